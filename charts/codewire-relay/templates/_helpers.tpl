@@ -67,3 +67,10 @@ Return the image tag to use.
 {{- define "codewire-relay.imageTag" -}}
 {{- default .Chart.AppVersion .Values.image.tag }}
 {{- end }}
+
+{{/*
+Whether relay state lives in PostgreSQL rather than on the data volume.
+*/}}
+{{- define "codewire-relay.database" -}}
+{{- if or .Values.relay.database.url .Values.relay.database.existingSecret.name }}true{{- end }}
+{{- end }}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func applyCmd() *cobra.Command {
+	var opts client.ApplyOptions
+
+	cmd := &cobra.Command{
+		Use:   "apply <manifest.yaml>",
+		Short: "Launch, retag or kill sessions to match a manifest",
+		Long: `Reconcile the node's sessions with a YAML manifest of named sessions. A
+listed session that is not running or queued is launched; one whose tags
+differ is retagged. With --prune, running sessions launched from the same
+manifest that it no longer lists are killed. Sessions are matched by name.
+
+A running session whose command has changed is left alone, since
+relaunching it would lose its state; kill it and apply again to relaunch it.
+
+The changes are printed as a diff first: + launch, ~ retag, - kill and
+= unchanged. --dry-run stops there.
+
+  name: review-cohort          # for --prune; defaults to the file name
+  sessions:
+    - name: planner
+      command: [claude, --dangerously-skip-permissions]
+      dir: ./app               # relative to the manifest; the default
+      env: {MODEL: opus}
+      tags: [cohort]
+      labels: {role: planner}
+      worktree: planner        # optional, as cw run --worktree
+      stdin: "Plan the refactor in PLAN.md\n"
+
+Sessions cw apply launches get the label codewire/manifest=<name>.`,
+		Example: `  cw apply agents.yaml --dry-run
+  cw apply agents.yaml
+  cw apply agents.yaml --prune`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifest, err := client.LoadManifest(args[0])
+			if err != nil {
+				return err
+			}
+
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.Apply(cmd.Context(), target, manifest, opts)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.Prune, "prune", false, "Kill running sessions from this manifest that it no longer lists")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "Print the changes without making them")
+	cmd.Flags().BoolVarP(&opts.JSON, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
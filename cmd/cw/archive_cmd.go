@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func archiveCmd() *cobra.Command {
+	var (
+		before     string
+		jsonOutput bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "archive [session]",
+		Short: "Archive finished sessions, removing them from the session list",
+		Long: `Bundle a finished session's metadata, output log, messages and events into a
+compressed archive (a .tar.gz file) and remove the session from the node.
+With --before, archive every finished session that completed longer ago
+than that (e.g. 12h, 30d) instead.
+
+Archives are kept in the archive directory, "archive" in the node's data
+directory unless config.toml says otherwise. With an S3 bucket configured,
+each archive is also uploaded there:
+
+  [archive]
+  dir = "/var/lib/cw-archive"
+  s3_bucket = "my-bucket"
+  s3_prefix = "codewire/archive"
+  s3_region = "eu-west-1"        # default AWS_REGION, then us-east-1
+  s3_endpoint = ""               # for S3-compatible services
+
+S3 credentials come from the node's AWS_ACCESS_KEY_ID and
+AWS_SECRET_ACCESS_KEY (and AWS_SESSION_TOKEN). Archives are listed by
+'cw archive list' and brought back by 'cw archive restore'.`,
+		Example: `  cw archive planner
+  cw archive --before 30d
+  cw archive list
+  cw archive restore 12`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: sessionCompletionFunc,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 1) == (before != "") {
+				return fmt.Errorf("give either a session or --before")
+			}
+
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			if before != "" {
+				age, err := client.ParseAge(before)
+				if err != nil {
+					return fmt.Errorf("--before: %w", err)
+				}
+				return client.Archive(cmd.Context(), target, nil, age, jsonOutput)
+			}
+
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
+			if err != nil {
+				return err
+			}
+			return client.Archive(cmd.Context(), target, &resolved, 0, jsonOutput)
+		},
+	}
+
+	cmd.Flags().StringVar(&before, "before", "", "Archive the sessions that completed longer ago than this (e.g. 30d)")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	cmd.AddCommand(archiveListCmd(), archiveRestoreCmd())
+
+	return cmd
+}
+
+func archiveListCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the node's session archives",
+		Long: `List the archives in the node's archive directory, with the sessions they
+hold. Archives only kept in S3 are not listed; restore them by file name.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.ArchiveList(cmd.Context(), target, jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
+
+func archiveRestoreCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "restore <archive>",
+		Short: "Bring an archived session back into the session list",
+		Long: `Restore an archived session, given as the archive's file name or the ID of
+the session it holds (its latest archive), as 'cw archive list' shows them.
+An archive missing from the archive directory is downloaded from the
+configured S3 bucket. The session comes back finished, with its logs,
+messages and events, under its old ID unless another session has taken it;
+it does not get its name back. The local archive is removed, copies in S3
+are kept.`,
+		Example: `  cw archive restore 12
+  cw archive restore 12-20260914T081502Z.tar.gz`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.RestoreArchive(cmd.Context(), target, args[0], jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output the restored session's archive as JSON")
+
+	return cmd
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/config"
+)
+
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show and change settings in config.toml",
+		Long: `Show and change settings in config.toml, in the data directory.
+
+Each setting is resolved from, highest precedence first:
+  1. a command-line flag, where the command has one (e.g. --server, --tag)
+  2. its environment variable (e.g. CODEWIRE_SERVER)
+  3. config.toml
+  4. the default
+
+The data directory itself is --data-dir, then CODEWIRE_DIR, then
+~/.codewire. cw config list shows every setting, its value and where the
+value came from. Settings the node reads take effect when it restarts.`,
+	}
+	cmd.AddCommand(configGetCmd(), configSetCmd(), configUnsetCmd(), configListCmd())
+	return cmd
+}
+
+func configGetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "get <key>",
+		Short:             "Print a setting's effective value",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: settingCompletionFunc,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := config.LookupSetting(args[0]); err != nil {
+				return err
+			}
+			values, err := config.EffectiveSettings(dataDir())
+			if err != nil {
+				return err
+			}
+			for _, v := range values {
+				if v.Key == args[0] {
+					fmt.Println(v.Value)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func configSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "set <key> <value>",
+		Short:             "Set a setting in config.toml",
+		Example:           "  cw config set client.detach_key ctrl-a\n  cw config set client.tags team-a,nightly\n  cw config set client.server gpu-box",
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: settingCompletionFunc,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := config.SetSetting(dataDir(), args[0], args[1]); err != nil {
+				return err
+			}
+			successMsg("%s = %s", args[0], args[1])
+			warnEnvOverride(args[0])
+			return nil
+		},
+	}
+}
+
+func configUnsetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "unset <key>",
+		Short:             "Remove a setting from config.toml, restoring its default",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: settingCompletionFunc,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := config.UnsetSetting(dataDir(), args[0]); err != nil {
+				return err
+			}
+			successMsg("%s unset", args[0])
+			warnEnvOverride(args[0])
+			return nil
+		},
+	}
+}
+
+func configListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List settings with their values and sources",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values, err := config.EffectiveSettings(dataDir())
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			tableHeader(w, "KEY", "VALUE", "SOURCE")
+			fmt.Fprintf(w, "%s\t%s\t%s\n", "data_dir", dataDir(), dim(dataDirSource()))
+			for _, v := range values {
+				value := v.Value
+				switch {
+				case value == "":
+					value = dim("-")
+				case v.Secret:
+					value = "********"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", v.Key, value, dim(v.Source))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+// dataDirSource describes where dataDir came from, like SettingValue.Source.
+func dataDirSource() string {
+	switch {
+	case dataDirFlag != "":
+		return "flag --data-dir"
+	case os.Getenv("CODEWIRE_DIR") != "":
+		return "env CODEWIRE_DIR"
+	}
+	return "default"
+}
+
+// warnEnvOverride notes on stderr when key's environment variable is set,
+// since it takes precedence over config.toml.
+func warnEnvOverride(key string) {
+	s, err := config.LookupSetting(key)
+	if err == nil && s.Env != "" && os.Getenv(s.Env) != "" {
+		fmt.Fprintf(os.Stderr, "  %s %s is set and overrides config.toml\n", yellowErr("!"), s.Env)
+	}
+}
+
+func settingCompletionFunc(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	keys := make([]string, 0, len(config.Settings))
+	for _, s := range config.Settings {
+		keys = append(keys, s.Key+"\t"+s.Usage)
+	}
+	return keys, cobra.ShellCompDirectiveNoFileComp
+}
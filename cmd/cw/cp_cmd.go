@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func cpCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cp <src> <dst>",
+		Short: "Copy a file to or from a session's working directory",
+		Long: `Copy a file between the local filesystem and a session's working directory,
+streamed over the node connection. Give the session side as
+[<server>/]<session>:<path>, with the path relative to the session's working
+directory; <server> is a name from 'cw server add' and defaults to --server
+or the local node.
+
+The file is written under a temporary name and moved into place only once
+its SHA-256 matches the sender's. A destination that is a directory, or an
+empty session path, keeps the source's name. Local paths containing a colon
+must start with ./ or /.`,
+		Example: `  cw cp ./notes.md planner:docs/notes.md     # upload
+  cw cp planner:dist/app.tar.gz .              # download
+  cw cp mynode/planner:build.log ./logs/       # from a remote node`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			srcServer, srcSession, srcPath, srcRemote := parseSessionPath(args[0])
+			dstServer, dstSession, dstPath, dstRemote := parseSessionPath(args[1])
+			switch {
+			case srcRemote && dstRemote:
+				return fmt.Errorf("cannot copy between two sessions; copy to a local file first")
+			case !srcRemote && !dstRemote:
+				return fmt.Errorf("one side must be a session path (<session>:<path>)")
+			}
+
+			server, session := dstServer, dstSession
+			if srcRemote {
+				server, session = srcServer, srcSession
+			}
+
+			var target *client.Target
+			var err error
+			if server != "" {
+				target, err = client.ResolveTarget(dataDir(), server, tokenFlag)
+			} else {
+				target, err = resolveTarget()
+			}
+			if err != nil {
+				return err
+			}
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			id, err := client.ResolveSessionArg(cmd.Context(), target, session)
+			if err != nil {
+				return err
+			}
+
+			progress := isatty.IsTerminal(os.Stderr.Fd())
+			if srcRemote {
+				return client.CopyFromSession(cmd.Context(), target, id, srcPath, dstPath, progress)
+			}
+			return client.CopyToSession(cmd.Context(), target, id, srcPath, dstPath, progress)
+		},
+	}
+}
+
+// parseSessionPath splits "[<server>/]<session>:<path>". remote is false for
+// a local path: one without a colon, or starting with / or ., so a local
+// file whose name contains a colon can be given as ./name.
+func parseSessionPath(s string) (server, session, path string, remote bool) {
+	if strings.HasPrefix(s, "/") || strings.HasPrefix(s, ".") {
+		return "", "", s, false
+	}
+	prefix, path, found := strings.Cut(s, ":")
+	if !found || prefix == "" {
+		return "", "", s, false
+	}
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		server, session = prefix[:i], prefix[i+1:]
+	} else {
+		session = prefix
+	}
+	if session == "" {
+		return "", "", s, false
+	}
+	return server, session, path, true
+}
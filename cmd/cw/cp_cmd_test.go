@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestParseSessionPath(t *testing.T) {
+	tests := []struct {
+		input                 string
+		server, session, path string
+		remote                bool
+	}{
+		{"planner:out/report.md", "", "planner", "out/report.md", true},
+		{"planner:", "", "planner", "", true},
+		{"3:build.log", "", "3", "build.log", true},
+		{"mynode/planner:relative/path", "mynode", "planner", "relative/path", true},
+
+		// Local paths.
+		{"notes.md", "", "", "notes.md", false},
+		{"dir/notes.md", "", "", "dir/notes.md", false},
+		{"./a:b", "", "", "./a:b", false},
+		{"/tmp/a:b", "", "", "/tmp/a:b", false},
+		{":x", "", "", ":x", false},
+		{"mynode/:x", "", "", "mynode/:x", false},
+	}
+
+	for _, tt := range tests {
+		server, session, path, remote := parseSessionPath(tt.input)
+		if server != tt.server || session != tt.session || path != tt.path || remote != tt.remote {
+			t.Errorf("parseSessionPath(%q) = %q, %q, %q, %v; want %q, %q, %q, %v",
+				tt.input, server, session, path, remote, tt.server, tt.session, tt.path, tt.remote)
+		}
+	}
+}
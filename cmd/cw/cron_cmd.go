@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func cronCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cron",
+		Short: "Schedule recurring sessions",
+		Long: `Schedule sessions that the node launches on a cron schedule. Jobs are stored
+in the node's cron.json and survive restarts. Each run is a normal session
+named after the job, with a session.scheduled_run event recording which job
+and schedule time launched it.
+
+Schedules use the five cron fields (minute hour day-of-month month
+day-of-week) in the node's local time, or @hourly, @daily, @weekly,
+@monthly, @yearly and "@every <duration>".`,
+	}
+
+	cmd.AddCommand(
+		cronAddCmd(),
+		cronListCmd(),
+		cronRemoveCmd(),
+	)
+
+	return cmd
+}
+
+func cronAddCmd() *cobra.Command {
+	var (
+		workDir     string
+		tags        []string
+		envVars     []string
+		missed      string
+		budgetSpecs []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add <name> <schedule> -- command...",
+		Short: "Add a cron job",
+		Example: `  cw cron add nightly-review "0 2 * * *" -- claude -p "review open PRs"
+  cw cron add deps "@weekly" --tag maintenance -- claude -p "update dependencies"
+  cw cron add poll "@every 15m" --missed run-once -- ./poll.sh`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dash := cmd.ArgsLenAtDash()
+			if dash == -1 || len(args) == dash {
+				return fmt.Errorf("command required\n\nUsage: cw cron add <name> <schedule> -- <command> [args...]")
+			}
+			if dash != 2 {
+				return fmt.Errorf("expected <name> <schedule> before --")
+			}
+
+			if workDir == "" {
+				workDir, _ = os.Getwd()
+			}
+
+			job := protocol.CronJob{
+				Name:       args[0],
+				Schedule:   args[1],
+				Command:    args[2:],
+				WorkingDir: workDir,
+				Env:        envVars,
+				Tags:       tags,
+				MissedRun:  missed,
+			}
+			if len(budgetSpecs) > 0 {
+				budget, err := client.ParseBudget(budgetSpecs)
+				if err != nil {
+					return err
+				}
+				job.Budget = budget
+			}
+
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.CronAdd(cmd.Context(), target, job)
+		},
+	}
+
+	cmd.Flags().StringVarP(&workDir, "dir", "d", "", "Working directory for the sessions")
+	cmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Tags for the sessions (can be repeated)")
+	cmd.Flags().StringArrayVarP(&envVars, "env", "e", nil, "Environment variable overrides (KEY=VALUE, can be repeated)")
+	cmd.Flags().StringVar(&missed, "missed", "skip", "Runs missed while the node was down: skip, or run-once on startup")
+	cmd.Flags().StringArrayVar(&budgetSpecs, "budget", nil, "Agent budget: tool calls enforced by cw hook, cost in dollars by the node (e.g. tools=200,bash=50,writes=100,cost=5)")
+	_ = cmd.RegisterFlagCompletionFunc("tag", tagCompletionFunc)
+	_ = cmd.RegisterFlagCompletionFunc("missed", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"skip", "run-once"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return cmd
+}
+
+func cronListCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List cron jobs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.CronList(cmd.Context(), target, jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
+
+func cronRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a cron job (sessions it launched keep running)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.CronRemove(cmd.Context(), target, args[0])
+		},
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func forwardCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "forward <node> <port-spec>...",
+		Short: "Forward local TCP ports to a node",
+		Long: `Forward local TCP ports through the connection to a node, so servers started
+by its sessions can be reached from this machine. <node> is a name from
+'cw server add' or a URL. Each <port-spec> is
+
+  [<bind-address>:]<local-port>:<host>:<port>
+
+where <host>:<port> is reached from the node; <host> is usually localhost.
+<local-port> alone forwards the same port on the node's localhost, and
+<local-port>:<port> a different one. Local ports listen on 127.0.0.1 unless a
+bind address is given.
+
+All ports share one connection to the node, and run until interrupted.
+Forwarding needs a token with admin scope.`,
+		Example: `  cw forward mynode 8080:localhost:3000
+  cw forward mynode 3000 5432:db.internal:5432
+  cw forward mynode 0.0.0.0:8080:localhost:8080`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			specs := make([]client.ForwardSpec, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				spec, err := parseForwardSpec(arg)
+				if err != nil {
+					return err
+				}
+				specs = append(specs, spec)
+			}
+
+			target, err := client.ResolveTarget(dataDir(), args[0], tokenFlag)
+			if err != nil {
+				return err
+			}
+			return client.Forward(cmd.Context(), target, specs)
+		},
+	}
+}
+
+// parseForwardSpec parses "[<bind>:]<local>:<host>:<port>", "<local>:<port>"
+// or "<local>", the last two forwarding to localhost on the node. An IPv6
+// bind address or host is given in brackets.
+func parseForwardSpec(s string) (client.ForwardSpec, error) {
+	parts, err := splitForwardSpec(s)
+	if err != nil {
+		return client.ForwardSpec{}, err
+	}
+
+	bind, host := "127.0.0.1", "localhost"
+	var local, remote string
+	switch len(parts) {
+	case 1:
+		local, remote = parts[0], parts[0]
+	case 2:
+		local, remote = parts[0], parts[1]
+	case 3:
+		local, host, remote = parts[0], parts[1], parts[2]
+	case 4:
+		bind, local, host, remote = parts[0], parts[1], parts[2], parts[3]
+	default:
+		return client.ForwardSpec{}, fmt.Errorf("invalid port spec %q: want [bind:]local-port:host:port", s)
+	}
+
+	localPort, err := strconv.ParseUint(local, 10, 16)
+	if err != nil {
+		return client.ForwardSpec{}, fmt.Errorf("invalid port spec %q: bad local port %q", s, local)
+	}
+	port, err := strconv.ParseUint(remote, 10, 16)
+	if err != nil || port == 0 {
+		return client.ForwardSpec{}, fmt.Errorf("invalid port spec %q: bad port %q", s, remote)
+	}
+	if host == "" {
+		return client.ForwardSpec{}, fmt.Errorf("invalid port spec %q: empty host", s)
+	}
+	return client.ForwardSpec{
+		Listen: net.JoinHostPort(bind, strconv.FormatUint(localPort, 10)),
+		Host:   host,
+		Port:   int(port),
+	}, nil
+}
+
+// splitForwardSpec splits s at colons outside brackets, unbracketing the
+// parts.
+func splitForwardSpec(s string) ([]string, error) {
+	var parts []string
+	for s != "" {
+		if strings.HasPrefix(s, "[") {
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid port spec: missing ] in %q", s)
+			}
+			parts = append(parts, s[1:end])
+			s = s[end+1:]
+			if s != "" && !strings.HasPrefix(s, ":") {
+				return nil, fmt.Errorf("invalid port spec: expected : after ] in %q", s)
+			}
+			s = strings.TrimPrefix(s, ":")
+			continue
+		}
+		part, rest, found := strings.Cut(s, ":")
+		parts = append(parts, part)
+		s = rest
+		if found && s == "" {
+			parts = append(parts, "")
+		}
+	}
+	return parts, nil
+}
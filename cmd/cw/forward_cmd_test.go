@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func TestParseForwardSpec(t *testing.T) {
+	tests := []struct {
+		input string
+		want  client.ForwardSpec
+	}{
+		{"8080:localhost:3000", client.ForwardSpec{Listen: "127.0.0.1:8080", Host: "localhost", Port: 3000}},
+		{"3000", client.ForwardSpec{Listen: "127.0.0.1:3000", Host: "localhost", Port: 3000}},
+		{"8080:3000", client.ForwardSpec{Listen: "127.0.0.1:8080", Host: "localhost", Port: 3000}},
+		{"5432:db.internal:5432", client.ForwardSpec{Listen: "127.0.0.1:5432", Host: "db.internal", Port: 5432}},
+		{"0.0.0.0:8080:localhost:80", client.ForwardSpec{Listen: "0.0.0.0:8080", Host: "localhost", Port: 80}},
+		{"[::1]:8080:[fd00::2]:80", client.ForwardSpec{Listen: "[::1]:8080", Host: "fd00::2", Port: 80}},
+		{"0:localhost:3000", client.ForwardSpec{Listen: "127.0.0.1:0", Host: "localhost", Port: 3000}},
+	}
+	for _, tt := range tests {
+		got, err := parseForwardSpec(tt.input)
+		if err != nil {
+			t.Errorf("parseForwardSpec(%q): %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseForwardSpec(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "http", "8080:", "8080::3000", "70000:localhost:80", "8080:localhost:0", "a:b:c:d:e", "[::1:8080:x:1"} {
+		if _, err := parseForwardSpec(bad); err == nil {
+			t.Errorf("parseForwardSpec(%q): expected error", bad)
+		}
+	}
+}
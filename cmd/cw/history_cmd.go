@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func historyCmd() *cobra.Command {
+	var (
+		limit      int
+		all        bool
+		jsonOutput bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "history [query]",
+		Short: "Show the history of launched sessions",
+		Long: `Show the sessions the node has launched, oldest first, with how they ended.
+Unlike 'cw list', the history keeps every session, however long ago it ran,
+in history.jsonl in the node's data directory. A query shows only entries
+whose command, working directory, name, tags or labels contain it, ignoring
+case.
+
+Each entry records the command, working directory (and worktree), env, tags
+and labels it was launched with, which 'cw history rerun' launches again.
+Secrets and the variables listed in the node's redact.env are not recorded.`,
+		Example: `  cw history
+  cw history pytest -n 5
+  cw history --all --json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			var query string
+			if len(args) > 0 {
+				query = args[0]
+			}
+			if all {
+				limit = 0
+			}
+			return client.History(cmd.Context(), target, query, limit, jsonOutput)
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of most recent entries to show")
+	cmd.Flags().BoolVarP(&all, "all", "a", false, "Show every entry")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	cmd.AddCommand(historyRerunCmd())
+
+	return cmd
+}
+
+func historyRerunCmd() *cobra.Command {
+	var (
+		name       string
+		jsonOutput bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rerun <entry>",
+		Short: "Launch a history entry's command again",
+		Long: `Launch a new session with the command, working directory (and worktree),
+env, tags and labels of a history entry, as numbered by 'cw history'. The
+session gets the node's default budget and a generated name unless --name
+is given.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid history entry %q", args[0])
+			}
+
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.HistoryRerun(cmd.Context(), target, n, name, jsonOutput)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Unique name for the new session (alphanumeric + hyphens, 1-32 chars)")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output the new session's info as JSON")
+
+	return cmd
+}
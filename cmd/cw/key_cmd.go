@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func keyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "key",
+		Short: "Manage SSH keys for reaching this node through the relay",
+		Long: `Manage the public keys that may log in to this node through the relay's SSH
+listener, for machines where cw isn't installed. Keys are stored on the relay
+and apply only to this node. Use the node name as the SSH user:
+
+  ssh -p 2222 <node>@<relay-host> list
+  ssh -t -p 2222 <node>@<relay-host> cw-attach <session>
+
+Requires the node registered with 'cw relay-setup'.`,
+	}
+
+	cmd.AddCommand(
+		keyAddCmd(),
+		keyListCmd(),
+		keyRemoveCmd(),
+	)
+
+	return cmd
+}
+
+func keyAddCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add <public-key-file | public-key | ->",
+		Short: "Allow a public key to log in",
+		Example: `  cw key add ~/.ssh/id_ed25519.pub
+  cw key add "ssh-ed25519 AAAAC3Nz... alice@laptop"
+  curl -s https://github.com/alice.keys | head -1 | cw key add -`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := readPublicKeyArg(args[0])
+			if err != nil {
+				return err
+			}
+			return client.SSHKeyAdd(dataDir(), key)
+		},
+	}
+}
+
+// readPublicKeyArg returns the authorized_keys line given directly, in a
+// file, or on stdin for "-".
+func readPublicKeyArg(arg string) (string, error) {
+	var data []byte
+	var err error
+	switch {
+	case arg == "-":
+		data, err = io.ReadAll(os.Stdin)
+	case strings.Contains(arg, " "):
+		data = []byte(arg)
+	default:
+		data, err = os.ReadFile(arg)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading public key: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func keyListCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List keys allowed to log in",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.SSHKeyList(dataDir(), jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
+
+func keyRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <fingerprint>",
+		Short: "Remove a key by its SHA256 fingerprint",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.SSHKeyRemove(dataDir(), args[0])
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func keysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "List and rotate the relay tokens of nodes and client devices",
+		Long: `List and rotate the tokens nodes and client devices use with the relay.
+Tokens are identified by the start of their SHA-256 hash; the tokens
+themselves are never shown.
+
+Rotating a node's token sends the new token over the node's relay
+connection. The node saves it and reconnects with it, and the relay only
+then revokes the old token, so the node stays reachable throughout. Client
+tokens cannot be rotated: revoke the device with 'cw revoke' and invite it
+again.
+
+These are relay credentials; 'cw key' manages the SSH keys that may log in
+to this node.`,
+	}
+
+	cmd.AddCommand(
+		keysListCmd(),
+		keysRotateCmd(),
+	)
+
+	return cmd
+}
+
+func keysListCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List node and client tokens with when they were issued and last used",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.KeyList(dataDir(), jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
+
+func keysRotateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rotate <node>",
+		Short: "Issue a node a new token and revoke the old one",
+		Long: `Issue a node a new relay token over its relay connection and revoke the old
+token once the node reconnects with the new one. The node must be connected.
+If it does not reconnect within 30 seconds the old token stays valid.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.KeyRotate(dataDir(), args[0])
+		},
+	}
+}
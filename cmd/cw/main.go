@@ -1,25 +1,36 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 
+	"github.com/codewiresh/codewire/internal/agent"
 	"github.com/codewiresh/codewire/internal/client"
 	"github.com/codewiresh/codewire/internal/config"
 	"github.com/codewiresh/codewire/internal/mcp"
 	"github.com/codewiresh/codewire/internal/node"
+	"github.com/codewiresh/codewire/internal/notify"
+	"github.com/codewiresh/codewire/internal/protocol"
 	"github.com/codewiresh/codewire/internal/relay"
+	"github.com/codewiresh/codewire/internal/secrets"
+	"github.com/codewiresh/codewire/internal/terminal"
 	"github.com/codewiresh/codewire/internal/update"
 )
 
@@ -27,20 +38,35 @@ var (
 	// version is set at build time via -ldflags "-X main.version=..."
 	version = "dev"
 
-	serverFlag string
-	tokenFlag  string
+	serverFlag  string
+	tokenFlag   string
+	nodeFlag    string
+	dataDirFlag string
+	colorFlag   string
 )
 
 func main() {
 	rootCmd := &cobra.Command{
-		Use:          "cw",
-		Short:        "Codewire CLI",
-		Long:         "  ▸ codewire\n\n  Persistent process server and agent-first dev environments.",
-		Version:      version,
-		SilenceUsage: true,
+		Use:           "cw",
+		Short:         "Codewire CLI",
+		Long:          "  ▸ codewire\n\n  Persistent process server and agent-first dev environments.",
+		Version:       version,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	rootCmd.PersistentFlags().StringVarP(&serverFlag, "server", "s", "", "Connect to a remote server (name from servers.toml, ws://host:port or ssh://[user@]host)")
+	rootCmd.PersistentFlags().StringVar(&tokenFlag, "token", "", "Auth token for a remote server, or for a local node run by another user")
+	rootCmd.PersistentFlags().StringVar(&nodeFlag, "node", "", "With --server set to a relay, connect to this node through the relay")
+	rootCmd.PersistentFlags().StringVar(&dataDirFlag, "data-dir", "", "Data directory (default: $CODEWIRE_DIR or ~/.codewire)")
+	rootCmd.PersistentFlags().StringVar(&colorFlag, "color", "", "Colored output: auto, always or never (default: client.color)")
+	_ = rootCmd.RegisterFlagCompletionFunc("color", cobra.FixedCompletions([]string{"auto", "always", "never"}, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// Processes cw starts, like the node, inherit the data directory.
+		if dataDirFlag != "" {
+			os.Setenv("CODEWIRE_DIR", dataDirFlag)
+		}
+		return setupColor(colorFlag)
 	}
-	rootCmd.PersistentFlags().StringVarP(&serverFlag, "server", "s", "", "Connect to a remote server (name from servers.toml or ws://host:port)")
-	rootCmd.PersistentFlags().StringVar(&tokenFlag, "token", "", "Auth token for remote server")
 
 	// Disable cobra's auto-generated completion command; we supply our own with --install support.
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
@@ -65,12 +91,31 @@ func main() {
 		grouped(attachCmd(), "session"),
 		grouped(killCmd(), "session"),
 		grouped(logsCmd(), "session"),
+		grouped(exportCmd(), "session"),
+		grouped(replayCmd(), "session"),
 		grouped(sendCmd(), "session"),
+		grouped(pipeCmd(), "session"),
+		grouped(cpCmd(), "session"),
 		grouped(watchCmd(), "session"),
 		grouped(statusCmd(), "session"),
+		grouped(screenCmd(), "session"),
+		grouped(renameCmd(), "session"),
+		grouped(forkCmd(), "session"),
+		grouped(resumeCmd(), "session"),
+		grouped(historyCmd(), "session"),
+		grouped(statsCmd(), "session"),
+		grouped(timelineCmd(), "session"),
+		grouped(archiveCmd(), "session"),
+		grouped(applyCmd(), "session"),
+		grouped(topCmd(), "session"),
+		grouped(layoutCmd(), "session"),
 		grouped(platformListCmd(), "session"),
 		grouped(subscribeCmd(), "session"),
 		grouped(waitSessionCmd(), "session"),
+		grouped(notifyCmd(), "session"),
+		grouped(cronCmd(), "session"),
+		grouped(worktreeCmd(), "session"),
+		grouped(scriptCmd(), "session"),
 		// Platform
 		grouped(loginCmd(), "platform"),
 		grouped(logoutCmd(), "platform"),
@@ -89,8 +134,13 @@ func main() {
 		grouped(qrCmd(), "network"),
 		grouped(nodesCmd(), "network"),
 		grouped(serverCmd(), "network"),
+		grouped(webhookCmd(), "network"),
 		grouped(inviteCmd(), "network"),
 		grouped(revokeCmd(), "network"),
+		grouped(tokenCmd(), "network"),
+		grouped(keyCmd(), "network"),
+		grouped(keysCmd(), "network"),
+		grouped(forwardCmd(), "network"),
 		// Messaging
 		grouped(msgCmd(), "messaging"),
 		grouped(inboxCmd(), "messaging"),
@@ -102,25 +152,47 @@ func main() {
 		grouped(hookCmd(), "agent"),
 		grouped(mcpServerCmd(), "agent"),
 		grouped(kvCmd(), "agent"),
+		grouped(secretCmd(), "agent"),
 		// System
+		grouped(configCmd(), "system"),
 		grouped(completionCmd(rootCmd), "system"),
-		grouped(updateCmd(), "system"),
+		grouped(schemaCmd(), "system"),
+		grouped(upgradeCmd(), "system"),
 	)
 
 	printUpdateNotice := update.BackgroundCheck(version)
-	err := rootCmd.Execute()
+	ctx := interruptContext()
+	err := rootCmd.ExecuteContext(ctx)
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		// Interrupted: the requests in flight were cancelled, nothing failed.
+		os.Exit(130)
+	}
 	if !isUpdateCommand() {
-		printUpdateNotice()
+		printUpdateNotice(stderrColor)
 	}
 	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 	}
 }
 
-// isUpdateCommand returns true when the user invoked "cw update".
+// interruptContext returns a context cancelled by the first SIGINT or
+// SIGTERM, which closes the connections of the requests in flight. A second
+// signal kills cw as usual.
+func interruptContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
+// isUpdateCommand returns true when the user invoked "cw upgrade" or its
+// alias "cw update".
 func isUpdateCommand() bool {
 	for _, arg := range os.Args[1:] {
-		if arg == "update" {
+		if arg == "upgrade" || arg == "update" {
 			return true
 		}
 		if !strings.HasPrefix(arg, "-") {
@@ -141,20 +213,82 @@ func grouped(cmd *cobra.Command, id string) *cobra.Command {
 // ---------------------------------------------------------------------------
 
 func nodeCmd() *cobra.Command {
+	var (
+		handoff bool
+		daemon  bool
+		logFile bool
+	)
+
 	cmd := &cobra.Command{
 		Use:   "node",
 		Short: "Start the codewire node",
+		Long: `Start the codewire node.
+
+With --handoff the new node takes over from the node already running, for
+example after upgrading cw: the running node passes its socket and its
+sessions' terminals to the new process and exits, and the sessions keep
+running. Exit codes of sessions taken over this way are reported as -1.
+
+With --daemon the node detaches from the terminal and this command returns
+once it is accepting connections. A daemonized node, like one started
+automatically by other commands, writes its logs to node.log in the data
+directory (see 'cw node logs'), rotating it at 10 MiB.
+
+A node that sets node.update_channel follows that update channel of its
+relay (see 'cw relay channel'): when the channel asks for another version,
+the node downloads the release, verifies its signed checksums and restarts
+into it, by handoff or, under systemd or launchd, through the service
+manager.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			dir := dataDir()
 			if err := os.MkdirAll(dir, 0o755); err != nil {
 				return fmt.Errorf("creating data dir: %w", err)
 			}
 
-			n, err := node.NewNode(dir)
+			if daemon {
+				var extra []string
+				if handoff {
+					extra = append(extra, "--handoff")
+				}
+				pid, err := spawnNode(dir, extra...)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "[cw] node started (pid %d), logging to %s\n", pid, node.LogPath(dir))
+				return nil
+			}
+
+			if logFile {
+				cfg, err := config.LoadConfig(dir)
+				if err != nil {
+					return err
+				}
+				lf, err := node.OpenLog(dir, int64(cfg.Node.LogMaxSize)<<20, cfg.Node.LogFiles)
+				if err != nil {
+					return err
+				}
+				defer lf.Close()
+				slog.SetDefault(slog.New(slog.NewJSONHandler(lf, nil)))
+			}
+
+			var h *node.Handoff
+			if handoff {
+				var err error
+				if h, err = node.ReceiveHandoff(dir); err != nil {
+					return fmt.Errorf("taking over from running node: %w", err)
+				}
+				fmt.Fprintln(os.Stderr, "[cw] took over from the running node")
+			}
+
+			n, err := node.NewNodeFromHandoff(dir, h)
 			if err != nil {
+				if h != nil {
+					h.Close()
+				}
 				return fmt.Errorf("initializing node: %w", err)
 			}
 			defer n.Cleanup()
+			n.Version = version
 
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
@@ -167,10 +301,18 @@ func nodeCmd() *cobra.Command {
 				cancel()
 			}()
 
-			return n.Run(ctx)
+			err = n.Run(ctx)
+			if errors.Is(err, node.ErrRestart) {
+				fmt.Fprintln(os.Stderr, "[cw] updated, exiting for the service manager to restart the node")
+				os.Exit(node.ExitRestart)
+			}
+			return err
 		},
 	}
-	cmd.AddCommand(nodeStopCmd())
+	cmd.Flags().BoolVar(&handoff, "handoff", false, "Take over the running node's socket and sessions without stopping them")
+	cmd.Flags().BoolVar(&daemon, "daemon", false, "Run the node in the background")
+	cmd.Flags().BoolVar(&logFile, "log", false, "Write structured logs to node.log in the data directory instead of stderr")
+	cmd.AddCommand(nodeStopCmd(), nodeLogsCmd(), nodeInstallServiceCmd(), nodeStdioCmd(), nodeExportCmd(), nodeImportCmd())
 	return cmd
 }
 
@@ -190,17 +332,17 @@ func nodeStopCmd() *cobra.Command {
 				return fmt.Errorf("invalid pid file: %w", err)
 			}
 
-			if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
-				if err == syscall.ESRCH {
+			if err := stopNodeProcess(pid); err != nil {
+				if errors.Is(err, os.ErrProcessDone) {
 					// Process already gone — clean up stale files.
 					_ = os.Remove(pidPath)
 					fmt.Fprintln(os.Stderr, "[cw] node already stopped (stale pid file removed)")
 					return nil
 				}
-				return fmt.Errorf("sending SIGTERM to pid %d: %w", pid, err)
+				return fmt.Errorf("stopping node (pid %d): %w", pid, err)
 			}
 
-			fmt.Fprintf(os.Stderr, "[cw] sent SIGTERM to node (pid %d)\n", pid)
+			fmt.Fprintf(os.Stderr, "[cw] stopping node (pid %d)\n", pid)
 			return nil
 		},
 	}
@@ -218,17 +360,59 @@ func runCmd() *cobra.Command {
 		envVars     []string
 		autoApprove bool
 		promptFile  string
+		budgetSpecs []string
+		autoRespond []string
+		alerts      []string
+		alertNotify string
+		redact      []string
+		acceptFrom  []string
+		labels      []string
+		noQueue     bool
+		pool        string
+		worktree    string
+		dockerImage string
+		backend     string
+		backendOpts []string
+		k8s         bool
+		k8sImage    string
+		jsonOutput  bool
+		template    string
+		secretSpecs []string
+		nodeGroup   string
+		placement   string
 	)
 
 	cmd := &cobra.Command{
 		Use:     "run [name] [tag] -- command...",
 		Aliases: []string{},
 		Short:   "Launch a new session",
+		Long: `Launch a new session running command.
+
+The nearest .codewire.toml in --dir (or the current directory) or a parent
+sets defaults for the project: tags, a name prefix, environment variables,
+and templates run with --template. Flags override them.
+
+With --server set to a relay, --node-group launches the session on a node
+of that group, chosen by the relay's placement strategy or --placement:
+least-loaded (the node running the fewest sessions) or round-robin. Nodes
+join groups with cw relay-setup --group.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			target, err := resolveTarget()
 			if err != nil {
 				return err
 			}
+			if placement != "" && nodeGroup == "" {
+				return fmt.Errorf("--placement requires --node-group")
+			}
+			if nodeGroup != "" {
+				if target.Node != "" {
+					return fmt.Errorf("--node-group and --node are mutually exclusive")
+				}
+				if target.IsLocal() || target.SSH != "" {
+					return fmt.Errorf("--node-group requires --server set to a relay")
+				}
+				target.NodeGroup, target.Placement = nodeGroup, placement
+			}
 
 			if target.IsLocal() {
 				if err := ensureNode(); err != nil {
@@ -238,10 +422,14 @@ func runCmd() *cobra.Command {
 
 			dash := cmd.ArgsLenAtDash()
 			if dash == -1 {
-				if len(args) > 0 {
+				if template != "" {
+					// cw run planner --template review: no extra arguments.
+					dash = len(args)
+				} else if len(args) > 0 {
 					return fmt.Errorf("missing '--' before command\n\nDid you mean: cw run -- %s\n\nUsage: cw run [name] [tag] -- <command> [args...]", strings.Join(args, " "))
+				} else {
+					return fmt.Errorf("command required\n\nUsage: cw run [name] [tag] -- <command> [args...]")
 				}
-				return fmt.Errorf("command required\n\nUsage: cw run [name] [tag] -- <command> [args...]")
 			}
 
 			var command []string
@@ -265,13 +453,49 @@ func runCmd() *cobra.Command {
 				return fmt.Errorf("expected at most two positional args (name, tag) before --")
 			}
 
+			// Defaults come from .codewire.toml (and its --template),
+			// then config.toml.
+			project, err := config.FindProjectConfig(cmp.Or(workDir, "."))
+			if err != nil {
+				return err
+			}
+			var tmpl *config.RunTemplate
+			if template != "" {
+				if tmpl, err = project.Template(template); err != nil {
+					return err
+				}
+				command = append(slices.Clone(tmpl.Command), command...)
+				name = cmp.Or(name, tmpl.Name)
+				workDir = cmp.Or(workDir, tmpl.Dir)
+			}
 			if len(command) == 0 {
 				return fmt.Errorf("command required after --")
 			}
+			if name != "" && !strings.HasPrefix(name, project.NamePrefix) {
+				name = project.NamePrefix + name
+			}
+			envVars = append(project.Environ(tmpl), envVars...)
+			if len(tags) == 0 {
+				tags = project.Tags
+				if tmpl != nil {
+					tags = slices.Concat(project.Tags, tmpl.Tags)
+				}
+			}
+			cfg, err := config.LoadConfig(dataDir())
+			if err != nil {
+				return err
+			}
+			if len(tags) == 0 {
+				tags = cfg.Client.Tags
+			}
 
-			// If --auto-approve, inject --dangerously-skip-permissions after the binary.
-			if autoApprove && len(command) > 0 {
-				command = append([]string{command[0], "--dangerously-skip-permissions"}, command[1:]...)
+			// --auto-approve and --prompt-file depend on the agent CLI.
+			adapter := agent.Lookup(command, cfg.Agents)
+			if autoApprove {
+				if adapter == nil || len(adapter.AutoApprove) == 0 {
+					return fmt.Errorf("--auto-approve: no agent adapter for %q (known: %s; add one with [[agents]] in config.toml)", command[0], strings.Join(agent.Known(cfg.Agents), ", "))
+				}
+				command = adapter.WithAutoApprove(command)
 			}
 
 			// Default to current working directory if --dir not specified.
@@ -286,23 +510,156 @@ func runCmd() *cobra.Command {
 				if readErr != nil {
 					return fmt.Errorf("reading prompt file: %w", readErr)
 				}
+				if adapter != nil {
+					if adapter.Prompt == agent.PromptFile && !target.IsLocal() {
+						return fmt.Errorf("--prompt-file: %s reads its prompt from a file, which needs a local node", adapter.Binary)
+					}
+					var asStdin bool
+					if command, asStdin, err = adapter.WithPrompt(command, promptFile, stdinData); err != nil {
+						return err
+					}
+					if !asStdin {
+						stdinData = nil
+					}
+				}
 			}
 
-			return client.Run(target, command, workDir, name, envVars, stdinData, tags...)
+			opts := client.RunOptions{
+				WorkingDir: workDir,
+				Name:       name,
+				Env:        envVars,
+				StdinData:  stdinData,
+				Tags:       tags,
+				NoQueue:    noQueue,
+				Worktree:   worktree,
+				JSON:       jsonOutput,
+			}
+			if pool != "" {
+				if opts.Pool, opts.PoolSize, err = client.ParsePool(pool); err != nil {
+					return err
+				}
+			}
+			if len(budgetSpecs) > 0 {
+				if opts.Budget, err = client.ParseBudget(budgetSpecs); err != nil {
+					return err
+				}
+			}
+			if len(secretSpecs) > 0 {
+				if opts.Secrets, err = client.ResolveSecrets(cmd.Context(), target, dataDir(), secretSpecs); err != nil {
+					return err
+				}
+			}
+			if len(autoRespond) > 0 {
+				if opts.AutoRespond, err = client.ParseAutoRespond(autoRespond); err != nil {
+					return err
+				}
+			}
+			for _, p := range alerts {
+				if _, err := regexp.Compile(p); err != nil {
+					return fmt.Errorf("invalid --alert pattern %q: %w", p, err)
+				}
+			}
+			if alertNotify != "" {
+				if _, err := notify.Parse(alertNotify); err != nil {
+					return err
+				}
+			}
+			opts.Alerts, opts.AlertNotify = alerts, alertNotify
+			for _, p := range redact {
+				if _, err := regexp.Compile(p); err != nil {
+					return fmt.Errorf("invalid --redact pattern %q: %w", p, err)
+				}
+			}
+			opts.Redact = redact
+			opts.AcceptInputFrom = acceptFrom
+			if opts.Labels, err = protocol.ParseLabels(labels); err != nil {
+				return err
+			}
+			if opts.Backend, opts.BackendOptions, err = runBackend(backend, backendOpts, dockerImage, k8s, k8sImage); err != nil {
+				return err
+			}
+
+			return client.Run(cmd.Context(), target, command, opts)
 		},
 	}
 
 	cmd.Flags().StringVarP(&workDir, "dir", "d", "", "Working directory for the session")
-	cmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Tags for the session (can be repeated)")
+	cmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Tags for the session (can be repeated; default: tags from .codewire.toml, else client.tags)")
 	cmd.Flags().StringVar(&name, "name", "", "Unique name for the session (alphanumeric + hyphens, 1-32 chars)")
+	cmd.Flags().StringArrayVar(&labels, "label", nil, "Label as key=value, matched by --selector in list, kill, wait and subscribe (can be repeated)")
 	cmd.Flags().StringArrayVarP(&envVars, "env", "e", nil, "Environment variable overrides (KEY=VALUE, can be repeated)")
-	cmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "Inject --dangerously-skip-permissions after the command binary")
-	cmd.Flags().StringVar(&promptFile, "prompt-file", "", "File whose contents are injected as stdin after launch")
+	cmd.Flags().StringArrayVar(&secretSpecs, "secret", nil, "Environment variable from a secrets provider, as NAME@<ref> with <ref> one of "+secrets.Schemes+"; kept out of cw status, logs and sessions.json (can be repeated)")
+	cmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "Skip the agent's permission prompts with its adapter's flags (claude --dangerously-skip-permissions, aider --yes-always, codex --dangerously-bypass-approvals-and-sandbox, openhands --always-approve)")
+	cmd.Flags().StringVar(&promptFile, "prompt-file", "", "File whose contents are the agent's prompt: given as an argument or file path if its adapter says so, else injected as stdin after launch")
+	cmd.Flags().StringArrayVar(&budgetSpecs, "budget", nil, "Agent budget: tool calls enforced by cw hook, cost in dollars by the node (e.g. tools=200,bash=50,writes=100,cost=5; tools is per hour)")
+	cmd.Flags().StringArrayVar(&autoRespond, "auto-respond", nil, "Answer prompts as /pattern/flags=response: types response and Enter when the output matches, e.g. '/\\(y\\/n\\)\\s*$/i=y' (can be repeated)")
+	cmd.Flags().StringArrayVar(&alerts, "alert", nil, "Raise a session.alert event for output lines matching this regular expression, e.g. 'panic:|Traceback' (can be repeated)")
+	cmd.Flags().StringVar(&alertNotify, "alert-notify", "", "Also send alerts to this notification method ("+notify.Methods+")")
+	cmd.Flags().StringArrayVar(&redact, "redact", nil, "Mask output matching this regular expression in logs, cw watch and cw status, e.g. 'sk-[A-Za-z0-9]{20,}' (can be repeated)")
+	cmd.Flags().StringSliceVar(&acceptFrom, "accept-input-from", nil, "Who may send, msg or request the session: any, none, cli, shared-tag, tag:<tag> or session:<name|id> (comma-separated or repeated; default any)")
+	cmd.Flags().StringVar(&pool, "pool", "", "Concurrency pool as name=N: at most N sessions in the pool run at once, the rest queue")
+	cmd.Flags().BoolVar(&noQueue, "no-queue", false, "Fail instead of queueing when the node is at max_concurrent_sessions")
+	cmd.Flags().StringVar(&worktree, "worktree", "", "Run in a git worktree on its own branch of this name, created from --dir's repository (see cw worktree)")
+	cmd.Flags().StringVar(&backend, "backend", "", "Where the command runs: local (default), docker, kubernetes or ssh")
+	cmd.Flags().StringArrayVar(&backendOpts, "backend-opt", nil, "Backend option as key=value, e.g. image=node:22 or host=build-box (can be repeated)")
+	cmd.Flags().StringVar(&dockerImage, "docker", "", "Run the command in a container from this image, with --dir mounted; short for --backend docker --backend-opt image=<image>")
+	cmd.Flags().BoolVar(&k8s, "k8s", false, "Run the command in a Kubernetes pod from --image; short for --backend kubernetes --backend-opt image=<image>")
+	cmd.Flags().StringVar(&k8sImage, "image", "", "Image for --k8s")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output the launched session as JSON")
+	cmd.Flags().StringVarP(&template, "template", "T", "", "Run a [templates.<name>] command from .codewire.toml; arguments after -- are appended")
+	cmd.Flags().StringVar(&nodeGroup, "node-group", "", "Launch on a node of this group, chosen by the relay given with --server")
+	cmd.Flags().StringVar(&placement, "placement", "", "How the relay chooses the node for --node-group: "+strings.Join(relay.PlacementNames(), " or ")+" (default: the relay's)")
+	_ = cmd.RegisterFlagCompletionFunc("placement", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return relay.PlacementNames(), cobra.ShellCompDirectiveNoFileComp
+	})
+	_ = cmd.RegisterFlagCompletionFunc("template", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		project, err := config.FindProjectConfig(cmp.Or(workDir, "."))
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return project.TemplateNames(), cobra.ShellCompDirectiveNoFileComp
+	})
 	_ = cmd.RegisterFlagCompletionFunc("tag", tagCompletionFunc)
 
 	return cmd
 }
 
+// runBackend combines cw run's backend flags: --backend and --backend-opt,
+// and the shorthands --docker <image> and --k8s --image <image>.
+func runBackend(backend string, optSpecs []string, dockerImage string, k8s bool, image string) (string, map[string]string, error) {
+	opts, err := client.ParseBackendOptions(optSpecs)
+	if err != nil {
+		return "", nil, err
+	}
+	shorthand := func(name, flag, image string) error {
+		if backend != "" && backend != name {
+			return fmt.Errorf("%s cannot be combined with --backend %s", flag, backend)
+		}
+		backend = name
+		opts["image"] = image
+		return nil
+	}
+	switch {
+	case dockerImage != "" && k8s:
+		err = fmt.Errorf("--docker and --k8s cannot be combined")
+	case dockerImage != "":
+		err = shorthand("docker", "--docker", dockerImage)
+	case k8s && image == "":
+		err = fmt.Errorf("--k8s needs --image")
+	case k8s:
+		err = shorthand("kubernetes", "--k8s", image)
+	case image != "":
+		err = fmt.Errorf("--image is only used with --k8s")
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if len(opts) == 0 {
+		opts = nil
+	}
+	return backend, opts, nil
+}
+
 // ---------------------------------------------------------------------------
 // listCmd
 // ---------------------------------------------------------------------------
@@ -310,7 +667,12 @@ func runCmd() *cobra.Command {
 // ---------------------------------------------------------------------------
 
 func attachCmd() *cobra.Command {
-	var noHistory bool
+	var (
+		noHistory  bool
+		lowLatency bool
+		tmux       bool
+		tags       []string
+	)
 
 	cmd := &cobra.Command{
 		Use:               "attach [session]",
@@ -318,11 +680,26 @@ func attachCmd() *cobra.Command {
 		ValidArgsFunction: sessionCompletionFunc,
 		Long: `Attach to a running session's PTY for interactive use.
 
-Detach without killing: press Ctrl+B d
-The session continues running after you detach.
+Detach without killing: press Ctrl+B d (the prefix key is client.detach_key,
+see cw config). The session continues running after you detach.
 
-Warning: Ctrl+C sends SIGINT to the session process — use Ctrl+B d to detach safely.`,
+Warning: Ctrl+C sends SIGINT to the session process — use Ctrl+B d to detach safely.
+
+The node batches output for node.output_delay (5ms by default) before
+sending it; --low-latency sends every write at once, for interactive
+programs where echo latency matters.
+
+With --tmux, opens a tmux session with one pane per running session (only
+those with --tag, if given), each attached with cw attach. Save and restore
+pane arrangements with cw layout.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(tags) > 0 && !tmux {
+				return fmt.Errorf("--tag requires --tmux")
+			}
+			if tmux && len(args) > 0 {
+				return fmt.Errorf("--tmux attaches by tag; do not pass a session")
+			}
+
 			target, err := resolveTarget()
 			if err != nil {
 				return err
@@ -334,39 +711,144 @@ Warning: Ctrl+C sends SIGINT to the session process — use Ctrl+B d to detach s
 				}
 			}
 
+			if tmux {
+				return client.AttachTmux(cmd.Context(), target, tags, selfArgs())
+			}
+
 			var id *uint32
 			if len(args) > 0 {
-				resolved, err := client.ResolveSessionArg(target, args[0])
+				resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
 				if err != nil {
 					return err
 				}
 				id = &resolved
 			}
 
-			return client.Attach(target, id, noHistory)
+			prefix, err := detachKey()
+			if err != nil {
+				return err
+			}
+			return client.Attach(cmd.Context(), target, id, noHistory, lowLatency, prefix)
 		},
 	}
 
 	cmd.Flags().BoolVar(&noHistory, "no-history", false, "Do not replay session history")
+	cmd.Flags().BoolVar(&lowLatency, "low-latency", false, "Send output as soon as it is written, without the node's output_delay batching")
+	cmd.Flags().BoolVar(&tmux, "tmux", false, "Open a tmux session with one pane per running session")
+	cmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "With --tmux, only sessions with this tag (repeatable)")
+	_ = cmd.RegisterFlagCompletionFunc("tag", tagCompletionFunc)
+
+	return cmd
+}
+
+// ---------------------------------------------------------------------------
+// layoutCmd
+// ---------------------------------------------------------------------------
+
+func layoutCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "layout",
+		Short: "Save and restore tmux pane layouts of attached sessions",
+	}
+
+	cmd.AddCommand(
+		layoutSaveCmd(),
+		layoutRestoreCmd(),
+		layoutListCmd(),
+		layoutDeleteCmd(),
+	)
+
+	return cmd
+}
+
+func layoutSaveCmd() *cobra.Command {
+	var tmuxSession string
+
+	cmd := &cobra.Command{
+		Use:   "save <name>",
+		Short: "Save the codewire panes of a tmux session",
+		Long: `Save the panes of a tmux session that are attached to codewire sessions
+(for example one opened with cw attach --tmux), along with each window's
+pane arrangement. Defaults to the tmux session cw is running in.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.SaveLayout(dataDir(), args[0], tmuxSession)
+		},
+	}
+
+	cmd.Flags().StringVar(&tmuxSession, "tmux-session", "", "tmux session to save (default: current)")
 
 	return cmd
 }
 
+func layoutRestoreCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore <name>",
+		Short: "Recreate a saved layout in a new tmux session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.RestoreLayout(cmd.Context(), target, dataDir(), args[0], selfArgs())
+		},
+	}
+}
+
+func layoutListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List saved layouts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.ListLayouts(dataDir())
+		},
+	}
+}
+
+func layoutDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a saved layout",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.DeleteLayout(dataDir(), args[0])
+		},
+	}
+}
+
 // ---------------------------------------------------------------------------
 // killCmd
 // ---------------------------------------------------------------------------
 
 func killCmd() *cobra.Command {
 	var (
-		all  bool
-		tags []string
+		all      bool
+		tags     []string
+		selector string
+		opts     client.KillOptions
 	)
 
 	cmd := &cobra.Command{
-		Use:               "kill [session]",
-		Short:             "Kill a session (by ID, name, or tag), or all sessions",
+		Use:   "kill [session]",
+		Short: "Kill a session (by ID, name, or tag), or all sessions",
+		Example: `  cw kill planner
+  cw kill planner --grace 30s          # TERM, then KILL after 30s
+  cw kill --tag workers --signal INT --children
+  cw kill --selector repo=webapp,ticket!=JIRA-123`,
 		ValidArgsFunction: sessionCompletionFunc,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Grace < 0 {
+				return fmt.Errorf("--grace must not be negative")
+			}
+
 			target, err := resolveTarget()
 			if err != nil {
 				return err
@@ -379,31 +861,39 @@ func killCmd() *cobra.Command {
 			}
 
 			if all {
-				return client.KillAll(target)
+				return client.KillAll(cmd.Context(), target, opts)
 			}
 
-			if len(tags) > 0 {
-				return client.KillByTags(target, tags)
+			if len(tags) > 0 || selector != "" {
+				return client.KillByTags(cmd.Context(), target, tags, selector, opts)
 			}
 
 			if len(args) == 0 {
-				return fmt.Errorf("session id, name, or tag required (or use --all / --tag)")
+				return fmt.Errorf("session id, name, or tag required (or use --all / --tag / --selector)")
 			}
 
-			id, tagList, err := client.ResolveSessionOrTag(target, args[0])
+			id, tagList, err := client.ResolveSessionOrTag(cmd.Context(), target, args[0])
 			if err != nil {
 				return err
 			}
 			if len(tagList) > 0 {
-				return client.KillByTags(target, tagList)
+				return client.KillByTags(cmd.Context(), target, tagList, "", opts)
 			}
-			return client.Kill(target, *id)
+			return client.Kill(cmd.Context(), target, *id, opts)
 		},
 	}
 
 	cmd.Flags().BoolVarP(&all, "all", "a", false, "Kill all sessions")
 	cmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Kill sessions matching tag (can be repeated)")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Kill sessions whose labels match, e.g. repo=webapp,ticket!=X")
+	cmd.Flags().StringVar(&opts.Signal, "signal", "", "Signal to send: TERM (default), INT, HUP or KILL")
+	cmd.Flags().DurationVar(&opts.Grace, "grace", 0, "Send KILL if the session is still running after this long (e.g. 30s)")
+	cmd.Flags().BoolVar(&opts.Children, "children", false, "Signal the session's whole process group, not just its main process")
+	cmd.Flags().BoolVarP(&opts.JSON, "json", "j", false, "Output as JSON")
 	_ = cmd.RegisterFlagCompletionFunc("tag", tagCompletionFunc)
+	_ = cmd.RegisterFlagCompletionFunc("signal", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"TERM", "INT", "HUP", "KILL"}, cobra.ShellCompDirectiveNoFileComp
+	})
 
 	return cmd
 }
@@ -414,17 +904,32 @@ func killCmd() *cobra.Command {
 
 func logsCmd() *cobra.Command {
 	var (
-		follow bool
-		tail   int
-		raw    bool
+		follow   bool
+		tail     int
+		raw      bool
+		sanitize string
 	)
 
 	cmd := &cobra.Command{
-		Use:               "logs <session>",
-		Short:             "View session output logs (by ID or name)",
+		Use:   "logs <session>",
+		Short: "View session output logs (by ID or name)",
+		Long: `View a session's output log. Terminal escape codes are cleaned up at the
+--sanitize level:
+
+  full     plain text (default)
+  colors   keep colors, styles and hyperlinks; drop cursor movement, titles
+           and other control sequences
+  none     the output as written (same as --raw)`,
 		Args:              cobra.ExactArgs(1),
 		ValidArgsFunction: sessionCompletionFunc,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if raw {
+				if sanitize != "" && sanitize != "none" {
+					return fmt.Errorf("--raw cannot be combined with --sanitize %s", sanitize)
+				}
+				sanitize = "none"
+			}
+
 			target, err := resolveTarget()
 			if err != nil {
 				return err
@@ -436,7 +941,7 @@ func logsCmd() *cobra.Command {
 				}
 			}
 
-			resolved, err := client.ResolveSessionArg(target, args[0])
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
 			if err != nil {
 				return err
 			}
@@ -446,13 +951,142 @@ func logsCmd() *cobra.Command {
 				tailPtr = &tail
 			}
 
-			return client.Logs(target, resolved, follow, tailPtr, raw)
+			return client.Logs(cmd.Context(), target, resolved, follow, tailPtr, sanitize)
 		},
 	}
 
 	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow log output")
 	cmd.Flags().IntVarP(&tail, "tail", "t", 0, "Number of lines to show from end")
 	cmd.Flags().BoolVar(&raw, "raw", false, "Output raw log data without stripping ANSI escape codes")
+	cmd.Flags().StringVar(&sanitize, "sanitize", "", "Clean up escape codes: none, colors or full (default full)")
+
+	return cmd
+}
+
+// ---------------------------------------------------------------------------
+// exportCmd
+// ---------------------------------------------------------------------------
+
+func exportCmd() *cobra.Command {
+	var (
+		format string
+		output string
+		cols   int
+		rows   int
+	)
+
+	cmd := &cobra.Command{
+		Use:               "export <session>",
+		Short:             "Export a session transcript (asciicast, HTML replay, or text)",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: sessionCompletionFunc,
+		Long: `Export a session's output with its original timing.
+
+  asciicast  asciinema v2 cast (play with: asciinema play file.cast)
+  html       standalone HTML page that replays the session in a browser
+  txt        plain text with escape codes removed`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
+			if err != nil {
+				return err
+			}
+
+			opts := client.ExportOptions{Format: format, Cols: cols, Rows: rows}
+			if output == "" || output == "-" {
+				return client.Export(cmd.Context(), target, resolved, os.Stdout, opts)
+			}
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("creating %s: %w", output, err)
+			}
+			if err := client.Export(cmd.Context(), target, resolved, f, opts); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("writing %s: %w", output, err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "asciicast", "Output format: asciicast, html, or txt")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write to file instead of stdout")
+	cmd.Flags().IntVar(&cols, "cols", 120, "Terminal width for asciicast and html")
+	cmd.Flags().IntVar(&rows, "rows", 40, "Terminal height for asciicast and html")
+
+	return cmd
+}
+
+// ---------------------------------------------------------------------------
+// replayCmd
+// ---------------------------------------------------------------------------
+
+func replayCmd() *cobra.Command {
+	var (
+		speed   string
+		from    string
+		maxIdle time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:               "replay <session>",
+		Short:             "Play back a session's output with its original timing",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: sessionCompletionFunc,
+		Long: `Play back a session's recorded output in the terminal in real time.
+
+  cw replay 3 --speed 2x           # twice as fast
+  cw replay 3 --from 00:05:00      # start five minutes in
+  cw replay 3 --max-idle 2s        # skip long pauses
+
+Press Ctrl+C to stop.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := client.ReplayOptions{MaxIdle: maxIdle}
+			var err error
+			if opts.Speed, err = client.ParseSpeed(speed); err != nil {
+				return err
+			}
+			if from != "" {
+				if opts.From, err = client.ParseClock(from); err != nil {
+					return err
+				}
+			}
+
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
+			if err != nil {
+				return err
+			}
+
+			return client.Replay(cmd.Context(), target, resolved, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&speed, "speed", "1x", "Playback speed (e.g. 2x, 0.5x)")
+	cmd.Flags().StringVar(&from, "from", "", "Start at this point in the recording (hh:mm:ss)")
+	cmd.Flags().DurationVar(&maxIdle, "max-idle", 0, "Cap pauses between output at this length (e.g. 2s)")
 
 	return cmd
 }
@@ -463,14 +1097,31 @@ func logsCmd() *cobra.Command {
 
 func sendCmd() *cobra.Command {
 	var (
-		useStdin  bool
-		file      string
-		noNewline bool
+		from       string
+		useStdin   bool
+		file       string
+		noNewline  bool
+		escapes    bool
+		hexInput   bool
+		keys       []string
+		jsonOutput bool
 	)
 
 	cmd := &cobra.Command{
-		Use:               "send <session> [input]",
-		Short:             "Send input to a session (by ID or name)",
+		Use:   "send <session> [input]",
+		Short: "Send input to a session (by ID or name)",
+		Long: `Send input to a session without attaching, followed by a newline unless
+--no-newline, --key or --hex is given.
+
+To drive interactive programs, --key sends the keys a terminal would, after
+any input, and --escapes interprets \e (ESC), \xHH, \n, \r, \t and \\ in
+the input. --hex sends the input as hex bytes.`,
+		Example: `  cw send 3 "fix the failing test"
+  cw send 3 --key down --key enter           # pick the next menu entry
+  cw send 3 --key ctrl-c                     # interrupt
+  cw send 3 --key esc,up,enter               # cancel, then rerun the last entry
+  cw send 3 -E '\e[A\r'                      # up, then Enter
+  cw send 3 --hex '1b 5b 42 0d'              # down, then Enter`,
 		Args:              cobra.RangeArgs(1, 2),
 		ValidArgsFunction: sessionCompletionFunc,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -485,7 +1136,7 @@ func sendCmd() *cobra.Command {
 				}
 			}
 
-			resolved, err := client.ResolveSessionArg(target, args[0])
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
 			if err != nil {
 				return err
 			}
@@ -500,13 +1151,41 @@ func sendCmd() *cobra.Command {
 				filePtr = &file
 			}
 
-			return client.SendInput(target, resolved, input, useStdin, filePtr, noNewline)
+			if from == "" {
+				from = os.Getenv("CW_SESSION_ID")
+			}
+			var fromID *uint32
+			if from != "" {
+				id, err := client.ResolveSessionArg(cmd.Context(), target, from)
+				if err != nil {
+					return err
+				}
+				fromID = &id
+			}
+
+			if escapes && hexInput {
+				return fmt.Errorf("--escapes and --hex are mutually exclusive")
+			}
+			decode := ""
+			switch {
+			case escapes:
+				decode = "escapes"
+			case hexInput:
+				decode = "hex"
+			}
+
+			return client.SendInput(cmd.Context(), target, resolved, fromID, input, useStdin, filePtr, decode, keys, noNewline, jsonOutput)
 		},
 	}
 
+	cmd.Flags().StringVar(&from, "from", "", "Sender session (ID or name; default: CW_SESSION_ID), checked against the session's --accept-input-from")
 	cmd.Flags().BoolVar(&useStdin, "stdin", false, "Read input from stdin")
 	cmd.Flags().StringVarP(&file, "file", "f", "", "Read input from file")
 	cmd.Flags().BoolVarP(&noNewline, "no-newline", "n", false, "Do not append newline")
+	cmd.Flags().BoolVarP(&escapes, "escapes", "E", false, `Interpret backslash escapes in the input: \e, \xHH, \0NN, \n, \r, \t, \\`)
+	cmd.Flags().BoolVar(&hexInput, "hex", false, "Input is hex bytes, e.g. '1b 5b 41'")
+	cmd.Flags().StringSliceVarP(&keys, "key", "k", nil, "Key to send after the input (repeatable or comma-separated): "+client.KeyNames())
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
 
 	return cmd
 }
@@ -517,9 +1196,15 @@ func sendCmd() *cobra.Command {
 
 func watchCmd() *cobra.Command {
 	var (
-		tail      int
-		noHistory bool
-		timeout   uint64
+		tail       int
+		noHistory  bool
+		timeout    uint64
+		timestamps bool
+		grep       string
+		since      time.Duration
+		render     bool
+		interval   time.Duration
+		sanitize   string
 	)
 
 	cmd := &cobra.Command{
@@ -527,7 +1212,40 @@ func watchCmd() *cobra.Command {
 		Short:             "Watch session output in real-time (by ID, name, or tag for multi-session)",
 		Args:              cobra.ExactArgs(1),
 		ValidArgsFunction: sessionCompletionFunc,
+		Long: `Watch session output in real-time. Given a tag, output from every session
+with that tag is merged line by line, each line prefixed with its session.
+
+  --timestamps   prefix each line with the time it was written
+  --grep RE      only show lines matching the regular expression
+  --since 10m    only replay history written in the last 10 minutes
+  --sanitize L   clean up escape codes: colors keeps colors and styles,
+                 full leaves plain text (see cw logs)
+  --render       show the session's rendered screen instead of its raw
+                 output, redrawn at most every --interval while it changes,
+                 for full-screen programs (TUIs, editors, agents)`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := client.WatchOptions{Timestamps: timestamps, Since: since, NoColor: !stdoutColor, Sanitize: sanitize}
+			if grep != "" {
+				re, err := regexp.Compile(grep)
+				if err != nil {
+					return fmt.Errorf("invalid --grep pattern: %w", err)
+				}
+				opts.Grep = re
+			}
+			filtered := opts.Timestamps || opts.Grep != nil || opts.Since > 0
+			if filtered && cmd.Flags().Changed("tail") {
+				return fmt.Errorf("--tail cannot be combined with --timestamps, --grep, or --since")
+			}
+			if noHistory && opts.Since > 0 {
+				return fmt.Errorf("--since cannot be combined with --no-history")
+			}
+			if render && (filtered || cmd.Flags().Changed("tail") || noHistory || sanitize != "") {
+				return fmt.Errorf("--render cannot be combined with --tail, --no-history, --timestamps, --grep, --since, or --sanitize")
+			}
+			if cmd.Flags().Changed("interval") && !render {
+				return fmt.Errorf("--interval requires --render")
+			}
+
 			target, err := resolveTarget()
 			if err != nil {
 				return err
@@ -539,17 +1257,20 @@ func watchCmd() *cobra.Command {
 				}
 			}
 
-			id, tagList, err := client.ResolveSessionOrTag(target, args[0])
+			id, tagList, err := client.ResolveSessionOrTag(cmd.Context(), target, args[0])
 			if err != nil {
 				return err
 			}
 
 			if len(tagList) > 0 {
+				if render {
+					return fmt.Errorf("--render watches a single session, not a tag")
+				}
 				var timeoutPtr *uint64
 				if cmd.Flags().Changed("timeout") {
 					timeoutPtr = &timeout
 				}
-				return client.WatchMultiByTag(target, tagList[0], os.Stdout, timeoutPtr)
+				return client.WatchMultiByTag(cmd.Context(), target, tagList[0], os.Stdout, timeoutPtr, opts)
 			}
 
 			var tailPtr *int
@@ -560,13 +1281,29 @@ func watchCmd() *cobra.Command {
 			if cmd.Flags().Changed("timeout") {
 				timeoutPtr = &timeout
 			}
-			return client.WatchSession(target, *id, tailPtr, noHistory, timeoutPtr)
+			if render {
+				return client.WatchScreen(cmd.Context(), target, *id, os.Stdout, timeoutPtr, client.RenderOptions{
+					Interval: interval,
+					ANSI:     stdoutColor,
+					Redraw:   isatty.IsTerminal(os.Stdout.Fd()),
+				})
+			}
+			if filtered {
+				return client.WatchSessionLines(cmd.Context(), target, *id, os.Stdout, timeoutPtr, opts)
+			}
+			return client.WatchSession(cmd.Context(), target, *id, tailPtr, noHistory, timeoutPtr, sanitize)
 		},
 	}
 
 	cmd.Flags().IntVarP(&tail, "tail", "t", 0, "Number of lines to show from end")
 	cmd.Flags().BoolVar(&noHistory, "no-history", false, "Do not replay session history")
 	cmd.Flags().Uint64Var(&timeout, "timeout", 0, "Timeout in seconds")
+	cmd.Flags().BoolVar(&timestamps, "timestamps", false, "Prefix each line with the time it was written")
+	cmd.Flags().StringVar(&grep, "grep", "", "Only show lines matching this regular expression")
+	cmd.Flags().DurationVar(&since, "since", 0, "Only replay history from this long ago (e.g. 10m)")
+	cmd.Flags().BoolVar(&render, "render", false, "Show the rendered screen instead of raw output")
+	cmd.Flags().DurationVar(&interval, "interval", client.DefaultRenderInterval, "With --render, least time between redraws")
+	cmd.Flags().StringVar(&sanitize, "sanitize", "", "Clean up escape codes: none, colors or full (default none)")
 
 	return cmd
 }
@@ -595,12 +1332,12 @@ func statusCmd() *cobra.Command {
 				}
 			}
 
-			resolved, err := client.ResolveSessionArg(target, args[0])
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
 			if err != nil {
 				return err
 			}
 
-			return client.GetStatus(target, resolved, jsonOutput)
+			return client.GetStatus(cmd.Context(), target, resolved, jsonOutput)
 		},
 	}
 
@@ -609,30 +1346,306 @@ func statusCmd() *cobra.Command {
 	return cmd
 }
 
+// ---------------------------------------------------------------------------
+// screenCmd
+// ---------------------------------------------------------------------------
+
+func screenCmd() *cobra.Command {
+	var (
+		ansi       bool
+		jsonOutput bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "screen <session>",
+		Short: "Print what a session's terminal shows now",
+		Long: `Print a session's current screen as the node's terminal emulator renders
+it: the rows a full-screen program such as an editor, a TUI or an agent
+shows, rather than the raw output cw logs prints. Trailing blanks and blank
+rows at the bottom are left out. With --ansi, lines keep their colors and
+styles; with --json, the cursor position, terminal size and whether the
+alternate screen is shown are included.`,
+		Example: `  cw screen planner
+  cw screen 3 --ansi
+  cw screen 3 --json | jq -r '.lines[-1]'`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: sessionCompletionFunc,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
+			if err != nil {
+				return err
+			}
+
+			return client.Screen(cmd.Context(), target, resolved, ansi, jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVar(&ansi, "ansi", false, "Keep colors and styles as ANSI escape sequences")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
+
+// ---------------------------------------------------------------------------
+// topCmd
+// ---------------------------------------------------------------------------
+
+func topCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "top",
+		Short: "Interactive dashboard of all sessions",
+		Long: `Show a full-screen dashboard of all sessions with live status, output rate,
+last output line, and message activity.
+
+Keys:
+  up/down, j/k   select a session
+  a, enter       attach (detach with Ctrl+B d to return)
+  l              view the last 200 lines of output
+  i              send a line of input
+  x              kill (asks for confirmation)
+  q              quit`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			prefix, err := detachKey()
+			if err != nil {
+				return err
+			}
+			return client.Top(cmd.Context(), target, prefix)
+		},
+	}
+}
+
+// ---------------------------------------------------------------------------
+// renameCmd
+// ---------------------------------------------------------------------------
+
+func renameCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rename <session> <new-name>",
+		Short: "Rename a session (by ID or name)",
+		Long: `Rename a session. Names are 1-32 alphanumeric characters or hyphens and
+must be unique. Sessions launched without --name get a generated name
+(e.g. brave-otter) that can be changed with this command.`,
+		Args: cobra.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return sessionCompletionFunc(cmd, args, toComplete)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
+			if err != nil {
+				return err
+			}
+
+			return client.Rename(cmd.Context(), target, resolved, args[1])
+		},
+	}
+}
+
+func forkCmd() *cobra.Command {
+	var (
+		name        string
+		replayStdin bool
+		jsonOutput  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "fork <session>",
+		Short: "Launch a copy of a session, e.g. to retry a failed run",
+		Long: `Launch a new session with the same command, working directory (and
+worktree), env, secrets, tags, labels, pool, auto-respond, alert and redact
+rules, and budget as an existing one, running or not, and print its ID. The
+new session gets a generated name unless --name is given.
+
+With --replay-stdin, the new session is sent all the input the original has
+received so far (from --stdin, attached terminals, cw send, auto-responses
+and pipes), instead of just its --stdin data. The node keeps the first 64 KiB
+of each session's input, in memory only.
+
+Sessions carried over from before a node restart cannot be forked.`,
+		Example: `  cw fork 3
+  cw fork flaky-tests --name retry-1
+  cw fork planner --replay-stdin`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: sessionCompletionFunc,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
+			if err != nil {
+				return err
+			}
+
+			return client.Fork(cmd.Context(), target, resolved, name, replayStdin, jsonOutput)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Unique name for the new session (alphanumeric + hyphens, 1-32 chars)")
+	cmd.Flags().BoolVar(&replayStdin, "replay-stdin", false, "Send the new session all the input the original has received")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output the new session's info as JSON")
+
+	return cmd
+}
+
+// ---------------------------------------------------------------------------
+// resumeCmd
+// ---------------------------------------------------------------------------
+
+func resumeCmd() *cobra.Command {
+	var (
+		name       string
+		jsonOutput bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "resume <session> [-- claude-args...]",
+		Short: "Continue a Claude Code session's conversation in a new session",
+		Long: `Launch a new session running claude --resume with the Claude Code session
+that an ended session ran, in the same working directory (and worktree), with
+the same env, secrets, tags, labels, pool, rules and budget, and print its ID.
+Arguments after -- are passed on to claude.
+
+The node records the Claude Code session ID from the command line
+(--session-id, --resume), from its JSON output, or from cw hook, which also
+reports the transcript path; cw status shows both.`,
+		Example: `  cw resume planner
+  cw resume 3 --name planner-2 -- -p "now write the tests"`,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: sessionCompletionFunc,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
+			if err != nil {
+				return err
+			}
+
+			return client.Resume(cmd.Context(), target, resolved, name, args[1:], jsonOutput)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Unique name for the new session (alphanumeric + hyphens, 1-32 chars)")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output the new session's info as JSON")
+	return cmd
+}
+
 // ---------------------------------------------------------------------------
 // mcpServerCmd
 // ---------------------------------------------------------------------------
 
 func mcpServerCmd() *cobra.Command {
-	return &cobra.Command{
+	var httpAddr string
+
+	cmd := &cobra.Command{
 		Use:   "mcp-server",
 		Short: "Run the MCP (Model Context Protocol) server",
 		Long: `Run the Codewire MCP server (communicates over stdio).
 
-To register with Claude Code:
-  claude mcp add --scope user codewire -- cw mcp-server
+To register with Claude Code:
+  claude mcp add --scope user codewire -- cw mcp-server
+
+With --http, serve the MCP streamable-HTTP transport at /mcp instead, for
+web-based agents and remote orchestrators:
+  cw mcp-server --http :8700
+
+HTTP clients authenticate with the node token (~/.codewire/token) via
+"Authorization: Bearer <token>" or ?token=<token>.
+
+With --server, tools drive sessions on a remote node instead of the local one:
+  cw mcp-server --server gpu-box
+
+Individual tool calls can also pass a "target" argument (a servers.toml name
+or URL) to reach a different node. Over --http they cannot: the server only
+drives the node it was started with.
+
+The node must be running before MCP tools work:
+  cw node -d
+
+The MCP server does NOT auto-start a node.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+			// The HTTP transport authenticates against the local node token.
+			if target.IsLocal() || httpAddr != "" {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+			if httpAddr == "" {
+				return mcp.RunMCPServer(dataDir(), target)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
 
-The node must be running before MCP tools work:
-  cw node -d
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+			go func() {
+				<-sigCh
+				cancel()
+			}()
 
-The MCP server does NOT auto-start a node.`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := ensureNode(); err != nil {
-				return err
-			}
-			return mcp.RunMCPServer(dataDir())
+			fmt.Fprintf(os.Stderr, "[cw] MCP server listening on %s/mcp\n", httpAddr)
+			return mcp.RunMCPHTTPServer(ctx, dataDir(), target, httpAddr)
 		},
 	}
+	cmd.Flags().StringVar(&httpAddr, "http", "", "Serve MCP over streamable HTTP on this address (e.g. :8700) instead of stdio")
+	return cmd
 }
 
 // ---------------------------------------------------------------------------
@@ -640,17 +1653,39 @@ The MCP server does NOT auto-start a node.`,
 // ---------------------------------------------------------------------------
 
 func nodesCmd() *cobra.Command {
-	return &cobra.Command{
+	var opts client.NodesOptions
+
+	cmd := &cobra.Command{
 		Use:   "nodes",
 		Short: "List registered nodes from the relay",
+		Long: `List the nodes registered with the relay.
+
+Connected nodes report their status to the relay every 15 seconds: running
+sessions, cw version, OS and architecture, tags (node.tags), CPUs, load
+average, memory and the disk space left in their data directory. The table
+shows the first of these and --wide all of them; --json includes them as
+status. Load, memory and disk are only reported by Linux nodes.
+
+--filter keeps the nodes matching a selector over name, connected, version,
+os, arch and tag, as in cw list --selector: comma-separated key=value,
+key!=value, key and !key terms that must all hold. tag=gpu matches nodes
+with the tag gpu among theirs.`,
+		Example: `  cw nodes --filter connected=true
+  cw nodes --wide --filter tag=gpu,os=linux`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			relayURL, err := resolveRelayURL()
 			if err != nil {
 				return err
 			}
-			return client.Nodes(relayURL)
+			return client.Nodes(relayURL, opts)
 		},
 	}
+
+	cmd.Flags().BoolVarP(&opts.JSON, "json", "j", false, "Output as JSON")
+	cmd.Flags().BoolVarP(&opts.Wide, "wide", "w", false, "Show each node's last reported load, memory and disk")
+	cmd.Flags().StringVarP(&opts.Filter, "filter", "f", "", "Keep nodes matching a selector, e.g. connected=true,tag=gpu")
+
+	return cmd
 }
 
 // ---------------------------------------------------------------------------
@@ -660,14 +1695,42 @@ func nodesCmd() *cobra.Command {
 func subscribeCmd() *cobra.Command {
 	var (
 		tags       []string
+		selector   string
 		eventTypes []string
+		filter     string
+		since      time.Duration
+		fromSeq    uint64
+		format     string
+		jsonOutput bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "subscribe [target]",
 		Short: "Subscribe to session events",
-		Args:  cobra.MaximumNArgs(1),
+		Long: `Subscribe to session events, printed as they happen until interrupted.
+
+--format ndjson prints each event as a line of JSON with its type, session
+(id and name), node, timestamp and data, for tools such as jq, Vector or Fluent
+Bit. cw schema subscribe describes it.
+
+--filter selects events with an expression the node evaluates, over the
+event type (event), session ID (session), tags, labels.<key> and
+data.<field>, with == != < <= > >= =~ in ! && || and parentheses.
+
+The node journals the events it publishes, numbered in order (seq). --since
+and --from-seq replay the journaled events from then on before the live ones,
+so a supervisor that restarts can pick up where it left off.`,
+		Example: `  cw subscribe --tag build --format ndjson | jq -r .type
+  cw subscribe --filter 'event == "session.status" && data.to == "completed" && "build" in tags'
+  cw subscribe --since 2h
+  cw subscribe --from-seq 1234 --format ndjson`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			ndjson, err := ndjsonFormat(format, jsonOutput)
+			if err != nil {
+				return err
+			}
+
 			target, err := resolveTarget()
 			if err != nil {
 				return err
@@ -682,7 +1745,7 @@ func subscribeCmd() *cobra.Command {
 			var sid *uint32
 			var resolvedTags []string
 			if len(args) > 0 {
-				id, tagList, err := client.ResolveSessionOrTag(target, args[0])
+				id, tagList, err := client.ResolveSessionOrTag(cmd.Context(), target, args[0])
 				if err != nil {
 					return err
 				}
@@ -691,12 +1754,23 @@ func subscribeCmd() *cobra.Command {
 			}
 			allTags := append(resolvedTags, tags...)
 
-			return client.SubscribeEvents(target, sid, allTags, eventTypes)
+			var from *uint64
+			if cmd.Flags().Changed("from-seq") {
+				from = &fromSeq
+			}
+			return client.SubscribeEvents(cmd.Context(), target, sid, allTags, selector, filter, eventTypes, since, from, ndjson)
 		},
 	}
 
 	cmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Filter by tag (can be repeated)")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Filter by label selector, e.g. repo=webapp,ticket!=X")
 	cmd.Flags().StringSliceVarP(&eventTypes, "event", "e", nil, "Filter by event type (can be repeated)")
+	cmd.Flags().StringVar(&filter, "filter", "", `Filter by expression, e.g. 'data.exit_code != 0 && "build" in tags'`)
+	cmd.Flags().DurationVar(&since, "since", 0, "First replay the events of this long ago on (e.g. 2h)")
+	cmd.Flags().Uint64Var(&fromSeq, "from-seq", 0, "First replay the events from this sequence number on")
+	cmd.Flags().StringVar(&format, "format", "text", "Output format: text or ndjson")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Same as --format ndjson")
+	_ = cmd.RegisterFlagCompletionFunc("format", formatCompletionFunc)
 	_ = cmd.RegisterFlagCompletionFunc("tag", tagCompletionFunc)
 	_ = cmd.RegisterFlagCompletionFunc("event", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return []string{
@@ -706,26 +1780,66 @@ func subscribeCmd() *cobra.Command {
 			"message.direct",
 			"message.request",
 			"message.reply",
+			"message.rate_limited",
 		}, cobra.ShellCompDirectiveNoFileComp
 	})
 
 	return cmd
 }
 
+// ndjsonFormat reports whether the --format and --json flags of cw subscribe
+// or cw listen ask for NDJSON.
+func ndjsonFormat(format string, jsonOutput bool) (bool, error) {
+	switch format {
+	case "text":
+		return jsonOutput, nil
+	case "ndjson":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid --format %q (use text or ndjson)", format)
+}
+
+func formatCompletionFunc(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{"text", "ndjson"}, cobra.ShellCompDirectiveNoFileComp
+}
+
 // ---------------------------------------------------------------------------
 // waitSessionCmd — wait for session(s) to complete
 // ---------------------------------------------------------------------------
 
 func waitSessionCmd() *cobra.Command {
 	var (
-		tags      []string
-		condition string
-		timeout   uint64
+		tags        []string
+		selector    string
+		condition   string
+		untilOutput string
+		timeout     uint64
+		exitCode    bool
+		jsonOutput  bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "wait [session]",
 		Short: "Wait for session(s) to complete (by ID or name)",
+		Long: `Wait for a session, or the sessions with a tag or matching a label
+selector, to complete.
+
+--condition decides when the wait is over: all (default) or any of the
+sessions finished, success (all finished with exit code 0) or any-failure (one
+was killed or exited non-zero). cw wait exits 1 once success or any-failure
+can no longer be met, e.g. as soon as a session fails while waiting for
+success.
+
+--until-output instead waits for a line of output, written before or during
+the wait, to match a regular expression, and fails if the sessions finish
+without one.
+
+--exit-code makes cw wait exit with the session's own exit code (1 if it was
+killed), or with 1 if any of several sessions failed, so scripts can branch on
+it: cw wait build --exit-code || rollback.`,
+		Example: `  cw wait --tag build --condition success && deploy
+  cw wait server --until-output 'listening on :8080' --timeout 60
+  cw wait --selector repo=webapp,ticket=JIRA-123 --condition any`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			target, err := resolveTarget()
 			if err != nil {
@@ -741,7 +1855,7 @@ func waitSessionCmd() *cobra.Command {
 			var sid *uint32
 			var resolvedTags []string
 			if len(args) > 0 {
-				id, tagList, err := client.ResolveSessionOrTag(target, args[0])
+				id, tagList, err := client.ResolveSessionOrTag(cmd.Context(), target, args[0])
 				if err != nil {
 					return err
 				}
@@ -755,16 +1869,90 @@ func waitSessionCmd() *cobra.Command {
 				timeoutPtr = &timeout
 			}
 
-			return client.WaitForSession(target, sid, allTags, condition, timeoutPtr)
+			if untilOutput != "" && cmd.Flags().Changed("condition") {
+				return fmt.Errorf("--until-output cannot be combined with --condition")
+			}
+
+			if untilOutput != "" && exitCode {
+				return fmt.Errorf("--until-output cannot be combined with --exit-code")
+			}
+
+			return client.WaitForSession(cmd.Context(), target, sid, allTags, client.WaitOptions{
+				Condition:   condition,
+				UntilOutput: untilOutput,
+				Selector:    selector,
+				Timeout:     timeoutPtr,
+				ExitCode:    exitCode,
+				JSON:        jsonOutput,
+			})
 		},
 	}
 
 	cmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Wait for sessions matching tag (can be repeated)")
-	cmd.Flags().StringVarP(&condition, "condition", "c", "all", "Wait condition: all or any")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Wait for sessions whose labels match, e.g. repo=webapp,ticket!=X")
+	cmd.Flags().StringVarP(&condition, "condition", "c", "all", "Wait condition: all, any, success or any-failure")
+	cmd.Flags().StringVar(&untilOutput, "until-output", "", "Wait for a line of output matching this regular expression instead")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with the session's exit code, or 1 if any of several sessions failed")
 	cmd.Flags().Uint64Var(&timeout, "timeout", 0, "Timeout in seconds")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
 	_ = cmd.RegisterFlagCompletionFunc("tag", tagCompletionFunc)
 	_ = cmd.RegisterFlagCompletionFunc("condition", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"all", "any"}, cobra.ShellCompDirectiveNoFileComp
+		return []string{"all", "any", "success", "any-failure"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return cmd
+}
+
+func notifyCmd() *cobra.Command {
+	var (
+		method string
+		lines  int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "notify <session-or-tag>",
+		Short: "Send a notification when session(s) finish",
+		Long: `Wait for a session, or every running session with a tag, to finish and send
+a notification with its exit code and last lines of output.
+
+Methods: ` + notify.Methods,
+		Example: `  cw notify build --method macos
+  cw notify 3 --method ntfy:https://ntfy.sh/my-topic
+  cw notify worker --method 'command:notify-send "$CW_NOTIFY_TITLE" "$CW_NOTIFY_BODY"'`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := notify.Parse(method); err != nil {
+				return err
+			}
+			if lines < 0 {
+				return fmt.Errorf("--lines must not be negative")
+			}
+
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			id, tags, err := client.ResolveSessionOrTag(cmd.Context(), target, args[0])
+			if err != nil {
+				return err
+			}
+
+			return client.NotifyOnCompletion(cmd.Context(), target, id, tags, method, lines)
+		},
+	}
+
+	cmd.Flags().StringVar(&method, "method", "", "Notification method ("+notify.Methods+")")
+	cmd.Flags().IntVar(&lines, "lines", 10, "Number of output lines to include")
+	_ = cmd.MarkFlagRequired("method")
+	_ = cmd.RegisterFlagCompletionFunc("method", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"macos", "ntfy:", "slack:", "discord:", "command:"}, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
 	})
 
 	return cmd
@@ -812,7 +2000,7 @@ func kvSetCmd() *cobra.Command {
 				}
 			}
 
-			return client.KVSet(target, namespace, args[0], args[1], ttl)
+			return client.KVSet(cmd.Context(), target, namespace, args[0], args[1], ttl)
 		},
 	}
 
@@ -823,7 +2011,10 @@ func kvSetCmd() *cobra.Command {
 }
 
 func kvGetCmd() *cobra.Command {
-	var namespace string
+	var (
+		namespace  string
+		jsonOutput bool
+	)
 
 	cmd := &cobra.Command{
 		Use:   "get <key>",
@@ -841,17 +2032,21 @@ func kvGetCmd() *cobra.Command {
 				}
 			}
 
-			return client.KVGet(target, namespace, args[0])
+			return client.KVGet(cmd.Context(), target, namespace, args[0], jsonOutput)
 		},
 	}
 
 	cmd.Flags().StringVar(&namespace, "ns", "default", "Namespace")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
 
 	return cmd
 }
 
 func kvListCmd() *cobra.Command {
-	var namespace string
+	var (
+		namespace  string
+		jsonOutput bool
+	)
 
 	cmd := &cobra.Command{
 		Use:   "list [prefix]",
@@ -874,11 +2069,12 @@ func kvListCmd() *cobra.Command {
 				prefix = args[0]
 			}
 
-			return client.KVList(target, namespace, prefix)
+			return client.KVList(cmd.Context(), target, namespace, prefix, jsonOutput)
 		},
 	}
 
 	cmd.Flags().StringVar(&namespace, "ns", "default", "Namespace")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
 
 	return cmd
 }
@@ -902,7 +2098,7 @@ func kvDeleteCmd() *cobra.Command {
 				}
 			}
 
-			return client.KVDelete(target, namespace, args[0])
+			return client.KVDelete(cmd.Context(), target, namespace, args[0])
 		},
 	}
 
@@ -1028,13 +2224,18 @@ func relaySetupCmd() *cobra.Command {
 	var (
 		authToken string
 		qr        bool
+		groups    []string
 	)
 
 	cmd := &cobra.Command{
 		Use:   "relay-setup <relay-url> [token]",
 		Short: "Connect this node to a relay",
-		Long:  "Connect this node to a relay. With no token, uses OIDC device flow if the relay supports it.",
-		Args:  cobra.RangeArgs(1, 2),
+		Long: `Connect this node to a relay. With no token, uses OIDC device flow if the relay supports it.
+
+With --group, the node joins node groups: cw run --node-group launches
+through the relay on a node of the group. The groups are saved as
+relay_groups in config.toml and take effect when the node next connects.`,
+		Args: cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			relayURL := args[0]
 			var token string
@@ -1063,12 +2264,14 @@ func relaySetupCmd() *cobra.Command {
 				Token:     token,
 				AuthToken: authToken,
 				ShowQR:    qr,
+				Groups:    groups,
 			})
 		},
 	}
 
 	cmd.Flags().StringVar(&authToken, "token", "", "Admin auth token (for headless/CI use)")
 	cmd.Flags().BoolVar(&qr, "qr", false, "Print QR code with SSH connection URI (for Termius iOS)")
+	cmd.Flags().StringSliceVar(&groups, "group", nil, "Join this node group, for cw run --node-group (can be repeated)")
 
 	return cmd
 }
@@ -1103,6 +2306,13 @@ func relayCmd() *cobra.Command {
 		listen             string
 		sshListen          string
 		relayDir           string
+		databaseURL        string
+		advertiseAddr      string
+		kvMaxKeys          int
+		kvMaxBytes         int64
+		nodeQuota          int64
+		userQuota          int64
+		nodeRate           int64
 		authMode           string
 		authToken          string
 		allowedUsers       []string
@@ -1112,6 +2322,7 @@ func relayCmd() *cobra.Command {
 		oidcClientID       string
 		oidcClientSecret   string
 		oidcAllowedGroups  []string
+		placement          string
 	)
 
 	cmd := &cobra.Command{
@@ -1122,9 +2333,7 @@ func relayCmd() *cobra.Command {
 				return fmt.Errorf("--base-url is required")
 			}
 
-			if relayDir == "" {
-				relayDir = filepath.Join(dataDir(), "relay")
-			}
+			relayDir = relayDataDir(relayDir)
 
 			if err := os.MkdirAll(relayDir, 0o755); err != nil {
 				return fmt.Errorf("creating relay data dir: %w", err)
@@ -1146,6 +2355,13 @@ func relayCmd() *cobra.Command {
 				ListenAddr:         listen,
 				SSHListenAddr:      sshListen,
 				DataDir:            relayDir,
+				DatabaseURL:        databaseURL,
+				AdvertiseAddr:      advertiseAddr,
+				KVMaxKeys:          kvMaxKeys,
+				KVMaxBytes:         kvMaxBytes,
+				NodeQuota:          nodeQuota,
+				UserQuota:          userQuota,
+				NodeRate:           nodeRate,
 				AuthMode:           authMode,
 				AuthToken:          authToken,
 				AllowedUsers:       allowedUsers,
@@ -1155,6 +2371,7 @@ func relayCmd() *cobra.Command {
 				OIDCClientID:       oidcClientID,
 				OIDCClientSecret:   oidcClientSecret,
 				OIDCAllowedGroups:  oidcAllowedGroups,
+				Placement:          placement,
 			})
 		},
 	}
@@ -1163,6 +2380,13 @@ func relayCmd() *cobra.Command {
 	cmd.Flags().StringVar(&listen, "listen", ":8080", "HTTP listen address")
 	cmd.Flags().StringVar(&sshListen, "ssh-listen", ":2222", "SSH listen address")
 	cmd.Flags().StringVar(&relayDir, "data-dir", "", "Data directory for relay (default: ~/.codewire/relay)")
+	cmd.Flags().StringVar(&databaseURL, "database-url", "", "PostgreSQL URL to store relay state in instead of the data directory")
+	cmd.Flags().StringVar(&advertiseAddr, "advertise-addr", "", "Address other relay replicas reach this one at, enabling multi-replica routing (requires --database-url and --auth-token)")
+	cmd.Flags().IntVar(&kvMaxKeys, "kv-max-keys", 10000, "Most keys a KV namespace may hold (0 for no limit)")
+	cmd.Flags().Int64Var(&kvMaxBytes, "kv-max-bytes", 64<<20, "Most value bytes a KV namespace may hold (0 for no limit)")
+	cmd.Flags().Int64Var(&nodeQuota, "node-quota", 0, "Most bytes proxied to and from a node a day, UTC (0 for no limit)")
+	cmd.Flags().Int64Var(&userQuota, "user-quota", 0, "Most bytes proxied for a user a day across nodes, UTC (0 for no limit)")
+	cmd.Flags().Int64Var(&nodeRate, "node-rate", 0, "Most bytes a second proxied to and from a node (0 for no limit)")
 	cmd.Flags().StringVar(&authMode, "auth-mode", "none", "Auth mode: none, token, github, oidc")
 	_ = cmd.RegisterFlagCompletionFunc("auth-mode", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return []string{"none", "token", "github", "oidc"}, cobra.ShellCompDirectiveNoFileComp
@@ -1175,32 +2399,255 @@ func relayCmd() *cobra.Command {
 	cmd.Flags().StringVar(&oidcClientID, "oidc-client-id", "", "OIDC client ID")
 	cmd.Flags().StringVar(&oidcClientSecret, "oidc-client-secret", "", "OIDC client secret")
 	cmd.Flags().StringSliceVar(&oidcAllowedGroups, "oidc-allowed-groups", nil, "OIDC groups required for access (empty = any authenticated user)")
+	cmd.Flags().StringVar(&placement, "placement", relay.DefaultPlacement, "How to choose the node of a group clients connect to: "+strings.Join(relay.PlacementNames(), " or "))
+
+	cmd.AddCommand(relayAuditCmd(), relayBackupCmd(), relayRestoreCmd(), relayChannelCmd())
+
+	return cmd
+}
+
+func relayChannelCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "channel",
+		Short: "Manage the update channels nodes follow",
+		Long: `Manage the relay's update channels. A node that sets node.update_channel
+follows that channel: while the channel asks for another cw version than the
+node runs, the node downloads the release, checks that its checksums are
+signed with the cw release key (or node.update_key) and restarts into it,
+keeping its sessions.
+
+Requires the relay configured with 'cw setup'.`,
+	}
+
+	cmd.AddCommand(relayChannelSetCmd(), relayChannelListCmd(), relayChannelRemoveCmd())
+	return cmd
+}
+
+func relayChannelSetCmd() *cobra.Command {
+	var baseURL string
+
+	cmd := &cobra.Command{
+		Use:   "set <channel> <version>",
+		Short: "Set the version a channel's nodes should run",
+		Example: `  cw relay channel set stable v0.2.48
+  cw relay channel set canary v0.3.0 --url https://mirror.internal/cw/releases`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.RelayChannelSet(dataDir(), args[0], args[1], baseURL)
+		},
+	}
+
+	cmd.Flags().StringVar(&baseURL, "url", "", "Base URL releases are downloaded from as <url>/<version>/<file> (default: GitHub releases)")
+
+	return cmd
+}
+
+func relayChannelListCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List update channels",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.RelayChannels(dataDir(), jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
+
+func relayChannelRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <channel>",
+		Short: "Remove an update channel; its nodes keep their version",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.RelayChannelRemove(dataDir(), args[0])
+		},
+	}
+}
+
+func relayAuditCmd() *cobra.Command {
+	var opts client.RelayAuditOptions
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Show the relay's audit log",
+		Long: `Show actions the relay carried out or proxied to nodes, newest first: SSH
+sessions, approval decisions, node registrations and revocations, and invite
+and update channel changes. Each entry records who acted, the node, the session and the result.
+
+Requires the relay configured with 'cw setup'.`,
+		Example: `  cw relay audit --user alice --since 24h
+  cw relay audit --node build-box --limit 20 --json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.RelayAudit(dataDir(), opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.User, "user", "", "Only show actions by this user")
+	cmd.Flags().StringVar(&opts.Node, "node", "", "Only show actions on this node")
+	cmd.Flags().StringVar(&opts.Since, "since", "", "Only show entries newer than a duration (e.g. 24h) or RFC 3339 time")
+	cmd.Flags().IntVar(&opts.Limit, "limit", 100, "Maximum entries to show (0 for all)")
+	cmd.Flags().BoolVarP(&opts.JSON, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
+
+// relayS3Flags adds the flags locating relay backups in S3 to cmd. The
+// location is used only when --s3-bucket is set.
+func relayS3Flags(cmd *cobra.Command, loc *relay.S3Location) {
+	cmd.Flags().StringVar(&loc.Bucket, "s3-bucket", "", "S3 bucket holding the backups")
+	cmd.Flags().StringVar(&loc.Prefix, "s3-prefix", "", "Key prefix (directory) for the backups in the bucket")
+	cmd.Flags().StringVar(&loc.Region, "s3-region", "", "S3 region (default: $AWS_REGION, then us-east-1)")
+	cmd.Flags().StringVar(&loc.Endpoint, "s3-endpoint", "", "Endpoint of an S3-compatible service (default: AWS S3)")
+}
+
+func relayBackupCmd() *cobra.Command {
+	var (
+		relayDir string
+		s3       relay.S3Location
+	)
+
+	cmd := &cobra.Command{
+		Use:   "backup [file]",
+		Short: "Back up the relay's database",
+		Long: `Snapshot the relay's database (node registry, KV store, invites, users and
+keys) to a file, or to a new object relay-<time>.db in an S3 bucket. The relay
+may keep running while it is backed up.
+
+S3 credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.`,
+		Example: `  cw relay backup /backups/relay.db
+  cw relay backup --s3-bucket acme-backups --s3-prefix relay/prod`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := relay.BackupOptions{DataDir: relayDataDir(relayDir)}
+			switch {
+			case len(args) == 1 && s3.Bucket != "":
+				return fmt.Errorf("give a file or --s3-bucket, not both")
+			case len(args) == 1:
+				opts.Output = args[0]
+			case s3.Bucket != "":
+				opts.S3 = &s3
+			default:
+				return fmt.Errorf("give a file to write the backup to, or --s3-bucket")
+			}
+
+			where, err := relay.RunBackup(context.Background(), opts)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Backed up the relay to %s\n", where)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&relayDir, "data-dir", "", "Data directory of the relay (default: ~/.codewire/relay)")
+	relayS3Flags(cmd, &s3)
+
+	return cmd
+}
+
+func relayRestoreCmd() *cobra.Command {
+	var (
+		relayDir  string
+		s3        relay.S3Location
+		ifMissing bool
+		force     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "restore [file | key]",
+		Short: "Restore the relay's database from a backup",
+		Long: `Replace the relay's database with a backup made by 'cw relay backup': a file,
+or with --s3-bucket an object key, by default the newest backup under the
+prefix. Stop the relay first; it picks the restored state up when it starts.
+
+With --if-missing the restore only happens when the data directory has no
+database yet, and succeeds without one when there is no backup, so it can run
+before every relay start.`,
+		Example: `  cw relay restore /backups/relay.db --force
+  cw relay restore --s3-bucket acme-backups --s3-prefix relay/prod --if-missing`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := relay.RestoreOptions{
+				DataDir:   relayDataDir(relayDir),
+				IfMissing: ifMissing,
+				Force:     force,
+			}
+			if len(args) == 1 {
+				opts.Source = args[0]
+			}
+			if s3.Bucket != "" {
+				opts.S3 = &s3
+			} else if opts.Source == "" {
+				return fmt.Errorf("give a backup file, or --s3-bucket")
+			}
+
+			restored, err := relay.RunRestore(context.Background(), opts)
+			if err != nil {
+				return err
+			}
+			if restored == "" {
+				fmt.Println("Nothing to restore")
+				return nil
+			}
+			fmt.Printf("Restored the relay from %s\n", restored)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&relayDir, "data-dir", "", "Data directory of the relay (default: ~/.codewire/relay)")
+	cmd.Flags().BoolVar(&ifMissing, "if-missing", false, "Only restore when the relay has no database yet")
+	cmd.Flags().BoolVar(&force, "force", false, "Replace an existing database")
+	relayS3Flags(cmd, &s3)
 
 	return cmd
 }
 
+// relayDataDir returns the relay data directory, dir or the default.
+func relayDataDir(dir string) string {
+	if dir == "" {
+		return filepath.Join(dataDir(), "relay")
+	}
+	return dir
+}
+
 // ---------------------------------------------------------------------------
 // inviteCmd — create an invite code for device onboarding
 // ---------------------------------------------------------------------------
 
 func inviteCmd() *cobra.Command {
-	var (
-		uses int
-		ttl  string
-		qr   bool
-	)
+	var opts client.InviteOptions
 
 	cmd := &cobra.Command{
 		Use:   "invite",
 		Short: "Create an invite code for device onboarding",
+		Long: `Create an invite code that registers a device with the relay.
+
+By default the device joins as a node, under the name it has configured.
+--name and --tags give it a name and node tags chosen here instead; the relay
+keeps them whatever the device reports. With --scope client, the device can
+only connect to nodes through the relay, as the user creating the invite: it
+cannot connect as a node itself.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return client.Invite(dataDir(), uses, ttl, qr)
+			return client.Invite(dataDir(), opts)
 		},
 	}
 
-	cmd.Flags().IntVar(&uses, "uses", 1, "Number of times the invite can be used")
-	cmd.Flags().StringVar(&ttl, "ttl", "1h", "Time-to-live for the invite (e.g. 5m, 1h, 24h)")
-	cmd.Flags().BoolVar(&qr, "qr", false, "Print QR code for the invite URL")
+	cmd.Flags().IntVar(&opts.Uses, "uses", 1, "Number of times the invite can be used")
+	cmd.Flags().StringVar(&opts.TTL, "ttl", "1h", "Time-to-live for the invite (e.g. 5m, 1h, 24h)")
+	cmd.Flags().StringVar(&opts.Name, "name", "", "Name the device joins under")
+	cmd.Flags().StringSliceVar(&opts.Tags, "tags", nil, "Node tags for the device (comma-separated)")
+	cmd.Flags().StringVar(&opts.Scope, "scope", "node", "What the device may do: node or client")
+	cmd.Flags().BoolVar(&opts.ExpiresAfterJoin, "expires-after-join", false, "Delete the invite once a device has joined with it")
+	cmd.Flags().BoolVar(&opts.QR, "qr", false, "Print QR code for the invite URL")
+	_ = cmd.RegisterFlagCompletionFunc("scope", cobra.FixedCompletions([]string{"node", "client"}, cobra.ShellCompDirectiveNoFileComp))
 
 	return cmd
 }
@@ -1226,8 +2673,9 @@ func revokeCmd() *cobra.Command {
 
 func msgCmd() *cobra.Command {
 	var (
-		from     string
-		delivery string
+		from       string
+		delivery   string
+		jsonOutput bool
 	)
 
 	cmd := &cobra.Command{
@@ -1246,7 +2694,7 @@ func msgCmd() *cobra.Command {
 				}
 			}
 
-			toID, err := client.ResolveSessionArg(target, args[0])
+			toID, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
 			if err != nil {
 				return err
 			}
@@ -1259,7 +2707,7 @@ func msgCmd() *cobra.Command {
 
 			var fromID *uint32
 			if from != "" {
-				resolved, err := client.ResolveSessionArg(target, from)
+				resolved, err := client.ResolveSessionArg(cmd.Context(), target, from)
 				if err != nil {
 					return err
 				}
@@ -1267,12 +2715,13 @@ func msgCmd() *cobra.Command {
 			}
 
 			resolved := resolveDelivery(delivery, from)
-			return client.Msg(target, fromID, toID, args[1], resolved)
+			return client.Msg(cmd.Context(), target, fromID, toID, args[1], resolved, jsonOutput)
 		},
 	}
 
 	cmd.Flags().StringVarP(&from, "from", "f", "", "Sender session (ID or name)")
 	cmd.Flags().StringVar(&delivery, "delivery", "auto", "Delivery mode: auto|inbox|pty|both")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
 
 	return cmd
 }
@@ -1294,7 +2743,10 @@ func resolveDelivery(delivery, from string) string {
 // ---------------------------------------------------------------------------
 
 func inboxCmd() *cobra.Command {
-	var tail int
+	var (
+		tail       int
+		jsonOutput bool
+	)
 
 	cmd := &cobra.Command{
 		Use:               "inbox <session>",
@@ -1313,16 +2765,17 @@ func inboxCmd() *cobra.Command {
 				}
 			}
 
-			sessionID, err := client.ResolveSessionArg(target, args[0])
+			sessionID, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
 			if err != nil {
 				return err
 			}
 
-			return client.Inbox(target, sessionID, tail)
+			return client.Inbox(cmd.Context(), target, sessionID, tail, jsonOutput)
 		},
 	}
 
 	cmd.Flags().IntVarP(&tail, "tail", "t", 50, "Number of messages to show")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
 
 	return cmd
 }
@@ -1332,12 +2785,26 @@ func inboxCmd() *cobra.Command {
 // ---------------------------------------------------------------------------
 
 func listenCmd() *cobra.Command {
-	var sessionArg string
+	var (
+		sessionArg string
+		format     string
+		jsonOutput bool
+	)
 
 	cmd := &cobra.Command{
 		Use:   "listen",
 		Short: "Stream all message traffic in real-time",
+		Long: `Stream all message traffic in real-time: direct messages, requests and
+replies.
+
+--format ndjson prints each message event as a line of JSON, in the same shape
+as cw subscribe --format ndjson.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			ndjson, err := ndjsonFormat(format, jsonOutput)
+			if err != nil {
+				return err
+			}
+
 			target, err := resolveTarget()
 			if err != nil {
 				return err
@@ -1351,18 +2818,21 @@ func listenCmd() *cobra.Command {
 
 			var sessionID *uint32
 			if sessionArg != "" {
-				resolved, err := client.ResolveSessionArg(target, sessionArg)
+				resolved, err := client.ResolveSessionArg(cmd.Context(), target, sessionArg)
 				if err != nil {
 					return err
 				}
 				sessionID = &resolved
 			}
 
-			return client.Listen(target, sessionID)
+			return client.Listen(cmd.Context(), target, sessionID, ndjson)
 		},
 	}
 
 	cmd.Flags().StringVar(&sessionArg, "session", "", "Filter by session (ID or name)")
+	cmd.Flags().StringVar(&format, "format", "text", "Output format: text or ndjson")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Same as --format ndjson")
+	_ = cmd.RegisterFlagCompletionFunc("format", formatCompletionFunc)
 
 	return cmd
 }
@@ -1373,10 +2843,11 @@ func listenCmd() *cobra.Command {
 
 func requestCmd() *cobra.Command {
 	var (
-		from      string
-		timeout   uint64
-		rawOutput bool
-		delivery  string
+		from       string
+		timeout    uint64
+		rawOutput  bool
+		delivery   string
+		jsonOutput bool
 	)
 
 	cmd := &cobra.Command{
@@ -1395,7 +2866,7 @@ func requestCmd() *cobra.Command {
 				}
 			}
 
-			toID, err := client.ResolveSessionArg(target, args[0])
+			toID, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
 			if err != nil {
 				return err
 			}
@@ -1408,21 +2879,26 @@ func requestCmd() *cobra.Command {
 
 			var fromID *uint32
 			if from != "" {
-				resolved, err := client.ResolveSessionArg(target, from)
+				resolved, err := client.ResolveSessionArg(cmd.Context(), target, from)
 				if err != nil {
 					return err
 				}
 				fromID = &resolved
 			}
 
+			if rawOutput && jsonOutput {
+				return fmt.Errorf("--raw cannot be combined with --json")
+			}
+
 			resolved := resolveDelivery(delivery, from)
-			return client.Request(target, fromID, toID, args[1], timeout, rawOutput, resolved)
+			return client.Request(cmd.Context(), target, fromID, toID, args[1], timeout, rawOutput, resolved, jsonOutput)
 		},
 	}
 
 	cmd.Flags().StringVarP(&from, "from", "f", "", "Sender session (ID or name)")
 	cmd.Flags().Uint64Var(&timeout, "timeout", 60, "Timeout in seconds")
 	cmd.Flags().BoolVar(&rawOutput, "raw", false, "Print only the reply body without prefix")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
 	cmd.Flags().StringVar(&delivery, "delivery", "auto", "Delivery mode: auto|inbox|pty|both")
 
 	return cmd
@@ -1433,7 +2909,10 @@ func requestCmd() *cobra.Command {
 // ---------------------------------------------------------------------------
 
 func replyCmd() *cobra.Command {
-	var from string
+	var (
+		from       string
+		jsonOutput bool
+	)
 
 	cmd := &cobra.Command{
 		Use:   "reply <request-id> <body>",
@@ -1459,18 +2938,19 @@ func replyCmd() *cobra.Command {
 
 			var fromID *uint32
 			if from != "" {
-				resolved, err := client.ResolveSessionArg(target, from)
+				resolved, err := client.ResolveSessionArg(cmd.Context(), target, from)
 				if err != nil {
 					return err
 				}
 				fromID = &resolved
 			}
 
-			return client.Reply(target, fromID, args[0], args[1])
+			return client.Reply(cmd.Context(), target, fromID, args[0], args[1], jsonOutput)
 		},
 	}
 
 	cmd.Flags().StringVarP(&from, "from", "f", "", "Sender session (ID or name)")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
 
 	return cmd
 }
@@ -1501,7 +2981,19 @@ Human notification (macOS):
   cw gateway --notify macos
 
 Combined (LLM first, macOS notification on ESCALATE):
-  cw gateway --exec '...' --notify macos`,
+  cw gateway --exec '...' --notify macos
+
+Slack or Discord approval (requires a relay, see 'cw setup'):
+  cw gateway --exec '...' --notify slack:https://hooks.slack.com/services/...
+  cw gateway --exec '...' --notify discord:https://discord.com/api/webhooks/...
+
+ESCALATE requests are posted to the webhook with a relay approval link; the
+Approve/Deny click is sent back to the worker as the reply. The relay sends
+it to the node that registered the request, so slack: and discord: only work
+against the local node, not with --server.
+
+Without --exec or --notify, the [gateway] table of the nearest .codewire.toml
+supplies them; its exec command runs in the project directory.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			target, err := resolveTarget()
 			if err != nil {
@@ -1512,12 +3004,27 @@ Combined (LLM first, macOS notification on ESCALATE):
 					return err
 				}
 			}
-			return client.Gateway(target, name, execCmd, notify)
+			// Unless given as flags, the policy comes from .codewire.toml.
+			project, err := config.FindProjectConfig(".")
+			if err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("exec") && project.Gateway.Exec != "" {
+				execCmd = project.Gateway.Exec
+				// It may name scripts relative to the project.
+				if err := os.Chdir(project.Dir); err != nil {
+					return err
+				}
+			}
+			if !cmd.Flags().Changed("notify") {
+				notify = project.Gateway.Notify
+			}
+			return client.Gateway(cmd.Context(), target, name, execCmd, notify)
 		},
 	}
 	cmd.Flags().StringVar(&name, "name", "gateway", "Session name to register as")
 	cmd.Flags().StringVar(&execCmd, "exec", "", "Shell command to evaluate requests (body on stdin); default auto-approves all")
-	cmd.Flags().StringVar(&notify, "notify", "", "Notification method: macos or ntfy:<url>")
+	cmd.Flags().StringVar(&notify, "notify", "", "Notification method: macos, ntfy:<url>, slack:<webhook-url>, or discord:<webhook-url>")
 	return cmd
 }
 
@@ -1530,18 +3037,24 @@ func hookCmd() *cobra.Command {
 
 	cmd := &cobra.Command{
 		Use:   "hook",
-		Short: "Claude Code PreToolUse hook — routes tool calls through the gateway",
-		Long: `Run as a Claude Code PreToolUse hook. Reads the tool call JSON from stdin,
-checks if a gateway session is running, and blocks the call if the gateway
-returns a DENIED reply.
+		Short: "Claude Code hook — routes tool calls through the gateway",
+		Long: `Run as a Claude Code hook. Reads the hook JSON from stdin.
+
+PreToolUse: checks if a gateway session is running, and blocks the call if
+the gateway returns a DENIED reply.
+
+PostToolUse and Stop: when running inside a codewire session (CW_SESSION_ID),
+records the outcome as a session.tool_result or session.agent_stopped event.
 
-Install the hook automatically:
+Install the hooks automatically:
   cw hook --install
 
 Or add manually to ~/.claude/settings.json:
   {
     "hooks": {
-      "PreToolUse": [{"hooks": [{"type": "command", "command": "cw hook"}]}]
+      "PreToolUse":  [{"hooks": [{"type": "command", "command": "cw hook"}]}],
+      "PostToolUse": [{"hooks": [{"type": "command", "command": "cw hook"}]}],
+      "Stop":        [{"hooks": [{"type": "command", "command": "cw hook"}]}]
     }
   }
 
@@ -1558,7 +3071,14 @@ Exit codes:
 				// Node not running — allow by default (don't block agent work).
 				return nil
 			}
-			blocked, err := client.Hook(target, os.Stdin, os.Stdout)
+			var sessionID *uint32
+			if envID := os.Getenv("CW_SESSION_ID"); envID != "" {
+				if id, err := strconv.ParseUint(envID, 10, 32); err == nil {
+					v := uint32(id)
+					sessionID = &v
+				}
+			}
+			blocked, err := client.HookForSession(cmd.Context(), target, sessionID, os.Stdin, os.Stdout)
 			if err != nil {
 				return err
 			}
@@ -1568,10 +3088,33 @@ Exit codes:
 			return nil
 		},
 	}
-	cmd.Flags().BoolVar(&install, "install", false, "Add PreToolUse hook entry to ~/.claude/settings.json")
+	cmd.Flags().BoolVar(&install, "install", false, "Add PreToolUse, PostToolUse, and Stop hook entries to ~/.claude/settings.json")
 	return cmd
 }
 
+// ---------------------------------------------------------------------------
+// schemaCmd — JSON Schemas of --json output
+// ---------------------------------------------------------------------------
+
+func schemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema [command]",
+		Short: "Print the JSON Schema of a command's --json output",
+		Long: `Print the JSON Schema of what a command prints with --json, such as
+cw schema run or cw schema kv list. Without a command, print an object mapping
+every command with --json output to its schema.
+
+These schemas are stable: new releases may add fields, but do not rename or
+remove them.`,
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return client.SchemaCommands(), cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return client.Schema(strings.Join(args, " "))
+		},
+	}
+}
+
 // ---------------------------------------------------------------------------
 // completionCmd — shell completion with --install support
 // ---------------------------------------------------------------------------
@@ -1783,7 +3326,7 @@ func sessionCompletionFunc(cmd *cobra.Command, args []string, toComplete string)
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
-	return client.ListSessionsForCompletion(target), cobra.ShellCompDirectiveNoFileComp
+	return client.ListSessionsForCompletion(cmd.Context(), target), cobra.ShellCompDirectiveNoFileComp
 }
 
 func tagCompletionFunc(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -1791,7 +3334,7 @@ func tagCompletionFunc(cmd *cobra.Command, args []string, toComplete string) ([]
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
-	return client.ListTagsForCompletion(target), cobra.ShellCompDirectiveNoFileComp
+	return client.ListTagsForCompletion(cmd.Context(), target), cobra.ShellCompDirectiveNoFileComp
 }
 
 // ---------------------------------------------------------------------------
@@ -1799,6 +3342,9 @@ func tagCompletionFunc(cmd *cobra.Command, args []string, toComplete string) ([]
 // ---------------------------------------------------------------------------
 
 func dataDir() string {
+	if dir := os.Getenv("CODEWIRE_DIR"); dir != "" {
+		return dir
+	}
 	home := os.Getenv("HOME")
 	if home == "" {
 		fmt.Fprintln(os.Stderr, "[cw] ERROR: $HOME environment variable is not set")
@@ -1809,40 +3355,48 @@ func dataDir() string {
 }
 
 func resolveTarget() (*client.Target, error) {
-	dir := dataDir()
-
-	if serverFlag == "" {
-		return &client.Target{Local: dir}, nil
+	target, err := client.ResolveTarget(dataDir(), serverFlag, tokenFlag)
+	if err != nil {
+		return nil, err
 	}
-
-	// Check servers.toml for a named entry.
-	servers, err := config.LoadServersConfig(dir)
-	if err == nil {
-		if entry, ok := servers.Servers[serverFlag]; ok {
-			token := tokenFlag
-			if token == "" {
-				token = entry.Token
-			}
-			return &client.Target{URL: entry.URL, Token: token}, nil
+	target.Version = version
+	if nodeFlag != "" {
+		if target.IsLocal() || target.SSH != "" {
+			return nil, fmt.Errorf("--node requires --server set to a relay")
 		}
+		target.Node = nodeFlag
 	}
+	return target, nil
+}
 
-	// Treat serverFlag as a direct URL.
-	url := serverFlag
-	if strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") {
-		// Relay URL — token is optional (relay handles auth).
-		return &client.Target{URL: url, Token: tokenFlag}, nil
+// detachKey returns the byte of the configured detach key (client.detach_key
+// or CODEWIRE_DETACH_KEY).
+func detachKey() (byte, error) {
+	cfg, err := config.LoadConfig(dataDir())
+	if err != nil {
+		return 0, err
 	}
+	return terminal.ParseDetachKey(cfg.Client.DetachKey)
+}
 
-	if tokenFlag == "" {
-		return nil, fmt.Errorf("--token required for ad-hoc WebSocket server")
+// selfArgs returns the cw executable followed by the global connection flags,
+// for commands that spawn cw again (e.g. tmux panes running cw attach).
+func selfArgs() []string {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "cw"
 	}
-
-	if !strings.HasPrefix(url, "ws://") && !strings.HasPrefix(url, "wss://") {
-		url = "ws://" + url
+	args := []string{exe}
+	if serverFlag != "" {
+		args = append(args, "--server", serverFlag)
 	}
-
-	return &client.Target{URL: url, Token: tokenFlag}, nil
+	if tokenFlag != "" {
+		args = append(args, "--token", tokenFlag)
+	}
+	if nodeFlag != "" {
+		args = append(args, "--node", nodeFlag)
+	}
+	return args
 }
 
 func ensureNode() error {
@@ -1859,29 +3413,69 @@ func ensureNode() error {
 	_ = os.Remove(sock)
 	_ = os.MkdirAll(dir, 0o755)
 
-	// Spawn `cw node` in background.
-	exe, _ := os.Executable()
-	cmd := exec.Command(exe, "node")
-	cmd.Stdin = nil
-	cmd.Stdout = nil
-	cmd.Stderr = nil
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	pid, err := spawnNode(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "[cw] node started (pid %d)\n", pid)
+	return nil
+}
+
+// spawnNode starts `cw node --log` detached from the terminal, with extra
+// arguments appended, and waits until it has written its PID file and is
+// accepting connections.
+func spawnNode(dir string, extra ...string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("locating cw executable: %w", err)
+	}
+
+	// Anything the node writes outside the structured log, such as a panic,
+	// goes to the log file too.
+	logPath := node.LogPath(dir)
+	out, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("opening node log: %w", err)
+	}
+	defer out.Close()
 
+	cmd := exec.Command(exe, append([]string{"node", "--log"}, extra...)...)
+	cmd.Dir = "/"
+	cmd.Stdin = nil
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = node.DetachedProcAttr()
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("spawning node: %w", err)
+		return 0, fmt.Errorf("spawning node: %w", err)
 	}
-	fmt.Fprintf(os.Stderr, "[cw] node started (pid %d)\n", cmd.Process.Pid)
+	pid := cmd.Process.Pid
+
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
 
-	// Wait for socket to become available.
-	for i := 0; i < 50; i++ {
-		time.Sleep(100 * time.Millisecond)
+	// Wait for the node to take over the PID file and socket. With --handoff
+	// the socket is already up, so the PID file is what shows it is ready.
+	pidPath := filepath.Join(dir, "codewire.pid")
+	sock := filepath.Join(dir, "codewire.sock")
+	deadline := time.Now().Add(15 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case <-exited:
+			return 0, fmt.Errorf("node exited during startup (see %s)", logPath)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if data, err := os.ReadFile(pidPath); err != nil || strings.TrimSpace(string(data)) != strconv.Itoa(pid) {
+			continue
+		}
 		if conn, err := net.Dial("unix", sock); err == nil {
 			conn.Close()
-			return nil
+			return pid, nil
 		}
 	}
-
-	return fmt.Errorf("node failed to start (socket not available after 5s)")
+	return 0, fmt.Errorf("node failed to start (not accepting connections after 15s, see %s)", logPath)
 }
 
 func resolveRelayURL() (string, error) {
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestRunBackend(t *testing.T) {
+	tests := []struct {
+		backend     string
+		opts        []string
+		docker      string
+		k8s         bool
+		image       string
+		wantBackend string
+		wantOpts    map[string]string
+	}{
+		{"", nil, "", false, "", "", nil},
+		{"ssh", []string{"host=box", "dir=~/src"}, "", false, "", "ssh", map[string]string{"host": "box", "dir": "~/src"}},
+		{"", nil, "node:22", false, "", "docker", map[string]string{"image": "node:22"}},
+		{"", []string{"namespace=agents"}, "", true, "ghcr.io/acme/agent", "kubernetes", map[string]string{"image": "ghcr.io/acme/agent", "namespace": "agents"}},
+		{"kubernetes", nil, "", true, "alpine", "kubernetes", map[string]string{"image": "alpine"}},
+	}
+	for _, tt := range tests {
+		backend, opts, err := runBackend(tt.backend, tt.opts, tt.docker, tt.k8s, tt.image)
+		if err != nil || backend != tt.wantBackend || !maps.Equal(opts, tt.wantOpts) {
+			t.Errorf("runBackend(%q, %q, %q, %v, %q) = %q, %v, %v", tt.backend, tt.opts, tt.docker, tt.k8s, tt.image, backend, opts, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		backend string
+		opts    []string
+		docker  string
+		k8s     bool
+		image   string
+		want    string
+	}{
+		{"", []string{"image"}, "", false, "", "expected key=value"},
+		{"ssh", nil, "alpine", false, "", "--docker cannot be combined with --backend ssh"},
+		{"", nil, "alpine", true, "alpine", "cannot be combined"},
+		{"", nil, "", true, "", "--k8s needs --image"},
+		{"", nil, "", false, "alpine", "only used with --k8s"},
+	} {
+		if _, _, err := runBackend(tt.backend, tt.opts, tt.docker, tt.k8s, tt.image); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("runBackend(%q, %q, %q, %v, %q): got %v, want %q", tt.backend, tt.opts, tt.docker, tt.k8s, tt.image, err, tt.want)
+		}
+	}
+}
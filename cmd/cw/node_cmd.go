@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/node"
+)
+
+func nodeStdioCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stdio",
+		Short: "Relay stdin and stdout to the node",
+		Long: `Connect stdin and stdout to the node's socket, starting the node if it is not
+running. Clients with --server ssh://host run this on the host over SSH.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := ensureNode(); err != nil {
+				return err
+			}
+			return client.ServeStdio(dataDir(), os.Stdin, os.Stdout)
+		},
+	}
+}
+
+func nodeLogsCmd() *cobra.Command {
+	var (
+		follow bool
+		tail   int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "View the node's log",
+		Long: `Print the node's log, node.log in the data directory. The node writes it when
+started with --daemon or --log, or automatically by another command; a node
+running in the foreground logs to stderr instead. Entries are JSON lines.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := node.LogPath(dataDir())
+			f, err := os.Open(path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return fmt.Errorf("no node log at %s", path)
+				}
+				return err
+			}
+			defer f.Close()
+
+			if cmd.Flags().Changed("tail") {
+				data, err := io.ReadAll(f)
+				if err != nil {
+					return err
+				}
+				lines := strings.SplitAfter(string(data), "\n")
+				if lines[len(lines)-1] == "" {
+					lines = lines[:len(lines)-1]
+				}
+				if tail < len(lines) {
+					lines = lines[len(lines)-tail:]
+				}
+				fmt.Print(strings.Join(lines, ""))
+			} else if _, err := io.Copy(os.Stdout, f); err != nil {
+				return err
+			}
+
+			if follow {
+				return followNodeLog(f, path)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow log output")
+	cmd.Flags().IntVarP(&tail, "tail", "t", 0, "Number of lines to show from end")
+
+	return cmd
+}
+
+func nodeExportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "export <file>",
+		Short: "Export the node's state for moving it to another machine",
+		Long: `Write the node's state to a zstd-compressed tar file (state.tar.zst, say):
+session metadata and logs, messages and events, launch history, cron jobs,
+session archives, tokens, saved servers and config.toml, relay credentials
+included. A running node writes the export itself, adding the entries of its
+KV store, which it keeps in memory; with the node stopped, those are gone.
+Worktree checkouts are left out: they belong to repositories on this machine.
+
+The export holds credentials; keep it private. Import it on the other
+machine with 'cw node import', and stop this node afterwards: both would use
+the same relay credentials.`,
+		Example: `  cw node export state.tar.zst
+  cw node import state.tar.zst    # on the new machine`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, err := filepath.Abs(args[0])
+			if err != nil {
+				return err
+			}
+			dir := dataDir()
+			if conn, err := net.Dial("unix", filepath.Join(dir, "codewire.sock")); err == nil {
+				conn.Close()
+				target := &client.Target{Local: dir, Token: tokenFlag}
+				if err := client.ExportState(cmd.Context(), target, output); err != nil {
+					return err
+				}
+			} else if _, err := node.ExportState(dir, output, nil); err != nil {
+				return err
+			}
+
+			manifest, err := node.ReadStateManifest(output)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "[cw] exported %d files and %d KV entries from %s to %s\n", manifest.Files, manifest.KVEntries, manifest.DataDir, output)
+			return nil
+		},
+	}
+}
+
+func nodeImportCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import a node's state exported with 'cw node export'",
+		Long: `Unpack a node's state, as written by 'cw node export' on another machine, into
+the data directory. Paths under the exported data directory, in session
+metadata, config.toml and the like, are rewritten to be under this one.
+Sessions that were running when exported are recorded as killed, since their
+processes stayed behind; their logs and messages are kept. The KV entries
+are loaded when the node next starts.
+
+The node must not be running. Into a data directory that already holds a
+node's state, --force is needed, and replaces the files the export has.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := dataDir()
+			if conn, err := net.Dial("unix", filepath.Join(dir, "codewire.sock")); err == nil {
+				conn.Close()
+				return fmt.Errorf("the node is running; stop it first (cw node stop)")
+			}
+
+			manifest, err := node.ImportState(node.ImportOptions{Input: args[0], DataDir: dir, Force: force})
+			if err != nil {
+				return err
+			}
+			from := manifest.DataDir
+			if manifest.Node != "" {
+				from = fmt.Sprintf("node %s (%s)", manifest.Node, manifest.DataDir)
+			}
+			fmt.Fprintf(os.Stderr, "[cw] imported %d files and %d KV entries from %s, exported %s\n",
+				manifest.Files, manifest.KVEntries, from, manifest.ExportedAt.Local().Format("2006-01-02 15:04:05"))
+			fmt.Fprintln(os.Stderr, "[cw] start the node with 'cw node --daemon'")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&force, "force", false, "Import over an existing node's state")
+
+	return cmd
+}
+
+// followNodeLog prints what is appended to f, moving on to the new file at
+// path when the log rotates.
+func followNodeLog(f *os.File, path string) error {
+	for {
+		if _, err := io.Copy(os.Stdout, f); err != nil {
+			return err
+		}
+		time.Sleep(250 * time.Millisecond)
+
+		cur, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		next, err := os.Stat(path)
+		if err != nil || os.SameFile(cur, next) {
+			continue
+		}
+		// Rotated: finish the old file, then start on the new one.
+		if _, err := io.Copy(os.Stdout, f); err != nil {
+			return err
+		}
+		nf, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		f.Close()
+		f = nf
+	}
+}
+
+func nodeInstallServiceCmd() *cobra.Command {
+	var print bool
+
+	cmd := &cobra.Command{
+		Use:   "install-service",
+		Short: "Run the node as a systemd or launchd user service",
+		Long: `Install a systemd user unit (Linux) or launchd agent (macOS) that starts the
+node at login, restarts it if it fails, and logs to node.log in the data
+directory. The service runs this cw binary with the current PATH, which
+sessions inherit.
+
+Stopping or restarting the service stops only the node, not its sessions;
+the restarted node adopts the sessions still running (see orphan_policy).
+
+With --print the unit is written to stdout instead of installed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			exe, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("locating cw executable: %w", err)
+			}
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+
+			var path, unit, next string
+			switch runtime.GOOS {
+			case "linux":
+				configDir := os.Getenv("XDG_CONFIG_HOME")
+				if configDir == "" {
+					configDir = filepath.Join(home, ".config")
+				}
+				path = filepath.Join(configDir, "systemd", "user", "codewire.service")
+				unit = systemdUnit(exe, os.Getenv("PATH"))
+				next = "systemctl --user daemon-reload\nsystemctl --user enable --now codewire"
+			case "darwin":
+				path = filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist")
+				unit = launchdPlist(exe, os.Getenv("PATH"), node.LogPath(dataDir()))
+				next = "launchctl load -w " + path
+			default:
+				return fmt.Errorf("install-service is not supported on %s", runtime.GOOS)
+			}
+
+			if print {
+				fmt.Print(unit)
+				return nil
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, []byte(unit), 0o644); err != nil {
+				return fmt.Errorf("writing %s: %w", path, err)
+			}
+			fmt.Printf("Wrote %s\n\nStop any node already running ('cw node stop'), then start the service:\n\n%s\n", path, next)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&print, "print", false, "Print the unit instead of installing it")
+
+	return cmd
+}
+
+const launchdLabel = "dev.codewire.node"
+
+func systemdUnit(exe, path string) string {
+	return fmt.Sprintf(`[Unit]
+Description=Codewire node
+
+[Service]
+ExecStart=%s node --log
+Environment=%s
+Restart=on-failure
+RestartSec=2
+# Sessions outlive the node; a restarted node adopts them.
+KillMode=process
+
+[Install]
+WantedBy=default.target
+`, strconv.Quote(exe), strconv.Quote("PATH="+path))
+}
+
+func launchdPlist(exe, path, logPath string) string {
+	esc := func(s string) string {
+		var b bytes.Buffer
+		_ = xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>%s</string>
+		<string>node</string>
+		<string>--log</string>
+	</array>
+	<key>EnvironmentVariables</key>
+	<dict>
+		<key>PATH</key>
+		<string>%s</string>
+	</dict>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<!-- Sessions outlive the node; a restarted node adopts them. -->
+	<key>AbandonProcessGroup</key>
+	<true/>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, launchdLabel, esc(exe), esc(path), esc(logPath))
+}
@@ -0,0 +1,15 @@
+package main
+
+import "os"
+
+// stopNodeProcess terminates the node. Windows has no SIGTERM to deliver to
+// a detached process, so the node does not get to shut down cleanly. It
+// returns os.ErrProcessDone if the process no longer exists.
+func stopNodeProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return os.ErrProcessDone
+	}
+	defer p.Release()
+	return p.Kill()
+}
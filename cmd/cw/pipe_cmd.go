@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func pipeCmd() *cobra.Command {
+	var (
+		grep       string
+		replace    string
+		jsonOutput bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "pipe <from-session> <to-session>",
+		Short: "Forward one session's output into another session's input",
+		Long: `Forward each line of one session's output into another session's input,
+followed by Enter. Lines are sent as a terminal shows them: escape codes are
+stripped, output the source's log redacts is redacted, and blank lines are
+skipped.
+
+With --grep, only lines matching the regular expression are forwarded, and
+--replace rewrites the matches ($1 and ${name} expand to submatches), so
+
+  cw pipe builder fixer --grep '^(.+\.go):(\d+): (.*)' --replace 'fix $1 line $2: $3'
+
+hands each compiler error to the fixer agent.
+
+The node runs the pipe, so it keeps going after cw pipe returns, until either
+session exits or 'cw pipe remove' stops it. Pipes do not survive a node
+restart.`,
+		Example: `  cw pipe 1 2
+  cw pipe tests fixer --grep FAIL
+  cw pipe list
+  cw pipe remove 1`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			from, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
+			if err != nil {
+				return err
+			}
+			to, err := client.ResolveSessionArg(cmd.Context(), target, args[1])
+			if err != nil {
+				return err
+			}
+
+			return client.PipeAdd(cmd.Context(), target, from, to, grep, replace, jsonOutput)
+		},
+	}
+
+	cmd.Flags().StringVar(&grep, "grep", "", "Forward only lines matching this regular expression")
+	cmd.Flags().StringVar(&replace, "replace", "", "Rewrite matches of --grep with this template")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	cmd.AddCommand(
+		pipeListCmd(),
+		pipeRemoveCmd(),
+	)
+
+	return cmd
+}
+
+func pipeListCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List pipes between sessions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.PipeList(cmd.Context(), target, jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
+
+func pipeRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <pipe-id>",
+		Short: "Stop a pipe (both sessions keep running)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid pipe id %q", args[0])
+			}
+
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.PipeRemove(cmd.Context(), target, uint32(id))
+		},
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -14,6 +15,8 @@ import (
 func platformListCmd() *cobra.Command {
 	var jsonOutput bool
 	var statusFilter string
+	var opts client.ListOptions
+	var watchSecs int
 
 	cmd := &cobra.Command{
 		Use:   "list",
@@ -31,7 +34,10 @@ func platformListCmd() *cobra.Command {
 						return err
 					}
 				}
-				return client.List(target, jsonOutput, statusFilter)
+				opts.JSON = jsonOutput
+				opts.Status = statusFilter
+				opts.Watch = time.Duration(watchSecs) * time.Second
+				return client.List(cmd.Context(), target, opts)
 			}
 
 			orgID, pc, err := getDefaultOrg()
@@ -69,9 +75,19 @@ func platformListCmd() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
-	cmd.Flags().StringVar(&statusFilter, "status", "all", "Filter by status (standalone mode): all, running, completed, killed")
+	cmd.Flags().StringVar(&statusFilter, "status", "all", "Filter by status (standalone mode): all, running, queued, completed, killed")
 	_ = cmd.RegisterFlagCompletionFunc("status", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"all", "running", "completed", "killed"}, cobra.ShellCompDirectiveNoFileComp
+		return []string{"all", "running", "queued", "completed", "killed"}, cobra.ShellCompDirectiveNoFileComp
 	})
+	cmd.Flags().StringVar(&opts.Sort, "sort", "id", "Sort sessions (standalone mode): id, age, name, status")
+	_ = cmd.RegisterFlagCompletionFunc("sort", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"id", "age", "name", "status"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	cmd.Flags().StringSliceVarP(&opts.Tags, "tag", "t", nil, "Only show sessions with this tag (repeatable, standalone mode)")
+	_ = cmd.RegisterFlagCompletionFunc("tag", tagCompletionFunc)
+	cmd.Flags().StringVarP(&opts.Selector, "selector", "l", "", "Only show sessions whose labels match, e.g. repo=webapp,ticket!=X (standalone mode)")
+	cmd.Flags().BoolVarP(&opts.Wide, "wide", "w", false, "Show working directory, PID and git state (standalone mode)")
+	cmd.Flags().IntVar(&watchSecs, "watch", 0, "Refresh the table every N seconds (standalone mode; default 2 when given without a value)")
+	cmd.Flags().Lookup("watch").NoOptDefVal = "2"
 	return cmd
 }
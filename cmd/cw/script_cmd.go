@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func scriptCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "script",
+		Short: "Drive interactive sessions with expect/send scripts",
+	}
+
+	cmd.AddCommand(scriptRunCmd())
+
+	return cmd
+}
+
+func scriptRunCmd() *cobra.Command {
+	var (
+		sessionArg string
+		from       string
+		jsonOutput bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "run <steps.yaml> --session <session>",
+		Short: "Run expect/send steps against a session's output",
+		Long: `Have the node run a script of expect/send steps against a session, for
+interactive flows such as logins and menus that sleep-and-send automation
+gets wrong. Each step waits for the session's output to match its expect
+pattern (a Go regular expression, matched with ANSI codes stripped and
+across lines, so a prompt without a newline matches), then sends its send
+text and keys (as cw send --key). A step sees the output after the previous
+step's match; the first also sees the session's current line, so a prompt
+already on screen matches it.
+
+The script stops at the first step whose pattern does not match within its
+timeout (default 30s), printing the output that step saw, and cw exits 1.
+Given "-", the steps are read from stdin.
+
+  timeout: 20s                 # for every step (optional)
+  steps:
+    - expect: 'Username: ?$'
+      send: "admin\r"
+    - expect: 'Password: ?$'
+      send: "hunter2\r"
+      timeout: 5s
+    - expect: 'Select a project'
+      keys: [down, down, enter]
+    - expect: '\$ $'`,
+		Example: `  cw script run login.yaml --session db-shell
+  cw script run - --session installer < steps.yaml`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			steps, err := client.LoadScript(args[0])
+			if err != nil {
+				return err
+			}
+
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, sessionArg)
+			if err != nil {
+				return err
+			}
+
+			if from == "" {
+				from = os.Getenv("CW_SESSION_ID")
+			}
+			var fromID *uint32
+			if from != "" {
+				id, err := client.ResolveSessionArg(cmd.Context(), target, from)
+				if err != nil {
+					return err
+				}
+				fromID = &id
+			}
+
+			return client.RunScript(cmd.Context(), target, resolved, fromID, steps, jsonOutput)
+		},
+	}
+
+	cmd.Flags().StringVar(&sessionArg, "session", "", "Session to run the script against (ID or name)")
+	cmd.Flags().StringVar(&from, "from", "", "Sender session (ID or name; default: CW_SESSION_ID), checked against the session's --accept-input-from")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output the result as JSON")
+	_ = cmd.MarkFlagRequired("session")
+	_ = cmd.RegisterFlagCompletionFunc("session", sessionCompletionFunc)
+
+	return cmd
+}
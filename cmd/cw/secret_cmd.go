@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func secretCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Store secrets for cw run --secret",
+		Long: `cw run --secret NAME@<ref> sets NAME in the session's environment to a
+secret looked up when the session is launched. The value is not saved in
+sessions.json or events, is not shown by cw status, and stays off command
+lines (the ssh and kubernetes backends refuse secrets for that reason).
+
+References:
+  envfile://<path>[#KEY]               a dotenv file; KEY defaults to NAME
+  1password://<vault>/<item>/<field>   1Password, with the op CLI
+  vault://<path>[#field]               HashiCorp Vault, with vault kv get;
+                                       field defaults to NAME
+  kv://<namespace>/<key>               the relay's KV store, sealed with
+                                       cw secret set
+
+Values in the KV store are encrypted with the key in secrets.key in the data
+directory; machines that read them need a copy of that file.`,
+		Example: `  cw secret set kv://team/openai < key.txt
+  cw run --secret OPENAI_API_KEY@kv://team/openai -- claude
+  cw run --secret OPENAI_API_KEY@1password://Dev/OpenAI/credential -- claude
+  cw run --secret DB_PASSWORD@envfile://.env -- ./migrate`,
+	}
+	cmd.AddCommand(secretSetCmd())
+	return cmd
+}
+
+func secretSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set kv://<namespace>/<key>",
+		Short: "Encrypt a secret read from stdin into the relay's KV store",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !strings.HasPrefix(args[0], "kv://") {
+				return fmt.Errorf("cw secret set stores kv://<namespace>/<key> references; other providers are managed with their own tools")
+			}
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("reading secret from stdin: %w", err)
+			}
+			value := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+			if value == "" {
+				return fmt.Errorf("no secret on stdin")
+			}
+
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+			return client.SecretSet(cmd.Context(), target, dataDir(), args[0], value)
+		},
+	}
+}
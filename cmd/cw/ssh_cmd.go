@@ -35,7 +35,7 @@ func sshCmd() *cobra.Command {
 		Long: `Connect to a running sandbox environment via SSH.
 
 Interactive mode (default):
-  Connects via SSH with PTY, resize support, and Ctrl+B d to detach.
+  Connects via SSH with PTY, resize support, and Ctrl+B d (client.detach_key) to detach.
 
 Stdio mode (--stdio):
   For use as SSH ProxyCommand. Pipes stdin/stdout directly to the SSH proxy.
@@ -481,7 +481,11 @@ func runSSHSession(sshClient *ssh.Client) error {
 	resizeCh, resizeCleanup := terminal.ResizeSignal()
 	defer resizeCleanup()
 
-	detach := terminal.NewDetachDetector()
+	prefix, err := detachKey()
+	if err != nil {
+		return err
+	}
+	detach := terminal.NewDetachDetectorKey(prefix)
 	done := make(chan error, 1)
 
 	go func() {
@@ -597,7 +601,11 @@ func terminalFallback(client *platform.Client, orgID, envID string) error {
 	}()
 
 	done := make(chan error, 2)
-	detach := terminal.NewDetachDetector()
+	prefix, err := detachKey()
+	if err != nil {
+		return err
+	}
+	detach := terminal.NewDetachDetectorKey(prefix)
 
 	// stdin -> WebSocket (with terminal framing: 0x00 prefix for stdin)
 	go func() {
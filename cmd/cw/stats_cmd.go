@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func statsCmd() *cobra.Command {
+	var (
+		all        bool
+		since      string
+		jsonOutput bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "stats [session]",
+		Short: "Show what sessions have used",
+		Long: `Show a session's runtime, output and input volume, the messages it sent and
+received, and the approvals it requested and had denied. For sessions running
+a known agent CLI (claude, codex, aider), the tokens and cost it reported are
+parsed from its transcript or output.
+
+With --all, show every session on the node and their total, or with --since
+only those created in that time (e.g. 24h, 7d). Input is counted since the
+node started.`,
+		Example: `  cw stats planner
+  cw stats --all --since 7d
+  cw stats --all --json`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: sessionCompletionFunc,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if all == (len(args) == 1) {
+				return fmt.Errorf("give a session or --all")
+			}
+			if since != "" && !all {
+				return fmt.Errorf("--since requires --all")
+			}
+			var age time.Duration
+			if since != "" {
+				var err error
+				if age, err = client.ParseAge(since); err != nil {
+					return fmt.Errorf("--since: %w", err)
+				}
+			}
+
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			var id *uint32
+			if len(args) == 1 {
+				resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
+				if err != nil {
+					return err
+				}
+				id = &resolved
+			}
+			return client.Stats(cmd.Context(), target, id, age, jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&all, "all", "a", false, "Show every session and the total")
+	cmd.Flags().StringVar(&since, "since", "", "With --all, only sessions created within this long (e.g. 24h, 7d)")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func timelineCmd() *cobra.Command {
+	var (
+		kinds      []string
+		jsonOutput bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "timeline <session>",
+		Short: "Show a session's events in order, as an audit trail",
+		Long: `Show what happened in a session, oldest first, merged from the node's logs
+of it: when it was created, changed status and exited; the messages it sent
+and received; the approvals it requested (from the gateway, for instance)
+and their outcome; output alerts and auto-responses; the tools its agent
+used; and budget and git events. Output itself is left out (see cw logs).
+
+Each event has a kind, which --kind filters on: lifecycle, message,
+approval, alert, agent, budget or git.`,
+		Example: `  cw timeline planner
+  cw timeline 3 --kind approval --kind alert
+  cw timeline 3 --json`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: sessionCompletionFunc,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			resolved, err := client.ResolveSessionArg(cmd.Context(), target, args[0])
+			if err != nil {
+				return err
+			}
+
+			return client.Timeline(cmd.Context(), target, resolved, kinds, jsonOutput)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&kinds, "kind", nil, "Only show events of this kind (repeatable)")
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
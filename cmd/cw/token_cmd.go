@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/auth"
+)
+
+func tokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage auth tokens for the node's WebSocket listener",
+		Long: `Manage the tokens clients use to reach this node over its WebSocket listener
+(node.listen) with --server and --token.
+
+The main token in the data directory's token file can do everything. Named
+tokens are limited to a scope:
+
+  read    list sessions and read status, output, events, messages and KV
+  launch  also launch, attach to, send input to, copy files to and from and
+          kill single sessions
+  admin   everything, including bulk kills, cron jobs and port forwards
+
+Tokens are checked on every connection, so changes apply without restarting
+the node. Only a hash of each named token is stored; the token itself is
+printed once, when created or rotated.`,
+	}
+
+	cmd.AddCommand(
+		tokenCreateCmd(),
+		tokenListCmd(),
+		tokenRevokeCmd(),
+		tokenRotateCmd(),
+	)
+
+	return cmd
+}
+
+func tokenCreateCmd() *cobra.Command {
+	var scope string
+
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a named token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := auth.ParseScope(scope)
+			if err != nil {
+				return err
+			}
+			token, err := auth.CreateToken(dataDir(), args[0], s)
+			if err != nil {
+				return err
+			}
+			fmt.Println(token)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&scope, "scope", "read", "What the token may do: read, launch or admin")
+	_ = cmd.RegisterFlagCompletionFunc("scope", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"read", "launch", "admin"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	return cmd
+}
+
+func tokenListCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List named tokens",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tokens, err := auth.ListTokens(dataDir())
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				type entry struct {
+					Name      string `json:"name"`
+					Scope     string `json:"scope"`
+					CreatedAt string `json:"created_at"`
+				}
+				entries := make([]entry, 0, len(tokens))
+				for _, t := range tokens {
+					entries = append(entries, entry{t.Name, string(t.Scope), t.CreatedAt.Format(time.RFC3339)})
+				}
+				data, _ := json.MarshalIndent(entries, "", "  ")
+				fmt.Println(string(data))
+				return nil
+			}
+			if len(tokens) == 0 {
+				fmt.Println("No named tokens")
+				return nil
+			}
+			fmt.Printf("%-32s %-8s %s\n", "NAME", "SCOPE", "CREATED")
+			for _, t := range tokens {
+				fmt.Printf("%-32s %-8s %s\n", t.Name, t.Scope, t.CreatedAt.Local().Format("2006-01-02 15:04"))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
+
+func tokenRevokeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke <name>",
+		Short: "Delete a named token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := auth.RevokeToken(dataDir(), args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Revoked token %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func tokenRotateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rotate [name]",
+		Short: "Replace a named token, or the main token",
+		Long: `Replace a named token, or the main token when no name is given, and print
+the new one. The old token stops working for new connections immediately.
+
+A node started with CODEWIRE_TOKEN set goes back to that token when it
+restarts.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) == 1 {
+				name = args[0]
+			}
+			token, err := auth.RotateToken(dataDir(), name)
+			if err != nil {
+				return err
+			}
+			fmt.Println(token)
+			return nil
+		},
+	}
+}
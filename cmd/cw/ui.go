@@ -6,6 +6,8 @@ import (
 	"text/tabwriter"
 
 	"github.com/mattn/go-isatty"
+
+	"github.com/codewiresh/codewire/internal/config"
 )
 
 var (
@@ -13,13 +15,31 @@ var (
 	stdoutColor bool
 )
 
-func init() {
-	stderrColor = isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd())
-	stdoutColor = isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
-	if os.Getenv("NO_COLOR") != "" {
-		stderrColor = false
-		stdoutColor = false
+// setupColor decides whether output is colored: mode ("auto", "always" or
+// "never") comes from --color, CODEWIRE_COLOR or client.color in
+// config.toml, in that order. Auto colors terminals unless NO_COLOR is set.
+func setupColor(mode string) error {
+	if mode == "" {
+		if cfg, err := config.LoadConfig(dataDir()); err == nil {
+			mode = cfg.Client.Color
+		}
+	}
+	switch mode {
+	case "always":
+		stderrColor, stdoutColor = true, true
+	case "never":
+		stderrColor, stdoutColor = false, false
+	case "", "auto":
+		stderrColor = isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd())
+		stdoutColor = isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
+		if os.Getenv("NO_COLOR") != "" {
+			stderrColor = false
+			stdoutColor = false
+		}
+	default:
+		return fmt.Errorf("--color must be auto, always or never, got %q", mode)
 	}
+	return nil
 }
 
 // ANSI helpers — all check stdoutColor before emitting codes.
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/update"
+)
+
+func upgradeCmd() *cobra.Command {
+	var (
+		channel string
+		check   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:     "upgrade",
+		Aliases: []string{"update"},
+		Short:   "Upgrade cw to the latest release",
+		Long: `Upgrade cw to the latest release of a channel: stable, the latest release,
+or nightly, the newest release including prereleases.
+
+The release's SHA256SUMS must be signed with the cw release key and the
+downloaded binary must match it; the running executable is then replaced
+atomically. cw installed with Homebrew, apt or the AUR is upgraded with the
+package manager instead.
+
+With --check nothing is installed: the command reports whether an upgrade is
+available and exits with status 2 if there is one (1 on errors).`,
+		Example: `  cw upgrade
+  cw upgrade --channel nightly
+  cw upgrade --check; [ $? -eq 2 ] && echo "cw is out of date"`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if version == "dev" {
+				return fmt.Errorf("cannot upgrade a dev build — install a release build first")
+			}
+
+			latest, err := update.FetchChannelVersion(channel)
+			if err != nil {
+				return fmt.Errorf("checking for updates: %w", err)
+			}
+			if !update.UpgradeAvailable(channel, version, latest) {
+				fmt.Printf("Already up to date (%s, %s channel at %s).\n", version, channel, latest)
+				return nil
+			}
+			if check {
+				fmt.Printf("Upgrade available: %s → %s\n", version, latest)
+				os.Exit(2)
+			}
+
+			if method := update.DetectInstallMethod(); method != update.DirectBinary {
+				return fmt.Errorf("cw was installed with %s; upgrade it with: %s", method, update.UpgradeCommand(method))
+			}
+
+			fmt.Printf("Upgrading %s → %s...\n", version, latest)
+			if err := update.InstallSigned(latest, "", ""); err != nil {
+				return err
+			}
+
+			fmt.Printf("Upgraded to %s (signature verified).\n", latest)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&channel, "channel", update.ChannelStable, "Release channel: stable or nightly")
+	_ = cmd.RegisterFlagCompletionFunc("channel", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{update.ChannelStable, update.ChannelNightly}, cobra.ShellCompDirectiveNoFileComp
+	})
+	cmd.Flags().BoolVar(&check, "check", false, "Only report whether an upgrade is available; exit 2 if so")
+
+	return cmd
+}
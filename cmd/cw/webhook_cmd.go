@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/config"
+)
+
+func webhookCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "webhook",
+		Short: "Manage webhooks that receive this node's session events",
+		Long: `Manage webhooks stored in this node's config.toml. The node POSTs a JSON
+payload to each webhook when a matching event fires, retrying failed
+deliveries with backoff. Payloads are signed with HMAC-SHA256 in the
+X-Codewire-Signature header ("sha256=<hex>"). Changes take effect without
+restarting the node.`,
+	}
+
+	cmd.AddCommand(
+		webhookAddCmd(),
+		webhookListCmd(),
+		webhookRemoveCmd(),
+	)
+
+	return cmd
+}
+
+func webhookAddCmd() *cobra.Command {
+	var (
+		events []string
+		tags   []string
+		secret string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add <url>",
+		Short: "Add a webhook",
+		Example: `  cw webhook add https://hooks.example.com/cw --event session.status --tag build
+  cw webhook add https://hooks.example.com/cw --event direct.message --event message.request`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			u, err := url.Parse(args[0])
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid webhook URL %q (must be http or https)", args[0])
+			}
+
+			generated := false
+			if secret == "" {
+				b := make([]byte, 32)
+				if _, err := rand.Read(b); err != nil {
+					return fmt.Errorf("generating secret: %w", err)
+				}
+				secret = hex.EncodeToString(b)
+				generated = true
+			}
+
+			hook := config.Webhook{URL: args[0], Events: events, Tags: tags, Secret: secret}
+			err = config.UpdateConfig(dataDir(), func(cfg *config.Config) error {
+				cfg.Webhooks = append(cfg.Webhooks, hook)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "Webhook added: %s (%s)\n", hook.URL, webhookFilter(hook))
+			if generated {
+				fmt.Fprintf(os.Stderr, "Signing secret: %s\n", secret)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&events, "event", nil, "Event type to send, e.g. session.status (repeatable; default all)")
+	cmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Only sessions with this tag (repeatable; default all)")
+	cmd.Flags().StringVar(&secret, "secret", "", "HMAC signing secret (default: generated)")
+	_ = cmd.RegisterFlagCompletionFunc("tag", tagCompletionFunc)
+
+	return cmd
+}
+
+func webhookListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List webhooks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadConfig(dataDir())
+			if err != nil {
+				return err
+			}
+
+			if len(cfg.Webhooks) == 0 {
+				fmt.Println("No webhooks")
+				return nil
+			}
+
+			fmt.Printf("%-4s %-40s %s\n", "#", "URL", "FILTER")
+			for i, hook := range cfg.Webhooks {
+				fmt.Printf("%-4d %-40s %s\n", i+1, hook.URL, webhookFilter(hook))
+			}
+			return nil
+		},
+	}
+}
+
+func webhookRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <number|url>",
+		Short: "Remove a webhook by its number in cw webhook list, or by URL",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var removed []string
+			err := config.UpdateConfig(dataDir(), func(cfg *config.Config) error {
+				if n, err := strconv.Atoi(args[0]); err == nil {
+					if n < 1 || n > len(cfg.Webhooks) {
+						return fmt.Errorf("no webhook #%d", n)
+					}
+					removed = append(removed, cfg.Webhooks[n-1].URL)
+					cfg.Webhooks = append(cfg.Webhooks[:n-1], cfg.Webhooks[n:]...)
+					return nil
+				}
+
+				var kept []config.Webhook
+				for _, hook := range cfg.Webhooks {
+					if hook.URL == args[0] {
+						removed = append(removed, hook.URL)
+						continue
+					}
+					kept = append(kept, hook)
+				}
+				if len(removed) == 0 {
+					return fmt.Errorf("no webhook with URL %q", args[0])
+				}
+				cfg.Webhooks = kept
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "Removed %d webhook(s)\n", len(removed))
+			return nil
+		},
+	}
+}
+
+// webhookFilter describes which events a webhook receives.
+func webhookFilter(hook config.Webhook) string {
+	events := "all events"
+	if len(hook.Events) > 0 {
+		events = strings.Join(hook.Events, ",")
+	}
+	if len(hook.Tags) > 0 {
+		return events + " tagged " + strings.Join(hook.Tags, ",")
+	}
+	return events
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+func worktreeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "worktree",
+		Short: "Merge or clean up session worktrees",
+		Long: `Manage the git worktrees created by 'cw run --worktree <name>'. Each worktree
+is a separate checkout on a branch called <name>, so agents working in
+parallel do not touch each other's files. Worktrees live in the node's data
+directory and are listed in its worktrees.json.
+
+When a session is done, merge its branch into the branch checked out in the
+main repository with 'cw worktree merge', then delete the worktree and
+branch with 'cw worktree clean'.`,
+	}
+
+	cmd.AddCommand(
+		worktreeListCmd(),
+		worktreeMergeCmd(),
+		worktreeCleanCmd(),
+	)
+
+	return cmd
+}
+
+func worktreeListCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List session worktrees",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.WorktreeList(cmd.Context(), target, jsonOutput)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&jsonOutput, "json", "j", false, "Output as JSON")
+
+	return cmd
+}
+
+func worktreeMergeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "merge <name>",
+		Short: "Merge a worktree's branch into the repository's checked out branch",
+		Long: `Merge a worktree's branch into the branch checked out in the main repository,
+with a merge commit. The worktree must have no uncommitted changes and no
+running sessions. A merge with conflicts is aborted and changes nothing.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.WorktreeMerge(cmd.Context(), target, args[0])
+		},
+	}
+}
+
+func worktreeCleanCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "clean <name>",
+		Short: "Remove a worktree and its branch",
+		Long: `Remove a worktree and delete its branch. Unless --force is given, the branch
+must be merged and the worktree must have no uncommitted changes.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget()
+			if err != nil {
+				return err
+			}
+
+			if target.IsLocal() {
+				if err := ensureNode(); err != nil {
+					return err
+				}
+			}
+
+			return client.WorktreeClean(cmd.Context(), target, args[0], force)
+		},
+	}
+
+	cmd.Flags().BoolVar(&force, "force", false, "Discard an unmerged branch and uncommitted changes")
+
+	return cmd
+}
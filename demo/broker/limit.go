@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fingerprintHeader carries a browser fingerprint computed by the frontend.
+// Without it, visitors are limited by IP alone.
+const fingerprintHeader = "X-Demo-Fingerprint"
+
+// Limiter caps how many demo sessions each IP and browser fingerprint can
+// take within a window, and blocks keys that keep asking past their limit.
+type Limiter struct {
+	max        int           // sessions per key per window; 0 disables
+	window     time.Duration // how long a session counts against its keys
+	blockAfter int           // rejections within a window before blocking; 0 disables
+	blockFor   time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	grants  map[string][]time.Time // key -> session start times within window
+	strikes map[string][]time.Time // key -> rejection times within window
+	blocked map[string]time.Time   // key -> blocked until
+}
+
+func NewLimiter(max int, window time.Duration, blockAfter int, blockFor time.Duration) *Limiter {
+	return &Limiter{
+		max:        max,
+		window:     window,
+		blockAfter: blockAfter,
+		blockFor:   blockFor,
+		now:        time.Now,
+		grants:     make(map[string][]time.Time),
+		strikes:    make(map[string][]time.Time),
+		blocked:    make(map[string]time.Time),
+	}
+}
+
+// Rejection reasons returned by Allow and in 429 responses.
+const (
+	reasonRateLimited = "rate_limited"
+	reasonBlocked     = "blocked"
+	reasonCapacity    = "at_capacity"
+)
+
+// Allow records a session for ip and fingerprint (which may be empty) and
+// returns "" when both are under their limits. Otherwise it records nothing
+// and returns the reason and how long to wait before trying again.
+func (l *Limiter) Allow(ip, fingerprint string) (reason string, retryAfter time.Duration) {
+	keys := []string{"ip:" + ip}
+	if fingerprint != "" {
+		keys = append(keys, "fp:"+fingerprint)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	for _, key := range keys {
+		if until, ok := l.blocked[key]; ok && now.Before(until) {
+			return reasonBlocked, until.Sub(now)
+		}
+	}
+	if l.max > 0 {
+		for _, key := range keys {
+			grants := l.recent(l.grants, key, now)
+			if len(grants) < l.max {
+				continue
+			}
+			retryAfter = grants[0].Add(l.window).Sub(now)
+			if l.strike(keys, now) {
+				return reasonBlocked, l.blockFor
+			}
+			return reasonRateLimited, retryAfter
+		}
+	}
+	for _, key := range keys {
+		l.grants[key] = append(l.grants[key], now)
+	}
+	return "", 0
+}
+
+// Refund removes the session Allow last recorded for ip and fingerprint,
+// for when no pod could be assigned after all.
+func (l *Limiter) Refund(ip, fingerprint string) {
+	keys := []string{"ip:" + ip}
+	if fingerprint != "" {
+		keys = append(keys, "fp:"+fingerprint)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if grants := l.grants[key]; len(grants) > 0 {
+			l.grants[key] = grants[:len(grants)-1]
+		}
+	}
+}
+
+// strike records a rejection against keys, and blocks them all once any has
+// been rejected blockAfter times within the window. It reports whether they
+// were blocked.
+func (l *Limiter) strike(keys []string, now time.Time) bool {
+	if l.blockAfter <= 0 {
+		return false
+	}
+	block := false
+	for _, key := range keys {
+		l.strikes[key] = append(l.recent(l.strikes, key, now), now)
+		if len(l.strikes[key]) >= l.blockAfter {
+			block = true
+		}
+	}
+	if !block {
+		return false
+	}
+	for _, key := range keys {
+		l.blocked[key] = now.Add(l.blockFor)
+		delete(l.strikes, key)
+	}
+	return true
+}
+
+// recent drops times older than the window from m[key] and returns the rest.
+func (l *Limiter) recent(m map[string][]time.Time, key string, now time.Time) []time.Time {
+	times := m[key]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) >= l.window {
+		i++
+	}
+	times = times[i:]
+	if len(times) == 0 {
+		delete(m, key)
+	} else {
+		m[key] = times
+	}
+	return times
+}
+
+// Prune forgets keys with nothing left in the window and expired blocks.
+func (l *Limiter) Prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for key := range l.grants {
+		l.recent(l.grants, key, now)
+	}
+	for key := range l.strikes {
+		l.recent(l.strikes, key, now)
+	}
+	for key, until := range l.blocked {
+		if !now.Before(until) {
+			delete(l.blocked, key)
+		}
+	}
+}
+
+// Blocked returns the number of IPs and fingerprints currently blocked.
+func (l *Limiter) Blocked() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	n := 0
+	for _, until := range l.blocked {
+		if now.Before(until) {
+			n++
+		}
+	}
+	return n
+}
+
+// brokerStats counts session requests by outcome since the broker started.
+type brokerStats struct {
+	assigned    atomic.Int64
+	rateLimited atomic.Int64
+	blocked     atomic.Int64
+	atCapacity  atomic.Int64
+	noWarmPods  atomic.Int64
+}
+
+// clientIP returns the visitor's address. Behind trustedProxies reverse
+// proxies it is the X-Forwarded-For entry the outermost proxy appended,
+// since entries before it come from the client and can be forged.
+func clientIP(r *http.Request, trustedProxies int) string {
+	if trustedProxies > 0 {
+		var hops []string
+		for _, h := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(h, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+		if i := len(hops) - trustedProxies; i >= 0 && i < len(hops) {
+			return hops[i]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestFingerprint returns the frontend's fingerprint for the visitor, if
+// it sent a plausible one.
+func requestFingerprint(r *http.Request) string {
+	fp := strings.TrimSpace(r.Header.Get(fingerprintHeader))
+	if len(fp) > 128 {
+		fp = fp[:128]
+	}
+	return fp
+}
+
+// writeTooManyRequests sends a 429 the frontend can act on: a machine-readable
+// reason, a message to show, and when to retry.
+func writeTooManyRequests(w http.ResponseWriter, reason, message string, retryAfter time.Duration) {
+	secs := int((retryAfter + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":       message,
+		"reason":      reason,
+		"retry_after": secs,
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(2, time.Hour, 3, 24*time.Hour)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if reason, _ := l.Allow("1.2.3.4", ""); reason != "" {
+			t.Fatalf("session %d rejected: %s", i+1, reason)
+		}
+	}
+	reason, retry := l.Allow("1.2.3.4", "")
+	if reason != reasonRateLimited || retry != time.Hour {
+		t.Fatalf("third session = %q, retry %v; want rate_limited after 1h", reason, retry)
+	}
+
+	// Another IP is unaffected, unless it shares a limited fingerprint.
+	if reason, _ := l.Allow("5.6.7.8", "fp-a"); reason != "" {
+		t.Fatalf("other IP rejected: %s", reason)
+	}
+	if reason, _ := l.Allow("9.9.9.9", "fp-a"); reason != "" {
+		t.Fatalf("second session for fingerprint rejected: %s", reason)
+	}
+	if reason, _ := l.Allow("10.0.0.1", "fp-a"); reason != reasonRateLimited {
+		t.Fatalf("third session for fingerprint = %q, want rate_limited", reason)
+	}
+
+	// A refunded session does not count.
+	if reason, _ := l.Allow("2.2.2.2", ""); reason != "" {
+		t.Fatal(reason)
+	}
+	l.Refund("2.2.2.2", "")
+	l.Allow("2.2.2.2", "")
+	if reason, _ := l.Allow("2.2.2.2", ""); reason != "" {
+		t.Fatalf("session after refund rejected: %s", reason)
+	}
+
+	// Sessions leave the window after an hour.
+	now = now.Add(time.Hour)
+	if reason, _ := l.Allow("1.2.3.4", ""); reason != "" {
+		t.Fatalf("session after window rejected: %s", reason)
+	}
+}
+
+func TestLimiterBlocks(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(1, time.Hour, 3, 24*time.Hour)
+	l.now = func() time.Time { return now }
+
+	l.Allow("1.2.3.4", "")
+	for i := 0; i < 2; i++ {
+		if reason, _ := l.Allow("1.2.3.4", ""); reason != reasonRateLimited {
+			t.Fatalf("attempt %d = %q, want rate_limited", i+1, reason)
+		}
+	}
+	if reason, retry := l.Allow("1.2.3.4", ""); reason != reasonBlocked || retry != 24*time.Hour {
+		t.Fatalf("third rejected attempt = %q, retry %v; want blocked for 24h", reason, retry)
+	}
+	if n := l.Blocked(); n != 1 {
+		t.Errorf("Blocked() = %d, want 1", n)
+	}
+
+	// Still blocked after the rate-limit window, until the block ends.
+	now = now.Add(2 * time.Hour)
+	if reason, _ := l.Allow("1.2.3.4", ""); reason != reasonBlocked {
+		t.Fatalf("after window = %q, want blocked", reason)
+	}
+	now = now.Add(24 * time.Hour)
+	l.Prune()
+	if n := l.Blocked(); n != 0 {
+		t.Errorf("Blocked() after block ended = %d, want 0", n)
+	}
+	if reason, _ := l.Allow("1.2.3.4", ""); reason != "" {
+		t.Fatalf("after block = %q, want allowed", reason)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/session", nil)
+	r.RemoteAddr = "10.0.0.5:41234"
+	r.Header.Add("X-Forwarded-For", "6.6.6.6, 203.0.113.7")
+
+	if got := clientIP(r, 1); got != "203.0.113.7" {
+		t.Errorf("behind one proxy = %q, want the address it appended", got)
+	}
+	if got := clientIP(r, 0); got != "10.0.0.5" {
+		t.Errorf("without proxies = %q, want RemoteAddr host", got)
+	}
+	if got := clientIP(r, 3); got != "10.0.0.5" {
+		t.Errorf("with fewer hops than proxies = %q, want RemoteAddr host", got)
+	}
+}
@@ -15,20 +15,51 @@ import (
 type Config struct {
 	Namespace     string
 	DemoImage     string
-	PoolSize      int // number of warm pods to keep ready
+	PoolMin       int // fewest warm pods to keep ready
+	PoolMax       int // most warm pods to keep ready, however busy
 	PodMaxAge     int // max pod lifetime in seconds
 	ListenAddr    string
 	AllowedOrigin string
+
+	// Abuse limits: sessions per IP (and per fingerprint) per hour, total
+	// sessions assigned at once, and how many rejected requests within the
+	// hour get an IP blocked for BlockSeconds.
+	MaxPodsPerIP   int
+	MaxConcurrent  int
+	BlockAfter     int
+	BlockSeconds   int
+	TrustedProxies int // reverse proxies in front of the broker that append X-Forwarded-For
+
+	// Session recordings for visitors who consent, kept in an S3 bucket.
+	// Recording is off unless RecordingBucket is set.
+	RecordingBucket        string
+	RecordingPrefix        string
+	RecordingEndpoint      string // S3-compatible endpoint; default AWS S3
+	RecordingRetentionDays int
+	RecordingMaxBytes      int
 }
 
 func configFromEnv() Config {
 	return Config{
 		Namespace:     envOr("DEMO_NAMESPACE", "codewire-demo"),
 		DemoImage:     envOr("DEMO_IMAGE", "ghcr.io/codewiresh/codewire-demo:latest"),
-		PoolSize:      envInt("DEMO_POOL_SIZE", 3),
+		PoolMin:       envInt("DEMO_POOL_MIN", envInt("DEMO_POOL_SIZE", 3)),
+		PoolMax:       envInt("DEMO_POOL_MAX", 10),
 		PodMaxAge:     envInt("DEMO_POD_MAX_AGE", 300),
 		ListenAddr:    envOr("DEMO_LISTEN", ":8080"),
 		AllowedOrigin: envOr("DEMO_ALLOWED_ORIGIN", "https://codewire.sh"),
+
+		MaxPodsPerIP:   envInt("DEMO_MAX_PODS_PER_IP", 5),
+		MaxConcurrent:  envInt("DEMO_MAX_CONCURRENT", 20),
+		BlockAfter:     envInt("DEMO_BLOCK_AFTER", 10),
+		BlockSeconds:   envInt("DEMO_BLOCK_SECONDS", 3600),
+		TrustedProxies: envInt("DEMO_TRUSTED_PROXIES", 1),
+
+		RecordingBucket:        os.Getenv("DEMO_RECORDING_BUCKET"),
+		RecordingPrefix:        envOr("DEMO_RECORDING_PREFIX", "recordings"),
+		RecordingEndpoint:      os.Getenv("DEMO_RECORDING_ENDPOINT"),
+		RecordingRetentionDays: envInt("DEMO_RECORDING_RETENTION_DAYS", 30),
+		RecordingMaxBytes:      envInt("DEMO_RECORDING_MAX_BYTES", 1<<20),
 	}
 }
 
@@ -51,6 +82,9 @@ func envInt(key string, def int) int {
 
 func main() {
 	cfg := configFromEnv()
+	if cfg.PoolMax < cfg.PoolMin {
+		cfg.PoolMax = cfg.PoolMin
+	}
 
 	pool, err := NewPool(cfg)
 	if err != nil {
@@ -62,6 +96,16 @@ func main() {
 
 	pool.Start(ctx)
 
+	if cfg.RecordingBucket != "" {
+		recordings, err := NewRecordings(cfg)
+		if err != nil {
+			log.Fatalf("failed to set up recordings: %v", err)
+		}
+		recordings.Start(ctx)
+		pool.recordings = recordings
+		log.Printf("recording consenting sessions to s3://%s/%s (retention %dd)", cfg.RecordingBucket, cfg.RecordingPrefix, cfg.RecordingRetentionDays)
+	}
+
 	mux := http.NewServeMux()
 
 	// Health endpoint
@@ -70,6 +114,9 @@ func main() {
 	// Session assignment — returns WebSocket URL for a warm pod
 	mux.HandleFunc("GET /api/session", corsMiddleware(cfg.AllowedOrigin, pool.HandleSession))
 
+	// Session and abuse counters
+	mux.HandleFunc("GET /api/stats", corsMiddleware(cfg.AllowedOrigin, pool.HandleStats))
+
 	// WebSocket proxy to demo pod: /ws/{pod-name}?token={token}
 	mux.HandleFunc("GET /ws/", corsMiddleware(cfg.AllowedOrigin, pool.HandleWS))
 
@@ -79,7 +126,7 @@ func main() {
 		if corsAllowed(cfg.AllowedOrigin, origin) {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, "+fingerprintHeader)
 			w.Header().Set("Access-Control-Max-Age", "3600")
 		}
 		w.WriteHeader(http.StatusNoContent)
@@ -103,7 +150,8 @@ func main() {
 		server.Shutdown(shutdownCtx)
 	}()
 
-	log.Printf("demo broker listening on %s (pool=%d, maxAge=%ds)", cfg.ListenAddr, cfg.PoolSize, cfg.PodMaxAge)
+	log.Printf("demo broker listening on %s (pool=%d-%d, maxAge=%ds, perIP=%d/h, concurrent=%d)",
+		cfg.ListenAddr, cfg.PoolMin, cfg.PoolMax, cfg.PodMaxAge, cfg.MaxPodsPerIP, cfg.MaxConcurrent)
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server error: %v", err)
 	}
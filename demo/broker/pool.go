@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -21,8 +22,13 @@ import (
 
 // Pool manages a set of warm demo pods for per-visitor assignment.
 type Pool struct {
-	cfg    Config
-	client kubernetes.Interface
+	cfg     Config
+	client  kubernetes.Interface
+	limiter *Limiter
+	stats   brokerStats
+	demand  *demand
+
+	recordings *Recordings // nil unless recording is configured
 
 	mu       sync.Mutex
 	warm     []podInfo // ready pods waiting for visitors
@@ -34,6 +40,7 @@ type podInfo struct {
 	IP        string
 	Token     string
 	CreatedAt time.Time
+	Record    bool // the visitor consented to recording
 }
 
 func NewPool(cfg Config) (*Pool, error) {
@@ -44,6 +51,8 @@ func NewPool(cfg Config) (*Pool, error) {
 	return &Pool{
 		cfg:      cfg,
 		client:   client,
+		limiter:  NewLimiter(cfg.MaxPodsPerIP, time.Hour, cfg.BlockAfter, time.Duration(cfg.BlockSeconds)*time.Second),
+		demand:   newDemand(time.Now()),
 		assigned: make(map[string]podInfo),
 	}, nil
 }
@@ -68,15 +77,16 @@ func (p *Pool) Start(ctx context.Context) {
 	go p.reapLoop(ctx)
 }
 
-// replenishLoop ensures the warm pool stays at the target size.
+// replenishLoop keeps the warm pool at the size demand calls for.
 func (p *Pool) replenishLoop(ctx context.Context) {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(replenishInterval)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			p.demand.tick(time.Now())
 			p.replenish(ctx)
 		}
 	}
@@ -92,13 +102,26 @@ func (p *Pool) reapLoop(ctx context.Context) {
 			return
 		case <-ticker.C:
 			p.reapExpired(ctx)
+			p.limiter.Prune()
 		}
 	}
 }
 
+// replenish creates warm pods up to the target size, or retires the oldest
+// one when demand has fallen, so the pool shrinks gradually.
 func (p *Pool) replenish(ctx context.Context) {
+	target := p.demand.target(p.cfg.PoolMin, p.cfg.PoolMax)
+
 	p.mu.Lock()
-	need := p.cfg.PoolSize - len(p.warm)
+	need := target - len(p.warm)
+	if need < 0 {
+		excess := p.warm[0]
+		p.warm = p.warm[1:]
+		p.mu.Unlock()
+		log.Printf("scaling down warm pool to %d", target)
+		p.deletePod(ctx, excess.Name)
+		return
+	}
 	p.mu.Unlock()
 
 	for i := 0; i < need; i++ {
@@ -200,6 +223,7 @@ func (p *Pool) createPod(ctx context.Context) (*podInfo, error) {
 		},
 	}
 
+	start := time.Now()
 	created, err := p.client.CoreV1().Pods(p.cfg.Namespace).Create(ctx, pod, metav1.CreateOptions{})
 	if err != nil {
 		return nil, err
@@ -228,6 +252,7 @@ func (p *Pool) createPod(ctx context.Context) (*podInfo, error) {
 		p.deletePod(ctx, name)
 		return nil, fmt.Errorf("pod %s did not get IP", name)
 	}
+	p.demand.observeStartup(time.Since(start))
 
 	p.mu.Lock()
 	p.warm = append(p.warm, info)
@@ -245,18 +270,28 @@ func (p *Pool) deletePod(ctx context.Context, name string) {
 	}
 }
 
-// Assign pops a warm pod and returns it with a token.
-func (p *Pool) Assign() (*podInfo, error) {
+var (
+	errAtCapacity = errors.New("concurrent session limit reached")
+	errNoWarmPods = errors.New("no warm pods available")
+)
+
+// Assign pops a warm pod and returns it with a token. Its session is
+// recorded if record is set and recording is configured.
+func (p *Pool) Assign(record bool) (*podInfo, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if p.cfg.MaxConcurrent > 0 && len(p.assigned) >= p.cfg.MaxConcurrent {
+		return nil, errAtCapacity
+	}
 	if len(p.warm) == 0 {
-		return nil, fmt.Errorf("no warm pods available")
+		return nil, errNoWarmPods
 	}
 
 	pod := p.warm[0]
 	p.warm = p.warm[1:]
 	pod.Token = randomID(16)
+	pod.Record = record && p.recordings != nil
 	p.assigned[pod.Token] = pod
 	return &pod, nil
 }
@@ -288,21 +323,82 @@ func (p *Pool) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{
 		"status":   status,
 		"warm":     warmCount,
+		"target":   p.demand.target(p.cfg.PoolMin, p.cfg.PoolMax),
 		"assigned": assignedCount,
 	})
 }
 
+// HandleStats returns session and abuse counters.
+func (p *Pool) HandleStats(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	warmCount := len(p.warm)
+	assignedCount := len(p.assigned)
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"warm":           warmCount,
+		"assigned":       assignedCount,
+		"max_concurrent": p.cfg.MaxConcurrent,
+		"blocked":        p.limiter.Blocked(),
+		"sessions_total": p.stats.assigned.Load(),
+		"pool": map[string]any{
+			"target":            p.demand.target(p.cfg.PoolMin, p.cfg.PoolMax),
+			"min":               p.cfg.PoolMin,
+			"max":               p.cfg.PoolMax,
+			"demand_per_minute": p.demand.perMinute(),
+			"hits":              p.stats.assigned.Load(),
+			"misses":            p.stats.noWarmPods.Load(),
+		},
+		"rejected": map[string]int64{
+			reasonRateLimited: p.stats.rateLimited.Load(),
+			reasonBlocked:     p.stats.blocked.Load(),
+			reasonCapacity:    p.stats.atCapacity.Load(),
+			"no_warm_pods":    p.stats.noWarmPods.Load(),
+		},
+	})
+}
+
 // HandleSession assigns a warm pod to a visitor and returns the WebSocket URL.
 func (p *Pool) HandleSession(w http.ResponseWriter, r *http.Request) {
-	pod, err := p.Assign()
+	ip := clientIP(r, p.cfg.TrustedProxies)
+	fp := requestFingerprint(r)
+
+	if reason, retryAfter := p.limiter.Allow(ip, fp); reason != "" {
+		message := "You've started several demos recently. Please try again later."
+		if reason == reasonBlocked {
+			p.stats.blocked.Add(1)
+			message = "Too many demo requests from your network. Please try again later."
+		} else {
+			p.stats.rateLimited.Add(1)
+		}
+		log.Printf("rejected session for %s (fingerprint %q): %s", ip, fp, reason)
+		writeTooManyRequests(w, reason, message, retryAfter)
+		return
+	}
+
+	// The frontend passes record=1 once the visitor agrees to recording.
+	pod, err := p.Assign(r.URL.Query().Get("record") == "1")
+	if !errors.Is(err, errAtCapacity) {
+		p.demand.record()
+	}
 	if err != nil {
+		p.limiter.Refund(ip, fp)
+		if errors.Is(err, errAtCapacity) {
+			p.stats.atCapacity.Add(1)
+			writeTooManyRequests(w, reasonCapacity, "Demo is at capacity. Please try again in a minute.", time.Minute)
+			return
+		}
+		p.stats.noWarmPods.Add(1)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]any{
-			"error": "Demo is at capacity. Please try again in a minute.",
+			"error":  "Demo is at capacity. Please try again in a minute.",
+			"reason": "no_warm_pods",
 		})
 		return
 	}
+	p.stats.assigned.Add(1)
 
 	// Build the WebSocket URL for the browser to connect to the broker's proxy
 	scheme := "wss"
@@ -314,12 +410,13 @@ func (p *Pool) HandleSession(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"ws":      wsURL,
-		"pod":     pod.Name,
-		"expires": p.cfg.PodMaxAge,
+		"ws":        wsURL,
+		"pod":       pod.Name,
+		"expires":   p.cfg.PodMaxAge,
+		"recording": pod.Record,
 	})
 
-	log.Printf("assigned pod %s (IP %s) to visitor from %s", pod.Name, pod.IP, r.RemoteAddr)
+	log.Printf("assigned pod %s (IP %s) to visitor from %s", pod.Name, pod.IP, ip)
 }
 
 func randomID(n int) string {
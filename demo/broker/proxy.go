@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -73,11 +74,20 @@ func (p *Pool) HandleWS(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("viewer connected to pod %s from %s", podName, r.RemoteAddr)
 
+	var rec *Recorder
+	if pod.Record {
+		rec = newRecorder(p.recordings.maxBytes)
+		defer func() {
+			go p.recordings.Save(context.Background(), rec)
+		}()
+	}
+
 	done := make(chan struct{}, 2)
 
 	// Backend (ttyd) -> client (browser): forward all output
 	go func() {
 		defer func() { done <- struct{}{} }()
+		var tee bytes.Buffer
 		for {
 			msgType, reader, err := backendConn.NextReader()
 			if err != nil {
@@ -87,12 +97,19 @@ func (p *Pool) HandleWS(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				return
 			}
+			if rec != nil {
+				tee.Reset()
+				reader = io.TeeReader(reader, &tee)
+			}
 			if _, err := io.Copy(writer, reader); err != nil {
 				return
 			}
 			if err := writer.Close(); err != nil {
 				return
 			}
+			if rec != nil {
+				rec.FromServer(tee.Bytes())
+			}
 		}
 	}()
 
@@ -100,10 +117,15 @@ func (p *Pool) HandleWS(w http.ResponseWriter, r *http.Request) {
 	go func() {
 		defer func() { done <- struct{}{} }()
 		for {
-			if _, _, err := clientConn.NextReader(); err != nil {
+			_, reader, err := clientConn.NextReader()
+			if err != nil {
 				return
 			}
 			// Input silently dropped — ttyd is in read-only mode (-R)
+			if rec != nil {
+				msg, _ := io.ReadAll(io.LimitReader(reader, 4096))
+				rec.FromClient(msg)
+			}
 		}
 	}()
 
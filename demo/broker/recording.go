@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recorder turns the ttyd traffic of one demo session into an asciicast v2
+// recording. It keeps no IP, token or pod name, and marks input without its
+// content, so recordings cannot be tied to a visitor.
+type Recorder struct {
+	start time.Time
+	max   int // recording size limit in bytes; later events are dropped
+
+	mu        sync.Mutex
+	width     int
+	height    int
+	events    bytes.Buffer
+	truncated bool
+}
+
+func newRecorder(max int) *Recorder {
+	return &Recorder{start: time.Now(), max: max, width: 80, height: 24}
+}
+
+// ttyd message types. Output and title updates come from the server; input
+// and resizes from the browser, whose first message is a JSON handshake.
+const (
+	ttydOutput = '0'
+	ttydInput  = '0'
+	ttydResize = '1'
+)
+
+// FromServer records a message ttyd sent to the browser.
+func (r *Recorder) FromServer(msg []byte) {
+	if len(msg) > 0 && msg[0] == ttydOutput {
+		r.event("o", string(msg[1:]))
+	}
+}
+
+// FromClient records a message the browser sent to ttyd.
+func (r *Recorder) FromClient(msg []byte) {
+	if len(msg) == 0 {
+		return
+	}
+	switch msg[0] {
+	case ttydInput:
+		r.event("m", "input")
+	case ttydResize, '{':
+		if msg[0] == ttydResize {
+			msg = msg[1:]
+		}
+		var size struct {
+			Columns int `json:"columns"`
+			Rows    int `json:"rows"`
+		}
+		if json.Unmarshal(msg, &size) != nil || size.Columns <= 0 || size.Rows <= 0 {
+			return
+		}
+		r.mu.Lock()
+		if r.events.Len() == 0 {
+			// Sizes before any output become the recording's size.
+			r.width, r.height = size.Columns, size.Rows
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+		r.event("r", fmt.Sprintf("%dx%d", size.Columns, size.Rows))
+	}
+}
+
+func (r *Recorder) event(code, data string) {
+	line, err := json.Marshal([]any{time.Since(r.start).Round(time.Millisecond).Seconds(), code, data})
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.truncated || r.events.Len()+len(line)+1 > r.max {
+		r.truncated = true
+		return
+	}
+	r.events.Write(line)
+	r.events.WriteByte('\n')
+}
+
+// Cast returns the recording in asciicast v2 format, or nil when nothing
+// was shown.
+func (r *Recorder) Cast() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.events.Len() == 0 {
+		return nil
+	}
+	header, _ := json.Marshal(map[string]any{
+		"version":   2,
+		"width":     r.width,
+		"height":    r.height,
+		"timestamp": r.start.Unix(),
+		"title":     "codewire demo",
+	})
+	var b bytes.Buffer
+	b.Write(header)
+	b.WriteByte('\n')
+	b.Write(r.events.Bytes())
+	return b.Bytes()
+}
+
+// Recordings stores demo recordings in a bucket under prefix, one folder per
+// day, and deletes folders older than the retention period.
+type Recordings struct {
+	s3        *s3Client
+	prefix    string
+	retention time.Duration
+	maxBytes  int
+}
+
+func NewRecordings(cfg Config) (*Recordings, error) {
+	s3, err := newS3Client(cfg.RecordingBucket, cfg.RecordingEndpoint, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Recordings{
+		s3:        s3,
+		prefix:    strings.Trim(cfg.RecordingPrefix, "/"),
+		retention: time.Duration(cfg.RecordingRetentionDays) * 24 * time.Hour,
+		maxBytes:  cfg.RecordingMaxBytes,
+	}, nil
+}
+
+// Save uploads rec under a random name.
+func (rs *Recordings) Save(ctx context.Context, rec *Recorder) {
+	cast := rec.Cast()
+	if cast == nil {
+		return
+	}
+	key := path.Join(rs.prefix, rec.start.UTC().Format("2006-01-02"), randomID(12)+".cast")
+	if err := rs.s3.put(ctx, key, cast); err != nil {
+		log.Printf("upload recording %s: %v", key, err)
+		return
+	}
+	log.Printf("saved recording %s (%d bytes)", key, len(cast))
+}
+
+// Start deletes expired recordings now and then daily.
+func (rs *Recordings) Start(ctx context.Context) {
+	if rs.retention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for {
+			rs.expire(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (rs *Recordings) expire(ctx context.Context, now time.Time) {
+	prefix := ""
+	if rs.prefix != "" {
+		prefix = rs.prefix + "/"
+	}
+	keys, err := rs.s3.list(ctx, prefix)
+	if err != nil {
+		log.Printf("list recordings: %v", err)
+		return
+	}
+	cutoff := now.Add(-rs.retention).UTC().Format("2006-01-02")
+	deleted := 0
+	for _, key := range keys {
+		day, _, ok := strings.Cut(strings.TrimPrefix(key, prefix), "/")
+		if !ok || len(day) != len(cutoff) || day >= cutoff {
+			continue
+		}
+		if err := rs.s3.delete(ctx, key); err != nil {
+			log.Printf("delete recording %s: %v", key, err)
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		log.Printf("deleted %d recordings older than %s", deleted, cutoff)
+	}
+}
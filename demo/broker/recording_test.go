@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecorderCast(t *testing.T) {
+	rec := newRecorder(1 << 20)
+	if rec.Cast() != nil {
+		t.Fatal("empty recording should have no cast")
+	}
+
+	rec.FromClient([]byte(`{"AuthToken":"","columns":120,"rows":40}`))
+	rec.FromServer([]byte("0$ cw list\r\n"))
+	rec.FromServer([]byte("1codewire demo")) // window title, not recorded
+	rec.FromClient([]byte("0my secret"))
+	rec.FromClient([]byte(`1{"columns":100,"rows":30}`))
+
+	lines := strings.Split(strings.TrimSpace(string(rec.Cast())), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("cast has %d lines, want header and 3 events:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	var header struct {
+		Version int `json:"version"`
+		Width   int `json:"width"`
+		Height  int `json:"height"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Version != 2 || header.Width != 120 || header.Height != 40 {
+		t.Errorf("header = %s", lines[0])
+	}
+	for i, want := range [][2]string{{"o", "$ cw list\r\n"}, {"m", "input"}, {"r", "100x30"}} {
+		var event []any
+		if err := json.Unmarshal([]byte(lines[i+1]), &event); err != nil || len(event) != 3 {
+			t.Fatalf("event %d = %s", i, lines[i+1])
+		}
+		if event[1] != want[0] || event[2] != want[1] {
+			t.Errorf("event %d = %v, want %q %q", i, event, want[0], want[1])
+		}
+	}
+	if strings.Contains(string(rec.Cast()), "secret") {
+		t.Error("recording contains typed input")
+	}
+
+	small := newRecorder(64)
+	for i := 0; i < 10; i++ {
+		small.FromServer([]byte("0hello world\r\n"))
+	}
+	if cast := small.Cast(); strings.Count(string(cast), "hello") != 2 {
+		t.Errorf("size limit kept wrong events:\n%s", cast)
+	}
+}
+
+// fakeS3 serves list and delete requests for one bucket from memory.
+type fakeS3 struct {
+	mu   sync.Mutex
+	objs map[string]bool
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/demo"), "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodDelete:
+		delete(s.objs, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		s.objs[key] = true
+	default:
+		var keys []string
+		for k := range s.objs {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		type object struct {
+			Key string `xml:"Key"`
+		}
+		var page struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []object `xml:"Contents"`
+		}
+		for _, k := range keys {
+			page.Contents = append(page.Contents, object{k})
+		}
+		xml.NewEncoder(w).Encode(page)
+	}
+}
+
+func TestRecordingsExpire(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+	s3 := &fakeS3{objs: map[string]bool{
+		"recordings/2026-09-01/a.cast": true,
+		"recordings/2026-09-15/b.cast": true,
+		"recordings/2026-09-16/c.cast": true,
+		"recordings/2026-10-14/d.cast": true,
+	}}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+
+	rs, err := NewRecordings(Config{
+		RecordingBucket:        "demo",
+		RecordingPrefix:        "/recordings/",
+		RecordingEndpoint:      srv.URL,
+		RecordingRetentionDays: 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := newRecorder(1 << 20)
+	rec.FromServer([]byte("0hi"))
+	rec.start = time.Date(2026, 10, 16, 2, 0, 0, 0, time.UTC)
+	rs.Save(context.Background(), rec)
+	rs.expire(context.Background(), time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC))
+
+	var left []string
+	for k := range s3.objs {
+		left = append(left, k)
+	}
+	sort.Strings(left)
+	if len(left) != 3 || left[0] != "recordings/2026-09-16/c.cast" || left[1] != "recordings/2026-10-14/d.cast" {
+		t.Errorf("recordings left = %v, want those from the last 30 days and the new one", left)
+	}
+}
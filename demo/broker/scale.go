@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// demandHalfLife is how quickly the demand average forgets old requests.
+	demandHalfLife = 5 * time.Minute
+	// replenishInterval is how often the pool is resized.
+	replenishInterval = 5 * time.Second
+	// defaultStartup is the assumed pod startup time until one is measured.
+	defaultStartup = 20 * time.Second
+)
+
+// demand keeps moving averages of how often visitors ask for a session and
+// how long a new pod takes to become ready, to size the warm pool.
+type demand struct {
+	mu      sync.Mutex
+	pending int       // requests since the last tick
+	rate    float64   // requests per second
+	last    time.Time // last tick
+	startup float64   // seconds from pod creation to ready
+}
+
+func newDemand(now time.Time) *demand {
+	return &demand{last: now, startup: defaultStartup.Seconds()}
+}
+
+// record counts a session request, whether or not a warm pod was free.
+func (d *demand) record() {
+	d.mu.Lock()
+	d.pending++
+	d.mu.Unlock()
+}
+
+// observeStartup folds a measured pod startup time into the average.
+func (d *demand) observeStartup(took time.Duration) {
+	d.mu.Lock()
+	d.startup = 0.7*d.startup + 0.3*took.Seconds()
+	d.mu.Unlock()
+}
+
+// tick folds the requests since the last tick into the rate average.
+func (d *demand) tick(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dt := now.Sub(d.last).Seconds()
+	if dt <= 0 {
+		return
+	}
+	alpha := 1 - math.Exp2(-dt/demandHalfLife.Seconds())
+	d.rate += alpha * (float64(d.pending)/dt - d.rate)
+	d.pending = 0
+	d.last = now
+}
+
+// target returns how many warm pods cover the requests expected while a
+// replacement pod starts, within [min, max].
+func (d *demand) target(min, max int) int {
+	d.mu.Lock()
+	lead := d.startup + replenishInterval.Seconds()
+	n := int(math.Ceil(d.rate * lead))
+	d.mu.Unlock()
+	if n < min {
+		n = min
+	}
+	if n > max {
+		n = max
+	}
+	return n
+}
+
+// perMinute returns the demand average in requests per minute.
+func (d *demand) perMinute() float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rate * 60
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDemandTarget(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	d := newDemand(now)
+
+	if got := d.target(2, 10); got != 2 {
+		t.Fatalf("idle target = %d, want the minimum", got)
+	}
+
+	// A sustained burst of two requests a second grows the pool to cover the
+	// requests arriving while a replacement starts, up to the maximum.
+	for i := 0; i < 120; i++ {
+		d.record()
+		d.record()
+		now = now.Add(time.Second)
+		d.tick(now)
+	}
+	if got := d.target(2, 10); got != 10 {
+		t.Fatalf("busy target = %d, want the maximum", got)
+	}
+	if got := d.target(2, 100); got <= 10 || got > 50 {
+		t.Fatalf("busy target without cap = %d, want about rate × (startup + interval)", got)
+	}
+
+	// Faster pods need a smaller pool.
+	big := d.target(2, 100)
+	for i := 0; i < 10; i++ {
+		d.observeStartup(2 * time.Second)
+	}
+	if got := d.target(2, 100); got >= big {
+		t.Fatalf("target after faster startups = %d, want below %d", got, big)
+	}
+
+	// With no requests for a while, the pool falls back to the minimum.
+	for i := 0; i < 60; i++ {
+		now = now.Add(time.Minute)
+		d.tick(now)
+	}
+	if got := d.target(2, 10); got != 2 {
+		t.Fatalf("target after demand ended = %d, want the minimum", got)
+	}
+}
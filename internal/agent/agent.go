@@ -0,0 +1,148 @@
+// Package agent describes the agent CLIs cw launches: how to let them act
+// without asking for permission, how to hand them a prompt, and what their
+// output looks like when they wait for input or finish.
+package agent
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+// Ways an adapter hands cw run --prompt-file's prompt to its agent.
+const (
+	// PromptStdin types the prompt into the session's terminal (default).
+	PromptStdin = "stdin"
+	// PromptArg appends PromptFlag, if set, and the prompt itself to the
+	// command.
+	PromptArg = "arg"
+	// PromptFile appends PromptFlag and the prompt file's absolute path to
+	// the command; the agent reads it, so it must run on this machine.
+	PromptFile = "file"
+)
+
+// Adapter describes the agent CLI run as Binary, a command name.
+type Adapter struct {
+	Binary string `toml:"binary"`
+	// AutoApprove are the arguments cw run --auto-approve inserts after
+	// the binary to skip permission prompts.
+	AutoApprove []string `toml:"auto_approve,omitempty"`
+	// Prompt is PromptStdin, PromptArg or PromptFile, with PromptFlag the
+	// flag given before the prompt or its file.
+	Prompt     string `toml:"prompt,omitempty"`
+	PromptFlag string `toml:"prompt_flag,omitempty"`
+	// Idle and Done are Go regular expressions matching an output line
+	// shown when the agent waits for input, and when it has finished its
+	// task. Idle makes the session awaiting-input; Done records a
+	// session.agent_stopped event.
+	Idle string `toml:"idle,omitempty"`
+	Done string `toml:"done,omitempty"`
+}
+
+// Builtin are the adapters for the agent CLIs cw knows. Claude Code reports
+// that it stopped through cw hook, so it has no output patterns.
+var Builtin = []Adapter{
+	{
+		Binary:      "claude",
+		AutoApprove: []string{"--dangerously-skip-permissions"},
+	},
+	{
+		Binary:      "aider",
+		AutoApprove: []string{"--yes-always"},
+		Prompt:      PromptArg,
+		PromptFlag:  "--message",
+		Idle:        `^(architect|ask|code|multi)?>\s*$`,
+		Done:        `^Tokens: .* sent, .* received`,
+	},
+	{
+		Binary:      "codex",
+		AutoApprove: []string{"--dangerously-bypass-approvals-and-sandbox"},
+		Prompt:      PromptArg,
+		Idle:        `^▌\s*(Ask Codex to do anything|Implement \{feature\})`,
+		Done:        `^Token usage: `,
+	},
+	{
+		Binary:      "openhands",
+		AutoApprove: []string{"--always-approve"},
+		Prompt:      PromptFile,
+		PromptFlag:  "--file",
+		Idle:        `AWAITING_USER_INPUT|Agent is waiting for your input`,
+		Done:        `AgentState\.FINISHED|Agent finished the task`,
+	},
+}
+
+// Lookup returns the adapter for command: the one in custom, else the
+// built-in one, for its binary's name, or nil if there is none.
+func Lookup(command []string, custom []Adapter) *Adapter {
+	if len(command) == 0 {
+		return nil
+	}
+	binary := filepath.Base(command[0])
+	for _, list := range [][]Adapter{custom, Builtin} {
+		for i := range list {
+			if list[i].Binary == binary {
+				return &list[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Known lists the binaries of custom and the built-in adapters.
+func Known(custom []Adapter) []string {
+	var names []string
+	for _, a := range slices.Concat(custom, Builtin) {
+		if !slices.Contains(names, a.Binary) {
+			names = append(names, a.Binary)
+		}
+	}
+	return names
+}
+
+// Validate checks a's fields.
+func (a Adapter) Validate() error {
+	if a.Binary == "" {
+		return fmt.Errorf("binary is required")
+	}
+	switch a.Prompt {
+	case "", PromptStdin, PromptArg:
+	case PromptFile:
+		if a.PromptFlag == "" {
+			return fmt.Errorf("prompt %q requires prompt_flag", a.Prompt)
+		}
+	default:
+		return fmt.Errorf("prompt must be %s, %s or %s, got %q", PromptStdin, PromptArg, PromptFile, a.Prompt)
+	}
+	for _, p := range []string{a.Idle, a.Done} {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// WithAutoApprove returns command with a's AutoApprove arguments inserted
+// after the binary.
+func (a Adapter) WithAutoApprove(command []string) []string {
+	return slices.Concat(command[:1], a.AutoApprove, command[1:])
+}
+
+// WithPrompt returns command given the prompt in path, which holds data,
+// and whether the prompt must still be sent as stdin data.
+func (a Adapter) WithPrompt(command []string, path string, data []byte) ([]string, bool, error) {
+	switch a.Prompt {
+	case PromptArg:
+		if a.PromptFlag != "" {
+			command = append(slices.Clone(command), a.PromptFlag)
+		}
+		return append(slices.Clone(command), string(data)), false, nil
+	case PromptFile:
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return slices.Concat(command, []string{a.PromptFlag, abs}), false, nil
+	}
+	return command, true, nil
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	if a := Lookup([]string{"/usr/bin/aider", "--model", "sonnet"}, nil); a == nil || a.Binary != "aider" {
+		t.Fatalf("Lookup(aider) = %+v", a)
+	}
+	if a := Lookup([]string{"bash"}, nil); a != nil {
+		t.Errorf("Lookup(bash) = %+v", a)
+	}
+	custom := []Adapter{{Binary: "claude", AutoApprove: []string{"--permission-mode", "bypassPermissions"}}}
+	a := Lookup([]string{"claude", "-p", "hi"}, custom)
+	if got := a.WithAutoApprove([]string{"claude", "-p", "hi"}); !slices.Equal(got, []string{"claude", "--permission-mode", "bypassPermissions", "-p", "hi"}) {
+		t.Errorf("custom claude auto-approve = %q", got)
+	}
+	if known := Known(custom); !slices.Equal(known, []string{"claude", "aider", "codex", "openhands"}) {
+		t.Errorf("Known = %q", known)
+	}
+}
+
+func TestWithPrompt(t *testing.T) {
+	prompt := []byte("fix the tests")
+	for _, tc := range []struct {
+		binary  string
+		want    []string
+		asStdin bool
+	}{
+		{"claude", []string{"claude"}, true},
+		{"aider", []string{"aider", "--message", "fix the tests"}, false},
+		{"codex", []string{"codex", "fix the tests"}, false},
+		{"openhands", []string{"openhands", "--file", "/work/task.md"}, false},
+	} {
+		a := Lookup([]string{tc.binary}, nil)
+		got, asStdin, err := a.WithPrompt([]string{tc.binary}, filepath.FromSlash("/work/task.md"), prompt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tc.want) || asStdin != tc.asStdin {
+			t.Errorf("%s: WithPrompt = %q, %v, want %q, %v", tc.binary, got, asStdin, tc.want, tc.asStdin)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, a := range Builtin {
+		if err := a.Validate(); err != nil {
+			t.Errorf("%s: %v", a.Binary, err)
+		}
+	}
+	for _, a := range []Adapter{
+		{},
+		{Binary: "x", Prompt: "pipe"},
+		{Binary: "x", Prompt: PromptFile},
+		{Binary: "x", Idle: "("},
+	} {
+		if a.Validate() == nil {
+			t.Errorf("%+v is valid", a)
+		}
+	}
+}
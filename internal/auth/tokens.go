@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope limits what a token may do on the node.
+type Scope string
+
+const (
+	// ScopeRead can list sessions and read their status, output, events,
+	// messages and KV entries.
+	ScopeRead Scope = "read"
+	// ScopeLaunch can also launch, attach to, send input to and kill
+	// individual sessions, and send messages.
+	ScopeLaunch Scope = "launch"
+	// ScopeAdmin can do everything, including killing sessions in bulk and
+	// managing cron jobs. The node's main token has this scope.
+	ScopeAdmin Scope = "admin"
+)
+
+var scopeRank = map[Scope]int{ScopeRead: 1, ScopeLaunch: 2, ScopeAdmin: 3}
+
+// ParseScope validates a scope name.
+func ParseScope(s string) (Scope, error) {
+	scope := Scope(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := scopeRank[scope]; !ok {
+		return "", fmt.Errorf("invalid scope %q (want read, launch or admin)", s)
+	}
+	return scope, nil
+}
+
+// Allows reports whether a token with scope s may do what need requires.
+func (s Scope) Allows(need Scope) bool {
+	return scopeRank[s] >= scopeRank[need]
+}
+
+// TokenInfo describes a named token in tokens.json. Only a hash of the token
+// itself is stored; it is shown once, when created or rotated.
+type TokenInfo struct {
+	Name      string    `json:"name"`
+	Scope     Scope     `json:"scope"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var validTokenName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// tokensMu serialises changes to tokens.json within this process.
+var tokensMu sync.Mutex
+
+// CreateToken adds a named token with the given scope and returns it.
+func CreateToken(dataDir, name string, scope Scope) (string, error) {
+	if !validTokenName.MatchString(name) {
+		return "", fmt.Errorf("token name must be 1-32 alphanumeric characters, hyphens or underscores, got %q", name)
+	}
+	if _, ok := scopeRank[scope]; !ok {
+		return "", fmt.Errorf("invalid scope %q", scope)
+	}
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+
+	tokens, err := loadTokens(dataDir)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range tokens {
+		if t.Name == name {
+			return "", fmt.Errorf("token %q already exists", name)
+		}
+	}
+	token, err := randomAlphanumeric(tokenLength)
+	if err != nil {
+		return "", fmt.Errorf("generating random token: %w", err)
+	}
+	tokens = append(tokens, TokenInfo{Name: name, Scope: scope, Hash: hashToken(token), CreatedAt: time.Now().UTC()})
+	if err := saveTokens(dataDir, tokens); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ListTokens returns the named tokens, oldest first.
+func ListTokens(dataDir string) ([]TokenInfo, error) {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	return loadTokens(dataDir)
+}
+
+// RevokeToken deletes a named token. Connections already open with it are
+// not closed.
+func RevokeToken(dataDir, name string) error {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+
+	tokens, err := loadTokens(dataDir)
+	if err != nil {
+		return err
+	}
+	for i, t := range tokens {
+		if t.Name == name {
+			return saveTokens(dataDir, append(tokens[:i], tokens[i+1:]...))
+		}
+	}
+	return fmt.Errorf("no token named %q", name)
+}
+
+// RotateToken replaces a named token, or the main token when name is empty,
+// and returns the new one. The old token stops working immediately.
+func RotateToken(dataDir, name string) (string, error) {
+	if name == "" {
+		return GenerateToken(dataDir)
+	}
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+
+	tokens, err := loadTokens(dataDir)
+	if err != nil {
+		return "", err
+	}
+	for i, t := range tokens {
+		if t.Name != name {
+			continue
+		}
+		token, err := randomAlphanumeric(tokenLength)
+		if err != nil {
+			return "", fmt.Errorf("generating random token: %w", err)
+		}
+		tokens[i].Hash = hashToken(token)
+		tokens[i].CreatedAt = time.Now().UTC()
+		if err := saveTokens(dataDir, tokens); err != nil {
+			return "", err
+		}
+		return token, nil
+	}
+	return "", fmt.Errorf("no token named %q", name)
+}
+
+// Authenticate checks candidate against the main token and the named tokens
+// and returns its scope. Tokens are read from disk on every call, so created,
+// rotated and revoked tokens take effect without restarting the node.
+func Authenticate(dataDir, candidate string) (Scope, bool) {
+	candidate = strings.TrimSpace(candidate)
+	if candidate == "" {
+		return "", false
+	}
+	if ValidateToken(dataDir, candidate) {
+		return ScopeAdmin, true
+	}
+	tokens, err := ListTokens(dataDir)
+	if err != nil {
+		return "", false
+	}
+	hash := hashToken(candidate)
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+			return t.Scope, true
+		}
+	}
+	return "", false
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokensPath(dataDir string) string {
+	return filepath.Join(dataDir, "tokens.json")
+}
+
+func loadTokens(dataDir string) ([]TokenInfo, error) {
+	data, err := os.ReadFile(tokensPath(dataDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading tokens: %w", err)
+	}
+	var tokens []TokenInfo
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", tokensPath(dataDir), err)
+	}
+	return tokens, nil
+}
+
+func saveTokens(dataDir string, tokens []TokenInfo) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := tokensPath(dataDir)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing tokens: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing tokens: %w", err)
+	}
+	return nil
+}
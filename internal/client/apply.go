@@ -0,0 +1,314 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// ManifestLabel is the label cw apply gives the sessions it launches, set to
+// the manifest's name, so that --prune only kills sessions of that manifest.
+const ManifestLabel = "codewire/manifest"
+
+// Manifest is a cw apply file: the named sessions that should be running.
+type Manifest struct {
+	// Name identifies the manifest's sessions for --prune. It defaults to
+	// the file's base name without its extension.
+	Name     string            `yaml:"name"`
+	Sessions []ManifestSession `yaml:"sessions"`
+}
+
+// ManifestSession describes a session as cw run would launch it. Dir is
+// relative to the manifest's directory, which is also the default.
+type ManifestSession struct {
+	Name     string            `yaml:"name"`
+	Command  []string          `yaml:"command"`
+	Dir      string            `yaml:"dir"`
+	Env      map[string]string `yaml:"env"`
+	Tags     []string          `yaml:"tags"`
+	Labels   map[string]string `yaml:"labels"`
+	Worktree string            `yaml:"worktree"`
+	Stdin    string            `yaml:"stdin"`
+}
+
+// LoadManifest reads and checks a cw apply file. Unknown fields are errors,
+// so that a misspelt one is not silently ignored.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	if m.Name == "" {
+		m.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := protocol.ValidateLabel(ManifestLabel, m.Name); err != nil {
+		return nil, fmt.Errorf("%s: manifest name %q cannot be a label value; set name", path, m.Name)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Dir(abs)
+
+	seen := make(map[string]bool)
+	for i := range m.Sessions {
+		s := &m.Sessions[i]
+		switch {
+		case s.Name == "":
+			return nil, fmt.Errorf("%s: session %d has no name", path, i+1)
+		case seen[s.Name]:
+			return nil, fmt.Errorf("%s: session %s is listed twice", path, s.Name)
+		case len(s.Command) == 0:
+			return nil, fmt.Errorf("%s: session %s has no command", path, s.Name)
+		}
+		seen[s.Name] = true
+		for k, v := range s.Labels {
+			if k == ManifestLabel {
+				return nil, fmt.Errorf("%s: session %s: label %s is set by cw apply", path, s.Name, k)
+			}
+			if err := protocol.ValidateLabel(k, v); err != nil {
+				return nil, fmt.Errorf("%s: session %s: %w", path, s.Name, err)
+			}
+		}
+		if !filepath.IsAbs(s.Dir) {
+			s.Dir = filepath.Join(base, s.Dir)
+		}
+	}
+	return &m, nil
+}
+
+// ApplyOptions configures Apply.
+type ApplyOptions struct {
+	// Prune kills running sessions launched from the manifest that it no
+	// longer lists.
+	Prune bool
+	// DryRun prints the changes without making them.
+	DryRun bool
+	JSON   bool
+}
+
+// Apply reconciles the node's sessions with m: a listed session that is not
+// running or queued is launched, one whose tags differ is retagged, and,
+// with Prune, an unlisted one from the same manifest is killed. Sessions
+// are matched by name. A running session whose command has changed is left
+// alone, since relaunching would lose its state; kill it to have the next
+// apply relaunch it.
+func Apply(ctx context.Context, target *Target, m *Manifest, opts ApplyOptions) error {
+	sessions, err := listSessionsForResolve(ctx, target)
+	if err != nil {
+		return err
+	}
+	live := make(map[string]protocol.SessionInfo)
+	for _, s := range sessions {
+		if s.Name != "" && (s.Status == "running" || s.Status == "queued") {
+			live[s.Name] = s
+		}
+	}
+
+	var actions []ApplyAction
+	listed := make(map[string]bool)
+	for _, ms := range m.Sessions {
+		listed[ms.Name] = true
+		command := strings.Join(ms.Command, " ")
+		s, ok := live[ms.Name]
+		if !ok {
+			actions = append(actions, ApplyAction{Action: "launch", Name: ms.Name, Command: command, Tags: ms.Tags})
+			continue
+		}
+		a := ApplyAction{Action: "unchanged", Name: ms.Name, ID: s.ID, Command: s.Prompt, Tags: s.Tags}
+		if !sameTags(s.Tags, ms.Tags) {
+			a.Action, a.Tags, a.OldTags = "retag", ms.Tags, s.Tags
+		}
+		if s.Prompt != command {
+			a.Note = "runs a different command; kill it to relaunch"
+		}
+		actions = append(actions, a)
+	}
+	if opts.Prune {
+		for _, s := range sessions {
+			if s.Labels[ManifestLabel] == m.Name && !listed[s.Name] && (s.Status == "running" || s.Status == "queued") {
+				actions = append(actions, ApplyAction{Action: "kill", Name: s.Name, ID: s.ID, Command: s.Prompt, Tags: s.Tags})
+			}
+		}
+	}
+
+	if !opts.JSON {
+		printApplyPlan(actions)
+	}
+	failed := 0
+	if !opts.DryRun {
+		byName := make(map[string]ManifestSession, len(m.Sessions))
+		for _, ms := range m.Sessions {
+			byName[ms.Name] = ms
+		}
+		for i := range actions {
+			a := &actions[i]
+			var err error
+			switch a.Action {
+			case "launch":
+				a.ID, err = applyLaunch(ctx, target, m.Name, byName[a.Name])
+			case "retag":
+				err = applySetTags(ctx, target, a.ID, a.Tags)
+			case "kill":
+				err = applyKill(ctx, target, a.ID)
+			default:
+				continue
+			}
+			if err != nil {
+				a.Error = err.Error()
+				failed++
+				if !opts.JSON {
+					fmt.Fprintf(os.Stderr, "Error: %s %s: %v\n", a.Action, a.Name, err)
+				}
+			}
+		}
+	}
+
+	if opts.JSON {
+		if actions == nil {
+			actions = []ApplyAction{}
+		}
+		if err := printJSON(actions); err != nil {
+			return err
+		}
+	} else {
+		printApplySummary(actions, opts.DryRun)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d changes failed", failed, countChanges(actions))
+	}
+	return nil
+}
+
+func applyLaunch(ctx context.Context, target *Target, manifest string, ms ManifestSession) (uint32, error) {
+	env := make([]string, 0, len(ms.Env))
+	for k, v := range ms.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	labels := map[string]string{ManifestLabel: manifest}
+	for k, v := range ms.Labels {
+		labels[k] = v
+	}
+	req := &protocol.Request{
+		Type:       "Launch",
+		Name:       ms.Name,
+		Command:    ms.Command,
+		WorkingDir: ms.Dir,
+		Env:        env,
+		Tags:       ms.Tags,
+		Labels:     labels,
+		Worktree:   ms.Worktree,
+	}
+	if ms.Stdin != "" {
+		req.StdinData = []byte(ms.Stdin)
+	}
+	resp, err := requestResponse(ctx, target, req)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Type == "Error" {
+		return 0, fmt.Errorf("%s", resp.Message)
+	}
+	if resp.Type != "Launched" || resp.ID == nil {
+		return 0, fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+	return *resp.ID, nil
+}
+
+func applySetTags(ctx context.Context, target *Target, id uint32, tags []string) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "SetTags", ID: &id, Tags: tags})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	return nil
+}
+
+func applyKill(ctx context.Context, target *Target, id uint32) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "Kill", ID: &id})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	return nil
+}
+
+// sameTags reports whether a and b hold the same tags, in any order.
+func sameTags(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// printApplyPlan prints actions as a diff: + launch, ~ retag, - kill, and
+// = unchanged.
+func printApplyPlan(actions []ApplyAction) {
+	for _, a := range actions {
+		switch a.Action {
+		case "launch":
+			fmt.Printf("+ %-20s %s\n", a.Name, a.Command)
+		case "retag":
+			fmt.Printf("~ %-20s tags: %s → %s\n", a.Name, formatTagList(a.OldTags), formatTagList(a.Tags))
+		case "kill":
+			fmt.Printf("- %-20s session %d: %s\n", a.Name, a.ID, a.Command)
+		default:
+			fmt.Printf("= %-20s session %d\n", a.Name, a.ID)
+		}
+		if a.Note != "" {
+			fmt.Printf("  %-20s (%s)\n", "", a.Note)
+		}
+	}
+}
+
+func printApplySummary(actions []ApplyAction, dryRun bool) {
+	counts := make(map[string]int)
+	for _, a := range actions {
+		if a.Error == "" {
+			counts[a.Action]++
+		}
+	}
+	summary := fmt.Sprintf("%d to launch, %d to retag, %d to kill, %d unchanged", counts["launch"], counts["retag"], counts["kill"], counts["unchanged"])
+	if !dryRun {
+		summary = fmt.Sprintf("%d launched, %d retagged, %d killed, %d unchanged", counts["launch"], counts["retag"], counts["kill"], counts["unchanged"])
+	}
+	fmt.Fprintln(os.Stderr, summary)
+}
+
+func countChanges(actions []ApplyAction) int {
+	n := 0
+	for _, a := range actions {
+		if a.Action != "unchanged" {
+			n++
+		}
+	}
+	return n
+}
+
+func formatTagList(tags []string) string {
+	if len(tags) == 0 {
+		return "(none)"
+	}
+	return strings.Join(tags, ",")
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Archive archives session id, or with id nil every finished session that
+// completed more than before ago, and prints the archives written.
+func Archive(ctx context.Context, target *Target, id *uint32, before time.Duration, jsonOutput bool) error {
+	req := &protocol.Request{Type: "ArchiveSessions", ID: id}
+	if id == nil {
+		req.Before = time.Now().Add(-before).UTC().Format(time.RFC3339Nano)
+	}
+	archives, err := archiveRequest(ctx, target, req)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(archives)
+	}
+	if len(archives) == 0 {
+		fmt.Println("No sessions to archive")
+		return nil
+	}
+	for _, a := range archives {
+		where := a.File
+		if a.URL != "" {
+			where += ", uploaded to " + a.URL
+		}
+		fmt.Printf("Archived session %d%s (%s) to %s\n", a.ID, archiveName(a), formatByteSize(a.Size), where)
+	}
+	return nil
+}
+
+// ArchiveList prints the node's session archives.
+func ArchiveList(ctx context.Context, target *Target, jsonOutput bool) error {
+	archives, err := archiveRequest(ctx, target, &protocol.Request{Type: "ArchiveList"})
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(archives)
+	}
+	if len(archives) == 0 {
+		fmt.Println("No archives")
+		return nil
+	}
+	fmt.Printf("%-5s %-14s %-14s %-20s %-9s %-32s %s\n", "ID", "NAME", "STATUS", "COMPLETED", "SIZE", "FILE", "COMMAND")
+	for _, a := range archives {
+		name := a.Name
+		if name == "" {
+			name = "-"
+		} else if len(name) > 14 {
+			name = name[:11] + "..."
+		}
+		completed := "-"
+		if t, err := time.Parse(time.RFC3339, a.CompletedAt); err == nil {
+			completed = t.Local().Format("2006-01-02 15:04:05")
+		}
+		prompt := a.Prompt
+		if len(prompt) > 40 {
+			prompt = prompt[:37] + "..."
+		}
+		fmt.Printf("%-5d %-14s %-14s %-20s %-9s %-32s %s\n", a.ID, name, a.Status, completed, formatByteSize(a.Size), a.File, prompt)
+	}
+	return nil
+}
+
+// RestoreArchive restores archive, an archive's file name or the ID of the
+// session it holds, and prints the restored session's ID.
+func RestoreArchive(ctx context.Context, target *Target, archive string, jsonOutput bool) error {
+	archives, err := archiveRequest(ctx, target, &protocol.Request{Type: "RestoreArchive", Archive: archive})
+	if err != nil {
+		return err
+	}
+	if len(archives) != 1 {
+		return fmt.Errorf("unexpected response: %d archives", len(archives))
+	}
+	a := archives[0]
+	if jsonOutput {
+		return printJSON(a)
+	}
+	fmt.Printf("Restored session %d%s from %s\n", a.ID, archiveName(a), a.File)
+	return nil
+}
+
+// archiveRequest sends req and returns the archives in the response.
+func archiveRequest(ctx context.Context, target *Target, req *protocol.Request) ([]protocol.ArchivedSession, error) {
+	resp, err := requestResponse(ctx, target, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Type == "Error" {
+		return nil, fmt.Errorf("%s", formatError(resp.Message))
+	}
+	if resp.Archives == nil {
+		return nil, fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+	return *resp.Archives, nil
+}
+
+// archiveName returns " (name)" for an archived session with a name.
+func archiveName(a protocol.ArchivedSession) string {
+	if a.Name == "" {
+		return ""
+	}
+	return " (" + a.Name + ")"
+}
@@ -5,41 +5,139 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 
 	"nhooyr.io/websocket"
 
+	"github.com/codewiresh/codewire/internal/config"
 	"github.com/codewiresh/codewire/internal/connection"
 	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/relay"
 )
 
-// Target describes where to connect: either a local Unix socket or a remote
-// WebSocket endpoint.
+// Target describes where to connect: either a local Unix socket, a remote
+// WebSocket endpoint or a host reached over SSH.
 type Target struct {
 	Local string // dataDir path (empty if remote)
 	URL   string // ws:// or wss:// URL for remote
-	Token string // auth token for remote
+	SSH   string // ssh://[user@]host[:port] of a node reached over SSH
+	Token string // auth token for remote, or for another user's local node
+
+	// Version is the version of this cw, which an SSH target installs on
+	// hosts of another platform that have no cw.
+	Version string
+
+	// NodeGroup, with a relay URL, has the relay connect to a node of the
+	// group, chosen by Placement or else the relay's default strategy.
+	// Connect sets Node to the node chosen. Node alone, with a relay URL,
+	// has the relay connect to that node (one that joined a group).
+	NodeGroup string
+	Placement string
+	Node      string
 }
 
 // IsLocal returns true when the target is a local Unix socket connection.
 func (t *Target) IsLocal() bool { return t.Local != "" }
 
+// ResolveTarget maps a server name or URL to a Target. An empty server is
+// client.server from config.toml (or CODEWIRE_SERVER), and "local", or no
+// server at all, is the local node in dataDir; otherwise server is looked up
+// in servers.toml and falls back to being treated as a URL. An ssh:// URL
+// runs the node on that host over SSH (see connectSSH). A non-empty token
+// overrides the token saved for the server. For the local node, token (or
+// CODEWIRE_TOKEN) is sent with each request, for nodes run by another user
+// with socket_token_auth.
+func ResolveTarget(dataDir, server, token string) (*Target, error) {
+	if server == "" {
+		cfg, err := config.LoadConfig(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		server = cfg.Client.Server
+	}
+	if server == "" || server == "local" {
+		if token == "" {
+			token = strings.TrimSpace(os.Getenv("CODEWIRE_TOKEN"))
+		}
+		return &Target{Local: dataDir, Token: token}, nil
+	}
+
+	// Check servers.toml for a named entry.
+	servers, err := config.LoadServersConfig(dataDir)
+	if err == nil {
+		if entry, ok := servers.Servers[server]; ok {
+			if strings.HasPrefix(entry.URL, "ssh://") {
+				return &Target{SSH: entry.URL}, nil
+			}
+			if token == "" {
+				token = entry.Token
+			}
+			return &Target{URL: entry.URL, Token: token}, nil
+		}
+	}
+
+	// Treat server as a direct URL.
+	url := server
+	if strings.HasPrefix(url, "ssh://") {
+		if _, err := sshArgs(url, ""); err != nil {
+			return nil, err
+		}
+		return &Target{SSH: url}, nil
+	}
+	if strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") {
+		// Relay URL — token is optional (relay handles auth).
+		return &Target{URL: url, Token: token}, nil
+	}
+
+	if token == "" {
+		return nil, fmt.Errorf("--token required for ad-hoc WebSocket server")
+	}
+
+	if !strings.HasPrefix(url, "ws://") && !strings.HasPrefix(url, "wss://") {
+		url = "ws://" + url
+	}
+
+	return &Target{URL: url, Token: token}, nil
+}
+
 // Connect establishes a connection to the target and returns a FrameReader
-// and FrameWriter pair. The caller is responsible for closing both.
-func (t *Target) Connect() (connection.FrameReader, connection.FrameWriter, error) {
+// and FrameWriter pair. The caller is responsible for closing both. When ctx
+// is done the connection is closed, which also ends whatever the node was
+// doing for it, such as a watch, and reads return ctx.Err().
+func (t *Target) Connect(ctx context.Context) (connection.FrameReader, connection.FrameWriter, error) {
 	if t.IsLocal() {
 		sockPath := filepath.Join(t.Local, "codewire.sock")
-		conn, err := net.Dial("unix", sockPath)
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", sockPath)
 		if err != nil {
 			return nil, nil, fmt.Errorf("connecting to local socket: %w", err)
 		}
-		return connection.NewUnixReader(conn), connection.NewUnixWriter(conn), nil
+		var writer connection.FrameWriter = connection.NewUnixWriter(conn)
+		if t.Token != "" {
+			writer = &tokenWriter{FrameWriter: writer, token: t.Token}
+		}
+		reader, writer := connection.WithContext(ctx, connection.NewUnixReader(conn), writer)
+		return reader, writer, nil
+	}
+	if t.SSH != "" {
+		reader, writer, err := t.connectSSH(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader, writer = connection.WithContext(ctx, reader, writer)
+		return reader, writer, nil
 	}
 
 	// Determine WebSocket URL.
 	wsURL := t.URL
-	if strings.HasPrefix(wsURL, "https://") {
+	if t.NodeGroup != "" {
+		wsURL = groupURL(t.URL, t.NodeGroup, t.Placement)
+	} else if t.Node != "" {
+		wsURL = relayWSURL(t.URL, "/api/v1/nodes/"+url.PathEscape(t.Node)+"/ws")
+	} else if strings.HasPrefix(wsURL, "https://") {
 		// Relay URL: convert https:// → wss://
 		wsURL = "wss://" + strings.TrimPrefix(wsURL, "https://")
 		if !strings.HasSuffix(wsURL, "/ws") {
@@ -55,27 +153,62 @@ func (t *Target) Connect() (connection.FrameReader, connection.FrameWriter, erro
 	}
 
 	// Send token via Authorization header only (not in URL query to avoid log exposure).
-	ctx := context.Background()
 	opts := &websocket.DialOptions{}
 	if t.Token != "" {
 		opts.HTTPHeader = make(map[string][]string)
 		opts.HTTPHeader["Authorization"] = []string{"Bearer " + t.Token}
 	}
 
-	conn, _, err := websocket.Dial(ctx, wsURL, opts)
+	conn, resp, err := websocket.Dial(ctx, wsURL, opts)
 	if err != nil {
 		return nil, nil, fmt.Errorf("connecting to remote server: %w", err)
 	}
+	if t.NodeGroup != "" {
+		t.Node = resp.Header.Get(relay.NodeHeader)
+	}
 	// Remove the default read limit so large frames are not rejected.
 	conn.SetReadLimit(-1)
 	return connection.NewWSReader(ctx, conn), connection.NewWSWriter(ctx, conn), nil
 }
 
+// groupURL returns the WebSocket URL of the relay at relayURL that connects
+// to a node of group.
+func groupURL(relayURL, group, placement string) string {
+	u := relayWSURL(relayURL, "/api/v1/groups/"+url.PathEscape(group)+"/ws")
+	if placement != "" {
+		u += "?" + url.Values{"placement": {placement}}.Encode()
+	}
+	return u
+}
+
+// relayWSURL returns the WebSocket URL of path on the relay at relayURL.
+func relayWSURL(relayURL, path string) string {
+	base := strings.TrimSuffix(strings.TrimSuffix(relayURL, "/ws"), "/")
+	switch {
+	case strings.HasPrefix(base, "https://"):
+		base = "wss://" + strings.TrimPrefix(base, "https://")
+	case strings.HasPrefix(base, "http://"):
+		base = "ws://" + strings.TrimPrefix(base, "http://")
+	}
+	return base + path
+}
+
+// tokenWriter stamps the auth token on requests sent over the Unix socket.
+type tokenWriter struct {
+	connection.FrameWriter
+	token string
+}
+
+func (w *tokenWriter) SendRequest(req *protocol.Request) error {
+	req.Token = w.token
+	return w.FrameWriter.SendRequest(req)
+}
+
 // requestResponse opens a connection, sends a single request, reads a single
 // control frame response, and closes the connection. It is the building block
 // for simple one-shot commands.
-func requestResponse(target *Target, req *protocol.Request) (*protocol.Response, error) {
-	reader, writer, err := target.Connect()
+func requestResponse(ctx context.Context, target *Target, req *protocol.Request) (*protocol.Response, error) {
+	reader, writer, err := target.Connect(ctx)
 	if err != nil {
 		return nil, err
 	}
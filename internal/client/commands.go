@@ -2,21 +2,24 @@ package client
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -24,16 +27,23 @@ import (
 
 	"github.com/codewiresh/codewire/internal/config"
 	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/notify"
 	"github.com/codewiresh/codewire/internal/protocol"
 	"github.com/codewiresh/codewire/internal/relay"
+	"github.com/codewiresh/codewire/internal/secrets"
 	"github.com/codewiresh/codewire/internal/statusbar"
 	"github.com/codewiresh/codewire/internal/terminal"
 )
 
 // ResolveSessionArg resolves a session argument that can be either a numeric ID
-// or a session name (optionally prefixed with @). It queries the node to
-// resolve names to IDs.
-func ResolveSessionArg(target *Target, arg string) (uint32, error) {
+// or a session name (optionally prefixed with @). Names may be abbreviated to
+// any prefix that matches exactly one session. It queries the node to resolve
+// names to IDs.
+func ResolveSessionArg(ctx context.Context, target *Target, arg string) (uint32, error) {
+	if strings.HasPrefix(arg, "%") {
+		return 0, fmt.Errorf("%q is a tag; this command takes a single session", arg)
+	}
+
 	// Strip leading @ if present.
 	name := strings.TrimPrefix(arg, "@")
 
@@ -42,69 +52,170 @@ func ResolveSessionArg(target *Target, arg string) (uint32, error) {
 		return uint32(parsed), nil
 	}
 
-	// Resolve by name — list sessions and find by name.
-	resp, err := requestResponse(target, &protocol.Request{Type: "ListSessions"})
+	sessions, err := listSessionsForResolve(ctx, target)
 	if err != nil {
 		return 0, err
 	}
-	if resp.Type == "Error" {
-		return 0, fmt.Errorf("%s", formatError(resp.Message))
-	}
-	if resp.Sessions == nil {
+	if len(sessions) == 0 {
 		return 0, fmt.Errorf("no sessions found")
 	}
-	for _, s := range *resp.Sessions {
-		if s.Name == name {
-			return s.ID, nil
-		}
+	if id, ok := matchSessionName(sessions, name); ok {
+		return id, nil
 	}
-	return 0, fmt.Errorf("no session named %q", name)
+	return matchSessionPrefix(sessions, name)
 }
 
 // ResolveSessionOrTag tries to resolve arg as a session ID/name, then as a tag.
 // Returns (sessionID, tags, err). Exactly one of sessionID or tags will be non-nil/non-empty.
-func ResolveSessionOrTag(target *Target, arg string) (*uint32, []string, error) {
-	// Try as session ID or name first.
-	id, err := ResolveSessionArg(target, arg)
-	if err == nil {
+//
+// Exact IDs and names win over tags, and tags win over name prefixes. A
+// leading % ("%workers") always selects a tag and a leading @ always selects a
+// session.
+func ResolveSessionOrTag(ctx context.Context, target *Target, arg string) (*uint32, []string, error) {
+	if tag, ok := strings.CutPrefix(arg, "%"); ok {
+		if tag == "" {
+			return nil, nil, fmt.Errorf("empty tag")
+		}
+		return nil, []string{tag}, nil
+	}
+	if strings.HasPrefix(arg, "@") {
+		id, err := ResolveSessionArg(ctx, target, arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &id, nil, nil
+	}
+
+	// Try as session ID first.
+	if parsed, err := strconv.ParseUint(arg, 10, 32); err == nil {
+		id := uint32(parsed)
 		return &id, nil, nil
 	}
 
-	// Only fall back to tag for "not found" errors, not connection errors.
-	lower := strings.ToLower(err.Error())
-	if !strings.Contains(lower, "not found") && !strings.Contains(lower, "no session named") {
+	sessions, err := listSessionsForResolve(ctx, target)
+	if err != nil {
 		return nil, nil, err
 	}
 
+	// Exact name.
+	if id, ok := matchSessionName(sessions, arg); ok {
+		return &id, nil, nil
+	}
+
 	// Check if any sessions have this tag.
-	resp, listErr := requestResponse(target, &protocol.Request{Type: "ListSessions"})
-	if listErr != nil {
-		return nil, nil, err // return original error
-	}
-	if resp.Sessions != nil {
-		for _, s := range *resp.Sessions {
-			for _, t := range s.Tags {
-				if t == arg {
-					return nil, []string{arg}, nil
-				}
+	for _, s := range sessions {
+		for _, t := range s.Tags {
+			if t == arg {
+				return nil, []string{arg}, nil
 			}
 		}
 	}
 
+	// Unique name prefix.
+	id, err := matchSessionPrefix(sessions, arg)
+	if err == nil {
+		return &id, nil, nil
+	}
+	var ambiguous *ambiguousNameError
+	if errors.As(err, &ambiguous) {
+		return nil, nil, err
+	}
+
 	return nil, nil, fmt.Errorf("no session or tag named %q\n\nUse 'cw list' to see active sessions", arg)
 }
 
+// listSessionsForResolve fetches the session list used for name resolution.
+func listSessionsForResolve(ctx context.Context, target *Target) ([]protocol.SessionInfo, error) {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "ListSessions"})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Type == "Error" {
+		return nil, fmt.Errorf("%s", formatError(resp.Message))
+	}
+	if resp.Sessions == nil {
+		return nil, nil
+	}
+	return *resp.Sessions, nil
+}
+
+// matchSessionName finds the session with exactly this name.
+func matchSessionName(sessions []protocol.SessionInfo, name string) (uint32, bool) {
+	for _, s := range sessions {
+		if s.Name == name {
+			return s.ID, true
+		}
+	}
+	return 0, false
+}
+
+// ambiguousNameError is a name prefix that matches several sessions.
+type ambiguousNameError struct {
+	prefix  string
+	matches []protocol.SessionInfo
+}
+
+func (e *ambiguousNameError) Error() string {
+	candidates := make([]string, len(e.matches))
+	for i, s := range e.matches {
+		candidates[i] = fmt.Sprintf("  %d  %s", s.ID, s.Name)
+	}
+	return fmt.Sprintf("%q is ambiguous; it matches:\n%s", e.prefix, strings.Join(candidates, "\n"))
+}
+
+// matchSessionPrefix finds the single session whose name starts with prefix.
+// If several match, it returns an *ambiguousNameError listing them.
+func matchSessionPrefix(sessions []protocol.SessionInfo, prefix string) (uint32, error) {
+	var matches []protocol.SessionInfo
+	for _, s := range sessions {
+		if s.Name != "" && strings.HasPrefix(s.Name, prefix) {
+			matches = append(matches, s)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("no session named %q", prefix)
+	case 1:
+		return matches[0].ID, nil
+	}
+	return 0, &ambiguousNameError{prefix: prefix, matches: matches}
+}
+
 // ---------------------------------------------------------------------------
 // List
 // ---------------------------------------------------------------------------
 
-// List retrieves sessions, optionally filtered by status.
-func List(target *Target, jsonOutput bool, statusFilter string) error {
-	sessions, err := ListFiltered(target, statusFilter)
+// ListOptions controls which sessions List shows and how.
+type ListOptions struct {
+	JSON     bool
+	Status   string        // all, running, queued, completed, killed
+	Tags     []string      // keep sessions with any of these tags
+	Selector string        // keep sessions whose labels match (see protocol.ParseSelector)
+	Sort     string        // id (default), age, name, status
+	Wide     bool          // add working directory and PID columns
+	Watch    time.Duration // redraw every interval until interrupted; 0 prints once
+}
+
+// List retrieves sessions, filtered and sorted per opts.
+func List(ctx context.Context, target *Target, opts ListOptions) error {
+	switch opts.Sort {
+	case "", "id", "age", "name", "status":
+	default:
+		return fmt.Errorf("invalid --sort %q (use id, age, name, or status)", opts.Sort)
+	}
+	if opts.Watch > 0 {
+		if opts.JSON {
+			return fmt.Errorf("--watch cannot be combined with --json")
+		}
+		return watchList(ctx, target, opts)
+	}
+
+	sessions, err := listSessions(ctx, target, opts)
 	if err != nil {
 		return err
 	}
-	if jsonOutput {
+	if opts.JSON {
 		data, err := json.MarshalIndent(sessions, "", "  ")
 		if err != nil {
 			return err
@@ -116,13 +227,126 @@ func List(target *Target, jsonOutput bool, statusFilter string) error {
 		fmt.Println("No sessions")
 		return nil
 	}
-	printSessionTable(sessions)
+	printSessionTable(sessions, opts.Wide)
 	return nil
 }
 
-// ListFiltered returns sessions filtered by status: "all", "running", "completed", "killed".
-func ListFiltered(target *Target, statusFilter string) ([]protocol.SessionInfo, error) {
-	resp, err := requestResponse(target, &protocol.Request{Type: "ListSessions"})
+// watchList redraws the session table every opts.Watch until ctx is done.
+func watchList(ctx context.Context, target *Target, opts ListOptions) error {
+	for {
+		sessions, err := listSessions(ctx, target, opts)
+
+		// Home the cursor and clear the screen before each redraw.
+		fmt.Print("\x1b[H\x1b[2J")
+		fmt.Printf("Every %s: cw list\t%s\n\n", opts.Watch, time.Now().Format("15:04:05"))
+		switch {
+		case err != nil:
+			fmt.Printf("error: %v\n", err)
+		case len(sessions) == 0:
+			fmt.Println("No sessions")
+		default:
+			printSessionTable(sessions, opts.Wide)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.Watch):
+		}
+	}
+}
+
+// listSessions fetches sessions and applies the status filter, tag filter,
+// and sort order from opts.
+func listSessions(ctx context.Context, target *Target, opts ListOptions) ([]protocol.SessionInfo, error) {
+	sessions, err := ListFiltered(ctx, target, opts.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.Tags) > 0 {
+		var tagged []protocol.SessionInfo
+		for _, s := range sessions {
+			if hasAnyTag(s.Tags, opts.Tags) {
+				tagged = append(tagged, s)
+			}
+		}
+		sessions = tagged
+	}
+	if opts.Selector != "" {
+		selector, err := protocol.ParseSelector(opts.Selector)
+		if err != nil {
+			return nil, err
+		}
+		var selected []protocol.SessionInfo
+		for _, s := range sessions {
+			if selector.Matches(s.Labels) {
+				selected = append(selected, s)
+			}
+		}
+		sessions = selected
+	}
+
+	sortSessions(sessions, opts.Sort)
+	return sessions, nil
+}
+
+func hasAnyTag(tags, want []string) bool {
+	for _, w := range want {
+		for _, t := range tags {
+			if t == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sortSessions orders sessions by key: "age" (newest first), "name", "status"
+// (running first, then queued), or by ID.
+func sortSessions(sessions []protocol.SessionInfo, key string) {
+	statusRank := func(status string) int {
+		switch {
+		case strings.HasPrefix(status, "running"):
+			return 0
+		case strings.HasPrefix(status, "queued"):
+			return 1
+		case strings.HasPrefix(status, "completed"):
+			return 2
+		case strings.HasPrefix(status, "killed"):
+			return 3
+		default:
+			return 4
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		a, b := sessions[i], sessions[j]
+		switch key {
+		case "age":
+			if a.CreatedAt != b.CreatedAt {
+				return a.CreatedAt > b.CreatedAt
+			}
+		case "name":
+			if a.Name != b.Name {
+				// Unnamed sessions sort last.
+				if a.Name == "" || b.Name == "" {
+					return b.Name == ""
+				}
+				return a.Name < b.Name
+			}
+		case "status":
+			if ra, rb := statusRank(a.Status), statusRank(b.Status); ra != rb {
+				return ra < rb
+			}
+		}
+		return a.ID < b.ID
+	})
+}
+
+// ListFiltered returns sessions filtered by status: "all", "running", "queued", "completed", "killed".
+func ListFiltered(ctx context.Context, target *Target, statusFilter string) ([]protocol.SessionInfo, error) {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "ListSessions"})
 	if err != nil {
 		return nil, err
 	}
@@ -153,18 +377,192 @@ func ListFiltered(target *Target, statusFilter string) ([]protocol.SessionInfo,
 // Run
 // ---------------------------------------------------------------------------
 
-// Run launches a new session on the node with the given command, working
-// directory, and optional tags. If name is non-empty, the session is assigned
-// that name for addressing.
-func Run(target *Target, command []string, workingDir string, name string, env []string, stdinData []byte, tags ...string) error {
-	resp, err := requestResponse(target, &protocol.Request{
-		Type:       "Launch",
-		Command:    command,
-		WorkingDir: workingDir,
-		Name:       name,
-		Env:        env,
-		StdinData:  stdinData,
-		Tags:       tags,
+// RunOptions holds the optional launch parameters for Run.
+type RunOptions struct {
+	WorkingDir     string
+	Name           string   // unique name for addressing (optional)
+	Env            []string // KEY=VALUE overrides
+	Secrets        []string // KEY=VALUE variables the node never stores (see ResolveSecrets)
+	StdinData      []byte   // injected into the PTY after launch
+	Tags           []string
+	Labels         map[string]string // key=value metadata for selectors (see protocol.ParseLabels)
+	Budget         *protocol.Budget  // nil uses the node default
+	NoQueue        bool              // fail instead of queueing at the node's session limit
+	Pool           string            // concurrency pool shared with other sessions (optional)
+	PoolSize       int               // pool limit; zero keeps the pool's current limit
+	Worktree       string            // run in this git worktree of WorkingDir's repository (optional)
+	Backend        string            // execution environment, e.g. "docker"; empty runs on the node's host
+	BackendOptions map[string]string // options for Backend, e.g. image
+
+	AutoRespond []protocol.AutoRespondRule // prompts to answer (see ParseAutoRespond)
+	Alerts      []string                   // output patterns raising session.alert events
+	AlertNotify string                     // notify method the node sends alerts to (optional)
+	Redact      []string                   // output patterns masked in logs and watch output
+
+	AcceptInputFrom []string // who may send the session input and messages (empty: anyone)
+
+	JSON bool // print a LaunchResult instead of a message
+}
+
+// ParsePool parses a "name=N" pool spec. A bare name joins the pool at its
+// current limit.
+func ParsePool(spec string) (string, int, error) {
+	name, size, hasSize := strings.Cut(spec, "=")
+	if name == "" {
+		return "", 0, fmt.Errorf("invalid pool %q: expected name=N", spec)
+	}
+	if !hasSize {
+		return name, 0, nil
+	}
+	n, err := strconv.Atoi(size)
+	if err != nil || n < 1 {
+		return "", 0, fmt.Errorf("invalid pool %q: size must be a positive integer", spec)
+	}
+	return name, n, nil
+}
+
+// ParseAutoRespond parses "/pattern/flags=response" auto-respond rules, such
+// as `/\(y\/n\)\s*$/i=y`. The pattern is a Go regular expression matched
+// against the session's latest output, so $ anchors it to a waiting prompt,
+// and the flags are any of i, m, s and U. The response is typed followed by
+// Enter, so it may be empty to just press Enter.
+func ParseAutoRespond(specs []string) ([]protocol.AutoRespondRule, error) {
+	rules := make([]protocol.AutoRespondRule, 0, len(specs))
+	for _, spec := range specs {
+		if !strings.HasPrefix(spec, "/") {
+			return nil, fmt.Errorf("invalid auto-respond rule %q: expected /pattern/flags=response", spec)
+		}
+		end := -1
+		for i := 1; i < len(spec); i++ {
+			if spec[i] == '\\' {
+				i++
+			} else if spec[i] == '/' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("invalid auto-respond rule %q: pattern is missing its closing /", spec)
+		}
+		flags, response, ok := strings.Cut(spec[end+1:], "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid auto-respond rule %q: expected /pattern/flags=response", spec)
+		}
+		if strings.Trim(flags, "imsU") != "" {
+			return nil, fmt.Errorf("invalid auto-respond rule %q: unknown flags %q (valid: i, m, s, U)", spec, flags)
+		}
+		pattern := spec[1:end]
+		if pattern == "" {
+			return nil, fmt.Errorf("invalid auto-respond rule %q: empty pattern", spec)
+		}
+		if flags != "" {
+			pattern = "(?" + flags + ")" + pattern
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid auto-respond rule %q: %w", spec, err)
+		}
+		rules = append(rules, protocol.AutoRespondRule{Pattern: pattern, Response: response})
+	}
+	return rules, nil
+}
+
+// ParseBackendOptions parses "key=value" backend options.
+func ParseBackendOptions(specs []string) (map[string]string, error) {
+	opts := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		key, val, ok := strings.Cut(spec, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid backend option %q: expected key=value", spec)
+		}
+		opts[key] = val
+	}
+	return opts, nil
+}
+
+// describeBackend formats a session's backend and its state, e.g.
+// "docker (container=cw-1a2b3c4d image=alpine runtime=docker)".
+func describeBackend(info *protocol.SessionInfo) string {
+	if len(info.BackendState) == 0 {
+		return info.Backend
+	}
+	keys := make([]string, 0, len(info.BackendState))
+	for k := range info.BackendState {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + info.BackendState[k]
+	}
+	return info.Backend + " (" + strings.Join(parts, " ") + ")"
+}
+
+// ParseBudget parses "tools=200,bash=50" style specs (one or more, comma
+// separated) into a Budget.
+func ParseBudget(specs []string) (*protocol.Budget, error) {
+	var b protocol.Budget
+	for _, spec := range specs {
+		for _, part := range strings.Split(spec, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			key, val, ok := strings.Cut(part, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid budget %q: expected key=value", part)
+			}
+			if key == "cost" {
+				v, err := strconv.ParseFloat(strings.TrimPrefix(val, "$"), 64)
+				if err != nil || v < 0 {
+					return nil, fmt.Errorf("invalid budget %q: cost must be a non-negative number of dollars", part)
+				}
+				b.Cost = v
+				continue
+			}
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid budget %q: value must be a non-negative integer", part)
+			}
+			switch key {
+			case "tools":
+				b.Tools = n
+			case "bash":
+				b.Bash = n
+			case "writes":
+				b.Writes = n
+			default:
+				return nil, fmt.Errorf("unknown budget %q (valid: tools, bash, writes, cost)", key)
+			}
+		}
+	}
+	return &b, nil
+}
+
+// Run launches a new session on the node with the given command and options.
+func Run(ctx context.Context, target *Target, command []string, opts RunOptions) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type:           "Launch",
+		Command:        command,
+		WorkingDir:     opts.WorkingDir,
+		Name:           opts.Name,
+		Env:            opts.Env,
+		Secrets:        opts.Secrets,
+		StdinData:      opts.StdinData,
+		Tags:           opts.Tags,
+		Labels:         opts.Labels,
+		Budget:         opts.Budget,
+		NoQueue:        opts.NoQueue,
+		Pool:           opts.Pool,
+		PoolSize:       opts.PoolSize,
+		Worktree:       opts.Worktree,
+		Backend:        opts.Backend,
+		BackendOptions: opts.BackendOptions,
+		AutoRespond:    opts.AutoRespond,
+		Alerts:         opts.Alerts,
+		AlertNotify:    opts.AlertNotify,
+		Redact:         opts.Redact,
+
+		AcceptInputFrom: opts.AcceptInputFrom,
 	})
 	if err != nil {
 		return err
@@ -176,8 +574,124 @@ func Run(target *Target, command []string, workingDir string, name string, env [
 		return fmt.Errorf("unexpected response type: %s", resp.Type)
 	}
 
+	if opts.JSON {
+		return printJSON(LaunchResult{
+			ID:       *resp.ID,
+			Name:     resp.Name,
+			Status:   cmp.Or(resp.Status, "running"),
+			Command:  command,
+			Worktree: opts.Worktree,
+			Path:     resp.Path,
+			Node:     target.Node,
+		})
+	}
+
 	display := strings.Join(command, " ")
-	fmt.Fprintf(os.Stderr, "Session %d launched: %s\n", *resp.ID, display)
+	on := ""
+	if target.Node != "" {
+		on = " on node " + target.Node
+	}
+	verb := "launched" + on
+	if resp.Status == "queued" {
+		verb = "queued" + on + " (node is at its session limit)"
+		if opts.Pool != "" {
+			verb = "queued" + on + " (node or pool " + opts.Pool + " is at its session limit)"
+		}
+	}
+	if resp.Name != "" {
+		fmt.Fprintf(os.Stderr, "Session %d (%s) %s: %s\n", *resp.ID, resp.Name, verb, display)
+	} else {
+		fmt.Fprintf(os.Stderr, "Session %d %s: %s\n", *resp.ID, verb, display)
+	}
+	if opts.Worktree != "" {
+		fmt.Fprintf(os.Stderr, "Worktree %s: %s\n", opts.Worktree, resp.Path)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Fork
+// ---------------------------------------------------------------------------
+
+// Fork launches a copy of session id, as the node launched it, named name
+// (generated if empty). With replayInput, the copy is sent the input the
+// session has received. With jsonOutput, the new session's info is printed.
+func Fork(ctx context.Context, target *Target, id uint32, name string, replayInput, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type:        "Fork",
+		ID:          &id,
+		Name:        name,
+		ReplayInput: replayInput,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	if resp.Type != "Launched" || resp.ID == nil || resp.Info == nil {
+		return fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+
+	if jsonOutput {
+		return printJSON(resp.Info)
+	}
+	from := fmt.Sprintf("forked from session %d", id)
+	if resp.Status == "queued" {
+		from += ", queued (node is at its session limit)"
+	}
+	fmt.Fprintf(os.Stderr, "Session %d (%s) %s: %s\n", *resp.ID, resp.Name, from, resp.Info.Prompt)
+	return nil
+}
+
+// Resume launches a new session continuing the Claude Code conversation of
+// session id, passing args on to claude --resume.
+func Resume(ctx context.Context, target *Target, id uint32, name string, args []string, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type:    "Resume",
+		ID:      &id,
+		Name:    name,
+		Command: args,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	if resp.Type != "Launched" || resp.ID == nil || resp.Info == nil {
+		return fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+
+	if jsonOutput {
+		return printJSON(resp.Info)
+	}
+	from := fmt.Sprintf("resumed from session %d", id)
+	if resp.Status == "queued" {
+		from += ", queued (node is at its session limit)"
+	}
+	fmt.Fprintf(os.Stderr, "Session %d (%s) %s: %s\n", *resp.ID, resp.Name, from, resp.Info.Prompt)
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Rename
+// ---------------------------------------------------------------------------
+
+// Rename changes the name of a session.
+func Rename(ctx context.Context, target *Target, id uint32, name string) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type: "Rename",
+		ID:   &id,
+		Name: name,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	fmt.Fprintf(os.Stderr, "Session %d renamed to %s\n", id, name)
 	return nil
 }
 
@@ -200,13 +714,16 @@ type frameEvent struct {
 
 // Attach connects to a session's PTY. If id is nil, the oldest running
 // unattached session is selected automatically. The terminal is put into raw
-// mode and a status bar is drawn at the bottom of the screen.
-func Attach(target *Target, id *uint32, noHistory bool) error {
+// mode and a status bar is drawn at the bottom of the screen. detachKey is
+// the detach prefix from terminal.ParseDetachKey, or 0 for Ctrl+B. lowLatency
+// asks the node to send output as soon as it is written rather than batching
+// it for a few milliseconds.
+func Attach(ctx context.Context, target *Target, id *uint32, noHistory, lowLatency bool, detachKey byte) error {
 	// ---------------------------------------------------------------
 	// Step 1: auto-select session if no ID given
 	// ---------------------------------------------------------------
 	if id == nil {
-		resp, err := requestResponse(target, &protocol.Request{Type: "ListSessions"})
+		resp, err := requestResponse(ctx, target, &protocol.Request{Type: "ListSessions"})
 		if err != nil {
 			return err
 		}
@@ -238,45 +755,26 @@ func Attach(target *Target, id *uint32, noHistory bool) error {
 	// ---------------------------------------------------------------
 	// Step 2: connect and send Attach request
 	// ---------------------------------------------------------------
-	reader, writer, err := target.Connect()
-	if err != nil {
-		return err
-	}
-	defer reader.Close()
-	defer writer.Close()
-
 	includeHistory := !noHistory
 	req := &protocol.Request{
 		Type:           "Attach",
 		ID:             id,
 		IncludeHistory: &includeHistory,
+		LowLatency:     lowLatency,
 	}
-	if err := writer.SendRequest(req); err != nil {
-		return fmt.Errorf("sending attach request: %w", err)
+	if !target.IsLocal() {
+		// Compression pays off on remote links, ANSI-heavy output through
+		// a relay especially, not over the local socket.
+		req.Compression = connection.Compressions
 	}
-
-	// Read the Attached response.
-	frame, err := reader.ReadFrame()
+	reader, writer, err := attachStream(ctx, target, req)
 	if err != nil {
-		return fmt.Errorf("reading attach response: %w", err)
-	}
-	if frame == nil {
-		return fmt.Errorf("connection closed before attach response")
-	}
-	if frame.Type != protocol.FrameControl {
-		return fmt.Errorf("expected control frame, got type 0x%02x", frame.Type)
-	}
-
-	var resp protocol.Response
-	if err := json.Unmarshal(frame.Payload, &resp); err != nil {
-		return fmt.Errorf("parsing attach response: %w", err)
-	}
-	if resp.Type == "Error" {
-		return fmt.Errorf("%s", formatError(resp.Message))
-	}
-	if resp.Type != "Attached" {
-		return fmt.Errorf("unexpected response: %s", resp.Type)
+		return err
 	}
+	defer func() {
+		reader.Close()
+		writer.Close()
+	}()
 
 	sessionID := *id
 	fmt.Fprintf(os.Stderr, "[cw] attached to session %d\n", sessionID)
@@ -299,7 +797,11 @@ func Attach(target *Target, id *uint32, noHistory bool) error {
 		return fmt.Errorf("getting terminal size: %w", err)
 	}
 
+	if detachKey == 0 {
+		detachKey, _ = terminal.ParseDetachKey("")
+	}
 	bar := statusbar.New(uint32(sessionID), cols, rows)
+	bar.DetachKey = terminal.DetachKeyLabel(detachKey)
 	if setup := bar.Setup(); setup != nil {
 		os.Stdout.Write(setup)
 	}
@@ -332,7 +834,7 @@ func Attach(target *Target, id *uint32, noHistory bool) error {
 	// ---------------------------------------------------------------
 	// Step 7: stdin reader goroutine
 	// ---------------------------------------------------------------
-	detector := terminal.NewDetachDetector()
+	detector := terminal.NewDetachDetectorKey(detachKey)
 	stdinCh := make(chan stdinEvent, 1)
 	go func() {
 		for {
@@ -356,15 +858,11 @@ func Attach(target *Target, id *uint32, noHistory bool) error {
 	// Step 8: frame reader goroutine
 	// ---------------------------------------------------------------
 	frameCh := make(chan frameEvent, 1)
-	go func() {
-		for {
-			f, readErr := reader.ReadFrame()
-			frameCh <- frameEvent{frame: f, err: readErr}
-			if readErr != nil || f == nil {
-				return
-			}
-		}
-	}()
+	go readFrames(reader, frameCh)
+
+	// redial delivers the new connection while reconnecting, and is nil
+	// otherwise.
+	var redial chan attachedStream
 
 	// ---------------------------------------------------------------
 	// Step 9: main select loop
@@ -372,6 +870,24 @@ func Attach(target *Target, id *uint32, noHistory bool) error {
 	for {
 		select {
 		case fe := <-frameCh:
+			if (fe.err != nil || fe.frame == nil) && canResume(ctx, target) {
+				// Reattach where the output left off.
+				fmt.Fprintf(os.Stderr, "\r\n[cw] connection lost, reconnecting...\r\n")
+				resumeOutput(req)
+				reader.Close()
+				writer.Close()
+				frameCh = nil
+				redial = make(chan attachedStream, 1)
+				go func() {
+					var a attachedStream
+					a.err = reconnect(ctx, func() (err error) {
+						a.reader, a.writer, err = attachStream(ctx, target, req)
+						return err
+					})
+					redial <- a
+				}()
+				continue
+			}
 			if fe.err != nil {
 				teardown(bar, guard)
 				fmt.Fprintf(os.Stderr, "\n[cw] connection error: %v\n", fe.err)
@@ -385,6 +901,9 @@ func Attach(target *Target, id *uint32, noHistory bool) error {
 			switch fe.frame.Type {
 			case protocol.FrameData:
 				os.Stdout.Write(fe.frame.Payload)
+				if req.Offset != nil {
+					*req.Offset += int64(len(fe.frame.Payload))
+				}
 			case protocol.FrameControl:
 				var ctrlResp protocol.Response
 				if err := json.Unmarshal(fe.frame.Payload, &ctrlResp); err != nil {
@@ -401,18 +920,44 @@ func Attach(target *Target, id *uint32, noHistory bool) error {
 					teardown(bar, guard)
 					fmt.Fprintf(os.Stderr, "\n[cw] %s\n", formatError(ctrlResp.Message))
 					os.Exit(0)
+				case "OutputDropped":
+					fmt.Fprintf(os.Stderr, "\r\n[cw] %d bytes of output dropped (connection too slow)\r\n", ctrlResp.Dropped)
 				default:
 					// Ignore other control messages.
 				}
 			}
 
+		case a := <-redial:
+			redial = nil
+			if a.err != nil {
+				teardown(bar, guard)
+				fmt.Fprintf(os.Stderr, "\n[cw] %v\n", a.err)
+				os.Exit(1)
+			}
+			reader, writer = a.reader, a.writer
+			fmt.Fprintf(os.Stderr, "[cw] reconnected\r\n")
+			ptyCols, ptyRows := bar.PtySize()
+			_ = writer.SendRequest(&protocol.Request{Type: "Resize", ID: &sessionID, Cols: &ptyCols, Rows: &ptyRows})
+			frameCh = make(chan frameEvent, 1)
+			go readFrames(reader, frameCh)
+
 		case se := <-stdinCh:
 			if se.err != nil {
 				// stdin closed or error, just continue until connection drops.
 				continue
 			}
-			if se.detach {
-				// Send detach request and wait for confirmation from the node.
+			if redial != nil {
+				// Input is dropped until the connection is back; the node
+				// already detached the lost one.
+				if se.detach {
+					teardown(bar, guard)
+					fmt.Fprintf(os.Stderr, "\n[cw] detached from session %d\n", sessionID)
+					os.Exit(0)
+				}
+				continue
+			}
+			if se.detach {
+				// Send detach request and wait for confirmation from the node.
 				detachReq := &protocol.Request{
 					Type: "Detach",
 					ID:   &sessionID,
@@ -436,6 +981,9 @@ func Attach(target *Target, id *uint32, noHistory bool) error {
 			if resize := bar.Resize(newCols, newRows); resize != nil {
 				os.Stdout.Write(resize)
 			}
+			if redial != nil {
+				continue // sent on reconnecting
+			}
 			ptyCols, ptyRows := bar.PtySize()
 			resizeReq := &protocol.Request{
 				Type: "Resize",
@@ -453,6 +1001,63 @@ func Attach(target *Target, id *uint32, noHistory bool) error {
 	}
 }
 
+// attachedStream is a connection attachStream opened, or why it failed.
+type attachedStream struct {
+	reader connection.FrameReader
+	writer connection.FrameWriter
+	err    error
+}
+
+// attachStream connects to target and sends the Attach request req,
+// returning the connection once the node has accepted it. req.Offset is set
+// to the log offset the data frames start at, if the node reports it.
+func attachStream(ctx context.Context, target *Target, req *protocol.Request) (connection.FrameReader, connection.FrameWriter, error) {
+	reader, writer, err := openStream(ctx, target, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := attachResponse(reader)
+	if err == nil {
+		reader, writer, err = connection.Compress(reader, writer, resp.Compression)
+	}
+	if err != nil {
+		reader.Close()
+		writer.Close()
+		return nil, nil, err
+	}
+	if resp.Offset != nil {
+		offset := *resp.Offset
+		req.Offset = &offset
+	}
+	return reader, writer, nil
+}
+
+// attachResponse reads the node's answer to an Attach request.
+func attachResponse(reader connection.FrameReader) (*protocol.Response, error) {
+	frame, err := reader.ReadFrame()
+	if err != nil {
+		return nil, fmt.Errorf("reading attach response: %w", err)
+	}
+	if frame == nil {
+		return nil, fmt.Errorf("connection closed before attach response")
+	}
+	if frame.Type != protocol.FrameControl {
+		return nil, fmt.Errorf("expected control frame, got type 0x%02x", frame.Type)
+	}
+
+	var resp protocol.Response
+	if err := json.Unmarshal(frame.Payload, &resp); err != nil {
+		return nil, fmt.Errorf("parsing attach response: %w", err)
+	}
+	if resp.Type == "Error" {
+		return nil, &refusedError{message: resp.Message}
+	}
+	if resp.Type != "Attached" {
+		return nil, fmt.Errorf("unexpected response: %s", resp.Type)
+	}
+	return &resp, nil
+}
+
 // teardown restores the terminal and clears the status bar.
 func teardown(bar *statusbar.StatusBar, guard *terminal.RawModeGuard) {
 	if td := bar.Teardown(); td != nil {
@@ -465,18 +1070,39 @@ func teardown(bar *statusbar.StatusBar, guard *terminal.RawModeGuard) {
 // Kill
 // ---------------------------------------------------------------------------
 
+// KillOptions controls how the node signals killed sessions.
+type KillOptions struct {
+	Signal   string        // TERM (default), INT, HUP or KILL
+	Grace    time.Duration // send SIGKILL if still running after this long
+	Children bool          // signal the session's whole process group
+	JSON     bool          // print a KillResult instead of a message
+}
+
+// request adds the kill options to req.
+func (o KillOptions) request(req *protocol.Request) *protocol.Request {
+	req.Signal = o.Signal
+	if o.Grace > 0 {
+		req.Grace = o.Grace.String()
+	}
+	req.Children = o.Children
+	return req
+}
+
 // Kill terminates a single session by ID.
-func Kill(target *Target, id uint32) error {
-	resp, err := requestResponse(target, &protocol.Request{
+func Kill(ctx context.Context, target *Target, id uint32, opts KillOptions) error {
+	resp, err := requestResponse(ctx, target, opts.request(&protocol.Request{
 		Type: "Kill",
 		ID:   &id,
-	})
+	}))
 	if err != nil {
 		return err
 	}
 	if resp.Type == "Error" {
 		return fmt.Errorf("%s", formatError(resp.Message))
 	}
+	if opts.JSON {
+		return printJSON(KillResult{ID: &id, Count: 1})
+	}
 	fmt.Fprintf(os.Stderr, "Session %d killed\n", id)
 	return nil
 }
@@ -485,12 +1111,14 @@ func Kill(target *Target, id uint32) error {
 // KillByTags
 // ---------------------------------------------------------------------------
 
-// KillByTags terminates all sessions matching the given tags.
-func KillByTags(target *Target, tags []string) error {
-	resp, err := requestResponse(target, &protocol.Request{
-		Type: "KillByTags",
-		Tags: tags,
-	})
+// KillByTags terminates all sessions matching the given tags and, if set,
+// the label selector.
+func KillByTags(ctx context.Context, target *Target, tags []string, selector string, opts KillOptions) error {
+	resp, err := requestResponse(ctx, target, opts.request(&protocol.Request{
+		Type:     "KillByTags",
+		Tags:     tags,
+		Selector: selector,
+	}))
 	if err != nil {
 		return err
 	}
@@ -501,7 +1129,17 @@ func KillByTags(target *Target, tags []string) error {
 	if resp.Count != nil {
 		count = *resp.Count
 	}
-	fmt.Fprintf(os.Stderr, "Killed %d session(s) matching tags %v\n", count, tags)
+	if opts.JSON {
+		return printJSON(KillResult{Tags: tags, Selector: selector, Count: count})
+	}
+	switch {
+	case selector == "":
+		fmt.Fprintf(os.Stderr, "Killed %d session(s) matching tags %v\n", count, tags)
+	case len(tags) == 0:
+		fmt.Fprintf(os.Stderr, "Killed %d session(s) matching %s\n", count, selector)
+	default:
+		fmt.Fprintf(os.Stderr, "Killed %d session(s) matching tags %v and %s\n", count, tags, selector)
+	}
 	return nil
 }
 
@@ -510,8 +1148,8 @@ func KillByTags(target *Target, tags []string) error {
 // ---------------------------------------------------------------------------
 
 // KillAll terminates all running sessions on the node.
-func KillAll(target *Target) error {
-	resp, err := requestResponse(target, &protocol.Request{Type: "KillAll"})
+func KillAll(ctx context.Context, target *Target, opts KillOptions) error {
+	resp, err := requestResponse(ctx, target, opts.request(&protocol.Request{Type: "KillAll"}))
 	if err != nil {
 		return err
 	}
@@ -522,6 +1160,9 @@ func KillAll(target *Target) error {
 	if resp.Count != nil {
 		count = *resp.Count
 	}
+	if opts.JSON {
+		return printJSON(KillResult{Count: count})
+	}
 	fmt.Fprintf(os.Stderr, "Killed %d session(s)\n", count)
 	return nil
 }
@@ -530,11 +1171,11 @@ func KillAll(target *Target) error {
 // Logs
 // ---------------------------------------------------------------------------
 
-// Logs retrieves the output log for a session. When follow is true, the client
-// streams new output as it arrives until the session ends or the connection
-// drops.
-func Logs(target *Target, id uint32, follow bool, tail *int, raw bool) error {
-	reader, writer, err := target.Connect()
+// Logs retrieves the output log for a session, sanitized at level sanitize
+// (full if empty). When follow is true, the client streams new output as it
+// arrives until the session ends or the connection drops.
+func Logs(ctx context.Context, target *Target, id uint32, follow bool, tail *int, sanitize string) error {
+	reader, writer, err := target.Connect(ctx)
 	if err != nil {
 		return err
 	}
@@ -542,15 +1183,17 @@ func Logs(target *Target, id uint32, follow bool, tail *int, raw bool) error {
 	defer writer.Close()
 
 	req := &protocol.Request{
-		Type:   "Logs",
-		ID:     &id,
-		Follow: &follow,
+		Type:     "Logs",
+		ID:       &id,
+		Follow:   &follow,
+		Sanitize: sanitize,
 	}
 	if tail != nil {
 		t := uint(*tail)
 		req.Tail = &t
 	}
-	if raw {
+	if sanitize == "none" {
+		// Nodes from before sanitization levels only know this.
 		f := false
 		req.StripANSI = &f
 	}
@@ -599,9 +1242,12 @@ func Logs(target *Target, id uint32, follow bool, tail *int, raw bool) error {
 // ---------------------------------------------------------------------------
 
 // SendInput sends input to a session without attaching. The input can come
-// from a direct argument, stdin, or a file. Unless noNewline is set, a
-// trailing newline is appended.
-func SendInput(target *Target, id uint32, input *string, useStdin bool, file *string, noNewline bool) error {
+// from a direct argument, stdin, or a file, and is decoded by decode:
+// "escapes" interprets backslash escapes (see Unescape), "hex" hex digits
+// (see DecodeHex). The named keys (see ParseKeys) follow it. Unless
+// noNewline is set, or keys or hex input are given, a trailing newline is
+// appended. With jsonOutput, it prints a SendResult.
+func SendInput(ctx context.Context, target *Target, id uint32, fromID *uint32, input *string, useStdin bool, file *string, decode string, keys []string, noNewline, jsonOutput bool) error {
 	var data []byte
 
 	switch {
@@ -619,18 +1265,39 @@ func SendInput(target *Target, id uint32, input *string, useStdin bool, file *st
 		if err != nil {
 			return fmt.Errorf("reading file: %w", err)
 		}
+	case len(keys) > 0:
 	default:
 		return fmt.Errorf("no input source specified")
 	}
 
-	if !noNewline {
+	var err error
+	switch decode {
+	case "":
+	case "escapes":
+		data, err = Unescape(string(data))
+	case "hex":
+		data, err = DecodeHex(string(data))
+	default:
+		err = fmt.Errorf("unknown input decoding %q", decode)
+	}
+	if err != nil {
+		return err
+	}
+	keyData, err := ParseKeys(keys)
+	if err != nil {
+		return err
+	}
+	data = append(data, keyData...)
+
+	if !noNewline && len(keys) == 0 && decode != "hex" {
 		data = append(data, '\n')
 	}
 
-	resp, err := requestResponse(target, &protocol.Request{
-		Type: "SendInput",
-		ID:   &id,
-		Data: data,
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type:   "SendInput",
+		ID:     &id,
+		FromID: fromID,
+		Data:   data,
 	})
 	if err != nil {
 		return err
@@ -643,6 +1310,9 @@ func SendInput(target *Target, id uint32, input *string, useStdin bool, file *st
 	if resp.Bytes != nil {
 		bytes = *resp.Bytes
 	}
+	if jsonOutput {
+		return printJSON(SendResult{ID: id, Bytes: bytes})
+	}
 	fmt.Fprintf(os.Stderr, "Sent %d bytes to session %d\n", bytes, id)
 	return nil
 }
@@ -651,30 +1321,31 @@ func SendInput(target *Target, id uint32, input *string, useStdin bool, file *st
 // WatchSession
 // ---------------------------------------------------------------------------
 
-// WatchSession watches a session's output in real-time without attaching.
-// An optional timeout (in seconds) limits how long to wait.
-func WatchSession(target *Target, id uint32, tail *int, noHistory bool, timeout *uint64) error {
-	reader, writer, err := target.Connect()
-	if err != nil {
-		return err
-	}
-	defer reader.Close()
-	defer writer.Close()
-
+// WatchSession watches a session's output in real-time without attaching,
+// sanitized at level sanitize (none if empty). An optional timeout (in
+// seconds) limits how long to wait. A watch of a remote node that loses the
+// connection reconnects and resumes.
+func WatchSession(ctx context.Context, target *Target, id uint32, tail *int, noHistory bool, timeout *uint64, sanitize string) error {
 	includeHistory := !noHistory
 	req := &protocol.Request{
 		Type:           "WatchSession",
 		ID:             &id,
 		IncludeHistory: &includeHistory,
+		Sanitize:       sanitize,
 	}
 	if tail != nil {
 		t := uint(*tail)
 		req.Tail = &t
 	}
 
-	if err := writer.SendRequest(req); err != nil {
-		return fmt.Errorf("sending watch request: %w", err)
+	reader, writer, err := openStream(ctx, target, req)
+	if err != nil {
+		return err
 	}
+	defer func() {
+		reader.Close()
+		writer.Close()
+	}()
 
 	// Set up timeout timer.
 	var timeoutDuration time.Duration
@@ -694,6 +1365,25 @@ func WatchSession(target *Target, id uint32, tail *int, noHistory bool, timeout
 	for {
 		select {
 		case fe := <-frameCh:
+			if (fe.err != nil || fe.frame == nil) && canResume(ctx, target) {
+				// The watch ends with a final WatchUpdate, so this is the
+				// connection dropping.
+				fmt.Fprintf(os.Stderr, "\n[cw] connection lost, reconnecting...\n")
+				resumeOutput(req)
+				reader.Close()
+				writer.Close()
+				err := reconnect(ctx, func() (err error) {
+					reader, writer, err = openStream(ctx, target, req)
+					return err
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "[cw] reconnected\n")
+				frameCh = make(chan frameEvent, 1)
+				go readFrames(reader, frameCh)
+				continue
+			}
 			if fe.err != nil {
 				return fmt.Errorf("reading watch frame: %w", fe.err)
 			}
@@ -712,9 +1402,14 @@ func WatchSession(target *Target, id uint32, tail *int, noHistory bool, timeout
 				if resp.Output != nil {
 					os.Stdout.Write([]byte(*resp.Output))
 				}
+				if resp.Offset != nil {
+					req.Offset = resp.Offset
+				}
 				if resp.Done != nil && *resp.Done {
 					return nil
 				}
+			case "OutputDropped":
+				fmt.Fprintf(os.Stderr, "\n[cw] %d bytes of output dropped (connection too slow)\n", resp.Dropped)
 			case "Error":
 				return fmt.Errorf("%s", formatError(resp.Message))
 			}
@@ -726,6 +1421,17 @@ func WatchSession(target *Target, id uint32, tail *int, noHistory bool, timeout
 	}
 }
 
+// resumeOutput updates a WatchSession or Attach request to resume after the
+// output received: from req.Offset, which the caller keeps at the end of
+// that output, or, from a node that reports no offsets, with new output
+// only.
+func resumeOutput(req *protocol.Request) {
+	if req.Offset == nil {
+		f := false
+		req.IncludeHistory = &f
+	}
+}
+
 // readFrames reads frames in a loop and sends them to the channel.
 func readFrames(reader connection.FrameReader, ch chan<- frameEvent) {
 	for {
@@ -743,8 +1449,9 @@ func readFrames(reader connection.FrameReader, ch chan<- frameEvent) {
 
 type watchLine struct {
 	label string
+	color string
 	data  string
-	done  bool
+	at    time.Time
 	err   error
 }
 
@@ -755,12 +1462,33 @@ var watchColors = []string{
 
 const colorReset = "\x1b[0m"
 
+// resetFor returns the code ending color, if any.
+func resetFor(color string) string {
+	if color == "" {
+		return ""
+	}
+	return colorReset
+}
+
+// watchIdleFlush is how long a partial line (e.g. a prompt) waits for the
+// rest of its line before being printed on its own.
+const watchIdleFlush = 500 * time.Millisecond
+
+// WatchOptions filters and annotates multiplexed watch output.
+type WatchOptions struct {
+	Timestamps bool           // prefix each line with the time it was written
+	Grep       *regexp.Regexp // only print matching lines (ANSI codes ignored)
+	Since      time.Duration  // only replay history this recent (0 for all)
+	NoColor    bool           // leave session prefixes uncolored
+	Sanitize   string         // clean up output at this level (none, colors or full)
+}
+
 // WatchMultiByTag watches all sessions matching a tag, merging their output
-// with colored prefixes. It writes to w (os.Stdout for CLI, or a buffer for
-// tests). If timeout is non-nil, it stops after that many seconds.
-func WatchMultiByTag(target *Target, tag string, w io.Writer, timeout *uint64) error {
+// line by line with colored prefixes. It writes to w (os.Stdout for CLI, or a
+// buffer for tests). If timeout is non-nil, it stops after that many seconds.
+func WatchMultiByTag(ctx context.Context, target *Target, tag string, w io.Writer, timeout *uint64, opts WatchOptions) error {
 	// 1. List sessions, filter by tag.
-	resp, err := requestResponse(target, &protocol.Request{Type: "ListSessions"})
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "ListSessions"})
 	if err != nil {
 		return err
 	}
@@ -785,22 +1513,42 @@ func WatchMultiByTag(target *Target, tag string, w io.Writer, timeout *uint64) e
 		return fmt.Errorf("no sessions found with tag %q", tag)
 	}
 
-	// 2. For each matched session, spawn a goroutine to watch it.
-	merged := make(chan watchLine, len(matched)*64)
+	return watchMerged(ctx, target, matched, w, timeout, opts, true)
+}
+
+// WatchSessionLines watches a single session like WatchSession, but line by
+// line so that opts can filter and timestamp the output.
+func WatchSessionLines(ctx context.Context, target *Target, id uint32, w io.Writer, timeout *uint64, opts WatchOptions) error {
+	return watchMerged(ctx, target, []protocol.SessionInfo{{ID: id}}, w, timeout, opts, false)
+}
+
+// watchMerged watches sessions concurrently and writes their output to w a
+// line at a time, prefixed with each session's label when prefix is set.
+func watchMerged(ctx context.Context, target *Target, sessions []protocol.SessionInfo, w io.Writer, timeout *uint64, opts WatchOptions, prefix bool) error {
+	var since time.Time
+	if opts.Since > 0 {
+		since = time.Now().Add(-opts.Since)
+	}
+
+	// 2. For each session, spawn a goroutine to watch it.
+	merged := make(chan watchLine, len(sessions)*64)
 	var wg sync.WaitGroup
 
-	for idx, s := range matched {
+	for idx, s := range sessions {
 		wg.Add(1)
 		label := s.Name
 		if label == "" {
 			label = fmt.Sprintf("%d", s.ID)
 		}
-		color := watchColors[idx%len(watchColors)]
+		color := ""
+		if !opts.NoColor {
+			color = watchColors[idx%len(watchColors)]
+		}
 		sessionID := s.ID
 
 		go func() {
 			defer wg.Done()
-			watchSingleToChannel(target, sessionID, label, color, merged)
+			watchSingleToChannel(ctx, target, sessionID, label, color, since, opts, merged)
 		}()
 	}
 
@@ -820,7 +1568,12 @@ func WatchMultiByTag(target *Target, tag string, w io.Writer, timeout *uint64) e
 	timer := time.NewTimer(timeoutDuration)
 	defer timer.Stop()
 
-	// 4. Drain merged channel, write prefixed output to w.
+	idle := time.NewTicker(watchIdleFlush)
+	defer idle.Stop()
+
+	// 4. Drain merged channel, write prefixed lines to w.
+	p := &watchPrinter{w: w, opts: opts, prefix: prefix, pending: make(map[string]*pendingLine)}
+	defer p.flushAll()
 	for {
 		select {
 		case line, ok := <-merged:
@@ -828,45 +1581,148 @@ func WatchMultiByTag(target *Target, tag string, w io.Writer, timeout *uint64) e
 				return nil // all watchers done
 			}
 			if line.err != nil {
-				fmt.Fprintf(w, "%s[%s]%s error: %v\n", line.label, line.label, colorReset, line.err)
+				p.flush(line.label)
+				fmt.Fprintf(w, "%s[%s]%s error: %v\n", line.color, line.label, resetFor(line.color), line.err)
 				continue
 			}
-			if line.data != "" {
-				fmt.Fprintf(w, "%s[%s]%s %s", line.label, line.label, colorReset, line.data)
-			}
+			p.add(line)
+		case now := <-idle.C:
+			p.flushIdle(now)
+		case <-ctx.Done():
+			return ctx.Err()
 		case <-timer.C:
+			p.flushAll()
 			fmt.Fprintf(os.Stderr, "\n[cw] watch timeout reached\n")
 			return nil
 		}
 	}
 }
 
-// watchSingleToChannel connects to a single session's WatchSession stream
-// and sends output lines to the merged channel.
-func watchSingleToChannel(target *Target, sessionID uint32, label, color string, merged chan<- watchLine) {
-	reader, writer, err := target.Connect()
-	if err != nil {
-		merged <- watchLine{label: color, err: err}
+// watchPrinter splits each session's output into lines, holding a partial
+// line until it is completed, and prints lines that pass the filter.
+type watchPrinter struct {
+	w       io.Writer
+	opts    WatchOptions
+	prefix  bool
+	pending map[string]*pendingLine
+}
+
+type pendingLine struct {
+	color string
+	text  strings.Builder
+	at    time.Time // when the line's first byte was written
+	seen  time.Time // when the line was last extended
+}
+
+func (p *watchPrinter) add(line watchLine) {
+	pl, ok := p.pending[line.label]
+	if !ok {
+		pl = &pendingLine{color: line.color}
+		p.pending[line.label] = pl
+	}
+	data := line.data
+	for data != "" {
+		if pl.text.Len() == 0 {
+			pl.at = line.at
+		}
+		i := strings.IndexByte(data, '\n')
+		if i < 0 {
+			pl.text.WriteString(data)
+			pl.seen = time.Now()
+			return
+		}
+		pl.text.WriteString(data[:i])
+		p.emit(line.label, pl)
+		data = data[i+1:]
+	}
+}
+
+func (p *watchPrinter) flush(label string) {
+	if pl, ok := p.pending[label]; ok && pl.text.Len() > 0 {
+		p.emit(label, pl)
+	}
+}
+
+func (p *watchPrinter) flushIdle(now time.Time) {
+	for label, pl := range p.pending {
+		if pl.text.Len() > 0 && now.Sub(pl.seen) >= watchIdleFlush {
+			p.emit(label, pl)
+		}
+	}
+}
+
+func (p *watchPrinter) flushAll() {
+	for label := range p.pending {
+		p.flush(label)
+	}
+}
+
+// emit prints the pending line for label, if it matches, and resets it.
+func (p *watchPrinter) emit(label string, pl *pendingLine) {
+	text := strings.TrimSuffix(pl.text.String(), "\r")
+	pl.text.Reset()
+	if p.opts.Grep != nil && !p.opts.Grep.MatchString(ansiPattern.ReplaceAllString(text, "")) {
 		return
 	}
-	defer reader.Close()
-	defer writer.Close()
 
+	var b strings.Builder
+	if p.prefix {
+		fmt.Fprintf(&b, "%s[%s]%s ", pl.color, label, resetFor(pl.color))
+	}
+	if p.opts.Timestamps {
+		b.WriteString(pl.at.Local().Format("15:04:05.000") + " ")
+	}
+	b.WriteString(text)
+	b.WriteString("\n")
+	io.WriteString(p.w, b.String())
+}
+
+// watchSingleToChannel connects to a single session's WatchSession stream
+// and sends its output to the merged channel. History is limited to output
+// written since, if set; each chunk carries the time the node wrote it.
+func watchSingleToChannel(ctx context.Context, target *Target, sessionID uint32, label, color string, since time.Time, opts WatchOptions, merged chan<- watchLine) {
 	includeHistory := true
 	req := &protocol.Request{
 		Type:           "WatchSession",
 		ID:             &sessionID,
 		IncludeHistory: &includeHistory,
+		Timestamps:     opts.Timestamps,
+		Sanitize:       opts.Sanitize,
 	}
-	if err := writer.SendRequest(req); err != nil {
-		merged <- watchLine{label: color, err: err}
+	if !since.IsZero() {
+		req.Since = since.UTC().Format(time.RFC3339Nano)
+	}
+	reader, writer, err := openStream(ctx, target, req)
+	if err != nil {
+		merged <- watchLine{label: label, color: color, err: err}
 		return
 	}
+	defer func() {
+		reader.Close()
+		writer.Close()
+	}()
 
 	frameCh := make(chan frameEvent, 1)
 	go readFrames(reader, frameCh)
 
-	for fe := range frameCh {
+	for {
+		fe := <-frameCh
+		if (fe.err != nil || fe.frame == nil) && canResume(ctx, target) {
+			resumeOutput(req)
+			reader.Close()
+			writer.Close()
+			err := reconnect(ctx, func() (err error) {
+				reader, writer, err = openStream(ctx, target, req)
+				return err
+			})
+			if err != nil {
+				merged <- watchLine{label: label, color: color, err: err}
+				return
+			}
+			frameCh = make(chan frameEvent, 1)
+			go readFrames(reader, frameCh)
+			continue
+		}
 		if fe.err != nil {
 			return
 		}
@@ -882,14 +1738,24 @@ func watchSingleToChannel(target *Target, sessionID uint32, label, color string,
 		}
 		if resp.Type == "WatchUpdate" {
 			if resp.Output != nil && *resp.Output != "" {
-				merged <- watchLine{label: color, data: *resp.Output}
+				at, err := time.Parse(time.RFC3339Nano, resp.Timestamp)
+				if err != nil {
+					at = time.Now()
+				}
+				merged <- watchLine{label: label, color: color, data: *resp.Output, at: at}
+			}
+			if resp.Offset != nil {
+				req.Offset = resp.Offset
 			}
 			if resp.Done != nil && *resp.Done {
 				return
 			}
 		}
+		if resp.Type == "OutputDropped" {
+			merged <- watchLine{label: label, color: color, data: fmt.Sprintf("[cw] %d bytes of output dropped\n", resp.Dropped), at: time.Now()}
+		}
 		if resp.Type == "Error" {
-			merged <- watchLine{label: color, err: fmt.Errorf("%s", resp.Message)}
+			merged <- watchLine{label: label, color: color, err: fmt.Errorf("%s", resp.Message)}
 			return
 		}
 	}
@@ -900,8 +1766,8 @@ func watchSingleToChannel(target *Target, sessionID uint32, label, color string,
 // ---------------------------------------------------------------------------
 
 // GetStatus retrieves detailed status information for a single session.
-func GetStatus(target *Target, id uint32, jsonOutput bool) error {
-	resp, err := requestResponse(target, &protocol.Request{
+func GetStatus(ctx context.Context, target *Target, id uint32, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
 		Type: "GetStatus",
 		ID:   &id,
 	})
@@ -931,37 +1797,310 @@ func GetStatus(target *Target, id uint32, jsonOutput bool) error {
 	fmt.Printf("  Command:     %s\n", info.Prompt)
 	fmt.Printf("  Working Dir: %s\n", info.WorkingDir)
 	fmt.Printf("  Status:      %s\n", info.Status)
+	if info.Activity != "" {
+		fmt.Printf("  Activity:    %s\n", info.Activity)
+	}
+	if info.ExitReason != "" {
+		fmt.Printf("  Exit Reason: %s\n", info.ExitReason)
+	}
 	fmt.Printf("  Created:     %s\n", info.CreatedAt)
 	fmt.Printf("  Attached:    %v\n", info.Attached)
 	if info.PID != nil {
 		fmt.Printf("  PID:         %d\n", *info.PID)
 	}
+	if len(info.Labels) > 0 {
+		fmt.Printf("  Labels:      %s\n", formatLabels(info.Labels))
+	}
+	if info.Pool != "" {
+		fmt.Printf("  Pool:        %s\n", info.Pool)
+	}
+	if len(info.AcceptInputFrom) > 0 {
+		fmt.Printf("  Input From:  %s\n", strings.Join(info.AcceptInputFrom, ","))
+	}
+	if info.Adopted {
+		fmt.Printf("  Adopted:     yes (no terminal since the node restarted)\n")
+	}
+	if info.Worktree != "" {
+		fmt.Printf("  Worktree:    %s\n", info.Worktree)
+	}
+	if info.Backend != "" {
+		fmt.Printf("  Backend:     %s\n", describeBackend(info))
+	}
+	if info.Git != nil {
+		fmt.Printf("  Git:         %s\n", describeGit(info.Git))
+	}
+	if r := info.Resources; r != nil {
+		fmt.Printf("  Resources:   %s\n", describeResources(r.CPUPercent, r.RSSBytes, r.OpenFiles))
+		fmt.Printf("  Processes:\n")
+		depth := map[uint32]int{}
+		for _, p := range r.Processes {
+			d, ok := depth[p.PPID]
+			if ok {
+				d++
+			}
+			depth[p.PID] = d
+			command := p.Command
+			if len(command) > 60 {
+				command = command[:57] + "..."
+			}
+			fmt.Printf("    %s%-7d %s  (%s)\n", strings.Repeat("  ", d), p.PID, command, describeResources(p.CPUPercent, p.RSSBytes, p.OpenFiles))
+		}
+	}
+	if u := info.Usage; u != nil {
+		fmt.Printf("  Usage:       %s: %d input, %d output tokens, $%.2f\n", u.Agent, u.InputTokens, u.OutputTokens, u.CostUSD)
+	}
+	if info.AgentSessionID != "" {
+		fmt.Printf("  Claude:      %s\n", info.AgentSessionID)
+	}
+	if info.TranscriptPath != "" {
+		fmt.Printf("  Transcript:  %s\n", info.TranscriptPath)
+	}
 	if info.OutputSizeBytes != nil {
 		fmt.Printf("  Output Size: %d bytes\n", *info.OutputSizeBytes)
 	}
 	if resp.OutputSize != nil {
 		fmt.Printf("  Log Size:    %d bytes\n", *resp.OutputSize)
 	}
+	if sum := info.Summary; sum != nil {
+		fmt.Printf("  Summary:     %s\n", sum.At)
+		if sum.Summary != "" {
+			fmt.Printf("    %s\n", strings.ReplaceAll(sum.Summary, "\n", "\n    "))
+		}
+		for _, line := range sum.Errors {
+			fmt.Printf("    error: %s\n", line)
+		}
+	}
 	if info.LastOutputSnippet != nil {
 		fmt.Printf("  Last Output:\n%s\n", *info.LastOutputSnippet)
 	}
 	return nil
 }
 
+// Screen prints what session id's terminal shows now, as the node renders
+// it, with colors and styles if ansi is set.
+func Screen(ctx context.Context, target *Target, id uint32, ansi, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type: "Screen",
+		ID:   &id,
+		ANSI: ansi,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	if resp.Screen == nil {
+		return fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+
+	if jsonOutput {
+		return printJSON(resp.Screen)
+	}
+	for _, line := range resp.Screen.Lines {
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// DefaultRenderInterval is how often WatchScreen redraws a session's
+// screen while it writes output.
+const DefaultRenderInterval = time.Second
+
+// RenderOptions controls how WatchScreen prints a session's screen.
+type RenderOptions struct {
+	Interval time.Duration // least time between redraws (0 for DefaultRenderInterval)
+	ANSI     bool          // keep the screen's colors and styles
+	Redraw   bool          // clear the terminal before each screen, else separate them
+}
+
+// WatchScreen watches session id like WatchSession, but prints the screen
+// the node's terminal emulator renders from its output rather than the
+// output itself: once at the start, then at most once per interval while
+// the screen changes, and a last time when the session ends. Full-screen
+// programs, which redraw with cursor movement and the alternate screen,
+// read as they would on attaching.
+func WatchScreen(ctx context.Context, target *Target, id uint32, w io.Writer, timeout *uint64, opts RenderOptions) error {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultRenderInterval
+	}
+	var last []string
+	render := func() error {
+		resp, err := requestResponse(ctx, target, &protocol.Request{
+			Type: "Screen",
+			ID:   &id,
+			ANSI: opts.ANSI,
+		})
+		if err != nil {
+			return err
+		}
+		if resp.Type == "Error" {
+			return fmt.Errorf("%s", formatError(resp.Message))
+		}
+		if resp.Screen == nil {
+			return fmt.Errorf("unexpected response type: %s", resp.Type)
+		}
+		if last != nil && slices.Equal(resp.Screen.Lines, last) {
+			return nil
+		}
+		last = resp.Screen.Lines
+		if last == nil {
+			last = []string{}
+		}
+		var b strings.Builder
+		if opts.Redraw {
+			b.WriteString("\x1b[H\x1b[2J")
+		} else {
+			fmt.Fprintf(&b, "--- %s ---\n", time.Now().Format("15:04:05"))
+		}
+		for _, line := range last {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+		_, err = io.WriteString(w, b.String())
+		return err
+	}
+
+	noHistory := false
+	req := &protocol.Request{
+		Type:           "WatchSession",
+		ID:             &id,
+		IncludeHistory: &noHistory,
+	}
+	reader, writer, err := openStream(ctx, target, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		reader.Close()
+		writer.Close()
+	}()
+	if err := render(); err != nil {
+		return err
+	}
+
+	timeoutDuration := time.Duration(math.MaxInt64)
+	if timeout != nil {
+		timeoutDuration = time.Duration(*timeout) * time.Second
+	}
+	timer := time.NewTimer(timeoutDuration)
+	defer timer.Stop()
+	tick := time.NewTicker(opts.Interval)
+	defer tick.Stop()
+
+	frameCh := make(chan frameEvent, 1)
+	go readFrames(reader, frameCh)
+
+	changed := false
+	for {
+		select {
+		case fe := <-frameCh:
+			if (fe.err != nil || fe.frame == nil) && canResume(ctx, target) {
+				fmt.Fprintf(os.Stderr, "\n[cw] connection lost, reconnecting...\n")
+				reader.Close()
+				writer.Close()
+				err := reconnect(ctx, func() (err error) {
+					reader, writer, err = openStream(ctx, target, req)
+					return err
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "[cw] reconnected\n")
+				frameCh = make(chan frameEvent, 1)
+				go readFrames(reader, frameCh)
+				changed = true
+				continue
+			}
+			if fe.err != nil {
+				return fmt.Errorf("reading watch frame: %w", fe.err)
+			}
+			if fe.frame == nil {
+				return render()
+			}
+			if fe.frame.Type != protocol.FrameControl {
+				continue
+			}
+			var resp protocol.Response
+			if err := json.Unmarshal(fe.frame.Payload, &resp); err != nil {
+				return fmt.Errorf("parsing watch response: %w", err)
+			}
+			switch resp.Type {
+			case "WatchUpdate":
+				if resp.Output != nil && *resp.Output != "" {
+					changed = true
+				}
+				if resp.Done != nil && *resp.Done {
+					return render()
+				}
+			case "Error":
+				return fmt.Errorf("%s", formatError(resp.Message))
+			}
+
+		case <-tick.C:
+			if changed {
+				changed = false
+				if err := render(); err != nil {
+					return err
+				}
+			}
+
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-timer.C:
+			fmt.Fprintf(os.Stderr, "\n[cw] watch timeout reached\n")
+			return nil
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Helpers
 // ---------------------------------------------------------------------------
 
+// describeResources formats CPU, memory and (when counted) open files.
+func describeResources(cpu float64, rss uint64, files int) string {
+	s := fmt.Sprintf("CPU %.1f%%, RSS %s", cpu, formatByteSize(int64(rss)))
+	if files > 0 {
+		s += fmt.Sprintf(", %d open files", files)
+	}
+	return s
+}
+
 // printSessionTable prints a formatted table of sessions.
-func printSessionTable(sessions []protocol.SessionInfo) {
+func printSessionTable(sessions []protocol.SessionInfo, wide bool) {
 	// Column headers.
-	fmt.Printf("%-4s %-14s %-32s %-10s %-8s\n", "ID", "NAME", "COMMAND", "STATUS", "AGE")
+	if wide {
+		fmt.Printf("%-4s %-20s %-48s %-14s %-8s %-7s %-24s %-24s %-20s %s\n", "ID", "NAME", "COMMAND", "STATUS", "AGE", "PID", "TAGS", "LABELS", "GIT", "WORKDIR")
+	} else {
+		fmt.Printf("%-4s %-14s %-32s %-10s %-8s %s\n", "ID", "NAME", "COMMAND", "STATUS", "AGE", "TAGS")
+	}
 
 	for _, s := range sessions {
 		name := s.Name
 		if name == "" {
 			name = "-"
 		}
+		tags := strings.Join(s.Tags, ",")
+		if tags == "" {
+			tags = "-"
+		}
+		age := formatRelativeTime(s.CreatedAt)
+
+		if wide {
+			pid := "-"
+			if s.PID != nil {
+				pid = fmt.Sprintf("%d", *s.PID)
+			}
+			labels := formatLabels(s.Labels)
+			if labels == "" {
+				labels = "-"
+			}
+			fmt.Printf("%-4d %-20s %-48s %-14s %-8s %-7s %-24s %-24s %-20s %s\n", s.ID, name, s.Prompt, s.Status, age, pid, tags, labels, formatGit(s.Git), s.WorkingDir)
+			continue
+		}
+
 		if len(name) > 14 {
 			name = name[:11] + "..."
 		}
@@ -969,45 +2108,214 @@ func printSessionTable(sessions []protocol.SessionInfo) {
 		if len(prompt) > 32 {
 			prompt = prompt[:29] + "..."
 		}
-		age := formatRelativeTime(s.CreatedAt)
-		fmt.Printf("%-4d %-14s %-32s %-10s %-8s\n", s.ID, name, prompt, s.Status, age)
+		if len(tags) > 24 {
+			tags = tags[:21] + "..."
+		}
+		fmt.Printf("%-4d %-14s %-32s %-10s %-8s %s\n", s.ID, name, prompt, s.Status, age, tags)
+	}
+}
+
+// formatLabels joins labels as sorted key=value pairs.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// formatGit is the compact git column of cw list --wide: the branch (or
+// commit, when detached), * when dirty, and commits ahead and behind the
+// upstream, e.g. "main* +2 -1".
+func formatGit(g *protocol.GitInfo) string {
+	if g == nil {
+		return "-"
+	}
+	out := g.Branch
+	if out == "" {
+		out = g.Commit
+	}
+	if g.Dirty {
+		out += "*"
+	}
+	if g.Ahead > 0 {
+		out += fmt.Sprintf(" +%d", g.Ahead)
+	}
+	if g.Behind > 0 {
+		out += fmt.Sprintf(" -%d", g.Behind)
+	}
+	return out
+}
+
+// describeGit spells out git state for cw status.
+func describeGit(g *protocol.GitInfo) string {
+	head := g.Branch
+	if head == "" {
+		head = "detached at " + g.Commit
+	} else if g.Commit != "" {
+		head += " (" + g.Commit + ")"
+	}
+	parts := []string{head}
+	switch {
+	case g.Changed == 1:
+		parts = append(parts, "1 uncommitted file")
+	case g.Changed > 1:
+		parts = append(parts, fmt.Sprintf("%d uncommitted files", g.Changed))
+	default:
+		parts = append(parts, "clean")
+	}
+	if g.Upstream != "" {
+		parts = append(parts, fmt.Sprintf("%d ahead, %d behind %s", g.Ahead, g.Behind, g.Upstream))
 	}
+	return strings.Join(parts, ", ")
 }
 
 // ---------------------------------------------------------------------------
 // Nodes (relay discovery)
 // ---------------------------------------------------------------------------
 
+// NodesOptions controls cw nodes.
+type NodesOptions struct {
+	JSON bool
+	Wide bool // add the load, memory and disk each node last reported
+	// Filter keeps the nodes matching a selector (see protocol.ParseSelector)
+	// over name, connected, version, os, arch and tag, which matches any of
+	// a node's tags.
+	Filter string
+}
+
+// nodeFilterKeys are the keys a cw nodes filter may use.
+var nodeFilterKeys = []string{"name", "connected", "version", "os", "arch", "tag"}
+
 // Nodes fetches the list of registered nodes from a relay URL and prints them.
-func Nodes(relayURL string) error {
-	resp, err := fetchJSON(relayURL + "/api/v1/nodes")
+func Nodes(relayURL string, opts NodesOptions) error {
+	sel, err := protocol.ParseSelector(opts.Filter)
 	if err != nil {
 		return err
 	}
+	for _, r := range sel {
+		if !slices.Contains(nodeFilterKeys, r.Key) {
+			return fmt.Errorf("invalid filter key %q (use one of %s)", r.Key, strings.Join(nodeFilterKeys, ", "))
+		}
+	}
 
-	var nodes []struct {
-		Name      string `json:"name"`
-		TunnelURL string `json:"tunnel_url"`
-		Connected bool   `json:"connected"`
+	resp, err := fetchJSON(relayURL + "/api/v1/nodes")
+	if err != nil {
+		return err
 	}
-	if err := json.Unmarshal(resp, &nodes); err != nil {
+
+	var all []NodeInfo
+	if err := json.Unmarshal(resp, &all); err != nil {
 		return fmt.Errorf("parsing nodes: %w", err)
 	}
+	nodes := []NodeInfo{}
+	for _, n := range all {
+		if nodeMatches(n, sel) {
+			nodes = append(nodes, n)
+		}
+	}
+
+	if opts.JSON {
+		return printJSON(nodes)
+	}
 
 	if len(nodes) == 0 {
-		fmt.Println("No registered nodes")
+		if opts.Filter != "" {
+			fmt.Println("No matching nodes")
+		} else {
+			fmt.Println("No registered nodes")
+		}
 		return nil
 	}
 
-	fmt.Printf("%-20s %-40s %-10s\n", "NAME", "TUNNEL URL", "STATUS")
+	if opts.Wide {
+		fmt.Printf("%-20s %-8s %-9s %-9s %-10s %-13s %-5s %-6s %-21s %-10s %s\n", "NAME", "STATUS", "LAST SEEN", "SESSIONS", "VERSION", "PLATFORM", "CPUS", "LOAD", "MEMORY (AVAIL/TOTAL)", "DISK FREE", "TAGS")
+	} else {
+		fmt.Printf("%-20s %-8s %-9s %-9s %-10s %-13s %s\n", "NAME", "STATUS", "LAST SEEN", "SESSIONS", "VERSION", "PLATFORM", "TAGS")
+	}
 	for _, n := range nodes {
-		status := "offline"
-		if n.Connected {
-			status = "online"
+		printNodeRow(n, opts.Wide)
+	}
+	return nil
+}
+
+// nodeMatches reports whether n satisfies every requirement of sel. A tag
+// requirement holds if it holds for any of the node's tags.
+func nodeMatches(n NodeInfo, sel protocol.Selector) bool {
+	st := n.Status
+	if st == nil {
+		st = &relay.NodeStatus{}
+	}
+	fields := map[string]string{"name": n.Name, "connected": strconv.FormatBool(n.Connected)}
+	for key, value := range map[string]string{"version": st.Version, "os": st.OS, "arch": st.Arch} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	for _, r := range sel {
+		if r.Key != "tag" {
+			if !(protocol.Selector{r}).Matches(fields) {
+				return false
+			}
+			continue
+		}
+		has := len(st.Tags) > 0
+		if r.Op == protocol.SelectorEquals || r.Op == protocol.SelectorNotEquals {
+			has = slices.Contains(st.Tags, r.Value)
+		}
+		if has != (r.Op == protocol.SelectorEquals || r.Op == protocol.SelectorExists) {
+			return false
+		}
+	}
+	return true
+}
+
+// printNodeRow prints a node of cw nodes. Readings the node did not report
+// are shown as "-".
+func printNodeRow(n NodeInfo, wide bool) {
+	status := "offline"
+	if n.Connected {
+		status = "online"
+	}
+	seen := "-"
+	if !n.LastSeenAt.IsZero() {
+		seen = formatRelativeTime(n.LastSeenAt.Format(time.RFC3339))
+	}
+	sessions, version, platform, tags := "-", "-", "-", "-"
+	cpus, load, mem, disk := "-", "-", "-", "-"
+	if st := n.Status; st != nil {
+		sessions = fmt.Sprintf("%d", st.Sessions)
+		if st.MaxSessions > 0 {
+			sessions = fmt.Sprintf("%d/%d", st.Sessions, st.MaxSessions)
+		}
+		if st.Version != "" {
+			version = st.Version
+		}
+		if st.OS != "" {
+			platform = st.OS + "/" + st.Arch
+		}
+		if len(st.Tags) > 0 {
+			tags = strings.Join(st.Tags, ",")
+		}
+		if st.CPUs > 0 {
+			cpus = fmt.Sprintf("%d", st.CPUs)
+		}
+		if st.LoadAvg > 0 {
+			load = fmt.Sprintf("%.2f", st.LoadAvg)
+		}
+		if st.MemTotal > 0 {
+			mem = formatByteSize(int64(st.MemAvailable)) + "/" + formatByteSize(int64(st.MemTotal))
+		}
+		if st.DiskFree > 0 {
+			disk = formatByteSize(int64(st.DiskFree))
 		}
-		fmt.Printf("%-20s %-40s %-10s\n", n.Name, n.TunnelURL, status)
 	}
-	return nil
+	if wide {
+		fmt.Printf("%-20s %-8s %-9s %-9s %-10s %-13s %-5s %-6s %-21s %-10s %s\n", n.Name, status, seen, sessions, version, platform, cpus, load, mem, disk, tags)
+		return
+	}
+	fmt.Printf("%-20s %-8s %-9s %-9s %-10s %-13s %s\n", n.Name, status, seen, sessions, version, platform, tags)
 }
 
 func fetchJSON(url string) ([]byte, error) {
@@ -1029,26 +2337,50 @@ func fetchJSON(url string) ([]byte, error) {
 // ---------------------------------------------------------------------------
 
 // SubscribeEvents subscribes to session events and prints them as they arrive.
-func SubscribeEvents(target *Target, sessionID *uint32, tags []string, eventTypes []string) error {
-	reader, writer, err := target.Connect()
-	if err != nil {
-		return err
-	}
-	defer reader.Close()
-	defer writer.Close()
-
+// With ndjson, each event is printed as a StreamEvent on its own line.
+// selector, if set, filters sessions by label, and filter events by a filter
+// expression (see protocol.ParseFilter). With since or fromSeq, the node
+// first replays the events it journaled from then on. A subscription to a
+// remote node that loses the connection reconnects and resumes after the
+// last event received.
+func SubscribeEvents(ctx context.Context, target *Target, sessionID *uint32, tags []string, selector, filter string, eventTypes []string, since time.Duration, fromSeq *uint64, ndjson bool) error {
 	req := &protocol.Request{
 		Type:       "Subscribe",
 		ID:         sessionID,
 		Tags:       tags,
+		Selector:   selector,
 		EventTypes: eventTypes,
+		Filter:     filter,
+		FromSeq:    fromSeq,
 	}
-	if err := writer.SendRequest(req); err != nil {
+	if since > 0 {
+		req.Since = time.Now().Add(-since).UTC().Format(time.RFC3339Nano)
+	}
+	reader, writer, err := openStream(ctx, target, req)
+	if err != nil {
 		return err
 	}
+	defer func() {
+		reader.Close()
+		writer.Close()
+	}()
 
 	for {
 		frame, err := reader.ReadFrame()
+		if (err != nil || frame == nil) && canResume(ctx, target) {
+			// Subscriptions only end when the connection does.
+			fmt.Fprintf(os.Stderr, "[cw] connection lost, reconnecting...\n")
+			reader.Close()
+			writer.Close()
+			err := reconnect(ctx, func() (err error) {
+				reader, writer, err = openStream(ctx, target, req)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		if err != nil {
 			return err
 		}
@@ -1068,7 +2400,17 @@ func SubscribeEvents(target *Target, sessionID *uint32, tags []string, eventType
 		case "SubscribeAck":
 			fmt.Fprintf(os.Stderr, "[cw] subscribed (id=%d)\n", *resp.SubscriptionID)
 		case "Event":
-			if resp.Event != nil && resp.SessionID != nil {
+			if resp.Event == nil || resp.SessionID == nil {
+				continue
+			}
+			if resp.Event.Seq > 0 {
+				// Resume after this event, journaled or not.
+				next := resp.Event.Seq + 1
+				req.FromSeq, req.Since = &next, ""
+			}
+			if ndjson {
+				printStreamEvent(&resp)
+			} else {
 				data, _ := json.Marshal(resp.Event)
 				fmt.Printf("[session %d] %s\n", *resp.SessionID, string(data))
 			}
@@ -1084,9 +2426,24 @@ func SubscribeEvents(target *Target, sessionID *uint32, tags []string, eventType
 // WaitForSession
 // ---------------------------------------------------------------------------
 
-// WaitForSession blocks until the target session(s) complete.
-func WaitForSession(target *Target, sessionID *uint32, tags []string, condition string, timeout *uint64) error {
-	reader, writer, err := target.Connect()
+// WaitOptions configures WaitForSession.
+type WaitOptions struct {
+	Condition   string  // all (default), any, success or any-failure
+	UntilOutput string  // wait for a matching line of output instead (optional)
+	Selector    string  // also, or instead of tags, sessions whose labels match
+	Timeout     *uint64 // seconds; nil waits for a day
+	// ExitCode exits the process with the waited-for session's exit code,
+	// or 1 if any of several failed, instead of checking Condition.
+	ExitCode bool
+	// JSON prints a WaitResult instead of the sessions' final output.
+	JSON bool
+}
+
+// WaitForSession blocks until the target session(s) meet opts.Condition, or a
+// line of their output matches opts.UntilOutput if it is set. It fails if the
+// sessions finish without meeting it.
+func WaitForSession(ctx context.Context, target *Target, sessionID *uint32, tags []string, opts WaitOptions) error {
+	reader, writer, err := target.Connect(ctx)
 	if err != nil {
 		return err
 	}
@@ -1097,8 +2454,10 @@ func WaitForSession(target *Target, sessionID *uint32, tags []string, condition
 		Type:           "Wait",
 		ID:             sessionID,
 		Tags:           tags,
-		Condition:      condition,
-		TimeoutSeconds: timeout,
+		Selector:       opts.Selector,
+		Condition:      opts.Condition,
+		TimeoutSeconds: opts.Timeout,
+		UntilOutput:    opts.UntilOutput,
 	}
 	if err := writer.SendRequest(req); err != nil {
 		return err
@@ -1123,12 +2482,47 @@ func WaitForSession(target *Target, sessionID *uint32, tags []string, condition
 
 		switch resp.Type {
 		case "WaitResult":
+			var sessions []protocol.SessionInfo
 			if resp.Sessions != nil {
-				for _, s := range *resp.Sessions {
+				sessions = *resp.Sessions
+			}
+			// Nodes predating Met only answer once the condition is met.
+			met := resp.Met == nil || *resp.Met
+			if opts.UntilOutput != "" {
+				met = resp.Met != nil && *resp.Met && resp.SessionID != nil && resp.Output != nil
+			}
+
+			if opts.JSON {
+				result := WaitResult{
+					UntilOutput: opts.UntilOutput,
+					Met:         met,
+					ExitCode:    WaitExitCode(sessions),
+					Sessions:    sessions,
+				}
+				if opts.UntilOutput == "" {
+					result.Condition = cmp.Or(opts.Condition, "all")
+				} else if met {
+					result.SessionID, result.Output = resp.SessionID, *resp.Output
+				}
+				if result.Sessions == nil {
+					result.Sessions = []protocol.SessionInfo{}
+				}
+				if err := printJSON(result); err != nil {
+					return err
+				}
+			} else if opts.UntilOutput != "" {
+				if met {
+					fmt.Printf("session %d: %s\n", *resp.SessionID, *resp.Output)
+				}
+			} else {
+				for _, s := range sessions {
 					exitStr := "n/a"
 					if s.ExitCode != nil {
 						exitStr = fmt.Sprintf("%d", *s.ExitCode)
 					}
+					if s.ExitReason != "" {
+						exitStr += ", " + s.ExitReason
+					}
 					name := s.Name
 					if name == "" {
 						name = fmt.Sprintf("%d", s.ID)
@@ -1140,6 +2534,20 @@ func WaitForSession(target *Target, sessionID *uint32, tags []string, condition
 					fmt.Println()
 				}
 			}
+
+			switch {
+			case opts.UntilOutput != "" && !met:
+				return fmt.Errorf("session(s) finished without output matching %q", opts.UntilOutput)
+			case opts.UntilOutput != "":
+				return nil
+			case opts.ExitCode:
+				if code := WaitExitCode(sessions); code != 0 {
+					os.Exit(code)
+				}
+				return nil
+			case !met:
+				return fmt.Errorf("wait condition %q not met", opts.Condition)
+			}
 			return nil
 		case "Error":
 			return fmt.Errorf("%s", resp.Message)
@@ -1147,13 +2555,40 @@ func WaitForSession(target *Target, sessionID *uint32, tags []string, condition
 	}
 }
 
+// WaitExitCode is the exit status for cw wait --exit-code: a lone session's
+// exit code, or 1 if any of several sessions failed. Killed sessions, and
+// codes a process cannot exit with, count as 1.
+func WaitExitCode(sessions []protocol.SessionInfo) int {
+	failed := 0
+	for _, s := range sessions {
+		if !strings.HasPrefix(s.Status, "completed") && s.Status != "killed" {
+			continue
+		}
+		code := 1
+		if s.ExitCode != nil && s.Status != "killed" && *s.ExitCode >= 0 && *s.ExitCode <= 255 {
+			code = *s.ExitCode
+		}
+		if code == 0 {
+			continue
+		}
+		if len(sessions) == 1 {
+			return code
+		}
+		failed++
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
 // ---------------------------------------------------------------------------
 // KV commands
 // ---------------------------------------------------------------------------
 
 // KVSet sets a key-value pair via the node (which proxies to the relay).
-func KVSet(target *Target, namespace, key, value, ttl string) error {
-	resp, err := requestResponse(target, &protocol.Request{
+func KVSet(ctx context.Context, target *Target, namespace, key, value, ttl string) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
 		Type:      "KVSet",
 		Namespace: namespace,
 		Key:       key,
@@ -1170,9 +2605,79 @@ func KVSet(target *Target, namespace, key, value, ttl string) error {
 	return nil
 }
 
+// ResolveSecrets looks up --secret specs (see secrets.ParseSpec), returning
+// KEY=VALUE pairs for RunOptions.Secrets. kv:// references are read through
+// target and opened with the key in dataDir.
+func ResolveSecrets(ctx context.Context, target *Target, dataDir string, specs []string) ([]string, error) {
+	parsed := make([]secrets.Spec, 0, len(specs))
+	for _, arg := range specs {
+		s, err := secrets.ParseSpec(arg)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, s)
+	}
+	r := secrets.NewResolver()
+	r.Register("kv", secrets.KV{DataDir: dataDir, Get: func(namespace, key string) ([]byte, bool, error) {
+		return kvValue(ctx, target, namespace, key)
+	}})
+	return r.Resolve(parsed)
+}
+
+// SecretSet seals value with the key in dataDir, creating the key if needed,
+// and stores it in the relay's KV store at ref, kv://<namespace>/<key>.
+func SecretSet(ctx context.Context, target *Target, dataDir, ref, value string) error {
+	s, err := secrets.ParseSpec("_@" + ref)
+	if err != nil || s.Scheme != "kv" {
+		return fmt.Errorf("secret reference must be kv://<namespace>/<key>, got %q", ref)
+	}
+	namespace, key, ok := strings.Cut(s.Ref, "/")
+	if !ok || namespace == "" || key == "" {
+		return fmt.Errorf("secret reference must be kv://<namespace>/<key>, got %q", ref)
+	}
+	sealKey, err := secrets.LoadKey(dataDir, true)
+	if err != nil {
+		return err
+	}
+	sealed, err := secrets.Seal(sealKey, value)
+	if err != nil {
+		return err
+	}
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type:      "KVSet",
+		Namespace: namespace,
+		Key:       key,
+		Value:     []byte(sealed),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	fmt.Fprintf(os.Stderr, "Sealed %s/%s\n", namespace, key)
+	return nil
+}
+
+// kvValue fetches a value by key via the node.
+func kvValue(ctx context.Context, target *Target, namespace, key string) ([]byte, bool, error) {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type:      "KVGet",
+		Namespace: namespace,
+		Key:       key,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.Type == "Error" {
+		return nil, false, fmt.Errorf("%s", resp.Message)
+	}
+	return resp.Value, resp.Value != nil, nil
+}
+
 // KVGet retrieves a value by key via the node.
-func KVGet(target *Target, namespace, key string) error {
-	resp, err := requestResponse(target, &protocol.Request{
+func KVGet(ctx context.Context, target *Target, namespace, key string, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
 		Type:      "KVGet",
 		Namespace: namespace,
 		Key:       key,
@@ -1183,6 +2688,14 @@ func KVGet(target *Target, namespace, key string) error {
 	if resp.Type == "Error" {
 		return fmt.Errorf("%s", resp.Message)
 	}
+	if jsonOutput {
+		entry := KVEntry{Namespace: namespace, Key: key}
+		if resp.Value != nil {
+			value := string(resp.Value)
+			entry.Value = &value
+		}
+		return printJSON(entry)
+	}
 	if resp.Value == nil {
 		fmt.Println("(not found)")
 		return nil
@@ -1192,8 +2705,8 @@ func KVGet(target *Target, namespace, key string) error {
 }
 
 // KVList lists keys by prefix via the node.
-func KVList(target *Target, namespace, prefix string) error {
-	resp, err := requestResponse(target, &protocol.Request{
+func KVList(ctx context.Context, target *Target, namespace, prefix string, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
 		Type:      "KVList",
 		Namespace: namespace,
 		Key:       prefix,
@@ -1204,6 +2717,16 @@ func KVList(target *Target, namespace, prefix string) error {
 	if resp.Type == "Error" {
 		return fmt.Errorf("%s", resp.Message)
 	}
+	if jsonOutput {
+		entries := []KVEntry{}
+		if resp.Entries != nil {
+			for _, e := range *resp.Entries {
+				value := string(e.Value)
+				entries = append(entries, KVEntry{Namespace: namespace, Key: e.Key, Value: &value, ExpiresAt: e.ExpiresAt})
+			}
+		}
+		return printJSON(entries)
+	}
 	if resp.Entries == nil || len(*resp.Entries) == 0 {
 		fmt.Println("No keys found")
 		return nil
@@ -1215,8 +2738,8 @@ func KVList(target *Target, namespace, prefix string) error {
 }
 
 // KVDelete deletes a key via the node.
-func KVDelete(target *Target, namespace, key string) error {
-	resp, err := requestResponse(target, &protocol.Request{
+func KVDelete(ctx context.Context, target *Target, namespace, key string) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
 		Type:      "KVDelete",
 		Namespace: namespace,
 		Key:       key,
@@ -1236,8 +2759,8 @@ func KVDelete(target *Target, namespace, key string) error {
 // ---------------------------------------------------------------------------
 
 // Msg sends a direct message to a session.
-func Msg(target *Target, fromID *uint32, toID uint32, body string, delivery string) error {
-	resp, err := requestResponse(target, &protocol.Request{
+func Msg(ctx context.Context, target *Target, fromID *uint32, toID uint32, body string, delivery string, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
 		Type:     "MsgSend",
 		ID:       fromID,
 		ToID:     &toID,
@@ -1250,6 +2773,9 @@ func Msg(target *Target, fromID *uint32, toID uint32, body string, delivery stri
 	if resp.Type == "Error" {
 		return fmt.Errorf("%s", formatError(resp.Message))
 	}
+	if jsonOutput {
+		return printJSON(MessageResult{MessageID: resp.MessageID})
+	}
 	fmt.Fprintf(os.Stderr, "Message sent: %s\n", resp.MessageID)
 	return nil
 }
@@ -1259,9 +2785,9 @@ func Msg(target *Target, fromID *uint32, toID uint32, body string, delivery stri
 // ---------------------------------------------------------------------------
 
 // Inbox reads and displays messages for a session.
-func Inbox(target *Target, sessionID uint32, tail int) error {
+func Inbox(ctx context.Context, target *Target, sessionID uint32, tail int, jsonOutput bool) error {
 	t := uint(tail)
-	resp, err := requestResponse(target, &protocol.Request{
+	resp, err := requestResponse(ctx, target, &protocol.Request{
 		Type: "MsgRead",
 		ID:   &sessionID,
 		Tail: &t,
@@ -1272,12 +2798,13 @@ func Inbox(target *Target, sessionID uint32, tail int) error {
 	if resp.Type == "Error" {
 		return fmt.Errorf("%s", formatError(resp.Message))
 	}
-	if resp.Messages == nil {
-		fmt.Println("No messages")
-		return nil
+	messages := []protocol.MessageResponse{}
+	if resp.Messages != nil {
+		messages = *resp.Messages
+	}
+	if jsonOutput {
+		return printJSON(messages)
 	}
-
-	messages := *resp.Messages
 	if len(messages) == 0 {
 		fmt.Println("No messages")
 		return nil
@@ -1310,9 +2837,10 @@ func Inbox(target *Target, sessionID uint32, tail int) error {
 // ---------------------------------------------------------------------------
 
 // Request sends a request to a session and blocks until a reply arrives.
-// When rawOutput is true, only the reply body is printed (no "[reply from X]" prefix).
-func Request(target *Target, fromID *uint32, toID uint32, body string, timeout uint64, rawOutput bool, delivery string) error {
-	reader, writer, err := target.Connect()
+// When rawOutput is true, only the reply body is printed (no "[reply from X]" prefix),
+// and with jsonOutput, a ReplyResult.
+func Request(ctx context.Context, target *Target, fromID *uint32, toID uint32, body string, timeout uint64, rawOutput bool, delivery string, jsonOutput bool) error {
+	reader, writer, err := target.Connect(ctx)
 	if err != nil {
 		return err
 	}
@@ -1350,6 +2878,14 @@ func Request(target *Target, fromID *uint32, toID uint32, body string, timeout u
 
 	switch resp.Type {
 	case "MsgRequestResult":
+		if jsonOutput {
+			return printJSON(ReplyResult{
+				RequestID: resp.RequestID,
+				FromID:    resp.FromID,
+				FromName:  resp.FromName,
+				Body:      resp.ReplyBody,
+			})
+		}
 		if rawOutput {
 			fmt.Println(resp.ReplyBody)
 		} else {
@@ -1375,8 +2911,8 @@ func Request(target *Target, fromID *uint32, toID uint32, body string, timeout u
 // ---------------------------------------------------------------------------
 
 // Reply sends a reply to a pending request.
-func Reply(target *Target, fromID *uint32, requestID string, body string) error {
-	resp, err := requestResponse(target, &protocol.Request{
+func Reply(ctx context.Context, target *Target, fromID *uint32, requestID string, body string, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
 		Type:      "MsgReply",
 		ID:        fromID,
 		RequestID: requestID,
@@ -1388,6 +2924,9 @@ func Reply(target *Target, fromID *uint32, requestID string, body string) error
 	if resp.Type == "Error" {
 		return fmt.Errorf("%s", formatError(resp.Message))
 	}
+	if jsonOutput {
+		return printJSON(MessageResult{RequestID: requestID})
+	}
 	fmt.Fprintf(os.Stderr, "Reply sent for request %s\n", requestID)
 	return nil
 }
@@ -1396,9 +2935,10 @@ func Reply(target *Target, fromID *uint32, requestID string, body string) error
 // Listen — stream message traffic
 // ---------------------------------------------------------------------------
 
-// Listen streams all message traffic on the node in real-time.
-func Listen(target *Target, sessionID *uint32) error {
-	reader, writer, err := target.Connect()
+// Listen streams all message traffic on the node in real-time. With ndjson,
+// each message event is printed as a StreamEvent on its own line.
+func Listen(ctx context.Context, target *Target, sessionID *uint32, ndjson bool) error {
+	reader, writer, err := target.Connect(ctx)
 	if err != nil {
 		return err
 	}
@@ -1434,7 +2974,9 @@ func Listen(target *Target, sessionID *uint32) error {
 		case "MsgListenAck":
 			fmt.Fprintf(os.Stderr, "[cw] listening for messages...\n")
 		case "Event":
-			if resp.Event != nil {
+			if resp.Event != nil && resp.SessionID != nil && ndjson {
+				printStreamEvent(&resp)
+			} else if resp.Event != nil {
 				printMessageEvent(resp.SessionID, resp.Event)
 			}
 		case "Error":
@@ -1504,6 +3046,34 @@ func printMessageEvent(sessionID *uint32, event *protocol.SessionEvent) {
 			fromLabel = d.FromName
 		}
 		fmt.Printf("[%s] REPLY (%s): %s\n", fromLabel, d.RequestID, d.Body)
+
+	case "message.rate_limited":
+		var d struct {
+			Kind     string `json:"kind"`
+			Reason   string `json:"reason"`
+			From     uint32 `json:"from"`
+			FromName string `json:"from_name"`
+			To       uint32 `json:"to"`
+			ToName   string `json:"to_name"`
+			Limit    int    `json:"limit"`
+			Size     int    `json:"size"`
+		}
+		if json.Unmarshal(event.Data, &d) != nil {
+			return
+		}
+		fromLabel := fmt.Sprintf("%d", d.From)
+		if d.FromName != "" {
+			fromLabel = d.FromName
+		}
+		toLabel := fmt.Sprintf("%d", d.To)
+		if d.ToName != "" {
+			toLabel = d.ToName
+		}
+		if d.Reason == "size" {
+			fmt.Printf("[%s → %s] REFUSED %s: %d bytes, over the limit of %d\n", fromLabel, toLabel, d.Kind, d.Size, d.Limit)
+		} else {
+			fmt.Printf("[%s → %s] RATE LIMITED: more than %d messages a minute\n", fromLabel, toLabel, d.Limit)
+		}
 	}
 }
 
@@ -1512,15 +3082,31 @@ func printMessageEvent(sessionID *uint32, event *protocol.SessionEvent) {
 // ---------------------------------------------------------------------------
 
 // Invite creates an invite code on the relay and optionally prints a QR code.
-func Invite(dataDir string, uses int, ttl string, showQR bool) error {
+// InviteOptions describes the invite Invite creates and the identity it
+// gives the device that joins with it.
+type InviteOptions struct {
+	Uses             int
+	TTL              string
+	Name             string   // node name the device gets, instead of its own
+	Tags             []string // node tags the relay keeps for the device
+	Scope            string   // "node" (default) or "client"
+	ExpiresAfterJoin bool     // delete the invite once a device has joined
+	QR               bool
+}
+
+func Invite(dataDir string, opts InviteOptions) error {
 	relayURL, authToken, err := loadRelayAuth(dataDir)
 	if err != nil {
 		return err
 	}
 
 	reqBody, _ := json.Marshal(map[string]interface{}{
-		"uses": uses,
-		"ttl":  ttl,
+		"uses":               opts.Uses,
+		"ttl":                opts.TTL,
+		"name":               opts.Name,
+		"tags":               opts.Tags,
+		"scope":              opts.Scope,
+		"expires_after_join": opts.ExpiresAfterJoin,
 	})
 
 	req, err := http.NewRequest(http.MethodPost, relayURL+"/api/v1/invites", strings.NewReader(string(reqBody)))
@@ -1545,6 +3131,9 @@ func Invite(dataDir string, uses int, ttl string, showQR bool) error {
 		Token         string    `json:"token"`
 		UsesRemaining int       `json:"uses_remaining"`
 		ExpiresAt     time.Time `json:"expires_at"`
+		Name          string    `json:"name"`
+		Tags          []string  `json:"tags"`
+		Scope         string    `json:"scope"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&invite); err != nil {
 		return fmt.Errorf("parsing response: %w", err)
@@ -1556,11 +3145,20 @@ func Invite(dataDir string, uses int, ttl string, showQR bool) error {
 	fmt.Fprintf(os.Stderr, "  Token:   %s\n", invite.Token)
 	fmt.Fprintf(os.Stderr, "  Uses:    %d\n", invite.UsesRemaining)
 	fmt.Fprintf(os.Stderr, "  Expires: %s\n", invite.ExpiresAt.Format(time.RFC3339))
+	if invite.Name != "" {
+		fmt.Fprintf(os.Stderr, "  Name:    %s\n", invite.Name)
+	}
+	if len(invite.Tags) > 0 {
+		fmt.Fprintf(os.Stderr, "  Tags:    %s\n", strings.Join(invite.Tags, ", "))
+	}
+	if invite.Scope != "" {
+		fmt.Fprintf(os.Stderr, "  Scope:   %s\n", invite.Scope)
+	}
 	fmt.Fprintf(os.Stderr, "  URL:     %s\n\n", joinURL)
 	fmt.Fprintf(os.Stderr, "To setup another device:\n")
 	fmt.Fprintf(os.Stderr, "  cw setup %s --invite %s\n", relayURL, invite.Token)
 
-	if showQR {
+	if opts.QR {
 		PrintQR(joinURL)
 	}
 
@@ -1577,56 +3175,346 @@ func PrintQR(content string) {
 	fmt.Fprintf(os.Stderr, "\n%s\n", q.ToSmallString(false))
 }
 
-// SSHQRCode prints an SSH connection QR code from existing config.
-func SSHQRCode(dataDir string, sshPort int) error {
-	cfg, err := config.LoadConfig(dataDir)
+// SSHQRCode prints an SSH connection QR code from existing config.
+func SSHQRCode(dataDir string, sshPort int) error {
+	cfg, err := config.LoadConfig(dataDir)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if cfg.RelayURL == nil || *cfg.RelayURL == "" {
+		return fmt.Errorf("relay not configured (run 'cw setup <relay-url>')")
+	}
+	if cfg.RelayToken == nil || *cfg.RelayToken == "" {
+		return fmt.Errorf("no relay token in config (run 'cw setup <relay-url>')")
+	}
+
+	nodeName := cfg.Node.Name
+	uri := relay.SSHURI(*cfg.RelayURL, nodeName, *cfg.RelayToken, sshPort)
+
+	fmt.Fprintf(os.Stderr, "SSH URI: %s\n", uri)
+	PrintQR(uri)
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Revoke — revoke a node's access via relay API
+// ---------------------------------------------------------------------------
+
+// Revoke removes a node from the relay and adds its key to the revoked list.
+func Revoke(dataDir string, nodeName string) error {
+	relayURL, authToken, err := loadRelayAuth(dataDir)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, relayURL+"/api/v1/nodes/"+nodeName, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("contacting relay: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to revoke node: %s", string(body))
+	}
+
+	fmt.Fprintf(os.Stderr, "Node %q revoked\n", nodeName)
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// RelayAudit — query the relay's audit log
+// ---------------------------------------------------------------------------
+
+// RelayAuditOptions filters the entries RelayAudit prints.
+type RelayAuditOptions struct {
+	User  string
+	Node  string
+	Since string // duration (e.g. 24h) or RFC 3339 time
+	Limit int    // maximum entries to print; 0 means all
+	JSON  bool
+}
+
+// RelayAudit prints audit log entries from the relay, newest first, fetching
+// as many pages as needed.
+func RelayAudit(dataDir string, opts RelayAuditOptions) error {
+	relayURL, authToken, err := loadRelayAuth(dataDir)
+	if err != nil {
+		return err
+	}
+
+	type auditEntry struct {
+		ID        int64     `json:"id"`
+		Time      time.Time `json:"time"`
+		User      string    `json:"user"`
+		Node      string    `json:"node"`
+		Action    string    `json:"action"`
+		SessionID string    `json:"session_id,omitempty"`
+		Result    string    `json:"result"`
+		RemoteIP  string    `json:"remote_ip,omitempty"`
+	}
+
+	var entries []auditEntry
+	var before int64
+	for {
+		q := url.Values{}
+		if opts.User != "" {
+			q.Set("user", opts.User)
+		}
+		if opts.Node != "" {
+			q.Set("node", opts.Node)
+		}
+		if opts.Since != "" {
+			q.Set("since", opts.Since)
+		}
+		if before > 0 {
+			q.Set("before", strconv.FormatInt(before, 10))
+		}
+		pageSize := 1000
+		if opts.Limit > 0 {
+			pageSize = min(pageSize, opts.Limit-len(entries))
+		}
+		q.Set("limit", strconv.Itoa(pageSize))
+
+		req, err := http.NewRequest(http.MethodGet, relayURL+"/api/v1/audit?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+authToken)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("contacting relay: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return fmt.Errorf("failed to read audit log: %s", strings.TrimSpace(string(body)))
+		}
+		var page struct {
+			Entries    []auditEntry `json:"entries"`
+			NextBefore int64        `json:"next_before"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("parsing response: %w", err)
+		}
+
+		entries = append(entries, page.Entries...)
+		if page.NextBefore == 0 || (opts.Limit > 0 && len(entries) >= opts.Limit) {
+			break
+		}
+		before = page.NextBefore
+	}
+
+	if opts.JSON {
+		if entries == nil {
+			entries = []auditEntry{}
+		}
+		data, _ := json.MarshalIndent(entries, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(entries) == 0 {
+		fmt.Println("No audit entries")
+		return nil
+	}
+
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	fmt.Printf("%-19s %-16s %-16s %-16s %-12s %s\n", "TIME", "USER", "NODE", "ACTION", "SESSION", "RESULT")
+	for _, e := range entries {
+		session := e.SessionID
+		if len(session) > 12 {
+			session = session[:12]
+		}
+		user := e.User
+		if user == "" && e.RemoteIP != "" {
+			user = e.RemoteIP
+		}
+		fmt.Printf("%-19s %-16s %-16s %-16s %-12s %s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"), dash(user), dash(e.Node), e.Action, dash(session), e.Result)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Update channels — the cw version the relay asks nodes to run
+// ---------------------------------------------------------------------------
+
+// relayAdminRequest sends an authenticated request to the relay's admin API
+// and returns the response body. A status other than 2xx is an error
+// prefixed with what.
+func relayAdminRequest(dataDir, method, path string, body any, what string) ([]byte, error) {
+	relayURL, authToken, err := loadRelayAuth(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, relayURL+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("contacting relay: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s: %s", what, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+type updateChannel struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	URL       string    `json:"url,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RelayChannels prints the relay's update channels.
+func RelayChannels(dataDir string, jsonOutput bool) error {
+	data, err := relayAdminRequest(dataDir, http.MethodGet, "/api/v1/update-channels", nil, "failed to list update channels")
 	if err != nil {
-		return fmt.Errorf("loading config: %w", err)
+		return err
 	}
-	if cfg.RelayURL == nil || *cfg.RelayURL == "" {
-		return fmt.Errorf("relay not configured (run 'cw setup <relay-url>')")
+	var channels []updateChannel
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
 	}
-	if cfg.RelayToken == nil || *cfg.RelayToken == "" {
-		return fmt.Errorf("no relay token in config (run 'cw setup <relay-url>')")
+
+	if jsonOutput {
+		if channels == nil {
+			channels = []updateChannel{}
+		}
+		return printJSON(channels)
+	}
+	if len(channels) == 0 {
+		fmt.Println("No update channels")
+		return nil
 	}
+	fmt.Printf("%-16s %-12s %-19s %s\n", "CHANNEL", "VERSION", "UPDATED", "URL")
+	for _, ch := range channels {
+		base := ch.URL
+		if base == "" {
+			base = "-"
+		}
+		fmt.Printf("%-16s %-12s %-19s %s\n", ch.Name, ch.Version, ch.UpdatedAt.Local().Format("2006-01-02 15:04:05"), base)
+	}
+	return nil
+}
 
-	nodeName := cfg.Node.Name
-	uri := relay.SSHURI(*cfg.RelayURL, nodeName, *cfg.RelayToken, sshPort)
+// RelayChannelSet points an update channel at version, downloaded from
+// baseURL (the GitHub releases if empty), creating the channel if needed.
+func RelayChannelSet(dataDir, name, version, baseURL string) error {
+	body := map[string]string{"version": version, "url": baseURL}
+	if _, err := relayAdminRequest(dataDir, http.MethodPut, "/api/v1/update-channels/"+url.PathEscape(name), body, "failed to set update channel"); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Channel %q now at %s\n", name, version)
+	return nil
+}
 
-	fmt.Fprintf(os.Stderr, "SSH URI: %s\n", uri)
-	PrintQR(uri)
+// RelayChannelRemove deletes an update channel. Nodes following it stay on
+// their version.
+func RelayChannelRemove(dataDir, name string) error {
+	if _, err := relayAdminRequest(dataDir, http.MethodDelete, "/api/v1/update-channels/"+url.PathEscape(name), nil, "failed to remove update channel"); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Channel %q removed\n", name)
 	return nil
 }
 
 // ---------------------------------------------------------------------------
-// Revoke — revoke a node's access via relay API
+// Keys — the relay tokens of registered nodes and client devices
 // ---------------------------------------------------------------------------
 
-// Revoke removes a node from the relay and adds its key to the revoked list.
-func Revoke(dataDir string, nodeName string) error {
-	relayURL, authToken, err := loadRelayAuth(dataDir)
+type relayKey struct {
+	Name       string    `json:"name"`
+	Scope      string    `json:"scope"`
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Rotating   bool      `json:"rotating,omitempty"`
+}
+
+// KeyList prints the relay tokens of the devices registered with the relay,
+// identified by a hash, with when each was issued and last used.
+func KeyList(dataDir string, jsonOutput bool) error {
+	data, err := relayAdminRequest(dataDir, http.MethodGet, "/api/v1/keys", nil, "failed to list keys")
 	if err != nil {
 		return err
 	}
+	var keys []relayKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
 
-	req, err := http.NewRequest(http.MethodDelete, relayURL+"/api/v1/nodes/"+nodeName, nil)
-	if err != nil {
-		return err
+	if jsonOutput {
+		if keys == nil {
+			keys = []relayKey{}
+		}
+		return printJSON(keys)
 	}
-	req.Header.Set("Authorization", "Bearer "+authToken)
+	if len(keys) == 0 {
+		fmt.Println("No keys")
+		return nil
+	}
+	fmt.Printf("%-20s %-7s %-13s %-19s %-10s %s\n", "NAME", "SCOPE", "ID", "CREATED", "LAST USED", "STATE")
+	for _, k := range keys {
+		used := "-"
+		if !k.LastUsedAt.IsZero() {
+			used = formatRelativeTime(k.LastUsedAt.Format(time.RFC3339))
+		}
+		state := "active"
+		if k.Rotating {
+			state = "rotating"
+		}
+		fmt.Printf("%-20s %-7s %-13s %-19s %-10s %s\n",
+			k.Name, k.Scope, k.ID, k.CreatedAt.Local().Format("2006-01-02 15:04:05"), used, state)
+	}
+	return nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// KeyRotate issues node a new relay token over its relay connection. It
+// returns once the node has reconnected with the new token, which
+// invalidates the old one.
+func KeyRotate(dataDir, node string) error {
+	data, err := relayAdminRequest(dataDir, http.MethodPost, "/api/v1/keys/"+url.PathEscape(node)+"/rotate", nil, "failed to rotate key")
 	if err != nil {
-		return fmt.Errorf("contacting relay: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return fmt.Errorf("failed to revoke node: %s", string(body))
+	var key relayKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
 	}
-
-	fmt.Fprintf(os.Stderr, "Node %q revoked\n", nodeName)
+	fmt.Fprintf(os.Stderr, "Node %q now uses key %s; the old key is revoked\n", key.Name, key.ID)
 	return nil
 }
 
@@ -1676,15 +3564,164 @@ func loadConfigFromDir(dataDir string) (*relayAuthConfig, error) {
 	return result, nil
 }
 
+// ---------------------------------------------------------------------------
+// SSH keys — client keys for the relay's SSH listener
+// ---------------------------------------------------------------------------
+
+// loadNodeRelay returns the relay URL and node token from dataDir's config.
+func loadNodeRelay(dataDir string) (relayURL, nodeToken string, err error) {
+	cfg, err := config.LoadConfig(dataDir)
+	if err != nil {
+		return "", "", fmt.Errorf("loading config: %w", err)
+	}
+	if cfg.RelayURL == nil || *cfg.RelayURL == "" || cfg.RelayToken == nil || *cfg.RelayToken == "" {
+		return "", "", fmt.Errorf("node not registered with a relay (run 'cw relay-setup <relay-url>')")
+	}
+	return strings.TrimRight(*cfg.RelayURL, "/"), *cfg.RelayToken, nil
+}
+
+type sshKeyEntry struct {
+	Fingerprint string    `json:"fingerprint"`
+	PublicKey   string    `json:"public_key"`
+	Comment     string    `json:"comment"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// relayNodeRequest sends an API request to the relay as this node.
+func relayNodeRequest(dataDir, method, path string, body any) (*http.Response, error) {
+	relayURL, nodeToken, err := loadNodeRelay(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, relayURL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+nodeToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("contacting relay: %w", err)
+	}
+	return resp, nil
+}
+
+// SSHKeyAdd allows publicKey, an authorized_keys line, to log in to this
+// node through the relay's SSH listener.
+func SSHKeyAdd(dataDir, publicKey string) error {
+	resp, err := relayNodeRequest(dataDir, http.MethodPost, "/api/v1/ssh-keys", map[string]string{"public_key": publicKey})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to add key: %s", strings.TrimSpace(string(body)))
+	}
+	var key sshKeyEntry
+	if err := json.NewDecoder(resp.Body).Decode(&key); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+	fmt.Printf("Added key %s", key.Fingerprint)
+	if key.Comment != "" {
+		fmt.Printf(" (%s)", key.Comment)
+	}
+	fmt.Println()
+	return nil
+}
+
+// SSHKeyList prints the keys allowed to log in to this node through the
+// relay's SSH listener.
+func SSHKeyList(dataDir string, jsonOutput bool) error {
+	resp, err := relayNodeRequest(dataDir, http.MethodGet, "/api/v1/ssh-keys", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to list keys: %s", strings.TrimSpace(string(body)))
+	}
+	var keys []sshKeyEntry
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(keys, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(keys) == 0 {
+		fmt.Println("No SSH keys")
+		return nil
+	}
+	fmt.Printf("%-50s %-24s %s\n", "FINGERPRINT", "COMMENT", "ADDED")
+	for _, k := range keys {
+		fmt.Printf("%-50s %-24s %s\n", k.Fingerprint, k.Comment, k.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+// SSHKeyRemove revokes the key with the given SHA256 fingerprint.
+func SSHKeyRemove(dataDir, fingerprint string) error {
+	resp, err := relayNodeRequest(dataDir, http.MethodDelete, "/api/v1/ssh-keys/"+url.PathEscape(fingerprint), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to remove key: %s", strings.TrimSpace(string(body)))
+	}
+	fmt.Printf("Removed key %s\n", fingerprint)
+	return nil
+}
+
 // ---------------------------------------------------------------------------
 // Gateway — run an approval gateway for worker sessions
 // ---------------------------------------------------------------------------
 
 // Gateway launches a stub session and subscribes to message.request events,
 // evaluating each request via execCmd and replying automatically.
-func Gateway(target *Target, name, execCmd, notifyMethod string) error {
+//
+// With a slack:<url> or discord:<url> notify method, ESCALATE replies are not
+// sent back immediately: the request is registered with the node's relay,
+// and the human's Approve/Deny click becomes the reply. The relay delivers
+// that reply to the node whose token registered the request, so this needs
+// the local node, whose config.toml holds that token.
+func Gateway(ctx context.Context, target *Target, name, execCmd, notifyMethod string) error {
+	var escalation *gatewayRelay
+	if isWebhookNotify(notifyMethod) {
+		if !target.IsLocal() {
+			return fmt.Errorf("--notify %s registers approvals with the local node's relay and cannot be used with --server", strings.SplitN(notifyMethod, ":", 2)[0])
+		}
+		cfg, err := config.LoadConfig(target.Local)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		if cfg.RelayURL == nil || *cfg.RelayURL == "" || cfg.RelayToken == nil || *cfg.RelayToken == "" {
+			return fmt.Errorf("--notify %s requires a relay for approval links (run 'cw setup <relay-url>')", strings.SplitN(notifyMethod, ":", 2)[0])
+		}
+		escalation = &gatewayRelay{url: *cfg.RelayURL, token: *cfg.RelayToken}
+	} else if notifyMethod != "" {
+		if _, err := notify.Parse(notifyMethod); err != nil {
+			return err
+		}
+	}
+
 	// 1. Launch stub session
-	resp, err := requestResponse(target, &protocol.Request{
+	resp, err := requestResponse(ctx, target, &protocol.Request{
 		Type:    "Launch",
 		Command: []string{"sleep", "infinity"},
 		Tags:    []string{"_gateway"},
@@ -1699,28 +3736,15 @@ func Gateway(target *Target, name, execCmd, notifyMethod string) error {
 	stubID := *resp.ID
 	fmt.Fprintf(os.Stderr, "[cw gateway] listening as %q (session %d)\n", name, stubID)
 
-	// 2. Setup cleanup
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		select {
-		case <-sigCh:
-			cancel()
-		case <-ctx.Done():
-		}
-	}()
-
+	// 2. Setup cleanup; the gateway runs until ctx is done, so kill the stub
+	// with a context that outlives it.
 	defer func() {
-		signal.Stop(sigCh)
-		_ = Kill(target, stubID)
+		_ = Kill(context.WithoutCancel(ctx), target, stubID, KillOptions{})
 		fmt.Fprintf(os.Stderr, "[cw gateway] stopped\n")
 	}()
 
 	// 3. Subscribe to message.request on stub session
-	reader, writer, err := target.Connect()
+	reader, writer, err := target.Connect(ctx)
 	if err != nil {
 		return err
 	}
@@ -1745,6 +3769,9 @@ func Gateway(target *Target, name, execCmd, notifyMethod string) error {
 		return fmt.Errorf("expected SubscribeAck, got %q", ack.Type)
 	}
 
+	// Log what workers actually did, as reported by their PostToolUse/Stop hooks.
+	go gatewayObserve(ctx, target)
+
 	// 4. Event loop
 	frameCh := make(chan *protocol.Frame, 16)
 	readErr := make(chan error, 1)
@@ -1795,20 +3822,86 @@ func Gateway(target *Target, name, execCmd, notifyMethod string) error {
 			if err := json.Unmarshal(resp.Event.Data, &reqData); err != nil {
 				continue
 			}
-			go gatewayHandleRequest(ctx, target, execCmd, notifyMethod, reqData.RequestID, reqData.Body, reqData.FromName)
+			go gatewayHandleRequest(ctx, target, escalation, execCmd, notifyMethod, reqData.RequestID, reqData.Body, reqData.FromName)
+		}
+	}
+}
+
+// gatewayObserve subscribes to tool results and agent stops across all
+// sessions and logs them alongside the gateway's decisions.
+func gatewayObserve(ctx context.Context, target *Target) {
+	reader, writer, err := target.Connect(ctx)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	defer writer.Close()
+	go func() {
+		<-ctx.Done()
+		reader.Close()
+	}()
+
+	if err := writer.SendRequest(&protocol.Request{
+		Type:       "Subscribe",
+		EventTypes: []string{"session.tool_result", "session.agent_stopped"},
+	}); err != nil {
+		return
+	}
+
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil || frame == nil {
+			return
+		}
+		if frame.Type != protocol.FrameControl {
+			continue
+		}
+		var resp protocol.Response
+		if err := json.Unmarshal(frame.Payload, &resp); err != nil {
+			continue
+		}
+		if resp.Type != "Event" || resp.Event == nil || resp.SessionID == nil {
+			continue
+		}
+		switch resp.Event.EventType {
+		case "session.tool_result":
+			var d struct {
+				Tool string `json:"tool"`
+			}
+			_ = json.Unmarshal(resp.Event.Data, &d)
+			fmt.Fprintf(os.Stderr, "[cw gateway] session %d: %s done\n", *resp.SessionID, d.Tool)
+		case "session.agent_stopped":
+			fmt.Fprintf(os.Stderr, "[cw gateway] session %d: agent stopped\n", *resp.SessionID)
 		}
 	}
 }
 
-func gatewayHandleRequest(ctx context.Context, target *Target, execCmd, notifyMethod, requestID, body, fromName string) {
+// gatewayRelay holds the relay endpoint and node token used to register
+// escalated requests for webhook approval.
+type gatewayRelay struct {
+	url   string
+	token string
+}
+
+func gatewayHandleRequest(ctx context.Context, target *Target, escalation *gatewayRelay, execCmd, notifyMethod, requestID, body, fromName string) {
 	reply := gatewayEvaluate(ctx, execCmd, body, fromName)
 	upperReply := strings.ToUpper(reply)
 
 	if strings.HasPrefix(upperReply, "ESCALATE") && notifyMethod != "" {
-		gatewayNotify(notifyMethod, body, fromName)
+		if escalation != nil {
+			// The relay delivers the human's decision as the reply.
+			err := gatewayEscalate(escalation, notifyMethod, requestID, body, fromName)
+			if err == nil {
+				fmt.Fprintf(os.Stderr, "[cw gateway] %s -> escalated via %s\n", fromName, strings.SplitN(notifyMethod, ":", 2)[0])
+				return
+			}
+			fmt.Fprintf(os.Stderr, "[cw gateway] escalation error: %v\n", err)
+		} else {
+			gatewayNotify(notifyMethod, body, fromName)
+		}
 	}
 
-	if _, err := requestResponse(target, &protocol.Request{
+	if _, err := requestResponse(ctx, target, &protocol.Request{
 		Type:      "MsgReply",
 		RequestID: requestID,
 		Body:      reply,
@@ -1846,19 +3939,90 @@ func gatewayEvaluate(ctx context.Context, execCmd, body, fromName string) string
 }
 
 func gatewayNotify(method, body, fromName string) {
+	notifier, err := notify.Parse(method)
+	if err == nil {
+		err = notifier.Notify(notify.Notification{
+			Title: "cw gateway",
+			Body:  fmt.Sprintf("Approval needed from %s: %s", fromName, body),
+		})
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[cw gateway] notify error: %v\n", err)
+	}
+}
+
+// isWebhookNotify reports whether method posts to a chat webhook with an
+// approval link (slack:<url> or discord:<url>).
+func isWebhookNotify(method string) bool {
+	return strings.HasPrefix(method, "slack:") || strings.HasPrefix(method, "discord:")
+}
+
+// gatewayEscalate registers requestID with the relay and posts the resulting
+// approval URL to the Slack or Discord webhook named by method.
+func gatewayEscalate(rl *gatewayRelay, method, requestID, body, fromName string) error {
+	payload, _ := json.Marshal(map[string]string{
+		"request_id": requestID,
+		"from":       fromName,
+		"body":       body,
+	})
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(rl.url, "/")+"/api/v1/approvals", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+rl.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("contacting relay: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("registering approval: %s", strings.TrimSpace(string(msg)))
+	}
+	var approval struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&approval); err != nil {
+		return fmt.Errorf("parsing approval response: %w", err)
+	}
+
+	if fromName == "" {
+		fromName = "anonymous"
+	}
+	var webhookURL string
+	var message map[string]string
 	switch {
-	case method == "macos":
-		msg := fmt.Sprintf("Approval needed from %s: %s", fromName, body)
-		_ = exec.Command("osascript", "-e",
-			fmt.Sprintf(`display notification %q with title "cw gateway"`, msg)).Run()
-	case strings.HasPrefix(method, "ntfy:"):
-		url := strings.TrimPrefix(method, "ntfy:")
-		_ = exec.Command("curl", "-s", "-d", body, url).Run()
+	case strings.HasPrefix(method, "slack:"):
+		webhookURL = strings.TrimPrefix(method, "slack:")
+		message = map[string]string{
+			"text": fmt.Sprintf("*Approval needed* from `%s`\n```%s```\n<%s|Review request>", fromName, body, approval.URL),
+		}
+	case strings.HasPrefix(method, "discord:"):
+		webhookURL = strings.TrimPrefix(method, "discord:")
+		message = map[string]string{
+			"content": fmt.Sprintf("**Approval needed** from `%s`\n```%s```\nReview: %s", fromName, body, approval.URL),
+		}
+	default:
+		return fmt.Errorf("unsupported notify method %q", method)
+	}
+
+	data, _ := json.Marshal(message)
+	whResp, err := http.Post(webhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("posting webhook: %w", err)
+	}
+	defer whResp.Body.Close()
+	if whResp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(whResp.Body, 1024))
+		return fmt.Errorf("webhook returned %d: %s", whResp.StatusCode, strings.TrimSpace(string(msg)))
 	}
+	return nil
 }
 
 // ---------------------------------------------------------------------------
-// Hook — Claude Code PreToolUse hook handler
+// Hook — Claude Code PreToolUse / PostToolUse / Stop hook handler
 // ---------------------------------------------------------------------------
 
 // hookReadOnlyTools are tool names that bypass the gateway check.
@@ -1868,12 +4032,20 @@ var hookReadOnlyTools = map[string]bool{
 	"TodoRead": true, "TaskList": true, "TaskGet": true,
 }
 
-// hookInput is the JSON payload Claude Code sends to PreToolUse hooks.
+// hookInput is the JSON payload Claude Code sends to hooks. HookEventName is
+// absent in older payloads, which are treated as PreToolUse.
 type hookInput struct {
-	ToolName  string          `json:"tool_name"`
-	ToolInput json.RawMessage `json:"tool_input"`
+	HookEventName  string          `json:"hook_event_name"`
+	SessionID      string          `json:"session_id"`
+	TranscriptPath string          `json:"transcript_path"`
+	ToolName       string          `json:"tool_name"`
+	ToolInput      json.RawMessage `json:"tool_input"`
+	ToolResponse   json.RawMessage `json:"tool_response"`
 }
 
+// hookEvents are the Claude Code hook events installed by HookInstall.
+var hookEvents = []string{"PreToolUse", "PostToolUse", "Stop"}
+
 // hookOutput is the JSON payload returned to block a tool call.
 type hookOutput struct {
 	Decision string `json:"decision"`
@@ -1883,20 +4055,84 @@ type hookOutput struct {
 // Hook reads a Claude Code PreToolUse JSON payload from r, checks if a gateway
 // session is running, sends an approval request, and writes a block decision to w
 // if the gateway denies the call. Returns (block bool, err).
-func Hook(target *Target, r io.Reader, w io.Writer) (bool, error) {
+func Hook(ctx context.Context, target *Target, r io.Reader, w io.Writer) (bool, error) {
+	return HookForSession(ctx, target, nil, r, w)
+}
+
+// HookForSession is Hook for an agent running inside codewire session
+// sessionID (from CW_SESSION_ID). PreToolUse calls the gateway allows are
+// then charged against the session budget, and blocked once it is exhausted;
+// denied calls are not charged. PostToolUse and Stop
+// payloads are recorded on that session as session.tool_result and
+// session.agent_stopped events; they never block.
+func HookForSession(ctx context.Context, target *Target, sessionID *uint32, r io.Reader, w io.Writer) (bool, error) {
 	var input hookInput
 	if err := json.NewDecoder(r).Decode(&input); err != nil {
 		// Malformed input — allow (don't block on hook errors).
 		return false, nil
 	}
 
+	switch input.HookEventName {
+	case "PostToolUse", "Stop":
+		if sessionID != nil {
+			hookRecord(ctx, target, *sessionID, input)
+		}
+		return false, nil
+	}
+
+	blocked, err := hookPreToolUse(ctx, target, sessionID, input, w)
+	if blocked || err != nil {
+		return blocked, err
+	}
+
+	// Charge the session budget once the gateway allowed the call, so that
+	// denied calls do not use it up.
+	if sessionID != nil {
+		resp, err := requestResponse(ctx, target, &protocol.Request{
+			Type:      "HookEvent",
+			ID:        sessionID,
+			HookEvent: "PreToolUse",
+			ToolName:  input.ToolName,
+
+			AgentSessionID: input.SessionID,
+			TranscriptPath: input.TranscriptPath,
+		})
+		if err == nil && resp.Type == "BudgetExceeded" {
+			out := hookOutput{Decision: "block", Reason: "cw " + resp.Message}
+			if err := json.NewEncoder(w).Encode(out); err != nil {
+				return true, err
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hookRecord reports a PostToolUse or Stop payload to the node. Errors are
+// ignored: recording is best-effort and must not disturb the agent.
+func hookRecord(ctx context.Context, target *Target, sessionID uint32, input hookInput) {
+	_, _ = requestResponse(ctx, target, &protocol.Request{
+		Type:           "HookEvent",
+		ID:             &sessionID,
+		HookEvent:      input.HookEventName,
+		ToolName:       input.ToolName,
+		ToolInput:      input.ToolInput,
+		ToolResponse:   input.ToolResponse,
+		AgentSessionID: input.SessionID,
+		TranscriptPath: input.TranscriptPath,
+	})
+}
+
+// hookPreToolUse asks the gateway session to approve the tool call, on
+// behalf of session sessionID if known.
+func hookPreToolUse(ctx context.Context, target *Target, sessionID *uint32, input hookInput, w io.Writer) (bool, error) {
 	// Skip read-only tools.
 	if hookReadOnlyTools[input.ToolName] {
 		return false, nil
 	}
 
 	// Find the gateway session.
-	resp, err := requestResponse(target, &protocol.Request{Type: "ListSessions"})
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "ListSessions"})
 	if err != nil || resp.Type != "SessionList" || resp.Sessions == nil {
 		// Node not running or error — allow by default.
 		return false, nil
@@ -1917,8 +4153,9 @@ func Hook(target *Target, r io.Reader, w io.Writer) (bool, error) {
 	// Send the approval request to the gateway.
 	body := input.ToolName + ": " + string(input.ToolInput)
 	timeout := uint64(30)
-	reqResp, err := requestResponse(target, &protocol.Request{
+	reqResp, err := requestResponse(ctx, target, &protocol.Request{
 		Type:           "MsgRequest",
+		ID:             sessionID,
 		ToID:           &gatewayID,
 		Body:           body,
 		TimeoutSeconds: &timeout,
@@ -1943,7 +4180,8 @@ func Hook(target *Target, r io.Reader, w io.Writer) (bool, error) {
 	return false, nil
 }
 
-// HookInstall adds the PreToolUse hook entry to ~/.claude/settings.json.
+// HookInstall adds the PreToolUse, PostToolUse, and Stop hook entries to
+// ~/.claude/settings.json.
 func HookInstall() error {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -1962,11 +4200,6 @@ func HookInstall() error {
 		settings = make(map[string]json.RawMessage)
 	}
 
-	// Build the hook entry.
-	hookEntry := json.RawMessage(`{"hooks":[{"type":"command","command":"cw hook"}]}`)
-	preToolUse := []json.RawMessage{hookEntry}
-
-	// Merge into hooks.PreToolUse — preserve any existing entries.
 	var hooks map[string]json.RawMessage
 	if raw, ok := settings["hooks"]; ok {
 		if err := json.Unmarshal(raw, &hooks); err != nil {
@@ -1977,32 +4210,28 @@ func HookInstall() error {
 		hooks = make(map[string]json.RawMessage)
 	}
 
-	// Check if already installed.
-	if existing, ok := hooks["PreToolUse"]; ok {
+	// Merge into each hook event — preserve any existing entries.
+	hookEntry := json.RawMessage(`{"hooks":[{"type":"command","command":"cw hook"}]}`)
+	added := 0
+	for _, event := range hookEvents {
 		var entries []json.RawMessage
-		if err := json.Unmarshal(existing, &entries); err == nil {
-			for _, e := range entries {
-				var m map[string]json.RawMessage
-				if err := json.Unmarshal(e, &m); err == nil {
-					if hooksArr, ok := m["hooks"]; ok {
-						var hArr []map[string]string
-						if err := json.Unmarshal(hooksArr, &hArr); err == nil {
-							for _, h := range hArr {
-								if h["command"] == "cw hook" {
-									fmt.Fprintf(os.Stderr, "cw hook already installed in %s\n", settingsPath)
-									return nil
-								}
-							}
-						}
-					}
-				}
+		if existing, ok := hooks[event]; ok {
+			if err := json.Unmarshal(existing, &entries); err != nil {
+				entries = nil
 			}
-			preToolUse = append(entries, hookEntry)
 		}
+		if hookEntriesHaveCW(entries) {
+			continue
+		}
+		raw, _ := json.Marshal(append(entries, hookEntry))
+		hooks[event] = raw
+		added++
+	}
+	if added == 0 {
+		fmt.Fprintf(os.Stderr, "cw hook already installed in %s\n", settingsPath)
+		return nil
 	}
 
-	preToolUseRaw, _ := json.Marshal(preToolUse)
-	hooks["PreToolUse"] = preToolUseRaw
 	hooksRaw, _ := json.Marshal(hooks)
 	settings["hooks"] = hooksRaw
 
@@ -2020,14 +4249,32 @@ func HookInstall() error {
 	return nil
 }
 
+// hookEntriesHaveCW reports whether any hook matcher entry already runs "cw hook".
+func hookEntriesHaveCW(entries []json.RawMessage) bool {
+	for _, e := range entries {
+		var m struct {
+			Hooks []map[string]any `json:"hooks"`
+		}
+		if err := json.Unmarshal(e, &m); err != nil {
+			continue
+		}
+		for _, h := range m.Hooks {
+			if h["command"] == "cw hook" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ---------------------------------------------------------------------------
 // Completion helpers
 // ---------------------------------------------------------------------------
 
 // ListSessionsForCompletion returns session names and IDs suitable for tab
 // completion. Names are returned first (preferred), followed by numeric IDs.
-func ListSessionsForCompletion(target *Target) []string {
-	resp, err := requestResponse(target, &protocol.Request{Type: "ListSessions"})
+func ListSessionsForCompletion(ctx context.Context, target *Target) []string {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "ListSessions"})
 	if err != nil || resp.Sessions == nil {
 		return nil
 	}
@@ -2042,8 +4289,8 @@ func ListSessionsForCompletion(target *Target) []string {
 }
 
 // ListTagsForCompletion returns all tags currently in use across sessions.
-func ListTagsForCompletion(target *Target) []string {
-	resp, err := requestResponse(target, &protocol.Request{Type: "ListSessions"})
+func ListTagsForCompletion(ctx context.Context, target *Target) []string {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "ListSessions"})
 	if err != nil || resp.Sessions == nil {
 		return nil
 	}
@@ -0,0 +1,269 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// copyChunkSize is the most file content sent in one FileChunk frame; the
+// node reads WebSocket messages up to 32 KiB.
+const copyChunkSize = 32 << 10
+
+// CopyToSession uploads the local file localPath to remotePath, relative to
+// session id's working directory. An empty remotePath or a directory keeps
+// the file's name. The node writes the file only once its SHA-256 matches.
+func CopyToSession(ctx context.Context, target *Target, id uint32, localPath, remotePath string, progress bool) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", localPath)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("reading %s: %w", localPath, err)
+	}
+	checksum := hex.EncodeToString(h.Sum(nil))
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader, writer, err := target.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	if err := writer.SendRequest(&protocol.Request{
+		Type:     "FileWrite",
+		ID:       &id,
+		Path:     remotePath,
+		FileName: filepath.Base(localPath),
+		FileSize: fi.Size(),
+		FileMode: uint32(fi.Mode().Perm()),
+		Checksum: checksum,
+	}); err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	ready, err := expectResponse(reader, "FileReady")
+	if err != nil {
+		return err
+	}
+
+	bar := newCopyProgress(progress, fi.Size())
+	buf := make([]byte, copyChunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if werr := writer.WriteFrame(&protocol.Frame{Type: protocol.FrameFileChunk, Payload: buf[:n]}); werr != nil {
+				bar.done()
+				return fmt.Errorf("sending file: %w", werr)
+			}
+			bar.add(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			bar.done()
+			return fmt.Errorf("reading %s: %w", localPath, err)
+		}
+	}
+	bar.done()
+
+	done, err := expectResponse(reader, "FileDone")
+	if err != nil {
+		return err
+	}
+	if done.Checksum != checksum {
+		return fmt.Errorf("checksum mismatch: sent %s, node stored %s", checksum, done.Checksum)
+	}
+	fmt.Printf("Copied %s -> %s (%s, sha256 %s)\n", localPath, ready.Path, formatByteSize(done.FileSize), checksum[:12])
+	return nil
+}
+
+// CopyFromSession downloads remotePath, relative to session id's working
+// directory, to localPath. A localPath that is a directory, or ends in a
+// separator, keeps the remote file's name. The file is written in place
+// only once its SHA-256 matches the node's.
+func CopyFromSession(ctx context.Context, target *Target, id uint32, remotePath, localPath string, progress bool) error {
+	if fi, err := os.Stat(localPath); (err == nil && fi.IsDir()) || strings.HasSuffix(localPath, string(filepath.Separator)) {
+		localPath = filepath.Join(localPath, path.Base(filepath.ToSlash(remotePath)))
+	}
+
+	reader, writer, err := target.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	if err := writer.SendRequest(&protocol.Request{Type: "FileRead", ID: &id, Path: remotePath}); err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	info, err := expectResponse(reader, "FileInfo")
+	if err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".cw-*")
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		out.Close()
+		if !committed {
+			os.Remove(out.Name())
+		}
+	}()
+
+	connection.ExpectFileChunks(reader)
+	bar := newCopyProgress(progress, info.FileSize)
+	h := sha256.New()
+	var done *protocol.Response
+	for done == nil {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			bar.done()
+			return fmt.Errorf("reading file: %w", err)
+		}
+		if frame == nil {
+			bar.done()
+			return fmt.Errorf("connection closed during transfer")
+		}
+		switch frame.Type {
+		case protocol.FrameFileChunk:
+			if _, err := out.Write(frame.Payload); err != nil {
+				bar.done()
+				return fmt.Errorf("writing %s: %w", localPath, err)
+			}
+			h.Write(frame.Payload)
+			bar.add(len(frame.Payload))
+		case protocol.FrameControl:
+			var resp protocol.Response
+			if err := json.Unmarshal(frame.Payload, &resp); err != nil {
+				bar.done()
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			if resp.Type != "FileDone" {
+				bar.done()
+				if resp.Type == "Error" {
+					return fmt.Errorf("%s", resp.Message)
+				}
+				return fmt.Errorf("unexpected response: %s", resp.Type)
+			}
+			done = &resp
+		}
+	}
+	bar.done()
+
+	checksum := hex.EncodeToString(h.Sum(nil))
+	if done.Checksum != checksum {
+		return fmt.Errorf("checksum mismatch: node sent %s, received %s; %s left unchanged", done.Checksum, checksum, localPath)
+	}
+	if err := out.Chmod(os.FileMode(info.FileMode).Perm()); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", localPath, err)
+	}
+	if err := os.Rename(out.Name(), localPath); err != nil {
+		return err
+	}
+	committed = true
+
+	fmt.Printf("Copied %s -> %s (%s, sha256 %s)\n", info.Path, localPath, formatByteSize(done.FileSize), checksum[:12])
+	return nil
+}
+
+// expectResponse reads the next control frame, expecting a response of
+// type want.
+func expectResponse(reader connection.FrameReader, want string) (*protocol.Response, error) {
+	frame, err := reader.ReadFrame()
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if frame == nil {
+		return nil, fmt.Errorf("connection closed before response")
+	}
+	if frame.Type != protocol.FrameControl {
+		return nil, fmt.Errorf("expected control frame, got type 0x%02x", frame.Type)
+	}
+	var resp protocol.Response
+	if err := json.Unmarshal(frame.Payload, &resp); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	if resp.Type == "Error" {
+		return nil, fmt.Errorf("%s", resp.Message)
+	}
+	if resp.Type != want {
+		return nil, fmt.Errorf("unexpected response: %s", resp.Type)
+	}
+	return &resp, nil
+}
+
+// copyProgress draws a progress line on stderr, at most ten times a second.
+type copyProgress struct {
+	enabled bool
+	total   int64
+	n       int64
+	last    time.Time
+}
+
+func newCopyProgress(enabled bool, total int64) *copyProgress {
+	return &copyProgress{enabled: enabled, total: total}
+}
+
+func (p *copyProgress) add(n int) {
+	p.n += int64(n)
+	if !p.enabled || time.Since(p.last) < 100*time.Millisecond {
+		return
+	}
+	p.last = time.Now()
+	pct := 100
+	if p.total > 0 {
+		pct = int(p.n * 100 / p.total)
+	}
+	fmt.Fprintf(os.Stderr, "\r%3d%%  %s / %s ", pct, formatByteSize(p.n), formatByteSize(p.total))
+}
+
+// done clears the progress line.
+func (p *copyProgress) done() {
+	if p.enabled && !p.last.IsZero() {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
+
+func formatByteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
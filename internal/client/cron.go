@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// CronAdd schedules job on the node.
+func CronAdd(ctx context.Context, target *Target, job protocol.CronJob) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type:       "CronAdd",
+		Name:       job.Name,
+		Schedule:   job.Schedule,
+		Command:    job.Command,
+		WorkingDir: job.WorkingDir,
+		Env:        job.Env,
+		Tags:       job.Tags,
+		Budget:     job.Budget,
+		MissedRun:  job.MissedRun,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	fmt.Fprintf(os.Stderr, "Scheduled %s (%s)\n", job.Name, job.Schedule)
+	return nil
+}
+
+// CronList prints the node's cron jobs.
+func CronList(ctx context.Context, target *Target, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "CronList"})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	var jobs []protocol.CronJob
+	if resp.CronJobs != nil {
+		jobs = *resp.CronJobs
+	}
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(jobs, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No cron jobs")
+		return nil
+	}
+
+	fmt.Printf("%-20s %-16s %-17s %-14s %s\n", "NAME", "SCHEDULE", "NEXT RUN", "LAST RUN", "COMMAND")
+	for _, job := range jobs {
+		next := "-"
+		if t, err := time.Parse(time.RFC3339, job.NextRunAt); err == nil {
+			next = t.Local().Format("2006-01-02 15:04")
+		}
+		last := "never"
+		if job.LastRunAt != nil {
+			last = formatRelativeTime(*job.LastRunAt)
+			if job.LastSessionID != nil {
+				last = fmt.Sprintf("%s (%d)", last, *job.LastSessionID)
+			}
+		}
+		command := strings.Join(job.Command, " ")
+		if len(command) > 40 {
+			command = command[:37] + "..."
+		}
+		fmt.Printf("%-20s %-16s %-17s %-14s %s\n", job.Name, job.Schedule, next, last, command)
+	}
+	return nil
+}
+
+// CronRemove deletes a cron job. Sessions it already launched keep running.
+func CronRemove(ctx context.Context, target *Target, name string) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "CronRemove", Name: name})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	fmt.Fprintf(os.Stderr, "Removed cron job %s\n", name)
+	return nil
+}
@@ -0,0 +1,284 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// recording is a session's output log split into timed chunks.
+type recording struct {
+	info   protocol.SessionInfo
+	start  time.Time
+	chunks []recordedChunk
+}
+
+type recordedChunk struct {
+	at   time.Time
+	data string
+}
+
+// duration is the time from the start of the recording to its last chunk.
+func (r *recording) duration() time.Duration {
+	if len(r.chunks) == 0 {
+		return 0
+	}
+	return r.chunks[len(r.chunks)-1].at.Sub(r.start)
+}
+
+// fetchRecording retrieves a session's output and timing from the node.
+// Output written before the node recorded timing is attributed to the
+// session's start.
+func fetchRecording(ctx context.Context, target *Target, id uint32) (*recording, error) {
+	reader, writer, err := target.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	if err := writer.SendRequest(&protocol.Request{Type: "GetRecording", ID: &id}); err != nil {
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+	resp, err := readRecordingResponse(reader)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Type != "Recording" || resp.Info == nil {
+		return nil, fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+
+	// The log follows in FileChunk frames, then its timing in batches.
+	connection.ExpectFileChunks(reader)
+	var buf strings.Builder
+	buf.Grow(int(resp.FileSize))
+	timing := []protocol.TimingEntry{}
+	for done := false; !done; {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			return nil, fmt.Errorf("reading recording: %w", err)
+		}
+		if frame == nil {
+			return nil, fmt.Errorf("connection closed during recording")
+		}
+		if frame.Type == protocol.FrameFileChunk {
+			buf.Write(frame.Payload)
+			continue
+		}
+		next, err := parseRecordingResponse(frame)
+		if err != nil {
+			return nil, err
+		}
+		switch next.Type {
+		case "RecordingTiming":
+			if next.Timing != nil {
+				timing = append(timing, *next.Timing...)
+			}
+		case "RecordingDone":
+			done = true
+		default:
+			return nil, fmt.Errorf("unexpected response type: %s", next.Type)
+		}
+	}
+
+	rec := &recording{info: *resp.Info}
+	rec.start, _ = time.Parse(time.RFC3339, resp.Info.CreatedAt)
+
+	var timed int64
+	for _, t := range timing {
+		timed += t.Length
+	}
+
+	data := buf.String()
+	offset := int64(len(data)) - timed
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > 0 {
+		rec.chunks = append(rec.chunks, recordedChunk{at: rec.start, data: data[:offset]})
+	}
+	for _, t := range timing {
+		at, err := time.Parse(time.RFC3339Nano, t.Time)
+		if err != nil {
+			continue
+		}
+		end := offset + t.Length
+		if end > int64(len(data)) {
+			break
+		}
+		rec.chunks = append(rec.chunks, recordedChunk{at: at, data: data[offset:end]})
+		offset = end
+	}
+
+	if len(rec.chunks) > 0 && (rec.start.IsZero() || rec.chunks[0].at.Before(rec.start)) {
+		rec.start = rec.chunks[0].at
+	}
+	return rec, nil
+}
+
+// readRecordingResponse reads the next control frame of a GetRecording
+// reply.
+func readRecordingResponse(reader connection.FrameReader) (*protocol.Response, error) {
+	frame, err := reader.ReadFrame()
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if frame == nil {
+		return nil, fmt.Errorf("connection closed before response")
+	}
+	return parseRecordingResponse(frame)
+}
+
+// parseRecordingResponse parses a control frame of a GetRecording reply,
+// returning the node's error if it sent one.
+func parseRecordingResponse(frame *protocol.Frame) (*protocol.Response, error) {
+	if frame.Type != protocol.FrameControl {
+		return nil, fmt.Errorf("expected control frame, got type 0x%02x", frame.Type)
+	}
+	var resp protocol.Response
+	if err := json.Unmarshal(frame.Payload, &resp); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	if resp.Type == "Error" {
+		return nil, fmt.Errorf("%s", formatError(resp.Message))
+	}
+	return &resp, nil
+}
+
+// ExportOptions controls cw export.
+type ExportOptions struct {
+	Format string // "asciicast", "html", or "txt"
+	Cols   int    // terminal width for asciicast and html
+	Rows   int    // terminal height for asciicast and html
+}
+
+// Export writes a session's output to w as an asciinema v2 cast, a
+// standalone HTML replay, or plain text.
+func Export(ctx context.Context, target *Target, id uint32, w io.Writer, opts ExportOptions) error {
+	switch opts.Format {
+	case "txt":
+		resp, err := requestResponse(ctx, target, &protocol.Request{Type: "Logs", ID: &id})
+		if err != nil {
+			return err
+		}
+		if resp.Type == "Error" {
+			return fmt.Errorf("%s", formatError(resp.Message))
+		}
+		_, err = io.WriteString(w, strings.ReplaceAll(resp.Data, "\r\n", "\n"))
+		return err
+	case "asciicast", "html":
+	default:
+		return fmt.Errorf("unknown format %q (use asciicast, html, or txt)", opts.Format)
+	}
+
+	rec, err := fetchRecording(ctx, target, id)
+	if err != nil {
+		return err
+	}
+	if opts.Format == "html" {
+		return writeHTMLReplay(w, rec, opts.Cols, opts.Rows)
+	}
+	return writeAsciicast(w, rec, opts.Cols, opts.Rows)
+}
+
+// sessionTitle describes a recorded session for cast and page titles.
+func sessionTitle(info protocol.SessionInfo) string {
+	title := fmt.Sprintf("codewire session %d", info.ID)
+	if info.Name != "" {
+		title += " (" + info.Name + ")"
+	}
+	if info.Prompt != "" {
+		title += ": " + info.Prompt
+	}
+	return title
+}
+
+// asciicastEvents converts the recording to asciicast output events of
+// [seconds, "o", data]. A multi-byte character split across chunks is carried
+// into the next event so every event is valid UTF-8.
+func asciicastEvents(rec *recording) [][3]interface{} {
+	var events [][3]interface{}
+	var carry string
+	for _, c := range rec.chunks {
+		data := carry + c.data
+		carry = ""
+		if tail := incompleteUTF8Suffix(data); tail > 0 {
+			carry = data[len(data)-tail:]
+			data = data[:len(data)-tail]
+		}
+		if data == "" {
+			continue
+		}
+		elapsed := c.at.Sub(rec.start).Seconds()
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		events = append(events, [3]interface{}{elapsed, "o", strings.ToValidUTF8(data, "�")})
+	}
+	if carry != "" {
+		events = append(events, [3]interface{}{rec.duration().Seconds(), "o", strings.ToValidUTF8(carry, "�")})
+	}
+	return events
+}
+
+// incompleteUTF8Suffix returns the length of a truncated multi-byte character
+// at the end of s, or 0.
+func incompleteUTF8Suffix(s string) int {
+	for i := 1; i < utf8.UTFMax && i <= len(s); i++ {
+		b := s[len(s)-i]
+		if b < 0x80 {
+			return 0
+		}
+		if utf8.RuneStart(b) {
+			if !utf8.FullRuneInString(s[len(s)-i:]) {
+				return i
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+func writeAsciicast(w io.Writer, rec *recording, cols, rows int) error {
+	header := struct {
+		Version   int               `json:"version"`
+		Width     int               `json:"width"`
+		Height    int               `json:"height"`
+		Timestamp int64             `json:"timestamp"`
+		Title     string            `json:"title"`
+		Env       map[string]string `json:"env"`
+	}{2, cols, rows, rec.start.Unix(), sessionTitle(rec.info), map[string]string{"TERM": "xterm-256color"}}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	for _, e := range asciicastEvents(rec) {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeHTMLReplay(w io.Writer, rec *recording, cols, rows int) error {
+	events, err := json.Marshal(asciicastEvents(rec))
+	if err != nil {
+		return err
+	}
+	return htmlReplayTemplate.Execute(w, map[string]interface{}{
+		"Title":    sessionTitle(rec.info),
+		"Cols":     cols,
+		"Rows":     rows,
+		"Duration": rec.duration().Round(time.Second).String(),
+		"Events":   template.JS(events),
+	})
+}
@@ -0,0 +1,194 @@
+package client
+
+import "html/template"
+
+// htmlReplayTemplate is a self-contained page that replays asciicast events
+// in a small terminal emulator. It handles the common cursor movement,
+// erase, and SGR color sequences; anything else is ignored.
+var htmlReplayTemplate = template.Must(template.New("replay").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { background: #1e1e1e; color: #ddd; font-family: sans-serif; margin: 2em; }
+h1 { font-size: 1.1em; font-weight: normal; }
+#term { background: #000; color: #ccc; font: 13px/1.25 Menlo, Consolas, monospace; padding: 8px; white-space: pre; overflow: auto; display: inline-block; min-width: {{.Cols}}ch; min-height: calc({{.Rows}} * 1.25em); }
+#controls { margin: 0.8em 0; display: flex; gap: 0.8em; align-items: center; }
+#controls input[type=range] { width: 40em; }
+.b { font-weight: bold; } .u { text-decoration: underline; }
+</style>
+</head>
+<body>
+<h1>{{.Title}} <small>({{.Duration}})</small></h1>
+<div id="controls">
+<button id="play">Play</button>
+<input id="seek" type="range" min="0" max="1000" value="0">
+<span id="clock">0:00</span>
+<select id="speed"><option value="0.5">0.5x</option><option value="1" selected>1x</option><option value="2">2x</option><option value="4">4x</option><option value="16">16x</option></select>
+</div>
+<div id="term"></div>
+<script>
+const events = {{.Events}};
+const cols = {{.Cols}}, rows = {{.Rows}};
+const palette = ["#000","#c33","#3c3","#cc3","#36c","#c3c","#3cc","#ccc","#666","#f66","#6f6","#ff6","#69f","#f6f","#6ff","#fff"];
+const total = events.length ? events[events.length - 1][0] : 0;
+
+let screen, row, col, style, next, offset, playing = false, startedAt = 0;
+
+function blank() { return {ch: " ", s: ""}; }
+function reset() {
+  screen = [[]]; row = 0; col = 0; style = {fg: null, bg: null, b: false, u: false}; next = 0; offset = 0;
+}
+function line(r) { while (screen.length <= r) screen.push([]); return screen[r]; }
+function styleKey() {
+  let k = "";
+  if (style.fg !== null) k += "color:" + style.fg + ";";
+  if (style.bg !== null) k += "background:" + style.bg + ";";
+  return k + (style.b ? "|b" : "") + (style.u ? "|u" : "");
+}
+function color256(n) {
+  if (n < 16) return palette[n];
+  if (n >= 232) { const v = 8 + (n - 232) * 10; return "rgb(" + v + "," + v + "," + v + ")"; }
+  n -= 16;
+  const c = [Math.floor(n / 36), Math.floor(n / 6) % 6, n % 6].map(v => v ? v * 40 + 55 : 0);
+  return "rgb(" + c.join(",") + ")";
+}
+function sgr(params) {
+  if (params.length === 0) params = [0];
+  for (let i = 0; i < params.length; i++) {
+    const p = params[i];
+    if (p === 0) style = {fg: null, bg: null, b: false, u: false};
+    else if (p === 1) style.b = true;
+    else if (p === 4) style.u = true;
+    else if (p === 22) style.b = false;
+    else if (p === 24) style.u = false;
+    else if (p >= 30 && p <= 37) style.fg = palette[p - 30];
+    else if (p === 39) style.fg = null;
+    else if (p >= 40 && p <= 47) style.bg = palette[p - 40];
+    else if (p === 49) style.bg = null;
+    else if (p >= 90 && p <= 97) style.fg = palette[p - 82];
+    else if (p >= 100 && p <= 107) style.bg = palette[p - 92];
+    else if ((p === 38 || p === 48) && params[i + 1] === 5) {
+      style[p === 38 ? "fg" : "bg"] = color256(params[i + 2]); i += 2;
+    } else if ((p === 38 || p === 48) && params[i + 1] === 2) {
+      style[p === 38 ? "fg" : "bg"] = "rgb(" + params.slice(i + 2, i + 5).join(",") + ")"; i += 4;
+    }
+  }
+}
+function csi(final, params) {
+  const n = params[0] || 1;
+  switch (final) {
+    case "m": sgr(params); break;
+    case "A": row = Math.max(0, row - n); break;
+    case "B": row += n; break;
+    case "C": col += n; break;
+    case "D": col = Math.max(0, col - n); break;
+    case "G": col = n - 1; break;
+    case "H": case "f": row = (params[0] || 1) - 1; col = (params[1] || 1) - 1; break;
+    case "K": {
+      const l = line(row);
+      if (!params[0]) l.length = Math.min(l.length, col);
+      else if (params[0] === 1) for (let i = 0; i <= col && i < l.length; i++) l[i] = blank();
+      else l.length = 0;
+      break;
+    }
+    case "J":
+      if (params[0] === 2 || params[0] === 3) { screen = [[]]; row = 0; col = 0; }
+      else if (!params[0]) { line(row).length = Math.min(line(row).length, col); screen.length = row + 1; }
+      break;
+  }
+}
+function feed(data) {
+  for (let i = 0; i < data.length; i++) {
+    const c = data[i];
+    if (c === "\x1b") {
+      if (data[i + 1] === "[") {
+        let j = i + 2;
+        while (j < data.length && !(data[j] >= "@" && data[j] <= "~")) j++;
+        const raw = data.slice(i + 2, j);
+        if (!/^[?>=]/.test(raw)) csi(data[j], raw.split(";").filter(s => s !== "").map(Number));
+        i = j;
+      } else if (data[i + 1] === "]") {
+        let j = i + 2;
+        while (j < data.length && data[j] !== "\x07" && !(data[j] === "\x1b" && data[j + 1] === "\\")) j++;
+        i = data[j] === "\x07" ? j : j + 1;
+      } else {
+        i++;
+      }
+    } else if (c === "\n") { row++; line(row); }
+    else if (c === "\r") col = 0;
+    else if (c === "\b") col = Math.max(0, col - 1);
+    else if (c === "\t") col = (Math.floor(col / 8) + 1) * 8;
+    else if (c >= " ") {
+      if (col >= cols) { col = 0; row++; }
+      const l = line(row);
+      while (l.length < col) l.push(blank());
+      l[col++] = {ch: c, s: styleKey()};
+    }
+  }
+}
+function esc(s) { return s.replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;"); }
+function render() {
+  const out = [];
+  for (const l of screen) {
+    let html = "", run = "", key = null;
+    const flush = () => {
+      if (!run) return;
+      if (!key) { html += esc(run); } else {
+        const [css, ...flags] = key.split("|");
+        html += '<span style="' + css + '" class="' + flags.join(" ") + '">' + esc(run) + "</span>";
+      }
+      run = "";
+    };
+    for (const cell of l) {
+      if (cell.s !== key) { flush(); key = cell.s; }
+      run += cell.ch;
+    }
+    flush();
+    out.push(html);
+  }
+  const term = document.getElementById("term");
+  term.innerHTML = out.join("\n");
+  term.scrollTop = term.scrollHeight;
+}
+function fmt(t) { const s = Math.floor(t); return Math.floor(s / 60) + ":" + String(s % 60).padStart(2, "0"); }
+function speed() { return Number(document.getElementById("speed").value); }
+function advance(t) {
+  if (t < offset) reset();
+  while (next < events.length && events[next][0] <= t) feed(events[next++][2]);
+  offset = t;
+  render();
+  document.getElementById("clock").textContent = fmt(t) + " / " + fmt(total);
+  document.getElementById("seek").value = total ? Math.round(t / total * 1000) : 1000;
+}
+function tick() {
+  if (!playing) return;
+  const t = (performance.now() - startedAt) / 1000 * speed();
+  advance(Math.min(t, total));
+  if (t >= total) { playing = false; document.getElementById("play").textContent = "Play"; return; }
+  requestAnimationFrame(tick);
+}
+function play() {
+  if (offset >= total) advance(0);
+  playing = true;
+  startedAt = performance.now() - offset / speed() * 1000;
+  document.getElementById("play").textContent = "Pause";
+  requestAnimationFrame(tick);
+}
+document.getElementById("play").onclick = () => {
+  if (playing) { playing = false; document.getElementById("play").textContent = "Play"; } else play();
+};
+document.getElementById("seek").oninput = e => {
+  advance(total * e.target.value / 1000);
+  if (playing) startedAt = performance.now() - offset / speed() * 1000;
+};
+document.getElementById("speed").onchange = () => {
+  if (playing) startedAt = performance.now() - offset / speed() * 1000;
+};
+reset();
+advance(total);
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// ForwardSpec is one port forwarded by Forward: connections to the local
+// address Listen are tunneled to Host:Port, as reached from the node.
+type ForwardSpec struct {
+	Listen string
+	Host   string
+	Port   int
+}
+
+// Remote returns the spec's target address.
+func (s ForwardSpec) Remote() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// Forward listens on each spec's local address and tunnels the connections
+// it accepts to the node, all multiplexed over one node connection. It runs
+// until that connection ends.
+func Forward(ctx context.Context, target *Target, specs []ForwardSpec) error {
+	var listeners []net.Listener
+	defer func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}()
+	for _, spec := range specs {
+		ln, err := net.Listen("tcp", spec.Listen)
+		if err != nil {
+			return fmt.Errorf("listening on %s: %w", spec.Listen, err)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	reader, writer, err := target.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	if err := writer.SendRequest(&protocol.Request{Type: "Forward"}); err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	if _, err := expectResponse(reader, "ForwardReady"); err != nil {
+		return err
+	}
+	connection.ExpectStreams(reader)
+
+	streams := connection.NewStreams(writer, func(id uint32) error {
+		return writer.SendRequest(&protocol.Request{Type: "StreamClose", Stream: id})
+	})
+	defer streams.CloseAll()
+
+	var nextID atomic.Uint32
+	for i, ln := range listeners {
+		spec := specs[i]
+		fmt.Printf("Forwarding %s -> %s\n", ln.Addr(), spec.Remote())
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				id := nextID.Add(1)
+				streams.Add(id, conn)
+				if err := writer.SendRequest(&protocol.Request{
+					Type:   "StreamOpen",
+					Stream: id,
+					Host:   spec.Host,
+					Port:   spec.Port,
+				}); err != nil {
+					streams.Closed(id, true)
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			return fmt.Errorf("connection to node lost: %w", err)
+		}
+		if frame == nil {
+			return fmt.Errorf("connection to node closed")
+		}
+
+		switch frame.Type {
+		case protocol.FrameStream:
+			id, data, err := protocol.ParseStream(frame.Payload)
+			if err != nil {
+				return err
+			}
+			streams.Data(id, data)
+
+		case protocol.FrameControl:
+			var resp protocol.Response
+			if err := json.Unmarshal(frame.Payload, &resp); err != nil {
+				return fmt.Errorf("parsing response: %w", err)
+			}
+			switch resp.Type {
+			case "StreamOpened":
+				streams.Start(resp.Stream)
+			case "StreamClose":
+				if resp.Message != "" {
+					fmt.Fprintf(os.Stderr, "[cw] %s\n", resp.Message)
+				}
+				streams.Closed(resp.Stream, resp.Message != "")
+			case "Error":
+				return fmt.Errorf("%s", resp.Message)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// History prints the last limit entries (all when zero) of the node's
+// launch history matching query.
+func History(ctx context.Context, target *Target, query string, limit int, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "HistoryList", Query: query, Limit: limit})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	var entries []protocol.HistoryEntry
+	if resp.History != nil {
+		entries = *resp.History
+	}
+
+	if jsonOutput {
+		if entries == nil {
+			entries = []protocol.HistoryEntry{}
+		}
+		return printJSON(entries)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No history")
+		return nil
+	}
+
+	fmt.Printf("%-5s %-7s %-14s %-14s %-8s %-40s %s\n", "#", "SESSION", "NAME", "STATUS", "STARTED", "COMMAND", "WORKDIR")
+	for _, e := range entries {
+		name := e.Name
+		if name == "" {
+			name = "-"
+		}
+		if len(name) > 14 {
+			name = name[:11] + "..."
+		}
+		command := strings.Join(e.Command, " ")
+		if len(command) > 40 {
+			command = command[:37] + "..."
+		}
+		dir := e.WorkingDir
+		if e.Worktree != "" {
+			dir += " (" + e.Worktree + ")"
+		}
+		fmt.Printf("%-5d %-7d %-14s %-14s %-8s %-40s %s\n", e.Entry, e.SessionID, name, e.Status, formatRelativeTime(e.StartedAt), command, dir)
+	}
+	return nil
+}
+
+// HistoryRerun launches history entry n again, named name (generated if
+// empty). With jsonOutput, the new session's info is printed.
+func HistoryRerun(ctx context.Context, target *Target, n int, name string, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "HistoryRerun", Entry: n, Name: name})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	if resp.Type != "Launched" || resp.ID == nil || resp.Info == nil {
+		return fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+
+	if jsonOutput {
+		return printJSON(resp.Info)
+	}
+	from := fmt.Sprintf("rerun from history entry %d", n)
+	if resp.Status == "queued" {
+		from += ", queued (node is at its session limit)"
+	}
+	fmt.Fprintf(os.Stderr, "Session %d (%s) %s: %s\n", *resp.ID, resp.Name, from, resp.Info.Prompt)
+	return nil
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keySequences are the bytes a terminal sends for the keys cw send --key
+// names, besides ctrl-a to ctrl-z.
+var keySequences = map[string]string{
+	"enter":     "\r",
+	"tab":       "\t",
+	"shift-tab": "\x1b[Z",
+	"esc":       "\x1b",
+	"space":     " ",
+	"backspace": "\x7f",
+	"delete":    "\x1b[3~",
+	"up":        "\x1b[A",
+	"down":      "\x1b[B",
+	"right":     "\x1b[C",
+	"left":      "\x1b[D",
+	"home":      "\x1b[H",
+	"end":       "\x1b[F",
+	"pgup":      "\x1b[5~",
+	"pgdn":      "\x1b[6~",
+}
+
+// KeyNames lists the keys ParseKeys accepts.
+func KeyNames() string {
+	names := make([]string, 0, len(keySequences)+1)
+	for name := range keySequences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(append(names, "ctrl-a..ctrl-z"), ", ")
+}
+
+// ParseKeys returns the bytes a terminal sends for the named keys, in
+// order.
+func ParseKeys(names []string) ([]byte, error) {
+	var data []byte
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if seq, ok := keySequences[key]; ok {
+			data = append(data, seq...)
+			continue
+		}
+		if letter, ok := strings.CutPrefix(key, "ctrl-"); ok && len(letter) == 1 && letter[0] >= 'a' && letter[0] <= 'z' {
+			data = append(data, letter[0]-'a'+1)
+			continue
+		}
+		return nil, fmt.Errorf("unknown key %q (known: %s)", name, KeyNames())
+	}
+	return data, nil
+}
+
+// Unescape interprets the backslash escapes in s: \n, \r, \t, \e (ESC),
+// \\, \xHH and \0NN octal.
+func Unescape(s string) ([]byte, error) {
+	var data []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			data = append(data, s[i])
+			continue
+		}
+		if i+1 == len(s) {
+			return nil, fmt.Errorf("trailing backslash")
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			data = append(data, '\n')
+		case 'r':
+			data = append(data, '\r')
+		case 't':
+			data = append(data, '\t')
+		case 'e':
+			data = append(data, 0x1b)
+		case '\\':
+			data = append(data, '\\')
+		case 'x', '0':
+			base := 16
+			if c == '0' {
+				base = 8
+			}
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("escape \\%c needs two digits", c)
+			}
+			b, err := strconv.ParseUint(s[i+1:i+3], base, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid escape \\%c%s", c, s[i+1:i+3])
+			}
+			data = append(data, byte(b))
+			i += 2
+		default:
+			return nil, fmt.Errorf("unknown escape \\%c", c)
+		}
+	}
+	return data, nil
+}
+
+// DecodeHex decodes s, hex digits that may be separated by spaces, such
+// as "1b 5b 41".
+func DecodeHex(s string) ([]byte, error) {
+	data, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex input: %w", err)
+	}
+	return data, nil
+}
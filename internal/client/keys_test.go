@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"plain", "plain", true},
+		{"", "", true},
+		{`a\nb\rc\td`, "a\nb\rc\td", true},
+		{`\e[A`, "\x1b[A", true},
+		{`back\\slash\\`, `back\slash\`, true},
+		{`\x1b\x5B`, "\x1b[", true},
+		{`\x41`, "A", true},
+		{`\033`, "\x1b", true},
+		{`\000`, "\x00", true},
+		{`\0101`, "\x081", true},
+		{`\x00\xff`, "\x00\xff", true},
+		{`trailing\`, "", false},
+		{`\`, "", false},
+		{`\x`, "", false},
+		{`\x4`, "", false},
+		{`\xg1`, "", false},
+		{`\x+1`, "", false},
+		{`\0`, "", false},
+		{`\03`, "", false},
+		{`\08`, "", false},
+		{`\q`, "", false},
+	}
+	for _, tt := range tests {
+		got, err := Unescape(tt.in)
+		if (err == nil) != tt.ok || string(got) != tt.want {
+			t.Errorf("Unescape(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeHex(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []byte
+		ok   bool
+	}{
+		{"1b5b41", []byte{0x1b, 0x5b, 0x41}, true},
+		{"1b 5b 41", []byte{0x1b, 0x5b, 0x41}, true},
+		{" 0D\t0a\n", []byte{0x0d, 0x0a}, true},
+		{"", []byte{}, true},
+		{"1b5", nil, false},
+		{"1 b 5", nil, false},
+		{"0x1b", nil, false},
+		{"zz", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := DecodeHex(tt.in)
+		if (err == nil) != tt.ok || !bytes.Equal(got, tt.want) {
+			t.Errorf("DecodeHex(%q) = %x, %v; want %x", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+		ok    bool
+	}{
+		{[]string{"ctrl-a"}, "\x01", true},
+		{[]string{"ctrl-c", "ctrl-z"}, "\x03\x1a", true},
+		{[]string{"Ctrl-D"}, "\x04", true},
+		{[]string{"enter"}, "\r", true},
+		{[]string{" Esc ", "up", "tab"}, "\x1b\x1b[A\t", true},
+		{[]string{"shift-tab", "delete", "pgdn"}, "\x1b[Z\x1b[3~\x1b[6~", true},
+		{nil, "", true},
+		{[]string{"ctrl-"}, "", false},
+		{[]string{"ctrl-1"}, "", false},
+		{[]string{"ctrl-ab"}, "", false},
+		{[]string{"enter", "f13"}, "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParseKeys(tt.names)
+		if (err == nil) != tt.ok || string(got) != tt.want {
+			t.Errorf("ParseKeys(%q) = %q, %v; want %q", tt.names, got, err, tt.want)
+		}
+	}
+
+	// Every named key is listed and maps to a non-empty sequence.
+	for name, seq := range keySequences {
+		if got, err := ParseKeys([]string{name}); err != nil || string(got) != seq || seq == "" {
+			t.Errorf("ParseKeys(%q) = %q, %v", name, got, err)
+		}
+		if !strings.Contains(KeyNames(), name) {
+			t.Errorf("KeyNames() does not list %q", name)
+		}
+	}
+}
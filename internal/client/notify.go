@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codewiresh/codewire/internal/notify"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// NotifyOnCompletion waits for a session (id), or every running session with
+// any of tags, to finish and sends a notification for each one with its exit
+// code and the last lines of its output. A session that has already finished
+// is notified immediately.
+func NotifyOnCompletion(ctx context.Context, target *Target, id *uint32, tags []string, method string, lines int) error {
+	notifier, err := notify.Parse(method)
+	if err != nil {
+		return err
+	}
+
+	reader, writer, err := target.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	// Subscribe before checking statuses so no completion is missed.
+	if err := writer.SendRequest(&protocol.Request{
+		Type:       "Subscribe",
+		ID:         id,
+		Tags:       tags,
+		EventTypes: []string{"session.status"},
+	}); err != nil {
+		return err
+	}
+	ackFrame, err := reader.ReadFrame()
+	if err != nil || ackFrame == nil {
+		return fmt.Errorf("waiting for SubscribeAck: %w", err)
+	}
+	var ack protocol.Response
+	if err := json.Unmarshal(ackFrame.Payload, &ack); err != nil || ack.Type != "SubscribeAck" {
+		if ack.Type == "Error" {
+			return fmt.Errorf("%s", formatError(ack.Message))
+		}
+		return fmt.Errorf("expected SubscribeAck, got %q", ack.Type)
+	}
+	frameCh := make(chan frameEvent, 16)
+	go readFrames(reader, frameCh)
+
+	pending := make(map[uint32]protocol.SessionInfo)
+	sessions, err := listSessionsForResolve(ctx, target)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		switch {
+		case id != nil && s.ID == *id:
+			if !sessionLive(s) {
+				return sendCompletionNotice(ctx, target, notifier, s, s.ExitCode, lines)
+			}
+			pending[s.ID] = s
+		case id == nil && sessionLive(s) && hasAnyTag(s.Tags, tags):
+			pending[s.ID] = s
+		}
+	}
+	if len(pending) == 0 {
+		if id != nil {
+			return fmt.Errorf("session %d not found", *id)
+		}
+		return fmt.Errorf("no running sessions with tag %s", strings.Join(tags, ", "))
+	}
+	fmt.Fprintf(os.Stderr, "[cw] waiting for %d session(s) to finish\n", len(pending))
+
+	for fe := range frameCh {
+		if fe.err != nil {
+			return fe.err
+		}
+		if fe.frame == nil {
+			return fmt.Errorf("connection to node closed")
+		}
+		if fe.frame.Type != protocol.FrameControl {
+			continue
+		}
+		var resp protocol.Response
+		if json.Unmarshal(fe.frame.Payload, &resp) != nil {
+			continue
+		}
+		if resp.Type == "Error" {
+			return fmt.Errorf("%s", formatError(resp.Message))
+		}
+		if resp.Type != "Event" || resp.Event == nil || resp.SessionID == nil {
+			continue
+		}
+
+		s, ok := pending[*resp.SessionID]
+		if !ok {
+			continue
+		}
+		var data struct {
+			To       string `json:"to"`
+			ExitCode *int   `json:"exit_code"`
+		}
+		if json.Unmarshal(resp.Event.Data, &data) != nil || data.To == "running" || data.To == "queued" {
+			continue
+		}
+		delete(pending, s.ID)
+		if err := sendCompletionNotice(ctx, target, notifier, s, data.ExitCode, lines); err != nil {
+			fmt.Fprintf(os.Stderr, "[cw] notify error: %v\n", err)
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// sessionLive reports whether s is running or waiting to run.
+func sessionLive(s protocol.SessionInfo) bool {
+	return s.Status == "running" || s.Status == "queued"
+}
+
+// sendCompletionNotice notifies that s finished, including the tail of its
+// output.
+func sendCompletionNotice(ctx context.Context, target *Target, notifier notify.Notifier, s protocol.SessionInfo, exitCode *int, lines int) error {
+	label := fmt.Sprintf("session %d", s.ID)
+	if s.Name != "" {
+		label = fmt.Sprintf("%s (%d)", s.Name, s.ID)
+	}
+	title := "cw: " + label + " finished"
+	if exitCode != nil {
+		if *exitCode == 0 {
+			title = fmt.Sprintf("cw: %s completed (exit 0)", label)
+		} else {
+			title = fmt.Sprintf("cw: %s failed (exit %d)", label, *exitCode)
+		}
+	}
+
+	body := s.Prompt
+	tail := uint(lines)
+	if resp, err := requestResponse(ctx, target, &protocol.Request{Type: "Logs", ID: &s.ID, Tail: &tail}); err == nil && resp.Type == "LogData" {
+		if out := strings.TrimSpace(strings.ReplaceAll(resp.Data, "\r", "")); out != "" {
+			body = out
+		}
+	}
+
+	if err := notifier.Notify(notify.Notification{Title: title, Body: body}); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "[cw] notified: %s\n", title)
+	return nil
+}
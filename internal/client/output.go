@@ -0,0 +1,295 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/relay"
+)
+
+// The types below are what commands print with --json. They are a stable
+// interface for scripts, described by cw schema: add fields to them, but do
+// not rename or remove any.
+
+// LaunchResult is the output of cw run --json.
+type LaunchResult struct {
+	ID       uint32   `json:"id"`
+	Name     string   `json:"name,omitempty"`
+	Status   string   `json:"status"` // "running" or "queued"
+	Command  []string `json:"command"`
+	Worktree string   `json:"worktree,omitempty"`
+	Path     string   `json:"path,omitempty"` // the worktree's directory
+	Node     string   `json:"node,omitempty"` // the node a --node-group placed it on
+}
+
+// KillResult is the output of cw kill --json. ID is set when a single
+// session was killed, Tags and Selector when sessions were killed by tag or
+// label.
+type KillResult struct {
+	ID       *uint32  `json:"id,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Selector string   `json:"selector,omitempty"`
+	Count    uint     `json:"count"`
+}
+
+// ApplyAction is an entry of cw apply --json output: a session of the
+// manifest, or one --prune kills. Action is "launch", "retag", "kill" or
+// "unchanged"; Error is set when the change failed. With --dry-run nothing
+// is changed, and launched sessions have no ID.
+type ApplyAction struct {
+	Action  string   `json:"action"`
+	Name    string   `json:"name"`
+	ID      uint32   `json:"id,omitempty"`
+	Command string   `json:"command"`
+	Tags    []string `json:"tags,omitempty"`
+	OldTags []string `json:"old_tags,omitempty"` // retag: the tags replaced
+	Note    string   `json:"note,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// SendResult is the output of cw send --json.
+type SendResult struct {
+	ID    uint32 `json:"id"`
+	Bytes uint   `json:"bytes"`
+}
+
+// WaitResult is the output of cw wait --json. For --until-output, SessionID
+// and Output are the session and line that matched. ExitCode is what
+// cw wait --exit-code exits with.
+type WaitResult struct {
+	Condition   string                 `json:"condition,omitempty"`
+	UntilOutput string                 `json:"until_output,omitempty"`
+	Met         bool                   `json:"met"`
+	SessionID   *uint32                `json:"session_id,omitempty"`
+	Output      string                 `json:"output,omitempty"`
+	ExitCode    int                    `json:"exit_code"`
+	Sessions    []protocol.SessionInfo `json:"sessions"`
+}
+
+// MessageResult is the output of cw msg --json and cw reply --json.
+type MessageResult struct {
+	MessageID string `json:"message_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"` // the request replied to
+}
+
+// ReplyResult is the output of cw request --json.
+type ReplyResult struct {
+	RequestID string  `json:"request_id,omitempty"`
+	FromID    *uint32 `json:"from_id,omitempty"`
+	FromName  string  `json:"from_name,omitempty"`
+	Body      string  `json:"body"`
+}
+
+// StreamEvent is a line of cw subscribe and cw listen output with --format
+// ndjson: one event, in the same shape whichever command streams it.
+type StreamEvent struct {
+	Type      string          `json:"type"`
+	Session   StreamSession   `json:"session"`
+	Node      string          `json:"node"`
+	Timestamp string          `json:"timestamp"` // RFC 3339
+	Data      json.RawMessage `json:"data"`
+	// Seq numbers the event in the node's event journal: cw subscribe
+	// --from-seq resumes after the last one seen.
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// StreamSession identifies the session a StreamEvent happened in.
+type StreamSession struct {
+	ID   uint32 `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// KVEntry is the output of cw kv get --json, and an entry of cw kv list
+// --json. Value is null when cw kv get finds no such key.
+type KVEntry struct {
+	Namespace string  `json:"namespace"`
+	Key       string  `json:"key"`
+	Value     *string `json:"value"`
+	ExpiresAt *string `json:"expires_at,omitempty"`
+}
+
+// NodeInfo is an entry of cw nodes --json.
+type NodeInfo struct {
+	Name       string            `json:"name"`
+	TunnelURL  string            `json:"tunnel_url"`
+	Connected  bool              `json:"connected"`
+	LastSeenAt time.Time         `json:"last_seen_at"`
+	Status     *relay.NodeStatus `json:"status,omitempty"` // as last reported
+}
+
+// outputs maps each command with --json output to the type it prints.
+var outputs = map[string]reflect.Type{
+	"apply":         reflect.TypeFor[[]ApplyAction](),
+	"cron list":     reflect.TypeFor[[]protocol.CronJob](),
+	"fork":          reflect.TypeFor[protocol.SessionInfo](),
+	"history":       reflect.TypeFor[[]protocol.HistoryEntry](),
+	"history rerun": reflect.TypeFor[protocol.SessionInfo](),
+	"inbox":         reflect.TypeFor[[]protocol.MessageResponse](),
+	"key list":      reflect.TypeFor[[]sshKeyEntry](),
+	"kill":          reflect.TypeFor[KillResult](),
+	"kv get":        reflect.TypeFor[KVEntry](),
+	"kv list":       reflect.TypeFor[[]KVEntry](),
+	"list":          reflect.TypeFor[[]protocol.SessionInfo](),
+	"listen":        reflect.TypeFor[StreamEvent](),
+	"msg":           reflect.TypeFor[MessageResult](),
+	"nodes":         reflect.TypeFor[[]NodeInfo](),
+	"pipe":          reflect.TypeFor[protocol.Pipe](),
+	"pipe list":     reflect.TypeFor[[]protocol.Pipe](),
+	"reply":         reflect.TypeFor[MessageResult](),
+	"request":       reflect.TypeFor[ReplyResult](),
+	"run":           reflect.TypeFor[LaunchResult](),
+	"send":          reflect.TypeFor[SendResult](),
+	"status":        reflect.TypeFor[protocol.SessionInfo](),
+	"subscribe":     reflect.TypeFor[StreamEvent](),
+	"wait":          reflect.TypeFor[WaitResult](),
+	"worktree list": reflect.TypeFor[[]protocol.Worktree](),
+}
+
+// printJSON prints v as indented JSON.
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// printStreamEvent prints the event in resp, an Event response, as a line
+// of NDJSON.
+func printStreamEvent(resp *protocol.Response) {
+	data, _ := json.Marshal(StreamEvent{
+		Type:      resp.Event.EventType,
+		Session:   StreamSession{ID: *resp.SessionID, Name: resp.Name},
+		Node:      resp.Node,
+		Timestamp: resp.Event.Timestamp,
+		Data:      resp.Event.Data,
+		Seq:       resp.Event.Seq,
+	})
+	fmt.Println(string(data))
+}
+
+// Schema prints the JSON Schema of command's --json output, or with no
+// command, an object mapping every such command to its schema.
+func Schema(command string) error {
+	if command == "" {
+		all := make(map[string]any, len(outputs))
+		for name, t := range outputs {
+			all[name] = JSONSchema(t)
+		}
+		return printJSON(all)
+	}
+	t, ok := outputs[command]
+	if !ok {
+		return fmt.Errorf("no JSON output for %q (commands: %s)", command, strings.Join(SchemaCommands(), ", "))
+	}
+	return printJSON(JSONSchema(t))
+}
+
+// SchemaCommands lists the commands with --json output, sorted.
+func SchemaCommands() []string {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// JSONSchema describes how encoding/json encodes t, as a JSON Schema. Fields
+// without omitempty are required.
+func JSONSchema(t reflect.Type) map[string]any {
+	s := schemaOf(t, map[reflect.Type]bool{})
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	return s
+}
+
+func schemaOf(t reflect.Type, seen map[reflect.Type]bool) map[string]any {
+	switch t {
+	case reflect.TypeFor[json.RawMessage]():
+		return map[string]any{} // any JSON value
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem(), seen)
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]any{"type": "object"} // recursive type
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		props := map[string]any{}
+		required := []string{}
+		structFields(t, props, &required, seen)
+		s := map[string]any{"type": "object", "properties": props}
+		if t.Name() != "" {
+			s["title"] = t.Name()
+		}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	return map[string]any{}
+}
+
+// structFields adds the properties encoding/json encodes for t's fields,
+// including those of embedded structs.
+func structFields(t reflect.Type, props map[string]any, required *[]string, seen map[reflect.Type]bool) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				structFields(ft, props, required, seen)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		schema := schemaOf(f.Type, seen)
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") {
+			*required = append(*required, name)
+			if f.Type.Kind() == reflect.Pointer {
+				schema = map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+			}
+		}
+		props[name] = schema
+	}
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// PipeAdd asks the node to forward session from's output lines matching
+// grep, rewritten by replace, into session to's input.
+func PipeAdd(ctx context.Context, target *Target, from, to uint32, grep, replace string, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type:    "PipeAdd",
+		ID:      &from,
+		ToID:    &to,
+		Grep:    grep,
+		Replace: replace,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	if resp.Pipes == nil || len(*resp.Pipes) != 1 {
+		return fmt.Errorf("unexpected response: %s", resp.Type)
+	}
+	p := (*resp.Pipes)[0]
+	if jsonOutput {
+		data, _ := json.MarshalIndent(p, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Pipe %d: session %d → session %d\n", p.ID, p.From, p.To)
+	return nil
+}
+
+// PipeList prints the node's pipes.
+func PipeList(ctx context.Context, target *Target, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "PipeList"})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	var pipes []protocol.Pipe
+	if resp.Pipes != nil {
+		pipes = *resp.Pipes
+	}
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(pipes, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(pipes) == 0 {
+		fmt.Println("No pipes")
+		return nil
+	}
+
+	fmt.Printf("%-6s %-6s %-6s %-8s %-10s %s\n", "ID", "FROM", "TO", "LINES", "CREATED", "FILTER")
+	for _, p := range pipes {
+		filter := "-"
+		if p.Grep != "" {
+			filter = p.Grep
+			if p.Replace != "" {
+				filter += " → " + p.Replace
+			}
+		}
+		lines := fmt.Sprint(p.Lines)
+		if p.Dropped > 0 {
+			lines += fmt.Sprintf(" (%d dropped)", p.Dropped)
+		}
+		fmt.Printf("%-6d %-6d %-6d %-8s %-10s %s\n", p.ID, p.From, p.To, lines, formatRelativeTime(p.CreatedAt), filter)
+	}
+	return nil
+}
+
+// PipeRemove stops a pipe.
+func PipeRemove(ctx context.Context, target *Target, id uint32) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "PipeRemove", Pipe: id})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	fmt.Fprintf(os.Stderr, "Removed pipe %d\n", id)
+	return nil
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Watch, subscribe and attach streams to a remote node outlive the
+// connection: when it drops, they reconnect with exponential backoff and
+// resume where they left off, from the log offset of the last output or the
+// sequence number of the last event received.
+const (
+	reconnectBackoff    = 250 * time.Millisecond
+	reconnectMaxBackoff = 10 * time.Second
+	// reconnectTimeout is how long a stream keeps trying before giving up.
+	reconnectTimeout = 5 * time.Minute
+)
+
+// refusedError is the node's answer to a resumed request; reconnecting
+// again will not change it.
+type refusedError struct{ message string }
+
+func (e *refusedError) Error() string { return formatError(e.message) }
+
+// canResume reports whether a stream to target whose connection failed
+// should reconnect: the target is remote and ctx is not what ended it.
+func canResume(ctx context.Context, target *Target) bool {
+	return !target.IsLocal() && ctx.Err() == nil
+}
+
+// openStream connects to target and sends req.
+func openStream(ctx context.Context, target *Target, req *protocol.Request) (connection.FrameReader, connection.FrameWriter, error) {
+	reader, writer, err := target.Connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writer.SendRequest(req); err != nil {
+		reader.Close()
+		writer.Close()
+		return nil, nil, fmt.Errorf("sending %s request: %w", req.Type, err)
+	}
+	return reader, writer, nil
+}
+
+// reconnect calls dial, after a backoff doubling each time, until it
+// succeeds, fails with a *refusedError, ctx is done or reconnectTimeout
+// passes.
+func reconnect(ctx context.Context, dial func() error) error {
+	deadline := time.Now().Add(reconnectTimeout)
+	backoff := reconnectBackoff
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		err := dial()
+		var refused *refusedError
+		if err == nil || errors.As(err, &refused) || ctx.Err() != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("giving up reconnecting after %s: %w", reconnectTimeout, err)
+		}
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplayOptions controls cw replay.
+type ReplayOptions struct {
+	Speed   float64       // playback rate; 2 plays twice as fast
+	From    time.Duration // skip ahead to this point in the recording
+	MaxIdle time.Duration // cap pauses between output at this length (0: no cap)
+}
+
+// Replay plays a session's recorded output back in the terminal with its
+// original timing. Output before opts.From is written immediately so the
+// screen is in the right state when timed playback starts.
+func Replay(ctx context.Context, target *Target, id uint32, opts ReplayOptions) error {
+	if opts.Speed <= 0 {
+		opts.Speed = 1
+	}
+
+	rec, err := fetchRecording(ctx, target, id)
+	if err != nil {
+		return err
+	}
+	if len(rec.chunks) == 0 {
+		return fmt.Errorf("session %d has no recorded output", id)
+	}
+	if opts.From > rec.duration() {
+		return fmt.Errorf("--from %s is past the end of the recording (%s)", formatClock(opts.From), formatClock(rec.duration()))
+	}
+
+	out := os.Stdout
+	prev := opts.From
+	for _, c := range rec.chunks {
+		offset := c.at.Sub(rec.start)
+		if offset > opts.From {
+			wait := offset - prev
+			if opts.MaxIdle > 0 && wait > opts.MaxIdle {
+				wait = opts.MaxIdle
+			}
+			select {
+			case <-ctx.Done():
+				fmt.Fprint(out, colorReset)
+				return ctx.Err()
+			case <-time.After(time.Duration(float64(wait) / opts.Speed)):
+			}
+			prev = offset
+		}
+		out.WriteString(c.data)
+	}
+
+	fmt.Fprintf(out, "%s\n[cw] replay of session %d finished (%s)\n", colorReset, id, formatClock(rec.duration()))
+	return nil
+}
+
+// ParseSpeed parses a playback speed such as "2x", "0.5x", or "3".
+func ParseSpeed(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(s), "x"), 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid speed %q (e.g. 2x, 0.5x)", s)
+	}
+	return v, nil
+}
+
+// ParseClock parses a position in a recording given as hh:mm:ss, mm:ss,
+// seconds, or a Go duration (e.g. 5m30s).
+func ParseClock(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q (use hh:mm:ss)", s)
+	}
+	var total float64
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid time %q (use hh:mm:ss)", s)
+		}
+		total = total*60 + v
+	}
+	return time.Duration(total * float64(time.Second)), nil
+}
+
+// formatClock formats d as hh:mm:ss.
+func formatClock(d time.Duration) string {
+	s := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Script is a cw script run file: steps run in order against a session.
+// Timeout is how long each step waits for its expect pattern unless it
+// sets its own (default 30s).
+type Script struct {
+	Timeout string       `yaml:"timeout"`
+	Steps   []ScriptStep `yaml:"steps"`
+}
+
+// ScriptStep waits for output matching Expect, a Go regular expression, if
+// set, then sends Send followed by Keys (see ParseKeys), if set.
+type ScriptStep struct {
+	Expect  string   `yaml:"expect"`
+	Send    string   `yaml:"send"`
+	Keys    []string `yaml:"keys"`
+	Timeout string   `yaml:"timeout"`
+}
+
+// LoadScript reads a cw script run file, or stdin if path is "-", into the
+// steps the node runs. Unknown fields are errors, so that a misspelt one is
+// not silently ignored.
+func LoadScript(path string) ([]protocol.ScriptStep, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Script
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(s.Steps) == 0 {
+		return nil, fmt.Errorf("%s: no steps", path)
+	}
+
+	parseTimeout := func(v string) (int64, error) {
+		if v == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid timeout %q (e.g. 10s, 2m)", v)
+		}
+		return d.Milliseconds(), nil
+	}
+	defaultTimeout, err := parseTimeout(s.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	steps := make([]protocol.ScriptStep, len(s.Steps))
+	for i, st := range s.Steps {
+		if st.Expect == "" && st.Send == "" && len(st.Keys) == 0 {
+			return nil, fmt.Errorf("%s: step %d has neither expect nor send nor keys", path, i+1)
+		}
+		keys, err := ParseKeys(st.Keys)
+		if err != nil {
+			return nil, fmt.Errorf("%s: step %d: %w", path, i+1, err)
+		}
+		timeout, err := parseTimeout(st.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s: step %d: %w", path, i+1, err)
+		}
+		if timeout == 0 {
+			timeout = defaultTimeout
+		}
+		steps[i] = protocol.ScriptStep{
+			Expect:    st.Expect,
+			Send:      st.Send + string(keys),
+			TimeoutMs: timeout,
+		}
+	}
+	return steps, nil
+}
+
+// RunScript has the node run steps against session id, as session fromID
+// if set, and prints what each step matched. It fails if a step does,
+// after printing the output that step saw.
+func RunScript(ctx context.Context, target *Target, id uint32, fromID *uint32, steps []protocol.ScriptStep, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type:   "RunScript",
+		ID:     &id,
+		FromID: fromID,
+		Script: steps,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	if resp.Script == nil {
+		return fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+	result := *resp.Script
+
+	if jsonOutput {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	} else {
+		for i, match := range result.Matches {
+			step := steps[i]
+			switch {
+			case step.Expect != "" && step.Send != "":
+				fmt.Fprintf(os.Stderr, "step %d: matched %q, sent %q\n", i+1, match, step.Send)
+			case step.Expect != "":
+				fmt.Fprintf(os.Stderr, "step %d: matched %q\n", i+1, match)
+			default:
+				fmt.Fprintf(os.Stderr, "step %d: sent %q\n", i+1, step.Send)
+			}
+		}
+		if result.Error != "" && result.Output != "" {
+			fmt.Fprintf(os.Stderr, "--- output since the last match ---\n%s\n---\n", result.Output)
+		}
+	}
+	if result.Error != "" {
+		return fmt.Errorf("script failed at %s", result.Error)
+	}
+	if !jsonOutput {
+		fmt.Fprintf(os.Stderr, "Script completed: %d steps\n", result.Steps)
+	}
+	return nil
+}
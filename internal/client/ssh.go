@@ -0,0 +1,262 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/update"
+)
+
+// SSH targets (--server ssh://[user@]host[:port]) use a node on a host that
+// is only reachable over SSH. The client runs `cw node stdio` on the host
+// with the ssh command, which starts the node there if needed and relays
+// frames between its stdin/stdout and the node's socket. Hosts without cw
+// get a copy in ~/.codewire/bin.
+
+// StdioHello is the line cw node stdio writes once it is connected to the
+// node, before relaying frames.
+const StdioHello = "codewire\n"
+
+// sshStdioCommand runs cw node stdio on the host, exiting 127 if there is
+// no cw on its PATH or in ~/.codewire/bin.
+const sshStdioCommand = `sh -c 'PATH="$HOME/.codewire/bin:$PATH"; command -v cw >/dev/null 2>&1 || exit 127; exec cw node stdio'`
+
+// sshInstallCommand writes the cw binary read from stdin to ~/.codewire/bin.
+const sshInstallCommand = `sh -c 'mkdir -p "$HOME/.codewire/bin" && cat > "$HOME/.codewire/bin/cw.tmp" && chmod 755 "$HOME/.codewire/bin/cw.tmp" && mv "$HOME/.codewire/bin/cw.tmp" "$HOME/.codewire/bin/cw"'`
+
+// errNoRemoteCW means the SSH host has no cw to run.
+var errNoRemoteCW = errors.New("cw is not installed")
+
+// sshArgs returns the ssh arguments running remote on the host of dest, an
+// ssh:// URL.
+func sshArgs(dest string, remote string) ([]string, error) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "ssh" || u.Hostname() == "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("invalid SSH server %q (want ssh://[user@]host[:port])", dest)
+	}
+	host := u.Hostname()
+	if u.User != nil {
+		host = u.User.Username() + "@" + host
+	}
+	args := []string{"-T"}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	return append(args, "--", host, remote), nil
+}
+
+// sshCommand returns the ssh command running remote on the host of dest,
+// killed when ctx is done.
+func sshCommand(ctx context.Context, dest string, remote string) (*exec.Cmd, error) {
+	args, err := sshArgs(dest, remote)
+	if err != nil {
+		return nil, err
+	}
+	return exec.CommandContext(ctx, "ssh", args...), nil
+}
+
+// connectSSH runs cw node stdio on the target's SSH host, installing cw
+// there first if the host has none. When ctx is done ssh is killed.
+func (t *Target) connectSSH(ctx context.Context) (connection.FrameReader, connection.FrameWriter, error) {
+	conn, err := dialSSH(ctx, t.SSH)
+	if errors.Is(err, errNoRemoteCW) {
+		if err := t.installSSH(ctx); err != nil {
+			return nil, nil, fmt.Errorf("installing cw on %s: %w", t.SSH, err)
+		}
+		conn, err = dialSSH(ctx, t.SSH)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return connection.NewStreamReader(conn.reader()), connection.NewStreamWriter(conn.writer()), nil
+}
+
+// sshConn is an ssh process running cw node stdio.
+type sshConn struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    *bufio.Reader
+	closeOnce sync.Once
+}
+
+func dialSSH(ctx context.Context, dest string) (*sshConn, error) {
+	cmd, err := sshCommand(ctx, dest, sshStdioCommand)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("running ssh: %w", err)
+	}
+
+	br := bufio.NewReader(stdout)
+	line, readErr := br.ReadString('\n')
+	if readErr == nil && line == StdioHello {
+		return &sshConn{cmd: cmd, stdin: stdin, stdout: br}, nil
+	}
+	stdin.Close()
+	waitErr := cmd.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if line == "" && errors.As(waitErr, &exitErr) && exitErr.ExitCode() == 127 {
+		return nil, errNoRemoteCW
+	}
+	if waitErr != nil {
+		return nil, fmt.Errorf("ssh %s: %w", dest, waitErr)
+	}
+	return nil, fmt.Errorf("ssh %s: unexpected reply %q from cw node stdio", dest, line)
+}
+
+// close ends the session: closing stdin makes cw node stdio disconnect from
+// the node and exit, which ends ssh.
+func (c *sshConn) close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		done := make(chan struct{})
+		go func() {
+			c.cmd.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			c.cmd.Process.Kill()
+		}
+	})
+	return nil
+}
+
+func (c *sshConn) reader() io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{c.stdout, closerFunc(c.close)}
+}
+
+func (c *sshConn) writer() io.WriteCloser {
+	return struct {
+		io.Writer
+		io.Closer
+	}{c.stdin, closerFunc(c.close)}
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// installSSH copies cw to ~/.codewire/bin on the target's SSH host: this
+// executable if the host's platform is the same, or else the release of
+// t.Version for the host's platform.
+func (t *Target) installSSH(ctx context.Context) error {
+	cmd, err := sshCommand(ctx, t.SSH, "uname -sm")
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("detecting platform: %w", err)
+	}
+	goos, goarch, ok := unamePlatform(string(out))
+	if !ok {
+		return fmt.Errorf("unsupported platform %q", strings.TrimSpace(string(out)))
+	}
+
+	var binary []byte
+	if goos == runtime.GOOS && goarch == runtime.GOARCH {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("locating cw executable: %w", err)
+		}
+		if binary, err = os.ReadFile(exe); err != nil {
+			return err
+		}
+	} else {
+		if !update.ValidVersion(t.Version) {
+			return fmt.Errorf("a %s build of cw cannot download cw for %s/%s; install cw on the host", t.Version, goos, goarch)
+		}
+		if binary, err = update.FetchSigned(t.Version, goos, goarch, "", ""); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "[cw] installing cw for %s/%s in ~/.codewire/bin on %s\n", goos, goarch, t.SSH)
+	if cmd, err = sshCommand(ctx, t.SSH, sshInstallCommand); err != nil {
+		return err
+	}
+	cmd.Stdin = bytes.NewReader(binary)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// unamePlatform maps the output of uname -sm to GOOS and GOARCH.
+func unamePlatform(uname string) (goos, goarch string, ok bool) {
+	fields := strings.Fields(uname)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	switch fields[0] {
+	case "Linux":
+		goos = "linux"
+	case "Darwin":
+		goos = "darwin"
+	default:
+		return "", "", false
+	}
+	switch fields[1] {
+	case "x86_64", "amd64":
+		goarch = "amd64"
+	case "aarch64", "arm64":
+		goarch = "arm64"
+	default:
+		return "", "", false
+	}
+	return goos, goarch, true
+}
+
+// ServeStdio relays frames between in/out and the node in dataDir, for
+// cw node stdio. It writes StdioHello once connected and returns when the
+// node closes the connection, which it does once in reaches EOF.
+func ServeStdio(dataDir string, in io.Reader, out io.Writer) error {
+	conn, err := net.Dial("unix", filepath.Join(dataDir, "codewire.sock"))
+	if err != nil {
+		return fmt.Errorf("connecting to node: %w", err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(out, StdioHello); err != nil {
+		return err
+	}
+
+	go func() {
+		io.Copy(conn, in)
+		if uc, ok := conn.(*net.UnixConn); ok {
+			uc.CloseWrite()
+		}
+	}()
+	_, err = io.Copy(out, conn)
+	return err
+}
@@ -0,0 +1,24 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// ExportState has the local node of target write its state, KV entries
+// included, to path, an absolute path (see node.ExportState).
+func ExportState(ctx context.Context, target *Target, path string) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "ExportState", Path: path})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	if resp.Type != "StateExported" {
+		return fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+	return nil
+}
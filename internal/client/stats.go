@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Stats prints the usage of session id, or with id nil, of every session
+// created in the last since (every session if zero) and their total.
+func Stats(ctx context.Context, target *Target, id *uint32, since time.Duration, jsonOutput bool) error {
+	req := &protocol.Request{Type: "SessionStats", ID: id}
+	if since > 0 {
+		req.Since = time.Now().Add(-since).UTC().Format(time.RFC3339Nano)
+	}
+	resp, err := requestResponse(ctx, target, req)
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	if resp.Stats == nil {
+		return fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+	stats := *resp.Stats
+
+	if id != nil {
+		if len(stats) != 1 {
+			return fmt.Errorf("unexpected response: %d sessions", len(stats))
+		}
+		if jsonOutput {
+			return printJSON(stats[0])
+		}
+		printSessionStats(stats[0])
+		return nil
+	}
+
+	total := totalStats(stats)
+	if jsonOutput {
+		return printJSON(struct {
+			Sessions []protocol.SessionStats `json:"sessions"`
+			Total    protocol.SessionStats   `json:"total"`
+		}{stats, total})
+	}
+	if len(stats) == 0 {
+		fmt.Println("No sessions")
+		return nil
+	}
+	fmt.Printf("%-5s %-14s %-14s %-9s %-10s %-10s %-9s %-9s %-16s %s\n", "ID", "NAME", "STATUS", "RUNTIME", "OUTPUT", "INPUT", "MESSAGES", "APPROVALS", "TOKENS", "COST")
+	row := func(id, name string, st protocol.SessionStats) {
+		if len(name) > 14 {
+			name = name[:11] + "..."
+		}
+		fmt.Printf("%-5s %-14s %-14s %-9s %-10s %-10s %-9s %-9s %-16s %s\n",
+			id, name, st.Status, formatRuntime(st.RuntimeMs),
+			formatByteSize(int64(st.OutputBytes)), formatByteSize(int64(st.InputBytes)),
+			fmt.Sprintf("%d/%d", st.MessagesSent, st.MessagesReceived),
+			fmt.Sprintf("%d/%d", st.ApprovalsRequested, st.ApprovalsDenied),
+			formatTokens(st), formatCost(st))
+	}
+	for _, st := range stats {
+		name := st.Name
+		if name == "" {
+			name = "-"
+		}
+		row(strconv.Itoa(int(st.ID)), name, st)
+	}
+	row("", "TOTAL", total)
+	fmt.Println("\nMESSAGES are sent/received; APPROVALS are requested/denied.")
+	return nil
+}
+
+// totalStats sums stats; its Status is the number of sessions.
+func totalStats(stats []protocol.SessionStats) protocol.SessionStats {
+	total := protocol.SessionStats{Status: fmt.Sprintf("%d sessions", len(stats))}
+	for _, st := range stats {
+		total.RuntimeMs += st.RuntimeMs
+		total.OutputBytes += st.OutputBytes
+		total.OutputLines += st.OutputLines
+		total.InputBytes += st.InputBytes
+		total.MessagesSent += st.MessagesSent
+		total.MessagesReceived += st.MessagesReceived
+		total.ApprovalsRequested += st.ApprovalsRequested
+		total.ApprovalsDenied += st.ApprovalsDenied
+		total.InputTokens += st.InputTokens
+		total.OutputTokens += st.OutputTokens
+		total.CostUSD += st.CostUSD
+	}
+	return total
+}
+
+func printSessionStats(st protocol.SessionStats) {
+	fmt.Printf("Session %d", st.ID)
+	if st.Name != "" {
+		fmt.Printf(" (%s)", st.Name)
+	}
+	fmt.Println()
+	fmt.Printf("  Command:   %s\n", st.Command)
+	fmt.Printf("  Status:    %s\n", st.Status)
+	fmt.Printf("  Runtime:   %s\n", formatRuntime(st.RuntimeMs))
+	fmt.Printf("  Output:    %s, %d lines\n", formatByteSize(int64(st.OutputBytes)), st.OutputLines)
+	fmt.Printf("  Input:     %s\n", formatByteSize(int64(st.InputBytes)))
+	fmt.Printf("  Messages:  %d sent, %d received\n", st.MessagesSent, st.MessagesReceived)
+	fmt.Printf("  Approvals: %d requested, %d denied\n", st.ApprovalsRequested, st.ApprovalsDenied)
+	if st.Agent != "" {
+		fmt.Printf("  Agent:     %s\n", st.Agent)
+		fmt.Printf("  Tokens:    %s\n", formatTokens(st))
+		fmt.Printf("  Cost:      %s\n", formatCost(st))
+	}
+}
+
+func formatRuntime(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Second).String()
+}
+
+// formatTokens formats input and output tokens as "in/out", or "-" if none
+// were reported.
+func formatTokens(st protocol.SessionStats) string {
+	if st.InputTokens == 0 && st.OutputTokens == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d", st.InputTokens, st.OutputTokens)
+}
+
+func formatCost(st protocol.SessionStats) string {
+	if st.CostUSD == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("$%.2f", st.CostUSD)
+}
+
+// ParseAge parses a duration such as 90m or 24h, which may also be given in
+// days, such as 7d.
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.ParseFloat(days, 64); err == nil && n >= 0 {
+			return time.Duration(n * float64(24*time.Hour)), nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid duration %q (e.g. 90m, 24h, 7d)", s)
+}
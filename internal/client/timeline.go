@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Timeline prints session id's audit trail, oldest first, keeping only the
+// entries of kinds if any are given.
+func Timeline(ctx context.Context, target *Target, id uint32, kinds []string, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{
+		Type: "Timeline",
+		ID:   &id,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	if resp.Timeline == nil {
+		return fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+	entries := *resp.Timeline
+	if len(kinds) > 0 {
+		entries = slices.DeleteFunc(entries, func(e protocol.TimelineEntry) bool {
+			return !slices.Contains(kinds, e.Kind)
+		})
+	}
+
+	if jsonOutput {
+		return printJSON(entries)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No events")
+		return nil
+	}
+	for _, e := range entries {
+		at := e.Time
+		if t, err := time.Parse(time.RFC3339, e.Time); err == nil {
+			at = t.Local().Format("2006-01-02 15:04:05")
+		}
+		summary := strings.ReplaceAll(e.Summary, "\n", " ")
+		if len(summary) > 200 {
+			summary = summary[:197] + "..."
+		}
+		fmt.Printf("%s  %-9s  %s\n", at, e.Kind, summary)
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/terminal"
+)
+
+// tmuxSessionOption is the pane user option that records which codewire
+// session a pane is attached to, so layouts can be saved and restored.
+const tmuxSessionOption = "@cw-session"
+
+// AttachTmux opens a tmux session with one tiled pane per running session
+// that has any of tags (all running sessions when tags is empty). Each pane
+// runs `cw attach <id>`; cwArgs is the cw executable followed by any global
+// flags (e.g. --server) the panes should pass through. If the tmux session
+// already exists it is reattached instead of being rebuilt.
+func AttachTmux(ctx context.Context, target *Target, tags []string, cwArgs []string) error {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return fmt.Errorf("tmux not found in PATH")
+	}
+
+	name := "cw"
+	if len(tags) > 0 {
+		name = "cw-" + strings.Join(tags, "-")
+	}
+	name = sanitizeTmuxName(name)
+
+	if exec.Command("tmux", "has-session", "-t", "="+name).Run() == nil {
+		return tmuxAttach(name)
+	}
+
+	sessions, err := listSessions(ctx, target, ListOptions{Status: "running", Tags: tags})
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		if len(tags) > 0 {
+			return fmt.Errorf("no running sessions with tag %s", strings.Join(tags, ", "))
+		}
+		return fmt.Errorf("no running sessions")
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+
+	ids := make([]uint32, len(sessions))
+	labels := make(map[uint32]string, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.ID
+		labels[s.ID] = tmuxPaneTitle(s)
+	}
+
+	win := config.LayoutWindow{Name: name, Sessions: ids}
+	if err := tmuxBuild(name, []config.LayoutWindow{win}, labels, cwArgs); err != nil {
+		return err
+	}
+	return tmuxAttach(name)
+}
+
+// SaveLayout records the panes of tmuxSession that are attached to codewire
+// sessions, together with each window's tmux layout, under name. An empty
+// tmuxSession means the tmux session this command is running in.
+func SaveLayout(dataDir, name, tmuxSession string) error {
+	if tmuxSession == "" {
+		if os.Getenv("TMUX") == "" {
+			return fmt.Errorf("not inside tmux; pass --tmux-session")
+		}
+		out, err := tmuxOutput("display-message", "-p", "#S")
+		if err != nil {
+			return err
+		}
+		tmuxSession = strings.TrimSpace(out)
+	}
+
+	// tmux escapes control characters in format output, so fields are
+	// separated by "|", which cannot appear in an index or layout string.
+	out, err := tmuxOutput("list-windows", "-t", "="+tmuxSession, "-F", "#{window_index}|#{window_layout}|#{window_name}")
+	if err != nil {
+		return err
+	}
+	var windows []config.LayoutWindow
+	index := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.SplitN(line, "|", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		index[fields[0]] = len(windows)
+		windows = append(windows, config.LayoutWindow{Name: fields[2], Layout: fields[1]})
+	}
+
+	out, err = tmuxOutput("list-panes", "-s", "-t", "="+tmuxSession, "-F", "#{window_index}|#{"+tmuxSessionOption+"}")
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		winIdx, idStr, ok := strings.Cut(line, "|")
+		if !ok || idStr == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			continue
+		}
+		if i, ok := index[winIdx]; ok {
+			windows[i].Sessions = append(windows[i].Sessions, uint32(id))
+		}
+	}
+
+	layout := config.Layout{TmuxSession: tmuxSession}
+	for _, w := range windows {
+		if len(w.Sessions) > 0 {
+			layout.Windows = append(layout.Windows, w)
+		}
+	}
+	if len(layout.Windows) == 0 {
+		return fmt.Errorf("no codewire panes in tmux session %s", tmuxSession)
+	}
+
+	layouts, err := config.LoadLayoutsConfig(dataDir)
+	if err != nil {
+		return err
+	}
+	layouts.Layouts[name] = layout
+	if err := layouts.Save(dataDir); err != nil {
+		return err
+	}
+
+	panes := 0
+	for _, w := range layout.Windows {
+		panes += len(w.Sessions)
+	}
+	fmt.Printf("Saved layout %s (%d windows, %d panes)\n", name, len(layout.Windows), panes)
+	return nil
+}
+
+// RestoreLayout rebuilds the saved layout name in a new tmux session and
+// attaches to it. Panes for sessions that no longer exist are dropped; a
+// window whose pane count changed falls back to a tiled layout.
+func RestoreLayout(ctx context.Context, target *Target, dataDir, name string, cwArgs []string) error {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return fmt.Errorf("tmux not found in PATH")
+	}
+
+	layouts, err := config.LoadLayoutsConfig(dataDir)
+	if err != nil {
+		return err
+	}
+	layout, ok := layouts.Layouts[name]
+	if !ok {
+		return fmt.Errorf("no saved layout named %s", name)
+	}
+
+	tmuxSession := sanitizeTmuxName(layout.TmuxSession)
+	if tmuxSession == "" {
+		tmuxSession = sanitizeTmuxName("cw-" + name)
+	}
+	if exec.Command("tmux", "has-session", "-t", "="+tmuxSession).Run() == nil {
+		return fmt.Errorf("tmux session %s already exists", tmuxSession)
+	}
+
+	sessions, err := listSessionsForResolve(ctx, target)
+	if err != nil {
+		return err
+	}
+	labels := make(map[uint32]string, len(sessions))
+	for _, s := range sessions {
+		labels[s.ID] = tmuxPaneTitle(s)
+	}
+
+	var windows []config.LayoutWindow
+	for _, w := range layout.Windows {
+		var kept []uint32
+		for _, id := range w.Sessions {
+			if _, ok := labels[id]; ok {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		if len(kept) != len(w.Sessions) {
+			w.Layout = ""
+		}
+		w.Sessions = kept
+		windows = append(windows, w)
+	}
+	if len(windows) == 0 {
+		return fmt.Errorf("none of the sessions in layout %s still exist", name)
+	}
+
+	if err := tmuxBuild(tmuxSession, windows, labels, cwArgs); err != nil {
+		return err
+	}
+	return tmuxAttach(tmuxSession)
+}
+
+// ListLayouts prints the saved layouts.
+func ListLayouts(dataDir string) error {
+	layouts, err := config.LoadLayoutsConfig(dataDir)
+	if err != nil {
+		return err
+	}
+	if len(layouts.Layouts) == 0 {
+		fmt.Println("No saved layouts")
+		return nil
+	}
+
+	names := make([]string, 0, len(layouts.Layouts))
+	for n := range layouts.Layouts {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("%-20s %-20s %s\n", "NAME", "TMUX SESSION", "SESSIONS")
+	for _, n := range names {
+		l := layouts.Layouts[n]
+		var ids []string
+		for _, w := range l.Windows {
+			for _, id := range w.Sessions {
+				ids = append(ids, strconv.FormatUint(uint64(id), 10))
+			}
+		}
+		fmt.Printf("%-20s %-20s %s\n", n, l.TmuxSession, strings.Join(ids, ","))
+	}
+	return nil
+}
+
+// DeleteLayout removes a saved layout.
+func DeleteLayout(dataDir, name string) error {
+	layouts, err := config.LoadLayoutsConfig(dataDir)
+	if err != nil {
+		return err
+	}
+	if _, ok := layouts.Layouts[name]; !ok {
+		return fmt.Errorf("no saved layout named %s", name)
+	}
+	delete(layouts.Layouts, name)
+	if err := layouts.Save(dataDir); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted layout %s\n", name)
+	return nil
+}
+
+// tmuxBuild creates a detached tmux session with the given windows, one pane
+// per session ID, each running `cw attach <id>`.
+func tmuxBuild(name string, windows []config.LayoutWindow, labels map[uint32]string, cwArgs []string) error {
+	width, height := 200, 50
+	if cols, rows, err := terminal.TerminalSize(); err == nil {
+		width, height = int(cols), int(rows)
+	}
+
+	for wi, w := range windows {
+		// Panes are split off the window's first pane, which also identifies
+		// the window for layout and options.
+		var first string
+		for pi, id := range w.Sessions {
+			var args []string
+			switch {
+			case wi == 0 && pi == 0:
+				args = []string{"new-session", "-d", "-s", name, "-n", w.Name,
+					"-x", strconv.Itoa(width), "-y", strconv.Itoa(height)}
+			case pi == 0:
+				args = []string{"new-window", "-d", "-t", "=" + name + ":", "-n", w.Name}
+			default:
+				args = []string{"split-window", "-d", "-t", first}
+			}
+			args = append(args, "-P", "-F", "#{pane_id}", attachCommand(cwArgs, id))
+
+			out, err := tmuxOutput(args...)
+			if err != nil {
+				if wi > 0 || pi > 0 {
+					_ = exec.Command("tmux", "kill-session", "-t", "="+name).Run()
+				}
+				return err
+			}
+			pane := strings.TrimSpace(out)
+			if pi == 0 {
+				first = pane
+			}
+			_ = exec.Command("tmux", "set-option", "-p", "-t", pane, tmuxSessionOption, strconv.FormatUint(uint64(id), 10)).Run()
+			_ = exec.Command("tmux", "select-pane", "-t", pane, "-T", labels[id]).Run()
+
+			// Re-tile after every split so later splits have room.
+			if pi > 0 {
+				_ = exec.Command("tmux", "select-layout", "-t", first, "tiled").Run()
+			}
+		}
+
+		if w.Layout == "" || exec.Command("tmux", "select-layout", "-t", first, w.Layout).Run() != nil {
+			_ = exec.Command("tmux", "select-layout", "-t", first, "tiled").Run()
+		}
+		_ = exec.Command("tmux", "set-option", "-w", "-t", first, "pane-border-status", "top").Run()
+	}
+	return nil
+}
+
+// tmuxAttach switches the current tmux client to name when running inside
+// tmux, or attaches the terminal to it otherwise.
+func tmuxAttach(name string) error {
+	var cmd *exec.Cmd
+	if os.Getenv("TMUX") != "" {
+		cmd = exec.Command("tmux", "switch-client", "-t", "="+name)
+	} else {
+		cmd = exec.Command("tmux", "attach-session", "-t", "="+name)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func tmuxOutput(args ...string) (string, error) {
+	out, err := exec.Command("tmux", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("tmux %s: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// attachCommand builds the shell command a pane runs to attach to id.
+func attachCommand(cwArgs []string, id uint32) string {
+	parts := make([]string, 0, len(cwArgs)+2)
+	for _, a := range cwArgs {
+		parts = append(parts, shellQuote(a))
+	}
+	parts = append(parts, "attach", strconv.FormatUint(uint64(id), 10))
+	return strings.Join(parts, " ")
+}
+
+func tmuxPaneTitle(s protocol.SessionInfo) string {
+	if s.Name != "" {
+		return fmt.Sprintf("%d %s", s.ID, s.Name)
+	}
+	return strconv.FormatUint(uint64(s.ID), 10)
+}
+
+// sanitizeTmuxName replaces characters tmux does not allow in session names.
+func sanitizeTmuxName(name string) string {
+	return strings.NewReplacer(".", "_", ":", "_").Replace(name)
+}
+
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:@%+", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,600 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/terminal"
+)
+
+// ---------------------------------------------------------------------------
+// Top — full-screen session dashboard
+// ---------------------------------------------------------------------------
+
+const (
+	topRefreshInterval = time.Second
+	topActivityLines   = 3
+	topLogTail         = 200
+)
+
+// topMode is what the key handler is currently collecting.
+type topMode int
+
+const (
+	topNormal      topMode = iota
+	topInput               // typing input for the selected session
+	topConfirmKill         // waiting for y/n
+)
+
+// topRow is one session in the dashboard.
+type topRow struct {
+	info    protocol.SessionInfo
+	rate    float64 // output bytes/s since the previous refresh
+	msgs    int     // messages seen since top started
+	snippet string  // last line of output
+}
+
+type topModel struct {
+	ctx      context.Context
+	target   *Target
+	rows     []topRow
+	prev     map[uint32]uint64 // output bytes at the previous refresh
+	msgs     map[uint32]int
+	snippets map[uint32]string
+	lastPoll time.Time
+	selected int
+	offset   int
+	mode     topMode
+	input    string
+	flash    string
+	activity []string // recent message activity, newest last
+}
+
+// Top runs an interactive dashboard of all sessions with live status, output
+// rate, last output, and message activity. Keys: up/down (or j/k) select,
+// a/enter attach, l logs, i send input, x kill, q quit. detachKey is passed
+// to Attach.
+func Top(ctx context.Context, target *Target, detachKey byte) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	m := &topModel{
+		ctx:      ctx,
+		target:   target,
+		prev:     make(map[uint32]uint64),
+		msgs:     make(map[uint32]int),
+		snippets: make(map[uint32]string),
+	}
+	if err := m.refresh(); err != nil {
+		return err
+	}
+
+	guard, err := terminal.EnableRawMode()
+	if err != nil {
+		return fmt.Errorf("enabling raw mode: %w", err)
+	}
+	enterScreen := func() { os.Stdout.WriteString("\x1b[?1049h\x1b[?25l") }
+	leaveScreen := func() { os.Stdout.WriteString("\x1b[?25h\x1b[?1049l") }
+	enterScreen()
+	defer func() {
+		leaveScreen()
+		guard.Restore()
+	}()
+
+	// Stdin is read one chunk per request on want, so that nothing is
+	// consumed while attach or the log view owns the terminal. done stops
+	// the reader if Top returns while it holds a key.
+	keys := make(chan []byte)
+	want := make(chan struct{}, 1)
+	done := make(chan struct{})
+	defer close(done)
+	defer close(want)
+	go func() {
+		buf := make([]byte, 64)
+		for range want {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			k := make([]byte, n)
+			copy(k, buf[:n])
+			select {
+			case keys <- k:
+			case <-done:
+				return
+			}
+		}
+	}()
+	want <- struct{}{}
+
+	events := make(chan topEvent, 64)
+	go topSubscribeMessages(ctx, target, events)
+
+	winchCh, winchCleanup := terminal.ResizeSignal()
+	defer winchCleanup()
+
+	ticker := time.NewTicker(topRefreshInterval)
+	defer ticker.Stop()
+
+	m.render()
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.refresh(); err != nil {
+				m.flash = err.Error()
+			}
+
+		case <-winchCh:
+
+		case ev := <-events:
+			m.msgs[ev.sessionID]++
+			m.activity = append(m.activity, ev.line)
+			if len(m.activity) > topActivityLines {
+				m.activity = m.activity[len(m.activity)-topActivityLines:]
+			}
+
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			action := m.handleKey(k)
+			switch action {
+			case "quit":
+				return nil
+			case "attach", "logs":
+				row, ok := m.current()
+				if !ok {
+					break
+				}
+				leaveScreen()
+				guard.Restore()
+				if action == "attach" {
+					if err := Attach(ctx, target, &row.info.ID, false, false, detachKey); err != nil {
+						m.flash = err.Error()
+					}
+				} else {
+					m.showLogs(row.info.ID, keys, want)
+				}
+				if guard, err = terminal.EnableRawMode(); err != nil {
+					return fmt.Errorf("enabling raw mode: %w", err)
+				}
+				enterScreen()
+				_ = m.refresh()
+			}
+			want <- struct{}{}
+		}
+		m.render()
+	}
+}
+
+// showLogs prints the tail of a session's log on the normal screen and waits
+// for a key before returning to the dashboard.
+func (m *topModel) showLogs(id uint32, keys <-chan []byte, want chan<- struct{}) {
+	tail := topLogTail
+	fmt.Print("\x1b[2J\x1b[H")
+	if err := Logs(m.ctx, m.target, id, false, &tail, ""); err != nil {
+		fmt.Printf("error: %v\n", err)
+	}
+	fmt.Printf("\n-- session %d: press any key to return --", id)
+
+	guard, err := terminal.EnableRawMode()
+	if err != nil {
+		return
+	}
+	defer guard.Restore()
+	want <- struct{}{}
+	<-keys
+}
+
+// current returns the selected row.
+func (m *topModel) current() (topRow, bool) {
+	if m.selected < 0 || m.selected >= len(m.rows) {
+		return topRow{}, false
+	}
+	return m.rows[m.selected], true
+}
+
+// handleKey applies a key press and returns an action for the main loop to
+// perform outside the dashboard ("attach", "logs", "quit"), or "".
+func (m *topModel) handleKey(k []byte) string {
+	key := string(k)
+	m.flash = ""
+
+	switch m.mode {
+	case topInput:
+		switch {
+		case key == "\r" || key == "\n":
+			if row, ok := m.current(); ok {
+				m.sendInput(row.info.ID, m.input+"\n")
+			}
+			m.mode, m.input = topNormal, ""
+		case key == "\x1b" || key == "\x03":
+			m.mode, m.input = topNormal, ""
+		case key == "\x7f" || key == "\b":
+			if len(m.input) > 0 {
+				m.input = m.input[:len(m.input)-1]
+			}
+		case k[0] >= 0x20 && k[0] != 0x7f:
+			m.input += key
+		}
+		return ""
+
+	case topConfirmKill:
+		m.mode = topNormal
+		if key == "y" || key == "Y" {
+			if row, ok := m.current(); ok {
+				resp, err := requestResponse(m.ctx, m.target, &protocol.Request{Type: "Kill", ID: &row.info.ID})
+				switch {
+				case err != nil:
+					m.flash = err.Error()
+				case resp.Type == "Error":
+					m.flash = resp.Message
+				default:
+					m.flash = fmt.Sprintf("session %d killed", row.info.ID)
+				}
+				_ = m.refresh()
+			}
+		}
+		return ""
+	}
+
+	switch key {
+	case "q", "\x03":
+		return "quit"
+	case "\x1b[A", "k":
+		if m.selected > 0 {
+			m.selected--
+		}
+	case "\x1b[B", "j":
+		if m.selected < len(m.rows)-1 {
+			m.selected++
+		}
+	case "a", "\r":
+		return "attach"
+	case "l":
+		return "logs"
+	case "i":
+		if _, ok := m.current(); ok {
+			m.mode = topInput
+		}
+	case "x":
+		if _, ok := m.current(); ok {
+			m.mode = topConfirmKill
+		}
+	}
+	return ""
+}
+
+func (m *topModel) sendInput(id uint32, input string) {
+	resp, err := requestResponse(m.ctx, m.target, &protocol.Request{
+		Type: "SendInput",
+		ID:   &id,
+		Data: []byte(input),
+	})
+	switch {
+	case err != nil:
+		m.flash = err.Error()
+	case resp.Type == "Error":
+		m.flash = resp.Message
+	default:
+		m.flash = fmt.Sprintf("sent %d bytes to session %d", len(input), id)
+	}
+}
+
+// refresh reloads the session list and fetches the last output line of
+// running sessions.
+func (m *topModel) refresh() error {
+	resp, err := requestResponse(m.ctx, m.target, &protocol.Request{Type: "ListSessions"})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", formatError(resp.Message))
+	}
+	var sessions []protocol.SessionInfo
+	if resp.Sessions != nil {
+		sessions = *resp.Sessions
+	}
+	for _, s := range sessions {
+		if strings.HasPrefix(s.Status, "running") || m.snippets[s.ID] == "" {
+			if st, err := requestResponse(m.ctx, m.target, &protocol.Request{Type: "GetStatus", ID: &s.ID}); err == nil &&
+				st.Info != nil && st.Info.LastOutputSnippet != nil {
+				m.snippets[s.ID] = lastOutputLine(*st.Info.LastOutputSnippet)
+			}
+		}
+	}
+	m.update(sessions, time.Now())
+	return nil
+}
+
+// update replaces the rows with sessions, in ID order, computing output rates
+// from the change in output bytes since the previous update at now.
+func (m *topModel) update(sessions []protocol.SessionInfo, now time.Time) {
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+
+	elapsed := now.Sub(m.lastPoll).Seconds()
+	m.lastPoll = now
+
+	var selectedID uint32
+	if row, ok := m.current(); ok {
+		selectedID = row.info.ID
+	}
+
+	rows := make([]topRow, 0, len(sessions))
+	for _, s := range sessions {
+		row := topRow{info: s, msgs: m.msgs[s.ID], snippet: m.snippets[s.ID]}
+
+		var outBytes uint64
+		if s.OutputBytes != nil {
+			outBytes = *s.OutputBytes
+		}
+		if prev, ok := m.prev[s.ID]; ok && elapsed > 0 && outBytes >= prev {
+			row.rate = float64(outBytes-prev) / elapsed
+		}
+		m.prev[s.ID] = outBytes
+
+		rows = append(rows, row)
+	}
+	m.rows = rows
+
+	// Keep the same session selected across refreshes.
+	for i, r := range m.rows {
+		if r.info.ID == selectedID {
+			m.selected = i
+		}
+	}
+	if m.selected >= len(m.rows) {
+		m.selected = len(m.rows) - 1
+	}
+	if m.selected < 0 {
+		m.selected = 0
+	}
+}
+
+// render redraws the whole screen.
+func (m *topModel) render() {
+	cols, rows, err := terminal.TerminalSize()
+	if err != nil || cols == 0 || rows == 0 {
+		cols, rows = 80, 24
+	}
+	width := int(cols)
+
+	var b bytes.Buffer
+	line := func(s string) {
+		b.WriteString(truncateVisible(s, width))
+		b.WriteString("\x1b[K\r\n")
+	}
+
+	b.WriteString("\x1b[H")
+
+	running := 0
+	for _, r := range m.rows {
+		if strings.HasPrefix(r.info.Status, "running") {
+			running++
+		}
+	}
+	line(fmt.Sprintf("\x1b[1mcw top\x1b[0m  %d sessions, %d running  %s", len(m.rows), running, time.Now().Format("15:04:05")))
+	line("\x1b[7m" + padRight(fmt.Sprintf("%-5s %-16s %-14s %-8s %-9s %-5s %s", "ID", "NAME", "STATUS", "AGE", "RATE", "MSGS", "LAST OUTPUT"), width) + "\x1b[0m")
+
+	// Header (2) + activity + flash/help (2).
+	visible := int(rows) - 4 - topActivityLines
+	if visible < 1 {
+		visible = 1
+	}
+	if m.selected < m.offset {
+		m.offset = m.selected
+	}
+	if m.selected >= m.offset+visible {
+		m.offset = m.selected - visible + 1
+	}
+
+	for i := m.offset; i < len(m.rows) && i < m.offset+visible; i++ {
+		r := m.rows[i]
+		name := r.info.Name
+		if name == "" {
+			name = "-"
+		}
+		if len(name) > 16 {
+			name = name[:13] + "..."
+		}
+		status := r.info.Status
+		if len(status) > 14 {
+			status = status[:14]
+		}
+		msgs := "-"
+		if r.msgs > 0 {
+			msgs = fmt.Sprintf("%d", r.msgs)
+		}
+		text := fmt.Sprintf("%-5d %-16s %-14s %-8s %-9s %-5s %s",
+			r.info.ID, name, status, formatRelativeTime(r.info.CreatedAt), formatRate(r.rate), msgs, r.snippet)
+		if i == m.selected {
+			line("\x1b[7m" + padRight(truncateVisible(text, width), width) + "\x1b[0m")
+		} else {
+			line(text)
+		}
+	}
+	if len(m.rows) == 0 {
+		line("No sessions")
+	}
+
+	// Clear the rest of the table area, then draw the footer at the bottom.
+	b.WriteString("\x1b[J")
+	b.WriteString(fmt.Sprintf("\x1b[%d;1H", int(rows)-topActivityLines-1))
+	for i := 0; i < topActivityLines; i++ {
+		if i < len(m.activity) {
+			line("\x1b[2m" + m.activity[i] + "\x1b[0m")
+		} else {
+			line("")
+		}
+	}
+	if m.flash != "" {
+		line("\x1b[33m" + m.flash + "\x1b[0m")
+	} else {
+		line("")
+	}
+
+	row, _ := m.current()
+	var help string
+	switch m.mode {
+	case topInput:
+		help = fmt.Sprintf("input for session %d (enter to send, esc to cancel): %s", row.info.ID, m.input)
+	case topConfirmKill:
+		help = fmt.Sprintf("kill session %d? (y/n)", row.info.ID)
+	default:
+		help = "↑/↓ select  a attach  l logs  i input  x kill  q quit"
+	}
+	b.WriteString(truncateVisible(help, width))
+	b.WriteString("\x1b[K")
+
+	os.Stdout.Write(b.Bytes())
+}
+
+// ---------------------------------------------------------------------------
+// Message activity
+// ---------------------------------------------------------------------------
+
+type topEvent struct {
+	sessionID uint32
+	line      string
+}
+
+// topSubscribeMessages streams message events into events until the
+// connection closes. Events are dropped if the dashboard falls behind.
+func topSubscribeMessages(ctx context.Context, target *Target, events chan<- topEvent) {
+	reader, writer, err := target.Connect(ctx)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	if err := writer.SendRequest(&protocol.Request{
+		Type:       "Subscribe",
+		EventTypes: []string{"direct.message", "message.request", "message.reply"},
+	}); err != nil {
+		return
+	}
+
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil || frame == nil {
+			return
+		}
+		if frame.Type != protocol.FrameControl {
+			continue
+		}
+		var resp protocol.Response
+		if err := json.Unmarshal(frame.Payload, &resp); err != nil {
+			continue
+		}
+		if resp.Type != "Event" || resp.Event == nil || resp.SessionID == nil {
+			continue
+		}
+
+		var data struct {
+			FromName string `json:"from_name"`
+			ToName   string `json:"to_name"`
+			From     uint32 `json:"from"`
+			To       uint32 `json:"to"`
+			Body     string `json:"body"`
+		}
+		_ = json.Unmarshal(resp.Event.Data, &data)
+		from := data.FromName
+		if from == "" {
+			from = fmt.Sprintf("%d", data.From)
+		}
+		to := data.ToName
+		if to == "" {
+			to = fmt.Sprintf("%d", data.To)
+		}
+		kind := strings.TrimPrefix(strings.TrimPrefix(resp.Event.EventType, "message."), "direct.")
+
+		select {
+		case events <- topEvent{
+			sessionID: *resp.SessionID,
+			line:      fmt.Sprintf("%s %s %s → %s: %s", time.Now().Format("15:04:05"), kind, from, to, lastOutputLine(data.Body)),
+		}:
+		default:
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Formatting helpers
+// ---------------------------------------------------------------------------
+
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)?|\x1b.`)
+
+// lastOutputLine returns the last non-blank line of s with escape sequences
+// and control characters removed.
+func lastOutputLine(s string) string {
+	s = ansiPattern.ReplaceAllString(s, "")
+	lines := strings.Split(strings.ReplaceAll(s, "\r", "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		l := strings.Map(func(r rune) rune {
+			if r < 0x20 || r == 0x7f {
+				return -1
+			}
+			return r
+		}, lines[i])
+		if strings.TrimSpace(l) != "" {
+			return strings.TrimSpace(l)
+		}
+	}
+	return ""
+}
+
+// formatRate formats an output rate in bytes per second.
+func formatRate(bps float64) string {
+	switch {
+	case bps < 1:
+		return "-"
+	case bps < 1024:
+		return fmt.Sprintf("%.0fB/s", bps)
+	case bps < 1024*1024:
+		return fmt.Sprintf("%.1fK/s", bps/1024)
+	default:
+		return fmt.Sprintf("%.1fM/s", bps/(1024*1024))
+	}
+}
+
+// truncateVisible cuts s to width visible runes, keeping escape sequences.
+func truncateVisible(s string, width int) string {
+	var b strings.Builder
+	visible := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			if loc := ansiPattern.FindStringIndex(s[i:]); loc != nil && loc[0] == 0 {
+				b.WriteString(s[i : i+loc[1]])
+				i += loc[1]
+				continue
+			}
+		}
+		if visible >= width {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		b.WriteString(s[i : i+size])
+		visible++
+		i += size
+	}
+	return b.String()
+}
+
+// padRight pads s with spaces to width visible runes.
+func padRight(s string, width int) string {
+	n := utf8.RuneCountInString(ansiPattern.ReplaceAllString(s, ""))
+	if n >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-n)
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func newTestTopModel() *topModel {
+	return &topModel{
+		prev:     make(map[uint32]uint64),
+		msgs:     make(map[uint32]int),
+		snippets: make(map[uint32]string),
+	}
+}
+
+func topSessions(ids ...uint32) []protocol.SessionInfo {
+	sessions := make([]protocol.SessionInfo, len(ids))
+	for i, id := range ids {
+		out := uint64(id) * 100
+		sessions[i] = protocol.SessionInfo{ID: id, Status: "running", OutputBytes: &out}
+	}
+	return sessions
+}
+
+func rowIDs(m *topModel) []uint32 {
+	ids := make([]uint32, len(m.rows))
+	for i, r := range m.rows {
+		ids[i] = r.info.ID
+	}
+	return ids
+}
+
+func TestTopUpdate(t *testing.T) {
+	m := newTestTopModel()
+	m.msgs[2] = 3
+	m.snippets[3] = "done"
+	start := time.Now()
+
+	m.update(topSessions(3, 1, 2), start)
+	if got := rowIDs(m); len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Fatalf("rows = %v, want sessions in ID order", got)
+	}
+	if m.rows[1].msgs != 3 || m.rows[2].snippet != "done" || m.rows[0].rate != 0 {
+		t.Errorf("rows = %+v", m.rows)
+	}
+
+	// The selected session stays selected as sessions come and go, and
+	// rates follow the change in output over the elapsed time.
+	m.selected = 2
+	sessions := topSessions(3, 4)
+	*sessions[0].OutputBytes += 500
+	m.update(sessions, start.Add(2*time.Second))
+	if row, _ := m.current(); row.info.ID != 3 {
+		t.Errorf("selected session %d, want 3", row.info.ID)
+	}
+	if m.rows[0].rate != 250 || m.rows[1].rate != 0 {
+		t.Errorf("rates = %v, %v; want 250 and none for a new session", m.rows[0].rate, m.rows[1].rate)
+	}
+
+	// If the selected session is gone, the selection is clamped.
+	m.selected = 1
+	m.update(topSessions(3), start.Add(3*time.Second))
+	if m.selected != 0 {
+		t.Errorf("selected = %d, want 0", m.selected)
+	}
+	m.update(nil, start.Add(4*time.Second))
+	if _, ok := m.current(); ok || m.selected != 0 {
+		t.Errorf("selected = %d with no sessions", m.selected)
+	}
+}
+
+func TestTopHandleKey(t *testing.T) {
+	m := newTestTopModel()
+	m.update(topSessions(1, 2, 3), time.Now())
+
+	for _, tt := range []struct {
+		key      string
+		selected int
+	}{
+		{"j", 1}, {"\x1b[B", 2}, {"j", 2}, {"k", 1}, {"\x1b[A", 0}, {"k", 0},
+	} {
+		if action := m.handleKey([]byte(tt.key)); action != "" || m.selected != tt.selected {
+			t.Errorf("key %q: action %q, selected %d; want %d", tt.key, action, m.selected, tt.selected)
+		}
+	}
+	for key, want := range map[string]string{"a": "attach", "\r": "attach", "l": "logs", "q": "quit", "\x03": "quit", "z": ""} {
+		if action := m.handleKey([]byte(key)); action != want {
+			t.Errorf("key %q: action %q, want %q", key, action, want)
+		}
+	}
+
+	// Input mode collects text, with backspace, until escape.
+	m.handleKey([]byte("i"))
+	for _, k := range []string{"h", "i", "x", "\x7f", "\x01"} {
+		m.handleKey([]byte(k))
+	}
+	if m.mode != topInput || m.input != "hi" {
+		t.Errorf("mode %d, input %q; want input mode with %q", m.mode, m.input, "hi")
+	}
+	if action := m.handleKey([]byte("q")); action != "" || m.input != "hiq" {
+		t.Errorf("q in input mode: action %q, input %q", action, m.input)
+	}
+	m.handleKey([]byte("\x1b"))
+	if m.mode != topNormal || m.input != "" {
+		t.Errorf("after escape: mode %d, input %q", m.mode, m.input)
+	}
+
+	// Anything but y cancels a kill.
+	m.handleKey([]byte("x"))
+	if m.mode != topConfirmKill {
+		t.Fatalf("mode %d after x, want confirm", m.mode)
+	}
+	m.handleKey([]byte("n"))
+	if m.mode != topNormal || m.flash != "" {
+		t.Errorf("after n: mode %d, flash %q", m.mode, m.flash)
+	}
+
+	// With no sessions, nothing can be selected for input or kill.
+	m.update(nil, time.Now())
+	m.handleKey([]byte("i"))
+	m.handleKey([]byte("x"))
+	if m.mode != topNormal {
+		t.Errorf("mode %d with no sessions", m.mode)
+	}
+}
+
+func TestLastOutputLine(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                           "",
+		"one\ntwo\n\n":               "two",
+		"\x1b[32mgreen\x1b[0m\r\n ":  "green",
+		"progress 10%\rprogress 90%": "progress 90%",
+		"bell\x07 here":              "bell here",
+	} {
+		if got := lastOutputLine(in); got != want {
+			t.Errorf("lastOutputLine(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
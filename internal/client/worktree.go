@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// WorktreeList prints the node's session worktrees.
+func WorktreeList(ctx context.Context, target *Target, jsonOutput bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "WorktreeList"})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	var worktrees []protocol.Worktree
+	if resp.Worktrees != nil {
+		worktrees = *resp.Worktrees
+	}
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(worktrees, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(worktrees) == 0 {
+		fmt.Println("No worktrees")
+		return nil
+	}
+
+	fmt.Printf("%-20s %-20s %-10s %-10s %s\n", "NAME", "GIT", "SESSIONS", "CREATED", "PATH")
+	for _, wt := range worktrees {
+		sessions := "-"
+		if len(wt.Sessions) > 0 {
+			ids := make([]string, len(wt.Sessions))
+			for i, id := range wt.Sessions {
+				ids[i] = fmt.Sprint(id)
+			}
+			sessions = strings.Join(ids, ",")
+		}
+		fmt.Printf("%-20s %-20s %-10s %-10s %s\n", wt.Name, formatGit(wt.Git), sessions, formatRelativeTime(wt.CreatedAt), wt.Path)
+	}
+	return nil
+}
+
+// WorktreeMerge merges a worktree's branch into its repository's checked
+// out branch.
+func WorktreeMerge(ctx context.Context, target *Target, name string) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "WorktreeMerge", Name: name})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	fmt.Fprintf(os.Stderr, "Merged %s into %s\n", name, resp.Message)
+	return nil
+}
+
+// WorktreeClean removes a worktree and its branch.
+func WorktreeClean(ctx context.Context, target *Target, name string, force bool) error {
+	resp, err := requestResponse(ctx, target, &protocol.Request{Type: "WorktreeRemove", Name: name, Force: force})
+	if err != nil {
+		return err
+	}
+	if resp.Type == "Error" {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	fmt.Fprintf(os.Stderr, "Removed worktree %s and its branch\n", name)
+	return nil
+}
@@ -5,8 +5,14 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"time"
 
 	"github.com/BurntSushi/toml"
+
+	"github.com/codewiresh/codewire/internal/agent"
+	"github.com/codewiresh/codewire/internal/notify"
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/terminal"
 )
 
 // Config is the top-level configuration loaded from config.toml.
@@ -15,6 +21,144 @@ type Config struct {
 	RelayURL     *string    `toml:"relay_url,omitempty"`
 	RelaySession *string    `toml:"relay_session,omitempty"` // OAuth session token
 	RelayToken   *string    `toml:"relay_token,omitempty"`   // node auth token for relay agent
+	// RelayGroups are the node groups this node joins on the relay, which
+	// places client connections to a group on one of its nodes.
+	RelayGroups []string `toml:"relay_groups,omitempty"`
+	// Budget is the default per-session agent tool budget ([budget] table).
+	Budget *protocol.Budget `toml:"budget,omitempty"`
+	// Webhooks receive matching session events ([[webhooks]] tables).
+	Webhooks []Webhook `toml:"webhooks,omitempty"`
+	// Summaries configures session.output_summary events ([summaries]
+	// table).
+	Summaries *Summaries `toml:"summaries,omitempty"`
+	// Alerts applies to every session's output ([alerts] table).
+	Alerts *Alerts `toml:"alerts,omitempty"`
+	// Redact masks secrets in every session's output ([redact] table).
+	Redact *Redact `toml:"redact,omitempty"`
+	// Cost tracks what agent sessions spend ([cost] table).
+	Cost *Cost `toml:"cost,omitempty"`
+	// Agents adapt cw run --auto-approve and --prompt-file, and session
+	// activity, to agent CLIs besides, or instead of, the built-in ones
+	// ([[agents]] tables).
+	Agents []agent.Adapter `toml:"agents,omitempty"`
+	// Messages limits what each sender may send with cw msg and cw request
+	// ([messages] table).
+	Messages *Messages `toml:"messages,omitempty"`
+	// Archive says where cw archive keeps completed sessions ([archive]
+	// table).
+	Archive *Archive `toml:"archive,omitempty"`
+	// Client holds defaults for cw commands run with this data directory
+	// ([client] table).
+	Client ClientConfig `toml:"client,omitempty"`
+}
+
+// ClientConfig holds defaults for cw commands. Their flags override it.
+type ClientConfig struct {
+	// Server is what commands connect to without --server: a name from
+	// servers.toml or a URL. Empty, or "local", is the local node.
+	Server string `toml:"server,omitempty"`
+	// Tags are given to sessions launched without any.
+	Tags []string `toml:"tags,omitempty"`
+	// DetachKey is the key that, followed by d, detaches from a session:
+	// "ctrl-a" to "ctrl-z" (default "ctrl-b").
+	DetachKey string `toml:"detach_key,omitempty"`
+	// Color is "auto" (default: when writing to a terminal and NO_COLOR is
+	// unset), "always" or "never".
+	Color string `toml:"color,omitempty"`
+}
+
+// Alerts raises session.alert events for output lines matching Patterns,
+// Go regular expressions, and sends them to the Notify method (see
+// notify.Parse) if set.
+type Alerts struct {
+	Patterns []string `toml:"patterns,omitempty"`
+	Notify   string   `toml:"notify,omitempty"`
+}
+
+// Redact masks matches of Patterns, Go regular expressions, and the values
+// of the Env variables in session output logs, watch output, status
+// snippets and events. Values of cw run --secret variables are always
+// masked.
+type Redact struct {
+	Patterns []string `toml:"patterns,omitempty"`
+	Env      []string `toml:"env,omitempty"`
+}
+
+// Cost configures how the node reads agent sessions' token usage and cost
+// from their output, and limits what they spend. A session's own limit is
+// its budget's cost (cw run --budget cost=5).
+type Cost struct {
+	// Extractors read agent CLIs besides, or instead of, the built-in ones
+	// for claude, codex and aider ([[cost.extractors]] tables).
+	Extractors []UsageExtractor `toml:"extractors,omitempty"`
+	// TagLimits caps the cost, in US dollars, of all the sessions with a
+	// tag, by tag.
+	TagLimits map[string]float64 `toml:"tag_limits,omitempty"`
+	// Action is what happens to a session over a limit: "kill" (default),
+	// or "escalate" to ask the gateway session, killing it unless the
+	// gateway approves.
+	Action string `toml:"action,omitempty"`
+}
+
+// UsageExtractor reads the usage of sessions running Agent, a command
+// name. Each pattern is a Go regular expression whose first group is a
+// running total printed by the agent.
+type UsageExtractor struct {
+	Agent        string `toml:"agent"`
+	Cost         string `toml:"cost,omitempty"` // US dollars
+	InputTokens  string `toml:"input_tokens,omitempty"`
+	OutputTokens string `toml:"output_tokens,omitempty"`
+}
+
+// Messages limits the direct messages and requests each sender, a session
+// or the callers outside sessions, may send.
+type Messages struct {
+	// MaxBody is the largest body accepted, in bytes (default 65536); -1
+	// lifts the cap.
+	MaxBody int `toml:"max_body,omitempty"`
+	// PerMinute is how many messages and requests a sender may send a
+	// minute (default 60); -1 lifts the limit.
+	PerMinute int `toml:"per_minute,omitempty"`
+	// Burst is how many a sender may send at once, before PerMinute paces
+	// it (default 20).
+	Burst int `toml:"burst,omitempty"`
+}
+
+// Archive configures where cw archive keeps the archives of completed
+// sessions: Dir, and with S3Bucket set, a bucket on AWS S3 or an
+// S3-compatible service, which gets a copy of each archive and serves
+// restores of the ones no longer in Dir. S3 credentials come from
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type Archive struct {
+	// Dir defaults to "archive" in the data directory; a relative path is
+	// relative to the data directory.
+	Dir        string `toml:"dir,omitempty"`
+	S3Bucket   string `toml:"s3_bucket,omitempty"`
+	S3Prefix   string `toml:"s3_prefix,omitempty"`
+	S3Region   string `toml:"s3_region,omitempty"` // default AWS_REGION, then us-east-1
+	S3Endpoint string `toml:"s3_endpoint,omitempty"`
+}
+
+// Summaries configures the node's periodic summaries of session output.
+type Summaries struct {
+	// Interval is a Go duration (default "30s"); "0s" disables summaries.
+	Interval string `toml:"interval,omitempty"`
+	// Lines is how many of the last non-blank output lines each summary
+	// keeps (default 5).
+	Lines int `toml:"lines,omitempty"`
+	// Command, if set, is run with sh -c for each summary with the new
+	// output on stdin; what it prints is the summary.
+	Command string `toml:"command,omitempty"`
+}
+
+// Webhook posts session events to an external URL. Empty Events or Tags
+// match everything.
+type Webhook struct {
+	URL    string   `toml:"url"`
+	Events []string `toml:"events,omitempty"`
+	Tags   []string `toml:"tags,omitempty"`
+	// Secret signs each payload with HMAC-SHA256 (X-Codewire-Signature).
+	Secret string `toml:"secret,omitempty"`
 }
 
 // NodeConfig describes the local node identity and network settings.
@@ -23,9 +167,72 @@ type NodeConfig struct {
 	Name string `toml:"name"`
 	// WebSocket listen address (e.g. "0.0.0.0:9100"). Nil means no listener.
 	Listen *string `toml:"listen,omitempty"`
+	// GRPCListen is the listen address of the gRPC API (see
+	// proto/codewire/v1/node.proto), e.g. "0.0.0.0:9101". Nil means no
+	// listener.
+	GRPCListen *string `toml:"grpc_listen,omitempty"`
+	// TLSCert and TLSKey are PEM files that serve the WebSocket listener
+	// over TLS (wss://), and the gRPC listener too. They are reloaded when
+	// they change on disk.
+	TLSCert string `toml:"tls_cert,omitempty"`
+	TLSKey  string `toml:"tls_key,omitempty"`
+	// TLSACMEDomains serves TLS with certificates obtained from Let's
+	// Encrypt for these names instead. The listener must be reachable on
+	// port 443 for the TLS-ALPN challenge. TLSACMEEmail is the optional
+	// contact address for the ACME account.
+	TLSACMEDomains []string `toml:"tls_acme_domains,omitempty"`
+	TLSACMEEmail   string   `toml:"tls_acme_email,omitempty"`
 	// Externally-accessible WSS URL for fleet discovery
 	// (e.g. "wss://9100--workspace.coder.codewire.sh/ws").
 	ExternalURL *string `toml:"external_url,omitempty"`
+	// MaxConcurrentSessions caps running sessions; further launches wait in
+	// a FIFO queue. Zero means unlimited.
+	MaxConcurrentSessions int `toml:"max_concurrent_sessions,omitempty"`
+	// Tags describe the node to the relay, which lists them in cw nodes
+	// (e.g. "gpu", "eu-west").
+	Tags []string `toml:"tags,omitempty"`
+	// UpdateChannel opts the node in to automatic updates: when the relay's
+	// channel of this name asks for another cw version, the node installs
+	// the signed release and restarts into it, keeping its sessions.
+	// UpdateKey is an armored PGP public key file the release checksums
+	// must be signed with instead of the cw release key.
+	UpdateChannel string `toml:"update_channel,omitempty"`
+	UpdateKey     string `toml:"update_key,omitempty"`
+	// OrphanPolicy decides what happens on startup to session processes that
+	// outlived the previous node: "adopt" (default) tracks them again,
+	// "kill" terminates them and "ignore" leaves them untracked.
+	OrphanPolicy string `toml:"orphan_policy,omitempty"`
+	// ContainerRuntime runs sessions launched with cw run --docker:
+	// "docker" or "podman". Empty uses whichever is installed.
+	ContainerRuntime string `toml:"container_runtime,omitempty"`
+	// SocketAllowUIDs and SocketAllowGroups (group names or numeric GIDs)
+	// let other local users connect to the Unix socket. The user running the
+	// node is always allowed.
+	SocketAllowUIDs   []uint32 `toml:"socket_allow_uids,omitempty"`
+	SocketAllowGroups []string `toml:"socket_allow_groups,omitempty"`
+	// SocketTokenAuth also lets in local users outside those lists whose
+	// requests carry an auth token, limited to the token's scope.
+	SocketTokenAuth bool `toml:"socket_token_auth,omitempty"`
+	// LogMaxSize is the size in MiB at which node.log is rotated (default
+	// 10), and LogFiles how many rotated files are kept (default 3).
+	LogMaxSize int `toml:"log_max_size,omitempty"`
+	LogFiles   int `toml:"log_files,omitempty"`
+	// EventLogMaxSize is the size in MiB at which events.jsonl, the journal
+	// cw subscribe --since replays, is rotated (default 16), and
+	// EventLogFiles how many rotated files are kept (default 3).
+	EventLogMaxSize int `toml:"event_log_max_size,omitempty"`
+	EventLogFiles   int `toml:"event_log_files,omitempty"`
+	// HistoryBufferSize is how many KiB of each session's latest output
+	// are kept in memory to serve attach history, cw logs --tail and status
+	// snippets without reading the log (default 256, -1 keeps none).
+	// HistoryBufferLines also caps it in lines (default: no cap).
+	HistoryBufferSize  int `toml:"history_buffer_size,omitempty"`
+	HistoryBufferLines int `toml:"history_buffer_lines,omitempty"`
+	// OutputDelay is how long session output gathers before the node
+	// frames it for attached clients and watchers, so chatty programs send
+	// fewer, larger frames (default "5ms", "0s" frames it at once). cw
+	// attach --low-latency skips it.
+	OutputDelay string `toml:"output_delay,omitempty"`
 }
 
 // ServerEntry is a saved remote server (client-side).
@@ -75,59 +282,194 @@ func defaultName() string {
 }
 
 // LoadConfig reads config.toml from dataDir, applies environment variable
-// overrides, and validates the node name before returning.
+// overrides, and validates the result. Environment variables (see Settings)
+// take precedence over config.toml.
 func LoadConfig(dataDir string) (*Config, error) {
-	path := filepath.Join(dataDir, "config.toml")
+	cfg, err := readConfigFile(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	// If node.name was empty/missing, apply default.
+	if cfg.Node.Name == "" {
+		cfg.Node.Name = defaultName()
+	}
+
+	for _, s := range Settings {
+		if v := os.Getenv(s.Env); s.Env != "" && v != "" {
+			if err := s.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.Env, err)
+			}
+		}
+	}
 
-	cfg := &Config{
-		Node: NodeConfig{
-			Name: defaultName(),
-		},
+	if err := cfg.validate(); err != nil {
+		return nil, err
 	}
+	return cfg, nil
+}
 
+// readConfigFile reads config.toml from dataDir as-is, without defaults or
+// environment overrides. A missing file is an empty Config.
+func readConfigFile(dataDir string) (*Config, error) {
+	path := filepath.Join(dataDir, "config.toml")
+	cfg := &Config{}
 	if _, err := os.Stat(path); err == nil {
 		if _, err := toml.DecodeFile(path, cfg); err != nil {
 			return nil, fmt.Errorf("parsing %s: %w", path, err)
 		}
-		// If the file was parsed but node.name was empty/missing, apply default.
-		if cfg.Node.Name == "" {
-			cfg.Node.Name = defaultName()
-		}
 	}
+	return cfg, nil
+}
 
-	// Override node config from env vars.
-	if name := os.Getenv("CODEWIRE_NODE_NAME"); name != "" {
-		cfg.Node.Name = name
+func (cfg *Config) validate() error {
+	if err := ValidateNodeName(cfg.Node.Name); err != nil {
+		return err
+	}
+	if cfg.Node.MaxConcurrentSessions < 0 {
+		return fmt.Errorf("node.max_concurrent_sessions must not be negative, got %d", cfg.Node.MaxConcurrentSessions)
+	}
+	if (cfg.Node.TLSCert == "") != (cfg.Node.TLSKey == "") {
+		return fmt.Errorf("node.tls_cert and node.tls_key must be set together")
+	}
+	if cfg.Node.TLSCert != "" && len(cfg.Node.TLSACMEDomains) > 0 {
+		return fmt.Errorf("node.tls_cert and node.tls_acme_domains are mutually exclusive")
+	}
+	switch cfg.Node.OrphanPolicy {
+	case "", "adopt", "kill", "ignore":
+	default:
+		return fmt.Errorf("node.orphan_policy must be adopt, kill or ignore, got %q", cfg.Node.OrphanPolicy)
 	}
-	if cfg.Node.Listen == nil {
-		if listen := os.Getenv("CODEWIRE_LISTEN"); listen != "" {
-			cfg.Node.Listen = &listen
+	if cfg.Node.LogMaxSize < 0 || cfg.Node.LogFiles < 0 {
+		return fmt.Errorf("node.log_max_size and node.log_files must not be negative")
+	}
+	if cfg.Node.EventLogMaxSize < 0 || cfg.Node.EventLogFiles < 0 {
+		return fmt.Errorf("node.event_log_max_size and node.event_log_files must not be negative")
+	}
+	if cfg.Node.HistoryBufferSize < -1 || cfg.Node.HistoryBufferLines < 0 {
+		return fmt.Errorf("node.history_buffer_size must be -1 or more and node.history_buffer_lines must not be negative")
+	}
+	if cfg.Node.OutputDelay != "" {
+		if d, err := time.ParseDuration(cfg.Node.OutputDelay); err != nil || d < 0 || d > time.Second {
+			return fmt.Errorf("node.output_delay must be a duration from 0s to 1s, got %q", cfg.Node.OutputDelay)
 		}
 	}
-	if cfg.Node.ExternalURL == nil {
-		if extURL := os.Getenv("CODEWIRE_EXTERNAL_URL"); extURL != "" {
-			cfg.Node.ExternalURL = &extURL
+	if cfg.Summaries != nil {
+		if cfg.Summaries.Interval != "" {
+			if d, err := time.ParseDuration(cfg.Summaries.Interval); err != nil || d < 0 {
+				return fmt.Errorf("summaries.interval must be a non-negative duration, got %q", cfg.Summaries.Interval)
+			}
+		}
+		if cfg.Summaries.Lines < 0 {
+			return fmt.Errorf("summaries.lines must not be negative, got %d", cfg.Summaries.Lines)
 		}
 	}
-
-	// Relay URL from env var.
-	if cfg.RelayURL == nil {
-		if relayURL := os.Getenv("CODEWIRE_RELAY_URL"); relayURL != "" {
-			cfg.RelayURL = &relayURL
+	if cfg.Alerts != nil {
+		for _, p := range cfg.Alerts.Patterns {
+			if _, err := regexp.Compile(p); err != nil {
+				return fmt.Errorf("alerts.patterns: invalid pattern %q: %w", p, err)
+			}
+		}
+		if cfg.Alerts.Notify != "" {
+			if _, err := notify.Parse(cfg.Alerts.Notify); err != nil {
+				return fmt.Errorf("alerts.notify: %w", err)
+			}
+		}
+	}
+	if cfg.Redact != nil {
+		for _, p := range cfg.Redact.Patterns {
+			if _, err := regexp.Compile(p); err != nil {
+				return fmt.Errorf("redact.patterns: invalid pattern %q: %w", p, err)
+			}
+		}
+	}
+	if cfg.Cost != nil {
+		for i, ex := range cfg.Cost.Extractors {
+			if ex.Agent == "" {
+				return fmt.Errorf("cost.extractors[%d]: agent is required", i)
+			}
+			for _, p := range []string{ex.Cost, ex.InputTokens, ex.OutputTokens} {
+				if p == "" {
+					continue
+				}
+				re, err := regexp.Compile(p)
+				if err != nil {
+					return fmt.Errorf("cost.extractors[%d]: invalid pattern %q: %w", i, p, err)
+				}
+				if re.NumSubexp() < 1 {
+					return fmt.Errorf("cost.extractors[%d]: pattern %q has no group for the figure", i, p)
+				}
+			}
+		}
+		for tag, limit := range cfg.Cost.TagLimits {
+			if limit < 0 {
+				return fmt.Errorf("cost.tag_limits.%s must not be negative, got %v", tag, limit)
+			}
+		}
+		switch cfg.Cost.Action {
+		case "", "kill", "escalate":
+		default:
+			return fmt.Errorf("cost.action must be kill or escalate, got %q", cfg.Cost.Action)
 		}
 	}
-	// Relay token from env var.
-	if cfg.RelayToken == nil {
-		if t := os.Getenv("CODEWIRE_RELAY_TOKEN"); t != "" {
-			cfg.RelayToken = &t
+	for i, a := range cfg.Agents {
+		if err := a.Validate(); err != nil {
+			return fmt.Errorf("agents[%d]: %w", i, err)
+		}
+	}
+	if cfg.Messages != nil {
+		if cfg.Messages.MaxBody < -1 {
+			return fmt.Errorf("messages.max_body must be -1 or more, got %d", cfg.Messages.MaxBody)
+		}
+		if cfg.Messages.PerMinute < -1 {
+			return fmt.Errorf("messages.per_minute must be -1 or more, got %d", cfg.Messages.PerMinute)
 		}
+		if cfg.Messages.Burst < 0 {
+			return fmt.Errorf("messages.burst must not be negative, got %d", cfg.Messages.Burst)
+		}
+	}
+	switch cfg.Node.ContainerRuntime {
+	case "", "docker", "podman":
+	default:
+		return fmt.Errorf("node.container_runtime must be docker or podman, got %q", cfg.Node.ContainerRuntime)
+	}
+	if _, err := terminal.ParseDetachKey(cfg.Client.DetachKey); err != nil {
+		return fmt.Errorf("client.detach_key: %w", err)
 	}
+	switch cfg.Client.Color {
+	case "", "auto", "always", "never":
+	default:
+		return fmt.Errorf("client.color must be auto, always or never, got %q", cfg.Client.Color)
+	}
+	return nil
+}
 
-	if err := ValidateNodeName(cfg.Node.Name); err != nil {
-		return nil, err
+// UpdateConfig applies fn to config.toml in dataDir and writes it back.
+// The file is read as-is, without defaults or environment overrides, so
+// only fn's changes are persisted.
+func UpdateConfig(dataDir string, fn func(*Config) error) error {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return fmt.Errorf("creating data dir: %w", err)
 	}
 
-	return cfg, nil
+	cfg, err := readConfigFile(dataDir)
+	if err != nil {
+		return err
+	}
+	if err := fn(cfg); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dataDir, "config.toml")
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := toml.NewEncoder(f).Encode(cfg); err != nil {
+		return fmt.Errorf("encoding config.toml: %w", err)
+	}
+	return nil
 }
 
 // LoadServersConfig reads servers.toml from dataDir. If the file does not
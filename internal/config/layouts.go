@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LayoutWindow is one tmux window of a saved layout.
+type LayoutWindow struct {
+	Name string `toml:"name"`
+	// Layout is the tmux layout string (#{window_layout}).
+	Layout string `toml:"layout"`
+	// Sessions are the codewire session IDs attached in each pane, in pane order.
+	Sessions []uint32 `toml:"sessions"`
+}
+
+// Layout is a saved arrangement of tmux panes attached to codewire sessions.
+type Layout struct {
+	TmuxSession string         `toml:"tmux_session"`
+	Windows     []LayoutWindow `toml:"windows"`
+}
+
+// LayoutsConfig is the client-side saved layouts list (~/.codewire/layouts.toml).
+type LayoutsConfig struct {
+	Layouts map[string]Layout `toml:"layouts"`
+}
+
+// LoadLayoutsConfig reads layouts.toml from dataDir. If the file does not
+// exist an empty LayoutsConfig is returned.
+func LoadLayoutsConfig(dataDir string) (*LayoutsConfig, error) {
+	path := filepath.Join(dataDir, "layouts.toml")
+
+	lc := &LayoutsConfig{
+		Layouts: make(map[string]Layout),
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return lc, nil
+	}
+
+	if _, err := toml.DecodeFile(path, lc); err != nil {
+		return nil, fmt.Errorf("parsing layouts.toml: %w", err)
+	}
+	if lc.Layouts == nil {
+		lc.Layouts = make(map[string]Layout)
+	}
+
+	return lc, nil
+}
+
+// Save writes the LayoutsConfig to layouts.toml inside dataDir, creating the
+// directory if necessary.
+func (l *LayoutsConfig) Save(dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return fmt.Errorf("creating data dir: %w", err)
+	}
+
+	path := filepath.Join(dataDir, "layouts.toml")
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	defer f.Close()
+
+	enc := toml.NewEncoder(f)
+	if err := enc.Encode(l); err != nil {
+		return fmt.Errorf("encoding layouts.toml: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/codewiresh/codewire/internal/notify"
+)
+
+// ProjectFile is the per-project config file, found by walking up from the
+// working directory.
+const ProjectFile = ".codewire.toml"
+
+// ProjectConfig holds cw run and cw gateway defaults for the directory tree
+// containing a .codewire.toml, usually a repository. Command-line flags
+// override it, and it overrides the [client] table of config.toml.
+type ProjectConfig struct {
+	// Dir is the directory containing the file; empty if there is none.
+	Dir string `toml:"-"`
+	// Tags are given to sessions launched without --tag, instead of
+	// client.tags.
+	Tags []string `toml:"tags,omitempty"`
+	// NamePrefix is prepended to the names of sessions cw run launches.
+	NamePrefix string `toml:"name_prefix,omitempty"`
+	// Env is set in every session; --env overrides it.
+	Env map[string]string `toml:"env,omitempty"`
+	// Gateway is the approval policy of cw gateway ([gateway] table).
+	Gateway ProjectGateway `toml:"gateway,omitempty"`
+	// Templates are launched with cw run --template <name>
+	// ([templates.<name>] tables).
+	Templates map[string]RunTemplate `toml:"templates,omitempty"`
+}
+
+// ProjectGateway is the default of cw gateway's --exec and --notify. Exec
+// runs in the project directory.
+type ProjectGateway struct {
+	Exec   string `toml:"exec,omitempty"`
+	Notify string `toml:"notify,omitempty"`
+}
+
+// RunTemplate is a named cw run invocation. Arguments after -- are
+// appended to Command.
+type RunTemplate struct {
+	Command []string `toml:"command"`
+	// Dir is the working directory, relative to the project directory.
+	Dir  string `toml:"dir,omitempty"`
+	Name string `toml:"name,omitempty"`
+	// Tags are added to the project's tags; Env is set over its env.
+	Tags []string          `toml:"tags,omitempty"`
+	Env  map[string]string `toml:"env,omitempty"`
+}
+
+// FindProjectConfig reads the .codewire.toml in dir or its nearest parent
+// that has one. If there is none, it returns an empty ProjectConfig.
+func FindProjectConfig(dir string) (*ProjectConfig, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		if _, err := os.Stat(path); err == nil {
+			return loadProjectConfig(path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return &ProjectConfig{}, nil
+		}
+		dir = parent
+	}
+}
+
+func loadProjectConfig(path string) (*ProjectConfig, error) {
+	p := &ProjectConfig{Dir: filepath.Dir(path)}
+	if _, err := toml.DecodeFile(path, p); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for name, t := range p.Templates {
+		if len(t.Command) == 0 {
+			return nil, fmt.Errorf("%s: templates.%s.command must not be empty", path, name)
+		}
+	}
+	if p.Gateway.Notify != "" {
+		if _, err := notify.Parse(p.Gateway.Notify); err != nil {
+			return nil, fmt.Errorf("%s: gateway.notify: %w", path, err)
+		}
+	}
+	return p, nil
+}
+
+// Template returns the template called name, with Dir made absolute.
+func (p *ProjectConfig) Template(name string) (*RunTemplate, error) {
+	if p.Dir == "" {
+		return nil, fmt.Errorf("no %s found for template %q", ProjectFile, name)
+	}
+	t, ok := p.Templates[name]
+	if !ok {
+		return nil, fmt.Errorf("no template %q in %s (templates: %s)", name, filepath.Join(p.Dir, ProjectFile), strings.Join(p.TemplateNames(), ", "))
+	}
+	if t.Dir != "" && !filepath.IsAbs(t.Dir) {
+		t.Dir = filepath.Join(p.Dir, t.Dir)
+	}
+	return &t, nil
+}
+
+// TemplateNames lists the project's templates, sorted.
+func (p *ProjectConfig) TemplateNames() []string {
+	return slices.Sorted(maps.Keys(p.Templates))
+}
+
+// Environ returns the project's env with that of t, if any, set over it,
+// as sorted KEY=VALUE pairs.
+func (p *ProjectConfig) Environ(t *RunTemplate) []string {
+	env := maps.Clone(p.Env)
+	if t != nil {
+		if env == nil {
+			env = map[string]string{}
+		}
+		maps.Copy(env, t.Env)
+	}
+	var pairs []string
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		pairs = append(pairs, k+"="+env[k])
+	}
+	return pairs
+}
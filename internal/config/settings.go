@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Setting is a config.toml key that cw config reads and writes. Settings
+// are resolved, highest precedence first, from a command-line flag (where
+// the command has one), the environment variable Env, config.toml, and the
+// default.
+type Setting struct {
+	Key     string // dotted TOML path, e.g. "client.detach_key"
+	Env     string // environment variable overriding config.toml, if any
+	Default string // shown by cw config list when unset
+	Usage   string
+	// Secret settings are masked by cw config list.
+	Secret bool
+}
+
+// Settings lists the keys cw config manages. Tables such as [[webhooks]]
+// and [budget] are edited in config.toml directly.
+var Settings = []Setting{
+	{Key: "node.name", Env: "CODEWIRE_NODE_NAME", Usage: "Node name, used in fleet discovery (default: $HOSTNAME)"},
+	{Key: "node.listen", Env: "CODEWIRE_LISTEN", Usage: "WebSocket listen address, e.g. 0.0.0.0:9100"},
+	{Key: "node.grpc_listen", Env: "CODEWIRE_GRPC_LISTEN", Usage: "gRPC API listen address, e.g. 0.0.0.0:9101"},
+	{Key: "node.external_url", Env: "CODEWIRE_EXTERNAL_URL", Usage: "Externally reachable WSS URL for fleet discovery"},
+	{Key: "node.max_concurrent_sessions", Default: "0", Usage: "Running sessions before launches queue (0: unlimited)"},
+	{Key: "node.tags", Env: "CODEWIRE_NODE_TAGS", Usage: "Tags the relay lists the node with (comma-separated)"},
+	{Key: "node.update_channel", Env: "CODEWIRE_UPDATE_CHANNEL", Usage: "Relay update channel to follow for automatic updates"},
+	{Key: "node.update_key", Usage: "PGP public key file release checksums must be signed with (default: the cw release key)"},
+	{Key: "node.orphan_policy", Default: "adopt", Usage: "Sessions that outlived the previous node: adopt, kill or ignore"},
+	{Key: "node.container_runtime", Usage: "Runtime for cw run --docker: docker or podman"},
+	{Key: "node.log_max_size", Default: "10", Usage: "Size in MiB at which node.log is rotated"},
+	{Key: "node.log_files", Default: "3", Usage: "Rotated node.log files kept"},
+	{Key: "node.event_log_max_size", Default: "16", Usage: "Size in MiB at which the event journal is rotated"},
+	{Key: "node.event_log_files", Default: "3", Usage: "Rotated event journal files kept"},
+	{Key: "node.history_buffer_size", Default: "256", Usage: "KiB of each session's latest output kept in memory (-1: none)"},
+	{Key: "node.history_buffer_lines", Default: "0", Usage: "Lines of each session's latest output kept in memory (0: no cap)"},
+	{Key: "node.output_delay", Default: "5ms", Usage: "How long output gathers before it is framed for clients (0s: at once)"},
+	{Key: "relay_url", Env: "CODEWIRE_RELAY_URL", Usage: "Relay for remote access"},
+	{Key: "relay_token", Env: "CODEWIRE_RELAY_TOKEN", Usage: "Node token for the relay", Secret: true},
+	{Key: "summaries.interval", Default: "30s", Usage: "How often session output is summarized (0s: never)"},
+	{Key: "summaries.lines", Default: "5", Usage: "Output lines kept in each summary"},
+	{Key: "alerts.notify", Usage: "Where session.alert events are sent"},
+	{Key: "messages.max_body", Default: "65536", Usage: "Largest message or request body in bytes (-1: no limit)"},
+	{Key: "messages.per_minute", Default: "60", Usage: "Messages and requests each sender may send a minute (-1: no limit)"},
+	{Key: "messages.burst", Default: "20", Usage: "Messages a sender may send at once before per_minute paces it"},
+	{Key: "redact.env", Usage: "Variables whose values are masked in session output (comma-separated)"},
+	{Key: "client.server", Env: "CODEWIRE_SERVER", Default: "local", Usage: "Server commands use without --server"},
+	{Key: "client.tags", Env: "CODEWIRE_TAGS", Usage: "Tags for sessions launched without any (comma-separated)"},
+	{Key: "client.detach_key", Env: "CODEWIRE_DETACH_KEY", Default: "ctrl-b", Usage: "Key that, followed by d, detaches"},
+	{Key: "client.color", Env: "CODEWIRE_COLOR", Default: "auto", Usage: "Colored output: auto, always or never"},
+}
+
+// LookupSetting returns the setting for key.
+func LookupSetting(key string) (Setting, error) {
+	for _, s := range Settings {
+		if s.Key == key {
+			return s, nil
+		}
+	}
+	return Setting{}, fmt.Errorf("unknown setting %q (see cw config list)", key)
+}
+
+// SettingValue is a setting's effective value and where it came from:
+// "env <VAR>", "config.toml" or "default".
+type SettingValue struct {
+	Setting
+	Value  string
+	Source string
+}
+
+// EffectiveSettings resolves every setting for dataDir, without flags.
+func EffectiveSettings(dataDir string) ([]SettingValue, error) {
+	cfg, err := readConfigFile(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]SettingValue, 0, len(Settings))
+	for _, s := range Settings {
+		v := SettingValue{Setting: s, Value: s.Default, Source: "default"}
+		if s.Key == "node.name" {
+			v.Value = defaultName()
+		}
+		if env := os.Getenv(s.Env); s.Env != "" && env != "" {
+			v.Value, v.Source = env, "env "+s.Env
+		} else if value, ok := s.get(cfg); ok {
+			v.Value, v.Source = value, "config.toml"
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// SetSetting sets key to value in config.toml, checking that the result
+// is a valid configuration.
+func SetSetting(dataDir, key, value string) error {
+	s, err := LookupSetting(key)
+	if err != nil {
+		return err
+	}
+	return UpdateConfig(dataDir, func(cfg *Config) error {
+		if err := s.set(cfg, value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		check := *cfg
+		if check.Node.Name == "" {
+			check.Node.Name = defaultName()
+		}
+		return check.validate()
+	})
+}
+
+// UnsetSetting removes key from config.toml, restoring its default.
+func UnsetSetting(dataDir, key string) error {
+	s, err := LookupSetting(key)
+	if err != nil {
+		return err
+	}
+	return UpdateConfig(dataDir, func(cfg *Config) error {
+		f := s.field(reflect.ValueOf(cfg).Elem(), false)
+		if f.IsValid() {
+			f.Set(reflect.Zero(f.Type()))
+		}
+		return nil
+	})
+}
+
+// get returns the setting's value in cfg, and whether it is set.
+func (s Setting) get(cfg *Config) (string, bool) {
+	f := s.field(reflect.ValueOf(cfg).Elem(), false)
+	if !f.IsValid() || f.IsZero() {
+		return "", false
+	}
+	if f.Kind() == reflect.Pointer {
+		f = f.Elem()
+	}
+	switch f.Kind() {
+	case reflect.Slice:
+		return strings.Join(f.Interface().([]string), ","), true
+	case reflect.Int:
+		return strconv.FormatInt(f.Int(), 10), true
+	}
+	return f.String(), true
+}
+
+// set parses value into the setting's field of cfg.
+func (s Setting) set(cfg *Config, value string) error {
+	f := s.field(reflect.ValueOf(cfg).Elem(), true)
+	switch f.Kind() {
+	case reflect.Pointer:
+		f.Set(reflect.ValueOf(&value))
+	case reflect.Slice:
+		var list []string
+		for item := range strings.SplitSeq(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		f.Set(reflect.ValueOf(list))
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		f.SetInt(int64(n))
+	default:
+		f.SetString(value)
+	}
+	return nil
+}
+
+// field finds the setting's field in v, a Config, by TOML tag. Missing
+// tables are created if create is set; otherwise the result is invalid.
+func (s Setting) field(v reflect.Value, create bool) reflect.Value {
+	for name := range strings.SplitSeq(s.Key, ".") {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !create {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		t := v.Type()
+		for i := range t.NumField() {
+			tag, _, _ := strings.Cut(t.Field(i).Tag.Get("toml"), ",")
+			if tag == name {
+				v = v.Field(i)
+				break
+			}
+		}
+	}
+	return v
+}
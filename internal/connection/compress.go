@@ -0,0 +1,165 @@
+package connection
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Compression codecs a connection can negotiate for its data frames: the
+// client offers the ones it supports in its Attach request and the node
+// answers with its pick in Attached (see NegotiateCompression).
+const (
+	CompressZstd   = "zstd"
+	CompressSnappy = "snappy"
+)
+
+// Compressions lists the codecs this build supports, preferred first.
+var Compressions = []string{CompressZstd, CompressSnappy}
+
+// minCompress is the smallest payload worth compressing; keystroke echoes
+// and the like go as they are.
+const minCompress = 64
+
+// A compressed data frame's payload starts with a flag byte saying whether
+// the rest is compressed: payloads compression would not shrink are sent
+// raw.
+const (
+	payloadRaw        byte = 0
+	payloadCompressed byte = 1
+)
+
+type codec interface {
+	encode(dst, src []byte) []byte
+	decode(src []byte) ([]byte, error)
+}
+
+// NegotiateCompression returns the first of the offered codecs this build
+// supports, or "" for none.
+func NegotiateCompression(offered []string) string {
+	for _, name := range offered {
+		if slices.Contains(Compressions, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Compress wraps r and w so that data frames are compressed with the named
+// codec, as negotiated with the peer; control frames pass as they are.
+// Both ends must switch after the Attached response and before their first
+// data frame. An empty name returns r and w unchanged.
+func Compress(r FrameReader, w FrameWriter, name string) (FrameReader, FrameWriter, error) {
+	var c codec
+	switch name {
+	case "":
+		return r, w, nil
+	case CompressZstd:
+		c = zstdCodec{}
+	case CompressSnappy:
+		c = snappyCodec{}
+	default:
+		return nil, nil, fmt.Errorf("unsupported compression %q", name)
+	}
+	return &compressReader{FrameReader: r, c: c}, &compressWriter{FrameWriter: w, c: c}, nil
+}
+
+type compressWriter struct {
+	FrameWriter
+	c codec
+}
+
+func (w *compressWriter) WriteFrame(f *protocol.Frame) error {
+	if f.Type != protocol.FrameData {
+		return w.FrameWriter.WriteFrame(f)
+	}
+	payload := make([]byte, 1, 1+len(f.Payload))
+	if len(f.Payload) >= minCompress {
+		payload = w.c.encode(payload, f.Payload)
+		if len(payload) < 1+len(f.Payload) {
+			payload[0] = payloadCompressed
+			return w.FrameWriter.WriteFrame(&protocol.Frame{Type: f.Type, Payload: payload})
+		}
+		payload = payload[:1]
+	}
+	payload[0] = payloadRaw
+	payload = append(payload, f.Payload...)
+	return w.FrameWriter.WriteFrame(&protocol.Frame{Type: f.Type, Payload: payload})
+}
+
+func (w *compressWriter) SendData(data []byte) error {
+	return w.WriteFrame(&protocol.Frame{Type: protocol.FrameData, Payload: data})
+}
+
+type compressReader struct {
+	FrameReader
+	c codec
+}
+
+func (r *compressReader) ReadFrame() (*protocol.Frame, error) {
+	f, err := r.FrameReader.ReadFrame()
+	if err != nil || f == nil || f.Type != protocol.FrameData {
+		return f, err
+	}
+	if len(f.Payload) == 0 {
+		return nil, fmt.Errorf("compressed data frame without a flag byte")
+	}
+	switch f.Payload[0] {
+	case payloadRaw:
+		f.Payload = f.Payload[1:]
+	case payloadCompressed:
+		if f.Payload, err = r.c.decode(f.Payload[1:]); err != nil {
+			return nil, fmt.Errorf("decompressing data frame: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown data frame flag 0x%02x", f.Payload[0])
+	}
+	return f, nil
+}
+
+// The zstd encoder and decoder are made on first use and shared: they are
+// safe for concurrent EncodeAll and DecodeAll calls. Decoding is capped at
+// protocol.MaxPayload, like frames.
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		e, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		return e
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		d, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(uint64(protocol.MaxPayload)))
+		return d
+	})
+)
+
+type zstdCodec struct{}
+
+func (zstdCodec) encode(dst, src []byte) []byte { return zstdEncoder().EncodeAll(src, dst) }
+
+func (zstdCodec) decode(src []byte) ([]byte, error) { return zstdDecoder().DecodeAll(src, nil) }
+
+type snappyCodec struct{}
+
+func (snappyCodec) encode(dst, src []byte) []byte {
+	// snappy.Encode writes to the start of the slice it is given, so give
+	// it the room after dst.
+	n := snappy.MaxEncodedLen(len(src))
+	dst = slices.Grow(dst, n)
+	out := snappy.Encode(dst[len(dst):len(dst)+n], src)
+	return dst[:len(dst)+len(out)]
+}
+
+func (snappyCodec) decode(src []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if n > int(protocol.MaxPayload) {
+		return nil, fmt.Errorf("decoded payload too large: %d bytes", n)
+	}
+	return snappy.Decode(nil, src)
+}
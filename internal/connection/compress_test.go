@@ -0,0 +1,149 @@
+package connection
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	for _, name := range Compressions {
+		t.Run(name, func(t *testing.T) {
+			a, b := net.Pipe()
+			defer a.Close()
+			defer b.Close()
+			_, w, err := Compress(nil, NewUnixWriter(a), name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, _, _ := Compress(NewUnixReader(b), nil, name)
+
+			resp := &protocol.Response{Type: "Attached", Compression: name}
+			payloads := [][]byte{[]byte("ls\r"), transcript(4 << 10), bytes.Repeat([]byte{0}, 1)}
+			go func() {
+				_ = w.SendResponse(resp)
+				for _, p := range payloads {
+					_ = w.SendData(p)
+				}
+			}()
+
+			f, err := r.ReadFrame()
+			if err != nil || f.Type != protocol.FrameControl || !bytes.Contains(f.Payload, []byte(`"compression":"`+name+`"`)) {
+				t.Fatalf("control frame = %+v, %v", f, err)
+			}
+			for _, want := range payloads {
+				f, err := r.ReadFrame()
+				if err != nil || f.Type != protocol.FrameData || !bytes.Equal(f.Payload, want) {
+					t.Fatalf("data frame of %d bytes: got %d, %v", len(want), len(f.Payload), err)
+				}
+			}
+		})
+	}
+}
+
+func TestNegotiateCompression(t *testing.T) {
+	tests := []struct {
+		offered []string
+		want    string
+	}{
+		{nil, ""},
+		{[]string{"lz4"}, ""},
+		{[]string{"lz4", CompressSnappy, CompressZstd}, CompressSnappy},
+		{Compressions, CompressZstd},
+	}
+	for _, tt := range tests {
+		if got := NegotiateCompression(tt.offered); got != tt.want {
+			t.Errorf("NegotiateCompression(%q) = %q, want %q", tt.offered, got, tt.want)
+		}
+	}
+	if _, _, err := Compress(nil, nil, "lz4"); err == nil {
+		t.Error("Compress accepted an unsupported codec")
+	}
+}
+
+// transcript returns about n bytes of colourised build and ls output, the
+// escape-heavy kind of stream compression is for.
+func transcript(n int) []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < n; i++ {
+		switch i % 3 {
+		case 0:
+			fmt.Fprintf(&b, "\x1b[1;32m   Compiling\x1b[0m pkg-%d v0.%d.%d (/src/crates/pkg-%d)\r\n", i, i%7, i%13, i)
+		case 1:
+			fmt.Fprintf(&b, "\x1b[0m\x1b[01;34mdir%03d\x1b[0m  \x1b[01;32mrun.sh\x1b[0m  file_%d.go  \x1b[38;5;208m%dK\x1b[0m\r\n", i, i, i*17%900)
+		default:
+			fmt.Fprintf(&b, "\x1b[2K\x1b[1G\x1b[36m[%3d%%]\x1b[39m \x1b[33mwarning\x1b[0m: unused variable `x%d`\r\n", i%101, i)
+		}
+	}
+	return b.Bytes()[:n]
+}
+
+func BenchmarkCompress(b *testing.B) {
+	for _, size := range []int{256, 4 << 10, 32 << 10} {
+		data := transcript(size)
+		for _, name := range Compressions {
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				var out int
+				_, w, _ := Compress(nil, discardWriter{n: &out}, name)
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				for b.Loop() {
+					_ = w.SendData(data)
+				}
+				b.ReportMetric(float64(out)/float64(b.N)/float64(size), "ratio")
+			})
+		}
+	}
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	for _, size := range []int{256, 4 << 10, 32 << 10} {
+		data := transcript(size)
+		for _, name := range Compressions {
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				var frame protocol.Frame
+				_, w, _ := Compress(nil, discardWriter{last: &frame}, name)
+				_ = w.SendData(data)
+				r, _, _ := Compress(&replayReader{f: frame}, nil, name)
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := r.ReadFrame(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// discardWriter drops frames, counting their payload bytes in n and keeping
+// a copy of the last in last when set.
+type discardWriter struct {
+	FrameWriter
+	n    *int
+	last *protocol.Frame
+}
+
+func (w discardWriter) WriteFrame(f *protocol.Frame) error {
+	if w.n != nil {
+		*w.n += len(f.Payload)
+	}
+	if w.last != nil {
+		*w.last = protocol.Frame{Type: f.Type, Payload: bytes.Clone(f.Payload)}
+	}
+	return nil
+}
+
+// replayReader returns copies of f forever.
+type replayReader struct {
+	FrameReader
+	f protocol.Frame
+}
+
+func (r *replayReader) ReadFrame() (*protocol.Frame, error) {
+	return &protocol.Frame{Type: r.f.Type, Payload: r.f.Payload}, nil
+}
@@ -1,6 +1,13 @@
 package connection
 
-import "github.com/codewiresh/codewire/internal/protocol"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
 
 // FrameReader reads protocol frames from a transport.
 type FrameReader interface {
@@ -8,7 +15,8 @@ type FrameReader interface {
 	Close() error
 }
 
-// FrameWriter writes protocol frames to a transport.
+// FrameWriter writes protocol frames to a transport. WriteFrame is done
+// with the frame's payload when it returns, so callers may reuse it.
 type FrameWriter interface {
 	WriteFrame(f *protocol.Frame) error
 	SendResponse(resp *protocol.Response) error
@@ -16,3 +24,79 @@ type FrameWriter interface {
 	SendData(data []byte) error
 	Close() error
 }
+
+// jsonBufs holds the buffers control frames are encoded into.
+var jsonBufs = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// maxPooledJSON keeps the buffers of unusually large control frames, such
+// as a long session list, out of the pool.
+const maxPooledJSON = 64 << 10
+
+// writeJSON encodes v into a pooled buffer and writes it to w as a control
+// frame.
+func writeJSON(w FrameWriter, v any) error {
+	buf := jsonBufs.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledJSON {
+			jsonBufs.Put(buf)
+		}
+	}()
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	// Unlike json.Marshal, Encode ends the value with a newline.
+	payload := bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})
+	return w.WriteFrame(&protocol.Frame{Type: protocol.FrameControl, Payload: payload})
+}
+
+// ExpectFileChunks tells r that the peer is about to send FileChunk frames.
+// WebSocket has only text and binary messages, so a WebSocket reader reads
+// binary messages as file chunks from then on rather than as data frames.
+// Other transports carry the frame type and need no switch.
+func ExpectFileChunks(r FrameReader) {
+	expectBinary(r, protocol.FrameFileChunk)
+}
+
+// ExpectStreams is ExpectFileChunks for the Stream frames of a port forward.
+func ExpectStreams(r FrameReader) {
+	expectBinary(r, protocol.FrameStream)
+}
+
+func expectBinary(r FrameReader, frameType byte) {
+	if ws, ok := r.(*WSReader); ok {
+		ws.binary = frameType
+	}
+}
+
+// WithContext closes r and w when ctx is done, so that a blocked ReadFrame
+// or WriteFrame returns, and from then on reports ctx.Err() where r would
+// report an error or end of stream. Closing the returned reader releases
+// ctx. WebSocket readers and writers take a context of their own and need
+// no wrapping.
+func WithContext(ctx context.Context, r FrameReader, w FrameWriter) (FrameReader, FrameWriter) {
+	stop := context.AfterFunc(ctx, func() {
+		r.Close()
+		w.Close()
+	})
+	return &ctxReader{FrameReader: r, ctx: ctx, stop: stop}, w
+}
+
+type ctxReader struct {
+	FrameReader
+	ctx  context.Context
+	stop func() bool
+}
+
+func (r *ctxReader) ReadFrame() (*protocol.Frame, error) {
+	f, err := r.FrameReader.ReadFrame()
+	if (err != nil || f == nil) && r.ctx.Err() != nil {
+		return nil, r.ctx.Err()
+	}
+	return f, err
+}
+
+func (r *ctxReader) Close() error {
+	r.stop()
+	return r.FrameReader.Close()
+}
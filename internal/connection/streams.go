@@ -0,0 +1,134 @@
+package connection
+
+import (
+	"net"
+	"sync"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// streamChunkSize is the most stream data sent in one Stream frame; the
+// node reads WebSocket messages up to 32 KiB.
+const streamChunkSize = 32<<10 - 4
+
+// Streams multiplexes TCP connections over one frame connection, as Stream
+// frames tagged with a stream id. Both ends of a port forward use it: the
+// client for the connections it accepts, the node for the ones it dials.
+//
+// Each direction ends on its own, like a TCP half-close: when a connection
+// reaches EOF, Streams calls sendClose, and when the peer's close arrives
+// (Closed), the connection's write side is shut down. A stream is dropped
+// once both directions have ended.
+type Streams struct {
+	writer    FrameWriter
+	sendClose func(id uint32) error
+
+	mu    sync.Mutex
+	conns map[uint32]*stream
+}
+
+type stream struct {
+	conn       net.Conn
+	readDone   bool // conn reached EOF and the peer was told
+	peerClosed bool // the peer will send no more data
+}
+
+// NewStreams returns a Streams sending data with writer. sendClose tells
+// the peer that stream id has no more data.
+func NewStreams(writer FrameWriter, sendClose func(id uint32) error) *Streams {
+	return &Streams{writer: writer, sendClose: sendClose, conns: make(map[uint32]*stream)}
+}
+
+// Add registers conn as stream id, so data from the peer reaches it. Its
+// own data is not sent until Start.
+func (s *Streams) Add(id uint32, conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[id] = &stream{conn: conn}
+}
+
+// Start sends stream id's data to the peer until the connection ends.
+func (s *Streams) Start(id uint32) {
+	s.mu.Lock()
+	st := s.conns[id]
+	s.mu.Unlock()
+	if st == nil {
+		return
+	}
+
+	go func() {
+		buf := make([]byte, streamChunkSize)
+		for {
+			n, err := st.conn.Read(buf)
+			if n > 0 {
+				if werr := s.writer.WriteFrame(protocol.StreamFrame(id, buf[:n])); werr != nil {
+					st.conn.Close()
+					return
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		_ = s.sendClose(id)
+		s.mu.Lock()
+		st.readDone = true
+		s.finishLocked(id, st)
+		s.mu.Unlock()
+	}()
+}
+
+// Data writes data from the peer to stream id. Data for unknown or closed
+// streams is dropped.
+func (s *Streams) Data(id uint32, data []byte) {
+	s.mu.Lock()
+	st := s.conns[id]
+	s.mu.Unlock()
+	if st == nil || st.peerClosed {
+		return
+	}
+	if _, err := st.conn.Write(data); err != nil {
+		// Closing ends the read loop too, which tells the peer.
+		st.conn.Close()
+	}
+}
+
+// Closed records that the peer sent all of stream id's data. With failed
+// set, the stream is torn down instead, as when the peer could not connect.
+func (s *Streams) Closed(id uint32, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.conns[id]
+	if st == nil {
+		return
+	}
+	st.peerClosed = true
+	if failed {
+		st.conn.Close()
+		delete(s.conns, id)
+		return
+	}
+	if cw, ok := st.conn.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	} else {
+		st.conn.Close()
+	}
+	s.finishLocked(id, st)
+}
+
+// CloseAll closes every stream, when the frame connection ends.
+func (s *Streams) CloseAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, st := range s.conns {
+		st.conn.Close()
+		delete(s.conns, id)
+	}
+}
+
+func (s *Streams) finishLocked(id uint32, st *stream) {
+	if st.readDone && st.peerClosed {
+		st.conn.Close()
+		delete(s.conns, id)
+	}
+}
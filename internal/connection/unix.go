@@ -1,27 +1,40 @@
 package connection
 
 import (
-	"encoding/json"
+	"bufio"
+	"io"
 	"net"
 	"sync"
 
 	"github.com/codewiresh/codewire/internal/protocol"
 )
 
+// readBufSize is the read buffer of a UnixReader: a burst of small frames
+// takes one read from the socket instead of two per frame. Payloads larger
+// than it are read straight into place.
+const readBufSize = 64 << 10
+
 // UnixReader reads protocol frames from a Unix socket connection.
 type UnixReader struct {
-	conn net.Conn
+	conn io.ReadCloser
+	r    *bufio.Reader
 }
 
 // NewUnixReader creates a new UnixReader wrapping the given connection.
 func NewUnixReader(conn net.Conn) *UnixReader {
-	return &UnixReader{conn: conn}
+	return NewStreamReader(conn)
+}
+
+// NewStreamReader creates a UnixReader reading frames from any byte stream
+// that carries them as a Unix socket does, such as the stdout of ssh.
+func NewStreamReader(r io.ReadCloser) *UnixReader {
+	return &UnixReader{conn: r, r: bufio.NewReaderSize(r, readBufSize)}
 }
 
 // ReadFrame reads a single protocol frame from the underlying connection.
 // Returns (nil, nil) on clean EOF.
 func (r *UnixReader) ReadFrame() (*protocol.Frame, error) {
-	return protocol.ReadFrame(r.conn)
+	return protocol.ReadFrame(r.r)
 }
 
 // Close closes the underlying connection.
@@ -32,7 +45,7 @@ func (r *UnixReader) Close() error {
 // UnixWriter writes protocol frames to a Unix socket connection.
 // It is safe for concurrent use.
 type UnixWriter struct {
-	conn net.Conn
+	conn io.WriteCloser
 	mu   sync.Mutex
 }
 
@@ -41,6 +54,12 @@ func NewUnixWriter(conn net.Conn) *UnixWriter {
 	return &UnixWriter{conn: conn}
 }
 
+// NewStreamWriter creates a UnixWriter writing frames to any byte stream,
+// such as the stdin of ssh.
+func NewStreamWriter(w io.WriteCloser) *UnixWriter {
+	return &UnixWriter{conn: w}
+}
+
 // WriteFrame writes a single protocol frame to the underlying connection.
 func (w *UnixWriter) WriteFrame(f *protocol.Frame) error {
 	w.mu.Lock()
@@ -50,20 +69,12 @@ func (w *UnixWriter) WriteFrame(f *protocol.Frame) error {
 
 // SendResponse marshals a Response to JSON and sends it as a control frame.
 func (w *UnixWriter) SendResponse(resp *protocol.Response) error {
-	data, err := json.Marshal(resp)
-	if err != nil {
-		return err
-	}
-	return w.WriteFrame(&protocol.Frame{Type: protocol.FrameControl, Payload: data})
+	return writeJSON(w, resp)
 }
 
 // SendRequest marshals a Request to JSON and sends it as a control frame.
 func (w *UnixWriter) SendRequest(req *protocol.Request) error {
-	data, err := json.Marshal(req)
-	if err != nil {
-		return err
-	}
-	return w.WriteFrame(&protocol.Frame{Type: protocol.FrameControl, Payload: data})
+	return writeJSON(w, req)
 }
 
 // SendData sends raw bytes as a data frame.
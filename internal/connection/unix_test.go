@@ -0,0 +1,68 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestUnixRoundTrip(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	w, r := NewUnixWriter(a), NewUnixReader(b)
+
+	resp := &protocol.Response{Type: "Error", Message: "<session> & co"}
+	data := bytes.Repeat([]byte("x"), readBufSize+1)
+	go func() {
+		for range 2 {
+			_ = w.SendResponse(resp)
+		}
+		_ = w.SendData(data)
+		_ = w.SendData(nil)
+	}()
+
+	// Pooled buffers carry exactly what json.Marshal would.
+	want, _ := json.Marshal(resp)
+	for range 2 {
+		f, err := r.ReadFrame()
+		if err != nil || f.Type != protocol.FrameControl || !bytes.Equal(f.Payload, want) {
+			t.Fatalf("control frame = %+v, %v, want %s", f, err, want)
+		}
+	}
+	if f, err := r.ReadFrame(); err != nil || f.Type != protocol.FrameData || !bytes.Equal(f.Payload, data) {
+		t.Fatalf("large data frame: %v", err)
+	}
+	if f, err := r.ReadFrame(); err != nil || f.Type != protocol.FrameData || len(f.Payload) != 0 {
+		t.Fatalf("empty data frame = %+v, %v", f, err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	r, w := WithContext(ctx, NewUnixReader(b), NewUnixWriter(b))
+	defer r.Close()
+
+	go func() {
+		_ = NewUnixWriter(a).SendData([]byte("hi"))
+	}()
+	if f, err := r.ReadFrame(); err != nil || string(f.Payload) != "hi" {
+		t.Fatalf("ReadFrame = %+v, %v", f, err)
+	}
+
+	// Cancelling unblocks a pending read and fails later writes.
+	go cancel()
+	if _, err := r.ReadFrame(); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadFrame after cancel = %v, want context.Canceled", err)
+	}
+	if err := w.SendData([]byte("late")); err == nil {
+		t.Error("SendData after cancel succeeded")
+	}
+}
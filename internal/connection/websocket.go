@@ -2,7 +2,6 @@ package connection
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
@@ -14,23 +13,30 @@ import (
 
 // WSReader reads protocol frames from a WebSocket connection.
 // Control frames map to Text messages, data frames map to Binary messages,
-// matching the Rust WebSocket transport.
+// matching the Rust WebSocket transport. During a file transfer or port
+// forward, Binary messages carry file chunks or stream data instead (see
+// ExpectFileChunks and ExpectStreams).
 type WSReader struct {
-	conn *websocket.Conn
-	ctx  context.Context
+	conn   *websocket.Conn
+	ctx    context.Context
+	binary byte // frame type of Binary messages
 }
 
 // NewWSReader creates a new WSReader wrapping the given WebSocket connection.
 func NewWSReader(ctx context.Context, conn *websocket.Conn) *WSReader {
-	return &WSReader{conn: conn, ctx: ctx}
+	return &WSReader{conn: conn, ctx: ctx, binary: protocol.FrameData}
 }
 
 // ReadFrame reads a single protocol frame from the WebSocket.
 // Text messages become control frames, binary messages become data frames.
-// Returns (nil, nil) on normal close, matching the Rust EOF convention.
+// Returns (nil, nil) on normal close, matching the Rust EOF convention, and
+// the context's error once it is done.
 func (r *WSReader) ReadFrame() (*protocol.Frame, error) {
 	msgType, data, err := r.conn.Read(r.ctx)
 	if err != nil {
+		if ctxErr := r.ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		// Normal close is treated as a clean EOF — return nil, nil.
 		var closeErr websocket.CloseError
 		if errors.As(err, &closeErr) {
@@ -43,7 +49,7 @@ func (r *WSReader) ReadFrame() (*protocol.Frame, error) {
 	case websocket.MessageText:
 		return &protocol.Frame{Type: protocol.FrameControl, Payload: data}, nil
 	case websocket.MessageBinary:
-		return &protocol.Frame{Type: protocol.FrameData, Payload: data}, nil
+		return &protocol.Frame{Type: r.binary, Payload: data}, nil
 	default:
 		return nil, fmt.Errorf("unexpected websocket message type: %d", msgType)
 	}
@@ -68,7 +74,8 @@ func NewWSWriter(ctx context.Context, conn *websocket.Conn) *WSWriter {
 }
 
 // WriteFrame writes a single protocol frame to the WebSocket.
-// Control frames are sent as text messages, data frames as binary messages.
+// Control frames are sent as text messages, data frames, file chunks and
+// stream frames as binary messages.
 func (w *WSWriter) WriteFrame(f *protocol.Frame) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -76,7 +83,7 @@ func (w *WSWriter) WriteFrame(f *protocol.Frame) error {
 	switch f.Type {
 	case protocol.FrameControl:
 		return w.conn.Write(w.ctx, websocket.MessageText, f.Payload)
-	case protocol.FrameData:
+	case protocol.FrameData, protocol.FrameFileChunk, protocol.FrameStream:
 		return w.conn.Write(w.ctx, websocket.MessageBinary, f.Payload)
 	default:
 		return fmt.Errorf("unknown frame type: %d", f.Type)
@@ -85,20 +92,12 @@ func (w *WSWriter) WriteFrame(f *protocol.Frame) error {
 
 // SendResponse marshals a Response to JSON and sends it as a control frame.
 func (w *WSWriter) SendResponse(resp *protocol.Response) error {
-	data, err := json.Marshal(resp)
-	if err != nil {
-		return err
-	}
-	return w.WriteFrame(&protocol.Frame{Type: protocol.FrameControl, Payload: data})
+	return writeJSON(w, resp)
 }
 
 // SendRequest marshals a Request to JSON and sends it as a control frame.
 func (w *WSWriter) SendRequest(req *protocol.Request) error {
-	data, err := json.Marshal(req)
-	if err != nil {
-		return err
-	}
-	return w.WriteFrame(&protocol.Frame{Type: protocol.FrameControl, Payload: data})
+	return writeJSON(w, req)
 }
 
 // SendData sends raw bytes as a data frame.
@@ -0,0 +1,155 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/auth"
+	"github.com/codewiresh/codewire/internal/client"
+)
+
+// RunMCPHTTPServer serves MCP over the streamable-HTTP transport at /mcp on
+// addr, with node tools talking to target; tool calls cannot name a target
+// of their own. Clients authenticate with the local node's auth token
+// (Authorization: Bearer or ?token=), the same token used by the WebSocket
+// listener. It blocks until ctx is cancelled.
+func RunMCPHTTPServer(ctx context.Context, dataDir string, target *client.Target, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", mcpHTTPHandler(dataDir, target))
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("mcp http server listening", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("mcp http server: %w", err)
+	}
+	return nil
+}
+
+// mcpHTTPHandler handles POSTed JSON-RPC messages. A message (or batch) with
+// no requests is acknowledged with 202. Requests are answered with JSON, or
+// with an SSE stream when the client accepts text/event-stream, so progress
+// notifications can be delivered before the final response. The server does
+// not offer a standalone GET stream.
+func mcpHTTPHandler(dataDir string, target *client.Target) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+			token = strings.TrimPrefix(authHeader, "Bearer ")
+		}
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if !auth.ValidateToken(dataDir, token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1024*1024))
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		// A POST body is a single message or a batch.
+		var reqs []jsonRpcRequest
+		trimmed := bytes.TrimSpace(body)
+		batch := len(trimmed) > 0 && trimmed[0] == '['
+		if batch {
+			err = json.Unmarshal(body, &reqs)
+		} else {
+			var req jsonRpcRequest
+			err = json.Unmarshal(body, &req)
+			reqs = []jsonRpcRequest{req}
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(jsonRpcResponse{
+				Jsonrpc: "2.0",
+				Error:   &jsonRpcError{Code: -32700, Message: "parse error"},
+			})
+			return
+		}
+
+		hasRequest := false
+		for _, req := range reqs {
+			if req.ID != nil {
+				hasRequest = true
+			}
+		}
+		if !hasRequest {
+			// Notifications and responses only.
+			for _, req := range reqs {
+				handleRPC(dataDir, target, nil, false, req, nil)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			serveMCPStream(w, dataDir, target, reqs)
+			return
+		}
+
+		var resps []*jsonRpcResponse
+		for _, req := range reqs {
+			if resp := handleRPC(dataDir, target, nil, false, req, nil); resp != nil {
+				resps = append(resps, resp)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if batch {
+			json.NewEncoder(w).Encode(resps)
+		} else {
+			json.NewEncoder(w).Encode(resps[0])
+		}
+	})
+}
+
+// serveMCPStream answers reqs over an SSE stream, interleaving any progress
+// notifications with the responses, then closes the stream.
+func serveMCPStream(w http.ResponseWriter, dataDir string, target *client.Target, reqs []jsonRpcRequest) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	var mu sync.Mutex
+	send := func(msg interface{}) {
+		data, _ := json.Marshal(msg)
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	for _, req := range reqs {
+		if resp := handleRPC(dataDir, target, nil, false, req, send); resp != nil {
+			send(resp)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/auth"
+)
+
+// postMCP posts body to the MCP endpoint and returns the response.
+func postMCP(t *testing.T, url, token, accept, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func TestMCPHTTP(t *testing.T) {
+	target := startNode(t)
+	token, err := auth.LoadOrGenerateToken(target.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(mcpHTTPHandler(target.Local, target))
+	defer srv.Close()
+	ping := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+
+	for _, tok := range []string{"", "wrong"} {
+		if resp, _ := postMCP(t, srv.URL, tok, "", ping); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("token %q: status %d, want 401", tok, resp.StatusCode)
+		}
+	}
+	if resp, _ := postMCP(t, srv.URL+"?token="+token, "", "", ping); resp.StatusCode != http.StatusOK {
+		t.Errorf("?token=: status %d, want 200", resp.StatusCode)
+	}
+	if resp, err := http.Get(srv.URL + "?token=" + token); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %v, %v; want 405", resp, err)
+	}
+
+	t.Run("json", func(t *testing.T) {
+		resp, body := postMCP(t, srv.URL, token, "application/json, text/plain", ping)
+		if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "application/json" {
+			t.Fatalf("status %d, Content-Type %q", resp.StatusCode, ct)
+		}
+		var r jsonRpcResponse
+		if err := json.Unmarshal([]byte(body), &r); err != nil || string(*r.ID) != "1" || r.Error != nil {
+			t.Errorf("response = %s, %v", body, err)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		id := launch(t, target, "echo", "streamed")
+		call := fmt.Sprintf(`{"jsonrpc":"2.0","id":"w","method":"tools/call","params":{"name":"codewire_watch_session","arguments":{"session_id":%d,"max_duration_seconds":10},"_meta":{"progressToken":"p"}}}`, id)
+		resp, body := postMCP(t, srv.URL, token, "application/json, text/event-stream", call)
+		if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+			t.Fatalf("status %d, Content-Type %q", resp.StatusCode, ct)
+		}
+		var methods []string
+		for _, event := range strings.Split(strings.TrimSpace(body), "\n\n") {
+			data, ok := strings.CutPrefix(event, "event: message\ndata: ")
+			if !ok {
+				t.Fatalf("malformed event %q", event)
+			}
+			var msg struct {
+				Method string           `json:"method"`
+				ID     *json.RawMessage `json:"id"`
+			}
+			json.Unmarshal([]byte(data), &msg)
+			if msg.ID != nil {
+				msg.Method = "response " + string(*msg.ID)
+			}
+			methods = append(methods, msg.Method)
+		}
+		if len(methods) < 2 || methods[0] != "notifications/progress" || methods[len(methods)-1] != `response "w"` {
+			t.Errorf("stream = %q, want progress notifications then the response", methods)
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		batch := `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"},{"jsonrpc":"2.0","id":2,"method":"nope"}]`
+		_, body := postMCP(t, srv.URL, token, "application/json", batch)
+		var resps []jsonRpcResponse
+		if err := json.Unmarshal([]byte(body), &resps); err != nil || len(resps) != 2 {
+			t.Fatalf("batch response = %s, %v; want two responses", body, err)
+		}
+		if string(*resps[0].ID) != "1" || resps[0].Error != nil || string(*resps[1].ID) != "2" || resps[1].Error == nil || resps[1].Error.Code != -32601 {
+			t.Errorf("batch responses = %s", body)
+		}
+	})
+
+	t.Run("notifications", func(t *testing.T) {
+		for _, body := range []string{
+			`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+			`[{"jsonrpc":"2.0","method":"notifications/initialized"},{"jsonrpc":"2.0","method":"notifications/cancelled"}]`,
+		} {
+			resp, out := postMCP(t, srv.URL, token, "application/json, text/event-stream", body)
+			if resp.StatusCode != http.StatusAccepted || out != "" {
+				t.Errorf("%s: status %d, body %q; want 202 and no body", body, resp.StatusCode, out)
+			}
+		}
+	})
+
+	if resp, body := postMCP(t, srv.URL, token, "", `{"jsonrpc":`); resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "-32700") {
+		t.Errorf("malformed body: status %d, %s", resp.StatusCode, body)
+	}
+}
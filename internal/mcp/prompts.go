@@ -0,0 +1,148 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// Prompts
+// ---------------------------------------------------------------------------
+
+type prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Arguments   []promptArgument `json:"arguments,omitempty"`
+}
+
+type promptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// promptDef pairs a prompt with the function that renders its text from the
+// client-supplied arguments. Required arguments are checked before render.
+type promptDef struct {
+	prompt
+	render func(args map[string]string) string
+}
+
+// promptDefs are the orchestration workflows offered to MCP clients. Each one
+// spells out the sequence of codewire tool calls for a common pattern.
+var promptDefs = []promptDef{
+	{
+		prompt: prompt{
+			Name:        "spawn-worker-cohort",
+			Description: "Launch a group of tagged worker sessions for a task and collect their results",
+			Arguments: []promptArgument{
+				{Name: "task", Description: "What the workers should do", Required: true},
+				{Name: "count", Description: "Number of workers to launch (default 3)"},
+				{Name: "tag", Description: "Tag that groups the workers (default \"workers\")"},
+				{Name: "command", Description: "Command each worker runs (default: claude -p <task>)"},
+			},
+		},
+		render: func(args map[string]string) string {
+			count := argOr(args, "count", "3")
+			tag := argOr(args, "tag", "workers")
+			command := argOr(args, "command", fmt.Sprintf("claude -p %q", args["task"]))
+			return fmt.Sprintf(`Run a cohort of %s codewire worker sessions for this task:
+
+%s
+
+1. Split the task into %s independent parts.
+2. For each part, call codewire_launch_session with command %s, a descriptive name (e.g. "%s-1"), and tags ["%s"]. Include the worker's part of the task in its command or send it afterwards with codewire_send_input.
+3. Call codewire_wait_for with tags ["%s"] and condition "all" to block until every worker has finished.
+4. For each worker, call codewire_read_session_output with a tail to collect its result, and codewire_get_session_status to check its exit code.
+5. Summarize the combined results, noting any worker that failed.`,
+				count, args["task"], count, command, tag, tag, tag)
+		},
+	},
+	{
+		prompt: prompt{
+			Name:        "supervise-session",
+			Description: "Monitor a running session, answer its requests, and step in when it needs help",
+			Arguments: []promptArgument{
+				{Name: "session_id", Description: "Session to supervise", Required: true},
+				{Name: "goal", Description: "What the session is expected to accomplish"},
+			},
+		},
+		render: func(args map[string]string) string {
+			id := args["session_id"]
+			goal := ""
+			if g := args["goal"]; g != "" {
+				goal = fmt.Sprintf("\nThe session's goal: %s\n", g)
+			}
+			return fmt.Sprintf(`Supervise codewire session %s until it finishes.
+%s
+1. Call codewire_get_session_status for session %s to confirm it is running.
+2. Call codewire_watch_session for session %s to follow its output in bounded intervals.
+3. Between intervals, call codewire_read_messages for session %s. Answer any pending request with codewire_reply, using its request_id.
+4. If the session is stuck or heading the wrong way, send guidance with codewire_msg or codewire_send_input. Only kill it with codewire_kill_session as a last resort.
+5. When the session completes, read the tail of its output with codewire_read_session_output and report whether it met its goal.`,
+				id, goal, id, id, id)
+		},
+	},
+	{
+		prompt: prompt{
+			Name:        "triage-failed-sessions",
+			Description: "Find sessions that exited with an error, diagnose each failure, and propose next steps",
+			Arguments: []promptArgument{
+				{Name: "tag", Description: "Only triage sessions with this tag"},
+			},
+		},
+		render: func(args map[string]string) string {
+			scope := "all completed sessions"
+			if tag := args["tag"]; tag != "" {
+				scope = fmt.Sprintf("completed sessions tagged %q", tag)
+			}
+			return fmt.Sprintf(`Triage the failed codewire sessions among %s.
+
+1. Call codewire_list_sessions with status_filter "completed" and keep the sessions whose exit code is non-zero.
+2. For each failed session, call codewire_get_session_status for its command and working directory, then codewire_read_session_output with a tail of about 100 lines to find the error.
+3. Group failures that share a root cause.
+4. For each group, explain the cause and propose a fix. Where a retry is likely to succeed, relaunch it with codewire_launch_session using the same command, name, and tags.`,
+				scope)
+		},
+	},
+}
+
+func listPrompts() []prompt {
+	prompts := make([]prompt, len(promptDefs))
+	for i, d := range promptDefs {
+		prompts[i] = d.prompt
+	}
+	return prompts
+}
+
+// getPrompt renders the named prompt as a single user message.
+func getPrompt(name string, args map[string]string) (map[string]interface{}, error) {
+	for _, d := range promptDefs {
+		if d.Name != name {
+			continue
+		}
+		for _, a := range d.Arguments {
+			if a.Required && strings.TrimSpace(args[a.Name]) == "" {
+				return nil, fmt.Errorf("missing required argument: %s", a.Name)
+			}
+		}
+		return map[string]interface{}{
+			"description": d.Description,
+			"messages": []map[string]interface{}{
+				{
+					"role":    "user",
+					"content": map[string]interface{}{"type": "text", "text": d.render(args)},
+				},
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown prompt: %s", name)
+}
+
+// argOr returns args[key], or def when it is empty.
+func argOr(args map[string]string, key, def string) string {
+	if v := args[key]; v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// promptsRPC sends method with params through handleRPC.
+func promptsRPC(t *testing.T, method, params string) *jsonRpcResponse {
+	t.Helper()
+	id := json.RawMessage(`1`)
+	req := jsonRpcRequest{Jsonrpc: "2.0", ID: &id, Method: method}
+	if params != "" {
+		req.Params = json.RawMessage(params)
+	}
+	return handleRPC(t.TempDir(), nil, nil, false, req, nil)
+}
+
+// promptText returns the text of the single message a prompts/get result
+// holds.
+func promptText(t *testing.T, resp *jsonRpcResponse) string {
+	t.Helper()
+	if resp.Error != nil {
+		t.Fatalf("prompts/get: %s", resp.Error.Message)
+	}
+	messages := resp.Result.(map[string]interface{})["messages"].([]map[string]interface{})
+	if len(messages) != 1 || messages[0]["role"] != "user" {
+		t.Fatalf("messages = %+v, want one user message", messages)
+	}
+	return messages[0]["content"].(map[string]interface{})["text"].(string)
+}
+
+func TestPromptsList(t *testing.T) {
+	resp := promptsRPC(t, "prompts/list", "")
+	if resp.Error != nil {
+		t.Fatalf("prompts/list: %s", resp.Error.Message)
+	}
+	prompts := resp.Result.(map[string]interface{})["prompts"].([]prompt)
+	if len(prompts) != len(promptDefs) {
+		t.Fatalf("%d prompts listed, want %d", len(prompts), len(promptDefs))
+	}
+	names := make(map[string]bool)
+	for _, p := range prompts {
+		if p.Description == "" {
+			t.Errorf("prompt %q has no description", p.Name)
+		}
+		names[p.Name] = true
+	}
+	for _, name := range []string{"spawn-worker-cohort", "supervise-session", "triage-failed-sessions"} {
+		if !names[name] {
+			t.Errorf("prompt %q not listed", name)
+		}
+	}
+}
+
+func TestPromptsGet(t *testing.T) {
+	// Required arguments must be given and not blank.
+	for _, params := range []string{
+		`{"name":"spawn-worker-cohort"}`,
+		`{"name":"spawn-worker-cohort","arguments":{"task":"  ","count":"2"}}`,
+		`{"name":"supervise-session","arguments":{"goal":"ship it"}}`,
+	} {
+		resp := promptsRPC(t, "prompts/get", params)
+		if resp.Error == nil || resp.Error.Code != -32602 || !strings.Contains(resp.Error.Message, "missing required argument") {
+			t.Errorf("%s: error = %+v, want a missing argument", params, resp.Error)
+		}
+	}
+	if resp := promptsRPC(t, "prompts/get", `{"name":"no-such-prompt"}`); resp.Error == nil || !strings.Contains(resp.Error.Message, "unknown prompt") {
+		t.Errorf("unknown prompt: error = %+v", resp.Error)
+	}
+
+	// Optional arguments fall back to their defaults.
+	text := promptText(t, promptsRPC(t, "prompts/get", `{"name":"spawn-worker-cohort","arguments":{"task":"fix the tests"}}`))
+	for _, want := range []string{"cohort of 3 ", "fix the tests", `claude -p "fix the tests"`, `tags ["workers"]`, `"workers-1"`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("spawn-worker-cohort text lacks %q:\n%s", want, text)
+		}
+	}
+
+	// Given arguments replace them.
+	text = promptText(t, promptsRPC(t, "prompts/get", `{"name":"spawn-worker-cohort","arguments":{"task":"lint","count":"5","tag":"linters","command":"make lint"}}`))
+	for _, want := range []string{"cohort of 5 ", "into 5 independent", "with command make lint", `tags ["linters"]`, `"linters-1"`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("spawn-worker-cohort text lacks %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "workers") {
+		t.Errorf("spawn-worker-cohort text still uses the default tag:\n%s", text)
+	}
+
+	text = promptText(t, promptsRPC(t, "prompts/get", `{"name":"supervise-session","arguments":{"session_id":"42"}}`))
+	if !strings.Contains(text, "session 42") || strings.Contains(text, "goal:") {
+		t.Errorf("supervise-session text without a goal:\n%s", text)
+	}
+	text = promptText(t, promptsRPC(t, "prompts/get", `{"name":"supervise-session","arguments":{"session_id":"42","goal":"ship it"}}`))
+	if !strings.Contains(text, "The session's goal: ship it") {
+		t.Errorf("supervise-session text lacks the goal:\n%s", text)
+	}
+
+	text = promptText(t, promptsRPC(t, "prompts/get", `{"name":"triage-failed-sessions"}`))
+	if !strings.Contains(text, "among all completed sessions") {
+		t.Errorf("triage-failed-sessions text without a tag:\n%s", text)
+	}
+	text = promptText(t, promptsRPC(t, "prompts/get", `{"name":"triage-failed-sessions","arguments":{"tag":"nightly"}}`))
+	if !strings.Contains(text, `completed sessions tagged "nightly"`) {
+		t.Errorf("triage-failed-sessions text lacks the tag:\n%s", text)
+	}
+}
@@ -0,0 +1,318 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// ---------------------------------------------------------------------------
+// Resources
+// ---------------------------------------------------------------------------
+
+// Session resources are addressed as codewire://sessions/{id}/{kind}.
+const sessionResourcePrefix = "codewire://sessions/"
+
+// resourceKinds describes the per-session resources, in listing order.
+var resourceKinds = []struct {
+	kind        string
+	mimeType    string
+	description string
+}{
+	{"output", "text/plain", "Session output log"},
+	{"inbox", "application/json", "Messages and requests received by the session"},
+	{"status", "application/json", "Session status and metadata"},
+}
+
+type resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type resourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+func sessionResourceURI(id uint32, kind string) string {
+	return fmt.Sprintf("%s%d/%s", sessionResourcePrefix, id, kind)
+}
+
+// parseSessionResourceURI splits codewire://sessions/{id}/{kind}.
+func parseSessionResourceURI(uri string) (uint32, string, error) {
+	rest, ok := strings.CutPrefix(uri, sessionResourcePrefix)
+	if !ok {
+		return 0, "", fmt.Errorf("unknown resource: %s", uri)
+	}
+	idStr, kind, ok := strings.Cut(rest, "/")
+	if !ok {
+		return 0, "", fmt.Errorf("unknown resource: %s", uri)
+	}
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid session id in resource: %s", uri)
+	}
+	for _, k := range resourceKinds {
+		if k.kind == kind {
+			return uint32(id), kind, nil
+		}
+	}
+	return 0, "", fmt.Errorf("unknown resource: %s", uri)
+}
+
+// listResources returns the output, inbox, and status resources of every
+// session on the target node.
+func listResources(target *client.Target) ([]resource, error) {
+	resp, err := nodeRequest(target, &protocol.Request{Type: "ListSessions"})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Type == "Error" {
+		return nil, fmt.Errorf("%s", resp.Message)
+	}
+
+	resources := []resource{}
+	if resp.Sessions == nil {
+		return resources, nil
+	}
+	for _, s := range *resp.Sessions {
+		label := fmt.Sprintf("session %d", s.ID)
+		if s.Name != "" {
+			label = fmt.Sprintf("session %d (%s)", s.ID, s.Name)
+		}
+		for _, k := range resourceKinds {
+			resources = append(resources, resource{
+				URI:         sessionResourceURI(s.ID, k.kind),
+				Name:        label + " " + k.kind,
+				Description: k.description,
+				MimeType:    k.mimeType,
+			})
+		}
+	}
+	return resources, nil
+}
+
+func resourceTemplates() []resourceTemplate {
+	var templates []resourceTemplate
+	for _, k := range resourceKinds {
+		templates = append(templates, resourceTemplate{
+			URITemplate: sessionResourcePrefix + "{id}/" + k.kind,
+			Name:        "session " + k.kind,
+			Description: k.description,
+			MimeType:    k.mimeType,
+		})
+	}
+	return templates
+}
+
+// readResource returns the contents of a session resource, reusing the
+// corresponding tool handlers.
+func readResource(target *client.Target, uri string) (map[string]interface{}, error) {
+	id, kind, err := parseSessionResourceURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	args := map[string]interface{}{"session_id": float64(id)}
+	var text, mimeType string
+	switch kind {
+	case "output":
+		text, err = toolReadSessionOutput(target, args)
+		mimeType = "text/plain"
+	case "inbox":
+		text, err = toolReadMessages(target, args)
+		mimeType = "application/json"
+	case "status":
+		text, err = toolGetSessionStatus(target, args)
+		mimeType = "application/json"
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{"uri": uri, "mimeType": mimeType, "text": text},
+		},
+	}, nil
+}
+
+// ---------------------------------------------------------------------------
+// Resource subscriptions
+// ---------------------------------------------------------------------------
+
+// outputUpdateInterval throttles update notifications for busy output logs.
+const outputUpdateInterval = time.Second
+
+// resourceSubscriptions holds the client's resource subscriptions. Each one
+// keeps a connection to the node open and sends notifications/resources/updated
+// when the resource changes. Subscriptions need a long-lived channel back to
+// the client, so they are only available over stdio.
+type resourceSubscriptions struct {
+	target *client.Target
+	send   func(interface{})
+
+	mu   sync.Mutex
+	subs map[string]*resourceWatch
+}
+
+// resourceWatch is one subscription's node connection.
+type resourceWatch struct {
+	reader connection.FrameReader
+	writer connection.FrameWriter
+	once   sync.Once
+}
+
+func (w *resourceWatch) stop() {
+	w.once.Do(func() {
+		w.reader.Close()
+		w.writer.Close()
+	})
+}
+
+func newResourceSubscriptions(target *client.Target, send func(interface{})) *resourceSubscriptions {
+	return &resourceSubscriptions{target: target, send: send, subs: make(map[string]*resourceWatch)}
+}
+
+// Subscribe starts watching uri. Subscribing twice is a no-op.
+func (r *resourceSubscriptions) Subscribe(uri string) error {
+	id, kind, err := parseSessionResourceURI(uri)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.subs[uri]; ok {
+		return nil
+	}
+
+	reader, writer, err := connectNode(r.target)
+	if err != nil {
+		return err
+	}
+
+	req := &protocol.Request{ID: &id}
+	switch kind {
+	case "output":
+		includeHistory := false
+		req.Type = "WatchSession"
+		req.IncludeHistory = &includeHistory
+	case "inbox":
+		req.Type = "Subscribe"
+		req.EventTypes = []string{"direct.message", "message.request", "message.reply"}
+	case "status":
+		req.Type = "Subscribe"
+		req.EventTypes = []string{"session.status", "session.output_summary"}
+	}
+	if err := writer.SendRequest(req); err != nil {
+		reader.Close()
+		writer.Close()
+		return err
+	}
+
+	w := &resourceWatch{reader: reader, writer: writer}
+	r.subs[uri] = w
+	go r.watch(uri, w)
+	return nil
+}
+
+// Unsubscribe stops watching uri.
+func (r *resourceSubscriptions) Unsubscribe(uri string) {
+	r.mu.Lock()
+	w, ok := r.subs[uri]
+	delete(r.subs, uri)
+	r.mu.Unlock()
+	if ok {
+		w.stop()
+	}
+}
+
+// watch reads frames for a subscription until the connection closes or the
+// watched session finishes, notifying the client of each change. Output
+// changes are coalesced to at most one notification per outputUpdateInterval.
+func (r *resourceSubscriptions) watch(uri string, w *resourceWatch) {
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		w.stop()
+		r.mu.Lock()
+		if r.subs[uri] == w {
+			delete(r.subs, uri)
+		}
+		r.mu.Unlock()
+	}()
+
+	frameCh := make(chan *protocol.Frame)
+	go func() {
+		defer close(frameCh)
+		for {
+			f, err := w.reader.ReadFrame()
+			if err != nil || f == nil {
+				return
+			}
+			select {
+			case frameCh <- f:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(outputUpdateInterval)
+	defer ticker.Stop()
+	dirty := false
+
+	for {
+		select {
+		case f, ok := <-frameCh:
+			if !ok {
+				return
+			}
+			if f.Type != protocol.FrameControl {
+				continue
+			}
+			var resp protocol.Response
+			if err := json.Unmarshal(f.Payload, &resp); err != nil {
+				continue
+			}
+			switch resp.Type {
+			case "Event":
+				r.notify(uri)
+			case "WatchUpdate":
+				if resp.Done != nil && *resp.Done {
+					r.notify(uri)
+					return
+				}
+				dirty = true
+			case "Error":
+				return
+			}
+
+		case <-ticker.C:
+			if dirty {
+				dirty = false
+				r.notify(uri)
+			}
+		}
+	}
+}
+
+func (r *resourceSubscriptions) notify(uri string) {
+	r.send(jsonRpcNotification{
+		Jsonrpc: "2.0",
+		Method:  "notifications/resources/updated",
+		Params:  map[string]interface{}{"uri": uri},
+	})
+}
@@ -0,0 +1,127 @@
+package mcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestParseSessionResourceURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		id   uint32
+		kind string
+		ok   bool
+	}{
+		{"codewire://sessions/12/output", 12, "output", true},
+		{"codewire://sessions/0/inbox", 0, "inbox", true},
+		{"codewire://sessions/4294967295/status", 4294967295, "status", true},
+		{"file:///sessions/12/output", 0, "", false},
+		{"codewire://session/12/output", 0, "", false},
+		{"codewire://sessions/abc/output", 0, "", false},
+		{"codewire://sessions/-1/output", 0, "", false},
+		{"codewire://sessions/4294967296/output", 0, "", false},
+		{"codewire://sessions//output", 0, "", false},
+		{"codewire://sessions/12", 0, "", false},
+		{"codewire://sessions/12/", 0, "", false},
+		{"codewire://sessions/12/logs", 0, "", false},
+		{"codewire://sessions/12/output/extra", 0, "", false},
+	}
+	for _, tt := range tests {
+		id, kind, err := parseSessionResourceURI(tt.uri)
+		if (err == nil) != tt.ok || id != tt.id || kind != tt.kind {
+			t.Errorf("parseSessionResourceURI(%q) = %d, %q, %v", tt.uri, id, kind, err)
+		}
+		if tt.ok && sessionResourceURI(id, kind) != tt.uri {
+			t.Errorf("sessionResourceURI(%d, %q) = %q, want %q", id, kind, sessionResourceURI(id, kind), tt.uri)
+		}
+	}
+}
+
+func TestResourceSubscriptions(t *testing.T) {
+	target := startNode(t)
+	id := launch(t, target, "sleep", "30")
+	uri := sessionResourceURI(id, "inbox")
+
+	updates := make(chan string, 16)
+	subs := newResourceSubscriptions(target, func(msg interface{}) {
+		n := msg.(jsonRpcNotification)
+		if n.Method == "notifications/resources/updated" {
+			updates <- n.Params.(map[string]interface{})["uri"].(string)
+		}
+	})
+	if err := subs.Subscribe("codewire://sessions/1/logs"); err == nil {
+		t.Error("subscribed to an unknown resource")
+	}
+	for range 2 {
+		if err := subs.Subscribe(uri); err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+	}
+	if len(subs.subs) != 1 {
+		t.Fatalf("%d subscriptions, want one", len(subs.subs))
+	}
+
+	// The node registers the subscription asynchronously, so send until a
+	// message is seen.
+	send := func() {
+		t.Helper()
+		resp, err := nodeRequest(target, &protocol.Request{Type: "MsgSend", ToID: &id, Body: "ping"})
+		if err != nil || resp.Type == "Error" {
+			t.Fatalf("MsgSend: %+v, %v", resp, err)
+		}
+	}
+	for i := 0; ; i++ {
+		send()
+		select {
+		case got := <-updates:
+			if got != uri {
+				t.Fatalf("update for %q, want %q", got, uri)
+			}
+		case <-time.After(200 * time.Millisecond):
+			if i == 25 {
+				t.Fatal("no update after sending a message")
+			}
+			continue
+		}
+		break
+	}
+
+	subs.Unsubscribe(uri)
+	if len(subs.subs) != 0 {
+		t.Fatalf("%d subscriptions left after Unsubscribe", len(subs.subs))
+	}
+	for len(updates) > 0 {
+		<-updates
+	}
+	send()
+	select {
+	case got := <-updates:
+		t.Fatalf("update for %q after Unsubscribe", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// A finished session ends the subscription on its own.
+	done := launch(t, target, "sleep", "0.3")
+	if err := subs.Subscribe(sessionResourceURI(done, "output")); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	select {
+	case <-updates:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update when the session finished")
+	}
+	for i := 0; ; i++ {
+		subs.mu.Lock()
+		n := len(subs.subs)
+		subs.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if i == 50 {
+			t.Fatal("subscription kept after the session finished")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -2,15 +2,17 @@ package mcp
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/codewiresh/codewire/internal/client"
 	"github.com/codewiresh/codewire/internal/config"
 	"github.com/codewiresh/codewire/internal/connection"
 	"github.com/codewiresh/codewire/internal/protocol"
@@ -34,6 +36,12 @@ type jsonRpcResponse struct {
 	Error   *jsonRpcError    `json:"error,omitempty"`
 }
 
+type jsonRpcNotification struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
 type jsonRpcError struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
@@ -51,13 +59,21 @@ type tool struct {
 // ---------------------------------------------------------------------------
 
 // RunMCPServer reads JSON-RPC requests from stdin, dispatches them, and writes
-// responses to stdout. It communicates with the codewire node over a Unix
-// socket at dataDir/codewire.sock.
-func RunMCPServer(dataDir string) error {
+// responses to stdout. Node tools talk to target (the local Unix socket at
+// dataDir/codewire.sock, or a remote server) unless a call names its own
+// target.
+func RunMCPServer(dataDir string, target *client.Target) error {
 	scanner := bufio.NewScanner(os.Stdin)
 	scanner.Buffer(make([]byte, 1024*1024), 1024*1024) // 1 MB buffer
 
-	version := "0.1.0"
+	var mu sync.Mutex
+	send := func(msg interface{}) {
+		out, _ := json.Marshal(msg)
+		mu.Lock()
+		fmt.Fprintf(os.Stdout, "%s\n", out)
+		mu.Unlock()
+	}
+	subs := newResourceSubscriptions(target, send)
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -71,64 +87,208 @@ func RunMCPServer(dataDir string) error {
 			continue
 		}
 
-		var resp jsonRpcResponse
-		resp.Jsonrpc = "2.0"
-		resp.ID = req.ID
+		if resp := handleRPC(dataDir, target, subs, true, req, send); resp != nil {
+			send(resp)
+		}
+	}
+	return scanner.Err()
+}
 
-		switch req.Method {
-		case "initialize":
-			resp.Result = map[string]interface{}{
-				"protocolVersion": "2024-11-05",
-				"capabilities": map[string]interface{}{
-					"tools": map[string]interface{}{},
-				},
-				"serverInfo": map[string]interface{}{
-					"name":    "codewire",
-					"version": version,
+// handleRPC dispatches a single JSON-RPC request. send delivers server-initiated
+// notifications (e.g. progress) while the request is being handled. subs is nil
+// on transports that cannot push resource updates. Tool calls may name their
+// own target only with perCallTarget, which is for the local user's stdio
+// server: over HTTP it would let any client with the token make the server
+// dial URLs of its choosing, or use the tokens saved in servers.toml. Returns
+// nil for client notifications, which take no response.
+func handleRPC(dataDir string, target *client.Target, subs *resourceSubscriptions, perCallTarget bool, req jsonRpcRequest, send func(interface{})) *jsonRpcResponse {
+	if req.ID == nil && strings.HasPrefix(req.Method, "notifications/") {
+		return nil
+	}
+
+	resp := &jsonRpcResponse{Jsonrpc: "2.0", ID: req.ID}
+
+	switch req.Method {
+	case "initialize":
+		resp.Result = map[string]interface{}{
+			"protocolVersion": "2024-11-05",
+			"capabilities": map[string]interface{}{
+				"tools": map[string]interface{}{},
+				"resources": map[string]interface{}{
+					"subscribe": subs != nil,
 				},
-			}
+				"prompts": map[string]interface{}{},
+			},
+			"serverInfo": map[string]interface{}{
+				"name":    "codewire",
+				"version": serverVersion,
+			},
+		}
+
+	case "ping":
+		resp.Result = map[string]interface{}{}
 
-		case "tools/list":
+	case "tools/list":
+		resp.Result = map[string]interface{}{
+			"tools": getTools(perCallTarget),
+		}
+
+	case "tools/call":
+		result, err := handleToolCall(dataDir, target, perCallTarget, req.Params, send)
+		if err != nil {
+			resp.Error = &jsonRpcError{Code: -32603, Message: err.Error()}
+		} else {
 			resp.Result = map[string]interface{}{
-				"tools": getTools(),
+				"content": []map[string]interface{}{
+					{"type": "text", "text": result},
+				},
 			}
+		}
+
+	case "resources/list":
+		resources, err := listResources(target)
+		if err != nil {
+			resp.Error = &jsonRpcError{Code: -32603, Message: err.Error()}
+		} else {
+			resp.Result = map[string]interface{}{"resources": resources}
+		}
 
-		case "tools/call":
-			result, err := handleToolCall(dataDir, req.Params)
-			if err != nil {
-				resp.Error = &jsonRpcError{Code: -32603, Message: err.Error()}
+	case "resources/templates/list":
+		resp.Result = map[string]interface{}{
+			"resourceTemplates": resourceTemplates(),
+		}
+
+	case "resources/read", "resources/subscribe", "resources/unsubscribe":
+		var p struct {
+			URI string `json:"uri"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil || p.URI == "" {
+			resp.Error = &jsonRpcError{Code: -32602, Message: "missing uri"}
+			break
+		}
+		var err error
+		switch req.Method {
+		case "resources/read":
+			resp.Result, err = readResource(target, p.URI)
+		case "resources/subscribe":
+			if subs == nil {
+				err = fmt.Errorf("resource subscriptions are only supported over stdio")
 			} else {
-				resp.Result = map[string]interface{}{
-					"content": []map[string]interface{}{
-						{"type": "text", "text": result},
-					},
-				}
+				err = subs.Subscribe(p.URI)
 			}
-
-		default:
-			resp.Error = &jsonRpcError{
-				Code:    -32601,
-				Message: fmt.Sprintf("method not found: %s", req.Method),
+			resp.Result = map[string]interface{}{}
+		case "resources/unsubscribe":
+			if subs != nil {
+				subs.Unsubscribe(p.URI)
 			}
+			resp.Result = map[string]interface{}{}
+		}
+		if err != nil {
+			resp.Result = nil
+			resp.Error = &jsonRpcError{Code: -32603, Message: err.Error()}
 		}
 
-		out, _ := json.Marshal(resp)
-		fmt.Fprintf(os.Stdout, "%s\n", out)
+	case "prompts/list":
+		resp.Result = map[string]interface{}{
+			"prompts": listPrompts(),
+		}
+
+	case "prompts/get":
+		var p struct {
+			Name      string            `json:"name"`
+			Arguments map[string]string `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			resp.Error = &jsonRpcError{Code: -32602, Message: fmt.Sprintf("invalid params: %v", err)}
+			break
+		}
+		result, err := getPrompt(p.Name, p.Arguments)
+		if err != nil {
+			resp.Error = &jsonRpcError{Code: -32602, Message: err.Error()}
+		} else {
+			resp.Result = result
+		}
+
+	default:
+		resp.Error = &jsonRpcError{
+			Code:    -32601,
+			Message: fmt.Sprintf("method not found: %s", req.Method),
+		}
 	}
-	return scanner.Err()
+	return resp
+}
+
+// serverVersion is reported in the initialize response.
+const serverVersion = "0.1.0"
+
+// progressReporter streams incremental tool output to the client as MCP
+// notifications/progress messages. It is only created when the tools/call
+// request carries a _meta.progressToken; a nil reporter is a no-op.
+type progressReporter struct {
+	send     func(interface{})
+	token    json.RawMessage
+	progress int
+}
+
+func newProgressReporter(send func(interface{}), token json.RawMessage) *progressReporter {
+	if send == nil || len(token) == 0 || string(token) == "null" {
+		return nil
+	}
+	return &progressReporter{send: send, token: token}
+}
+
+// report sends message as the next progress notification.
+func (p *progressReporter) report(message string) {
+	if p == nil {
+		return
+	}
+	p.progress++
+	p.send(jsonRpcNotification{
+		Jsonrpc: "2.0",
+		Method:  "notifications/progress",
+		Params: map[string]interface{}{
+			"progressToken": p.token,
+			"progress":      p.progress,
+			"message":       message,
+		},
+	})
 }
 
 // ---------------------------------------------------------------------------
 // Tool definitions
 // ---------------------------------------------------------------------------
 
-// getTools returns all MCP tools (local node + platform environment tools).
-func getTools() []tool {
+// getTools returns all MCP tools (local node + platform environment tools),
+// with the "target" argument if perCallTarget.
+func getTools(perCallTarget bool) []tool {
 	tools := getNodeTools()
+	if perCallTarget {
+		for _, t := range tools {
+			addTargetArg(t)
+		}
+	}
 	tools = append(tools, environmentTools()...)
 	return tools
 }
 
+// addTargetArg adds the optional per-call "target" argument to a node tool's
+// input schema.
+func addTargetArg(t tool) {
+	schema, ok := t.InputSchema.(map[string]interface{})
+	if !ok {
+		return
+	}
+	props, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		props = map[string]interface{}{}
+		schema["properties"] = props
+	}
+	props["target"] = map[string]interface{}{
+		"type":        "string",
+		"description": "Server to run against: a name from servers.toml or a URL (default: the server the MCP server was started with)",
+	}
+}
+
 func getNodeTools() []tool {
 	return []tool{
 		{
@@ -163,6 +323,29 @@ func getNodeTools() []tool {
 						"type":        "integer",
 						"description": "Maximum characters to return (default: 500000)",
 					},
+					"sanitize": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"none", "colors", "full"},
+						"description": "How much terminal escape codes are cleaned up: full leaves plain text, colors keeps colors and styles, none returns output as written (default: full)",
+					},
+				},
+				"required": []string{"session_id"},
+			},
+		},
+		{
+			Name:        "codewire_get_screen",
+			Description: "Get what a session's terminal shows now, as rendered by the node's terminal emulator. Use it to read full-screen programs (TUIs, editors, agents) whose raw output is hard to follow.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"session_id": map[string]interface{}{
+						"type":        "integer",
+						"description": "The session ID to read the screen of",
+					},
+					"ansi": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Keep colors and styles as ANSI escape sequences (default: false)",
+					},
 				},
 				"required": []string{"session_id"},
 			},
@@ -183,15 +366,24 @@ func getNodeTools() []tool {
 					},
 					"auto_newline": map[string]interface{}{
 						"type":        "boolean",
-						"description": "Automatically add newline (default: true)",
+						"description": "Automatically add newline (default: true, unless keys are given)",
+					},
+					"keys": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Keys to send after the input, to drive interactive programs: " + client.KeyNames(),
+					},
+					"from_session_id": map[string]interface{}{
+						"type":        "integer",
+						"description": "Sender session ID (optional), checked against the session's accept-input-from policy",
 					},
 				},
-				"required": []string{"session_id", "input"},
+				"required": []string{"session_id"},
 			},
 		},
 		{
 			Name:        "codewire_watch_session",
-			Description: "Monitor a session in real-time (time-bounded)",
+			Description: "Monitor a session in real-time (time-bounded). If the call includes a progressToken, output is streamed as progress notifications as it arrives.",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -211,6 +403,11 @@ func getNodeTools() []tool {
 						"type":        "integer",
 						"description": "Maximum watch duration in seconds (default: 30)",
 					},
+					"sanitize": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"none", "colors", "full"},
+						"description": "How much terminal escape codes are cleaned up: full leaves plain text, colors keeps colors and styles, none returns output as written (default: full)",
+					},
 				},
 				"required": []string{"session_id"},
 			},
@@ -251,7 +448,7 @@ func getNodeTools() []tool {
 					"tags": map[string]interface{}{
 						"type":        "array",
 						"items":       map[string]interface{}{"type": "string"},
-						"description": "Tags for grouping/filtering (e.g. ['worker', 'build'])",
+						"description": "Tags for grouping/filtering (e.g. ['worker', 'build']; defaults to client.tags from config.toml)",
 					},
 				},
 				"required": []string{"command"},
@@ -277,7 +474,7 @@ func getNodeTools() []tool {
 		},
 		{
 			Name:        "codewire_subscribe",
-			Description: "Subscribe to session events (returns events as they arrive, time-bounded)",
+			Description: "Subscribe to session events (time-bounded). If the call includes a progressToken, each event is streamed as a progress notification; otherwise events are returned together at the end.",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -295,6 +492,10 @@ func getNodeTools() []tool {
 						"items":       map[string]interface{}{"type": "string"},
 						"description": "Filter by event type (session.created, session.status, etc.)",
 					},
+					"filter": map[string]interface{}{
+						"type":        "string",
+						"description": "Filter expression over event, session, tags, labels.<key> and data.<field>, e.g. event == \"session.status\" && data.to == \"completed\" && \"build\" in tags",
+					},
 					"max_duration_seconds": map[string]interface{}{
 						"type":        "integer",
 						"description": "Maximum subscription duration in seconds (default: 30)",
@@ -319,8 +520,12 @@ func getNodeTools() []tool {
 					},
 					"condition": map[string]interface{}{
 						"type":        "string",
-						"description": "Wait condition: 'all' (default) or 'any'",
-						"enum":        []string{"all", "any"},
+						"description": "Wait condition: 'all' (default) or 'any' session finished, 'success' (all exited 0) or 'any-failure' (one was killed or exited non-zero)",
+						"enum":        []string{"all", "any", "success", "any-failure"},
+					},
+					"until_output": map[string]interface{}{
+						"type":        "string",
+						"description": "Instead of a condition, wait for a line of output matching this regular expression",
 					},
 					"timeout_seconds": map[string]interface{}{
 						"type":        "integer",
@@ -426,7 +631,7 @@ func getNodeTools() []tool {
 		},
 		{
 			Name:        "codewire_list_nodes",
-			Description: "List all registered nodes from the relay",
+			Description: "List all registered nodes from the relay, with the load and health each connected node last reported (sessions, CPUs, load average, memory, disk free, version)",
 			InputSchema: map[string]interface{}{
 				"type":       "object",
 				"properties": map[string]interface{}{},
@@ -518,55 +723,74 @@ func getNodeTools() []tool {
 // Tool dispatch
 // ---------------------------------------------------------------------------
 
-// handleToolCall dispatches to the appropriate tool handler.
-func handleToolCall(dataDir string, params json.RawMessage) (string, error) {
+// handleToolCall dispatches to the appropriate tool handler. Node tools use
+// target unless, with perCallTarget, the call carries a "target" argument
+// naming another server.
+func handleToolCall(dataDir string, target *client.Target, perCallTarget bool, params json.RawMessage, send func(interface{})) (string, error) {
 	var p struct {
 		Name      string                 `json:"name"`
 		Arguments map[string]interface{} `json:"arguments"`
+		Meta      struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
 	}
 	if err := json.Unmarshal(params, &p); err != nil {
 		return "", fmt.Errorf("invalid params: %w", err)
 	}
 
 	args := p.Arguments
+	progress := newProgressReporter(send, p.Meta.ProgressToken)
+
+	if name, ok := args["target"].(string); ok && name != "" {
+		if !perCallTarget {
+			return "", fmt.Errorf("the target argument is not accepted over HTTP")
+		}
+		t, err := client.ResolveTarget(dataDir, name, "")
+		if err != nil {
+			return "", fmt.Errorf("resolving target %q: %w", name, err)
+		}
+		target = t
+	}
 
 	switch p.Name {
 	case "codewire_list_sessions":
-		return toolListSessions(dataDir, args)
+		return toolListSessions(target, args)
 	case "codewire_read_session_output":
-		return toolReadSessionOutput(dataDir, args)
+		return toolReadSessionOutput(target, args)
+	case "codewire_get_screen":
+		return toolGetScreen(target, args)
 	case "codewire_send_input":
-		return toolSendInput(dataDir, args)
+		return toolSendInput(target, args)
 	case "codewire_watch_session":
-		return toolWatchSession(dataDir, args)
+		return toolWatchSession(target, args, progress)
 	case "codewire_get_session_status":
-		return toolGetSessionStatus(dataDir, args)
+		return toolGetSessionStatus(target, args)
 	case "codewire_launch_session":
-		return toolLaunchSession(dataDir, args)
+		return toolLaunchSession(dataDir, target, args)
 	case "codewire_kill_session":
-		return toolKillSession(dataDir, args)
+		return toolKillSession(target, args)
 	case "codewire_subscribe":
-		return toolSubscribe(dataDir, args)
+		return toolSubscribe(target, args, progress)
 	case "codewire_wait_for":
-		return toolWaitFor(dataDir, args)
+		return toolWaitFor(target, args)
 	case "codewire_msg":
-		return toolMsg(dataDir, args)
+		return toolMsg(target, args)
 	case "codewire_read_messages":
-		return toolReadMessages(dataDir, args)
+		return toolReadMessages(target, args)
 	case "codewire_request":
-		return toolRequest(dataDir, args)
+		return toolRequest(target, args)
 	case "codewire_reply":
-		return toolReply(dataDir, args)
+		return toolReply(target, args)
 	case "codewire_list_nodes":
 		return toolListNodes(dataDir, args)
 	case "codewire_kv_set":
-		return toolKVSet(dataDir, args)
+		return toolKVSet(target, args)
 	case "codewire_kv_get":
-		return toolKVGet(dataDir, args)
+		return toolKVGet(target, args)
 	case "codewire_kv_list":
-		return toolKVList(dataDir, args)
+		return toolKVList(target, args)
 	case "codewire_kv_delete":
-		return toolKVDelete(dataDir, args)
+		return toolKVDelete(target, args)
 	// Platform environment tools (use API, not local node)
 	case "codewire_list_environments":
 		return toolListEnvironments(args)
@@ -595,8 +819,8 @@ func handleToolCall(dataDir string, params json.RawMessage) (string, error) {
 // Tool handlers
 // ---------------------------------------------------------------------------
 
-func toolListSessions(dataDir string, args map[string]interface{}) (string, error) {
-	resp, err := nodeRequest(dataDir, &protocol.Request{Type: "ListSessions"})
+func toolListSessions(target *client.Target, args map[string]interface{}) (string, error) {
+	resp, err := nodeRequest(target, &protocol.Request{Type: "ListSessions"})
 	if err != nil {
 		return "", err
 	}
@@ -637,7 +861,7 @@ func toolListSessions(dataDir string, args map[string]interface{}) (string, erro
 	return string(out), nil
 }
 
-func toolReadSessionOutput(dataDir string, args map[string]interface{}) (string, error) {
+func toolReadSessionOutput(target *client.Target, args map[string]interface{}) (string, error) {
 	sessionID, err := argUint32(args, "session_id")
 	if err != nil {
 		return "", err
@@ -654,12 +878,15 @@ func toolReadSessionOutput(dataDir string, args map[string]interface{}) (string,
 		maxChars = uint64(v)
 	}
 
+	sanitize, _ := args["sanitize"].(string)
+
 	f := false
-	resp, err := nodeRequest(dataDir, &protocol.Request{
-		Type:   "Logs",
-		ID:     &sessionID,
-		Follow: &f,
-		Tail:   tail,
+	resp, err := nodeRequest(target, &protocol.Request{
+		Type:     "Logs",
+		ID:       &sessionID,
+		Follow:   &f,
+		Tail:     tail,
+		Sanitize: sanitize,
 	})
 	if err != nil {
 		return "", err
@@ -679,18 +906,56 @@ func toolReadSessionOutput(dataDir string, args map[string]interface{}) (string,
 	return data, nil
 }
 
-func toolSendInput(dataDir string, args map[string]interface{}) (string, error) {
+func toolGetScreen(target *client.Target, args map[string]interface{}) (string, error) {
 	sessionID, err := argUint32(args, "session_id")
 	if err != nil {
 		return "", err
 	}
+	ansi, _ := args["ansi"].(bool)
 
+	resp, err := nodeRequest(target, &protocol.Request{
+		Type: "Screen",
+		ID:   &sessionID,
+		ANSI: ansi,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Type == "Error" {
+		return fmt.Sprintf("Error: %s", resp.Message), nil
+	}
+	if resp.Screen == nil {
+		return "Unexpected response", nil
+	}
+	scr := resp.Screen
+	header := fmt.Sprintf("Screen %dx%d, cursor at row %d col %d", scr.Cols, scr.Rows, scr.CursorRow+1, scr.CursorCol+1)
+	if scr.Alternate {
+		header += " (alternate screen)"
+	}
+	return header + "\n" + strings.Join(scr.Lines, "\n"), nil
+}
+
+func toolSendInput(target *client.Target, args map[string]interface{}) (string, error) {
+	sessionID, err := argUint32(args, "session_id")
+	if err != nil {
+		return "", err
+	}
+
+	var keys []string
+	if keysRaw, ok := args["keys"].([]interface{}); ok {
+		for _, v := range keysRaw {
+			if s, ok := v.(string); ok {
+				keys = append(keys, s)
+			}
+		}
+	}
 	input, ok := args["input"].(string)
-	if !ok {
+	if !ok && len(keys) == 0 {
 		return "", fmt.Errorf("missing input")
 	}
 
-	autoNewline := true
+	autoNewline := len(keys) == 0
 	if v, ok := args["auto_newline"].(bool); ok {
 		autoNewline = v
 	}
@@ -699,12 +964,23 @@ func toolSendInput(dataDir string, args map[string]interface{}) (string, error)
 	if autoNewline && !endsWithNewline(data) {
 		data = append(data, '\n')
 	}
+	keyData, err := client.ParseKeys(keys)
+	if err != nil {
+		return "", err
+	}
+	data = append(data, keyData...)
 
-	resp, err := nodeRequest(dataDir, &protocol.Request{
+	req := &protocol.Request{
 		Type: "SendInput",
 		ID:   &sessionID,
 		Data: data,
-	})
+	}
+	if v, ok := args["from_session_id"].(float64); ok {
+		id := uint32(v)
+		req.FromID = &id
+	}
+
+	resp, err := nodeRequest(target, req)
 	if err != nil {
 		return "", err
 	}
@@ -722,7 +998,7 @@ func toolSendInput(dataDir string, args map[string]interface{}) (string, error)
 	return "Unexpected response", nil
 }
 
-func toolWatchSession(dataDir string, args map[string]interface{}) (string, error) {
+func toolWatchSession(target *client.Target, args map[string]interface{}, progress *progressReporter) (string, error) {
 	sessionID, err := argUint32(args, "session_id")
 	if err != nil {
 		return "", err
@@ -744,16 +1020,21 @@ func toolWatchSession(dataDir string, args map[string]interface{}) (string, erro
 		maxDuration = uint64(v)
 	}
 
-	return watchSessionTimed(dataDir, sessionID, includeHistory, historyLines, maxDuration)
+	sanitize := "full"
+	if v, ok := args["sanitize"].(string); ok {
+		sanitize = v
+	}
+
+	return watchSessionTimed(target, sessionID, includeHistory, historyLines, sanitize, maxDuration, progress)
 }
 
-func toolGetSessionStatus(dataDir string, args map[string]interface{}) (string, error) {
+func toolGetSessionStatus(target *client.Target, args map[string]interface{}) (string, error) {
 	sessionID, err := argUint32(args, "session_id")
 	if err != nil {
 		return "", err
 	}
 
-	resp, err := nodeRequest(dataDir, &protocol.Request{
+	resp, err := nodeRequest(target, &protocol.Request{
 		Type: "GetStatus",
 		ID:   &sessionID,
 	})
@@ -788,7 +1069,7 @@ func toolGetSessionStatus(dataDir string, args map[string]interface{}) (string,
 	return string(out), nil
 }
 
-func toolLaunchSession(dataDir string, args map[string]interface{}) (string, error) {
+func toolLaunchSession(dataDir string, target *client.Target, args map[string]interface{}) (string, error) {
 	cmdRaw, ok := args["command"]
 	if !ok {
 		return "", fmt.Errorf("missing command")
@@ -825,8 +1106,16 @@ func toolLaunchSession(dataDir string, args map[string]interface{}) (string, err
 			}
 		}
 	}
+	if len(tags) == 0 {
+		// Like cw run, untagged launches get client.tags.
+		cfg, err := config.LoadConfig(dataDir)
+		if err != nil {
+			return "", err
+		}
+		tags = cfg.Client.Tags
+	}
 
-	resp, err := nodeRequest(dataDir, &protocol.Request{
+	resp, err := nodeRequest(target, &protocol.Request{
 		Type:       "Launch",
 		Command:    command,
 		WorkingDir: workingDir,
@@ -841,12 +1130,15 @@ func toolLaunchSession(dataDir string, args map[string]interface{}) (string, err
 		return fmt.Sprintf("Error: %s", resp.Message), nil
 	}
 	if resp.Type == "Launched" && resp.ID != nil {
+		if resp.Name != "" {
+			return fmt.Sprintf("Launched session %d (%s)", *resp.ID, resp.Name), nil
+		}
 		return fmt.Sprintf("Launched session %d", *resp.ID), nil
 	}
 	return "Unexpected response", nil
 }
 
-func toolKillSession(dataDir string, args map[string]interface{}) (string, error) {
+func toolKillSession(target *client.Target, args map[string]interface{}) (string, error) {
 	// Check if killing by tags.
 	var tags []string
 	if tagsRaw, ok := args["tags"].([]interface{}); ok {
@@ -858,7 +1150,7 @@ func toolKillSession(dataDir string, args map[string]interface{}) (string, error
 	}
 
 	if len(tags) > 0 {
-		resp, err := nodeRequest(dataDir, &protocol.Request{
+		resp, err := nodeRequest(target, &protocol.Request{
 			Type: "KillByTags",
 			Tags: tags,
 		})
@@ -880,7 +1172,7 @@ func toolKillSession(dataDir string, args map[string]interface{}) (string, error
 		return "", fmt.Errorf("either session_id or tags required")
 	}
 
-	resp, err := nodeRequest(dataDir, &protocol.Request{
+	resp, err := nodeRequest(target, &protocol.Request{
 		Type: "Kill",
 		ID:   &sessionID,
 	})
@@ -897,7 +1189,7 @@ func toolKillSession(dataDir string, args map[string]interface{}) (string, error
 	return "Unexpected response", nil
 }
 
-func toolSubscribe(dataDir string, args map[string]interface{}) (string, error) {
+func toolSubscribe(target *client.Target, args map[string]interface{}, progress *progressReporter) (string, error) {
 	maxDuration := uint64(30)
 	if v, ok := args["max_duration_seconds"].(float64); ok {
 		maxDuration = uint64(v)
@@ -927,10 +1219,12 @@ func toolSubscribe(dataDir string, args map[string]interface{}) (string, error)
 		}
 	}
 
-	return subscribeTimed(dataDir, sessionID, tags, eventTypes, maxDuration)
+	filter, _ := args["filter"].(string)
+
+	return subscribeTimed(target, sessionID, tags, eventTypes, filter, maxDuration, progress)
 }
 
-func toolWaitFor(dataDir string, args map[string]interface{}) (string, error) {
+func toolWaitFor(target *client.Target, args map[string]interface{}) (string, error) {
 	var sessionID *uint32
 	if v, ok := args["session_id"].(float64); ok {
 		id := uint32(v)
@@ -956,10 +1250,12 @@ func toolWaitFor(dataDir string, args map[string]interface{}) (string, error) {
 		timeoutSecs = uint64(v)
 	}
 
-	return waitForTimed(dataDir, sessionID, tags, condition, timeoutSecs)
+	untilOutput, _ := args["until_output"].(string)
+
+	return waitForTimed(target, sessionID, tags, condition, untilOutput, timeoutSecs)
 }
 
-func toolMsg(dataDir string, args map[string]interface{}) (string, error) {
+func toolMsg(target *client.Target, args map[string]interface{}) (string, error) {
 	body, _ := args["body"].(string)
 	if body == "" {
 		return "", fmt.Errorf("missing body")
@@ -982,7 +1278,7 @@ func toolMsg(dataDir string, args map[string]interface{}) (string, error) {
 		req.ID = &id
 	}
 
-	resp, err := nodeRequest(dataDir, req)
+	resp, err := nodeRequest(target, req)
 	if err != nil {
 		return "", err
 	}
@@ -992,7 +1288,7 @@ func toolMsg(dataDir string, args map[string]interface{}) (string, error) {
 	return fmt.Sprintf("Message sent: %s", resp.MessageID), nil
 }
 
-func toolReadMessages(dataDir string, args map[string]interface{}) (string, error) {
+func toolReadMessages(target *client.Target, args map[string]interface{}) (string, error) {
 	var sessionID *uint32
 	if v, ok := args["session_id"].(float64); ok {
 		id := uint32(v)
@@ -1010,7 +1306,7 @@ func toolReadMessages(dataDir string, args map[string]interface{}) (string, erro
 		Tail: &tail,
 	}
 
-	resp, err := nodeRequest(dataDir, req)
+	resp, err := nodeRequest(target, req)
 	if err != nil {
 		return "", err
 	}
@@ -1027,7 +1323,7 @@ func toolReadMessages(dataDir string, args map[string]interface{}) (string, erro
 	return string(out), nil
 }
 
-func toolRequest(dataDir string, args map[string]interface{}) (string, error) {
+func toolRequest(target *client.Target, args map[string]interface{}) (string, error) {
 	body, _ := args["body"].(string)
 	if body == "" {
 		return "", fmt.Errorf("missing body")
@@ -1056,15 +1352,12 @@ func toolRequest(dataDir string, args map[string]interface{}) (string, error) {
 	}
 
 	// This blocks until reply or timeout — use a long-lived connection.
-	sockPath := filepath.Join(dataDir, "codewire.sock")
-	conn, err := net.Dial("unix", sockPath)
+	reader, writer, err := connectNode(target)
 	if err != nil {
-		return "", fmt.Errorf("no node running — start one with: cw node -d\n(socket: %s)", sockPath)
+		return "", err
 	}
-	defer conn.Close()
-
-	reader := connection.NewUnixReader(conn)
-	writer := connection.NewUnixWriter(conn)
+	defer reader.Close()
+	defer writer.Close()
 
 	if err := writer.SendRequest(req); err != nil {
 		return "", err
@@ -1103,7 +1396,7 @@ func toolRequest(dataDir string, args map[string]interface{}) (string, error) {
 	}
 }
 
-func toolReply(dataDir string, args map[string]interface{}) (string, error) {
+func toolReply(target *client.Target, args map[string]interface{}) (string, error) {
 	requestID, _ := args["request_id"].(string)
 	if requestID == "" {
 		return "", fmt.Errorf("missing request_id")
@@ -1120,7 +1413,7 @@ func toolReply(dataDir string, args map[string]interface{}) (string, error) {
 		req.ID = &id
 	}
 
-	resp, err := nodeRequest(dataDir, req)
+	resp, err := nodeRequest(target, req)
 	if err != nil {
 		return "", err
 	}
@@ -1143,7 +1436,7 @@ func toolListNodes(dataDir string, _ map[string]interface{}) (string, error) {
 	return string(resp), nil
 }
 
-func toolKVSet(dataDir string, args map[string]interface{}) (string, error) {
+func toolKVSet(target *client.Target, args map[string]interface{}) (string, error) {
 	key, _ := args["key"].(string)
 	if key == "" {
 		return "", fmt.Errorf("missing key")
@@ -1155,7 +1448,7 @@ func toolKVSet(dataDir string, args map[string]interface{}) (string, error) {
 	}
 	ttl, _ := args["ttl"].(string)
 
-	resp, err := nodeRequest(dataDir, &protocol.Request{
+	resp, err := nodeRequest(target, &protocol.Request{
 		Type:      "KVSet",
 		Namespace: namespace,
 		Key:       key,
@@ -1171,7 +1464,7 @@ func toolKVSet(dataDir string, args map[string]interface{}) (string, error) {
 	return fmt.Sprintf("Set %s/%s", namespace, key), nil
 }
 
-func toolKVGet(dataDir string, args map[string]interface{}) (string, error) {
+func toolKVGet(target *client.Target, args map[string]interface{}) (string, error) {
 	key, _ := args["key"].(string)
 	if key == "" {
 		return "", fmt.Errorf("missing key")
@@ -1181,7 +1474,7 @@ func toolKVGet(dataDir string, args map[string]interface{}) (string, error) {
 		namespace = "default"
 	}
 
-	resp, err := nodeRequest(dataDir, &protocol.Request{
+	resp, err := nodeRequest(target, &protocol.Request{
 		Type:      "KVGet",
 		Namespace: namespace,
 		Key:       key,
@@ -1198,14 +1491,14 @@ func toolKVGet(dataDir string, args map[string]interface{}) (string, error) {
 	return string(resp.Value), nil
 }
 
-func toolKVList(dataDir string, args map[string]interface{}) (string, error) {
+func toolKVList(target *client.Target, args map[string]interface{}) (string, error) {
 	prefix, _ := args["prefix"].(string)
 	namespace, _ := args["namespace"].(string)
 	if namespace == "" {
 		namespace = "default"
 	}
 
-	resp, err := nodeRequest(dataDir, &protocol.Request{
+	resp, err := nodeRequest(target, &protocol.Request{
 		Type:      "KVList",
 		Namespace: namespace,
 		Key:       prefix,
@@ -1226,7 +1519,7 @@ func toolKVList(dataDir string, args map[string]interface{}) (string, error) {
 	return string(out), nil
 }
 
-func toolKVDelete(dataDir string, args map[string]interface{}) (string, error) {
+func toolKVDelete(target *client.Target, args map[string]interface{}) (string, error) {
 	key, _ := args["key"].(string)
 	if key == "" {
 		return "", fmt.Errorf("missing key")
@@ -1236,7 +1529,7 @@ func toolKVDelete(dataDir string, args map[string]interface{}) (string, error) {
 		namespace = "default"
 	}
 
-	resp, err := nodeRequest(dataDir, &protocol.Request{
+	resp, err := nodeRequest(target, &protocol.Request{
 		Type:      "KVDelete",
 		Namespace: namespace,
 		Key:       key,
@@ -1254,18 +1547,25 @@ func toolKVDelete(dataDir string, args map[string]interface{}) (string, error) {
 // Node communication
 // ---------------------------------------------------------------------------
 
-// nodeRequest connects to the Unix socket and sends a single request,
+// connectNode opens a connection to the target node. Tool calls run to
+// completion, so the connection has no deadline of its own.
+func connectNode(target *client.Target) (connection.FrameReader, connection.FrameWriter, error) {
+	reader, writer, err := target.Connect(context.Background())
+	if err != nil && target.IsLocal() {
+		return nil, nil, fmt.Errorf("no node running — start one with: cw node -d\n(socket: %s)", filepath.Join(target.Local, "codewire.sock"))
+	}
+	return reader, writer, err
+}
+
+// nodeRequest connects to the target node and sends a single request,
 // returning the response.
-func nodeRequest(dataDir string, req *protocol.Request) (*protocol.Response, error) {
-	sockPath := filepath.Join(dataDir, "codewire.sock")
-	conn, err := net.Dial("unix", sockPath)
+func nodeRequest(target *client.Target, req *protocol.Request) (*protocol.Response, error) {
+	reader, writer, err := connectNode(target)
 	if err != nil {
-		return nil, fmt.Errorf("no node running — start one with: cw node -d\n(socket: %s)", sockPath)
+		return nil, err
 	}
-	defer conn.Close()
-
-	reader := connection.NewUnixReader(conn)
-	writer := connection.NewUnixWriter(conn)
+	defer reader.Close()
+	defer writer.Close()
 
 	if err := writer.SendRequest(req); err != nil {
 		return nil, err
@@ -1290,29 +1590,29 @@ func nodeRequest(dataDir string, req *protocol.Request) (*protocol.Response, err
 }
 
 // watchSessionTimed connects and watches a session with a maximum duration,
-// collecting all output.
-func watchSessionTimed(dataDir string, sessionID uint32, includeHistory bool, historyLines *uint, maxDurationSecs uint64) (string, error) {
-	sockPath := filepath.Join(dataDir, "codewire.sock")
-	conn, err := net.Dial("unix", sockPath)
+// collecting all output. With a progress reporter, each output chunk is pushed
+// as it arrives and only a summary is returned at the end.
+func watchSessionTimed(target *client.Target, sessionID uint32, includeHistory bool, historyLines *uint, sanitize string, maxDurationSecs uint64, progress *progressReporter) (string, error) {
+	reader, writer, err := connectNode(target)
 	if err != nil {
-		return "", fmt.Errorf("no node running — start one with: cw node -d\n(socket: %s)", sockPath)
+		return "", err
 	}
-	defer conn.Close()
-
-	reader := connection.NewUnixReader(conn)
-	writer := connection.NewUnixWriter(conn)
+	defer reader.Close()
+	defer writer.Close()
 
 	req := &protocol.Request{
 		Type:           "WatchSession",
 		ID:             &sessionID,
 		IncludeHistory: &includeHistory,
 		HistoryLines:   historyLines,
+		Sanitize:       sanitize,
 	}
 	if err := writer.SendRequest(req); err != nil {
 		return "", err
 	}
 
 	var output string
+	var streamed int
 	deadline := time.After(time.Duration(maxDurationSecs) * time.Second)
 
 	type frameResult struct {
@@ -1346,19 +1646,37 @@ func watchSessionTimed(dataDir string, sessionID uint32, includeHistory bool, hi
 				}
 				switch resp.Type {
 				case "WatchUpdate":
-					if resp.Output != nil {
-						output += *resp.Output
+					if resp.Output != nil && *resp.Output != "" {
+						if progress != nil {
+							streamed += len(*resp.Output)
+							progress.report(*resp.Output)
+						} else {
+							output += *resp.Output
+						}
 					}
 					if resp.Done != nil && *resp.Done {
+						if progress != nil {
+							return fmt.Sprintf("[Session %s] streamed %d bytes", resp.Status, streamed), nil
+						}
 						output += fmt.Sprintf("\n[Session %s]\n", resp.Status)
 						return output, nil
 					}
+				case "OutputDropped":
+					note := fmt.Sprintf("\n[%d bytes of output dropped]\n", resp.Dropped)
+					if progress != nil {
+						progress.report(note)
+					} else {
+						output += note
+					}
 				case "Error":
 					return "", fmt.Errorf("watch error: %s", resp.Message)
 				}
 			}
 
 		case <-deadline:
+			if progress != nil {
+				return fmt.Sprintf("[Watch timeout] streamed %d bytes", streamed), nil
+			}
 			output += "\n[Watch timeout]\n"
 			if len(output) > 500000 {
 				output = output[:500000] + "\n... [output truncated to 500KB]"
@@ -1388,22 +1706,22 @@ func endsWithNewline(data []byte) bool {
 }
 
 // subscribeTimed subscribes to events and collects them for up to maxDurationSecs.
-func subscribeTimed(dataDir string, sessionID *uint32, tags, eventTypes []string, maxDurationSecs uint64) (string, error) {
-	sockPath := filepath.Join(dataDir, "codewire.sock")
-	conn, err := net.Dial("unix", sockPath)
+// With a progress reporter, each event is pushed as it arrives and only a
+// count is returned at the end.
+func subscribeTimed(target *client.Target, sessionID *uint32, tags, eventTypes []string, filter string, maxDurationSecs uint64, progress *progressReporter) (string, error) {
+	reader, writer, err := connectNode(target)
 	if err != nil {
-		return "", fmt.Errorf("no node running — start one with: cw node -d\n(socket: %s)", sockPath)
+		return "", err
 	}
-	defer conn.Close()
-
-	reader := connection.NewUnixReader(conn)
-	writer := connection.NewUnixWriter(conn)
+	defer reader.Close()
+	defer writer.Close()
 
 	req := &protocol.Request{
 		Type:       "Subscribe",
 		ID:         sessionID,
 		Tags:       tags,
 		EventTypes: eventTypes,
+		Filter:     filter,
 	}
 	if err := writer.SendRequest(req); err != nil {
 		return "", err
@@ -1427,17 +1745,23 @@ func subscribeTimed(dataDir string, sessionID *uint32, tags, eventTypes []string
 	}()
 
 	var events []map[string]interface{}
+	var streamed int
+	finish := func() string {
+		if progress != nil {
+			return fmt.Sprintf("streamed %d events", streamed)
+		}
+		out, _ := json.MarshalIndent(events, "", "  ")
+		return string(out)
+	}
 
 	for {
 		select {
 		case fr := <-frameCh:
 			if fr.err != nil {
-				out, _ := json.MarshalIndent(events, "", "  ")
-				return string(out), nil
+				return finish(), nil
 			}
 			if fr.frame == nil {
-				out, _ := json.MarshalIndent(events, "", "  ")
-				return string(out), nil
+				return finish(), nil
 			}
 			if fr.frame.Type != protocol.FrameControl {
 				continue
@@ -1462,29 +1786,31 @@ func subscribeTimed(dataDir string, sessionID *uint32, tags, eventTypes []string
 						event["data"] = data
 					}
 				}
+				if progress != nil {
+					data, _ := json.Marshal(event)
+					progress.report(string(data))
+					streamed++
+					continue
+				}
 				events = append(events, event)
 			case "Error":
 				return fmt.Sprintf("Error: %s", resp.Message), nil
 			}
 
 		case <-deadline:
-			out, _ := json.MarshalIndent(events, "", "  ")
-			return string(out), nil
+			return finish(), nil
 		}
 	}
 }
 
 // waitForTimed sends a Wait request and blocks for the result.
-func waitForTimed(dataDir string, sessionID *uint32, tags []string, condition string, timeoutSecs uint64) (string, error) {
-	sockPath := filepath.Join(dataDir, "codewire.sock")
-	conn, err := net.Dial("unix", sockPath)
+func waitForTimed(target *client.Target, sessionID *uint32, tags []string, condition, untilOutput string, timeoutSecs uint64) (string, error) {
+	reader, writer, err := connectNode(target)
 	if err != nil {
 		return "", err
 	}
-	defer conn.Close()
-
-	reader := connection.NewUnixReader(conn)
-	writer := connection.NewUnixWriter(conn)
+	defer reader.Close()
+	defer writer.Close()
 
 	req := &protocol.Request{
 		Type:           "Wait",
@@ -1492,6 +1818,7 @@ func waitForTimed(dataDir string, sessionID *uint32, tags []string, condition st
 		Tags:           tags,
 		Condition:      condition,
 		TimeoutSeconds: &timeoutSecs,
+		UntilOutput:    untilOutput,
 	}
 	if err := writer.SendRequest(req); err != nil {
 		return "", err
@@ -1515,11 +1842,20 @@ func waitForTimed(dataDir string, sessionID *uint32, tags []string, condition st
 		}
 		switch resp.Type {
 		case "WaitResult":
+			var prefix string
+			switch {
+			case resp.Met != nil && *resp.Met && resp.SessionID != nil && resp.Output != nil:
+				prefix = fmt.Sprintf("Output of session %d matched: %s\n", *resp.SessionID, *resp.Output)
+			case resp.Met != nil && !*resp.Met && untilOutput != "":
+				prefix = "Sessions finished without matching output.\n"
+			case resp.Met != nil && !*resp.Met:
+				prefix = fmt.Sprintf("Condition %q not met.\n", condition)
+			}
 			if resp.Sessions != nil {
 				out, _ := json.MarshalIndent(resp.Sessions, "", "  ")
-				return string(out), nil
+				return prefix + string(out), nil
 			}
-			return "[]", nil
+			return prefix + "[]", nil
 		case "Error":
 			return fmt.Sprintf("Error: %s", resp.Message), nil
 		}
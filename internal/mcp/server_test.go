@@ -0,0 +1,164 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/node"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// startNode runs a node in a fresh data directory, short enough for its
+// socket path, and returns a target for it.
+func startNode(t *testing.T) *client.Target {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "cw-mcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := node.NewNode(dir)
+	if err != nil {
+		t.Fatalf("NewNode: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		n.Cleanup()
+		os.RemoveAll(dir)
+	})
+	go n.Run(ctx)
+
+	for range 50 {
+		time.Sleep(100 * time.Millisecond)
+		if conn, err := net.Dial("unix", filepath.Join(dir, "codewire.sock")); err == nil {
+			conn.Close()
+			return &client.Target{Local: dir}
+		}
+	}
+	t.Fatal("node did not start")
+	return nil
+}
+
+// launch starts command on the node and returns the session ID.
+func launch(t *testing.T, target *client.Target, command ...string) uint32 {
+	t.Helper()
+	resp, err := nodeRequest(target, &protocol.Request{Type: "Launch", Command: command, WorkingDir: t.TempDir()})
+	if err != nil || resp.Type != "Launched" || resp.ID == nil {
+		t.Fatalf("Launch: %+v, %v", resp, err)
+	}
+	return *resp.ID
+}
+
+// recorder collects the messages handleRPC sends.
+type recorder struct {
+	mu   sync.Mutex
+	msgs []jsonRpcNotification
+}
+
+func (r *recorder) send(msg interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg.(jsonRpcNotification))
+}
+
+// callTool calls a tool through handleRPC and returns the text it produced.
+func callTool(t *testing.T, target *client.Target, send func(interface{}), params string) string {
+	t.Helper()
+	id := json.RawMessage(`1`)
+	resp := handleRPC(target.Local, target, nil, true, jsonRpcRequest{Jsonrpc: "2.0", ID: &id, Method: "tools/call", Params: json.RawMessage(params)}, send)
+	if resp.Error != nil {
+		t.Fatalf("tools/call: %s", resp.Error.Message)
+	}
+	content := resp.Result.(map[string]interface{})["content"].([]map[string]interface{})
+	return content[0]["text"].(string)
+}
+
+func TestWatchSessionProgress(t *testing.T) {
+	target := startNode(t)
+	id := launch(t, target, "sh", "-c", "echo first; sleep 0.5; echo second")
+
+	var rec recorder
+	result := callTool(t, target, rec.send, fmt.Sprintf(`{"name":"codewire_watch_session","arguments":{"session_id":%d,"max_duration_seconds":10},"_meta":{"progressToken":"tok-1"}}`, id))
+
+	var output strings.Builder
+	for i, n := range rec.msgs {
+		params := n.Params.(map[string]interface{})
+		if n.Method != "notifications/progress" || string(params["progressToken"].(json.RawMessage)) != `"tok-1"` || params["progress"] != i+1 {
+			t.Fatalf("notification %d = %+v", i, n)
+		}
+		output.WriteString(params["message"].(string))
+	}
+	if !strings.Contains(output.String(), "first") || !strings.Contains(output.String(), "second") {
+		t.Errorf("progress messages = %q, want both lines", output.String())
+	}
+	if want := fmt.Sprintf("streamed %d bytes", output.Len()); !strings.HasPrefix(result, "[Session completed") || !strings.HasSuffix(result, want) {
+		t.Errorf("result = %q, want the session's status and %q", result, want)
+	}
+
+	// Without a progress token the output is returned in the result.
+	result = callTool(t, target, rec.send, fmt.Sprintf(`{"name":"codewire_watch_session","arguments":{"session_id":%d,"max_duration_seconds":10}}`, id))
+	if !strings.Contains(result, "first") || !strings.Contains(result, "second") {
+		t.Errorf("result without progress = %q", result)
+	}
+}
+
+func TestSubscribeProgress(t *testing.T) {
+	target := startNode(t)
+	id := launch(t, target, "sleep", "0.5")
+
+	var rec recorder
+	result := callTool(t, target, rec.send, fmt.Sprintf(`{"name":"codewire_subscribe","arguments":{"session_id":%d,"event_types":["session.status"],"max_duration_seconds":2},"_meta":{"progressToken":7}}`, id))
+
+	if len(rec.msgs) == 0 {
+		t.Fatal("no progress notifications")
+	}
+	var event struct {
+		SessionID uint32 `json:"session_id"`
+		Type      string `json:"type"`
+	}
+	params := rec.msgs[0].Params.(map[string]interface{})
+	if err := json.Unmarshal([]byte(params["message"].(string)), &event); err != nil || event.SessionID != id || event.Type != "session.status" {
+		t.Errorf("first event = %s, %v", params["message"], err)
+	}
+	if want := fmt.Sprintf("streamed %d events", len(rec.msgs)); result != want {
+		t.Errorf("result = %q, want %q", result, want)
+	}
+}
+
+func TestPerCallTarget(t *testing.T) {
+	target := startNode(t)
+	hasTarget := func(perCallTarget bool) bool {
+		for _, tl := range getTools(perCallTarget) {
+			if tl.Name == "codewire_list_sessions" {
+				_, ok := tl.InputSchema.(map[string]interface{})["properties"].(map[string]interface{})["target"]
+				return ok
+			}
+		}
+		return false
+	}
+	if !hasTarget(true) || hasTarget(false) {
+		t.Errorf("target argument listed with perCallTarget %v, without %v", hasTarget(true), hasTarget(false))
+	}
+
+	id := json.RawMessage(`1`)
+	call := jsonRpcRequest{Jsonrpc: "2.0", ID: &id, Method: "tools/call", Params: json.RawMessage(`{"name":"codewire_list_sessions","arguments":{"target":"http://169.254.169.254"}}`)}
+	resp := handleRPC(target.Local, target, nil, false, call, nil)
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "not accepted") {
+		t.Errorf("tools/call with a target over HTTP = %+v, want it refused", resp)
+	}
+
+	// Over stdio the target is used: "local" is the node in the data dir.
+	call.Params = json.RawMessage(`{"name":"codewire_list_sessions","arguments":{"target":"local"}}`)
+	if resp := handleRPC(target.Local, &client.Target{Local: t.TempDir()}, nil, true, call, nil); resp.Error != nil {
+		t.Errorf("tools/call with a target over stdio: %s", resp.Error.Message)
+	}
+}
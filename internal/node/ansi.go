@@ -1,47 +0,0 @@
-package node
-
-import "strings"
-
-// stripANSI removes ANSI/VT100 escape sequences from s.
-func stripANSI(s string) string {
-	var b strings.Builder
-	b.Grow(len(s))
-	i := 0
-	for i < len(s) {
-		if s[i] != '\x1b' {
-			b.WriteByte(s[i])
-			i++
-			continue
-		}
-		if i+1 >= len(s) {
-			i++
-			continue
-		}
-		switch s[i+1] {
-		case '[': // CSI
-			i += 2
-			for i < len(s) && (s[i] < 0x40 || s[i] > 0x7E) {
-				i++
-			}
-			if i < len(s) {
-				i++
-			}
-		case ']': // OSC
-			i += 2
-			for i < len(s) {
-				if s[i] == '\x07' {
-					i++
-					break
-				}
-				if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '\\' {
-					i += 2
-					break
-				}
-				i++
-			}
-		default:
-			i += 2
-		}
-	}
-	return b.String()
-}
@@ -0,0 +1,134 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/update"
+)
+
+// ErrRestart is returned by Run after the node installed an update while
+// running under a service manager. The process should exit with
+// ExitRestart so that the service manager starts the new cw, which adopts
+// the sessions.
+var ErrRestart = errors.New("restarting into the updated cw")
+
+// ExitRestart is the exit status for ErrRestart (EX_TEMPFAIL). The units
+// written by cw node install-service restart the node when it exits with a
+// failure.
+const ExitRestart = 75
+
+// updateRetry is how long the node waits before trying a version whose
+// update failed again.
+const updateRetry = time.Hour
+
+// autoUpdater remembers the update in progress and the last failed one.
+type autoUpdater struct {
+	mu       sync.Mutex
+	busy     bool
+	failed   string // version whose update failed
+	failedAt time.Time
+}
+
+// autoUpdate installs cw version from baseURL and restarts the node into
+// it, when the relay's update channel asks for it (node.update_channel).
+// Offers for the running version, or while an update is in progress, are
+// ignored.
+func (n *Node) autoUpdate(version, baseURL string) {
+	u := &n.updater
+	u.mu.Lock()
+	if u.busy || version == n.Version || (version == u.failed && time.Since(u.failedAt) < updateRetry) {
+		u.mu.Unlock()
+		return
+	}
+	u.busy = true
+	u.mu.Unlock()
+
+	if err := n.installUpdate(version, baseURL); err != nil {
+		slog.Error("auto-update failed", "version", version, "err", err, "retry_in", updateRetry)
+		u.mu.Lock()
+		u.busy, u.failed, u.failedAt = false, version, time.Now()
+		u.mu.Unlock()
+	}
+}
+
+func (n *Node) installUpdate(version, baseURL string) error {
+	if !update.ValidVersion(n.Version) {
+		return fmt.Errorf("cannot update a %s build", n.Version)
+	}
+	if method := update.DetectInstallMethod(); method != update.DirectBinary {
+		return fmt.Errorf("cw was installed with %s; update it with: %s", method, update.UpgradeCommand(method))
+	}
+	if runtime.GOOS == "windows" && !underServiceManager() {
+		return errors.New("restarting into an update needs a service manager on Windows")
+	}
+	var keys string
+	if path := n.config.Node.UpdateKey; path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading update key: %w", err)
+		}
+		keys = string(data)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating cw executable: %w", err)
+	}
+
+	slog.Info("auto-update: installing", "from", n.Version, "to", version)
+	if err := update.InstallSigned(version, baseURL, keys); err != nil {
+		return err
+	}
+
+	if underServiceManager() {
+		slog.Info("auto-update: restarting through the service manager", "version", version)
+		n.restarting.Store(true)
+		n.stop()
+		return nil
+	}
+	return n.spawnHandoff(exe, version)
+}
+
+// spawnHandoff starts the updated cw as a node that takes over from this
+// one (see ReceiveHandoff). The handoff makes Run return; if the new node
+// exits first, the update failed.
+func (n *Node) spawnHandoff(exe, version string) error {
+	out, err := os.OpenFile(LogPath(n.dataDir), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening node log: %w", err)
+	}
+	defer out.Close()
+
+	cmd := exec.Command(exe, "node", "--handoff", "--log")
+	cmd.Dir = "/"
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = DetachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting updated node: %w", err)
+	}
+	slog.Info("auto-update: handing off to the updated node", "version", version, "pid", cmd.Process.Pid)
+
+	err = cmd.Wait()
+	if n.handedOff.Load() {
+		return nil
+	}
+	return fmt.Errorf("updated node exited before taking over: %v", err)
+}
+
+// underServiceManager reports whether the node was started by systemd or
+// launchd, which restart it themselves. Shells in macOS terminals have
+// XPC_SERVICE_NAME set to 0.
+func underServiceManager() bool {
+	if os.Getenv("INVOCATION_ID") != "" {
+		return true
+	}
+	xpc := os.Getenv("XPC_SERVICE_NAME")
+	return xpc != "" && xpc != "0"
+}
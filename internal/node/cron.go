@@ -0,0 +1,295 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/cron"
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+const (
+	// cronTickInterval is how often jobs are checked for due runs.
+	cronTickInterval = time.Second
+	// cronMissedGrace is how late a run may start before it counts as missed
+	// (e.g. after the machine slept through its schedule time).
+	cronMissedGrace = time.Minute
+)
+
+// Missed-run policies: what a job does about schedule times that passed while
+// the node was down.
+const (
+	missedSkip    = "skip"     // wait for the next schedule time
+	missedRunOnce = "run-once" // run once on startup, however many were missed
+)
+
+// cronJob is a scheduled launch, persisted to dataDir/cron.json.
+type cronJob struct {
+	Name       string           `json:"name"`
+	Schedule   string           `json:"schedule"`
+	Command    []string         `json:"command"`
+	WorkingDir string           `json:"working_dir"`
+	Env        []string         `json:"env,omitempty"`
+	Tags       []string         `json:"tags,omitempty"`
+	Budget     *protocol.Budget `json:"budget,omitempty"`
+	MissedRun  string           `json:"missed_run"`
+	CreatedAt  time.Time        `json:"created_at"`
+	// CheckedAt is the schedule time handled most recently (run or skipped);
+	// the next run is the first schedule time after it.
+	CheckedAt     time.Time  `json:"checked_at"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	LastSessionID *uint32    `json:"last_session_id,omitempty"`
+
+	schedule cron.Schedule
+}
+
+// cronScheduler launches sessions on cron schedules.
+type cronScheduler struct {
+	path    string
+	manager *session.SessionManager
+	started time.Time
+
+	mu   sync.Mutex
+	jobs []*cronJob
+}
+
+// newCronScheduler loads the jobs in dataDir/cron.json.
+func newCronScheduler(dataDir string, manager *session.SessionManager) (*cronScheduler, error) {
+	s := &cronScheduler{
+		path:    filepath.Join(dataDir, "cron.json"),
+		manager: manager,
+	}
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.jobs); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", s.path, err)
+	}
+	for _, job := range s.jobs {
+		if job.schedule, err = cron.Parse(job.Schedule); err != nil {
+			return nil, fmt.Errorf("cron job %q: %w", job.Name, err)
+		}
+	}
+	return s, nil
+}
+
+// run checks for due jobs until ctx is cancelled.
+func (s *cronScheduler) run(ctx context.Context) {
+	s.mu.Lock()
+	s.started = time.Now()
+	s.mu.Unlock()
+
+	s.tick(time.Now())
+	ticker := time.NewTicker(cronTickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.tick(now)
+		}
+	}
+}
+
+func (s *cronScheduler) tick(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for _, job := range s.jobs {
+		due := job.schedule.Next(job.CheckedAt)
+		if due.IsZero() || due.After(now) {
+			continue
+		}
+		changed = true
+
+		missed := due.Before(s.started) || now.Sub(due) > cronMissedGrace
+		job.CheckedAt = due
+		if missed || !job.schedule.Next(due).After(now) {
+			// Collapse every passed schedule time into this one.
+			job.CheckedAt = now
+		}
+		if missed && job.MissedRun != missedRunOnce {
+			slog.Info("cron: skipping missed run", "job", job.Name, "scheduled_at", due)
+			continue
+		}
+		s.launch(job, due, missed)
+	}
+	if changed {
+		s.persist()
+	}
+}
+
+// launch starts a session for job. The caller holds s.mu.
+func (s *cronScheduler) launch(job *cronJob, scheduledAt time.Time, missed bool) {
+	id, name, err := launchSession(s.manager, &protocol.Request{
+		Name:       s.manager.AvailableName(job.Name),
+		Command:    job.Command,
+		WorkingDir: job.WorkingDir,
+		Env:        job.Env,
+		Tags:       job.Tags,
+		Budget:     job.Budget,
+	})
+	if err != nil {
+		slog.Error("cron: launching job", "job", job.Name, "err", err)
+		return
+	}
+
+	_ = s.manager.RecordEvent(id, session.NewScheduledRunEvent(session.ScheduledRunData{
+		Job:         job.Name,
+		Schedule:    job.Schedule,
+		ScheduledAt: scheduledAt.UTC(),
+		Missed:      missed,
+	}))
+
+	now := time.Now()
+	job.LastRunAt = &now
+	job.LastSessionID = &id
+	slog.Info("cron: launched job", "job", job.Name, "id", id, "name", name, "missed", missed)
+}
+
+// persist writes the jobs to cron.json. The caller holds s.mu.
+func (s *cronScheduler) persist() {
+	data, err := json.MarshalIndent(s.jobs, "", "  ")
+	if err != nil {
+		slog.Error("cron: encoding jobs", "err", err)
+		return
+	}
+	// Jobs may carry secrets in their environment.
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		slog.Error("cron: writing jobs", "err", err)
+		return
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		slog.Error("cron: writing jobs", "err", err)
+	}
+}
+
+func (s *cronScheduler) add(req protocol.Request) error {
+	if !session.ValidName(req.Name) {
+		return fmt.Errorf("invalid job name %q: must be 1-32 alphanumeric characters or hyphens, starting with alphanumeric", req.Name)
+	}
+	if len(req.Command) == 0 {
+		return fmt.Errorf("command must not be empty")
+	}
+	schedule, err := cron.Parse(req.Schedule)
+	if err != nil {
+		return err
+	}
+	missedRun := req.MissedRun
+	switch missedRun {
+	case "":
+		missedRun = missedSkip
+	case missedSkip, missedRunOnce:
+	default:
+		return fmt.Errorf("invalid missed-run policy %q (use %s or %s)", missedRun, missedSkip, missedRunOnce)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.Name == req.Name {
+			return fmt.Errorf("cron job %q already exists", req.Name)
+		}
+	}
+
+	now := time.Now()
+	s.jobs = append(s.jobs, &cronJob{
+		Name:       req.Name,
+		Schedule:   req.Schedule,
+		Command:    req.Command,
+		WorkingDir: req.WorkingDir,
+		Env:        req.Env,
+		Tags:       req.Tags,
+		Budget:     req.Budget,
+		MissedRun:  missedRun,
+		CreatedAt:  now,
+		CheckedAt:  now,
+		schedule:   schedule,
+	})
+	s.persist()
+	return nil
+}
+
+func (s *cronScheduler) remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, job := range s.jobs {
+		if job.Name == name {
+			s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+			s.persist()
+			return nil
+		}
+	}
+	return fmt.Errorf("cron job %q not found", name)
+}
+
+func (s *cronScheduler) list() []protocol.CronJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]protocol.CronJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		info := protocol.CronJob{
+			Name:          job.Name,
+			Schedule:      job.Schedule,
+			Command:       job.Command,
+			WorkingDir:    job.WorkingDir,
+			Env:           job.Env,
+			Tags:          job.Tags,
+			Budget:        job.Budget,
+			MissedRun:     job.MissedRun,
+			CreatedAt:     job.CreatedAt.UTC().Format(time.RFC3339),
+			LastSessionID: job.LastSessionID,
+		}
+		if job.LastRunAt != nil {
+			last := job.LastRunAt.UTC().Format(time.RFC3339)
+			info.LastRunAt = &last
+		}
+		if next := job.schedule.Next(job.CheckedAt); !next.IsZero() {
+			info.NextRunAt = next.UTC().Format(time.RFC3339)
+		}
+		jobs = append(jobs, info)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// handleCron serves CronAdd, CronRemove and CronList requests.
+func handleCron(writer connection.FrameWriter, scheduler *cronScheduler, req protocol.Request) {
+	var (
+		resp *protocol.Response
+		err  error
+	)
+	switch req.Type {
+	case "CronAdd":
+		err = scheduler.add(req)
+		resp = &protocol.Response{Type: "CronAdded", Name: req.Name}
+	case "CronRemove":
+		err = scheduler.remove(req.Name)
+		resp = &protocol.Response{Type: "CronRemoved", Name: req.Name}
+	default:
+		jobs := scheduler.list()
+		resp = &protocol.Response{Type: "CronJobs", CronJobs: &jobs}
+	}
+	if err != nil {
+		resp = &protocol.Response{Type: "Error", Message: err.Error()}
+	}
+	_ = writer.SendResponse(resp)
+}
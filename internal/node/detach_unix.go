@@ -0,0 +1,11 @@
+//go:build !windows
+
+package node
+
+import "syscall"
+
+// DetachedProcAttr starts a process in a session of its own, so that it
+// outlives the terminal and the process that started it.
+func DetachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,14 @@
+package node
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// DetachedProcAttr starts a process without a console and in a process
+// group of its own, so that it outlives the console and the process that
+// started it.
+func DetachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: windows.DETACHED_PROCESS | windows.CREATE_NEW_PROCESS_GROUP}
+}
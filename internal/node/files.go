@@ -0,0 +1,226 @@
+package node
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+// fileChunkSize is the most file content sent in one FileChunk frame. It
+// stays within the default WebSocket read limit of the node's listener.
+const fileChunkSize = 32 << 10
+
+// openSessionRoot opens session id's working directory. Transfers go
+// through the returned root, so paths cannot escape it, by .. or symlinks.
+func openSessionRoot(manager *session.SessionManager, id uint32) (*os.Root, string, error) {
+	info, _, err := manager.GetStatus(id)
+	if err != nil {
+		return nil, "", err
+	}
+	root, err := os.OpenRoot(info.WorkingDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("opening working directory: %w", err)
+	}
+	return root, info.WorkingDir, nil
+}
+
+// handleFileRead sends the file at req.Path in the session's working
+// directory: a FileInfo response, the content in FileChunk frames, then a
+// FileDone response with its checksum.
+func handleFileRead(writer connection.FrameWriter, manager *session.SessionManager, id uint32, req *protocol.Request) {
+	sendErr := func(msg string) {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: msg})
+	}
+
+	root, workDir, err := openSessionRoot(manager, id)
+	if err != nil {
+		sendErr(err.Error())
+		return
+	}
+	defer root.Close()
+
+	f, err := root.Open(req.Path)
+	if err != nil {
+		sendErr(fileError(req.Path, err))
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		sendErr(fileError(req.Path, err))
+		return
+	}
+	if !fi.Mode().IsRegular() {
+		sendErr(fmt.Sprintf("%s is not a regular file", req.Path))
+		return
+	}
+
+	if err := writer.SendResponse(&protocol.Response{
+		Type:     "FileInfo",
+		Path:     filepath.Join(workDir, req.Path),
+		FileSize: fi.Size(),
+		FileMode: uint32(fi.Mode().Perm()),
+	}); err != nil {
+		return
+	}
+
+	h := sha256.New()
+	buf := make([]byte, fileChunkSize)
+	var sent int64
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			if werr := writer.WriteFrame(&protocol.Frame{Type: protocol.FrameFileChunk, Payload: buf[:n]}); werr != nil {
+				return
+			}
+			sent += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			sendErr(fmt.Sprintf("reading %s: %v", req.Path, err))
+			return
+		}
+	}
+
+	_ = writer.SendResponse(&protocol.Response{
+		Type:     "FileDone",
+		FileSize: sent,
+		Checksum: hex.EncodeToString(h.Sum(nil)),
+	})
+}
+
+// handleFileWrite receives req.FileSize bytes of FileChunk frames into
+// req.Path in the session's working directory. The content goes to a
+// temporary file that replaces the target only once its checksum matches
+// req.Checksum.
+func handleFileWrite(reader connection.FrameReader, writer connection.FrameWriter, manager *session.SessionManager, id uint32, req *protocol.Request) {
+	sendErr := func(msg string) {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: msg})
+	}
+
+	if req.FileSize < 0 || req.Checksum == "" {
+		sendErr("missing file size or checksum")
+		return
+	}
+	root, workDir, err := openSessionRoot(manager, id)
+	if err != nil {
+		sendErr(err.Error())
+		return
+	}
+	defer root.Close()
+
+	// Like cp, an empty path or a directory receives the file under its
+	// own name.
+	name := req.Path
+	if fi, err := root.Stat(name); name == "" || (err == nil && fi.IsDir()) {
+		base := path.Base(filepath.ToSlash(req.FileName))
+		if base == "." || base == "/" || base == ".." {
+			sendErr("missing file name")
+			return
+		}
+		name = filepath.Join(name, base)
+	}
+
+	var suffix [6]byte
+	rand.Read(suffix[:])
+	tmp := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".cw-"+hex.EncodeToString(suffix[:]))
+	f, err := root.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		sendErr(fileError(name, err))
+		return
+	}
+	committed := false
+	defer func() {
+		f.Close()
+		if !committed {
+			root.Remove(tmp)
+		}
+	}()
+
+	if err := writer.SendResponse(&protocol.Response{Type: "FileReady", Path: filepath.Join(workDir, name)}); err != nil {
+		return
+	}
+
+	connection.ExpectFileChunks(reader)
+	h := sha256.New()
+	var received int64
+	for received < req.FileSize {
+		frame, err := reader.ReadFrame()
+		if err != nil || frame == nil {
+			return // client gone
+		}
+		if frame.Type != protocol.FrameFileChunk {
+			sendErr("expected file chunk")
+			return
+		}
+		if received+int64(len(frame.Payload)) > req.FileSize {
+			sendErr("received more data than the announced file size")
+			return
+		}
+		if _, err := f.Write(frame.Payload); err != nil {
+			sendErr(fmt.Sprintf("writing %s: %v", name, err))
+			return
+		}
+		h.Write(frame.Payload)
+		received += int64(len(frame.Payload))
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	if sum != req.Checksum {
+		sendErr(fmt.Sprintf("checksum mismatch (sent %s, received %s); %s left unchanged", req.Checksum, sum, name))
+		return
+	}
+	mode := os.FileMode(req.FileMode).Perm()
+	if mode == 0 {
+		mode = 0o644
+	}
+	if err := f.Close(); err != nil {
+		sendErr(fmt.Sprintf("writing %s: %v", name, err))
+		return
+	}
+	if err := root.Chmod(tmp, mode); err != nil {
+		sendErr(fmt.Sprintf("writing %s: %v", name, err))
+		return
+	}
+	if err := root.Rename(tmp, name); err != nil {
+		sendErr(fileError(name, err))
+		return
+	}
+	committed = true
+
+	_ = writer.SendResponse(&protocol.Response{
+		Type:     "FileDone",
+		Path:     filepath.Join(workDir, name),
+		FileSize: received,
+		Checksum: sum,
+	})
+}
+
+// fileError describes err for name, a path relative to a session's working
+// directory, without the root's internals.
+func fileError(name string, err error) string {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Sprintf("%s: no such file in the session's working directory", name)
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Sprintf("%s: permission denied", name)
+	}
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return fmt.Sprintf("%s: %v", name, pathErr.Err)
+	}
+	return fmt.Sprintf("%s: %v", name, err)
+}
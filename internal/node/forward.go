@@ -0,0 +1,85 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// forwardDialTimeout bounds how long a StreamOpen waits for its target.
+const forwardDialTimeout = 10 * time.Second
+
+// handleForward serves a port forward: after ForwardReady, each StreamOpen
+// dials a TCP target from the node and the stream's data flows in Stream
+// frames until either side closes it. It returns when the client
+// disconnects, closing every stream.
+func handleForward(reader connection.FrameReader, writer connection.FrameWriter) {
+	if err := writer.SendResponse(&protocol.Response{Type: "ForwardReady"}); err != nil {
+		return
+	}
+	connection.ExpectStreams(reader)
+
+	streams := connection.NewStreams(writer, func(id uint32) error {
+		return writer.SendResponse(&protocol.Response{Type: "StreamClose", Stream: id})
+	})
+	defer streams.CloseAll()
+
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil || frame == nil {
+			return // client gone
+		}
+
+		switch frame.Type {
+		case protocol.FrameStream:
+			id, data, err := protocol.ParseStream(frame.Payload)
+			if err != nil {
+				slog.Warn("forward: bad stream frame", "err", err)
+				return
+			}
+			streams.Data(id, data)
+
+		case protocol.FrameControl:
+			var req protocol.Request
+			if err := json.Unmarshal(frame.Payload, &req); err != nil {
+				slog.Warn("forward: bad control frame", "err", err)
+				return
+			}
+			switch req.Type {
+			case "StreamOpen":
+				go openForwardStream(streams, writer, req.Stream, req.Host, req.Port)
+			case "StreamClose":
+				streams.Closed(req.Stream, false)
+			}
+		}
+	}
+}
+
+// openForwardStream dials host:port for stream id and starts relaying it,
+// or reports the failure in a StreamClose.
+func openForwardStream(streams *connection.Streams, writer connection.FrameWriter, id uint32, host string, port int) {
+	if host == "" {
+		host = "localhost"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, forwardDialTimeout)
+	if err != nil {
+		_ = writer.SendResponse(&protocol.Response{
+			Type:    "StreamClose",
+			Stream:  id,
+			Message: fmt.Sprintf("connecting to %s: %v", addr, err),
+		})
+		return
+	}
+	slog.Debug("forward: stream opened", "stream", id, "addr", addr)
+
+	streams.Add(id, conn)
+	streams.Start(id)
+	_ = writer.SendResponse(&protocol.Response{Type: "StreamOpened", Stream: id})
+}
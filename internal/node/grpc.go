@@ -0,0 +1,425 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/codewiresh/codewire/internal/auth"
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/nodepb"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// runGRPCServer serves the gRPC API (nodepb.NodeServer) on addr until ctx is
+// cancelled, with the WebSocket listener's TLS when configured.
+func (n *Node) runGRPCServer(ctx context.Context, addr string) error {
+	tlsConfig, err := wsTLSConfig(n.dataDir, n.config.Node)
+	if err != nil {
+		return err
+	}
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	srv := grpc.NewServer(opts...)
+	nodepb.RegisterNodeServer(srv, &grpcServer{node: n})
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("grpc server: %w", err)
+	}
+	slog.Info("grpc server listening", "addr", addr, "tls", tlsConfig != nil)
+
+	go func() {
+		<-ctx.Done()
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			srv.Stop()
+		}
+	}()
+
+	if err := srv.Serve(ln); err != nil {
+		return fmt.Errorf("grpc server: %w", err)
+	}
+	return nil
+}
+
+// grpcServer implements the gRPC API by turning each call into the
+// equivalent frame protocol request and running it through handleClient
+// over an in-process connection, so calls behave exactly like the same
+// requests on the WebSocket listener.
+type grpcServer struct {
+	nodepb.UnimplementedNodeServer
+	node *Node
+}
+
+// grpcCall is the client end of a request handleClient is serving.
+type grpcCall struct {
+	reader connection.FrameReader
+	writer connection.FrameWriter
+	stop   func() bool
+}
+
+// call authenticates ctx's token and starts serving req, which ends when
+// ctx does. The caller must close the returned call.
+func (s *grpcServer) call(ctx context.Context, req *protocol.Request) (*grpcCall, error) {
+	token := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			token = strings.TrimPrefix(v[0], "Bearer ")
+		}
+	}
+	scope, ok := auth.Authenticate(s.node.dataDir, token)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	if need := requestScope(req.Type); !scope.Allows(need) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s needs a token with %s scope, this one has %s scope", req.Type, need, scope)
+	}
+
+	client, server := net.Pipe()
+	go handleClient(connection.NewUnixReader(server), connection.NewUnixWriter(server), s.node.Manager, s.node.kv, s.node.cron, nil, scope)
+	c := &grpcCall{
+		reader: connection.NewUnixReader(client),
+		writer: connection.NewUnixWriter(client),
+		stop:   context.AfterFunc(ctx, func() { client.Close() }),
+	}
+	if err := c.writer.SendRequest(req); err != nil {
+		c.close()
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return c, nil
+}
+
+// next returns the next frame of the call's answer, with its Response if it
+// is a control frame. An Error response becomes a gRPC error.
+func (c *grpcCall) next() (*protocol.Frame, *protocol.Response, error) {
+	f, err := c.reader.ReadFrame()
+	if err != nil {
+		return nil, nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if f == nil {
+		return nil, nil, status.Error(codes.Unavailable, "node closed the request")
+	}
+	if f.Type != protocol.FrameControl {
+		return f, nil, nil
+	}
+	var resp protocol.Response
+	if err := json.Unmarshal(f.Payload, &resp); err != nil {
+		return nil, nil, status.Error(codes.Internal, err.Error())
+	}
+	if resp.Type == "Error" {
+		return nil, nil, status.Error(codes.Unknown, resp.Message)
+	}
+	return f, &resp, nil
+}
+
+// response returns the call's next Response, skipping data frames.
+func (c *grpcCall) response() (*protocol.Response, error) {
+	for {
+		_, resp, err := c.next()
+		if err != nil || resp != nil {
+			return resp, err
+		}
+	}
+}
+
+func (c *grpcCall) close() {
+	c.stop()
+	c.reader.Close()
+}
+
+// roundTrip runs a request with a single response.
+func (s *grpcServer) roundTrip(ctx context.Context, req *protocol.Request) (*protocol.Response, error) {
+	c, err := s.call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	return c.response()
+}
+
+func (s *grpcServer) Launch(ctx context.Context, in *nodepb.LaunchRequest) (*nodepb.LaunchResponse, error) {
+	resp, err := s.roundTrip(ctx, &protocol.Request{
+		Type:       "Launch",
+		Command:    in.Command,
+		WorkingDir: in.WorkingDir,
+		Name:       in.Name,
+		Env:        in.Env,
+		Tags:       in.Tags,
+		Labels:     in.Labels,
+		StdinData:  in.Stdin,
+		NoQueue:    in.NoQueue,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := &nodepb.LaunchResponse{Name: resp.Name, Status: resp.Status}
+	if resp.ID != nil {
+		out.Id = *resp.ID
+	}
+	return out, nil
+}
+
+func (s *grpcServer) List(ctx context.Context, _ *nodepb.ListRequest) (*nodepb.ListResponse, error) {
+	resp, err := s.roundTrip(ctx, &protocol.Request{Type: "ListSessions"})
+	if err != nil {
+		return nil, err
+	}
+	out := &nodepb.ListResponse{}
+	if resp.Sessions != nil {
+		for _, info := range *resp.Sessions {
+			out.Sessions = append(out.Sessions, sessionPB(info))
+		}
+	}
+	return out, nil
+}
+
+// sessionPB converts a SessionInfo to its gRPC form.
+func sessionPB(info protocol.SessionInfo) *nodepb.Session {
+	s := &nodepb.Session{
+		Id:            info.ID,
+		Name:          info.Name,
+		Command:       info.Prompt,
+		WorkingDir:    info.WorkingDir,
+		CreatedAt:     info.CreatedAt,
+		Status:        info.Status,
+		Activity:      info.Activity,
+		AttachedCount: uint32(max(info.AttachedCount, 0)),
+		Pid:           info.PID,
+		Tags:          info.Tags,
+		Labels:        info.Labels,
+	}
+	if info.ExitCode != nil {
+		code := int32(*info.ExitCode)
+		s.ExitCode = &code
+	}
+	if info.CompletedAt != nil {
+		s.CompletedAt = *info.CompletedAt
+	}
+	if info.OutputBytes != nil {
+		s.OutputBytes = *info.OutputBytes
+	}
+	if info.OutputLines != nil {
+		s.OutputLines = *info.OutputLines
+	}
+	if info.LastOutputAt != nil {
+		s.LastOutputAt = *info.LastOutputAt
+	}
+	return s
+}
+
+func (s *grpcServer) Attach(stream grpc.BidiStreamingServer[nodepb.AttachRequest, nodepb.AttachResponse]) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	start := first.GetStart()
+	if start == nil {
+		return status.Error(codes.InvalidArgument, "the first attach request must be start")
+	}
+	id := start.Id
+	includeHistory := !start.NoHistory
+	req := &protocol.Request{Type: "Attach", ID: &id, IncludeHistory: &includeHistory, LowLatency: start.LowLatency}
+	if start.HistoryLines != nil {
+		lines := uint(*start.HistoryLines)
+		req.HistoryLines = &lines
+	}
+	c, err := s.call(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	if _, err := c.response(); err != nil {
+		return err
+	}
+	if err := stream.Send(&nodepb.AttachResponse{Msg: &nodepb.AttachResponse_Attached{Attached: id}}); err != nil {
+		return err
+	}
+
+	// Client requests go on to the node as they come; closing the stream
+	// detaches.
+	go func() {
+		for {
+			in, err := stream.Recv()
+			if err != nil {
+				_ = c.writer.SendRequest(&protocol.Request{Type: "Detach"})
+				return
+			}
+			switch msg := in.Msg.(type) {
+			case *nodepb.AttachRequest_Input:
+				err = c.writer.SendData(msg.Input)
+			case *nodepb.AttachRequest_Resize:
+				cols, rows := uint16(msg.Resize.Cols), uint16(msg.Resize.Rows)
+				err = c.writer.SendRequest(&protocol.Request{Type: "Resize", ID: &id, Cols: &cols, Rows: &rows})
+			case *nodepb.AttachRequest_Detach:
+				err = c.writer.SendRequest(&protocol.Request{Type: "Detach"})
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		f, err := c.reader.ReadFrame()
+		if err != nil || f == nil {
+			return err
+		}
+		out := &nodepb.AttachResponse{}
+		if f.Type == protocol.FrameData {
+			out.Msg = &nodepb.AttachResponse_Output{Output: f.Payload}
+		} else {
+			var resp protocol.Response
+			if err := json.Unmarshal(f.Payload, &resp); err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			switch resp.Type {
+			case "OutputDropped":
+				out.Msg = &nodepb.AttachResponse_Dropped{Dropped: resp.Dropped}
+			case "Detached":
+				out.Msg = &nodepb.AttachResponse_Detached{Detached: true}
+			case "Error":
+				out.Msg = &nodepb.AttachResponse_Ended{Ended: resp.Message}
+			default:
+				continue
+			}
+		}
+		if err := stream.Send(out); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *grpcServer) Logs(in *nodepb.LogsRequest, stream grpc.ServerStreamingServer[nodepb.LogsResponse]) error {
+	id := in.Id
+	strip := !in.KeepAnsi
+	req := &protocol.Request{Type: "Logs", ID: &id, Follow: &in.Follow, StripANSI: &strip}
+	if in.Tail != nil {
+		tail := uint(*in.Tail)
+		req.Tail = &tail
+	}
+	c, err := s.call(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	for {
+		resp, err := c.response()
+		if err != nil {
+			if stream.Context().Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := stream.Send(&nodepb.LogsResponse{Data: resp.Data}); err != nil {
+			return err
+		}
+		if resp.Done != nil && *resp.Done {
+			return nil
+		}
+	}
+}
+
+func (s *grpcServer) Subscribe(in *nodepb.SubscribeRequest, stream grpc.ServerStreamingServer[nodepb.Event]) error {
+	c, err := s.call(stream.Context(), &protocol.Request{
+		Type:       "Subscribe",
+		ID:         in.Id,
+		Tags:       in.Tags,
+		Selector:   in.Selector,
+		EventTypes: in.EventTypes,
+		Filter:     in.Filter,
+		Since:      in.Since,
+		FromSeq:    in.FromSeq,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	for {
+		resp, err := c.response()
+		if err != nil {
+			if stream.Context().Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if resp.Type != "Event" || resp.Event == nil {
+			continue
+		}
+		ev := &nodepb.Event{
+			SessionName: resp.Name,
+			Node:        resp.Node,
+			Timestamp:   resp.Event.Timestamp,
+			Type:        resp.Event.EventType,
+			Data:        resp.Event.Data,
+			Seq:         resp.Event.Seq,
+		}
+		if resp.SessionID != nil {
+			ev.SessionId = *resp.SessionID
+		}
+		if err := stream.Send(ev); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *grpcServer) KVGet(ctx context.Context, in *nodepb.KVGetRequest) (*nodepb.KVGetResponse, error) {
+	resp, err := s.roundTrip(ctx, &protocol.Request{Type: "KVGet", Namespace: in.Namespace, Key: in.Key})
+	if err != nil {
+		return nil, err
+	}
+	return &nodepb.KVGetResponse{Value: resp.Value}, nil
+}
+
+func (s *grpcServer) KVSet(ctx context.Context, in *nodepb.KVSetRequest) (*nodepb.KVSetResponse, error) {
+	if _, err := s.roundTrip(ctx, &protocol.Request{Type: "KVSet", Namespace: in.Namespace, Key: in.Key, Value: in.Value, TTL: in.Ttl}); err != nil {
+		return nil, err
+	}
+	return &nodepb.KVSetResponse{}, nil
+}
+
+func (s *grpcServer) KVDelete(ctx context.Context, in *nodepb.KVDeleteRequest) (*nodepb.KVDeleteResponse, error) {
+	if _, err := s.roundTrip(ctx, &protocol.Request{Type: "KVDelete", Namespace: in.Namespace, Key: in.Key}); err != nil {
+		return nil, err
+	}
+	return &nodepb.KVDeleteResponse{}, nil
+}
+
+func (s *grpcServer) KVList(ctx context.Context, in *nodepb.KVListRequest) (*nodepb.KVListResponse, error) {
+	resp, err := s.roundTrip(ctx, &protocol.Request{Type: "KVList", Namespace: in.Namespace, Key: in.Prefix})
+	if err != nil {
+		return nil, err
+	}
+	out := &nodepb.KVListResponse{}
+	if resp.Entries != nil {
+		for _, e := range *resp.Entries {
+			entry := &nodepb.KVEntry{Key: e.Key, Value: e.Value}
+			if e.ExpiresAt != nil {
+				entry.ExpiresAt = *e.ExpiresAt
+			}
+			out.Entries = append(out.Entries, entry)
+		}
+	}
+	return out, nil
+}
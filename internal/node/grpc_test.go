@@ -0,0 +1,86 @@
+package node
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/codewiresh/codewire/internal/auth"
+	"github.com/codewiresh/codewire/internal/nodepb"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+func TestGRPCServer(t *testing.T) {
+	dataDir := t.TempDir()
+	mgr, err := session.NewSessionManager(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := auth.LoadOrGenerateToken(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := auth.CreateToken(dataDir, "reader", auth.ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	nodepb.RegisterNodeServer(srv, &grpcServer{node: &Node{Manager: mgr, kv: localKV{session.NewKVStore()}, dataDir: dataDir}})
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := nodepb.NewNodeClient(conn)
+	as := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	if _, err := client.List(context.Background(), &nodepb.ListRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("List without a token: %v, want Unauthenticated", err)
+	}
+	if _, err := client.List(as(reader), &nodepb.ListRequest{}); err != nil {
+		t.Errorf("List with a read token: %v", err)
+	}
+	if _, err := client.KVSet(as(reader), &nodepb.KVSetRequest{Key: "k", Value: []byte("v")}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("KVSet with a read token: %v, want PermissionDenied", err)
+	}
+
+	if _, err := client.KVSet(as(admin), &nodepb.KVSetRequest{Namespace: "ns", Key: "build/1", Value: []byte("ok")}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.KVGet(as(admin), &nodepb.KVGetRequest{Namespace: "ns", Key: "build/1"})
+	if err != nil || string(got.Value) != "ok" {
+		t.Fatalf("KVGet = %v, %v", got, err)
+	}
+	list, err := client.KVList(as(admin), &nodepb.KVListRequest{Namespace: "ns", Prefix: "build/"})
+	if err != nil || len(list.Entries) != 1 || list.Entries[0].Key != "build/1" {
+		t.Fatalf("KVList = %v, %v", list, err)
+	}
+
+	// Node errors come back as the call's error.
+	stream, err := client.Attach(as(admin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&nodepb.AttachRequest{Msg: &nodepb.AttachRequest_Start{Start: &nodepb.AttachStart{Id: 42}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unknown {
+		t.Errorf("attaching to a missing session: %v, want Unknown", err)
+	}
+}
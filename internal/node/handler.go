@@ -1,13 +1,19 @@
 package node
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/codewiresh/codewire/internal/auth"
 	"github.com/codewiresh/codewire/internal/connection"
 	"github.com/codewiresh/codewire/internal/protocol"
 	"github.com/codewiresh/codewire/internal/session"
@@ -15,8 +21,10 @@ import (
 
 // handleClient reads the first control frame from a client, dispatches the
 // request by type, and returns. Each Unix/WebSocket connection is handled
-// by exactly one goroutine calling this function.
-func handleClient(reader connection.FrameReader, writer connection.FrameWriter, manager *session.SessionManager, kvStore *session.KVStore) {
+// by exactly one goroutine calling this function. Handoff requests are only
+// served when local is set, for connections on the node's Unix socket.
+// Requests beyond the client's token scope are refused.
+func handleClient(reader connection.FrameReader, writer connection.FrameWriter, manager *session.SessionManager, kv kvBackend, scheduler *cronScheduler, local *Node, scope auth.Scope) {
 	defer reader.Close()
 	defer writer.Close()
 
@@ -39,6 +47,14 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 		return
 	}
 
+	if need := requestScope(req.Type); !scope.Allows(need) {
+		_ = writer.SendResponse(&protocol.Response{
+			Type:    "Error",
+			Message: fmt.Sprintf("%s needs a token with %s scope, this one has %s scope", req.Type, need, scope),
+		})
+		return
+	}
+
 	switch req.Type {
 	case "ListSessions":
 		sessions := manager.List()
@@ -48,27 +64,120 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 		})
 
 	case "Launch":
-		id, launchErr := manager.Launch(req.Command, req.WorkingDir, req.Env, req.StdinData, req.Name, req.Tags...)
+		id, name, launchErr := launchSession(manager, &req)
 		if launchErr != nil {
-			msg := launchErr.Error()
 			_ = writer.SendResponse(&protocol.Response{
 				Type:    "Error",
-				Message: msg,
+				Message: launchErr.Error(),
 			})
 			return
 		}
-		if req.Name != "" {
-			if nameErr := manager.SetName(id, req.Name); nameErr != nil {
-				_ = writer.SendResponse(&protocol.Response{
-					Type:    "Error",
-					Message: nameErr.Error(),
-				})
-				return
+		status := "running"
+		if manager.QueuePosition(id) > 0 {
+			status = "queued"
+		}
+		resp := &protocol.Response{
+			Type:   "Launched",
+			ID:     &id,
+			Name:   name,
+			Status: status,
+		}
+		if req.Worktree != "" {
+			if info, _, err := manager.GetStatus(id); err == nil {
+				resp.Path = info.WorkingDir
 			}
 		}
+		_ = writer.SendResponse(resp)
+
+	case "Fork":
+		if req.ID == nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: "missing session id",
+			})
+			return
+		}
+		id, forkErr := manager.Fork(*req.ID, req.Name, req.ReplayInput)
+		if forkErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: forkErr.Error(),
+			})
+			return
+		}
+		resp := &protocol.Response{Type: "Launched", ID: &id, Name: manager.GetName(id), Status: "running"}
+		if manager.QueuePosition(id) > 0 {
+			resp.Status = "queued"
+		}
+		if info, _, err := manager.GetStatus(id); err == nil {
+			resp.Info = &info
+		}
+		_ = writer.SendResponse(resp)
+
+	case "Resume":
+		if req.ID == nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: "missing session id",
+			})
+			return
+		}
+		id, resumeErr := manager.Resume(*req.ID, req.Name, req.Command)
+		if resumeErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: resumeErr.Error(),
+			})
+			return
+		}
+		resp := &protocol.Response{Type: "Launched", ID: &id, Name: manager.GetName(id), Status: "running"}
+		if manager.QueuePosition(id) > 0 {
+			resp.Status = "queued"
+		}
+		if info, _, err := manager.GetStatus(id); err == nil {
+			resp.Info = &info
+		}
+		_ = writer.SendResponse(resp)
+
+	case "Rename":
+		if req.ID == nil || req.Name == "" {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: "missing session id or name",
+			})
+			return
+		}
+		if nameErr := manager.SetName(*req.ID, req.Name); nameErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: nameErr.Error(),
+			})
+			return
+		}
 		_ = writer.SendResponse(&protocol.Response{
-			Type: "Launched",
-			ID:   &id,
+			Type: "Renamed",
+			ID:   req.ID,
+			Name: req.Name,
+		})
+
+	case "SetTags":
+		if req.ID == nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: "missing session id",
+			})
+			return
+		}
+		if tagsErr := manager.SetTags(*req.ID, req.Tags); tagsErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: tagsErr.Error(),
+			})
+			return
+		}
+		_ = writer.SendResponse(&protocol.Response{
+			Type: "TagsSet",
+			ID:   req.ID,
 		})
 
 	case "Attach":
@@ -94,25 +203,45 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 		// Unsubscribe the output broadcast when we are done.
 		defer manager.UnsubscribeOutput(sessionID, channels.OutputID)
 
-		// Send Attached confirmation.
-		_ = writer.SendResponse(&protocol.Response{
-			Type: "Attached",
-			ID:   &sessionID,
-		})
-
-		// Replay history if requested.
+		// History, if requested, or the log from the offset a resuming
+		// client asks for.
+		var history []byte
+		_, start, _ := manager.OutputFrom(sessionID, math.MaxInt64)
 		includeHistory := req.IncludeHistory == nil || *req.IncludeHistory
-		if includeHistory {
-			logPath, logErr := manager.LogPath(sessionID)
-			if logErr == nil {
-				if histErr := replayHistory(writer, logPath, req.HistoryLines); histErr != nil {
-					slog.Warn("failed to replay history", "id", sessionID, "err", histErr)
-				}
+		switch {
+		case req.Offset != nil:
+			data, size, histErr := manager.OutputFrom(sessionID, *req.Offset)
+			if histErr != nil {
+				slog.Warn("failed to read output to resume from", "id", sessionID, "err", histErr)
+				break
+			}
+			history, start = data, size-int64(len(data))
+		case includeHistory:
+			data, size, histErr := recentOutput(manager, sessionID, req.HistoryLines)
+			if histErr != nil {
+				slog.Warn("failed to replay history", "id", sessionID, "err", histErr)
+				break
 			}
+			history, start = data, size-int64(len(data))
+		}
+
+		// Send Attached confirmation, with the compression picked from the
+		// client's offer and the log offset data frames start at, and switch
+		// data frames over to the compression.
+		compression := connection.NegotiateCompression(req.Compression)
+		_ = writer.SendResponse(&protocol.Response{
+			Type:        "Attached",
+			ID:          &sessionID,
+			Compression: compression,
+			Offset:      &start,
+		})
+		reader, writer, _ = connection.Compress(reader, writer, compression)
+		if len(history) > 0 {
+			_ = writer.SendData(history)
 		}
 
 		// Bridge PTY and client until detach or disconnect.
-		if bridgeErr := handleAttachSession(reader, writer, channels, sessionID, manager); bridgeErr != nil {
+		if bridgeErr := handleAttachSession(reader, writer, channels, sessionID, manager, req.LowLatency); bridgeErr != nil {
 			slog.Debug("attach session ended", "id", sessionID, "err", bridgeErr)
 		}
 
@@ -124,7 +253,15 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 			})
 			return
 		}
-		if killErr := manager.Kill(*req.ID); killErr != nil {
+		opts, optsErr := killOptions(&req)
+		if optsErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: optsErr.Error(),
+			})
+			return
+		}
+		if killErr := manager.KillWith(*req.ID, opts); killErr != nil {
 			_ = writer.SendResponse(&protocol.Response{
 				Type:    "Error",
 				Message: killErr.Error(),
@@ -136,8 +273,52 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 			ID:   req.ID,
 		})
 
+	case "Handoff":
+		if local == nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: "handoff is only available over the local socket",
+			})
+			return
+		}
+		if err := local.handoff(); err != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: fmt.Sprintf("handoff failed: %v", err),
+			})
+			return
+		}
+		_ = writer.SendResponse(&protocol.Response{Type: "HandedOff"})
+		local.exit()
+
+	case "ExportState":
+		if local == nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: "state export is only available over the local socket",
+			})
+			return
+		}
+		manager.PersistMeta()
+		if _, err := ExportState(local.dataDir, req.Path, local.KVStore); err != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: err.Error(),
+			})
+			return
+		}
+		_ = writer.SendResponse(&protocol.Response{Type: "StateExported", Path: req.Path})
+
 	case "KillAll":
-		count := manager.KillAll()
+		opts, optsErr := killOptions(&req)
+		if optsErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: optsErr.Error(),
+			})
+			return
+		}
+		count := manager.KillAll(opts)
 		c := uint(count)
 		_ = writer.SendResponse(&protocol.Response{
 			Type:  "KilledAll",
@@ -145,7 +326,23 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 		})
 
 	case "KillByTags":
-		count := manager.KillByTags(req.Tags)
+		opts, optsErr := killOptions(&req)
+		if optsErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: optsErr.Error(),
+			})
+			return
+		}
+		selector, selErr := protocol.ParseSelector(req.Selector)
+		if selErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: selErr.Error(),
+			})
+			return
+		}
+		count := manager.KillByTags(req.Tags, selector, opts)
 		c := uint(count)
 		_ = writer.SendResponse(&protocol.Response{
 			Type:  "KilledAll",
@@ -179,8 +376,19 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 			return
 		}
 		follow := req.Follow != nil && *req.Follow
-		strip := req.StripANSI == nil || *req.StripANSI // default: strip
-		if logsErr := handleLogs(writer, logPath, follow, req.Tail, strip); logsErr != nil {
+		level := session.SanitizeFull
+		if req.StripANSI != nil && !*req.StripANSI {
+			level = session.SanitizeNone
+		}
+		level, levelErr := session.ParseSanitize(req.Sanitize, level)
+		if levelErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: levelErr.Error(),
+			})
+			return
+		}
+		if logsErr := handleLogs(writer, manager, *req.ID, logPath, follow, req.Tail, level); logsErr != nil {
 			slog.Debug("logs handler ended", "id", *req.ID, "err", logsErr)
 		}
 
@@ -192,7 +400,11 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 			})
 			return
 		}
-		n, inputErr := manager.SendInput(*req.ID, req.Data)
+		var fromID uint32
+		if req.FromID != nil {
+			fromID = *req.FromID
+		}
+		n, inputErr := manager.SendInputFrom(fromID, *req.ID, req.Data)
 		if inputErr != nil {
 			_ = writer.SendResponse(&protocol.Response{
 				Type:    "Error",
@@ -206,6 +418,24 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 			Bytes: &bytes,
 		})
 
+	case "Screen":
+		if req.ID == nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: "missing session id",
+			})
+			return
+		}
+		scr, screenErr := manager.Screen(*req.ID, req.ANSI)
+		if screenErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: screenErr.Error(),
+			})
+			return
+		}
+		_ = writer.SendResponse(&protocol.Response{Type: "Screen", ID: req.ID, Screen: &scr})
+
 	case "GetStatus":
 		if req.ID == nil {
 			_ = writer.SendResponse(&protocol.Response{
@@ -228,6 +458,33 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 			OutputSize: &outputSize,
 		})
 
+	case "GetRecording":
+		if req.ID == nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: "missing session id",
+			})
+			return
+		}
+		handleGetRecording(writer, manager, *req.ID)
+
+	case "FileRead", "FileWrite":
+		if req.ID == nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: "missing session id",
+			})
+			return
+		}
+		if req.Type == "FileRead" {
+			handleFileRead(writer, manager, *req.ID, &req)
+		} else {
+			handleFileWrite(reader, writer, manager, *req.ID, &req)
+		}
+
+	case "Forward":
+		handleForward(reader, writer)
+
 	case "WatchSession":
 		if req.ID == nil {
 			_ = writer.SendResponse(&protocol.Response{
@@ -237,7 +494,31 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 			return
 		}
 		includeHistory := req.IncludeHistory == nil || *req.IncludeHistory
-		if watchErr := handleWatchSession(reader, writer, manager, *req.ID, includeHistory, req.HistoryLines); watchErr != nil {
+		var since time.Time
+		if req.Since != "" {
+			t, err := time.Parse(time.RFC3339Nano, req.Since)
+			if err != nil {
+				_ = writer.SendResponse(&protocol.Response{
+					Type:    "Error",
+					Message: fmt.Sprintf("invalid since time: %s", req.Since),
+				})
+				return
+			}
+			since = t
+		}
+		level, levelErr := session.ParseSanitize(req.Sanitize, session.SanitizeNone)
+		if levelErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: levelErr.Error(),
+			})
+			return
+		}
+		watchWriter := writer
+		if level != session.SanitizeNone {
+			watchWriter = &sanitizingWriter{FrameWriter: writer, stream: session.NewSanitizeStream(level)}
+		}
+		if watchErr := handleWatchSession(reader, watchWriter, manager, *req.ID, includeHistory, req.HistoryLines, since, req.Timestamps, req.Offset); watchErr != nil {
 			slog.Debug("watch session ended", "id", *req.ID, "err", watchErr)
 		}
 
@@ -246,13 +527,64 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 		for _, et := range req.EventTypes {
 			eventTypes = append(eventTypes, session.EventType(et))
 		}
-		sub := manager.Subscriptions.Subscribe(req.ID, req.Tags, eventTypes)
+		selector, selErr := protocol.ParseSelector(req.Selector)
+		if selErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: selErr.Error(),
+			})
+			return
+		}
+		var since time.Time
+		if req.Since != "" {
+			t, err := time.Parse(time.RFC3339Nano, req.Since)
+			if err != nil {
+				_ = writer.SendResponse(&protocol.Response{
+					Type:    "Error",
+					Message: fmt.Sprintf("invalid since time: %s", req.Since),
+				})
+				return
+			}
+			since = t
+		}
+		filter, err := protocol.ParseFilter(req.Filter)
+		if err != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: err.Error(),
+			})
+			return
+		}
+		sub := manager.Subscriptions.SubscribeFiltered(req.ID, req.Tags, selector, eventTypes, filter)
 		subID := sub.ID
 		_ = writer.SendResponse(&protocol.Response{
 			Type:           "SubscribeAck",
 			SubscriptionID: &subID,
 		})
 
+		// Replay what was journaled before the subscription; live events
+		// queue on sub.Ch meanwhile.
+		if req.FromSeq != nil || !since.IsZero() {
+			var fromSeq uint64
+			if req.FromSeq != nil {
+				fromSeq = *req.FromSeq
+			}
+			var sendErr error
+			err := manager.Subscriptions.Replay(sub, fromSeq, since, func(se session.SessionEvent) bool {
+				resp := eventResponse(manager, se)
+				resp.SubscriptionID = &subID
+				sendErr = writer.SendResponse(resp)
+				return sendErr == nil
+			})
+			if err != nil || sendErr != nil {
+				manager.Subscriptions.Unsubscribe(sub.ID)
+				if err != nil {
+					_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: fmt.Sprintf("replaying events: %v", err)})
+				}
+				return
+			}
+		}
+
 		// Stream events until client disconnects.
 		disconnectCh := make(chan struct{}, 1)
 		go func() {
@@ -279,17 +611,9 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 				if !ok {
 					return
 				}
-				sessionID := se.SessionID
-				_ = writer.SendResponse(&protocol.Response{
-					Type:           "Event",
-					SubscriptionID: &subID,
-					SessionID:      &sessionID,
-					Event: &protocol.SessionEvent{
-						Timestamp: se.Event.Timestamp.Format(time.RFC3339Nano),
-						EventType: string(se.Event.Type),
-						Data:      se.Event.Data,
-					},
-				})
+				resp := eventResponse(manager, se)
+				resp.SubscriptionID = &subID
+				_ = writer.SendResponse(resp)
 			case <-disconnectCh:
 				manager.Subscriptions.Unsubscribe(sub.ID)
 				_ = writer.SendResponse(&protocol.Response{
@@ -302,6 +626,9 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 	case "Wait":
 		handleWait(reader, writer, manager, req)
 
+	case "RunScript":
+		handleRunScript(reader, writer, manager, req)
+
 	case "MsgSend":
 		handleMsgSend(writer, manager, req)
 
@@ -317,17 +644,114 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 	case "MsgListen":
 		handleMsgListen(reader, writer, manager, req)
 
+	case "HookEvent":
+		handleHookEvent(writer, manager, req)
+
 	case "KVSet":
-		handleKVSet(writer, kvStore, req)
+		handleKVSet(writer, kv, req)
 
 	case "KVGet":
-		handleKVGet(writer, kvStore, req)
+		handleKVGet(writer, kv, req)
 
 	case "KVDelete":
-		handleKVDelete(writer, kvStore, req)
+		handleKVDelete(writer, kv, req)
 
 	case "KVList":
-		handleKVList(writer, kvStore, req)
+		handleKVList(writer, kv, req)
+
+	case "CronAdd", "CronRemove", "CronList":
+		handleCron(writer, scheduler, req)
+
+	case "WorktreeList", "WorktreeMerge", "WorktreeRemove":
+		handleWorktree(writer, manager, req)
+
+	case "PipeAdd", "PipeRemove", "PipeList":
+		handlePipe(writer, manager, req)
+
+	case "HistoryList", "HistoryRerun":
+		handleHistory(writer, manager, req)
+
+	case "SessionStats":
+		handleStats(writer, manager, req)
+
+	case "Timeline":
+		if req.ID == nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: "missing session id",
+			})
+			return
+		}
+		entries, timelineErr := manager.Timeline(*req.ID)
+		if timelineErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: timelineErr.Error(),
+			})
+			return
+		}
+		_ = writer.SendResponse(&protocol.Response{Type: "Timeline", ID: req.ID, Timeline: &entries})
+
+	case "ArchiveSessions":
+		var archived []protocol.ArchivedSession
+		var archiveErr error
+		switch {
+		case req.ID != nil:
+			var a protocol.ArchivedSession
+			if a, archiveErr = manager.Archive(context.Background(), *req.ID); archiveErr == nil {
+				archived = []protocol.ArchivedSession{a}
+			}
+		case req.Before != "":
+			cutoff, parseErr := time.Parse(time.RFC3339Nano, req.Before)
+			if parseErr != nil {
+				_ = writer.SendResponse(&protocol.Response{
+					Type:    "Error",
+					Message: fmt.Sprintf("invalid before time %q: %v", req.Before, parseErr),
+				})
+				return
+			}
+			archived, archiveErr = manager.ArchiveBefore(context.Background(), cutoff)
+		default:
+			archiveErr = fmt.Errorf("missing session id or before time")
+		}
+		if archiveErr != nil {
+			msg := archiveErr.Error()
+			if len(archived) > 0 {
+				msg = fmt.Sprintf("%s (after archiving %d sessions)", msg, len(archived))
+			}
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: msg,
+			})
+			return
+		}
+		_ = writer.SendResponse(&protocol.Response{Type: "Archived", Archives: &archived})
+
+	case "ArchiveList":
+		archives, listErr := manager.Archives()
+		if listErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: listErr.Error(),
+			})
+			return
+		}
+		_ = writer.SendResponse(&protocol.Response{Type: "ArchiveList", Archives: &archives})
+
+	case "RestoreArchive":
+		restored, restoreErr := manager.RestoreArchive(context.Background(), req.Archive)
+		if restoreErr != nil {
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "Error",
+				Message: restoreErr.Error(),
+			})
+			return
+		}
+		_ = writer.SendResponse(&protocol.Response{
+			Type:     "Restored",
+			ID:       &restored.ID,
+			Archives: &[]protocol.ArchivedSession{restored},
+		})
 
 	default:
 		_ = writer.SendResponse(&protocol.Response{
@@ -337,20 +761,182 @@ func handleClient(reader connection.FrameReader, writer connection.FrameWriter,
 	}
 }
 
+// requestScopes is the token scope each request type needs. Types not
+// listed, such as bulk kills, archiving, cron changes and port forwards, need
+// auth.ScopeAdmin.
+var requestScopes = map[string]auth.Scope{
+	"ListSessions": auth.ScopeRead,
+	"Logs":         auth.ScopeRead,
+	"GetStatus":    auth.ScopeRead,
+	"GetRecording": auth.ScopeRead,
+	"WatchSession": auth.ScopeRead,
+	"Subscribe":    auth.ScopeRead,
+	"Wait":         auth.ScopeRead,
+	"MsgRead":      auth.ScopeRead,
+	"MsgListen":    auth.ScopeRead,
+	"KVGet":        auth.ScopeRead,
+	"KVList":       auth.ScopeRead,
+	"CronList":     auth.ScopeRead,
+	"WorktreeList": auth.ScopeRead,
+	"PipeList":     auth.ScopeRead,
+	"SessionStats": auth.ScopeRead,
+	"Screen":       auth.ScopeRead,
+	"Timeline":     auth.ScopeRead,
+	"ArchiveList":  auth.ScopeRead,
+
+	"Launch":     auth.ScopeLaunch,
+	"Fork":       auth.ScopeLaunch,
+	"Resume":     auth.ScopeLaunch,
+	"Rename":     auth.ScopeLaunch,
+	"SetTags":    auth.ScopeLaunch,
+	"Attach":     auth.ScopeLaunch,
+	"Resize":     auth.ScopeLaunch,
+	"Detach":     auth.ScopeLaunch,
+	"SendInput":  auth.ScopeLaunch,
+	"RunScript":  auth.ScopeLaunch,
+	"Kill":       auth.ScopeLaunch,
+	"MsgSend":    auth.ScopeLaunch,
+	"MsgRequest": auth.ScopeLaunch,
+	"MsgReply":   auth.ScopeLaunch,
+	"HookEvent":  auth.ScopeLaunch,
+	"KVSet":      auth.ScopeLaunch,
+	"KVDelete":   auth.ScopeLaunch,
+	"PipeAdd":    auth.ScopeLaunch,
+	"PipeRemove": auth.ScopeLaunch,
+
+	// Merging and removing worktrees changes the repositories that sessions
+	// launched with --worktree came from.
+	"WorktreeMerge":  auth.ScopeLaunch,
+	"WorktreeRemove": auth.ScopeLaunch,
+
+	// The launch history holds the env sessions were launched with.
+	"HistoryList":  auth.ScopeLaunch,
+	"HistoryRerun": auth.ScopeLaunch,
+
+	// File transfers reach beyond the session's output, so reading needs
+	// launch scope as well.
+	"FileRead":  auth.ScopeLaunch,
+	"FileWrite": auth.ScopeLaunch,
+}
+
+func requestScope(typ string) auth.Scope {
+	if scope, ok := requestScopes[typ]; ok {
+		return scope
+	}
+	return auth.ScopeAdmin
+}
+
+// launchSession launches the session described by req: a Launch request or a
+// cron job's run. Unnamed sessions get a generated adjective-noun name.
+func launchSession(manager *session.SessionManager, req *protocol.Request) (uint32, string, error) {
+	id, err := manager.LaunchWith(session.LaunchOptions{
+		Command:        req.Command,
+		WorkingDir:     req.WorkingDir,
+		Env:            req.Env,
+		Secrets:        req.Secrets,
+		StdinData:      req.StdinData,
+		Name:           req.Name,
+		GenerateName:   true,
+		Tags:           req.Tags,
+		Labels:         req.Labels,
+		NoQueue:        req.NoQueue,
+		Pool:           req.Pool,
+		PoolSize:       req.PoolSize,
+		Worktree:       req.Worktree,
+		Backend:        req.Backend,
+		BackendOptions: req.BackendOptions,
+		AutoRespond:    req.AutoRespond,
+		Alerts:         req.Alerts,
+		AlertNotify:    req.AlertNotify,
+		Redact:         req.Redact,
+
+		AcceptInputFrom: req.AcceptInputFrom,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	budget := req.Budget
+	if budget == nil {
+		budget = manager.DefaultBudget
+	}
+	if budget != nil {
+		_ = manager.SetBudget(id, *budget)
+	}
+	return id, manager.GetName(id), nil
+}
+
+// killOptions reads the signal, grace period and process group options of a
+// kill request.
+func killOptions(req *protocol.Request) (session.KillOptions, error) {
+	opts := session.KillOptions{Children: req.Children}
+	if req.Signal != "" {
+		sig, err := session.ParseSignal(req.Signal)
+		if err != nil {
+			return opts, err
+		}
+		opts.Signal = sig
+	}
+	if req.Grace != "" {
+		grace, err := time.ParseDuration(req.Grace)
+		if err != nil || grace < 0 {
+			return opts, fmt.Errorf("invalid grace period %q", req.Grace)
+		}
+		opts.Grace = grace
+	}
+	return opts, nil
+}
+
 // frameOrError bundles a frame read result for channel-based communication.
 type frameOrError struct {
 	frame *protocol.Frame
 	err   error
 }
 
+// outputBatcher lets a session's output gather for a delay before it is
+// framed, so chatty programs produce fewer, larger frames. With no delay,
+// output is framed as soon as it arrives.
+type outputBatcher struct {
+	out   *session.OutputListener
+	delay time.Duration
+	due   <-chan time.Time // set while output waits out the delay
+}
+
+// ready is called when out signals Ready. It reports whether to drain now,
+// or else starts the wait after which due fires.
+func (b *outputBatcher) ready() bool {
+	if b.delay <= 0 {
+		return true
+	}
+	if b.due == nil {
+		b.due = time.After(b.delay)
+	}
+	return false
+}
+
+// drain passes the queued output to send, chunk by chunk.
+func (b *outputBatcher) drain(send func(session.Output) error) error {
+	b.due = nil
+	for {
+		out, ok := b.out.Next()
+		if !ok {
+			return nil
+		}
+		if err := send(out); err != nil {
+			return err
+		}
+	}
+}
+
 // handleAttachSession bridges PTY output and client input until the session
-// ends, the client disconnects, or the client sends a Detach command.
+// ends, the client disconnects, or the client sends a Detach command. Output
+// is batched for manager.OutputDelay unless lowLatency is set.
 func handleAttachSession(
 	reader connection.FrameReader,
 	writer connection.FrameWriter,
 	channels *session.AttachChannels,
 	sessionID uint32,
 	manager *session.SessionManager,
+	lowLatency bool,
 ) error {
 	// Spawn a goroutine to read frames from the client, since ReadFrame blocks.
 	frameCh := make(chan frameOrError, 1)
@@ -364,12 +950,37 @@ func handleAttachSession(
 		}
 	}()
 
+	// PTY output to client, with a marker where any was lost.
+	sendOutput := func(out session.Output) error {
+		if out.Dropped > 0 {
+			if err := writer.SendResponse(&protocol.Response{Type: "OutputDropped", Dropped: out.Dropped}); err != nil {
+				return fmt.Errorf("sending output data: %w", err)
+			}
+		}
+		if len(out.Data) > 0 {
+			if err := writer.SendData(out.Data); err != nil {
+				return fmt.Errorf("sending output data: %w", err)
+			}
+		}
+		return nil
+	}
+	batch := &outputBatcher{out: channels.Output, delay: manager.OutputDelay}
+	if lowLatency {
+		batch.delay = 0
+	}
+
 	for {
 		select {
-		case data := <-channels.OutputCh:
-			// PTY output to client.
-			if err := writer.SendData(data); err != nil {
-				return fmt.Errorf("sending output data: %w", err)
+		case <-channels.Output.Ready():
+			if batch.ready() {
+				if err := batch.drain(sendOutput); err != nil {
+					return err
+				}
+			}
+
+		case <-batch.due:
+			if err := batch.drain(sendOutput); err != nil {
+				return err
 			}
 
 		case fe := <-frameCh:
@@ -420,6 +1031,8 @@ func handleAttachSession(
 		case <-channels.Status.Changed():
 			status := channels.Status.Get()
 			if status.State != "running" {
+				// Output still waiting out the delay goes first.
+				_ = batch.drain(sendOutput)
 				msg := fmt.Sprintf("session %s", status.String())
 				_ = writer.SendResponse(&protocol.Response{
 					Type:    "Error",
@@ -431,38 +1044,42 @@ func handleAttachSession(
 	}
 }
 
-// replayHistory reads the session log file and sends its contents as a data
-// frame. If historyLines is non-nil, only the last N lines are sent.
-func replayHistory(writer connection.FrameWriter, logPath string, historyLines *uint) error {
+// recentOutput returns the session's log from its last lines lines on (all
+// of it if lines is nil), and the log's size. The session's in-memory
+// history serves it when it reaches back that far; otherwise the log file is
+// read.
+func recentOutput(manager *session.SessionManager, id uint32, lines *uint) ([]byte, int64, error) {
+	if data, size, ok := manager.OutputTail(id, lines); ok {
+		return data, size, nil
+	}
+	logPath, err := manager.LogPath(id)
+	if err != nil {
+		return nil, 0, err
+	}
 	content, err := os.ReadFile(logPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil // no history yet
+			return nil, 0, nil // no history yet
 		}
-		return fmt.Errorf("reading log file: %w", err)
+		return nil, 0, fmt.Errorf("reading log file: %w", err)
 	}
+	size := int64(len(content))
 
-	if len(content) == 0 {
-		return nil
-	}
-
-	if historyLines != nil {
-		lines := strings.Split(string(content), "\n")
-		n := int(*historyLines)
-		if n < len(lines) {
-			lines = lines[len(lines)-n:]
+	if lines != nil && len(content) > 0 {
+		split := strings.Split(string(content), "\n")
+		n := int(*lines)
+		if n < len(split) {
+			split = split[len(split)-n:]
 		}
-		content = []byte(strings.Join(lines, "\n"))
+		content = []byte(strings.Join(split, "\n"))
 	}
-
-	if len(content) > 0 {
-		return writer.SendData(content)
-	}
-	return nil
+	return content, size, nil
 }
 
 // handleWatchSession subscribes to a session's output and status, streaming
 // updates to the client until the session ends or the client disconnects.
+// With offset set, the client is resuming: it gets the log from there on
+// instead of history.
 func handleWatchSession(
 	reader connection.FrameReader,
 	writer connection.FrameWriter,
@@ -470,52 +1087,140 @@ func handleWatchSession(
 	id uint32,
 	includeHistory bool,
 	historyLines *uint,
+	since time.Time,
+	timestamps bool,
+	offset *int64,
 ) error {
-	subID, outputCh, err := manager.SubscribeOutput(id)
+	subID, output, err := manager.SubscribeOutput(id)
+	if err != nil {
+		return writer.SendResponse(&protocol.Response{
+			Type:    "Error",
+			Message: err.Error(),
+		})
+	}
+	defer manager.UnsubscribeOutput(id, subID)
+	// Live output from here on may also make it into the history sent
+	// below; what does is skipped.
+	_, subscribedAt, _ := manager.OutputFrom(id, math.MaxInt64)
+
+	// Live output is redacted like the log the history comes from. end is
+	// the log offset the output sent so far ends at.
+	var end, skip int64
+	sendFailed := make(chan error, 1)
+	live, err := manager.RedactOutput(id, func(data []byte) {
+		if skip > 0 {
+			n := min(skip, int64(len(data)))
+			data, skip = data[n:], skip-n
+			if len(data) == 0 {
+				return
+			}
+		}
+		end += int64(len(data))
+		out, at := string(data), end
+		f := false
+		if sendErr := writer.SendResponse(&protocol.Response{
+			Type:      "WatchUpdate",
+			Status:    "running",
+			Output:    &out,
+			Done:      &f,
+			Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+			Offset:    &at,
+		}); sendErr != nil {
+			select {
+			case sendFailed <- sendErr:
+			default:
+			}
+		}
+	})
 	if err != nil {
 		return writer.SendResponse(&protocol.Response{
 			Type:    "Error",
 			Message: err.Error(),
 		})
 	}
-	defer manager.UnsubscribeOutput(id, subID)
+	defer live.Close()
+
+	statusWatcher, err := manager.SubscribeStatus(id)
+	if err != nil {
+		return writer.SendResponse(&protocol.Response{
+			Type:    "Error",
+			Message: err.Error(),
+		})
+	}
+
+	// Send history if requested. With since or timestamps, history is sent
+	// chunk by chunk from the timing file instead of as one blob.
+	end = subscribedAt
+	switch {
+	case offset != nil:
+		data, size, histErr := manager.OutputFrom(id, *offset)
+		if histErr == nil {
+			end = size
+			if len(data) > 0 {
+				output := string(data)
+				f := false
+				_ = writer.SendResponse(&protocol.Response{
+					Type:   "WatchUpdate",
+					Status: "running",
+					Output: &output,
+					Done:   &f,
+					Offset: &size,
+				})
+			}
+		}
+	case includeHistory && (!since.IsZero() || timestamps):
+		if size, ok := sendTimedHistory(writer, manager, id, since); ok {
+			end = size
+			break
+		}
+		fallthrough
+	case includeHistory:
+		data, size, histErr := recentOutput(manager, id, historyLines)
+		if histErr == nil {
+			end = size
+			if len(data) > 0 {
+				output := string(data)
+				f := false
+				_ = writer.SendResponse(&protocol.Response{
+					Type:   "WatchUpdate",
+					Status: "running",
+					Output: &output,
+					Done:   &f,
+					Offset: &size,
+				})
+			}
+		}
+	}
+	skip = max(end-subscribedAt, 0)
 
-	statusWatcher, err := manager.SubscribeStatus(id)
-	if err != nil {
+	// A session that has already ended, as it may have while a client
+	// reconnected, gets no status change to wait for.
+	if s := statusWatcher.Get(); s.State == "completed" || s.State == "killed" {
+		done := true
 		return writer.SendResponse(&protocol.Response{
-			Type:    "Error",
-			Message: err.Error(),
+			Type:   "WatchUpdate",
+			Status: s.String(),
+			Done:   &done,
 		})
 	}
 
-	// Send history if requested.
-	if includeHistory {
-		logPath, logErr := manager.LogPath(id)
-		if logErr == nil {
-			content, readErr := os.ReadFile(logPath)
-			if readErr == nil && len(content) > 0 {
-				data := content
-				if historyLines != nil {
-					lines := strings.Split(string(data), "\n")
-					n := int(*historyLines)
-					if n < len(lines) {
-						lines = lines[len(lines)-n:]
-					}
-					data = []byte(strings.Join(lines, "\n"))
-				}
-				if len(data) > 0 {
-					output := string(data)
-					f := false
-					_ = writer.SendResponse(&protocol.Response{
-						Type:   "WatchUpdate",
-						Status: "running",
-						Output: &output,
-						Done:   &f,
-					})
-				}
-			}
+	writeLive := func(out session.Output) error {
+		if out.Dropped > 0 {
+			// Ahead of the marker goes what came before the gap, which
+			// the offsets after it skip.
+			live.Flush()
+			end += int64(out.Dropped)
+			_ = writer.SendResponse(&protocol.Response{
+				Type:    "OutputDropped",
+				Dropped: out.Dropped,
+			})
+		}
+		if len(out.Data) > 0 {
+			live.Write(out.Data)
 		}
+		return nil
 	}
+	batch := &outputBatcher{out: output, delay: manager.OutputDelay}
 
 	// Spawn a goroutine to detect client disconnect.
 	disconnectCh := make(chan struct{}, 1)
@@ -535,21 +1240,24 @@ func handleWatchSession(
 
 	for {
 		select {
-		case data := <-outputCh:
-			output := string(data)
-			f := false
-			if sendErr := writer.SendResponse(&protocol.Response{
-				Type:   "WatchUpdate",
-				Status: "running",
-				Output: &output,
-				Done:   &f,
-			}); sendErr != nil {
-				return sendErr
+		case <-output.Ready():
+			if batch.ready() {
+				_ = batch.drain(writeLive)
 			}
 
+		case <-batch.due:
+			_ = batch.drain(writeLive)
+
+		case sendErr := <-sendFailed:
+			return sendErr
+
 		case <-statusWatcher.Changed():
 			s := statusWatcher.Get()
-			done := s.State != "running"
+			done := s.State == "completed" || s.State == "killed"
+			if done {
+				_ = batch.drain(writeLive)
+				live.Close()
+			}
 			_ = writer.SendResponse(&protocol.Response{
 				Type:   "WatchUpdate",
 				Status: s.String(),
@@ -566,7 +1274,164 @@ func handleWatchSession(
 	}
 }
 
-// handleWait blocks until the target session(s) complete or timeout.
+// recordingTimingBatch is the most timing entries sent in one
+// RecordingTiming response, keeping each well under protocol.MaxPayload.
+const recordingTimingBatch = 16 << 10
+
+// handleGetRecording sends a session's raw output log together with the
+// timing of each chunk, for export and replay: a Recording response with the
+// session's info and the log's size, the log in FileChunk frames, the timing
+// in RecordingTiming responses, then RecordingDone. Sessions without timing
+// data get no RecordingTiming responses.
+func handleGetRecording(writer connection.FrameWriter, manager *session.SessionManager, id uint32) {
+	sendErr := func(msg string) {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: msg})
+	}
+
+	info, _, err := manager.GetStatus(id)
+	if err != nil {
+		sendErr(err.Error())
+		return
+	}
+	// The recording holds all of the output, and a snippet of it could make
+	// the response too large.
+	info.LastOutputSnippet = nil
+	logPath, _ := manager.LogPath(id)
+	var size int64
+	f, err := os.Open(logPath)
+	if err != nil && !os.IsNotExist(err) {
+		sendErr("failed to read session log")
+		return
+	}
+	if f != nil {
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			sendErr("failed to read session log")
+			return
+		}
+		// Output written from now on is left out, as is its timing.
+		size = fi.Size()
+	}
+
+	if err := writer.SendResponse(&protocol.Response{
+		Type:     "Recording",
+		Info:     &info,
+		FileSize: size,
+	}); err != nil {
+		return
+	}
+
+	var sent int64
+	if f != nil {
+		buf := make([]byte, fileChunkSize)
+		r := io.LimitReader(f, size)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				if werr := writer.WriteFrame(&protocol.Frame{Type: protocol.FrameFileChunk, Payload: buf[:n]}); werr != nil {
+					return
+				}
+				sent += int64(n)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				sendErr("failed to read session log")
+				return
+			}
+		}
+	}
+
+	// Without complete timing, the client attributes all of the output to
+	// the session's start.
+	timingPath, _ := manager.TimingPath(id)
+	if chunks, err := session.ReadOutputTiming(timingPath); err == nil {
+		var timed int64
+		batch := []protocol.TimingEntry{}
+		for _, c := range chunks {
+			if timed += c.Length; timed > sent {
+				break
+			}
+			batch = append(batch, protocol.TimingEntry{
+				Time:   c.At.Format(time.RFC3339Nano),
+				Length: c.Length,
+			})
+			if len(batch) == recordingTimingBatch {
+				if err := writer.SendResponse(&protocol.Response{Type: "RecordingTiming", Timing: &batch}); err != nil {
+					return
+				}
+				batch = []protocol.TimingEntry{}
+			}
+		}
+		if len(batch) > 0 {
+			if err := writer.SendResponse(&protocol.Response{Type: "RecordingTiming", Timing: &batch}); err != nil {
+				return
+			}
+		}
+	}
+
+	_ = writer.SendResponse(&protocol.Response{Type: "RecordingDone", FileSize: sent})
+}
+
+// sendTimedHistory sends a session's output history written at or after
+// since, one WatchUpdate per recorded chunk with its write time, and returns
+// the log's size. It returns false when the session has no timing data (e.g.
+// it predates timing recording), so the caller can fall back to sending the
+// plain log.
+func sendTimedHistory(writer connection.FrameWriter, manager *session.SessionManager, id uint32, since time.Time) (int64, bool) {
+	logPath, err := manager.LogPath(id)
+	if err != nil {
+		return 0, false
+	}
+	timingPath, err := manager.TimingPath(id)
+	if err != nil {
+		return 0, false
+	}
+	chunks, err := session.ReadOutputTiming(timingPath)
+	if err != nil || len(chunks) == 0 {
+		return 0, false
+	}
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		return 0, false
+	}
+
+	// Output written before timing was recorded sits ahead of the first chunk.
+	last := chunks[len(chunks)-1]
+	base := int64(len(content)) - (last.Offset + last.Length)
+	if base < 0 {
+		base = 0
+	}
+
+	f := false
+	for _, c := range chunks {
+		if c.At.Before(since) {
+			continue
+		}
+		start := base + c.Offset
+		end := start + c.Length
+		if end > int64(len(content)) {
+			break
+		}
+		output := string(content[start:end])
+		if err := writer.SendResponse(&protocol.Response{
+			Type:      "WatchUpdate",
+			Status:    "running",
+			Output:    &output,
+			Done:      &f,
+			Timestamp: c.At.Format(time.RFC3339Nano),
+			Offset:    &end,
+		}); err != nil {
+			break
+		}
+	}
+	return int64(len(content)), true
+}
+
+// handleWait blocks until the target session(s) meet the wait's condition,
+// or can no longer meet it, or the wait times out.
 func handleWait(
 	reader connection.FrameReader,
 	writer connection.FrameWriter,
@@ -587,89 +1452,232 @@ func handleWait(
 	if condition == "" {
 		condition = "all"
 	}
+	switch condition {
+	case "all", "any", "success", "any-failure":
+	default:
+		_ = writer.SendResponse(&protocol.Response{
+			Type:    "Error",
+			Message: fmt.Sprintf("unknown wait condition %q (valid: all, any, success, any-failure)", condition),
+		})
+		return
+	}
+
+	selector, err := protocol.ParseSelector(req.Selector)
+	if err != nil {
+		_ = writer.SendResponse(&protocol.Response{
+			Type:    "Error",
+			Message: err.Error(),
+		})
+		return
+	}
 
-	// Subscribe to status events.
-	var eventTypes []session.EventType
-	eventTypes = append(eventTypes, session.EventSessionStatus)
+	if req.UntilOutput != "" {
+		waitForOutput(writer, manager, req, timer.C)
+		return
+	}
 
-	sub := manager.Subscriptions.Subscribe(req.ID, req.Tags, eventTypes)
+	// Subscribe to status events before checking, so no completion is missed.
+	sub := manager.Subscriptions.Subscribe(req.ID, req.Tags, selector, []session.EventType{session.EventSessionStatus})
 	defer manager.Subscriptions.Unsubscribe(sub.ID)
 
-	// Check if already completed.
-	if req.ID != nil {
-		info, _, err := manager.GetStatus(*req.ID)
-		if err == nil && (strings.Contains(info.Status, "completed") || strings.Contains(info.Status, "killed")) {
-			sessions := []protocol.SessionInfo{info}
+	for {
+		if sessions, met, done := waitState(manager, req, condition); done {
 			_ = writer.SendResponse(&protocol.Response{
 				Type:     "WaitResult",
 				Sessions: &sessions,
+				Met:      &met,
 			})
 			return
 		}
-	}
 
-	// If waiting by tags, check if matching sessions are already done.
-	if len(req.Tags) > 0 {
-		matching := manager.ListByTags(req.Tags)
-		allDone := true
-		anyDone := false
-		for _, s := range matching {
-			if strings.Contains(s.Status, "completed") || strings.Contains(s.Status, "killed") {
-				anyDone = true
-			} else {
-				allDone = false
+		select {
+		case _, ok := <-sub.Ch:
+			if !ok {
+				return
 			}
-		}
-		if (condition == "all" && allDone && len(matching) > 0) || (condition == "any" && anyDone) {
+		case <-timer.C:
 			_ = writer.SendResponse(&protocol.Response{
-				Type:     "WaitResult",
-				Sessions: &matching,
+				Type:    "Error",
+				Message: "wait timed out",
 			})
 			return
 		}
 	}
+}
 
-	for {
-		select {
-		case _, ok := <-sub.Ch:
-			if !ok {
+// waitTargets returns the sessions a Wait request is for: its session, or
+// the sessions with its tags and matching its selector.
+func waitTargets(manager *session.SessionManager, req protocol.Request) []protocol.SessionInfo {
+	if req.ID != nil {
+		info, _, err := manager.GetStatus(*req.ID)
+		if err != nil {
+			return nil
+		}
+		return []protocol.SessionInfo{info}
+	}
+	if len(req.Tags) > 0 || req.Selector != "" {
+		selector, _ := protocol.ParseSelector(req.Selector) // checked by handleWait
+		return manager.ListMatching(req.Tags, selector)
+	}
+	return nil
+}
+
+func sessionFinished(s protocol.SessionInfo) bool {
+	return strings.Contains(s.Status, "completed") || strings.Contains(s.Status, "killed")
+}
+
+// sessionFailed reports whether s finished other than with exit code 0.
+func sessionFailed(s protocol.SessionInfo) bool {
+	return sessionFinished(s) && (s.ExitCode == nil || *s.ExitCode != 0 || strings.Contains(s.Status, "killed"))
+}
+
+// waitState evaluates a Wait condition over the request's sessions. done
+// reports whether the wait is over: the condition is met, or it can no longer
+// be, as when a session fails while waiting for success.
+func waitState(manager *session.SessionManager, req protocol.Request, condition string) (sessions []protocol.SessionInfo, met, done bool) {
+	sessions = waitTargets(manager, req)
+	finished, failed := 0, 0
+	for _, s := range sessions {
+		if sessionFinished(s) {
+			finished++
+		}
+		if sessionFailed(s) {
+			failed++
+		}
+	}
+	allFinished := len(sessions) > 0 && finished == len(sessions)
+	switch condition {
+	case "any":
+		return sessions, finished > 0, finished > 0
+	case "success":
+		return sessions, allFinished && failed == 0, allFinished || failed > 0
+	case "any-failure":
+		return sessions, failed > 0, allFinished || failed > 0
+	default: // all
+		return sessions, allFinished, allFinished
+	}
+}
+
+// handleRunScript runs a script against a session and reports how it went,
+// giving up if the client disconnects.
+func handleRunScript(
+	reader connection.FrameReader,
+	writer connection.FrameWriter,
+	manager *session.SessionManager,
+	req protocol.Request,
+) {
+	if req.ID == nil {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: "missing session id"})
+		return
+	}
+	var fromID uint32
+	if req.FromID != nil {
+		fromID = *req.FromID
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			f, err := reader.ReadFrame()
+			if err != nil || f == nil {
+				cancel()
 				return
 			}
+		}
+	}()
 
-			// Re-check condition.
-			if req.ID != nil {
-				info, _, err := manager.GetStatus(*req.ID)
-				if err == nil && (strings.Contains(info.Status, "completed") || strings.Contains(info.Status, "killed")) {
-					sessions := []protocol.SessionInfo{info}
-					_ = writer.SendResponse(&protocol.Response{
-						Type:     "WaitResult",
-						Sessions: &sessions,
-					})
-					return
-				}
-			}
+	result, err := manager.RunScript(ctx, fromID, *req.ID, req.Script)
+	if err != nil {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: err.Error()})
+		return
+	}
+	_ = writer.SendResponse(&protocol.Response{Type: "ScriptResult", ID: req.ID, Script: &result})
+}
 
-			if len(req.Tags) > 0 {
-				matching := manager.ListByTags(req.Tags)
-				allDone := true
-				anyDone := false
-				for _, s := range matching {
-					if strings.Contains(s.Status, "completed") || strings.Contains(s.Status, "killed") {
-						anyDone = true
-					} else {
-						allDone = false
-					}
-				}
-				if (condition == "all" && allDone && len(matching) > 0) || (condition == "any" && anyDone) {
-					_ = writer.SendResponse(&protocol.Response{
-						Type:     "WaitResult",
-						Sessions: &matching,
-					})
-					return
+// waitOutputInterval is how often waitForOutput reads new session output.
+const waitOutputInterval = 250 * time.Millisecond
+
+// waitForOutput answers a Wait request with UntilOutput: it reads the output
+// of the request's sessions, from the start, until a line matches the
+// pattern or every session has finished without one.
+func waitForOutput(writer connection.FrameWriter, manager *session.SessionManager, req protocol.Request, timeout <-chan time.Time) {
+	re, err := regexp.Compile(req.UntilOutput)
+	if err != nil {
+		_ = writer.SendResponse(&protocol.Response{
+			Type:    "Error",
+			Message: fmt.Sprintf("invalid output pattern %q: %v", req.UntilOutput, err),
+		})
+		return
+	}
+
+	type progress struct {
+		offset  int64
+		partial string
+	}
+	read := make(map[uint32]*progress)
+	ticker := time.NewTicker(waitOutputInterval)
+	defer ticker.Stop()
+
+	for {
+		// Check for finished sessions before reading, so their last read
+		// has all their output.
+		sessions := waitTargets(manager, req)
+		allFinished := len(sessions) > 0
+		for _, s := range sessions {
+			finished := sessionFinished(s)
+			allFinished = allFinished && finished
+
+			p := read[s.ID]
+			if p == nil {
+				p = &progress{}
+				read[s.ID] = p
+			}
+			logPath, err := manager.LogPath(s.ID)
+			if err != nil {
+				continue
+			}
+			data, next := readLogFrom(logPath, p.offset)
+			p.offset = next
+			lines := strings.Split(p.partial+string(data), "\n")
+			p.partial = lines[len(lines)-1]
+			if !finished {
+				// The last line is incomplete; it is matched once it ends.
+				lines = lines[:len(lines)-1]
+			}
+			for _, line := range lines {
+				line = strings.TrimRight(session.StripANSI(line), "\r")
+				if !re.MatchString(line) {
+					continue
 				}
+				met := true
+				id := s.ID
+				_ = writer.SendResponse(&protocol.Response{
+					Type:      "WaitResult",
+					Sessions:  &[]protocol.SessionInfo{s},
+					Met:       &met,
+					SessionID: &id,
+					Output:    &line,
+				})
+				return
 			}
+			if finished {
+				p.partial = ""
+			}
+		}
+		if allFinished {
+			met := false
+			_ = writer.SendResponse(&protocol.Response{
+				Type:     "WaitResult",
+				Sessions: &sessions,
+				Met:      &met,
+			})
+			return
+		}
 
-		case <-timer.C:
+		select {
+		case <-ticker.C:
+		case <-timeout:
 			_ = writer.SendResponse(&protocol.Response{
 				Type:    "Error",
 				Message: "wait timed out",
@@ -679,24 +1687,67 @@ func handleWait(
 	}
 }
 
-// handleLogs reads a session's log file and sends it to the client. If follow
-// is true, it polls for new data every 500ms until the connection is closed.
-func handleLogs(writer connection.FrameWriter, logPath string, follow bool, tail *uint, strip bool) error {
-	content, err := os.ReadFile(logPath)
+// readLogFrom returns the log's content from offset, and the offset after it.
+func readLogFrom(path string, offset int64) ([]byte, int64) {
+	f, err := os.Open(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			content = nil
-		} else {
-			return writer.SendResponse(&protocol.Response{
-				Type:    "Error",
-				Message: "failed to read session log",
-			})
+		return nil, offset
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, 1<<62))
+	if err != nil {
+		return nil, offset
+	}
+	return data, offset + int64(len(data))
+}
+
+// sanitizingWriter sanitizes the output in the WatchUpdate responses sent
+// through it, in the order they are sent.
+type sanitizingWriter struct {
+	connection.FrameWriter
+	mu     sync.Mutex
+	stream *session.SanitizeStream
+}
+
+func (w *sanitizingWriter) SendResponse(resp *protocol.Response) error {
+	if resp.Type != "WatchUpdate" || resp.Output == nil {
+		return w.FrameWriter.SendResponse(resp)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := w.stream.Sanitize(*resp.Output)
+	resp.Output = &out
+	return w.FrameWriter.SendResponse(resp)
+}
+
+// handleLogs sends a session's log to the client, from its in-memory
+// history when that reaches back far enough and from the log file otherwise.
+// Output is sanitized at level. If follow is true, it polls for new data
+// every 500ms until the connection is closed.
+func handleLogs(writer connection.FrameWriter, manager *session.SessionManager, id uint32, logPath string, follow bool, tail *uint, level string) error {
+	content, offset, ok := manager.OutputTail(id, tail)
+	if !ok {
+		var err error
+		content, err = os.ReadFile(logPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				content = nil
+			} else {
+				return writer.SendResponse(&protocol.Response{
+					Type:    "Error",
+					Message: "failed to read session log",
+				})
+			}
 		}
+		offset = int64(len(content))
 	}
 
-	data := string(content)
-	if strip {
-		data = stripANSI(data)
+	// Following, a sequence the log ends in the middle of waits for the
+	// data that completes it.
+	sanitizer := session.NewSanitizeStream(level)
+	data := session.Sanitize(string(content), level)
+	if follow {
+		data = sanitizer.Sanitize(string(content))
 	}
 
 	// Apply tail.
@@ -723,7 +1774,6 @@ func handleLogs(writer connection.FrameWriter, logPath string, follow bool, tail
 	}
 
 	// Follow mode: poll for new data.
-	offset := int64(len(content))
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
@@ -755,10 +1805,7 @@ func handleLogs(writer connection.FrameWriter, logPath string, follow bool, tail
 		}
 
 		offset += int64(n)
-		chunk := string(buf[:n])
-		if strip {
-			chunk = stripANSI(chunk)
-		}
+		chunk := sanitizer.Sanitize(string(buf[:n]))
 		notDone := false
 		if sendErr := writer.SendResponse(&protocol.Response{
 			Type: "LogData",
@@ -808,6 +1855,10 @@ func handleMsgSend(writer connection.FrameWriter, manager *session.SessionManage
 	if req.ID != nil {
 		fromID = *req.ID
 	}
+	if err := manager.CheckInput(fromID, toID); err != nil {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: err.Error()})
+		return
+	}
 
 	var msgID string
 	if deliveryIncludesInbox(req.Delivery) {
@@ -817,6 +1868,10 @@ func handleMsgSend(writer connection.FrameWriter, manager *session.SessionManage
 			return
 		}
 	} else {
+		if err := manager.AdmitMessage(fromID, toID, req.Body); err != nil {
+			_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: err.Error()})
+			return
+		}
 		msgID = fmt.Sprintf("msg_%d_%d_%d", fromID, toID, time.Now().UnixNano())
 	}
 
@@ -1021,8 +2076,9 @@ func handleMsgListen(
 		session.EventDirectMessage,
 		session.EventRequest,
 		session.EventReply,
+		session.EventRateLimited,
 	}
-	sub := manager.Subscriptions.Subscribe(req.ID, nil, eventTypes)
+	sub := manager.Subscriptions.Subscribe(req.ID, nil, nil, eventTypes)
 	defer manager.Subscriptions.Unsubscribe(sub.ID)
 
 	// Send ack.
@@ -1048,22 +2104,74 @@ func handleMsgListen(
 			if !ok {
 				return
 			}
-			sessionID := se.SessionID
-			_ = writer.SendResponse(&protocol.Response{
-				Type:      "Event",
-				SessionID: &sessionID,
-				Event: &protocol.SessionEvent{
-					Timestamp: se.Event.Timestamp.Format(time.RFC3339Nano),
-					EventType: string(se.Event.Type),
-					Data:      se.Event.Data,
-				},
-			})
+			_ = writer.SendResponse(eventResponse(manager, se))
 		case <-disconnectCh:
 			return
 		}
 	}
 }
 
+// eventResponse is the Event response streaming se to a subscriber.
+func eventResponse(manager *session.SessionManager, se session.SessionEvent) *protocol.Response {
+	sessionID := se.SessionID
+	return &protocol.Response{
+		Type:      "Event",
+		SessionID: &sessionID,
+		Name:      manager.GetName(se.SessionID),
+		Node:      manager.NodeName,
+		Event: &protocol.SessionEvent{
+			Timestamp: se.Event.Timestamp.Format(time.RFC3339Nano),
+			EventType: string(se.Event.Type),
+			Data:      se.Event.Data,
+			Seq:       se.Seq,
+		},
+	}
+}
+
+// handleHookEvent handles an agent hook report. PreToolUse is charged against
+// the session budget; PostToolUse and Stop are recorded as session events.
+func handleHookEvent(writer connection.FrameWriter, manager *session.SessionManager, req protocol.Request) {
+	if req.ID == nil {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: "missing session id"})
+		return
+	}
+	if req.AgentSessionID != "" || req.TranscriptPath != "" {
+		_ = manager.SetAgentSession(*req.ID, req.AgentSessionID, req.TranscriptPath)
+	}
+
+	var event session.Event
+	switch req.HookEvent {
+	case "PreToolUse":
+		reason, err := manager.ChargeBudget(*req.ID, req.ToolName)
+		if err != nil {
+			_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: err.Error()})
+			return
+		}
+		if reason != "" {
+			_ = writer.SendResponse(&protocol.Response{Type: "BudgetExceeded", ID: req.ID, Message: reason})
+			return
+		}
+		_ = writer.SendResponse(&protocol.Response{Type: "HookEventRecorded", ID: req.ID})
+		return
+	case "PostToolUse":
+		event = session.NewToolResultEvent(req.ToolName, req.ToolInput, req.ToolResponse)
+	case "Stop":
+		event = session.NewAgentStoppedEvent(req.AgentSessionID, req.TranscriptPath)
+	default:
+		_ = writer.SendResponse(&protocol.Response{
+			Type:    "Error",
+			Message: fmt.Sprintf("unsupported hook event: %q", req.HookEvent),
+		})
+		return
+	}
+
+	if err := manager.RecordEvent(*req.ID, event); err != nil {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: err.Error()})
+		return
+	}
+	_ = writer.SendResponse(&protocol.Response{Type: "HookEventRecorded", ID: req.ID})
+}
+
 // handleMsgReply processes a MsgReply: sends a reply to a pending request.
 func handleMsgReply(writer connection.FrameWriter, manager *session.SessionManager, req protocol.Request) {
 	if req.RequestID == "" {
@@ -1091,7 +2199,7 @@ func handleMsgReply(writer connection.FrameWriter, manager *session.SessionManag
 // KV handlers
 // ---------------------------------------------------------------------------
 
-func handleKVSet(writer connection.FrameWriter, kvStore *session.KVStore, req protocol.Request) {
+func handleKVSet(writer connection.FrameWriter, kv kvBackend, req protocol.Request) {
 	ns := req.Namespace
 	if ns == "" {
 		ns = "default"
@@ -1110,44 +2218,58 @@ func handleKVSet(writer connection.FrameWriter, kvStore *session.KVStore, req pr
 		}
 	}
 
-	kvStore.Set(ns, req.Key, req.Value, ttl)
+	if err := kv.Set(ns, req.Key, req.Value, ttl); err != nil {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: err.Error()})
+		return
+	}
 	_ = writer.SendResponse(&protocol.Response{
 		Type: "KVSetOK",
 	})
 }
 
-func handleKVGet(writer connection.FrameWriter, kvStore *session.KVStore, req protocol.Request) {
+func handleKVGet(writer connection.FrameWriter, kv kvBackend, req protocol.Request) {
 	ns := req.Namespace
 	if ns == "" {
 		ns = "default"
 	}
 
-	value := kvStore.Get(ns, req.Key)
+	value, err := kv.Get(ns, req.Key)
+	if err != nil {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: err.Error()})
+		return
+	}
 	_ = writer.SendResponse(&protocol.Response{
 		Type:  "KVGetResult",
 		Value: value,
 	})
 }
 
-func handleKVDelete(writer connection.FrameWriter, kvStore *session.KVStore, req protocol.Request) {
+func handleKVDelete(writer connection.FrameWriter, kv kvBackend, req protocol.Request) {
 	ns := req.Namespace
 	if ns == "" {
 		ns = "default"
 	}
 
-	kvStore.Delete(ns, req.Key)
+	if err := kv.Delete(ns, req.Key); err != nil {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: err.Error()})
+		return
+	}
 	_ = writer.SendResponse(&protocol.Response{
 		Type: "KVDeleteOK",
 	})
 }
 
-func handleKVList(writer connection.FrameWriter, kvStore *session.KVStore, req protocol.Request) {
+func handleKVList(writer connection.FrameWriter, kv kvBackend, req protocol.Request) {
 	ns := req.Namespace
 	if ns == "" {
 		ns = "default"
 	}
 
-	entries := kvStore.List(ns, req.Key)
+	entries, err := kv.List(ns, req.Key)
+	if err != nil {
+		_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: err.Error()})
+		return
+	}
 	pairs := make([]protocol.KVPair, 0, len(entries))
 	for _, e := range entries {
 		pair := protocol.KVPair{
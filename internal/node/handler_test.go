@@ -0,0 +1,54 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+func TestOutputBatcher(t *testing.T) {
+	b := session.NewBroadcaster()
+	_, out := b.Subscribe(session.OutputBufferBytes)
+	batch := &outputBatcher{out: out, delay: 20 * time.Millisecond}
+
+	var frames []string
+	send := func(o session.Output) error {
+		frames = append(frames, string(o.Data))
+		return nil
+	}
+
+	// Writes within the delay go out as one frame once it has passed.
+	b.Send([]byte("one "))
+	<-out.Ready()
+	if batch.ready() {
+		t.Fatal("batcher drained before the delay")
+	}
+	b.Send([]byte("two"))
+	<-out.Ready()
+	if batch.ready() {
+		t.Fatal("batcher drained before the delay")
+	}
+	select {
+	case <-batch.due:
+	case <-time.After(time.Second):
+		t.Fatal("delay never passed")
+	}
+	if err := batch.drain(send); err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || frames[0] != "one two" {
+		t.Fatalf("frames = %q, want [\"one two\"]", frames)
+	}
+	if batch.due != nil {
+		t.Error("drain left the delay running")
+	}
+
+	// Without a delay, output is drained as it comes.
+	batch.delay = 0
+	b.Send([]byte("three"))
+	<-out.Ready()
+	if !batch.ready() {
+		t.Fatal("low-latency batcher waited")
+	}
+}
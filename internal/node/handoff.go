@@ -0,0 +1,54 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// Handoff is what a running node passes to the node process replacing it:
+// its Unix socket listener and the PTY masters of its running sessions.
+type Handoff struct {
+	listener  net.Listener
+	terminals map[uint32]*os.File
+}
+
+var errHandingOff = errors.New("node is handing over to a new node process")
+
+// Close releases everything in an unused handoff.
+func (h *Handoff) Close() {
+	if h.listener != nil {
+		h.listener.Close()
+	}
+	for _, f := range h.terminals {
+		f.Close()
+	}
+}
+
+// handoff sends the node's listener and session terminals to the new node
+// waiting on the handoff socket. Launches are refused from then on; if the
+// handoff fails they are allowed again and the node carries on. On success
+// the caller replies to the new node and calls exit.
+func (n *Node) handoff() error {
+	if !n.handingOff.CompareAndSwap(false, true) {
+		return fmt.Errorf("a handoff is already in progress")
+	}
+	n.Manager.StopLaunches(errHandingOff)
+	err := n.sendHandoff()
+	if err != nil {
+		n.Manager.StopLaunches(nil)
+		n.handingOff.Store(false)
+	}
+	return err
+}
+
+// exit stops the node after a handoff without touching its sessions, socket
+// or PID file, which now belong to the new node.
+func (n *Node) exit() {
+	n.handedOff.Store(true)
+	if ul, ok := n.listener.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	n.stop()
+}
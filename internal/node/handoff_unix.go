@@ -0,0 +1,275 @@
+//go:build !windows
+
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// handoffMsg is one datagram of a handoff. Its file descriptors travel as
+// SCM_RIGHTS ancillary data: the listener first if Listener is set, then one
+// PTY master per entry in Sessions.
+type handoffMsg struct {
+	Listener bool     `json:"listener,omitempty"`
+	Sessions []uint32 `json:"sessions,omitempty"`
+	Done     bool     `json:"done,omitempty"`
+}
+
+// handoffBatch caps the descriptors sent per datagram, well under the
+// kernel's SCM_MAX_FD.
+const handoffBatch = 64
+
+// handoffTimeout bounds each step of receiving a handoff.
+const handoffTimeout = 10 * time.Second
+
+// handoffPath is the datagram socket a new node listens on for a handoff.
+func handoffPath(dataDir string) string {
+	return filepath.Join(dataDir, "handoff.sock")
+}
+
+// ReceiveHandoff takes over from the node running in dataDir. It asks the
+// node for its listener and session terminals, then waits for it to exit so
+// that only one process reads each session's output. Pass the result to
+// NewNodeFromHandoff.
+func ReceiveHandoff(dataDir string) (*Handoff, error) {
+	pidData, err := os.ReadFile(filepath.Join(dataDir, "codewire.pid"))
+	if err != nil {
+		return nil, fmt.Errorf("no running node to take over: %w", err)
+	}
+	oldPID, err := strconv.Atoi(strings.TrimSpace(string(pidData)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pid file: %w", err)
+	}
+
+	path := handoffPath(dataDir)
+	_ = os.Remove(path)
+	pc, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("listening for handoff: %w", err)
+	}
+	defer os.Remove(path)
+	defer pc.Close()
+
+	conn, err := net.Dial("unix", filepath.Join(dataDir, "codewire.sock"))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to running node: %w", err)
+	}
+	defer conn.Close()
+
+	// Drain datagrams while waiting for the reply, so the node never blocks
+	// on a full socket buffer.
+	h := &Handoff{terminals: make(map[uint32]*os.File)}
+	received := make(chan error, 1)
+	_ = pc.SetReadDeadline(time.Now().Add(handoffTimeout))
+	go func() { received <- h.receive(pc) }()
+
+	if err := connection.NewUnixWriter(conn).SendRequest(&protocol.Request{Type: "Handoff"}); err != nil {
+		h.Close()
+		return nil, err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(handoffTimeout))
+	frame, err := connection.NewUnixReader(conn).ReadFrame()
+	if err == nil && frame == nil {
+		err = fmt.Errorf("connection closed")
+	}
+	if err != nil {
+		_ = pc.Close()
+		<-received
+		h.Close()
+		return nil, fmt.Errorf("waiting for handoff: %w", err)
+	}
+	var resp protocol.Response
+	if err := json.Unmarshal(frame.Payload, &resp); err != nil || resp.Type != "HandedOff" {
+		_ = pc.Close()
+		<-received
+		h.Close()
+		if resp.Type == "Error" {
+			return nil, fmt.Errorf("%s", resp.Message)
+		}
+		return nil, fmt.Errorf("unexpected handoff response %q", resp.Type)
+	}
+	if err := <-received; err != nil {
+		h.Close()
+		return nil, fmt.Errorf("receiving handoff: %w", err)
+	}
+
+	deadline := time.Now().Add(handoffTimeout)
+	for syscall.Kill(oldPID, 0) == nil {
+		if time.Now().After(deadline) {
+			h.Close()
+			return nil, fmt.Errorf("previous node (pid %d) did not exit", oldPID)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	slog.Info("received handoff", "sessions", len(h.terminals), "previous_pid", oldPID)
+	return h, nil
+}
+
+// receive reads handoff datagrams until the final one.
+func (h *Handoff) receive(pc *net.UnixConn) error {
+	buf := make([]byte, 64*1024)
+	oob := make([]byte, syscall.CmsgSpace((handoffBatch+1)*4))
+	for {
+		n, oobn, _, _, err := pc.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return err
+		}
+		files, err := unixRights(oob[:oobn])
+		if err != nil {
+			return err
+		}
+		var msg handoffMsg
+		if err := json.Unmarshal(buf[:n], &msg); err != nil {
+			closeFiles(files)
+			return fmt.Errorf("invalid handoff message: %w", err)
+		}
+		want := len(msg.Sessions)
+		if msg.Listener {
+			want++
+		}
+		if len(files) != want {
+			closeFiles(files)
+			return fmt.Errorf("handoff message carries %d descriptors, expected %d", len(files), want)
+		}
+
+		if msg.Listener {
+			ln, err := net.FileListener(files[0])
+			files[0].Close()
+			if err != nil {
+				closeFiles(files[1:])
+				return fmt.Errorf("restoring listener: %w", err)
+			}
+			h.listener = ln
+			files = files[1:]
+		}
+		for i, id := range msg.Sessions {
+			h.terminals[id] = files[i]
+		}
+		if msg.Done {
+			if h.listener == nil {
+				return fmt.Errorf("handoff did not include the listener")
+			}
+			return nil
+		}
+	}
+}
+
+// unixRights extracts the files passed in SCM_RIGHTS control messages.
+func unixRights(oob []byte) ([]*os.File, error) {
+	if len(oob) == 0 {
+		return nil, nil
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, fmt.Errorf("parsing control message: %w", err)
+	}
+	var files []*os.File
+	for _, m := range msgs {
+		fds, err := syscall.ParseUnixRights(&m)
+		if err != nil {
+			closeFiles(files)
+			return nil, fmt.Errorf("parsing descriptors: %w", err)
+		}
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), "handoff"))
+		}
+	}
+	return files, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+func (n *Node) sendHandoff() error {
+	terminals, err := n.Manager.Terminals()
+	if err != nil {
+		return err
+	}
+	ul, ok := n.listener.(*net.UnixListener)
+	if !ok {
+		return fmt.Errorf("listener cannot be handed off")
+	}
+	lnFile, err := ul.File()
+	if err != nil {
+		return fmt.Errorf("duplicating listener: %w", err)
+	}
+	defer lnFile.Close()
+
+	sock, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return fmt.Errorf("creating handoff socket: %w", err)
+	}
+	defer syscall.Close(sock)
+	to := &syscall.SockaddrUnix{Name: handoffPath(n.dataDir)}
+
+	// The new node reads sessions.json to learn about the sessions.
+	n.Manager.PersistMeta()
+
+	if err := sendHandoffMsg(sock, to, handoffMsg{Listener: true}, lnFile); err != nil {
+		return err
+	}
+	ids := make([]uint32, 0, len(terminals))
+	for id := range terminals {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for len(ids) > 0 {
+		batch := ids[:min(len(ids), handoffBatch)]
+		ids = ids[len(batch):]
+		files := make([]*os.File, len(batch))
+		for i, id := range batch {
+			files[i] = terminals[id]
+		}
+		if err := sendHandoffMsg(sock, to, handoffMsg{Sessions: batch}, files...); err != nil {
+			return err
+		}
+	}
+	if err := sendHandoffMsg(sock, to, handoffMsg{Done: true}); err != nil {
+		return err
+	}
+	slog.Info("handed off to new node", "sessions", len(terminals))
+	return nil
+}
+
+func sendHandoffMsg(sock int, to syscall.Sockaddr, msg handoffMsg, files ...*os.File) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var oob []byte
+	if len(files) > 0 {
+		// Read the descriptors without File.Fd, which would switch the
+		// shared open files to blocking mode.
+		fds := make([]int, len(files))
+		for i, f := range files {
+			rc, err := f.SyscallConn()
+			if err != nil {
+				return err
+			}
+			if err := rc.Control(func(fd uintptr) { fds[i] = int(fd) }); err != nil {
+				return err
+			}
+		}
+		oob = syscall.UnixRights(fds...)
+	}
+	if err := syscall.Sendmsg(sock, data, oob, to, 0); err != nil {
+		return fmt.Errorf("sending handoff: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package node
+
+import "errors"
+
+// errNoHandoff is returned on Windows, where a node cannot pass its
+// listener and pseudo consoles to another process.
+var errNoHandoff = errors.New("handoff is not supported on Windows")
+
+// ReceiveHandoff is not supported on Windows.
+func ReceiveHandoff(dataDir string) (*Handoff, error) {
+	return nil, errNoHandoff
+}
+
+func (n *Node) sendHandoff() error {
+	return errNoHandoff
+}
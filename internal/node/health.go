@@ -0,0 +1,35 @@
+package node
+
+import (
+	"runtime"
+
+	"github.com/codewiresh/codewire/internal/relay"
+)
+
+// relayStatus reports the node's load and health to the relay: its running
+// and queued sessions, session limit, CPUs, load average, memory, the space
+// left in the data directory, the cw version and platform, its tags and
+// its update channel.
+func (n *Node) relayStatus() relay.NodeStatus {
+	count := 0
+	for _, s := range n.Manager.List() {
+		if s.Status == "running" || s.Status == "queued" {
+			count++
+		}
+	}
+	memTotal, memAvailable := memory()
+	return relay.NodeStatus{
+		Sessions:     count,
+		LoadAvg:      loadAverage(),
+		MaxSessions:  n.config.Node.MaxConcurrentSessions,
+		CPUs:         runtime.NumCPU(),
+		MemTotal:     memTotal,
+		MemAvailable: memAvailable,
+		DiskFree:     diskFree(n.dataDir),
+		Version:      n.Version,
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		Tags:         n.config.Node.Tags,
+		Channel:      n.config.Node.UpdateChannel,
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package node
+
+// loadAverage, memory and diskFree are only read on Linux; elsewhere the
+// node reports them as unknown.
+
+func loadAverage() float64 { return 0 }
+
+func memory() (total, available uint64) { return 0, 0 }
+
+func diskFree(dir string) uint64 { return 0 }
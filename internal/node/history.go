@@ -0,0 +1,51 @@
+package node
+
+import (
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+// handleHistory serves cw history. HistoryRerun launches an entry's command
+// again through launchSession, so the new session gets the node's default
+// budget and, unless req names it, a generated name.
+func handleHistory(writer connection.FrameWriter, manager *session.SessionManager, req protocol.Request) {
+	var (
+		resp *protocol.Response
+		err  error
+	)
+	switch req.Type {
+	case "HistoryRerun":
+		var e protocol.HistoryEntry
+		if e, err = manager.HistoryEntry(req.Entry); err != nil {
+			break
+		}
+		var id uint32
+		var name string
+		id, name, err = launchSession(manager, &protocol.Request{
+			Command:    e.Command,
+			WorkingDir: e.WorkingDir,
+			Worktree:   e.Worktree,
+			Env:        e.Env,
+			Tags:       e.Tags,
+			Labels:     e.Labels,
+			Name:       req.Name,
+		})
+		status := "running"
+		if manager.QueuePosition(id) > 0 {
+			status = "queued"
+		}
+		resp = &protocol.Response{Type: "Launched", ID: &id, Name: name, Status: status}
+		if info, _, statusErr := manager.GetStatus(id); statusErr == nil {
+			resp.Info = &info
+		}
+	default:
+		var entries []protocol.HistoryEntry
+		entries, err = manager.History(req.Query, req.Limit)
+		resp = &protocol.Response{Type: "History", History: &entries}
+	}
+	if err != nil {
+		resp = &protocol.Response{Type: "Error", Message: err.Error()}
+	}
+	_ = writer.SendResponse(resp)
+}
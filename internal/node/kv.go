@@ -0,0 +1,79 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/relay"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+// kvBackend serves the node's KV requests. A node connected to a relay uses
+// the relay's store, so keys are shared with every other node on it;
+// otherwise keys live in memory on this node.
+type kvBackend interface {
+	Set(namespace, key string, value []byte, ttl time.Duration) error
+	Get(namespace, key string) ([]byte, error)
+	Delete(namespace, key string) error
+	List(namespace, prefix string) ([]session.KVEntry, error)
+}
+
+// localKV adapts the in-memory session.KVStore to kvBackend.
+type localKV struct{ kv *session.KVStore }
+
+func (l localKV) Set(namespace, key string, value []byte, ttl time.Duration) error {
+	l.kv.Set(namespace, key, value, ttl)
+	return nil
+}
+
+func (l localKV) Get(namespace, key string) ([]byte, error) {
+	return l.kv.Get(namespace, key), nil
+}
+
+func (l localKV) Delete(namespace, key string) error {
+	l.kv.Delete(namespace, key)
+	return nil
+}
+
+func (l localKV) List(namespace, prefix string) ([]session.KVEntry, error) {
+	return l.kv.List(namespace, prefix), nil
+}
+
+// relayKV forwards KV requests to the relay.
+type relayKV struct{ c *relay.KVClient }
+
+// rotateRelayToken saves the node's new relay token from a rotation and
+// switches the relay KV client to it.
+func (n *Node) rotateRelayToken(token string) error {
+	if err := relay.SaveNodeToken(n.dataDir, token); err != nil {
+		return err
+	}
+	if r, ok := n.kv.(relayKV); ok {
+		r.c.SetToken(token)
+	}
+	return nil
+}
+
+func (r relayKV) Set(namespace, key string, value []byte, ttl time.Duration) error {
+	return r.c.Set(context.Background(), namespace, key, value, ttl)
+}
+
+func (r relayKV) Get(namespace, key string) ([]byte, error) {
+	return r.c.Get(context.Background(), namespace, key)
+}
+
+func (r relayKV) Delete(namespace, key string) error {
+	return r.c.Delete(context.Background(), namespace, key)
+}
+
+func (r relayKV) List(namespace, prefix string) ([]session.KVEntry, error) {
+	entries, err := r.c.List(context.Background(), namespace, prefix)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]session.KVEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, session.KVEntry{Key: e.Key, Value: e.Value, ExpiresAt: e.ExpiresAt})
+	}
+	return out, nil
+}
@@ -0,0 +1,105 @@
+package node
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Node log rotation defaults: node.log is renamed to node.log.1 (and older
+// files shifted up to node.log.<LogBackups>) once it exceeds LogMaxSize.
+// config.toml's node.log_max_size and node.log_files override them.
+const (
+	LogMaxSize = 10 << 20
+	LogBackups = 3
+)
+
+// LogPath is the node's log file in dataDir.
+func LogPath(dataDir string) string {
+	return filepath.Join(dataDir, "node.log")
+}
+
+// LogFile is an append-only log file that rotates itself by size. It is safe
+// for concurrent use.
+type LogFile struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	size    int64
+	maxSize int64
+	backups int
+}
+
+// OpenLog opens (or creates) the node log in dataDir for appending. It is
+// rotated at maxSize bytes keeping backups old files; zero means
+// LogMaxSize and LogBackups.
+func OpenLog(dataDir string, maxSize int64, backups int) (*LogFile, error) {
+	if maxSize <= 0 {
+		maxSize = LogMaxSize
+	}
+	if backups <= 0 {
+		backups = LogBackups
+	}
+	l := &LogFile{path: LogPath(dataDir), maxSize: maxSize, backups: backups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *LogFile) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening node log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("opening node log: %w", err)
+	}
+	l.f, l.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past its
+// maximum size.
+func (l *LogFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return 0, os.ErrClosed
+	}
+	if l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+func (l *LogFile) rotate() error {
+	l.f.Close()
+	l.f = nil
+	for i := l.backups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rotating node log: %w", err)
+	}
+	return l.open()
+}
+
+// Close closes the log file.
+func (l *LogFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
@@ -0,0 +1,63 @@
+package node
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestLogFileRotates(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenLog(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	line := bytes.Repeat([]byte("x"), 1<<20-1)
+	line = append(line, '\n')
+	// Enough to fill node.log and every backup, and then some.
+	for i := 0; i < (LogBackups+2)*LogMaxSize/len(line); i++ {
+		if _, err := l.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := LogPath(dir)
+	for _, p := range []string{path, path + ".1", fmt.Sprintf("%s.%d", path, LogBackups)} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("expected %s: %v", p, err)
+		}
+		if info.Size() > LogMaxSize {
+			t.Errorf("%s is %d bytes, over the %d limit", p, info.Size(), LogMaxSize)
+		}
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s.%d", path, LogBackups+1)); !os.IsNotExist(err) {
+		t.Errorf("expected at most %d backups", LogBackups)
+	}
+}
+
+func TestLogFileConfiguredRotation(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenLog(dir, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	line := append(bytes.Repeat([]byte("x"), 59), '\n')
+	for range 5 {
+		if _, err := l.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := LogPath(dir)
+	if info, err := os.Stat(path + ".1"); err != nil || info.Size() != 60 {
+		t.Fatalf("expected a 60-byte %s.1: %v", path, err)
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Error("expected a single backup")
+	}
+}
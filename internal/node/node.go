@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"nhooyr.io/websocket"
@@ -24,42 +25,183 @@ import (
 // and optionally a WebSocket listener.
 type Node struct {
 	Manager    *session.SessionManager
-	KVStore    *session.KVStore
+	KVStore    *session.KVStore // used when no relay is configured
+	kv         kvBackend
+	cron       *cronScheduler
 	socketPath string
 	pidPath    string
 	config     *config.Config
 	dataDir    string
+	peers      *peerAuth // who may use the Unix socket
+
+	// Version is the cw version the node reports to the relay.
+	Version string
+
+	listener   net.Listener       // Unix socket listener, set by Run or a handoff
+	stop       context.CancelFunc // stops Run
+	handingOff atomic.Bool        // a handoff to a new node is in progress
+	handedOff  atomic.Bool        // the new node has taken over; exit quietly
+	restarting atomic.Bool        // Run returns ErrRestart for the service manager
+	updater    autoUpdater
 }
 
 // NewNode creates a Node rooted at dataDir. It loads the configuration,
 // initialises the session manager, and ensures an auth token exists on disk.
 func NewNode(dataDir string) (*Node, error) {
+	return NewNodeFromHandoff(dataDir, nil)
+}
+
+// NewNodeFromHandoff is NewNode for a node taking over from a previous one
+// (see ReceiveHandoff): it serves the handed-over listener and resumes the
+// previous node's sessions with their terminals. h may be nil.
+func NewNodeFromHandoff(dataDir string, h *Handoff) (*Node, error) {
 	cfg, err := config.LoadConfig(dataDir)
 	if err != nil {
 		return nil, fmt.Errorf("loading config: %w", err)
 	}
 
+	peers, err := newPeerAuth(dataDir, cfg.Node)
+	if err != nil {
+		return nil, err
+	}
+
 	mgr, err := session.NewSessionManager(dataDir)
 	if err != nil {
 		return nil, fmt.Errorf("creating session manager: %w", err)
 	}
 
+	if journal, err := session.OpenJournal(dataDir, int64(cfg.Node.EventLogMaxSize)<<20, cfg.Node.EventLogFiles); err != nil {
+		slog.Warn("events will not be journaled", "err", err)
+	} else {
+		mgr.Subscriptions.SetJournal(journal)
+	}
+
+	mgr.DefaultBudget = cfg.Budget
+	mgr.MaxConcurrent = cfg.Node.MaxConcurrentSessions
+	mgr.Summaries = summarizer(cfg.Summaries)
+	mgr.MessageLimits = messageLimits(cfg.Messages)
+	if cfg.Node.HistoryBufferSize != 0 {
+		mgr.HistoryBytes = max(cfg.Node.HistoryBufferSize, 0) << 10
+	}
+	mgr.HistoryLines = cfg.Node.HistoryBufferLines
+	if cfg.Node.OutputDelay != "" {
+		mgr.OutputDelay, _ = time.ParseDuration(cfg.Node.OutputDelay)
+	}
+	mgr.NodeName = cfg.Node.Name
+	if cfg.Alerts != nil {
+		mgr.AlertPatterns = cfg.Alerts.Patterns
+		mgr.AlertNotify = cfg.Alerts.Notify
+	}
+	if cfg.Redact != nil {
+		mgr.RedactPatterns = cfg.Redact.Patterns
+		mgr.RedactEnv = cfg.Redact.Env
+	}
+	if cfg.Cost != nil {
+		for _, ex := range cfg.Cost.Extractors {
+			// Validated with the config.
+			extractor, _ := session.NewUsageExtractor(ex.Agent, ex.Cost, ex.InputTokens, ex.OutputTokens)
+			mgr.UsageExtractors = append(mgr.UsageExtractors, extractor)
+		}
+		mgr.CostTagLimits = cfg.Cost.TagLimits
+		mgr.CostAction = cfg.Cost.Action
+	}
+	mgr.Agents = cfg.Agents
+	if cfg.Archive != nil {
+		mgr.ArchiveDir = cfg.Archive.Dir
+		if mgr.ArchiveDir != "" && !filepath.IsAbs(mgr.ArchiveDir) {
+			mgr.ArchiveDir = filepath.Join(dataDir, mgr.ArchiveDir)
+		}
+		if cfg.Archive.S3Bucket != "" {
+			mgr.ArchiveStore = relay.S3Location{
+				Bucket:   cfg.Archive.S3Bucket,
+				Prefix:   cfg.Archive.S3Prefix,
+				Region:   cfg.Archive.S3Region,
+				Endpoint: cfg.Archive.S3Endpoint,
+			}
+		}
+	}
+	mgr.RegisterBackend("docker", session.DockerBackend{Runtime: cfg.Node.ContainerRuntime})
+	orphanPolicy := cfg.Node.OrphanPolicy
+	if orphanPolicy == "" {
+		orphanPolicy = session.OrphanAdopt
+	}
+	var terminals map[uint32]*os.File
+	var listener net.Listener
+	if h != nil {
+		terminals, listener = h.terminals, h.listener
+	}
+	if n := mgr.RecoverOrphans(orphanPolicy, terminals); n > 0 {
+		slog.Info("found session processes left by the previous node", "count", n, "policy", orphanPolicy)
+	}
+
+	scheduler, err := newCronScheduler(dataDir, mgr)
+	if err != nil {
+		return nil, fmt.Errorf("loading cron jobs: %w", err)
+	}
+
 	token, err := auth.LoadOrGenerateToken(dataDir)
 	if err != nil {
 		return nil, fmt.Errorf("loading auth token: %w", err)
 	}
 	slog.Info("auth token ready", "token", token)
 
+	kvStore := session.NewKVStore()
+	loadImportedKV(dataDir, kvStore)
+	var kv kvBackend = localKV{kvStore}
+	if cfg.RelayURL != nil && cfg.RelayToken != nil {
+		kv = relayKV{relay.NewKVClient(*cfg.RelayURL, *cfg.RelayToken)}
+	}
+
 	return &Node{
 		Manager:    mgr,
-		KVStore:    session.NewKVStore(),
+		KVStore:    kvStore,
+		kv:         kv,
+		cron:       scheduler,
 		socketPath: filepath.Join(dataDir, "codewire.sock"),
 		pidPath:    filepath.Join(dataDir, "codewire.pid"),
 		config:     cfg,
 		dataDir:    dataDir,
+		peers:      peers,
+		listener:   listener,
 	}, nil
 }
 
+// summarizer returns the output summary settings of the [summaries] table,
+// with defaults for what it leaves out. LoadConfig has validated them.
+func summarizer(cfg *config.Summaries) session.Summarizer {
+	s := session.Summarizer{Interval: 30 * time.Second, Lines: 5}
+	if cfg == nil {
+		return s
+	}
+	if cfg.Interval != "" {
+		s.Interval, _ = time.ParseDuration(cfg.Interval)
+	}
+	if cfg.Lines > 0 {
+		s.Lines = cfg.Lines
+	}
+	s.Command = cfg.Command
+	return s
+}
+
+// messageLimits returns the message limits of the [messages] table, with
+// defaults for what it leaves out. LoadConfig has validated them.
+func messageLimits(cfg *config.Messages) session.MessageLimits {
+	l := session.MessageLimits{MaxBody: 64 << 10, PerMinute: 60, Burst: 20}
+	if cfg == nil {
+		return l
+	}
+	if cfg.MaxBody != 0 {
+		l.MaxBody = max(cfg.MaxBody, 0)
+	}
+	if cfg.PerMinute != 0 {
+		l.PerMinute = max(cfg.PerMinute, 0)
+	}
+	if cfg.Burst > 0 {
+		l.Burst = cfg.Burst
+	}
+	return l
+}
+
 // Run starts the node. It writes a PID file, listens on a Unix socket,
 // and optionally starts a WebSocket server. It blocks until ctx is cancelled.
 func (n *Node) Run(ctx context.Context) error {
@@ -69,15 +211,30 @@ func (n *Node) Run(ctx context.Context) error {
 		return fmt.Errorf("writing pid file: %w", err)
 	}
 
-	// Remove stale socket if it exists.
-	_ = os.Remove(n.socketPath)
+	ln := n.listener
+	if ln == nil {
+		// Remove stale socket if it exists.
+		_ = os.Remove(n.socketPath)
 
-	ln, err := net.Listen("unix", n.socketPath)
-	if err != nil {
-		return fmt.Errorf("listening on unix socket: %w", err)
+		var err error
+		ln, err = net.Listen("unix", n.socketPath)
+		if err != nil {
+			return fmt.Errorf("listening on unix socket: %w", err)
+		}
+		n.listener = ln
+	}
+	if n.peers.shared() {
+		// Connecting needs write permission; peer credentials decide who is
+		// actually let in.
+		if err := os.Chmod(n.socketPath, 0o666); err != nil {
+			return fmt.Errorf("opening up unix socket: %w", err)
+		}
 	}
 	slog.Info("listening on unix socket", "path", n.socketPath)
 
+	ctx, n.stop = context.WithCancel(ctx)
+	defer n.stop()
+
 	defer n.Cleanup()
 
 	// Start WebSocket server if configured (direct mode).
@@ -90,16 +247,39 @@ func (n *Node) Run(ctx context.Context) error {
 		}()
 	}
 
+	// Start the gRPC API if configured.
+	if n.config.Node.GRPCListen != nil {
+		addr := *n.config.Node.GRPCListen
+		go func() {
+			if grpcErr := n.runGRPCServer(ctx, addr); grpcErr != nil {
+				slog.Error("grpc server error", "err", grpcErr)
+			}
+		}()
+	}
+
 	// Start relay agent if relay URL and token are configured.
 	if n.config.RelayURL != nil && n.config.RelayToken != nil {
 		go relay.RunAgent(ctx, relay.AgentConfig{
 			RelayURL:  *n.config.RelayURL,
 			NodeName:  n.config.Node.Name,
 			NodeToken: *n.config.RelayToken,
+			DataDir:   n.dataDir,
+			OnReply: func(requestID, body string) error {
+				return n.Manager.SendReply(0, requestID, body)
+			},
+			Groups: n.config.RelayGroups,
+			// Clients the relay places on this node were authenticated
+			// by the relay; they may launch and manage sessions.
+			Clients: func(reader connection.FrameReader, writer connection.FrameWriter) {
+				handleClient(reader, writer, n.Manager, n.kv, n.cron, nil, auth.ScopeLaunch)
+			},
+			Status: n.relayStatus,
+			Update: n.autoUpdate,
+			Rotate: n.rotateRelayToken,
 		})
 	}
 
-	// Start periodic status refresh (every 5 seconds).
+	// Refresh session statuses and sweep expired KV entries every 5 seconds.
 	go func() {
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
@@ -109,13 +289,36 @@ func (n *Node) Run(ctx context.Context) error {
 				return
 			case <-ticker.C:
 				n.Manager.RefreshStatuses()
+				n.KVStore.Sweep()
 			}
 		}
 	}()
 
+	// Summarize new session output.
+	if interval := n.Manager.Summaries.Interval; interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					n.Manager.SummarizeOutput()
+				}
+			}
+		}()
+	}
+
 	// Start persistence manager.
 	go persistenceManager(n.Manager)
 
+	// Deliver events to configured webhooks.
+	go newWebhookDispatcher(n.dataDir, n.config.Node.Name, n.Manager).run(ctx)
+
+	// Launch scheduled sessions.
+	go n.cron.run(ctx)
+
 	// Close the listener when ctx is cancelled so Accept unblocks.
 	go func() {
 		<-ctx.Done()
@@ -129,31 +332,42 @@ func (n *Node) Run(ctx context.Context) error {
 			// Check if we were shut down.
 			select {
 			case <-ctx.Done():
+				if n.handedOff.Load() {
+					return nil
+				}
+				if n.restarting.Load() {
+					return ErrRestart
+				}
 				return ctx.Err()
 			default:
 			}
 			slog.Error("accept error", "err", acceptErr)
 			continue
 		}
-		go handleClient(
-			connection.NewUnixReader(conn),
-			connection.NewUnixWriter(conn),
-			n.Manager,
-			n.KVStore,
-		)
+		go n.serveUnix(conn)
 	}
 }
 
-// Cleanup removes the Unix socket and PID files.
+// Cleanup removes the Unix socket and PID files, unless the node handed off
+// to a new node, which now owns them.
 func (n *Node) Cleanup() {
+	if n.handedOff.Load() {
+		return
+	}
 	_ = os.Remove(n.socketPath)
 	_ = os.Remove(n.pidPath)
 }
 
 // runWSServer starts an HTTP server that upgrades /ws connections to WebSocket
 // and dispatches them through the standard client handler after validating the
-// auth token.
+// auth token, whose scope limits what the connection may do. It serves TLS
+// when configured.
 func (n *Node) runWSServer(ctx context.Context, addr string) error {
+	tlsConfig, err := wsTLSConfig(n.dataDir, n.config.Node)
+	if err != nil {
+		return err
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		// Check Authorization header first, fall back to query param.
@@ -164,7 +378,8 @@ func (n *Node) runWSServer(ctx context.Context, addr string) error {
 		if token == "" {
 			token = r.URL.Query().Get("token")
 		}
-		if !auth.ValidateToken(n.dataDir, token) {
+		scope, ok := auth.Authenticate(n.dataDir, token)
+		if !ok {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -178,15 +393,16 @@ func (n *Node) runWSServer(ctx context.Context, addr string) error {
 		wsCtx := r.Context()
 		reader := connection.NewWSReader(wsCtx, wsConn)
 		writer := connection.NewWSWriter(wsCtx, wsConn)
-		handleClient(reader, writer, n.Manager, n.KVStore)
+		handleClient(reader, writer, n.Manager, n.kv, n.cron, nil, scope)
 	})
 
 	srv := &http.Server{
-		Addr:    addr,
-		Handler: mux,
+		Addr:      addr,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
 	}
 
-	slog.Info("websocket server listening", "addr", addr)
+	slog.Info("websocket server listening", "addr", addr, "tls", tlsConfig != nil)
 
 	// Shut down gracefully when ctx is cancelled.
 	go func() {
@@ -196,7 +412,12 @@ func (n *Node) runWSServer(ctx context.Context, addr string) error {
 		_ = srv.Shutdown(shutdownCtx)
 	}()
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if tlsConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("websocket server: %w", err)
 	}
 	return nil
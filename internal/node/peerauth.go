@@ -0,0 +1,161 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+
+	"github.com/codewiresh/codewire/internal/auth"
+	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// peerAuth decides which local users may use the node's Unix socket.
+type peerAuth struct {
+	uids    []uint32 // always includes the node's own user
+	gids    []uint32
+	token   bool   // let other users in with an auth token
+	dataDir string // where the auth token is stored
+}
+
+func newPeerAuth(dataDir string, cfg config.NodeConfig) (*peerAuth, error) {
+	p := &peerAuth{
+		uids:    append([]uint32{uint32(os.Getuid())}, cfg.SocketAllowUIDs...),
+		token:   cfg.SocketTokenAuth,
+		dataDir: dataDir,
+	}
+	for _, g := range cfg.SocketAllowGroups {
+		if gid, err := strconv.ParseUint(g, 10, 32); err == nil {
+			p.gids = append(p.gids, uint32(gid))
+			continue
+		}
+		grp, err := user.LookupGroup(g)
+		if err != nil {
+			return nil, fmt.Errorf("node.socket_allow_groups: %w", err)
+		}
+		gid, err := strconv.ParseUint(grp.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("node.socket_allow_groups: group %s has invalid gid %q", g, grp.Gid)
+		}
+		p.gids = append(p.gids, uint32(gid))
+	}
+	// Without peer credentials every local user would look like the node's
+	// own, so the socket cannot be opened up.
+	if p.shared() && !peerCredSupported {
+		return nil, fmt.Errorf("node.socket_allow_uids, node.socket_allow_groups and node.socket_token_auth need peer credentials, which are not available on this platform")
+	}
+	return p, nil
+}
+
+// shared reports whether users other than the node's own may connect, in
+// which case the socket must be writable by them.
+func (p *peerAuth) shared() bool {
+	return len(p.uids) > 1 || len(p.gids) > 0 || p.token
+}
+
+// allowed reports whether a peer running as uid with the given groups may
+// use the node. Supplementary groups are looked up for uid as well.
+func (p *peerAuth) allowed(uid uint32, gids []uint32) bool {
+	if slices.Contains(p.uids, uid) {
+		return true
+	}
+	if len(p.gids) == 0 {
+		return false
+	}
+	if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+		if ids, err := u.GroupIds(); err == nil {
+			for _, id := range ids {
+				if gid, err := strconv.ParseUint(id, 10, 32); err == nil {
+					gids = append(gids, uint32(gid))
+				}
+			}
+		}
+	}
+	for _, gid := range gids {
+		if slices.Contains(p.gids, gid) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveUnix handles a connection on the Unix socket once the peer has been
+// checked. Peers the allowlists do not cover are rejected, unless token auth
+// is on and their request carries an auth token, whose scope then applies.
+func (n *Node) serveUnix(conn net.Conn) {
+	var reader connection.FrameReader = connection.NewUnixReader(conn)
+	writer := connection.NewUnixWriter(conn)
+
+	scope := auth.ScopeAdmin
+	uid, gids, err := peerCred(conn)
+	unsupported := errors.Is(err, errors.ErrUnsupported)
+	if unsupported && !n.peers.shared() {
+		// No peer credentials on this platform; rely on socket permissions,
+		// which only let the node's own user in.
+	} else if err != nil && !unsupported {
+		slog.Error("reading peer credentials", "err", err)
+		reader.Close()
+		writer.Close()
+		return
+	} else if unsupported || !n.peers.allowed(uid, gids) {
+		f, err := reader.ReadFrame()
+		if err != nil || f == nil {
+			// Disconnected without a request, e.g. a liveness check.
+			reader.Close()
+			writer.Close()
+			return
+		}
+		var ok bool
+		if scope, ok = n.peers.authenticate(f); !ok {
+			slog.Warn("rejected unix socket connection", "uid", uid)
+			msg := fmt.Sprintf("uid %d is not allowed to use this node", uid)
+			if unsupported {
+				msg = "other users are not allowed to use this node"
+			}
+			if n.peers.token {
+				msg += " without an auth token"
+			}
+			_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: msg})
+			reader.Close()
+			writer.Close()
+			return
+		}
+		reader = &prereadReader{FrameReader: reader, first: f}
+	}
+
+	handleClient(reader, writer, n.Manager, n.kv, n.cron, n, scope)
+}
+
+// authenticate checks that f, the first frame from a peer the allowlists do
+// not cover, is a request carrying an auth token, and returns its scope.
+func (p *peerAuth) authenticate(f *protocol.Frame) (auth.Scope, bool) {
+	if !p.token || f.Type != protocol.FrameControl {
+		return "", false
+	}
+	var req protocol.Request
+	if err := json.Unmarshal(f.Payload, &req); err != nil {
+		return "", false
+	}
+	return auth.Authenticate(p.dataDir, req.Token)
+}
+
+// prereadReader replays a frame already read from the connection.
+type prereadReader struct {
+	connection.FrameReader
+	first *protocol.Frame
+}
+
+func (r *prereadReader) ReadFrame() (*protocol.Frame, error) {
+	if f := r.first; f != nil {
+		r.first = nil
+		return f, nil
+	}
+	return r.FrameReader.ReadFrame()
+}
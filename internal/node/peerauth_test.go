@@ -0,0 +1,125 @@
+package node
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/auth"
+	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestPeerCred(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	uid, gids, err := peerCred(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid != uint32(os.Getuid()) {
+		t.Errorf("peer uid = %d, want %d", uid, os.Getuid())
+	}
+	if len(gids) == 0 || gids[0] != uint32(os.Getegid()) {
+		t.Errorf("peer groups = %v, want %d first", gids, os.Getegid())
+	}
+}
+
+func TestPeerAuthAllowed(t *testing.T) {
+	own := uint32(os.Getuid())
+	other := own + 1000
+
+	p, err := newPeerAuth(t.TempDir(), config.NodeConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.allowed(own, nil) {
+		t.Error("node's own user should be allowed")
+	}
+	if p.allowed(other, []uint32{12345}) {
+		t.Error("other users should not be allowed by default")
+	}
+	if p.shared() {
+		t.Error("socket should not be shared by default")
+	}
+
+	p, err = newPeerAuth(t.TempDir(), config.NodeConfig{
+		SocketAllowUIDs:   []uint32{other},
+		SocketAllowGroups: []string{"12345"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.allowed(other, nil) {
+		t.Error("allowlisted uid should be allowed")
+	}
+	if !p.allowed(other+1, []uint32{12345}) {
+		t.Error("member of an allowlisted group should be allowed")
+	}
+	if p.allowed(other+1, []uint32{54321}) {
+		t.Error("user outside the allowlists should not be allowed")
+	}
+	if !p.shared() {
+		t.Error("socket should be shared with allowlisted users")
+	}
+
+	if _, err := newPeerAuth(t.TempDir(), config.NodeConfig{SocketAllowGroups: []string{"no-such-group-cw"}}); err == nil {
+		t.Error("expected an error for an unknown group")
+	}
+
+	// Without peer credentials, opening up the socket would let every
+	// local user in as the node's own.
+	if _, err := newPeerAuth(t.TempDir(), config.NodeConfig{SocketTokenAuth: true}); (err == nil) != peerCredSupported {
+		t.Errorf("socket_token_auth with peer credentials supported %v: %v", peerCredSupported, err)
+	}
+}
+
+func TestPeerAuthToken(t *testing.T) {
+	dir := t.TempDir()
+	token, err := auth.LoadOrGenerateToken(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticate := func(p *peerAuth, req *protocol.Request) bool {
+		t.Helper()
+		payload, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ok := p.authenticate(&protocol.Frame{Type: protocol.FrameControl, Payload: payload})
+		return ok
+	}
+
+	p := &peerAuth{token: true, dataDir: dir}
+	if !authenticate(p, &protocol.Request{Type: "ListSessions", Token: token}) {
+		t.Error("request with the auth token should be accepted")
+	}
+	if authenticate(p, &protocol.Request{Type: "ListSessions", Token: "wrong"}) {
+		t.Error("request with a wrong token should be rejected")
+	}
+	if authenticate(p, &protocol.Request{Type: "ListSessions"}) {
+		t.Error("request without a token should be rejected")
+	}
+	if authenticate(&peerAuth{dataDir: dir}, &protocol.Request{Type: "ListSessions", Token: token}) {
+		t.Error("token should not be accepted without socket_token_auth")
+	}
+}
@@ -0,0 +1,30 @@
+package node
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredSupported reports whether peerCred works on this platform.
+const peerCredSupported = true
+
+// peerCred returns the user and groups of the process on the other end of a
+// Unix socket connection.
+func peerCred(conn net.Conn) (uint32, []uint32, error) {
+	rc, err := conn.(*net.UnixConn).SyscallConn()
+	if err != nil {
+		return 0, nil, err
+	}
+	var cred *unix.Xucred
+	var credErr error
+	if err := rc.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	}); err != nil {
+		return 0, nil, err
+	}
+	if credErr != nil {
+		return 0, nil, credErr
+	}
+	return cred.Uid, cred.Groups[:cred.Ngroups], nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+
+package node
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCredSupported reports whether peerCred works on this platform.
+const peerCredSupported = false
+
+// peerCred is not implemented on this platform; access to the Unix socket
+// is governed by its file permissions alone.
+func peerCred(conn net.Conn) (uint32, []uint32, error) {
+	return 0, nil, errors.ErrUnsupported
+}
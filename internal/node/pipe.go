@@ -0,0 +1,38 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+// handlePipe serves cw pipe, which forwards one session's output into
+// another's input.
+func handlePipe(writer connection.FrameWriter, manager *session.SessionManager, req protocol.Request) {
+	var (
+		resp *protocol.Response
+		err  error
+	)
+	switch req.Type {
+	case "PipeAdd":
+		if req.ID == nil || req.ToID == nil {
+			err = fmt.Errorf("missing session id")
+			break
+		}
+		var p protocol.Pipe
+		p, err = manager.AddPipe(*req.ID, *req.ToID, req.Grep, req.Replace)
+		resp = &protocol.Response{Type: "PipeAdded", Pipes: &[]protocol.Pipe{p}}
+	case "PipeRemove":
+		err = manager.RemovePipe(req.Pipe)
+		resp = &protocol.Response{Type: "PipeRemoved"}
+	default:
+		pipes := manager.Pipes()
+		resp = &protocol.Response{Type: "Pipes", Pipes: &pipes}
+	}
+	if err != nil {
+		resp = &protocol.Response{Type: "Error", Message: err.Error()}
+	}
+	_ = writer.SendResponse(resp)
+}
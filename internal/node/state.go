@@ -0,0 +1,433 @@
+package node
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+// A state export is a zstd-compressed tar file: stateManifestFile first,
+// then the data directory's files by their paths in it, and the node's KV
+// entries as stateKVFile.
+const (
+	stateManifestFile = "manifest.json"
+	stateKVFile       = "kv.json"
+	stateVersion      = 1
+)
+
+// StateManifest describes a node state export.
+type StateManifest struct {
+	Version int `json:"version"`
+	// DataDir is the data directory exported. ImportState rewrites paths
+	// under it to be under the data directory imported to.
+	DataDir    string    `json:"data_dir"`
+	Node       string    `json:"node,omitempty"`
+	ExportedAt time.Time `json:"exported_at"`
+	Files      int       `json:"files"`
+	KVEntries  int       `json:"kv_entries"`
+}
+
+// kvRecord is a KV entry in stateKVFile.
+type kvRecord struct {
+	Namespace string     `json:"namespace"`
+	Key       string     `json:"key"`
+	Value     []byte     `json:"value"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// stateSkipped reports whether the data directory entry at rel is left out
+// of exports: the node's socket, PID file and logs, and the worktree
+// checkouts and their list, which belong to repositories on this machine.
+func stateSkipped(rel string) bool {
+	switch rel {
+	case "codewire.sock", "codewire.pid", "handoff.sock", "worktrees", "worktrees.json":
+		return true
+	}
+	return strings.HasPrefix(rel, "node.log")
+}
+
+// ExportState writes the node state in dataDir to output: session metadata
+// and logs, launch history, cron jobs, archives, tokens, config.toml with
+// its relay credentials, saved servers and, if kv is not nil, the entries
+// of the node's in-memory KV store.
+func ExportState(dataDir, output string, kv *session.KVStore) (StateManifest, error) {
+	dataDir, err := filepath.Abs(dataDir)
+	if err != nil {
+		return StateManifest{}, err
+	}
+	output, err = filepath.Abs(output)
+	if err != nil {
+		return StateManifest{}, err
+	}
+
+	var files []string
+	err = filepath.WalkDir(dataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dataDir, path)
+		if rel == "." {
+			return nil
+		}
+		if stateSkipped(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && path != output {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return StateManifest{}, fmt.Errorf("reading data dir: %w", err)
+	}
+
+	var records []kvRecord
+	if kv != nil {
+		for _, ns := range kv.Namespaces() {
+			for _, e := range kv.List(ns, "") {
+				records = append(records, kvRecord{Namespace: ns, Key: e.Key, Value: e.Value, ExpiresAt: e.ExpiresAt})
+			}
+		}
+	}
+	manifest := StateManifest{
+		Version:    stateVersion,
+		DataDir:    dataDir,
+		ExportedAt: time.Now().UTC(),
+		Files:      len(files),
+		KVEntries:  len(records),
+	}
+	if cfg, err := config.LoadConfig(dataDir); err == nil {
+		manifest.Node = cfg.Node.Name
+	}
+
+	if err := writeState(output, dataDir, files, manifest, records); err != nil {
+		return StateManifest{}, fmt.Errorf("writing %s: %w", output, err)
+	}
+	return manifest, nil
+}
+
+// writeState writes the export of files in dataDir to output, through a
+// temporary file.
+func writeState(output, dataDir string, files []string, manifest StateManifest, records []kvRecord) (err error) {
+	tmp := output + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addStateData(tw, stateManifestFile, manifestData); err != nil {
+		return err
+	}
+	for _, rel := range files {
+		if err := addStateFile(tw, dataDir, rel); err != nil {
+			return err
+		}
+	}
+	if len(records) > 0 {
+		kvData, err := json.Marshal(records)
+		if err != nil {
+			return err
+		}
+		if err := addStateData(tw, stateKVFile, kvData); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, output)
+}
+
+// addStateData adds data to tw as name.
+func addStateData(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// addStateFile adds the file at rel in dataDir to tw. A file that is gone
+// by now, such as a rotated log, is left out.
+func addStateFile(tw *tar.Writer, dataDir, rel string) error {
+	f, err := os.Open(filepath.Join(dataDir, rel))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(rel)
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	// Copy no more than the header promises, should the file still grow.
+	_, err = io.CopyN(tw, f, hdr.Size)
+	return err
+}
+
+// ImportOptions configures ImportState.
+type ImportOptions struct {
+	Input   string // the export
+	DataDir string // to import into; the node must not be running on it
+	// Force imports into a data directory that already holds a node's
+	// state, replacing the files the export has.
+	Force bool
+}
+
+// ImportState unpacks the export opts.Input into opts.DataDir, rewriting
+// the paths that JSON and TOML files have under the exported data
+// directory to be under opts.DataDir. Sessions the export recorded as
+// running or queued are recorded as killed: their processes stayed behind.
+// KV entries are left in kv.json, which the node loads when it starts.
+func ImportState(opts ImportOptions) (StateManifest, error) {
+	dataDir, err := filepath.Abs(opts.DataDir)
+	if err != nil {
+		return StateManifest{}, err
+	}
+	if !opts.Force {
+		for _, name := range []string{"sessions.json", "config.toml"} {
+			if _, err := os.Stat(filepath.Join(dataDir, name)); err == nil {
+				return StateManifest{}, fmt.Errorf("%s already holds a node's state; pass --force to import over it", dataDir)
+			}
+		}
+	}
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return StateManifest{}, err
+	}
+
+	var manifest StateManifest
+	err = readState(opts.Input, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name == stateManifestFile {
+			if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+				return fmt.Errorf("reading manifest: %w", err)
+			}
+			if manifest.Version != stateVersion {
+				return fmt.Errorf("unsupported export version %d", manifest.Version)
+			}
+			return nil
+		}
+		if manifest.Version == 0 {
+			return fmt.Errorf("not a node state export: no %s first", stateManifestFile)
+		}
+		rel := filepath.FromSlash(hdr.Name)
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("invalid path %q in export", hdr.Name)
+		}
+		return importStateFile(filepath.Join(dataDir, rel), hdr, r, manifest.DataDir, dataDir)
+	})
+	if err != nil {
+		return StateManifest{}, err
+	}
+	if manifest.Version == 0 {
+		return StateManifest{}, fmt.Errorf("not a node state export: no %s", stateManifestFile)
+	}
+	if err := endImportedSessions(filepath.Join(dataDir, "sessions.json")); err != nil {
+		return StateManifest{}, fmt.Errorf("updating sessions.json: %w", err)
+	}
+	return manifest, nil
+}
+
+// ReadStateManifest returns the manifest of the export at path.
+func ReadStateManifest(path string) (StateManifest, error) {
+	var manifest StateManifest
+	errFound := errors.New("found")
+	err := readState(path, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name != stateManifestFile {
+			return fmt.Errorf("not a node state export: no %s first", stateManifestFile)
+		}
+		if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+			return fmt.Errorf("reading manifest: %w", err)
+		}
+		return errFound
+	})
+	if errors.Is(err, errFound) {
+		err = nil
+	} else if err == nil {
+		err = fmt.Errorf("not a node state export: no %s", stateManifestFile)
+	}
+	return manifest, err
+}
+
+// readState calls fn with each regular file of the export at path, until
+// it returns an error.
+func readState(path string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading export: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// importStateFile writes the exported file hdr describes to path, with
+// JSON and TOML files' paths under from rewritten to be under to.
+func importStateFile(path string, hdr *tar.Header, r io.Reader, from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm())
+	if err != nil {
+		return err
+	}
+	switch filepath.Ext(path) {
+	case ".json", ".jsonl", ".toml":
+		var data []byte
+		if data, err = io.ReadAll(r); err == nil {
+			_, err = f.Write(remapDataDir(data, from, to))
+		}
+	default:
+		_, err = io.Copy(f, r)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(path, hdr.ModTime, hdr.ModTime)
+}
+
+// remapDataDir rewrites the paths in data that are from, or under it, to
+// be to, or under it.
+func remapDataDir(data []byte, from, to string) []byte {
+	if from == "" || from == to {
+		return data
+	}
+	for _, end := range []string{string(filepath.Separator), `"`, `'`} {
+		data = bytes.ReplaceAll(data, []byte(from+end), []byte(to+end))
+	}
+	return data
+}
+
+// endImportedSessions records the sessions in sessions.json at path that
+// were running or queued as killed, so that the node does not take
+// processes on this machine for theirs.
+func endImportedSessions(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var metas []session.SessionMeta
+	if err := json.Unmarshal(data, &metas); err != nil {
+		return err
+	}
+	changed := false
+	for i, m := range metas {
+		if m.Status == session.StatusRunning().String() || m.Status == session.StatusQueued().String() {
+			metas[i].Status = session.StatusKilled().String()
+			metas[i].PID = nil
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	data, err = json.MarshalIndent(metas, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// loadImportedKV sets the KV entries ImportState left in dataDir in kv,
+// and removes the file. Expired entries are dropped.
+func loadImportedKV(dataDir string, kv *session.KVStore) {
+	path := filepath.Join(dataDir, stateKVFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var records []kvRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		slog.Error("failed to read imported KV entries", "path", path, "err", err)
+		return
+	}
+	loaded := 0
+	for _, r := range records {
+		var ttl time.Duration
+		if r.ExpiresAt != nil {
+			if ttl = time.Until(*r.ExpiresAt); ttl <= 0 {
+				continue
+			}
+		}
+		kv.Set(r.Namespace, r.Key, r.Value, ttl)
+		loaded++
+	}
+	if err := os.Remove(path); err != nil {
+		slog.Warn("failed to remove imported KV entries", "path", path, "err", err)
+	}
+	slog.Info("loaded imported KV entries", "count", loaded)
+}
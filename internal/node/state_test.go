@@ -0,0 +1,111 @@
+package node
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExportImportState(t *testing.T) {
+	oldDir := t.TempDir()
+	pid := uint32(os.Getpid())
+	metas, _ := json.Marshal([]session.SessionMeta{
+		{ID: 1, Prompt: "make", WorkingDir: "/src/app", Status: "completed (0)"},
+		{ID: 2, Prompt: "claude", WorkingDir: filepath.Join(oldDir, "worktrees", "app-x"), Status: "running", PID: &pid},
+	})
+	writeFiles(t, oldDir, map[string]string{
+		"sessions.json":             string(metas),
+		"config.toml":               "relay_url = \"https://relay.example.com\"\nrelay_token = \"secret\"\n\n[archive]\ndir = \"" + filepath.Join(oldDir, "archive") + "\"\n",
+		"token":                     "node-token",
+		"sessions/1/output.log":     "built\n",
+		"sessions/1/messages.jsonl": "{}\n",
+		"archive/3-x.tar.gz":        "archived",
+		"codewire.pid":              "123",
+		"node.log":                  "{}\n",
+		"worktrees/app-x/main.go":   "package main",
+	})
+	kv := session.NewKVStore()
+	kv.Set("ci", "last-build", []byte("ok"), 0)
+	kv.Set("ci", "lock", []byte("held"), time.Hour)
+
+	export := filepath.Join(t.TempDir(), "state.tar.zst")
+	manifest, err := ExportState(oldDir, export, kv)
+	if err != nil {
+		t.Fatalf("ExportState: %v", err)
+	}
+	if manifest.Files != 6 || manifest.KVEntries != 2 {
+		t.Errorf("manifest = %+v, want 6 files and 2 KV entries", manifest)
+	}
+	if read, err := ReadStateManifest(export); err != nil || read.DataDir != oldDir {
+		t.Errorf("ReadStateManifest = %+v, %v", read, err)
+	}
+
+	newDir := filepath.Join(t.TempDir(), "codewire")
+	if _, err := ImportState(ImportOptions{Input: export, DataDir: newDir}); err != nil {
+		t.Fatalf("ImportState: %v", err)
+	}
+	for _, skipped := range []string{"codewire.pid", "node.log", "worktrees"} {
+		if _, err := os.Stat(filepath.Join(newDir, skipped)); !os.IsNotExist(err) {
+			t.Errorf("%s was imported", skipped)
+		}
+	}
+	if out, _ := os.ReadFile(filepath.Join(newDir, "sessions", "1", "output.log")); string(out) != "built\n" {
+		t.Errorf("output.log = %q", out)
+	}
+	if fi, err := os.Stat(filepath.Join(newDir, "token")); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("token = %v, %v; want mode 0600", fi, err)
+	}
+	cfg, _ := os.ReadFile(filepath.Join(newDir, "config.toml"))
+	if !strings.Contains(string(cfg), `relay_token = "secret"`) || !strings.Contains(string(cfg), filepath.Join(newDir, "archive")) {
+		t.Errorf("config.toml = %s", cfg)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(newDir, "sessions.json"))
+	var imported []session.SessionMeta
+	if err := json.Unmarshal(data, &imported); err != nil || len(imported) != 2 {
+		t.Fatalf("sessions.json = %s, %v", data, err)
+	}
+	if imported[0].Status != "completed (0)" || imported[0].WorkingDir != "/src/app" {
+		t.Errorf("session 1 = %+v", imported[0])
+	}
+	if imported[1].Status != "killed" || imported[1].PID != nil || imported[1].WorkingDir != filepath.Join(newDir, "worktrees", "app-x") {
+		t.Errorf("session 2 = %+v, want it killed, in the new data dir", imported[1])
+	}
+
+	loaded := session.NewKVStore()
+	loadImportedKV(newDir, loaded)
+	if got := loaded.Get("ci", "last-build"); string(got) != "ok" {
+		t.Errorf("imported KV entry = %q", got)
+	}
+	if entries := loaded.List("ci", "lock"); len(entries) != 1 || entries[0].ExpiresAt == nil {
+		t.Errorf("imported KV entry with TTL = %+v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(newDir, stateKVFile)); !os.IsNotExist(err) {
+		t.Error("kv.json left behind after loading")
+	}
+
+	if _, err := ImportState(ImportOptions{Input: export, DataDir: newDir}); err == nil {
+		t.Error("imported over existing state without Force")
+	}
+	if _, err := ImportState(ImportOptions{Input: export, DataDir: newDir, Force: true}); err != nil {
+		t.Errorf("ImportState with Force: %v", err)
+	}
+}
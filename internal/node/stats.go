@@ -0,0 +1,35 @@
+package node
+
+import (
+	"time"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+// handleStats serves cw stats: the stats of session req.ID, or without an
+// ID those of every session created since req.Since.
+func handleStats(writer connection.FrameWriter, manager *session.SessionManager, req protocol.Request) {
+	var stats []protocol.SessionStats
+	if req.ID != nil {
+		st, err := manager.Stats(*req.ID)
+		if err != nil {
+			_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: err.Error()})
+			return
+		}
+		stats = []protocol.SessionStats{st}
+	} else {
+		var since time.Time
+		if req.Since != "" {
+			t, err := time.Parse(time.RFC3339Nano, req.Since)
+			if err != nil {
+				_ = writer.SendResponse(&protocol.Response{Type: "Error", Message: "invalid since time: " + req.Since})
+				return
+			}
+			since = t
+		}
+		stats = manager.AllStats(since)
+	}
+	_ = writer.SendResponse(&protocol.Response{Type: "SessionStats", Stats: &stats})
+}
@@ -0,0 +1,91 @@
+package node
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/codewiresh/codewire/internal/config"
+)
+
+// wsTLSConfig returns the TLS configuration for the WebSocket listener, or
+// nil to serve it unencrypted.
+func wsTLSConfig(dataDir string, cfg config.NodeConfig) (*tls.Config, error) {
+	if len(cfg.TLSACMEDomains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSACMEDomains...),
+			Cache:      autocert.DirCache(filepath.Join(dataDir, "acme")),
+			Email:      cfg.TLSACMEEmail,
+		}
+		return m.TLSConfig(), nil
+	}
+	if cfg.TLSCert == "" {
+		return nil, nil
+	}
+	r := &certReloader{certPath: cfg.TLSCert, keyPath: cfg.TLSKey}
+	// Fail at startup rather than on the first handshake.
+	if _, err := r.getCertificate(nil); err != nil {
+		return nil, err
+	}
+	return &tls.Config{GetCertificate: r.getCertificate, MinVersion: tls.VersionTLS12}, nil
+}
+
+// certReloader serves a certificate from PEM files, reloading it when the
+// files change so renewals need no restart.
+type certReloader struct {
+	certPath, keyPath string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var modTime time.Time
+	for _, path := range []string{r.certPath, r.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return r.keep(err)
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cert != nil && !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		if r.cert != nil {
+			// Likely caught between writing the two files; retry next time.
+			slog.Warn("reloading tls certificate", "err", err)
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("loading tls certificate: %w", err)
+	}
+	if r.cert != nil {
+		slog.Info("reloaded tls certificate", "cert", r.certPath)
+	}
+	r.cert, r.modTime = &cert, modTime
+	return r.cert, nil
+}
+
+// keep returns the current certificate when the files cannot be read.
+func (r *certReloader) keep(err error) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cert != nil {
+		return r.cert, nil
+	}
+	return nil, fmt.Errorf("loading tls certificate: %w", err)
+}
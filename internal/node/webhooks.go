@@ -0,0 +1,235 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+const (
+	// webhookReloadInterval is how often config.toml is checked for webhook
+	// changes, so `cw webhook add` takes effect without a node restart.
+	webhookReloadInterval = 2 * time.Second
+	// webhookAttempts is the number of delivery attempts per event.
+	webhookAttempts = 4
+	// webhookQueueSize bounds each webhook's pending deliveries.
+	webhookQueueSize = 256
+)
+
+// WebhookPayload is the JSON body POSTed to a webhook.
+type WebhookPayload struct {
+	Node        string          `json:"node"`
+	SessionID   uint32          `json:"session_id"`
+	SessionName string          `json:"session_name,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	Event       string          `json:"event"`
+	Timestamp   string          `json:"timestamp"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// SignWebhookPayload returns the X-Codewire-Signature header value for body.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDispatcher delivers session events to the webhooks configured in
+// config.toml. Each webhook has its own subscription and delivery goroutine,
+// so a slow endpoint only delays its own events.
+type webhookDispatcher struct {
+	dataDir  string
+	nodeName string
+	manager  *session.SessionManager
+	client   *http.Client
+
+	hooks   []config.Webhook
+	cancels []context.CancelFunc
+	modTime time.Time
+}
+
+func newWebhookDispatcher(dataDir, nodeName string, manager *session.SessionManager) *webhookDispatcher {
+	return &webhookDispatcher{
+		dataDir:  dataDir,
+		nodeName: nodeName,
+		manager:  manager,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// run starts the configured webhooks and reloads them whenever config.toml
+// changes, until ctx is cancelled.
+func (d *webhookDispatcher) run(ctx context.Context) {
+	d.reload(ctx)
+	ticker := time.NewTicker(webhookReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			d.stop()
+			return
+		case <-ticker.C:
+			d.reload(ctx)
+		}
+	}
+}
+
+func (d *webhookDispatcher) reload(ctx context.Context) {
+	var modTime time.Time
+	if fi, err := os.Stat(filepath.Join(d.dataDir, "config.toml")); err == nil {
+		modTime = fi.ModTime()
+	}
+	if !d.modTime.IsZero() && modTime.Equal(d.modTime) {
+		return
+	}
+	d.modTime = modTime
+
+	cfg, err := config.LoadConfig(d.dataDir)
+	if err != nil {
+		slog.Error("webhooks: reloading config", "err", err)
+		return
+	}
+	if reflect.DeepEqual(cfg.Webhooks, d.hooks) {
+		return
+	}
+
+	d.stop()
+	d.hooks = cfg.Webhooks
+	for _, hook := range d.hooks {
+		hookCtx, cancel := context.WithCancel(ctx)
+		d.cancels = append(d.cancels, cancel)
+		go d.serve(hookCtx, hook)
+	}
+	if len(d.hooks) > 0 {
+		slog.Info("webhooks loaded", "count", len(d.hooks))
+	}
+}
+
+func (d *webhookDispatcher) stop() {
+	for _, cancel := range d.cancels {
+		cancel()
+	}
+	d.cancels = nil
+}
+
+// serve subscribes to hook's events and delivers them until ctx is cancelled.
+func (d *webhookDispatcher) serve(ctx context.Context, hook config.Webhook) {
+	var eventTypes []session.EventType
+	for _, e := range hook.Events {
+		eventTypes = append(eventTypes, session.EventType(e))
+	}
+	sub := d.manager.Subscriptions.Subscribe(nil, hook.Tags, nil, eventTypes)
+	defer d.manager.Subscriptions.Unsubscribe(sub.ID)
+
+	// Deliveries run on their own goroutine so retries do not block the
+	// subscription, which drops events when its buffer is full.
+	queue := make(chan WebhookPayload, webhookQueueSize)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case p := <-queue:
+				d.deliver(ctx, hook, p)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case se, ok := <-sub.Ch:
+			if !ok {
+				return
+			}
+			p := d.payload(se)
+			select {
+			case queue <- p:
+			default:
+				slog.Warn("webhook queue full, dropping event", "url", hook.URL, "event", p.Event)
+			}
+		}
+	}
+}
+
+func (d *webhookDispatcher) payload(se session.SessionEvent) WebhookPayload {
+	p := WebhookPayload{
+		Node:      d.nodeName,
+		SessionID: se.SessionID,
+		Event:     string(se.Event.Type),
+		Timestamp: se.Event.Timestamp.Format(time.RFC3339Nano),
+		Data:      se.Event.Data,
+	}
+	if info, _, err := d.manager.GetStatus(se.SessionID); err == nil {
+		p.SessionName = info.Name
+		p.Tags = info.Tags
+	}
+	return p
+}
+
+// deliver POSTs p to hook, retrying with exponential backoff on network
+// errors and 5xx/429 responses.
+func (d *webhookDispatcher) deliver(ctx context.Context, hook config.Webhook, p WebhookPayload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+
+	backoff := time.Second
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		retry, err := d.post(ctx, hook, p.Event, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == webhookAttempts {
+			slog.Warn("webhook delivery failed", "url", hook.URL, "event", p.Event, "attempts", attempt, "err", err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends one delivery attempt. It reports whether a failure is worth
+// retrying.
+func (d *webhookDispatcher) post(ctx context.Context, hook config.Webhook, event string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "codewire-webhook")
+	req.Header.Set("X-Codewire-Event", event)
+	if hook.Secret != "" {
+		req.Header.Set("X-Codewire-Signature", SignWebhookPayload(hook.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("status %d", resp.StatusCode)
+}
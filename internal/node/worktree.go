@@ -0,0 +1,33 @@
+package node
+
+import (
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+// handleWorktree serves the cw worktree commands for the worktrees that
+// cw run --worktree creates.
+func handleWorktree(writer connection.FrameWriter, manager *session.SessionManager, req protocol.Request) {
+	var (
+		resp *protocol.Response
+		err  error
+	)
+	switch req.Type {
+	case "WorktreeMerge":
+		var into string
+		into, err = manager.MergeWorktree(req.Name)
+		resp = &protocol.Response{Type: "WorktreeMerged", Name: req.Name, Message: into}
+	case "WorktreeRemove":
+		err = manager.RemoveWorktree(req.Name, req.Force)
+		resp = &protocol.Response{Type: "WorktreeRemoved", Name: req.Name}
+	default:
+		var worktrees []protocol.Worktree
+		worktrees, err = manager.Worktrees()
+		resp = &protocol.Response{Type: "Worktrees", Worktrees: &worktrees}
+	}
+	if err != nil {
+		resp = &protocol.Response{Type: "Error", Message: err.Error()}
+	}
+	_ = writer.SendResponse(resp)
+}
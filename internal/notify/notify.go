@@ -0,0 +1,142 @@
+// Package notify delivers short notifications to people: desktop alerts, ntfy
+// topics, chat webhooks, or an arbitrary command.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Notification is a titled message.
+type Notification struct {
+	Title string
+	Body  string
+}
+
+// Notifier delivers notifications.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// Methods lists the accepted method formats, for help text and errors.
+const Methods = "macos, ntfy:<url>, slack:<url>, discord:<url>, command:<cmd>"
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Parse returns the notifier for method:
+//
+//	macos           macOS Notification Center (osascript)
+//	ntfy:<url>      POST to an ntfy topic URL
+//	slack:<url>     Slack incoming webhook
+//	discord:<url>   Discord webhook
+//	command:<cmd>   run cmd with sh -c; the body is on stdin and the title and
+//	                body are in $CW_NOTIFY_TITLE and $CW_NOTIFY_BODY
+func Parse(method string) (Notifier, error) {
+	kind, arg, _ := strings.Cut(method, ":")
+	switch kind {
+	case "macos":
+		return macosNotifier{}, nil
+	case "ntfy", "slack", "discord":
+		if !strings.HasPrefix(arg, "http://") && !strings.HasPrefix(arg, "https://") {
+			return nil, fmt.Errorf("%s notify method needs a URL (%s:https://...)", kind, kind)
+		}
+		switch kind {
+		case "ntfy":
+			return ntfyNotifier{url: arg}, nil
+		case "slack":
+			return chatNotifier{url: arg, field: "text", bold: "*"}, nil
+		default:
+			return chatNotifier{url: arg, field: "content", bold: "**"}, nil
+		}
+	case "command":
+		if strings.TrimSpace(arg) == "" {
+			return nil, fmt.Errorf("command notify method needs a command (command:<cmd>)")
+		}
+		return commandNotifier{command: arg}, nil
+	}
+	return nil, fmt.Errorf("unknown notify method %q (use %s)", method, Methods)
+}
+
+type macosNotifier struct{}
+
+func (macosNotifier) Notify(n Notification) error {
+	script := fmt.Sprintf("display notification %q with title %q", n.Body, n.Title)
+	if out, err := exec.Command("osascript", "-e", script).CombinedOutput(); err != nil {
+		return fmt.Errorf("osascript: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+type ntfyNotifier struct {
+	url string
+}
+
+func (t ntfyNotifier) Notify(n Notification) error {
+	req, err := http.NewRequest(http.MethodPost, t.url, strings.NewReader(n.Body))
+	if err != nil {
+		return err
+	}
+	if n.Title != "" {
+		req.Header.Set("Title", n.Title)
+	}
+	return send(req)
+}
+
+// chatNotifier posts to a Slack or Discord webhook, which differ only in the
+// JSON field holding the message and their bold markup.
+type chatNotifier struct {
+	url   string
+	field string
+	bold  string
+}
+
+func (c chatNotifier) Notify(n Notification) error {
+	text := n.Body
+	if n.Title != "" {
+		text = fmt.Sprintf("%s%s%s\n```%s```", c.bold, n.Title, c.bold, n.Body)
+	}
+	data, _ := json.Marshal(map[string]string{c.field: text})
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return send(req)
+}
+
+type commandNotifier struct {
+	command string
+}
+
+func (c commandNotifier) Notify(n Notification) error {
+	cmd := exec.Command("sh", "-c", c.command)
+	cmd.Stdin = strings.NewReader(n.Body)
+	cmd.Env = append(os.Environ(),
+		"CW_NOTIFY_TITLE="+n.Title,
+		"CW_NOTIFY_BODY="+n.Body,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notify command: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func send(req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
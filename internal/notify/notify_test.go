@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, method := range []string{"", "email", "ntfy", "ntfy:not-a-url", "slack:", "command:", "command:   "} {
+		if _, err := Parse(method); err == nil {
+			t.Errorf("Parse(%q): expected error", method)
+		}
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	var title, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		title, body = r.Header.Get("Title"), string(data)
+	}))
+	defer srv.Close()
+
+	n, err := Parse("ntfy:" + srv.URL + "/topic")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := n.Notify(Notification{Title: "build done", Body: "ok"}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if title != "build done" || body != "ok" {
+		t.Fatalf("got title %q body %q", title, body)
+	}
+}
+
+func TestSlackAndStatusError(t *testing.T) {
+	var payload map[string]string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	n, err := Parse("slack:" + srv.URL)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := n.Notify(Notification{Title: "t", Body: "b"}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if !strings.HasPrefix(payload["text"], "*t*") {
+		t.Fatalf("unexpected slack text %q", payload["text"])
+	}
+
+	status = http.StatusBadGateway
+	if err := n.Notify(Notification{Title: "t", Body: "b"}); err == nil {
+		t.Fatal("expected error for 502 response")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	n, err := Parse(`command:echo "$CW_NOTIFY_TITLE" > ` + out + `; cat >> ` + out)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := n.Notify(Notification{Title: "session 1 exited", Body: "last line"}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "session 1 exited\nlast line" {
+		t.Fatalf("unexpected command output %q", got)
+	}
+}
@@ -38,6 +38,12 @@ func GetAuth(ctx context.Context) *AuthIdentity {
 	return id
 }
 
+// WithAuth returns a copy of ctx carrying id, for other authentication
+// schemes to hand handlers the identity GetAuth returns.
+func WithAuth(ctx context.Context, id *AuthIdentity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
 // GenerateSessionToken returns a session token with the format sess_ + 32 random
 // alphanumeric characters (~190 bits of entropy).
 func GenerateSessionToken() string {
@@ -70,8 +76,7 @@ func RequireAuth(st store.Store, adminToken string) func(http.Handler) http.Hand
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), contextKey{}, identity)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(WithAuth(r.Context(), identity)))
 		})
 	}
 }
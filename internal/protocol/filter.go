@@ -0,0 +1,526 @@
+package protocol
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter is a parsed event filter expression, evaluated against each event
+// on the node so that subscribers are only sent what they ask for. A nil
+// Filter matches everything.
+//
+// An expression compares fields of the event with literals:
+//
+//	event                    the event type, e.g. "session.status"
+//	session                  the session ID
+//	tags                     the session's tags
+//	labels.<key>             a session label
+//	data.<field>[.<field>]   a field of the event's data
+//
+// Literals are strings ("..." with Go escapes, or raw '...'), numbers,
+// true, false, null and lists ([...]). The operators are == != < <= > >=,
+// =~ (matches a Go regular expression), in (an element of a list, a
+// substring of a string or a key of an object), ! && || and parentheses. A
+// missing field is null. Any other value is true unless it is false, 0, "",
+// or an empty list or object.
+//
+//	event == "session.status" && data.to == "completed" && "build" in tags
+type Filter struct {
+	src      string
+	root     filterNode
+	usesData bool
+}
+
+// FilterEvent is what a Filter is evaluated against.
+type FilterEvent struct {
+	Type    string
+	Session uint32
+	Tags    []string
+	Labels  map[string]string
+	Data    json.RawMessage
+}
+
+// ParseFilter parses a filter expression. An empty expression returns a
+// nil Filter.
+func ParseFilter(s string) (*Filter, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	toks, err := lexFilter(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	p := &filterParser{toks: toks}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.errorf("unexpected %s", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return &Filter{src: s, root: root, usesData: p.usesData}, nil
+}
+
+// String returns the expression f was parsed from.
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.src
+}
+
+// Match reports whether ev satisfies f.
+func (f *Filter) Match(ev FilterEvent) bool {
+	if f == nil {
+		return true
+	}
+	env := &filterEnv{ev: ev}
+	if f.usesData && len(ev.Data) > 0 {
+		// Undecodable data is null.
+		_ = json.Unmarshal(ev.Data, &env.data)
+	}
+	return truthy(f.root.eval(env))
+}
+
+// --- Lexer ---
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type filterToken struct {
+	kind tokKind
+	text string // identifier, operator or number as written; string contents
+	pos  int
+}
+
+func (t filterToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// filterOps lists the operators, longest first so that "==" is not lexed as
+// two "=".
+var filterOps = []string{"==", "!=", "<=", ">=", "=~", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+func lexFilter(s string) ([]filterToken, error) {
+	var toks []filterToken
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'':
+			// Single-quoted strings are raw, handy for regular expressions.
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			toks = append(toks, filterToken{tokString, s[i+1 : i+1+end], i})
+			i += end + 2
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d", i)
+			}
+			toks = append(toks, filterToken{tokString, text, i})
+			i = end + 1
+		case c == '-' || c >= '0' && c <= '9':
+			end := i + 1
+			for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' || s[end] == 'e' || s[end] == 'E') {
+				end++
+			}
+			if _, err := strconv.ParseFloat(s[i:end], 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q at offset %d", s[i:end], i)
+			}
+			toks = append(toks, filterToken{tokNumber, s[i:end], i})
+			i = end
+		case c == '_' || unicode.IsLetter(c):
+			end := i + 1
+			for end < len(s) && (s[end] == '_' || s[end] == '-' || unicode.IsLetter(rune(s[end])) || unicode.IsDigit(rune(s[end]))) {
+				end++
+			}
+			toks = append(toks, filterToken{tokIdent, s[i:end], i})
+			i = end
+		default:
+			op := ""
+			for _, o := range filterOps {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			toks = append(toks, filterToken{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, filterToken{kind: tokEOF, pos: len(s)}), nil
+}
+
+// --- Parser ---
+
+type filterParser struct {
+	toks     []filterToken
+	pos      int
+	usesData bool
+}
+
+func (p *filterParser) peek() filterToken { return p.toks[p.pos] }
+
+func (p *filterParser) next() filterToken {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the operator or keyword op.
+func (p *filterParser) accept(op string) bool {
+	if t := p.peek(); (t.kind == tokOp || t.kind == tokIdent) && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) errorf(format string, args ...any) error {
+	return p.errorAt(p.peek(), format, args...)
+}
+
+func (p *filterParser) errorAt(t filterToken, format string, args ...any) error {
+	return fmt.Errorf("%s at offset %d", fmt.Sprintf(format, args...), t.pos)
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = orNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = andNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.accept("!") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *filterParser) parseCompare() (filterNode, error) {
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			r, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return compareNode{op, l, r}, nil
+		}
+	}
+	if p.accept("=~") {
+		t := p.next()
+		if t.kind != tokString {
+			return nil, p.errorAt(t, "=~ needs a string, got %s", t)
+		}
+		re, err := regexp.Compile(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", t.text, err)
+		}
+		return matchNode{l, re}, nil
+	}
+	return l, nil
+}
+
+// filterRoots are the event fields an expression can refer to.
+var filterRoots = []string{"event", "session", "tags", "labels", "data"}
+
+func (p *filterParser) parseOperand() (filterNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return literalNode{t.text}, nil
+	case tokNumber:
+		f, _ := strconv.ParseFloat(t.text, 64)
+		return literalNode{f}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept(")") {
+				return nil, p.errorf("expected ), got %s", p.peek())
+			}
+			return x, nil
+		case "[":
+			var items []filterNode
+			for !p.accept("]") {
+				if len(items) > 0 && !p.accept(",") {
+					return nil, p.errorf("expected , or ], got %s", p.peek())
+				}
+				x, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, x)
+			}
+			return listNode{items}, nil
+		}
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		case "null":
+			return literalNode{nil}, nil
+		}
+		found := false
+		for _, root := range filterRoots {
+			found = found || t.text == root
+		}
+		if !found {
+			return nil, p.errorAt(t, "unknown field %q (want %s)", t.text, strings.Join(filterRoots, ", "))
+		}
+		path := pathNode{root: t.text}
+		for p.accept(".") {
+			key := p.next()
+			if key.kind != tokIdent {
+				return nil, p.errorAt(key, "expected a field name after ., got %s", key)
+			}
+			path.keys = append(path.keys, key.text)
+		}
+		if path.root == "data" {
+			p.usesData = true
+		}
+		return path, nil
+	}
+	return nil, p.errorAt(t, "unexpected %s", t)
+}
+
+// --- Evaluation ---
+
+// filterEnv holds the event being matched. Values are those of decoded
+// JSON: nil, bool, float64, string, []any and map[string]any.
+type filterEnv struct {
+	ev   FilterEvent
+	data any
+}
+
+type filterNode interface {
+	eval(env *filterEnv) any
+}
+
+type literalNode struct{ v any }
+
+func (n literalNode) eval(*filterEnv) any { return n.v }
+
+type listNode struct{ items []filterNode }
+
+func (n listNode) eval(env *filterEnv) any {
+	list := make([]any, len(n.items))
+	for i, x := range n.items {
+		list[i] = x.eval(env)
+	}
+	return list
+}
+
+type pathNode struct {
+	root string
+	keys []string
+}
+
+func (n pathNode) eval(env *filterEnv) any {
+	var v any
+	switch n.root {
+	case "event":
+		v = env.ev.Type
+	case "session":
+		v = float64(env.ev.Session)
+	case "tags":
+		tags := make([]any, len(env.ev.Tags))
+		for i, t := range env.ev.Tags {
+			tags[i] = t
+		}
+		v = tags
+	case "labels":
+		labels := make(map[string]any, len(env.ev.Labels))
+		for k, l := range env.ev.Labels {
+			labels[k] = l
+		}
+		v = labels
+	case "data":
+		v = env.data
+	}
+	for _, key := range n.keys {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	return v
+}
+
+type notNode struct{ x filterNode }
+
+func (n notNode) eval(env *filterEnv) any { return !truthy(n.x.eval(env)) }
+
+type andNode struct{ l, r filterNode }
+
+func (n andNode) eval(env *filterEnv) any { return truthy(n.l.eval(env)) && truthy(n.r.eval(env)) }
+
+type orNode struct{ l, r filterNode }
+
+func (n orNode) eval(env *filterEnv) any { return truthy(n.l.eval(env)) || truthy(n.r.eval(env)) }
+
+type matchNode struct {
+	x  filterNode
+	re *regexp.Regexp
+}
+
+func (n matchNode) eval(env *filterEnv) any {
+	s, ok := n.x.eval(env).(string)
+	return ok && n.re.MatchString(s)
+}
+
+type compareNode struct {
+	op   string
+	l, r filterNode
+}
+
+func (n compareNode) eval(env *filterEnv) any {
+	l, r := n.l.eval(env), n.r.eval(env)
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(l, r)
+	case "!=":
+		return !reflect.DeepEqual(l, r)
+	case "in":
+		switch r := r.(type) {
+		case []any:
+			for _, x := range r {
+				if reflect.DeepEqual(l, x) {
+					return true
+				}
+			}
+		case string:
+			s, ok := l.(string)
+			return ok && strings.Contains(r, s)
+		case map[string]any:
+			s, ok := l.(string)
+			_, found := r[s]
+			return ok && found
+		}
+		return false
+	}
+
+	// Ordering compares two numbers or two strings.
+	var c int
+	switch l := l.(type) {
+	case float64:
+		r, ok := r.(float64)
+		if !ok {
+			return false
+		}
+		c = cmp.Compare(l, r)
+	case string:
+		r, ok := r.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(l, r)
+	default:
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// truthy reports whether v counts as true.
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	ev := FilterEvent{
+		Type:    "session.status",
+		Session: 7,
+		Tags:    []string{"build", "nightly"},
+		Labels:  map[string]string{"repo": "webapp"},
+		Data:    []byte(`{"from": "running", "to": "completed", "exit_code": 2, "git": {"branch": "main"}, "truncated": false}`),
+	}
+	for _, tc := range []struct {
+		filter string
+		want   bool
+	}{
+		{"", true},
+		{`event == "session.status"`, true},
+		{`event == 'session.alert'`, false},
+		{`event == "session.status" && data.to == "completed" && "build" in tags`, true},
+		{`event == "session.status" && "deploy" in tags`, false},
+		{`"deploy" in tags || session == 7`, true},
+		{`session != 7`, false},
+		{`data.exit_code != 0`, true},
+		{`data.exit_code >= 2 && data.exit_code < 3`, true},
+		{`data.exit_code > 2`, false},
+		{`data.exit_code > "2"`, false},
+		{`data.git.branch == "main"`, true},
+		{`data.git.branch.name == null`, true},
+		{`data.missing == null && !data.missing`, true},
+		{`data.truncated`, false},
+		{`!data.truncated`, true},
+		{`data.to`, true},
+		{`labels.repo == "webapp" && !labels.owner`, true},
+		{`"repo" in labels`, true},
+		{`"comp" in data.to`, true},
+		{`event in ["session.status", "session.alert"]`, true},
+		{`data.to =~ '^comp'`, true},
+		{`data.to =~ "^run"`, false},
+		{`event =~ '^session\.'`, true},
+		{`data.exit_code =~ "2"`, false},
+		{`!(event == "session.status" && session == 7)`, false},
+		{`event == "session.alert" || (session == 7 && "nightly" in tags)`, true},
+		{`data.from < data.to`, false},
+		{`tags == ["build", "nightly"]`, true},
+	} {
+		f, err := ParseFilter(tc.filter)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", tc.filter, err)
+		}
+		if got := f.Match(ev); got != tc.want {
+			t.Errorf("%s: Match = %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, tc := range []struct {
+		filter string
+		err    string
+	}{
+		{`status == "completed"`, `unknown field "status"`},
+		{`event ==`, "unexpected end of filter"},
+		{`event == "session.status" &&`, "unexpected end of filter"},
+		{`(event == "x"`, "expected )"},
+		{`event == "x`, "unterminated string"},
+		{`event = "x"`, `unexpected '='`},
+		{`event =~ 3`, "=~ needs a string"},
+		{`event =~ "("`, "invalid regular expression"},
+		{`data.`, "expected a field name"},
+		{`event == "x" session`, `unexpected "session"`},
+		{`event in ["a" "b"]`, "expected , or ]"},
+	} {
+		_, err := ParseFilter(tc.filter)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("ParseFilter(%q) = %v, want an error containing %q", tc.filter, err, tc.err)
+		}
+	}
+}
@@ -10,20 +10,116 @@ type SessionInfo struct {
 	WorkingDir        string  `json:"working_dir"`
 	CreatedAt         string  `json:"created_at"`
 	Status            string  `json:"status"`
+	Activity          string  `json:"activity,omitempty"` // running sessions: active, idle or awaiting-input
 	Attached          bool    `json:"attached"`
 	PID               *uint32 `json:"pid,omitempty"`
 	OutputSizeBytes   *uint64 `json:"output_size_bytes,omitempty"`
 	LastOutputSnippet *string `json:"last_output_snippet,omitempty"`
 
 	// Enriched fields (new — backward compatible via omitempty).
-	Tags          []string `json:"tags,omitempty"`
-	ExitCode      *int     `json:"exit_code,omitempty"`
-	CompletedAt   *string  `json:"completed_at,omitempty"`
-	DurationMs    *int64   `json:"duration_ms,omitempty"`
-	OutputLines   *uint64  `json:"output_lines,omitempty"`
-	OutputBytes   *uint64  `json:"output_bytes,omitempty"`
-	LastOutputAt  *string  `json:"last_output_at,omitempty"`
-	AttachedCount int32    `json:"attached_count"`
+	Tags []string `json:"tags,omitempty"`
+	// Labels are key=value metadata given at launch (cw run --label).
+	Labels        map[string]string `json:"labels,omitempty"`
+	ExitCode      *int              `json:"exit_code,omitempty"`
+	ExitReason    string            `json:"exit_reason,omitempty"` // abnormal end reported by the backend, e.g. OOMKilled
+	CompletedAt   *string           `json:"completed_at,omitempty"`
+	DurationMs    *int64            `json:"duration_ms,omitempty"`
+	OutputLines   *uint64           `json:"output_lines,omitempty"`
+	OutputBytes   *uint64           `json:"output_bytes,omitempty"`
+	LastOutputAt  *string           `json:"last_output_at,omitempty"`
+	AttachedCount int32             `json:"attached_count"`
+	Budget        *Budget           `json:"budget,omitempty"`
+	Pool          string            `json:"pool,omitempty"`
+	Adopted       bool              `json:"adopted,omitempty"`  // taken over after a node restart; no terminal
+	Git           *GitInfo          `json:"git,omitempty"`      // set when WorkingDir is in a git repository
+	Worktree      string            `json:"worktree,omitempty"` // cw run --worktree name
+	Backend       string            `json:"backend,omitempty"`  // empty for local sessions
+	// BackendState is what the backend keeps for the session, such as its
+	// container's name.
+	BackendState map[string]string `json:"backend_state,omitempty"`
+	// Resources is sampled by the node for GetStatus of a running local
+	// session.
+	Resources *ResourceUsage `json:"resources,omitempty"`
+	// Summary is the latest summary of the session's output (see the
+	// session.output_summary event).
+	Summary *OutputSummary `json:"summary,omitempty"`
+	// AcceptInputFrom is the session's input policy, empty if anyone may
+	// send it input, messages and requests.
+	AcceptInputFrom []string `json:"accept_input_from,omitempty"`
+	// Usage is what the session's agent has reported using, if it runs a
+	// known agent CLI.
+	Usage *Usage `json:"usage,omitempty"`
+	// AgentSessionID is the Claude Code session the session runs, which
+	// cw resume continues, and TranscriptPath its transcript, if known.
+	AgentSessionID string `json:"agent_session_id,omitempty"`
+	TranscriptPath string `json:"transcript_path,omitempty"`
+}
+
+// OutputSummary summarizes a stretch of a session's output.
+type OutputSummary struct {
+	At      string   `json:"at"`                // RFC 3339
+	Summary string   `json:"summary,omitempty"` // from the node's summarizer command, if configured
+	Lines   []string `json:"lines,omitempty"`   // last non-blank lines, ANSI stripped
+	Errors  []string `json:"errors,omitempty"`  // lines that look like errors
+}
+
+// ResourceUsage is what a session's processes use: the process the session
+// started, its descendants, and anything else in its process session.
+type ResourceUsage struct {
+	CPUPercent float64 `json:"cpu_percent"` // 100 is one core fully busy
+	RSSBytes   uint64  `json:"rss_bytes"`
+	OpenFiles  int     `json:"open_files,omitempty"` // zero where the node cannot count them
+	// Processes lists the session's processes, each after its parent.
+	Processes []ProcessInfo `json:"processes,omitempty"`
+}
+
+// ProcessInfo describes one process of a session.
+type ProcessInfo struct {
+	PID        uint32  `json:"pid"`
+	PPID       uint32  `json:"ppid"`
+	Command    string  `json:"command"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSSBytes   uint64  `json:"rss_bytes"`
+	OpenFiles  int     `json:"open_files,omitempty"`
+}
+
+// GitInfo describes the git repository a session's working directory is in.
+type GitInfo struct {
+	Branch   string `json:"branch,omitempty"` // empty when HEAD is detached
+	Commit   string `json:"commit,omitempty"` // abbreviated HEAD commit
+	Dirty    bool   `json:"dirty"`
+	Changed  int    `json:"changed,omitempty"` // files with uncommitted changes, untracked included
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead,omitempty"`
+	Behind   int    `json:"behind,omitempty"`
+}
+
+// Budget caps an agent's tool usage within a session, enforced by cw hook.
+// Zero fields are unlimited.
+type Budget struct {
+	Tools  int `json:"tools,omitempty" toml:"tools"`   // tool calls per rolling hour
+	Bash   int `json:"bash,omitempty" toml:"bash"`     // total Bash invocations
+	Writes int `json:"writes,omitempty" toml:"writes"` // total file writes (Edit, Write, MultiEdit, NotebookEdit)
+	// Cost is the most the session's agent may spend, in US dollars, as
+	// its usage extractor reads it (see Usage).
+	Cost float64 `json:"cost,omitempty" toml:"cost"`
+}
+
+// Usage is the token usage and cost an agent CLI running in a session
+// reported, as read from its output by the node's usage extractor for it
+// (Agent).
+type Usage struct {
+	Agent        string  `json:"agent"`
+	InputTokens  int64   `json:"input_tokens,omitempty"`
+	OutputTokens int64   `json:"output_tokens,omitempty"`
+	CostUSD      float64 `json:"cost_usd,omitempty"`
+}
+
+// AutoRespondRule types Response, followed by Enter, into a session whenever
+// the end of its output matches Pattern, a Go regular expression.
+type AutoRespondRule struct {
+	Pattern  string `json:"pattern"`
+	Response string `json:"response"`
 }
 
 // Request is the union of all client-to-server control messages.
@@ -36,6 +132,8 @@ type Request struct {
 	ID             *uint32  `json:"id,omitempty"`
 	IncludeHistory *bool    `json:"include_history,omitempty"`
 	HistoryLines   *uint    `json:"history_lines,omitempty"`
+	LowLatency     bool     `json:"low_latency,omitempty"` // Attach: skip the node's output delay
+	Compression    []string `json:"compression,omitempty"` // Attach: codecs the client accepts, preferred first
 	Cols           *uint16  `json:"cols,omitempty"`
 	Rows           *uint16  `json:"rows,omitempty"`
 	Follow         *bool    `json:"follow,omitempty"`
@@ -47,19 +145,51 @@ type Request struct {
 
 	// Environment variable overrides for Launch (KEY=VALUE strings).
 	Env []string `json:"env,omitempty"`
+	// Secrets are Launch variables (KEY=VALUE) the node never writes to
+	// disk, logs or command lines.
+	Secrets []string `json:"secrets,omitempty"`
 
 	// StdinData is injected into the session's PTY after launch.
 	StdinData []byte `json:"stdin_data,omitempty"`
 
 	// StripANSI controls ANSI escape stripping in Logs responses (default: true).
 	StripANSI *bool `json:"strip_ansi,omitempty"`
+	// Sanitize is the level, none, colors or full, Logs and WatchSession
+	// clean up output at. Logs defaults to full, or none with StripANSI
+	// false; WatchSession to none.
+	Sanitize string `json:"sanitize,omitempty"`
+
+	// Since limits WatchSession history to output written at or after this
+	// RFC 3339 time, and has Subscribe first replay the journaled events
+	// published since then. Timestamps sends history chunk by chunk, each
+	// WatchUpdate carrying the time it was written.
+	Since      string `json:"since,omitempty"`
+	Timestamps bool   `json:"timestamps,omitempty"`
+	// FromSeq has Subscribe first replay the journaled events from this
+	// sequence number on (see SessionEvent.Seq).
+	FromSeq *uint64 `json:"from_seq,omitempty"`
+	// Offset resumes a WatchSession or Attach: in place of history, the
+	// node sends the session's log from this byte offset on (see
+	// Response.Offset).
+	Offset *int64 `json:"offset,omitempty"`
+	// Filter is an event filter expression for Subscribe (see
+	// ParseFilter), evaluated on the node.
+	Filter string `json:"filter,omitempty"`
 
 	// New fields for enriched protocol.
-	Tags           []string `json:"tags,omitempty"`
-	EventTypes     []string `json:"event_types,omitempty"`
-	SubscriptionID *uint64  `json:"subscription_id,omitempty"`
-	Condition      string   `json:"condition,omitempty"` // "any", "all"
-	TimeoutSeconds *uint64  `json:"timeout_seconds,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	// Labels for Launch. Selector filters the sessions of KillByTags, Wait
+	// and Subscribe by label, kubectl-style (see ParseSelector).
+	Labels         map[string]string `json:"labels,omitempty"`
+	Selector       string            `json:"selector,omitempty"`
+	EventTypes     []string          `json:"event_types,omitempty"`
+	SubscriptionID *uint64           `json:"subscription_id,omitempty"`
+	Condition      string            `json:"condition,omitempty"` // Wait: "all", "any", "success" or "any-failure"
+	TimeoutSeconds *uint64           `json:"timeout_seconds,omitempty"`
+
+	// UntilOutput makes Wait complete when a line of output matching this
+	// regular expression appears, instead of on Condition.
+	UntilOutput string `json:"until_output,omitempty"`
 
 	// KV fields.
 	Namespace string `json:"namespace,omitempty"`
@@ -73,6 +203,127 @@ type Request struct {
 	Body      string  `json:"body,omitempty"`
 	RequestID string  `json:"request_id,omitempty"`
 	Delivery  string  `json:"delivery,omitempty"`
+
+	// Budget for Launch (nil uses the node default).
+	Budget *Budget `json:"budget,omitempty"`
+
+	// AutoRespond rules for Launch, answering prompts in the session's output.
+	AutoRespond []AutoRespondRule `json:"auto_respond,omitempty"`
+
+	// Alerts for Launch: regular expressions whose matching output lines
+	// raise session.alert events, also sent to the AlertNotify notify
+	// method if set.
+	Alerts      []string `json:"alerts,omitempty"`
+	AlertNotify string   `json:"alert_notify,omitempty"`
+
+	// Redact for Launch: regular expressions masked in the session's logged
+	// and watched output.
+	Redact []string `json:"redact,omitempty"`
+
+	// AcceptInputFrom for Launch: who may send the session input, messages
+	// and requests, e.g. "tag:planners" or "none" (anyone if empty).
+	AcceptInputFrom []string `json:"accept_input_from,omitempty"`
+	// FromID is the session sending SendInput, if the caller is one.
+	FromID *uint32 `json:"from_id,omitempty"`
+
+	// NoQueue makes Launch fail instead of queueing when the node is at its
+	// concurrent session limit.
+	NoQueue bool `json:"no_queue,omitempty"`
+
+	// ReplayInput makes Fork send the new session the input session ID has
+	// received so far, instead of the StdinData it was launched with.
+	ReplayInput bool `json:"replay_input,omitempty"`
+
+	// History fields. HistoryList returns the last Limit entries (all when
+	// zero) whose command, directory, name, tags or labels contain Query;
+	// HistoryRerun launches entry Entry again, named Name.
+	Query string `json:"query,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+	Entry int    `json:"entry,omitempty"`
+
+	// Kill options (Kill, KillAll, KillByTags). Signal is a name such as
+	// "TERM" (the default); Grace is a Go duration after which SIGKILL
+	// follows; Children signals the session's whole process group.
+	Signal   string `json:"signal,omitempty"`
+	Grace    string `json:"grace,omitempty"`
+	Children bool   `json:"children,omitempty"`
+
+	// Pool limits Launch to PoolSize running sessions sharing the pool name;
+	// the rest are queued. PoolSize sets the pool's limit, or keeps the
+	// current one when zero.
+	Pool     string `json:"pool,omitempty"`
+	PoolSize int    `json:"pool_size,omitempty"`
+
+	// Token is an auth token for the node. Over the Unix socket it is only
+	// needed by local users that socket_allow_uids and socket_allow_groups do
+	// not cover, on nodes with socket_token_auth.
+	Token string `json:"token,omitempty"`
+
+	// Cron fields (CronAdd). Name, Command, WorkingDir, Env, Tags and Budget
+	// describe the job's sessions.
+	Schedule  string `json:"schedule,omitempty"`
+	MissedRun string `json:"missed_run,omitempty"` // "skip" (default), "run-once"
+
+	// File transfer fields (FileRead, FileWrite). Path is relative to the
+	// session's working directory. For FileWrite, FileName is the source's
+	// base name, used when Path is empty or a directory, and FileSize,
+	// FileMode and Checksum (hex SHA-256) describe the content that follows
+	// in FileChunk frames. ExportState writes the node's state to Path, an
+	// absolute path on the node's machine.
+	Path     string `json:"path,omitempty"`
+	FileName string `json:"file_name,omitempty"`
+	FileSize int64  `json:"file_size,omitempty"`
+	FileMode uint32 `json:"file_mode,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+
+	// Worktree runs a Launch in the named git worktree, created from
+	// WorkingDir's repository on first use. Name is the worktree for
+	// WorktreeMerge and WorktreeRemove; Force removes it even when its
+	// branch is unmerged or it has uncommitted changes.
+	Worktree string `json:"worktree,omitempty"`
+	Force    bool   `json:"force,omitempty"`
+
+	// Backend names the execution environment a Launch's command runs in,
+	// such as "docker" or "ssh", configured by BackendOptions. Empty runs it
+	// on the node's host.
+	Backend        string            `json:"backend,omitempty"`
+	BackendOptions map[string]string `json:"backend_options,omitempty"`
+
+	// Port forwarding fields (StreamOpen, StreamClose), sent after Forward.
+	// Stream names the connection; StreamOpen connects it to Host:Port on
+	// the node's side.
+	Stream uint32 `json:"stream,omitempty"`
+	Host   string `json:"host,omitempty"`
+	Port   int    `json:"port,omitempty"`
+
+	// Pipe fields. PipeAdd forwards lines of session ID's output matching
+	// Grep (every non-blank line if empty), rewritten by Replace if set,
+	// into session ToID's input. PipeRemove stops pipe Pipe.
+	Grep    string `json:"grep,omitempty"`
+	Replace string `json:"replace,omitempty"`
+	Pipe    uint32 `json:"pipe,omitempty"`
+
+	// Script is run against session ID by RunScript, as session FromID if
+	// set.
+	Script []ScriptStep `json:"script,omitempty"`
+
+	// ANSI asks Screen for lines with their colors and styles.
+	ANSI bool `json:"ansi,omitempty"`
+
+	// Archive fields. ArchiveSessions archives session ID, or with ID nil
+	// every completed session that finished before Before, an RFC 3339
+	// time. RestoreArchive restores Archive: an archive's file name, or the
+	// ID of the session it holds (the latest archive of that ID).
+	Before  string `json:"before,omitempty"`
+	Archive string `json:"archive,omitempty"`
+
+	// Agent hook fields (HookEvent).
+	HookEvent      string          `json:"hook_event,omitempty"` // "PreToolUse", "PostToolUse", "Stop"
+	ToolName       string          `json:"tool_name,omitempty"`
+	ToolInput      json.RawMessage `json:"tool_input,omitempty"`
+	ToolResponse   json.RawMessage `json:"tool_response,omitempty"`
+	AgentSessionID string          `json:"agent_session_id,omitempty"`
+	TranscriptPath string          `json:"transcript_path,omitempty"`
 }
 
 // UnmarshalJSON implements custom JSON unmarshalling for Request.
@@ -102,20 +353,44 @@ type Response struct {
 	Type       string         `json:"type"`
 	Sessions   *[]SessionInfo `json:"sessions,omitempty"`
 	ID         *uint32        `json:"id,omitempty"`
+	Name       string         `json:"name,omitempty"` // Launched, Renamed, Event (the session's)
 	Count      *uint          `json:"count,omitempty"`
 	Data       string         `json:"data,omitempty"`
 	Done       *bool          `json:"done,omitempty"`
 	Bytes      *uint          `json:"bytes,omitempty"`
 	Info       *SessionInfo   `json:"info,omitempty"`
 	OutputSize *uint64        `json:"output_size,omitempty"`
-	Status     string         `json:"status,omitempty"`
+	Status     string         `json:"status,omitempty"` // Launched: "running" or "queued"
 	Output     *string        `json:"output,omitempty"`
 	Message    string         `json:"message,omitempty"`
+	Timestamp  string         `json:"timestamp,omitempty"` // WatchUpdate: when the output was written
+
+	// Compression is the codec an Attached connection's data frames use
+	// from then on, picked from the Attach request's offer; empty for none.
+	Compression string `json:"compression,omitempty"`
+
+	// Offset is the byte offset in the session's log a WatchUpdate's
+	// output ends at, or an Attached connection's first data frame starts
+	// at; a client that loses the connection resumes from it with
+	// Request.Offset.
+	Offset *int64 `json:"offset,omitempty"`
+
+	// Met reports whether a WaitResult's condition holds; false means the
+	// sessions can no longer meet it. For UntilOutput, SessionID and Output
+	// are the session and line that matched.
+	Met *bool `json:"met,omitempty"`
 
-	// Subscribe/Event fields.
+	// Dropped is the number of bytes of output an attach or watch stream
+	// lost at this point because the client fell too far behind
+	// (OutputDropped).
+	Dropped uint64 `json:"dropped,omitempty"`
+
+	// Subscribe/Event fields. Node is the name of the node an Event
+	// happened on.
 	SubscriptionID *uint64       `json:"subscription_id,omitempty"`
 	SessionID      *uint32       `json:"session_id,omitempty"`
 	Event          *SessionEvent `json:"event,omitempty"`
+	Node           string        `json:"node,omitempty"`
 
 	// KV fields.
 	Value   []byte    `json:"value,omitempty"`
@@ -128,6 +403,207 @@ type Response struct {
 	ReplyBody string             `json:"reply_body,omitempty"`
 	FromID    *uint32            `json:"from_id,omitempty"`
 	FromName  string             `json:"from_name,omitempty"`
+
+	// Recording fields (RecordingTiming): Timing holds the chunks the output
+	// log was written in. The log itself follows Recording in FileChunk
+	// frames.
+	Timing *[]TimingEntry `json:"timing,omitempty"`
+
+	// Cron fields (CronList).
+	CronJobs *[]CronJob `json:"cron_jobs,omitempty"`
+
+	// File transfer fields (FileInfo, FileReady, FileDone). Path is the
+	// file's full path on the node, as it is for StateExported; FileDone
+	// carries the size and hex SHA-256 of the content transferred.
+	Path     string `json:"path,omitempty"`
+	FileSize int64  `json:"file_size,omitempty"`
+	FileMode uint32 `json:"file_mode,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+
+	// Worktrees lists the node's session worktrees (WorktreeList).
+	Worktrees *[]Worktree `json:"worktrees,omitempty"`
+
+	// Pipes lists the node's pipes (PipeList); PipeAdded has the new one.
+	Pipes *[]Pipe `json:"pipes,omitempty"`
+
+	// History lists launched sessions, oldest first (HistoryList).
+	History *[]HistoryEntry `json:"history,omitempty"`
+
+	// Stats reports the usage of sessions (SessionStats).
+	Stats *[]SessionStats `json:"stats,omitempty"`
+
+	// Script reports how a RunScript went (ScriptResult).
+	Script *ScriptResult `json:"script,omitempty"`
+
+	// Screen is a session's current screen (Screen).
+	Screen *Screen `json:"screen,omitempty"`
+
+	// Timeline is a session's audit trail (Timeline).
+	Timeline *[]TimelineEntry `json:"timeline,omitempty"`
+
+	// Archives lists session archives (Archived, ArchiveList), or the one
+	// restored (Restored, with the session's ID).
+	Archives *[]ArchivedSession `json:"archives,omitempty"`
+
+	// Port forwarding fields (StreamOpened, StreamClose). A StreamClose
+	// with a Message reports why the stream failed.
+	Stream uint32 `json:"stream,omitempty"`
+}
+
+// CronJob is a scheduled session launch.
+type CronJob struct {
+	Name          string   `json:"name"`
+	Schedule      string   `json:"schedule"`
+	Command       []string `json:"command"`
+	WorkingDir    string   `json:"working_dir"`
+	Env           []string `json:"env,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	Budget        *Budget  `json:"budget,omitempty"`
+	MissedRun     string   `json:"missed_run"`
+	CreatedAt     string   `json:"created_at"`
+	LastRunAt     *string  `json:"last_run_at,omitempty"`
+	LastSessionID *uint32  `json:"last_session_id,omitempty"`
+	NextRunAt     string   `json:"next_run_at,omitempty"`
+}
+
+// Worktree is a git worktree created by cw run --worktree. Its branch has
+// the worktree's name and starts from Base, the repository's HEAD commit
+// when the worktree was created.
+type Worktree struct {
+	Name      string   `json:"name"`
+	Repo      string   `json:"repo"` // the main checkout
+	Path      string   `json:"path"`
+	Base      string   `json:"base"`
+	CreatedAt string   `json:"created_at"`
+	Sessions  []uint32 `json:"sessions,omitempty"` // running or queued sessions in it
+	Git       *GitInfo `json:"git,omitempty"`
+}
+
+// Pipe forwards lines of one session's output into another's input.
+type Pipe struct {
+	ID        uint32 `json:"id"`
+	From      uint32 `json:"from"`
+	To        uint32 `json:"to"`
+	Grep      string `json:"grep,omitempty"`
+	Replace   string `json:"replace,omitempty"`
+	CreatedAt string `json:"created_at"`
+	Lines     uint64 `json:"lines"`             // forwarded so far
+	Dropped   uint64 `json:"dropped,omitempty"` // lost to a full input queue
+}
+
+// HistoryEntry is a session in the node's launch history, which outlives
+// the session itself. Entry numbers count up from 1 for the node's data
+// directory. Status is the session's final status, such as "completed (0)"
+// or "killed", its current one while it runs, or "unknown" when the node
+// stopped before it ended.
+type HistoryEntry struct {
+	Entry       int               `json:"entry"`
+	SessionID   uint32            `json:"session_id"`
+	Name        string            `json:"name,omitempty"`
+	Command     []string          `json:"command"`
+	WorkingDir  string            `json:"working_dir"`
+	Worktree    string            `json:"worktree,omitempty"`
+	Env         []string          `json:"env,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	StartedAt   string            `json:"started_at"`
+	Status      string            `json:"status"`
+	ExitCode    *int              `json:"exit_code,omitempty"`
+	CompletedAt string            `json:"completed_at,omitempty"`
+}
+
+// SessionStats is what a session has used, as cw stats reports it.
+// Messages count direct messages, requests and replies; approvals are the
+// requests the session sent, such as the gateway hook's, and the replies
+// to them that begin with DENIED. For a known agent CLI (Agent), tokens and
+// cost are what it reported (see Usage).
+type SessionStats struct {
+	ID        uint32 `json:"id"`
+	Name      string `json:"name,omitempty"`
+	Command   string `json:"command"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+	RuntimeMs int64  `json:"runtime_ms"`
+
+	OutputBytes uint64 `json:"output_bytes"`
+	OutputLines uint64 `json:"output_lines"`
+	InputBytes  uint64 `json:"input_bytes"`
+
+	MessagesSent       int `json:"messages_sent"`
+	MessagesReceived   int `json:"messages_received"`
+	ApprovalsRequested int `json:"approvals_requested"`
+	ApprovalsDenied    int `json:"approvals_denied"`
+
+	Agent        string  `json:"agent,omitempty"`
+	InputTokens  int64   `json:"input_tokens,omitempty"`
+	OutputTokens int64   `json:"output_tokens,omitempty"`
+	CostUSD      float64 `json:"cost_usd,omitempty"`
+}
+
+// ScriptStep is a step of cw script run: it waits up to TimeoutMs for the
+// session's output to match Expect, a Go regular expression, if set, then
+// sends Send, if set.
+type ScriptStep struct {
+	Expect    string `json:"expect,omitempty"`
+	Send      string `json:"send,omitempty"`
+	TimeoutMs int64  `json:"timeout_ms,omitempty"`
+}
+
+// ScriptResult is how a script ran: Steps is how many steps completed and
+// Matches the text each step's Expect matched. If a step failed, Error says
+// why and Output is the end of the output it saw.
+type ScriptResult struct {
+	Steps   int      `json:"steps"`
+	Matches []string `json:"matches,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Output  string   `json:"output,omitempty"`
+}
+
+// Screen is what a session's terminal shows, as the node's terminal
+// emulator renders it: Lines are its rows, without trailing blanks or
+// blank rows at the bottom, and carry SGR escape sequences when asked for.
+// Cursor positions count from 0; Alternate is set while a full-screen
+// program shows the alternate screen.
+type Screen struct {
+	Cols      int      `json:"cols"`
+	Rows      int      `json:"rows"`
+	CursorRow int      `json:"cursor_row"`
+	CursorCol int      `json:"cursor_col"`
+	Alternate bool     `json:"alternate,omitempty"`
+	Lines     []string `json:"lines"`
+}
+
+// TimelineEntry is an event of a session's timeline, as cw timeline shows
+// it. Kind groups events: lifecycle, message, approval, alert, agent,
+// budget or git. Summary describes the event in a line; Data is the
+// event's own data, as cw subscribe reports it.
+type TimelineEntry struct {
+	Time    string          `json:"time"` // RFC 3339
+	Kind    string          `json:"kind"`
+	Type    string          `json:"type"`
+	Summary string          `json:"summary"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// ArchivedSession describes a session archive: the session it holds, the
+// archive's file name in the node's archive directory and its size, and,
+// once uploaded, its location in S3.
+type ArchivedSession struct {
+	ID          uint32 `json:"id"`
+	Name        string `json:"name,omitempty"`
+	Prompt      string `json:"prompt"`
+	Status      string `json:"status"`
+	CompletedAt string `json:"completed_at,omitempty"` // RFC 3339
+	File        string `json:"file"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url,omitempty"`
+}
+
+// TimingEntry records when a chunk of session output was written. Chunks are
+// consecutive: each one's bytes follow the previous one's in the output log.
+type TimingEntry struct {
+	Time   string `json:"time"` // RFC 3339
+	Length int64  `json:"length"`
 }
 
 // MessageResponse represents a message in an inbox read result.
@@ -148,6 +624,9 @@ type SessionEvent struct {
 	Timestamp string          `json:"timestamp"`
 	EventType string          `json:"type"`
 	Data      json.RawMessage `json:"data"`
+	// Seq numbers the event in the node's event journal, for Subscribe
+	// FromSeq.
+	Seq uint64 `json:"seq,omitempty"`
 }
 
 // KVPair is a key-value entry for list responses.
@@ -4,13 +4,18 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"net"
 )
 
-// Frame type constants matching the Rust wire format.
+// Frame type constants matching the Rust wire format. FrameFileChunk carries
+// file content for FileRead and FileWrite transfers, and FrameStream the
+// data of one of the TCP streams multiplexed over a Forward connection.
 const (
-	FrameControl byte   = 0x00
-	FrameData    byte   = 0x01
-	MaxPayload   uint32 = 16 * 1024 * 1024 // 16 MB
+	FrameControl   byte   = 0x00
+	FrameData      byte   = 0x01
+	FrameFileChunk byte   = 0x02
+	FrameStream    byte   = 0x03
+	MaxPayload     uint32 = 16 * 1024 * 1024 // 16 MB
 )
 
 // Frame represents a wire-protocol frame with a type byte and payload.
@@ -48,26 +53,44 @@ func ReadFrame(r io.Reader) (*Frame, error) {
 	}
 
 	switch frameType {
-	case FrameControl, FrameData:
+	case FrameControl, FrameData, FrameFileChunk, FrameStream:
 		return &Frame{Type: frameType, Payload: payload}, nil
 	default:
 		return nil, fmt.Errorf("unknown frame type: 0x%02x", frameType)
 	}
 }
 
-// WriteFrame writes a single frame to the writer.
+// WriteFrame writes a single frame to the writer. Header and payload go out
+// in one vectored write (writev) where w supports it, such as a Unix socket,
+// and the payload is never copied.
 func WriteFrame(w io.Writer, f *Frame) error {
 	var header [5]byte
 	header[0] = f.Type
 	binary.BigEndian.PutUint32(header[1:5], uint32(len(f.Payload)))
 
-	if _, err := w.Write(header[:]); err != nil {
-		return fmt.Errorf("writing frame header: %w", err)
-	}
+	bufs := net.Buffers{header[:]}
 	if len(f.Payload) > 0 {
-		if _, err := w.Write(f.Payload); err != nil {
-			return fmt.Errorf("writing frame payload: %w", err)
-		}
+		bufs = append(bufs, f.Payload)
+	}
+	if _, err := bufs.WriteTo(w); err != nil {
+		return fmt.Errorf("writing frame: %w", err)
 	}
 	return nil
 }
+
+// StreamFrame builds a FrameStream frame carrying data for stream id.
+// Payload format: [stream:u32 BE][data]
+func StreamFrame(id uint32, data []byte) *Frame {
+	payload := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(payload[:4], id)
+	copy(payload[4:], data)
+	return &Frame{Type: FrameStream, Payload: payload}
+}
+
+// ParseStream splits a FrameStream payload into its stream id and data.
+func ParseStream(payload []byte) (uint32, []byte, error) {
+	if len(payload) < 4 {
+		return 0, nil, fmt.Errorf("stream frame too short: %d bytes", len(payload))
+	}
+	return binary.BigEndian.Uint32(payload[:4]), payload[4:], nil
+}
@@ -58,6 +58,55 @@ func TestFrameRoundTripData(t *testing.T) {
 	}
 }
 
+func TestFrameRoundTripFileChunk(t *testing.T) {
+	original := &Frame{Type: FrameFileChunk, Payload: []byte{0x00, 0xff, 'x'}}
+
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, original); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+
+	decoded, err := ReadFrame(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if decoded == nil {
+		t.Fatal("ReadFrame returned nil frame")
+	}
+	if decoded.Type != FrameFileChunk {
+		t.Errorf("Type = 0x%02x, want 0x%02x", decoded.Type, FrameFileChunk)
+	}
+	if !bytes.Equal(decoded.Payload, original.Payload) {
+		t.Errorf("Payload = %q, want %q", decoded.Payload, original.Payload)
+	}
+}
+
+func TestStreamFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, StreamFrame(0x01020304, []byte("GET / HTTP/1.1\r\n"))); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+
+	decoded, err := ReadFrame(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if decoded == nil || decoded.Type != FrameStream {
+		t.Fatalf("decoded = %+v, want a stream frame", decoded)
+	}
+	id, data, err := ParseStream(decoded.Payload)
+	if err != nil {
+		t.Fatalf("ParseStream: %v", err)
+	}
+	if id != 0x01020304 || string(data) != "GET / HTTP/1.1\r\n" {
+		t.Errorf("ParseStream = %#x, %q", id, data)
+	}
+
+	if _, _, err := ParseStream([]byte{0, 1}); err == nil {
+		t.Error("expected error for short stream payload")
+	}
+}
+
 func TestFrameEmptyPayload(t *testing.T) {
 	original := &Frame{Type: FrameControl, Payload: []byte{}}
 
@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// labelKeyRe and labelValueRe restrict label keys and values to characters
+// that need no quoting in a selector.
+var (
+	labelKeyRe   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,62})$`)
+	labelValueRe = regexp.MustCompile(`^[A-Za-z0-9._/-]{0,63}$`)
+)
+
+// ParseLabels parses key=value arguments into session labels. A later
+// value for a key replaces an earlier one.
+func ParseLabels(args []string) (map[string]string, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("label must be key=value, got %q", arg)
+		}
+		if err := ValidateLabel(key, value); err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// ValidateLabel checks a label's key (letters, digits, '.', '_', '/' and
+// '-', starting with a letter or digit) and value (the same characters, or
+// empty), each at most 63 characters.
+func ValidateLabel(key, value string) error {
+	if !labelKeyRe.MatchString(key) {
+		return fmt.Errorf("invalid label key %q (letters, digits, '.', '_', '/' and '-'; at most 63)", key)
+	}
+	if !labelValueRe.MatchString(value) {
+		return fmt.Errorf("invalid value %q for label %s (letters, digits, '.', '_', '/' and '-'; at most 63)", value, key)
+	}
+	return nil
+}
+
+// SelectorOp is how a Requirement tests a label.
+type SelectorOp string
+
+const (
+	SelectorEquals    SelectorOp = "="
+	SelectorNotEquals SelectorOp = "!="
+	SelectorExists    SelectorOp = "exists"
+	SelectorNotExists SelectorOp = "!exists"
+)
+
+// Requirement is one comma-separated term of a Selector.
+type Requirement struct {
+	Key   string
+	Op    SelectorOp
+	Value string
+}
+
+// Selector matches session labels, kubectl-style: every requirement must
+// hold. An empty Selector matches everything.
+type Selector []Requirement
+
+// ParseSelector parses a comma-separated list of requirements: key=value
+// (or key==value), key!=value (also true without the label), key (the
+// label is set) and !key (it is not).
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		var r Requirement
+		switch {
+		case strings.Contains(term, "!="):
+			r.Key, r.Value, _ = strings.Cut(term, "!=")
+			r.Op = SelectorNotEquals
+		case strings.Contains(term, "="):
+			r.Key, r.Value, _ = strings.Cut(term, "=")
+			r.Value = strings.TrimPrefix(r.Value, "=")
+			r.Op = SelectorEquals
+		case strings.HasPrefix(term, "!"):
+			r.Key, r.Op = strings.TrimSpace(term[1:]), SelectorNotExists
+		default:
+			r.Key, r.Op = term, SelectorExists
+		}
+		r.Key, r.Value = strings.TrimSpace(r.Key), strings.TrimSpace(r.Value)
+		if err := ValidateLabel(r.Key, r.Value); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", term, err)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels satisfy every requirement.
+func (sel Selector) Matches(labels map[string]string) bool {
+	for _, r := range sel {
+		value, ok := labels[r.Key]
+		switch r.Op {
+		case SelectorEquals:
+			if !ok || value != r.Value {
+				return false
+			}
+		case SelectorNotEquals:
+			if ok && value == r.Value {
+				return false
+			}
+		case SelectorExists:
+			if !ok {
+				return false
+			}
+		case SelectorNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package protocol
+
+import "testing"
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"repo=webapp", "ticket=JIRA-123", "empty=", "repo=api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 3 || labels["repo"] != "api" || labels["ticket"] != "JIRA-123" || labels["empty"] != "" {
+		t.Errorf("ParseLabels = %v", labels)
+	}
+	for _, bad := range []string{"repo", "=x", "re po=x", "repo=a b", "-repo=x"} {
+		if _, err := ParseLabels([]string{bad}); err == nil {
+			t.Errorf("ParseLabels(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{"repo": "webapp", "ticket": "JIRA-123"}
+	for _, tc := range []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"repo=webapp", true},
+		{"repo==webapp", true},
+		{"repo=api", false},
+		{"repo=webapp,ticket!=JIRA-1", true},
+		{"repo=webapp, ticket!=JIRA-123", false},
+		{"owner!=bob", true},
+		{"ticket", true},
+		{"owner", false},
+		{"!owner", true},
+		{"!ticket", false},
+	} {
+		sel, err := ParseSelector(tc.selector)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", tc.selector, err)
+		}
+		if got := sel.Matches(labels); got != tc.want {
+			t.Errorf("%q matches %v = %v, want %v", tc.selector, labels, got, tc.want)
+		}
+	}
+	for _, bad := range []string{"=x", "repo=a b", "!", "re po"} {
+		if _, err := ParseSelector(bad); err == nil {
+			t.Errorf("ParseSelector(%q) succeeded", bad)
+		}
+	}
+}
@@ -3,15 +3,21 @@ package relay
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/creack/pty"
 	"nhooyr.io/websocket"
+
+	"github.com/codewiresh/codewire/internal/connection"
 )
 
 // AgentConfig configures the node agent.
@@ -19,9 +25,44 @@ type AgentConfig struct {
 	RelayURL  string // e.g. "https://relay.codewire.sh"
 	NodeName  string
 	NodeToken string
+	// DataDir holds the node's SSH host key and authorized_keys for end-to-end
+	// encrypted sessions (see LoadOrCreateHostKey).
+	DataDir string
+	// OnReply applies a reply to a pending message request on the local node.
+	// Used to deliver human decisions on escalated gateway requests.
+	OnReply func(requestID, body string) error
+	// Groups are the node groups this node joined. The relay places client
+	// connections to a group on one of its nodes.
+	Groups []string
+	// Clients serves the client connections the relay places on this node,
+	// as the node's /ws endpoint does. Without it, or without Groups, the
+	// node refuses them.
+	Clients func(connection.FrameReader, connection.FrameWriter)
+	// Status returns the node's load and health, reported to the relay for
+	// placement and for listing nodes.
+	Status func() NodeStatus
+	// Update installs cw version from the release base URL baseURL (empty
+	// for the GitHub releases) and restarts the node into it. The relay
+	// sends it while the node's update channel asks for another version,
+	// so it is called again until the node restarts.
+	Update func(version, baseURL string)
+	// Rotate saves the new relay token the relay sends when the node's
+	// token is rotated. The agent then reconnects with it, which makes the
+	// relay drop the old token. Without it the node refuses rotations.
+	Rotate func(token string) error
 }
 
-// RunAgent connects to the relay and handles incoming SSH requests.
+// tokenRotated ends a connection whose node token was rotated, carrying the
+// new token to reconnect with.
+type tokenRotated string
+
+func (t tokenRotated) Error() string { return "node token rotated" }
+
+// statusInterval is how often the agent reports the node's status.
+const statusInterval = 15 * time.Second
+
+// RunAgent connects to the relay and handles incoming SSH requests and
+// forwarded gateway replies.
 // It reconnects automatically with exponential backoff.
 func RunAgent(ctx context.Context, cfg AgentConfig) {
 	backoff := time.Second
@@ -30,6 +71,13 @@ func RunAgent(ctx context.Context, cfg AgentConfig) {
 		if ctx.Err() != nil {
 			return
 		}
+		var rotated tokenRotated
+		if errors.As(err, &rotated) {
+			slog.Info("relay agent reconnecting with rotated token", "node", cfg.NodeName)
+			cfg.NodeToken = string(rotated)
+			backoff = time.Second
+			continue
+		}
 		slog.Warn("relay agent disconnected", "err", err, "retry_in", backoff)
 		select {
 		case <-time.After(backoff):
@@ -44,6 +92,9 @@ func RunAgent(ctx context.Context, cfg AgentConfig) {
 
 func runAgentOnce(ctx context.Context, cfg AgentConfig) error {
 	wsURL := toWS(cfg.RelayURL) + "/node/connect"
+	if len(cfg.Groups) > 0 {
+		wsURL += "?" + url.Values{"group": cfg.Groups}.Encode()
+	}
 	ws, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
 		HTTPHeader: http.Header{"Authorization": {"Bearer " + cfg.NodeToken}},
 	})
@@ -52,7 +103,11 @@ func runAgentOnce(ctx context.Context, cfg AgentConfig) error {
 	}
 	defer ws.CloseNow()
 
-	slog.Info("relay agent connected", "relay", cfg.RelayURL, "node", cfg.NodeName)
+	slog.Info("relay agent connected", "relay", cfg.RelayURL, "node", cfg.NodeName, "groups", cfg.Groups)
+
+	if cfg.Status != nil {
+		go reportStatus(ctx, ws, cfg.Status)
+	}
 
 	for {
 		_, data, err := ws.Read(ctx)
@@ -63,8 +118,36 @@ func runAgentOnce(ctx context.Context, cfg AgentConfig) error {
 		if err := json.Unmarshal(data, &msg); err != nil {
 			continue
 		}
-		if msg.Type == "SSHRequest" {
-			go handleSSHBack(ctx, cfg, msg)
+		switch msg.Type {
+		case "SSHRequest":
+			if msg.Tunnel {
+				go handleSSHTunnel(ctx, cfg, msg)
+			} else {
+				go handleSSHBack(ctx, cfg, msg)
+			}
+		case "ClientRequest":
+			go handleClientRequest(ctx, cfg, msg)
+		case "MsgReply":
+			if cfg.OnReply == nil {
+				continue
+			}
+			if err := cfg.OnReply(msg.RequestID, msg.Body); err != nil {
+				slog.Warn("relay agent: applying reply failed", "err", err, "request", msg.RequestID)
+			}
+		case "Update":
+			if cfg.Update != nil {
+				go cfg.Update(msg.Version, msg.URL)
+			}
+		case "RotateToken":
+			if cfg.Rotate == nil || msg.Token == "" {
+				continue
+			}
+			if err := cfg.Rotate(msg.Token); err != nil {
+				slog.Warn("relay agent: saving rotated token failed", "err", err)
+				continue
+			}
+			ws.Close(websocket.StatusNormalClosure, "token rotated")
+			return tokenRotated(msg.Token)
 		}
 	}
 }
@@ -97,8 +180,15 @@ func handleSSHBack(ctx context.Context, cfg AgentConfig, msg HubMessage) {
 	nc := websocket.NetConn(childCtx, ws, websocket.MessageBinary)
 	defer nc.Close()
 
-	// Spawn a bash shell attached to a PTY.
+	// Spawn a bash shell, or the requested cw command, attached to a PTY.
 	cmd := exec.CommandContext(ctx, "bash", "--login")
+	if msg.Command != nil {
+		if cmd, err = cwCommand(ctx, cfg, msg.Command); err != nil {
+			slog.Warn("relay agent: refusing command", "err", err, "session", msg.SessionID)
+			fmt.Fprintf(nc, "%v\r\n", err)
+			return
+		}
+	}
 	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{
 		Rows: uint16(rows), Cols: uint16(cols),
 	})
@@ -124,6 +214,27 @@ func handleSSHBack(ctx context.Context, cfg AgentConfig, msg HubMessage) {
 }
 
 // toWS converts http(s):// to ws(s)://.
+// cwCommand returns the cw invocation for a command requested through the
+// relay's SSH listener. The relay already restricts commands; the node
+// checks again rather than trusting it.
+func cwCommand(ctx context.Context, cfg AgentConfig, args []string) (*exec.Cmd, error) {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+	case len(args) == 2 && args[0] == "attach" && !strings.HasPrefix(args[1], "-"):
+	default:
+		return nil, fmt.Errorf("unsupported command %q", strings.Join(args, " "))
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, self, args...)
+	if cfg.DataDir != "" {
+		cmd.Env = append(os.Environ(), "CODEWIRE_DIR="+cfg.DataDir)
+	}
+	return cmd, nil
+}
+
 func toWS(u string) string {
 	if len(u) > 5 && u[:5] == "https" {
 		return "wss" + u[5:]
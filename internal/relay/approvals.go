@@ -0,0 +1,171 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// approvalTTL bounds how long an escalated gateway request stays clickable.
+const approvalTTL = time.Hour
+
+// RegisterApprovalHandlers adds the gateway escalation endpoints to mux.
+//
+//	POST /api/v1/approvals   — node-authenticated; registers a request, returns its URL
+//	GET  /approvals/{token}  — human-facing page with Approve / Deny buttons
+//	POST /approvals/{token}  — applies the decision as a MsgReply on the node
+//
+// Decisions are only applied on POST so that link unfurlers in Slack or
+// Discord cannot approve a request by prefetching the URL. Pending approvals
+// live in the store, so any relay replica can serve the link.
+func RegisterApprovalHandlers(mux *http.ServeMux, hub *NodeHub, st store.Store, baseURL string) {
+	mux.HandleFunc("POST /api/v1/approvals", nodeAuthMiddleware(st, approvalCreateHandler(st, baseURL)))
+	mux.HandleFunc("GET /approvals/{token}", approvalPageHandler(st))
+	mux.HandleFunc("POST /approvals/{token}", approvalDecideHandler(hub, st))
+}
+
+func approvalCreateHandler(st store.Store, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nodeName, _ := r.Context().Value(nodeContextKey{}).(string)
+
+		var req struct {
+			RequestID string `json:"request_id"`
+			From      string `json:"from"`
+			Body      string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RequestID == "" {
+			http.Error(w, "request_id required", http.StatusBadRequest)
+			return
+		}
+
+		token := generateToken()
+		err := st.ApprovalCreate(r.Context(), store.Approval{
+			Token:     token,
+			NodeName:  nodeName,
+			RequestID: req.RequestID,
+			From:      req.From,
+			Body:      req.Body,
+			ExpiresAt: time.Now().UTC().Add(approvalTTL),
+		})
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"url": strings.TrimRight(baseURL, "/") + "/approvals/" + token,
+		})
+	}
+}
+
+func approvalPageHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a, err := st.ApprovalGet(r.Context(), r.PathValue("token"))
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if a == nil {
+			approvalPage(w, http.StatusNotFound, "Request not found", "This approval link has expired or was already used.")
+			return
+		}
+
+		from := a.From
+		if from == "" {
+			from = "anonymous"
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html><head><title>Approval Request</title>
+<style>body{font-family:system-ui;max-width:560px;margin:80px auto;color:#1a1a1a}
+h2{font-weight:600}
+.code{font-family:monospace;background:#f5f5f5;padding:8px 16px;border-radius:6px;margin:12px 0;white-space:pre-wrap;word-break:break-all}
+p{color:#525252;line-height:1.6}
+input[type=text]{width:100%%;padding:6px;margin:8px 0;box-sizing:border-box}
+button{padding:8px 20px;margin-right:8px;border-radius:6px;border:1px solid #d4d4d4;cursor:pointer}
+</style></head><body>
+<h2>Approval Request</h2>
+<p>Node <b>%s</b>, from <b>%s</b>:</p>
+<div class="code">%s</div>
+<form method="POST">
+<input type="text" name="reason" placeholder="Reason (optional, sent with deny)">
+<button type="submit" name="decision" value="approve">Approve</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body></html>`, html.EscapeString(a.NodeName), html.EscapeString(from), html.EscapeString(a.Body))
+	}
+}
+
+func approvalDecideHandler(hub *NodeHub, st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decision := r.FormValue("decision")
+		var reply string
+		switch decision {
+		case "approve":
+			reply = "APPROVED"
+		case "deny":
+			reply = "DENIED"
+			if reason := strings.TrimSpace(r.FormValue("reason")); reason != "" {
+				reply += ": " + reason
+			}
+		default:
+			http.Error(w, "decision must be approve or deny", http.StatusBadRequest)
+			return
+		}
+
+		// Take the approval before forwarding, so that of two concurrent
+		// decisions (a double click, or two reviewers) only one is sent.
+		a, err := st.ApprovalTake(r.Context(), r.PathValue("token"))
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if a == nil {
+			approvalPage(w, http.StatusNotFound, "Request not found", "This approval link has expired or was already used.")
+			return
+		}
+
+		// Approval links are bearer URLs, so the decider is only known by address.
+		entry := store.AuditEntry{Node: a.NodeName, Action: "approval." + decision, Result: "ok", RemoteIP: remoteIP(r)}
+		if err := hub.Send(a.NodeName, HubMessage{
+			Type:      "MsgReply",
+			RequestID: a.RequestID,
+			Body:      reply,
+		}); err != nil {
+			slog.Error("approval: forwarding reply failed", "node", a.NodeName, "err", err)
+			// Put it back so the link works once the node reconnects.
+			if err := st.ApprovalCreate(r.Context(), *a); err != nil {
+				slog.Error("approval: restoring request failed", "err", err)
+			}
+			entry.Result = "node not connected"
+			recordAudit(r.Context(), st, entry)
+			approvalPage(w, http.StatusBadGateway, "Node unavailable", "The node is not connected to the relay. Try again once it reconnects.")
+			return
+		}
+		recordAudit(r.Context(), st, entry)
+
+		slog.Info("approval: decision forwarded", "node", a.NodeName, "request", a.RequestID, "reply", reply)
+		approvalPage(w, http.StatusOK, "Decision sent", "Replied "+reply+".")
+	}
+}
+
+func approvalPage(w http.ResponseWriter, status int, title, message string) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html><head><title>%s</title>
+<style>body{font-family:system-ui;max-width:480px;margin:80px auto;text-align:center;color:#1a1a1a}
+h2{font-weight:600}
+p{color:#525252;line-height:1.6}
+</style></head><body>
+<h2>%s</h2>
+<p>%s</p>
+</body></html>`, html.EscapeString(title), html.EscapeString(title), html.EscapeString(message))
+}
@@ -0,0 +1,202 @@
+package relay_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/relay"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+func TestApprovalForwardsReply(t *testing.T) {
+	st, err := store.NewSQLiteStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	_ = st.NodeRegister(context.Background(), store.NodeRecord{Name: "n1", Token: "tok1", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+
+	hub := relay.NewNodeHub()
+	ch := make(chan relay.HubMessage, 1)
+	hub.Register("n1", ch)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	relay.RegisterApprovalHandlers(mux, hub, st, srv.URL)
+
+	// Unauthenticated registration is rejected.
+	resp, err := http.Post(srv.URL+"/api/v1/approvals", "application/json", strings.NewReader(`{"request_id":"r1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/approvals", strings.NewReader(`{"request_id":"r1","from":"worker","body":"Bash: rm -rf build"}`))
+	req.Header.Set("Authorization", "Bearer tok1")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created struct {
+		URL string `json:"url"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if !strings.HasPrefix(created.URL, srv.URL+"/approvals/") {
+		t.Fatalf("unexpected approval URL: %q", created.URL)
+	}
+
+	// Viewing the page must not apply a decision.
+	resp, err = http.Get(created.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for approval page, got %d", resp.StatusCode)
+	}
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected hub message on GET: %+v", msg)
+	default:
+	}
+
+	resp, err = http.PostForm(created.URL, url.Values{"decision": {"deny"}, "reason": {"too risky"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for decision, got %d", resp.StatusCode)
+	}
+	select {
+	case msg := <-ch:
+		if msg.Type != "MsgReply" || msg.RequestID != "r1" || msg.Body != "DENIED: too risky" {
+			t.Fatalf("unexpected hub message: %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for forwarded reply")
+	}
+
+	entries, err := st.AuditList(context.Background(), store.AuditFilter{Node: "n1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "approval.deny" || entries[0].Result != "ok" {
+		t.Fatalf("expected one approval.deny audit entry, got %+v", entries)
+	}
+
+	// Links are single-use.
+	resp, err = http.PostForm(created.URL, url.Values{"decision": {"approve"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for reused link, got %d", resp.StatusCode)
+	}
+}
+
+// newApproval registers an approval for node n1 on a fresh relay and
+// returns its URL.
+func newApproval(t *testing.T, hub *relay.NodeHub) string {
+	t.Helper()
+	st, err := store.NewSQLiteStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	_ = st.NodeRegister(context.Background(), store.NodeRecord{Name: "n1", Token: "tok1", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	relay.RegisterApprovalHandlers(mux, hub, st, srv.URL)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/approvals", strings.NewReader(`{"request_id":"r1","body":"Bash: make"}`))
+	req.Header.Set("Authorization", "Bearer tok1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var created struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	return created.URL
+}
+
+func TestApprovalConcurrentDecisions(t *testing.T) {
+	hub := relay.NewNodeHub()
+	ch := make(chan relay.HubMessage, 8)
+	hub.Register("n1", ch)
+	link := newApproval(t, hub)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.PostForm(link, url.Values{"decision": {"approve"}})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			codes <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	ok := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			ok++
+		}
+	}
+	if ok != 1 || len(ch) != 1 {
+		t.Fatalf("%d decisions accepted and %d replies forwarded, want one of each", ok, len(ch))
+	}
+}
+
+func TestApprovalNodeOffline(t *testing.T) {
+	hub := relay.NewNodeHub()
+	link := newApproval(t, hub)
+
+	resp, err := http.PostForm(link, url.Values{"decision": {"approve"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502 with the node offline, got %d", resp.StatusCode)
+	}
+
+	// The approval is kept for when the node reconnects.
+	ch := make(chan relay.HubMessage, 1)
+	hub.Register("n1", ch)
+	resp, err = http.PostForm(link, url.Values{"decision": {"approve"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(ch) != 1 {
+		t.Fatalf("expected the retried decision to be forwarded, got %d", resp.StatusCode)
+	}
+}
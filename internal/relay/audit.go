@@ -0,0 +1,118 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/oauth"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+// recordAudit appends e to the audit log. Failures are logged rather than
+// returned so that a full disk never blocks the action being audited.
+func recordAudit(ctx context.Context, st store.Store, e store.AuditEntry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := st.AuditAppend(ctx, e); err != nil {
+		slog.Error("audit: recording action failed", "action", e.Action, "node", e.Node, "err", err)
+	}
+}
+
+// auditUser returns the name to record for the authenticated caller of r.
+func auditUser(r *http.Request) string {
+	id := oauth.GetAuth(r.Context())
+	switch {
+	case id == nil:
+		return ""
+	case id.Username != "":
+		return id.Username
+	case id.IsAdmin:
+		return "admin"
+	}
+	return ""
+}
+
+// RegisterAuditHandler adds GET /api/v1/audit to mux. Callers authenticate
+// with a session or the admin token, like the other management endpoints.
+func RegisterAuditHandler(mux *http.ServeMux, st store.Store, adminToken string) {
+	mux.Handle("GET /api/v1/audit", oauth.RequireAuth(st, adminToken)(auditListHandler(st)))
+}
+
+type auditListResponse struct {
+	Entries []store.AuditEntry `json:"entries"`
+	// NextBefore is passed back as ?before= to fetch the next page. It is
+	// omitted on the last page.
+	NextBefore int64 `json:"next_before,omitempty"`
+}
+
+// auditListHandler serves GET /api/v1/audit, newest entries first.
+//
+//	user, node  exact match
+//	since       RFC 3339 time or a duration such as 24h
+//	before      only entries older than this ID (from next_before)
+//	limit       page size, default 100, at most 1000
+func auditListHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := store.AuditFilter{
+			User:  q.Get("user"),
+			Node:  q.Get("node"),
+			Limit: auditDefaultLimit,
+		}
+
+		if s := q.Get("since"); s != "" {
+			if d, err := time.ParseDuration(s); err == nil {
+				filter.Since = time.Now().Add(-d)
+			} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+				filter.Since = t
+			} else {
+				http.Error(w, "invalid since (want a duration or RFC 3339 time)", http.StatusBadRequest)
+				return
+			}
+		}
+		if s := q.Get("before"); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n <= 0 {
+				http.Error(w, "invalid before", http.StatusBadRequest)
+				return
+			}
+			filter.Before = n
+		}
+		if s := q.Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = min(n, auditMaxLimit)
+		}
+
+		entries, err := st.AuditList(r.Context(), filter)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := auditListResponse{Entries: entries}
+		if resp.Entries == nil {
+			resp.Entries = []store.AuditEntry{}
+		}
+		if len(entries) == filter.Limit {
+			resp.NextBefore = entries[len(entries)-1].ID
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
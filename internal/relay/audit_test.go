@@ -0,0 +1,76 @@
+package relay_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/relay"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+func TestAuditListPages(t *testing.T) {
+	st := newTestSQLiteStore(t)
+	ctx := context.Background()
+	_ = st.AuditAppend(ctx, store.AuditEntry{Time: time.Now().Add(-48 * time.Hour), User: "alice", Node: "n1", Action: "ssh", SessionID: "old", Result: "ok"})
+	for i := range 3 {
+		_ = st.AuditAppend(ctx, store.AuditEntry{User: "alice", Node: "n1", Action: "ssh", SessionID: fmt.Sprintf("s%d", i), Result: "ok"})
+	}
+	_ = st.AuditAppend(ctx, store.AuditEntry{User: "bob", Node: "n2", Action: "node.revoke", Result: "ok"})
+
+	mux := http.NewServeMux()
+	relay.RegisterAuditHandler(mux, st, "admin-secret")
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	get := func(query string) (int, []string, int64) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/audit?"+query, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Entries    []store.AuditEntry `json:"entries"`
+			NextBefore int64              `json:"next_before"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		var ids []string
+		for _, e := range body.Entries {
+			ids = append(ids, e.SessionID)
+		}
+		return resp.StatusCode, ids, body.NextBefore
+	}
+
+	// Unauthenticated requests are rejected.
+	resp, err := http.Get(srv.URL + "/api/v1/audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+
+	status, ids, next := get("user=alice&since=24h&limit=2")
+	if status != http.StatusOK || fmt.Sprint(ids) != "[s2 s1]" || next == 0 {
+		t.Fatalf("first page: status %d, ids %v, next %d", status, ids, next)
+	}
+	status, ids, next = get(fmt.Sprintf("user=alice&since=24h&limit=2&before=%d", next))
+	if status != http.StatusOK || fmt.Sprint(ids) != "[s0]" || next != 0 {
+		t.Fatalf("last page: status %d, ids %v, next %d", status, ids, next)
+	}
+
+	if status, ids, _ = get("node=n2"); status != http.StatusOK || len(ids) != 1 {
+		t.Fatalf("node filter: status %d, ids %v", status, ids)
+	}
+	if status, _, _ = get("since=yesterday"); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid since, got %d", status)
+	}
+}
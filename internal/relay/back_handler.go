@@ -13,8 +13,16 @@ import (
 
 // PendingSessions tracks back-connections that SSH sessions are waiting for.
 type PendingSessions struct {
-	mu    sync.Mutex
-	waits map[string]chan net.Conn
+	mu      sync.Mutex
+	waits   map[string]chan net.Conn
+	cluster *Cluster
+}
+
+// backConn is a back-connection. A client connection placed on a node uses
+// its WebSocket directly, to pass on the client's messages as they are.
+type backConn struct {
+	net.Conn
+	ws *websocket.Conn
 }
 
 // NewPendingSessions returns an empty PendingSessions registry.
@@ -29,9 +37,19 @@ func (p *PendingSessions) Expect(sessionID string) <-chan net.Conn {
 	p.mu.Lock()
 	p.waits[sessionID] = ch
 	p.mu.Unlock()
+	if p.cluster != nil {
+		p.cluster.claim(sessionRouteKey(sessionID), backRouteTTL)
+	}
 	return ch
 }
 
+func (p *PendingSessions) has(sessionID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.waits[sessionID]
+	return ok
+}
+
 func (p *PendingSessions) deliver(sessionID string, conn net.Conn) bool {
 	p.mu.Lock()
 	ch, ok := p.waits[sessionID]
@@ -54,6 +72,9 @@ func (p *PendingSessions) Cancel(sessionID string) {
 		close(ch)
 	}
 	p.mu.Unlock()
+	if p.cluster != nil {
+		p.cluster.release(sessionRouteKey(sessionID))
+	}
 }
 
 // DeliverForTest allows tests to inject a back-connection directly.
@@ -71,7 +92,7 @@ func RegisterBackHandler(mux *http.ServeMux, sessions *PendingSessions, st store
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
-		node, err := st.NodeGetByToken(r.Context(), token)
+		node, err := agentByToken(r.Context(), st, token)
 		if err != nil || node == nil {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
@@ -79,13 +100,18 @@ func RegisterBackHandler(mux *http.ServeMux, sessions *PendingSessions, st store
 
 		sessionID := r.PathValue("session_id")
 
+		// The SSH session may be held by another replica.
+		if !sessions.has(sessionID) && sessions.cluster != nil && sessions.cluster.proxyBack(w, r, sessionID) {
+			return
+		}
+
 		ws, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
 		if err != nil {
 			return
 		}
 
 		// Wrap as net.Conn and deliver to waiting SSH session.
-		nc := websocket.NetConn(r.Context(), ws, websocket.MessageBinary)
+		nc := &backConn{Conn: websocket.NetConn(r.Context(), ws, websocket.MessageBinary), ws: ws}
 		if !sessions.deliver(sessionID, nc) {
 			// No one waiting — session may have timed out.
 			ws.Close(websocket.StatusNormalClosure, "no waiter")
@@ -0,0 +1,189 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// backupKeyPrefix and backupKeySuffix frame the timestamp in backup object
+// names, so that the newest backup sorts last.
+const (
+	backupKeyPrefix = "relay-"
+	backupKeySuffix = ".db"
+)
+
+// BackupOptions configures a relay backup.
+type BackupOptions struct {
+	DataDir string // relay data directory holding relay.db
+	Output  string // file to write the backup to, instead of S3
+	S3      *S3Location
+}
+
+// RunBackup snapshots the relay database in opts.DataDir, which the relay
+// may be using, to opts.Output or as a new object under the S3 prefix. It
+// returns where the backup was written.
+func RunBackup(ctx context.Context, opts BackupOptions) (string, error) {
+	if opts.Output != "" {
+		if err := store.SnapshotSQLite(ctx, opts.DataDir, opts.Output); err != nil {
+			return "", err
+		}
+		return opts.Output, nil
+	}
+	if opts.S3 == nil {
+		return "", fmt.Errorf("a backup needs an output file or an S3 bucket")
+	}
+	s3, err := newS3Client(*opts.S3)
+	if err != nil {
+		return "", err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "cw-relay-backup-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	snapshot := filepath.Join(tmpDir, store.SQLiteFile)
+	if err := store.SnapshotSQLite(ctx, opts.DataDir, snapshot); err != nil {
+		return "", err
+	}
+
+	key := backupPrefix(opts.S3.Prefix) + backupKeyPrefix + time.Now().UTC().Format("20060102T150405Z") + backupKeySuffix
+	if err := s3.put(ctx, key, snapshot); err != nil {
+		return "", fmt.Errorf("uploading backup: %w", err)
+	}
+	return "s3://" + opts.S3.Bucket + "/" + key, nil
+}
+
+// RestoreOptions configures a relay restore.
+type RestoreOptions struct {
+	DataDir string
+	// Source is a backup file, or with S3 an object key. Empty restores the
+	// newest backup under the S3 prefix.
+	Source string
+	S3     *S3Location
+	// IfMissing restores only when the data directory has no relay.db, and
+	// succeeds without restoring when there is no backup yet.
+	IfMissing bool
+	// Force replaces an existing relay.db.
+	Force bool
+}
+
+// RunRestore replaces the relay database in opts.DataDir with a backup. The
+// relay must not be running. It returns the backup restored, or "" when
+// IfMissing left the data directory as it was.
+func RunRestore(ctx context.Context, opts RestoreOptions) (string, error) {
+	dbPath := filepath.Join(opts.DataDir, store.SQLiteFile)
+	if _, err := os.Stat(dbPath); err == nil {
+		if opts.IfMissing {
+			return "", nil
+		}
+		if !opts.Force {
+			return "", fmt.Errorf("%s already exists; stop the relay and pass --force to replace it", dbPath)
+		}
+	}
+	if opts.Source == "" && opts.S3 == nil {
+		return "", fmt.Errorf("a restore needs a backup file or an S3 bucket")
+	}
+	if err := os.MkdirAll(opts.DataDir, 0o755); err != nil {
+		return "", err
+	}
+
+	// Stage the backup next to relay.db, so it can be renamed into place.
+	tmp, err := os.CreateTemp(opts.DataDir, ".relay.db.restore-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	source, err := fetchBackup(ctx, opts, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || source == "" {
+		return "", err
+	}
+	if err := store.CheckSQLite(ctx, tmp.Name()); err != nil {
+		return "", fmt.Errorf("backup %s: %w", source, err)
+	}
+
+	// A write-ahead log left by the old database would be replayed into the
+	// restored one.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	if err := os.Rename(tmp.Name(), dbPath); err != nil {
+		return "", err
+	}
+	return source, nil
+}
+
+// fetchBackup copies the backup opts names into w, and returns its name. It
+// returns "" when IfMissing is set and S3 holds no backup.
+func fetchBackup(ctx context.Context, opts RestoreOptions, w io.Writer) (string, error) {
+	if opts.S3 == nil {
+		f, err := os.Open(opts.Source)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := io.Copy(w, f); err != nil {
+			return "", err
+		}
+		return opts.Source, nil
+	}
+
+	s3, err := newS3Client(*opts.S3)
+	if err != nil {
+		return "", err
+	}
+	key := opts.Source
+	if key == "" {
+		keys, err := s3.list(ctx, backupPrefix(opts.S3.Prefix)+backupKeyPrefix)
+		if err != nil {
+			return "", fmt.Errorf("listing backups: %w", err)
+		}
+		key = latestBackup(keys)
+		if key == "" {
+			if opts.IfMissing {
+				return "", nil
+			}
+			return "", fmt.Errorf("no backups found in %s", opts.S3)
+		}
+	}
+	if err := s3.get(ctx, key, w); err != nil {
+		return "", fmt.Errorf("downloading backup: %w", err)
+	}
+	return "s3://" + opts.S3.Bucket + "/" + key, nil
+}
+
+// backupPrefix returns the key prefix for backups under prefix, which is
+// treated as a directory.
+func backupPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// latestBackup returns the newest backup among keys, or "".
+func latestBackup(keys []string) string {
+	latest := ""
+	for _, key := range keys {
+		name := key[strings.LastIndex(key, "/")+1:]
+		if strings.HasPrefix(name, backupKeyPrefix) && strings.HasSuffix(name, backupKeySuffix) && key > latest {
+			latest = key
+		}
+	}
+	return latest
+}
@@ -0,0 +1,222 @@
+package relay
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/oauth"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// BandwidthLimits caps the traffic the relay proxies between clients and
+// nodes, over client WebSockets and the SSH listener alike. Zero fields are
+// unlimited. Each replica enforces them on the traffic it proxies.
+type BandwidthLimits struct {
+	// NodeQuota is how many bytes a node's connections may carry a day
+	// (UTC), and UserQuota how many a user's may, across nodes. Connections
+	// over quota are closed and new ones refused until the day ends.
+	NodeQuota int64
+	UserQuota int64
+	// NodeRate throttles each node's connections, together, to this many
+	// bytes a second.
+	NodeRate int64
+}
+
+// errQuotaExceeded ends the connections of a node or user over its quota.
+var errQuotaExceeded = errors.New("bandwidth quota exceeded")
+
+// BandwidthUsage is the traffic the relay proxied for a node or user.
+type BandwidthUsage struct {
+	Name string `json:"name"`
+	// ToNode and FromNode count the bytes sent to and received from nodes
+	// since the relay started.
+	ToNode   int64 `json:"to_node"`
+	FromNode int64 `json:"from_node"`
+	// Today counts both directions since the start of the UTC day, against
+	// Quota (0 for none).
+	Today int64 `json:"today"`
+	Quota int64 `json:"quota,omitempty"`
+}
+
+// Bandwidth counts the bytes the relay proxies per node and per user, and
+// enforces BandwidthLimits on them.
+type Bandwidth struct {
+	mu     sync.Mutex
+	limits BandwidthLimits
+	day    string // UTC date the Today counts are for
+	nodes  map[string]*meter
+	users  map[string]*meter
+}
+
+// meter is the traffic of one node or user; nodes also keep the token
+// bucket of BandwidthLimits.NodeRate.
+type meter struct {
+	toNode, fromNode, today int64
+
+	tokens float64
+	last   time.Time
+}
+
+func newBandwidth() *Bandwidth {
+	return &Bandwidth{nodes: make(map[string]*meter), users: make(map[string]*meter)}
+}
+
+// SetLimits replaces the limits.
+func (b *Bandwidth) SetLimits(l BandwidthLimits) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limits = l
+}
+
+// rolloverLocked resets the Today counts if the day has changed.
+func (b *Bandwidth) rolloverLocked(now time.Time) {
+	day := now.UTC().Format(time.DateOnly)
+	if day == b.day {
+		return
+	}
+	for _, mt := range b.nodes {
+		mt.today = 0
+	}
+	for _, mt := range b.users {
+		mt.today = 0
+	}
+	b.day = day
+}
+
+// meterLocked returns name's meter in m.
+func (b *Bandwidth) meterLocked(m map[string]*meter, name string, now time.Time) *meter {
+	b.rolloverLocked(now)
+	mt := m[name]
+	if mt == nil {
+		mt = &meter{tokens: float64(b.limits.NodeRate), last: now}
+		m[name] = mt
+	}
+	return mt
+}
+
+// allow returns errQuotaExceeded if node or user (empty if unknown) is
+// over its quota.
+func (b *Bandwidth) allow(node, user string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if q := b.limits.NodeQuota; q > 0 && b.meterLocked(b.nodes, node, now).today >= q {
+		return errQuotaExceeded
+	}
+	if q := b.limits.UserQuota; q > 0 && user != "" && b.meterLocked(b.users, user, now).today >= q {
+		return errQuotaExceeded
+	}
+	return nil
+}
+
+// count adds n bytes sent to node, or received from it, on behalf of user.
+// It waits while the node is over its rate, and returns errQuotaExceeded
+// once the node or user is over quota.
+func (b *Bandwidth) count(ctx context.Context, node, user string, n int, toNode bool) error {
+	b.mu.Lock()
+	now := time.Now()
+	meters := []*meter{b.meterLocked(b.nodes, node, now)}
+	if user != "" {
+		meters = append(meters, b.meterLocked(b.users, user, now))
+	}
+	for _, mt := range meters {
+		if toNode {
+			mt.toNode += int64(n)
+		} else {
+			mt.fromNode += int64(n)
+		}
+		mt.today += int64(n)
+	}
+	over := (b.limits.NodeQuota > 0 && meters[0].today > b.limits.NodeQuota) ||
+		(b.limits.UserQuota > 0 && len(meters) > 1 && meters[1].today > b.limits.UserQuota)
+
+	// The bucket holds a second's worth of bytes and goes into debt for a
+	// message larger than what is left, which the wait then pays off.
+	var wait time.Duration
+	if rate := float64(b.limits.NodeRate); rate > 0 {
+		mt := meters[0]
+		mt.tokens = min(mt.tokens+now.Sub(mt.last).Seconds()*rate, rate) - float64(n)
+		mt.last = now
+		if mt.tokens < 0 {
+			wait = time.Duration(-mt.tokens / rate * float64(time.Second))
+		}
+	}
+	b.mu.Unlock()
+
+	if over {
+		return errQuotaExceeded
+	}
+	if wait > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return nil
+}
+
+// Usage returns the traffic of each node and user, by name.
+func (b *Bandwidth) Usage() (nodes, users []BandwidthUsage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rolloverLocked(time.Now())
+	list := func(m map[string]*meter, quota int64) []BandwidthUsage {
+		out := make([]BandwidthUsage, 0, len(m))
+		for name, mt := range m {
+			out = append(out, BandwidthUsage{Name: name, ToNode: mt.toNode, FromNode: mt.fromNode, Today: mt.today, Quota: quota})
+		}
+		slices.SortFunc(out, func(a, b BandwidthUsage) int { return cmp.Compare(a.Name, b.Name) })
+		return out
+	}
+	return list(b.nodes, b.limits.NodeQuota), list(b.users, b.limits.UserQuota)
+}
+
+// totals returns the bytes sent to and received from nodes since the relay
+// started.
+func (b *Bandwidth) totals() (toNode, fromNode int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, mt := range b.nodes {
+		toNode += mt.toNode
+		fromNode += mt.fromNode
+	}
+	return toNode, fromNode
+}
+
+// meteredWriter counts what it writes toward node and user.
+type meteredWriter struct {
+	ctx        context.Context
+	bw         *Bandwidth
+	node, user string
+	toNode     bool
+	w          io.Writer
+}
+
+func (m *meteredWriter) Write(p []byte) (int, error) {
+	if err := m.bw.count(m.ctx, m.node, m.user, len(p), m.toNode); err != nil {
+		return 0, err
+	}
+	return m.w.Write(p)
+}
+
+// RegisterBandwidthHandler adds GET /api/v1/bandwidth to mux, serving the
+// traffic this replica proxied per node and per user. Callers authenticate
+// with a session or the admin token, like the other management endpoints.
+func RegisterBandwidthHandler(mux *http.ServeMux, st store.Store, hub *NodeHub, adminToken string) {
+	mux.Handle("GET /api/v1/bandwidth", oauth.RequireAuth(st, adminToken)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nodes, users := hub.Bandwidth().Usage()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Nodes []BandwidthUsage `json:"nodes"`
+			Users []BandwidthUsage `json:"users"`
+		}{nodes, users})
+	})))
+}
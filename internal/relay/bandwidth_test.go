@@ -0,0 +1,82 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBandwidthQuota(t *testing.T) {
+	ctx := context.Background()
+	bw := newBandwidth()
+	bw.SetLimits(BandwidthLimits{NodeQuota: 100, UserQuota: 150})
+
+	if err := bw.count(ctx, "n1", "alice", 60, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.count(ctx, "n1", "alice", 40, false); err != nil {
+		t.Fatalf("count up to the quota: %v", err)
+	}
+	if err := bw.allow("n1", "alice"); !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("allow n1 at quota = %v, want errQuotaExceeded", err)
+	}
+	// alice has quota left on other nodes until her own runs out.
+	if err := bw.allow("n2", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.count(ctx, "n2", "alice", 51, true); !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("count over the user quota = %v, want errQuotaExceeded", err)
+	}
+	if err := bw.allow("n2", "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, users := bw.Usage()
+	if len(nodes) != 2 || nodes[0] != (BandwidthUsage{Name: "n1", ToNode: 60, FromNode: 40, Today: 100, Quota: 100}) {
+		t.Fatalf("node usage = %+v", nodes)
+	}
+	if len(users) != 2 || users[0].Name != "alice" || users[0].Today != 151 {
+		t.Fatalf("user usage = %+v", users)
+	}
+	if to, from := bw.totals(); to != 111 || from != 40 {
+		t.Fatalf("totals = %d, %d, want 111, 40", to, from)
+	}
+
+	// A new day resets the quotas but not the totals.
+	bw.mu.Lock()
+	bw.day = "2000-01-01"
+	bw.mu.Unlock()
+	if err := bw.allow("n1", "alice"); err != nil {
+		t.Fatalf("allow on a new day: %v", err)
+	}
+	nodes, _ = bw.Usage()
+	if nodes[0].Today != 0 || nodes[0].ToNode != 60 {
+		t.Fatalf("node usage on a new day = %+v", nodes[0])
+	}
+}
+
+func TestBandwidthRate(t *testing.T) {
+	ctx := context.Background()
+	bw := newBandwidth()
+	bw.SetLimits(BandwidthLimits{NodeRate: 1000})
+
+	// The first second's worth passes at once; the next 200 bytes wait
+	// about 200ms for the bucket to refill.
+	start := time.Now()
+	if err := bw.count(ctx, "n1", "", 1000, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.count(ctx, "n1", "", 200, true); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("over-rate count returned after %v, want about 200ms", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := bw.count(cancelled, "n1", "", 1000, true); !errors.Is(err, context.Canceled) {
+		t.Fatalf("count with a cancelled context = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,103 @@
+package relay
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/store"
+	"github.com/codewiresh/codewire/internal/update"
+)
+
+// RegisterUpdateChannelHandlers adds the admin endpoints managing update
+// channels. Nodes that set node.update_channel report it with their status
+// and are sent an Update message while their version differs from the
+// channel's.
+//
+//	GET    /api/v1/update-channels
+//	PUT    /api/v1/update-channels/{name}  — body {"version": "v0.2.48", "url": "<release base URL>"}
+//	DELETE /api/v1/update-channels/{name}
+func RegisterUpdateChannelHandlers(mux *http.ServeMux, st store.Store, authMiddleware func(http.Handler) http.Handler) {
+	mux.Handle("GET /api/v1/update-channels", authMiddleware(updateChannelListHandler(st)))
+	mux.Handle("PUT /api/v1/update-channels/{name}", authMiddleware(updateChannelSetHandler(st)))
+	mux.Handle("DELETE /api/v1/update-channels/{name}", authMiddleware(updateChannelDeleteHandler(st)))
+}
+
+func updateChannelListHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		channels, err := st.UpdateChannelList(r.Context())
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if channels == nil {
+			channels = []store.UpdateChannel{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(channels)
+	}
+}
+
+func updateChannelSetHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Version string `json:"version"`
+			URL     string `json:"url"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 16<<10)).Decode(&req); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if !update.ValidVersion(req.Version) {
+			http.Error(w, "version must be a release such as v0.2.48", http.StatusBadRequest)
+			return
+		}
+		if req.URL != "" {
+			if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				http.Error(w, "url must be an http(s) URL", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ch := store.UpdateChannel{
+			Name:      r.PathValue("name"),
+			Version:   req.Version,
+			URL:       req.URL,
+			UpdatedAt: time.Now().UTC(),
+		}
+		entry := store.AuditEntry{User: auditUser(r), Action: "update_channel.set", Result: "ok", RemoteIP: remoteIP(r)}
+		if err := st.UpdateChannelSet(r.Context(), ch); err != nil {
+			entry.Result = "internal error"
+			recordAudit(r.Context(), st, entry)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit(r.Context(), st, entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ch)
+	}
+}
+
+func updateChannelDeleteHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry := store.AuditEntry{User: auditUser(r), Action: "update_channel.delete", Result: "ok", RemoteIP: remoteIP(r)}
+		found, err := st.UpdateChannelDelete(r.Context(), r.PathValue("name"))
+		if err != nil {
+			entry.Result = "internal error"
+			recordAudit(r.Context(), st, entry)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			entry.Result = "channel not found"
+			recordAudit(r.Context(), st, entry)
+			http.Error(w, "channel not found", http.StatusNotFound)
+			return
+		}
+		recordAudit(r.Context(), st, entry)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,166 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// backRouteTTL bounds how long a replica waits for an SSH back-connection.
+// It only needs to outlast bridgeToNode's timeout.
+const backRouteTTL = time.Minute
+
+// forwardedHeader marks a back-connection already proxied by another
+// replica, so it is never proxied twice.
+const forwardedHeader = "X-Codewire-Relay-Forwarded"
+
+// Cluster lets relay replicas that share a store serve any request, so the
+// relay can run behind a load balancer without sticky sessions.
+//
+// Each replica records in the store which node agents are connected to it
+// and which SSH sessions are waiting on it for a back-connection. A hub
+// message for a node connected elsewhere is forwarded to that replica over
+// HTTP, and a back-connection that lands on the wrong replica is proxied to
+// the one holding the SSH session.
+type Cluster struct {
+	self   string // base URL other replicas reach this one at
+	secret string
+	st     store.Store
+	hub    *NodeHub
+	client *http.Client
+}
+
+// NewCluster routes hub and sessions through the cluster. advertise is this
+// replica's HTTP address as reachable by the other replicas (host:port or a
+// URL); secret authenticates forwarded hub messages and must be the same on
+// every replica.
+func NewCluster(st store.Store, hub *NodeHub, sessions *PendingSessions, advertise, secret string) *Cluster {
+	self := advertise
+	if !strings.Contains(self, "://") {
+		self = "http://" + self
+	}
+	c := &Cluster{
+		self:   strings.TrimRight(self, "/"),
+		secret: secret,
+		st:     st,
+		hub:    hub,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	hub.cluster = c
+	sessions.cluster = c
+	return c
+}
+
+// RegisterHandlers adds the replica-to-replica endpoint to mux.
+func (c *Cluster) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("POST /internal/v1/hub/{node}", c.hubForwardHandler)
+}
+
+func nodeRouteKey(name string) string         { return "node/" + name }
+func sessionRouteKey(sessionID string) string { return "session/" + sessionID }
+
+// claim records that this replica holds key.
+func (c *Cluster) claim(key string, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.st.RouteSet(ctx, key, c.self, ttl); err != nil {
+		slog.Error("cluster: recording route failed", "key", key, "err", err)
+	}
+}
+
+// release removes the route for key if it still points at this replica.
+func (c *Cluster) release(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.st.RouteDelete(ctx, key, c.self); err != nil {
+		slog.Error("cluster: removing route failed", "key", key, "err", err)
+	}
+}
+
+// forward delivers msg to a node connected to another replica.
+func (c *Cluster) forward(name string, msg HubMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	replica, err := c.st.RouteGet(ctx, nodeRouteKey(name))
+	if err != nil {
+		return fmt.Errorf("looking up node %q: %w", name, err)
+	}
+	if replica == "" || replica == c.self {
+		return fmt.Errorf("node %q not connected", name)
+	}
+
+	body, _ := json.Marshal(msg)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, replica+"/internal/v1/hub/"+url.PathEscape(name), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.secret)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("node %q not connected (replica %s unreachable: %w)", name, replica, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.New(strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (c *Cluster) hubForwardHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.secret)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var msg HubMessage
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&msg); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err := c.hub.sendLocal(r.PathValue("node"), msg); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// proxyBack hands a back-connection for an SSH session held by another
+// replica over to that replica. It returns false if no other replica is
+// waiting for sessionID.
+func (c *Cluster) proxyBack(w http.ResponseWriter, r *http.Request, sessionID string) bool {
+	if r.Header.Get(forwardedHeader) != "" {
+		return false
+	}
+	replica, err := c.st.RouteGet(r.Context(), sessionRouteKey(sessionID))
+	if err != nil || replica == "" || replica == c.self {
+		return false
+	}
+	target, err := url.Parse(replica)
+	if err != nil {
+		return false
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.Out.Header.Set(forwardedHeader, c.self)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+	return true
+}
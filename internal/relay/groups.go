@@ -0,0 +1,288 @@
+package relay
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"nhooyr.io/websocket"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/oauth"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// NodeHeader names, on the response to a group connection, the node the
+// client was placed on.
+const NodeHeader = "X-Codewire-Node"
+
+// errNoNode is returned by place when no node can take the client.
+var errNoNode = errors.New("no node is connected")
+
+// nodeRouter connects clients to the nodes that joined a group, which serve
+// them over a back-connection as on their /ws endpoint.
+type nodeRouter struct {
+	hub              *NodeHub
+	sessions         *PendingSessions
+	st               store.Store
+	strategies       map[string]Placement
+	defaultPlacement string
+}
+
+// RegisterGroupHandlers adds GET /api/v1/groups/{group}/ws and
+// GET /api/v1/nodes/{name}/ws to mux. Clients connect there, as to a node's
+// /ws, to reach a node of the group chosen by placement (the placement
+// query parameter or else defaultPlacement) or the named node. The relay
+// bridges the connection to the node over a back-connection. It also adds
+// POST /api/v1/sessions, which launches a session on a node so chosen.
+//
+// With cluster routing, a replica places clients on the group's nodes
+// connected to it.
+func RegisterGroupHandlers(mux *http.ServeMux, hub *NodeHub, sessions *PendingSessions, st store.Store, authMiddleware func(http.Handler) http.Handler, defaultPlacement string) {
+	rt := newNodeRouter(hub, sessions, st, defaultPlacement)
+	mux.Handle("GET /api/v1/groups/{group}/ws", authMiddleware(http.HandlerFunc(rt.groupConnectHandler)))
+	mux.Handle("GET /api/v1/nodes/{name}/ws", authMiddleware(http.HandlerFunc(rt.nodeConnectHandler)))
+	mux.Handle("POST /api/v1/sessions", authMiddleware(http.HandlerFunc(rt.sessionCreateHandler)))
+}
+
+// clientAuth wraps authMiddleware to also admit devices that joined with a
+// client-scoped invite, by their token, as the user who created the invite.
+// It guards the endpoints clients connect to nodes through.
+func clientAuth(st store.Store, authMiddleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		authed := authMiddleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+				if dev, err := st.NodeGetByToken(r.Context(), token); err == nil && dev != nil && dev.IsClient() {
+					id := &oauth.AuthIdentity{Username: dev.Name}
+					if dev.GitHubID != nil {
+						id.UserID = *dev.GitHubID
+					}
+					_ = st.NodeUpdateLastSeen(r.Context(), dev.Name)
+					next.ServeHTTP(w, r.WithContext(oauth.WithAuth(r.Context(), id)))
+					return
+				}
+			}
+			authed.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newNodeRouter(hub *NodeHub, sessions *PendingSessions, st store.Store, defaultPlacement string) *nodeRouter {
+	rt := &nodeRouter{hub: hub, sessions: sessions, st: st, strategies: make(map[string]Placement), defaultPlacement: defaultPlacement}
+	for _, name := range PlacementNames() {
+		rt.strategies[name], _ = NewPlacement(name)
+	}
+	return rt
+}
+
+// place picks the node of group (any group if empty) for a client of r,
+// among the nodes with room, and counts the client towards its load.
+func (rt *nodeRouter) place(r *http.Request, group, placement string) (string, error) {
+	name := cmp.Or(placement, rt.defaultPlacement)
+	strategy, ok := rt.strategies[name]
+	if !ok {
+		return "", fmt.Errorf("unknown placement %q (use one of %v)", name, PlacementNames())
+	}
+	nodes := ownedNodes(r, rt.st, rt.hub.Group(group))
+	if len(nodes) == 0 {
+		if group == "" {
+			return "", errNoNode
+		}
+		return "", fmt.Errorf("no node of group %q is connected: %w", group, errNoNode)
+	}
+	node := strategy.Place(group, withRoom(nodes))
+	rt.hub.Placed(node)
+	return node, nil
+}
+
+// dialNode asks node for a back-connection for sessionID. The HTTP status
+// returned describes the failure.
+func (rt *nodeRouter) dialNode(ctx context.Context, node, sessionID string) (*backConn, int, error) {
+	backCh := rt.sessions.Expect(sessionID)
+	defer rt.sessions.Cancel(sessionID)
+	if err := rt.hub.Send(node, HubMessage{Type: "ClientRequest", SessionID: sessionID}); err != nil {
+		return nil, http.StatusBadGateway, errors.New("node not connected")
+	}
+	select {
+	case conn, ok := <-backCh:
+		if !ok || conn == nil {
+			return nil, http.StatusBadGateway, errors.New("back-connection closed")
+		}
+		bc, ok := conn.(*backConn)
+		if !ok {
+			conn.Close()
+			return nil, http.StatusBadGateway, errors.New("back-connection is not a WebSocket")
+		}
+		bc.ws.SetReadLimit(-1)
+		return bc, 0, nil
+	case <-time.After(10 * time.Second):
+		return nil, http.StatusGatewayTimeout, errors.New("node connection timed out")
+	case <-ctx.Done():
+		return nil, http.StatusGatewayTimeout, ctx.Err()
+	}
+}
+
+func (rt *nodeRouter) groupConnectHandler(w http.ResponseWriter, r *http.Request) {
+	group := r.PathValue("group")
+	placement := cmp.Or(r.URL.Query().Get("placement"), rt.defaultPlacement)
+	node, err := rt.place(r, group, placement)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errNoNode) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	slog.Info("group: placed client", "group", group, "node", node, "placement", placement)
+	rt.bridge(w, r, node, "group.connect")
+}
+
+func (rt *nodeRouter) nodeConnectHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !slices.ContainsFunc(ownedNodes(r, rt.st, rt.hub.Group("")), func(n NodeLoad) bool { return n.Name == name }) {
+		http.Error(w, fmt.Sprintf("node %q is not connected or joined no group", name), http.StatusServiceUnavailable)
+		return
+	}
+	rt.bridge(w, r, name, "node.connect")
+}
+
+// bridge connects the client WebSocket of r to node, passing the client's
+// messages on as they are. The relay sees them in the clear: only SSH
+// through the relay as a jump host is end-to-end encrypted (see
+// HostKeyFile).
+func (rt *nodeRouter) bridge(w http.ResponseWriter, r *http.Request, node, action string) {
+	sessionID := generateSessionID()
+	entry := store.AuditEntry{User: auditUser(r), Node: node, Action: action, SessionID: sessionID, Result: "ok", RemoteIP: remoteIP(r)}
+	bw := rt.hub.Bandwidth()
+	if err := bw.allow(node, entry.User); err != nil {
+		entry.Result = err.Error()
+		recordAudit(r.Context(), rt.st, entry)
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	bc, status, err := rt.dialNode(r.Context(), node, sessionID)
+	if err != nil {
+		entry.Result = err.Error()
+		recordAudit(r.Context(), rt.st, entry)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer bc.Close()
+
+	w.Header().Set(NodeHeader, node)
+	ws, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		InsecureSkipVerify: true, // origin check done by token auth
+	})
+	if err != nil {
+		entry.Result = "websocket upgrade failed"
+		recordAudit(r.Context(), rt.st, entry)
+		return
+	}
+	defer ws.CloseNow()
+	recordAudit(r.Context(), rt.st, entry)
+	slog.Info("relay: bridging client", "node", node, "session", sessionID)
+
+	ws.SetReadLimit(-1)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	counter := func(toNode bool) func(int) error {
+		return func(n int) error { return bw.count(ctx, node, entry.User, n, toNode) }
+	}
+	go func() {
+		pumpMessages(ctx, ws, bc.ws, counter(false))
+		cancel()
+	}()
+	pumpMessages(ctx, bc.ws, ws, counter(true))
+}
+
+// pumpMessages copies WebSocket messages from src to dst until either
+// fails, then closes dst as src was closed. count, if not nil, is called
+// with each message's size before it is passed on; an error from it closes
+// both ends with a policy violation.
+func pumpMessages(ctx context.Context, dst, src *websocket.Conn, count func(int) error) {
+	for {
+		typ, data, err := src.Read(ctx)
+		if err != nil {
+			status := websocket.CloseStatus(err)
+			if status == -1 {
+				status = websocket.StatusGoingAway
+			}
+			dst.Close(status, "")
+			return
+		}
+		if count != nil {
+			if err := count(len(data)); err != nil {
+				if ctx.Err() == nil {
+					dst.Close(websocket.StatusPolicyViolation, err.Error())
+					src.Close(websocket.StatusPolicyViolation, err.Error())
+				}
+				return
+			}
+		}
+		if err := dst.Write(ctx, typ, data); err != nil {
+			return
+		}
+	}
+}
+
+// ownedNodes drops the nodes a GitHub user did not register. Other users,
+// who are not recorded as owning the nodes they register, reach all of them.
+func ownedNodes(r *http.Request, st store.Store, nodes []NodeLoad) []NodeLoad {
+	id := oauth.GetAuth(r.Context())
+	if id == nil || id.UserID == 0 {
+		return nodes
+	}
+	var owned []NodeLoad
+	for _, n := range nodes {
+		rec, err := st.NodeGet(r.Context(), n.Name)
+		if err == nil && rec != nil && rec.GitHubID != nil && *rec.GitHubID == id.UserID {
+			owned = append(owned, n)
+		}
+	}
+	return owned
+}
+
+// reportStatus sends the node's status to the relay until the connection
+// closes.
+func reportStatus(ctx context.Context, ws *websocket.Conn, status func() NodeStatus) {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		st := status()
+		st.Type = "NodeStatus"
+		data, _ := json.Marshal(st)
+		if err := ws.Write(ctx, websocket.MessageText, data); err != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleClientRequest dials the back-connection for a client connection the
+// relay placed on this node and serves it with cfg.Clients.
+func handleClientRequest(ctx context.Context, cfg AgentConfig, msg HubMessage) {
+	if cfg.Clients == nil || len(cfg.Groups) == 0 {
+		slog.Warn("relay agent: refusing client connection; the node joined no group", "session", msg.SessionID)
+		return
+	}
+	ws, err := dialBackWS(ctx, cfg, msg.SessionID)
+	if err != nil {
+		slog.Error("relay agent: back-connect failed", "err", err, "session", msg.SessionID)
+		return
+	}
+	defer ws.CloseNow()
+	cfg.Clients(connection.NewWSReader(ctx, ws), connection.NewWSWriter(ctx, ws))
+}
@@ -2,6 +2,8 @@ package relay
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 )
 
@@ -11,28 +13,95 @@ type HubMessage struct {
 	SessionID string `json:"session_id,omitempty"`
 	Cols      int    `json:"cols,omitempty"`
 	Rows      int    `json:"rows,omitempty"`
+	// Tunnel asks the node to serve SSH on the back-connection rather than a
+	// shell, for end-to-end encrypted sessions.
+	Tunnel bool `json:"tunnel,omitempty"`
+	// Command, if set, runs cw with these arguments instead of a login
+	// shell. The relay only sends the commands accepted by sshCommand.
+	Command   []string `json:"command,omitempty"`
+	RequestID string   `json:"request_id,omitempty"`
+	Body      string   `json:"body,omitempty"`
+	// Version and URL ask the node, in an Update message, to run the cw
+	// release Version downloaded from URL (the GitHub releases if empty).
+	Version string `json:"version,omitempty"`
+	URL     string `json:"url,omitempty"`
+	// Token is the node's new relay token, in a RotateToken message.
+	Token string `json:"token,omitempty"`
 }
 
-// NodeHub tracks connected node agents (in-memory).
+// NodeStatus is sent by a node agent to the relay to report its load and
+// health. Readings a node cannot take are 0.
+type NodeStatus struct {
+	Type     string `json:"type,omitempty"` // "NodeStatus"
+	Sessions int    `json:"sessions"`
+	// LoadAvg is the node's one-minute load average.
+	LoadAvg float64 `json:"load_avg,omitempty"`
+	// MaxSessions is the node's max_concurrent_sessions; 0 is unlimited.
+	MaxSessions int `json:"max_sessions,omitempty"`
+	CPUs        int `json:"cpus,omitempty"`
+	// MemTotal and MemAvailable are the node's memory in bytes.
+	MemTotal     uint64 `json:"mem_total,omitempty"`
+	MemAvailable uint64 `json:"mem_available,omitempty"`
+	// DiskFree is the space in bytes left to the node's data directory.
+	DiskFree uint64 `json:"disk_free,omitempty"`
+	Version  string `json:"version,omitempty"`
+	OS       string `json:"os,omitempty"`
+	Arch     string `json:"arch,omitempty"`
+	// Tags are the node's node.tags.
+	Tags []string `json:"tags,omitempty"`
+	// Channel is the update channel the node follows, if any.
+	Channel string `json:"channel,omitempty"`
+}
+
+// NodeHub tracks connected node agents (in-memory). With a Cluster, messages
+// for nodes connected to other replicas are forwarded to them.
 type NodeHub struct {
-	mu    sync.RWMutex
-	nodes map[string]chan<- HubMessage
+	mu      sync.RWMutex
+	nodes   map[string]chan<- HubMessage
+	cluster *Cluster
+
+	// groups, status and placed describe the nodes connected to this
+	// replica for placement: the groups each node joined, the status it
+	// last reported, and the clients placed on it since then.
+	groups map[string][]string
+	status map[string]NodeStatus
+	placed map[string]int
+
+	bandwidth *Bandwidth
 }
 
 func NewNodeHub() *NodeHub {
-	return &NodeHub{nodes: make(map[string]chan<- HubMessage)}
+	return &NodeHub{
+		nodes:     make(map[string]chan<- HubMessage),
+		groups:    make(map[string][]string),
+		status:    make(map[string]NodeStatus),
+		placed:    make(map[string]int),
+		bandwidth: newBandwidth(),
+	}
 }
 
+// Bandwidth returns the meter of the traffic proxied to the nodes.
+func (h *NodeHub) Bandwidth() *Bandwidth { return h.bandwidth }
+
 func (h *NodeHub) Register(name string, ch chan<- HubMessage) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	h.nodes[name] = ch
+	h.mu.Unlock()
+	if h.cluster != nil {
+		h.cluster.claim(nodeRouteKey(name), 0)
+	}
 }
 
 func (h *NodeHub) Unregister(name string) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	delete(h.nodes, name)
+	delete(h.groups, name)
+	delete(h.status, name)
+	delete(h.placed, name)
+	h.mu.Unlock()
+	if h.cluster != nil {
+		h.cluster.release(nodeRouteKey(name))
+	}
 }
 
 func (h *NodeHub) Has(name string) bool {
@@ -42,8 +111,75 @@ func (h *NodeHub) Has(name string) bool {
 	return ok
 }
 
+// Count returns the number of nodes connected to this replica.
+func (h *NodeHub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.nodes)
+}
+
+// SetGroups records the groups a connected node joined.
+func (h *NodeHub) SetGroups(name string, groups []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.nodes[name]; ok {
+		h.groups[name] = groups
+	}
+}
+
+// SetStatus records the status a connected node reports. It replaces the
+// clients placed on the node since its last report, which the status now
+// counts.
+func (h *NodeHub) SetStatus(name string, status NodeStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.nodes[name]; ok {
+		h.status[name] = status
+		h.placed[name] = 0
+	}
+}
+
+// Group returns the nodes connected to this replica that joined group, or
+// any group if group is empty, sorted by name, with their load.
+func (h *NodeHub) Group(group string) []NodeLoad {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var nodes []NodeLoad
+	for name, groups := range h.groups {
+		if group == "" || slices.Contains(groups, group) {
+			st := h.status[name]
+			nodes = append(nodes, NodeLoad{
+				Name:        name,
+				Load:        st.Sessions + h.placed[name],
+				LoadAvg:     st.LoadAvg,
+				MaxSessions: st.MaxSessions,
+			})
+		}
+	}
+	slices.SortFunc(nodes, func(a, b NodeLoad) int { return strings.Compare(a.Name, b.Name) })
+	return nodes
+}
+
+// Placed counts a client placed on name towards its load until the node
+// next reports it.
+func (h *NodeHub) Placed(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.nodes[name]; ok {
+		h.placed[name]++
+	}
+}
+
 // Send delivers a message to the named node. Returns error if node not connected.
 func (h *NodeHub) Send(name string, msg HubMessage) error {
+	if h.cluster != nil && !h.Has(name) {
+		return h.cluster.forward(name, msg)
+	}
+	return h.sendLocal(name, msg)
+}
+
+// sendLocal delivers a message to a node connected to this replica.
+func (h *NodeHub) sendLocal(name string, msg HubMessage) error {
 	h.mu.RLock()
 	ch, ok := h.nodes[name]
 	h.mu.RUnlock()
@@ -0,0 +1,174 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/oauth"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// inviteServer serves invite creation and redemption, and the client
+// endpoint clientAuth guards, which echoes the identity it sees.
+func inviteServer(t *testing.T) (*httptest.Server, store.Store) {
+	t.Helper()
+	st, err := store.NewSQLiteStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	deny := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/invites", inviteCreateHandler(st))
+	mux.HandleFunc("POST /api/v1/join", joinHandler(st))
+	mux.Handle("GET /whoami", clientAuth(st, deny)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(auditUser(r)))
+	})))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, st
+}
+
+func createInvite(t *testing.T, srv *httptest.Server, req inviteCreateRequest) (store.Invite, int) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	resp, err := http.Post(srv.URL+"/api/v1/invites", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var inv store.Invite
+	if resp.StatusCode == http.StatusOK {
+		json.NewDecoder(resp.Body).Decode(&inv)
+	}
+	return inv, resp.StatusCode
+}
+
+func TestInviteAssignsNodeIdentity(t *testing.T) {
+	srv, st := inviteServer(t)
+	ctx := context.Background()
+
+	inv, code := createInvite(t, srv, inviteCreateRequest{
+		Uses:             3,
+		Name:             "build-box-1",
+		Tags:             []string{"gpu", "linux"},
+		Scope:            store.ScopeNode,
+		ExpiresAfterJoin: true,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("creating invite: HTTP %d", code)
+	}
+
+	dir := t.TempDir()
+	if err := RunSetup(ctx, SetupOptions{RelayURL: srv.URL, DataDir: dir, Token: inv.Token}); err != nil {
+		t.Fatalf("RunSetup: %v", err)
+	}
+	cfg, err := config.LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Node.Name != "build-box-1" || !slices.Equal(cfg.Node.Tags, []string{"gpu", "linux"}) {
+		t.Fatalf("config node = %q %v, want build-box-1 [gpu linux]", cfg.Node.Name, cfg.Node.Tags)
+	}
+
+	rec, _ := st.NodeGet(ctx, "build-box-1")
+	if rec == nil || rec.Scope != store.ScopeNode || !slices.Equal(rec.Tags, []string{"gpu", "linux"}) {
+		t.Fatalf("node record = %+v", rec)
+	}
+	if node, _ := agentByToken(ctx, st, rec.Token); node == nil {
+		t.Fatal("node token rejected for the node endpoints")
+	}
+	// The invite had uses left, but expired with the join.
+	if got, _ := st.InviteGet(ctx, inv.Token); got != nil {
+		t.Fatalf("invite still valid after join: %+v", got)
+	}
+}
+
+func TestClientInvite(t *testing.T) {
+	srv, st := inviteServer(t)
+	ctx := context.Background()
+
+	inv, code := createInvite(t, srv, inviteCreateRequest{Name: "laptop", Scope: store.ScopeClient})
+	if code != http.StatusOK {
+		t.Fatalf("creating invite: HTTP %d", code)
+	}
+	dir := t.TempDir()
+	if err := RunSetup(ctx, SetupOptions{RelayURL: srv.URL, DataDir: dir, Token: inv.Token}); err != nil {
+		t.Fatalf("RunSetup: %v", err)
+	}
+
+	servers, err := config.LoadServersConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := servers.Servers["127.0.0.1"]
+	if !ok || entry.URL != srv.URL || entry.Token == "" {
+		t.Fatalf("servers.toml = %+v, want the relay saved with the client's token", servers.Servers)
+	}
+	if cfg, _ := config.LoadConfig(dir); cfg != nil && cfg.RelayToken != nil {
+		t.Fatal("client device was configured as a node")
+	}
+
+	// The token reaches nodes as a client, never as a node agent.
+	if node, _ := agentByToken(ctx, st, entry.Token); node != nil {
+		t.Fatal("client token accepted for the node endpoints")
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+entry.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var who bytes.Buffer
+	who.ReadFrom(resp.Body)
+	if resp.StatusCode != http.StatusOK || who.String() != "laptop" {
+		t.Fatalf("client endpoint: HTTP %d %q, want 200 laptop", resp.StatusCode, who.String())
+	}
+
+	// Node tokens and unknown tokens still need the usual authentication.
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n1", Token: "tok1", Scope: store.ScopeNode})
+	for _, token := range []string{"tok1", "bogus"} {
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("token %s: HTTP %d, want 401", token, resp.StatusCode)
+		}
+	}
+	if id := oauth.GetAuth(ctx); id != nil {
+		t.Fatal("identity leaked into the background context")
+	}
+}
+
+func TestInviteValidation(t *testing.T) {
+	srv, _ := inviteServer(t)
+	for name, req := range map[string]inviteCreateRequest{
+		"bad name":         {Name: "box.1"},
+		"bad tag":          {Tags: []string{"gpu,linux"}},
+		"bad scope":        {Scope: "admin"},
+		"client with tags": {Scope: store.ScopeClient, Tags: []string{"gpu"}},
+		"named reuse":      {Name: "box", Uses: 2},
+	} {
+		if _, code := createInvite(t, srv, req); code != http.StatusBadRequest {
+			t.Errorf("%s: HTTP %d, want 400", name, code)
+		}
+	}
+	if _, code := createInvite(t, srv, inviteCreateRequest{Name: "box", Uses: 2, ExpiresAfterJoin: true}); code != http.StatusOK {
+		t.Errorf("named invite expiring after join: HTTP %d, want 200", code)
+	}
+}
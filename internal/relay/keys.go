@@ -0,0 +1,152 @@
+package relay
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// rotateTimeout is how long a rotation waits for the node to reconnect with
+// its new token before giving up. The old token stays valid if it does.
+const rotateTimeout = 30 * time.Second
+
+// RegisterKeyHandlers adds the admin endpoints for the relay tokens of
+// registered devices: node tokens and client tokens.
+//
+//	GET  /api/v1/keys
+//	POST /api/v1/keys/{name}/rotate
+//
+// Rotation sends the node a new token over its relay connection. The node
+// saves it and reconnects with it, and that reconnection invalidates the old
+// token, so the node never holds a token the relay has already dropped.
+func RegisterKeyHandlers(mux *http.ServeMux, hub *NodeHub, st store.Store, authMiddleware func(http.Handler) http.Handler) {
+	mux.Handle("GET /api/v1/keys", authMiddleware(keyListHandler(st)))
+	mux.Handle("POST /api/v1/keys/{name}/rotate", authMiddleware(keyRotateHandler(hub, st)))
+}
+
+// keyResponse describes a device's token without revealing it.
+type keyResponse struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+	// ID identifies the token: the start of its SHA-256 hash.
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastUsedAt is when the node last reported to the relay, or the
+	// client last connected through it.
+	LastUsedAt time.Time `json:"last_used_at"`
+	Rotating   bool      `json:"rotating,omitempty"`
+}
+
+// tokenID returns the ID keyResponse shows for token.
+func tokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:6])
+}
+
+func keyListHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nodes, err := st.NodeList(r.Context())
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		keys := make([]keyResponse, 0, len(nodes))
+		for _, n := range nodes {
+			scope := n.Scope
+			if scope == "" {
+				scope = store.ScopeNode
+			}
+			keys = append(keys, keyResponse{
+				Name:       n.Name,
+				Scope:      scope,
+				ID:         tokenID(n.Token),
+				CreatedAt:  n.AuthorizedAt,
+				LastUsedAt: n.LastSeenAt,
+				Rotating:   n.PendingToken != "",
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+func keyRotateHandler(hub *NodeHub, st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		entry := store.AuditEntry{User: auditUser(r), Node: name, Action: "node.rotate", Result: "ok", RemoteIP: remoteIP(r)}
+		fail := func(msg string, code int) {
+			entry.Result = msg
+			recordAudit(r.Context(), st, entry)
+			http.Error(w, msg, code)
+		}
+
+		node, err := st.NodeGet(r.Context(), name)
+		if err != nil {
+			fail("internal error", http.StatusInternalServerError)
+			return
+		}
+		if node == nil {
+			fail("node not found", http.StatusNotFound)
+			return
+		}
+		if node.IsClient() {
+			fail("client tokens cannot be rotated; revoke the device and invite it again", http.StatusBadRequest)
+			return
+		}
+
+		token := generateToken()
+		if err := st.NodeSetPendingToken(r.Context(), name, token); err != nil {
+			fail("internal error", http.StatusInternalServerError)
+			return
+		}
+		if err := hub.Send(name, HubMessage{Type: "RotateToken", Token: token}); err != nil {
+			_ = st.NodeSetPendingToken(r.Context(), name, "")
+			fail("node not connected", http.StatusConflict)
+			return
+		}
+
+		// The node connect handler commits the token when the node
+		// reconnects with it.
+		deadline := time.Now().Add(rotateTimeout)
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+			}
+			node, err := st.NodeGet(r.Context(), name)
+			if err != nil || node == nil {
+				fail("node not found", http.StatusNotFound)
+				return
+			}
+			if node.Token == token {
+				recordAudit(r.Context(), st, entry)
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(keyResponse{
+					Name:       node.Name,
+					Scope:      store.ScopeNode,
+					ID:         tokenID(node.Token),
+					CreatedAt:  node.AuthorizedAt,
+					LastUsedAt: node.LastSeenAt,
+				})
+				return
+			}
+			if node.PendingToken != token {
+				fail("superseded by another rotation", http.StatusConflict)
+				return
+			}
+			if time.Now().After(deadline) {
+				// The token stays pending: a node that saved it
+				// completes the rotation when it next connects.
+				fail("node did not reconnect with the new token; the old token is still valid", http.StatusGatewayTimeout)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// kvMaxValueSize is the largest value accepted by PUT /api/v1/kv.
+const kvMaxValueSize = 1 << 20
+
+// RegisterKVHandlers adds the shared KV endpoints to mux. Callers
+// authenticate with a node token.
+//
+//	PUT    /api/v1/kv/{namespace}/{key}  — body is the value; X-TTL sets a TTL
+//	GET    /api/v1/kv/{namespace}/{key}
+//	DELETE /api/v1/kv/{namespace}/{key}
+//	GET    /api/v1/kv/{namespace}?prefix=
+//
+// A write that would take the namespace over its quota fails with 507.
+func RegisterKVHandlers(mux *http.ServeMux, st store.Store) {
+	mux.HandleFunc("PUT /api/v1/kv/{namespace}/{key}", nodeAuthMiddleware(st, kvSetHandler(st)))
+	mux.HandleFunc("GET /api/v1/kv/{namespace}/{key}", nodeAuthMiddleware(st, kvGetHandler(st)))
+	mux.HandleFunc("DELETE /api/v1/kv/{namespace}/{key}", nodeAuthMiddleware(st, kvDeleteHandler(st)))
+	mux.HandleFunc("GET /api/v1/kv/{namespace}", nodeAuthMiddleware(st, kvListHandler(st)))
+}
+
+func kvSetHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := r.PathValue("namespace")
+		key := r.PathValue("key")
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, kvMaxValueSize+1))
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if len(body) > kvMaxValueSize {
+			http.Error(w, fmt.Sprintf("value larger than %d bytes", kvMaxValueSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		var ttl *time.Duration
+		if ttlStr := r.Header.Get("X-TTL"); ttlStr != "" {
+			d, err := time.ParseDuration(ttlStr)
+			if err != nil || d <= 0 {
+				http.Error(w, "invalid X-TTL header", http.StatusBadRequest)
+				return
+			}
+			ttl = &d
+		}
+
+		if err := st.KVSet(r.Context(), ns, key, body, ttl); err != nil {
+			var qerr *store.KVQuotaError
+			if errors.As(err, &qerr) {
+				http.Error(w, qerr.Error(), http.StatusInsufficientStorage)
+				return
+			}
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func kvGetHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := r.PathValue("namespace")
+		key := r.PathValue("key")
+
+		val, err := st.KVGet(r.Context(), ns, key)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if val == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(val)
+	}
+}
+
+func kvDeleteHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := r.PathValue("namespace")
+		key := r.PathValue("key")
+
+		if err := st.KVDelete(r.Context(), ns, key); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func kvListHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ns := r.PathValue("namespace")
+		prefix := r.URL.Query().Get("prefix")
+
+		entries, err := st.KVList(r.Context(), ns, prefix)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if entries == nil {
+			entries = []store.KVEntry{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
@@ -0,0 +1,138 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// KVClient uses the relay's shared KV store on behalf of a node.
+type KVClient struct {
+	baseURL string
+	client  *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewKVClient returns a client for the KV API of the relay at relayURL,
+// authenticating with the node's relay token.
+func NewKVClient(relayURL, nodeToken string) *KVClient {
+	return &KVClient{
+		baseURL: strings.TrimRight(relayURL, "/"),
+		token:   nodeToken,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SetToken switches to the node's new relay token after a rotation.
+func (c *KVClient) SetToken(token string) {
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+}
+
+func (c *KVClient) keyURL(namespace, key string) string {
+	return c.baseURL + "/api/v1/kv/" + url.PathEscape(namespace) + "/" + url.PathEscape(key)
+}
+
+func (c *KVClient) do(ctx context.Context, method, u string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	c.mu.Lock()
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	c.mu.Unlock()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("contacting relay: %w", err)
+	}
+	return resp, nil
+}
+
+// kvError turns a failed relay response into an error carrying its message.
+func kvError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if s := strings.TrimSpace(string(msg)); s != "" {
+		return errors.New("relay: " + s)
+	}
+	return fmt.Errorf("relay: %s", resp.Status)
+}
+
+// Set stores value under namespace/key. A zero ttl never expires.
+func (c *KVClient) Set(ctx context.Context, namespace, key string, value []byte, ttl time.Duration) error {
+	header := http.Header{}
+	if ttl > 0 {
+		header.Set("X-TTL", ttl.String())
+	}
+	resp, err := c.do(ctx, http.MethodPut, c.keyURL(namespace, key), value, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return kvError(resp)
+	}
+	return nil
+}
+
+// Get returns the value under namespace/key, or nil if there is none.
+func (c *KVClient) Get(ctx context.Context, namespace, key string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.keyURL(namespace, key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	}
+	return nil, kvError(resp)
+}
+
+// Delete removes namespace/key.
+func (c *KVClient) Delete(ctx context.Context, namespace, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, c.keyURL(namespace, key), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return kvError(resp)
+	}
+	return nil
+}
+
+// List returns the live entries in namespace whose keys start with prefix.
+func (c *KVClient) List(ctx context.Context, namespace, prefix string) ([]store.KVEntry, error) {
+	u := c.baseURL + "/api/v1/kv/" + url.PathEscape(namespace) + "?prefix=" + url.QueryEscape(prefix)
+	resp, err := c.do(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, kvError(resp)
+	}
+	var entries []store.KVEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("parsing relay response: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,71 @@
+package relay_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/relay"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+func TestKVClientQuota(t *testing.T) {
+	st := newTestSQLiteStore(t)
+	ctx := context.Background()
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n1", Token: "tok1", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+	st.SetKVQuota(store.KVQuota{MaxKeys: 2})
+
+	mux := http.NewServeMux()
+	relay.RegisterKVHandlers(mux, st)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	kv := relay.NewKVClient(srv.URL, "tok1")
+	if err := kv.Set(ctx, "ns", "task/1", []byte("done"), 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := kv.Set(ctx, "ns", "task/2", []byte("running"), time.Minute); err != nil {
+		t.Fatalf("Set with TTL: %v", err)
+	}
+	if val, err := kv.Get(ctx, "ns", "task/1"); err != nil || string(val) != "done" {
+		t.Fatalf("Get = %q, %v; want done", val, err)
+	}
+	if val, err := kv.Get(ctx, "ns", "missing"); err != nil || val != nil {
+		t.Fatalf("Get missing = %q, %v; want nil", val, err)
+	}
+	entries, err := kv.List(ctx, "ns", "task/")
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("List = %+v, %v; want 2 entries", entries, err)
+	}
+
+	if err := kv.Set(ctx, "ns", "task/3", []byte("x"), 0); err == nil || !strings.Contains(err.Error(), "quota") {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+	if err := kv.Delete(ctx, "ns", "task/1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := kv.Set(ctx, "ns", "task/3", []byte("x"), 0); err != nil {
+		t.Fatalf("Set after delete: %v", err)
+	}
+
+	// The KV API is only open to registered nodes.
+	if _, err := relay.NewKVClient(srv.URL, "wrong").Get(ctx, "ns", "task/3"); err == nil {
+		t.Fatal("expected an unknown token to be refused")
+	}
+
+	resp, err := http.DefaultClient.Do(func() *http.Request {
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/api/v1/kv/ns/big", strings.NewReader(strings.Repeat("x", 1<<20+1)))
+		req.Header.Set("Authorization", "Bearer tok1")
+		return req
+	}())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for an oversized value, got %d", resp.StatusCode)
+	}
+}
@@ -15,6 +15,11 @@ import (
 // RegisterNodeConnectHandler adds GET /node/connect to mux.
 // Nodes connect here with Authorization: Bearer <node-token>.
 // The handler registers them in the hub and streams HubMessages to the node.
+// Nodes list the groups they joined as group query parameters and report
+// their load and health as NodeStatus messages, which are kept in the store
+// for GET /api/v1/nodes. A node following an update channel that wants
+// another version is sent an Update message in reply. A node connecting
+// with the token a rotation issued completes the rotation.
 func RegisterNodeConnectHandler(mux *http.ServeMux, hub *NodeHub, st store.Store) {
 	mux.HandleFunc("GET /node/connect", func(w http.ResponseWriter, r *http.Request) {
 		// Authenticate node.
@@ -23,11 +28,20 @@ func RegisterNodeConnectHandler(mux *http.ServeMux, hub *NodeHub, st store.Store
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
-		node, err := st.NodeGetByToken(r.Context(), token)
+		node, err := agentByToken(r.Context(), st, token)
 		if err != nil || node == nil {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if token == node.PendingToken {
+			// The node saved the token a rotation sent it, so its old
+			// token can go.
+			if err := st.NodeCommitToken(r.Context(), node.Name); err != nil {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			slog.Info("node agent token rotated", "node", node.Name)
+		}
 
 		// Upgrade to WebSocket.
 		ws, err := websocket.Accept(w, r, &websocket.AcceptOptions{
@@ -44,6 +58,9 @@ func RegisterNodeConnectHandler(mux *http.ServeMux, hub *NodeHub, st store.Store
 		msgCh := make(chan HubMessage, 16)
 		hub.Register(node.Name, msgCh)
 		defer hub.Unregister(node.Name)
+		if groups := r.URL.Query()["group"]; len(groups) > 0 {
+			hub.SetGroups(node.Name, groups)
+		}
 
 		_ = st.NodeUpdateLastSeen(r.Context(), node.Name)
 
@@ -67,17 +84,45 @@ func RegisterNodeConnectHandler(mux *http.ServeMux, hub *NodeHub, st store.Store
 			}
 		}()
 
-		// Read loop: keep connection alive (nodes may send pings or status).
+		// Read loop: keep connection alive and record the node's status.
 		for {
-			_, _, err := ws.Read(ctx)
+			_, data, err := ws.Read(ctx)
 			if err != nil {
 				slog.Info("node agent disconnected", "node", node.Name, "err", err)
 				return
 			}
+			var status NodeStatus
+			if json.Unmarshal(data, &status) == nil && status.Type == "NodeStatus" {
+				if len(node.Tags) > 0 {
+					// The tags the node's invite assigned win.
+					status.Tags = node.Tags
+				}
+				hub.SetStatus(node.Name, status)
+				status.Type = ""
+				report, _ := json.Marshal(status)
+				_ = st.NodeUpdateStatus(ctx, node.Name, string(report))
+				offerUpdate(ctx, st, msgCh, status)
+			}
 		}
 	})
 }
 
+// offerUpdate asks the node that sent status to update if its channel wants
+// another version. The node ignores offers while it is updating.
+func offerUpdate(ctx context.Context, st store.Store, msgCh chan<- HubMessage, status NodeStatus) {
+	if status.Channel == "" {
+		return
+	}
+	ch, err := st.UpdateChannelGet(ctx, status.Channel)
+	if err != nil || ch == nil || ch.Version == status.Version {
+		return
+	}
+	select {
+	case msgCh <- HubMessage{Type: "Update", Version: ch.Version, URL: ch.URL}:
+	default:
+	}
+}
+
 // nodeAuthFromRequest extracts and validates the node token from the
 // Authorization header. Returns the NodeRecord or nil if unauthorized.
 func nodeAuthFromRequest(r *http.Request, st store.Store) (*store.NodeRecord, error) {
@@ -85,7 +130,17 @@ func nodeAuthFromRequest(r *http.Request, st store.Store) (*store.NodeRecord, er
 	if token == "" {
 		return nil, nil
 	}
-	return st.NodeGetByToken(r.Context(), token)
+	return agentByToken(r.Context(), st, token)
+}
+
+// agentByToken returns the node whose token is token, or nil if there is
+// none or the token belongs to a client device, which may not act as a node.
+func agentByToken(ctx context.Context, st store.Store, token string) (*store.NodeRecord, error) {
+	node, err := st.NodeGetByToken(ctx, token)
+	if err != nil || node == nil || node.IsClient() {
+		return nil, err
+	}
+	return node, nil
 }
 
 // nodeAuthMiddleware wraps h with node token authentication.
@@ -0,0 +1,97 @@
+package relay
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// NodeLoad is a placement candidate: a connected node, the number of
+// sessions it runs, its load average and its session limit (0 for none).
+type NodeLoad struct {
+	Name        string  `json:"name"`
+	Load        int     `json:"load"`
+	LoadAvg     float64 `json:"load_avg,omitempty"`
+	MaxSessions int     `json:"max_sessions,omitempty"`
+}
+
+// Full reports whether a launch on the node would queue.
+func (n NodeLoad) Full() bool {
+	return n.MaxSessions > 0 && n.Load >= n.MaxSessions
+}
+
+// Placement picks the node of a group that a client connection is sent to.
+// nodes is never empty and is sorted by name.
+type Placement interface {
+	Place(group string, nodes []NodeLoad) string
+}
+
+// withRoom returns the nodes that are not full, or all of them if every
+// node is, so that the launch queues rather than fails.
+func withRoom(nodes []NodeLoad) []NodeLoad {
+	var room []NodeLoad
+	for _, n := range nodes {
+		if !n.Full() {
+			room = append(room, n)
+		}
+	}
+	if len(room) == 0 {
+		return nodes
+	}
+	return room
+}
+
+// DefaultPlacement is the strategy used when neither the relay nor the
+// client names one.
+const DefaultPlacement = "least-loaded"
+
+// placements holds the built-in strategies by name.
+var placements = map[string]func() Placement{
+	"least-loaded": func() Placement { return leastLoaded{} },
+	"round-robin":  func() Placement { return &roundRobin{next: make(map[string]int)} },
+}
+
+// PlacementNames returns the names of the built-in strategies, sorted.
+func PlacementNames() []string {
+	names := make([]string, 0, len(placements))
+	for name := range placements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPlacement returns the built-in strategy called name.
+func NewPlacement(name string) (Placement, error) {
+	newPlacement, ok := placements[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown placement %q (use one of %v)", name, PlacementNames())
+	}
+	return newPlacement(), nil
+}
+
+// leastLoaded places a client on the node running the fewest sessions,
+// breaking ties by load average and then by name.
+type leastLoaded struct{}
+
+func (leastLoaded) Place(_ string, nodes []NodeLoad) string {
+	return slices.MinFunc(nodes, func(a, b NodeLoad) int {
+		return cmp.Or(cmp.Compare(a.Load, b.Load), cmp.Compare(a.LoadAvg, b.LoadAvg))
+	}).Name
+}
+
+// roundRobin places each group's clients on its nodes in turn.
+type roundRobin struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+func (p *roundRobin) Place(group string, nodes []NodeLoad) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := p.next[group] % len(nodes)
+	p.next[group] = i + 1
+	return nodes[i].Name
+}
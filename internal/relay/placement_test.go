@@ -0,0 +1,80 @@
+package relay_test
+
+import (
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/relay"
+)
+
+func TestPlacementLeastLoaded(t *testing.T) {
+	p, err := relay.NewPlacement("least-loaded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := []relay.NodeLoad{{Name: "a", Load: 3}, {Name: "b", Load: 1}, {Name: "c", Load: 1}}
+	if got := p.Place("gpu", nodes); got != "b" {
+		t.Fatalf("placed on %s, want b", got)
+	}
+	// Equal session counts are broken by load average.
+	nodes = []relay.NodeLoad{{Name: "a", Load: 1, LoadAvg: 2.5}, {Name: "b", Load: 1, LoadAvg: 0.5}}
+	if got := p.Place("gpu", nodes); got != "b" {
+		t.Fatalf("placed on %s, want b", got)
+	}
+}
+
+func TestPlacementRoundRobin(t *testing.T) {
+	p, err := relay.NewPlacement("round-robin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := []relay.NodeLoad{{Name: "a"}, {Name: "b"}}
+	var got []string
+	for range 3 {
+		got = append(got, p.Place("gpu", nodes))
+	}
+	if got[0] != "a" || got[1] != "b" || got[2] != "a" {
+		t.Fatalf("placed on %v", got)
+	}
+	// Each group has its own turn.
+	if got := p.Place("cpu", nodes); got != "a" {
+		t.Fatalf("first cpu placement on %s, want a", got)
+	}
+}
+
+func TestPlacementUnknown(t *testing.T) {
+	if _, err := relay.NewPlacement("random"); err == nil {
+		t.Fatal("expected error for unknown placement")
+	}
+}
+
+func TestHubGroup(t *testing.T) {
+	h := relay.NewNodeHub()
+	h.Register("n2", nil)
+	h.Register("n1", nil)
+	h.Register("n3", nil)
+	h.SetGroups("n1", []string{"gpu"})
+	h.SetGroups("n2", []string{"gpu", "cpu"})
+	h.SetStatus("n2", relay.NodeStatus{Sessions: 4, LoadAvg: 1.5, MaxSessions: 4})
+	h.Placed("n1")
+
+	nodes := h.Group("gpu")
+	if len(nodes) != 2 || nodes[0] != (relay.NodeLoad{Name: "n1", Load: 1}) || nodes[1] != (relay.NodeLoad{Name: "n2", Load: 4, LoadAvg: 1.5, MaxSessions: 4}) {
+		t.Fatalf("gpu = %+v", nodes)
+	}
+	// A report replaces the placements counted since the last one.
+	h.SetStatus("n1", relay.NodeStatus{})
+	if nodes := h.Group("gpu"); nodes[0].Load != 0 {
+		t.Fatalf("n1 load after report = %d", nodes[0].Load)
+	}
+	if !nodes[1].Full() {
+		t.Fatalf("n2 at its session limit is not full: %+v", nodes[1])
+	}
+	// The empty group holds every node that joined one.
+	if nodes := h.Group(""); len(nodes) != 2 {
+		t.Fatalf("all groups = %+v", nodes)
+	}
+	h.Unregister("n2")
+	if nodes := h.Group("cpu"); len(nodes) != 0 {
+		t.Fatalf("cpu after unregister = %+v", nodes)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"os"
@@ -13,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/codewiresh/codewire/internal/config"
 	"github.com/codewiresh/codewire/internal/oauth"
 	"github.com/codewiresh/codewire/internal/store"
 )
@@ -27,6 +27,21 @@ type RelayConfig struct {
 	SSHListenAddr string
 	// DataDir is where relay.db lives.
 	DataDir string
+	// DatabaseURL selects a PostgreSQL store instead of relay.db in DataDir.
+	// Every replica must share one when running more than one.
+	DatabaseURL string
+	// KVMaxKeys and KVMaxBytes limit each KV namespace. Zero is unlimited.
+	KVMaxKeys  int
+	KVMaxBytes int64
+	// NodeQuota, UserQuota and NodeRate limit the traffic proxied to nodes,
+	// as BandwidthLimits. Zero is unlimited.
+	NodeQuota int64
+	UserQuota int64
+	NodeRate  int64
+	// AdvertiseAddr is the HTTP address other replicas reach this one at
+	// (e.g. 10.0.0.5:8080). Setting it enables cross-replica routing, which
+	// requires DatabaseURL and AuthToken.
+	AdvertiseAddr string
 	// AuthMode controls authentication: "oidc", "github", "token", "none".
 	AuthMode string
 	// AuthToken is the shared secret when AuthMode is "token" or as fallback.
@@ -47,6 +62,9 @@ type RelayConfig struct {
 	// OIDCAllowedGroups restricts access to members of these groups.
 	// Empty means any authenticated user is allowed.
 	OIDCAllowedGroups []string
+	// Placement is the strategy that picks the node of a group a client
+	// is sent to, unless the client names one (default "least-loaded").
+	Placement string
 }
 
 // RunRelay starts the relay server. It blocks until ctx is cancelled.
@@ -58,15 +76,41 @@ func RunRelay(ctx context.Context, cfg RelayConfig) error {
 		cfg.SSHListenAddr = ":2222"
 	}
 
-	st, err := store.NewSQLiteStore(cfg.DataDir)
+	if cfg.AdvertiseAddr != "" && (cfg.DatabaseURL == "" || cfg.AuthToken == "") {
+		return fmt.Errorf("--advertise-addr requires --database-url and --auth-token")
+	}
+	if cfg.Placement == "" {
+		cfg.Placement = DefaultPlacement
+	}
+	if _, err := NewPlacement(cfg.Placement); err != nil {
+		return err
+	}
+
+	var st store.Store
+	var err error
+	if cfg.DatabaseURL != "" {
+		st, err = store.NewPostgresStore(ctx, cfg.DatabaseURL)
+	} else {
+		st, err = store.NewSQLiteStore(cfg.DataDir)
+	}
 	if err != nil {
 		return fmt.Errorf("opening store: %w", err)
 	}
 	defer st.Close()
+	st.SetKVQuota(store.KVQuota{MaxKeys: cfg.KVMaxKeys, MaxBytes: cfg.KVMaxBytes})
 
 	hub := NewNodeHub()
+	hub.Bandwidth().SetLimits(BandwidthLimits{NodeQuota: cfg.NodeQuota, UserQuota: cfg.UserQuota, NodeRate: cfg.NodeRate})
 	sessions := NewPendingSessions()
 
+	// With a shared store, route hub messages and back-connections to
+	// whichever replica holds the node or SSH session.
+	var cluster *Cluster
+	if cfg.AdvertiseAddr != "" {
+		cluster = NewCluster(st, hub, sessions, cfg.AdvertiseAddr, cfg.AuthToken)
+		fmt.Fprintf(os.Stderr, "[relay] cluster routing enabled (advertise=%s)\n", cfg.AdvertiseAddr)
+	}
+
 	sshSrv, err := NewSSHServer(st, hub, sessions)
 	if err != nil {
 		return fmt.Errorf("creating SSH server: %w", err)
@@ -81,7 +125,10 @@ func RunRelay(ctx context.Context, cfg RelayConfig) error {
 	fmt.Fprintf(os.Stderr, "[relay] SSH listening on %s\n", cfg.SSHListenAddr)
 
 	// Build HTTP mux.
-	mux := buildMux(hub, sessions, st, cfg)
+	mux := buildMux(hub, sessions, sshSrv, st, cfg)
+	if cluster != nil {
+		cluster.RegisterHandlers(mux)
+	}
 
 	httpSrv := &http.Server{Addr: cfg.ListenAddr, Handler: mux}
 	errCh := make(chan error, 1)
@@ -104,16 +151,22 @@ func RunRelay(ctx context.Context, cfg RelayConfig) error {
 	}
 }
 
-// BuildRelayMux creates an HTTP mux with node agent endpoints (no OAuth, no GitHub).
+// BuildRelayMux creates an HTTP mux with node agent endpoints, group
+// connections, the node list, update channels and device keys (no OAuth,
+// no GitHub).
 // Used in tests; RunRelay calls the full buildMux.
 func BuildRelayMux(hub *NodeHub, sessions *PendingSessions, st store.Store) http.Handler {
 	mux := http.NewServeMux()
 	RegisterNodeConnectHandler(mux, hub, st)
 	RegisterBackHandler(mux, sessions, st)
+	RegisterGroupHandlers(mux, hub, sessions, st, func(h http.Handler) http.Handler { return h }, DefaultPlacement)
+	mux.HandleFunc("GET /api/v1/nodes", nodesListHandler(st))
+	RegisterUpdateChannelHandlers(mux, st, func(h http.Handler) http.Handler { return h })
+	RegisterKeyHandlers(mux, hub, st, func(h http.Handler) http.Handler { return h })
 	return mux
 }
 
-func buildMux(hub *NodeHub, sessions *PendingSessions, st store.Store, cfg RelayConfig) *http.ServeMux {
+func buildMux(hub *NodeHub, sessions *PendingSessions, sshSrv *SSHServer, st store.Store, cfg RelayConfig) *http.ServeMux {
 	authMiddleware := oauth.RequireAuth(st, cfg.AuthToken)
 	joinRL := newRateLimiter(10, time.Minute)
 
@@ -123,6 +176,12 @@ func buildMux(hub *NodeHub, sessions *PendingSessions, st store.Store, cfg Relay
 	RegisterNodeConnectHandler(mux, hub, st)
 	RegisterBackHandler(mux, sessions, st)
 
+	// Client connections placed on a node of a group.
+	RegisterGroupHandlers(mux, hub, sessions, st, clientAuth(st, authMiddleware), cfg.Placement)
+
+	// Gateway escalation approvals.
+	RegisterApprovalHandlers(mux, hub, st, cfg.BaseURL)
+
 	// GitHub OAuth (when AuthMode == "github").
 	if cfg.AuthMode == "github" {
 		mux.HandleFunc("GET /auth/github/manifest/callback", oauth.ManifestCallbackHandler(st, cfg.BaseURL))
@@ -179,15 +238,28 @@ func buildMux(hub *NodeHub, sessions *PendingSessions, st store.Store, cfg Relay
 	mux.Handle("GET /api/v1/invites", authMiddleware(http.HandlerFunc(inviteListHandler(st))))
 	mux.Handle("DELETE /api/v1/invites/{token}", authMiddleware(http.HandlerFunc(inviteDeleteHandler(st))))
 
+	// Update channels: the cw version nodes following each should run.
+	RegisterUpdateChannelHandlers(mux, st, authMiddleware)
+
+	// Device tokens: listing and rotation over the node's connection.
+	RegisterKeyHandlers(mux, hub, st, authMiddleware)
+
+	// Audit log of relayed and administrative actions.
+	RegisterAuditHandler(mux, st, cfg.AuthToken)
+	RegisterBandwidthHandler(mux, st, hub, cfg.AuthToken)
+
 	// Invite redemption (public, rate-limited).
 	mux.HandleFunc("POST /api/v1/join", rateLimitMiddleware(joinRL, joinHandler(st)))
 	mux.HandleFunc("GET /join", joinPageHandler(cfg.BaseURL))
 
-	// KV API.
-	mux.HandleFunc("PUT /api/v1/kv/{namespace}/{key}", kvSetHandler(st))
-	mux.HandleFunc("GET /api/v1/kv/{namespace}/{key}", kvGetHandler(st))
-	mux.HandleFunc("DELETE /api/v1/kv/{namespace}/{key}", kvDeleteHandler(st))
-	mux.HandleFunc("GET /api/v1/kv/{namespace}", kvListHandler(st))
+	// KV API (node-authenticated; nodes proxy cw kv here).
+	RegisterKVHandlers(mux, st)
+
+	// Client keys for the SSH listener (node-authenticated; see cw key).
+	RegisterSSHKeyHandlers(mux, st)
+
+	// Activity counts, as JSON and for Prometheus.
+	RegisterStatsHandlers(mux, st, hub, sshSrv)
 
 	// Health check.
 	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -224,10 +296,14 @@ func nodeRegisterHandler(st store.Store) http.HandlerFunc {
 			AuthorizedAt: time.Now().UTC(),
 			LastSeenAt:   time.Now().UTC(),
 		}
+		entry := store.AuditEntry{User: auditUser(r), Node: req.NodeName, Action: "node.register", Result: "ok", RemoteIP: remoteIP(r)}
 		if err := st.NodeRegister(r.Context(), node); err != nil {
+			entry.Result = "internal error"
+			recordAudit(r.Context(), st, entry)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
+		recordAudit(r.Context(), st, entry)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
@@ -243,17 +319,23 @@ func nodeRegisterHandler(st store.Store) http.HandlerFunc {
 func nodeRevokeHandler(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		name := r.PathValue("name")
+		entry := store.AuditEntry{User: auditUser(r), Node: name, Action: "node.revoke", Result: "ok", RemoteIP: remoteIP(r)}
 
 		node, err := st.NodeGet(r.Context(), name)
 		if err != nil || node == nil {
+			entry.Result = "node not found"
+			recordAudit(r.Context(), st, entry)
 			http.Error(w, "node not found", http.StatusNotFound)
 			return
 		}
 
 		if err := st.NodeDelete(r.Context(), name); err != nil {
+			entry.Result = "internal error"
+			recordAudit(r.Context(), st, entry)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
+		recordAudit(r.Context(), st, entry)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
@@ -266,8 +348,10 @@ func nodeRevokeHandler(st store.Store) http.HandlerFunc {
 // --- Node Discovery ---
 
 type nodeResponse struct {
-	Name      string `json:"name"`
-	Connected bool   `json:"connected"`
+	Name       string      `json:"name"`
+	Connected  bool        `json:"connected"`
+	LastSeenAt time.Time   `json:"last_seen_at"`
+	Status     *NodeStatus `json:"status,omitempty"` // as last reported
 }
 
 func nodesListHandler(st store.Store) http.HandlerFunc {
@@ -281,10 +365,18 @@ func nodesListHandler(st store.Store) http.HandlerFunc {
 		resp := make([]nodeResponse, 0, len(nodes))
 		for _, n := range nodes {
 			connected := time.Since(n.LastSeenAt) < 2*time.Minute
-			resp = append(resp, nodeResponse{
-				Name:      n.Name,
-				Connected: connected,
-			})
+			node := nodeResponse{
+				Name:       n.Name,
+				Connected:  connected,
+				LastSeenAt: n.LastSeenAt,
+			}
+			if n.Status != "" {
+				var status NodeStatus
+				if json.Unmarshal([]byte(n.Status), &status) == nil {
+					node.Status = &status
+				}
+			}
+			resp = append(resp, node)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -295,8 +387,39 @@ func nodesListHandler(st store.Store) http.HandlerFunc {
 // --- Invite Handlers ---
 
 type inviteCreateRequest struct {
-	Uses int    `json:"uses"`
-	TTL  string `json:"ttl"`
+	Uses             int      `json:"uses"`
+	TTL              string   `json:"ttl"`
+	Name             string   `json:"name"`
+	Tags             []string `json:"tags"`
+	Scope            string   `json:"scope"`
+	ExpiresAfterJoin bool     `json:"expires_after_join"`
+}
+
+// validate checks the identity and scope the invite assigns.
+func (req *inviteCreateRequest) validate() error {
+	if req.Name != "" {
+		if err := config.ValidateNodeName(req.Name); err != nil {
+			return err
+		}
+	}
+	for _, tag := range req.Tags {
+		if tag == "" || strings.ContainsAny(tag, ", \t\n") {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+	switch req.Scope {
+	case "", store.ScopeNode:
+	case store.ScopeClient:
+		if len(req.Tags) > 0 {
+			return fmt.Errorf("tags are for node invites")
+		}
+	default:
+		return fmt.Errorf("scope must be %q or %q", store.ScopeNode, store.ScopeClient)
+	}
+	if req.Name != "" && req.Uses > 1 && !req.ExpiresAfterJoin {
+		return fmt.Errorf("an invite with a name registers one device; use uses 1 or expires_after_join")
+	}
+	return nil
 }
 
 func inviteCreateHandler(st store.Store) http.HandlerFunc {
@@ -307,6 +430,10 @@ func inviteCreateHandler(st store.Store) http.HandlerFunc {
 		if req.Uses <= 0 {
 			req.Uses = 1
 		}
+		if err := req.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		ttl := time.Hour
 		if req.TTL != "" {
@@ -331,12 +458,21 @@ func inviteCreateHandler(st store.Store) http.HandlerFunc {
 			UsesRemaining: req.Uses,
 			ExpiresAt:     now.Add(ttl),
 			CreatedAt:     now,
+
+			Name:             req.Name,
+			Tags:             req.Tags,
+			Scope:            req.Scope,
+			ExpiresAfterJoin: req.ExpiresAfterJoin,
 		}
 
+		entry := store.AuditEntry{User: auditUser(r), Action: "invite.create", Result: "ok", RemoteIP: remoteIP(r)}
 		if err := st.InviteCreate(r.Context(), invite); err != nil {
+			entry.Result = "internal error"
+			recordAudit(r.Context(), st, entry)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
+		recordAudit(r.Context(), st, entry)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(invite)
@@ -358,10 +494,14 @@ func inviteListHandler(st store.Store) http.HandlerFunc {
 func inviteDeleteHandler(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		token := r.PathValue("token")
+		entry := store.AuditEntry{User: auditUser(r), Action: "invite.delete", Result: "ok", RemoteIP: remoteIP(r)}
 		if err := st.InviteDelete(r.Context(), token); err != nil {
+			entry.Result = "invite not found"
+			recordAudit(r.Context(), st, entry)
 			http.Error(w, "invite not found", http.StatusNotFound)
 			return
 		}
+		recordAudit(r.Context(), st, entry)
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -373,6 +513,16 @@ type joinRequest struct {
 	InviteToken string `json:"invite_token"`
 }
 
+// joinResponse gives the device its token and the identity the invite
+// assigned it.
+type joinResponse struct {
+	Status    string   `json:"status"`
+	NodeToken string   `json:"node_token"`
+	NodeName  string   `json:"node_name"`
+	Scope     string   `json:"scope"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
 func joinHandler(st store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req joinRequest
@@ -381,44 +531,67 @@ func joinHandler(st store.Store) http.HandlerFunc {
 			return
 		}
 
-		if req.NodeName == "" || req.InviteToken == "" {
-			http.Error(w, "node_name and invite_token required", http.StatusBadRequest)
+		if req.InviteToken == "" {
+			http.Error(w, "invite_token required", http.StatusBadRequest)
 			return
 		}
 
-		// Look up invite before consuming (for github_id association).
+		// Look up invite before consuming, for the identity it assigns and
+		// the github_id association.
 		invite, _ := st.InviteGet(r.Context(), req.InviteToken)
+		name := req.NodeName
+		if invite != nil && invite.Name != "" {
+			name = invite.Name
+		}
+		if name == "" {
+			http.Error(w, "node_name and invite_token required", http.StatusBadRequest)
+			return
+		}
+
+		entry := store.AuditEntry{Node: name, Action: "node.join", Result: "ok", RemoteIP: remoteIP(r)}
 
 		// Consume invite (validates + decrements uses).
 		if err := st.InviteConsume(r.Context(), req.InviteToken); err != nil {
+			entry.Result = "invalid or expired invite"
+			recordAudit(r.Context(), st, entry)
 			http.Error(w, "invalid or expired invite", http.StatusForbidden)
 			return
 		}
 
-		var githubID *int64
-		if invite != nil && invite.CreatedBy != nil {
-			githubID = invite.CreatedBy
-		}
-
 		token := generateToken()
 		node := store.NodeRecord{
-			Name:         req.NodeName,
+			Name:         name,
 			Token:        token,
-			GitHubID:     githubID,
+			Scope:        store.ScopeNode,
 			AuthorizedAt: time.Now().UTC(),
 			LastSeenAt:   time.Now().UTC(),
 		}
+		if invite != nil {
+			node.GitHubID = invite.CreatedBy
+			node.Tags = invite.Tags
+			if invite.Scope != "" {
+				node.Scope = invite.Scope
+			}
+		}
 
 		if err := st.NodeRegister(r.Context(), node); err != nil {
+			entry.Result = "internal error"
+			recordAudit(r.Context(), st, entry)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
+		if invite != nil && invite.ExpiresAfterJoin {
+			_ = st.InviteDelete(r.Context(), req.InviteToken)
+		}
+		recordAudit(r.Context(), st, entry)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"status":     "registered",
-			"node_token": token,
-			"node_name":  req.NodeName,
+		json.NewEncoder(w).Encode(joinResponse{
+			Status:    "registered",
+			NodeToken: token,
+			NodeName:  name,
+			Scope:     node.Scope,
+			Tags:      node.Tags,
 		})
 	}
 }
@@ -443,84 +616,6 @@ p{color:#525252;line-height:1.6}
 	}
 }
 
-// --- KV API ---
-
-func kvSetHandler(st store.Store) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ns := r.PathValue("namespace")
-		key := r.PathValue("key")
-
-		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
-		if err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
-			return
-		}
-
-		var ttl *time.Duration
-		if ttlStr := r.Header.Get("X-TTL"); ttlStr != "" {
-			d, err := time.ParseDuration(ttlStr)
-			if err != nil {
-				http.Error(w, "invalid X-TTL header", http.StatusBadRequest)
-				return
-			}
-			ttl = &d
-		}
-
-		if err := st.KVSet(r.Context(), ns, key, body, ttl); err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusNoContent)
-	}
-}
-
-func kvGetHandler(st store.Store) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ns := r.PathValue("namespace")
-		key := r.PathValue("key")
-
-		val, err := st.KVGet(r.Context(), ns, key)
-		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
-			return
-		}
-		if val == nil {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
-		}
-		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Write(val)
-	}
-}
-
-func kvDeleteHandler(st store.Store) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ns := r.PathValue("namespace")
-		key := r.PathValue("key")
-
-		if err := st.KVDelete(r.Context(), ns, key); err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusNoContent)
-	}
-}
-
-func kvListHandler(st store.Store) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ns := r.PathValue("namespace")
-		prefix := r.URL.Query().Get("prefix")
-
-		entries, err := st.KVList(r.Context(), ns, prefix)
-		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(entries)
-	}
-}
-
 // --- Rate Limiter ---
 
 type rateLimiter struct {
@@ -0,0 +1,139 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// LaunchSpec is the body of POST /api/v1/sessions: a session for the relay
+// to launch on the connected node with the most room.
+type LaunchSpec struct {
+	Command    []string          `json:"command"`
+	WorkingDir string            `json:"working_dir,omitempty"` // default: the node's
+	Name       string            `json:"name,omitempty"`
+	Env        []string          `json:"env,omitempty"` // KEY=VALUE
+	Tags       []string          `json:"tags,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Stdin      string            `json:"stdin,omitempty"`
+	// Group limits the candidates to the nodes of a group; otherwise any
+	// node that joined a group may be chosen.
+	Group string `json:"group,omitempty"`
+	// Placement overrides the relay's placement strategy.
+	Placement string `json:"placement,omitempty"`
+}
+
+// ScheduledSession is the response to POST /api/v1/sessions. Handle is
+// node:id; cw reaches the session with --server <relay> --node <node>.
+type ScheduledSession struct {
+	Node   string `json:"node"`
+	ID     uint32 `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"` // "running" or "queued"
+	Handle string `json:"handle"`
+}
+
+// sessionCreateHandler schedules a LaunchSpec onto a node: it places the
+// session like a group connection, then launches it over a back-connection
+// as a client of the node would.
+func (rt *nodeRouter) sessionCreateHandler(w http.ResponseWriter, r *http.Request) {
+	var spec LaunchSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil || len(spec.Command) == 0 {
+		http.Error(w, "command required", http.StatusBadRequest)
+		return
+	}
+	for k, v := range spec.Labels {
+		if err := protocol.ValidateLabel(k, v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	node, err := rt.place(r, spec.Group, spec.Placement)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errNoNode) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	sessionID := generateSessionID()
+	entry := store.AuditEntry{User: auditUser(r), Node: node, Action: "session.schedule", SessionID: sessionID, Result: "ok", RemoteIP: remoteIP(r)}
+	fail := func(status int, msg string) {
+		entry.Result = msg
+		recordAudit(r.Context(), rt.st, entry)
+		http.Error(w, msg, status)
+	}
+	bc, status, err := rt.dialNode(r.Context(), node, sessionID)
+	if err != nil {
+		fail(status, err.Error())
+		return
+	}
+	defer bc.Close()
+
+	req := &protocol.Request{
+		Type:       "Launch",
+		Command:    spec.Command,
+		WorkingDir: spec.WorkingDir,
+		Name:       spec.Name,
+		Env:        spec.Env,
+		Tags:       spec.Tags,
+		Labels:     spec.Labels,
+	}
+	if spec.Stdin != "" {
+		req.StdinData = []byte(spec.Stdin)
+	}
+	resp, err := nodeRequest(bc, r, req)
+	if err != nil {
+		fail(http.StatusBadGateway, err.Error())
+		return
+	}
+	if resp.Type == "Error" {
+		fail(http.StatusUnprocessableEntity, resp.Message)
+		return
+	}
+	if resp.Type != "Launched" || resp.ID == nil {
+		fail(http.StatusBadGateway, "unexpected response type: "+resp.Type)
+		return
+	}
+	recordAudit(r.Context(), rt.st, entry)
+	slog.Info("relay: scheduled session", "node", node, "id", *resp.ID, "group", spec.Group)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ScheduledSession{
+		Node:   node,
+		ID:     *resp.ID,
+		Name:   resp.Name,
+		Status: resp.Status,
+		Handle: fmt.Sprintf("%s:%d", node, *resp.ID),
+	})
+}
+
+// nodeRequest sends req to the node on bc and reads its response.
+func nodeRequest(bc *backConn, r *http.Request, req *protocol.Request) (*protocol.Response, error) {
+	reader := connection.NewWSReader(r.Context(), bc.ws)
+	writer := connection.NewWSWriter(r.Context(), bc.ws)
+	if err := writer.SendRequest(req); err != nil {
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+	frame, err := reader.ReadFrame()
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if frame == nil || frame.Type != protocol.FrameControl {
+		return nil, errors.New("node closed the connection")
+	}
+	var resp protocol.Response
+	if err := json.Unmarshal(frame.Payload, &resp); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	return &resp, nil
+}
@@ -10,12 +10,15 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	qrcode "github.com/skip2/go-qrcode"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/store"
 )
 
 // SetupOptions configures the relay setup flow.
@@ -26,6 +29,8 @@ type SetupOptions struct {
 	AuthToken string // admin/CI token (--token flag)
 	ShowQR    bool   // print SSH connection QR code after registration
 	SSHPort   int    // SSH port for QR URI (default 2222)
+	// Groups are the node groups to join. Nil keeps the configured ones.
+	Groups []string
 }
 
 // RunSetup registers this node with the relay and writes relay_url + relay_token
@@ -39,13 +44,26 @@ func RunSetup(ctx context.Context, opts SetupOptions) error {
 	}
 
 	var nodeToken string
+	var assignedName string // set by the invite
+	var tags []string
 	var err error
 
 	switch {
 	case opts.AuthToken != "":
 		nodeToken, err = registerWithToken(ctx, opts.RelayURL, nodeName, opts.AuthToken)
 	case opts.Token != "":
-		nodeToken, err = registerWithInvite(ctx, opts.RelayURL, nodeName, opts.Token)
+		var joined *joinResponse
+		joined, err = registerWithInvite(ctx, opts.RelayURL, nodeName, opts.Token)
+		if err == nil && joined.Scope == store.ScopeClient {
+			return saveClientServer(opts.DataDir, opts.RelayURL, joined)
+		}
+		if err == nil {
+			// The invite may assign the node's name and tags.
+			nodeToken, tags = joined.NodeToken, joined.Tags
+			if joined.NodeName != "" && joined.NodeName != nodeName {
+				nodeName, assignedName = joined.NodeName, joined.NodeName
+			}
+		}
 	default:
 		nodeToken, err = registerAutoDetect(ctx, opts.RelayURL, nodeName)
 	}
@@ -56,9 +74,15 @@ func RunSetup(ctx context.Context, opts SetupOptions) error {
 
 	fmt.Fprintf(os.Stderr, "→ Registered node %q with relay %s\n", nodeName, opts.RelayURL)
 
-	if err := writeRelayConfig(opts.DataDir, opts.RelayURL, nodeToken); err != nil {
+	if err := writeRelayConfig(opts.DataDir, opts.RelayURL, nodeToken, opts.Groups, assignedName, tags); err != nil {
 		return fmt.Errorf("writing config: %w", err)
 	}
+	if len(tags) > 0 {
+		fmt.Fprintf(os.Stderr, "→ Node tags: %s\n", strings.Join(tags, ", "))
+	}
+	if len(opts.Groups) > 0 {
+		fmt.Fprintf(os.Stderr, "→ Joined node groups: %s\n", strings.Join(opts.Groups, ", "))
+	}
 
 	sshPort := opts.SSHPort
 	if sshPort == 0 {
@@ -69,6 +93,20 @@ func RunSetup(ctx context.Context, opts SetupOptions) error {
 	fmt.Fprintln(os.Stderr, "→ Configuration saved.")
 	fmt.Fprintf(os.Stderr, "→ Start node agent: cw node -d\n")
 	fmt.Fprintf(os.Stderr, "→ SSH access: ssh %s@%s -p %d\n", nodeName, relayHost, sshPort)
+	fmt.Fprintf(os.Stderr, "  (or run 'list' / 'cw-attach <session>'; log in with a key added by 'cw key add')\n")
+
+	// The host key lets clients verify they reach this node, not the relay,
+	// for sessions the relay cannot read.
+	hostKey, err := LoadOrCreateHostKey(opts.DataDir)
+	if err != nil {
+		return fmt.Errorf("creating host key: %w", err)
+	}
+	alias := "codewire-" + nodeName
+	fmt.Fprintf(os.Stderr, "→ End-to-end encrypted SSH (the relay sees only ciphertext):\n")
+	fmt.Fprintf(os.Stderr, "    ssh -J %s@%s:%d -o HostKeyAlias=%s %s\n", nodeName, relayHost, sshPort, alias, nodeName)
+	fmt.Fprintf(os.Stderr, "  after adding this line to the client's ~/.ssh/known_hosts:\n")
+	fmt.Fprintf(os.Stderr, "    %s %s", alias, ssh.MarshalAuthorizedKey(hostKey.PublicKey()))
+	fmt.Fprintf(os.Stderr, "  and the client's public key to %s here.\n", filepath.Join(opts.DataDir, AuthorizedKeysFile))
 
 	if opts.ShowQR {
 		uri := SSHURI(opts.RelayURL, nodeName, nodeToken, sshPort)
@@ -241,7 +279,7 @@ func registerWithToken(ctx context.Context, relayURL, nodeName, adminToken strin
 	return result.NodeToken, nil
 }
 
-func registerWithInvite(ctx context.Context, relayURL, nodeName, inviteToken string) (string, error) {
+func registerWithInvite(ctx context.Context, relayURL, nodeName, inviteToken string) (*joinResponse, error) {
 	body, _ := json.Marshal(map[string]string{
 		"node_name":    nodeName,
 		"invite_token": inviteToken,
@@ -251,23 +289,44 @@ func registerWithInvite(ctx context.Context, relayURL, nodeName, inviteToken str
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("contacting relay: %w", err)
+		return nil, fmt.Errorf("contacting relay: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return "", fmt.Errorf("invite rejected (%d): %s", resp.StatusCode, b)
+		return nil, fmt.Errorf("invite rejected (%d): %s", resp.StatusCode, b)
 	}
 
-	var result struct {
-		NodeToken string `json:"node_token"`
+	var result joinResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("parsing relay response: %w", err)
 	}
-	json.NewDecoder(resp.Body).Decode(&result)
-	return result.NodeToken, nil
+	return &result, nil
+}
+
+// saveClientServer saves the relay in servers.toml, under its host name,
+// with the token of a device that joined with a client-scoped invite.
+func saveClientServer(dataDir, relayURL string, joined *joinResponse) error {
+	servers, err := config.LoadServersConfig(dataDir)
+	if err != nil {
+		return err
+	}
+	name := extractHost(relayURL)
+	servers.Servers[name] = config.ServerEntry{URL: relayURL, Token: joined.NodeToken}
+	if err := servers.Save(dataDir); err != nil {
+		return fmt.Errorf("writing servers.toml: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "→ Registered client %q with relay %s\n", joined.NodeName, relayURL)
+	fmt.Fprintf(os.Stderr, "→ Saved as server %q.\n", name)
+	fmt.Fprintf(os.Stderr, "→ Connect to a node: cw --server %s --node <node> list\n", name)
+	return nil
 }
 
-func writeRelayConfig(dataDir, relayURL, nodeToken string) error {
+// writeRelayConfig saves the relay and the node's token in config.toml, and
+// name and tags as node.name and node.tags if set.
+func writeRelayConfig(dataDir, relayURL, nodeToken string, groups []string, name string, tags []string) error {
 	if err := os.MkdirAll(dataDir, 0o755); err != nil {
 		return err
 	}
@@ -279,6 +338,15 @@ func writeRelayConfig(dataDir, relayURL, nodeToken string) error {
 
 	cfg.RelayURL = &relayURL
 	cfg.RelayToken = &nodeToken
+	if groups != nil {
+		cfg.RelayGroups = groups
+	}
+	if name != "" {
+		cfg.Node.Name = name
+	}
+	if tags != nil {
+		cfg.Node.Tags = tags
+	}
 
 	f, err := os.Create(configPath)
 	if err != nil {
@@ -288,6 +356,19 @@ func writeRelayConfig(dataDir, relayURL, nodeToken string) error {
 	return toml.NewEncoder(f).Encode(cfg)
 }
 
+// SaveNodeToken replaces the relay token in dataDir's config.toml with
+// token, issued by a rotation.
+func SaveNodeToken(dataDir, token string) error {
+	cfg, err := config.LoadConfig(dataDir)
+	if err != nil {
+		return err
+	}
+	if cfg.RelayURL == nil {
+		return fmt.Errorf("no relay configured in %s", dataDir)
+	}
+	return writeRelayConfig(dataDir, *cfg.RelayURL, token, nil, "", nil)
+}
+
 // SSHURI builds an ssh:// URI for the given relay and node credentials.
 func SSHURI(relayURL, nodeName, nodeToken string, port int) string {
 	host := extractHost(relayURL)
@@ -6,10 +6,13 @@ import (
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -20,39 +23,75 @@ import (
 // SSHServer wraps an ssh.ServerConfig with relay-specific auth and routing.
 type SSHServer struct {
 	config   *ssh.ServerConfig
+	st       store.Store
 	hub      *NodeHub
 	sessions *PendingSessions
+
+	// tunnels counts the sessions currently bridged to nodes, and
+	// tunnelsTotal those bridged since the relay started.
+	tunnels      atomic.Int64
+	tunnelsTotal atomic.Int64
 }
 
-// NewSSHServer creates an SSH server that authenticates via node tokens.
+// NewSSHServer creates an SSH server for node sessions. The SSH username is
+// the node name; clients authenticate with the node's token as the password
+// or with a public key added to the node with cw key add.
 func NewSSHServer(st store.Store, hub *NodeHub, sessions *PendingSessions) (*SSHServer, error) {
 	hostKey, err := generateEd25519Key()
 	if err != nil {
 		return nil, fmt.Errorf("generating host key: %w", err)
 	}
 
-	srv := &SSHServer{hub: hub, sessions: sessions}
+	srv := &SSHServer{st: st, hub: hub, sessions: sessions}
 
 	srv.config = &ssh.ServerConfig{
 		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
-			node, err := st.NodeGetByToken(ctx, string(pass))
+			node, err := agentByToken(ctx, st, string(pass))
 			if err != nil || node == nil {
 				return nil, fmt.Errorf("authentication failed")
 			}
 			if subtle.ConstantTimeCompare([]byte(c.User()), []byte(node.Name)) != 1 {
 				return nil, fmt.Errorf("username does not match node name")
 			}
-			return &ssh.Permissions{
-				Extensions: map[string]string{"node_name": node.Name},
-			}, nil
+			return nodePermissions(ctx, st, node), nil
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, pub ssh.PublicKey) (*ssh.Permissions, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			key, err := st.SSHKeyGet(ctx, c.User(), ssh.FingerprintSHA256(pub))
+			if err != nil || key == nil {
+				return nil, fmt.Errorf("unknown public key")
+			}
+			if key.PublicKey != strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))) {
+				return nil, fmt.Errorf("unknown public key")
+			}
+			node, err := st.NodeGet(ctx, c.User())
+			if err != nil || node == nil {
+				return nil, fmt.Errorf("authentication failed")
+			}
+			return nodePermissions(ctx, st, node), nil
 		},
 	}
 	srv.config.AddHostKey(hostKey)
 	return srv, nil
 }
 
+// nodePermissions records the authenticated node on the connection, along
+// with the user its token was issued to, when known, for the audit log.
+func nodePermissions(ctx context.Context, st store.Store, node *store.NodeRecord) *ssh.Permissions {
+	owner := ""
+	if node.GitHubID != nil {
+		if u, err := st.UserGetByID(ctx, *node.GitHubID); err == nil && u != nil {
+			owner = u.Username
+		}
+	}
+	return &ssh.Permissions{
+		Extensions: map[string]string{"node_name": node.Name, "owner": owner},
+	}
+}
+
 // Serve accepts SSH connections on ln until ctx is cancelled.
 func (s *SSHServer) Serve(ctx context.Context, ln net.Listener) {
 	go func() {
@@ -71,6 +110,11 @@ func (s *SSHServer) Serve(ctx context.Context, ln net.Listener) {
 func (s *SSHServer) handleConn(ctx context.Context, tc net.Conn) {
 	defer tc.Close()
 
+	// Cancelled when the client goes away, so sessions bridged for it stop
+	// even if the node has nothing more to send.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	sshConn, chans, reqs, err := ssh.NewServerConn(tc, s.config)
 	if err != nil {
 		return
@@ -78,22 +122,35 @@ func (s *SSHServer) handleConn(ctx context.Context, tc net.Conn) {
 	defer sshConn.Close()
 	go ssh.DiscardRequests(reqs)
 
-	nodeName := sshConn.Permissions.Extensions["node_name"]
-
 	for newChan := range chans {
-		if newChan.ChannelType() != "session" {
-			newChan.Reject(ssh.UnknownChannelType, "only session channels supported")
-			continue
-		}
-		ch, reqs, err := newChan.Accept()
-		if err != nil {
-			return
+		switch newChan.ChannelType() {
+		case "session":
+			ch, reqs, err := newChan.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleSession(ctx, ch, reqs, sshConn)
+		case "direct-tcpip":
+			// ssh -J: the client runs its own SSH session with the node
+			// inside this channel, so the relay only carries ciphertext.
+			// The requested destination is ignored; it is always the node
+			// the client authenticated as.
+			ch, reqs, err := newChan.Accept()
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			go func() {
+				defer ch.Close()
+				s.bridgeToNode(ctx, ch, sshConn, HubMessage{SessionID: generateSessionID(), Tunnel: true})
+			}()
+		default:
+			newChan.Reject(ssh.UnknownChannelType, "only session and direct-tcpip channels supported")
 		}
-		go s.handleSession(ctx, ch, reqs, nodeName)
 	}
 }
 
-func (s *SSHServer) handleSession(ctx context.Context, ch ssh.Channel, reqs <-chan *ssh.Request, nodeName string) {
+func (s *SSHServer) handleSession(ctx context.Context, ch ssh.Channel, reqs <-chan *ssh.Request, conn *ssh.ServerConn) {
 	defer ch.Close()
 
 	sessionID := generateSessionID()
@@ -120,10 +177,26 @@ func (s *SSHServer) handleSession(ctx context.Context, ch ssh.Channel, reqs <-ch
 				req.Reply(true, nil)
 			}
 		case "shell", "exec":
+			msg := HubMessage{SessionID: sessionID, Cols: int(cols), Rows: int(rows)}
+			if req.Type == "exec" {
+				var e struct{ Command string }
+				if ssh.Unmarshal(req.Payload, &e) != nil {
+					req.Reply(false, nil)
+					return
+				}
+				args, err := sshCommand(e.Command)
+				if err != nil {
+					req.Reply(true, nil)
+					fmt.Fprintf(ch.Stderr(), "%v\r\n", err)
+					sendExitStatus(ch, 127)
+					return
+				}
+				msg.Command = args
+			}
 			if req.WantReply {
 				req.Reply(true, nil)
 			}
-			s.bridgeToNode(ctx, ch, nodeName, sessionID, int(cols), int(rows))
+			s.bridgeToNode(ctx, ch, conn, msg)
 			return
 		default:
 			if req.WantReply {
@@ -133,21 +206,50 @@ func (s *SSHServer) handleSession(ctx context.Context, ch ssh.Channel, reqs <-ch
 	}
 }
 
-func (s *SSHServer) bridgeToNode(ctx context.Context, ch ssh.Channel, nodeName, sessionID string, cols, rows int) {
+// bridgeToNode asks the node to dial back for msg.SessionID and pipes ch to
+// the back-connection. For a tunnel (msg.Tunnel) the node serves SSH itself
+// on the back-connection instead of a shell, and for msg.Command it runs cw.
+func (s *SSHServer) bridgeToNode(ctx context.Context, ch ssh.Channel, conn *ssh.ServerConn, msg HubMessage) {
+	nodeName := conn.Permissions.Extensions["node_name"]
+	sessionID := msg.SessionID
+	ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	action := "ssh"
+	switch {
+	case msg.Tunnel:
+		action = "ssh.e2e"
+	case msg.Command != nil:
+		action = "ssh." + msg.Command[0]
+	}
+	audit := func(result string) {
+		recordAudit(ctx, s.st, store.AuditEntry{
+			User:      conn.Permissions.Extensions["owner"],
+			Node:      nodeName,
+			Action:    action,
+			SessionID: sessionID,
+			Result:    result,
+			RemoteIP:  ip,
+		})
+	}
+
+	owner := conn.Permissions.Extensions["owner"]
+	bw := s.hub.Bandwidth()
+	if err := bw.allow(nodeName, owner); err != nil {
+		ch.Stderr().Write([]byte(err.Error() + "\r\n"))
+		audit(err.Error())
+		return
+	}
+
 	// Register pending back-connection channel before signalling node.
 	backCh := s.sessions.Expect(sessionID)
 	defer s.sessions.Cancel(sessionID)
 
 	// Signal node via hub.
-	err := s.hub.Send(nodeName, HubMessage{
-		Type:      "SSHRequest",
-		SessionID: sessionID,
-		Cols:      cols,
-		Rows:      rows,
-	})
+	msg.Type = "SSHRequest"
+	err := s.hub.Send(nodeName, msg)
 	if err != nil {
 		slog.Error("SSH: node not connected", "node", nodeName, "err", err)
 		ch.Stderr().Write([]byte("node not connected\r\n"))
+		audit("node not connected")
 		return
 	}
 
@@ -157,11 +259,13 @@ func (s *SSHServer) bridgeToNode(ctx context.Context, ch ssh.Channel, nodeName,
 	case conn, ok := <-backCh:
 		if !ok || conn == nil {
 			slog.Error("SSH: back-connection channel closed", "node", nodeName)
+			audit("back-connection closed")
 			return
 		}
 		backConn = conn
 	case <-time.After(10 * time.Second):
 		ch.Stderr().Write([]byte("node connection timed out\r\n"))
+		audit("node connection timed out")
 		return
 	case <-ctx.Done():
 		return
@@ -169,17 +273,35 @@ func (s *SSHServer) bridgeToNode(ctx context.Context, ch ssh.Channel, nodeName,
 	defer backConn.Close()
 
 	slog.Info("SSH: bridging session", "node", nodeName, "session", sessionID)
+	audit("ok")
+	s.tunnels.Add(1)
+	s.tunnelsTotal.Add(1)
+	defer s.tunnels.Add(-1)
 
 	// Pipe SSH channel ↔ back-connection.
 	// Wait for BOTH directions: stdin EOF fires first, then node output drains.
+	// A copy over quota closes the back-connection, ending the other.
 	done := make(chan struct{}, 2)
+	overQuota := func(err error) {
+		if errors.Is(err, errQuotaExceeded) {
+			ch.Stderr().Write([]byte("\r\n" + err.Error() + "\r\n"))
+			backConn.Close()
+		}
+	}
 	go func() {
-		io.Copy(backConn, ch)
-		// Signal stdin EOF to the node via PTY Ctrl-D so bash exits gracefully.
-		backConn.Write([]byte{0x04})
+		_, err := io.Copy(&meteredWriter{ctx: ctx, bw: bw, node: nodeName, user: owner, toNode: true, w: backConn}, ch)
+		overQuota(err)
+		if !msg.Tunnel && msg.Command == nil {
+			// Signal stdin EOF to the node via PTY Ctrl-D so bash exits gracefully.
+			backConn.Write([]byte{0x04})
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		_, err := io.Copy(&meteredWriter{ctx: ctx, bw: bw, node: nodeName, user: owner, w: ch}, backConn)
+		overQuota(err)
 		done <- struct{}{}
 	}()
-	go func() { io.Copy(ch, backConn); done <- struct{}{} }()
 	select {
 	case <-done:
 		// One direction finished; wait for the other (with ctx as safety valve).
@@ -189,6 +311,32 @@ func (s *SSHServer) bridgeToNode(ctx context.Context, ch ssh.Channel, nodeName,
 		}
 	case <-ctx.Done():
 	}
+
+	if msg.Command != nil && ctx.Err() == nil {
+		// The back-connection carries only the terminal, not the command's
+		// exit code, so a command that ran to completion reports success.
+		sendExitStatus(ch, 0)
+	}
+}
+
+// sshCommand maps the command of an exec request to the cw arguments the
+// node runs for it. Plain SSH clients get these instead of a shell:
+//
+//	list                 cw list
+//	cw-attach <session>  cw attach <session>
+func sshCommand(command string) ([]string, error) {
+	fields := strings.Fields(command)
+	switch {
+	case len(fields) == 1 && (fields[0] == "list" || fields[0] == "cw-list"):
+		return []string{"list"}, nil
+	case len(fields) == 2 && fields[0] == "cw-attach" && !strings.HasPrefix(fields[1], "-"):
+		return []string{"attach", fields[1]}, nil
+	}
+	return nil, fmt.Errorf("unsupported command %q (use: list, cw-attach <session>)", command)
+}
+
+func sendExitStatus(ch ssh.Channel, status uint32) {
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
 }
 
 func generateSessionID() string {
@@ -0,0 +1,97 @@
+package relay
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// RegisterSSHKeyHandlers adds the endpoints managing the client keys that
+// may log in to a node through the relay's SSH listener. Callers
+// authenticate with the node's token and only see that node's keys.
+//
+//	POST   /api/v1/ssh-keys                — body {"public_key": "<authorized_keys line>"}
+//	GET    /api/v1/ssh-keys
+//	DELETE /api/v1/ssh-keys/{fingerprint}
+func RegisterSSHKeyHandlers(mux *http.ServeMux, st store.Store) {
+	mux.HandleFunc("POST /api/v1/ssh-keys", nodeAuthMiddleware(st, sshKeyAddHandler(st)))
+	mux.HandleFunc("GET /api/v1/ssh-keys", nodeAuthMiddleware(st, sshKeyListHandler(st)))
+	mux.HandleFunc("DELETE /api/v1/ssh-keys/{fingerprint}", nodeAuthMiddleware(st, sshKeyDeleteHandler(st)))
+}
+
+func sshKeyAddHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nodeName, _ := r.Context().Value(nodeContextKey{}).(string)
+
+		var req struct {
+			PublicKey string `json:"public_key"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 16<<10)).Decode(&req); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		pub, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+		if err != nil {
+			http.Error(w, "invalid public key", http.StatusBadRequest)
+			return
+		}
+
+		key := store.SSHKey{
+			NodeName:    nodeName,
+			Fingerprint: ssh.FingerprintSHA256(pub),
+			PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))),
+			Comment:     comment,
+			CreatedAt:   time.Now().UTC(),
+		}
+		if err := st.SSHKeyAdd(r.Context(), key); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit(r.Context(), st, store.AuditEntry{Node: nodeName, Action: "ssh_key.add", Result: "ok", RemoteIP: remoteIP(r)})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(key)
+	}
+}
+
+func sshKeyListHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nodeName, _ := r.Context().Value(nodeContextKey{}).(string)
+
+		keys, err := st.SSHKeyList(r.Context(), nodeName)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if keys == nil {
+			keys = []store.SSHKey{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+func sshKeyDeleteHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nodeName, _ := r.Context().Value(nodeContextKey{}).(string)
+
+		ok, err := st.SSHKeyDelete(r.Context(), nodeName, r.PathValue("fingerprint"))
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "key not found", http.StatusNotFound)
+			return
+		}
+		recordAudit(r.Context(), st, store.AuditEntry{Node: nodeName, Action: "ssh_key.remove", Result: "ok", RemoteIP: remoteIP(r)})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
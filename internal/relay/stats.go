@@ -0,0 +1,90 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// RelayStats is a snapshot of the relay's activity. Connected nodes and
+// tunnels are counted on the replica serving the request.
+type RelayStats struct {
+	// Nodes is the number of nodes registered with the relay.
+	Nodes int `json:"nodes"`
+	// ConnectedNodes is the number of nodes connected to this replica.
+	ConnectedNodes int `json:"connected_nodes"`
+	// Tunnels is the number of SSH sessions bridged to nodes right now.
+	Tunnels int64 `json:"tunnels"`
+	// TunnelsTotal is the number of SSH sessions bridged since the relay
+	// started.
+	TunnelsTotal int64 `json:"tunnels_total"`
+	// BytesToNodes and BytesFromNodes count the bytes this replica proxied
+	// to and from nodes since the relay started.
+	BytesToNodes   int64 `json:"bytes_to_nodes"`
+	BytesFromNodes int64 `json:"bytes_from_nodes"`
+}
+
+// RegisterStatsHandlers adds GET /api/v1/stats, serving RelayStats as JSON,
+// and GET /metrics, serving them in the Prometheus text format. Like
+// /api/v1/nodes and /healthz they need no authentication.
+func RegisterStatsHandlers(mux *http.ServeMux, st store.Store, hub *NodeHub, sshSrv *SSHServer) {
+	mux.HandleFunc("GET /api/v1/stats", func(w http.ResponseWriter, r *http.Request) {
+		stats, err := relayStats(r.Context(), st, hub, sshSrv)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		stats, err := relayStats(r.Context(), st, hub, sshSrv)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, m := range []struct {
+			name, kind, help string
+			value            int64
+		}{
+			{"codewire_relay_nodes", "gauge", "Nodes registered with the relay.", int64(stats.Nodes)},
+			{"codewire_relay_connected_nodes", "gauge", "Nodes connected to this relay replica.", int64(stats.ConnectedNodes)},
+			{"codewire_relay_tunnels", "gauge", "SSH sessions currently bridged to nodes.", stats.Tunnels},
+			{"codewire_relay_tunnels_total", "counter", "SSH sessions bridged to nodes since the relay started.", stats.TunnelsTotal},
+			{"codewire_relay_bytes_to_nodes_total", "counter", "Bytes proxied to nodes since the relay started.", stats.BytesToNodes},
+			{"codewire_relay_bytes_from_nodes_total", "counter", "Bytes proxied from nodes since the relay started.", stats.BytesFromNodes},
+		} {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+		}
+		nodes, _ := hub.Bandwidth().Usage()
+		if len(nodes) > 0 {
+			const name = "codewire_relay_node_bytes_total"
+			fmt.Fprintf(w, "# HELP %s Bytes proxied per node since the relay started.\n# TYPE %s counter\n", name, name)
+			for _, n := range nodes {
+				fmt.Fprintf(w, "%s{node=%q,direction=\"to_node\"} %d\n", name, n.Name, n.ToNode)
+				fmt.Fprintf(w, "%s{node=%q,direction=\"from_node\"} %d\n", name, n.Name, n.FromNode)
+			}
+		}
+	})
+}
+
+func relayStats(ctx context.Context, st store.Store, hub *NodeHub, sshSrv *SSHServer) (RelayStats, error) {
+	nodes, err := st.NodeList(ctx)
+	if err != nil {
+		return RelayStats{}, err
+	}
+	stats := RelayStats{
+		Nodes:          len(nodes),
+		ConnectedNodes: hub.Count(),
+	}
+	stats.BytesToNodes, stats.BytesFromNodes = hub.Bandwidth().totals()
+	if sshSrv != nil {
+		stats.Tunnels = sshSrv.tunnels.Load()
+		stats.TunnelsTotal = sshSrv.tunnelsTotal.Load()
+	}
+	return stats, nil
+}
@@ -0,0 +1,65 @@
+package relay_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/relay"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+func TestStatsHandlers(t *testing.T) {
+	st := newTestSQLiteStore(t)
+	ctx := context.Background()
+	for _, name := range []string{"n1", "n2"} {
+		_ = st.NodeRegister(ctx, store.NodeRecord{Name: name, Token: "tok-" + name, AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+	}
+	hub := relay.NewNodeHub()
+	hub.Register("n1", make(chan relay.HubMessage, 1))
+	sshSrv, err := relay.NewSSHServer(st, hub, relay.NewPendingSessions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	relay.RegisterStatsHandlers(mux, st, hub, sshSrv)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats relay.RelayStats
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (relay.RelayStats{Nodes: 2, ConnectedNodes: 1}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{
+		"# TYPE codewire_relay_nodes gauge\ncodewire_relay_nodes 2\n",
+		"codewire_relay_connected_nodes 1\n",
+		"codewire_relay_tunnels 0\n",
+		"# TYPE codewire_relay_tunnels_total counter\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/creack/pty"
+	"golang.org/x/crypto/ssh"
+	"nhooyr.io/websocket"
+)
+
+// HostKeyFile is the node's SSH host key, in the data directory. Clients
+// pin its public key (HostKeyFile + ".pub") to reach the node end-to-end
+// encrypted through the relay.
+const HostKeyFile = "node_host_key"
+
+// AuthorizedKeysFile lists, in the data directory, the client keys allowed
+// to open end-to-end encrypted sessions, in addition to
+// ~/.ssh/authorized_keys.
+const AuthorizedKeysFile = "authorized_keys"
+
+// LoadOrCreateHostKey returns the node's SSH host key from dataDir,
+// generating it on first use.
+func LoadOrCreateHostKey(dataDir string) (ssh.Signer, error) {
+	path := filepath.Join(dataDir, HostKeyFile)
+	if data, err := os.ReadFile(path); err == nil {
+		return ssh.ParsePrivateKey(data)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		return nil, fmt.Errorf("writing host key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0o644); err != nil {
+		return nil, fmt.Errorf("writing host public key: %w", err)
+	}
+	return signer, nil
+}
+
+// loadAuthorizedKeys reads the keys allowed to open tunnels. It is called
+// per tunnel so that edits apply without restarting the node.
+func loadAuthorizedKeys(dataDir string) map[string]bool {
+	paths := []string{filepath.Join(dataDir, AuthorizedKeysFile)}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".ssh", "authorized_keys"))
+	}
+	keys := make(map[string]bool)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for len(bytes.TrimSpace(data)) > 0 {
+			key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+			if err != nil {
+				break
+			}
+			keys[string(key.Marshal())] = true
+			data = rest
+		}
+	}
+	return keys
+}
+
+// handleSSHTunnel dials the back-connection for msg and serves SSH on it
+// with the node's host key. The relay only relays the encrypted stream.
+func handleSSHTunnel(ctx context.Context, cfg AgentConfig, msg HubMessage) {
+	hostKey, err := LoadOrCreateHostKey(cfg.DataDir)
+	if err != nil {
+		slog.Error("relay agent: loading host key failed", "err", err)
+		return
+	}
+	authorized := loadAuthorizedKeys(cfg.DataDir)
+	if len(authorized) == 0 {
+		slog.Warn("relay agent: end-to-end session will be refused, no authorized keys", "dir", cfg.DataDir)
+	}
+
+	nc, err := dialBack(ctx, cfg, msg.SessionID)
+	if err != nil {
+		slog.Error("relay agent: back-connect failed", "err", err, "session", msg.SessionID)
+		return
+	}
+	defer nc.Close()
+
+	sshCfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if authorized[string(key.Marshal())] {
+				return nil, nil
+			}
+			return nil, errors.New("unknown public key")
+		},
+	}
+	sshCfg.AddHostKey(hostKey)
+
+	conn, chans, reqs, err := ssh.NewServerConn(nc, sshCfg)
+	if err != nil {
+		slog.Warn("relay agent: end-to-end handshake failed", "err", err, "session", msg.SessionID)
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only session channels supported")
+			continue
+		}
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+		go serveTunnelSession(ctx, ch, chReqs)
+	}
+}
+
+// serveTunnelSession runs a shell or command for one SSH session channel.
+func serveTunnelSession(ctx context.Context, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+
+	// Requests are handled in order on this goroutine, so a window-change
+	// always sees the PTY started by an earlier shell or exec.
+	var (
+		ptmx    *os.File
+		winsize *pty.Winsize
+		term    string
+		started bool
+	)
+
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			var p struct {
+				Term          string
+				Cols, Rows    uint32
+				Width, Height uint32
+				Modes         string
+			}
+			ok := ssh.Unmarshal(req.Payload, &p) == nil
+			if ok {
+				term, winsize = p.Term, &pty.Winsize{Cols: uint16(p.Cols), Rows: uint16(p.Rows)}
+			}
+			req.Reply(ok, nil)
+		case "window-change":
+			var w struct {
+				Cols, Rows    uint32
+				Width, Height uint32
+			}
+			if ssh.Unmarshal(req.Payload, &w) == nil {
+				winsize = &pty.Winsize{Cols: uint16(w.Cols), Rows: uint16(w.Rows)}
+				if ptmx != nil {
+					pty.Setsize(ptmx, winsize)
+				}
+			}
+		case "env":
+			req.Reply(true, nil)
+		case "shell", "exec":
+			if started {
+				req.Reply(false, nil)
+				continue
+			}
+			cmd := exec.CommandContext(ctx, "bash", "--login")
+			if req.Type == "exec" {
+				var e struct{ Command string }
+				if ssh.Unmarshal(req.Payload, &e) != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				cmd = exec.CommandContext(ctx, "bash", "-c", e.Command)
+			}
+
+			var err error
+			if winsize != nil {
+				if term != "" {
+					cmd.Env = append(os.Environ(), "TERM="+term)
+				}
+				ptmx, err = pty.StartWithSize(cmd, winsize)
+			} else {
+				err = startPiped(cmd, ch)
+			}
+			if err != nil {
+				slog.Error("relay agent: starting shell failed", "err", err)
+				req.Reply(false, nil)
+				return
+			}
+			req.Reply(true, nil)
+			started = true
+			go waitTunnelCommand(ch, cmd, ptmx)
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// waitTunnelCommand copies the PTY, if any, until cmd exits, then reports
+// the exit status and closes ch.
+func waitTunnelCommand(ch ssh.Channel, cmd *exec.Cmd, ptmx *os.File) {
+	defer ch.Close()
+	if ptmx != nil {
+		go io.Copy(ptmx, ch)
+		io.Copy(ch, ptmx)
+		ptmx.Close()
+	}
+	status := 0
+	if err := cmd.Wait(); err != nil {
+		status = 1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			status = exitErr.ExitCode()
+		}
+	}
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+}
+
+// startPiped starts cmd with its standard streams connected to ch.
+func startPiped(cmd *exec.Cmd, ch ssh.Channel) error {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = ch
+	cmd.Stderr = ch.Stderr()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		io.Copy(stdin, ch)
+		stdin.Close()
+	}()
+	return nil
+}
+
+// dialBack opens the back-connection for sessionID.
+func dialBack(ctx context.Context, cfg AgentConfig, sessionID string) (net.Conn, error) {
+	ws, err := dialBackWS(ctx, cfg, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return websocket.NetConn(ctx, ws, websocket.MessageBinary), nil
+}
+
+// dialBackWS opens the back-connection for sessionID as a WebSocket.
+func dialBackWS(ctx context.Context, cfg AgentConfig, sessionID string) (*websocket.Conn, error) {
+	backURL := toWS(cfg.RelayURL) + "/node/back/" + sessionID
+	ws, _, err := websocket.Dial(ctx, backURL, &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": {"Bearer " + cfg.NodeToken}},
+	})
+	return ws, err
+}
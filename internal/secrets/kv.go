@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyFile is the file in the data directory holding the key that seals
+// secrets stored in the relay's KV store. Nodes and clients that share
+// these secrets need a copy of it.
+const KeyFile = "secrets.key"
+
+// sealedPrefix marks a sealed value: the prefix, then the base64 of an
+// AES-256-GCM nonce and ciphertext.
+const sealedPrefix = "cwsecret:v1:"
+
+// LoadKey reads the sealing key from dataDir, creating one if create is set
+// and there is none.
+func LoadKey(dataDir string, create bool) ([]byte, error) {
+	path := filepath.Join(dataDir, KeyFile)
+	key, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && create {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dataDir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating data dir: %w", err)
+		}
+		return key, os.WriteFile(path, key, 0o600)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%s must hold a 32-byte key", path)
+	}
+	return key, nil
+}
+
+// Seal encrypts value with key for storage.
+func Seal(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value made by Seal with the same key.
+func Open(key []byte, sealed string) (string, error) {
+	encoded, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return "", fmt.Errorf("value is not sealed (store it with cw secret set)")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("decoding sealed value: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("sealed value is truncated")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypting sealed value: wrong %s?", KeyFile)
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// KV reads kv://<namespace>/<key>, a value sealed with the key in DataDir
+// and stored in the relay's KV store, which Get fetches.
+type KV struct {
+	DataDir string
+	Get     func(namespace, key string) (value []byte, found bool, err error)
+}
+
+func (p KV) Lookup(s Spec) (string, error) {
+	namespace, key, ok := strings.Cut(s.Ref, "/")
+	if !ok || namespace == "" || key == "" {
+		return "", fmt.Errorf("kv reference must be kv://<namespace>/<key>, got %q", s.Ref)
+	}
+	value, found, err := p.Get(namespace, key)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("no key %s in namespace %s", key, namespace)
+	}
+	sealKey, err := LoadKey(p.DataDir, false)
+	if err != nil {
+		return "", err
+	}
+	return Open(sealKey, string(value))
+}
@@ -0,0 +1,168 @@
+// Package secrets resolves references to secrets kept by a provider (an env
+// file, 1Password, Vault, or the relay's KV store) into their values, for
+// sessions' environments.
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schemes lists the accepted reference formats, for help text and errors.
+const Schemes = "envfile://<path>[#KEY], 1password://<vault>/<item>/<field>, vault://<path>[#field], kv://<namespace>/<key>"
+
+// commandTimeout bounds provider CLIs such as op and vault, which may wait
+// for a sign-in.
+const commandTimeout = 30 * time.Second
+
+// Spec is a --secret argument, NAME@<scheme>://<ref>: the variable NAME
+// gets the secret the provider for scheme finds at ref.
+type Spec struct {
+	Name   string
+	Scheme string
+	Ref    string
+}
+
+func (s Spec) String() string {
+	return s.Name + "@" + s.Scheme + "://" + s.Ref
+}
+
+// ParseSpec parses a NAME@<scheme>://<ref> argument.
+func ParseSpec(arg string) (Spec, error) {
+	name, ref, ok := strings.Cut(arg, "@")
+	if !ok || name == "" || strings.ContainsAny(name, "= ") {
+		return Spec{}, fmt.Errorf("secret must be NAME@<scheme>://<ref>, got %q", arg)
+	}
+	scheme, rest, ok := strings.Cut(ref, "://")
+	if !ok || scheme == "" || rest == "" {
+		return Spec{}, fmt.Errorf("secret %s: reference must be one of %s, got %q", name, Schemes, ref)
+	}
+	return Spec{Name: name, Scheme: scheme, Ref: rest}, nil
+}
+
+// Provider looks up secrets for one reference scheme.
+type Provider interface {
+	Lookup(s Spec) (string, error)
+}
+
+// Resolver looks up specs with the provider registered for their scheme.
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// NewResolver returns a Resolver for the envfile, 1password (or op) and
+// vault schemes. Register adds others, such as kv.
+func NewResolver() *Resolver {
+	return &Resolver{providers: map[string]Provider{
+		"envfile":   EnvFile{},
+		"1password": OnePassword{},
+		"op":        OnePassword{},
+		"vault":     Vault{},
+	}}
+}
+
+// Register makes p resolve references of scheme, replacing any provider
+// registered for it.
+func (r *Resolver) Register(scheme string, p Provider) {
+	r.providers[scheme] = p
+}
+
+// Resolve looks up every spec, returning NAME=VALUE pairs in order.
+func (r *Resolver) Resolve(specs []Spec) ([]string, error) {
+	env := make([]string, 0, len(specs))
+	for _, s := range specs {
+		p, ok := r.providers[s.Scheme]
+		if !ok {
+			return nil, fmt.Errorf("secret %s: unknown scheme %q (use %s)", s.Name, s.Scheme, Schemes)
+		}
+		value, err := p.Lookup(s)
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %w", s.Name, err)
+		}
+		env = append(env, s.Name+"="+value)
+	}
+	return env, nil
+}
+
+// EnvFile reads envfile://<path>[#KEY] from a dotenv file: KEY=VALUE lines,
+// optionally prefixed by export and with the value quoted. KEY defaults to
+// the variable's name.
+type EnvFile struct{}
+
+func (EnvFile) Lookup(s Spec) (string, error) {
+	path, key, _ := strings.Cut(s.Ref, "#")
+	if key == "" {
+		key = s.Name
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		line = strings.TrimPrefix(line, "export ")
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(line, "#") || strings.TrimSpace(k) != key {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			if v[0] == '"' {
+				if unquoted, err := strconv.Unquote(v); err == nil {
+					return unquoted, nil
+				}
+			}
+			return v[1 : len(v)-1], nil
+		}
+		return v, nil
+	}
+	return "", fmt.Errorf("%s not found in %s", key, path)
+}
+
+// OnePassword reads 1password://<vault>/<item>/<field> (a 1Password secret
+// reference) with the op CLI.
+type OnePassword struct{}
+
+func (OnePassword) Lookup(s Spec) (string, error) {
+	return run("op", "read", "--no-newline", "op://"+s.Ref)
+}
+
+// Vault reads vault://<path>[#field] with the vault CLI (vault kv get), so
+// VAULT_ADDR and VAULT_TOKEN apply. The field defaults to the variable's
+// name.
+type Vault struct{}
+
+func (Vault) Lookup(s Spec) (string, error) {
+	path, field, _ := strings.Cut(s.Ref, "#")
+	if field == "" {
+		field = s.Name
+	}
+	return run("vault", "kv", "get", "-field="+field, path)
+}
+
+// run runs a provider CLI and returns what it prints, less a final newline.
+func run(name string, args ...string) (string, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return "", fmt.Errorf("%s not found in PATH", name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", name, msg)
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(stdout.String(), "\n"), "\r"), nil
+}
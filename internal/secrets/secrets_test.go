@@ -0,0 +1,86 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	s, err := ParseSpec("OPENAI_API_KEY@1password://Dev/OpenAI/credential")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != (Spec{Name: "OPENAI_API_KEY", Scheme: "1password", Ref: "Dev/OpenAI/credential"}) {
+		t.Errorf("ParseSpec = %+v", s)
+	}
+	for _, bad := range []string{"KEY", "@envfile://.env", "KEY@.env", "KEY@envfile://", "A=B@envfile://.env"} {
+		if _, err := ParseSpec(bad); err == nil {
+			t.Errorf("ParseSpec(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	err := os.WriteFile(path, []byte("# comment\nexport TOKEN=\"a b\\n\"\nPLAIN = xyz\nSINGLE='q'\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewResolver()
+	env, err := r.Resolve([]Spec{
+		{Name: "TOKEN", Scheme: "envfile", Ref: path},
+		{Name: "OTHER", Scheme: "envfile", Ref: path + "#PLAIN"},
+		{Name: "SINGLE", Scheme: "envfile", Ref: path},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"TOKEN=a b\n", "OTHER=xyz", "SINGLE=q"}; !reflect.DeepEqual(env, want) {
+		t.Errorf("Resolve = %q, want %q", env, want)
+	}
+	if _, err := r.Resolve([]Spec{{Name: "MISSING", Scheme: "envfile", Ref: path}}); err == nil {
+		t.Error("missing key resolved")
+	}
+	if _, err := r.Resolve([]Spec{{Name: "X", Scheme: "nope", Ref: "x"}}); err == nil {
+		t.Error("unknown scheme resolved")
+	}
+}
+
+func TestKVSealed(t *testing.T) {
+	dir := t.TempDir()
+	key, err := LoadKey(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := LoadKey(dir, true); err != nil || !reflect.DeepEqual(again, key) {
+		t.Fatalf("LoadKey made a new key: %v", err)
+	}
+	sealed, err := Seal(key, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := map[string]string{"team/api": sealed, "team/plain": "s3cret"}
+	r := NewResolver()
+	r.Register("kv", KV{DataDir: dir, Get: func(namespace, k string) ([]byte, bool, error) {
+		v, ok := store[namespace+"/"+k]
+		return []byte(v), ok, nil
+	}})
+	env, err := r.Resolve([]Spec{{Name: "API", Scheme: "kv", Ref: "team/api"}})
+	if err != nil || !reflect.DeepEqual(env, []string{"API=s3cret"}) {
+		t.Fatalf("Resolve = %q (%v)", env, err)
+	}
+	for _, ref := range []string{"team/plain", "team/none", "team"} {
+		if _, err := r.Resolve([]Spec{{Name: "API", Scheme: "kv", Ref: ref}}); err == nil {
+			t.Errorf("kv://%s resolved", ref)
+		}
+	}
+
+	// Another key cannot open it.
+	other, _ := LoadKey(t.TempDir(), true)
+	if _, err := Open(other, sealed); err == nil {
+		t.Error("opened with the wrong key")
+	}
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A session's input policy (LaunchOptions.AcceptInputFrom) lists who may send
+// it input, messages and requests. Each entry is one of:
+//
+//	any            anyone (the default, as with no policy)
+//	none           nobody but the session itself
+//	cli            callers that are not sessions: the CLI, hooks, remote clients
+//	shared-tag     sessions that share a tag with this one
+//	tag:<tag>      sessions tagged <tag>
+//	session:<ref>  the session with this name or ID
+//
+// A session may always send to itself. The sender is the session a request
+// names (cw send/msg/request --from, or CW_SESSION_ID inside a session).
+const (
+	AcceptAny       = "any"
+	AcceptNone      = "none"
+	AcceptCLI       = "cli"
+	AcceptSharedTag = "shared-tag"
+)
+
+// ErrInputDenied is returned when a session's input policy refuses a sender.
+var ErrInputDenied = errors.New("input not accepted")
+
+// ValidateInputPolicy checks the entries of an input policy.
+func ValidateInputPolicy(policy []string) error {
+	for _, entry := range policy {
+		switch {
+		case entry == AcceptAny, entry == AcceptNone:
+			if len(policy) > 1 {
+				return fmt.Errorf("accept-input-from %q cannot be combined with other entries", entry)
+			}
+		case entry == AcceptCLI, entry == AcceptSharedTag:
+		case strings.HasPrefix(entry, "tag:") && len(entry) > len("tag:"):
+		case strings.HasPrefix(entry, "session:") && len(entry) > len("session:"):
+		default:
+			return fmt.Errorf("invalid accept-input-from entry %q (want any, none, cli, shared-tag, tag:<tag> or session:<name|id>)", entry)
+		}
+	}
+	return nil
+}
+
+// checkInput returns ErrInputDenied, wrapped, unless the policy of to
+// accepts input from session fromID (0 for a caller that is not a session).
+func (m *SessionManager) checkInput(fromID uint32, to *Session) error {
+	policy := to.Meta.AcceptInputFrom
+	if len(policy) == 0 || fromID == to.Meta.ID {
+		return nil
+	}
+
+	var from *Session
+	if fromID != 0 {
+		m.mu.RLock()
+		from = m.sessions[fromID]
+		m.mu.RUnlock()
+		if from == nil {
+			return fmt.Errorf("sender session %d not found", fromID)
+		}
+	}
+	var fromName string
+	var fromTags []string
+	if from != nil {
+		from.mu.Lock()
+		fromName, fromTags = from.Meta.Name, from.Meta.Tags
+		from.mu.Unlock()
+	}
+
+	for _, entry := range policy {
+		ok := false
+		switch {
+		case entry == AcceptAny:
+			ok = true
+		case entry == AcceptCLI:
+			ok = from == nil
+		case entry == AcceptSharedTag:
+			ok = from != nil && slices.ContainsFunc(fromTags, func(t string) bool { return slices.Contains(to.Meta.Tags, t) })
+		case strings.HasPrefix(entry, "tag:"):
+			ok = from != nil && slices.Contains(fromTags, strings.TrimPrefix(entry, "tag:"))
+		case strings.HasPrefix(entry, "session:"):
+			ref := strings.TrimPrefix(entry, "session:")
+			ok = from != nil && (ref == fromName || ref == strconv.FormatUint(uint64(fromID), 10))
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	sender := "callers outside sessions"
+	if from != nil {
+		sender = fmt.Sprintf("session %d", fromID)
+	}
+	return fmt.Errorf("session %d does not accept input from %s (accept-input-from %s): %w",
+		to.Meta.ID, sender, strings.Join(policy, ","), ErrInputDenied)
+}
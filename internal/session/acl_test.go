@@ -0,0 +1,107 @@
+package session
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateInputPolicy(t *testing.T) {
+	for _, ok := range [][]string{nil, {"any"}, {"none"}, {"cli", "tag:planners", "session:boss", "shared-tag"}} {
+		if err := ValidateInputPolicy(ok); err != nil {
+			t.Errorf("ValidateInputPolicy(%q): %v", ok, err)
+		}
+	}
+	for _, bad := range [][]string{{"none", "cli"}, {"any", "tag:x"}, {"tag:"}, {"session:"}, {"planners"}} {
+		if err := ValidateInputPolicy(bad); err == nil {
+			t.Errorf("ValidateInputPolicy(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestInputPolicy(t *testing.T) {
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create session manager: %v", err)
+	}
+	launch := func(name string, tags []string, policy ...string) uint32 {
+		t.Helper()
+		id, err := sm.LaunchWith(LaunchOptions{
+			Command:         []string{"sleep", "30"},
+			WorkingDir:      "/tmp",
+			Name:            name,
+			Tags:            tags,
+			AcceptInputFrom: policy,
+		})
+		if err != nil {
+			t.Fatalf("launching %s: %v", name, err)
+		}
+		if err := sm.SetName(id, name); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = sm.Kill(id) })
+		return id
+	}
+
+	planner := launch("planner", []string{"planners"})
+	boss := launch("boss", nil)
+	worker := launch("worker", []string{"build"})
+	open := launch("open", nil)
+	guarded := launch("guarded", []string{"build"}, "tag:planners", "session:boss", "shared-tag")
+	sealed := launch("sealed", nil, "none")
+	cliOnly := launch("cli-only", nil, "cli")
+
+	for _, c := range []struct {
+		from, to uint32
+		ok       bool
+	}{
+		{worker, open, true},
+		{0, open, true},
+		{planner, guarded, true},
+		{boss, guarded, true},
+		{worker, guarded, true}, // shares the build tag
+		{open, guarded, false},
+		{0, guarded, false},
+		{planner, sealed, false},
+		{0, sealed, false},
+		{sealed, sealed, true},
+		{0, cliOnly, true},
+		{boss, cliOnly, false},
+	} {
+		err := sm.CheckInput(c.from, c.to)
+		if c.ok != (err == nil) {
+			t.Errorf("CheckInput(%d, %d) = %v, want ok=%v", c.from, c.to, err, c.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInputDenied) {
+			t.Errorf("CheckInput(%d, %d) = %v, want ErrInputDenied", c.from, c.to, err)
+		}
+	}
+
+	// Input, messages, requests and pipes are all refused.
+	if _, err := sm.SendInputFrom(open, guarded, []byte("ls\n")); !errors.Is(err, ErrInputDenied) {
+		t.Errorf("SendInputFrom: %v", err)
+	}
+	if _, err := sm.SendMessage(open, guarded, "hi"); !errors.Is(err, ErrInputDenied) {
+		t.Errorf("SendMessage: %v", err)
+	}
+	if _, _, err := sm.SendRequest(0, sealed, "ok?"); !errors.Is(err, ErrInputDenied) {
+		t.Errorf("SendRequest: %v", err)
+	}
+	if err := sm.DeliverDirectMessagePrompt(sealed, "planner", planner, "hi"); !errors.Is(err, ErrInputDenied) {
+		t.Errorf("DeliverDirectMessagePrompt: %v", err)
+	}
+	if _, err := sm.AddPipe(open, sealed, "", ""); !errors.Is(err, ErrInputDenied) {
+		t.Errorf("AddPipe: %v", err)
+	}
+	if msgs, _ := sm.ReadMessages(guarded, 0); len(msgs) != 0 {
+		t.Errorf("refused message was logged: %+v", msgs)
+	}
+
+	// A sender that is not a session cannot pass for the CLI.
+	if err := sm.CheckInput(9999, cliOnly); err == nil {
+		t.Error("unknown sender accepted")
+	}
+
+	if _, err := sm.LaunchWith(LaunchOptions{Command: []string{"true"}, WorkingDir: "/tmp", AcceptInputFrom: []string{"everyone"}}); err == nil {
+		t.Error("launch with an invalid policy succeeded")
+	}
+}
@@ -0,0 +1,62 @@
+package session
+
+import (
+	"os"
+	"time"
+)
+
+// Activity states of a running session, derived from its output and what
+// its terminal's foreground process is doing.
+const (
+	// ActivityActive means the session wrote output recently.
+	ActivityActive = "active"
+	// ActivityIdle means the session has been quiet for a while.
+	ActivityIdle = "idle"
+	// ActivityAwaitingInput means the session is quiet and its foreground
+	// process is waiting to read from the terminal, e.g. at a prompt, or
+	// its agent's last line matched its adapter's Idle pattern.
+	ActivityAwaitingInput = "awaiting-input"
+)
+
+// activityIdleAfter is how long a session must be quiet to be idle.
+const activityIdleAfter = 10 * time.Second
+
+// activityPromptAfter is how long a session must be quiet, with its
+// foreground process reading the terminal, to be awaiting input. Programs
+// that redraw a prompt or spinner keep resetting it.
+const activityPromptAfter = 3 * time.Second
+
+// activity returns s's activity state, or "" when it is not running.
+func (m *SessionManager) activity(s *Session, status SessionStatus) string {
+	if status.State != StatusRunning().State {
+		return ""
+	}
+	s.mu.Lock()
+	last := s.startedAt
+	master := s.master
+	local := s.Meta.Backend == "" || s.Meta.Backend == LocalBackend
+	s.mu.Unlock()
+	if nano := s.lastOutputAt.Load(); nano > 0 {
+		last = time.Unix(0, nano)
+	}
+	quiet := time.Since(last)
+	if s.agent != nil && s.agent.waiting.Load() {
+		return ActivityAwaitingInput
+	}
+	// Other backends' clients read the terminal all the time to forward
+	// it, whatever runs at the far end.
+	if pm, ok := master.(ptyMaster); quiet >= activityPromptAfter && local && ok && readingTerminal(pm.File) {
+		return ActivityAwaitingInput
+	}
+	if quiet < activityIdleAfter {
+		return ActivityActive
+	}
+	return ActivityIdle
+}
+
+// readingTerminal reports whether the foreground process of the terminal
+// whose PTY master is master is blocked waiting for input from it.
+func readingTerminal(master *os.File) bool {
+	fg, tty, ok := terminalForeground(master)
+	return ok && waitingOnTerminal(fg, tty)
+}
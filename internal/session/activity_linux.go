@@ -0,0 +1,76 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalForeground returns the foreground process group of master's
+// terminal, whose leader's PID is the group ID, and the terminal's path.
+func terminalForeground(master *os.File) (int, string, bool) {
+	rc, err := master.SyscallConn()
+	if err != nil {
+		return 0, "", false
+	}
+	var fg int
+	var ptn uint32
+	var fgErr, ptnErr error
+	if err := rc.Control(func(fd uintptr) {
+		fg, fgErr = unix.IoctlGetInt(int(fd), unix.TIOCGPGRP)
+		ptn, ptnErr = unix.IoctlGetUint32(int(fd), unix.TIOCGPTN)
+	}); err != nil || fgErr != nil || ptnErr != nil || fg <= 0 {
+		return 0, "", false
+	}
+	return fg, fmt.Sprintf("/dev/pts/%d", ptn), true
+}
+
+// waitingOnTerminal reports whether pid is blocked reading tty, either in
+// read itself or in an epoll wait watching it (as Node.js and most event
+// loops do). poll and select are not recognised: their file descriptors are
+// not visible in /proc.
+func waitingOnTerminal(pid int, tty string) bool {
+	// /proc/<pid>/syscall holds the blocking system call's number and
+	// arguments, or "running".
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/syscall", pid))
+	if err != nil {
+		return false
+	}
+	f := strings.Fields(string(data))
+	if len(f) < 2 {
+		return false
+	}
+	nr, err1 := strconv.Atoi(f[0])
+	arg0, err2 := strconv.ParseUint(f[1], 0, 64)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	target, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, arg0))
+	if err != nil {
+		return false
+	}
+	switch {
+	case nr == unix.SYS_READ || nr == unix.SYS_READV:
+		return target == tty
+	case target == "anon_inode:[eventpoll]":
+		// Every epoll wait call takes the epoll instance first; its fdinfo
+		// lists the watched descriptors as "tfd: <fd> ...".
+		info, err := os.ReadFile(fmt.Sprintf("/proc/%d/fdinfo/%d", pid, arg0))
+		if err != nil {
+			return false
+		}
+		for _, line := range strings.Split(string(info), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || fields[0] != "tfd:" {
+				continue
+			}
+			if t, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%s", pid, fields[1])); err == nil && t == tty {
+				return true
+			}
+		}
+	}
+	return false
+}
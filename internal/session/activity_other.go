@@ -0,0 +1,15 @@
+//go:build !linux
+
+package session
+
+import "os"
+
+// terminalForeground is not implemented on this platform, so sessions are
+// never reported as awaiting input.
+func terminalForeground(master *os.File) (int, string, bool) {
+	return 0, "", false
+}
+
+func waitingOnTerminal(pid int, tty string) bool {
+	return false
+}
@@ -0,0 +1,58 @@
+package session
+
+import (
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+func TestReadingTerminal(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("awaiting input is only detected on Linux")
+	}
+	for _, tc := range []struct {
+		name    string
+		script  string
+		reading bool
+	}{
+		{"prompt", `printf 'Continue? '; read answer`, true},
+		{"event loop", `exec python3 -c 'import select; e = select.epoll(); e.register(0, select.EPOLLIN); e.poll()'`, true},
+		{"sleeping", `sleep 30`, false},
+		{"busy", `while :; do :; done`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if strings.Contains(tc.script, "python3") {
+				if _, err := exec.LookPath("python3"); err != nil {
+					t.Skip("python3 not installed")
+				}
+			}
+			cmd := exec.Command("sh", "-c", tc.script)
+			ptmx, err := pty.Start(cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				cmd.Process.Kill()
+				cmd.Wait()
+				ptmx.Close()
+			}()
+			go io.Copy(io.Discard, ptmx)
+
+			// Give the shell time to reach its steady state.
+			got := false
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+				if got = readingTerminal(ptmx); got {
+					break
+				}
+			}
+			if got != tc.reading {
+				t.Errorf("readingTerminal = %v, want %v", got, tc.reading)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package session
+
+import (
+	"bytes"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/codewiresh/codewire/internal/agent"
+)
+
+// agentWatcher applies the Idle and Done patterns of a session's agent
+// adapter to its output, line by line. feed is only called by the
+// session's PTY reader.
+type agentWatcher struct {
+	idle, done *regexp.Regexp
+	partial    []byte
+	waiting    atomic.Bool // the last line matched idle
+}
+
+// newAgentWatcher returns a watcher for a session running command, nil if
+// its adapter, if any, has no output patterns.
+func (m *SessionManager) newAgentWatcher(command []string) *agentWatcher {
+	a := agent.Lookup(command, m.Agents)
+	if a == nil || (a.Idle == "" && a.Done == "") {
+		return nil
+	}
+	// The patterns were checked with the config (see Adapter.Validate).
+	w := &agentWatcher{}
+	if a.Idle != "" {
+		w.idle, _ = regexp.Compile(a.Idle)
+	}
+	if a.Done != "" {
+		w.done, _ = regexp.Compile(a.Done)
+	}
+	return w
+}
+
+// feed adds output, returning whether a complete line matched done. An
+// unfinished line, such as a prompt awaiting input, is matched against
+// idle too.
+func (w *agentWatcher) feed(data []byte) bool {
+	w.partial = append(w.partial, data...)
+	done := false
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := cleanLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+		if line == "" {
+			continue
+		}
+		w.waiting.Store(w.idle != nil && w.idle.MatchString(line))
+		if w.done != nil && w.done.MatchString(line) {
+			done = true
+		}
+	}
+	if line := cleanLine(string(w.partial)); line != "" {
+		w.waiting.Store(w.idle != nil && w.idle.MatchString(line))
+	}
+	if len(w.partial) > alertLineBytes {
+		w.partial = w.partial[len(w.partial)-alertLineBytes:]
+	}
+	return done
+}
@@ -0,0 +1,26 @@
+package session
+
+import "testing"
+
+func TestAgentWatcher(t *testing.T) {
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	if sm.newAgentWatcher([]string{"claude"}) != nil {
+		t.Error("agent watcher for claude, which has no output patterns")
+	}
+	w := sm.newAgentWatcher([]string{"aider"})
+	if w == nil {
+		t.Fatal("no agent watcher for aider")
+	}
+	if w.feed([]byte("Added main.go to the chat\n\x1b[32m> ")) || !w.waiting.Load() {
+		t.Error("aider prompt not seen as waiting")
+	}
+	if w.feed([]byte("fix it\nEditing main.go\n")) || w.waiting.Load() {
+		t.Error("aider still waiting after input")
+	}
+	if !w.feed([]byte("Tokens: 2.1k sent, 150 received. Cost: $0.01 message, $0.03 session.\n")) {
+		t.Error("aider reply end not seen as done")
+	}
+}
@@ -0,0 +1,140 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/notify"
+)
+
+// alertCooldown is how long a pattern stays quiet after alerting. Matches in
+// the meantime are counted in its next alert, so a crash loop does not bury
+// subscribers in alerts.
+const alertCooldown = 5 * time.Second
+
+// alertLineBytes caps the partial output line kept between reads.
+const alertLineBytes = 4096
+
+type alertRule struct {
+	re         *regexp.Regexp
+	last       time.Time // of the latest alert
+	suppressed int       // matches since then
+}
+
+// alertWatcher matches a session's output, line by line, against its alert
+// patterns. It is only used by the session's PTY reader.
+type alertWatcher struct {
+	rules   []*alertRule
+	partial []byte
+	// notifier, if set, also delivers each alert to a person.
+	notifier notify.Notifier
+}
+
+// newAlertWatcher compiles patterns, returning nil when there are none.
+// method is an optional notify method (see notify.Parse).
+func newAlertWatcher(patterns []string, method string) (*alertWatcher, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	a := &alertWatcher{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert pattern %q: %w", p, err)
+		}
+		a.rules = append(a.rules, &alertRule{re: re})
+	}
+	if method != "" {
+		n, err := notify.Parse(method)
+		if err != nil {
+			return nil, err
+		}
+		a.notifier = n
+	}
+	return a, nil
+}
+
+// newAlertWatcher is newAlertWatcher for a session launched with patterns
+// and notify method, adding the node's own.
+func (m *SessionManager) newAlertWatcher(patterns []string, method string) (*alertWatcher, error) {
+	if method == "" {
+		method = m.AlertNotify
+	}
+	all := append(append([]string(nil), m.AlertPatterns...), patterns...)
+	return newAlertWatcher(all, method)
+}
+
+// feed adds output and returns an alert for each complete line matching a
+// pattern that is not cooling down. A line matching several patterns alerts
+// once, for the first.
+func (a *alertWatcher) feed(data []byte, now time.Time) []AlertData {
+	a.partial = append(a.partial, data...)
+	var alerts []AlertData
+	for {
+		i := bytes.IndexByte(a.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := cleanLine(string(a.partial[:i]))
+		a.partial = a.partial[i+1:]
+		if line == "" {
+			continue
+		}
+		for _, r := range a.rules {
+			if !r.re.MatchString(line) {
+				continue
+			}
+			if now.Sub(r.last) < alertCooldown {
+				r.suppressed++
+			} else {
+				alerts = append(alerts, AlertData{Pattern: r.re.String(), Line: line, Suppressed: r.suppressed})
+				r.last, r.suppressed = now, 0
+			}
+			break
+		}
+	}
+	if len(a.partial) > alertLineBytes {
+		a.partial = a.partial[len(a.partial)-alertLineBytes:]
+	}
+	return alerts
+}
+
+// cleanLine returns what a terminal shows of an output line: ANSI codes
+// stripped, and only the text after its last carriage return.
+func cleanLine(line string) string {
+	line = StripANSI(strings.TrimRight(line, "\r"))
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	return strings.TrimSpace(line)
+}
+
+// alert records a session.alert event for a line of sess's output, and
+// notifies the session's alert notifier, if any.
+func (m *SessionManager) alert(sess *Session, d AlertData) {
+	d.Line = sess.redact.redactString(d.Line)
+	event := NewAlertEvent(d)
+	if sess.eventLog != nil {
+		sess.eventLog.Append(event)
+	}
+	m.Subscriptions.Publish(sess.Meta.ID, sess.Meta.Tags, sess.Meta.Labels, event)
+
+	if n := sess.alerts.notifier; n != nil {
+		title := fmt.Sprintf("cw: session %d alert", sess.Meta.ID)
+		sess.mu.Lock()
+		name := sess.Meta.Name
+		sess.mu.Unlock()
+		if name != "" {
+			title = fmt.Sprintf("cw: session %d (%s) alert", sess.Meta.ID, name)
+		}
+		go func() {
+			if err := n.Notify(notify.Notification{Title: title, Body: d.Line}); err != nil {
+				slog.Warn("alert notification failed", "id", sess.Meta.ID, "err", err)
+			}
+		}()
+	}
+}
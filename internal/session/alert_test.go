@@ -0,0 +1,104 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertWatcherFeed(t *testing.T) {
+	a, err := newAlertWatcher([]string{`panic:|Traceback`, `(?i)error`}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	// Lines split across reads alert once complete, ANSI stripped.
+	if got := a.feed([]byte("ok\n\x1b[31mpanic: run"), now); len(got) != 0 {
+		t.Fatalf("alerted on a partial line: %+v", got)
+	}
+	got := a.feed([]byte("time error\x1b[0m\r\nError: disk full\n"), now)
+	if len(got) != 2 {
+		t.Fatalf("alerts = %+v, want 2", got)
+	}
+	// The first line matches both patterns but alerts once, for the first.
+	if got[0].Pattern != `panic:|Traceback` || got[0].Line != "panic: runtime error" {
+		t.Errorf("first alert = %+v", got[0])
+	}
+	if got[1].Pattern != `(?i)error` || got[1].Line != "Error: disk full" {
+		t.Errorf("second alert = %+v", got[1])
+	}
+
+	// A pattern cooling down counts its matches instead.
+	if got := a.feed([]byte("Traceback (most recent call last):\npanic: again\n"), now.Add(time.Second)); len(got) != 0 {
+		t.Fatalf("alerted while cooling down: %+v", got)
+	}
+	got = a.feed([]byte("panic: later\n"), now.Add(alertCooldown))
+	if len(got) != 1 || got[0].Suppressed != 2 {
+		t.Fatalf("alert after cooldown = %+v, want 2 suppressed", got)
+	}
+
+	if a, err := newAlertWatcher(nil, ""); a != nil || err != nil {
+		t.Errorf("newAlertWatcher(nil) = %v, %v; want nil, nil", a, err)
+	}
+	if _, err := newAlertWatcher([]string{"("}, ""); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+	if _, err := newAlertWatcher([]string{"x"}, "pager"); err == nil {
+		t.Error("invalid notify method accepted")
+	}
+}
+
+func TestAlertEvent(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	sm.AlertPatterns = []string{`^FATAL`}
+	notified := filepath.Join(dir, "notified")
+	sub := sm.Subscriptions.Subscribe(nil, nil, nil, []EventType{EventAlert})
+	defer sm.Subscriptions.Unsubscribe(sub.ID)
+
+	id, err := sm.LaunchWith(LaunchOptions{
+		Command:     []string{"sh", "-c", "echo starting; echo 'Traceback (most recent call last):'; echo FATAL: gone"},
+		WorkingDir:  dir,
+		Alerts:      []string{`Traceback`},
+		AlertNotify: "command:cat > " + notified,
+	})
+	if err != nil {
+		t.Fatalf("LaunchWith: %v", err)
+	}
+	var lines []string
+	for len(lines) < 2 {
+		select {
+		case se := <-sub.Ch:
+			var d AlertData
+			if err := json.Unmarshal(se.Event.Data, &d); err != nil {
+				t.Fatal(err)
+			}
+			if se.SessionID != id {
+				t.Fatalf("alert for session %d, want %d", se.SessionID, id)
+			}
+			lines = append(lines, d.Line)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("alerts = %q, want the node's and the session's", lines)
+		}
+	}
+	if lines[0] != "Traceback (most recent call last):" || lines[1] != "FATAL: gone" {
+		t.Errorf("alerts = %q", lines)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		data, _ := os.ReadFile(notified)
+		if strings.Contains(string(data), "Traceback") || strings.Contains(string(data), "FATAL") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("alert notification not sent")
+		}
+	}
+}
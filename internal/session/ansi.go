@@ -0,0 +1,206 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Levels at which Sanitize cleans up what a program wrote to its terminal
+// for reading as text.
+const (
+	// SanitizeNone leaves output as written.
+	SanitizeNone = "none"
+	// SanitizeColors keeps colors, styles and hyperlinks, and removes the
+	// other escape sequences and control characters.
+	SanitizeColors = "colors"
+	// SanitizeFull leaves plain text.
+	SanitizeFull = "full"
+)
+
+// maxCursorForward caps the spaces a cursor-forward sequence becomes.
+const maxCursorForward = 256
+
+// ParseSanitize checks that level is a sanitization level, returning def
+// when it is empty.
+func ParseSanitize(level, def string) (string, error) {
+	switch level {
+	case "":
+		return def, nil
+	case SanitizeNone, SanitizeColors, SanitizeFull:
+		return level, nil
+	}
+	return "", fmt.Errorf("sanitize level must be %s, %s or %s, got %q", SanitizeNone, SanitizeColors, SanitizeFull, level)
+}
+
+// StripANSI removes escape sequences and control characters from s, as
+// Sanitize does at SanitizeFull.
+func StripANSI(s string) string {
+	return Sanitize(s, SanitizeFull)
+}
+
+// Sanitize cleans up s at level. Above SanitizeNone, it removes escape
+// sequences (CSI, OSC, DCS and the like, character set selections
+// included) and control characters other than newlines, tabs and carriage
+// returns; turns cursor-forward sequences, which some programs print
+// instead of spaces, into spaces; applies backspaces; and drops the
+// carriage return of each CRLF. SanitizeColors keeps SGR sequences and OSC
+// 8 hyperlinks. An escape sequence cut off at the end of s is dropped.
+func Sanitize(s, level string) string {
+	if level == SanitizeNone || s == "" {
+		return s
+	}
+	out, _ := sanitize(make([]byte, 0, len(s)), s, level == SanitizeColors, true)
+	return string(out)
+}
+
+// SanitizeStream sanitizes output that arrives in chunks, holding back an
+// escape sequence, or a carriage return, until the chunk that completes
+// it.
+type SanitizeStream struct {
+	level   string
+	pending string
+}
+
+// NewSanitizeStream returns a stream sanitizing at level.
+func NewSanitizeStream(level string) *SanitizeStream {
+	return &SanitizeStream{level: level}
+}
+
+// Sanitize returns the sanitized output of chunk and what was held back
+// before it.
+func (st *SanitizeStream) Sanitize(chunk string) string {
+	if st.level == SanitizeNone {
+		return chunk
+	}
+	s := st.pending + chunk
+	out, n := sanitize(make([]byte, 0, len(s)), s, st.level == SanitizeColors, false)
+	st.pending = s[n:]
+	return string(out)
+}
+
+// sanitize appends s, sanitized, to dst. Unless final, it stops at an
+// escape sequence or carriage return that s may end before completing,
+// and returns how much of s it consumed.
+func sanitize(dst []byte, s string, colors, final bool) ([]byte, int) {
+	// text is where the text backspaces may erase begins in dst: after the
+	// last line break or kept escape sequence.
+	text := 0
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == '\x1b':
+			end, complete := escapeEnd(s, i)
+			if !complete {
+				if !final {
+					return dst, i
+				}
+				return dst, len(s)
+			}
+			seq := s[i:end]
+			switch {
+			case colors && (isSGR(seq) || strings.HasPrefix(seq, "\x1b]8;")):
+				dst = append(dst, seq...)
+				text = len(dst)
+			case strings.HasPrefix(seq, "\x1b[") && seq[len(seq)-1] == 'C':
+				n, err := strconv.Atoi(seq[2 : len(seq)-1])
+				if err != nil || n < 1 {
+					n = 1
+				}
+				dst = append(dst, strings.Repeat(" ", min(n, maxCursorForward))...)
+			}
+			i = end
+			continue
+		case c == '\r':
+			if i+1 == len(s) && !final {
+				return dst, i
+			}
+			if i+1 == len(s) || s[i+1] != '\n' {
+				dst = append(dst, c)
+				text = len(dst)
+			}
+		case c == '\n':
+			dst = append(dst, c)
+			text = len(dst)
+		case c == '\t':
+			dst = append(dst, c)
+		case c == '\b':
+			if len(dst) > text {
+				_, size := utf8.DecodeLastRune(dst[text:])
+				dst = dst[:len(dst)-size]
+			}
+		case c < 0x20 || c == 0x7f:
+		default:
+			dst = append(dst, c)
+		}
+		i++
+	}
+	return dst, i
+}
+
+// escapeEnd returns where the escape sequence starting at s[i] ends, and
+// false if s ends first. A malformed sequence ends at the byte that breaks
+// it, which is left as text.
+func escapeEnd(s string, i int) (int, bool) {
+	j := i + 1
+	if j == len(s) {
+		return j, false
+	}
+	switch s[j] {
+	case '[': // CSI: parameters, intermediates, final byte
+		j++
+		for j < len(s) && s[j] >= 0x30 && s[j] <= 0x3f {
+			j++
+		}
+		for j < len(s) && s[j] >= 0x20 && s[j] <= 0x2f {
+			j++
+		}
+		if j == len(s) {
+			return j, false
+		}
+		if s[j] >= 0x40 && s[j] <= 0x7e {
+			j++
+		}
+		return j, true
+	case ']', 'P', 'X', '^', '_': // OSC, DCS, SOS, PM, APC: strings up to ST
+		for j++; j < len(s); j++ {
+			switch {
+			case s[j] == '\x07' && s[i+1] == ']':
+				return j + 1, true
+			case s[j] == '\x1b' && j+1 < len(s) && s[j+1] == '\\':
+				return j + 2, true
+			case s[j] == '\x1b' && j+1 < len(s):
+				// An unterminated string ends at the next sequence.
+				return j, true
+			}
+		}
+		return j, false
+	}
+	// Other sequences: intermediates, then a final byte, as in ESC ( B.
+	for j < len(s) && s[j] >= 0x20 && s[j] <= 0x2f {
+		j++
+	}
+	if j == len(s) {
+		return j, false
+	}
+	if s[j] >= 0x30 && s[j] <= 0x7e {
+		j++
+	}
+	return j, true
+}
+
+// isSGR reports whether seq, a complete escape sequence, sets colors or
+// styles.
+func isSGR(seq string) bool {
+	if len(seq) < 3 || seq[1] != '[' || seq[len(seq)-1] != 'm' {
+		return false
+	}
+	for _, c := range []byte(seq[2 : len(seq)-1]) {
+		if (c < '0' || c > '9') && c != ';' && c != ':' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package session
+
+import "testing"
+
+func TestStripANSI(t *testing.T) {
+	cases := []struct {
+		name, input, want string
+	}{
+		{"plain text", "hello world", "hello world"},
+		{"CSI color", "\x1b[32mgreen\x1b[0m text", "green text"},
+		{"CSI cursor move", "\x1b[2J\x1b[H", ""},
+		{"OSC title BEL", "\x1b]0;title\x07rest", "rest"},
+		{"OSC title ST", "\x1b]0;title\x1b\\rest", "rest"},
+		{"nested codes", "\x1b[1;32mBold\x1b[0m normal", "Bold normal"},
+		{"preserves newlines", "line1\nline2\n", "line1\nline2\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := StripANSI(tc.input)
+			if got != tc.want {
+				t.Errorf("StripANSI(%q) = %q, want %q", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+// Vectors are taken from the logs of sessions running agents and common
+// CLI tools.
+func TestSanitize(t *testing.T) {
+	cases := []struct {
+		name, input, full, colors string
+	}{
+		{
+			"CRLF",
+			"one\r\ntwo\r\n",
+			"one\ntwo\n",
+			"one\ntwo\n",
+		},
+		{
+			"cursor forward as spaces (claude)",
+			"\x1b[1mRead\x1b[22m(\x1b[1C\x1b[2mmain.go\x1b[22m)\x1b[3C",
+			"Read( main.go)   ",
+			"\x1b[1mRead\x1b[22m( \x1b[2mmain.go\x1b[22m)   ",
+		},
+		{
+			"redraw of a spinner line (claude)",
+			"\x1b[2K\x1b[1A\x1b[2K\x1b[G\x1b[38;5;174m✻\x1b[39m Thinking…",
+			"✻ Thinking…",
+			"\x1b[38;5;174m✻\x1b[39m Thinking…",
+		},
+		{
+			"private modes and title",
+			"\x1b[?25l\x1b[?2004h\x1b]0;✳ Claude Code\x07> \x1b[?25h",
+			"> ",
+			"> ",
+		},
+		{
+			"hyperlink (OSC 8, ST)",
+			"see \x1b]8;id=1;file:///src/main.go\x1b\\main.go\x1b]8;;\x1b\\ now",
+			"see main.go now",
+			"see \x1b]8;id=1;file:///src/main.go\x1b\\main.go\x1b]8;;\x1b\\ now",
+		},
+		{
+			"hyperlink (OSC 8, BEL)",
+			"\x1b]8;;https://example.com\x07docs\x1b]8;;\x07",
+			"docs",
+			"\x1b]8;;https://example.com\x07docs\x1b]8;;\x07",
+		},
+		{
+			"character set selection (tput sgr0)",
+			"\x1b[1mok\x1b(B\x1b[m done",
+			"ok done",
+			"\x1b[1mok\x1b[m done",
+		},
+		{
+			"truecolor (codex)",
+			"\x1b[38;2;95;135;255m•\x1b[0m Ran \x1b[1mgo test\x1b[0m",
+			"• Ran go test",
+			"\x1b[38;2;95;135;255m•\x1b[0m Ran \x1b[1mgo test\x1b[0m",
+		},
+		{
+			"keypad and cursor save (aider)",
+			"\x1b=\x1b7\x1b[1;32m> \x1b[0m\x1b8\x1b>",
+			"> ",
+			"\x1b[1;32m> \x1b[0m",
+		},
+		{
+			"DCS string",
+			"a\x1bP+q544e\x1b\\b",
+			"ab",
+			"ab",
+		},
+		{
+			"backspaces",
+			"ab\bc\b",
+			"a",
+			"a",
+		},
+		{
+			"backspace stops at a line break",
+			"ok\n\bx",
+			"ok\nx",
+			"ok\nx",
+		},
+		{
+			"backspace over a wide character",
+			"✓\bx",
+			"x",
+			"x",
+		},
+		{
+			"bell and other controls",
+			"done\x07\x00\x0e!",
+			"done!",
+			"done!",
+		},
+		{
+			"progress with carriage returns",
+			"10%\r50%\r100%\r\n",
+			"10%\r50%\r100%\n",
+			"10%\r50%\r100%\n",
+		},
+		{
+			"sequence cut off at the end",
+			"text\x1b[38;5",
+			"text",
+			"text",
+		},
+		{
+			"malformed CSI",
+			"\x1b[12\nnext",
+			"\nnext",
+			"\nnext",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Sanitize(tc.input, SanitizeFull); got != tc.full {
+				t.Errorf("full: Sanitize(%q) = %q, want %q", tc.input, got, tc.full)
+			}
+			if got := Sanitize(tc.input, SanitizeColors); got != tc.colors {
+				t.Errorf("colors: Sanitize(%q) = %q, want %q", tc.input, got, tc.colors)
+			}
+			if got := Sanitize(tc.input, SanitizeNone); got != tc.input {
+				t.Errorf("none: Sanitize(%q) = %q, want it unchanged", tc.input, got)
+			}
+		})
+	}
+}
+
+func TestSanitizeStream(t *testing.T) {
+	input := "\x1b[1mRead\x1b[22m(\x1b[1Cmain.go)\r\n\x1b]0;title\x07✓ ok\r\n"
+	want := Sanitize(input, SanitizeFull)
+	// Split the input at every position, cutting sequences in two.
+	for i := range len(input) + 1 {
+		st := NewSanitizeStream(SanitizeFull)
+		got := st.Sanitize(input[:i]) + st.Sanitize(input[i:])
+		if got != want {
+			t.Errorf("split at %d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestParseSanitize(t *testing.T) {
+	if got, err := ParseSanitize("", SanitizeFull); got != SanitizeFull || err != nil {
+		t.Errorf("ParseSanitize(\"\") = %q, %v; want the default", got, err)
+	}
+	if got, err := ParseSanitize(SanitizeColors, SanitizeFull); got != SanitizeColors || err != nil {
+		t.Errorf("ParseSanitize(colors) = %q, %v", got, err)
+	}
+	if _, err := ParseSanitize("some", SanitizeFull); err == nil {
+		t.Error("ParseSanitize(some) succeeded")
+	}
+}
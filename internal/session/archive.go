@@ -0,0 +1,531 @@
+package session
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// archiveMetaFile is the archive entry holding the session's SessionMeta;
+// the other entries are the files of its log directory.
+const archiveMetaFile = "meta.json"
+
+// archiveSuffix ends the file names of session archives.
+const archiveSuffix = ".tar.gz"
+
+// ArchiveStore keeps copies of session archives off the node, such as in
+// S3 (see relay.S3Location).
+type ArchiveStore interface {
+	// Upload copies the archive at path as name and returns where to.
+	Upload(ctx context.Context, name, path string) (string, error)
+	// Download writes archive name to w.
+	Download(ctx context.Context, name string, w io.Writer) error
+}
+
+// archiveDir returns the directory session archives are kept in.
+func (m *SessionManager) archiveDir() string {
+	if m.ArchiveDir != "" {
+		return m.ArchiveDir
+	}
+	return filepath.Join(m.dataDir, "archive")
+}
+
+// Archive bundles completed session id, its metadata and the files of its
+// log directory (output, events, messages and timing), into a gzipped tar
+// file in the archive directory, uploads it to the ArchiveStore if there is
+// one, and removes the session. Running and queued sessions cannot be
+// archived.
+func (m *SessionManager) Archive(ctx context.Context, id uint32) (protocol.ArchivedSession, error) {
+	m.mu.Lock()
+	sess, ok := m.sessions[id]
+	if !ok {
+		m.mu.Unlock()
+		return protocol.ArchivedSession{}, fmt.Errorf("session %d not found", id)
+	}
+	if !finished(sess) {
+		m.mu.Unlock()
+		return protocol.ArchivedSession{}, fmt.Errorf("session %d is %s; only finished sessions can be archived", id, sess.statusWatcher.Get())
+	}
+	// Out of the list, nothing new reaches the session's logs.
+	delete(m.sessions, id)
+	m.mu.Unlock()
+
+	archived, err := m.archive(ctx, sess)
+	if err != nil {
+		m.mu.Lock()
+		m.sessions[id] = sess
+		m.mu.Unlock()
+		return protocol.ArchivedSession{}, err
+	}
+	m.triggerPersist()
+	return archived, nil
+}
+
+// ArchiveBefore archives every finished session that completed before
+// cutoff, oldest first, stopping at the first that fails.
+func (m *SessionManager) ArchiveBefore(ctx context.Context, cutoff time.Time) ([]protocol.ArchivedSession, error) {
+	type candidate struct {
+		id        uint32
+		completed time.Time
+	}
+	var due []candidate
+	m.mu.RLock()
+	for id, sess := range m.sessions {
+		if !finished(sess) {
+			continue
+		}
+		sess.mu.Lock()
+		completed := sess.Meta.CreatedAt
+		if sess.Meta.CompletedAt != nil {
+			completed = *sess.Meta.CompletedAt
+		}
+		sess.mu.Unlock()
+		if completed.Before(cutoff) {
+			due = append(due, candidate{id, completed})
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(due, func(i, j int) bool { return due[i].completed.Before(due[j].completed) })
+
+	archived := []protocol.ArchivedSession{}
+	for _, c := range due {
+		a, err := m.Archive(ctx, c.id)
+		if err != nil {
+			return archived, err
+		}
+		archived = append(archived, a)
+	}
+	return archived, nil
+}
+
+// finished reports whether sess is done with: completed, or killed with
+// its process, if it had one, gone.
+func finished(sess *Session) bool {
+	switch sess.statusWatcher.Get().State {
+	case "completed":
+		return true
+	case "killed":
+		sess.mu.Lock()
+		pid := sess.Meta.PID
+		sess.mu.Unlock()
+		if pid == nil {
+			return true
+		}
+		select {
+		case <-sess.exited:
+			return true
+		default:
+		}
+	}
+	return false
+}
+
+// archive writes the archive of sess, taken out of the session list, and
+// removes its log directory.
+func (m *SessionManager) archive(ctx context.Context, sess *Session) (protocol.ArchivedSession, error) {
+	sess.mu.Lock()
+	meta := sess.Meta
+	sess.mu.Unlock()
+	meta.Status = sess.statusWatcher.Get().String()
+	meta.PID = nil
+
+	dir := m.archiveDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return protocol.ArchivedSession{}, fmt.Errorf("creating archive dir: %w", err)
+	}
+	name := fmt.Sprintf("%d-%s%s", meta.ID, meta.CreatedAt.UTC().Format("20060102T150405Z"), archiveSuffix)
+	path := filepath.Join(dir, name)
+	logDir := filepath.Dir(sess.logPath)
+	if err := writeArchive(path, meta, logDir); err != nil {
+		return protocol.ArchivedSession{}, fmt.Errorf("writing archive: %w", err)
+	}
+	archived, err := archivedSession(path, meta)
+	if err != nil {
+		os.Remove(path)
+		return protocol.ArchivedSession{}, err
+	}
+	if m.ArchiveStore != nil {
+		if archived.URL, err = m.ArchiveStore.Upload(ctx, name, path); err != nil {
+			os.Remove(path)
+			return protocol.ArchivedSession{}, fmt.Errorf("uploading archive: %w", err)
+		}
+	}
+
+	if sess.eventLog != nil {
+		sess.eventLog.Close()
+	}
+	if sess.messageLog != nil {
+		sess.messageLog.Close()
+	}
+	if err := os.RemoveAll(logDir); err != nil {
+		return archived, fmt.Errorf("removing session logs: %w", err)
+	}
+	return archived, nil
+}
+
+// writeArchive writes meta and the regular files in logDir to a gzipped
+// tar file at path.
+func writeArchive(path string, meta SessionMeta, logDir string) (err error) {
+	metaData, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(logDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	if err := tw.WriteHeader(&tar.Header{Name: archiveMetaFile, Mode: 0o644, Size: int64(len(metaData)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(metaData); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if err := addArchiveFile(tw, filepath.Join(logDir, e.Name())); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// addArchiveFile adds the file at path to tw under its base name.
+func addArchiveFile(tw *tar.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	// Copy no more than the header promises, should the file still grow.
+	_, err = io.CopyN(tw, f, hdr.Size)
+	return err
+}
+
+// archivedSession describes the archive at path, of the session meta.
+func archivedSession(path string, meta SessionMeta) (protocol.ArchivedSession, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return protocol.ArchivedSession{}, err
+	}
+	a := protocol.ArchivedSession{
+		ID:     meta.ID,
+		Name:   meta.Name,
+		Prompt: meta.Prompt,
+		Status: meta.Status,
+		File:   filepath.Base(path),
+		Size:   fi.Size(),
+	}
+	if meta.CompletedAt != nil {
+		a.CompletedAt = meta.CompletedAt.Format(time.RFC3339)
+	}
+	return a, nil
+}
+
+// Archives lists the archives in the archive directory, oldest session
+// first.
+func (m *SessionManager) Archives() ([]protocol.ArchivedSession, error) {
+	dir := m.archiveDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	archives := []protocol.ArchivedSession{}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), archiveSuffix) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		meta, err := readArchiveMeta(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", e.Name(), err)
+		}
+		a, err := archivedSession(path, meta)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, a)
+	}
+	sort.SliceStable(archives, func(i, j int) bool { return archives[i].ID < archives[j].ID })
+	return archives, nil
+}
+
+// readArchiveMeta reads the SessionMeta of the archive at path.
+func readArchiveMeta(path string) (SessionMeta, error) {
+	var meta SessionMeta
+	err := readArchive(path, func(name string, r io.Reader) (bool, error) {
+		if name != archiveMetaFile {
+			return true, nil
+		}
+		return false, json.NewDecoder(r).Decode(&meta)
+	})
+	if err == nil && meta.ID == 0 {
+		err = fmt.Errorf("no %s in archive", archiveMetaFile)
+	}
+	return meta, err
+}
+
+// readArchive calls fn with each regular file of the archive at path,
+// until it returns false or an error.
+func readArchive(path string, fn func(name string, r io.Reader) (bool, error)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		more, err := fn(hdr.Name, tr)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// findArchive returns the file name of archive, given as a file name or as
+// the ID of the session it holds, in which case it is that session's
+// latest archive in the archive directory.
+func (m *SessionManager) findArchive(archive string) (string, error) {
+	if _, err := strconv.ParseUint(archive, 10, 32); err != nil {
+		if filepath.Base(archive) != archive || !strings.HasSuffix(archive, archiveSuffix) {
+			return "", fmt.Errorf("invalid archive %q: give a session ID or an archive's file name", archive)
+		}
+		return archive, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(m.archiveDir(), archive+"-*"+archiveSuffix))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no archive of session %s", archive)
+	}
+	// The names end in the session's creation time, which sorts.
+	sort.Strings(matches)
+	return filepath.Base(matches[len(matches)-1]), nil
+}
+
+// RestoreArchive brings an archived session back into the session list,
+// finished, and removes its archive from the archive directory; copies in
+// the ArchiveStore are kept. archive is the archive's file name, which is
+// downloaded from the ArchiveStore if it is not in the archive directory,
+// or the ID of the session it holds. The session gets a new ID if its own
+// is taken.
+//
+// The archive is claimed first, by renaming it to end in ".restoring" (or
+// downloading it under that name), so a concurrent restore of the same
+// archive fails rather than restoring the session twice.
+func (m *SessionManager) RestoreArchive(ctx context.Context, archive string) (_ protocol.ArchivedSession, err error) {
+	name, err := m.findArchive(archive)
+	if err != nil {
+		return protocol.ArchivedSession{}, err
+	}
+	path := filepath.Join(m.archiveDir(), name)
+	claimed := path + ".restoring"
+	switch renameErr := os.Rename(path, claimed); {
+	case renameErr == nil:
+		defer func() {
+			if err != nil {
+				os.Rename(claimed, path)
+			}
+		}()
+	case !errors.Is(renameErr, os.ErrNotExist):
+		return protocol.ArchivedSession{}, fmt.Errorf("claiming archive: %w", renameErr)
+	case m.ArchiveStore != nil:
+		if downloadErr := m.downloadArchive(ctx, name, claimed); errors.Is(downloadErr, os.ErrExist) {
+			return protocol.ArchivedSession{}, fmt.Errorf("archive %s is already being restored", name)
+		} else if downloadErr != nil {
+			return protocol.ArchivedSession{}, fmt.Errorf("downloading archive: %w", downloadErr)
+		}
+		defer func() {
+			if err != nil {
+				os.Remove(claimed)
+			}
+		}()
+	case fileExists(claimed):
+		return protocol.ArchivedSession{}, fmt.Errorf("archive %s is already being restored", name)
+	default:
+		return protocol.ArchivedSession{}, fmt.Errorf("no archive named %s", name)
+	}
+	meta, err := readArchiveMeta(claimed)
+	if err != nil {
+		return protocol.ArchivedSession{}, fmt.Errorf("reading archive: %w", err)
+	}
+
+	sessionsDir := filepath.Join(m.dataDir, "sessions")
+	if err := os.MkdirAll(sessionsDir, 0o755); err != nil {
+		return protocol.ArchivedSession{}, fmt.Errorf("creating sessions dir: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(sessionsDir, ".restore-")
+	if err != nil {
+		return protocol.ArchivedSession{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+	err = readArchive(claimed, func(entry string, r io.Reader) (bool, error) {
+		// Entries are base names; skip anything that would land elsewhere.
+		if entry == archiveMetaFile || filepath.Base(entry) != entry || entry == "." || entry == ".." {
+			return true, nil
+		}
+		f, err := os.OpenFile(filepath.Join(tmpDir, entry), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return false, err
+		}
+		_, err = io.Copy(f, r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return true, err
+	})
+	if err != nil {
+		return protocol.ArchivedSession{}, fmt.Errorf("extracting archive: %w", err)
+	}
+
+	m.mu.Lock()
+	id := meta.ID
+	logDir := filepath.Join(sessionsDir, fmt.Sprintf("%d", id))
+	if _, taken := m.sessions[id]; taken || fileExists(logDir) {
+		id = m.nextID.Add(1) - 1
+		logDir = filepath.Join(sessionsDir, fmt.Sprintf("%d", id))
+	}
+	if err := os.Rename(tmpDir, logDir); err != nil {
+		m.mu.Unlock()
+		return protocol.ArchivedSession{}, fmt.Errorf("restoring session logs: %w", err)
+	}
+	meta.ID = id
+	sess := m.restoredSession(meta, logDir)
+	// Like every finished session, it does not hold its name.
+	m.sessions[id] = sess
+	m.mu.Unlock()
+
+	restored, err := archivedSession(claimed, meta)
+	if err != nil {
+		return protocol.ArchivedSession{}, err
+	}
+	os.Remove(claimed)
+	m.triggerPersist()
+	return restored, nil
+}
+
+// downloadArchive downloads archive name from the ArchiveStore to path,
+// failing with an error wrapping os.ErrExist if path exists.
+func (m *SessionManager) downloadArchive(ctx context.Context, name, path string) (err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+	if err := m.ArchiveStore.Download(ctx, name, f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// restoredSession returns the finished session meta describes, with its
+// logs in logDir.
+func (m *SessionManager) restoredSession(meta SessionMeta, logDir string) *Session {
+	status := StatusKilled()
+	if meta.Status != status.String() {
+		code := -1
+		if meta.ExitCode != nil {
+			code = *meta.ExitCode
+		}
+		status = StatusCompleted(code)
+	}
+	meta.Status = status.String()
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+	sess := &Session{
+		Meta:          meta,
+		broadcaster:   NewBroadcaster(),
+		inputCh:       make(chan []byte, 256),
+		statusWatcher: NewStatusWatcher(status),
+		logPath:       filepath.Join(logDir, "output.log"),
+		startedAt:     meta.CreatedAt,
+		exited:        make(chan struct{}),
+		screen:        newScreen(defaultScreenCols, defaultScreenRows),
+	}
+	close(sess.exited)
+	if fi, err := os.Stat(sess.logPath); err == nil {
+		sess.outputBytes.Store(uint64(fi.Size()))
+	}
+	// The message log stays open, for messages sent to finished sessions.
+	if messageLog, err := NewEventLog(filepath.Join(logDir, "messages.jsonl")); err == nil {
+		sess.messageLog = messageLog
+	}
+	return sess
+}
+
+// fileExists reports whether something exists at path.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,245 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memArchiveStore is an ArchiveStore in memory.
+type memArchiveStore map[string][]byte
+
+func (s memArchiveStore) Upload(_ context.Context, name, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	s[name] = data
+	return "mem://" + name, nil
+}
+
+func (s memArchiveStore) Download(_ context.Context, name string, w io.Writer) error {
+	data, ok := s[name]
+	if !ok {
+		return fmt.Errorf("%s not found", name)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func TestArchiveRestore(t *testing.T) {
+	dataDir := t.TempDir()
+	sm, err := NewSessionManager(dataDir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	ctx := context.Background()
+
+	id, err := sm.Launch([]string{"sh", "-c", "echo archived output"}, t.TempDir(), nil, nil, "job")
+	if err != nil {
+		t.Fatalf("Launch: %v", err)
+	}
+	if err := sm.SetName(id, "job"); err != nil {
+		t.Fatalf("SetName: %v", err)
+	}
+	running, err := sm.Launch([]string{"sleep", "10"}, t.TempDir(), nil, nil, "")
+	if err != nil {
+		t.Fatalf("Launch: %v", err)
+	}
+	defer sm.Kill(running)
+	if _, err := sm.Archive(ctx, running); err == nil || !strings.Contains(err.Error(), "running") {
+		t.Fatalf("archiving a running session: %v, want it refused", err)
+	}
+
+	waitExited(t, sm, id)
+	if _, err := sm.SendMessage(0, id, "for the record"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	a, err := sm.Archive(ctx, id)
+	if err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	if a.ID != id || a.Name != "job" || a.Status != "completed (0)" || a.Size == 0 {
+		t.Errorf("archived = %+v", a)
+	}
+	if _, _, err := sm.GetStatus(id); err == nil {
+		t.Error("archived session is still listed")
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "sessions", fmt.Sprint(id))); !os.IsNotExist(err) {
+		t.Errorf("session logs left behind: %v", err)
+	}
+	archives, err := sm.Archives()
+	if err != nil || len(archives) != 1 || archives[0].File != a.File {
+		t.Fatalf("Archives = %+v, %v", archives, err)
+	}
+
+	restored, err := sm.RestoreArchive(ctx, fmt.Sprint(id))
+	if err != nil {
+		t.Fatalf("RestoreArchive: %v", err)
+	}
+	if restored.ID != id {
+		t.Errorf("restored as session %d, want %d", restored.ID, id)
+	}
+	info, _, err := sm.GetStatus(id)
+	if err != nil || info.Status != "completed (0)" || info.Name != "job" {
+		t.Fatalf("restored session = %+v, %v", info, err)
+	}
+	logPath, _ := sm.LogPath(id)
+	if out, err := os.ReadFile(logPath); err != nil || !bytes.Contains(out, []byte("archived output")) {
+		t.Errorf("restored output = %q, %v", out, err)
+	}
+	if msgs, err := sm.ReadMessages(id, 0); err != nil || len(msgs) != 1 {
+		t.Errorf("restored messages = %d, %v; want 1", len(msgs), err)
+	}
+	if _, err := sm.ResolveByName("job"); err == nil {
+		t.Error("restored session took its name back")
+	}
+	if archives, _ := sm.Archives(); len(archives) != 0 {
+		t.Errorf("archive kept after restore: %+v", archives)
+	}
+}
+
+func TestArchiveStore(t *testing.T) {
+	dataDir := t.TempDir()
+	sm, err := NewSessionManager(dataDir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	store := memArchiveStore{}
+	sm.ArchiveStore = store
+	ctx := context.Background()
+
+	id, err := sm.Launch([]string{"true"}, t.TempDir(), nil, nil, "")
+	if err != nil {
+		t.Fatalf("Launch: %v", err)
+	}
+	waitExited(t, sm, id)
+	a, err := sm.Archive(ctx, id)
+	if err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	if a.URL != "mem://"+a.File || store[a.File] == nil {
+		t.Fatalf("archive %+v not uploaded", a)
+	}
+
+	// Without the local copy, the archive is downloaded; with the session's
+	// ID taken, it gets another.
+	if err := os.Remove(filepath.Join(dataDir, "archive", a.File)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dataDir, "sessions", fmt.Sprint(id)), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := sm.RestoreArchive(ctx, a.File)
+	if err != nil {
+		t.Fatalf("RestoreArchive: %v", err)
+	}
+	if restored.ID == id {
+		t.Errorf("restored under taken ID %d", id)
+	}
+	if _, _, err := sm.GetStatus(restored.ID); err != nil {
+		t.Errorf("restored session: %v", err)
+	}
+
+	if _, err := sm.RestoreArchive(ctx, "../sessions.json"); err == nil {
+		t.Error("restored from outside the archive directory")
+	}
+}
+
+func TestRestoreArchiveOnce(t *testing.T) {
+	dataDir := t.TempDir()
+	sm, err := NewSessionManager(dataDir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	ctx := context.Background()
+
+	id, err := sm.Launch([]string{"true"}, t.TempDir(), nil, nil, "")
+	if err != nil {
+		t.Fatalf("Launch: %v", err)
+	}
+	waitExited(t, sm, id)
+	a, err := sm.Archive(ctx, id)
+	if err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	path := filepath.Join(dataDir, "archive", a.File)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Of concurrent restores of an archive, one wins.
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := sm.RestoreArchive(ctx, a.File)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	restored := 0
+	for err := range errs {
+		if err == nil {
+			restored++
+		}
+	}
+	if restored != 1 || len(sm.List()) != 1 {
+		t.Fatalf("%d restores succeeded, %d sessions listed; want one", restored, len(sm.List()))
+	}
+
+	// An archive being downloaded for a restore is claimed too.
+	store := memArchiveStore{a.File: data}
+	sm.ArchiveStore = store
+	claimed := path + ".restoring"
+	if err := os.WriteFile(claimed, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.RestoreArchive(ctx, a.File); err == nil || !strings.Contains(err.Error(), "already being restored") {
+		t.Errorf("restore of a claimed archive: %v", err)
+	}
+	if err := os.Remove(claimed); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restore that fails gives the archive up again.
+	store[a.File] = []byte("not a tar file")
+	if _, err := sm.RestoreArchive(ctx, a.File); err == nil {
+		t.Fatal("restored a corrupt archive")
+	}
+	if _, err := os.Stat(claimed); !os.IsNotExist(err) {
+		t.Errorf("claim left after a failed restore: %v", err)
+	}
+}
+
+func TestArchiveBefore(t *testing.T) {
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	ctx := context.Background()
+
+	id, err := sm.Launch([]string{"true"}, t.TempDir(), nil, nil, "")
+	if err != nil {
+		t.Fatalf("Launch: %v", err)
+	}
+	waitExited(t, sm, id)
+	if archived, err := sm.ArchiveBefore(ctx, time.Now().Add(-time.Hour)); err != nil || len(archived) != 0 {
+		t.Fatalf("ArchiveBefore an hour ago = %+v, %v; want nothing", archived, err)
+	}
+	archived, err := sm.ArchiveBefore(ctx, time.Now().Add(time.Second))
+	if err != nil || len(archived) != 1 || archived[0].ID != id {
+		t.Fatalf("ArchiveBefore = %+v, %v; want session %d", archived, err, id)
+	}
+}
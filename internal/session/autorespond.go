@@ -0,0 +1,79 @@
+package session
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// autoRespondWindow is how much of a session's most recent output, before
+// ANSI stripping, auto-respond rules are matched against.
+const autoRespondWindow = 1024
+
+type autoRespondRule struct {
+	protocol.AutoRespondRule
+	re *regexp.Regexp
+}
+
+// autoResponder matches a session's output stream against its auto-respond
+// rules. It is only used by the session's PTY reader.
+type autoResponder struct {
+	rules []autoRespondRule
+	tail  []byte
+}
+
+// newAutoResponder compiles rules, returning nil when there are none.
+func newAutoResponder(rules []protocol.AutoRespondRule) (*autoResponder, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	a := &autoResponder{}
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auto-respond pattern %q: %w", r.Pattern, err)
+		}
+		a.rules = append(a.rules, autoRespondRule{AutoRespondRule: r, re: re})
+	}
+	return a, nil
+}
+
+// feed adds output to the window and returns the first rule matching it,
+// with the matched text. A match clears the window, so each prompt is only
+// answered once.
+func (a *autoResponder) feed(data []byte) (*protocol.AutoRespondRule, string, bool) {
+	a.tail = append(a.tail, data...)
+	if over := len(a.tail) - autoRespondWindow; over > 0 {
+		a.tail = append(a.tail[:0], a.tail[over:]...)
+	}
+	text := StripANSI(string(a.tail))
+	for i := range a.rules {
+		if loc := a.rules[i].re.FindStringIndex(text); loc != nil {
+			a.tail = a.tail[:0]
+			return &a.rules[i].AutoRespondRule, text[loc[0]:loc[1]], true
+		}
+	}
+	return nil, "", false
+}
+
+// autoRespond answers a prompt matched by rule in sess's output, recording a
+// session.auto_responded event.
+func (m *SessionManager) autoRespond(sess *Session, rule *protocol.AutoRespondRule, match string) {
+	select {
+	case sess.inputCh <- []byte(rule.Response + "\r"):
+	default:
+		slog.Warn("input channel full when auto-responding", "id", sess.Meta.ID)
+		return
+	}
+	event := NewAutoRespondedEvent(AutoRespondedData{
+		Pattern:  rule.Pattern,
+		Response: rule.Response,
+		Match:    sess.redact.redactString(match),
+	})
+	if sess.eventLog != nil {
+		sess.eventLog.Append(event)
+	}
+	m.Subscriptions.Publish(sess.Meta.ID, sess.Meta.Tags, sess.Meta.Labels, event)
+}
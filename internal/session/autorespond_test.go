@@ -0,0 +1,99 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestAutoResponderFeed(t *testing.T) {
+	a, err := newAutoResponder([]protocol.AutoRespondRule{
+		{Pattern: `(?i)\(y/n\)\s*$`, Response: "y"},
+		{Pattern: `Press Enter`, Response: ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A prompt split across reads, with colour codes, matches once it ends
+	// the output.
+	if _, _, ok := a.feed([]byte("Proceed? \x1b[1m(Y/")); ok {
+		t.Fatal("matched an incomplete prompt")
+	}
+	rule, match, ok := a.feed([]byte("n)\x1b[0m "))
+	if !ok || rule.Response != "y" || match != "(Y/n) " {
+		t.Fatalf("feed = %+v %q %v, want the y/n rule", rule, match, ok)
+	}
+	// The echoed answer does not match it again.
+	if _, _, ok := a.feed([]byte("y\r\n")); ok {
+		t.Fatal("matched the answered prompt again")
+	}
+	// Output after a prompt means it is not waiting.
+	if _, _, ok := a.feed([]byte("Continue (y/n)? ok\r\n")); ok {
+		t.Fatal("matched a prompt that was not last in the output")
+	}
+	if rule, _, ok := a.feed([]byte("Press Enter to continue")); !ok || rule.Response != "" {
+		t.Fatalf("feed = %+v %v, want the Enter rule", rule, ok)
+	}
+
+	if a, err := newAutoResponder(nil); a != nil || err != nil {
+		t.Errorf("newAutoResponder(nil) = %v, %v; want nil, nil", a, err)
+	}
+	if _, err := newAutoResponder([]protocol.AutoRespondRule{{Pattern: "("}}); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestAutoRespondedEvent(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	sub := sm.Subscriptions.Subscribe(nil, nil, nil, []EventType{EventAutoResponded})
+	defer sm.Subscriptions.Unsubscribe(sub.ID)
+
+	id, err := sm.LaunchWith(LaunchOptions{
+		Command:     []string{"sh", "-c", `printf 'Overwrite? [y/N] '; read answer; echo "answer=$answer"`},
+		WorkingDir:  dir,
+		AutoRespond: []protocol.AutoRespondRule{{Pattern: `\[y/N\] $`, Response: "y"}},
+	})
+	if err != nil {
+		t.Fatalf("LaunchWith: %v", err)
+	}
+	select {
+	case se := <-sub.Ch:
+		var d AutoRespondedData
+		if err := json.Unmarshal(se.Event.Data, &d); err != nil {
+			t.Fatal(err)
+		}
+		if se.SessionID != id || d.Response != "y" || d.Match != "[y/N] " {
+			t.Fatalf("auto_responded event = %d %+v", se.SessionID, d)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no session.auto_responded event")
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		out, _ := os.ReadFile(filepath.Join(dir, "sessions", "1", "output.log"))
+		if strings.Contains(string(out), "answer=y") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("output = %q, want the prompt answered", out)
+		}
+	}
+
+	if _, err := sm.LaunchWith(LaunchOptions{
+		Command:     []string{"true"},
+		WorkingDir:  dir,
+		AutoRespond: []protocol.AutoRespondRule{{Pattern: "[", Response: "y"}},
+	}); err == nil {
+		t.Error("launch with an invalid auto-respond pattern succeeded")
+	}
+}
@@ -0,0 +1,160 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// LocalBackend is the name of the backend that runs commands directly on the
+// node's host, used when a launch names none.
+const LocalBackend = "local"
+
+// SessionBackend runs session commands in an execution environment: the
+// node's host, a container, a Kubernetes pod or another machine. Whatever
+// the environment, the process a backend returns runs in a PTY owned by the
+// node, so attach, logs, send, resize and messaging work the same for every
+// backend. Backends are selected per launch by the name they are registered
+// under (see RegisterBackend), and configured by the launch's options.
+type SessionBackend interface {
+	// Prepare validates a launch before its session is created, and returns
+	// the state the backend keeps for the session, such as a container name.
+	// The state is saved in sessions.json, so that Signal still works after
+	// a node restart.
+	Prepare(launch BackendLaunch) (map[string]string, error)
+	// Command returns the process that runs the launch's command in the
+	// session's PTY.
+	Command(launch BackendLaunch, state map[string]string) *exec.Cmd
+	// Signal sends sig to a session's command. pid is the PTY's process, the
+	// leader of its own process group; group also signals the command's
+	// children.
+	Signal(state map[string]string, pid int, sig syscall.Signal, group bool) error
+}
+
+// SessionFinisher is implemented by backends that know more about how a
+// command ended than the exit of its PTY process shows, or that hold
+// resources after it, such as a pod.
+type SessionFinisher interface {
+	// Finish runs once a session's PTY process has exited, and releases what
+	// the backend still holds for it. When ok is set, code is the command's
+	// exit code, in place of the process's. reason explains an abnormal end,
+	// such as "OOMKilled", and is empty otherwise.
+	Finish(state map[string]string) (code int, reason string, ok bool)
+}
+
+// BackendLaunch describes a session's command to its backend.
+type BackendLaunch struct {
+	Command    []string
+	WorkingDir string
+	// Env holds the launch's variables followed by the ones the node sets
+	// for every session (CW_SESSION_ID, ...). It is empty in Prepare.
+	Env []string
+	// Secrets are variables set after Env that must not appear on a
+	// command line, where other users could see them. Backends that cannot
+	// keep them off one refuse them in Prepare.
+	Secrets []string
+	Options map[string]string
+}
+
+// RegisterBackend makes b available to launches as name, replacing any
+// backend registered under that name.
+func (m *SessionManager) RegisterBackend(name string, b SessionBackend) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.backends[name] = b
+}
+
+// Backends returns the names of the registered backends, sorted.
+func (m *SessionManager) Backends() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.backends))
+	for name := range m.backends {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// backend returns the backend registered as name, LocalBackend for "".
+func (m *SessionManager) backend(name string) (SessionBackend, error) {
+	if name == "" {
+		name = LocalBackend
+	}
+	m.mu.RLock()
+	b, ok := m.backends[name]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (available: %s)", name, strings.Join(m.Backends(), ", "))
+	}
+	return b, nil
+}
+
+// signalSession signals a started session's command through its backend.
+// Sessions whose backend is no longer registered are signalled as local
+// processes.
+func (m *SessionManager) signalSession(meta SessionMeta, sig syscall.Signal, group bool) error {
+	if meta.PID == nil {
+		return nil
+	}
+	b, err := m.backend(meta.Backend)
+	if err != nil {
+		b = localBackend{}
+	}
+	return b.Signal(meta.BackendState, int(*meta.PID), sig, group)
+}
+
+// refuseSecrets fails a launch with secrets on backend, which cannot pass
+// them to the command without a command line.
+func refuseSecrets(backend string, launch BackendLaunch) error {
+	if len(launch.Secrets) > 0 {
+		return fmt.Errorf("backend %s cannot pass secrets without exposing them on a command line; use --env", backend)
+	}
+	return nil
+}
+
+// checkOptions fails when options holds keys other than known.
+func checkOptions(backend string, options map[string]string, known ...string) error {
+	for key := range options {
+		if !slices.Contains(known, key) {
+			if len(known) == 0 {
+				return fmt.Errorf("backend %s takes no options, got %q", backend, key)
+			}
+			return fmt.Errorf("backend %s has no option %q (valid: %s)", backend, key, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// localBackend runs the command directly on the node's host.
+type localBackend struct{}
+
+func (localBackend) Prepare(launch BackendLaunch) (map[string]string, error) {
+	if err := checkOptions(LocalBackend, launch.Options); err != nil {
+		return nil, err
+	}
+	cmdName := launch.Command[0]
+	if filepath.IsAbs(cmdName) {
+		if _, err := os.Stat(cmdName); err != nil {
+			return nil, fmt.Errorf("command %q does not exist", cmdName)
+		}
+	} else if _, err := exec.LookPath(cmdName); err != nil {
+		return nil, fmt.Errorf("command %q not found in PATH", cmdName)
+	}
+	return nil, nil
+}
+
+func (localBackend) Command(launch BackendLaunch, state map[string]string) *exec.Cmd {
+	cmd := exec.Command(launch.Command[0], launch.Command[1:]...)
+	cmd.Dir = launch.WorkingDir
+	cmd.Env = buildEnv(slices.Concat(launch.Env, launch.Secrets))
+	return cmd
+}
+
+func (localBackend) Signal(state map[string]string, pid int, sig syscall.Signal, group bool) error {
+	return signalGroup(pid, sig, group)
+}
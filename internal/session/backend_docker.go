@@ -0,0 +1,126 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// containerRuntimes are the runtimes DockerBackend tries, in order, when it
+// is not configured with one.
+var containerRuntimes = []string{"docker", "podman"}
+
+// backendCommandTimeout bounds the commands backends run besides the
+// session's own, such as docker kill.
+const backendCommandTimeout = 10 * time.Second
+
+// DockerBackend runs the command in a fresh container with the runtime's run
+// command. The runtime client is the PTY's process: it passes the terminal,
+// its size and the exit code through, and the container is removed when the
+// command exits. The working directory is mounted at the same path, and the
+// command runs as the node's user.
+//
+// Options: image (required).
+type DockerBackend struct {
+	// Runtime is "docker" or "podman". Empty uses whichever is in PATH.
+	Runtime string
+}
+
+func (b DockerBackend) Prepare(launch BackendLaunch) (map[string]string, error) {
+	if err := checkOptions("docker", launch.Options, "image"); err != nil {
+		return nil, err
+	}
+	image := launch.Options["image"]
+	if image == "" || strings.HasPrefix(image, "-") {
+		return nil, fmt.Errorf("backend docker needs a valid image, got %q", image)
+	}
+	runtime := b.Runtime
+	if runtime == "" {
+		for _, r := range containerRuntimes {
+			if _, err := exec.LookPath(r); err == nil {
+				runtime = r
+				break
+			}
+		}
+		if runtime == "" {
+			return nil, fmt.Errorf("backend docker needs docker or podman in the node's PATH")
+		}
+	} else if _, err := exec.LookPath(runtime); err != nil {
+		return nil, fmt.Errorf("container runtime %q not found in PATH", runtime)
+	}
+	return map[string]string{
+		"runtime":   runtime,
+		"image":     image,
+		"container": "cw-" + randomSuffix(),
+	}, nil
+}
+
+func (DockerBackend) Command(launch BackendLaunch, state map[string]string) *exec.Cmd {
+	runtime := state["runtime"]
+	args := []string{
+		"run", "--rm", "--interactive", "--tty", "--init",
+		"--name", state["container"],
+		"--volume", launch.WorkingDir + ":" + launch.WorkingDir,
+		"--workdir", launch.WorkingDir,
+		"--env", "TERM=" + terminalType(),
+	}
+	// Files the command writes to the mounted directory belong to the
+	// node's user, as they would for a local session.
+	if runtime == "podman" {
+		args = append(args, "--userns=keep-id")
+	} else {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+	}
+	for _, e := range launch.Env {
+		args = append(args, "--env", e)
+	}
+	// A bare --env NAME takes the value from the runtime client's
+	// environment, keeping secrets out of its arguments.
+	for _, e := range launch.Secrets {
+		name, _, _ := strings.Cut(e, "=")
+		args = append(args, "--env", name)
+	}
+	args = append(args, state["image"])
+	args = append(args, launch.Command...)
+
+	cmd := exec.Command(runtime, args...)
+	cmd.Dir = launch.WorkingDir
+	cmd.Env = buildEnv(launch.Secrets)
+	return cmd
+}
+
+// Signal asks the runtime to signal the container, which takes its whole
+// process tree down on SIGKILL. Before the container exists, while the
+// image is pulled, the runtime client is signalled instead.
+func (DockerBackend) Signal(state map[string]string, pid int, sig syscall.Signal, group bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), backendCommandTimeout)
+	defer cancel()
+	err := exec.CommandContext(ctx, state["runtime"], "kill", "--signal", strconv.Itoa(int(sig)), state["container"]).Run()
+	if err != nil {
+		return signalGroup(pid, sig, true)
+	}
+	return nil
+}
+
+// terminalType is the TERM given to commands that do not inherit the
+// node's environment.
+func terminalType() string {
+	if term := os.Getenv("TERM"); term != "" {
+		return term
+	}
+	return "xterm-256color"
+}
+
+// randomSuffix returns 8 random hex digits, to name containers and pods.
+func randomSuffix() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
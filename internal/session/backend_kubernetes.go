@@ -0,0 +1,149 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// KubernetesBackend runs the command in a new pod with kubectl run, attached
+// to the session's PTY. Unlike DockerBackend it mounts nothing: the command
+// works on what the image and the cluster provide. A node running in the
+// cluster uses its service account, which needs to create, get and delete
+// pods and create pods/attach.
+//
+// When the command ends the pod's termination decides the session's exit
+// code and reason, such as OOMKilled or Evicted, and the pod is deleted.
+//
+// Options: image (required), namespace, context (the kubeconfig context),
+// and workdir (the container's working directory).
+type KubernetesBackend struct{}
+
+func (KubernetesBackend) Prepare(launch BackendLaunch) (map[string]string, error) {
+	opts := launch.Options
+	if err := checkOptions("kubernetes", opts, "image", "namespace", "context", "workdir"); err != nil {
+		return nil, err
+	}
+	if err := refuseSecrets("kubernetes", launch); err != nil {
+		return nil, err
+	}
+	if opts["image"] == "" || strings.HasPrefix(opts["image"], "-") {
+		return nil, fmt.Errorf("backend kubernetes needs a valid image, got %q", opts["image"])
+	}
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		return nil, fmt.Errorf("backend kubernetes needs kubectl in the node's PATH")
+	}
+	state := map[string]string{
+		"image": opts["image"],
+		"pod":   "cw-" + randomSuffix(),
+	}
+	for _, key := range []string{"namespace", "context", "workdir"} {
+		if opts[key] != "" {
+			state[key] = opts[key]
+		}
+	}
+	return state, nil
+}
+
+func (KubernetesBackend) Command(launch BackendLaunch, state map[string]string) *exec.Cmd {
+	pod := state["pod"]
+	args := append(kubectlTarget(state), "run", pod,
+		"--image", state["image"],
+		"--restart", "Never", "--stdin", "--tty",
+		"--labels", "app.kubernetes.io/managed-by=codewire",
+		"--env", "TERM="+terminalType(),
+	)
+	for _, e := range launch.Env {
+		args = append(args, "--env", e)
+	}
+	if dir := state["workdir"]; dir != "" {
+		overrides, _ := json.Marshal(map[string]any{
+			"apiVersion": "v1",
+			"spec": map[string]any{
+				"containers": []map[string]any{{"name": pod, "workingDir": dir}},
+			},
+		})
+		args = append(args, "--overrides", string(overrides))
+	}
+	args = append(args, "--command", "--")
+	args = append(args, launch.Command...)
+
+	cmd := exec.Command("kubectl", args...)
+	cmd.Dir = launch.WorkingDir
+	cmd.Env = buildEnv(nil)
+	return cmd
+}
+
+// Signal deletes the pod, which sends its command SIGTERM and, after the
+// pod's grace period, SIGKILL. SIGKILL deletes it at once. Before the pod
+// exists kubectl itself is signalled.
+func (KubernetesBackend) Signal(state map[string]string, pid int, sig syscall.Signal, group bool) error {
+	args := append(kubectlTarget(state), "delete", "pod", state["pod"], "--wait=false")
+	if sig == syscall.SIGKILL {
+		args = append(args, "--grace-period", "0", "--force")
+	}
+	if _, err := kubectl(args...); err != nil {
+		return signalGroup(pid, sig, true)
+	}
+	return nil
+}
+
+// podTermination is the jsonpath of what Finish reads from the pod: the
+// container's exit code and reason, and the pod's own reason, set when it
+// was evicted or ran out of time.
+const podTermination = `{.status.containerStatuses[0].state.terminated.exitCode}|` +
+	`{.status.containerStatuses[0].state.terminated.reason}|{.status.reason}`
+
+// Finish reads how the pod ended, then deletes it.
+func (KubernetesBackend) Finish(state map[string]string) (int, string, bool) {
+	target := kubectlTarget(state)
+	out, err := kubectl(append(target, "get", "pod", state["pod"], "--output", "jsonpath="+podTermination)...)
+	if _, delErr := kubectl(append(target, "delete", "pod", state["pod"], "--wait=false", "--ignore-not-found")...); delErr != nil {
+		slog.Error("failed to delete session pod", "pod", state["pod"], "err", delErr)
+	}
+	if err != nil {
+		return 0, "", false
+	}
+	return parsePodTermination(out)
+}
+
+// parsePodTermination parses podTermination's output. The reasons of
+// ordinary exits, Completed and Error, are dropped.
+func parsePodTermination(out string) (int, string, bool) {
+	fields := strings.SplitN(out, "|", 3)
+	for len(fields) < 3 {
+		fields = append(fields, "")
+	}
+	reason := fields[2]
+	if reason == "" && fields[1] != "Completed" && fields[1] != "Error" {
+		reason = fields[1]
+	}
+	code, err := strconv.Atoi(fields[0])
+	return code, reason, err == nil
+}
+
+// kubectl runs kubectl with args and returns its output.
+func kubectl(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backendCommandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "kubectl", args...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// kubectlTarget returns the kubectl flags selecting state's context and
+// namespace.
+func kubectlTarget(state map[string]string) []string {
+	var args []string
+	if state["context"] != "" {
+		args = append(args, "--context", state["context"])
+	}
+	if state["namespace"] != "" {
+		args = append(args, "--namespace", state["namespace"])
+	}
+	return args
+}
@@ -0,0 +1,81 @@
+package session
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// SSHBackend runs the command on another machine with ssh, in a remote
+// terminal attached to the session's PTY. Authentication must work without
+// a prompt (keys or an agent): the node cannot answer one.
+//
+// Options: host (required, anything ssh accepts, including aliases from
+// ~/.ssh/config), and dir (the remote working directory; by default the
+// remote user's home).
+type SSHBackend struct{}
+
+func (SSHBackend) Prepare(launch BackendLaunch) (map[string]string, error) {
+	opts := launch.Options
+	if err := checkOptions("ssh", opts, "host", "dir"); err != nil {
+		return nil, err
+	}
+	if err := refuseSecrets("ssh", launch); err != nil {
+		return nil, err
+	}
+	if opts["host"] == "" || strings.HasPrefix(opts["host"], "-") {
+		return nil, fmt.Errorf("backend ssh needs a valid host, got %q", opts["host"])
+	}
+	if _, err := exec.LookPath("ssh"); err != nil {
+		return nil, fmt.Errorf("backend ssh needs ssh in the node's PATH")
+	}
+	state := map[string]string{"host": opts["host"]}
+	if opts["dir"] != "" {
+		state["dir"] = opts["dir"]
+	}
+	return state, nil
+}
+
+func (SSHBackend) Command(launch BackendLaunch, state map[string]string) *exec.Cmd {
+	// The remote shell gets one string: the working directory, the
+	// session's variables and the command, each word quoted.
+	words := []string{"exec", "env"}
+	for _, e := range launch.Env {
+		words = append(words, shellQuote(e))
+	}
+	for _, arg := range launch.Command {
+		words = append(words, shellQuote(arg))
+	}
+	remote := strings.Join(words, " ")
+	if dir := state["dir"]; dir != "" {
+		// Leave a leading ~/ unquoted for the remote shell to expand.
+		if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+			dir = "~/" + shellQuote(rest)
+		} else {
+			dir = shellQuote(dir)
+		}
+		remote = "cd " + dir + " && " + remote
+	}
+
+	cmd := exec.Command("ssh", "-tt", "-o", "BatchMode=yes", state["host"], "--", remote)
+	cmd.Dir = launch.WorkingDir
+	cmd.Env = buildEnv(nil)
+	return cmd
+}
+
+// Signal signals the local ssh client. When it exits the connection closes
+// and the remote command gets SIGHUP.
+func (SSHBackend) Signal(state map[string]string, pid int, sig syscall.Signal, group bool) error {
+	return signalGroup(pid, sig, true)
+}
+
+// shellQuote quotes s for a POSIX shell, leaving plain words as they are.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:@%+", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
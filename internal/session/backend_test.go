@@ -0,0 +1,256 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRuntime stands in for docker: it logs its arguments, runs the command
+// after the image on the host, and fails kill as if the container were not
+// there yet.
+const fakeRuntime = `#!/bin/sh
+echo "$@" >> "$0.log"
+[ "$1" = run ] || exit 1
+shift
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--name|--volume|--workdir|--env|--user) shift 2 ;;
+	--*) shift ;;
+	*) break ;;
+	esac
+done
+shift
+exec "$@"
+`
+
+func TestContainerBackend(t *testing.T) {
+	runtime := filepath.Join(t.TempDir(), "docker")
+	if err := os.WriteFile(runtime, []byte(fakeRuntime), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	sm.RegisterBackend("docker", DockerBackend{Runtime: runtime})
+	workDir := t.TempDir()
+
+	id, err := sm.LaunchWith(LaunchOptions{
+		Command:        []string{"sh", "-c", "echo in-container; sleep 30"},
+		WorkingDir:     workDir,
+		Env:            []string{"FOO=bar"},
+		Name:           "boxed",
+		Backend:        "docker",
+		BackendOptions: map[string]string{"image": "alpine:3"},
+	})
+	if err != nil {
+		t.Fatalf("LaunchWith: %v", err)
+	}
+	_, output, err := sm.SubscribeOutput(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-output.Ready():
+		if out, _ := output.Next(); !strings.Contains(string(out.Data), "in-container") {
+			t.Fatalf("output = %q", out.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no output from container session")
+	}
+
+	info, _, _ := sm.GetStatus(id)
+	container := info.BackendState["container"]
+	if info.Backend != "docker" || info.BackendState["image"] != "alpine:3" || !strings.HasPrefix(container, "cw-") {
+		t.Fatalf("SessionInfo backend = %q %v", info.Backend, info.BackendState)
+	}
+
+	if err := sm.Kill(id); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	waitExited(t, sm, id)
+
+	log, err := os.ReadFile(runtime + ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("runtime calls = %q", lines)
+	}
+	for _, want := range []string{
+		"run --rm --interactive --tty --init --name " + container,
+		"--volume " + workDir + ":" + workDir + " --workdir " + workDir,
+		"--env FOO=bar --env CW_SESSION_ID=1 --env CW_SESSION_NAME=boxed alpine:3 sh -c",
+	} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("run arguments %q lack %q", lines[0], want)
+		}
+	}
+	// The kill fails, so the runtime client is signalled instead.
+	if lines[1] != "kill --signal 15 "+container {
+		t.Errorf("kill arguments = %q", lines[1])
+	}
+}
+
+func TestBackendSelection(t *testing.T) {
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	if got := strings.Join(sm.Backends(), ","); got != "docker,kubernetes,local,ssh" {
+		t.Fatalf("Backends = %s", got)
+	}
+	sm.RegisterBackend("docker", DockerBackend{Runtime: filepath.Join(t.TempDir(), "podman")})
+
+	for _, tc := range []struct {
+		backend string
+		options map[string]string
+		want    string
+	}{
+		{"vm", nil, `unknown backend "vm"`},
+		{"", map[string]string{"image": "alpine"}, "takes no options"},
+		{"docker", nil, "needs a valid image"},
+		{"docker", map[string]string{"image": "--privileged"}, "needs a valid image"},
+		{"docker", map[string]string{"image": "alpine", "tag": "3"}, `no option "tag"`},
+		{"docker", map[string]string{"image": "alpine"}, "not found in PATH"},
+		{"ssh", map[string]string{"host": "-oProxyCommand=x"}, "needs a valid host"},
+	} {
+		_, err := sm.LaunchWith(LaunchOptions{
+			Command:        []string{"true"},
+			WorkingDir:     t.TempDir(),
+			Backend:        tc.backend,
+			BackendOptions: tc.options,
+		})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("backend %q %v: got %v, want %q", tc.backend, tc.options, err, tc.want)
+		}
+	}
+
+	// The local backend may be named explicitly.
+	id, err := sm.LaunchWith(LaunchOptions{Command: []string{"true"}, WorkingDir: t.TempDir(), Backend: LocalBackend})
+	if err != nil {
+		t.Fatalf("LaunchWith local: %v", err)
+	}
+	if info, _, _ := sm.GetStatus(id); info.Backend != "" {
+		t.Errorf("local session backend = %q, want empty", info.Backend)
+	}
+}
+
+func TestRemoteBackendCommands(t *testing.T) {
+	launch := BackendLaunch{
+		Command:    []string{"claude", "-p", "it's done?"},
+		WorkingDir: "/tmp",
+		Env:        []string{"CW_SESSION_ID=7"},
+	}
+
+	cmd := SSHBackend{}.Command(launch, map[string]string{"host": "build-box", "dir": "~/src/my app"})
+	want := []string{"ssh", "-tt", "-o", "BatchMode=yes", "build-box", "--",
+		`cd ~/'src/my app' && exec env CW_SESSION_ID=7 claude -p 'it'\''s done?'`}
+	if !slices.Equal(cmd.Args, want) {
+		t.Errorf("ssh args = %q, want %q", cmd.Args, want)
+	}
+
+	cmd = KubernetesBackend{}.Command(launch, map[string]string{"image": "node:22", "pod": "cw-1", "namespace": "agents"})
+	args := strings.Join(cmd.Args, " ")
+	for _, want := range []string{
+		"kubectl --namespace agents run cw-1 --image node:22 --restart Never --stdin --tty",
+		"--env CW_SESSION_ID=7 --command -- claude -p it's done?",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("kubectl args %q lack %q", args, want)
+		}
+	}
+}
+
+// fakeKubectl stands in for kubectl: run runs the command on the host, get
+// reports the pod as killed for running out of memory, and every call is
+// logged.
+const fakeKubectl = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/kubectl.log"
+case "$*" in
+*" run "*)
+	while [ "$1" != -- ]; do shift; done
+	shift
+	exec "$@" ;;
+*" get "*) echo "137|OOMKilled|" ;;
+esac
+`
+
+// TestKubernetesPodTermination checks that a session in a pod takes its
+// exit code and reason from the pod's termination, and that the pod is
+// deleted afterwards.
+func TestKubernetesPodTermination(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "kubectl"), []byte(fakeKubectl), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	sub := sm.Subscriptions.Subscribe(nil, nil, nil, []EventType{EventSessionStatus})
+	defer sm.Subscriptions.Unsubscribe(sub.ID)
+
+	id, err := sm.LaunchWith(LaunchOptions{
+		Command:        []string{"sh", "-c", "exit 1"},
+		WorkingDir:     t.TempDir(),
+		Backend:        "kubernetes",
+		BackendOptions: map[string]string{"image": "node:22", "namespace": "agents"},
+	})
+	if err != nil {
+		t.Fatalf("LaunchWith: %v", err)
+	}
+	select {
+	case se := <-sub.Ch:
+		var d SessionStatusData
+		if err := json.Unmarshal(se.Event.Data, &d); err != nil {
+			t.Fatal(err)
+		}
+		if d.ExitCode == nil || *d.ExitCode != 137 || d.Reason != "OOMKilled" {
+			t.Fatalf("session.status = %+v", d)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no session.status event")
+	}
+
+	info, _, _ := sm.GetStatus(id)
+	if info.Status != "completed (137)" || info.ExitReason != "OOMKilled" {
+		t.Fatalf("status = %s, reason %q", info.Status, info.ExitReason)
+	}
+	log, err := os.ReadFile(filepath.Join(bin, "kubectl.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := info.BackendState["pod"]
+	if want := "--namespace agents delete pod " + pod + " --wait=false --ignore-not-found"; !strings.Contains(string(log), want) {
+		t.Errorf("kubectl calls %q lack %q", log, want)
+	}
+}
+
+func TestParsePodTermination(t *testing.T) {
+	for _, tt := range []struct {
+		out    string
+		code   int
+		reason string
+		ok     bool
+	}{
+		{"0|Completed|", 0, "", true},
+		{"2|Error|", 2, "", true},
+		{"137|OOMKilled|", 137, "OOMKilled", true},
+		{"||Evicted", 0, "Evicted", false},
+		{"", 0, "", false},
+	} {
+		code, reason, ok := parsePodTermination(tt.out)
+		if code != tt.code || reason != tt.reason || ok != tt.ok {
+			t.Errorf("parsePodTermination(%q) = %d, %q, %v", tt.out, code, reason, ok)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package session
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// writeTools are the tool names counted against Budget.Writes.
+var writeTools = map[string]bool{
+	"Edit": true, "Write": true, "MultiEdit": true, "NotebookEdit": true,
+}
+
+// BudgetUsed is what a session's agent has used of its budget. It is kept in
+// SessionMeta so that a restarted or adopted session does not start over.
+type BudgetUsed struct {
+	ToolCalls []time.Time `json:"tool_calls,omitempty"` // within the last hour
+	Bash      int         `json:"bash,omitempty"`
+	Writes    int         `json:"writes,omitempty"`
+}
+
+// SetBudget sets the tool budget for a session, replacing any previous one.
+func (m *SessionManager) SetBudget(id uint32, budget protocol.Budget) error {
+	m.mu.RLock()
+	sess, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("session %d not found", id)
+	}
+	sess.mu.Lock()
+	sess.Meta.Budget = &budget
+	usage := sess.Meta.Usage
+	sess.mu.Unlock()
+	m.triggerPersist()
+	if usage != nil {
+		m.enforceCost(sess, *usage)
+	}
+	return nil
+}
+
+// ChargeBudget counts a tool call against the session's budget. If the call
+// would exceed a limit it is not counted, a session.budget_exceeded event is
+// emitted, and a human-readable reason is returned. An empty reason means the
+// call is allowed.
+func (m *SessionManager) ChargeBudget(id uint32, tool string) (string, error) {
+	m.mu.RLock()
+	sess, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("session %d not found", id)
+	}
+
+	sess.mu.Lock()
+	budget := sess.Meta.Budget
+	tags, labels := sess.Meta.Tags, sess.Meta.Labels
+	if budget == nil {
+		sess.mu.Unlock()
+		return "", nil
+	}
+	// Copies of Meta share the BudgetUsed they were taken with, so it is
+	// replaced rather than changed.
+	var u BudgetUsed
+	if prev := sess.Meta.BudgetUsed; prev != nil {
+		u.Bash, u.Writes = prev.Bash, prev.Writes
+		cutoff := time.Now().Add(-time.Hour)
+		for _, t := range prev.ToolCalls {
+			if t.After(cutoff) {
+				u.ToolCalls = append(u.ToolCalls, t)
+			}
+		}
+	}
+
+	var data BudgetExceededData
+	switch {
+	case budget.Tools > 0 && len(u.ToolCalls) >= budget.Tools:
+		data = BudgetExceededData{Budget: "tools", Limit: budget.Tools, Used: len(u.ToolCalls), Tool: tool}
+	case tool == "Bash" && budget.Bash > 0 && u.Bash >= budget.Bash:
+		data = BudgetExceededData{Budget: "bash", Limit: budget.Bash, Used: u.Bash, Tool: tool}
+	case writeTools[tool] && budget.Writes > 0 && u.Writes >= budget.Writes:
+		data = BudgetExceededData{Budget: "writes", Limit: budget.Writes, Used: u.Writes, Tool: tool}
+	default:
+		u.ToolCalls = append(u.ToolCalls, time.Now())
+		if tool == "Bash" {
+			u.Bash++
+		}
+		if writeTools[tool] {
+			u.Writes++
+		}
+		sess.Meta.BudgetUsed = &u
+		sess.mu.Unlock()
+		m.triggerPersist()
+		return "", nil
+	}
+	sess.mu.Unlock()
+
+	event := NewBudgetExceededEvent(data)
+	if sess.eventLog != nil {
+		sess.eventLog.Append(event)
+	}
+	m.Subscriptions.Publish(id, tags, labels, event)
+
+	return data.Reason(), nil
+}
+
+// Reason describes the exceeded budget for a hook block decision.
+func (d BudgetExceededData) Reason() string {
+	switch d.Budget {
+	case "tools":
+		return fmt.Sprintf("session budget exceeded: %d/%d tool calls in the last hour", d.Used, d.Limit)
+	case "bash":
+		return fmt.Sprintf("session budget exceeded: %d/%d Bash invocations", d.Used, d.Limit)
+	default:
+		return fmt.Sprintf("session budget exceeded: %d/%d file writes", d.Used, d.Limit)
+	}
+}
@@ -0,0 +1,97 @@
+package session
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestChargeBudget(t *testing.T) {
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	id := launchSleep(t, sm)
+
+	// No budget: everything allowed.
+	if reason, err := sm.ChargeBudget(id, "Bash"); err != nil || reason != "" {
+		t.Fatalf("expected allow without budget, got reason=%q err=%v", reason, err)
+	}
+
+	if err := sm.SetBudget(id, protocol.Budget{Tools: 4, Bash: 1, Writes: 1}); err != nil {
+		t.Fatalf("SetBudget: %v", err)
+	}
+	sub := sm.Subscriptions.Subscribe(&id, nil, nil, []EventType{EventBudgetExceeded})
+	defer sm.Subscriptions.Unsubscribe(sub.ID)
+
+	for _, tool := range []string{"Bash", "Write"} {
+		if reason, _ := sm.ChargeBudget(id, tool); reason != "" {
+			t.Fatalf("first %s should be allowed, got %q", tool, reason)
+		}
+	}
+	reason, _ := sm.ChargeBudget(id, "Bash")
+	if !strings.Contains(reason, "1/1 Bash") {
+		t.Fatalf("expected bash budget reason, got %q", reason)
+	}
+	if reason, _ := sm.ChargeBudget(id, "Edit"); !strings.Contains(reason, "file writes") {
+		t.Fatalf("expected writes budget reason, got %q", reason)
+	}
+
+	// Blocked calls are not counted: two more non-write tools fit in tools=4.
+	for i := 0; i < 2; i++ {
+		if reason, _ := sm.ChargeBudget(id, "Read"); reason != "" {
+			t.Fatalf("Read %d should be allowed, got %q", i, reason)
+		}
+	}
+	if reason, _ := sm.ChargeBudget(id, "Read"); !strings.Contains(reason, "4/4 tool calls") {
+		t.Fatalf("expected tools budget reason, got %q", reason)
+	}
+
+	se := <-sub.Ch
+	var data BudgetExceededData
+	if err := json.Unmarshal(se.Event.Data, &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.Budget != "bash" || data.Limit != 1 || data.Tool != "Bash" {
+		t.Fatalf("unexpected event data: %+v", data)
+	}
+}
+
+func TestBudgetUsedSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	id := launchSleep(t, sm)
+	if err := sm.SetBudget(id, protocol.Budget{Tools: 3, Bash: 1}); err != nil {
+		t.Fatalf("SetBudget: %v", err)
+	}
+	for _, tool := range []string{"Bash", "Read"} {
+		if reason, _ := sm.ChargeBudget(id, tool); reason != "" {
+			t.Fatalf("%s should be allowed, got %q", tool, reason)
+		}
+	}
+	sm.PersistMeta()
+
+	// A node started after this one exited adopts the session with what it
+	// had used.
+	next, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	if n := next.RecoverOrphans(OrphanAdopt, nil); n != 1 {
+		t.Fatalf("RecoverOrphans found %d sessions, want 1", n)
+	}
+	if reason, _ := next.ChargeBudget(id, "Bash"); !strings.Contains(reason, "1/1 Bash") {
+		t.Fatalf("expected bash budget reason after restart, got %q", reason)
+	}
+	if reason, _ := next.ChargeBudget(id, "Read"); reason != "" {
+		t.Fatalf("Read should be allowed, got %q", reason)
+	}
+	if reason, _ := next.ChargeBudget(id, "Read"); !strings.Contains(reason, "3/3 tool calls") {
+		t.Fatalf("expected tools budget reason after restart, got %q", reason)
+	}
+}
@@ -0,0 +1,129 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// claudeBinary is the name Claude Code is run as.
+const claudeBinary = "claude"
+
+// isClaude reports whether command runs Claude Code.
+func isClaude(command []string) bool {
+	return len(command) > 0 && filepath.Base(command[0]) == claudeBinary
+}
+
+// claudeSessionArg returns the Claude Code session command picks with
+// --session-id or resumes with --resume (-r), if it is a claude command.
+func claudeSessionArg(command []string) string {
+	if !isClaude(command) {
+		return ""
+	}
+	for i := 1; i < len(command); i++ {
+		arg := command[i]
+		for _, flag := range []string{"--session-id", "--resume", "-r"} {
+			if v, ok := strings.CutPrefix(arg, flag+"="); ok {
+				return v
+			}
+			if arg == flag && i+1 < len(command) && !strings.HasPrefix(command[i+1], "-") {
+				return command[i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// claudeSessionLine returns the session ID in a message Claude Code prints
+// with --output-format json or stream-json: every message carries it, from
+// the init message on.
+func claudeSessionLine(line string) string {
+	if !strings.HasPrefix(line, "{") {
+		return ""
+	}
+	var msg struct {
+		SessionID string `json:"session_id"`
+	}
+	if json.Unmarshal([]byte(line), &msg) != nil {
+		return ""
+	}
+	return msg.SessionID
+}
+
+// SetAgentSession records the Claude Code session that session id runs,
+// and its transcript if known, as reported by cw hook or its output.
+func (m *SessionManager) SetAgentSession(id uint32, agentSessionID, transcriptPath string) error {
+	m.mu.RLock()
+	sess, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("session %d not found", id)
+	}
+	sess.mu.Lock()
+	changed := false
+	if agentSessionID != "" && agentSessionID != sess.Meta.AgentSessionID {
+		sess.Meta.AgentSessionID = agentSessionID
+		changed = true
+	}
+	if transcriptPath != "" && transcriptPath != sess.Meta.TranscriptPath {
+		sess.Meta.TranscriptPath = transcriptPath
+		changed = true
+	}
+	sess.mu.Unlock()
+	if changed {
+		m.triggerPersist()
+	}
+	return nil
+}
+
+// Resume launches a new session, named name (or a generated name if name
+// is empty), running claude --resume with the Claude Code session that
+// session id ran, followed by args. It runs in the same working directory
+// (and worktree) and, unless id was carried over from a previous node, with
+// the rest of the options id was launched with, like Fork, but without its
+// stdin data. id must have ended: two sessions would both write the
+// conversation.
+func (m *SessionManager) Resume(id uint32, name string, args []string) (uint32, error) {
+	m.mu.RLock()
+	sess, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("session %d not found", id)
+	}
+	if state := sess.statusWatcher.Get().State; state == "running" || state == "queued" {
+		return 0, fmt.Errorf("session %d is still %s; kill it before resuming its conversation", id, state)
+	}
+	sess.mu.Lock()
+	meta := sess.Meta
+	sess.mu.Unlock()
+	if meta.AgentSessionID == "" {
+		return 0, fmt.Errorf("session %d has no recorded Claude Code session (is cw hook installed?)", id)
+	}
+
+	opts := sess.launchOpts
+	binary := claudeBinary
+	if isClaude(opts.Command) {
+		binary = opts.Command[0]
+	}
+	if len(opts.Command) == 0 {
+		opts = LaunchOptions{
+			WorkingDir: meta.WorkingDir,
+			Tags:       meta.Tags,
+			Labels:     meta.Labels,
+			Pool:       meta.Pool,
+		}
+	}
+	opts.Name, opts.GenerateName = name, true
+	opts.StdinData = nil
+	opts.Command = append([]string{binary, "--resume", meta.AgentSessionID}, args...)
+
+	newID, err := m.LaunchWith(opts)
+	if err != nil {
+		return 0, err
+	}
+	if meta.Budget != nil {
+		_ = m.SetBudget(newID, *meta.Budget)
+	}
+	return newID, nil
+}
@@ -0,0 +1,86 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClaudeSessionArg(t *testing.T) {
+	for _, tc := range []struct {
+		command []string
+		want    string
+	}{
+		{[]string{"claude", "--session-id", "abc"}, "abc"},
+		{[]string{"/opt/bin/claude", "-p", "hi", "--resume=def"}, "def"},
+		{[]string{"claude", "-r"}, ""},
+		{[]string{"claude", "-p", "hi"}, ""},
+		{[]string{"codex", "--resume", "abc"}, ""},
+	} {
+		if got := claudeSessionArg(tc.command); got != tc.want {
+			t.Errorf("claudeSessionArg(%q) = %q, want %q", tc.command, got, tc.want)
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	// A stand-in for claude -p --output-format stream-json that keeps
+	// running when resuming.
+	claude := filepath.Join(dir, "claude")
+	script := "#!/bin/sh\n[ \"$1\" = --resume ] && exec sleep 30\necho '{\"type\":\"system\",\"subtype\":\"init\",\"session_id\":\"sess-1\"}'\n"
+	if err := os.WriteFile(claude, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := sm.LaunchWith(LaunchOptions{Command: []string{claude, "-p", "plan"}, WorkingDir: dir})
+	if err != nil {
+		t.Fatalf("LaunchWith: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		info, _, err := sm.GetStatus(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.AgentSessionID == "sess-1" && !strings.HasPrefix(info.Status, "running") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("session %d: status %q, Claude session %q", id, info.Status, info.AgentSessionID)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err := sm.SetAgentSession(id, "", "/tmp/sess-1.jsonl"); err != nil {
+		t.Fatal(err)
+	}
+	newID, err := sm.Resume(id, "planner-2", []string{"-p", "next"})
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	t.Cleanup(func() { _ = sm.Kill(newID) })
+	info, _, err := sm.GetStatus(newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := claude + " --resume sess-1 -p next"; info.Prompt != want || info.WorkingDir != dir {
+		t.Errorf("resumed session runs %q in %s, want %q in %s", info.Prompt, info.WorkingDir, want, dir)
+	}
+	if info.AgentSessionID != "sess-1" {
+		t.Errorf("resumed session's Claude session = %q", info.AgentSessionID)
+	}
+	if old, _, _ := sm.GetStatus(id); old.TranscriptPath != "/tmp/sess-1.jsonl" {
+		t.Errorf("transcript = %q", old.TranscriptPath)
+	}
+
+	if _, err := sm.Resume(newID, "", nil); err == nil {
+		t.Error("resumed a running session")
+	}
+}
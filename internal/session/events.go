@@ -7,6 +7,8 @@ import (
 	"os"
 	"sync"
 	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
 )
 
 // --- Event Types ---
@@ -24,6 +26,15 @@ const (
 	EventDirectMessage  EventType = "direct.message"
 	EventRequest        EventType = "message.request"
 	EventReply          EventType = "message.reply"
+	EventToolResult     EventType = "session.tool_result"
+	EventAgentStopped   EventType = "session.agent_stopped"
+	EventBudgetExceeded EventType = "session.budget_exceeded"
+	EventScheduledRun   EventType = "session.scheduled_run"
+	EventGitDirty       EventType = "session.git_dirty"
+	EventAutoResponded  EventType = "session.auto_responded"
+	EventAlert          EventType = "session.alert"
+	EventRateLimited    EventType = "message.rate_limited"
+	EventCost           EventType = "session.cost"
 )
 
 // Event is a typed, timestamped session event written to events.jsonl.
@@ -42,17 +53,21 @@ type SessionCreatedData struct {
 }
 
 type SessionStatusData struct {
-	From       string  `json:"from"`
-	To         string  `json:"to"`
-	ExitCode   *int    `json:"exit_code,omitempty"`
-	DurationMs *int64  `json:"duration_ms,omitempty"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	DurationMs *int64 `json:"duration_ms,omitempty"`
+	Reason     string `json:"reason,omitempty"` // why the backend ended the command, e.g. OOMKilled
 }
 
 type OutputSummaryData struct {
-	BytesDelta uint64 `json:"bytes_delta"`
-	LinesDelta uint64 `json:"lines_delta"`
-	TotalBytes uint64 `json:"total_bytes"`
-	TotalLines uint64 `json:"total_lines"`
+	BytesDelta uint64   `json:"bytes_delta"`
+	LinesDelta uint64   `json:"lines_delta"`
+	TotalBytes uint64   `json:"total_bytes"`
+	TotalLines uint64   `json:"total_lines"`
+	Summary    string   `json:"summary,omitempty"`
+	Lines      []string `json:"lines,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
 }
 
 type InputData struct {
@@ -91,6 +106,103 @@ type ReplyData struct {
 	Body      string `json:"body"`
 }
 
+// --- Agent Hook Data Types ---
+
+// ToolResultData records a tool call completed by an agent running in the
+// session, as reported by its PostToolUse hook. Response is omitted (and
+// Truncated set) when it exceeds MaxToolResponseBytes, and Input (setting
+// InputTruncated) when it exceeds MaxToolInputBytes.
+type ToolResultData struct {
+	Tool           string          `json:"tool"`
+	Input          json.RawMessage `json:"input,omitempty"`
+	InputBytes     int             `json:"input_bytes"`
+	InputTruncated bool            `json:"input_truncated,omitempty"`
+	Response       json.RawMessage `json:"response,omitempty"`
+	ResponseBytes  int             `json:"response_bytes"`
+	Truncated      bool            `json:"truncated,omitempty"`
+}
+
+// BudgetExceededData records a tool call blocked by the session budget.
+type BudgetExceededData struct {
+	Budget string `json:"budget"` // "tools", "bash", "writes"
+	Limit  int    `json:"limit"`
+	Used   int    `json:"used"`
+	Tool   string `json:"tool"`
+}
+
+// MaxToolResponseBytes caps the tool response stored in a tool_result event.
+const MaxToolResponseBytes = 8192
+
+// MaxToolInputBytes caps the tool input stored in a tool_result event; the
+// input of a Write or Edit holds whole files.
+const MaxToolInputBytes = 8192
+
+type AgentStoppedData struct {
+	AgentSessionID string `json:"agent_session_id,omitempty"`
+	TranscriptPath string `json:"transcript_path,omitempty"`
+}
+
+// ScheduledRunData records that a cron job launched the session. Missed is
+// set when the run catches up on a schedule time the node was down for.
+type ScheduledRunData struct {
+	Job         string    `json:"job"`
+	Schedule    string    `json:"schedule"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	Missed      bool      `json:"missed,omitempty"`
+}
+
+// GitDirtyData records that a session exited leaving uncommitted changes
+// in its working directory's git repository.
+type GitDirtyData struct {
+	WorkingDir string `json:"working_dir"`
+	Branch     string `json:"branch,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+	Changed    int    `json:"changed"`
+	Ahead      int    `json:"ahead,omitempty"`
+	Behind     int    `json:"behind,omitempty"`
+}
+
+// AutoRespondedData records that a session's output matched one of its
+// auto-respond rules and the rule's response was typed into it.
+type AutoRespondedData struct {
+	Pattern  string `json:"pattern"`
+	Response string `json:"response"`
+	Match    string `json:"match"`
+}
+
+// AlertData records a line of a session's output that matched one of its
+// alert patterns.
+type AlertData struct {
+	Pattern    string `json:"pattern"`
+	Line       string `json:"line"`
+	Suppressed int    `json:"suppressed,omitempty"` // earlier matches of the pattern not alerted while it cooled down
+}
+
+// CostData records a change in what a session's agent reported using. When
+// Budget is set, it records instead that the session went over that
+// budget's Limit, with Spent, and what was done about it (Action).
+type CostData struct {
+	protocol.Usage
+	Budget string  `json:"budget,omitempty"` // "session", or "tag:" and the tag
+	Limit  float64 `json:"limit,omitempty"`
+	Spent  float64 `json:"spent,omitempty"`  // by the session, or all sessions with the tag
+	Action string  `json:"action,omitempty"` // CostKill or CostEscalate
+}
+
+// RateLimitedData records a message or request the node refused because
+// its sender went over the node's message limits.
+type RateLimitedData struct {
+	Kind       string `json:"kind"`   // "message" or "request"
+	Reason     string `json:"reason"` // "rate" or "size"
+	From       uint32 `json:"from"`
+	FromName   string `json:"from_name,omitempty"`
+	To         uint32 `json:"to"`
+	ToName     string `json:"to_name,omitempty"`
+	Limit      int    `json:"limit"`                // messages a minute, or body bytes
+	Size       int    `json:"size"`                 // body bytes
+	Suppressed int    `json:"suppressed,omitempty"` // earlier refusals not reported
+}
+
 // --- Event Constructors ---
 
 func NewSessionCreatedEvent(command []string, workingDir string, tags []string) Event {
@@ -103,8 +215,15 @@ func NewSessionStatusEvent(from, to string, exitCode *int, durationMs *int64) Ev
 	return Event{Timestamp: time.Now().UTC(), Type: EventSessionStatus, Data: data}
 }
 
-func NewOutputSummaryEvent(bytesDelta, linesDelta, totalBytes, totalLines uint64) Event {
-	data, _ := json.Marshal(OutputSummaryData{BytesDelta: bytesDelta, LinesDelta: linesDelta, TotalBytes: totalBytes, TotalLines: totalLines})
+// NewSessionExitEvent is the running to completed session.status event,
+// with the reason the session's backend gave for ending it, if any.
+func NewSessionExitEvent(exitCode *int, durationMs *int64, reason string) Event {
+	data, _ := json.Marshal(SessionStatusData{From: "running", To: "completed", ExitCode: exitCode, DurationMs: durationMs, Reason: reason})
+	return Event{Timestamp: time.Now().UTC(), Type: EventSessionStatus, Data: data}
+}
+
+func NewOutputSummaryEvent(d OutputSummaryData) Event {
+	data, _ := json.Marshal(d)
 	return Event{Timestamp: time.Now().UTC(), Type: EventOutputSummary, Data: data}
 }
 
@@ -138,6 +257,62 @@ func NewReplyEvent(reply ReplyData) Event {
 	return Event{Timestamp: time.Now().UTC(), Type: EventReply, Data: data}
 }
 
+func NewToolResultEvent(tool string, input, response json.RawMessage) Event {
+	d := ToolResultData{Tool: tool, InputBytes: len(input), ResponseBytes: len(response)}
+	if len(input) > MaxToolInputBytes {
+		d.InputTruncated = true
+	} else {
+		d.Input = input
+	}
+	if len(response) > MaxToolResponseBytes {
+		d.Truncated = true
+	} else {
+		d.Response = response
+	}
+	data, _ := json.Marshal(d)
+	return Event{Timestamp: time.Now().UTC(), Type: EventToolResult, Data: data}
+}
+
+func NewBudgetExceededEvent(d BudgetExceededData) Event {
+	data, _ := json.Marshal(d)
+	return Event{Timestamp: time.Now().UTC(), Type: EventBudgetExceeded, Data: data}
+}
+
+func NewAgentStoppedEvent(agentSessionID, transcriptPath string) Event {
+	data, _ := json.Marshal(AgentStoppedData{AgentSessionID: agentSessionID, TranscriptPath: transcriptPath})
+	return Event{Timestamp: time.Now().UTC(), Type: EventAgentStopped, Data: data}
+}
+
+func NewScheduledRunEvent(d ScheduledRunData) Event {
+	data, _ := json.Marshal(d)
+	return Event{Timestamp: time.Now().UTC(), Type: EventScheduledRun, Data: data}
+}
+
+func NewGitDirtyEvent(d GitDirtyData) Event {
+	data, _ := json.Marshal(d)
+	return Event{Timestamp: time.Now().UTC(), Type: EventGitDirty, Data: data}
+}
+
+func NewAutoRespondedEvent(d AutoRespondedData) Event {
+	data, _ := json.Marshal(d)
+	return Event{Timestamp: time.Now().UTC(), Type: EventAutoResponded, Data: data}
+}
+
+func NewAlertEvent(d AlertData) Event {
+	data, _ := json.Marshal(d)
+	return Event{Timestamp: time.Now().UTC(), Type: EventAlert, Data: data}
+}
+
+func NewCostEvent(d CostData) Event {
+	data, _ := json.Marshal(d)
+	return Event{Timestamp: time.Now().UTC(), Type: EventCost, Data: data}
+}
+
+func NewRateLimitedEvent(d RateLimitedData) Event {
+	data, _ := json.Marshal(d)
+	return Event{Timestamp: time.Now().UTC(), Type: EventRateLimited, Data: data}
+}
+
 // --- EventLog — append-only JSONL file ---
 
 // EventLog provides append-only writes and sequential reads for a JSONL event file.
@@ -223,14 +398,21 @@ type Subscription struct {
 	ID         uint64
 	SessionID  *uint32
 	Tags       []string
+	Selector   protocol.Selector
 	EventTypes []EventType
+	Filter     *protocol.Filter
 	Ch         chan SessionEvent
+
+	startSeq uint64 // journal sequence number when subscribed
 }
 
 // SessionEvent pairs an event with its session ID for subscription dispatch.
 type SessionEvent struct {
 	SessionID uint32 `json:"session_id"`
 	Event     Event  `json:"event"`
+	// Seq is the event's sequence number in the node's Journal, 0 without
+	// one.
+	Seq uint64 `json:"seq,omitempty"`
 }
 
 // SubscriptionManager tracks active subscriptions and dispatches events.
@@ -238,6 +420,8 @@ type SubscriptionManager struct {
 	mu     sync.RWMutex
 	subs   map[uint64]*Subscription
 	nextID uint64
+
+	journal *Journal // (guarded by mu)
 }
 
 // NewSubscriptionManager creates a ready-to-use manager.
@@ -248,7 +432,13 @@ func NewSubscriptionManager() *SubscriptionManager {
 }
 
 // Subscribe creates a new subscription with the given filters.
-func (m *SubscriptionManager) Subscribe(sessionID *uint32, tags []string, eventTypes []EventType) *Subscription {
+func (m *SubscriptionManager) Subscribe(sessionID *uint32, tags []string, selector protocol.Selector, eventTypes []EventType) *Subscription {
+	return m.SubscribeFiltered(sessionID, tags, selector, eventTypes, nil)
+}
+
+// SubscribeFiltered is Subscribe with a filter expression as well, which
+// events must also satisfy.
+func (m *SubscriptionManager) SubscribeFiltered(sessionID *uint32, tags []string, selector protocol.Selector, eventTypes []EventType, filter *protocol.Filter) *Subscription {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -259,13 +449,47 @@ func (m *SubscriptionManager) Subscribe(sessionID *uint32, tags []string, eventT
 		ID:         id,
 		SessionID:  sessionID,
 		Tags:       tags,
+		Selector:   selector,
 		EventTypes: eventTypes,
+		Filter:     filter,
 		Ch:         make(chan SessionEvent, 256),
 	}
+	// Publish journals and dispatches an event under the read lock, so
+	// every event up to this number was dispatched before sub existed, and
+	// every later one is dispatched to it.
+	if m.journal != nil {
+		sub.startSeq = m.journal.Seq()
+	}
 	m.subs[id] = sub
 	return sub
 }
 
+// SetJournal records every event published from now on in j, and lets
+// subscribers replay them.
+func (m *SubscriptionManager) SetJournal(j *Journal) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.journal = j
+}
+
+// Replay calls fn, oldest first, with the journaled events matching sub that
+// were published before sub was created: from sequence number fromSeq, at or
+// after since, until fn returns false. The live events follow on sub.Ch.
+func (m *SubscriptionManager) Replay(sub *Subscription, fromSeq uint64, since time.Time, fn func(SessionEvent) bool) error {
+	m.mu.RLock()
+	j := m.journal
+	m.mu.RUnlock()
+	if j == nil {
+		return fmt.Errorf("this node keeps no event journal")
+	}
+	return j.Replay(fromSeq, sub.startSeq, since, func(e JournalEntry) bool {
+		if !sub.matches(e.SessionID, e.Tags, e.Labels, e.Event) {
+			return true
+		}
+		return fn(SessionEvent{SessionID: e.SessionID, Event: e.Event, Seq: e.Seq})
+	})
+}
+
 // Unsubscribe removes and closes a subscription.
 func (m *SubscriptionManager) Unsubscribe(id uint64) {
 	m.mu.Lock()
@@ -277,14 +501,17 @@ func (m *SubscriptionManager) Unsubscribe(id uint64) {
 }
 
 // Publish dispatches an event to all matching subscriptions.
-func (m *SubscriptionManager) Publish(sessionID uint32, tags []string, event Event) {
+func (m *SubscriptionManager) Publish(sessionID uint32, tags []string, labels map[string]string, event Event) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	se := SessionEvent{SessionID: sessionID, Event: event}
+	if m.journal != nil {
+		se.Seq = m.journal.append(sessionID, tags, labels, event)
+	}
 
 	for _, sub := range m.subs {
-		if !sub.matches(sessionID, tags, event.Type) {
+		if !sub.matches(sessionID, tags, labels, event) {
 			continue
 		}
 		select {
@@ -295,7 +522,7 @@ func (m *SubscriptionManager) Publish(sessionID uint32, tags []string, event Eve
 }
 
 // matches checks if a subscription's filters match the given event.
-func (s *Subscription) matches(sessionID uint32, tags []string, eventType EventType) bool {
+func (s *Subscription) matches(sessionID uint32, tags []string, labels map[string]string, event Event) bool {
 	// Session ID filter.
 	if s.SessionID != nil && *s.SessionID != sessionID {
 		return false
@@ -320,11 +547,15 @@ func (s *Subscription) matches(sessionID uint32, tags []string, eventType EventT
 		}
 	}
 
+	if !s.Selector.Matches(labels) {
+		return false
+	}
+
 	// Event type filter.
 	if len(s.EventTypes) > 0 {
 		matched := false
 		for _, et := range s.EventTypes {
-			if et == eventType {
+			if et == event.Type {
 				matched = true
 				break
 			}
@@ -334,5 +565,12 @@ func (s *Subscription) matches(sessionID uint32, tags []string, eventType EventT
 		}
 	}
 
-	return true
+	// Filter expression, last as the costliest.
+	return s.Filter.Match(protocol.FilterEvent{
+		Type:    string(event.Type),
+		Session: sessionID,
+		Tags:    tags,
+		Labels:  labels,
+		Data:    event.Data,
+	})
 }
@@ -1,8 +1,12 @@
 package session
 
 import (
+	"encoding/json"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/codewiresh/codewire/internal/protocol"
 )
 
 func TestEventLogWriteRead(t *testing.T) {
@@ -58,14 +62,14 @@ func TestReadEventLog_NonExistent(t *testing.T) {
 func TestSubscriptionManager_BasicPubSub(t *testing.T) {
 	sm := NewSubscriptionManager()
 
-	sub := sm.Subscribe(nil, nil, nil)
+	sub := sm.Subscribe(nil, nil, nil, nil)
 	if sub.ID != 0 {
 		t.Fatalf("expected ID 0, got %d", sub.ID)
 	}
 
 	// Publish an event.
 	event := NewSessionCreatedEvent([]string{"test"}, "/tmp", []string{"worker"})
-	sm.Publish(1, []string{"worker"}, event)
+	sm.Publish(1, []string{"worker"}, nil, event)
 
 	// Should receive it.
 	se := <-sub.Ch
@@ -83,12 +87,12 @@ func TestSubscriptionManager_SessionFilter(t *testing.T) {
 	sm := NewSubscriptionManager()
 
 	sessionID := uint32(5)
-	sub := sm.Subscribe(&sessionID, nil, nil)
+	sub := sm.Subscribe(&sessionID, nil, nil, nil)
 
 	event := NewSessionCreatedEvent([]string{"test"}, "/tmp", nil)
 
 	// Wrong session — should not receive.
-	sm.Publish(3, nil, event)
+	sm.Publish(3, nil, nil, event)
 	select {
 	case <-sub.Ch:
 		t.Fatal("should not receive event for wrong session")
@@ -96,7 +100,7 @@ func TestSubscriptionManager_SessionFilter(t *testing.T) {
 	}
 
 	// Right session — should receive.
-	sm.Publish(5, nil, event)
+	sm.Publish(5, nil, nil, event)
 	se := <-sub.Ch
 	if se.SessionID != 5 {
 		t.Fatalf("expected session 5, got %d", se.SessionID)
@@ -108,12 +112,12 @@ func TestSubscriptionManager_SessionFilter(t *testing.T) {
 func TestSubscriptionManager_TagFilter(t *testing.T) {
 	sm := NewSubscriptionManager()
 
-	sub := sm.Subscribe(nil, []string{"worker"}, nil)
+	sub := sm.Subscribe(nil, []string{"worker"}, nil, nil)
 
 	event := NewSessionCreatedEvent([]string{"test"}, "/tmp", nil)
 
 	// No matching tags.
-	sm.Publish(1, []string{"build"}, event)
+	sm.Publish(1, []string{"build"}, nil, event)
 	select {
 	case <-sub.Ch:
 		t.Fatal("should not receive event for non-matching tags")
@@ -121,7 +125,7 @@ func TestSubscriptionManager_TagFilter(t *testing.T) {
 	}
 
 	// Matching tag.
-	sm.Publish(2, []string{"worker", "build"}, event)
+	sm.Publish(2, []string{"worker", "build"}, nil, event)
 	se := <-sub.Ch
 	if se.SessionID != 2 {
 		t.Fatalf("expected session 2, got %d", se.SessionID)
@@ -133,10 +137,10 @@ func TestSubscriptionManager_TagFilter(t *testing.T) {
 func TestSubscriptionManager_EventTypeFilter(t *testing.T) {
 	sm := NewSubscriptionManager()
 
-	sub := sm.Subscribe(nil, nil, []EventType{EventSessionStatus})
+	sub := sm.Subscribe(nil, nil, nil, []EventType{EventSessionStatus})
 
 	// Created event — should not match.
-	sm.Publish(1, nil, NewSessionCreatedEvent([]string{"test"}, "/tmp", nil))
+	sm.Publish(1, nil, nil, NewSessionCreatedEvent([]string{"test"}, "/tmp", nil))
 	select {
 	case <-sub.Ch:
 		t.Fatal("should not receive created event")
@@ -145,7 +149,7 @@ func TestSubscriptionManager_EventTypeFilter(t *testing.T) {
 
 	// Status event — should match.
 	exitCode := 0
-	sm.Publish(1, nil, NewSessionStatusEvent("running", "completed", &exitCode, nil))
+	sm.Publish(1, nil, nil, NewSessionStatusEvent("running", "completed", &exitCode, nil))
 	se := <-sub.Ch
 	if se.Event.Type != EventSessionStatus {
 		t.Fatalf("expected session.status, got %s", se.Event.Type)
@@ -153,3 +157,69 @@ func TestSubscriptionManager_EventTypeFilter(t *testing.T) {
 
 	sm.Unsubscribe(sub.ID)
 }
+
+func TestSubscriptionManager_FilterExpression(t *testing.T) {
+	sm := NewSubscriptionManager()
+
+	filter, err := protocol.ParseFilter(`data.exit_code != 0 && labels.repo == "webapp"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := sm.SubscribeFiltered(nil, nil, nil, nil, filter)
+
+	ok, failed := 0, 1
+	labels := map[string]string{"repo": "webapp"}
+	sm.Publish(1, nil, labels, NewSessionStatusEvent("running", "completed", &ok, nil))
+	sm.Publish(2, nil, nil, NewSessionStatusEvent("running", "completed", &failed, nil))
+	sm.Publish(3, nil, labels, NewSessionStatusEvent("running", "completed", &failed, nil))
+
+	se := <-sub.Ch
+	if se.SessionID != 3 {
+		t.Fatalf("received session %d's event, want only session 3's", se.SessionID)
+	}
+	select {
+	case se := <-sub.Ch:
+		t.Fatalf("unexpected event from session %d", se.SessionID)
+	default:
+	}
+
+	sm.Unsubscribe(sub.ID)
+}
+
+func TestRecordEventToolResult(t *testing.T) {
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	id := launchSleep(t, sm)
+	sub := sm.Subscriptions.Subscribe(nil, []string{"agent"}, nil, []EventType{EventToolResult})
+	defer sm.Subscriptions.Unsubscribe(sub.ID)
+
+	// Retagging while hook events arrive must not race.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 50 {
+			sm.SetTags(id, []string{"agent"})
+		}
+	}()
+	input := json.RawMessage(`{"file_path":"big.txt","content":"` + strings.Repeat("x", MaxToolInputBytes) + `"}`)
+	for range 50 {
+		if err := sm.RecordEvent(id, NewToolResultEvent("Write", input, json.RawMessage(`"ok"`))); err != nil {
+			t.Fatalf("RecordEvent: %v", err)
+		}
+	}
+	<-done
+	if err := sm.RecordEvent(id, NewToolResultEvent("Write", input, json.RawMessage(`"ok"`))); err != nil {
+		t.Fatalf("RecordEvent: %v", err)
+	}
+
+	se := <-sub.Ch
+	var d ToolResultData
+	if err := json.Unmarshal(se.Event.Data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Input != nil || !d.InputTruncated || d.InputBytes != len(input) || string(d.Response) != `"ok"` {
+		t.Errorf("tool result = %+v, want the input dropped and the response kept", d)
+	}
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"fmt"
+	"sync"
+)
+
+// inputHistoryBytes caps the input a session keeps for Fork to replay.
+const inputHistoryBytes = 64 << 10
+
+// inputHistory is the input written to a session's PTY, from stdin data,
+// attached clients, cw send, auto-responses and pipes alike. Like Env, it
+// is held only in memory.
+type inputHistory struct {
+	mu        sync.Mutex
+	data      []byte
+	truncated bool // input past inputHistoryBytes was not kept
+}
+
+func (h *inputHistory) record(data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if room := inputHistoryBytes - len(h.data); len(data) > room {
+		data, h.truncated = data[:room], true
+	}
+	h.data = append(h.data, data...)
+}
+
+func (h *inputHistory) get() ([]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]byte(nil), h.data...), h.truncated
+}
+
+// Fork launches a new session, named name (or a generated name if name is
+// empty), with the options session id was launched with: its command,
+// working directory (and worktree), env, secrets, tags, labels, pool,
+// backend, rules and budget. With replayInput, the new session is sent the
+// input id has received so far instead of the stdin data id was launched
+// with.
+//
+// Sessions carried over from a previous node cannot be forked: their env
+// and secrets were never saved.
+func (m *SessionManager) Fork(id uint32, name string, replayInput bool) (uint32, error) {
+	m.mu.RLock()
+	sess, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("session %d not found", id)
+	}
+	opts := sess.launchOpts
+	if len(opts.Command) == 0 {
+		return 0, fmt.Errorf("session %d was launched by a previous node; its launch options are gone", id)
+	}
+	opts.Name, opts.GenerateName = name, true
+	if replayInput {
+		input, truncated := sess.input.get()
+		if truncated {
+			return 0, fmt.Errorf("session %d has received more than %d KiB of input, too much to replay", id, inputHistoryBytes>>10)
+		}
+		opts.StdinData = input
+	}
+
+	newID, err := m.LaunchWith(opts)
+	if err != nil {
+		return 0, err
+	}
+	sess.mu.Lock()
+	budget := sess.Meta.Budget
+	sess.mu.Unlock()
+	if budget != nil {
+		_ = m.SetBudget(newID, *budget)
+	}
+	return newID, nil
+}
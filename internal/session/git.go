@@ -0,0 +1,137 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// gitCacheTTL is how long a working directory's git state is reused, so
+// that cw list and cw top do not run git for every session on each refresh.
+const gitCacheTTL = 5 * time.Second
+
+// gitTimeout bounds one git status run, for very large repositories.
+const gitTimeout = 2 * time.Second
+
+// gitCache holds the git state of working directories, keyed by path.
+// Directories outside a repository are cached too, as nil.
+type gitCache struct {
+	mu      sync.Mutex
+	entries map[string]gitCacheEntry
+}
+
+type gitCacheEntry struct {
+	info *protocol.GitInfo
+	at   time.Time
+}
+
+// get returns dir's git state, from the cache when fresh enough.
+func (c *gitCache) get(dir string) *protocol.GitInfo {
+	c.mu.Lock()
+	e, ok := c.entries[dir]
+	c.mu.Unlock()
+	if ok && time.Since(e.at) < gitCacheTTL {
+		return e.info
+	}
+	return c.refresh(dir)
+}
+
+// refresh reads dir's git state now and caches it.
+func (c *gitCache) refresh(dir string) *protocol.GitInfo {
+	info := gitStatus(dir)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]gitCacheEntry)
+	}
+	c.entries[dir] = gitCacheEntry{info: info, at: time.Now()}
+	return info
+}
+
+// gitStatus reads the git state of dir, or returns nil when dir is not in a
+// git repository or git is not installed.
+func gitStatus(dir string) *protocol.GitInfo {
+	if dir == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "status", "--porcelain=v2", "--branch")
+	// Status refreshes the index when it can; without optional locks it
+	// never takes index.lock, which would fail an agent's own git commands.
+	cmd.Env = append(os.Environ(), "GIT_OPTIONAL_LOCKS=0")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	return parseGitStatus(string(out))
+}
+
+// parseGitStatus parses the output of git status --porcelain=v2 --branch.
+func parseGitStatus(out string) *protocol.GitInfo {
+	info := &protocol.GitInfo{}
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		if header, ok := strings.CutPrefix(line, "# "); ok {
+			key, value, _ := strings.Cut(header, " ")
+			switch key {
+			case "branch.oid":
+				if value != "(initial)" && len(value) >= 7 {
+					info.Commit = value[:7]
+				}
+			case "branch.head":
+				if value != "(detached)" {
+					info.Branch = value
+				}
+			case "branch.upstream":
+				info.Upstream = value
+			case "branch.ab":
+				ahead, behind, _ := strings.Cut(value, " ")
+				info.Ahead, _ = strconv.Atoi(strings.TrimPrefix(ahead, "+"))
+				info.Behind, _ = strconv.Atoi(strings.TrimPrefix(behind, "-"))
+			}
+			continue
+		}
+		// Changed (1, 2), unmerged (u) and untracked (?) entries.
+		switch line[:1] {
+		case "1", "2", "u", "?":
+			info.Changed++
+		}
+	}
+	info.Dirty = info.Changed > 0
+	return info
+}
+
+// checkGitDirty records a session.git_dirty event when a session that just
+// exited left uncommitted changes in its working directory. It runs before
+// the session is marked completed, so clients waiting for completion
+// already see the event.
+func (m *SessionManager) checkGitDirty(sess *Session) {
+	info := m.git.refresh(sess.Meta.WorkingDir)
+	if info == nil || !info.Dirty {
+		return
+	}
+	event := NewGitDirtyEvent(GitDirtyData{
+		WorkingDir: sess.Meta.WorkingDir,
+		Branch:     info.Branch,
+		Commit:     info.Commit,
+		Changed:    info.Changed,
+		Ahead:      info.Ahead,
+		Behind:     info.Behind,
+	})
+	if sess.eventLog != nil {
+		sess.eventLog.Append(event)
+	}
+	m.Subscriptions.Publish(sess.Meta.ID, sess.Meta.Tags, sess.Meta.Labels, event)
+}
@@ -0,0 +1,127 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestParseGitStatus(t *testing.T) {
+	out := `# branch.oid 4f2a9c1e0b7d3a5f6e8c9d0a1b2c3d4e5f6a7b8c
+# branch.head feature/login
+# branch.upstream origin/feature/login
+# branch.ab +2 -1
+1 .M N... 100644 100644 100644 abc abc internal/auth.go
+2 R. N... 100644 100644 100644 abc abc R100 new.go	old.go
+u UU N... 100644 100644 100644 100644 abc abc abc conflict.go
+? scratch.txt
+`
+	got := parseGitStatus(out)
+	want := protocol.GitInfo{
+		Branch:   "feature/login",
+		Commit:   "4f2a9c1",
+		Dirty:    true,
+		Changed:  4,
+		Upstream: "origin/feature/login",
+		Ahead:    2,
+		Behind:   1,
+	}
+	if *got != want {
+		t.Errorf("parseGitStatus = %+v, want %+v", *got, want)
+	}
+
+	got = parseGitStatus("# branch.oid (initial)\n# branch.head (detached)\n")
+	if *got != (protocol.GitInfo{}) {
+		t.Errorf("parseGitStatus(clean, detached) = %+v, want zero", *got)
+	}
+}
+
+// TestGitDirtyEvent launches a session that leaves an untracked file in a
+// repository, and checks the git state in its SessionInfo and the
+// session.git_dirty event on exit.
+func TestGitDirtyEvent(t *testing.T) {
+	repo := initRepo(t)
+
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	if info := sm.git.get(repo); info == nil || info.Branch != "main" || info.Dirty {
+		t.Fatalf("clean repo git state = %+v", info)
+	}
+	if info := sm.git.get(t.TempDir()); info != nil {
+		t.Fatalf("non-repo git state = %+v, want nil", info)
+	}
+
+	sub := sm.Subscriptions.Subscribe(nil, nil, nil, []EventType{EventGitDirty})
+	defer sm.Subscriptions.Unsubscribe(sub.ID)
+
+	id, err := sm.Launch([]string{"sh", "-c", "echo draft > notes.txt"}, repo, nil, nil, "")
+	if err != nil {
+		t.Fatalf("Launch: %v", err)
+	}
+	select {
+	case se := <-sub.Ch:
+		var d GitDirtyData
+		if err := json.Unmarshal(se.Event.Data, &d); err != nil {
+			t.Fatal(err)
+		}
+		if se.SessionID != id || d.Branch != "main" || d.Changed != 1 || d.WorkingDir != repo {
+			t.Fatalf("git_dirty event = %d %+v", se.SessionID, d)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no session.git_dirty event")
+	}
+
+	info, _, err := sm.GetStatus(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Git == nil || !info.Git.Dirty || info.Git.Changed != 1 {
+		t.Fatalf("SessionInfo.Git = %+v, want dirty with 1 change", info.Git)
+	}
+
+	// A session leaving the tree clean records no event.
+	if err := os.Remove(filepath.Join(repo, "notes.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.Launch([]string{"true"}, repo, nil, nil, ""); err != nil {
+		t.Fatalf("Launch: %v", err)
+	}
+	select {
+	case se := <-sub.Ch:
+		t.Fatalf("unexpected event for clean exit: %+v", se)
+	case <-time.After(time.Second):
+	}
+}
+
+// initRepo creates a git repository with an identity configured and one
+// commit on main, skipping the test when git is not installed.
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	git(t, repo, "init", "-q", "-b", "main")
+	git(t, repo, "config", "user.name", "t")
+	git(t, repo, "config", "user.email", "t@example.com")
+	git(t, repo, "commit", "-q", "--allow-empty", "-m", "init")
+	return repo
+}
+
+// git runs git in dir, failing the test on error.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,234 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// historyFile is the launch history in the data directory. Unlike
+// sessions.json it is only ever appended to: a record when a session is
+// launched and another, with the same entry number, when it ends.
+const historyFile = "history.jsonl"
+
+// historyRecord is a line of historyFile. Launch records have a Command;
+// outcome records have a Status.
+type historyRecord struct {
+	Entry       int               `json:"entry"`
+	SessionID   uint32            `json:"session_id,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Command     []string          `json:"command,omitempty"`
+	WorkingDir  string            `json:"working_dir,omitempty"`
+	Worktree    string            `json:"worktree,omitempty"`
+	Env         []string          `json:"env,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	StartedAt   string            `json:"started_at,omitempty"`
+	Status      string            `json:"status,omitempty"`
+	ExitCode    *int              `json:"exit_code,omitempty"`
+	CompletedAt string            `json:"completed_at,omitempty"`
+}
+
+// historyLog appends to historyFile.
+type historyLog struct {
+	mu     sync.Mutex
+	loaded bool // whether last has been read from historyFile
+	last   int  // latest entry number
+}
+
+// recordLaunch adds sess, launched with opts, to the history. Secrets are
+// never recorded, nor are the RedactEnv variables in opts.Env.
+func (m *SessionManager) recordLaunch(sess *Session, opts LaunchOptions) {
+	var env []string
+	for _, kv := range opts.Env {
+		if k, _, _ := strings.Cut(kv, "="); !slices.Contains(m.RedactEnv, k) {
+			env = append(env, kv)
+		}
+	}
+	m.history.mu.Lock()
+	defer m.history.mu.Unlock()
+	if !m.history.loaded {
+		entries, err := m.readHistory()
+		if err != nil {
+			slog.Error("failed to read launch history", "err", err)
+			return
+		}
+		if len(entries) > 0 {
+			m.history.last = entries[len(entries)-1].Entry
+		}
+		m.history.loaded = true
+	}
+	m.history.last++
+	sess.Meta.History = m.history.last
+	m.appendHistory(historyRecord{
+		Entry:      m.history.last,
+		SessionID:  sess.Meta.ID,
+		Name:       opts.Name,
+		Command:    opts.Command,
+		WorkingDir: opts.WorkingDir,
+		Worktree:   opts.Worktree,
+		Env:        env,
+		Tags:       opts.Tags,
+		Labels:     opts.Labels,
+		StartedAt:  sess.Meta.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+// recordOutcome adds how sess ended to its history entry.
+func (m *SessionManager) recordOutcome(sess *Session) {
+	sess.mu.Lock()
+	rec := historyRecord{
+		Entry:    sess.Meta.History,
+		Status:   sess.statusWatcher.Get().String(),
+		ExitCode: sess.Meta.ExitCode,
+	}
+	if sess.Meta.CompletedAt != nil {
+		rec.CompletedAt = sess.Meta.CompletedAt.Format(time.RFC3339)
+	}
+	sess.mu.Unlock()
+	if rec.Entry == 0 {
+		return
+	}
+	m.history.mu.Lock()
+	defer m.history.mu.Unlock()
+	m.appendHistory(rec)
+}
+
+// appendHistory writes rec to historyFile. Caller holds history.mu. Only
+// launch records create the file: if it was deleted since, an outcome has
+// no entry to go with.
+func (m *SessionManager) appendHistory(rec historyRecord) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	flags := os.O_APPEND | os.O_WRONLY
+	if rec.Command != nil {
+		flags |= os.O_CREATE
+	}
+	// The history holds launch env, so only the node's user may read it.
+	f, err := os.OpenFile(filepath.Join(m.dataDir, historyFile), flags, 0o600)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to open launch history", "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		slog.Error("failed to write launch history", "err", err)
+	}
+}
+
+// readHistory returns the history's entries, oldest first, each with its
+// outcome if recorded. Corrupt lines are skipped.
+func (m *SessionManager) readHistory() ([]protocol.HistoryEntry, error) {
+	f, err := os.Open(filepath.Join(m.dataDir, historyFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []protocol.HistoryEntry
+	index := make(map[int]int) // entry number → index in entries
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var rec historyRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil || rec.Entry <= 0 {
+			continue
+		}
+		if rec.Command != nil {
+			index[rec.Entry] = len(entries)
+			entries = append(entries, protocol.HistoryEntry{
+				Entry:      rec.Entry,
+				SessionID:  rec.SessionID,
+				Name:       rec.Name,
+				Command:    rec.Command,
+				WorkingDir: rec.WorkingDir,
+				Worktree:   rec.Worktree,
+				Env:        rec.Env,
+				Tags:       rec.Tags,
+				Labels:     rec.Labels,
+				StartedAt:  rec.StartedAt,
+				Status:     "unknown",
+			})
+		} else if i, ok := index[rec.Entry]; ok {
+			entries[i].Status = rec.Status
+			entries[i].ExitCode = rec.ExitCode
+			entries[i].CompletedAt = rec.CompletedAt
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// History returns the last limit entries of the launch history (all when
+// limit is zero), oldest first, whose command, working directory, name,
+// tags or labels contain query, ignoring case. Sessions still known to the
+// node have their current status.
+func (m *SessionManager) History(query string, limit int) ([]protocol.HistoryEntry, error) {
+	m.history.mu.Lock()
+	entries, err := m.readHistory()
+	m.history.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("reading launch history: %w", err)
+	}
+
+	query = strings.ToLower(query)
+	matched := entries[:0]
+	for _, e := range entries {
+		if query == "" || strings.Contains(historyText(e), query) {
+			matched = append(matched, e)
+		}
+	}
+	if limit > 0 && len(matched) > limit {
+		matched = matched[len(matched)-limit:]
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for i, e := range matched {
+		if sess, ok := m.sessions[e.SessionID]; ok && sess.Meta.History == e.Entry && e.CompletedAt == "" {
+			matched[i].Status = sess.statusWatcher.Get().String()
+		}
+	}
+	return matched, nil
+}
+
+// HistoryEntry returns entry n of the launch history.
+func (m *SessionManager) HistoryEntry(n int) (protocol.HistoryEntry, error) {
+	m.history.mu.Lock()
+	entries, err := m.readHistory()
+	m.history.mu.Unlock()
+	if err != nil {
+		return protocol.HistoryEntry{}, fmt.Errorf("reading launch history: %w", err)
+	}
+	for _, e := range entries {
+		if e.Entry == n {
+			return e, nil
+		}
+	}
+	return protocol.HistoryEntry{}, fmt.Errorf("history entry %d not found", n)
+}
+
+// historyText is what History searches in e, lower case.
+func historyText(e protocol.HistoryEntry) string {
+	parts := append([]string{strings.Join(e.Command, " "), e.WorkingDir, e.Worktree, e.Name}, e.Tags...)
+	for k, v := range e.Labels {
+		parts = append(parts, k+"="+v)
+	}
+	return strings.ToLower(strings.Join(parts, "\n"))
+}
@@ -0,0 +1,86 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	sm.RedactEnv = []string{"API_TOKEN"}
+
+	first, err := sm.LaunchWith(LaunchOptions{
+		Command:    []string{"sh", "-c", "exit 3"},
+		WorkingDir: dir,
+		Env:        []string{"FOO=bar", "API_TOKEN=hunter22"},
+		Secrets:    []string{"PASSWORD=swordfish"},
+		Name:       "failing",
+		Tags:       []string{"ci"},
+	})
+	if err != nil {
+		t.Fatalf("LaunchWith: %v", err)
+	}
+	waitExited(t, sm, first)
+	second, err := sm.LaunchWith(LaunchOptions{Command: []string{"sleep", "5"}, WorkingDir: dir})
+	if err != nil {
+		t.Fatalf("LaunchWith: %v", err)
+	}
+	defer sm.Kill(second)
+
+	entries, err := sm.History("", 0)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("History = %+v, %v", entries, err)
+	}
+	e := entries[0]
+	if e.Entry != 1 || e.SessionID != first || e.Name != "failing" || !slices.Equal(e.Env, []string{"FOO=bar"}) || !slices.Equal(e.Tags, []string{"ci"}) {
+		t.Errorf("entry 1 = %+v", e)
+	}
+	if e.Status != "completed (3)" || e.ExitCode == nil || *e.ExitCode != 3 || e.CompletedAt == "" {
+		t.Errorf("entry 1 outcome = %s %v %q", e.Status, e.ExitCode, e.CompletedAt)
+	}
+	if entries[1].Entry != 2 || entries[1].Status != "running" {
+		t.Errorf("entry 2 = %+v", entries[1])
+	}
+
+	if entries, _ := sm.History("SLEEP", 0); len(entries) != 1 || entries[0].Entry != 2 {
+		t.Errorf("History(SLEEP) = %+v", entries)
+	}
+	if entries, _ := sm.History("", 1); len(entries) != 1 || entries[0].Entry != 2 {
+		t.Errorf("History limited to 1 = %+v", entries)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, historyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter22", "swordfish"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("%s recorded in the history", secret)
+		}
+	}
+
+	// A new node continues the numbering, and reports sessions it never
+	// saw end as unknown.
+	sm2, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	third, err := sm2.LaunchWith(LaunchOptions{Command: []string{"true"}, WorkingDir: dir})
+	if err != nil {
+		t.Fatalf("LaunchWith: %v", err)
+	}
+	waitExited(t, sm2, third)
+	entries, _ = sm2.History("", 0)
+	if len(entries) != 3 || entries[1].Status != "unknown" || entries[2].Entry != 3 || entries[2].Status != "completed (0)" {
+		t.Errorf("History after restart = %+v", entries)
+	}
+	if _, err := sm2.HistoryEntry(4); err == nil {
+		t.Error("HistoryEntry(4) succeeded")
+	}
+}
@@ -0,0 +1,229 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Journal rotation defaults: events.jsonl is renamed to events.jsonl.1 (and
+// older files shifted up to events.jsonl.<JournalBackups>) once it exceeds
+// JournalMaxSize. config.toml's node.event_log_max_size and
+// node.event_log_files override them.
+const (
+	JournalMaxSize = 16 << 20
+	JournalBackups = 3
+)
+
+// JournalEntry is a line of the node's event journal: a published event with
+// its sequence number, and the session's tags and labels when it fired, so
+// replays filter it as a live subscription would have.
+type JournalEntry struct {
+	Seq       uint64            `json:"seq"`
+	SessionID uint32            `json:"session_id"`
+	Tags      []string          `json:"tags,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Event     Event             `json:"event"`
+}
+
+// Journal is the node's durable, append-only record of every event it
+// publishes, numbered in publish order across node restarts. It rotates
+// itself by size. It is safe for concurrent use.
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	size    int64
+	maxSize int64
+	backups int
+	seq     uint64 // of the last entry
+}
+
+// JournalPath is the node's event journal in dataDir.
+func JournalPath(dataDir string) string {
+	return filepath.Join(dataDir, "events.jsonl")
+}
+
+// OpenJournal opens (or creates) the event journal in dataDir for
+// appending, continuing its sequence numbers. It is rotated at maxSize bytes
+// keeping backups old files; zero means JournalMaxSize and JournalBackups.
+func OpenJournal(dataDir string, maxSize int64, backups int) (*Journal, error) {
+	if maxSize <= 0 {
+		maxSize = JournalMaxSize
+	}
+	if backups <= 0 {
+		backups = JournalBackups
+	}
+	j := &Journal{path: JournalPath(dataDir), maxSize: maxSize, backups: backups}
+	// The newest file with entries ends with the latest.
+	files := j.files()
+	for i := len(files) - 1; i >= 0 && j.seq == 0; i-- {
+		if err := readJournal(files[i], func(e JournalEntry) bool {
+			j.seq = max(j.seq, e.Seq)
+			return true
+		}); err != nil {
+			return nil, fmt.Errorf("reading event journal: %w", err)
+		}
+	}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) open() error {
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening event journal: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("opening event journal: %w", err)
+	}
+	j.f, j.size = f, info.Size()
+	return nil
+}
+
+// files returns the journal's files, oldest first.
+func (j *Journal) files() []string {
+	var files []string
+	for i := j.backups; i >= 1; i-- {
+		files = append(files, fmt.Sprintf("%s.%d", j.path, i))
+	}
+	return append(files, j.path)
+}
+
+// Seq returns the sequence number of the latest entry, 0 if there is none.
+func (j *Journal) Seq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// append records an event and returns its sequence number. Failing to write
+// it is logged, not returned: the event still reaches live subscribers.
+func (j *Journal) append(sessionID uint32, tags []string, labels map[string]string, event Event) uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.seq++
+	if j.f == nil {
+		return j.seq
+	}
+	data, err := json.Marshal(JournalEntry{Seq: j.seq, SessionID: sessionID, Tags: tags, Labels: labels, Event: event})
+	if err != nil {
+		return j.seq
+	}
+	data = append(data, '\n')
+	if j.size > 0 && j.size+int64(len(data)) > j.maxSize {
+		if err := j.rotate(); err != nil {
+			slog.Warn("rotating event journal failed", "err", err)
+			return j.seq
+		}
+	}
+	n, err := j.f.Write(data)
+	j.size += int64(n)
+	if err != nil {
+		slog.Warn("writing event journal failed", "seq", j.seq, "err", err)
+	}
+	return j.seq
+}
+
+func (j *Journal) rotate() error {
+	j.f.Close()
+	j.f = nil
+	for i := j.backups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", j.path, i), fmt.Sprintf("%s.%d", j.path, i+1))
+	}
+	if err := os.Rename(j.path, j.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return j.open()
+}
+
+// Replay calls fn, oldest first, with the entries numbered fromSeq through
+// toSeq that were published at or after since, until fn returns false.
+// Entries rotated out of the journal are gone.
+func (j *Journal) Replay(fromSeq, toSeq uint64, since time.Time, fn func(JournalEntry) bool) error {
+	// Hold the lock only to list the files: a rotation while reading them
+	// can at worst skip or repeat entries, which the sequence numbers catch.
+	j.mu.Lock()
+	files := j.files()
+	j.mu.Unlock()
+
+	last := fromSeq
+	if last > 0 {
+		last--
+	}
+	for _, path := range files {
+		stop := false
+		err := readJournal(path, func(e JournalEntry) bool {
+			if e.Seq <= last {
+				return true
+			}
+			if e.Seq > toSeq {
+				stop = true
+				return false
+			}
+			last = e.Seq
+			if !since.IsZero() && e.Event.Timestamp.Before(since) {
+				return true
+			}
+			if !fn(e) {
+				stop = true
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Close closes the journal; events published later are no longer recorded.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// readJournal calls fn with each entry of the journal file at path, until fn
+// returns false. A missing file has no entries; corrupt lines are skipped.
+func readJournal(path string, fn func(JournalEntry) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // 1MB max line
+	for scanner.Scan() {
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if !fn(e) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
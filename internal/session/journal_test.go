@@ -0,0 +1,101 @@
+package session
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJournalReplay(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := NewSubscriptionManager()
+	sm.SetJournal(j)
+
+	old := NewAutoRespondedEvent(AutoRespondedData{Pattern: "old"})
+	old.Timestamp = time.Now().Add(-3 * time.Hour)
+	sm.Publish(1, []string{"build"}, nil, old)
+	sm.Publish(2, []string{"docs"}, nil, NewAutoRespondedEvent(AutoRespondedData{Pattern: "docs"}))
+	sm.Publish(1, []string{"build"}, nil, NewAutoRespondedEvent(AutoRespondedData{Pattern: "new"}))
+
+	// A restarted node continues the numbering.
+	j.Close()
+	if j, err = OpenJournal(dir, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if j.Seq() != 3 {
+		t.Fatalf("reopened journal at seq %d, want 3", j.Seq())
+	}
+	sm = NewSubscriptionManager()
+	sm.SetJournal(j)
+
+	sub := sm.Subscribe(nil, []string{"build"}, nil, nil)
+	defer sm.Unsubscribe(sub.ID)
+	sm.Publish(1, []string{"build"}, nil, NewAutoRespondedEvent(AutoRespondedData{Pattern: "live"}))
+
+	replay := func(fromSeq uint64, since time.Time) []uint64 {
+		t.Helper()
+		var seqs []uint64
+		if err := sm.Replay(sub, fromSeq, since, func(se SessionEvent) bool {
+			seqs = append(seqs, se.Seq)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return seqs
+	}
+	// Only the build session's events, and only those from before the
+	// subscription: the live one arrives on sub.Ch.
+	if got := replay(0, time.Now().Add(-24*time.Hour)); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("replay since a day ago = %v, want [1 3]", got)
+	}
+	if got := replay(0, time.Now().Add(-2*time.Hour)); len(got) != 1 || got[0] != 3 {
+		t.Errorf("replay since 2h ago = %v, want [3]", got)
+	}
+	if got := replay(2, time.Time{}); len(got) != 1 || got[0] != 3 {
+		t.Errorf("replay from seq 2 = %v, want [3]", got)
+	}
+	select {
+	case se := <-sub.Ch:
+		if se.Seq != 4 {
+			t.Errorf("live event seq = %d, want 4", se.Seq)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no live event")
+	}
+}
+
+func TestJournalRotation(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir, 512, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	for range 40 {
+		j.append(1, nil, nil, NewAutoRespondedEvent(AutoRespondedData{Pattern: "x"}))
+	}
+	if _, err := os.Stat(JournalPath(dir) + ".3"); !os.IsNotExist(err) {
+		t.Errorf("journal kept more than 2 rotated files")
+	}
+
+	// Replay starts at the oldest entry kept, in order.
+	var seqs []uint64
+	if err := j.Replay(1, j.Seq(), time.Time{}, func(e JournalEntry) bool {
+		seqs = append(seqs, e.Seq)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(seqs) == 0 || len(seqs) == 40 || seqs[len(seqs)-1] != 40 {
+		t.Fatalf("replayed %v, want the latest entries up to 40", seqs)
+	}
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] != seqs[i-1]+1 {
+			t.Fatalf("replayed %v, want consecutive entries", seqs)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 )
 
 // KVStore is an in-memory key-value store with namespace support and TTL.
+// Expired entries are hidden from reads as soon as they expire and removed
+// by Sweep.
 type KVStore struct {
 	mu   sync.RWMutex
 	data map[string]map[string]kvEntry // namespace -> key -> entry
@@ -15,7 +17,10 @@ type KVStore struct {
 type kvEntry struct {
 	value     []byte
 	expiresAt *time.Time
-	timer     *time.Timer
+}
+
+func (e kvEntry) expired(now time.Time) bool {
+	return e.expiresAt != nil && !now.Before(*e.expiresAt)
 }
 
 // NewKVStore creates a ready-to-use KV store.
@@ -36,19 +41,10 @@ func (kv *KVStore) Set(namespace, key string, value []byte, ttl time.Duration) {
 		kv.data[namespace] = ns
 	}
 
-	// Cancel existing timer if any.
-	if existing, exists := ns[key]; exists && existing.timer != nil {
-		existing.timer.Stop()
-	}
-
 	entry := kvEntry{value: value}
-
 	if ttl > 0 {
 		expiresAt := time.Now().Add(ttl)
 		entry.expiresAt = &expiresAt
-		entry.timer = time.AfterFunc(ttl, func() {
-			kv.Delete(namespace, key)
-		})
 	}
 
 	ns[key] = entry
@@ -59,13 +55,8 @@ func (kv *KVStore) Get(namespace, key string) []byte {
 	kv.mu.RLock()
 	defer kv.mu.RUnlock()
 
-	ns, ok := kv.data[namespace]
-	if !ok {
-		return nil
-	}
-
-	entry, ok := ns[key]
-	if !ok {
+	entry, ok := kv.data[namespace][key]
+	if !ok || entry.expired(time.Now()) {
 		return nil
 	}
 
@@ -82,10 +73,6 @@ func (kv *KVStore) Delete(namespace, key string) {
 		return
 	}
 
-	if existing, exists := ns[key]; exists && existing.timer != nil {
-		existing.timer.Stop()
-	}
-
 	delete(ns, key)
 
 	if len(ns) == 0 {
@@ -93,6 +80,24 @@ func (kv *KVStore) Delete(namespace, key string) {
 	}
 }
 
+// Sweep removes expired entries. The node calls it periodically.
+func (kv *KVStore) Sweep() {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	now := time.Now()
+	for name, ns := range kv.data {
+		for key, entry := range ns {
+			if entry.expired(now) {
+				delete(ns, key)
+			}
+		}
+		if len(ns) == 0 {
+			delete(kv.data, name)
+		}
+	}
+}
+
 // KVEntry is the public type returned by List.
 type KVEntry struct {
 	Key       string
@@ -110,8 +115,12 @@ func (kv *KVStore) List(namespace, prefix string) []KVEntry {
 		return nil
 	}
 
+	now := time.Now()
 	var entries []KVEntry
 	for key, entry := range ns {
+		if entry.expired(now) {
+			continue
+		}
 		if prefix == "" || strings.HasPrefix(key, prefix) {
 			entries = append(entries, KVEntry{
 				Key:       key,
@@ -123,3 +132,16 @@ func (kv *KVStore) List(namespace, prefix string) []KVEntry {
 
 	return entries
 }
+
+// Namespaces returns the namespaces holding entries, in no particular
+// order.
+func (kv *KVStore) Namespaces() []string {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
+
+	names := make([]string, 0, len(kv.data))
+	for name := range kv.data {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,30 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKVStoreExpiry(t *testing.T) {
+	kv := NewKVStore()
+	kv.Set("ns", "lock", []byte("a"), time.Millisecond)
+	kv.Set("ns", "keep", []byte("b"), 0)
+
+	time.Sleep(5 * time.Millisecond)
+
+	// Expired keys are hidden before the sweep runs.
+	if v := kv.Get("ns", "lock"); v != nil {
+		t.Fatalf("Get expired = %q, want nil", v)
+	}
+	if entries := kv.List("ns", ""); len(entries) != 1 || entries[0].Key != "keep" {
+		t.Fatalf("List = %+v, want only keep", entries)
+	}
+
+	kv.Sweep()
+	kv.mu.RLock()
+	n := len(kv.data["ns"])
+	kv.mu.RUnlock()
+	if n != 1 {
+		t.Fatalf("expected 1 key after sweep, got %d", n)
+	}
+}
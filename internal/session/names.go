@@ -0,0 +1,105 @@
+package session
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+// Word lists for generated session names. Both lists are short, lowercase, and
+// easy to type so that generated names stay well under the 32-char limit.
+var (
+	nameAdjectives = []string{
+		"amber", "bold", "brave", "brisk", "calm", "clever", "cosmic", "crisp",
+		"dapper", "eager", "fancy", "fuzzy", "gentle", "glad", "golden", "happy",
+		"hidden", "jolly", "keen", "lively", "lucky", "mellow", "merry", "misty",
+		"nimble", "noble", "plucky", "proud", "quick", "quiet", "rapid", "rusty",
+		"shiny", "silent", "sleek", "snowy", "solar", "spry", "steady", "sunny",
+		"swift", "tidy", "vivid", "wild", "witty", "young", "zesty", "zippy",
+	}
+	nameNouns = []string{
+		"badger", "beacon", "bison", "comet", "condor", "coyote", "falcon", "ferret",
+		"finch", "fox", "gecko", "heron", "ibis", "jaguar", "koala", "lemur",
+		"lynx", "marten", "meadow", "moose", "newt", "ocelot", "orca", "osprey",
+		"otter", "owl", "panda", "pebble", "puffin", "quail", "raven", "river",
+		"robin", "salmon", "shark", "sparrow", "spruce", "squid", "stork", "tapir",
+		"tiger", "toucan", "trout", "walrus", "willow", "wombat", "wren", "yak",
+	}
+)
+
+// GenerateName returns a random adjective-noun name not used by any current
+// session. If every combination tried is taken, a numeric suffix is appended.
+// Another session may take the name before the caller uses it; launches
+// that need a generated name set LaunchOptions.GenerateName instead.
+func (m *SessionManager) GenerateName() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.generateName()
+}
+
+// generateName is GenerateName. The caller holds m.mu.
+func (m *SessionManager) generateName() string {
+	var name string
+	for i := 0; i < 20; i++ {
+		name = nameAdjectives[rand.IntN(len(nameAdjectives))] + "-" + nameNouns[rand.IntN(len(nameNouns))]
+		if _, taken := m.nameIndex[name]; !taken {
+			return name
+		}
+	}
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s-%d", name, n)
+		if _, taken := m.nameIndex[candidate]; !taken {
+			return candidate
+		}
+	}
+}
+
+// claimName takes name for session id, or a generated name if name is
+// empty and generate is set, and returns it. The name is checked and
+// claimed under one lock, so two launches cannot both take it.
+func (m *SessionManager) claimName(id uint32, name string, generate bool) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if name == "" {
+		if !generate {
+			return "", nil
+		}
+		name = m.generateName()
+	}
+	if existing, taken := m.nameIndex[name]; taken {
+		return "", fmt.Errorf("name %q already in use by session %d", name, existing)
+	}
+	m.nameIndex[name] = id
+	return name, nil
+}
+
+// unclaimName gives up the name claimName took for a session that failed
+// to launch.
+func (m *SessionManager) unclaimName(id uint32, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.nameIndex[name]; ok && existing == id {
+		delete(m.nameIndex, name)
+	}
+}
+
+// AvailableName returns base if no session holds it, otherwise base with the
+// lowest free "-N" suffix, trimming base so the result stays a valid name.
+func (m *SessionManager) AvailableName(base string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, taken := m.nameIndex[base]; !taken {
+		return base
+	}
+	for n := 2; ; n++ {
+		suffix := fmt.Sprintf("-%d", n)
+		trimmed := base
+		if len(trimmed)+len(suffix) > 32 {
+			trimmed = trimmed[:32-len(suffix)]
+		}
+		candidate := trimmed + suffix
+		if _, taken := m.nameIndex[candidate]; !taken {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package session
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Orphan policies for session processes that outlive the node that launched
+// them.
+const (
+	// OrphanAdopt tracks surviving processes as sessions again.
+	OrphanAdopt = "adopt"
+	// OrphanKill terminates surviving processes.
+	OrphanKill = "kill"
+	// OrphanIgnore leaves surviving processes alone, untracked.
+	OrphanIgnore = "ignore"
+)
+
+// orphanPollInterval is how often adopted processes are checked for exit;
+// they are not children of this node, so it cannot wait for them.
+const orphanPollInterval = time.Second
+
+// orphanKillGrace is how long OrphanKill waits after SIGTERM before sending
+// SIGKILL.
+const orphanKillGrace = 5 * time.Second
+
+// errAdopted is returned for operations that need an adopted session's PTY,
+// which closed with the node that launched it.
+func errAdopted(id uint32) error {
+	return fmt.Errorf("session %d was adopted after a node restart and has no terminal", id)
+}
+
+// RecoverOrphans applies policy to sessions the previous node recorded as
+// running whose processes are still alive, and returns how many it found.
+//
+// Adopted sessions keep their ID, name, tags and logs. Status, logs, wait
+// and kill work as before, but the PTY is gone, so they cannot be attached
+// to or sent input, and their output after the restart is not captured. When
+// an adopted process exits its exit code is unknown and reported as -1.
+//
+// terminals holds PTY masters handed over by the previous node (see
+// Terminals). Sessions with one are taken over whatever the policy, with
+// their terminal intact; only the exit code is lost. Unused terminals are
+// closed.
+func (m *SessionManager) RecoverOrphans(policy string, terminals map[uint32]*os.File) int {
+	m.mu.Lock()
+	previous := m.previous
+	m.previous = nil
+	m.mu.Unlock()
+
+	found := 0
+	for _, meta := range previous {
+		master := terminals[meta.ID]
+		delete(terminals, meta.ID)
+		if meta.Status != StatusRunning().String() || meta.PID == nil || !sameProcess(meta) {
+			if master != nil {
+				master.Close()
+			}
+			continue
+		}
+		found++
+		pid := int(*meta.PID)
+
+		if master != nil {
+			m.adopt(meta, ptyMaster{master})
+			slog.Info("took over session", "id", meta.ID, "pid", pid)
+			continue
+		}
+		switch policy {
+		case OrphanKill:
+			slog.Info("killing orphaned session process", "id", meta.ID, "pid", pid)
+			m.killOrphan(meta)
+		case OrphanIgnore:
+			slog.Info("ignoring orphaned session process", "id", meta.ID, "pid", pid)
+		default:
+			m.adopt(meta, nil)
+			slog.Info("adopted orphaned session", "id", meta.ID, "pid", pid)
+		}
+	}
+	for _, master := range terminals {
+		master.Close()
+	}
+	if found > 0 {
+		m.triggerPersist()
+	}
+	return found
+}
+
+// adopt registers a running session left behind by a previous node. With
+// master, its PTY, the session works as if this node had launched it.
+func (m *SessionManager) adopt(meta SessionMeta, master terminal) {
+	id := meta.ID
+	logDir := filepath.Join(m.dataDir, "sessions", fmt.Sprintf("%d", id))
+
+	meta.Adopted = master == nil
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+	sess := &Session{
+		Meta:          meta,
+		broadcaster:   NewBroadcaster(),
+		inputCh:       make(chan []byte, 256),
+		statusWatcher: NewStatusWatcher(StatusRunning()),
+		logPath:       filepath.Join(logDir, "output.log"),
+		startedAt:     meta.CreatedAt,
+		exited:        make(chan struct{}),
+		master:        master,
+		screen:        newScreen(defaultScreenCols, defaultScreenRows),
+	}
+	if responder, err := newAutoResponder(meta.AutoRespond); err == nil {
+		sess.autoRespond = responder
+	} else {
+		slog.Error("failed to restore auto-respond rules", "id", id, "err", err)
+	}
+	if alerts, err := m.newAlertWatcher(meta.Alerts, meta.AlertNotify); err == nil {
+		sess.alerts = alerts
+	} else {
+		slog.Error("failed to restore alert patterns", "id", id, "err", err)
+	}
+	// Secrets and launch env are not persisted, so only patterns and the
+	// node's own sensitive variables are still masked.
+	if redact, err := m.newRedactor(meta.Redact, nil, nil); err == nil {
+		sess.redact = redact
+	} else {
+		slog.Error("failed to restore redact patterns", "id", id, "err", err)
+	}
+	if eventLog, err := NewEventLog(filepath.Join(logDir, "events.jsonl")); err == nil {
+		sess.eventLog = eventLog
+	} else {
+		slog.Error("failed to open event log", "id", id, "err", err)
+	}
+	if messageLog, err := NewEventLog(filepath.Join(logDir, "messages.jsonl")); err == nil {
+		sess.messageLog = messageLog
+	} else {
+		slog.Error("failed to open message log", "id", id, "err", err)
+	}
+
+	m.mu.Lock()
+	m.sessions[id] = sess
+	if meta.Name != "" {
+		if _, taken := m.nameIndex[meta.Name]; !taken {
+			m.nameIndex[meta.Name] = id
+		}
+	}
+	m.take(meta.Pool)
+	m.mu.Unlock()
+
+	if master != nil {
+		m.pump(sess, nil)
+	}
+	go m.watchAdopted(sess, meta)
+}
+
+// Terminals returns the PTY masters of running sessions, for handing them
+// over to a new node. Windows pseudo consoles cannot be handed over. It fails while sessions are queued: their launch
+// details are not persisted, so a new node could not start them.
+func (m *SessionManager) Terminals() (map[uint32]*os.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if n := len(m.queue); n > 0 {
+		return nil, fmt.Errorf("%d session(s) are queued; wait for them to start or kill them first", n)
+	}
+	terminals := make(map[uint32]*os.File)
+	for id, sess := range m.sessions {
+		sess.mu.Lock()
+		if pm, ok := sess.master.(ptyMaster); ok && sess.statusWatcher.Get().State == "running" {
+			terminals[id] = pm.File
+		}
+		sess.mu.Unlock()
+	}
+	return terminals, nil
+}
+
+// watchAdopted waits for an adopted session's process to exit and completes
+// the session.
+func (m *SessionManager) watchAdopted(sess *Session, meta SessionMeta) {
+	ticker := time.NewTicker(orphanPollInterval)
+	for range ticker.C {
+		if !sameProcess(meta) {
+			break
+		}
+	}
+	ticker.Stop()
+
+	id := sess.Meta.ID
+	slog.Info("adopted session process exited", "id", id)
+
+	// The process was not this node's child, so only a backend that tracks
+	// the command itself knows its exit code.
+	exitCode, reason := -1, ""
+	var known *int
+	if b, err := m.backend(sess.Meta.Backend); err == nil {
+		if f, ok := b.(SessionFinisher); ok {
+			code, why, ok := f.Finish(sess.Meta.BackendState)
+			if ok {
+				exitCode, known = code, &code
+			}
+			reason = why
+		}
+	}
+
+	now := time.Now().UTC()
+	durationMs := now.Sub(sess.startedAt).Milliseconds()
+	sess.mu.Lock()
+	sess.Meta.CompletedAt = &now
+	sess.Meta.ExitCode = known
+	sess.Meta.ExitReason = reason
+	sess.Meta.Result = captureResult(sess.logPath, 200)
+	sess.mu.Unlock()
+
+	m.checkGitDirty(sess)
+
+	sess.statusWatcher.Set(sess.exitStatus(exitCode))
+	m.recordOutcome(sess)
+	close(sess.exited)
+
+	statusEvent := NewSessionExitEvent(known, &durationMs, reason)
+	if sess.eventLog != nil {
+		sess.eventLog.Append(statusEvent)
+		sess.eventLog.Close()
+	}
+	m.Subscriptions.Publish(id, sess.Meta.Tags, sess.Meta.Labels, statusEvent)
+
+	m.releaseName(id)
+	m.releaseSlot(sess.Meta.Pool)
+	m.triggerPersist()
+}
+
+// sameProcess reports whether meta's process is still running. Where meta
+// records when it started, a live PID must have started then too, so that a
+// recycled PID is neither adopted nor killed. Sessions recorded by older
+// nodes, or on platforms without processStart, rely on processAlive alone.
+func sameProcess(meta SessionMeta) bool {
+	pid := int(*meta.PID)
+	if !processAlive(pid) {
+		return false
+	}
+	if meta.PIDStart == "" {
+		return true
+	}
+	start, err := processStart(pid)
+	return err == nil && start == meta.PIDStart
+}
+
+// killOrphan sends SIGTERM to an orphaned session's process group, through
+// its backend, then SIGKILL if it is still running after orphanKillGrace.
+func (m *SessionManager) killOrphan(meta SessionMeta) {
+	_ = m.signalSession(meta, syscall.SIGTERM, true)
+	go func() {
+		deadline := time.Now().Add(orphanKillGrace)
+		for time.Now().Before(deadline) {
+			if !sameProcess(meta) {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		_ = m.signalSession(meta, syscall.SIGKILL, true)
+	}()
+}
@@ -0,0 +1,214 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// pipeLineBytes caps the partial output line a pipe holds; longer lines are
+// forwarded in pieces.
+const pipeLineBytes = 4096
+
+// pipe forwards lines of one session's output into another's input. It runs
+// on the node, so it outlives the client that created it, and ends when
+// either session does or it is removed.
+type pipe struct {
+	protocol.Pipe
+	re      *regexp.Regexp // nil forwards every line
+	lines   atomic.Uint64
+	dropped atomic.Uint64
+	stop    chan struct{}
+}
+
+// pipeSet holds a SessionManager's pipes.
+type pipeSet struct {
+	mu     sync.Mutex
+	nextID uint32
+	pipes  map[uint32]*pipe
+}
+
+// AddPipe starts forwarding the output of session from into session to's
+// input, a line at a time, each followed by Enter. With grep, only lines
+// matching it are forwarded, and replace, if set, rewrites the matches
+// (see regexp.Regexp.ReplaceAllString). Blank lines are skipped.
+func (m *SessionManager) AddPipe(from, to uint32, grep, replace string) (protocol.Pipe, error) {
+	if from == to {
+		return protocol.Pipe{}, fmt.Errorf("cannot pipe session %d into itself", from)
+	}
+	if replace != "" && grep == "" {
+		return protocol.Pipe{}, fmt.Errorf("replace needs a grep pattern")
+	}
+	var re *regexp.Regexp
+	if grep != "" {
+		var err error
+		if re, err = regexp.Compile(grep); err != nil {
+			return protocol.Pipe{}, fmt.Errorf("invalid grep pattern %q: %w", grep, err)
+		}
+	}
+
+	m.mu.RLock()
+	src, srcOK := m.sessions[from]
+	dst, dstOK := m.sessions[to]
+	m.mu.RUnlock()
+	switch {
+	case !srcOK:
+		return protocol.Pipe{}, fmt.Errorf("session %d not found", from)
+	case !dstOK:
+		return protocol.Pipe{}, fmt.Errorf("session %d not found", to)
+	case dst.Meta.Adopted:
+		return protocol.Pipe{}, errAdopted(to)
+	}
+	if err := m.checkInput(from, dst); err != nil {
+		return protocol.Pipe{}, err
+	}
+	for _, s := range []*Session{src, dst} {
+		if state := s.statusWatcher.Get().State; state != "running" {
+			return protocol.Pipe{}, fmt.Errorf("session %d is %s", s.Meta.ID, state)
+		}
+	}
+
+	p := &pipe{
+		Pipe: protocol.Pipe{
+			From:      from,
+			To:        to,
+			Grep:      grep,
+			Replace:   replace,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		},
+		re:   re,
+		stop: make(chan struct{}),
+	}
+	m.pipes.mu.Lock()
+	if m.pipes.pipes == nil {
+		m.pipes.pipes = make(map[uint32]*pipe)
+	}
+	m.pipes.nextID++
+	p.ID = m.pipes.nextID
+	m.pipes.pipes[p.ID] = p
+	m.pipes.mu.Unlock()
+
+	// Subscribe before returning, so no output after AddPipe is missed.
+	subID, out := src.broadcaster.Subscribe(OutputBufferBytes)
+	go m.runPipe(p, src, dst, subID, out)
+	slog.Info("pipe added", "pipe", p.ID, "from", from, "to", to)
+	return p.info(), nil
+}
+
+// Pipes returns the running pipes, sorted by ID.
+func (m *SessionManager) Pipes() []protocol.Pipe {
+	m.pipes.mu.Lock()
+	defer m.pipes.mu.Unlock()
+	pipes := make([]protocol.Pipe, 0, len(m.pipes.pipes))
+	for _, p := range m.pipes.pipes {
+		pipes = append(pipes, p.info())
+	}
+	sort.Slice(pipes, func(i, j int) bool { return pipes[i].ID < pipes[j].ID })
+	return pipes
+}
+
+// RemovePipe stops pipe id.
+func (m *SessionManager) RemovePipe(id uint32) error {
+	m.pipes.mu.Lock()
+	p, ok := m.pipes.pipes[id]
+	delete(m.pipes.pipes, id)
+	m.pipes.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("pipe %d not found", id)
+	}
+	close(p.stop)
+	return nil
+}
+
+func (p *pipe) info() protocol.Pipe {
+	info := p.Pipe
+	info.Lines, info.Dropped = p.lines.Load(), p.dropped.Load()
+	return info
+}
+
+// runPipe forwards src's output to dst until the pipe is removed or either
+// session ends; src's last lines are forwarded first.
+func (m *SessionManager) runPipe(p *pipe, src, dst *Session, subID uint64, out *OutputListener) {
+	defer src.broadcaster.Unsubscribe(subID)
+	defer func() {
+		m.pipes.mu.Lock()
+		if m.pipes.pipes[p.ID] == p {
+			delete(m.pipes.pipes, p.ID)
+		}
+		m.pipes.mu.Unlock()
+		slog.Info("pipe ended", "pipe", p.ID, "lines", p.lines.Load())
+	}()
+
+	var partial []byte
+	feed := func() {
+		for {
+			o, ok := out.Next()
+			if !ok {
+				return
+			}
+			if o.Dropped > 0 {
+				// The line the gap fell in is incomplete; don't forward it.
+				slog.Warn("pipe fell behind its source", "pipe", p.ID, "dropped_bytes", o.Dropped)
+				partial = nil
+			}
+			partial = append(partial, o.Data...)
+			for {
+				i := bytes.IndexByte(partial, '\n')
+				if i < 0 {
+					break
+				}
+				m.forward(p, src, dst, partial[:i])
+				partial = partial[i+1:]
+			}
+			if len(partial) > pipeLineBytes {
+				m.forward(p, src, dst, partial)
+				partial = nil
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-dst.exited:
+			return
+		case <-out.Ready():
+			feed()
+		case <-src.exited:
+			feed()
+			m.forward(p, src, dst, partial)
+			return
+		}
+	}
+}
+
+// forward sends one line of src's output, as a terminal shows it and
+// redacted like src's log, to dst if it passes the pipe's filter.
+func (m *SessionManager) forward(p *pipe, src, dst *Session, raw []byte) {
+	line := src.redact.redactString(cleanLine(string(raw)))
+	if line == "" {
+		return
+	}
+	if p.re != nil {
+		if !p.re.MatchString(line) {
+			return
+		}
+		if p.Replace != "" {
+			line = p.re.ReplaceAllString(line, p.Replace)
+		}
+	}
+	if _, err := m.SendInput(dst.Meta.ID, []byte(line+"\r")); err != nil {
+		p.dropped.Add(1)
+		slog.Warn("pipe dropped a line", "pipe", p.ID, "to", dst.Meta.ID, "err", err)
+		return
+	}
+	p.lines.Add(1)
+}
@@ -0,0 +1,32 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// processStart identifies the start of process pid: the boot ID and its
+// start time in clock ticks since boot, from /proc/<pid>/stat.
+func processStart(pid int) (string, error) {
+	boot, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return "", err
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "", err
+	}
+	// The command name in parentheses may hold spaces; starttime is the
+	// 20th field after it.
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return "", fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 20 {
+		return "", fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	return strings.TrimSpace(string(boot)) + ":" + fields[19], nil
+}
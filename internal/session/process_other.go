@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package session
+
+import "errors"
+
+// processStart is not implemented on this platform, so orphaned sessions
+// are only matched by PID and process group.
+func processStart(pid int) (string, error) {
+	return "", errors.ErrUnsupported
+}
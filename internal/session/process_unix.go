@@ -0,0 +1,25 @@
+//go:build !windows
+
+package session
+
+import "syscall"
+
+// signalGroup signals the PTY process pid, or with group its whole process
+// group. Sessions lead their own group (pty.Start uses setsid), so the
+// negated PID addresses it.
+func signalGroup(pid int, sig syscall.Signal, group bool) error {
+	if group {
+		pid = -pid
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// processAlive reports whether pid is a live session process: sessions lead
+// their own process group, which also guards against a recycled PID.
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	pgid, err := syscall.Getpgid(pid)
+	return err == nil && pgid == pid
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+
+package session
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestSameProcess(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	pid := uint32(cmd.Process.Pid)
+	start, err := processStart(int(pid))
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("process start times are not available here")
+	}
+	if err != nil || start == "" {
+		t.Fatalf("processStart = %q, %v", start, err)
+	}
+	if again, _ := processStart(int(pid)); again != start {
+		t.Errorf("processStart changed from %q to %q", start, again)
+	}
+
+	meta := SessionMeta{PID: &pid, PIDStart: start}
+	if !sameProcess(meta) {
+		t.Error("sameProcess = false for the running process")
+	}
+	meta.PIDStart = ""
+	if !sameProcess(meta) {
+		t.Error("sameProcess = false without a recorded start")
+	}
+	// A PID that now belongs to a process started at another time is not
+	// the session's.
+	meta.PIDStart = start + "0"
+	if sameProcess(meta) {
+		t.Error("sameProcess = true for a different start time")
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	meta.PIDStart = start
+	if sameProcess(meta) {
+		t.Error("sameProcess = true after the process exited")
+	}
+}
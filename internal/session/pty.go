@@ -0,0 +1,23 @@
+package session
+
+import (
+	"io"
+	"os"
+
+	"github.com/creack/pty"
+)
+
+// terminal is the master side of a session's pseudo-terminal: output from
+// the session is read from it and input written to it.
+type terminal interface {
+	io.ReadWriteCloser
+	Resize(cols, rows uint16) error
+}
+
+// ptyMaster is a Unix PTY master, as opened by creack/pty or handed over by
+// a previous node.
+type ptyMaster struct{ *os.File }
+
+func (p ptyMaster) Resize(cols, rows uint16) error {
+	return pty.Setsize(p.File, &pty.Winsize{Rows: rows, Cols: cols})
+}
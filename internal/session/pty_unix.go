@@ -0,0 +1,20 @@
+//go:build !windows
+
+package session
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/creack/pty"
+)
+
+// startPTY starts cmd on a new PTY, as the leader of a new session and
+// process group.
+func startPTY(cmd *exec.Cmd) (terminal, *os.Process, error) {
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ptyMaster{ptmx}, cmd.Process, nil
+}
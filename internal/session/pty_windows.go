@@ -0,0 +1,160 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// conPTY is a Windows pseudo console. The session writes input to one pipe
+// and reads the console's output from another.
+type conPTY struct {
+	console   windows.Handle
+	in        *os.File
+	out       *os.File
+	closeOnce sync.Once
+}
+
+func (c *conPTY) Read(p []byte) (int, error)  { return c.out.Read(p) }
+func (c *conPTY) Write(p []byte) (int, error) { return c.in.Write(p) }
+
+func (c *conPTY) Resize(cols, rows uint16) error {
+	return windows.ResizePseudoConsole(c.console, windows.Coord{X: int16(cols), Y: int16(rows)})
+}
+
+// closeConsole closes the pseudo console, which ends the processes still
+// attached to it and, once its last output is read, the output pipe.
+func (c *conPTY) closeConsole() {
+	c.closeOnce.Do(func() { windows.ClosePseudoConsole(c.console) })
+}
+
+func (c *conPTY) Close() error {
+	c.closeConsole()
+	c.in.Close()
+	return c.out.Close()
+}
+
+// startPTY starts cmd attached to a new pseudo console (ConPTY, Windows 10
+// 1809 or later). The console is closed when the process exits: unlike a
+// Unix PTY, its output pipe does not end by itself.
+func startPTY(cmd *exec.Cmd) (terminal, *os.Process, error) {
+	if cmd.Err != nil {
+		return nil, nil, cmd.Err
+	}
+
+	var inRead, inWrite, outRead, outWrite windows.Handle
+	if err := windows.CreatePipe(&inRead, &inWrite, nil, 0); err != nil {
+		return nil, nil, err
+	}
+	if err := windows.CreatePipe(&outRead, &outWrite, nil, 0); err != nil {
+		windows.CloseHandle(inRead)
+		windows.CloseHandle(inWrite)
+		return nil, nil, err
+	}
+	var console windows.Handle
+	err := windows.CreatePseudoConsole(windows.Coord{X: 80, Y: 24}, inRead, outWrite, 0, &console)
+	// The console keeps its own copies of its ends of the pipes.
+	windows.CloseHandle(inRead)
+	windows.CloseHandle(outWrite)
+	c := &conPTY{
+		console: console,
+		in:      os.NewFile(uintptr(inWrite), "conpty-in"),
+		out:     os.NewFile(uintptr(outRead), "conpty-out"),
+	}
+	if err != nil {
+		c.in.Close()
+		c.out.Close()
+		return nil, nil, err
+	}
+
+	pi, err := createConsoleProcess(cmd, console)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	windows.CloseHandle(pi.Thread)
+	proc, err := os.FindProcess(int(pi.ProcessId))
+	if err != nil {
+		windows.TerminateProcess(pi.Process, 1)
+		windows.CloseHandle(pi.Process)
+		c.Close()
+		return nil, nil, err
+	}
+	go func() {
+		windows.WaitForSingleObject(pi.Process, windows.INFINITE)
+		windows.CloseHandle(pi.Process)
+		c.closeConsole()
+	}()
+	return c, proc, nil
+}
+
+// createConsoleProcess starts cmd's program with its arguments, directory
+// and environment, attached to console.
+func createConsoleProcess(cmd *exec.Cmd, console windows.Handle) (*windows.ProcessInformation, error) {
+	attrs, err := windows.NewProcThreadAttributeList(1)
+	if err != nil {
+		return nil, err
+	}
+	defer attrs.Delete()
+	// The attribute's value is the console handle itself.
+	if err := attrs.Update(windows.PROC_THREAD_ATTRIBUTE_PSEUDOCONSOLE, *(*unsafe.Pointer)(unsafe.Pointer(&console)), unsafe.Sizeof(console)); err != nil {
+		return nil, err
+	}
+
+	si := &windows.StartupInfoEx{ProcThreadAttributeList: attrs.List()}
+	si.Cb = uint32(unsafe.Sizeof(*si))
+	// Without standard handles of its own the process would inherit the
+	// node's instead of using the console.
+	si.Flags = windows.STARTF_USESTDHANDLES
+
+	app, err := windows.UTF16PtrFromString(cmd.Path)
+	if err != nil {
+		return nil, err
+	}
+	cmdLine, err := windows.UTF16PtrFromString(windows.ComposeCommandLine(cmd.Args))
+	if err != nil {
+		return nil, err
+	}
+	var dir *uint16
+	if cmd.Dir != "" {
+		if dir, err = windows.UTF16PtrFromString(cmd.Dir); err != nil {
+			return nil, err
+		}
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	block, err := envBlock(env)
+	if err != nil {
+		return nil, err
+	}
+
+	pi := new(windows.ProcessInformation)
+	flags := uint32(windows.EXTENDED_STARTUPINFO_PRESENT | windows.CREATE_UNICODE_ENVIRONMENT)
+	if err := windows.CreateProcess(app, cmdLine, nil, nil, false, flags, &block[0], dir, &si.StartupInfo, pi); err != nil {
+		return nil, &os.PathError{Op: "CreateProcess", Path: cmd.Path, Err: err}
+	}
+	return pi, nil
+}
+
+// envBlock encodes env as a Unicode environment block: KEY=VALUE strings,
+// each NUL-terminated, followed by a final NUL.
+func envBlock(env []string) ([]uint16, error) {
+	var block []uint16
+	for _, kv := range env {
+		for _, r := range kv {
+			if r == 0 {
+				return nil, errors.New("environment variable contains NUL")
+			}
+		}
+		block = append(block, utf16.Encode([]rune(kv))...)
+		block = append(block, 0)
+	}
+	return append(block, 0), nil
+}
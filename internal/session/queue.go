@@ -0,0 +1,234 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ErrAtCapacity is returned by LaunchNoQueue when MaxConcurrent sessions are
+// already running.
+var ErrAtCapacity = errors.New("node is at its concurrent session limit")
+
+// ErrPoolAtCapacity is returned by LaunchWith with NoQueue when the
+// session's pool is full.
+var ErrPoolAtCapacity = errors.New("session pool is at its concurrent session limit")
+
+// queuedLaunch is a session waiting for a slot.
+type queuedLaunch struct {
+	sess *Session
+	spec launchSpec
+}
+
+// reserveSlot takes a running slot for a new session, or reports that it
+// must be queued. Sessions queue behind earlier launches that wait for the
+// same slot, so each pool, and the node as a whole, starts sessions in the
+// order they were launched.
+func (m *SessionManager) reserveSlot(spec launchSpec, allowQueue bool) (queued bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.launchErr != nil {
+		return false, m.launchErr
+	}
+
+	if spec.poolSize > 0 {
+		m.poolSize[spec.pool] = spec.poolSize
+	}
+
+	var full error
+	switch {
+	case m.MaxConcurrent > 0 && (m.active >= m.MaxConcurrent || m.queuedFor("") > 0):
+		full = fmt.Errorf("%w (%d)", ErrAtCapacity, m.MaxConcurrent)
+	case spec.pool != "" && (!m.poolHasRoom(spec.pool) || m.queuedFor(spec.pool) > 0):
+		full = fmt.Errorf("%w (%s=%d)", ErrPoolAtCapacity, spec.pool, m.poolSize[spec.pool])
+	}
+	if full != nil {
+		if !allowQueue {
+			return false, full
+		}
+		return true, nil
+	}
+	m.take(spec.pool)
+	return false, nil
+}
+
+// StopLaunches makes launches fail with err, or allows them again when err
+// is nil.
+func (m *SessionManager) StopLaunches(err error) {
+	m.mu.Lock()
+	m.launchErr = err
+	m.mu.Unlock()
+}
+
+// queuedFor counts queued sessions in pool, or the sessions only waiting for
+// a node slot when pool is empty. Caller holds mu.
+func (m *SessionManager) queuedFor(pool string) int {
+	n := 0
+	for _, q := range m.queue {
+		if pool != "" && q.spec.pool == pool {
+			n++
+		} else if pool == "" && (q.spec.pool == "" || m.poolHasRoom(q.spec.pool)) {
+			n++
+		}
+	}
+	return n
+}
+
+// poolHasRoom reports whether pool can start another session. Caller holds mu.
+func (m *SessionManager) poolHasRoom(pool string) bool {
+	size := m.poolSize[pool]
+	return pool == "" || size == 0 || m.poolActive[pool] < size
+}
+
+// take claims a node slot, and a pool slot when pool is set. Caller holds mu.
+func (m *SessionManager) take(pool string) {
+	m.active++
+	if pool != "" {
+		m.poolActive[pool]++
+	}
+}
+
+// give returns the slots claimed by take. Caller holds mu.
+func (m *SessionManager) give(pool string) {
+	m.active--
+	if pool != "" {
+		if m.poolActive[pool]--; m.poolActive[pool] <= 0 {
+			delete(m.poolActive, pool)
+		}
+	}
+}
+
+// releaseSlot frees a running slot in the node and pool, and starts queued
+// sessions.
+func (m *SessionManager) releaseSlot(pool string) {
+	m.mu.Lock()
+	m.give(pool)
+	m.mu.Unlock()
+	m.startQueued()
+}
+
+func (m *SessionManager) enqueue(sess *Session, spec launchSpec) {
+	m.mu.Lock()
+	m.queue = append(m.queue, &queuedLaunch{sess: sess, spec: spec})
+	m.mu.Unlock()
+	// A slot may have freed up since reserveSlot.
+	m.startQueued()
+}
+
+// startQueued starts queued sessions while slots are free. A session whose
+// pool is full does not hold up sessions queued behind it in other pools.
+func (m *SessionManager) startQueued() {
+	for {
+		m.mu.Lock()
+		q := m.nextStartable()
+		if q == nil {
+			m.mu.Unlock()
+			return
+		}
+		m.take(q.spec.pool)
+		m.mu.Unlock()
+
+		sess := q.sess
+		id := sess.Meta.ID
+		proc, err := m.spawn(sess, q.spec)
+		if err != nil {
+			slog.Error("failed to start queued session", "id", id, "err", err)
+			m.finishQueued(sess, StatusCompleted(-1))
+			m.mu.Lock()
+			m.give(q.spec.pool)
+			m.mu.Unlock()
+			continue
+		}
+
+		sess.statusWatcher.Set(StatusRunning())
+		sess.mu.Lock()
+		sess.Meta.Status = StatusRunning().String()
+		sess.mu.Unlock()
+
+		event := NewSessionStatusEvent("queued", "running", nil, nil)
+		if sess.eventLog != nil {
+			sess.eventLog.Append(event)
+		}
+		m.Subscriptions.Publish(id, sess.Meta.Tags, sess.Meta.Labels, event)
+
+		m.serve(sess, proc, q.spec)
+		slog.Info("queued session started", "id", id)
+		m.triggerPersist()
+	}
+}
+
+// nextStartable removes and returns the first queued session with a free node
+// and pool slot, or nil. Caller holds mu.
+func (m *SessionManager) nextStartable() *queuedLaunch {
+	if m.MaxConcurrent > 0 && m.active >= m.MaxConcurrent {
+		return nil
+	}
+	for i, q := range m.queue {
+		if m.poolHasRoom(q.spec.pool) {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			return q
+		}
+	}
+	return nil
+}
+
+// dequeue removes a queued session, reporting whether it was waiting.
+func (m *SessionManager) dequeue(id uint32) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, q := range m.queue {
+		if q.sess.Meta.ID == id {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// finishQueued ends a session that never started, with status killed or
+// completed (-1) when its process could not be started.
+func (m *SessionManager) finishQueued(sess *Session, status SessionStatus) {
+	id := sess.Meta.ID
+	now := time.Now().UTC()
+
+	var exitCode *int
+	sess.mu.Lock()
+	sess.Meta.Status = status.String()
+	sess.Meta.CompletedAt = &now
+	if status.State == "completed" {
+		code := status.ExitCode
+		sess.Meta.ExitCode = &code
+		exitCode = &code
+	}
+	sess.startedAt = now
+	sess.mu.Unlock()
+
+	sess.statusWatcher.Set(status)
+	m.recordOutcome(sess)
+
+	var zero int64
+	event := NewSessionStatusEvent("queued", status.State, exitCode, &zero)
+	if sess.eventLog != nil {
+		sess.eventLog.Append(event)
+		sess.eventLog.Close()
+	}
+	m.Subscriptions.Publish(id, sess.Meta.Tags, sess.Meta.Labels, event)
+
+	m.releaseName(id)
+	m.triggerPersist()
+}
+
+// QueuePosition returns a queued session's 1-based place in the queue, or 0
+// if it is not queued.
+func (m *SessionManager) QueuePosition(id uint32) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for i, q := range m.queue {
+		if q.sess.Meta.ID == id {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MessageLimits caps the direct messages and requests each sender may send:
+// each session, and callers that are not sessions as one sender. Zero fields
+// are unlimited.
+type MessageLimits struct {
+	// MaxBody is the largest body accepted, in bytes.
+	MaxBody int
+	// PerMinute is how many messages and requests a sender may send a
+	// minute, after a burst of Burst (PerMinute if zero).
+	PerMinute int
+	Burst     int
+}
+
+var (
+	// ErrRateLimited is returned when a sender goes over
+	// MessageLimits.PerMinute.
+	ErrRateLimited = errors.New("message rate limit exceeded")
+	// ErrMessageTooLarge is returned for a body over MessageLimits.MaxBody.
+	ErrMessageTooLarge = errors.New("message body too large")
+)
+
+// msgBucket is the token bucket of one sender. Once it runs dry, one
+// message.rate_limited event reports it; later refusals are counted until
+// the sender gets a message through again.
+type msgBucket struct {
+	tokens     float64
+	last       time.Time
+	limited    bool // reported since the last accepted message
+	suppressed int  // refusals not reported
+}
+
+// takeMessageToken takes a token from fromID's bucket. If there is none, it
+// reports whether to raise a message.rate_limited event, and how many
+// refusals before this one went unreported.
+func (m *SessionManager) takeMessageToken(fromID uint32, lim MessageLimits) (ok, report bool, suppressed int) {
+	burst := float64(lim.Burst)
+	if burst <= 0 {
+		burst = float64(lim.PerMinute)
+	}
+	rate := float64(lim.PerMinute) / 60 // tokens a second
+	now := time.Now()
+
+	m.msgBucketsMu.Lock()
+	defer m.msgBucketsMu.Unlock()
+	if m.msgBuckets == nil {
+		m.msgBuckets = make(map[uint32]*msgBucket)
+	}
+	// Forget senders whose buckets have refilled, so the map holds only
+	// recent senders.
+	for id, b := range m.msgBuckets {
+		if id != fromID && !b.limited && b.tokens+now.Sub(b.last).Seconds()*rate >= burst {
+			delete(m.msgBuckets, id)
+		}
+	}
+
+	b := m.msgBuckets[fromID]
+	if b == nil {
+		b = &msgBucket{tokens: burst, last: now}
+		m.msgBuckets[fromID] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = false
+		return true, false, 0
+	}
+	if b.limited {
+		b.suppressed++
+		return false, false, 0
+	}
+	b.limited = true
+	suppressed, b.suppressed = b.suppressed, 0
+	return false, true, suppressed
+}
+
+// admitMessage applies m.MessageLimits to a message or request (kind) from
+// session fromID (0 for a caller that is not a session) to session to. A
+// refused message raises a message.rate_limited event, on the sender if it
+// is a session and on to otherwise.
+func (m *SessionManager) admitMessage(kind string, fromID uint32, to *Session, body string) error {
+	lim := m.MessageLimits
+	d := RateLimitedData{Kind: kind, From: fromID, To: to.Meta.ID, Size: len(body)}
+	if lim.PerMinute > 0 {
+		if ok, report, suppressed := m.takeMessageToken(fromID, lim); !ok {
+			if report {
+				d.Reason, d.Limit, d.Suppressed = "rate", lim.PerMinute, suppressed
+				m.rateLimited(to, d)
+			}
+			return fmt.Errorf("%s may send %d messages a minute: %w", senderLabel(fromID), lim.PerMinute, ErrRateLimited)
+		}
+	}
+	if lim.MaxBody > 0 && len(body) > lim.MaxBody {
+		d.Reason, d.Limit = "size", lim.MaxBody
+		m.rateLimited(to, d)
+		return fmt.Errorf("%s body is %d bytes, over the limit of %d: %w", kind, len(body), lim.MaxBody, ErrMessageTooLarge)
+	}
+	return nil
+}
+
+// rateLimited records a message.rate_limited event for a message to to.
+func (m *SessionManager) rateLimited(to *Session, d RateLimitedData) {
+	m.mu.RLock()
+	from := m.sessions[d.From]
+	m.mu.RUnlock()
+	on := to
+	if from != nil {
+		on = from
+		from.mu.Lock()
+		d.FromName = from.Meta.Name
+		from.mu.Unlock()
+	}
+	to.mu.Lock()
+	d.ToName = to.Meta.Name
+	to.mu.Unlock()
+
+	event := NewRateLimitedEvent(d)
+	if on.eventLog != nil {
+		on.eventLog.Append(event)
+	}
+	m.Subscriptions.Publish(on.Meta.ID, on.Meta.Tags, on.Meta.Labels, event)
+}
+
+// senderLabel names session fromID in errors.
+func senderLabel(fromID uint32) string {
+	if fromID == 0 {
+		return "callers outside sessions"
+	}
+	return fmt.Sprintf("session %d", fromID)
+}
+
+// AdmitMessage applies m.MessageLimits to a message from session fromID to
+// session toID that is not going through SendMessage, such as one delivered
+// only to the recipient's terminal.
+func (m *SessionManager) AdmitMessage(fromID, toID uint32, body string) error {
+	m.mu.RLock()
+	sess, ok := m.sessions[toID]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("session %d not found", toID)
+	}
+	return m.admitMessage("message", fromID, sess, body)
+}
@@ -0,0 +1,109 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageLimits(t *testing.T) {
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create session manager: %v", err)
+	}
+	sm.MessageLimits = MessageLimits{MaxBody: 16, PerMinute: 60, Burst: 2}
+	sub := sm.Subscriptions.Subscribe(nil, nil, nil, []EventType{EventRateLimited})
+	defer sm.Subscriptions.Unsubscribe(sub.ID)
+
+	launch := func() uint32 {
+		t.Helper()
+		id, err := sm.Launch([]string{"sleep", "30"}, "/tmp", nil, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = sm.Kill(id) })
+		return id
+	}
+	looper, worker, other := launch(), launch(), launch()
+
+	next := func() (uint32, RateLimitedData) {
+		t.Helper()
+		select {
+		case se := <-sub.Ch:
+			var d RateLimitedData
+			if err := json.Unmarshal(se.Event.Data, &d); err != nil {
+				t.Fatal(err)
+			}
+			return se.SessionID, d
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message.rate_limited event")
+			return 0, RateLimitedData{}
+		}
+	}
+
+	// The body cap applies before anything is logged.
+	if _, err := sm.SendMessage(looper, worker, strings.Repeat("x", 17)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("oversized message: %v", err)
+	}
+	if on, d := next(); on != looper || d.Reason != "size" || d.Kind != "message" || d.Limit != 16 || d.Size != 17 || d.To != worker {
+		t.Fatalf("size event on %d: %+v", on, d)
+	}
+
+	// The oversized message took the first token of the burst.
+	if _, err := sm.SendMessage(looper, worker, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := sm.SendRequest(looper, worker, "ok?"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("request over the burst: %v", err)
+	}
+	if on, d := next(); on != looper || d.Reason != "rate" || d.Kind != "request" || d.Limit != 60 {
+		t.Fatalf("rate event on %d: %+v", on, d)
+	}
+	// Further refusals are counted, not reported one by one.
+	for range 3 {
+		if _, err := sm.SendMessage(looper, worker, "hi"); !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("message over the rate: %v", err)
+		}
+	}
+	select {
+	case se := <-sub.Ch:
+		t.Fatalf("unexpected event %+v", se)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if msgs, _ := sm.ReadMessages(worker, 0); len(msgs) != 1 {
+		t.Errorf("worker inbox holds %d messages, want 1", len(msgs))
+	}
+
+	// Each sender has its own bucket, and callers outside sessions share one.
+	if _, err := sm.SendMessage(other, worker, "hi"); err != nil {
+		t.Errorf("other sender: %v", err)
+	}
+	for range 2 {
+		if err := sm.AdmitMessage(0, worker, "hi"); err != nil {
+			t.Errorf("CLI sender: %v", err)
+		}
+	}
+	if err := sm.AdmitMessage(0, worker, "hi"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("CLI sender over the burst: %v", err)
+	}
+	if on, d := next(); on != worker || d.From != 0 {
+		t.Errorf("CLI rate event on %d: %+v", on, d)
+	}
+
+	// A refilled bucket lets the sender through again, and its next
+	// refusal reports the ones suppressed before.
+	sm.msgBucketsMu.Lock()
+	sm.msgBuckets[looper].last = time.Now().Add(-time.Second)
+	sm.msgBucketsMu.Unlock()
+	if _, err := sm.SendMessage(looper, worker, "hi"); err != nil {
+		t.Fatalf("after refill: %v", err)
+	}
+	if _, err := sm.SendMessage(looper, worker, "hi"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("after refill: %v", err)
+	}
+	if _, d := next(); d.Suppressed != 3 {
+		t.Errorf("suppressed = %d, want 3", d.Suppressed)
+	}
+}
@@ -0,0 +1,189 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedactMask replaces redacted text.
+const RedactMask = "[REDACTED]"
+
+// minRedactValue is the length below which a sensitive value is not masked:
+// masking "1" or "yes" everywhere would ruin the output and hide nothing.
+const minRedactValue = 4
+
+// redactLineBytes caps the partial output line held back so that a secret
+// split between two reads is still masked.
+const redactLineBytes = 4096
+
+// redactFlushDelay is how long a partial line, such as a prompt, is held
+// back before it is masked and written as it is.
+const redactFlushDelay = 200 * time.Millisecond
+
+// redactor masks matches of patterns and occurrences of sensitive values in
+// a session's output.
+type redactor struct {
+	res    []*regexp.Regexp
+	values []string
+}
+
+// newRedactor compiles patterns, returning nil when there is nothing to
+// redact. Values too short to mask are dropped.
+func newRedactor(patterns, values []string) (*redactor, error) {
+	r := &redactor{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+		r.res = append(r.res, re)
+	}
+	for _, v := range values {
+		if len(v) >= minRedactValue {
+			r.values = append(r.values, v)
+		}
+	}
+	if len(r.res) == 0 && len(r.values) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// newRedactor is newRedactor for a session launched with patterns, env and
+// secrets (NAME=VALUE pairs), adding the node's patterns. Every secret's
+// value is sensitive, as is that of each variable in RedactEnv, from env or
+// else the node's environment, which the session inherits.
+func (m *SessionManager) newRedactor(patterns, env, secrets []string) (*redactor, error) {
+	all := append(append([]string(nil), m.RedactPatterns...), patterns...)
+	var values []string
+	for _, kv := range secrets {
+		if _, v, ok := strings.Cut(kv, "="); ok {
+			values = append(values, v)
+		}
+	}
+	for _, name := range m.RedactEnv {
+		v, ok := os.LookupEnv(name)
+		for _, kv := range env {
+			if k, ev, found := strings.Cut(kv, "="); found && k == name {
+				v, ok = ev, true
+			}
+		}
+		if ok {
+			values = append(values, v)
+		}
+	}
+	return newRedactor(all, values)
+}
+
+// redact returns data with every match masked. A nil redactor returns data.
+func (r *redactor) redact(data []byte) []byte {
+	if r == nil {
+		return data
+	}
+	for _, v := range r.values {
+		data = bytes.ReplaceAll(data, []byte(v), []byte(RedactMask))
+	}
+	for _, re := range r.res {
+		data = re.ReplaceAllLiteral(data, []byte(RedactMask))
+	}
+	return data
+}
+
+func (r *redactor) redactString(s string) string {
+	if r == nil {
+		return s
+	}
+	return string(r.redact([]byte(s)))
+}
+
+// RedactStream masks a stream of output a line at a time, so matches split
+// between reads are caught, and passes the result to its emit function. A
+// partial line is held back until it ends, grows past redactLineBytes, or
+// the stream stays quiet for redactFlushDelay. Without a redactor, output
+// is passed through as it comes.
+type RedactStream struct {
+	r    *redactor
+	emit func([]byte)
+
+	mu      sync.Mutex
+	partial []byte
+	timer   *time.Timer
+	closed  bool
+}
+
+func newRedactStream(r *redactor, emit func([]byte)) *RedactStream {
+	return &RedactStream{r: r, emit: emit}
+}
+
+// Write adds output to the stream.
+func (s *RedactStream) Write(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.r == nil {
+		s.emit(data)
+		return
+	}
+	s.partial = append(s.partial, data...)
+	if i := bytes.LastIndexByte(s.partial, '\n'); i >= 0 {
+		s.emit(s.r.redact(s.partial[:i+1]))
+		s.partial = append([]byte(nil), s.partial[i+1:]...)
+	}
+	if len(s.partial) > redactLineBytes {
+		s.flushLocked()
+	}
+	if len(s.partial) == 0 {
+		return
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(redactFlushDelay, s.Flush)
+	} else {
+		s.timer.Reset(redactFlushDelay)
+	}
+}
+
+// Flush emits any partial line held back.
+func (s *RedactStream) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.flushLocked()
+	}
+}
+
+func (s *RedactStream) flushLocked() {
+	if len(s.partial) > 0 {
+		s.emit(s.r.redact(s.partial))
+		s.partial = nil
+	}
+}
+
+// Close flushes the stream; later output is dropped.
+func (s *RedactStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.flushLocked()
+	s.closed = true
+}
+
+// RedactOutput returns a stream masking session id's output the way its
+// log is masked, for output read from SubscribeOutput.
+func (m *SessionManager) RedactOutput(id uint32, emit func([]byte)) (*RedactStream, error) {
+	m.mu.RLock()
+	sess, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("session %d not found", id)
+	}
+	return newRedactStream(sess.redact, emit), nil
+}
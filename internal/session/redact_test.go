@@ -0,0 +1,66 @@
+package session
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := newRedactor([]string{`sk-[a-z0-9]{8,}`}, []string{"hunter2", "no"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := r.redactString("pw=hunter2 key=sk-abcdef1234 no yes")
+	if want := "pw=[REDACTED] key=[REDACTED] no yes"; got != want {
+		t.Errorf("redact = %q, want %q", got, want)
+	}
+	if r, err := newRedactor(nil, []string{"x"}); r != nil || err != nil {
+		t.Errorf("newRedactor with nothing to mask = %v, %v", r, err)
+	}
+	if _, err := newRedactor([]string{"("}, nil); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+	var none *redactor
+	if got := none.redactString("hunter2"); got != "hunter2" {
+		t.Errorf("nil redactor changed output: %q", got)
+	}
+}
+
+func TestRedactStream(t *testing.T) {
+	r, _ := newRedactor(nil, []string{"hunter2"})
+	var mu sync.Mutex
+	var out strings.Builder
+	s := newRedactStream(r, func(data []byte) {
+		mu.Lock()
+		out.Write(data)
+		mu.Unlock()
+	})
+	defer s.Close()
+	written := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return out.String()
+	}
+
+	// A value split between writes is still masked.
+	s.Write([]byte("one hun"))
+	s.Write([]byte("ter2\ntwo "))
+	if got := written(); got != "one [REDACTED]\n" {
+		t.Errorf("after a line: %q", got)
+	}
+
+	// A partial line, like a prompt, is written once the stream goes quiet.
+	time.Sleep(2 * redactFlushDelay)
+	if got := written(); got != "one [REDACTED]\ntwo " {
+		t.Errorf("after the flush delay: %q", got)
+	}
+
+	s.Write([]byte("hunter2"))
+	s.Close()
+	s.Write([]byte("dropped"))
+	if got := written(); got != "one [REDACTED]\ntwo [REDACTED]" {
+		t.Errorf("after Close: %q", got)
+	}
+}
@@ -0,0 +1,151 @@
+package session
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// resourceBaseline is how long sampling waits between two readings when it
+// has no recent reading to measure CPU use against.
+const resourceBaseline = 250 * time.Millisecond
+
+// resourceStale is how old a previous reading may be and still serve as the
+// baseline for CPU use; older readings are forgotten.
+const resourceStale = 30 * time.Second
+
+// procSample is one reading of a process.
+type procSample struct {
+	pid, ppid int
+	group     int           // the process session (Linux) or group it belongs to
+	command   string        // set by describeProcess
+	cpu       time.Duration // CPU time used since the process started
+	rss       uint64
+	openFiles int // set by describeProcess
+}
+
+type cpuReading struct {
+	cpu time.Duration
+	at  time.Time
+}
+
+// resourceSampler samples the processes of sessions for GetStatus. It keeps
+// each process's last CPU time, so CPU use is measured over the time since
+// the previous sample, like top does.
+type resourceSampler struct {
+	mu   sync.Mutex
+	last map[int]cpuReading
+}
+
+// sample returns what the session led by pid uses, or nil when its
+// processes cannot be read.
+func (s *resourceSampler) sample(pid int) *protocol.ResourceUsage {
+	procs, err := readProcesses()
+	if err != nil {
+		return nil
+	}
+	tree := sessionProcesses(procs, pid)
+	if len(tree) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	if s.last == nil {
+		s.last = make(map[int]cpuReading)
+	}
+	baseline := true
+	for _, p := range tree {
+		if r, ok := s.last[p.pid]; !ok || now.Sub(r.at) > resourceStale {
+			baseline = false
+			s.last[p.pid] = cpuReading{cpu: p.cpu, at: now}
+		}
+	}
+	s.mu.Unlock()
+	if !baseline {
+		time.Sleep(resourceBaseline)
+		if procs, err = readProcesses(); err != nil {
+			return nil
+		}
+		tree = sessionProcesses(procs, pid)
+		now = time.Now()
+	}
+
+	usage := &protocol.ResourceUsage{}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range tree {
+		describeProcess(&p)
+		info := protocol.ProcessInfo{
+			PID:       uint32(p.pid),
+			PPID:      uint32(p.ppid),
+			Command:   p.command,
+			RSSBytes:  p.rss,
+			OpenFiles: p.openFiles,
+		}
+		if r, ok := s.last[p.pid]; ok && now.After(r.at) && p.cpu >= r.cpu {
+			info.CPUPercent = 100 * (p.cpu - r.cpu).Seconds() / now.Sub(r.at).Seconds()
+		}
+		s.last[p.pid] = cpuReading{cpu: p.cpu, at: now}
+
+		usage.CPUPercent += info.CPUPercent
+		usage.RSSBytes += info.RSSBytes
+		usage.OpenFiles += info.OpenFiles
+		info.CPUPercent = roundTenth(info.CPUPercent)
+		usage.Processes = append(usage.Processes, info)
+	}
+	usage.CPUPercent = roundTenth(usage.CPUPercent)
+	for pid, r := range s.last {
+		if now.Sub(r.at) > resourceStale {
+			delete(s.last, pid)
+		}
+	}
+	return usage
+}
+
+// sessionProcesses returns the processes of the session led by root: root,
+// its descendants, and processes in its group that were reparented when
+// their parent exited. Each comes after its parent.
+func sessionProcesses(procs []procSample, root int) []procSample {
+	byPID := make(map[int]procSample, len(procs))
+	children := make(map[int][]int)
+	for _, p := range procs {
+		byPID[p.pid] = p
+		children[p.ppid] = append(children[p.ppid], p.pid)
+	}
+	for _, kids := range children {
+		sort.Ints(kids)
+	}
+
+	var tree []procSample
+	seen := make(map[int]bool)
+	var walk func(pid int)
+	walk = func(pid int) {
+		p, ok := byPID[pid]
+		if !ok || seen[pid] {
+			return
+		}
+		seen[pid] = true
+		tree = append(tree, p)
+		for _, kid := range children[pid] {
+			walk(kid)
+		}
+	}
+	walk(root)
+	if len(tree) == 0 {
+		return nil
+	}
+	for _, p := range procs {
+		if p.group == root && !seen[p.pid] && !seen[p.ppid] {
+			walk(p.pid)
+		}
+	}
+	return tree
+}
+
+func roundTenth(f float64) float64 {
+	return math.Round(f*10) / 10
+}
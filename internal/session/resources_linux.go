@@ -0,0 +1,84 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc, which is 100 on
+// every Linux architecture Go supports.
+const clockTicks = 100
+
+// readProcesses reads every process from /proc.
+func readProcesses() ([]procSample, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	pageSize := uint64(os.Getpagesize())
+	procs := make([]procSample, 0, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			continue // exited since ReadDir
+		}
+		p, ok := parseProcStat(string(data), pageSize)
+		if ok {
+			procs = append(procs, p)
+		}
+	}
+	return procs, nil
+}
+
+// parseProcStat parses /proc/<pid>/stat. The command name is in
+// parentheses and may itself contain spaces and parentheses, so fields are
+// counted from the last closing one.
+func parseProcStat(stat string, pageSize uint64) (procSample, bool) {
+	open := strings.IndexByte(stat, '(')
+	end := strings.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return procSample{}, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(stat[:open]))
+	if err != nil {
+		return procSample{}, false
+	}
+	// Fields from state (3) on; field n is at index n-3.
+	f := strings.Fields(stat[end+1:])
+	if len(f) < 22 {
+		return procSample{}, false
+	}
+	ppid, _ := strconv.Atoi(f[1])
+	sid, _ := strconv.Atoi(f[3])
+	utime, _ := strconv.ParseUint(f[11], 10, 64)
+	stime, _ := strconv.ParseUint(f[12], 10, 64)
+	rss, _ := strconv.ParseUint(f[21], 10, 64)
+	return procSample{
+		pid:     pid,
+		ppid:    ppid,
+		group:   sid,
+		command: stat[open+1 : end],
+		cpu:     time.Duration(utime+stime) * time.Second / clockTicks,
+		rss:     rss * pageSize,
+	}, true
+}
+
+// describeProcess fills in p's full command line and open file count.
+func describeProcess(p *procSample) {
+	if cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", p.pid)); err == nil {
+		if args := bytes.TrimRight(cmdline, "\x00"); len(args) > 0 {
+			p.command = string(bytes.ReplaceAll(args, []byte{0}, []byte{' '}))
+		}
+	}
+	if fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", p.pid)); err == nil {
+		p.openFiles = len(fds)
+	}
+}
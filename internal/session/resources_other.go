@@ -0,0 +1,66 @@
+//go:build !linux
+
+package session
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readProcesses reads every process from ps, which reports process groups
+// rather than sessions; session processes lead both.
+func readProcesses() ([]procSample, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,ppid=,pgid=,rss=,time=,args=").Output()
+	if err != nil {
+		return nil, err
+	}
+	var procs []procSample
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 6 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(f[0])
+		ppid, err2 := strconv.Atoi(f[1])
+		pgid, err3 := strconv.Atoi(f[2])
+		rss, err4 := strconv.ParseUint(f[3], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			continue
+		}
+		procs = append(procs, procSample{
+			pid:     pid,
+			ppid:    ppid,
+			group:   pgid,
+			command: strings.Join(f[5:], " "),
+			cpu:     parsePSTime(f[4]),
+			rss:     rss * 1024,
+		})
+	}
+	return procs, nil
+}
+
+// parsePSTime parses ps's CPU time, [[dd-]hh:]mm:ss[.cc].
+func parsePSTime(s string) time.Duration {
+	var d time.Duration
+	if days, rest, ok := strings.Cut(s, "-"); ok {
+		n, _ := strconv.Atoi(days)
+		d += time.Duration(n) * 24 * time.Hour
+		s = rest
+	}
+	parts := strings.Split(s, ":")
+	secs, _ := strconv.ParseFloat(parts[len(parts)-1], 64)
+	d += time.Duration(secs * float64(time.Second))
+	unit := time.Minute
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, _ := strconv.Atoi(parts[i])
+		d += time.Duration(n) * unit
+		unit *= 60
+	}
+	return d
+}
+
+// describeProcess has nothing to add: ps gave the command line, and open
+// files are not counted here.
+func describeProcess(p *procSample) {}
@@ -0,0 +1,33 @@
+package session
+
+import "testing"
+
+func TestSessionProcesses(t *testing.T) {
+	procs := []procSample{
+		{pid: 1, ppid: 0, group: 1},
+		{pid: 100, ppid: 1, group: 100},   // session leader
+		{pid: 102, ppid: 101, group: 100}, // grandchild, listed before its parent
+		{pid: 101, ppid: 100, group: 100},
+		{pid: 103, ppid: 100, group: 100},
+		{pid: 200, ppid: 1, group: 100}, // daemonized, reparented to init
+		{pid: 201, ppid: 200, group: 100},
+		{pid: 300, ppid: 1, group: 300}, // another session
+	}
+	var pids []int
+	for _, p := range sessionProcesses(procs, 100) {
+		pids = append(pids, p.pid)
+	}
+	want := []int{100, 101, 102, 103, 200, 201}
+	if len(pids) != len(want) {
+		t.Fatalf("session processes = %v, want %v", pids, want)
+	}
+	for i := range want {
+		if pids[i] != want[i] {
+			t.Fatalf("session processes = %v, want %v", pids, want)
+		}
+	}
+
+	if got := sessionProcesses(procs, 999); got != nil {
+		t.Errorf("processes of a missing session = %v, want nil", got)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package session
+
+import (
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestResourceSample(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 30 & while :; do :; done")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	var s resourceSampler
+	usage := s.sample(cmd.Process.Pid)
+	if usage == nil {
+		t.Skip("processes cannot be read here")
+	}
+	if len(usage.Processes) != 2 {
+		t.Fatalf("processes = %+v, want the shell and sleep", usage.Processes)
+	}
+	if usage.Processes[0].PID != uint32(cmd.Process.Pid) || !strings.Contains(usage.Processes[1].Command, "sleep 30") {
+		t.Errorf("processes = %+v", usage.Processes)
+	}
+	if usage.Processes[1].PPID != usage.Processes[0].PID {
+		t.Errorf("sleep's parent = %d, want the shell", usage.Processes[1].PPID)
+	}
+	if usage.RSSBytes == 0 {
+		t.Error("RSS is zero")
+	}
+	// The shell spins; allow for a busy machine.
+	if usage.CPUPercent < 20 {
+		t.Errorf("CPU = %.1f%%, want the busy shell's use", usage.CPUPercent)
+	}
+}
@@ -0,0 +1,103 @@
+package session
+
+import (
+	"bytes"
+	"sync"
+)
+
+// HistoryBufferBytes is how much of each session's latest output the node
+// keeps in memory by default; config.toml's node.history_buffer_size
+// overrides it.
+const HistoryBufferBytes = 256 << 10
+
+// outputRing holds the end of a session's log in memory, so recent history
+// is served without reading the file. It holds what the log holds from
+// offset start on, at most maxBytes and, if maxLines is set, maxLines lines
+// of it.
+type outputRing struct {
+	mu       sync.RWMutex
+	buf      []byte // buf[head:] is held
+	head     int
+	start    int64 // log offset of buf[head]
+	atLine   bool  // whether a line starts at buf[head]
+	lines    int   // newlines held
+	maxBytes int
+	maxLines int
+}
+
+// newOutputRing returns a ring for a log already size bytes long.
+func newOutputRing(size int64, maxBytes, maxLines int) *outputRing {
+	return &outputRing{start: size, maxBytes: maxBytes, maxLines: maxLines}
+}
+
+// write adds what was just appended to the log.
+func (r *outputRing) write(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = append(r.buf, data...)
+	r.lines += bytes.Count(data, []byte{'\n'})
+	if over := len(r.buf) - r.head - r.maxBytes; over > 0 {
+		r.drop(over)
+	}
+	for r.maxLines > 0 && r.lines > r.maxLines {
+		r.drop(bytes.IndexByte(r.buf[r.head:], '\n') + 1)
+	}
+	// Compact once more has been dropped than is held, keeping writes
+	// amortized O(len(data)).
+	if r.head > len(r.buf)-r.head {
+		n := copy(r.buf, r.buf[r.head:])
+		r.buf, r.head = r.buf[:n], 0
+	}
+}
+
+func (r *outputRing) drop(n int) {
+	r.lines -= bytes.Count(r.buf[r.head:r.head+n], []byte{'\n'})
+	r.head += n
+	r.start += int64(n)
+	r.atLine = r.buf[r.head-1] == '\n'
+}
+
+// tail returns the log from its last n lines on, counted as strings.Split
+// on "\n" counts them, or all of it if n is negative, and the log's size.
+// ok is false if that reaches back before what the ring holds.
+func (r *outputRing) tail(n int) (data []byte, size int64, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	held := r.buf[r.head:]
+	size = r.start + int64(len(held))
+	if n == 0 {
+		return nil, size, true
+	}
+	from := 0
+	if n > 0 {
+		i := len(held)
+		for ; n > 0; n-- {
+			if i = bytes.LastIndexByte(held[:i], '\n'); i < 0 {
+				break
+			}
+		}
+		from = i + 1
+	}
+	// Short of n newlines, the ring must hold the whole log or start just
+	// after the one missing.
+	if from == 0 && r.start > 0 && !(n == 1 && r.atLine) {
+		return nil, size, false
+	}
+	return bytes.Clone(held[from:]), size, true
+}
+
+// from returns the log from offset on and the log's size. ok is false if
+// offset is before what the ring holds.
+func (r *outputRing) from(offset int64) (data []byte, size int64, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	held := r.buf[r.head:]
+	size = r.start + int64(len(held))
+	if offset < r.start {
+		return nil, size, false
+	}
+	if offset >= size {
+		return nil, size, true
+	}
+	return bytes.Clone(held[offset-r.start:]), size, true
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"strings"
+	"testing"
+)
+
+// splitTail is how history was cut from the log file.
+func splitTail(log string, n int) string {
+	lines := strings.Split(log, "\n")
+	if n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestOutputRingTail(t *testing.T) {
+	r := newOutputRing(0, 1<<10, 0)
+	log := ""
+	for _, chunk := range []string{"one\ntwo\n", "thr", "ee\nfour", "\n\nfive"} {
+		r.write([]byte(chunk))
+		log += chunk
+	}
+	for n := range 9 {
+		got, size, ok := r.tail(n)
+		if !ok || string(got) != splitTail(log, n) || size != int64(len(log)) {
+			t.Errorf("tail(%d) = %q, %d, %v, want %q, %d", n, got, size, ok, splitTail(log, n), len(log))
+		}
+	}
+	if got, _, ok := r.tail(-1); !ok || string(got) != log {
+		t.Errorf("tail(-1) = %q, %v, want the whole log", got, ok)
+	}
+}
+
+func TestOutputRingLimits(t *testing.T) {
+	// A ring for a log that already had 100 bytes can't serve all of it.
+	r := newOutputRing(100, 16, 0)
+	r.write([]byte("a\nb\n"))
+	if got, size, ok := r.tail(2); !ok || string(got) != "b\n" || size != 104 {
+		t.Errorf("tail(2) = %q, %d, %v, want \"b\\n\", 104", got, size, ok)
+	}
+	if _, _, ok := r.tail(3); ok {
+		t.Error("tail(3) reaches back before the ring but was served")
+	}
+	if _, _, ok := r.tail(-1); ok {
+		t.Error("tail(-1) of a partly held log was served")
+	}
+
+	// The byte cap keeps the newest bytes.
+	for range 10 {
+		r.write([]byte("0123456\n"))
+	}
+	if got, size, ok := r.tail(3); !ok || string(got) != "0123456\n0123456\n" || size != 184 {
+		t.Errorf("tail(3) = %q, %d, %v", got, size, ok)
+	}
+	if _, _, ok := r.tail(4); ok {
+		t.Error("tail(4) needs more than the byte cap holds but was served")
+	}
+	r.write([]byte("abc"))
+	if _, _, ok := r.tail(3); ok {
+		t.Error("tail(3) needs a line the byte cap cut but was served")
+	}
+
+	// The line cap keeps the newest lines.
+	r = newOutputRing(0, 1<<10, 2)
+	r.write([]byte("a\nb\nc\nd"))
+	if got, _, ok := r.tail(3); !ok || string(got) != "b\nc\nd" {
+		t.Errorf("tail(3) = %q, %v, want \"b\\nc\\nd\"", got, ok)
+	}
+	if _, _, ok := r.tail(4); ok {
+		t.Error("tail(4) needs a dropped line but was served")
+	}
+}
+
+func TestOutputRingFrom(t *testing.T) {
+	// A ring for a log that already had 10 bytes, holding at most 8.
+	r := newOutputRing(10, 8, 0)
+	r.write([]byte("abcdefghij"))
+	if got, size, ok := r.from(15); !ok || string(got) != "fghij" || size != 20 {
+		t.Errorf("from(15) = %q, %d, %v, want \"fghij\", 20", got, size, ok)
+	}
+	if got, size, ok := r.from(25); !ok || got != nil || size != 20 {
+		t.Errorf("from(25) = %q, %d, %v, want nothing", got, size, ok)
+	}
+	if _, _, ok := r.from(11); ok {
+		t.Error("from(11) reaches back before the ring but was served")
+	}
+}
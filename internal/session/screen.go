@@ -0,0 +1,478 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Size of a session's screen until a client resizes its terminal.
+const (
+	defaultScreenCols = 80
+	defaultScreenRows = 24
+)
+
+// screenCell is a character on the screen and the SGR parameters it was
+// written with ("" for the default style).
+type screenCell struct {
+	ch  rune
+	sgr string
+}
+
+// screen emulates enough of a VT100/xterm to know what a session's
+// terminal shows: printing with wrap, cursor movement, erasing, inserting
+// and deleting, scroll regions, SGR styles and the alternate screen. Other
+// sequences are ignored. It is fed by the session's PTY reader.
+type screen struct {
+	mu         sync.Mutex
+	cols, rows int
+	cells      [][]screenCell
+	row, col   int
+	wrapNext   bool   // the last column was written; the next character wraps
+	sgr        string // current style
+	top, bot   int    // scroll region, inclusive
+	savedRow   int
+	savedCol   int
+	main       [][]screenCell // the main screen while the alternate one shows
+	pending    []byte         // an unfinished escape sequence or character
+}
+
+func newScreen(cols, rows int) *screen {
+	s := &screen{cols: cols, rows: rows, bot: rows - 1}
+	s.cells = s.blank()
+	return s
+}
+
+func (s *screen) blank() [][]screenCell {
+	cells := make([][]screenCell, s.rows)
+	for i := range cells {
+		cells[i] = s.blankLine()
+	}
+	return cells
+}
+
+func (s *screen) blankLine() []screenCell {
+	line := make([]screenCell, s.cols)
+	for i := range line {
+		line[i] = screenCell{ch: ' '}
+	}
+	return line
+}
+
+// resize changes the screen's size, keeping what fits.
+func (s *screen) resize(cols, rows int) {
+	if cols <= 0 || rows <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fit := func(cells [][]screenCell) [][]screenCell {
+		// Keep the bottom rows, where the cursor usually is.
+		if drop := len(cells) - rows; drop > 0 {
+			cells = cells[drop:]
+		}
+		out := make([][]screenCell, rows)
+		for i := range out {
+			line := make([]screenCell, cols)
+			for j := range line {
+				line[j] = screenCell{ch: ' '}
+			}
+			if i < len(cells) {
+				copy(line, cells[i])
+			}
+			out[i] = line
+		}
+		return out
+	}
+	if drop := len(s.cells) - rows; drop > 0 {
+		s.row -= drop
+	}
+	s.cells = fit(s.cells)
+	if s.main != nil {
+		s.main = fit(s.main)
+	}
+	s.cols, s.rows = cols, rows
+	s.top, s.bot = 0, rows-1
+	s.row = min(max(s.row, 0), rows-1)
+	s.col = min(s.col, cols-1)
+	s.wrapNext = false
+}
+
+// feed interprets output written to the terminal.
+func (s *screen) feed(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) > 0 {
+		data = append(s.pending, data...)
+		s.pending = nil
+	}
+	for i := 0; i < len(data); {
+		n := s.step(data[i:])
+		if n == 0 {
+			// Incomplete; wait for more, unless it is too long to be real.
+			if len(data)-i < 256 {
+				s.pending = append([]byte(nil), data[i:]...)
+			}
+			return
+		}
+		i += n
+	}
+}
+
+// step interprets the control, escape sequence or character at the start
+// of data, returning how many bytes it took, or 0 if data ends first.
+func (s *screen) step(data []byte) int {
+	switch c := data[0]; {
+	case c == 0x1b:
+		return s.escape(data)
+	case c == '\r':
+		s.col, s.wrapNext = 0, false
+	case c == '\n', c == '\v', c == '\f':
+		s.lineFeed()
+	case c == '\b':
+		if s.col > 0 {
+			s.col--
+		}
+		s.wrapNext = false
+	case c == '\t':
+		s.col = min((s.col/8+1)*8, s.cols-1)
+	case c < 0x20 || c == 0x7f:
+		// Other controls, such as BEL, show nothing.
+	default:
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 && !utf8.FullRune(data) {
+			return 0
+		}
+		s.put(r)
+		return size
+	}
+	return 1
+}
+
+func (s *screen) put(r rune) {
+	if s.wrapNext {
+		s.col = 0
+		s.lineFeed()
+	}
+	s.cells[s.row][s.col] = screenCell{ch: r, sgr: s.sgr}
+	if s.col == s.cols-1 {
+		s.wrapNext = true
+	} else {
+		s.col++
+	}
+}
+
+func (s *screen) lineFeed() {
+	s.wrapNext = false
+	if s.row == s.bot {
+		s.scrollUp(1)
+	} else if s.row < s.rows-1 {
+		s.row++
+	}
+}
+
+// scrollUp moves the lines of the scroll region up n lines, blanking the
+// bottom ones; scrollDown moves them down.
+func (s *screen) scrollUp(n int) {
+	region := s.cells[s.top : s.bot+1]
+	n = min(n, len(region))
+	copy(region, region[n:])
+	for i := len(region) - n; i < len(region); i++ {
+		region[i] = s.blankLine()
+	}
+}
+
+func (s *screen) scrollDown(n int) {
+	region := s.cells[s.top : s.bot+1]
+	n = min(n, len(region))
+	copy(region[n:], region)
+	for i := 0; i < n; i++ {
+		region[i] = s.blankLine()
+	}
+}
+
+// escape interprets the escape sequence at the start of data.
+func (s *screen) escape(data []byte) int {
+	if len(data) < 2 {
+		return 0
+	}
+	switch data[1] {
+	case '[':
+		for i := 2; i < len(data); i++ {
+			if data[i] >= 0x40 && data[i] <= 0x7e {
+				s.csi(string(data[2:i]), data[i])
+				return i + 1
+			}
+		}
+		return 0
+	case ']', 'P', '_', '^': // OSC, DCS, APC, PM: skip to BEL or ST
+		for i := 2; i < len(data); i++ {
+			if data[i] == 0x07 {
+				return i + 1
+			}
+			if data[i] == 0x1b && i+1 < len(data) && data[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return 0
+	case '(', ')', '*', '+', '#', '%': // character sets and the like
+		if len(data) < 3 {
+			return 0
+		}
+		return 3
+	case '7':
+		s.savedRow, s.savedCol = s.row, s.col
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.col = 0
+		s.lineFeed()
+	case 'M':
+		if s.row == s.top {
+			s.scrollDown(1)
+		} else if s.row > 0 {
+			s.row--
+		}
+	case 'c':
+		s.cells, s.main = s.blank(), nil
+		s.row, s.col, s.wrapNext, s.sgr = 0, 0, false, ""
+		s.top, s.bot = 0, s.rows-1
+	}
+	return 2
+}
+
+// csi interprets a control sequence with parameters params and final
+// byte final.
+func (s *screen) csi(params string, final byte) {
+	if strings.HasPrefix(params, ">") || strings.HasPrefix(params, "=") {
+		return // terminal queries and keyboard modes
+	}
+	private := strings.HasPrefix(params, "?")
+	if private {
+		params = params[1:]
+	}
+	var args []int
+	for _, p := range strings.Split(params, ";") {
+		n, _ := strconv.Atoi(p)
+		args = append(args, n)
+	}
+	arg := func(i, def int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return def
+	}
+	if private {
+		if final == 'h' || final == 'l' {
+			for _, mode := range args {
+				if mode == 47 || mode == 1047 || mode == 1049 {
+					s.altScreen(final == 'h')
+				}
+			}
+		}
+		return
+	}
+
+	s.wrapNext = false
+	switch final {
+	case 'A':
+		s.row = max(s.row-arg(0, 1), 0)
+	case 'B', 'e':
+		s.row = min(s.row+arg(0, 1), s.rows-1)
+	case 'C', 'a':
+		s.col = min(s.col+arg(0, 1), s.cols-1)
+	case 'D':
+		s.col = max(s.col-arg(0, 1), 0)
+	case 'E':
+		s.row, s.col = min(s.row+arg(0, 1), s.rows-1), 0
+	case 'F':
+		s.row, s.col = max(s.row-arg(0, 1), 0), 0
+	case 'G', '`':
+		s.col = min(arg(0, 1), s.cols) - 1
+	case 'd':
+		s.row = min(arg(0, 1), s.rows) - 1
+	case 'H', 'f':
+		s.row, s.col = min(arg(0, 1), s.rows)-1, min(arg(1, 1), s.cols)-1
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			s.eraseLine(s.row, s.col, s.cols)
+			for r := s.row + 1; r < s.rows; r++ {
+				s.cells[r] = s.blankLine()
+			}
+		case 1:
+			for r := 0; r < s.row; r++ {
+				s.cells[r] = s.blankLine()
+			}
+			s.eraseLine(s.row, 0, s.col+1)
+		case 2, 3:
+			s.cells = s.blank()
+		}
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			s.eraseLine(s.row, s.col, s.cols)
+		case 1:
+			s.eraseLine(s.row, 0, s.col+1)
+		case 2:
+			s.eraseLine(s.row, 0, s.cols)
+		}
+	case 'X':
+		s.eraseLine(s.row, s.col, min(s.col+arg(0, 1), s.cols))
+	case 'P':
+		line := s.cells[s.row]
+		n := min(arg(0, 1), s.cols-s.col)
+		copy(line[s.col:], line[s.col+n:])
+		s.eraseLine(s.row, s.cols-n, s.cols)
+	case '@':
+		line := s.cells[s.row]
+		n := min(arg(0, 1), s.cols-s.col)
+		copy(line[s.col+n:], line[s.col:])
+		s.eraseLine(s.row, s.col, s.col+n)
+	case 'L', 'M':
+		if s.row < s.top || s.row > s.bot {
+			return
+		}
+		top := s.top
+		s.top = s.row
+		if final == 'L' {
+			s.scrollDown(arg(0, 1))
+		} else {
+			s.scrollUp(arg(0, 1))
+		}
+		s.top = top
+	case 'S':
+		s.scrollUp(arg(0, 1))
+	case 'T':
+		s.scrollDown(arg(0, 1))
+	case 'r':
+		top, bot := arg(0, 1)-1, min(arg(1, s.rows), s.rows)-1
+		if top < bot {
+			s.top, s.bot = top, bot
+			s.row, s.col = 0, 0
+		}
+	case 's':
+		s.savedRow, s.savedCol = s.row, s.col
+	case 'u':
+		s.restoreCursor()
+	case 'm':
+		s.setSGR(params)
+	}
+}
+
+// eraseLine blanks columns from to to (exclusive) of row r.
+func (s *screen) eraseLine(r, from, to int) {
+	line := s.cells[r]
+	for c := max(from, 0); c < to && c < len(line); c++ {
+		line[c] = screenCell{ch: ' '}
+	}
+}
+
+// setSGR updates the current style. Styles are kept as the parameters
+// that set them since the last reset, which is enough to render them
+// again.
+func (s *screen) setSGR(params string) {
+	ps := strings.Split(params, ";")
+	for i := 0; i < len(ps); i++ {
+		p := ps[i]
+		if p == "" || p == "0" {
+			s.sgr = ""
+			continue
+		}
+		// 38 and 48 take a 256-color index (5;n) or an RGB color (2;r;g;b).
+		if (p == "38" || p == "48" || p == "58") && i+1 < len(ps) {
+			n := 0
+			switch ps[i+1] {
+			case "5":
+				n = 2
+			case "2":
+				n = 4
+			}
+			n = min(n, len(ps)-1-i)
+			p = strings.Join(ps[i:i+1+n], ";")
+			i += n
+		}
+		if s.sgr == "" {
+			s.sgr = p
+		} else {
+			s.sgr += ";" + p
+		}
+	}
+}
+
+func (s *screen) altScreen(on bool) {
+	switch {
+	case on && s.main == nil:
+		s.main = s.cells
+		s.cells = s.blank()
+		s.savedRow, s.savedCol = s.row, s.col
+	case !on && s.main != nil:
+		s.cells, s.main = s.main, nil
+		s.restoreCursor()
+	}
+	s.wrapNext = false
+}
+
+// restoreCursor moves the cursor where it was saved, within the screen.
+func (s *screen) restoreCursor() {
+	s.row, s.col = min(s.savedRow, s.rows-1), min(s.savedCol, s.cols-1)
+	s.wrapNext = false
+}
+
+// snapshot renders the screen. Trailing blanks are trimmed from each line,
+// and blank lines from the end. With ansi, lines carry SGR sequences for
+// their styles, ending with a reset. Lines are redacted by redact; a line
+// whose text it changes is rendered without styles.
+func (s *screen) snapshot(ansi bool, redact *redactor) protocol.Screen {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scr := protocol.Screen{
+		Cols:      s.cols,
+		Rows:      s.rows,
+		CursorRow: s.row,
+		CursorCol: s.col,
+		Alternate: s.main != nil,
+	}
+	for _, line := range s.cells {
+		end := len(line)
+		for end > 0 && line[end-1].ch == ' ' && line[end-1].sgr == "" {
+			end--
+		}
+		var plain strings.Builder
+		for _, c := range line[:end] {
+			plain.WriteRune(c.ch)
+		}
+		text := strings.TrimRight(plain.String(), " ")
+		if masked := redact.redactString(text); masked != text || !ansi {
+			scr.Lines = append(scr.Lines, masked)
+			continue
+		}
+		var b strings.Builder
+		sgr := ""
+		for _, c := range line[:end] {
+			if c.sgr != sgr {
+				if c.sgr == "" {
+					b.WriteString("\x1b[0m")
+				} else {
+					fmt.Fprintf(&b, "\x1b[0;%sm", c.sgr)
+				}
+				sgr = c.sgr
+			}
+			b.WriteRune(c.ch)
+		}
+		if sgr != "" {
+			b.WriteString("\x1b[0m")
+		}
+		scr.Lines = append(scr.Lines, b.String())
+	}
+	for len(scr.Lines) > 0 && scr.Lines[len(scr.Lines)-1] == "" {
+		scr.Lines = scr.Lines[:len(scr.Lines)-1]
+	}
+	return scr
+}
@@ -0,0 +1,103 @@
+package session
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestScreenFeed(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"lines", "one\r\ntwo\r\n", []string{"one", "two"}},
+		{"carriage return overwrites", "hello\rJ", []string{"Jello"}},
+		{"wrap", "abcdefghijkl", []string{"abcdefghij", "kl"}},
+		{"cursor position", "\x1b[2;3Hx\x1b[1;1Hy", []string{"y", "  x"}},
+		{"erase line", "hello\x1b[3D\x1b[K", []string{"he"}},
+		{"erase display", "one\r\ntwo\x1b[2J\x1b[Hthree", []string{"three"}},
+		{"backspace", "ab\bc", []string{"ac"}},
+		{"scroll", "1\r\n2\r\n3\r\n4\r\n5", []string{"2", "3", "4", "5"}},
+		{"split escape", "a\x1b[", []string{"a"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newScreen(10, 4)
+			s.feed([]byte(tc.input))
+			if got := s.snapshot(false, nil).Lines; !slices.Equal(got, tc.want) {
+				t.Errorf("lines = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScreenSplitSequence(t *testing.T) {
+	s := newScreen(10, 4)
+	s.feed([]byte("ab\x1b["))
+	s.feed([]byte("1Dc"))
+	if got := s.snapshot(false, nil).Lines; !slices.Equal(got, []string{"ac"}) {
+		t.Errorf("lines = %q, want [ac]", got)
+	}
+}
+
+func TestScreenAlternate(t *testing.T) {
+	s := newScreen(10, 4)
+	s.feed([]byte("shell $ "))
+	s.feed([]byte("\x1b[?1049h\x1b[Heditor"))
+	scr := s.snapshot(false, nil)
+	if !scr.Alternate || !slices.Equal(scr.Lines, []string{"editor"}) {
+		t.Errorf("alternate screen = %v %q, want true [editor]", scr.Alternate, scr.Lines)
+	}
+	s.feed([]byte("\x1b[?1049l"))
+	scr = s.snapshot(false, nil)
+	if scr.Alternate || !slices.Equal(scr.Lines, []string{"shell $"}) {
+		t.Errorf("main screen = %v %q, want false [shell $]", scr.Alternate, scr.Lines)
+	}
+	if scr.CursorRow != 0 || scr.CursorCol != 8 {
+		t.Errorf("cursor = %d,%d, want 0,8", scr.CursorRow, scr.CursorCol)
+	}
+}
+
+func TestScreenANSI(t *testing.T) {
+	s := newScreen(20, 4)
+	s.feed([]byte("\x1b[1;31mred\x1b[0m plain"))
+	if got, want := s.snapshot(true, nil).Lines, []string{"\x1b[0;1;31mred\x1b[0m plain"}; !slices.Equal(got, want) {
+		t.Errorf("ansi lines = %q, want %q", got, want)
+	}
+	if got, want := s.snapshot(false, nil).Lines, []string{"red plain"}; !slices.Equal(got, want) {
+		t.Errorf("plain lines = %q, want %q", got, want)
+	}
+}
+
+func TestScreenRedact(t *testing.T) {
+	r, err := newRedactor(nil, []string{"hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newScreen(30, 4)
+	s.feed([]byte("pass: \x1b[1mhunter2\x1b[0m\r\nok"))
+	if got, want := s.snapshot(true, r).Lines, []string{"pass: [REDACTED]", "ok"}; !slices.Equal(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestScreenResize(t *testing.T) {
+	s := newScreen(10, 4)
+	s.feed([]byte("abcdefgh\r\n1\r\n2\r\n3"))
+	s.resize(4, 2)
+	scr := s.snapshot(false, nil)
+	if scr.Cols != 4 || scr.Rows != 2 {
+		t.Errorf("size = %dx%d, want 4x2", scr.Cols, scr.Rows)
+	}
+	if !slices.Equal(scr.Lines, []string{"2", "3"}) {
+		t.Errorf("lines = %q, want the bottom rows [2 3]", scr.Lines)
+	}
+	if scr.CursorRow != 1 || scr.CursorCol != 1 {
+		t.Errorf("cursor = %d,%d, want 1,1", scr.CursorRow, scr.CursorCol)
+	}
+	s.feed([]byte("\x1b[Habcdef"))
+	if got, want := s.snapshot(false, nil).Lines, []string{"abcd", "ef"}; !slices.Equal(got, want) {
+		t.Errorf("lines after resize = %q, want %q", got, want)
+	}
+}
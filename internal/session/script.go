@@ -0,0 +1,135 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// DefaultScriptTimeout is how long a script step waits for its Expect
+// pattern unless it sets its own timeout.
+const DefaultScriptTimeout = 30 * time.Second
+
+// scriptWindow caps the output a script step matches against: the end of
+// what arrived since the previous step's match.
+const scriptWindow = 64 << 10
+
+// RunScript runs steps against session id, sending input as session
+// fromID (0 for none; see CheckInput). Each step waits for the session's
+// output to match its Expect pattern, then sends its Send data. Output is
+// matched with ANSI codes stripped and across lines, so an unfinished line
+// such as a prompt matches. A step sees the output after the previous
+// step's match; the first one also sees the session's current line, so a
+// prompt already shown matches it.
+//
+// An invalid script is an error. A step that times out, or is still
+// waiting when the session exits or ctx is done, ends the script with the
+// result's Error set.
+func (m *SessionManager) RunScript(ctx context.Context, fromID, id uint32, steps []protocol.ScriptStep) (protocol.ScriptResult, error) {
+	m.mu.RLock()
+	sess, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return protocol.ScriptResult{}, fmt.Errorf("session %d not found", id)
+	}
+	patterns := make([]*regexp.Regexp, len(steps))
+	for i, step := range steps {
+		if step.Expect == "" {
+			continue
+		}
+		re, err := regexp.Compile(step.Expect)
+		if err != nil {
+			return protocol.ScriptResult{}, fmt.Errorf("step %d: invalid pattern %q: %w", i+1, step.Expect, err)
+		}
+		patterns[i] = re
+	}
+	if err := m.CheckInput(fromID, id); err != nil {
+		return protocol.ScriptResult{}, err
+	}
+
+	// Subscribe before reading the current line, so no output is missed.
+	subID, out := sess.broadcaster.Subscribe(OutputBufferBytes)
+	defer sess.broadcaster.Unsubscribe(subID)
+	var tail []byte
+	if line, _, ok := outputTail(sess, 1); ok {
+		tail = append(tail, line...)
+	}
+
+	result := protocol.ScriptResult{Matches: []string{}}
+	for i, step := range steps {
+		match := ""
+		if patterns[i] != nil {
+			timeout := DefaultScriptTimeout
+			if step.TimeoutMs > 0 {
+				timeout = time.Duration(step.TimeoutMs) * time.Millisecond
+			}
+			var err error
+			if match, err = scriptMatch(ctx, sess, out, patterns[i], &tail, timeout); err != nil {
+				result.Error = fmt.Sprintf("step %d: %v", i+1, err)
+				result.Output = sess.redact.redactString(StripANSI(string(tail)))
+				return result, nil
+			}
+		}
+		if step.Send != "" {
+			if _, err := m.SendInput(id, []byte(step.Send)); err != nil {
+				result.Error = fmt.Sprintf("step %d: %v", i+1, err)
+				return result, nil
+			}
+		}
+		result.Matches = append(result.Matches, sess.redact.redactString(match))
+		result.Steps++
+	}
+	return result, nil
+}
+
+// scriptMatch waits up to timeout for the output in tail, and the output
+// that follows from out, to match re. It returns the match and leaves
+// what followed it in tail.
+func scriptMatch(ctx context.Context, sess *Session, out *OutputListener, re *regexp.Regexp, tail *[]byte, timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	read := func() {
+		for {
+			o, ok := out.Next()
+			if !ok {
+				break
+			}
+			*tail = append(*tail, o.Data...)
+		}
+		if over := len(*tail) - scriptWindow; over > 0 {
+			*tail = append((*tail)[:0], (*tail)[over:]...)
+		}
+	}
+	match := func() (string, bool) {
+		text := StripANSI(string(*tail))
+		loc := re.FindStringIndex(text)
+		if loc == nil {
+			return "", false
+		}
+		*tail = append((*tail)[:0], text[loc[1]:]...)
+		return text[loc[0]:loc[1]], true
+	}
+
+	for {
+		if m, ok := match(); ok {
+			return m, nil
+		}
+		select {
+		case <-out.Ready():
+			read()
+		case <-sess.exited:
+			read()
+			if m, ok := match(); ok {
+				return m, nil
+			}
+			return "", fmt.Errorf("session exited before its output matched %q", re)
+		case <-timer.C:
+			return "", fmt.Errorf("no output matched %q within %s", re, timeout)
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
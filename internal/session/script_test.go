@@ -0,0 +1,46 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestRunScript(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	id, err := sm.LaunchWith(LaunchOptions{
+		Command:    []string{"sh", "-c", `printf 'Username: '; read u; printf 'Password: '; read p; echo "welcome $u"; sleep 30`},
+		WorkingDir: dir,
+	})
+	if err != nil {
+		t.Fatalf("LaunchWith: %v", err)
+	}
+	t.Cleanup(func() { _ = sm.Kill(id) })
+
+	result, err := sm.RunScript(context.Background(), 0, id, []protocol.ScriptStep{
+		{Expect: `Username: $`, Send: "admin\r"},
+		{Expect: `Password: $`, Send: "hunter2\r"},
+		{Expect: `welcome \w+`},
+		{Expect: `never printed`, TimeoutMs: 200},
+		{Send: "not sent\r"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Steps != 3 || len(result.Matches) != 3 || result.Matches[2] != "welcome admin" {
+		t.Errorf("result = %+v", result)
+	}
+	if !strings.HasPrefix(result.Error, "step 4: no output matched") {
+		t.Errorf("error = %q", result.Error)
+	}
+
+	if _, err := sm.RunScript(context.Background(), 0, id, []protocol.ScriptStep{{Expect: "("}}); err == nil {
+		t.Error("ran a script with an invalid pattern")
+	}
+}
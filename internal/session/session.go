@@ -7,7 +7,6 @@ import (
 	"io"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -17,65 +16,150 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/creack/pty"
-
+	"github.com/codewiresh/codewire/internal/agent"
 	"github.com/codewiresh/codewire/internal/protocol"
 )
 
 // namePattern validates session names: alphanumeric + hyphens, 1-32 chars.
 var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]{0,31}$`)
 
+// ValidName reports whether name is a valid session name.
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
 // ---------------------------------------------------------------------------
 // Broadcaster — replaces tokio::sync::broadcast
 // ---------------------------------------------------------------------------
 
-// Broadcaster fans out byte slices to multiple subscribers. Slow consumers
-// are dropped (non-blocking send) to avoid back-pressure on the PTY reader.
+// PTY output is read into slabs of ptySlabSize bytes, each read getting at
+// least ptyReadMin of them.
+const (
+	ptySlabSize = 64 << 10
+	ptyReadMin  = 4 << 10
+)
+
+// DefaultOutputDelay is SessionManager.OutputDelay unless configured: long
+// enough to gather a burst of output into one frame, too short to notice.
+const DefaultOutputDelay = 5 * time.Millisecond
+
+// OutputBufferBytes is how much output a Broadcaster holds for a subscriber
+// that is slower than the session, such as a watch over a slow relay link.
+const OutputBufferBytes = 4 << 20
+
+// outputChunkBytes caps how much queued output is coalesced into one chunk.
+const outputChunkBytes = 32 << 10
+
+// Output is a chunk of a session's output read from an OutputListener.
+// Dropped counts the bytes lost before Data because the listener fell too far
+// behind; a chunk may carry only that count.
+type Output struct {
+	Data    []byte
+	Dropped uint64
+}
+
+// OutputListener is a Broadcaster subscription. Output queues up, coalesced
+// into chunks, until the listener's buffer is full; anything sent while it is
+// full is dropped and reported with the next chunk after it.
+type OutputListener struct {
+	ready chan struct{}
+
+	mu      sync.Mutex
+	queue   []Output
+	queued  int
+	max     int
+	dropped uint64 // since the last queued chunk
+}
+
+// Ready is signalled when output may be waiting; read it with Next until
+// that returns false.
+func (l *OutputListener) Ready() <-chan struct{} {
+	return l.ready
+}
+
+// Next returns the oldest queued chunk, or false if there is none.
+func (l *OutputListener) Next() (Output, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) == 0 {
+		if l.dropped == 0 {
+			return Output{}, false
+		}
+		out := Output{Dropped: l.dropped}
+		l.dropped = 0
+		return out, true
+	}
+	out := l.queue[0]
+	l.queue[0] = Output{}
+	l.queue = l.queue[1:]
+	l.queued -= len(out.Data)
+	return out, true
+}
+
+func (l *OutputListener) send(data []byte) {
+	l.mu.Lock()
+	switch {
+	case l.queued+len(data) > l.max:
+		l.dropped += uint64(len(data))
+	case l.dropped == 0 && len(l.queue) > 0 && len(l.queue[len(l.queue)-1].Data)+len(data) <= outputChunkBytes:
+		last := &l.queue[len(l.queue)-1]
+		last.Data = append(last.Data, data...)
+		l.queued += len(data)
+	default:
+		// The chunk shares data until more is appended to it.
+		l.queue = append(l.queue, Output{Data: data[:len(data):len(data)], Dropped: l.dropped})
+		l.queued += len(data)
+		l.dropped = 0
+	}
+	l.mu.Unlock()
+	select {
+	case l.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Broadcaster fans out byte slices to multiple subscribers. Send never
+// blocks the PTY reader: each subscriber buffers what it has not read yet,
+// and loses output only once that buffer is full.
 type Broadcaster struct {
 	mu        sync.RWMutex
-	listeners map[uint64]chan []byte
+	listeners map[uint64]*OutputListener
 	nextID    uint64
 }
 
 // NewBroadcaster creates a ready-to-use Broadcaster.
 func NewBroadcaster() *Broadcaster {
 	return &Broadcaster{
-		listeners: make(map[uint64]chan []byte),
+		listeners: make(map[uint64]*OutputListener),
 	}
 }
 
-// Subscribe registers a new listener. Returns (id, channel). bufSize controls
-// the channel buffer depth.
-func (b *Broadcaster) Subscribe(bufSize int) (uint64, <-chan []byte) {
+// Subscribe registers a new listener holding up to maxBytes of unread output.
+// Returns (id, listener).
+func (b *Broadcaster) Subscribe(maxBytes int) (uint64, *OutputListener) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	id := b.nextID
 	b.nextID++
-	ch := make(chan []byte, bufSize)
-	b.listeners[id] = ch
-	return id, ch
+	l := &OutputListener{ready: make(chan struct{}, 1), max: maxBytes}
+	b.listeners[id] = l
+	return id, l
 }
 
-// Unsubscribe removes and closes a listener by ID.
+// Unsubscribe removes a listener by ID.
 func (b *Broadcaster) Unsubscribe(id uint64) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	if ch, ok := b.listeners[id]; ok {
-		close(ch)
-		delete(b.listeners, id)
-	}
+	delete(b.listeners, id)
 }
 
-// Send broadcasts data to every listener. Non-blocking: if a listener's
-// channel is full the message is silently dropped for that consumer.
+// Send broadcasts data to every listener without blocking. Listeners keep
+// data rather than copying it, so it must not be modified afterwards.
 func (b *Broadcaster) Send(data []byte) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
-	for _, ch := range b.listeners {
-		select {
-		case ch <- data:
-		default: // drop for slow consumers
-		}
+	for _, l := range b.listeners {
+		l.send(data)
 	}
 }
 
@@ -128,7 +212,7 @@ func (w *StatusWatcher) Changed() <-chan struct{} {
 
 // SessionStatus represents the lifecycle state of a session.
 type SessionStatus struct {
-	State    string // "running", "completed", "killed"
+	State    string // "queued", "running", "completed", "killed"
 	ExitCode int    // only meaningful when State == "completed"
 }
 
@@ -139,11 +223,16 @@ func (s SessionStatus) String() string {
 		return fmt.Sprintf("completed (%d)", s.ExitCode)
 	case "killed":
 		return "killed"
+	case "queued":
+		return "queued"
 	default:
 		return "running"
 	}
 }
 
+// StatusQueued returns the status of a session waiting for a free slot.
+func StatusQueued() SessionStatus { return SessionStatus{State: "queued"} }
+
 // StatusRunning returns the running status.
 func StatusRunning() SessionStatus { return SessionStatus{State: "running"} }
 
@@ -162,17 +251,40 @@ func StatusKilled() SessionStatus { return SessionStatus{State: "killed"} }
 // SessionMeta holds the serialisable metadata for a session. It is written to
 // dataDir/sessions.json so that session IDs survive restarts.
 type SessionMeta struct {
-	ID          uint32     `json:"id"`
-	Name        string     `json:"name,omitempty"`
-	Prompt      string     `json:"prompt"`
-	WorkingDir  string     `json:"working_dir"`
-	CreatedAt   time.Time  `json:"created_at"`
-	Status      string     `json:"status"`
-	PID         *uint32    `json:"pid,omitempty"`
-	Tags        []string   `json:"tags,omitempty"`
-	ExitCode    *int       `json:"exit_code,omitempty"`
-	CompletedAt *time.Time `json:"completed_at,omitempty"`
-	Result      *string    `json:"result,omitempty"`
+	ID           uint32            `json:"id"`
+	Name         string            `json:"name,omitempty"`
+	Prompt       string            `json:"prompt"`
+	WorkingDir   string            `json:"working_dir"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Status       string            `json:"status"`
+	PID          *uint32           `json:"pid,omitempty"`
+	PIDStart     string            `json:"pid_start,omitempty"` // from processStart, to tell a recycled PID apart
+	Tags         []string          `json:"tags,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Pool         string            `json:"pool,omitempty"`
+	Worktree     string            `json:"worktree,omitempty"`
+	Backend      string            `json:"backend,omitempty"`       // empty for LocalBackend
+	BackendState map[string]string `json:"backend_state,omitempty"` // from SessionBackend.Prepare
+	Adopted      bool              `json:"adopted,omitempty"`       // running process taken over after a node restart
+	ExitCode     *int              `json:"exit_code,omitempty"`
+	ExitReason   string            `json:"exit_reason,omitempty"` // from SessionFinisher
+	CompletedAt  *time.Time        `json:"completed_at,omitempty"`
+	Result       *string           `json:"result,omitempty"`
+
+	Budget      *protocol.Budget           `json:"budget,omitempty"`
+	BudgetUsed  *BudgetUsed                `json:"budget_used,omitempty"` // charged by ChargeBudget
+	Usage       *protocol.Usage            `json:"usage,omitempty"`       // what the session's agent reported using
+	AutoRespond []protocol.AutoRespondRule `json:"auto_respond,omitempty"`
+	Alerts      []string                   `json:"alerts,omitempty"`       // patterns given at launch, besides the node's
+	AlertNotify string                     `json:"alert_notify,omitempty"` // notify method given at launch
+	Redact      []string                   `json:"redact,omitempty"`       // patterns given at launch, besides the node's
+	History     int                        `json:"history,omitempty"`      // entry number in history.jsonl
+	// AcceptInputFrom is the session's input policy (see checkInput).
+	AcceptInputFrom []string `json:"accept_input_from,omitempty"`
+	// AgentSessionID and TranscriptPath identify the Claude Code session
+	// the session runs (see SetAgentSession).
+	AgentSessionID string `json:"agent_session_id,omitempty"`
+	TranscriptPath string `json:"transcript_path,omitempty"`
 }
 
 // ---------------------------------------------------------------------------
@@ -182,20 +294,39 @@ type SessionMeta struct {
 // Session represents a live PTY session with its communication channels.
 type Session struct {
 	Meta          SessionMeta
-	master        *os.File // PTY master fd (from creack/pty)
+	master        terminal // PTY master (see startPTY)
 	attachedCount atomic.Int32
 	broadcaster   *Broadcaster
 	inputCh       chan []byte // buffered channel for PTY input writes
 	statusWatcher *StatusWatcher
 	logPath       string
-	mu            sync.Mutex // protects Meta.Status updates
+	startedAt     time.Time     // when the process started (after any queueing)
+	exited        chan struct{} // closed once the process has exited
+	mu            sync.Mutex    // protects Meta.Status updates
+	killPending   bool          // killed, but the process has not exited yet (guarded by mu)
 
 	// Enriched tracking (new).
 	outputBytes  atomic.Uint64
+	inputBytes   atomic.Uint64
 	outputLines  atomic.Uint64
 	lastOutputAt atomic.Int64 // unix nano
 	eventLog     *EventLog
 	messageLog   *EventLog // JSONL at sessions/{id}/messages.jsonl
+
+	autoRespond *autoResponder  // nil without auto-respond rules
+	alerts      *alertWatcher   // nil without alert patterns
+	usage       *usageWatcher   // nil unless an extractor reads the command
+	agent       *agentWatcher   // nil unless the command's adapter has output patterns
+	screen      *screen         // what the terminal shows
+	costHandled map[string]bool // cost limits acted on, by CostData.Budget (guarded by mu)
+	redact      *redactor       // nil without redaction
+	logOut      *RedactStream   // writes output to the log; set by pump
+	summary     summaryState
+
+	launchOpts LaunchOptions // as given to LaunchWith, for Fork
+	input      inputHistory  // for Fork
+
+	recent atomic.Pointer[outputRing] // the end of the log, for OutputTail; set by pump
 }
 
 // ---------------------------------------------------------------------------
@@ -204,7 +335,7 @@ type Session struct {
 
 // AttachChannels groups the channels returned by SessionManager.Attach.
 type AttachChannels struct {
-	OutputCh <-chan []byte
+	Output   *OutputListener
 	OutputID uint64 // for Broadcaster.Unsubscribe
 	InputCh  chan<- []byte
 	Status   *StatusWatcher
@@ -224,8 +355,74 @@ type SessionManager struct {
 	PersistCh     chan struct{} // exported: the node package drains this to trigger writes
 	Subscriptions *SubscriptionManager
 
+	// DefaultBudget applies to sessions launched without an explicit budget.
+	DefaultBudget *protocol.Budget
+	// MaxConcurrent caps running sessions; further launches are queued.
+	// Zero is unlimited.
+	MaxConcurrent int
+	// Summaries configures session.output_summary events.
+	Summaries Summarizer
+	// AlertPatterns apply to every session, besides the ones it is
+	// launched with. AlertNotify is the notify method for sessions launched
+	// without one.
+	AlertPatterns []string
+	AlertNotify   string
+	// UsageExtractors read agent usage from session output, taking
+	// precedence over the built-in ones. CostTagLimits caps the cost, in
+	// US dollars, of the sessions with each tag together; CostAction is
+	// what happens to a session over that or its budget's Cost: CostKill
+	// (default) or CostEscalate.
+	UsageExtractors []UsageExtractor
+	CostTagLimits   map[string]float64
+	CostAction      string
+	// Agents adapt session activity to agent CLIs, taking precedence over
+	// agent.Builtin.
+	Agents []agent.Adapter
+	// RedactPatterns are masked in every session's logged output, as are
+	// the values of the RedactEnv variables (see newRedactor).
+	RedactPatterns []string
+	RedactEnv      []string
+	// NodeName is the node's name, sent with the events it streams.
+	NodeName string
+	// MessageLimits caps what each sender may send with SendMessage and
+	// SendRequest.
+	MessageLimits MessageLimits
+	// HistoryBytes and HistoryLines size the in-memory copy of each
+	// session's latest logged output that history is served from (see
+	// OutputTail): zero HistoryBytes keeps none, zero HistoryLines counts
+	// only bytes. NewSessionManager sets HistoryBytes to HistoryBufferBytes.
+	HistoryBytes int
+	HistoryLines int
+	// OutputDelay is how long output gathers before it is framed for
+	// attached clients and watchers. NewSessionManager sets it to
+	// DefaultOutputDelay.
+	OutputDelay time.Duration
+	// ArchiveDir is where Archive keeps session archives; empty is
+	// "archive" in the data directory. ArchiveStore, if set, gets a copy of
+	// each, and serves restores of the ones no longer in ArchiveDir.
+	ArchiveDir   string
+	ArchiveStore ArchiveStore
+
+	active     int             // sessions holding a slot (guarded by mu)
+	queue      []*queuedLaunch // sessions waiting for a slot, FIFO (guarded by mu)
+	poolActive map[string]int  // running sessions per pool (guarded by mu)
+	poolSize   map[string]int  // pool limits, as set by the latest launch (guarded by mu)
+
+	previous  []SessionMeta // sessions.json as left by the previous node, for RecoverOrphans
+	launchErr error         // set by StopLaunches (guarded by mu)
+
+	msgBucketsMu sync.Mutex
+	msgBuckets   map[uint32]*msgBucket // by sender, for MessageLimits
+
 	pendingRequestsMu sync.Mutex
-	pendingRequests   map[string]chan ReplyData // requestID → reply channel
+	pendingRequests   map[string]pendingRequest // by request ID
+
+	backends    map[string]SessionBackend // by name (guarded by mu)
+	git         gitCache                  // git state of working directories, for SessionInfo
+	resources   resourceSampler           // CPU and memory of session processes, for GetStatus
+	worktreesMu sync.Mutex                // guards worktrees.json and worktree changes
+	pipes       pipeSet                   // output forwarded between sessions
+	history     historyLog                // history.jsonl
 }
 
 // NewSessionManager creates a SessionManager rooted at dataDir. It reads
@@ -237,6 +434,7 @@ func NewSessionManager(dataDir string) (*SessionManager, error) {
 	}
 
 	var startID uint32 = 1
+	var previous []SessionMeta
 
 	metaPath := filepath.Join(dataDir, "sessions.json")
 	data, err := os.ReadFile(metaPath)
@@ -260,6 +458,7 @@ func NewSessionManager(dataDir string) (*SessionManager, error) {
 				}
 			}
 			startID = maxID + 1
+			previous = metas
 		}
 	}
 	// If the file does not exist we silently start from ID 1.
@@ -270,7 +469,18 @@ func NewSessionManager(dataDir string) (*SessionManager, error) {
 		dataDir:         dataDir,
 		PersistCh:       make(chan struct{}, 1),
 		Subscriptions:   NewSubscriptionManager(),
-		pendingRequests: make(map[string]chan ReplyData),
+		HistoryBytes:    HistoryBufferBytes,
+		OutputDelay:     DefaultOutputDelay,
+		pendingRequests: make(map[string]pendingRequest),
+		poolActive:      make(map[string]int),
+		poolSize:        make(map[string]int),
+		previous:        previous,
+		backends: map[string]SessionBackend{
+			LocalBackend: localBackend{},
+			"docker":     DockerBackend{},
+			"kubernetes": KubernetesBackend{},
+			"ssh":        SSHBackend{},
+		},
 	}
 	sm.nextID.Store(startID)
 	return sm, nil
@@ -305,6 +515,7 @@ func (m *SessionManager) SetName(id uint32, name string) error {
 		delete(m.nameIndex, oldName)
 	}
 	m.nameIndex[name] = id
+	m.triggerPersist()
 
 	return nil
 }
@@ -368,6 +579,12 @@ func (m *SessionManager) SendMessage(fromID, toID uint32, body string) (string,
 	if !toOK {
 		return "", fmt.Errorf("recipient session %d not found", toID)
 	}
+	if err := m.checkInput(fromID, toSess); err != nil {
+		return "", err
+	}
+	if err := m.admitMessage("message", fromID, toSess, body); err != nil {
+		return "", err
+	}
 
 	msgID := fmt.Sprintf("msg_%d_%d_%d", fromID, toID, time.Now().UnixNano())
 
@@ -401,10 +618,10 @@ func (m *SessionManager) SendMessage(fromID, toID uint32, body string) (string,
 	}
 
 	// Publish to subscriptions (on the recipient's session ID).
-	m.Subscriptions.Publish(toID, toSess.Meta.Tags, event)
+	m.Subscriptions.Publish(toID, toSess.Meta.Tags, toSess.Meta.Labels, event)
 	// Also publish on sender so listen can see sent messages.
 	if fromOK && fromID != toID {
-		m.Subscriptions.Publish(fromID, fromSess.Meta.Tags, event)
+		m.Subscriptions.Publish(fromID, fromSess.Meta.Tags, fromSess.Meta.Labels, event)
 	}
 
 	return msgID, nil
@@ -425,6 +642,13 @@ func (m *SessionManager) ReadMessages(sessionID uint32, tail int) ([]Event, erro
 	return sess.messageLog.ReadTail(tail)
 }
 
+// pendingRequest is a request awaiting its reply, from session from (0 for
+// a caller that is not a session).
+type pendingRequest struct {
+	from  uint32
+	reply chan ReplyData
+}
+
 // SendRequest sends a request from one session to another and returns a channel
 // that will receive the reply. The caller should block on the channel with a timeout.
 func (m *SessionManager) SendRequest(fromID, toID uint32, body string) (string, <-chan ReplyData, error) {
@@ -440,6 +664,12 @@ func (m *SessionManager) SendRequest(fromID, toID uint32, body string) (string,
 	if !toOK {
 		return "", nil, fmt.Errorf("recipient session %d not found", toID)
 	}
+	if err := m.checkInput(fromID, toSess); err != nil {
+		return "", nil, err
+	}
+	if err := m.admitMessage("request", fromID, toSess, body); err != nil {
+		return "", nil, err
+	}
 
 	requestID := fmt.Sprintf("req_%d_%d_%d", fromID, toID, time.Now().UnixNano())
 
@@ -468,19 +698,19 @@ func (m *SessionManager) SendRequest(fromID, toID uint32, body string) (string,
 	if toSess.messageLog != nil {
 		toSess.messageLog.Append(event)
 	}
-	m.Subscriptions.Publish(toID, toSess.Meta.Tags, event)
+	m.Subscriptions.Publish(toID, toSess.Meta.Tags, toSess.Meta.Labels, event)
 	// Also publish on sender (only if sender is a real session).
 	if fromOK && fromID != toID {
 		if fromSess.messageLog != nil {
 			fromSess.messageLog.Append(event)
 		}
-		m.Subscriptions.Publish(fromID, fromSess.Meta.Tags, event)
+		m.Subscriptions.Publish(fromID, fromSess.Meta.Tags, fromSess.Meta.Labels, event)
 	}
 
 	// Register reply channel.
 	replyCh := make(chan ReplyData, 1)
 	m.pendingRequestsMu.Lock()
-	m.pendingRequests[requestID] = replyCh
+	m.pendingRequests[requestID] = pendingRequest{from: fromID, reply: replyCh}
 	m.pendingRequestsMu.Unlock()
 
 	return requestID, replyCh, nil
@@ -490,7 +720,7 @@ func (m *SessionManager) SendRequest(fromID, toID uint32, body string) (string,
 // sends the reply, and records the reply event in both sessions' message logs.
 func (m *SessionManager) SendReply(fromID uint32, requestID string, body string) error {
 	m.pendingRequestsMu.Lock()
-	replyCh, ok := m.pendingRequests[requestID]
+	pending, ok := m.pendingRequests[requestID]
 	if ok {
 		delete(m.pendingRequests, requestID)
 	}
@@ -502,6 +732,7 @@ func (m *SessionManager) SendReply(fromID uint32, requestID string, body string)
 
 	m.mu.RLock()
 	fromSess, fromOK := m.sessions[fromID]
+	reqSess, reqOK := m.sessions[pending.from]
 	m.mu.RUnlock()
 
 	var fromName string
@@ -519,15 +750,17 @@ func (m *SessionManager) SendReply(fromID uint32, requestID string, body string)
 	}
 	event := NewReplyEvent(replyData)
 
-	// Write to sender's message log.
 	if fromOK && fromSess.messageLog != nil {
 		fromSess.messageLog.Append(event)
 	}
-	m.Subscriptions.Publish(fromID, nil, event)
+	if reqOK && pending.from != fromID && reqSess.messageLog != nil {
+		reqSess.messageLog.Append(event)
+	}
+	m.Subscriptions.Publish(fromID, nil, nil, event)
 
 	// Send to the reply channel (non-blocking in case caller timed out).
 	select {
-	case replyCh <- replyData:
+	case pending.reply <- replyData:
 	default:
 	}
 
@@ -560,18 +793,18 @@ func FormatRequestPrompt(requestID string, fromName string, fromID uint32, body
 }
 
 // DeliverDirectMessagePrompt injects a formatted direct-message prompt into a
-// session's PTY via SendInput.
+// session's PTY via SendInputFrom.
 func (m *SessionManager) DeliverDirectMessagePrompt(toID uint32, fromName string, fromID uint32, body string) error {
 	prompt := FormatDirectMessagePrompt(fromName, fromID, body)
-	_, err := m.SendInput(toID, []byte(prompt))
+	_, err := m.SendInputFrom(fromID, toID, []byte(prompt))
 	return err
 }
 
 // DeliverRequestPrompt injects a formatted request prompt into a session's PTY
-// via SendInput.
+// via SendInputFrom.
 func (m *SessionManager) DeliverRequestPrompt(toID uint32, requestID string, fromName string, fromID uint32, body string) error {
 	prompt := FormatRequestPrompt(requestID, fromName, fromID, body)
-	_, err := m.SendInput(toID, []byte(prompt))
+	_, err := m.SendInputFrom(fromID, toID, []byte(prompt))
 	return err
 }
 
@@ -585,23 +818,177 @@ func (m *SessionManager) triggerPersist() {
 
 // Launch starts a new PTY session executing command in workingDir.
 // name is the session name (used for env injection; naming is done by the caller).
-// tags are optional labels for filtering/grouping.
+// tags are optional labels for filtering/grouping. When MaxConcurrent sessions
+// are already running the session is queued and starts once a slot frees up.
 func (m *SessionManager) Launch(command []string, workingDir string, env []string, stdinData []byte, name string, tags ...string) (uint32, error) {
+	return m.LaunchWith(LaunchOptions{Command: command, WorkingDir: workingDir, Env: env, StdinData: stdinData, Name: name, Tags: tags})
+}
+
+// LaunchNoQueue is like Launch but fails with ErrAtCapacity instead of
+// queueing the session.
+func (m *SessionManager) LaunchNoQueue(command []string, workingDir string, env []string, stdinData []byte, name string, tags ...string) (uint32, error) {
+	return m.LaunchWith(LaunchOptions{Command: command, WorkingDir: workingDir, Env: env, StdinData: stdinData, Name: name, Tags: tags, NoQueue: true})
+}
+
+// LaunchOptions describes a session for LaunchWith.
+type LaunchOptions struct {
+	Command    []string
+	WorkingDir string
+	Env        []string
+	StdinData  []byte
+	Tags       []string
+	// Name is claimed for the session as it is created; the launch fails
+	// if another session holds it. With GenerateName, a session launched
+	// without a Name gets a random adjective-noun one.
+	Name         string
+	GenerateName bool
+	// Secrets are KEY=VALUE variables set like Env, but kept off command
+	// lines. Like Env, they are held only in memory, never saved.
+	Secrets []string
+
+	// NoQueue fails the launch with ErrAtCapacity or ErrPoolAtCapacity
+	// instead of queueing it.
+	NoQueue bool
+	// Pool limits the session to run alongside at most PoolSize-1 other
+	// sessions in the same pool; further launches in the pool are queued.
+	// PoolSize updates the pool's limit and may be zero to keep the current
+	// one.
+	Pool     string
+	PoolSize int
+
+	// Worktree runs the session in the named git worktree of WorkingDir's
+	// repository, created on first use (see prepareWorktree).
+	Worktree string
+	// Backend names the SessionBackend that runs the command, configured
+	// by BackendOptions. Empty is LocalBackend.
+	Backend        string
+	BackendOptions map[string]string
+	// AutoRespond answers prompts in the session's output (see
+	// autoResponder).
+	AutoRespond []protocol.AutoRespondRule
+	// Alerts are regular expressions whose matching output lines are
+	// recorded as session.alert events and sent to AlertNotify, a notify
+	// method, if set.
+	Alerts      []string
+	AlertNotify string
+	// Redact are regular expressions masked in the session's logged and
+	// watched output, besides the node's patterns and sensitive values.
+	Redact []string
+	// Labels are key=value metadata that selectors match (see
+	// protocol.Selector).
+	Labels map[string]string
+	// AcceptInputFrom limits who may send the session input, messages and
+	// requests (see ValidateInputPolicy). Empty accepts anyone.
+	AcceptInputFrom []string
+}
+
+// LaunchWith is Launch with every option, including the session's pool.
+func (m *SessionManager) LaunchWith(opts LaunchOptions) (uint32, error) {
+	if opts.Pool == "" && opts.PoolSize != 0 {
+		return 0, fmt.Errorf("pool size given without a pool name")
+	}
+	if opts.PoolSize < 0 {
+		return 0, fmt.Errorf("pool size must not be negative")
+	}
+	if opts.Name != "" && !namePattern.MatchString(opts.Name) {
+		return 0, fmt.Errorf("invalid name %q: must be 1-32 alphanumeric characters or hyphens, starting with alphanumeric", opts.Name)
+	}
+	for k, v := range opts.Labels {
+		if err := protocol.ValidateLabel(k, v); err != nil {
+			return 0, err
+		}
+	}
+	if err := ValidateInputPolicy(opts.AcceptInputFrom); err != nil {
+		return 0, err
+	}
+	launched := opts
+	if opts.Worktree != "" {
+		dir, err := m.prepareWorktree(opts.Worktree, opts.WorkingDir)
+		if err != nil {
+			return 0, err
+		}
+		opts.WorkingDir = dir
+	}
+	return m.launch(launchSpec{
+		opts:       launched,
+		command:    opts.Command,
+		workingDir: opts.WorkingDir,
+		env:        opts.Env,
+		secrets:    opts.Secrets,
+		stdinData:  opts.StdinData,
+		name:       opts.Name,
+		generate:   opts.GenerateName,
+		tags:       opts.Tags,
+		labels:     opts.Labels,
+		pool:       opts.Pool,
+		poolSize:   opts.PoolSize,
+		worktree:   opts.Worktree,
+		backend:    opts.Backend,
+		options:    opts.BackendOptions,
+		respond:    opts.AutoRespond,
+		alerts:     opts.Alerts,
+		notify:     opts.AlertNotify,
+		redact:     opts.Redact,
+		acceptFrom: opts.AcceptInputFrom,
+	}, !opts.NoQueue)
+}
+
+// launchSpec is what a session runs.
+type launchSpec struct {
+	command    []string
+	workingDir string
+	env        []string
+	secrets    []string
+	stdinData  []byte
+	name       string
+	generate   bool // generate a name if name is empty
+	tags       []string
+	labels     map[string]string
+	pool       string
+	poolSize   int
+	worktree   string
+	backend    string
+	options    map[string]string
+	respond    []protocol.AutoRespondRule
+	alerts     []string
+	notify     string // for alerts
+	redact     []string
+	acceptFrom []string
+	opts       LaunchOptions     // as given to LaunchWith, for Fork
+	runner     SessionBackend    // set by launch
+	state      map[string]string // from runner.Prepare
+}
+
+func (m *SessionManager) launch(spec launchSpec, allowQueue bool) (uint32, error) {
+	command, workingDir := spec.command, spec.workingDir
 	if len(command) == 0 {
 		return 0, fmt.Errorf("command must not be empty")
 	}
+	responder, err := newAutoResponder(spec.respond)
+	if err != nil {
+		return 0, err
+	}
+	alerts, err := m.newAlertWatcher(spec.alerts, spec.notify)
+	if err != nil {
+		return 0, err
+	}
+	redact, err := m.newRedactor(spec.redact, spec.env, spec.secrets)
+	if err != nil {
+		return 0, err
+	}
 
-	// Validate command binary.
-	cmdName := command[0]
-	if filepath.IsAbs(cmdName) {
-		if _, err := os.Stat(cmdName); err != nil {
-			return 0, fmt.Errorf("command %q does not exist", cmdName)
-		}
-	} else {
-		if _, err := exec.LookPath(cmdName); err != nil {
-			return 0, fmt.Errorf("command %q not found in PATH", cmdName)
-		}
+	runner, err := m.backend(spec.backend)
+	if err != nil {
+		return 0, err
+	}
+	state, err := runner.Prepare(BackendLaunch{Command: command, WorkingDir: workingDir, Secrets: spec.secrets, Options: spec.options})
+	if err != nil {
+		return 0, err
+	}
+	if spec.backend == LocalBackend {
+		spec.backend = ""
 	}
+	spec.runner, spec.state = runner, state
 
 	// Validate working directory.
 	info, err := os.Stat(workingDir)
@@ -612,46 +999,88 @@ func (m *SessionManager) Launch(command []string, workingDir string, env []strin
 		return 0, fmt.Errorf("working directory %q is not a directory", workingDir)
 	}
 
+	queued, err := m.reserveSlot(spec, allowQueue)
+	if err != nil {
+		return 0, err
+	}
+
 	// Allocate ID (starts at 1).
 	id := m.nextID.Add(1) - 1
 
+	name, err := m.claimName(id, spec.name, spec.generate)
+	if err != nil {
+		if !queued {
+			m.releaseSlot(spec.pool)
+		}
+		return 0, err
+	}
+	spec.name, spec.opts.Name = name, name
+
 	// Ensure log directory.
 	logDir := filepath.Join(m.dataDir, "sessions", fmt.Sprintf("%d", id))
 	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		if !queued {
+			m.releaseSlot(spec.pool)
+		}
+		m.unclaimName(id, name)
 		return 0, fmt.Errorf("creating log dir: %w", err)
 	}
-	logPath := filepath.Join(logDir, "output.log")
 
-	// Build exec.Cmd.
-	cmd := exec.Command(command[0], command[1:]...)
-	cmd.Dir = workingDir
-	extraEnv := []string{fmt.Sprintf("CW_SESSION_ID=%d", id)}
-	if name != "" {
-		extraEnv = append(extraEnv, "CW_SESSION_NAME="+name)
+	if spec.tags == nil {
+		spec.tags = []string{}
 	}
-	if len(tags) > 0 {
-		extraEnv = append(extraEnv, "CW_COHORT_TAG="+tags[0])
-	}
-	cmd.Env = buildEnv(append(env, extraEnv...))
 
-	// Start with a PTY.
-	ptmx, err := pty.Start(cmd)
-	if err != nil {
-		return 0, fmt.Errorf("opening PTY: %w", err)
+	status := StatusRunning()
+	if queued {
+		status = StatusQueued()
 	}
 
-	// Process ID.
-	var pid *uint32
-	if cmd.Process != nil {
-		p := uint32(cmd.Process.Pid)
-		pid = &p
+	sess := &Session{
+		Meta: SessionMeta{
+			ID:           id,
+			Name:         name,
+			Prompt:       strings.Join(command, " "),
+			WorkingDir:   workingDir,
+			CreatedAt:    time.Now().UTC(),
+			Status:       status.String(),
+			Tags:         spec.tags,
+			Labels:       spec.labels,
+			Pool:         spec.pool,
+			Worktree:     spec.worktree,
+			Backend:      spec.backend,
+			BackendState: spec.state,
+			AutoRespond:  spec.respond,
+			Alerts:       spec.alerts,
+			AlertNotify:  spec.notify,
+			Redact:       spec.redact,
+
+			AcceptInputFrom: spec.acceptFrom,
+			AgentSessionID:  claudeSessionArg(command),
+		},
+		autoRespond:   responder,
+		alerts:        alerts,
+		usage:         m.newUsageWatcher(spec.opts.Command),
+		agent:         m.newAgentWatcher(spec.opts.Command),
+		screen:        newScreen(defaultScreenCols, defaultScreenRows),
+		redact:        redact,
+		launchOpts:    spec.opts,
+		broadcaster:   NewBroadcaster(),
+		inputCh:       make(chan []byte, 256),
+		statusWatcher: NewStatusWatcher(status),
+		logPath:       filepath.Join(logDir, "output.log"),
+		exited:        make(chan struct{}),
+	}
+
+	var proc *os.Process
+	if !queued {
+		if proc, err = m.spawn(sess, spec); err != nil {
+			m.releaseSlot(spec.pool)
+			m.unclaimName(id, name)
+			return 0, err
+		}
 	}
 
-	displayCommand := strings.Join(command, " ")
-
-	broadcaster := NewBroadcaster()
-	inputCh := make(chan []byte, 256)
-	statusWatcher := NewStatusWatcher(StatusRunning())
+	m.recordLaunch(sess, spec.opts)
 
 	// Open event log.
 	eventsPath := filepath.Join(logDir, "events.jsonl")
@@ -659,6 +1088,7 @@ func (m *SessionManager) Launch(command []string, workingDir string, env []strin
 	if evErr != nil {
 		slog.Error("failed to open event log", "id", id, "err", evErr)
 	}
+	sess.eventLog = eventLog
 
 	// Open message log.
 	messagesPath := filepath.Join(logDir, "messages.jsonl")
@@ -666,61 +1096,217 @@ func (m *SessionManager) Launch(command []string, workingDir string, env []strin
 	if msgErr != nil {
 		slog.Error("failed to open message log", "id", id, "err", msgErr)
 	}
-
-	if tags == nil {
-		tags = []string{}
-	}
-
-	sess := &Session{
-		Meta: SessionMeta{
-			ID:         id,
-			Prompt:     displayCommand,
-			WorkingDir: workingDir,
-			CreatedAt:  time.Now().UTC(),
-			Status:     StatusRunning().String(),
-			PID:        pid,
-			Tags:       tags,
-		},
-		master:        ptmx,
-		broadcaster:   broadcaster,
-		inputCh:       inputCh,
-		statusWatcher: statusWatcher,
-		logPath:       logPath,
-		eventLog:      eventLog,
-		messageLog:    messageLog,
-	}
+	sess.messageLog = messageLog
 
 	m.mu.Lock()
 	m.sessions[id] = sess
 	m.mu.Unlock()
 
 	// Emit session.created event.
-	createdEvent := NewSessionCreatedEvent(command, workingDir, tags)
+	createdEvent := NewSessionCreatedEvent(command, workingDir, spec.tags)
 	if eventLog != nil {
 		eventLog.Append(createdEvent)
 	}
-	m.Subscriptions.Publish(id, tags, createdEvent)
+	m.Subscriptions.Publish(id, spec.tags, spec.labels, createdEvent)
+
+	if queued {
+		m.enqueue(sess, spec)
+		slog.Info("session queued", "id", id)
+	} else {
+		m.serve(sess, proc, spec)
+		slog.Info("session launched", "id", id)
+	}
+	m.triggerPersist()
+	return id, nil
+}
+
+// spawn starts spec's command in a new PTY for sess, with the session's
+// backend.
+func (m *SessionManager) spawn(sess *Session, spec launchSpec) (*os.Process, error) {
+	id := sess.Meta.ID
+
+	extraEnv := []string{fmt.Sprintf("CW_SESSION_ID=%d", id)}
+	if spec.name != "" {
+		extraEnv = append(extraEnv, "CW_SESSION_NAME="+spec.name)
+	}
+	if len(spec.tags) > 0 {
+		extraEnv = append(extraEnv, "CW_COHORT_TAG="+spec.tags[0])
+	}
+	cmd := spec.runner.Command(BackendLaunch{
+		Command:    spec.command,
+		WorkingDir: spec.workingDir,
+		Env:        append(spec.env, extraEnv...),
+		Secrets:    spec.secrets,
+		Options:    spec.options,
+	}, spec.state)
+
+	// Start with a PTY.
+	master, proc, err := startPTY(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("opening PTY: %w", err)
+	}
+
+	sess.mu.Lock()
+	sess.master = master
+	sess.startedAt = time.Now().UTC()
+	pid := uint32(proc.Pid)
+	sess.Meta.PID = &pid
+	sess.Meta.PIDStart, _ = processStart(proc.Pid)
+	sess.mu.Unlock()
+	return proc, nil
+}
+
+// serve runs the I/O and exit goroutines for a spawned session.
+func (m *SessionManager) serve(sess *Session, proc *os.Process, spec launchSpec) {
+	id := sess.Meta.ID
+
+	m.pump(sess, spec.stdinData)
+
+	// Goroutine 3: wait for process exit → update status + emit events.
+	go func() {
+		exitCode := -1
+		if state, waitErr := proc.Wait(); waitErr == nil {
+			exitCode = state.ExitCode()
+		}
+		reason := ""
+		if f, ok := spec.runner.(SessionFinisher); ok {
+			code, why, known := f.Finish(spec.state)
+			if known {
+				exitCode = code
+			}
+			reason = why
+		}
+		slog.Info("session process exited", "id", id, "code", exitCode, "reason", reason)
+
+		now := time.Now().UTC()
+		durationMs := now.Sub(sess.startedAt).Milliseconds()
+
+		sess.mu.Lock()
+		sess.Meta.ExitCode = &exitCode
+		sess.Meta.ExitReason = reason
+		sess.Meta.CompletedAt = &now
+		sess.mu.Unlock()
+
+		// Capture result from output log before status change.
+		sess.logOut.Flush()
+		result := captureResult(sess.logPath, 200)
+		sess.mu.Lock()
+		sess.Meta.Result = result
+		sess.mu.Unlock()
+
+		if m.Summaries.Interval > 0 {
+			m.summarize(sess)
+		}
+		m.checkGitDirty(sess)
+
+		sess.statusWatcher.Set(sess.exitStatus(exitCode))
+		m.recordOutcome(sess)
+		close(sess.exited)
+
+		// Emit session.status event.
+		statusEvent := NewSessionExitEvent(&exitCode, &durationMs, reason)
+		if sess.eventLog != nil {
+			sess.eventLog.Append(statusEvent)
+		}
+		sess.mu.Lock()
+		tags := sess.Meta.Tags
+		sess.mu.Unlock()
+		m.Subscriptions.Publish(id, tags, sess.Meta.Labels, statusEvent)
+
+		m.releaseName(id)
+		m.releaseSlot(spec.pool)
+		m.triggerPersist()
+	}()
+}
+
+// pump runs the goroutines that copy a session's PTY output to its log and
+// attached clients, and its input channel to the PTY. stdinData, if any, is
+// injected shortly after.
+func (m *SessionManager) pump(sess *Session, stdinData []byte) {
+	id := sess.Meta.ID
+	ptmx := sess.master
+	broadcaster := sess.broadcaster
+	inputCh := sess.inputCh
+	eventLog := sess.eventLog
+	logPath := sess.logPath
 
 	// Open log file.
 	logFile, logErr := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
 	if logErr != nil {
 		slog.Error("failed to open session log file", "id", id, "path", logPath, "err", logErr)
 	}
+	timingPath := filepath.Join(filepath.Dir(logPath), "output.timing")
+	timingFile, timingErr := os.OpenFile(timingPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if timingErr != nil {
+		slog.Error("failed to open session timing file", "id", id, "path", timingPath, "err", timingErr)
+	}
+
+	if logFile != nil && m.HistoryBytes > 0 {
+		if fi, err := logFile.Stat(); err == nil {
+			sess.recent.Store(newOutputRing(fi.Size(), m.HistoryBytes, m.HistoryLines))
+		}
+	}
+
+	// Output is redacted on its way to the log.
+	sess.logOut = newRedactStream(sess.redact, func(data []byte) {
+		if logFile == nil {
+			return
+		}
+		if _, wErr := logFile.Write(data); wErr != nil {
+			slog.Error("log write error", "id", id, "err", wErr)
+			// The log may hold part of data; history is read from it now.
+			sess.recent.Store(nil)
+			return
+		}
+		if recent := sess.recent.Load(); recent != nil {
+			recent.write(data)
+		}
+		if timingFile != nil {
+			if tErr := appendTiming(timingFile, time.Now(), len(data)); tErr != nil {
+				slog.Error("timing write error", "id", id, "err", tErr)
+			}
+		}
+	})
 
 	// Goroutine 1: PTY reader → log file + broadcast + output tracking.
 	go func() {
-		buf := make([]byte, 4096)
+		// Reads land in a slab that is handed on without copying: listeners
+		// keep slices of it, so a slab is replaced once nearly full, never
+		// reused.
+		var slab []byte
 		for {
-			n, readErr := ptmx.Read(buf)
+			if cap(slab)-len(slab) < ptyReadMin {
+				slab = make([]byte, 0, ptySlabSize)
+			}
+			n, readErr := ptmx.Read(slab[len(slab):cap(slab)])
 			if n > 0 {
-				data := make([]byte, n)
-				copy(data, buf[:n])
-				if logFile != nil {
-					if _, wErr := logFile.Write(data); wErr != nil {
-						slog.Error("log write error", "id", id, "err", wErr)
+				data := slab[len(slab) : len(slab)+n : len(slab)+n]
+				slab = slab[:len(slab)+n]
+				now := time.Now()
+				sess.logOut.Write(data)
+				broadcaster.Send(data)
+				sess.screen.feed(data)
+				if sess.autoRespond != nil {
+					if rule, match, ok := sess.autoRespond.feed(data); ok {
+						m.autoRespond(sess, rule, match)
 					}
 				}
-				broadcaster.Send(data)
+				if sess.alerts != nil {
+					for _, d := range sess.alerts.feed(data, now) {
+						m.alert(sess, d)
+					}
+				}
+				if sess.usage != nil {
+					if u, changed := sess.usage.feed(data); changed {
+						m.recordUsage(sess, u)
+					}
+					if agentID := sess.usage.takeAgentSession(); agentID != "" {
+						_ = m.SetAgentSession(id, agentID, "")
+					}
+				}
+				if sess.agent != nil && sess.agent.feed(data) {
+					_ = m.RecordEvent(id, NewAgentStoppedEvent("", ""))
+				}
 
 				// Track output stats.
 				sess.outputBytes.Add(uint64(n))
@@ -729,7 +1315,7 @@ func (m *SessionManager) Launch(command []string, workingDir string, env []strin
 						sess.outputLines.Add(1)
 					}
 				}
-				sess.lastOutputAt.Store(time.Now().UTC().UnixNano())
+				sess.lastOutputAt.Store(now.UTC().UnixNano())
 			}
 			if readErr != nil {
 				if readErr == io.EOF || isEIO(readErr) {
@@ -739,9 +1325,13 @@ func (m *SessionManager) Launch(command []string, workingDir string, env []strin
 				break
 			}
 		}
+		sess.logOut.Close()
 		if logFile != nil {
 			logFile.Close()
 		}
+		if timingFile != nil {
+			timingFile.Close()
+		}
 		if eventLog != nil {
 			eventLog.Close()
 		}
@@ -751,10 +1341,14 @@ func (m *SessionManager) Launch(command []string, workingDir string, env []strin
 	// Goroutine 2: input channel → PTY writer.
 	go func() {
 		for data := range inputCh {
+			// Recorded before the write, so that anything the program does
+			// in response happens after Fork can see the input.
+			sess.input.record(data)
 			if _, wErr := ptmx.Write(data); wErr != nil {
 				slog.Error("PTY write error", "id", id, "err", wErr)
 				break
 			}
+			sess.inputBytes.Add(uint64(len(data)))
 		}
 		slog.Info("input writer exited", "id", id)
 	}()
@@ -772,59 +1366,27 @@ func (m *SessionManager) Launch(command []string, workingDir string, env []strin
 			}
 		}()
 	}
-
-	// Goroutine 3: wait for process exit → update status + emit events.
-	go func() {
-		var exitCode int
-		waitErr := cmd.Wait()
-		if waitErr != nil {
-			var exitErr *exec.ExitError
-			if errors.As(waitErr, &exitErr) {
-				exitCode = exitErr.ExitCode()
-			} else {
-				exitCode = -1
-			}
-		}
-		slog.Info("session process exited", "id", id, "code", exitCode)
-
-		now := time.Now().UTC()
-		durationMs := now.Sub(sess.Meta.CreatedAt).Milliseconds()
-
-		sess.mu.Lock()
-		sess.Meta.ExitCode = &exitCode
-		sess.Meta.CompletedAt = &now
-		sess.mu.Unlock()
-
-		// Capture result from output log before status change.
-		result := captureResult(sess.logPath, 200)
-		sess.mu.Lock()
-		sess.Meta.Result = result
-		sess.mu.Unlock()
-
-		statusWatcher.Set(StatusCompleted(exitCode))
-
-		// Emit session.status event.
-		statusEvent := NewSessionStatusEvent("running", "completed", &exitCode, &durationMs)
-		if sess.eventLog != nil {
-			sess.eventLog.Append(statusEvent)
-		}
-		m.Subscriptions.Publish(id, tags, statusEvent)
-
-		m.releaseName(id)
-	}()
-
-	slog.Info("session launched", "id", id)
-	m.triggerPersist()
-	return id, nil
 }
 
 // List returns a SessionInfo slice for every known session, sorted by ID.
 func (m *SessionManager) List() []protocol.SessionInfo {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	return m.infos(func(*Session) bool { return true })
+}
 
-	infos := make([]protocol.SessionInfo, 0, len(m.sessions))
+// infos builds the SessionInfo of every session matching filter, sorted by
+// ID. They are built outside m.mu, since reading git state runs git.
+func (m *SessionManager) infos(filter func(*Session) bool) []protocol.SessionInfo {
+	m.mu.RLock()
+	var sessions []*Session
 	for _, s := range m.sessions {
+		if filter(s) {
+			sessions = append(sessions, s)
+		}
+	}
+	m.mu.RUnlock()
+
+	infos := make([]protocol.SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
 		infos = append(infos, m.buildSessionInfo(s))
 	}
 	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
@@ -840,15 +1402,21 @@ func (m *SessionManager) Attach(id uint32) (*AttachChannels, error) {
 		return nil, fmt.Errorf("session %d not found", id)
 	}
 
-	if sess.statusWatcher.Get().State != "running" {
+	if state := sess.statusWatcher.Get().State; state != "running" {
+		if state == "queued" {
+			return nil, fmt.Errorf("session %d is queued and has not started yet", id)
+		}
 		return nil, fmt.Errorf("session %d is not running", id)
 	}
+	if sess.Meta.Adopted {
+		return nil, errAdopted(id)
+	}
 
 	sess.attachedCount.Add(1)
-	subID, ch := sess.broadcaster.Subscribe(4096)
+	subID, out := sess.broadcaster.Subscribe(OutputBufferBytes)
 
 	return &AttachChannels{
-		OutputCh: ch,
+		Output:   out,
 		OutputID: subID,
 		InputCh:  sess.inputCh,
 		Status:   sess.statusWatcher,
@@ -875,11 +1443,69 @@ func (m *SessionManager) Resize(id uint32, cols, rows uint16) error {
 	if !ok {
 		return fmt.Errorf("session %d not found", id)
 	}
-	return pty.Setsize(sess.master, &pty.Winsize{Rows: rows, Cols: cols})
+	sess.mu.Lock()
+	master := sess.master
+	sess.mu.Unlock()
+	if master == nil {
+		return fmt.Errorf("session %d is not running", id)
+	}
+	if err := master.Resize(cols, rows); err != nil {
+		return err
+	}
+	sess.screen.resize(int(cols), int(rows))
+	return nil
 }
 
-// Kill sends SIGTERM to the session's process and marks it killed.
+// Screen returns what session id's terminal shows now, with SGR styles if
+// ansi is set. Output is masked as the session's log is.
+func (m *SessionManager) Screen(id uint32, ansi bool) (protocol.Screen, error) {
+	m.mu.RLock()
+	sess, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return protocol.Screen{}, fmt.Errorf("session %d not found", id)
+	}
+	return sess.screen.snapshot(ansi, sess.redact), nil
+}
+
+// Kill sends SIGTERM to the session's process, which is marked killed when it
+// exits. A queued session is removed from the queue without ever starting.
 func (m *SessionManager) Kill(id uint32) error {
+	return m.KillWith(id, KillOptions{})
+}
+
+// KillOptions controls how a session's process is signalled.
+type KillOptions struct {
+	// Signal is sent first. Zero means SIGTERM.
+	Signal syscall.Signal
+	// Grace, when positive, is how long to wait for the process to exit
+	// after Signal before sending SIGKILL.
+	Grace time.Duration
+	// Children signals the session's whole process group instead of only
+	// its main process.
+	Children bool
+}
+
+// ParseSignal parses a signal name such as "TERM" or "SIGINT".
+func ParseSignal(name string) (syscall.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "TERM":
+		return syscall.SIGTERM, nil
+	case "INT":
+		return syscall.SIGINT, nil
+	case "HUP":
+		return syscall.SIGHUP, nil
+	case "KILL":
+		return syscall.SIGKILL, nil
+	}
+	return 0, fmt.Errorf("unsupported signal %q (valid: TERM, INT, HUP, KILL)", name)
+}
+
+// KillWith terminates a session like Kill, signalling it as opts describes.
+// With a grace period, SIGKILL follows in the background if the process is
+// still running when it expires. A running session is marked killed once its
+// process exits.
+func (m *SessionManager) KillWith(id uint32, opts KillOptions) error {
 	m.mu.RLock()
 	sess, ok := m.sessions[id]
 	m.mu.RUnlock()
@@ -887,34 +1513,58 @@ func (m *SessionManager) Kill(id uint32) error {
 		return fmt.Errorf("session %d not found", id)
 	}
 
-	sess.statusWatcher.Set(StatusKilled())
-
-	if sess.Meta.PID != nil {
-		_ = syscall.Kill(int(*sess.Meta.PID), syscall.SIGTERM)
+	if m.dequeue(id) {
+		m.finishQueued(sess, StatusKilled())
+		return nil
 	}
 
+	// The session stays running until its process exits, which may take
+	// the grace period or never happen if the signal is handled; serve
+	// then marks it killed and releases its name.
 	sess.mu.Lock()
-	sess.Meta.Status = StatusKilled().String()
+	if sess.statusWatcher.Get().State == "running" {
+		sess.killPending = true
+	}
+	meta := sess.Meta
 	sess.mu.Unlock()
-
-	m.triggerPersist()
-	m.releaseName(id)
+	if meta.PID != nil {
+		sig := opts.Signal
+		if sig == 0 {
+			sig = syscall.SIGTERM
+		}
+		_ = m.signalSession(meta, sig, opts.Children)
+
+		if opts.Grace > 0 && sig != syscall.SIGKILL {
+			go func() {
+				select {
+				case <-sess.exited:
+				case <-time.After(opts.Grace):
+					slog.Info("grace period expired, sending SIGKILL", "id", id, "grace", opts.Grace)
+					_ = m.signalSession(meta, syscall.SIGKILL, opts.Children)
+				}
+			}()
+		}
+	}
 	return nil
 }
 
-// KillAll kills every running session and returns the count killed.
-func (m *SessionManager) KillAll() int {
-	m.mu.RLock()
-	ids := make([]uint32, 0)
-	for id, s := range m.sessions {
-		if s.statusWatcher.Get().State == "running" {
-			ids = append(ids, id)
-		}
+// exitStatus returns the status a session ends with when its process exits
+// with code: killed if KillWith was called, completed otherwise.
+func (sess *Session) exitStatus(code int) SessionStatus {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.killPending {
+		return StatusKilled()
 	}
-	m.mu.RUnlock()
+	return StatusCompleted(code)
+}
+
+// KillAll kills every running or queued session and returns the count killed.
+func (m *SessionManager) KillAll(opts KillOptions) int {
+	ids := m.liveSessions(func(*Session) bool { return true })
 
 	for _, id := range ids {
-		_ = m.Kill(id)
+		_ = m.KillWith(id, opts)
 	}
 	return len(ids)
 }
@@ -930,8 +1580,31 @@ func (m *SessionManager) LogPath(id uint32) (string, error) {
 	return filepath.Join(m.dataDir, "sessions", fmt.Sprintf("%d", id), "output.log"), nil
 }
 
+// CheckInput reports, as SendInputFrom would, whether session toID accepts
+// input from session fromID (0 for a caller that is not a session).
+func (m *SessionManager) CheckInput(fromID, toID uint32) error {
+	m.mu.RLock()
+	sess, ok := m.sessions[toID]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("session %d not found", toID)
+	}
+	return m.checkInput(fromID, sess)
+}
+
+// SendInputFrom is SendInput on behalf of session fromID (0 for a caller
+// that is not a session), refused unless session id's input policy accepts
+// the sender.
+func (m *SessionManager) SendInputFrom(fromID, id uint32, data []byte) (int, error) {
+	if err := m.CheckInput(fromID, id); err != nil {
+		return 0, err
+	}
+	return m.SendInput(id, data)
+}
+
 // SendInput writes data to a session's PTY. It is non-blocking: if the input
-// channel is full the send fails with an error.
+// channel is full the send fails with an error. It applies no input policy;
+// input from clients and other sessions goes through SendInputFrom.
 func (m *SessionManager) SendInput(id uint32, data []byte) (int, error) {
 	m.mu.RLock()
 	sess, ok := m.sessions[id]
@@ -939,6 +1612,9 @@ func (m *SessionManager) SendInput(id uint32, data []byte) (int, error) {
 	if !ok {
 		return 0, fmt.Errorf("session %d not found", id)
 	}
+	if sess.Meta.Adopted {
+		return 0, errAdopted(id)
+	}
 
 	select {
 	case sess.inputCh <- data:
@@ -949,7 +1625,8 @@ func (m *SessionManager) SendInput(id uint32, data []byte) (int, error) {
 }
 
 // GetStatus returns detailed status information for a session, including log
-// file size and the last few lines of output.
+// file size, the last few lines of output as plain text and, for a running
+// local session, what its processes use.
 func (m *SessionManager) GetStatus(id uint32) (protocol.SessionInfo, uint64, error) {
 	m.mu.RLock()
 	sess, ok := m.sessions[id]
@@ -961,14 +1638,18 @@ func (m *SessionManager) GetStatus(id uint32) (protocol.SessionInfo, uint64, err
 	info := m.buildSessionInfo(sess)
 
 	// Add snippet for GetStatus specifically.
-	if content, err := os.ReadFile(sess.logPath); err == nil {
+	if recent, _, ok := outputTail(sess, 5); ok {
+		if joined := Sanitize(string(recent), SanitizeFull); joined != "" {
+			info.LastOutputSnippet = &joined
+		}
+	} else if content, err := os.ReadFile(sess.logPath); err == nil {
 		lines := strings.Split(string(content), "\n")
 		start := len(lines) - 5
 		if start < 0 {
 			start = 0
 		}
 		tail := lines[start:]
-		joined := strings.Join(tail, "\n")
+		joined := Sanitize(strings.Join(tail, "\n"), SanitizeFull)
 		if joined != "" {
 			info.LastOutputSnippet = &joined
 		}
@@ -976,6 +1657,11 @@ func (m *SessionManager) GetStatus(id uint32) (protocol.SessionInfo, uint64, err
 		slog.Warn("failed to read log file for snippet", "id", id, "err", err)
 	}
 
+	// Other backends run the session elsewhere; PID is only their client.
+	if info.Status == StatusRunning().String() && info.PID != nil && (info.Backend == "" || info.Backend == LocalBackend) {
+		info.Resources = m.resources.sample(int(*info.PID))
+	}
+
 	var outputSize uint64
 	if info.OutputBytes != nil {
 		outputSize = *info.OutputBytes
@@ -985,15 +1671,81 @@ func (m *SessionManager) GetStatus(id uint32) (protocol.SessionInfo, uint64, err
 }
 
 // SubscribeOutput returns a broadcast subscription for a session's PTY output.
-func (m *SessionManager) SubscribeOutput(id uint32) (uint64, <-chan []byte, error) {
+func (m *SessionManager) SubscribeOutput(id uint32) (uint64, *OutputListener, error) {
 	m.mu.RLock()
 	sess, ok := m.sessions[id]
 	m.mu.RUnlock()
 	if !ok {
 		return 0, nil, fmt.Errorf("session %d not found", id)
 	}
-	subID, ch := sess.broadcaster.Subscribe(4096)
-	return subID, ch, nil
+	subID, out := sess.broadcaster.Subscribe(OutputBufferBytes)
+	return subID, out, nil
+}
+
+// OutputTail returns session id's log from its last lines lines on (all of
+// it if lines is nil), split on "\n" as strings.Split counts lines, and the
+// log's size, without reading the log: ok is false unless the session's
+// in-memory history reaches back that far (see HistoryBytes).
+func (m *SessionManager) OutputTail(id uint32, lines *uint) (data []byte, size int64, ok bool) {
+	m.mu.RLock()
+	sess, found := m.sessions[id]
+	m.mu.RUnlock()
+	if !found {
+		return nil, 0, false
+	}
+	n := -1
+	if lines != nil {
+		n = int(*lines)
+	}
+	return outputTail(sess, n)
+}
+
+func outputTail(sess *Session, n int) ([]byte, int64, bool) {
+	recent := sess.recent.Load()
+	if recent == nil {
+		return nil, 0, false
+	}
+	return recent.tail(n)
+}
+
+// OutputFrom returns session id's log from byte offset on, nothing if the
+// log is not that long yet, and the log's size. The session's in-memory
+// history serves it when it reaches back that far; otherwise the log file is
+// read.
+func (m *SessionManager) OutputFrom(id uint32, offset int64) ([]byte, int64, error) {
+	m.mu.RLock()
+	sess, found := m.sessions[id]
+	m.mu.RUnlock()
+	if !found {
+		return nil, 0, fmt.Errorf("session %d not found", id)
+	}
+	if recent := sess.recent.Load(); recent != nil {
+		if data, size, ok := recent.from(offset); ok {
+			return data, size, nil
+		}
+	}
+	f, err := os.Open(sess.logPath)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading log file: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading log file: %w", err)
+	}
+	size := fi.Size()
+	if offset >= size {
+		return nil, size, nil
+	}
+	data := make([]byte, size-max(offset, 0))
+	n, err := f.ReadAt(data, max(offset, 0))
+	if err != nil && err != io.EOF {
+		return nil, 0, fmt.Errorf("reading log file: %w", err)
+	}
+	return data[:n], max(offset, 0) + int64(n), nil
 }
 
 // UnsubscribeOutput removes a broadcast subscription for a session.
@@ -1082,12 +1834,21 @@ func (m *SessionManager) buildSessionInfo(s *Session) protocol.SessionInfo {
 		WorkingDir:    s.Meta.WorkingDir,
 		CreatedAt:     s.Meta.CreatedAt.Format(time.RFC3339),
 		Status:        status.String(),
+		Activity:      m.activity(s, status),
 		Attached:      attached,
 		PID:           s.Meta.PID,
 		Tags:          s.Meta.Tags,
+		Labels:        s.Meta.Labels,
+		Pool:          s.Meta.Pool,
+		Worktree:      s.Meta.Worktree,
+		Backend:       s.Meta.Backend,
+		BackendState:  s.Meta.BackendState,
+		Adopted:       s.Meta.Adopted,
 		OutputBytes:   &outputBytes,
 		OutputLines:   &outputLines,
 		AttachedCount: attachedCount,
+
+		AcceptInputFrom: s.Meta.AcceptInputFrom,
 	}
 
 	// File-based output size.
@@ -1101,15 +1862,20 @@ func (m *SessionManager) buildSessionInfo(s *Session) protocol.SessionInfo {
 	if s.Meta.ExitCode != nil {
 		info.ExitCode = s.Meta.ExitCode
 	}
+	info.ExitReason = s.Meta.ExitReason
 	if s.Meta.CompletedAt != nil {
 		completedStr := s.Meta.CompletedAt.Format(time.RFC3339)
 		info.CompletedAt = &completedStr
-		durationMs := s.Meta.CompletedAt.Sub(s.Meta.CreatedAt).Milliseconds()
+		durationMs := s.Meta.CompletedAt.Sub(s.startedAt).Milliseconds()
 		info.DurationMs = &durationMs
 	}
 	if s.Meta.Result != nil {
 		info.LastOutputSnippet = s.Meta.Result
 	}
+	info.Budget = s.Meta.Budget
+	info.Usage = s.Meta.Usage
+	info.AgentSessionID = s.Meta.AgentSessionID
+	info.TranscriptPath = s.Meta.TranscriptPath
 	s.mu.Unlock()
 
 	// Last output timestamp.
@@ -1118,9 +1884,36 @@ func (m *SessionManager) buildSessionInfo(s *Session) protocol.SessionInfo {
 		info.LastOutputAt = &lastStr
 	}
 
+	info.Git = m.git.get(s.Meta.WorkingDir)
+	info.Summary = s.summary.last.Load()
+
 	return info
 }
 
+// RecordEvent appends an externally reported event (e.g. from an agent hook)
+// to the session's event log and publishes it to subscribers.
+func (m *SessionManager) RecordEvent(id uint32, event Event) error {
+	m.mu.RLock()
+	sess, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("session %d not found", id)
+	}
+	if sess.eventLog != nil {
+		sess.eventLog.Append(event)
+	}
+	sess.mu.Lock()
+	tags, labels := sess.Meta.Tags, sess.Meta.Labels
+	sess.mu.Unlock()
+	m.Subscriptions.Publish(id, tags, labels, event)
+	if event.Type == EventAgentStopped && sess.usage != nil {
+		if u, changed := sess.usage.fromTranscript(event); changed {
+			m.recordUsage(sess, u)
+		}
+	}
+	return nil
+}
+
 // GetSessionTags returns the tags for a session (used by handler for event filtering).
 func (m *SessionManager) GetSessionTags(id uint32) []string {
 	m.mu.RLock()
@@ -1132,19 +1925,43 @@ func (m *SessionManager) GetSessionTags(id uint32) []string {
 	return sess.Meta.Tags
 }
 
+// SetTags replaces a session's tags. Events from then on carry the new
+// tags.
+func (m *SessionManager) SetTags(id uint32, tags []string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess, ok := m.sessions[id]
+	if !ok {
+		return fmt.Errorf("session %d not found", id)
+	}
+	sess.mu.Lock()
+	sess.Meta.Tags = tags
+	sess.mu.Unlock()
+	m.triggerPersist()
+	return nil
+}
+
 // ListByTags returns sessions matching any of the given tags.
 func (m *SessionManager) ListByTags(tags []string) []protocol.SessionInfo {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	return m.infos(func(s *Session) bool { return matchesTags(s.Meta.Tags, tags) })
+}
 
-	var infos []protocol.SessionInfo
-	for _, s := range m.sessions {
-		if matchesTags(s.Meta.Tags, tags) {
-			infos = append(infos, m.buildSessionInfo(s))
-		}
+// ListMatching returns sessions with any of tags, if given, whose labels
+// match selector.
+func (m *SessionManager) ListMatching(tags []string, selector protocol.Selector) []protocol.SessionInfo {
+	return m.infos(func(s *Session) bool { return matchesFilter(s, tags, selector) })
+}
+
+// matchesFilter reports whether s has any of tags, if given, and labels
+// matching selector.
+func matchesFilter(s *Session, tags []string, selector protocol.Selector) bool {
+	if len(tags) > 0 && !matchesTags(s.Meta.Tags, tags) {
+		return false
 	}
-	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
-	return infos
+	return selector.Matches(s.Meta.Labels)
 }
 
 func matchesTags(sessionTags, filterTags []string) bool {
@@ -1158,19 +1975,39 @@ func matchesTags(sessionTags, filterTags []string) bool {
 	return false
 }
 
-// KillByTags kills all running sessions matching any of the given tags.
-func (m *SessionManager) KillByTags(tags []string) int {
+// liveSessions returns the IDs of queued and running sessions matching
+// filter, queued first so killing them in order never starts a queued one.
+func (m *SessionManager) liveSessions(filter func(*Session) bool) []uint32 {
 	m.mu.RLock()
-	var ids []uint32
+	defer m.mu.RUnlock()
+
+	var queued, running []uint32
 	for id, s := range m.sessions {
-		if s.statusWatcher.Get().State == "running" && matchesTags(s.Meta.Tags, tags) {
-			ids = append(ids, id)
+		if !filter(s) {
+			continue
+		}
+		switch s.statusWatcher.Get().State {
+		case "queued":
+			queued = append(queued, id)
+		case "running":
+			running = append(running, id)
 		}
 	}
-	m.mu.RUnlock()
+	return append(queued, running...)
+}
+
+// KillByTags kills all running or queued sessions matching any of the given
+// tags and, if set, the selector.
+func (m *SessionManager) KillByTags(tags []string, selector protocol.Selector, opts KillOptions) int {
+	ids := m.liveSessions(func(s *Session) bool {
+		if len(tags) == 0 && len(selector) == 0 {
+			return false
+		}
+		return matchesFilter(s, tags, selector)
+	})
 
 	for _, id := range ids {
-		m.Kill(id)
+		_ = m.KillWith(id, opts)
 	}
 	return len(ids)
 }
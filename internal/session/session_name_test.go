@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -281,3 +282,94 @@ func TestNamePersistence(t *testing.T) {
 		t.Fatalf("session %d not found in sessions.json", id)
 	}
 }
+
+func TestGenerateNameUnique(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+
+	id := launchSleep(t, sm)
+
+	name := sm.GenerateName()
+	if !namePattern.MatchString(name) {
+		t.Fatalf("generated name %q is not a valid session name", name)
+	}
+	if err := sm.SetName(id, name); err != nil {
+		t.Fatalf("SetName(%q) failed: %v", name, err)
+	}
+
+	// Generated names never collide with existing ones.
+	for i := 0; i < 100; i++ {
+		if got := sm.GenerateName(); got == name {
+			t.Fatalf("GenerateName returned taken name %q", got)
+		}
+	}
+}
+
+func TestLaunchClaimsName(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	launch := func(name string, generate bool) (uint32, error) {
+		id, err := sm.LaunchWith(LaunchOptions{Command: []string{"sleep", "5"}, WorkingDir: "/tmp", Name: name, GenerateName: generate})
+		if err == nil {
+			t.Cleanup(func() { _ = sm.Kill(id) })
+		}
+		return id, err
+	}
+
+	// Concurrent launches with the same name: exactly one gets it.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var launched []uint32
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if id, err := launch("contested", false); err == nil {
+				mu.Lock()
+				launched = append(launched, id)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(launched) != 1 || len(sm.List()) != 1 {
+		t.Fatalf("%d launches named contested, %d sessions; want one", len(launched), len(sm.List()))
+	}
+	if got, _ := sm.ResolveByName("contested"); got != launched[0] || sm.GetName(launched[0]) != "contested" {
+		t.Errorf("contested resolves to %d, want %d", got, launched[0])
+	}
+
+	// Generated names are claimed the same way.
+	names := map[string]bool{}
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := launch("", true)
+			if err != nil {
+				t.Errorf("launch: %v", err)
+				return
+			}
+			mu.Lock()
+			names[sm.GetName(id)] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(names) != 10 || names[""] {
+		t.Errorf("generated names = %v, want ten distinct names", names)
+	}
+
+	if _, err := launch("", false); err != nil {
+		t.Errorf("unnamed launch: %v", err)
+	}
+	if _, err := launch("-bad", false); err == nil {
+		t.Error("launch with an invalid name succeeded")
+	}
+}
@@ -61,3 +61,36 @@ func TestBuildEnvOverridesExisting(t *testing.T) {
 		}
 	}
 }
+
+func TestBroadcasterSlowListener(t *testing.T) {
+	b := NewBroadcaster()
+	_, l := b.Subscribe(8)
+
+	// Output coalesces while unread, and what overflows is counted.
+	b.Send([]byte("ab"))
+	b.Send([]byte("cd"))
+	b.Send([]byte("efghij"))
+	b.Send([]byte("kl"))
+	select {
+	case <-l.Ready():
+	default:
+		t.Fatal("listener not signalled")
+	}
+	if out, ok := l.Next(); !ok || string(out.Data) != "abcd" || out.Dropped != 0 {
+		t.Fatalf("first chunk = %q dropped %d, want \"abcd\"", out.Data, out.Dropped)
+	}
+	// The gap is reported with the output after it.
+	b.Send([]byte("mn"))
+	if out, _ := l.Next(); string(out.Data) != "klmn" || out.Dropped != 6 {
+		t.Fatalf("second chunk = %q dropped %d, want \"klmn\" after 6", out.Data, out.Dropped)
+	}
+
+	// A gap at the end is reported on its own.
+	b.Send([]byte("0123456789"))
+	if out, ok := l.Next(); !ok || len(out.Data) != 0 || out.Dropped != 10 {
+		t.Fatalf("trailing gap = %q dropped %d, want 10", out.Data, out.Dropped)
+	}
+	if _, ok := l.Next(); ok {
+		t.Fatal("Next returned a chunk from an empty listener")
+	}
+}
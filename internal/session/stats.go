@@ -0,0 +1,123 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Stats returns what session id has used.
+func (m *SessionManager) Stats(id uint32) (protocol.SessionStats, error) {
+	m.mu.RLock()
+	sess, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return protocol.SessionStats{}, fmt.Errorf("session %d not found", id)
+	}
+	return m.sessionStats(sess), nil
+}
+
+// AllStats returns the stats of every session created at or after since
+// (every session if since is zero), sorted by ID.
+func (m *SessionManager) AllStats(since time.Time) []protocol.SessionStats {
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, sess := range m.sessions {
+		if !sess.Meta.CreatedAt.Before(since) {
+			sessions = append(sessions, sess)
+		}
+	}
+	m.mu.RUnlock()
+
+	out := make([]protocol.SessionStats, 0, len(sessions))
+	for _, sess := range sessions {
+		out = append(out, m.sessionStats(sess))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (m *SessionManager) sessionStats(sess *Session) protocol.SessionStats {
+	status := sess.statusWatcher.Get()
+	sess.mu.Lock()
+	st := protocol.SessionStats{
+		ID:        sess.Meta.ID,
+		Name:      sess.Meta.Name,
+		Command:   sess.Meta.Prompt,
+		Status:    status.String(),
+		CreatedAt: sess.Meta.CreatedAt.Format(time.RFC3339),
+	}
+	switch {
+	case sess.Meta.CompletedAt != nil:
+		st.RuntimeMs = sess.Meta.CompletedAt.Sub(sess.startedAt).Milliseconds()
+	case status.State == "running":
+		st.RuntimeMs = time.Since(sess.startedAt).Milliseconds()
+	}
+	if u := sess.Meta.Usage; u != nil {
+		st.Agent, st.InputTokens, st.OutputTokens, st.CostUSD = u.Agent, u.InputTokens, u.OutputTokens, u.CostUSD
+	}
+	sess.mu.Unlock()
+	st.RuntimeMs = max(st.RuntimeMs, 0)
+	st.OutputBytes = sess.outputBytes.Load()
+	st.OutputLines = sess.outputLines.Load()
+	st.InputBytes = sess.inputBytes.Load()
+
+	logDir := filepath.Dir(sess.logPath)
+	messages, _ := ReadEventLog(filepath.Join(logDir, "messages.jsonl"))
+	countMessages(&st, messages)
+
+	return st
+}
+
+// countMessages counts the messages, requests and replies in the message
+// log of session st.ID.
+func countMessages(st *protocol.SessionStats, events []Event) {
+	requested := map[string]bool{} // IDs of the requests st.ID sent
+	for _, e := range events {
+		switch e.Type {
+		case EventDirectMessage:
+			var d DirectMessageData
+			if json.Unmarshal(e.Data, &d) != nil {
+				continue
+			}
+			if d.From == st.ID {
+				st.MessagesSent++
+			}
+			if d.To == st.ID {
+				st.MessagesReceived++
+			}
+		case EventRequest:
+			var d RequestData
+			if json.Unmarshal(e.Data, &d) != nil {
+				continue
+			}
+			if d.From == st.ID {
+				st.MessagesSent++
+				st.ApprovalsRequested++
+				requested[d.RequestID] = true
+			}
+			if d.To == st.ID {
+				st.MessagesReceived++
+			}
+		case EventReply:
+			var d ReplyData
+			if json.Unmarshal(e.Data, &d) != nil {
+				continue
+			}
+			switch {
+			case d.From == st.ID:
+				st.MessagesSent++
+			case requested[d.RequestID]:
+				st.MessagesReceived++
+				if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(d.Body)), "DENIED") {
+					st.ApprovalsDenied++
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsMessages(t *testing.T) {
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create session manager: %v", err)
+	}
+	worker := launchSleepSession(t, sm)
+	gateway := launchSleepSession(t, sm)
+
+	if _, err := sm.SendMessage(gateway, worker, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	for _, reply := range []string{"APPROVED", "DENIED: no rm -rf"} {
+		requestID, _, err := sm.SendRequest(worker, gateway, "Bash: rm -rf /tmp/x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sm.SendReply(gateway, requestID, reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := sm.SendInput(worker, []byte("ls\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := sm.Stats(worker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.MessagesSent != 2 || st.MessagesReceived != 3 {
+		t.Errorf("messages = %d sent, %d received, want 2, 3", st.MessagesSent, st.MessagesReceived)
+	}
+	if st.ApprovalsRequested != 2 || st.ApprovalsDenied != 1 {
+		t.Errorf("approvals = %d requested, %d denied, want 2, 1", st.ApprovalsRequested, st.ApprovalsDenied)
+	}
+	if st.Status != "running" || st.Agent != "" {
+		t.Errorf("status %q, agent %q", st.Status, st.Agent)
+	}
+
+	gw, _ := sm.Stats(gateway)
+	if gw.MessagesSent != 3 || gw.MessagesReceived != 2 || gw.ApprovalsRequested != 0 {
+		t.Errorf("gateway stats = %+v", gw)
+	}
+	if all := sm.AllStats(time.Time{}); len(all) != 2 {
+		t.Errorf("AllStats returned %d sessions, want 2", len(all))
+	}
+}
@@ -0,0 +1,181 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Summarizer configures the session.output_summary events the node records
+// as sessions write output.
+type Summarizer struct {
+	// Interval is how often each session's new output is summarized. Zero
+	// disables summaries.
+	Interval time.Duration
+	// Lines is how many of the last non-blank lines a summary keeps.
+	Lines int
+	// Command, if set, is run with sh -c for every summary, with the new
+	// output (ANSI stripped) on stdin. What it prints is the summary text.
+	Command string
+}
+
+const (
+	// summaryChunkBytes is the most output, from the end, that a summary
+	// reads.
+	summaryChunkBytes = 64 * 1024
+	// summaryTimeout bounds Summarizer.Command.
+	summaryTimeout = 30 * time.Second
+	// summaryTextBytes is how much of Summarizer.Command's output is kept.
+	summaryTextBytes = 4 * 1024
+)
+
+// errorLine matches output lines that look like errors.
+var errorLine = regexp.MustCompile(`(?i)\b(error|fatal|panic|exception|traceback|failed)\b`)
+
+// summaryState is a session's progress through its output summaries.
+type summaryState struct {
+	mu           sync.Mutex // held while summarizing
+	bytes, lines uint64     // output totals at the last summary
+	last         atomic.Pointer[protocol.OutputSummary]
+}
+
+// SummarizeOutput records a session.output_summary event for every session
+// that wrote output since its last summary.
+func (m *SessionManager) SummarizeOutput() {
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.mu.RUnlock()
+	for _, s := range sessions {
+		m.summarize(s)
+	}
+}
+
+// summarize records a session.output_summary event for the output s wrote
+// since its last summary, if any.
+func (m *SessionManager) summarize(s *Session) {
+	st := &s.summary
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	total, lines := s.outputBytes.Load(), s.outputLines.Load()
+	if total <= st.bytes {
+		return
+	}
+	text := StripANSI(string(readLogTail(s.logPath, min(total-st.bytes, summaryChunkBytes))))
+
+	summary := &protocol.OutputSummary{At: time.Now().UTC().Format(time.RFC3339)}
+	summary.Lines, summary.Errors = summarizeLines(text, m.Summaries.Lines)
+	if m.Summaries.Command != "" {
+		out, err := runSummarizer(m.Summaries.Command, s.Meta.ID, text)
+		if err != nil {
+			slog.Warn("summarizer command failed", "id", s.Meta.ID, "err", err)
+		}
+		summary.Summary = out
+	}
+
+	event := NewOutputSummaryEvent(OutputSummaryData{
+		BytesDelta: total - st.bytes,
+		LinesDelta: lines - st.lines,
+		TotalBytes: total,
+		TotalLines: lines,
+		Summary:    summary.Summary,
+		Lines:      summary.Lines,
+		Errors:     summary.Errors,
+	})
+	st.bytes, st.lines = total, lines
+	st.last.Store(summary)
+	if s.eventLog != nil {
+		s.eventLog.Append(event)
+	}
+	m.Subscriptions.Publish(s.Meta.ID, s.Meta.Tags, s.Meta.Labels, event)
+}
+
+// summarizeLines returns the last n non-blank lines of text and, of the
+// lines that look like errors, the last n.
+func summarizeLines(text string, n int) (tail, errors []string) {
+	for _, line := range strings.Split(text, "\n") {
+		// Keep what a terminal shows of lines redrawn with carriage returns.
+		if i := strings.LastIndexByte(strings.TrimRight(line, "\r"), '\r'); i >= 0 {
+			line = line[i+1:]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		tail = append(tail, line)
+		if errorLine.MatchString(line) {
+			errors = append(errors, line)
+		}
+	}
+	return lastN(tail, n), lastN(errors, n)
+}
+
+func lastN(lines []string, n int) []string {
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return lines
+}
+
+// readLogTail reads the last n bytes of the log at path.
+func readLogTail(path string, n uint64) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	size := fi.Size()
+	if int64(n) < size {
+		size = int64(n)
+	}
+	buf := make([]byte, size)
+	read, err := f.ReadAt(buf, fi.Size()-size)
+	if err != nil && err != io.EOF {
+		return nil
+	}
+	return buf[:read]
+}
+
+// runSummarizer runs command with text on stdin, returning the trimmed start
+// of what it prints.
+func runSummarizer(command string, id uint32, text string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("CW_SESSION_ID=%d", id))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if len(out) > summaryTextBytes {
+		out = out[:summaryTextBytes]
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
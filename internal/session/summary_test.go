@@ -0,0 +1,86 @@
+package session
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSummarizeLines(t *testing.T) {
+	text := "building...\n\nstep 1\r\nprogress 10%\rprogress 100%\r\n" +
+		"Error: cannot find module 'x'\nstep 2\n  FAILED tests/a_test\n\n"
+	tail, errors := summarizeLines(text, 3)
+	if want := []string{"Error: cannot find module 'x'", "step 2", "FAILED tests/a_test"}; !reflect.DeepEqual(tail, want) {
+		t.Errorf("tail = %q, want %q", tail, want)
+	}
+	if want := []string{"Error: cannot find module 'x'", "FAILED tests/a_test"}; !reflect.DeepEqual(errors, want) {
+		t.Errorf("errors = %q, want %q", errors, want)
+	}
+	tail, _ = summarizeLines(text, 5)
+	if tail[1] != "progress 100%" {
+		t.Errorf("redrawn line = %q, want its final state", tail[1])
+	}
+	if tail, errors := summarizeLines("\n \n", 5); tail != nil || errors != nil {
+		t.Errorf("blank output summarized as %q %q", tail, errors)
+	}
+}
+
+func TestOutputSummaryEvent(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	sm.Summaries = Summarizer{Interval: time.Minute, Lines: 2, Command: "wc -l | tr -d ' '"}
+	sub := sm.Subscriptions.Subscribe(nil, nil, nil, []EventType{EventOutputSummary})
+	defer sm.Subscriptions.Unsubscribe(sub.ID)
+
+	id, err := sm.Launch([]string{"sh", "-c", "echo one; echo 'panic: boom'; echo three; sleep 30"}, dir, nil, nil, "")
+	if err != nil {
+		t.Fatalf("Launch: %v", err)
+	}
+	defer sm.Kill(id)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		info, _, _ := sm.GetStatus(id)
+		if *info.OutputLines == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("output lines = %d, want 3", *info.OutputLines)
+		}
+	}
+
+	sm.SummarizeOutput()
+	select {
+	case se := <-sub.Ch:
+		var d OutputSummaryData
+		if err := json.Unmarshal(se.Event.Data, &d); err != nil {
+			t.Fatal(err)
+		}
+		if se.SessionID != id || d.TotalLines != 3 || d.LinesDelta != 3 || d.Summary != "3" {
+			t.Fatalf("output_summary event = %d %+v", se.SessionID, d)
+		}
+		if !reflect.DeepEqual(d.Lines, []string{"panic: boom", "three"}) || !reflect.DeepEqual(d.Errors, []string{"panic: boom"}) {
+			t.Fatalf("summary lines = %q, errors = %q", d.Lines, d.Errors)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no session.output_summary event")
+	}
+
+	info, _, err := sm.GetStatus(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Summary == nil || info.Summary.Summary != "3" {
+		t.Fatalf("SessionInfo.Summary = %+v", info.Summary)
+	}
+
+	// Without new output there is nothing to summarize.
+	sm.SummarizeOutput()
+	select {
+	case se := <-sub.Ch:
+		t.Fatalf("unexpected summary of no new output: %s", se.Event.Data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,166 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Timeline returns session id's audit trail: its lifecycle and the
+// messages, approvals, alerts and agent events recorded in its event and
+// message logs, oldest first. Output summaries and token usage updates are
+// left out; cw logs and cw stats report those.
+func (m *SessionManager) Timeline(id uint32) ([]protocol.TimelineEntry, error) {
+	m.mu.RLock()
+	sess, ok := m.sessions[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("session %d not found", id)
+	}
+	logDir := filepath.Dir(sess.logPath)
+	events, err := ReadEventLog(filepath.Join(logDir, "events.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("reading event log: %w", err)
+	}
+	messages, err := ReadEventLog(filepath.Join(logDir, "messages.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("reading message log: %w", err)
+	}
+	return timeline(id, append(events, messages...)), nil
+}
+
+// timeline turns the events of session id's logs into its timeline.
+func timeline(id uint32, events []Event) []protocol.TimelineEntry {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	requested := map[string]bool{} // IDs of the requests id sent
+	entries := []protocol.TimelineEntry{}
+	for _, e := range events {
+		kind, summary := describeEvent(id, e, requested)
+		if kind == "" {
+			continue
+		}
+		entries = append(entries, protocol.TimelineEntry{
+			Time:    e.Timestamp.Format(time.RFC3339),
+			Kind:    kind,
+			Type:    string(e.Type),
+			Summary: summary,
+			Data:    e.Data,
+		})
+	}
+	return entries
+}
+
+// describeEvent returns the kind of e, an event of session id, and a line
+// describing it, or no kind to leave it out of the timeline. Like cw stats,
+// it counts the requests id sends as approval requests, and the replies to
+// them as their outcome.
+func describeEvent(id uint32, e Event, requested map[string]bool) (string, string) {
+	switch e.Type {
+	case EventSessionCreated:
+		var d SessionCreatedData
+		_ = json.Unmarshal(e.Data, &d)
+		return "lifecycle", fmt.Sprintf("created: %s (in %s)", strings.Join(d.Command, " "), d.WorkingDir)
+	case EventSessionStatus:
+		var d SessionStatusData
+		_ = json.Unmarshal(e.Data, &d)
+		s := d.From + " -> " + d.To
+		if d.ExitCode != nil {
+			s += fmt.Sprintf(", exit code %d", *d.ExitCode)
+		}
+		if d.Reason != "" {
+			s += " (" + d.Reason + ")"
+		}
+		return "lifecycle", s
+	case EventScheduledRun:
+		var d ScheduledRunData
+		_ = json.Unmarshal(e.Data, &d)
+		s := fmt.Sprintf("launched by cron job %s (%s)", d.Job, d.Schedule)
+		if d.Missed {
+			s += ", catching up on a missed run"
+		}
+		return "lifecycle", s
+	case EventDirectMessage:
+		var d DirectMessageData
+		_ = json.Unmarshal(e.Data, &d)
+		if d.From == id {
+			return "message", fmt.Sprintf("sent to %s: %s", peerName(d.To, d.ToName), d.Body)
+		}
+		return "message", fmt.Sprintf("from %s: %s", peerName(d.From, d.FromName), d.Body)
+	case EventRequest:
+		var d RequestData
+		_ = json.Unmarshal(e.Data, &d)
+		if d.From == id {
+			requested[d.RequestID] = true
+			return "approval", fmt.Sprintf("requested from %s: %s", peerName(d.To, d.ToName), d.Body)
+		}
+		return "message", fmt.Sprintf("request from %s: %s", peerName(d.From, d.FromName), d.Body)
+	case EventReply:
+		var d ReplyData
+		_ = json.Unmarshal(e.Data, &d)
+		switch {
+		case d.From == id:
+			return "message", fmt.Sprintf("replied to %s: %s", d.RequestID, d.Body)
+		case requested[d.RequestID]:
+			verdict := "approved"
+			if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(d.Body)), "DENIED") {
+				verdict = "denied"
+			}
+			return "approval", fmt.Sprintf("%s by %s: %s", verdict, peerName(d.From, d.FromName), d.Body)
+		}
+		return "message", fmt.Sprintf("reply from %s: %s", peerName(d.From, d.FromName), d.Body)
+	case EventRateLimited:
+		var d RateLimitedData
+		_ = json.Unmarshal(e.Data, &d)
+		return "message", fmt.Sprintf("%s from %s to %s refused (%s limit)", d.Kind, peerName(d.From, d.FromName), peerName(d.To, d.ToName), d.Reason)
+	case EventAlert:
+		var d AlertData
+		_ = json.Unmarshal(e.Data, &d)
+		return "alert", fmt.Sprintf("output matched %q: %s", d.Pattern, d.Line)
+	case EventAutoResponded:
+		var d AutoRespondedData
+		_ = json.Unmarshal(e.Data, &d)
+		return "alert", fmt.Sprintf("auto-responded %q to %q", d.Response, d.Match)
+	case EventToolResult:
+		var d ToolResultData
+		_ = json.Unmarshal(e.Data, &d)
+		return "agent", fmt.Sprintf("used %s (%d byte response)", d.Tool, d.ResponseBytes)
+	case EventAgentStopped:
+		return "agent", "agent stopped"
+	case EventBudgetExceeded:
+		var d BudgetExceededData
+		_ = json.Unmarshal(e.Data, &d)
+		return "budget", fmt.Sprintf("%s blocked: %s budget of %d used up", d.Tool, d.Budget, d.Limit)
+	case EventCost:
+		var d CostData
+		_ = json.Unmarshal(e.Data, &d)
+		if d.Budget == "" {
+			return "", ""
+		}
+		return "budget", fmt.Sprintf("spent $%.2f, over the %s limit of $%.2f (%s)", d.Spent, d.Budget, d.Limit, d.Action)
+	case EventGitDirty:
+		var d GitDirtyData
+		_ = json.Unmarshal(e.Data, &d)
+		return "git", fmt.Sprintf("exited with %d uncommitted files on %s", d.Changed, d.Branch)
+	case EventOutputSummary, EventInput:
+		return "", ""
+	}
+	return "event", string(e.Type)
+}
+
+// peerName names session id in a timeline, given its name if known.
+func peerName(id uint32, name string) string {
+	switch {
+	case name != "":
+		return name
+	case id == 0:
+		return "cw"
+	}
+	return fmt.Sprintf("session %d", id)
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTimeline(t *testing.T) {
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create session manager: %v", err)
+	}
+	worker := launchSleepSession(t, sm)
+	gateway := launchSleepSession(t, sm)
+
+	if _, err := sm.SendMessage(gateway, worker, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	for _, reply := range []string{"APPROVED", "DENIED: no rm -rf"} {
+		requestID, _, err := sm.SendRequest(worker, gateway, "Bash: rm -rf /tmp/x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sm.SendReply(gateway, requestID, reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.RecordEvent(worker, NewAlertEvent(AlertData{Pattern: "FAIL", Line: "--- FAIL: TestX"})); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := sm.Timeline(worker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds, summaries []string
+	for _, e := range entries {
+		kinds = append(kinds, e.Kind)
+		summaries = append(summaries, e.Summary)
+	}
+	want := []string{"lifecycle", "message", "approval", "approval", "approval", "approval", "alert"}
+	if !slices.Equal(kinds, want) {
+		t.Fatalf("kinds = %v, want %v\n%s", kinds, want, strings.Join(summaries, "\n"))
+	}
+	if !strings.HasPrefix(summaries[0], "created: ") {
+		t.Errorf("first entry = %q, want the session's creation", summaries[0])
+	}
+	if !strings.HasPrefix(summaries[3], "approved by ") || !strings.HasPrefix(summaries[5], "denied by ") {
+		t.Errorf("approval outcomes = %q, %q", summaries[3], summaries[5])
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Time < entries[i-1].Time {
+			t.Errorf("entry %d at %s is before entry %d at %s", i, entries[i].Time, i-1, entries[i-1].Time)
+		}
+	}
+
+	if _, err := sm.Timeline(999); err == nil {
+		t.Error("Timeline of an unknown session succeeded")
+	}
+}
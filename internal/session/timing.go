@@ -0,0 +1,70 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OutputChunk is one PTY read as recorded in a session's output.timing file:
+// when it was written and where its bytes sit in output.log.
+type OutputChunk struct {
+	At     time.Time
+	Offset int64
+	Length int64
+}
+
+// appendTiming records a chunk of length n written to output.log at t. Each
+// line of output.timing is "<unix-nanos> <length>".
+func appendTiming(f *os.File, t time.Time, n int) error {
+	_, err := fmt.Fprintf(f, "%d %d\n", t.UnixNano(), n)
+	return err
+}
+
+// ReadOutputTiming reads a session's output.timing file. Offsets are relative
+// to the first recorded chunk. A torn final line, left by a write cut short,
+// is ignored; any other malformed line leaves the offsets after it unknown,
+// so reading stops there and the chunks before it are returned with an
+// error.
+func ReadOutputTiming(path string) ([]OutputChunk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var chunks []OutputChunk
+	var offset int64
+	r := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err != nil {
+			return chunks, err
+		}
+		tsStr, nStr, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		ts, err1 := strconv.ParseInt(tsStr, 10, 64)
+		n, err2 := strconv.ParseInt(nStr, 10, 64)
+		if !ok || err1 != nil || err2 != nil || n < 0 {
+			return chunks, fmt.Errorf("%s: malformed line %d: %q", path, lineNo, line)
+		}
+		chunks = append(chunks, OutputChunk{At: time.Unix(0, ts).UTC(), Offset: offset, Length: n})
+		offset += n
+	}
+}
+
+// TimingPath returns the path to a session's output timing file.
+func (m *SessionManager) TimingPath(id uint32) (string, error) {
+	logPath, err := m.LogPath(id)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(logPath), "output.timing"), nil
+}
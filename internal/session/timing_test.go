@@ -0,0 +1,106 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputTimingRecorded(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+
+	start := time.Now()
+	id, err := sm.Launch([]string{"bash", "-c", "echo first; sleep 0.3; echo second"}, "/tmp", nil, nil, "")
+	if err != nil {
+		t.Fatalf("Launch failed: %v", err)
+	}
+	t.Cleanup(func() { _ = sm.Kill(id) })
+	time.Sleep(800 * time.Millisecond)
+
+	timingPath, err := sm.TimingPath(id)
+	if err != nil {
+		t.Fatalf("TimingPath: %v", err)
+	}
+	chunks, err := ReadOutputTiming(timingPath)
+	if err != nil {
+		t.Fatalf("ReadOutputTiming: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expected at least 2 chunks, got %d", len(chunks))
+	}
+
+	logPath, _ := sm.LogPath(id)
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("reading log: %v", err)
+	}
+	last := chunks[len(chunks)-1]
+	if got := last.Offset + last.Length; got != int64(len(content)) {
+		t.Fatalf("chunks cover %d bytes, log has %d", got, len(content))
+	}
+
+	var firstAt, secondAt time.Time
+	for _, c := range chunks {
+		if c.At.Before(start) {
+			t.Fatalf("chunk time %v before launch %v", c.At, start)
+		}
+		data := string(content[c.Offset : c.Offset+c.Length])
+		if strings.Contains(data, "first") {
+			firstAt = c.At
+		}
+		if strings.Contains(data, "second") {
+			secondAt = c.At
+		}
+	}
+	if firstAt.IsZero() || secondAt.IsZero() {
+		t.Fatalf("expected both lines in separate chunks, got %q", content)
+	}
+	if secondAt.Sub(firstAt) < 200*time.Millisecond {
+		t.Fatalf("expected second chunk ~300ms after first, got %v", secondAt.Sub(firstAt))
+	}
+}
+
+func TestReadOutputTimingMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.timing")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A torn final line is ignored.
+	write("1000 5\n2000 3\n3000")
+	chunks, err := ReadOutputTiming(path)
+	if err != nil {
+		t.Fatalf("ReadOutputTiming: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(chunks))
+	}
+	if chunks[1].Offset != 5 || chunks[1].Length != 3 {
+		t.Fatalf("unexpected second chunk: %+v", chunks[1])
+	}
+	if !chunks[1].At.Equal(time.Unix(0, 2000)) {
+		t.Fatalf("unexpected second chunk time: %v", chunks[1].At)
+	}
+
+	// A corrupt line in the middle hides the length of the chunk it
+	// recorded, so the offsets after it cannot be trusted.
+	for _, bad := range []string{"bad line", "2000 x", "2000 -3", "2000"} {
+		write("1000 5\n" + bad + "\n3000 4\n")
+		chunks, err := ReadOutputTiming(path)
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%q: expected an error for line 2, got %v", bad, err)
+		}
+		if len(chunks) != 1 || chunks[0].Length != 5 {
+			t.Errorf("%q: expected the first chunk only, got %+v", bad, chunks)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Cost actions: what happens to a session whose agent goes over its cost
+// budget or a tag's cost limit.
+const (
+	// CostKill kills the session.
+	CostKill = "kill"
+	// CostEscalate asks the gateway session (see cw gateway) to approve the
+	// session going on, and kills it if the gateway denies it, does not
+	// answer within costEscalationTimeout or is not running.
+	CostEscalate = "escalate"
+)
+
+// costEscalationTimeout is how long an escalated session waits for the
+// gateway, which may be waiting for a person.
+const costEscalationTimeout = 10 * time.Minute
+
+// gatewayName is the name of the session cw gateway runs.
+const gatewayName = "gateway"
+
+// UsageExtractor reads an agent CLI's token usage and cost from the lines of
+// a session's output. Each pattern's first group is a running total, which
+// may be written with thousands separators, so the latest match wins.
+type UsageExtractor struct {
+	// Agent is the command name (the base of argv[0]) of the sessions the
+	// extractor reads.
+	Agent                           string
+	Cost, InputTokens, OutputTokens *regexp.Regexp
+
+	// parse, if set, reads a whole line, such as a JSON result, and
+	// reports whether it held usage.
+	parse func(line string, u *protocol.Usage) bool
+	// transcript, if set, reads token totals from the transcript the
+	// agent's Stop hook reported.
+	transcript func(path string) (input, output int64)
+}
+
+// NewUsageExtractor compiles an extractor for agent from patterns, any of
+// which may be empty.
+func NewUsageExtractor(agent, cost, inputTokens, outputTokens string) (UsageExtractor, error) {
+	ex := UsageExtractor{Agent: agent}
+	for _, p := range []struct {
+		re      **regexp.Regexp
+		pattern string
+	}{{&ex.Cost, cost}, {&ex.InputTokens, inputTokens}, {&ex.OutputTokens, outputTokens}} {
+		if p.pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(p.pattern)
+		if err != nil {
+			return UsageExtractor{}, fmt.Errorf("invalid usage pattern %q: %w", p.pattern, err)
+		}
+		if re.NumSubexp() < 1 {
+			return UsageExtractor{}, fmt.Errorf("usage pattern %q has no group for the figure", p.pattern)
+		}
+		*p.re = re
+	}
+	return ex, nil
+}
+
+// builtinUsageExtractors read the agent CLIs cw knows. Claude Code's tokens
+// come from the transcript its Stop hook reports (see cw hook), and its cost
+// from the result it prints with --output-format json or stream-json, or the
+// "Total cost" line of /cost. Codex prints a "Token usage" line when it
+// exits, without a cost. aider prints the session's cost after each reply;
+// its token counts there are the reply's only, so they are not read.
+var builtinUsageExtractors = []UsageExtractor{
+	{
+		Agent:      "claude",
+		Cost:       regexp.MustCompile(`Total cost:\s*\$([0-9.]+)`),
+		parse:      claudeResult,
+		transcript: claudeTranscriptTokens,
+	},
+	{
+		Agent:        "codex",
+		InputTokens:  regexp.MustCompile(`Token usage: total=[0-9,]+ input=([0-9,]+)`),
+		OutputTokens: regexp.MustCompile(`Token usage: total=.* output=([0-9,]+)`),
+	},
+	{
+		Agent: "aider",
+		Cost:  regexp.MustCompile(`Cost: \$[0-9.]+ message, \$([0-9.]+) session`),
+	},
+}
+
+// usageExtractor returns the extractor for sessions running command: one of
+// m.UsageExtractors, else a built-in one, else nil.
+func (m *SessionManager) usageExtractor(command []string) *UsageExtractor {
+	if len(command) == 0 {
+		return nil
+	}
+	agent := filepath.Base(command[0])
+	for _, list := range [][]UsageExtractor{m.UsageExtractors, builtinUsageExtractors} {
+		for i := range list {
+			if list[i].Agent == agent {
+				return &list[i]
+			}
+		}
+	}
+	return nil
+}
+
+// usageWatcher applies a session's usage extractor to its output, line by
+// line. feed is only called by the session's PTY reader.
+type usageWatcher struct {
+	ex      *UsageExtractor
+	partial []byte
+
+	mu    sync.Mutex
+	usage protocol.Usage
+	// agentSession is a Claude Code session ID seen in the output and not
+	// yet taken.
+	agentSession string
+}
+
+// newUsageWatcher returns a watcher for a session running command, nil if
+// no extractor reads it.
+func (m *SessionManager) newUsageWatcher(command []string) *usageWatcher {
+	ex := m.usageExtractor(command)
+	if ex == nil {
+		return nil
+	}
+	return &usageWatcher{ex: ex, usage: protocol.Usage{Agent: ex.Agent}}
+}
+
+// feed adds output, returning the usage if a complete line changed it.
+func (w *usageWatcher) feed(data []byte) (protocol.Usage, bool) {
+	w.partial = append(w.partial, data...)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	before := w.usage
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := cleanLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+		if line == "" {
+			continue
+		}
+		if w.ex.Agent == claudeBinary {
+			if id := claudeSessionLine(line); id != "" {
+				w.agentSession = id
+			}
+		}
+		if w.ex.parse != nil && w.ex.parse(line, &w.usage) {
+			continue
+		}
+		if v, ok := matchFigure(w.ex.Cost, line); ok {
+			w.usage.CostUSD = v
+		}
+		if v, ok := matchFigure(w.ex.InputTokens, line); ok {
+			w.usage.InputTokens = int64(v)
+		}
+		if v, ok := matchFigure(w.ex.OutputTokens, line); ok {
+			w.usage.OutputTokens = int64(v)
+		}
+	}
+	if len(w.partial) > alertLineBytes {
+		w.partial = w.partial[len(w.partial)-alertLineBytes:]
+	}
+	return w.usage, w.usage != before
+}
+
+// takeAgentSession returns the Claude Code session ID last seen in the
+// output, once.
+func (w *usageWatcher) takeAgentSession() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := w.agentSession
+	w.agentSession = ""
+	return id
+}
+
+// fromTranscript reads token totals from the transcript in an
+// agent_stopped event, returning the usage if that changed it.
+func (w *usageWatcher) fromTranscript(e Event) (protocol.Usage, bool) {
+	var d AgentStoppedData
+	if w.ex.transcript == nil || json.Unmarshal(e.Data, &d) != nil || d.TranscriptPath == "" {
+		return protocol.Usage{}, false
+	}
+	input, output := w.ex.transcript(d.TranscriptPath)
+	if input == 0 && output == 0 {
+		return protocol.Usage{}, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	before := w.usage
+	w.usage.InputTokens, w.usage.OutputTokens = input, output
+	return w.usage, w.usage != before
+}
+
+// matchFigure returns the number in re's first group in line.
+func matchFigure(re *regexp.Regexp, line string) (float64, bool) {
+	if re == nil {
+		return 0, false
+	}
+	m := re.FindStringSubmatch(line)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64)
+	return v, err == nil
+}
+
+// claudeTokens is the usage Claude reports for a message or a whole run.
+// Cached input counts as input.
+type claudeTokens struct {
+	InputTokens              int64 `json:"input_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+}
+
+func (t claudeTokens) input() int64 {
+	return t.InputTokens + t.CacheCreationInputTokens + t.CacheReadInputTokens
+}
+
+// claudeResult reads the result Claude Code prints last with
+// --output-format json or stream-json.
+func claudeResult(line string, u *protocol.Usage) bool {
+	if !strings.HasPrefix(line, "{") {
+		return false
+	}
+	var result struct {
+		Type         string       `json:"type"`
+		TotalCostUSD float64      `json:"total_cost_usd"`
+		Usage        claudeTokens `json:"usage"`
+	}
+	if json.Unmarshal([]byte(line), &result) != nil || result.Type != "result" {
+		return false
+	}
+	u.CostUSD = result.TotalCostUSD
+	u.InputTokens, u.OutputTokens = result.Usage.input(), result.Usage.OutputTokens
+	return true
+}
+
+// claudeTranscriptTokens totals the usage of the assistant messages in a
+// Claude Code transcript. A message split over several lines repeats its
+// usage on each, so it is counted once.
+func claudeTranscriptTokens(path string) (input, output int64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	usage := map[string]claudeTokens{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var entry struct {
+			Type    string `json:"type"`
+			Message struct {
+				ID    string       `json:"id"`
+				Usage claudeTokens `json:"usage"`
+			} `json:"message"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil || entry.Type != "assistant" {
+			continue
+		}
+		usage[entry.Message.ID] = entry.Message.Usage
+	}
+	for _, t := range usage {
+		input += t.input()
+		output += t.OutputTokens
+	}
+	return input, output
+}
+
+// recordUsage saves what sess's agent has reported using, records a
+// session.cost event, and enforces the cost limits.
+func (m *SessionManager) recordUsage(sess *Session, u protocol.Usage) {
+	sess.mu.Lock()
+	sess.Meta.Usage = &u
+	sess.mu.Unlock()
+	m.triggerPersist()
+	m.costEvent(sess, CostData{Usage: u})
+	m.enforceCost(sess, u)
+}
+
+func (m *SessionManager) costEvent(sess *Session, d CostData) {
+	event := NewCostEvent(d)
+	if sess.eventLog != nil {
+		sess.eventLog.Append(event)
+	}
+	m.Subscriptions.Publish(sess.Meta.ID, sess.Meta.Tags, sess.Meta.Labels, event)
+}
+
+// enforceCost acts on the first cost limit sess is over, unless it already
+// has: its budget's Cost, then the CostTagLimits of its tags, which count
+// the cost of all the sessions with the tag.
+func (m *SessionManager) enforceCost(sess *Session, u protocol.Usage) {
+	sess.mu.Lock()
+	budget, tags := sess.Meta.Budget, sess.Meta.Tags
+	sess.mu.Unlock()
+
+	d := CostData{Usage: u}
+	if budget != nil && budget.Cost > 0 && u.CostUSD > budget.Cost {
+		d.Budget, d.Limit, d.Spent = "session", budget.Cost, u.CostUSD
+	} else {
+		for _, tag := range tags {
+			limit, ok := m.CostTagLimits[tag]
+			if !ok || limit <= 0 {
+				continue
+			}
+			if spent := m.tagCost(tag); spent > limit {
+				d.Budget, d.Limit, d.Spent = "tag:"+tag, limit, spent
+				break
+			}
+		}
+	}
+	if d.Budget == "" {
+		return
+	}
+	sess.mu.Lock()
+	if sess.costHandled == nil {
+		sess.costHandled = make(map[string]bool)
+	}
+	handled := sess.costHandled[d.Budget]
+	sess.costHandled[d.Budget] = true
+	sess.mu.Unlock()
+	if handled {
+		return
+	}
+
+	d.Action = m.CostAction
+	if d.Action == "" {
+		d.Action = CostKill
+	}
+	m.costEvent(sess, d)
+	if d.Action == CostEscalate {
+		go m.escalateCost(sess.Meta.ID, d)
+		return
+	}
+	go m.killOverBudget(sess.Meta.ID, d, "")
+}
+
+// tagCost totals the cost of the sessions tagged tag.
+func (m *SessionManager) tagCost(tag string) float64 {
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.mu.RUnlock()
+
+	var total float64
+	for _, s := range sessions {
+		s.mu.Lock()
+		if s.Meta.Usage != nil && containsTag(s.Meta.Tags, tag) {
+			total += s.Meta.Usage.CostUSD
+		}
+		s.mu.Unlock()
+	}
+	return total
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// escalateCost asks the gateway whether session id may go on spending past
+// the limit in d, killing it unless the gateway approves.
+func (m *SessionManager) escalateCost(id uint32, d CostData) {
+	m.mu.RLock()
+	gatewayID, ok := m.nameIndex[gatewayName]
+	gateway := m.sessions[gatewayID]
+	m.mu.RUnlock()
+	if !ok || gateway == nil || gateway.statusWatcher.Get().State != "running" {
+		m.killOverBudget(id, d, "no gateway running")
+		return
+	}
+
+	body := fmt.Sprintf("COST: session %d (%s) has spent $%.2f, over the %s limit of $%.2f", id, m.GetName(id), d.Spent, d.Budget, d.Limit)
+	requestID, replyCh, err := m.SendRequest(id, gatewayID, body)
+	if err != nil {
+		m.killOverBudget(id, d, err.Error())
+		return
+	}
+	select {
+	case reply := <-replyCh:
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(reply.Body)), "DENIED") {
+			m.killOverBudget(id, d, "gateway denied it")
+			return
+		}
+		slog.Info("gateway approved session over its cost limit", "id", id, "budget", d.Budget)
+	case <-time.After(costEscalationTimeout):
+		m.CleanupRequest(requestID)
+		m.killOverBudget(id, d, "gateway did not answer")
+	}
+}
+
+func (m *SessionManager) killOverBudget(id uint32, d CostData, why string) {
+	slog.Warn("killing session over its cost limit", "id", id, "budget", d.Budget, "limit", d.Limit, "spent", d.Spent, "why", why)
+	if err := m.Kill(id); err != nil {
+		slog.Warn("killing session over its cost limit failed", "id", id, "err", err)
+	}
+}
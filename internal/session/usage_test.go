@@ -0,0 +1,143 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestClaudeUsage(t *testing.T) {
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	w := sm.newUsageWatcher([]string{"/usr/local/bin/claude", "-p", "hi"})
+	if w == nil {
+		t.Fatal("no usage watcher for claude")
+	}
+
+	u, changed := w.feed([]byte("working...\n  Total cost:            $0.4200\n"))
+	if !changed || u != (protocol.Usage{Agent: "claude", CostUSD: 0.42}) {
+		t.Errorf("usage after /cost = %+v, %v", u, changed)
+	}
+
+	transcript := filepath.Join(t.TempDir(), "transcript.jsonl")
+	lines := `{"type":"user","message":{"content":"hi"}}
+{"type":"assistant","message":{"id":"msg_1","usage":{"input_tokens":10,"cache_read_input_tokens":90,"output_tokens":5}}}
+{"type":"assistant","message":{"id":"msg_1","usage":{"input_tokens":10,"cache_read_input_tokens":90,"output_tokens":5}}}
+{"type":"assistant","message":{"id":"msg_2","usage":{"input_tokens":20,"output_tokens":7}}}
+`
+	if err := os.WriteFile(transcript, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	u, changed = w.fromTranscript(NewAgentStoppedEvent("abc", transcript))
+	if !changed || u != (protocol.Usage{Agent: "claude", InputTokens: 120, OutputTokens: 12, CostUSD: 0.42}) {
+		t.Errorf("usage after the transcript = %+v, %v", u, changed)
+	}
+
+	u, _ = w.feed([]byte(`{"type":"result","total_cost_usd":1.5,"usage":{"input_tokens":300,"output_tokens":40}}` + "\n"))
+	if u != (protocol.Usage{Agent: "claude", InputTokens: 300, OutputTokens: 40, CostUSD: 1.5}) {
+		t.Errorf("usage after the result = %+v", u)
+	}
+}
+
+func TestBuiltinUsageExtractors(t *testing.T) {
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	if sm.newUsageWatcher([]string{"bash"}) != nil {
+		t.Error("usage watcher for bash")
+	}
+
+	u, _ := sm.newUsageWatcher([]string{"codex"}).feed([]byte("Token usage: total=1,500 input=1,200 (+ 800 cached) output=300\n"))
+	if u.InputTokens != 1200 || u.OutputTokens != 300 {
+		t.Errorf("codex usage = %+v", u)
+	}
+	u, _ = sm.newUsageWatcher([]string{"aider"}).feed([]byte(
+		"Tokens: 2.1k sent, 120 received. Cost: $0.01 message, $0.01 session.\n" +
+			"Tokens: 3.4k sent, 200 received. Cost: $0.02 message, $0.03 session.\n"))
+	if u.CostUSD != 0.03 {
+		t.Errorf("aider cost = %v, want 0.03", u.CostUSD)
+	}
+
+	// A configured extractor takes precedence over the built-in one.
+	ex, err := NewUsageExtractor("aider", `spent \$([0-9.]+)`, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.UsageExtractors = []UsageExtractor{ex}
+	u, _ = sm.newUsageWatcher([]string{"aider"}).feed([]byte("spent $7.25\n"))
+	if u.CostUSD != 7.25 {
+		t.Errorf("configured aider cost = %v, want 7.25", u.CostUSD)
+	}
+	if _, err := NewUsageExtractor("x", `spent \$[0-9.]+`, "", ""); err == nil {
+		t.Error("pattern without a group accepted")
+	}
+}
+
+func TestCostBudgetKills(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewSessionManager(dir)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	ex, err := NewUsageExtractor("sh", `spent \$([0-9.]+)`, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.UsageExtractors = []UsageExtractor{ex}
+	sub := sm.Subscriptions.Subscribe(nil, nil, nil, []EventType{EventCost})
+	defer sm.Subscriptions.Unsubscribe(sub.ID)
+
+	id, err := sm.LaunchWith(LaunchOptions{
+		Command:    []string{"sh", "-c", "echo spent \\$0.50; sleep 0.5; echo spent \\$2.50; sleep 30"},
+		WorkingDir: dir,
+	})
+	if err != nil {
+		t.Fatalf("LaunchWith: %v", err)
+	}
+	t.Cleanup(func() { _ = sm.Kill(id) })
+	if err := sm.SetBudget(id, protocol.Budget{Cost: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	var over CostData
+	for over.Budget == "" {
+		select {
+		case se := <-sub.Ch:
+			var d CostData
+			if err := json.Unmarshal(se.Event.Data, &d); err != nil {
+				t.Fatal(err)
+			}
+			if d.Budget != "" {
+				over = d
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("no over-budget session.cost event")
+		}
+	}
+	if over.Budget != "session" || over.Limit != 1 || over.Spent != 2.5 || over.Action != CostKill {
+		t.Errorf("over-budget event = %+v", over)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		st, err := sm.Stats(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Status != "running" {
+			if st.CostUSD != 2.5 || st.Agent != "sh" {
+				t.Errorf("stats = %+v", st)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session over its cost budget still running")
+		}
+	}
+}
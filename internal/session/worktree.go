@@ -0,0 +1,283 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// worktreesFile records, in the data directory, the git worktrees created
+// by cw run --worktree. The worktrees themselves live in worktreesDir.
+const (
+	worktreesFile = "worktrees.json"
+	worktreesDir  = "worktrees"
+)
+
+// gitCommandTimeout bounds git commands that change worktrees or merge.
+const gitCommandTimeout = 60 * time.Second
+
+// worktreeRecord is one entry of worktrees.json.
+type worktreeRecord struct {
+	Name      string    `json:"name"`
+	Repo      string    `json:"repo"`
+	Path      string    `json:"path"`
+	Base      string    `json:"base"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// runGit runs git in dir and returns its trimmed output. Errors carry
+// git's own message.
+func runGit(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	text := strings.TrimSpace(string(out))
+	if err != nil {
+		if text == "" {
+			text = err.Error()
+		}
+		return text, fmt.Errorf("git %s: %s", args[0], text)
+	}
+	return text, nil
+}
+
+func (m *SessionManager) loadWorktrees() ([]worktreeRecord, error) {
+	data, err := os.ReadFile(filepath.Join(m.dataDir, worktreesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []worktreeRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", worktreesFile, err)
+	}
+	return records, nil
+}
+
+func (m *SessionManager) saveWorktrees(records []worktreeRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(m.dataDir, worktreesFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// findWorktree returns the index of the worktree called name, or -1.
+func findWorktree(records []worktreeRecord, name string) int {
+	return slices.IndexFunc(records, func(r worktreeRecord) bool { return r.Name == name })
+}
+
+// prepareWorktree returns the directory a session launched with
+// --worktree name in workingDir runs in. On first use it creates the
+// worktree from workingDir's repository, on a branch called name (reusing
+// the branch if it exists); later launches with the same name share it.
+// A workingDir below the repository's top level maps to the same
+// subdirectory of the worktree.
+func (m *SessionManager) prepareWorktree(name, workingDir string) (string, error) {
+	if _, err := runGit(workingDir, "check-ref-format", "--branch", name); err != nil || strings.HasPrefix(name, "-") {
+		return "", fmt.Errorf("invalid worktree name %q: must be a valid branch name", name)
+	}
+	repo, err := runGit(workingDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("--worktree needs a git repository: %s is not in one", workingDir)
+	}
+	sub, err := filepath.Rel(repo, workingDir)
+	if err != nil || strings.HasPrefix(sub, "..") {
+		sub = "."
+	}
+
+	m.worktreesMu.Lock()
+	defer m.worktreesMu.Unlock()
+
+	records, err := m.loadWorktrees()
+	if err != nil {
+		return "", err
+	}
+	if i := findWorktree(records, name); i >= 0 {
+		r := records[i]
+		if r.Repo != repo && r.Path != repo {
+			return "", fmt.Errorf("worktree %s belongs to %s", name, r.Repo)
+		}
+		if _, err := os.Stat(r.Path); err != nil {
+			return "", fmt.Errorf("worktree %s is missing at %s; remove it with cw worktree clean %s", name, r.Path, name)
+		}
+		return worktreeSubdir(r.Path, sub)
+	}
+	if slices.ContainsFunc(records, func(r worktreeRecord) bool { return r.Path == repo }) {
+		return "", fmt.Errorf("%s is already a session worktree; run from the main checkout", repo)
+	}
+
+	base, err := runGit(repo, "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("repository %s has no commits yet", repo)
+	}
+	path := filepath.Join(m.dataDir, worktreesDir, filepath.Base(repo)+"-"+strings.ReplaceAll(name, "/", "-"))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	args := []string{"worktree", "add", "-b", name, path, "HEAD"}
+	if _, err := runGit(repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+name); err == nil {
+		args = []string{"worktree", "add", path, name}
+	}
+	if _, err := runGit(repo, args...); err != nil {
+		return "", err
+	}
+
+	records = append(records, worktreeRecord{
+		Name:      name,
+		Repo:      repo,
+		Path:      path,
+		Base:      base,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err := m.saveWorktrees(records); err != nil {
+		return "", err
+	}
+	return worktreeSubdir(path, sub)
+}
+
+// worktreeSubdir returns subdirectory sub of worktree path, creating it
+// when git did not check it out because it holds no tracked files.
+func worktreeSubdir(path, sub string) (string, error) {
+	dir := filepath.Join(path, sub)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// worktreeSessions returns the running and queued sessions in worktree
+// name.
+func (m *SessionManager) worktreeSessions(name string) []uint32 {
+	ids := m.liveSessions(func(s *Session) bool { return s.Meta.Worktree == name })
+	slices.Sort(ids)
+	return ids
+}
+
+// Worktrees lists the session worktrees, with their live sessions and git
+// state.
+func (m *SessionManager) Worktrees() ([]protocol.Worktree, error) {
+	m.worktreesMu.Lock()
+	records, err := m.loadWorktrees()
+	m.worktreesMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]protocol.Worktree, 0, len(records))
+	for _, r := range records {
+		out = append(out, protocol.Worktree{
+			Name:      r.Name,
+			Repo:      r.Repo,
+			Path:      r.Path,
+			Base:      r.Base,
+			CreatedAt: r.CreatedAt.Format(time.RFC3339),
+			Sessions:  m.worktreeSessions(r.Name),
+			Git:       m.git.get(r.Path),
+		})
+	}
+	return out, nil
+}
+
+// lockedWorktree returns worktree name's record, refusing while sessions
+// still run in it. The caller holds m.worktreesMu.
+func (m *SessionManager) lockedWorktree(name string) ([]worktreeRecord, int, error) {
+	records, err := m.loadWorktrees()
+	if err != nil {
+		return nil, 0, err
+	}
+	i := findWorktree(records, name)
+	if i < 0 {
+		return nil, 0, fmt.Errorf("worktree %s not found", name)
+	}
+	if ids := m.worktreeSessions(name); len(ids) > 0 {
+		return nil, 0, fmt.Errorf("worktree %s is in use by session %d; wait for it to finish or kill it", name, ids[0])
+	}
+	return records, i, nil
+}
+
+// MergeWorktree merges worktree name's branch into the branch checked out
+// in its repository's main checkout, with a merge commit. The worktree must
+// have no uncommitted changes. A merge that conflicts is aborted, leaving
+// the main checkout as it was. It returns the branch merged into.
+func (m *SessionManager) MergeWorktree(name string) (string, error) {
+	m.worktreesMu.Lock()
+	defer m.worktreesMu.Unlock()
+
+	records, i, err := m.lockedWorktree(name)
+	if err != nil {
+		return "", err
+	}
+	r := records[i]
+	if info := m.git.refresh(r.Path); info != nil && info.Dirty {
+		return "", fmt.Errorf("worktree %s has %d uncommitted files; commit or discard them first", name, info.Changed)
+	}
+	into, err := runGit(r.Repo, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("%s has a detached HEAD; check out the branch to merge into", r.Repo)
+	}
+	if into == name {
+		return "", fmt.Errorf("%s has %s checked out itself", r.Repo, name)
+	}
+	if _, err := runGit(r.Repo, "merge", "--no-ff", "--no-edit", "-m", fmt.Sprintf("Merge worktree %s", name), name); err != nil {
+		_, _ = runGit(r.Repo, "merge", "--abort")
+		return "", fmt.Errorf("merging %s into %s failed, nothing was changed: %w", name, into, err)
+	}
+	m.git.refresh(r.Repo)
+	return into, nil
+}
+
+// RemoveWorktree deletes worktree name and its branch. Unless force is set,
+// the branch must already be merged into the main checkout's HEAD and the
+// worktree must have no uncommitted changes.
+func (m *SessionManager) RemoveWorktree(name string, force bool) error {
+	m.worktreesMu.Lock()
+	defer m.worktreesMu.Unlock()
+
+	records, i, err := m.lockedWorktree(name)
+	if err != nil {
+		return err
+	}
+	r := records[i]
+	if !force {
+		if _, err := runGit(r.Repo, "merge-base", "--is-ancestor", name, "HEAD"); err != nil {
+			return fmt.Errorf("branch %s is not merged; run cw worktree merge %s, or clean with --force to discard it", name, name)
+		}
+	}
+
+	if _, err := os.Stat(r.Path); err == nil {
+		args := []string{"worktree", "remove", r.Path}
+		if force {
+			args = []string{"worktree", "remove", "--force", r.Path}
+		}
+		if _, err := runGit(r.Repo, args...); err != nil {
+			return err
+		}
+	} else {
+		_, _ = runGit(r.Repo, "worktree", "prune")
+	}
+	if _, err := runGit(r.Repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+name); err == nil {
+		if _, err := runGit(r.Repo, "branch", "-D", name); err != nil {
+			return err
+		}
+	}
+
+	records = slices.Delete(records, i, i+1)
+	return m.saveWorktrees(records)
+}
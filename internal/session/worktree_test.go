@@ -0,0 +1,127 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitExited waits for session id's process to exit.
+func waitExited(t *testing.T, sm *SessionManager, id uint32) {
+	t.Helper()
+	sm.mu.RLock()
+	sess := sm.sessions[id]
+	sm.mu.RUnlock()
+	select {
+	case <-sess.exited:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("session %d did not exit", id)
+	}
+}
+
+func TestWorktreeLifecycle(t *testing.T) {
+	repo := initRepo(t)
+	if err := os.Mkdir(filepath.Join(repo, "web"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+
+	// The session runs in the worktree's matching subdirectory and commits
+	// on the worktree's branch.
+	script := "echo hi > page.html && git add . && git commit -qm page && sleep 1"
+	id, err := sm.LaunchWith(LaunchOptions{
+		Command:    []string{"sh", "-c", script},
+		WorkingDir: filepath.Join(repo, "web"),
+		Worktree:   "feature-x",
+	})
+	if err != nil {
+		t.Fatalf("LaunchWith: %v", err)
+	}
+	info, _, _ := sm.GetStatus(id)
+	if info.Worktree != "feature-x" || !strings.HasSuffix(info.WorkingDir, filepath.Join("worktrees", filepath.Base(repo)+"-feature-x", "web")) {
+		t.Fatalf("session worktree = %q in %s", info.Worktree, info.WorkingDir)
+	}
+
+	if _, err := sm.MergeWorktree("feature-x"); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("expected merge to be refused while the session runs, got %v", err)
+	}
+	waitExited(t, sm, id)
+
+	worktrees, err := sm.Worktrees()
+	if err != nil || len(worktrees) != 1 || worktrees[0].Git == nil || worktrees[0].Git.Branch != "feature-x" {
+		t.Fatalf("Worktrees = %+v, %v", worktrees, err)
+	}
+
+	if err := sm.RemoveWorktree("feature-x", false); err == nil || !strings.Contains(err.Error(), "not merged") {
+		t.Fatalf("expected clean of unmerged branch to be refused, got %v", err)
+	}
+	into, err := sm.MergeWorktree("feature-x")
+	if err != nil || into != "main" {
+		t.Fatalf("MergeWorktree = %q, %v", into, err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "web", "page.html")); err != nil {
+		t.Fatalf("merged file missing from main checkout: %v", err)
+	}
+
+	if err := sm.RemoveWorktree("feature-x", false); err != nil {
+		t.Fatalf("RemoveWorktree: %v", err)
+	}
+	if _, err := os.Stat(worktrees[0].Path); !os.IsNotExist(err) {
+		t.Fatalf("worktree directory still exists: %v", err)
+	}
+	if branches := git(t, repo, "branch", "--list", "feature-x"); branches != "" {
+		t.Fatalf("branch feature-x still exists: %q", branches)
+	}
+	if worktrees, _ := sm.Worktrees(); len(worktrees) != 0 {
+		t.Fatalf("worktree still listed: %+v", worktrees)
+	}
+}
+
+func TestWorktreeMergeConflictAborts(t *testing.T) {
+	repo := initRepo(t)
+	sm, err := NewSessionManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+
+	dir, err := sm.prepareWorktree("fix", repo)
+	if err != nil {
+		t.Fatalf("prepareWorktree: %v", err)
+	}
+	if again, err := sm.prepareWorktree("fix", repo); err != nil || again != dir {
+		t.Fatalf("second prepareWorktree = %q, %v; want shared %q", again, err, dir)
+	}
+	for _, d := range []string{repo, dir} {
+		if err := os.WriteFile(filepath.Join(d, "a.txt"), []byte(d), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git(t, d, "add", "a.txt")
+		git(t, d, "commit", "-qm", "a")
+	}
+	head := git(t, repo, "rev-parse", "HEAD")
+
+	if _, err := sm.MergeWorktree("fix"); err == nil || !strings.Contains(err.Error(), "nothing was changed") {
+		t.Fatalf("expected conflicting merge to fail, got %v", err)
+	}
+	if now := git(t, repo, "rev-parse", "HEAD"); now != head {
+		t.Fatalf("HEAD moved from %s to %s", head, now)
+	}
+	if status := git(t, repo, "status", "--porcelain"); status != "" {
+		t.Fatalf("main checkout left dirty: %q", status)
+	}
+
+	if err := sm.RemoveWorktree("fix", true); err != nil {
+		t.Fatalf("RemoveWorktree --force: %v", err)
+	}
+	if _, err := sm.prepareWorktree("../bad", repo); err == nil {
+		t.Fatal("expected invalid worktree name to be refused")
+	}
+	if _, err := sm.prepareWorktree("x", t.TempDir()); err == nil || !strings.Contains(err.Error(), "git repository") {
+		t.Fatalf("expected non-repository to be refused, got %v", err)
+	}
+}
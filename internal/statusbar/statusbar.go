@@ -12,6 +12,7 @@ type StatusBar struct {
 	Rows      uint16
 	Cols      uint16
 	Enabled   bool
+	DetachKey string // e.g. "Ctrl+B"
 }
 
 func New(sessionID uint32, cols, rows uint16) *StatusBar {
@@ -22,6 +23,7 @@ func New(sessionID uint32, cols, rows uint16) *StatusBar {
 		Rows:      rows,
 		Cols:      cols,
 		Enabled:   rows >= 5,
+		DetachKey: "Ctrl+B",
 	}
 }
 
@@ -88,8 +90,8 @@ func (s *StatusBar) Draw() []byte {
 	elapsed := time.Since(s.Started)
 	age := formatDuration(uint64(elapsed.Seconds()))
 
-	content := fmt.Sprintf(" [cw] session %d | %s | %s | Ctrl+B d",
-		s.SessionID, s.Status, age)
+	content := fmt.Sprintf(" [cw] session %d | %s | %s | %s d",
+		s.SessionID, s.Status, age, s.DetachKey)
 
 	// Pad or truncate to fill the row
 	cols := int(s.Cols)
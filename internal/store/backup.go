@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SQLiteFile is the name of the relay database in its data directory.
+const SQLiteFile = "relay.db"
+
+// SnapshotSQLite writes a consistent copy of the relay database in dataDir
+// to dest, which must not exist. The relay may keep running: the copy is
+// taken in a single read transaction, and includes what is still in the
+// write-ahead log.
+func SnapshotSQLite(ctx context.Context, dataDir, dest string) error {
+	src := filepath.Join(dataDir, SQLiteFile)
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("no relay database to back up: %w", err)
+	}
+	db, err := sql.Open("sqlite", src+"?_busy_timeout=5000")
+	if err != nil {
+		return fmt.Errorf("opening sqlite: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, dest); err != nil {
+		return fmt.Errorf("snapshotting %s: %w", src, err)
+	}
+	return nil
+}
+
+// CheckSQLite verifies that the file at path is an intact relay database,
+// before it is restored in place of the relay's own.
+func CheckSQLite(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("opening sqlite: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("%s is not a SQLite database: %w", path, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%s is corrupt: %s", path, result)
+	}
+	var nodes int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM nodes`).Scan(&nodes); err != nil {
+		return fmt.Errorf("%s is not a relay database: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,1053 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// migrationLockID is the advisory lock held while migrating, so replicas
+// starting together do not race to create the schema.
+const migrationLockID = 0x636f646577697265 // "codewire"
+
+// PostgresStore implements Store on PostgreSQL. Unlike SQLiteStore it can be
+// shared by several relay replicas.
+type PostgresStore struct {
+	db      *sql.DB
+	closeCh chan struct{}
+
+	mu    sync.RWMutex
+	quota KVQuota
+}
+
+// NewPostgresStore connects to the database at url (a postgres:// URL or
+// key=value DSN) and runs schema migrations.
+func NewPostgresStore(ctx context.Context, url string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, fmt.Errorf("opening postgres: %w", err)
+	}
+	db.SetMaxOpenConns(16)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to postgres: %w", err)
+	}
+
+	s := &PostgresStore{
+		db:      db,
+		closeCh: make(chan struct{}),
+	}
+
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating postgres: %w", err)
+	}
+
+	go s.cleanupLoop()
+
+	return s, nil
+}
+
+func (s *PostgresStore) migrate(ctx context.Context) error {
+	migrations := []string{
+		`CREATE TABLE IF NOT EXISTS users (
+			github_id     BIGINT PRIMARY KEY,
+			username      TEXT NOT NULL UNIQUE,
+			avatar_url    TEXT NOT NULL DEFAULT '',
+			created_at    TIMESTAMPTZ NOT NULL,
+			last_login_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS nodes (
+			name          TEXT PRIMARY KEY,
+			token         TEXT NOT NULL UNIQUE,
+			github_id     BIGINT REFERENCES users(github_id),
+			authorized_at TIMESTAMPTZ NOT NULL,
+			last_seen_at  TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS kv (
+			namespace  TEXT NOT NULL,
+			key        TEXT NOT NULL,
+			value      BYTEA NOT NULL,
+			expires_at TIMESTAMPTZ,
+			PRIMARY KEY (namespace, key)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_kv_expires ON kv(expires_at) WHERE expires_at IS NOT NULL`,
+		`CREATE TABLE IF NOT EXISTS device_codes (
+			code       TEXT PRIMARY KEY,
+			public_key TEXT NOT NULL,
+			node_name  TEXT NOT NULL,
+			status     TEXT NOT NULL DEFAULT 'pending',
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS github_app (
+			id             INTEGER PRIMARY KEY CHECK (id = 1),
+			app_id         BIGINT NOT NULL,
+			client_id      TEXT NOT NULL,
+			client_secret  TEXT NOT NULL,
+			pem            TEXT NOT NULL,
+			webhook_secret TEXT NOT NULL DEFAULT '',
+			owner          TEXT NOT NULL,
+			created_at     TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			token      TEXT PRIMARY KEY,
+			github_id  BIGINT NOT NULL REFERENCES users(github_id),
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS oauth_state (
+			state      TEXT PRIMARY KEY,
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS invites (
+			token          TEXT PRIMARY KEY,
+			created_by     BIGINT REFERENCES users(github_id),
+			uses_remaining INTEGER NOT NULL DEFAULT 1,
+			expires_at     TIMESTAMPTZ NOT NULL,
+			created_at     TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS revoked_keys (
+			public_key TEXT PRIMARY KEY,
+			revoked_at TIMESTAMPTZ NOT NULL,
+			reason     TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE TABLE IF NOT EXISTS oidc_users (
+			sub           TEXT PRIMARY KEY,
+			username      TEXT NOT NULL,
+			avatar_url    TEXT NOT NULL DEFAULT '',
+			created_at    TIMESTAMPTZ NOT NULL,
+			last_login_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS oidc_sessions (
+			token      TEXT PRIMARY KEY,
+			sub        TEXT NOT NULL REFERENCES oidc_users(sub) ON DELETE CASCADE,
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS oidc_device_flows (
+			poll_token  TEXT PRIMARY KEY,
+			device_code TEXT NOT NULL UNIQUE,
+			node_name   TEXT NOT NULL DEFAULT '',
+			node_token  TEXT NOT NULL DEFAULT '',
+			expires_at  TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id         BIGSERIAL PRIMARY KEY,
+			time       TIMESTAMPTZ NOT NULL,
+			"user"     TEXT NOT NULL DEFAULT '',
+			node       TEXT NOT NULL DEFAULT '',
+			action     TEXT NOT NULL,
+			session_id TEXT NOT NULL DEFAULT '',
+			result     TEXT NOT NULL,
+			remote_ip  TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_time ON audit_log(time)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log("user", id)`,
+		`CREATE TABLE IF NOT EXISTS approvals (
+			token      TEXT PRIMARY KEY,
+			node_name  TEXT NOT NULL,
+			request_id TEXT NOT NULL,
+			from_name  TEXT NOT NULL DEFAULT '',
+			body       TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS relay_routes (
+			key        TEXT PRIMARY KEY,
+			replica    TEXT NOT NULL,
+			expires_at TIMESTAMPTZ
+		)`,
+		`CREATE TABLE IF NOT EXISTS ssh_keys (
+			node_name   TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			public_key  TEXT NOT NULL,
+			comment     TEXT NOT NULL DEFAULT '',
+			created_at  TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (node_name, fingerprint)
+		)`,
+		`CREATE TABLE IF NOT EXISTS update_channels (
+			name       TEXT PRIMARY KEY,
+			version    TEXT NOT NULL,
+			url        TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMPTZ NOT NULL
+		)`,
+		`ALTER TABLE nodes ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE nodes ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE nodes ADD COLUMN IF NOT EXISTS tags TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE nodes ADD COLUMN IF NOT EXISTS pending_token TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE invites ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE invites ADD COLUMN IF NOT EXISTS tags TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE invites ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE invites ADD COLUMN IF NOT EXISTS expires_after_join BOOLEAN NOT NULL DEFAULT FALSE`,
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("taking migration lock: %w", err)
+	}
+	for _, m := range migrations {
+		if _, err := tx.ExecContext(ctx, m); err != nil {
+			return fmt.Errorf("executing migration: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// cleanupLoop periodically removes expired rows, like SQLiteStore.cleanupLoop.
+// Every replica runs it; the deletes are idempotent.
+func (s *PostgresStore) cleanupLoop() {
+	ticker := time.NewTicker(60 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+			now := time.Now().UTC()
+			s.db.Exec("DELETE FROM kv WHERE expires_at IS NOT NULL AND expires_at < $1", now)
+			s.db.Exec("DELETE FROM device_codes WHERE expires_at < $1", now)
+			s.db.Exec("DELETE FROM sessions WHERE expires_at < $1", now)
+			s.db.Exec("DELETE FROM oauth_state WHERE expires_at < $1", now)
+			s.db.Exec("DELETE FROM invites WHERE expires_at < $1", now)
+			s.db.Exec("DELETE FROM oidc_sessions WHERE expires_at < $1", now)
+			s.db.Exec("DELETE FROM oidc_device_flows WHERE expires_at < $1", now)
+			s.db.Exec("DELETE FROM approvals WHERE expires_at < $1", now)
+			s.db.Exec("DELETE FROM relay_routes WHERE expires_at IS NOT NULL AND expires_at < $1", now)
+			s.db.Exec("DELETE FROM audit_log WHERE time < $1", now.Add(-AuditRetention))
+		}
+	}
+}
+
+// --- KV Store ---
+
+func (s *PostgresStore) SetKVQuota(q KVQuota) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quota = q
+}
+
+func (s *PostgresStore) KVSet(ctx context.Context, namespace, key string, value []byte, ttl *time.Duration) error {
+	s.mu.RLock()
+	quota := s.quota
+	s.mu.RUnlock()
+
+	now := time.Now().UTC()
+	var expiresAt *time.Time
+	if ttl != nil {
+		t := now.Add(*ttl)
+		expiresAt = &t
+	}
+
+	const upsert = `INSERT INTO kv (namespace, key, value, expires_at) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (namespace, key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`
+	if !quota.enabled() {
+		_, err := s.db.ExecContext(ctx, upsert, namespace, key, value, expiresAt)
+		return err
+	}
+
+	// Writers to one namespace queue on an advisory lock so that replicas
+	// checking usage concurrently cannot both squeeze under the quota.
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "kv/"+namespace); err != nil {
+		return err
+	}
+	var keys int
+	var size int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(LENGTH(value)), 0) FROM kv
+		 WHERE namespace = $1 AND key <> $2 AND (expires_at IS NULL OR expires_at > $3)`,
+		namespace, key, now,
+	).Scan(&keys, &size)
+	if err != nil {
+		return err
+	}
+	if err := quota.check(namespace, keys, size, int64(len(value))); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, upsert, namespace, key, value, expiresAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) KVGet(ctx context.Context, namespace, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx,
+		"SELECT value FROM kv WHERE namespace = $1 AND key = $2 AND (expires_at IS NULL OR expires_at > $3)",
+		namespace, key, time.Now().UTC(),
+	).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (s *PostgresStore) KVDelete(ctx context.Context, namespace, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM kv WHERE namespace = $1 AND key = $2", namespace, key)
+	return err
+}
+
+func (s *PostgresStore) KVList(ctx context.Context, namespace, prefix string) ([]KVEntry, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT key, value, expires_at FROM kv WHERE namespace = $1 AND key LIKE $2 AND (expires_at IS NULL OR expires_at > $3)",
+		namespace, prefix+"%", time.Now().UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []KVEntry
+	for rows.Next() {
+		var e KVEntry
+		if err := rows.Scan(&e.Key, &e.Value, &e.ExpiresAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// --- Node Registry ---
+
+func (s *PostgresStore) NodeRegister(ctx context.Context, node NodeRecord) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO nodes (name, token, github_id, authorized_at, last_seen_at, scope, tags)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (name) DO UPDATE SET
+		   token = excluded.token,
+		   pending_token = '',
+		   github_id = excluded.github_id,
+		   authorized_at = excluded.authorized_at,
+		   last_seen_at = excluded.last_seen_at,
+		   scope = excluded.scope,
+		   tags = excluded.tags`,
+		node.Name, node.Token, node.GitHubID, node.AuthorizedAt, node.LastSeenAt, node.Scope, joinTags(node.Tags),
+	)
+	return err
+}
+
+func (s *PostgresStore) NodeList(ctx context.Context) ([]NodeRecord, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, token, github_id, authorized_at, last_seen_at, status, scope, tags, pending_token FROM nodes ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []NodeRecord
+	for rows.Next() {
+		var n NodeRecord
+		var tags string
+		if err := rows.Scan(&n.Name, &n.Token, &n.GitHubID, &n.AuthorizedAt, &n.LastSeenAt, &n.Status, &n.Scope, &tags, &n.PendingToken); err != nil {
+			return nil, err
+		}
+		n.Tags = splitTags(tags)
+		nodes = append(nodes, n)
+	}
+	return nodes, rows.Err()
+}
+
+func (s *PostgresStore) NodeGet(ctx context.Context, name string) (*NodeRecord, error) {
+	var n NodeRecord
+	var tags string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT name, token, github_id, authorized_at, last_seen_at, status, scope, tags, pending_token FROM nodes WHERE name = $1",
+		name,
+	).Scan(&n.Name, &n.Token, &n.GitHubID, &n.AuthorizedAt, &n.LastSeenAt, &n.Status, &n.Scope, &tags, &n.PendingToken)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n.Tags = splitTags(tags)
+	return &n, nil
+}
+
+func (s *PostgresStore) NodeGetByToken(ctx context.Context, token string) (*NodeRecord, error) {
+	if token == "" {
+		return nil, nil // would match every node without a pending token
+	}
+	var n NodeRecord
+	var tags string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT name, token, github_id, authorized_at, last_seen_at, status, scope, tags, pending_token FROM nodes WHERE token = $1 OR pending_token = $1",
+		token,
+	).Scan(&n.Name, &n.Token, &n.GitHubID, &n.AuthorizedAt, &n.LastSeenAt, &n.Status, &n.Scope, &tags, &n.PendingToken)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n.Tags = splitTags(tags)
+	return &n, nil
+}
+
+func (s *PostgresStore) NodeDelete(ctx context.Context, name string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM nodes WHERE name = $1", name); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "DELETE FROM ssh_keys WHERE node_name = $1", name)
+	return err
+}
+
+func (s *PostgresStore) NodeUpdateLastSeen(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE nodes SET last_seen_at = $1 WHERE name = $2", time.Now().UTC(), name)
+	return err
+}
+
+func (s *PostgresStore) NodeUpdateStatus(ctx context.Context, name, status string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE nodes SET status = $1, last_seen_at = $2 WHERE name = $3", status, time.Now().UTC(), name)
+	return err
+}
+
+func (s *PostgresStore) NodeSetPendingToken(ctx context.Context, name, token string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE nodes SET pending_token = $1 WHERE name = $2", token, name)
+	return err
+}
+
+func (s *PostgresStore) NodeCommitToken(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE nodes SET token = pending_token, pending_token = '', authorized_at = $1 WHERE name = $2 AND pending_token != ''",
+		time.Now().UTC(), name,
+	)
+	return err
+}
+
+// --- Device Codes ---
+
+func (s *PostgresStore) DeviceCodeCreate(ctx context.Context, dc DeviceCode) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO device_codes (code, public_key, node_name, status, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		dc.Code, dc.PublicKey, dc.NodeName, dc.Status, dc.CreatedAt, dc.ExpiresAt,
+	)
+	return err
+}
+
+func (s *PostgresStore) DeviceCodeGet(ctx context.Context, code string) (*DeviceCode, error) {
+	var dc DeviceCode
+	err := s.db.QueryRowContext(ctx,
+		"SELECT code, public_key, node_name, status, created_at, expires_at FROM device_codes WHERE code = $1 AND expires_at > $2",
+		code, time.Now().UTC(),
+	).Scan(&dc.Code, &dc.PublicKey, &dc.NodeName, &dc.Status, &dc.CreatedAt, &dc.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dc, nil
+}
+
+func (s *PostgresStore) DeviceCodeConfirm(ctx context.Context, code string) error {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE device_codes SET status = 'authorized' WHERE code = $1 AND status = 'pending' AND expires_at > $2",
+		code, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return fmt.Errorf("device code not found or already confirmed")
+	}
+	return nil
+}
+
+func (s *PostgresStore) DeviceCodeCleanup(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM device_codes WHERE expires_at < $1", time.Now().UTC())
+	return err
+}
+
+// --- GitHub App (singleton) ---
+
+func (s *PostgresStore) GitHubAppGet(ctx context.Context) (*GitHubApp, error) {
+	var app GitHubApp
+	err := s.db.QueryRowContext(ctx,
+		"SELECT app_id, client_id, client_secret, pem, webhook_secret, owner, created_at FROM github_app WHERE id = 1",
+	).Scan(&app.AppID, &app.ClientID, &app.ClientSecret, &app.PEM, &app.WebhookSecret, &app.Owner, &app.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+func (s *PostgresStore) GitHubAppSet(ctx context.Context, app GitHubApp) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO github_app (id, app_id, client_id, client_secret, pem, webhook_secret, owner, created_at)
+		 VALUES (1, $1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (id) DO UPDATE SET
+		   app_id = excluded.app_id,
+		   client_id = excluded.client_id,
+		   client_secret = excluded.client_secret,
+		   pem = excluded.pem,
+		   webhook_secret = excluded.webhook_secret,
+		   owner = excluded.owner`,
+		app.AppID, app.ClientID, app.ClientSecret, app.PEM, app.WebhookSecret, app.Owner, app.CreatedAt,
+	)
+	return err
+}
+
+// --- Users ---
+
+func (s *PostgresStore) UserUpsert(ctx context.Context, user User) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO users (github_id, username, avatar_url, created_at, last_login_at)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (github_id) DO UPDATE SET
+		   username = excluded.username,
+		   avatar_url = excluded.avatar_url,
+		   last_login_at = excluded.last_login_at`,
+		user.GitHubID, user.Username, user.AvatarURL, user.CreatedAt, user.LastLoginAt,
+	)
+	return err
+}
+
+func (s *PostgresStore) UserGetByID(ctx context.Context, githubID int64) (*User, error) {
+	var u User
+	err := s.db.QueryRowContext(ctx,
+		"SELECT github_id, username, avatar_url, created_at, last_login_at FROM users WHERE github_id = $1",
+		githubID,
+	).Scan(&u.GitHubID, &u.Username, &u.AvatarURL, &u.CreatedAt, &u.LastLoginAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *PostgresStore) UserGetByUsername(ctx context.Context, username string) (*User, error) {
+	var u User
+	err := s.db.QueryRowContext(ctx,
+		"SELECT github_id, username, avatar_url, created_at, last_login_at FROM users WHERE username = $1",
+		username,
+	).Scan(&u.GitHubID, &u.Username, &u.AvatarURL, &u.CreatedAt, &u.LastLoginAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// --- Sessions ---
+
+func (s *PostgresStore) SessionCreate(ctx context.Context, sess Session) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO sessions (token, github_id, created_at, expires_at) VALUES ($1, $2, $3, $4)",
+		sess.Token, sess.GitHubID, sess.CreatedAt, sess.ExpiresAt,
+	)
+	return err
+}
+
+func (s *PostgresStore) SessionGet(ctx context.Context, token string) (*Session, error) {
+	var sess Session
+	err := s.db.QueryRowContext(ctx,
+		"SELECT token, github_id, created_at, expires_at FROM sessions WHERE token = $1 AND expires_at > $2",
+		token, time.Now().UTC(),
+	).Scan(&sess.Token, &sess.GitHubID, &sess.CreatedAt, &sess.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *PostgresStore) SessionDelete(ctx context.Context, token string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE token = $1", token)
+	return err
+}
+
+func (s *PostgresStore) SessionDeleteByUser(ctx context.Context, githubID int64) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE github_id = $1", githubID)
+	return err
+}
+
+// --- OAuth State ---
+
+func (s *PostgresStore) OAuthStateCreate(ctx context.Context, state OAuthState) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO oauth_state (state, created_at, expires_at) VALUES ($1, $2, $3)",
+		state.State, state.CreatedAt, state.ExpiresAt,
+	)
+	return err
+}
+
+func (s *PostgresStore) OAuthStateConsume(ctx context.Context, state string) error {
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM oauth_state WHERE state = $1 AND expires_at > $2",
+		state, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return fmt.Errorf("oauth state not found or expired")
+	}
+	return nil
+}
+
+// --- Invites ---
+
+func (s *PostgresStore) InviteCreate(ctx context.Context, invite Invite) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO invites (token, created_by, uses_remaining, expires_at, created_at, name, tags, scope, expires_after_join) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		invite.Token, invite.CreatedBy, invite.UsesRemaining, invite.ExpiresAt, invite.CreatedAt, invite.Name, joinTags(invite.Tags), invite.Scope, invite.ExpiresAfterJoin,
+	)
+	return err
+}
+
+func (s *PostgresStore) InviteGet(ctx context.Context, token string) (*Invite, error) {
+	var inv Invite
+	var tags string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT token, created_by, uses_remaining, expires_at, created_at, name, tags, scope, expires_after_join FROM invites WHERE token = $1 AND expires_at > $2",
+		token, time.Now().UTC(),
+	).Scan(&inv.Token, &inv.CreatedBy, &inv.UsesRemaining, &inv.ExpiresAt, &inv.CreatedAt, &inv.Name, &tags, &inv.Scope, &inv.ExpiresAfterJoin)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	inv.Tags = splitTags(tags)
+	return &inv, nil
+}
+
+func (s *PostgresStore) InviteConsume(ctx context.Context, token string) error {
+	now := time.Now().UTC()
+
+	// The conditional decrement is atomic, so replicas racing to redeem the
+	// last use of an invite cannot both succeed.
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE invites SET uses_remaining = uses_remaining - 1 WHERE token = $1 AND uses_remaining > 0 AND expires_at > $2",
+		token, now,
+	)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return fmt.Errorf("invite not found, expired, or no uses remaining")
+	}
+
+	s.db.ExecContext(ctx, "DELETE FROM invites WHERE token = $1 AND uses_remaining <= 0", token)
+	return nil
+}
+
+func (s *PostgresStore) InviteList(ctx context.Context) ([]Invite, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT token, created_by, uses_remaining, expires_at, created_at, name, tags, scope, expires_after_join FROM invites WHERE expires_at > $1 ORDER BY created_at",
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []Invite
+	for rows.Next() {
+		var inv Invite
+		var tags string
+		if err := rows.Scan(&inv.Token, &inv.CreatedBy, &inv.UsesRemaining, &inv.ExpiresAt, &inv.CreatedAt, &inv.Name, &tags, &inv.Scope, &inv.ExpiresAfterJoin); err != nil {
+			return nil, err
+		}
+		inv.Tags = splitTags(tags)
+		invites = append(invites, inv)
+	}
+	return invites, rows.Err()
+}
+
+func (s *PostgresStore) InviteDelete(ctx context.Context, token string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM invites WHERE token = $1", token)
+	return err
+}
+
+// --- Revoked Keys ---
+
+func (s *PostgresStore) RevokedKeyAdd(ctx context.Context, key RevokedKey) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO revoked_keys (public_key, revoked_at, reason) VALUES ($1, $2, $3)
+		 ON CONFLICT (public_key) DO UPDATE SET revoked_at = excluded.revoked_at, reason = excluded.reason`,
+		key.PublicKey, key.RevokedAt, key.Reason,
+	)
+	return err
+}
+
+func (s *PostgresStore) RevokedKeyCheck(ctx context.Context, publicKey string) (bool, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM revoked_keys WHERE public_key = $1", publicKey).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// --- OIDC Users ---
+
+func (s *PostgresStore) OIDCUserUpsert(ctx context.Context, user OIDCUser) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO oidc_users (sub, username, avatar_url, created_at, last_login_at)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (sub) DO UPDATE SET
+		   username = excluded.username,
+		   avatar_url = excluded.avatar_url,
+		   last_login_at = excluded.last_login_at`,
+		user.Sub, user.Username, user.AvatarURL, user.CreatedAt, user.LastLoginAt,
+	)
+	return err
+}
+
+func (s *PostgresStore) OIDCUserGetBySub(ctx context.Context, sub string) (*OIDCUser, error) {
+	var u OIDCUser
+	err := s.db.QueryRowContext(ctx,
+		"SELECT sub, username, avatar_url, created_at, last_login_at FROM oidc_users WHERE sub = $1",
+		sub,
+	).Scan(&u.Sub, &u.Username, &u.AvatarURL, &u.CreatedAt, &u.LastLoginAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// --- OIDC Sessions ---
+
+func (s *PostgresStore) OIDCSessionCreate(ctx context.Context, sess OIDCSession) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO oidc_sessions (token, sub, created_at, expires_at) VALUES ($1, $2, $3, $4)",
+		sess.Token, sess.Sub, sess.CreatedAt, sess.ExpiresAt,
+	)
+	return err
+}
+
+func (s *PostgresStore) OIDCSessionGet(ctx context.Context, token string) (*OIDCSession, error) {
+	var sess OIDCSession
+	err := s.db.QueryRowContext(ctx,
+		"SELECT token, sub, created_at, expires_at FROM oidc_sessions WHERE token = $1 AND expires_at > $2",
+		token, time.Now().UTC(),
+	).Scan(&sess.Token, &sess.Sub, &sess.CreatedAt, &sess.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *PostgresStore) OIDCSessionDelete(ctx context.Context, token string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM oidc_sessions WHERE token = $1", token)
+	return err
+}
+
+// --- OIDC Device Flows ---
+
+func (s *PostgresStore) OIDCDeviceFlowCreate(ctx context.Context, flow OIDCDeviceFlow) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO oidc_device_flows (poll_token, device_code, node_name, node_token, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		flow.PollToken, flow.DeviceCode, flow.NodeName, flow.NodeToken, flow.ExpiresAt,
+	)
+	return err
+}
+
+func (s *PostgresStore) OIDCDeviceFlowGet(ctx context.Context, pollToken string) (*OIDCDeviceFlow, error) {
+	var flow OIDCDeviceFlow
+	err := s.db.QueryRowContext(ctx,
+		"SELECT poll_token, device_code, node_name, node_token, expires_at FROM oidc_device_flows WHERE poll_token = $1 AND expires_at > $2",
+		pollToken, time.Now().UTC(),
+	).Scan(&flow.PollToken, &flow.DeviceCode, &flow.NodeName, &flow.NodeToken, &flow.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &flow, nil
+}
+
+func (s *PostgresStore) OIDCDeviceFlowComplete(ctx context.Context, pollToken, nodeToken string) error {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE oidc_device_flows SET node_token = $1 WHERE poll_token = $2 AND expires_at > $3",
+		nodeToken, pollToken, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return fmt.Errorf("oidc device flow not found or expired")
+	}
+	return nil
+}
+
+// --- Approvals ---
+
+func (s *PostgresStore) ApprovalCreate(ctx context.Context, a Approval) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO approvals (token, node_name, request_id, from_name, body, expires_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		a.Token, a.NodeName, a.RequestID, a.From, a.Body, a.ExpiresAt,
+	)
+	return err
+}
+
+func (s *PostgresStore) ApprovalGet(ctx context.Context, token string) (*Approval, error) {
+	var a Approval
+	err := s.db.QueryRowContext(ctx,
+		"SELECT token, node_name, request_id, from_name, body, expires_at FROM approvals WHERE token = $1 AND expires_at > $2",
+		token, time.Now().UTC(),
+	).Scan(&a.Token, &a.NodeName, &a.RequestID, &a.From, &a.Body, &a.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *PostgresStore) ApprovalTake(ctx context.Context, token string) (*Approval, error) {
+	var a Approval
+	err := s.db.QueryRowContext(ctx,
+		"DELETE FROM approvals WHERE token = $1 AND expires_at > $2 RETURNING token, node_name, request_id, from_name, body, expires_at",
+		token, time.Now().UTC(),
+	).Scan(&a.Token, &a.NodeName, &a.RequestID, &a.From, &a.Body, &a.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// --- SSH Keys ---
+
+func (s *PostgresStore) SSHKeyAdd(ctx context.Context, key SSHKey) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO ssh_keys (node_name, fingerprint, public_key, comment, created_at) VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (node_name, fingerprint) DO UPDATE SET comment = excluded.comment`,
+		key.NodeName, key.Fingerprint, key.PublicKey, key.Comment, key.CreatedAt,
+	)
+	return err
+}
+
+func (s *PostgresStore) SSHKeyGet(ctx context.Context, nodeName, fingerprint string) (*SSHKey, error) {
+	var k SSHKey
+	err := s.db.QueryRowContext(ctx,
+		"SELECT node_name, fingerprint, public_key, comment, created_at FROM ssh_keys WHERE node_name = $1 AND fingerprint = $2",
+		nodeName, fingerprint,
+	).Scan(&k.NodeName, &k.Fingerprint, &k.PublicKey, &k.Comment, &k.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (s *PostgresStore) SSHKeyList(ctx context.Context, nodeName string) ([]SSHKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT node_name, fingerprint, public_key, comment, created_at FROM ssh_keys WHERE node_name = $1 ORDER BY created_at",
+		nodeName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []SSHKey
+	for rows.Next() {
+		var k SSHKey
+		if err := rows.Scan(&k.NodeName, &k.Fingerprint, &k.PublicKey, &k.Comment, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *PostgresStore) SSHKeyDelete(ctx context.Context, nodeName, fingerprint string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM ssh_keys WHERE node_name = $1 AND fingerprint = $2", nodeName, fingerprint)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// --- Update Channels ---
+
+func (s *PostgresStore) UpdateChannelSet(ctx context.Context, ch UpdateChannel) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO update_channels (name, version, url, updated_at) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (name) DO UPDATE SET version = excluded.version, url = excluded.url, updated_at = excluded.updated_at`,
+		ch.Name, ch.Version, ch.URL, ch.UpdatedAt,
+	)
+	return err
+}
+
+func (s *PostgresStore) UpdateChannelGet(ctx context.Context, name string) (*UpdateChannel, error) {
+	var ch UpdateChannel
+	err := s.db.QueryRowContext(ctx,
+		"SELECT name, version, url, updated_at FROM update_channels WHERE name = $1",
+		name,
+	).Scan(&ch.Name, &ch.Version, &ch.URL, &ch.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+func (s *PostgresStore) UpdateChannelList(ctx context.Context) ([]UpdateChannel, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, version, url, updated_at FROM update_channels ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []UpdateChannel
+	for rows.Next() {
+		var ch UpdateChannel
+		if err := rows.Scan(&ch.Name, &ch.Version, &ch.URL, &ch.UpdatedAt); err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+func (s *PostgresStore) UpdateChannelDelete(ctx context.Context, name string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM update_channels WHERE name = $1", name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// --- Replica Routes ---
+
+func (s *PostgresStore) RouteSet(ctx context.Context, key, replica string, ttl time.Duration) error {
+	var expiresAt *time.Time
+	if ttl > 0 {
+		t := time.Now().UTC().Add(ttl)
+		expiresAt = &t
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO relay_routes (key, replica, expires_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (key) DO UPDATE SET replica = excluded.replica, expires_at = excluded.expires_at`,
+		key, replica, expiresAt,
+	)
+	return err
+}
+
+func (s *PostgresStore) RouteGet(ctx context.Context, key string) (string, error) {
+	var replica string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT replica FROM relay_routes WHERE key = $1 AND (expires_at IS NULL OR expires_at > $2)",
+		key, time.Now().UTC(),
+	).Scan(&replica)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return replica, err
+}
+
+func (s *PostgresStore) RouteDelete(ctx context.Context, key, replica string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM relay_routes WHERE key = $1 AND replica = $2", key, replica)
+	return err
+}
+
+// --- Audit Log ---
+
+func (s *PostgresStore) AuditAppend(ctx context.Context, entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO audit_log (time, "user", node, action, session_id, result, remote_ip) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		entry.Time.UTC(), entry.User, entry.Node, entry.Action, entry.SessionID, entry.Result, entry.RemoteIP,
+	)
+	return err
+}
+
+func (s *PostgresStore) AuditList(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	query := `SELECT id, time, "user", node, action, session_id, result, remote_ip FROM audit_log WHERE TRUE`
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if filter.User != "" {
+		query += ` AND "user" = ` + arg(filter.User)
+	}
+	if filter.Node != "" {
+		query += " AND node = " + arg(filter.Node)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND time >= " + arg(filter.Since.UTC())
+	}
+	if filter.Before > 0 {
+		query += " AND id < " + arg(filter.Before)
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Time, &e.User, &e.Node, &e.Action, &e.SessionID, &e.Result, &e.RemoteIP); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Close shuts down the cleanup goroutine and closes the connection pool.
+func (s *PostgresStore) Close() error {
+	close(s.closeCh)
+	return s.db.Close()
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// newTestPostgresStore connects to CODEWIRE_TEST_POSTGRES_URL, skipping the
+// test when it is unset. Routes and approvals are cleared afterwards so the
+// database can be reused.
+func newTestPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+	url := os.Getenv("CODEWIRE_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("CODEWIRE_TEST_POSTGRES_URL not set")
+	}
+	s, err := NewPostgresStore(context.Background(), url)
+	if err != nil {
+		t.Fatalf("NewPostgresStore: %v", err)
+	}
+	t.Cleanup(func() {
+		s.db.Exec("DELETE FROM relay_routes")
+		s.db.Exec("DELETE FROM approvals")
+		s.db.Exec("DELETE FROM kv WHERE namespace IN ('q', 'other')")
+		s.Close()
+	})
+	return s
+}
+
+func TestPostgresRoutes(t *testing.T) {
+	testRoutes(t, newTestPostgresStore(t))
+}
+
+func TestPostgresApprovals(t *testing.T) {
+	testApprovals(t, newTestPostgresStore(t))
+}
+
+func TestPostgresSSHKeys(t *testing.T) {
+	testSSHKeys(t, newTestPostgresStore(t))
+}
+
+func TestPostgresUpdateChannels(t *testing.T) {
+	testUpdateChannels(t, newTestPostgresStore(t))
+}
+
+func TestPostgresKVQuota(t *testing.T) {
+	testKVQuota(t, newTestPostgresStore(t))
+}
+
+func TestPostgresKV(t *testing.T) {
+	s := newTestPostgresStore(t)
+	ctx := context.Background()
+	t.Cleanup(func() { s.KVDelete(ctx, "test", "k") })
+
+	if err := s.KVSet(ctx, "test", "k", []byte("v"), nil); err != nil {
+		t.Fatalf("KVSet: %v", err)
+	}
+	val, err := s.KVGet(ctx, "test", "k")
+	if err != nil || string(val) != "v" {
+		t.Fatalf("KVGet = %q, %v; want v", val, err)
+	}
+}
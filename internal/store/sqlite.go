@@ -18,12 +18,16 @@ type SQLiteStore struct {
 	db      *sql.DB
 	mu      sync.RWMutex // serializes writes (SQLite is single-writer)
 	closeCh chan struct{}
+	quota   KVQuota
 }
 
+// AuditRetention is how long audit log entries are kept.
+const AuditRetention = 90 * 24 * time.Hour
+
 // NewSQLiteStore opens or creates a SQLite database at dataDir/relay.db
 // and runs schema migrations.
 func NewSQLiteStore(dataDir string) (*SQLiteStore, error) {
-	dbPath := filepath.Join(dataDir, "relay.db")
+	dbPath := filepath.Join(dataDir, SQLiteFile)
 	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
 	if err != nil {
 		return nil, fmt.Errorf("opening sqlite: %w", err)
@@ -132,6 +136,45 @@ func (s *SQLiteStore) migrate() error {
 			node_token  TEXT NOT NULL DEFAULT '',
 			expires_at  DATETIME NOT NULL
 		)`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			time       DATETIME NOT NULL,
+			user       TEXT NOT NULL DEFAULT '',
+			node       TEXT NOT NULL DEFAULT '',
+			action     TEXT NOT NULL,
+			session_id TEXT NOT NULL DEFAULT '',
+			result     TEXT NOT NULL,
+			remote_ip  TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_time ON audit_log(time)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log(user, id)`,
+		`CREATE TABLE IF NOT EXISTS approvals (
+			token      TEXT PRIMARY KEY,
+			node_name  TEXT NOT NULL,
+			request_id TEXT NOT NULL,
+			from_name  TEXT NOT NULL DEFAULT '',
+			body       TEXT NOT NULL DEFAULT '',
+			expires_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS relay_routes (
+			key        TEXT PRIMARY KEY,
+			replica    TEXT NOT NULL,
+			expires_at DATETIME
+		)`,
+		`CREATE TABLE IF NOT EXISTS ssh_keys (
+			node_name   TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			public_key  TEXT NOT NULL,
+			comment     TEXT NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL,
+			PRIMARY KEY (node_name, fingerprint)
+		)`,
+		`CREATE TABLE IF NOT EXISTS update_channels (
+			name       TEXT PRIMARY KEY,
+			version    TEXT NOT NULL,
+			url        TEXT NOT NULL DEFAULT '',
+			updated_at DATETIME NOT NULL
+		)`,
 	}
 
 	for _, m := range migrations {
@@ -144,6 +187,14 @@ func (s *SQLiteStore) migrate() error {
 	s.addColumnIfNotExists("nodes", "github_id", "INTEGER REFERENCES users(github_id)")
 	// token column replaces public_key/tunnel_url in the new relay architecture.
 	s.addColumnIfNotExists("nodes", "token", "TEXT NOT NULL DEFAULT ''")
+	s.addColumnIfNotExists("nodes", "status", "TEXT NOT NULL DEFAULT ''")
+	s.addColumnIfNotExists("nodes", "scope", "TEXT NOT NULL DEFAULT ''")
+	s.addColumnIfNotExists("nodes", "tags", "TEXT NOT NULL DEFAULT ''")
+	s.addColumnIfNotExists("nodes", "pending_token", "TEXT NOT NULL DEFAULT ''")
+	s.addColumnIfNotExists("invites", "name", "TEXT NOT NULL DEFAULT ''")
+	s.addColumnIfNotExists("invites", "tags", "TEXT NOT NULL DEFAULT ''")
+	s.addColumnIfNotExists("invites", "scope", "TEXT NOT NULL DEFAULT ''")
+	s.addColumnIfNotExists("invites", "expires_after_join", "BOOLEAN NOT NULL DEFAULT 0")
 
 	// Ensure unique index on token for NodeGetByToken.
 	s.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_nodes_token ON nodes(token) WHERE token != ''`)
@@ -161,7 +212,8 @@ func (s *SQLiteStore) addColumnIfNotExists(table, column, colType string) {
 }
 
 // cleanupLoop periodically removes expired KV entries, device codes, sessions,
-// OAuth state parameters, and invites.
+// OAuth state parameters, invites, approvals, routes, and audit entries older
+// than AuditRetention.
 func (s *SQLiteStore) cleanupLoop() {
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
@@ -179,6 +231,9 @@ func (s *SQLiteStore) cleanupLoop() {
 			s.db.Exec("DELETE FROM invites WHERE expires_at < ?", now)
 			s.db.Exec("DELETE FROM oidc_sessions WHERE expires_at < ?", now)
 			s.db.Exec("DELETE FROM oidc_device_flows WHERE expires_at < ?", now)
+			s.db.Exec("DELETE FROM approvals WHERE expires_at < ?", now)
+			s.db.Exec("DELETE FROM relay_routes WHERE expires_at IS NOT NULL AND expires_at < ?", now)
+			s.db.Exec("DELETE FROM audit_log WHERE time < ?", now.Add(-AuditRetention))
 			s.mu.Unlock()
 		}
 	}
@@ -186,16 +241,41 @@ func (s *SQLiteStore) cleanupLoop() {
 
 // --- KV Store ---
 
+func (s *SQLiteStore) SetKVQuota(q KVQuota) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quota = q
+}
+
 func (s *SQLiteStore) KVSet(_ context.Context, namespace, key string, value []byte, ttl *time.Duration) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	now := time.Now().UTC()
 	var expiresAt *time.Time
 	if ttl != nil {
-		t := time.Now().UTC().Add(*ttl)
+		t := now.Add(*ttl)
 		expiresAt = &t
 	}
 
+	// Writes are serialized by mu, so the usage read here cannot go stale
+	// before the insert.
+	if s.quota.enabled() {
+		var keys int
+		var size int64
+		err := s.db.QueryRow(
+			`SELECT COUNT(*), COALESCE(SUM(LENGTH(value)), 0) FROM kv
+			 WHERE namespace = ? AND key != ? AND (expires_at IS NULL OR expires_at > ?)`,
+			namespace, key, now,
+		).Scan(&keys, &size)
+		if err != nil {
+			return err
+		}
+		if err := s.quota.check(namespace, keys, size, int64(len(value))); err != nil {
+			return err
+		}
+	}
+
 	_, err := s.db.Exec(
 		`INSERT INTO kv (namespace, key, value, expires_at) VALUES (?, ?, ?, ?)
 		 ON CONFLICT (namespace, key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`,
@@ -257,13 +337,17 @@ func (s *SQLiteStore) NodeRegister(_ context.Context, node NodeRecord) error {
 	defer s.mu.Unlock()
 
 	_, err := s.db.Exec(
-		`INSERT INTO nodes (name, token, github_id, authorized_at, last_seen_at)
-		 VALUES (?, ?, ?, ?, ?)
+		`INSERT INTO nodes (name, token, github_id, authorized_at, last_seen_at, scope, tags)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
 		 ON CONFLICT (name) DO UPDATE SET
 		   token = excluded.token,
+		   pending_token = '',
 		   github_id = excluded.github_id,
-		   last_seen_at = excluded.last_seen_at`,
-		node.Name, node.Token, node.GitHubID, node.AuthorizedAt, node.LastSeenAt,
+		   authorized_at = excluded.authorized_at,
+		   last_seen_at = excluded.last_seen_at,
+		   scope = excluded.scope,
+		   tags = excluded.tags`,
+		node.Name, node.Token, node.GitHubID, node.AuthorizedAt, node.LastSeenAt, node.Scope, joinTags(node.Tags),
 	)
 	return err
 }
@@ -272,7 +356,7 @@ func (s *SQLiteStore) NodeList(_ context.Context) ([]NodeRecord, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	rows, err := s.db.Query("SELECT name, token, github_id, authorized_at, last_seen_at FROM nodes ORDER BY name")
+	rows, err := s.db.Query("SELECT name, token, github_id, authorized_at, last_seen_at, status, scope, tags, pending_token FROM nodes ORDER BY name")
 	if err != nil {
 		return nil, err
 	}
@@ -281,9 +365,11 @@ func (s *SQLiteStore) NodeList(_ context.Context) ([]NodeRecord, error) {
 	var nodes []NodeRecord
 	for rows.Next() {
 		var n NodeRecord
-		if err := rows.Scan(&n.Name, &n.Token, &n.GitHubID, &n.AuthorizedAt, &n.LastSeenAt); err != nil {
+		var tags string
+		if err := rows.Scan(&n.Name, &n.Token, &n.GitHubID, &n.AuthorizedAt, &n.LastSeenAt, &n.Status, &n.Scope, &tags, &n.PendingToken); err != nil {
 			return nil, err
 		}
+		n.Tags = splitTags(tags)
 		nodes = append(nodes, n)
 	}
 	return nodes, rows.Err()
@@ -294,41 +380,51 @@ func (s *SQLiteStore) NodeGet(_ context.Context, name string) (*NodeRecord, erro
 	defer s.mu.RUnlock()
 
 	var n NodeRecord
+	var tags string
 	err := s.db.QueryRow(
-		"SELECT name, token, github_id, authorized_at, last_seen_at FROM nodes WHERE name = ?",
+		"SELECT name, token, github_id, authorized_at, last_seen_at, status, scope, tags, pending_token FROM nodes WHERE name = ?",
 		name,
-	).Scan(&n.Name, &n.Token, &n.GitHubID, &n.AuthorizedAt, &n.LastSeenAt)
+	).Scan(&n.Name, &n.Token, &n.GitHubID, &n.AuthorizedAt, &n.LastSeenAt, &n.Status, &n.Scope, &tags, &n.PendingToken)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
+	n.Tags = splitTags(tags)
 	return &n, nil
 }
 
 func (s *SQLiteStore) NodeGetByToken(_ context.Context, token string) (*NodeRecord, error) {
+	if token == "" {
+		return nil, nil // would match every node without a pending token
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	var n NodeRecord
+	var tags string
 	err := s.db.QueryRow(
-		"SELECT name, token, github_id, authorized_at, last_seen_at FROM nodes WHERE token = ?",
-		token,
-	).Scan(&n.Name, &n.Token, &n.GitHubID, &n.AuthorizedAt, &n.LastSeenAt)
+		"SELECT name, token, github_id, authorized_at, last_seen_at, status, scope, tags, pending_token FROM nodes WHERE token = ? OR pending_token = ?",
+		token, token,
+	).Scan(&n.Name, &n.Token, &n.GitHubID, &n.AuthorizedAt, &n.LastSeenAt, &n.Status, &n.Scope, &tags, &n.PendingToken)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
+	n.Tags = splitTags(tags)
 	return &n, nil
 }
 
 func (s *SQLiteStore) NodeDelete(_ context.Context, name string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	_, err := s.db.Exec("DELETE FROM nodes WHERE name = ?", name)
+	if _, err := s.db.Exec("DELETE FROM nodes WHERE name = ?", name); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("DELETE FROM ssh_keys WHERE node_name = ?", name)
 	return err
 }
 
@@ -339,6 +435,30 @@ func (s *SQLiteStore) NodeUpdateLastSeen(_ context.Context, name string) error {
 	return err
 }
 
+func (s *SQLiteStore) NodeUpdateStatus(_ context.Context, name, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.db.Exec("UPDATE nodes SET status = ?, last_seen_at = ? WHERE name = ?", status, time.Now().UTC(), name)
+	return err
+}
+
+func (s *SQLiteStore) NodeSetPendingToken(_ context.Context, name, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.db.Exec("UPDATE nodes SET pending_token = ? WHERE name = ?", token, name)
+	return err
+}
+
+func (s *SQLiteStore) NodeCommitToken(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.db.Exec(
+		"UPDATE nodes SET token = pending_token, pending_token = '', authorized_at = ? WHERE name = ? AND pending_token != ''",
+		time.Now().UTC(), name,
+	)
+	return err
+}
+
 // --- Device Codes ---
 
 func (s *SQLiteStore) DeviceCodeCreate(_ context.Context, dc DeviceCode) error {
@@ -570,8 +690,8 @@ func (s *SQLiteStore) InviteCreate(_ context.Context, invite Invite) error {
 	defer s.mu.Unlock()
 
 	_, err := s.db.Exec(
-		"INSERT INTO invites (token, created_by, uses_remaining, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
-		invite.Token, invite.CreatedBy, invite.UsesRemaining, invite.ExpiresAt, invite.CreatedAt,
+		"INSERT INTO invites (token, created_by, uses_remaining, expires_at, created_at, name, tags, scope, expires_after_join) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		invite.Token, invite.CreatedBy, invite.UsesRemaining, invite.ExpiresAt, invite.CreatedAt, invite.Name, joinTags(invite.Tags), invite.Scope, invite.ExpiresAfterJoin,
 	)
 	return err
 }
@@ -581,16 +701,18 @@ func (s *SQLiteStore) InviteGet(_ context.Context, token string) (*Invite, error
 	defer s.mu.RUnlock()
 
 	var inv Invite
+	var tags string
 	err := s.db.QueryRow(
-		"SELECT token, created_by, uses_remaining, expires_at, created_at FROM invites WHERE token = ? AND expires_at > ?",
+		"SELECT token, created_by, uses_remaining, expires_at, created_at, name, tags, scope, expires_after_join FROM invites WHERE token = ? AND expires_at > ?",
 		token, time.Now().UTC(),
-	).Scan(&inv.Token, &inv.CreatedBy, &inv.UsesRemaining, &inv.ExpiresAt, &inv.CreatedAt)
+	).Scan(&inv.Token, &inv.CreatedBy, &inv.UsesRemaining, &inv.ExpiresAt, &inv.CreatedAt, &inv.Name, &tags, &inv.Scope, &inv.ExpiresAfterJoin)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
+	inv.Tags = splitTags(tags)
 	return &inv, nil
 }
 
@@ -623,7 +745,7 @@ func (s *SQLiteStore) InviteList(_ context.Context) ([]Invite, error) {
 	defer s.mu.RUnlock()
 
 	rows, err := s.db.Query(
-		"SELECT token, created_by, uses_remaining, expires_at, created_at FROM invites WHERE expires_at > ? ORDER BY created_at",
+		"SELECT token, created_by, uses_remaining, expires_at, created_at, name, tags, scope, expires_after_join FROM invites WHERE expires_at > ? ORDER BY created_at",
 		time.Now().UTC(),
 	)
 	if err != nil {
@@ -634,9 +756,11 @@ func (s *SQLiteStore) InviteList(_ context.Context) ([]Invite, error) {
 	var invites []Invite
 	for rows.Next() {
 		var inv Invite
-		if err := rows.Scan(&inv.Token, &inv.CreatedBy, &inv.UsesRemaining, &inv.ExpiresAt, &inv.CreatedAt); err != nil {
+		var tags string
+		if err := rows.Scan(&inv.Token, &inv.CreatedBy, &inv.UsesRemaining, &inv.ExpiresAt, &inv.CreatedAt, &inv.Name, &tags, &inv.Scope, &inv.ExpiresAfterJoin); err != nil {
 			return nil, err
 		}
+		inv.Tags = splitTags(tags)
 		invites = append(invites, inv)
 	}
 	return invites, rows.Err()
@@ -797,6 +921,290 @@ func (s *SQLiteStore) OIDCDeviceFlowComplete(_ context.Context, pollToken, nodeT
 	return nil
 }
 
+// --- Approvals ---
+
+func (s *SQLiteStore) ApprovalCreate(_ context.Context, a Approval) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(
+		"INSERT INTO approvals (token, node_name, request_id, from_name, body, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		a.Token, a.NodeName, a.RequestID, a.From, a.Body, a.ExpiresAt,
+	)
+	return err
+}
+
+func (s *SQLiteStore) ApprovalGet(_ context.Context, token string) (*Approval, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var a Approval
+	err := s.db.QueryRow(
+		"SELECT token, node_name, request_id, from_name, body, expires_at FROM approvals WHERE token = ? AND expires_at > ?",
+		token, time.Now().UTC(),
+	).Scan(&a.Token, &a.NodeName, &a.RequestID, &a.From, &a.Body, &a.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *SQLiteStore) ApprovalTake(_ context.Context, token string) (*Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var a Approval
+	err := s.db.QueryRow(
+		"DELETE FROM approvals WHERE token = ? AND expires_at > ? RETURNING token, node_name, request_id, from_name, body, expires_at",
+		token, time.Now().UTC(),
+	).Scan(&a.Token, &a.NodeName, &a.RequestID, &a.From, &a.Body, &a.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// --- SSH Keys ---
+
+func (s *SQLiteStore) SSHKeyAdd(_ context.Context, key SSHKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(
+		`INSERT INTO ssh_keys (node_name, fingerprint, public_key, comment, created_at) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (node_name, fingerprint) DO UPDATE SET comment = excluded.comment`,
+		key.NodeName, key.Fingerprint, key.PublicKey, key.Comment, key.CreatedAt,
+	)
+	return err
+}
+
+func (s *SQLiteStore) SSHKeyGet(_ context.Context, nodeName, fingerprint string) (*SSHKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var k SSHKey
+	err := s.db.QueryRow(
+		"SELECT node_name, fingerprint, public_key, comment, created_at FROM ssh_keys WHERE node_name = ? AND fingerprint = ?",
+		nodeName, fingerprint,
+	).Scan(&k.NodeName, &k.Fingerprint, &k.PublicKey, &k.Comment, &k.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (s *SQLiteStore) SSHKeyList(_ context.Context, nodeName string) ([]SSHKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(
+		"SELECT node_name, fingerprint, public_key, comment, created_at FROM ssh_keys WHERE node_name = ? ORDER BY created_at",
+		nodeName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []SSHKey
+	for rows.Next() {
+		var k SSHKey
+		if err := rows.Scan(&k.NodeName, &k.Fingerprint, &k.PublicKey, &k.Comment, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLiteStore) SSHKeyDelete(_ context.Context, nodeName, fingerprint string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec("DELETE FROM ssh_keys WHERE node_name = ? AND fingerprint = ?", nodeName, fingerprint)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// --- Update Channels ---
+
+func (s *SQLiteStore) UpdateChannelSet(_ context.Context, ch UpdateChannel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(
+		`INSERT INTO update_channels (name, version, url, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (name) DO UPDATE SET version = excluded.version, url = excluded.url, updated_at = excluded.updated_at`,
+		ch.Name, ch.Version, ch.URL, ch.UpdatedAt,
+	)
+	return err
+}
+
+func (s *SQLiteStore) UpdateChannelGet(_ context.Context, name string) (*UpdateChannel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ch UpdateChannel
+	err := s.db.QueryRow(
+		"SELECT name, version, url, updated_at FROM update_channels WHERE name = ?",
+		name,
+	).Scan(&ch.Name, &ch.Version, &ch.URL, &ch.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+func (s *SQLiteStore) UpdateChannelList(_ context.Context) ([]UpdateChannel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query("SELECT name, version, url, updated_at FROM update_channels ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []UpdateChannel
+	for rows.Next() {
+		var ch UpdateChannel
+		if err := rows.Scan(&ch.Name, &ch.Version, &ch.URL, &ch.UpdatedAt); err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+func (s *SQLiteStore) UpdateChannelDelete(_ context.Context, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec("DELETE FROM update_channels WHERE name = ?", name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// --- Replica Routes ---
+
+func (s *SQLiteStore) RouteSet(_ context.Context, key, replica string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expiresAt *time.Time
+	if ttl > 0 {
+		t := time.Now().UTC().Add(ttl)
+		expiresAt = &t
+	}
+	_, err := s.db.Exec(
+		`INSERT INTO relay_routes (key, replica, expires_at) VALUES (?, ?, ?)
+		 ON CONFLICT (key) DO UPDATE SET replica = excluded.replica, expires_at = excluded.expires_at`,
+		key, replica, expiresAt,
+	)
+	return err
+}
+
+func (s *SQLiteStore) RouteGet(_ context.Context, key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var replica string
+	err := s.db.QueryRow(
+		"SELECT replica FROM relay_routes WHERE key = ? AND (expires_at IS NULL OR expires_at > ?)",
+		key, time.Now().UTC(),
+	).Scan(&replica)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return replica, err
+}
+
+func (s *SQLiteStore) RouteDelete(_ context.Context, key, replica string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.db.Exec("DELETE FROM relay_routes WHERE key = ? AND replica = ?", key, replica)
+	return err
+}
+
+// --- Audit Log ---
+
+func (s *SQLiteStore) AuditAppend(_ context.Context, entry AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	_, err := s.db.Exec(
+		"INSERT INTO audit_log (time, user, node, action, session_id, result, remote_ip) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		entry.Time.UTC(), entry.User, entry.Node, entry.Action, entry.SessionID, entry.Result, entry.RemoteIP,
+	)
+	return err
+}
+
+func (s *SQLiteStore) AuditList(_ context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := "SELECT id, time, user, node, action, session_id, result, remote_ip FROM audit_log WHERE 1=1"
+	var args []any
+	if filter.User != "" {
+		query += " AND user = ?"
+		args = append(args, filter.User)
+	}
+	if filter.Node != "" {
+		query += " AND node = ?"
+		args = append(args, filter.Node)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND time >= ?"
+		args = append(args, filter.Since.UTC())
+	}
+	if filter.Before > 0 {
+		query += " AND id < ?"
+		args = append(args, filter.Before)
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Time, &e.User, &e.Node, &e.Action, &e.SessionID, &e.Result, &e.RemoteIP); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
 // Close shuts down the cleanup goroutine and closes the database.
 func (s *SQLiteStore) Close() error {
 	close(s.closeCh)
@@ -2,6 +2,8 @@ package store
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"testing"
 	"time"
 )
@@ -146,6 +148,48 @@ func TestKVList(t *testing.T) {
 	}
 }
 
+func TestKVQuota(t *testing.T) {
+	testKVQuota(t, newTestStore(t))
+}
+
+func testKVQuota(t *testing.T, s Store) {
+	ctx := context.Background()
+	s.SetKVQuota(KVQuota{MaxKeys: 2, MaxBytes: 10})
+
+	if err := s.KVSet(ctx, "q", "a", []byte("12345"), nil); err != nil {
+		t.Fatalf("KVSet a: %v", err)
+	}
+	if err := s.KVSet(ctx, "q", "b", []byte("12345"), nil); err != nil {
+		t.Fatalf("KVSet b: %v", err)
+	}
+
+	var qerr *KVQuotaError
+	if err := s.KVSet(ctx, "q", "c", []byte("1"), nil); !errors.As(err, &qerr) || qerr.Limit != "keys" {
+		t.Fatalf("expected keys quota error, got %v", err)
+	}
+	if err := s.KVSet(ctx, "q", "a", []byte("123456"), nil); !errors.As(err, &qerr) || qerr.Limit != "bytes" {
+		t.Fatalf("expected bytes quota error, got %v", err)
+	}
+
+	// Overwriting a key within the quota, and other namespaces, still work.
+	if err := s.KVSet(ctx, "q", "a", []byte("1"), nil); err != nil {
+		t.Fatalf("KVSet overwrite: %v", err)
+	}
+	if err := s.KVSet(ctx, "other", "c", []byte("12345"), nil); err != nil {
+		t.Fatalf("KVSet other namespace: %v", err)
+	}
+
+	// Expired entries free their share before the sweep removes them.
+	ttl := time.Millisecond
+	if err := s.KVSet(ctx, "q", "b", []byte("1"), &ttl); err != nil {
+		t.Fatalf("KVSet b with TTL: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := s.KVSet(ctx, "q", "c", []byte("123456789"), nil); err != nil {
+		t.Fatalf("KVSet after expiry: %v", err)
+	}
+}
+
 func TestNodeCRUD(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
@@ -191,6 +235,16 @@ func TestNodeCRUD(t *testing.T) {
 		t.Fatal("last_seen_at not updated")
 	}
 
+	// A status report is kept and also marks the node seen.
+	time.Sleep(time.Millisecond)
+	if err := s.NodeUpdateStatus(ctx, "dev-1", `{"sessions":2}`); err != nil {
+		t.Fatal(err)
+	}
+	gotStatus, _ := s.NodeGet(ctx, "dev-1")
+	if gotStatus.Status != `{"sessions":2}` || !gotStatus.LastSeenAt.After(got2.LastSeenAt) {
+		t.Fatalf("after status report: %+v", gotStatus)
+	}
+
 	// Re-register (upsert) with updated token.
 	node.Token = "updatedtoken"
 	if err := s.NodeRegister(ctx, node); err != nil {
@@ -254,6 +308,48 @@ func TestNodeToken(t *testing.T) {
 	}
 }
 
+func TestNodeTokenRotation(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	issued := time.Now().Add(-time.Hour).UTC()
+	if err := s.NodeRegister(ctx, NodeRecord{Name: "mynode", Token: "old", AuthorizedAt: issued, LastSeenAt: issued}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.NodeSetPendingToken(ctx, "mynode", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Until the cutover both tokens authenticate.
+	for _, token := range []string{"old", "new"} {
+		if got, _ := s.NodeGetByToken(ctx, token); got == nil || got.PendingToken != "new" {
+			t.Fatalf("token %s: got %+v", token, got)
+		}
+	}
+	if got, _ := s.NodeGetByToken(ctx, ""); got != nil {
+		t.Fatalf("empty token matched %+v", got)
+	}
+
+	if err := s.NodeCommitToken(ctx, "mynode"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.NodeGetByToken(ctx, "old"); got != nil {
+		t.Fatalf("old token still valid: %+v", got)
+	}
+	got, _ := s.NodeGetByToken(ctx, "new")
+	if got == nil || got.Token != "new" || got.PendingToken != "" || !got.AuthorizedAt.After(issued) {
+		t.Fatalf("after cutover: %+v", got)
+	}
+
+	// Committing again without a pending token keeps the token.
+	if err := s.NodeCommitToken(ctx, "mynode"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.NodeGetByToken(ctx, "new"); got == nil {
+		t.Fatal("token lost by a second commit")
+	}
+}
+
 func TestDeviceCodeFlow(t *testing.T) {
 	s := newTestStore(t)
 	ctx := context.Background()
@@ -527,3 +623,248 @@ func TestOIDCDeviceFlowExpiry(t *testing.T) {
 		t.Error("expected nil for expired device flow, got a result")
 	}
 }
+
+func TestAuditLog(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	entries := []AuditEntry{
+		{Time: old, User: "alice", Node: "n1", Action: "ssh", SessionID: "s1", Result: "ok"},
+		{User: "bob", Node: "n1", Action: "node.revoke", Result: "ok"},
+		{User: "alice", Node: "n2", Action: "ssh", SessionID: "s2", Result: "node not connected"},
+		{User: "alice", Node: "n1", Action: "ssh", SessionID: "s3", Result: "ok"},
+	}
+	for _, e := range entries {
+		if err := s.AuditAppend(ctx, e); err != nil {
+			t.Fatalf("AuditAppend: %v", err)
+		}
+	}
+
+	all, err := s.AuditList(ctx, AuditFilter{})
+	if err != nil {
+		t.Fatalf("AuditList: %v", err)
+	}
+	if len(all) != 4 || all[0].SessionID != "s3" || all[3].SessionID != "s1" {
+		t.Fatalf("expected 4 entries newest first, got %+v", all)
+	}
+	if all[3].Time.Sub(old).Abs() > time.Second {
+		t.Errorf("time = %v, want %v", all[3].Time, old)
+	}
+	if all[0].Time.IsZero() {
+		t.Error("expected zero time to be filled in")
+	}
+
+	recent, err := s.AuditList(ctx, AuditFilter{User: "alice", Since: time.Now().Add(-24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("AuditList: %v", err)
+	}
+	if len(recent) != 2 || recent[0].SessionID != "s3" || recent[1].SessionID != "s2" {
+		t.Fatalf("expected alice's last 2 entries, got %+v", recent)
+	}
+
+	// Page through alice's entries one at a time.
+	var ids []string
+	var before int64
+	for {
+		page, err := s.AuditList(ctx, AuditFilter{User: "alice", Node: "n1", Before: before, Limit: 1})
+		if err != nil {
+			t.Fatalf("AuditList: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		ids = append(ids, page[0].SessionID)
+		before = page[0].ID
+	}
+	if len(ids) != 2 || ids[0] != "s3" || ids[1] != "s1" {
+		t.Fatalf("expected pages s3, s1, got %v", ids)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	testRoutes(t, newTestStore(t))
+}
+
+func TestApprovals(t *testing.T) {
+	testApprovals(t, newTestStore(t))
+}
+
+func TestSSHKeys(t *testing.T) {
+	testSSHKeys(t, newTestStore(t))
+}
+
+func TestUpdateChannels(t *testing.T) {
+	testUpdateChannels(t, newTestStore(t))
+}
+
+// testRoutes, testApprovals, testSSHKeys and testUpdateChannels run against
+// every Store implementation.
+func testRoutes(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	if err := s.RouteSet(ctx, "node/a", "http://r1", 0); err != nil {
+		t.Fatalf("RouteSet: %v", err)
+	}
+	if got, err := s.RouteGet(ctx, "node/a"); err != nil || got != "http://r1" {
+		t.Fatalf("RouteGet = %q, %v; want http://r1", got, err)
+	}
+
+	// A reconnect to another replica takes the route over, and the old
+	// replica's late cleanup must not remove it.
+	if err := s.RouteSet(ctx, "node/a", "http://r2", 0); err != nil {
+		t.Fatalf("RouteSet: %v", err)
+	}
+	if err := s.RouteDelete(ctx, "node/a", "http://r1"); err != nil {
+		t.Fatalf("RouteDelete: %v", err)
+	}
+	if got, _ := s.RouteGet(ctx, "node/a"); got != "http://r2" {
+		t.Fatalf("RouteGet = %q after stale delete, want http://r2", got)
+	}
+	if err := s.RouteDelete(ctx, "node/a", "http://r2"); err != nil {
+		t.Fatalf("RouteDelete: %v", err)
+	}
+	if got, _ := s.RouteGet(ctx, "node/a"); got != "" {
+		t.Fatalf("RouteGet = %q after delete, want empty", got)
+	}
+
+	if err := s.RouteSet(ctx, "session/s1", "http://r1", time.Millisecond); err != nil {
+		t.Fatalf("RouteSet: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if got, _ := s.RouteGet(ctx, "session/s1"); got != "" {
+		t.Fatalf("RouteGet = %q after expiry, want empty", got)
+	}
+}
+
+func testApprovals(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	a := Approval{
+		Token:     "tok1",
+		NodeName:  "n1",
+		RequestID: "r1",
+		From:      "worker",
+		Body:      "Bash: rm -rf build",
+		ExpiresAt: time.Now().UTC().Add(time.Hour),
+	}
+	if err := s.ApprovalCreate(ctx, a); err != nil {
+		t.Fatalf("ApprovalCreate: %v", err)
+	}
+	got, err := s.ApprovalGet(ctx, "tok1")
+	if err != nil || got == nil {
+		t.Fatalf("ApprovalGet = %v, %v", got, err)
+	}
+	if got.NodeName != "n1" || got.RequestID != "r1" || got.From != "worker" || got.Body != a.Body {
+		t.Fatalf("unexpected approval %+v", got)
+	}
+
+	taken, err := s.ApprovalTake(ctx, "tok1")
+	if err != nil || taken == nil || taken.RequestID != "r1" {
+		t.Fatalf("ApprovalTake = %+v, %v", taken, err)
+	}
+	if got, _ := s.ApprovalGet(ctx, "tok1"); got != nil {
+		t.Fatalf("expected taken approval to be gone, got %+v", got)
+	}
+	if taken, err := s.ApprovalTake(ctx, "tok1"); err != nil || taken != nil {
+		t.Fatalf("second ApprovalTake = %+v, %v; want nothing", taken, err)
+	}
+
+	a.Token = "tok2"
+	a.ExpiresAt = time.Now().UTC().Add(-time.Minute)
+	if err := s.ApprovalCreate(ctx, a); err != nil {
+		t.Fatalf("ApprovalCreate: %v", err)
+	}
+	if got, _ := s.ApprovalGet(ctx, "tok2"); got != nil {
+		t.Fatalf("expected expired approval to be hidden, got %+v", got)
+	}
+}
+
+func testSSHKeys(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	if err := s.NodeRegister(ctx, NodeRecord{Name: "keys-node", Token: "keys-tok", AuthorizedAt: time.Now().UTC(), LastSeenAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("NodeRegister: %v", err)
+	}
+	k := SSHKey{
+		NodeName:    "keys-node",
+		Fingerprint: "SHA256:abc",
+		PublicKey:   "ssh-ed25519 AAAA",
+		Comment:     "laptop",
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := s.SSHKeyAdd(ctx, k); err != nil {
+		t.Fatalf("SSHKeyAdd: %v", err)
+	}
+	// Adding the same key again updates the comment.
+	k.Comment = "work laptop"
+	if err := s.SSHKeyAdd(ctx, k); err != nil {
+		t.Fatalf("SSHKeyAdd again: %v", err)
+	}
+
+	got, err := s.SSHKeyGet(ctx, "keys-node", "SHA256:abc")
+	if err != nil || got == nil {
+		t.Fatalf("SSHKeyGet = %v, %v", got, err)
+	}
+	if got.PublicKey != k.PublicKey || got.Comment != "work laptop" {
+		t.Fatalf("unexpected key %+v", got)
+	}
+	if got, _ := s.SSHKeyGet(ctx, "other-node", "SHA256:abc"); got != nil {
+		t.Fatalf("key leaked to another node: %+v", got)
+	}
+
+	keys, err := s.SSHKeyList(ctx, "keys-node")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("SSHKeyList = %v, %v; want 1 key", keys, err)
+	}
+
+	if ok, err := s.SSHKeyDelete(ctx, "keys-node", "SHA256:missing"); err != nil || ok {
+		t.Fatalf("SSHKeyDelete(missing) = %v, %v; want false", ok, err)
+	}
+	if ok, err := s.SSHKeyDelete(ctx, "keys-node", "SHA256:abc"); err != nil || !ok {
+		t.Fatalf("SSHKeyDelete = %v, %v; want true", ok, err)
+	}
+
+	// Deleting the node removes its keys.
+	if err := s.SSHKeyAdd(ctx, k); err != nil {
+		t.Fatalf("SSHKeyAdd: %v", err)
+	}
+	if err := s.NodeDelete(ctx, "keys-node"); err != nil {
+		t.Fatalf("NodeDelete: %v", err)
+	}
+	if keys, _ := s.SSHKeyList(ctx, "keys-node"); len(keys) != 0 {
+		t.Fatalf("keys survived node deletion: %v", keys)
+	}
+}
+
+func testUpdateChannels(t *testing.T, s Store) {
+	ctx := context.Background()
+	t.Cleanup(func() { s.UpdateChannelDelete(ctx, "test-stable") })
+
+	if ch, err := s.UpdateChannelGet(ctx, "test-stable"); err != nil || ch != nil {
+		t.Fatalf("UpdateChannelGet(missing) = %v, %v; want nil", ch, err)
+	}
+	ch := UpdateChannel{Name: "test-stable", Version: "v1.2.3", UpdatedAt: time.Now().UTC().Truncate(time.Second)}
+	if err := s.UpdateChannelSet(ctx, ch); err != nil {
+		t.Fatalf("UpdateChannelSet: %v", err)
+	}
+	ch.Version, ch.URL = "v1.2.4", "https://mirror.example.com/cw"
+	if err := s.UpdateChannelSet(ctx, ch); err != nil {
+		t.Fatalf("UpdateChannelSet (update): %v", err)
+	}
+	got, err := s.UpdateChannelGet(ctx, "test-stable")
+	if err != nil || got == nil || got.Version != "v1.2.4" || got.URL != ch.URL || !got.UpdatedAt.Equal(ch.UpdatedAt) {
+		t.Fatalf("UpdateChannelGet = %+v, %v", got, err)
+	}
+	channels, err := s.UpdateChannelList(ctx)
+	if err != nil || !slices.ContainsFunc(channels, func(c UpdateChannel) bool { return c.Name == "test-stable" }) {
+		t.Fatalf("UpdateChannelList = %v, %v", channels, err)
+	}
+
+	if ok, err := s.UpdateChannelDelete(ctx, "test-stable"); err != nil || !ok {
+		t.Fatalf("UpdateChannelDelete = %v, %v; want true", ok, err)
+	}
+	if ok, err := s.UpdateChannelDelete(ctx, "test-stable"); err != nil || ok {
+		t.Fatalf("UpdateChannelDelete(missing) = %v, %v; want false", ok, err)
+	}
+}
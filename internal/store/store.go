@@ -1,10 +1,12 @@
 // Package store provides a pluggable storage interface for the CodeWire relay.
-// The default implementation uses SQLite (pure Go, no CGO). A PostgreSQL
-// backend can be added later behind the same interface.
+// The default implementation uses SQLite (pure Go, no CGO); PostgreSQL is
+// used when several relay replicas share state.
 package store
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -15,15 +17,68 @@ type KVEntry struct {
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
+// KVQuota limits each KV namespace. Zero fields are unlimited. Expired
+// entries awaiting the cleanup sweep do not count.
+type KVQuota struct {
+	MaxKeys  int   // live keys per namespace
+	MaxBytes int64 // total value bytes per namespace
+}
+
+// KVQuotaError is returned by KVSet when the write would take a namespace
+// over its quota. Nothing is written.
+type KVQuotaError struct {
+	Namespace string
+	Limit     string // "keys" or "bytes"
+	Max       int64
+}
+
+func (e *KVQuotaError) Error() string {
+	return fmt.Sprintf("namespace %q is over its quota of %d %s", e.Namespace, e.Max, e.Limit)
+}
+
+// check returns a KVQuotaError if a namespace holding keys and size bytes
+// (not counting the key being written) cannot take a value of n bytes.
+func (q KVQuota) check(namespace string, keys int, size, n int64) error {
+	if q.MaxKeys > 0 && keys+1 > q.MaxKeys {
+		return &KVQuotaError{Namespace: namespace, Limit: "keys", Max: int64(q.MaxKeys)}
+	}
+	if q.MaxBytes > 0 && size+n > q.MaxBytes {
+		return &KVQuotaError{Namespace: namespace, Limit: "bytes", Max: q.MaxBytes}
+	}
+	return nil
+}
+
+func (q KVQuota) enabled() bool { return q.MaxKeys > 0 || q.MaxBytes > 0 }
+
 // NodeRecord is a registered relay node.
 type NodeRecord struct {
 	Name         string    `json:"name"`
 	Token        string    `json:"token"`          // random auth token (replaces WireGuard public key)
 	GitHubID     *int64    `json:"github_id,omitempty"`
-	AuthorizedAt time.Time `json:"authorized_at"`
+	AuthorizedAt time.Time `json:"authorized_at"` // when Token was issued
 	LastSeenAt   time.Time `json:"last_seen_at"`
+	// Status is the JSON status the node last reported over its relay
+	// connection, empty before its first report.
+	Status string `json:"status,omitempty"`
+	// Scope is what the device's token may do: ScopeNode or ScopeClient,
+	// empty for devices registered before invites had scopes (nodes).
+	Scope string `json:"scope,omitempty"`
+	// Tags, if set, replace the node.tags the node reports.
+	Tags []string `json:"tags,omitempty"`
+	// PendingToken is the token a rotation issued to the node. It also
+	// authenticates the node until NodeCommitToken makes it the token.
+	PendingToken string `json:"pending_token,omitempty"`
 }
 
+// Device scopes, set by the invite a device joined with.
+const (
+	ScopeNode   = "node"   // connects as a node agent
+	ScopeClient = "client" // only connects to nodes, through the relay
+)
+
+// IsClient reports whether the device may only act as a client.
+func (n *NodeRecord) IsClient() bool { return n.Scope == ScopeClient }
+
 // GitHubApp stores the GitHub App credentials (singleton, one row).
 type GitHubApp struct {
 	AppID         int64     `json:"app_id"`
@@ -66,6 +121,24 @@ type Invite struct {
 	UsesRemaining int       `json:"uses_remaining"`
 	ExpiresAt     time.Time `json:"expires_at"`
 	CreatedAt     time.Time `json:"created_at"`
+	// Name, Tags and Scope are given to the device that joins with the
+	// invite, instead of the name it asks for.
+	Name  string   `json:"name,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Scope string   `json:"scope,omitempty"`
+	// ExpiresAfterJoin deletes the invite once a device has joined with
+	// it, whatever uses remain.
+	ExpiresAfterJoin bool `json:"expires_after_join,omitempty"`
+}
+
+// joinTags and splitTags store tag lists in a TEXT column.
+func joinTags(tags []string) string { return strings.Join(tags, ",") }
+
+func splitTags(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
 }
 
 // OIDCUser represents a user authenticated via OIDC (any provider).
@@ -113,9 +186,64 @@ type DeviceCode struct {
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
+// Approval is a gateway request escalated to a human. Token is the opaque
+// value in the approval URL.
+type Approval struct {
+	Token     string    `json:"token"`
+	NodeName  string    `json:"node_name"`
+	RequestID string    `json:"request_id"`
+	From      string    `json:"from"`
+	Body      string    `json:"body"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SSHKey is a client public key allowed to log in to a node through the
+// relay's SSH listener. PublicKey is in authorized_keys format, without the
+// comment; Fingerprint is its SHA256 fingerprint.
+type SSHKey struct {
+	NodeName    string    `json:"node_name"`
+	Fingerprint string    `json:"fingerprint"`
+	PublicKey   string    `json:"public_key"`
+	Comment     string    `json:"comment"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UpdateChannel is a cw version the relay asks the nodes following the
+// channel to run. URL is where the release is downloaded from; empty means
+// the GitHub releases.
+type UpdateChannel struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	URL       string    `json:"url,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AuditEntry records one action the relay carried out or proxied to a node.
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`   // who acted; empty if the action was unauthenticated
+	Node      string    `json:"node"`   // node the action targeted
+	Action    string    `json:"action"` // e.g. "ssh", "approval.approve", "node.revoke"
+	SessionID string    `json:"session_id,omitempty"`
+	Result    string    `json:"result"` // "ok" or a short error description
+	RemoteIP  string    `json:"remote_ip,omitempty"`
+}
+
+// AuditFilter selects audit entries. Zero-valued fields match everything.
+type AuditFilter struct {
+	User   string
+	Node   string
+	Since  time.Time
+	Before int64 // only entries with a smaller ID, for paging
+	Limit  int
+}
+
 // Store is the relay's storage interface. All methods are safe for concurrent use.
 type Store interface {
-	// KV store — shared across all nodes.
+	// KV store — shared across all nodes. KVSet enforces the quota set with
+	// SetKVQuota, returning a *KVQuotaError when a namespace is full.
+	SetKVQuota(q KVQuota)
 	KVSet(ctx context.Context, namespace, key string, value []byte, ttl *time.Duration) error
 	KVGet(ctx context.Context, namespace, key string) ([]byte, error)
 	KVDelete(ctx context.Context, namespace, key string) error
@@ -128,6 +256,14 @@ type Store interface {
 	NodeGetByToken(ctx context.Context, token string) (*NodeRecord, error)
 	NodeDelete(ctx context.Context, name string) error
 	NodeUpdateLastSeen(ctx context.Context, name string) error
+	// NodeUpdateStatus records a node's status report and marks it seen.
+	NodeUpdateStatus(ctx context.Context, name, status string) error
+	// NodeSetPendingToken issues token to the node alongside its current
+	// one, replacing any token pending from an earlier rotation.
+	NodeSetPendingToken(ctx context.Context, name, token string) error
+	// NodeCommitToken makes the node's pending token its token, which
+	// invalidates the old one, and sets its AuthorizedAt to now.
+	NodeCommitToken(ctx context.Context, name string) error
 
 	// Device authorization flow.
 	DeviceCodeCreate(ctx context.Context, dc DeviceCode) error
@@ -179,6 +315,38 @@ type Store interface {
 	RevokedKeyAdd(ctx context.Context, key RevokedKey) error
 	RevokedKeyCheck(ctx context.Context, publicKey string) (bool, error)
 
+	// Approvals — escalated gateway requests awaiting a decision.
+	// ApprovalTake removes and returns an approval in one step, so that only
+	// one decision is applied; like ApprovalGet it returns nil once expired.
+	ApprovalCreate(ctx context.Context, a Approval) error
+	ApprovalGet(ctx context.Context, token string) (*Approval, error)
+	ApprovalTake(ctx context.Context, token string) (*Approval, error)
+
+	// SSH keys — per node, removed along with the node. SSHKeyDelete
+	// reports whether the key existed.
+	SSHKeyAdd(ctx context.Context, key SSHKey) error
+	SSHKeyGet(ctx context.Context, nodeName, fingerprint string) (*SSHKey, error)
+	SSHKeyList(ctx context.Context, nodeName string) ([]SSHKey, error)
+	SSHKeyDelete(ctx context.Context, nodeName, fingerprint string) (bool, error)
+
+	// Update channels — the version each channel's nodes should run.
+	// UpdateChannelDelete reports whether the channel existed.
+	UpdateChannelSet(ctx context.Context, ch UpdateChannel) error
+	UpdateChannelGet(ctx context.Context, name string) (*UpdateChannel, error)
+	UpdateChannelList(ctx context.Context) ([]UpdateChannel, error)
+	UpdateChannelDelete(ctx context.Context, name string) (bool, error)
+
+	// Replica routes — which relay replica holds a node's agent connection
+	// or an SSH session's back-connection wait. A zero ttl never expires.
+	// RouteDelete only removes the route if it still points at replica.
+	RouteSet(ctx context.Context, key, replica string, ttl time.Duration) error
+	RouteGet(ctx context.Context, key string) (string, error)
+	RouteDelete(ctx context.Context, key, replica string) error
+
+	// Audit log — newest entries first.
+	AuditAppend(ctx context.Context, entry AuditEntry) error
+	AuditList(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+
 	// Close releases resources (e.g. closes the database).
 	Close() error
 }
@@ -1,10 +1,34 @@
 package terminal
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 )
 
+// DefaultDetachKey is the detach key unless configured otherwise.
+const DefaultDetachKey = "ctrl-b"
+
+// ParseDetachKey parses a detach key, "ctrl-a" to "ctrl-z", into the byte
+// the terminal sends for it. Empty is DefaultDetachKey. Ctrl+H, I, J and M
+// are refused: terminals send them for Backspace, Tab and Enter.
+func ParseDetachKey(key string) (byte, error) {
+	if key == "" {
+		key = DefaultDetachKey
+	}
+	letter, ok := strings.CutPrefix(strings.ToLower(key), "ctrl-")
+	if !ok || len(letter) != 1 || letter[0] < 'a' || letter[0] > 'z' || strings.Contains("hijm", letter) {
+		return 0, fmt.Errorf("detach key must be ctrl-a to ctrl-z (except ctrl-h, ctrl-i, ctrl-j and ctrl-m), got %q", key)
+	}
+	return letter[0] - 'a' + 1, nil
+}
+
+// DetachKeyLabel describes the detach key whose byte is prefix, e.g.
+// "Ctrl+B".
+func DetachKeyLabel(prefix byte) string {
+	return "Ctrl+" + string(rune('A'+prefix-1))
+}
+
 type detectState int
 
 const (
@@ -16,8 +40,9 @@ const (
 	stateCsi
 )
 
-// DetachDetector recognises Ctrl+B followed by 'd' (like tmux). Handles two
-// encodings of Ctrl+B:
+// DetachDetector recognises Ctrl+B (or another prefix, see
+// NewDetachDetectorKey) followed by 'd' (like tmux). Handles two encodings
+// of Ctrl+B:
 //
 //  1. Legacy -- the single byte 0x02.
 //  2. Kitty keyboard protocol -- \x1b[98;5u (codepoint 98 = 'b',
@@ -33,12 +58,19 @@ const (
 // and forwarded without cancelling the pending detach.
 type DetachDetector struct {
 	state  detectState
+	prefix byte   // legacy encoding of the prefix key
 	buf    []byte // buffered bytes during escape parsing
 	params []byte // CSI parameter bytes for Kitty detection
 }
 
 func NewDetachDetector() *DetachDetector {
-	return &DetachDetector{state: stateNormal}
+	return NewDetachDetectorKey(0x02)
+}
+
+// NewDetachDetectorKey returns a detector for the prefix key whose byte is
+// prefix, as returned by ParseDetachKey.
+func NewDetachDetectorKey(prefix byte) *DetachDetector {
+	return &DetachDetector{state: stateNormal, prefix: prefix}
 }
 
 // Feed processes a single byte. Returns (detachDetected, bytesToForward).
@@ -48,7 +80,7 @@ func (d *DetachDetector) Feed(b byte) (bool, []byte) {
 	// Normal: looking for legacy Ctrl+B (0x02) or Kitty CSI start
 	// ----------------------------------------------------------
 	case stateNormal:
-		if b == 0x02 {
+		if b == d.prefix {
 			d.state = stateSawPrefix
 			return false, nil
 		}
@@ -77,7 +109,7 @@ func (d *DetachDetector) Feed(b byte) (bool, []byte) {
 		}
 		// Any other byte cancels the prefix.
 		d.state = stateNormal
-		return false, []byte{0x02, b}
+		return false, []byte{d.prefix, b}
 
 	// ----------------------------------------------------------
 	// SawPrefixEsc: inside SawPrefix, saw \x1b
@@ -117,7 +149,7 @@ func (d *DetachDetector) Feed(b byte) (bool, []byte) {
 				// Some other Kitty key -- cancel SawPrefix.
 				d.state = stateNormal
 				fwd := make([]byte, 1+len(d.buf))
-				fwd[0] = 0x02
+				fwd[0] = d.prefix
 				copy(fwd[1:], d.buf)
 				d.buf = d.buf[:0]
 				return false, fwd
@@ -133,7 +165,7 @@ func (d *DetachDetector) Feed(b byte) (bool, []byte) {
 		// Unexpected byte -- forward everything and cancel to Normal.
 		d.state = stateNormal
 		fwd := make([]byte, 1+len(d.buf))
-		fwd[0] = 0x02
+		fwd[0] = d.prefix
 		copy(fwd[1:], d.buf)
 		d.buf = d.buf[:0]
 		return false, fwd
@@ -238,10 +270,11 @@ func parseKitty(params []byte) (codepoint, modifier uint32, ok bool) {
 	return uint32(cp), mod, true
 }
 
-// isKittyCtrlB checks if params represent Kitty Ctrl+B (codepoint 98, modifier 5).
+// isKittyCtrlB checks if params represent Kitty Ctrl+B (codepoint 98,
+// modifier 5), or the configured prefix.
 func (d *DetachDetector) isKittyCtrlB() bool {
 	cp, mod, ok := parseKitty(d.params)
-	return ok && cp == 98 && mod == 5
+	return ok && cp == uint32('a'+d.prefix-1) && mod == 5
 }
 
 // isKittyD checks if buf contains Kitty 'd' (codepoint 100, modifier 1).
@@ -215,3 +215,35 @@ func TestKittyCtrlBCancelRaw(t *testing.T) {
 	}
 	assertBytes(t, fwd, []byte{0x02, 'x'})
 }
+
+func TestDetachCustomKey(t *testing.T) {
+	prefix, err := ParseDetachKey("ctrl-a")
+	if err != nil || prefix != 0x01 {
+		t.Fatalf("ParseDetachKey(ctrl-a) = %v, %v", prefix, err)
+	}
+	d := NewDetachDetectorKey(prefix)
+	// Ctrl+B is ordinary input now.
+	_, fwd := d.FeedBuf([]byte{0x02, 'd'})
+	assertBytes(t, fwd, []byte{0x02, 'd'})
+	detach, _ := d.FeedBuf([]byte{0x01, 'd'})
+	if !detach {
+		t.Error("ctrl-a d did not detach")
+	}
+	// Kitty Ctrl+A (codepoint 97).
+	detach, fwd = d.FeedBuf([]byte("\x1b[97;5ud"))
+	assertFeed(t, detach, fwd, true, []byte{})
+	if got := DetachKeyLabel(prefix); got != "Ctrl+A" {
+		t.Errorf("DetachKeyLabel = %q", got)
+	}
+}
+
+func TestParseDetachKey(t *testing.T) {
+	if prefix, err := ParseDetachKey(""); err != nil || prefix != 0x02 {
+		t.Errorf("default detach key = %v, %v", prefix, err)
+	}
+	for _, key := range []string{"ctrl-m", "ctrl-", "alt-b", "ctrl-bb", "b"} {
+		if _, err := ParseDetachKey(key); err == nil {
+			t.Errorf("ParseDetachKey(%q) succeeded", key)
+		}
+	}
+}
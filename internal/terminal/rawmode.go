@@ -9,6 +9,7 @@ import (
 type RawModeGuard struct {
 	fd       int
 	oldState *term.State
+	restore  func() // undoes enableVT
 }
 
 func EnableRawMode() (*RawModeGuard, error) {
@@ -17,9 +18,10 @@ func EnableRawMode() (*RawModeGuard, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &RawModeGuard{fd: fd, oldState: oldState}, nil
+	return &RawModeGuard{fd: fd, oldState: oldState, restore: enableVT()}, nil
 }
 
 func (g *RawModeGuard) Restore() {
+	g.restore()
 	term.Restore(g.fd, g.oldState)
 }
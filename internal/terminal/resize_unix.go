@@ -0,0 +1,19 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ResizeSignal returns a channel that fires on SIGWINCH and a cleanup function.
+func ResizeSignal() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+	return ch, func() { signal.Stop(ch); close(ch) }
+}
+
+// enableVT does nothing: Unix terminals interpret escape sequences already.
+func enableVT() func() { return func() {} }
@@ -0,0 +1,59 @@
+package terminal
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// resizePoll is how often ResizeSignal checks the console size.
+const resizePoll = 250 * time.Millisecond
+
+// ResizeSignal returns a channel that fires when the console is resized and
+// a cleanup function. Windows has no SIGWINCH, so the size is polled.
+func ResizeSignal() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cols, rows, _ := TerminalSize()
+		ticker := time.NewTicker(resizePoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				c, r, err := TerminalSize()
+				if err != nil || (c == cols && r == rows) {
+					continue
+				}
+				cols, rows = c, r
+				select {
+				case ch <- windows.Signal(0):
+				default:
+				}
+			}
+		}
+	}()
+	return ch, func() { close(done); wg.Wait(); close(ch) }
+}
+
+// enableVT turns on escape sequence processing for the console on stdout,
+// so that session output renders as in a Unix terminal, and returns a
+// function restoring the previous mode.
+func enableVT() func() {
+	h := windows.Handle(os.Stdout.Fd())
+	var mode uint32
+	if windows.GetConsoleMode(h, &mode) != nil {
+		return func() {}
+	}
+	if windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) != nil {
+		return func() {}
+	}
+	return func() { windows.SetConsoleMode(h, mode) }
+}
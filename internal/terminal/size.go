@@ -2,8 +2,6 @@ package terminal
 
 import (
 	"os"
-	"os/signal"
-	"syscall"
 
 	"golang.org/x/term"
 )
@@ -15,10 +13,3 @@ func TerminalSize() (cols, rows uint16, err error) {
 	}
 	return uint16(w), uint16(h), nil
 }
-
-// ResizeSignal returns a channel that fires on SIGWINCH and a cleanup function.
-func ResizeSignal() (<-chan os.Signal, func()) {
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, syscall.SIGWINCH)
-	return ch, func() { signal.Stop(ch); close(ch) }
-}
@@ -75,7 +75,11 @@ func UpgradeCommand(method InstallMethod) string {
 }
 
 func assetSuffix() string {
-	switch runtime.GOOS + "/" + runtime.GOARCH {
+	return assetSuffixFor(runtime.GOOS, runtime.GOARCH)
+}
+
+func assetSuffixFor(goos, goarch string) string {
+	switch goos + "/" + goarch {
 	case "darwin/arm64":
 		return "aarch64-apple-darwin"
 	case "darwin/amd64":
@@ -84,6 +88,8 @@ func assetSuffix() string {
 		return "x86_64-unknown-linux-musl"
 	case "linux/arm64":
 		return "aarch64-unknown-linux-gnu"
+	case "windows/amd64":
+		return "x86_64-pc-windows-gnu.exe"
 	default:
 		return ""
 	}
@@ -91,31 +97,26 @@ func assetSuffix() string {
 
 // AssetName returns the expected binary asset name for the current platform.
 func AssetName(version string) string {
-	suffix := assetSuffix()
+	return AssetNameFor(version, runtime.GOOS, runtime.GOARCH)
+}
+
+// AssetNameFor returns the binary asset name for goos/goarch, or "" if
+// there is no release for that platform.
+func AssetNameFor(version, goos, goarch string) string {
+	suffix := assetSuffixFor(goos, goarch)
 	if suffix == "" {
 		return ""
 	}
 	return fmt.Sprintf("cw-%s-%s", version, suffix)
 }
 
-func releaseURL(version, filename string) string {
-	return fmt.Sprintf("https://github.com/codewiresh/codewire/releases/download/%s/%s", version, filename)
-}
-
-// SelfUpdate downloads the latest binary and replaces the running executable.
-func SelfUpdate(currentVersion, latestVersion string) error {
-	asset := AssetName(latestVersion)
-	if asset == "" {
-		return fmt.Errorf("unsupported platform: %s/%s", runtime.GOOS, runtime.GOARCH)
-	}
-
-	// Fetch checksums
-	sumsURL := releaseURL(latestVersion, "SHA256SUMS")
-	expectedHash, err := fetchChecksum(sumsURL, asset)
-	if err != nil {
-		return fmt.Errorf("fetching checksums: %w", err)
-	}
+// ReleaseBaseURL is where release assets are downloaded from, as
+// <base>/<version>/<file>.
+const ReleaseBaseURL = "https://github.com/codewiresh/codewire/releases/download"
 
+// replaceExecutable downloads the binary at assetURL, checks it against
+// expectedHash (hex SHA-256) and atomically replaces the running executable.
+func replaceExecutable(assetURL, expectedHash string) error {
 	// Resolve current executable path
 	exe, err := os.Executable()
 	if err != nil {
@@ -131,7 +132,7 @@ func SelfUpdate(currentVersion, latestVersion string) error {
 	tmp, err := os.CreateTemp(dir, ".cw-update-*")
 	if err != nil {
 		if os.IsPermission(err) {
-			return fmt.Errorf("permission denied writing to %s — try: sudo cw update", dir)
+			return fmt.Errorf("permission denied writing to %s — try: sudo cw upgrade", dir)
 		}
 		return fmt.Errorf("creating temp file: %w", err)
 	}
@@ -141,7 +142,6 @@ func SelfUpdate(currentVersion, latestVersion string) error {
 		os.Remove(tmpPath)
 	}()
 
-	assetURL := releaseURL(latestVersion, asset)
 	resp, err := http.Get(assetURL)
 	if err != nil {
 		return fmt.Errorf("downloading binary: %w", err)
@@ -168,9 +168,19 @@ func SelfUpdate(currentVersion, latestVersion string) error {
 	if err := os.Chmod(tmpPath, 0o755); err != nil {
 		return fmt.Errorf("setting permissions: %w", err)
 	}
+	if runtime.GOOS == "windows" {
+		// A running executable cannot be replaced on Windows, but it can be
+		// renamed. The old binary is left behind for the next upgrade to
+		// remove.
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return fmt.Errorf("moving old binary aside: %w", err)
+		}
+	}
 	if err := os.Rename(tmpPath, exe); err != nil {
 		if os.IsPermission(err) {
-			return fmt.Errorf("permission denied replacing %s — try: sudo cw update", exe)
+			return fmt.Errorf("permission denied replacing %s — try: sudo cw upgrade", exe)
 		}
 		return fmt.Errorf("replacing binary: %w", err)
 	}
@@ -178,23 +188,9 @@ func SelfUpdate(currentVersion, latestVersion string) error {
 	return nil
 }
 
-func fetchChecksum(sumsURL, assetName string) (string, error) {
-	resp, err := http.Get(sumsURL)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("SHA256SUMS returned HTTP %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	for _, line := range strings.Split(string(body), "\n") {
+// checksumFor finds the hash of assetName in a SHA256SUMS file.
+func checksumFor(sums []byte, assetName string) (string, error) {
+	for _, line := range strings.Split(string(sums), "\n") {
 		// Format: "<hash>  <filename>" or "<hash> <filename>"
 		fields := strings.Fields(line)
 		if len(fields) == 2 && fields[1] == assetName {
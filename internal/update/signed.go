@@ -0,0 +1,135 @@
+package update
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// releaseKey is the public key release checksums are signed with, a copy of
+// GPG_PUBLIC_KEY.asc at the root of the repository.
+//
+//go:embed release_key.asc
+var releaseKey string
+
+// ValidVersion reports whether s is a release version such as v0.2.48.
+func ValidVersion(s string) bool {
+	_, _, _, ok := parseSemver(s)
+	return ok && !strings.ContainsAny(s, "/?#% ")
+}
+
+// VerifySums checks that sig is a valid armored detached signature of sums
+// by one of armoredKeys, or by the release key if armoredKeys is empty.
+func VerifySums(sums, sig []byte, armoredKeys string) error {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(cmp.Or(armoredKeys, releaseKey)))
+	if err != nil {
+		return fmt.Errorf("reading signing key: %w", err)
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(sums), bytes.NewReader(sig)); err != nil {
+		return fmt.Errorf("bad signature on SHA256SUMS: %w", err)
+	}
+	return nil
+}
+
+// InstallSigned replaces the running executable with version, downloaded
+// from baseURL (ReleaseBaseURL if empty) as <base>/<version>/<file>. The
+// release's SHA256SUMS must be signed in SHA256SUMS.asc (see VerifySums)
+// and the binary must match them.
+func InstallSigned(version, baseURL, armoredKeys string) error {
+	if !ValidVersion(version) {
+		return fmt.Errorf("invalid version %q", version)
+	}
+	asset := AssetName(version)
+	if asset == "" {
+		return fmt.Errorf("unsupported platform: %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	base := releaseBase(version, baseURL)
+	hash, err := signedChecksum(base, asset, armoredKeys)
+	if err != nil {
+		return err
+	}
+	return replaceExecutable(base+asset, hash)
+}
+
+// FetchSigned downloads the cw binary of version for goos/goarch, checked
+// against the release's signed SHA256SUMS as by InstallSigned.
+func FetchSigned(version, goos, goarch, baseURL, armoredKeys string) ([]byte, error) {
+	if !ValidVersion(version) {
+		return nil, fmt.Errorf("invalid version %q", version)
+	}
+	asset := AssetNameFor(version, goos, goarch)
+	if asset == "" {
+		return nil, fmt.Errorf("no release for %s/%s", goos, goarch)
+	}
+	base := releaseBase(version, baseURL)
+	hash, err := signedChecksum(base, asset, armoredKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.Get(base + asset)
+	if err != nil {
+		return nil, fmt.Errorf("downloading binary: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download returned HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBinarySize))
+	if err != nil {
+		return nil, fmt.Errorf("downloading binary: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != hash {
+		return nil, fmt.Errorf("checksum mismatch: expected %s, got %s", hash, got)
+	}
+	return data, nil
+}
+
+// maxBinarySize bounds the binaries FetchSigned reads into memory.
+const maxBinarySize = 256 << 20
+
+// releaseBase returns the URL of version's release files under baseURL
+// (ReleaseBaseURL if empty), ending in a slash.
+func releaseBase(version, baseURL string) string {
+	return strings.TrimSuffix(cmp.Or(baseURL, ReleaseBaseURL), "/") + "/" + version + "/"
+}
+
+// signedChecksum returns the hash of asset listed in the SHA256SUMS at
+// base, after checking its signature (see VerifySums).
+func signedChecksum(base, asset, armoredKeys string) (string, error) {
+	sums, err := fetch(base + "SHA256SUMS")
+	if err != nil {
+		return "", fmt.Errorf("fetching checksums: %w", err)
+	}
+	sig, err := fetch(base + "SHA256SUMS.asc")
+	if err != nil {
+		return "", fmt.Errorf("fetching checksum signature: %w", err)
+	}
+	if err := VerifySums(sums, sig, armoredKeys); err != nil {
+		return "", err
+	}
+	return checksumFor(sums, asset)
+}
+
+// fetch reads the small file at url.
+func fetch(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
@@ -0,0 +1,113 @@
+package update
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// testKey returns a new signing key and its armored public key.
+func testKey(t *testing.T) (*openpgp.Entity, string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pub bytes.Buffer
+	w, err := armor.Encode(&pub, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return entity, pub.String()
+}
+
+func TestVerifySums(t *testing.T) {
+	entity, pub := testKey(t)
+
+	sums := []byte("abc123  cw-v1.2.3-x86_64-unknown-linux-musl\n")
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(sums), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifySums(sums, sig.Bytes(), pub); err != nil {
+		t.Fatalf("valid signature: %v", err)
+	}
+	tampered := bytes.Replace(sums, []byte("abc123"), []byte("def456"), 1)
+	if err := VerifySums(tampered, sig.Bytes(), pub); err == nil {
+		t.Fatal("tampered checksums verified")
+	}
+	// The release key is not the test key.
+	err := VerifySums(sums, sig.Bytes(), "")
+	if err == nil || !strings.Contains(err.Error(), "bad signature") {
+		t.Fatalf("release key: %v", err)
+	}
+}
+
+func TestValidVersion(t *testing.T) {
+	for v, want := range map[string]bool{
+		"v1.2.3":     true,
+		"0.2.48":     true,
+		"dev":        false,
+		"v1.2.3/../": false,
+		"":           false,
+	} {
+		if got := ValidVersion(v); got != want {
+			t.Errorf("ValidVersion(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestFetchSigned(t *testing.T) {
+	entity, pub := testKey(t)
+	binary := []byte("\x7fELF cw for linux/arm64")
+	sum := sha256.Sum256(binary)
+	sums := []byte(hex.EncodeToString(sum[:]) + "  cw-v1.2.3-aarch64-unknown-linux-gnu\n")
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(sums), nil); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"/v1.2.3/SHA256SUMS":                          sums,
+		"/v1.2.3/SHA256SUMS.asc":                      sig.Bytes(),
+		"/v1.2.3/cw-v1.2.3-aarch64-unknown-linux-gnu": binary,
+		"/v1.2.3/cw-v1.2.3-x86_64-apple-darwin":       []byte("not in SHA256SUMS"),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	got, err := FetchSigned("v1.2.3", "linux", "arm64", srv.URL, pub)
+	if err != nil {
+		t.Fatalf("FetchSigned: %v", err)
+	}
+	if !bytes.Equal(got, binary) {
+		t.Fatalf("FetchSigned = %q, want %q", got, binary)
+	}
+	if _, err := FetchSigned("v1.2.3", "darwin", "amd64", srv.URL, pub); err == nil {
+		t.Fatal("binary missing from SHA256SUMS was fetched")
+	}
+	if _, err := FetchSigned("v1.2.3", "linux", "arm64", srv.URL, ""); err == nil {
+		t.Fatal("checksums not signed by the release key were trusted")
+	}
+	if _, err := FetchSigned("v1.2.3", "plan9", "386", srv.URL, pub); err == nil {
+		t.Fatal("fetched a binary for a platform without releases")
+	}
+}
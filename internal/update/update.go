@@ -9,12 +9,17 @@ import (
 	"strconv"
 	"strings"
 	"time"
+)
 
-	"github.com/mattn/go-isatty"
+// Release channels cw upgrade follows.
+const (
+	ChannelStable  = "stable"  // the latest release
+	ChannelNightly = "nightly" // the newest release, prereleases included
 )
 
 const (
 	githubAPI  = "https://api.github.com/repos/codewiresh/codewire/releases/latest"
+	githubReleasesAPI = "https://api.github.com/repos/codewiresh/codewire/releases?per_page=1"
 	cacheTTL   = 24 * time.Hour
 	cacheFile  = "update-check.json"
 	fetchTimeout = 5 * time.Second
@@ -35,34 +40,76 @@ func FetchLatestVersion() (string, error) {
 	return fetchLatestVersionFrom(githubAPI)
 }
 
+// FetchChannelVersion returns the version a release channel is at.
+func FetchChannelVersion(channel string) (string, error) {
+	switch channel {
+	case ChannelStable:
+		return FetchLatestVersion()
+	case ChannelNightly:
+		return fetchNewestVersionFrom(githubReleasesAPI)
+	}
+	return "", fmt.Errorf("unknown channel %q (stable or nightly)", channel)
+}
+
 // httpClient is the client used for API requests. Tests may override this.
 var httpClient = &http.Client{Timeout: fetchTimeout}
 
 func fetchLatestVersionFrom(url string) (string, error) {
+	var rel githubRelease
+	if err := getGitHub(url, &rel); err != nil {
+		return "", err
+	}
+	if rel.TagName == "" {
+		return "", fmt.Errorf("empty tag_name in response")
+	}
+	return rel.TagName, nil
+}
+
+// fetchNewestVersionFrom returns the tag_name of the first release listed,
+// the newest, which may be a prerelease.
+func fetchNewestVersionFrom(url string) (string, error) {
+	var rels []githubRelease
+	if err := getGitHub(url, &rels); err != nil {
+		return "", err
+	}
+	if len(rels) == 0 || rels[0].TagName == "" {
+		return "", fmt.Errorf("no releases in response")
+	}
+	return rels[0].TagName, nil
+}
+
+// getGitHub decodes the JSON response of a GitHub API request into v.
+func getGitHub(url string, v any) error {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return "", err
+		return err
 	}
 	req.Header.Set("Accept", "application/vnd.github+json")
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("github API returned %d", resp.StatusCode)
+		return fmt.Errorf("github API returned %d", resp.StatusCode)
 	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
 
-	var rel githubRelease
-	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
-		return "", err
+// UpgradeAvailable reports whether cw at current should upgrade to latest,
+// the version of channel. On stable only a higher version is an upgrade; on
+// nightly any other build that is not older is, but a release is not left
+// for a prerelease of itself.
+func UpgradeAvailable(channel, current, latest string) bool {
+	if channel != ChannelNightly {
+		return IsNewer(current, latest)
 	}
-	if rel.TagName == "" {
-		return "", fmt.Errorf("empty tag_name in response")
+	if latest == current || IsNewer(latest, current) {
+		return false
 	}
-	return rel.TagName, nil
+	return IsNewer(current, latest) || strings.Contains(current, "-")
 }
 
 // IsNewer returns true if latest is a higher semver than current.
@@ -112,12 +159,12 @@ func parseSemver(s string) (int, int, int, bool) {
 }
 
 // BackgroundCheck starts a goroutine that checks for updates and returns a
-// closure that prints a notice to stderr if an update is available.
-// The closure should be called after the main command completes.
-// Silent on all errors. Skipped for dev builds.
-func BackgroundCheck(currentVersion string) func() {
+// closure that prints a notice to stderr if an update is available, in
+// color if asked. The closure should be called after the main command
+// completes. Silent on all errors. Skipped for dev builds.
+func BackgroundCheck(currentVersion string) func(color bool) {
 	if currentVersion == "dev" {
-		return func() {}
+		return func(bool) {}
 	}
 
 	type result struct {
@@ -131,15 +178,15 @@ func BackgroundCheck(currentVersion string) func() {
 		ch <- result{latest, newer}
 	}()
 
-	return func() {
+	return func(color bool) {
 		select {
 		case r := <-ch:
 			if r.newer {
 				msg := fmt.Sprintf("A new version of cw is available: %s → %s", currentVersion, r.latest)
-				if os.Getenv("NO_COLOR") == "" && (isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd())) {
+				if color {
 					msg = "\033[33m" + msg + "\033[0m"
 				}
-				fmt.Fprintf(os.Stderr, "\n%s\nRun `cw update` to upgrade.\n", msg)
+				fmt.Fprintf(os.Stderr, "\n%s\nRun `cw upgrade` to upgrade.\n", msg)
 			}
 		default:
 		}
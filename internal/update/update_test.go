@@ -82,6 +82,49 @@ func TestFetchLatestVersion(t *testing.T) {
 	}
 }
 
+func TestFetchNewestVersion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]githubRelease{{TagName: "v0.3.0-nightly.20261015"}, {TagName: "v0.2.49"}})
+	}))
+	defer srv.Close()
+
+	saved := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = saved }()
+
+	got, err := fetchNewestVersionFrom(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "v0.3.0-nightly.20261015" {
+		t.Errorf("got %q, want %q", got, "v0.3.0-nightly.20261015")
+	}
+	if _, err := FetchChannelVersion("beta"); err == nil {
+		t.Error("expected error for unknown channel")
+	}
+}
+
+func TestUpgradeAvailable(t *testing.T) {
+	tests := []struct {
+		channel, current, latest string
+		want                     bool
+	}{
+		{ChannelStable, "v0.2.48", "v0.2.49", true},
+		{ChannelStable, "v0.2.49", "v0.2.49", false},
+		{ChannelStable, "v0.3.0-nightly.20261015", "v0.2.49", false},
+		{ChannelNightly, "v0.2.49", "v0.3.0-nightly.20261015", true},
+		{ChannelNightly, "v0.3.0-nightly.20261014", "v0.3.0-nightly.20261015", true},
+		{ChannelNightly, "v0.3.0-nightly.20261015", "v0.3.0-nightly.20261015", false},
+		{ChannelNightly, "v0.3.0", "v0.3.0-nightly.20261015", false},
+		{ChannelNightly, "v0.3.1", "v0.3.0-nightly.20261015", false},
+	}
+	for _, tt := range tests {
+		if got := UpgradeAvailable(tt.channel, tt.current, tt.latest); got != tt.want {
+			t.Errorf("UpgradeAvailable(%q, %q, %q) = %v, want %v", tt.channel, tt.current, tt.latest, got, tt.want)
+		}
+	}
+}
+
 func TestFetchLatestVersionError(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusForbidden)
@@ -104,7 +147,7 @@ func TestAssetSuffix(t *testing.T) {
 		t.Skip("unsupported platform for this test")
 	}
 	// Should contain a known target triple component
-	known := []string{"apple-darwin", "unknown-linux-musl", "unknown-linux-gnu"}
+	known := []string{"apple-darwin", "unknown-linux-musl", "unknown-linux-gnu", "pc-windows-gnu"}
 	found := false
 	for _, k := range known {
 		if contains(suffix, k) {
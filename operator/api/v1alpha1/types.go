@@ -26,6 +26,10 @@ type CodewireRelaySpec struct {
 	// Ingress configures the Ingress resource for HTTPS API access.
 	Ingress *IngressSpec `json:"ingress,omitempty"`
 
+	// TLS configures the certificate the Ingress serves.
+	// +optional
+	TLS *TLSSpec `json:"tls,omitempty"`
+
 	// SSH configures the SSH gateway service.
 	SSH SSHSpec `json:"ssh,omitempty"`
 
@@ -44,6 +48,15 @@ type CodewireRelaySpec struct {
 	// OIDC configures OIDC authentication for the relay.
 	// +optional
 	OIDC *OIDCSpec `json:"oidc,omitempty"`
+
+	// Backup configures scheduled backups of the relay data to S3, and the
+	// restore of the newest backup when the data volume is empty.
+	// +optional
+	Backup *BackupSpec `json:"backup,omitempty"`
+
+	// Monitoring configures Prometheus scraping of the relay's /metrics.
+	// +optional
+	Monitoring *MonitoringSpec `json:"monitoring,omitempty"`
 }
 
 type PersistenceSpec struct {
@@ -63,6 +76,34 @@ type IngressSpec struct {
 	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
+type TLSSpec struct {
+	// SecretName is the Secret holding the Ingress certificate (default <name>-tls).
+	SecretName string `json:"secretName,omitempty"`
+
+	// CertManager has cert-manager issue the certificate for the baseURL host
+	// into SecretName. Without it, the Secret must be provided.
+	// +optional
+	CertManager *CertManagerSpec `json:"certManager,omitempty"`
+}
+
+type CertManagerSpec struct {
+	// IssuerRef references the cert-manager Issuer or ClusterIssuer to use.
+	IssuerRef IssuerRef `json:"issuerRef"`
+}
+
+type IssuerRef struct {
+	// Name of the issuer.
+	Name string `json:"name"`
+
+	// Kind of the issuer: Issuer (in the relay's namespace) or ClusterIssuer.
+	// +kubebuilder:default=Issuer
+	Kind string `json:"kind,omitempty"`
+
+	// Group of the issuer, for external issuers.
+	// +kubebuilder:default=cert-manager.io
+	Group string `json:"group,omitempty"`
+}
+
 type SSHSpec struct {
 	// Service configures the SSH gateway Kubernetes Service.
 	Service SSHServiceSpec `json:"service,omitempty"`
@@ -138,6 +179,48 @@ type OIDCSpec struct {
 	AllowedGroups []string `json:"allowedGroups,omitempty"`
 }
 
+type BackupSpec struct {
+	// Schedule is the cron schedule of backups (e.g. "0 3 * * *").
+	Schedule string `json:"schedule"`
+
+	// S3 is where backups are stored.
+	S3 S3Spec `json:"s3"`
+}
+
+type S3Spec struct {
+	// Bucket is the S3 bucket.
+	Bucket string `json:"bucket"`
+
+	// Prefix for the backup object keys (default <namespace>/<name>).
+	Prefix string `json:"prefix,omitempty"`
+
+	// Region of the bucket (default us-east-1).
+	Region string `json:"region,omitempty"`
+
+	// Endpoint of an S3-compatible service, instead of AWS S3.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// CredentialsSecret is the name of a Secret with AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY keys.
+	CredentialsSecret string `json:"credentialsSecret"`
+}
+
+type MonitoringSpec struct {
+	// Enabled creates a Prometheus Operator monitor for the relay.
+	Enabled bool `json:"enabled"`
+
+	// Kind of monitor to create: ServiceMonitor or PodMonitor.
+	// +kubebuilder:default=ServiceMonitor
+	// +kubebuilder:validation:Enum=ServiceMonitor;PodMonitor
+	Kind string `json:"kind,omitempty"`
+
+	// Interval between scrapes (e.g. 30s). Empty uses Prometheus' default.
+	Interval string `json:"interval,omitempty"`
+
+	// Labels added to the monitor, to match a Prometheus' monitor selector.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
 // CodewireRelayStatus defines the observed state of a Codewire Relay instance.
 type CodewireRelayStatus struct {
 	// Phase is the current lifecycle phase.
@@ -153,6 +236,15 @@ type CodewireRelayStatus struct {
 	// ConnectedNodes is the number of currently connected nodes.
 	ConnectedNodes int32 `json:"connectedNodes,omitempty"`
 
+	// RegisteredNodes is the number of nodes registered with the relay.
+	RegisteredNodes int32 `json:"registeredNodes,omitempty"`
+
+	// ActiveTunnels is the number of SSH sessions the relay is bridging to nodes.
+	ActiveTunnels int32 `json:"activeTunnels,omitempty"`
+
+	// LastBackupTime is when the last scheduled backup succeeded.
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+
 	// Conditions represent the latest available observations.
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
@@ -162,6 +254,8 @@ type CodewireRelayStatus struct {
 // +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
 // +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.relayURL`
 // +kubebuilder:printcolumn:name="Nodes",type=integer,JSONPath=`.status.connectedNodes`
+// +kubebuilder:printcolumn:name="Registered",type=integer,JSONPath=`.status.registeredNodes`,priority=1
+// +kubebuilder:printcolumn:name="Tunnels",type=integer,JSONPath=`.status.activeTunnels`,priority=1
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // CodewireRelay is the Schema for the codewirerelays API.
@@ -12,13 +12,16 @@ import (
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -40,6 +43,19 @@ const (
 	ConditionSSHReady            = "SSHReady"
 	ConditionDNSConfigured       = "DNSConfigured"
 	ConditionCredentialsInjected = "CredentialsInjected"
+	ConditionCertificateReady    = "CertificateReady"
+)
+
+// certificateGVK is cert-manager's Certificate. It is handled as an
+// unstructured object so the operator does not depend on cert-manager, and
+// runs in clusters that do not have it installed.
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// The Prometheus Operator's monitors, handled as unstructured objects for
+// the same reason as certificateGVK.
+var (
+	serviceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+	podMonitorGVK     = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PodMonitor"}
 )
 
 // CodewireRelayReconciler reconciles a CodewireRelay object.
@@ -58,6 +74,9 @@ type CodewireRelayReconciler struct {
 // +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;podmonitors,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile handles the reconciliation loop for a CodewireRelay resource.
 func (r *CodewireRelayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -179,6 +198,20 @@ func (r *CodewireRelayReconciler) runSubReconcilers(ctx context.Context, relay *
 		return fmt.Errorf("reconcile SSH Service: %w", err)
 	}
 
+	// Backup CronJob (removed when backups are not configured)
+	if err := r.reconcileBackup(ctx, relay); err != nil {
+		logger.Error(err, "failed to reconcile backup CronJob")
+		return fmt.Errorf("reconcile backup CronJob: %w", err)
+	}
+
+	// Certificate (optional)
+	if relay.Spec.TLS != nil && relay.Spec.TLS.CertManager != nil {
+		if err := r.reconcileCertificate(ctx, relay); err != nil {
+			logger.Error(err, "failed to reconcile Certificate")
+			return fmt.Errorf("reconcile Certificate: %w", err)
+		}
+	}
+
 	// Ingress (optional)
 	if relay.Spec.Ingress != nil {
 		if err := r.reconcileIngress(ctx, relay); err != nil {
@@ -187,6 +220,12 @@ func (r *CodewireRelayReconciler) runSubReconcilers(ctx context.Context, relay *
 		}
 	}
 
+	// Prometheus monitor (removed when monitoring is not enabled)
+	if err := r.reconcileMonitoring(ctx, relay); err != nil {
+		logger.Error(err, "failed to reconcile monitoring")
+		return fmt.Errorf("reconcile monitoring: %w", err)
+	}
+
 	// SSH Endpoint (watch LoadBalancer)
 	if err := r.reconcileSSHEndpoint(ctx, relay); err != nil {
 		logger.Error(err, "failed to reconcile SSH endpoint")
@@ -361,6 +400,7 @@ func (r *CodewireRelayReconciler) reconcileDeployment(ctx context.Context, relay
 				Labels: labels,
 			},
 			Spec: corev1.PodSpec{
+				InitContainers: r.restoreInitContainers(relay),
 				Containers: []corev1.Container{
 					{
 						Name:    "relay",
@@ -606,7 +646,7 @@ func (r *CodewireRelayReconciler) reconcileIngress(ctx context.Context, relay *c
 		ing.Spec.TLS = []networkingv1.IngressTLS{
 			{
 				Hosts:      []string{hostname},
-				SecretName: relay.Name + "-tls",
+				SecretName: tlsSecretName(relay),
 			},
 		}
 
@@ -616,6 +656,201 @@ func (r *CodewireRelayReconciler) reconcileIngress(ctx context.Context, relay *c
 	return err
 }
 
+// reconcileCertificate ensures a cert-manager Certificate issues the
+// certificate for the baseURL host into the Secret the Ingress serves, and
+// reports whether it has been issued.
+func (r *CodewireRelayReconciler) reconcileCertificate(ctx context.Context, relay *codewire.CodewireRelay) error {
+	parsedURL, err := url.Parse(relay.Spec.BaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid baseURL %q: %w", relay.Spec.BaseURL, err)
+	}
+	hostname := parsedURL.Hostname()
+
+	issuer := relay.Spec.TLS.CertManager.IssuerRef
+	if issuer.Kind == "" {
+		issuer.Kind = "Issuer"
+	}
+	if issuer.Group == "" {
+		issuer.Group = "cert-manager.io"
+	}
+
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(certificateGVK)
+	cert.SetName(relay.Name)
+	cert.SetNamespace(relay.Namespace)
+
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, cert, func() error {
+		if err := ctrl.SetControllerReference(relay, cert, r.Scheme); err != nil {
+			return err
+		}
+
+		cert.SetLabels(labelsForRelay(relay))
+		cert.Object["spec"] = map[string]interface{}{
+			"secretName": tlsSecretName(relay),
+			"dnsNames":   []interface{}{hostname},
+			"issuerRef": map[string]interface{}{
+				"name":  issuer.Name,
+				"kind":  issuer.Kind,
+				"group": issuer.Group,
+			},
+		}
+
+		return nil
+	})
+	if meta.IsNoMatchError(err) {
+		r.setCondition(relay, ConditionCertificateReady, metav1.ConditionFalse,
+			"CertManagerNotInstalled", "cert-manager is not installed in the cluster")
+		return fmt.Errorf("tls.certManager is set but the Certificate CRD is missing: %w", err)
+	}
+	if err != nil {
+		r.setCondition(relay, ConditionCertificateReady, metav1.ConditionFalse,
+			"CertificateError", fmt.Sprintf("failed to reconcile Certificate: %v", err))
+		return err
+	}
+
+	// The Certificate is not watched, since its CRD may be missing; its
+	// readiness is picked up by the periodic requeue.
+	status, reason, message := certificateReady(cert)
+	if status == metav1.ConditionTrue {
+		r.setCondition(relay, ConditionCertificateReady, metav1.ConditionTrue,
+			"Issued", fmt.Sprintf("Certificate for %s issued into %s", hostname, tlsSecretName(relay)))
+		return nil
+	}
+	if reason == "" {
+		reason, message = "Pending", fmt.Sprintf("Waiting for %s %s to issue the certificate", issuer.Kind, issuer.Name)
+	}
+	r.setCondition(relay, ConditionCertificateReady, metav1.ConditionFalse, reason, message)
+
+	return nil
+}
+
+// reconcileBackup ensures the CronJob that backs the relay data up to S3
+// exists when backups are configured, and is removed when they are not.
+func (r *CodewireRelayReconciler) reconcileBackup(ctx context.Context, relay *codewire.CodewireRelay) error {
+	cron := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      relay.Name + "-backup",
+			Namespace: relay.Namespace,
+		},
+	}
+
+	if relay.Spec.Backup == nil {
+		relay.Status.LastBackupTime = nil
+		return client.IgnoreNotFound(r.Delete(ctx, cron))
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, cron, func() error {
+		if err := ctrl.SetControllerReference(relay, cron, r.Scheme); err != nil {
+			return err
+		}
+
+		cron.Labels = labelsForRelay(relay)
+		cron.Spec.Schedule = relay.Spec.Backup.Schedule
+		cron.Spec.ConcurrencyPolicy = batchv1.ForbidConcurrent
+
+		backoffLimit := int32(2)
+		cron.Spec.JobTemplate.Spec.BackoffLimit = &backoffLimit
+		cron.Spec.JobTemplate.Spec.Template = corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: backupLabelsForRelay(relay),
+			},
+			Spec: corev1.PodSpec{
+				RestartPolicy: corev1.RestartPolicyOnFailure,
+				// The data volume is usually ReadWriteOnce, so the backup
+				// runs on the relay pod's node to mount it alongside.
+				Affinity: &corev1.Affinity{
+					PodAffinity: &corev1.PodAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+							{
+								LabelSelector: &metav1.LabelSelector{
+									MatchLabels: labelsForRelay(relay),
+								},
+								TopologyKey: "kubernetes.io/hostname",
+							},
+						},
+					},
+				},
+				Containers: []corev1.Container{
+					r.backupContainer(relay, "backup", []string{"cw", "relay", "backup", "--data-dir=/data"}),
+				},
+				Volumes: []corev1.Volume{
+					{
+						Name: "data",
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+								ClaimName: relay.Name + "-data",
+							},
+						},
+					},
+				},
+			},
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	relay.Status.LastBackupTime = cron.Status.LastSuccessfulTime
+	return nil
+}
+
+// restoreInitContainers returns the init container that restores the newest
+// backup into an empty data volume before the relay starts, so that a lost
+// PVC does not mean onboarding every node again. It is empty when backups
+// are not configured.
+func (r *CodewireRelayReconciler) restoreInitContainers(relay *codewire.CodewireRelay) []corev1.Container {
+	if relay.Spec.Backup == nil {
+		return nil
+	}
+	return []corev1.Container{
+		r.backupContainer(relay, "restore", []string{"cw", "relay", "restore", "--data-dir=/data", "--if-missing"}),
+	}
+}
+
+// backupContainer returns a container running the cw command with the
+// relay's S3 backup location and credentials, and its data volume mounted.
+func (r *CodewireRelayReconciler) backupContainer(relay *codewire.CodewireRelay, name string, command []string) corev1.Container {
+	s3 := relay.Spec.Backup.S3
+	prefix := s3.Prefix
+	if prefix == "" {
+		prefix = relay.Namespace + "/" + relay.Name
+	}
+	args := []string{
+		fmt.Sprintf("--s3-bucket=%s", s3.Bucket),
+		fmt.Sprintf("--s3-prefix=%s", prefix),
+	}
+	if s3.Region != "" {
+		args = append(args, fmt.Sprintf("--s3-region=%s", s3.Region))
+	}
+	if s3.Endpoint != "" {
+		args = append(args, fmt.Sprintf("--s3-endpoint=%s", s3.Endpoint))
+	}
+
+	return corev1.Container{
+		Name:    name,
+		Image:   r.relayImage(relay),
+		Command: command,
+		Args:    args,
+		EnvFrom: []corev1.EnvFromSource{
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: s3.CredentialsSecret,
+					},
+				},
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "data",
+				MountPath: "/data",
+			},
+		},
+	}
+}
+
 // reconcileHealthCheck probes the relay's /healthz endpoint via the cluster-
 // internal HTTP service to determine readiness.
 func (r *CodewireRelayReconciler) reconcileHealthCheck(ctx context.Context, relay *codewire.CodewireRelay) error {
@@ -648,6 +883,7 @@ func (r *CodewireRelayReconciler) reconcileHealthCheck(ctx context.Context, rela
 	if resp.StatusCode == http.StatusOK {
 		r.setCondition(relay, ConditionReady, metav1.ConditionTrue,
 			"Healthy", "Relay is healthy")
+		r.updateRelayStats(ctx, httpClient, relay)
 	} else {
 		r.setCondition(relay, ConditionReady, metav1.ConditionFalse,
 			"Unhealthy", fmt.Sprintf("health check returned status %d", resp.StatusCode))
@@ -656,6 +892,122 @@ func (r *CodewireRelayReconciler) reconcileHealthCheck(ctx context.Context, rela
 	return nil
 }
 
+// relayStats is the relay's GET /api/v1/stats response.
+type relayStats struct {
+	Nodes          int32 `json:"nodes"`
+	ConnectedNodes int32 `json:"connected_nodes"`
+	Tunnels        int32 `json:"tunnels"`
+}
+
+// updateRelayStats copies the node and tunnel counts from the relay's stats
+// endpoint into the status. Failures keep the previous counts; they are only
+// logged, since the relay already passed its health check.
+func (r *CodewireRelayReconciler) updateRelayStats(ctx context.Context, httpClient *http.Client, relay *codewire.CodewireRelay) {
+	logger := log.FromContext(ctx)
+
+	statsURL := fmt.Sprintf("http://%s-http.%s.svc.cluster.local:8080/api/v1/stats",
+		relay.Name, relay.Namespace)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, statsURL, nil)
+	if err != nil {
+		logger.Error(err, "failed to create stats request")
+		return
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		logger.Error(err, "relay stats request failed")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Info("relay stats unavailable", "status", resp.StatusCode)
+		return
+	}
+	var stats relayStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		logger.Error(err, "failed to decode relay stats")
+		return
+	}
+
+	relay.Status.RegisteredNodes = stats.Nodes
+	relay.Status.ConnectedNodes = stats.ConnectedNodes
+	relay.Status.ActiveTunnels = stats.Tunnels
+}
+
+// reconcileMonitoring ensures a ServiceMonitor or PodMonitor scrapes the
+// relay's /metrics when monitoring is enabled, and removes monitors the
+// spec no longer asks for.
+func (r *CodewireRelayReconciler) reconcileMonitoring(ctx context.Context, relay *codewire.CodewireRelay) error {
+	spec := relay.Spec.Monitoring
+	var gvk schema.GroupVersionKind
+	if spec != nil && spec.Enabled {
+		gvk = serviceMonitorGVK
+		if spec.Kind == podMonitorGVK.Kind {
+			gvk = podMonitorGVK
+		}
+	}
+
+	for _, other := range []schema.GroupVersionKind{serviceMonitorGVK, podMonitorGVK} {
+		if other == gvk {
+			continue
+		}
+		stale := &unstructured.Unstructured{}
+		stale.SetGroupVersionKind(other)
+		stale.SetName(relay.Name)
+		stale.SetNamespace(relay.Namespace)
+		if err := r.Delete(ctx, stale); err != nil && !errors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return fmt.Errorf("delete %s: %w", other.Kind, err)
+		}
+	}
+	if gvk.Empty() {
+		return nil
+	}
+
+	monitor := &unstructured.Unstructured{}
+	monitor.SetGroupVersionKind(gvk)
+	monitor.SetName(relay.Name)
+	monitor.SetNamespace(relay.Namespace)
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, monitor, func() error {
+		if err := ctrl.SetControllerReference(relay, monitor, r.Scheme); err != nil {
+			return err
+		}
+
+		labels := labelsForRelay(relay)
+		for k, v := range spec.Labels {
+			labels[k] = v
+		}
+		monitor.SetLabels(labels)
+
+		endpoint := map[string]interface{}{
+			"port": "http",
+			"path": "/metrics",
+		}
+		if spec.Interval != "" {
+			endpoint["interval"] = spec.Interval
+		}
+		selector := map[string]interface{}{}
+		for k, v := range labelsForRelay(relay) {
+			selector[k] = v
+		}
+		endpointsField := "endpoints"
+		if gvk == podMonitorGVK {
+			endpointsField = "podMetricsEndpoints"
+		}
+		monitor.Object["spec"] = map[string]interface{}{
+			"selector":     map[string]interface{}{"matchLabels": selector},
+			endpointsField: []interface{}{endpoint},
+		}
+
+		return nil
+	})
+	if meta.IsNoMatchError(err) {
+		return fmt.Errorf("monitoring is enabled but the %s CRD is missing (is the Prometheus Operator installed?): %w", gvk.Kind, err)
+	}
+
+	return err
+}
+
 // reconcileDNS ensures the DNS record for the relay is configured. Currently
 // only Cloudflare is supported as a provider.
 func (r *CodewireRelayReconciler) reconcileDNS(ctx context.Context, relay *codewire.CodewireRelay) error {
@@ -970,6 +1322,32 @@ func (r *CodewireRelayReconciler) setCondition(relay *codewire.CodewireRelay, co
 	})
 }
 
+// tlsSecretName returns the name of the Secret holding the relay's TLS
+// certificate.
+func tlsSecretName(relay *codewire.CodewireRelay) string {
+	if relay.Spec.TLS != nil && relay.Spec.TLS.SecretName != "" {
+		return relay.Spec.TLS.SecretName
+	}
+	return relay.Name + "-tls"
+}
+
+// certificateReady returns the status, reason and message of a cert-manager
+// Certificate's Ready condition, with an empty status if it has none yet.
+func certificateReady(cert *unstructured.Unstructured) (metav1.ConditionStatus, string, string) {
+	conditions, _, _ := unstructured.NestedSlice(cert.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok || cond["type"] != "Ready" {
+			continue
+		}
+		status, _ := cond["status"].(string)
+		reason, _ := cond["reason"].(string)
+		message, _ := cond["message"].(string)
+		return metav1.ConditionStatus(status), reason, message
+	}
+	return "", "", ""
+}
+
 // labelsForRelay returns the standard set of labels for resources managed by
 // this operator for a given CodewireRelay instance.
 func labelsForRelay(relay *codewire.CodewireRelay) map[string]string {
@@ -980,6 +1358,16 @@ func labelsForRelay(relay *codewire.CodewireRelay) map[string]string {
 	}
 }
 
+// backupLabelsForRelay returns the labels of a relay's backup pods. They
+// differ from labelsForRelay, which the relay's Services select pods by.
+func backupLabelsForRelay(relay *codewire.CodewireRelay) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":       "codewire-relay-backup",
+		"app.kubernetes.io/instance":   relay.Name,
+		"app.kubernetes.io/managed-by": "codewire-operator",
+	}
+}
+
 // relayImage returns the container image to use for the relay. It checks the
 // CR spec first, then falls back to the reconciler's configured default, and
 // finally to the hardcoded default.
@@ -1010,5 +1398,6 @@ func (r *CodewireRelayReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Owns(&corev1.Service{}).
 		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&networkingv1.Ingress{}).
+		Owns(&batchv1.CronJob{}).
 		Complete(r)
 }
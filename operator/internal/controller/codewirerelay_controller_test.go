@@ -8,11 +8,15 @@ import (
 	"testing"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -22,13 +26,18 @@ import (
 	codewire "github.com/codewiresh/codewire/operator/api/v1alpha1"
 )
 
-// mockRoundTripper returns HTTP 200 for all requests (used to mock health checks).
+// mockRoundTripper returns HTTP 200 for all requests (used to mock health
+// checks), with fixed counts for the relay's stats endpoint.
 type mockRoundTripper struct{}
 
-func (m *mockRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+func (m *mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := "ok"
+	if req.URL.Path == "/api/v1/stats" {
+		body = `{"nodes":5,"connected_nodes":3,"tunnels":2,"tunnels_total":40}`
+	}
 	return &http.Response{
 		StatusCode: http.StatusOK,
-		Body:       io.NopCloser(strings.NewReader("ok")),
+		Body:       io.NopCloser(strings.NewReader(body)),
 		Header:     make(http.Header),
 	}, nil
 }
@@ -42,6 +51,14 @@ func testScheme(t *testing.T) *runtime.Scheme {
 	if err := codewire.AddToScheme(s); err != nil {
 		t.Fatal(err)
 	}
+	// cert-manager's Certificate, as if its CRD were installed.
+	s.AddKnownTypeWithName(certificateGVK, &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(certificateGVK.GroupVersion().WithKind("CertificateList"), &unstructured.UnstructuredList{})
+	// The Prometheus Operator's monitors, likewise.
+	for _, gvk := range []schema.GroupVersionKind{serviceMonitorGVK, podMonitorGVK} {
+		s.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		s.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
 	return s
 }
 
@@ -295,6 +312,249 @@ func TestReconcile_IngressNotCreated(t *testing.T) {
 	}
 }
 
+func TestReconcile_CertManagerCertificate(t *testing.T) {
+	relay := newRelay("test", "default")
+	relay.Spec.Ingress = &codewire.IngressSpec{ClassName: "nginx"}
+	relay.Spec.TLS = &codewire.TLSSpec{
+		CertManager: &codewire.CertManagerSpec{
+			IssuerRef: codewire.IssuerRef{Name: "letsencrypt", Kind: "ClusterIssuer"},
+		},
+	}
+	r, c := setup(t, relay)
+	doReconcile(t, r, "test", "default")
+
+	key := types.NamespacedName{Name: "test", Namespace: "default"}
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(certificateGVK)
+	getObj(t, c, key, cert)
+
+	if name, _, _ := unstructured.NestedString(cert.Object, "spec", "secretName"); name != "test-tls" {
+		t.Errorf("Certificate secretName = %q, want test-tls", name)
+	}
+	dnsNames, _, _ := unstructured.NestedStringSlice(cert.Object, "spec", "dnsNames")
+	if len(dnsNames) != 1 || dnsNames[0] != "test.relay.example.com" {
+		t.Errorf("Certificate dnsNames = %v, want [test.relay.example.com]", dnsNames)
+	}
+	issuer, _, _ := unstructured.NestedStringMap(cert.Object, "spec", "issuerRef")
+	want := map[string]string{"name": "letsencrypt", "kind": "ClusterIssuer", "group": "cert-manager.io"}
+	for k, v := range want {
+		if issuer[k] != v {
+			t.Errorf("Certificate issuerRef.%s = %q, want %q", k, issuer[k], v)
+		}
+	}
+	if refs := cert.GetOwnerReferences(); len(refs) != 1 || refs[0].Name != "test" {
+		t.Errorf("Certificate owner references = %v, want the relay", refs)
+	}
+
+	ing := &networkingv1.Ingress{}
+	getObj(t, c, key, ing)
+	if len(ing.Spec.TLS) != 1 || ing.Spec.TLS[0].SecretName != "test-tls" {
+		t.Errorf("Ingress TLS = %v, want secret test-tls", ing.Spec.TLS)
+	}
+
+	updated := &codewire.CodewireRelay{}
+	getObj(t, c, key, updated)
+	cond := meta.FindStatusCondition(updated.Status.Conditions, ConditionCertificateReady)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "Pending" {
+		t.Fatalf("CertificateReady condition = %+v, want False/Pending", cond)
+	}
+
+	// Once cert-manager has issued the certificate, the condition turns true.
+	if err := unstructured.SetNestedSlice(cert.Object, []interface{}{
+		map[string]interface{}{"type": "Ready", "status": "True", "reason": "Ready"},
+	}, "status", "conditions"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Update(context.Background(), cert); err != nil {
+		t.Fatal(err)
+	}
+	doReconcile(t, r, "test", "default")
+
+	getObj(t, c, key, updated)
+	if !meta.IsStatusConditionTrue(updated.Status.Conditions, ConditionCertificateReady) {
+		t.Errorf("CertificateReady condition = %+v, want True",
+			meta.FindStatusCondition(updated.Status.Conditions, ConditionCertificateReady))
+	}
+}
+
+func TestReconcile_TLSSecretName(t *testing.T) {
+	relay := newRelay("test", "default")
+	relay.Spec.Ingress = &codewire.IngressSpec{}
+	relay.Spec.TLS = &codewire.TLSSpec{SecretName: "relay-cert"}
+	r, c := setup(t, relay)
+	doReconcile(t, r, "test", "default")
+
+	ing := &networkingv1.Ingress{}
+	getObj(t, c, types.NamespacedName{Name: "test", Namespace: "default"}, ing)
+	if len(ing.Spec.TLS) != 1 || ing.Spec.TLS[0].SecretName != "relay-cert" {
+		t.Errorf("Ingress TLS = %v, want secret relay-cert", ing.Spec.TLS)
+	}
+
+	// Without certManager the Secret is provided by the user.
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(certificateGVK)
+	err := c.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "default"}, cert)
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected Certificate to not exist, got err=%v", err)
+	}
+}
+
+func TestReconcile_Backup(t *testing.T) {
+	relay := newRelay("test", "default")
+	relay.Spec.Backup = &codewire.BackupSpec{
+		Schedule: "0 3 * * *",
+		S3: codewire.S3Spec{
+			Bucket:            "acme-backups",
+			Endpoint:          "https://minio.example.com",
+			CredentialsSecret: "backup-creds",
+		},
+	}
+	r, c := setup(t, relay)
+	doReconcile(t, r, "test", "default")
+
+	cron := &batchv1.CronJob{}
+	getObj(t, c, types.NamespacedName{Name: "test-backup", Namespace: "default"}, cron)
+	if cron.Spec.Schedule != "0 3 * * *" {
+		t.Errorf("schedule = %q, want 0 3 * * *", cron.Spec.Schedule)
+	}
+	if cron.Spec.ConcurrencyPolicy != batchv1.ForbidConcurrent {
+		t.Errorf("concurrency policy = %q, want Forbid", cron.Spec.ConcurrencyPolicy)
+	}
+	pod := cron.Spec.JobTemplate.Spec.Template
+	if pod.Labels["app.kubernetes.io/name"] == labelsForRelay(relay)["app.kubernetes.io/name"] {
+		t.Errorf("backup pod labels %v would be selected by the relay Services", pod.Labels)
+	}
+	if len(pod.Spec.Volumes) != 1 || pod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName != "test-data" {
+		t.Errorf("backup volumes = %+v, want the test-data PVC", pod.Spec.Volumes)
+	}
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.PodAffinity == nil {
+		t.Error("expected backup pods to be scheduled next to the relay pod")
+	}
+
+	wantArgs := []string{
+		"--s3-bucket=acme-backups",
+		"--s3-prefix=default/test",
+		"--s3-endpoint=https://minio.example.com",
+	}
+	backup := pod.Spec.Containers[0]
+	if strings.Join(backup.Command, " ") != "cw relay backup --data-dir=/data" {
+		t.Errorf("backup command = %v", backup.Command)
+	}
+	if strings.Join(backup.Args, " ") != strings.Join(wantArgs, " ") {
+		t.Errorf("backup args = %v, want %v", backup.Args, wantArgs)
+	}
+	if len(backup.EnvFrom) != 1 || backup.EnvFrom[0].SecretRef.Name != "backup-creds" {
+		t.Errorf("backup envFrom = %+v, want secret backup-creds", backup.EnvFrom)
+	}
+
+	// The relay restores the newest backup into an empty volume on start.
+	deploy := &appsv1.Deployment{}
+	getObj(t, c, types.NamespacedName{Name: "test", Namespace: "default"}, deploy)
+	inits := deploy.Spec.Template.Spec.InitContainers
+	if len(inits) != 1 {
+		t.Fatalf("expected 1 init container, got %d", len(inits))
+	}
+	if strings.Join(inits[0].Command, " ") != "cw relay restore --data-dir=/data --if-missing" {
+		t.Errorf("restore command = %v", inits[0].Command)
+	}
+	if strings.Join(inits[0].Args, " ") != strings.Join(wantArgs, " ") {
+		t.Errorf("restore args = %v, want %v", inits[0].Args, wantArgs)
+	}
+
+	// Removing the backup spec removes the CronJob and the restore.
+	updated := &codewire.CodewireRelay{}
+	getObj(t, c, types.NamespacedName{Name: "test", Namespace: "default"}, updated)
+	updated.Spec.Backup = nil
+	if err := c.Update(context.Background(), updated); err != nil {
+		t.Fatal(err)
+	}
+	doReconcile(t, r, "test", "default")
+
+	err := c.Get(context.Background(), types.NamespacedName{Name: "test-backup", Namespace: "default"}, &batchv1.CronJob{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected backup CronJob to be deleted, got err=%v", err)
+	}
+	getObj(t, c, types.NamespacedName{Name: "test", Namespace: "default"}, deploy)
+	if len(deploy.Spec.Template.Spec.InitContainers) != 0 {
+		t.Errorf("expected no init containers, got %d", len(deploy.Spec.Template.Spec.InitContainers))
+	}
+}
+
+func TestReconcile_RelayStats(t *testing.T) {
+	relay := newRelay("test", "default")
+	r, c := setup(t, relay)
+	doReconcile(t, r, "test", "default")
+
+	updated := &codewire.CodewireRelay{}
+	getObj(t, c, types.NamespacedName{Name: "test", Namespace: "default"}, updated)
+	if updated.Status.RegisteredNodes != 5 || updated.Status.ConnectedNodes != 3 || updated.Status.ActiveTunnels != 2 {
+		t.Errorf("status counts = %d registered, %d connected, %d tunnels; want 5, 3, 2",
+			updated.Status.RegisteredNodes, updated.Status.ConnectedNodes, updated.Status.ActiveTunnels)
+	}
+}
+
+func TestReconcile_Monitoring(t *testing.T) {
+	relay := newRelay("test", "default")
+	relay.Spec.Monitoring = &codewire.MonitoringSpec{
+		Enabled:  true,
+		Interval: "30s",
+		Labels:   map[string]string{"release": "prometheus"},
+	}
+	r, c := setup(t, relay)
+	doReconcile(t, r, "test", "default")
+
+	key := types.NamespacedName{Name: "test", Namespace: "default"}
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	getObj(t, c, key, sm)
+
+	if sm.GetLabels()["release"] != "prometheus" || sm.GetLabels()["app.kubernetes.io/instance"] != "test" {
+		t.Errorf("ServiceMonitor labels = %v", sm.GetLabels())
+	}
+	selector, _, _ := unstructured.NestedStringMap(sm.Object, "spec", "selector", "matchLabels")
+	if selector["app.kubernetes.io/instance"] != "test" || selector["release"] != "" {
+		t.Errorf("ServiceMonitor selector = %v, want the relay's labels", selector)
+	}
+	endpoints, _, _ := unstructured.NestedSlice(sm.Object, "spec", "endpoints")
+	if len(endpoints) != 1 {
+		t.Fatalf("expected 1 endpoint, got %d", len(endpoints))
+	}
+	ep := endpoints[0].(map[string]interface{})
+	if ep["port"] != "http" || ep["path"] != "/metrics" || ep["interval"] != "30s" {
+		t.Errorf("ServiceMonitor endpoint = %v", ep)
+	}
+
+	// Switching to a PodMonitor replaces the ServiceMonitor.
+	updated := &codewire.CodewireRelay{}
+	getObj(t, c, key, updated)
+	updated.Spec.Monitoring.Kind = "PodMonitor"
+	if err := c.Update(context.Background(), updated); err != nil {
+		t.Fatal(err)
+	}
+	doReconcile(t, r, "test", "default")
+
+	pm := &unstructured.Unstructured{}
+	pm.SetGroupVersionKind(podMonitorGVK)
+	getObj(t, c, key, pm)
+	if eps, _, _ := unstructured.NestedSlice(pm.Object, "spec", "podMetricsEndpoints"); len(eps) != 1 {
+		t.Errorf("PodMonitor endpoints = %v", eps)
+	}
+	if err := c.Get(context.Background(), key, sm); !apierrors.IsNotFound(err) {
+		t.Errorf("expected ServiceMonitor to be deleted, got err=%v", err)
+	}
+
+	// Disabling monitoring removes the monitor.
+	getObj(t, c, key, updated)
+	updated.Spec.Monitoring.Enabled = false
+	if err := c.Update(context.Background(), updated); err != nil {
+		t.Fatal(err)
+	}
+	doReconcile(t, r, "test", "default")
+	if err := c.Get(context.Background(), key, pm); !apierrors.IsNotFound(err) {
+		t.Errorf("expected PodMonitor to be deleted, got err=%v", err)
+	}
+}
+
 func TestReconcile_CredentialInjection(t *testing.T) {
 	relay := newRelay("test", "default")
 	relay.Spec.AuthToken = "test-token-123"
@@ -0,0 +1,233 @@
+// Package codewire controls codewire nodes from Go programs, as the cw CLI
+// does: launching and listing sessions, sending them input, reading their
+// output, following events and using the node's KV store.
+//
+// A Client reaches the node the way cw does, through the local node's Unix
+// socket, a server from servers.toml, a relay or a direct WebSocket URL:
+//
+//	c, err := codewire.New(codewire.Options{Server: "gpu-box"})
+//	if err != nil {
+//		return err
+//	}
+//	s, err := c.Launch(ctx, []string{"make", "test"}, codewire.LaunchOptions{Tags: []string{"ci"}})
+//	if err != nil {
+//		return err
+//	}
+//	for u, err := range c.Watch(ctx, s.ID, codewire.WatchOptions{}) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Print(u.Output)
+//	}
+//
+// Every call takes a context; cancelling it closes the call's connection,
+// which also ends server-side watches and subscriptions.
+package codewire
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Options configures a Client.
+type Options struct {
+	// DataDir is the cw data directory, with the local node's socket and
+	// the config.toml and servers.toml the client reads (default:
+	// $CODEWIRE_DIR, else ~/.codewire).
+	DataDir string
+	// Server is a server name from servers.toml, a relay, WebSocket or
+	// ssh:// URL, or "local". Empty uses client.server from config.toml,
+	// else the local node.
+	Server string
+	// Token overrides the token saved for Server.
+	Token string
+	// Retry retries requests that fail to reach the node.
+	Retry Retry
+}
+
+// Retry makes a Client retry requests that fail to reach the node, such as
+// while it restarts, with exponential backoff. Requests the node answers
+// with an error are not retried, and neither are requests that change
+// something, like Launch, once they have been sent. Watch and Subscribe
+// streams that lose the connection are reopened where they left off.
+type Retry struct {
+	// Attempts is how many times a request is tried in all; 0 or 1 means
+	// once.
+	Attempts int
+	// Backoff is the wait before the first retry, doubled after each
+	// (default 200ms), up to MaxBackoff (default 5s).
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Error is a request the node refused, such as one for an unknown session.
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Client sends requests to one node. It is safe for concurrent use; each
+// call uses its own connection.
+type Client struct {
+	target *client.Target
+	retry  Retry
+}
+
+// New returns a Client for the node opts describe.
+func New(opts Options) (*Client, error) {
+	dataDir := opts.DataDir
+	if dataDir == "" {
+		dataDir = os.Getenv("CODEWIRE_DIR")
+	}
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("finding the data directory: %w", err)
+		}
+		dataDir = filepath.Join(home, ".codewire")
+	}
+	target, err := client.ResolveTarget(dataDir, opts.Server, opts.Token)
+	if err != nil {
+		return nil, err
+	}
+	retry := opts.Retry
+	if retry.Backoff <= 0 {
+		retry.Backoff = 200 * time.Millisecond
+	}
+	if retry.MaxBackoff <= 0 {
+		retry.MaxBackoff = 5 * time.Second
+	}
+	return &Client{target: target, retry: retry}, nil
+}
+
+// conn is one request's connection, closed when its context is done.
+type conn struct {
+	reader connection.FrameReader
+	writer connection.FrameWriter
+}
+
+func (c *conn) Close() {
+	c.reader.Close()
+	c.writer.Close()
+}
+
+// open connects to the node and sends req.
+func (c *Client) open(ctx context.Context, req *protocol.Request) (*conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	reader, writer, err := c.target.Connect(ctx)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, errUnreachable{err}
+	}
+	cn := &conn{reader: reader, writer: writer}
+	if err := writer.SendRequest(req); err != nil {
+		cn.Close()
+		return nil, errUnreachable{fmt.Errorf("sending request: %w", err)}
+	}
+	return cn, nil
+}
+
+// response reads the next control frame from the node. An Error response
+// is returned as *Error.
+func (cn *conn) response() (*protocol.Response, error) {
+	for {
+		frame, err := cn.reader.ReadFrame()
+		if err != nil {
+			return nil, fmt.Errorf("reading response: %w", err)
+		}
+		if frame == nil {
+			return nil, errClosed
+		}
+		if frame.Type != protocol.FrameControl {
+			continue
+		}
+		var resp protocol.Response
+		if err := json.Unmarshal(frame.Payload, &resp); err != nil {
+			return nil, fmt.Errorf("parsing response: %w", err)
+		}
+		if resp.Type == "Error" {
+			return nil, &Error{Message: resp.Message}
+		}
+		return &resp, nil
+	}
+}
+
+// errClosed is a connection the node closed before answering.
+var errClosed = errors.New("connection closed before response")
+
+// errUnreachable is a request that never reached the node.
+type errUnreachable struct{ err error }
+
+func (e errUnreachable) Error() string { return e.err.Error() }
+func (e errUnreachable) Unwrap() error { return e.err }
+
+// do sends req and returns the node's answer of type want, retrying as
+// c.retry allows. Idempotent requests are also retried when the connection
+// fails before the answer.
+func (c *Client) do(ctx context.Context, req *protocol.Request, want string, idempotent bool) (*protocol.Response, error) {
+	var resp *protocol.Response
+	err := c.withRetry(ctx, func() error {
+		cn, err := c.open(ctx, req)
+		if err != nil {
+			return err
+		}
+		defer cn.Close()
+		resp, err = cn.response()
+		if err != nil && idempotent && !errors.As(err, new(*Error)) && ctx.Err() == nil {
+			return errUnreachable{err}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Type != want {
+		return nil, fmt.Errorf("unexpected response: %s", resp.Type)
+	}
+	return resp, nil
+}
+
+// withRetry calls f until it succeeds, fails in a way not worth retrying,
+// or runs out of attempts.
+func (c *Client) withRetry(ctx context.Context, f func() error) error {
+	backoff := c.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		var unreachable errUnreachable
+		if err == nil || !errors.As(err, &unreachable) || attempt >= c.retry.Attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, c.retry.MaxBackoff)
+	}
+}
+
+// stream opens a connection for a streaming request, retrying as c.retry
+// allows until the node accepts it.
+func (c *Client) stream(ctx context.Context, req *protocol.Request) (*conn, error) {
+	var cn *conn
+	err := c.withRetry(ctx, func() error {
+		var err error
+		cn, err = c.open(ctx, req)
+		return err
+	})
+	return cn, err
+}
@@ -0,0 +1,165 @@
+package codewire
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// fakeNode serves the local node's socket in a data directory, answering
+// each connection's request with serve.
+func fakeNode(t *testing.T, serve func(req protocol.Request, w connection.FrameWriter)) *Client {
+	t.Helper()
+	dir := t.TempDir()
+	ln, err := net.Listen("unix", filepath.Join(dir, "codewire.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				f, err := connection.NewUnixReader(conn).ReadFrame()
+				if err != nil || f == nil {
+					return
+				}
+				var req protocol.Request
+				if json.Unmarshal(f.Payload, &req) == nil {
+					serve(req, connection.NewUnixWriter(conn))
+				}
+			}()
+		}
+	}()
+	c, err := New(Options{DataDir: dir, Server: "local", Retry: Retry{Attempts: 3, Backoff: time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRequests(t *testing.T) {
+	var attempts atomic.Int32
+	c := fakeNode(t, func(req protocol.Request, w connection.FrameWriter) {
+		switch req.Type {
+		case "ListSessions":
+			// The first attempt fails before the answer.
+			if attempts.Add(1) == 1 {
+				return
+			}
+			_ = w.SendResponse(&protocol.Response{Type: "SessionList", Sessions: &[]protocol.SessionInfo{{ID: 1, Name: "build"}}})
+		case "Launch":
+			_ = w.SendResponse(&protocol.Response{Type: "Error", Message: "session limit reached"})
+		}
+	})
+	ctx := context.Background()
+
+	sessions, err := c.List(ctx)
+	if err != nil || len(sessions) != 1 || sessions[0].Name != "build" {
+		t.Fatalf("List = %v, %v", sessions, err)
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("List took %d attempts, want 2", n)
+	}
+
+	var nodeErr *Error
+	if _, err := c.Launch(ctx, []string{"true"}, LaunchOptions{NoQueue: true}); !errors.As(err, &nodeErr) || nodeErr.Message != "session limit reached" {
+		t.Errorf("Launch error = %v, want the node's", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	c := fakeNode(t, func(req protocol.Request, w connection.FrameWriter) {
+		id := uint64(7)
+		_ = w.SendResponse(&protocol.Response{Type: "SubscribeAck", SubscriptionID: &id})
+		for seq := uint64(1); ; seq++ {
+			sid := uint32(seq)
+			err := w.SendResponse(&protocol.Response{
+				Type:      "Event",
+				SessionID: &sid,
+				Event:     &protocol.SessionEvent{Timestamp: "2026-01-02T03:04:05Z", EventType: "session.status", Data: json.RawMessage(`{}`), Seq: seq},
+			})
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	var got []Event
+	for e, err := range c.Subscribe(context.Background(), SubscribeOptions{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got = append(got, e); len(got) == 3 {
+			break
+		}
+	}
+	if got[2].SessionID != 3 || got[2].Type != "session.status" || got[2].Time.Year() != 2026 {
+		t.Errorf("third event = %+v", got[2])
+	}
+
+	// A cancelled context ends the stream with its error.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, err := range c.Subscribe(ctx, SubscribeOptions{}) {
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("error after cancel = %v", err)
+			}
+			break
+		}
+		cancel()
+	}
+}
+
+func TestSubscribeResume(t *testing.T) {
+	var fromSeqs []uint64
+	var mu sync.Mutex
+	c := fakeNode(t, func(req protocol.Request, w connection.FrameWriter) {
+		from := uint64(1)
+		if req.FromSeq != nil {
+			from = *req.FromSeq
+		}
+		mu.Lock()
+		fromSeqs = append(fromSeqs, from)
+		mu.Unlock()
+		// Each connection drops after two events.
+		for seq := from; seq < from+2; seq++ {
+			sid := uint32(1)
+			_ = w.SendResponse(&protocol.Response{
+				Type:      "Event",
+				SessionID: &sid,
+				Event:     &protocol.SessionEvent{EventType: "session.status", Seq: seq},
+			})
+		}
+	})
+
+	var seqs []uint64
+	for e, err := range c.Subscribe(context.Background(), SubscribeOptions{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seqs = append(seqs, e.Seq); len(seqs) == 5 {
+			break
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(seqs, []uint64{1, 2, 3, 4, 5}) || !slices.Equal(fromSeqs, []uint64{1, 3, 5}) {
+		t.Errorf("got events %v over connections from %v", seqs, fromSeqs)
+	}
+}
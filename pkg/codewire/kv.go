@@ -0,0 +1,63 @@
+package codewire
+
+import (
+	"context"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// The KV methods use the node's KV store, shared by every node on a relay.
+// An empty namespace is "default".
+
+// KVPair is a KV entry.
+type KVPair struct {
+	Key       string
+	Value     []byte
+	ExpiresAt time.Time // zero if the key does not expire
+}
+
+// KVGet returns key's value, or nil if it is not set.
+func (c *Client) KVGet(ctx context.Context, namespace, key string) ([]byte, error) {
+	resp, err := c.do(ctx, &protocol.Request{Type: "KVGet", Namespace: namespace, Key: key}, "KVGetResult", true)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Value, nil
+}
+
+// KVSet sets key to value, expiring after ttl if it is positive.
+func (c *Client) KVSet(ctx context.Context, namespace, key string, value []byte, ttl time.Duration) error {
+	req := &protocol.Request{Type: "KVSet", Namespace: namespace, Key: key, Value: value}
+	if ttl > 0 {
+		req.TTL = ttl.String()
+	}
+	_, err := c.do(ctx, req, "KVSetOK", true)
+	return err
+}
+
+// KVDelete removes key.
+func (c *Client) KVDelete(ctx context.Context, namespace, key string) error {
+	_, err := c.do(ctx, &protocol.Request{Type: "KVDelete", Namespace: namespace, Key: key}, "KVDeleteOK", true)
+	return err
+}
+
+// KVList returns the entries whose keys start with prefix.
+func (c *Client) KVList(ctx context.Context, namespace, prefix string) ([]KVPair, error) {
+	resp, err := c.do(ctx, &protocol.Request{Type: "KVList", Namespace: namespace, Key: prefix}, "KVListResult", true)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Entries == nil {
+		return nil, nil
+	}
+	pairs := make([]KVPair, 0, len(*resp.Entries))
+	for _, e := range *resp.Entries {
+		p := KVPair{Key: e.Key, Value: e.Value}
+		if e.ExpiresAt != nil {
+			p.ExpiresAt = parseTime(*e.ExpiresAt)
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, nil
+}
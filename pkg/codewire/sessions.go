@@ -0,0 +1,126 @@
+package codewire
+
+import (
+	"context"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// Session describes a session, as cw list --json prints it.
+type Session = protocol.SessionInfo
+
+// LaunchOptions configures Launch. The zero value launches the command in
+// the node's working directory under a generated name.
+type LaunchOptions struct {
+	Name       string
+	WorkingDir string
+	Env        []string // KEY=VALUE overrides
+	Tags       []string
+	Labels     map[string]string
+	// Stdin is typed into the session once it starts.
+	Stdin []byte
+	// NoQueue fails the launch instead of queueing it when the node is at
+	// its concurrent session limit.
+	NoQueue bool
+}
+
+// Launched is a session Launch started.
+type Launched struct {
+	ID     uint32
+	Name   string
+	Status string // "running" or "queued"
+}
+
+// Launch starts command in a new session.
+func (c *Client) Launch(ctx context.Context, command []string, opts LaunchOptions) (*Launched, error) {
+	resp, err := c.do(ctx, &protocol.Request{
+		Type:       "Launch",
+		Command:    command,
+		WorkingDir: opts.WorkingDir,
+		Name:       opts.Name,
+		Env:        opts.Env,
+		Tags:       opts.Tags,
+		Labels:     opts.Labels,
+		StdinData:  opts.Stdin,
+		NoQueue:    opts.NoQueue,
+	}, "Launched", false)
+	if err != nil {
+		return nil, err
+	}
+	l := &Launched{Name: resp.Name, Status: resp.Status}
+	if resp.ID != nil {
+		l.ID = *resp.ID
+	}
+	return l, nil
+}
+
+// List returns the node's sessions.
+func (c *Client) List(ctx context.Context) ([]Session, error) {
+	resp, err := c.do(ctx, &protocol.Request{Type: "ListSessions"}, "SessionList", true)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Sessions == nil {
+		return nil, nil
+	}
+	return *resp.Sessions, nil
+}
+
+// Status returns session id, with the resource usage of a running local
+// session.
+func (c *Client) Status(ctx context.Context, id uint32) (*Session, error) {
+	resp, err := c.do(ctx, &protocol.Request{Type: "GetStatus", ID: &id}, "SessionStatus", true)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Info, nil
+}
+
+// Kill sends session id SIGTERM.
+func (c *Client) Kill(ctx context.Context, id uint32) error {
+	_, err := c.do(ctx, &protocol.Request{Type: "Kill", ID: &id}, "Killed", false)
+	return err
+}
+
+// SendInput types data into session id's terminal and returns how many
+// bytes were sent.
+func (c *Client) SendInput(ctx context.Context, id uint32, data []byte) (int, error) {
+	resp, err := c.do(ctx, &protocol.Request{Type: "SendInput", ID: &id, Data: data}, "InputSent", false)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Bytes == nil {
+		return 0, nil
+	}
+	return int(*resp.Bytes), nil
+}
+
+// LogsOptions configures Logs.
+type LogsOptions struct {
+	Tail int  // only the last Tail lines, if positive
+	Raw  bool // keep ANSI escape sequences
+}
+
+// Logs returns session id's output so far. Use Watch to follow it.
+func (c *Client) Logs(ctx context.Context, id uint32, opts LogsOptions) (string, error) {
+	follow := false
+	strip := !opts.Raw
+	req := &protocol.Request{Type: "Logs", ID: &id, Follow: &follow, StripANSI: &strip}
+	if opts.Tail > 0 {
+		tail := uint(opts.Tail)
+		req.Tail = &tail
+	}
+	resp, err := c.do(ctx, req, "LogData", true)
+	if err != nil {
+		return "", err
+	}
+	return resp.Data, nil
+}
+
+// parseTime parses an RFC 3339 timestamp from the node, or returns the zero
+// time.
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
@@ -0,0 +1,201 @@
+package codewire
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"iter"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// NoHistory starts with new output instead of the session's output so
+	// far; HistoryLines limits that to the last lines, if positive.
+	NoHistory    bool
+	HistoryLines int
+	// Since starts the history at output written at or after this time.
+	Since time.Time
+}
+
+// WatchUpdate is a piece of a watched session's output.
+type WatchUpdate struct {
+	Output string
+	// Time is when the output was written; zero for history sent in one
+	// piece.
+	Time time.Time
+	// Dropped counts output bytes lost before this update because the
+	// client fell too far behind.
+	Dropped uint64
+	// Status is the session's status, "running" until the final update.
+	Status string
+}
+
+// Watch follows session id's output until the session ends or ctx is
+// done. Stopping the iteration ends the watch on the node. With Retry set, a
+// watch that loses the connection resumes after the output received.
+func (c *Client) Watch(ctx context.Context, id uint32, opts WatchOptions) iter.Seq2[WatchUpdate, error] {
+	return func(yield func(WatchUpdate, error) bool) {
+		includeHistory := !opts.NoHistory
+		req := &protocol.Request{Type: "WatchSession", ID: &id, IncludeHistory: &includeHistory}
+		if opts.HistoryLines > 0 {
+			lines := uint(opts.HistoryLines)
+			req.HistoryLines = &lines
+		}
+		if !opts.Since.IsZero() {
+			req.Since = opts.Since.UTC().Format(time.RFC3339Nano)
+		}
+		cn, err := c.stream(ctx, req)
+		if err != nil {
+			yield(WatchUpdate{}, err)
+			return
+		}
+		defer func() { cn.Close() }()
+
+		var dropped uint64
+		for resumed := 0; ; {
+			resp, err := cn.response()
+			if c.lost(ctx, err) && resumed < c.retry.Attempts {
+				resumed++
+				// Resume after the output received, or from a node
+				// that reports no offsets, with new output.
+				if req.Offset == nil {
+					f := false
+					req.IncludeHistory = &f
+				}
+				cn.Close()
+				if cn, err = c.stream(ctx, req); err == nil {
+					continue
+				}
+			}
+			if err == errClosed {
+				return
+			}
+			if err != nil {
+				yield(WatchUpdate{}, err)
+				return
+			}
+			resumed = 0
+			switch resp.Type {
+			case "OutputDropped":
+				dropped += resp.Dropped
+			case "WatchUpdate":
+				u := WatchUpdate{Time: parseTime(resp.Timestamp), Dropped: dropped, Status: resp.Status}
+				if resp.Output != nil {
+					u.Output = *resp.Output
+				}
+				if resp.Offset != nil {
+					req.Offset = resp.Offset
+				}
+				dropped = 0
+				if !yield(u, nil) || (resp.Done != nil && *resp.Done) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// SubscribeOptions selects the events Subscribe delivers. The zero value
+// subscribes to every event of every session.
+type SubscribeOptions struct {
+	SessionID  *uint32
+	Tags       []string
+	Selector   string   // label selector, e.g. "team=a,env!=prod"
+	EventTypes []string // e.g. "session.status"
+	Filter     string   // filter expression, as for cw subscribe --filter
+	// Since and FromSeq first replay journaled events from that time or
+	// sequence number on.
+	Since   time.Time
+	FromSeq *uint64
+}
+
+// Event is a session event.
+type Event struct {
+	SessionID   uint32
+	SessionName string
+	Node        string
+	Type        string
+	Time        time.Time
+	Data        json.RawMessage
+	// Seq numbers the event in the node's journal, for
+	// SubscribeOptions.FromSeq.
+	Seq uint64
+}
+
+// Subscribe delivers session events until ctx is done. Stopping the
+// iteration unsubscribes. With Retry set, a subscription that loses the
+// connection resumes after the last event delivered, if the node keeps an
+// event journal.
+func (c *Client) Subscribe(ctx context.Context, opts SubscribeOptions) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		req := &protocol.Request{
+			Type:       "Subscribe",
+			ID:         opts.SessionID,
+			Tags:       opts.Tags,
+			Selector:   opts.Selector,
+			EventTypes: opts.EventTypes,
+			Filter:     opts.Filter,
+			FromSeq:    opts.FromSeq,
+		}
+		if !opts.Since.IsZero() {
+			req.Since = opts.Since.UTC().Format(time.RFC3339Nano)
+		}
+		cn, err := c.stream(ctx, req)
+		if err != nil {
+			yield(Event{}, err)
+			return
+		}
+		defer func() { cn.Close() }()
+
+		for resumed := 0; ; {
+			resp, err := cn.response()
+			if c.lost(ctx, err) && resumed < c.retry.Attempts {
+				resumed++
+				cn.Close()
+				if cn, err = c.stream(ctx, req); err == nil {
+					continue
+				}
+			}
+			if err == errClosed {
+				return
+			}
+			if err != nil {
+				yield(Event{}, err)
+				return
+			}
+			resumed = 0
+			if resp.Type != "Event" || resp.Event == nil {
+				continue
+			}
+			e := Event{
+				SessionName: resp.Name,
+				Node:        resp.Node,
+				Type:        resp.Event.EventType,
+				Time:        parseTime(resp.Event.Timestamp),
+				Data:        resp.Event.Data,
+				Seq:         resp.Event.Seq,
+			}
+			if resp.SessionID != nil {
+				e.SessionID = *resp.SessionID
+			}
+			if e.Seq > 0 {
+				// Resume after this event.
+				next := e.Seq + 1
+				req.FromSeq, req.Since = &next, ""
+			}
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
+
+// lost reports whether a stream's read failed because its connection was
+// lost, and c retries. Streams give up once as many reopened connections in
+// a row as c.retry.Attempts fail before a response.
+func (c *Client) lost(ctx context.Context, err error) bool {
+	return err != nil && c.retry.Attempts > 1 && ctx.Err() == nil && !errors.As(err, new(*Error))
+}
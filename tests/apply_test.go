@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// applyManifest writes manifest to dir/cohort.yaml and applies it.
+func applyManifest(t *testing.T, dir, manifest string, opts client.ApplyOptions) []client.ApplyAction {
+	t.Helper()
+	path := filepath.Join(dir, "cohort.yaml")
+	if err := os.WriteFile(path, []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := client.LoadManifest(path)
+	if err != nil {
+		t.Fatalf("LoadManifest: %v", err)
+	}
+	opts.JSON = true
+	out := captureStdout(t, func() error { return client.Apply(context.Background(), &client.Target{Local: dir}, m, opts) })
+	var actions []client.ApplyAction
+	if err := json.Unmarshal(out, &actions); err != nil {
+		t.Fatalf("parsing %s: %v", out, err)
+	}
+	return actions
+}
+
+func actionsByName(actions []client.ApplyAction) map[string]string {
+	byName := make(map[string]string)
+	for _, a := range actions {
+		byName[a.Name] = a.Action
+	}
+	return byName
+}
+
+func TestApply(t *testing.T) {
+	dir := tempDir(t, "apply")
+	sock := startTestNode(t, dir)
+
+	manifest := `
+sessions:
+  - name: alpha
+    command: [sleep, "30"]
+    tags: [cohort]
+  - name: beta
+    command: [sleep, "30"]
+`
+	actions := applyManifest(t, dir, manifest, client.ApplyOptions{DryRun: true})
+	if got := actionsByName(actions); got["alpha"] != "launch" || got["beta"] != "launch" {
+		t.Fatalf("dry run = %+v", actions)
+	}
+	resp := requestResponse(t, sock, &protocol.Request{Type: "ListSessions"})
+	if len(*resp.Sessions) != 0 {
+		t.Fatalf("dry run launched %d sessions", len(*resp.Sessions))
+	}
+
+	applyManifest(t, dir, manifest, client.ApplyOptions{})
+	resp = requestResponse(t, sock, &protocol.Request{Type: "ListSessions"})
+	sessions := *resp.Sessions
+	if len(sessions) != 2 || sessions[0].Name != "alpha" || sessions[0].WorkingDir != dir || sessions[0].Labels[client.ManifestLabel] != "cohort" {
+		t.Fatalf("sessions after apply = %+v", sessions)
+	}
+
+	// Applying again changes nothing; a changed tag is updated in place and
+	// an unlisted session is only killed with Prune.
+	if got := actionsByName(applyManifest(t, dir, manifest, client.ApplyOptions{})); got["alpha"] != "unchanged" || got["beta"] != "unchanged" {
+		t.Fatalf("second apply = %v", got)
+	}
+	manifest = `
+sessions:
+  - name: alpha
+    command: [sleep, "30"]
+    tags: [cohort, ci]
+`
+	if got := actionsByName(applyManifest(t, dir, manifest, client.ApplyOptions{})); got["alpha"] != "retag" || got["beta"] != "" {
+		t.Fatalf("apply without prune = %v", got)
+	}
+	if got := actionsByName(applyManifest(t, dir, manifest, client.ApplyOptions{Prune: true})); got["alpha"] != "unchanged" || got["beta"] != "kill" {
+		t.Fatalf("apply with prune = %v", got)
+	}
+
+	alpha, beta := sessions[0].ID, sessions[1].ID
+	waitExited(t, sock, beta, 5*time.Second)
+	resp = requestResponse(t, sock, &protocol.Request{Type: "GetStatus", ID: &alpha})
+	if resp.Info == nil || !slices.Equal(resp.Info.Tags, []string{"cohort", "ci"}) || resp.Info.Status != "running" {
+		t.Fatalf("alpha = %+v", resp.Info)
+	}
+}
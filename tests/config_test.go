@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/config"
+)
+
+// effective returns key's value and source from config.EffectiveSettings.
+func effective(t *testing.T, dir, key string) (string, string) {
+	t.Helper()
+	values, err := config.EffectiveSettings(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range values {
+		if v.Key == key {
+			return v.Value, v.Source
+		}
+	}
+	t.Fatalf("no setting %q", key)
+	return "", ""
+}
+
+func TestConfigSettings(t *testing.T) {
+	dir := tempDir(t, "config-settings")
+
+	if value, source := effective(t, dir, "client.detach_key"); value != "ctrl-b" || source != "default" {
+		t.Errorf("default detach key = %q from %s", value, source)
+	}
+	if err := config.SetSetting(dir, "client.tags", "team-a, nightly"); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.SetSetting(dir, "node.log_files", "5"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Client.Tags) != 2 || cfg.Client.Tags[1] != "nightly" || cfg.Node.LogFiles != 5 {
+		t.Errorf("config after set: tags %q, log_files %d", cfg.Client.Tags, cfg.Node.LogFiles)
+	}
+
+	// Invalid values are refused and leave config.toml alone.
+	for key, value := range map[string]string{
+		"client.color":       "sometimes",
+		"client.detach_key":  "alt-x",
+		"node.orphan_policy": "abandon",
+		"node.log_files":     "many",
+		"no.such.key":        "1",
+	} {
+		if err := config.SetSetting(dir, key, value); err == nil {
+			t.Errorf("setting %s to %q succeeded", key, value)
+		}
+	}
+	if value, source := effective(t, dir, "client.tags"); value != "team-a,nightly" || source != "config.toml" {
+		t.Errorf("client.tags = %q from %s", value, source)
+	}
+
+	// The environment overrides config.toml.
+	t.Setenv("CODEWIRE_TAGS", "from-env")
+	if value, source := effective(t, dir, "client.tags"); value != "from-env" || source != "env CODEWIRE_TAGS" {
+		t.Errorf("client.tags = %q from %s, want the environment", value, source)
+	}
+	if cfg, err := config.LoadConfig(dir); err != nil || len(cfg.Client.Tags) != 1 || cfg.Client.Tags[0] != "from-env" {
+		t.Errorf("LoadConfig tags = %v (%v), want the environment's", cfg.Client.Tags, err)
+	}
+
+	if err := config.UnsetSetting(dir, "node.log_files"); err != nil {
+		t.Fatal(err)
+	}
+	if value, source := effective(t, dir, "node.log_files"); value != "3" || source != "default" {
+		t.Errorf("node.log_files after unset = %q from %s", value, source)
+	}
+}
+
+func TestConfigDefaultServer(t *testing.T) {
+	dir := tempDir(t, "config-server")
+	if err := config.SetSetting(dir, "client.server", "ws://example.com:9100"); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := client.ResolveTarget(dir, "", "tok")
+	if err != nil || target.URL != "ws://example.com:9100" {
+		t.Fatalf("ResolveTarget without --server = %+v (%v), want client.server", target, err)
+	}
+	// --server local overrides client.server.
+	target, err = client.ResolveTarget(dir, "local", "")
+	if err != nil || !target.IsLocal() {
+		t.Fatalf("ResolveTarget(local) = %+v (%v), want the local node", target, err)
+	}
+	t.Setenv("CODEWIRE_SERVER", "local")
+	target, err = client.ResolveTarget(dir, "", "")
+	if err != nil || !target.IsLocal() {
+		t.Fatalf("ResolveTarget with CODEWIRE_SERVER=local = %+v (%v)", target, err)
+	}
+}
+
+func TestProjectConfig(t *testing.T) {
+	root := tempDir(t, "project-config")
+	sub := filepath.Join(root, "pkg", "web")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a .codewire.toml there are no project defaults.
+	project, err := config.FindProjectConfig(sub)
+	if err != nil || project.Dir != "" {
+		t.Fatalf("FindProjectConfig without a file = %+v (%v)", project, err)
+	}
+
+	err = os.WriteFile(filepath.Join(root, config.ProjectFile), []byte(`
+tags = ["mono"]
+name_prefix = "mono-"
+env = { GREETING = "hi", WHO = "project" }
+
+[gateway]
+exec = "./approve.sh"
+
+[templates.test]
+command = ["go", "test", "./..."]
+dir = "pkg"
+tags = ["ci"]
+env = { WHO = "template" }
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err = config.FindProjectConfig(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.Dir != root || project.NamePrefix != "mono-" || project.Gateway.Exec != "./approve.sh" {
+		t.Fatalf("FindProjectConfig from a subdirectory = %+v", project)
+	}
+
+	tmpl, err := project.Template("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.Dir != filepath.Join(root, "pkg") {
+		t.Errorf("template dir = %q, want it relative to the project", tmpl.Dir)
+	}
+	if env := project.Environ(tmpl); !reflect.DeepEqual(env, []string{"GREETING=hi", "WHO=template"}) {
+		t.Errorf("template environment = %q", env)
+	}
+	if env := project.Environ(nil); !reflect.DeepEqual(env, []string{"GREETING=hi", "WHO=project"}) {
+		t.Errorf("project environment = %q", env)
+	}
+	if _, err := project.Template("deploy"); err == nil {
+		t.Error("unknown template found")
+	}
+
+	err = os.WriteFile(filepath.Join(sub, config.ProjectFile), []byte("[templates.empty]\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.FindProjectConfig(sub); err == nil {
+		t.Error("template without a command accepted")
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	dir := tempDir(t, "config-layouts")
+
+	if out := captureStdout(t, func() error { return client.ListLayouts(dir) }); string(out) != "No saved layouts\n" {
+		t.Errorf("cw layout list with none saved = %q", out)
+	}
+
+	saved := &config.LayoutsConfig{Layouts: map[string]config.Layout{
+		"dev": {TmuxSession: "cw-dev", Windows: []config.LayoutWindow{
+			{Name: "main", Layout: "b25d,200x50,0,0", Sessions: []uint32{3, 1}},
+			{Name: "logs", Sessions: []uint32{7}},
+		}},
+		"ops": {TmuxSession: "cw-ops", Windows: []config.LayoutWindow{{Name: "w", Sessions: []uint32{2}}}},
+	}}
+	if err := saved.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := config.LoadLayoutsConfig(dir)
+	if err != nil || !reflect.DeepEqual(loaded, saved) {
+		t.Fatalf("LoadLayoutsConfig = %+v (%v), want %+v", loaded, err, saved)
+	}
+
+	out := string(captureStdout(t, func() error { return client.ListLayouts(dir) }))
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || strings.Join(strings.Fields(lines[1]), " ") != "dev cw-dev 3,1,7" || strings.Join(strings.Fields(lines[2]), " ") != "ops cw-ops 2" {
+		t.Errorf("cw layout list = %q", out)
+	}
+
+	if err := client.DeleteLayout(dir, "nope"); err == nil {
+		t.Error("deleted a layout that does not exist")
+	}
+	captureStdout(t, func() error { return client.DeleteLayout(dir, "dev") })
+	if loaded, err := config.LoadLayoutsConfig(dir); err != nil || len(loaded.Layouts) != 1 || loaded.Layouts["ops"].TmuxSession != "cw-ops" {
+		t.Errorf("layouts after deleting dev = %+v (%v)", loaded, err)
+	}
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/auth"
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// TestCopyFiles uploads a file over the Unix socket and downloads it again
+// over the WebSocket listener, where file chunks share binary messages with
+// data frames.
+func TestCopyFiles(t *testing.T) {
+	dir := tempDir(t, "cp")
+	workDir := filepath.Join(dir, "work")
+	localDir := filepath.Join(dir, "local")
+	for _, d := range []string{filepath.Join(workDir, "out"), localDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	if err := config.UpdateConfig(dir, func(cfg *config.Config) error {
+		cfg.Node.Listen = &addr
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	sock := startTestNode(t, dir)
+
+	resp := requestResponse(t, sock, &protocol.Request{Type: "Launch", Command: []string{"sleep", "30"}, WorkingDir: workDir})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	id := *resp.ID
+
+	// Several chunks' worth, with a partial last chunk.
+	content := make([]byte, 200<<10+123)
+	rand.Read(content)
+	src := filepath.Join(localDir, "artifact.bin")
+	if err := os.WriteFile(src, content, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	local := &client.Target{Local: dir}
+	if err := client.CopyToSession(context.Background(), local, id, src, "out", false); err != nil {
+		t.Fatalf("CopyToSession: %v", err)
+	}
+	uploaded := filepath.Join(workDir, "out", "artifact.bin")
+	if got, err := os.ReadFile(uploaded); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("uploaded file differs (err %v)", err)
+	}
+	if fi, _ := os.Stat(uploaded); fi.Mode().Perm() != 0o640 {
+		t.Fatalf("uploaded mode = %v, want 0640", fi.Mode().Perm())
+	}
+
+	admin, err := auth.LoadOrGenerateToken(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := &client.Target{URL: "ws://" + addr, Token: admin}
+	for i := 0; ; i++ {
+		if _, err := client.ResolveSessionArg(context.Background(), remote, "1"); err == nil {
+			break
+		}
+		if i == 50 {
+			t.Fatal("websocket listener not available")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	dst := filepath.Join(localDir, "copy") + string(filepath.Separator)
+	if err := os.Mkdir(dst, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CopyFromSession(context.Background(), remote, id, "out/artifact.bin", dst, false); err != nil {
+		t.Fatalf("CopyFromSession: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, "artifact.bin")); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("downloaded file differs (err %v)", err)
+	}
+
+	// Paths stay inside the working directory.
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret"), filepath.Join(workDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"../secret", "link", filepath.Join(dir, "secret")} {
+		err := client.CopyFromSession(context.Background(), local, id, p, filepath.Join(localDir, "leak"), false)
+		if err == nil {
+			t.Fatalf("expected %q to be refused", p)
+		}
+		if _, statErr := os.Stat(filepath.Join(localDir, "leak")); statErr == nil {
+			t.Fatalf("%q was copied despite error %v", p, err)
+		}
+	}
+
+	// A read-only token cannot copy files.
+	reader, err := auth.CreateToken(dir, "reader", auth.ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnly := &client.Target{URL: "ws://" + addr, Token: reader}
+	err = client.CopyFromSession(context.Background(), readOnly, id, "out/artifact.bin", filepath.Join(localDir, "ro"), false)
+	if err == nil || !strings.Contains(err.Error(), "launch scope") {
+		t.Fatalf("expected read token to be refused, got %v", err)
+	}
+}
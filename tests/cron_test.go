@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+// waitSessionNamed polls until a session with name exists.
+func waitSessionNamed(t *testing.T, sock, name string, timeout time.Duration) protocol.SessionInfo {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		resp := requestResponse(t, sock, &protocol.Request{Type: "ListSessions"})
+		if resp.Sessions != nil {
+			for _, s := range *resp.Sessions {
+				if s.Name == name {
+					return s
+				}
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for session %q", name)
+	return protocol.SessionInfo{}
+}
+
+// scheduledRun waits for the session.scheduled_run event recorded for id.
+func scheduledRun(t *testing.T, dir string, id uint32) session.ScheduledRunData {
+	t.Helper()
+	path := filepath.Join(dir, "sessions", fmt.Sprintf("%d", id), "events.jsonl")
+	for i := 0; i < 20; i++ {
+		events, _ := session.ReadEventLog(path)
+		for _, e := range events {
+			if e.Type == session.EventScheduledRun {
+				var d session.ScheduledRunData
+				if err := json.Unmarshal(e.Data, &d); err != nil {
+					t.Fatal(err)
+				}
+				return d
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("no scheduled_run event for session %d", id)
+	return session.ScheduledRunData{}
+}
+
+func TestCronScheduledRun(t *testing.T) {
+	dir := tempDir(t, "cron")
+	sock := startTestNode(t, dir)
+
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "CronAdd",
+		Name:       "tick",
+		Schedule:   "@every 1s",
+		Command:    []string{"sh", "-c", "echo tick; sleep 5"},
+		WorkingDir: "/tmp",
+		Tags:       []string{"cron"},
+	})
+	if resp.Type != "CronAdded" {
+		t.Fatalf("expected CronAdded, got %s: %s", resp.Type, resp.Message)
+	}
+
+	resp = requestResponse(t, sock, &protocol.Request{
+		Type:     "CronAdd",
+		Name:     "tick",
+		Schedule: "@hourly",
+		Command:  []string{"true"},
+	})
+	if resp.Type != "Error" {
+		t.Fatalf("expected Error for duplicate job, got %s", resp.Type)
+	}
+
+	s := waitSessionNamed(t, sock, "tick", 5*time.Second)
+	if len(s.Tags) != 1 || s.Tags[0] != "cron" {
+		t.Fatalf("expected tags [cron], got %v", s.Tags)
+	}
+	run := scheduledRun(t, dir, s.ID)
+	if run.Job != "tick" || run.Schedule != "@every 1s" || run.Missed {
+		t.Fatalf("unexpected scheduled_run data: %+v", run)
+	}
+
+	// The first run is still going, so the next one gets a suffixed name.
+	waitSessionNamed(t, sock, "tick-2", 5*time.Second)
+
+	resp = requestResponse(t, sock, &protocol.Request{Type: "CronList"})
+	if resp.CronJobs == nil || len(*resp.CronJobs) != 1 {
+		t.Fatalf("expected 1 cron job, got %+v", resp.CronJobs)
+	}
+	job := (*resp.CronJobs)[0]
+	if job.LastSessionID == nil || job.LastRunAt == nil || job.NextRunAt == "" || job.MissedRun != "skip" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	resp = requestResponse(t, sock, &protocol.Request{Type: "CronRemove", Name: "tick"})
+	if resp.Type != "CronRemoved" {
+		t.Fatalf("expected CronRemoved, got %s: %s", resp.Type, resp.Message)
+	}
+	resp = requestResponse(t, sock, &protocol.Request{Type: "CronList"})
+	if resp.CronJobs == nil || len(*resp.CronJobs) != 0 {
+		t.Fatalf("expected no cron jobs, got %+v", resp.CronJobs)
+	}
+}
+
+func TestCronMissedRunPolicy(t *testing.T) {
+	dir := tempDir(t, "cron-missed")
+
+	// Jobs persisted by an earlier node that went down two hours ago.
+	checked := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	jobs := fmt.Sprintf(`[
+  {"name": "catchup", "schedule": "@every 1h", "command": ["true"], "working_dir": "/tmp",
+   "missed_run": "run-once", "created_at": %[1]q, "checked_at": %[1]q},
+  {"name": "skipper", "schedule": "@every 1h", "command": ["true"], "working_dir": "/tmp",
+   "missed_run": "skip", "created_at": %[1]q, "checked_at": %[1]q}
+]`, checked)
+	if err := os.WriteFile(filepath.Join(dir, "cron.json"), []byte(jobs), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sock := startTestNode(t, dir)
+
+	s := waitSessionNamed(t, sock, "catchup", 5*time.Second)
+	if run := scheduledRun(t, dir, s.ID); !run.Missed {
+		t.Fatalf("expected a missed catch-up run, got %+v", run)
+	}
+
+	resp := requestResponse(t, sock, &protocol.Request{Type: "ListSessions"})
+	if n := len(*resp.Sessions); n != 1 {
+		t.Fatalf("expected only the catch-up session, got %d sessions", n)
+	}
+
+	// Both jobs wait for their next schedule time, an hour from now.
+	resp = requestResponse(t, sock, &protocol.Request{Type: "CronList"})
+	for _, job := range *resp.CronJobs {
+		next, err := time.Parse(time.RFC3339, job.NextRunAt)
+		if err != nil || time.Until(next) < 50*time.Minute {
+			t.Fatalf("job %s: expected next run in about an hour, got %q", job.Name, job.NextRunAt)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/codewiresh/codewire/internal/client"
 	"github.com/codewiresh/codewire/internal/protocol"
 )
 
@@ -164,6 +165,93 @@ func TestWaitForCompletion(t *testing.T) {
 	}
 }
 
+func TestWaitConditions(t *testing.T) {
+	dir := tempDir(t, "wait-conditions")
+	sock := startTestNode(t, dir)
+
+	launch := func(tag, script string) uint32 {
+		resp := requestResponse(t, sock, &protocol.Request{
+			Type:       "Launch",
+			Command:    []string{"bash", "-c", script},
+			WorkingDir: "/tmp",
+			Tags:       []string{tag},
+		})
+		if resp.Type != "Launched" {
+			t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+		}
+		return *resp.ID
+	}
+	timeout := uint64(10)
+	wait := func(req protocol.Request) *protocol.Response {
+		req.Type = "Wait"
+		req.TimeoutSeconds = &timeout
+		resp := requestResponse(t, sock, &req)
+		if resp.Type != "WaitResult" {
+			t.Fatalf("expected WaitResult, got %s: %s", resp.Type, resp.Message)
+		}
+		return resp
+	}
+
+	// A failure ends a wait for success at once, unmet, and meets
+	// any-failure; the slow session is still running.
+	failed := launch("cond", "exit 3")
+	slow := launch("cond", "sleep 30")
+	start := time.Now()
+	resp := wait(protocol.Request{Tags: []string{"cond"}, Condition: "success"})
+	if resp.Met == nil || *resp.Met {
+		t.Fatalf("success met = %v, want false", resp.Met)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("wait for success did not end at the first failure")
+	}
+	resp = wait(protocol.Request{Tags: []string{"cond"}, Condition: "any-failure"})
+	if resp.Met == nil || !*resp.Met || len(*resp.Sessions) != 2 {
+		t.Fatalf("any-failure = %v over %d sessions, want met over both", resp.Met, len(*resp.Sessions))
+	}
+	if code := client.WaitExitCode(*resp.Sessions); code != 1 {
+		t.Fatalf("exit code of several sessions, one failed = %d, want 1", code)
+	}
+	resp = wait(protocol.Request{ID: uint32Ptr(failed)})
+	if code := client.WaitExitCode(*resp.Sessions); code != 3 {
+		t.Fatalf("exit code of a session exiting 3 = %d, want 3", code)
+	}
+	requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: uint32Ptr(slow)})
+
+	ok := launch("ok", "true")
+	resp = wait(protocol.Request{ID: uint32Ptr(ok), Condition: "success"})
+	if resp.Met == nil || !*resp.Met {
+		t.Fatalf("success of a clean exit met = %v, want true", resp.Met)
+	}
+	resp = wait(protocol.Request{ID: uint32Ptr(ok), Condition: "any-failure"})
+	if resp.Met == nil || *resp.Met {
+		t.Fatalf("any-failure of a clean exit met = %v, want false", resp.Met)
+	}
+	if code := client.WaitExitCode(*resp.Sessions); code != 0 {
+		t.Fatalf("exit code of a clean exit = %d, want 0", code)
+	}
+
+	// Output already written counts, as does output written while waiting.
+	server := launch("out", "echo booting; sleep 1; echo 'BUILD SUCCESSFUL in 1s'; sleep 30")
+	resp = wait(protocol.Request{ID: uint32Ptr(server), UntilOutput: "BUILD SUCCESS"})
+	if resp.Met == nil || !*resp.Met || resp.Output == nil || *resp.Output != "BUILD SUCCESSFUL in 1s" || *resp.SessionID != server {
+		t.Fatalf("until-output result = %+v", resp)
+	}
+	resp = wait(protocol.Request{ID: uint32Ptr(server), UntilOutput: "^booting$"})
+	if resp.Met == nil || !*resp.Met {
+		t.Fatal("until-output missed output written before the wait")
+	}
+	requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: uint32Ptr(server)})
+	resp = wait(protocol.Request{ID: uint32Ptr(failed), UntilOutput: "never"})
+	if resp.Met == nil || *resp.Met {
+		t.Fatalf("until-output of a finished session without a match met = %v, want false", resp.Met)
+	}
+
+	resp = requestResponse(t, sock, &protocol.Request{Type: "Wait", ID: uint32Ptr(ok), Condition: "most"})
+	if resp.Type != "Error" {
+		t.Fatalf("unknown condition: got %s, want Error", resp.Type)
+	}
+}
+
 func TestKillByTags(t *testing.T) {
 	dir := tempDir(t, "kill-tags")
 	sock := startTestNode(t, dir)
@@ -220,11 +308,57 @@ func TestKillByTags(t *testing.T) {
 	if resp.Info.Status != "running" {
 		t.Fatalf("keeper should still be running, got %q", resp.Info.Status)
 	}
+	if r := resp.Info.Resources; r == nil || len(r.Processes) == 0 || r.Processes[0].PID != *resp.Info.PID {
+		t.Fatalf("running session should report its processes, got %+v", r)
+	}
 
 	// Clean up.
 	requestResponse(t, sock, &protocol.Request{Type: "KillAll"})
 }
 
+func TestKillBySelector(t *testing.T) {
+	dir := tempDir(t, "kill-selector")
+	sock := startTestNode(t, dir)
+
+	launch := func(labels map[string]string) uint32 {
+		resp := requestResponse(t, sock, &protocol.Request{
+			Type:       "Launch",
+			Command:    []string{"bash", "-c", "sleep 60"},
+			WorkingDir: "/tmp",
+			Labels:     labels,
+		})
+		if resp.Type != "Launched" {
+			t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+		}
+		return *resp.ID
+	}
+	launch(map[string]string{"repo": "webapp", "ticket": "JIRA-1"})
+	keeper := launch(map[string]string{"repo": "webapp", "ticket": "JIRA-2"})
+	other := launch(map[string]string{"repo": "api"})
+
+	resp := requestResponse(t, sock, &protocol.Request{Type: "KillByTags", Selector: "repo=webapp,ticket!=JIRA-2"})
+	if resp.Type != "KilledAll" || resp.Count == nil || *resp.Count != 1 {
+		t.Fatalf("expected 1 killed, got %s %v: %s", resp.Type, resp.Count, resp.Message)
+	}
+	resp = requestResponse(t, sock, &protocol.Request{Type: "KillByTags", Selector: "repo=a b"})
+	if resp.Type != "Error" {
+		t.Fatalf("invalid selector accepted: %s", resp.Type)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	for _, id := range []uint32{keeper, other} {
+		resp = requestResponse(t, sock, &protocol.Request{Type: "GetStatus", ID: uint32Ptr(id)})
+		if resp.Info == nil || resp.Info.Status != "running" {
+			t.Fatalf("session %d should still be running: %+v", id, resp.Info)
+		}
+	}
+	if resp.Info.Labels["repo"] != "api" {
+		t.Errorf("status labels = %v", resp.Info.Labels)
+	}
+
+	requestResponse(t, sock, &protocol.Request{Type: "KillAll"})
+}
+
 func TestEventSubscription(t *testing.T) {
 	dir := tempDir(t, "subscribe")
 	sock := startTestNode(t, dir)
@@ -256,6 +390,7 @@ func TestEventSubscription(t *testing.T) {
 		Type:       "Launch",
 		Command:    []string{"bash", "-c", "echo hello && exit 0"},
 		WorkingDir: "/tmp",
+		Name:       "greeter",
 	})
 	if launchResp.Type != "Launched" {
 		t.Fatalf("expected Launched, got %s", launchResp.Type)
@@ -307,6 +442,82 @@ loop:
 	if events[0].Event.EventType != "session.status" {
 		t.Fatalf("expected session.status event, got %s", events[0].Event.EventType)
 	}
+	if events[0].Name != "greeter" || events[0].Node == "" {
+		t.Fatalf("event session name = %q, node = %q; want greeter and the node's name", events[0].Name, events[0].Node)
+	}
+}
+
+func TestEventReplay(t *testing.T) {
+	dir := tempDir(t, "subscribe-replay")
+	sock := startTestNode(t, dir)
+
+	// Events published before anyone subscribed.
+	id := launchShell(t, sock, "exit 0")
+	waitExited(t, sock, id, 5*time.Second)
+
+	conn, reader, writer := connectRaw(t, sock)
+	defer conn.Close()
+	from := uint64(1)
+	if err := writer.SendRequest(&protocol.Request{
+		Type:       "Subscribe",
+		EventTypes: []string{"session.status"},
+		FromSeq:    &from,
+	}); err != nil {
+		t.Fatalf("send subscribe: %v", err)
+	}
+
+	frameCh := make(chan frameResult, 64)
+	go func() {
+		for {
+			f, err := reader.ReadFrame()
+			frameCh <- frameResult{f, err}
+			if err != nil || f == nil {
+				return
+			}
+		}
+	}()
+	next := func() protocol.Response {
+		t.Helper()
+		for {
+			select {
+			case fr := <-frameCh:
+				if fr.err != nil || fr.frame == nil {
+					t.Fatalf("subscription ended: %v", fr.err)
+				}
+				var r protocol.Response
+				if json.Unmarshal(fr.frame.Payload, &r) == nil && r.Type == "Event" {
+					return r
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no event")
+			}
+		}
+	}
+
+	// The replay holds the first session's exit, then live events follow
+	// with higher sequence numbers.
+	var lastSeq uint64
+	for {
+		r := next()
+		if r.Event.Seq <= lastSeq {
+			t.Fatalf("event seq %d after %d", r.Event.Seq, lastSeq)
+		}
+		lastSeq = r.Event.Seq
+		if *r.SessionID == id && strings.Contains(string(r.Event.Data), "completed") {
+			break
+		}
+	}
+	live := launchShell(t, sock, "exit 0")
+	for {
+		r := next()
+		if r.Event.Seq <= lastSeq {
+			t.Fatalf("event seq %d after %d", r.Event.Seq, lastSeq)
+		}
+		lastSeq = r.Event.Seq
+		if *r.SessionID == live {
+			break
+		}
+	}
 }
 
 func TestTokenInHeader(t *testing.T) {
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestFork(t *testing.T) {
+	dir := tempDir(t, "fork")
+	sock := startTestNode(t, dir)
+
+	// Each run writes its env and first two input lines to a file of its
+	// own, named by CW_SESSION_ID.
+	script := `read a; read b; echo "$FOO $a $b" > ` + dir + `/out-$CW_SESSION_ID`
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"sh", "-c", script},
+		WorkingDir: dir,
+		Env:        []string{"FOO=bar"},
+		StdinData:  []byte("one\n"),
+		Tags:       []string{"retry"},
+		Labels:     map[string]string{"run": "1"},
+	})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	orig := *resp.ID
+	time.Sleep(500 * time.Millisecond)
+	if resp := requestResponse(t, sock, &protocol.Request{Type: "SendInput", ID: &orig, Data: []byte("two\n")}); resp.Type != "InputSent" {
+		t.Fatalf("expected InputSent, got %s: %s", resp.Type, resp.Message)
+	}
+	if got := waitFile(t, filepath.Join(dir, "out-1")); got != "bar one two" {
+		t.Fatalf("original wrote %q", got)
+	}
+
+	resp = requestResponse(t, sock, &protocol.Request{Type: "Fork", ID: &orig, Name: "replayed", ReplayInput: true})
+	if resp.Type != "Launched" || resp.Info == nil {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	if resp.Name != "replayed" || resp.Info.WorkingDir != dir || !slices.Equal(resp.Info.Tags, []string{"retry"}) || resp.Info.Labels["run"] != "1" {
+		t.Errorf("fork = %s %+v", resp.Name, *resp.Info)
+	}
+	if got := waitFile(t, filepath.Join(dir, "out-2")); got != "bar one two" {
+		t.Errorf("fork replaying input wrote %q", got)
+	}
+
+	// Without ReplayInput, only the stdin data the original was launched
+	// with is sent.
+	resp = requestResponse(t, sock, &protocol.Request{Type: "Fork", ID: &orig})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	fork := *resp.ID
+	if resp := requestResponse(t, sock, &protocol.Request{Type: "SendInput", ID: &fork, Data: []byte("three\n")}); resp.Type != "InputSent" {
+		t.Fatalf("expected InputSent, got %s: %s", resp.Type, resp.Message)
+	}
+	if got := waitFile(t, filepath.Join(dir, "out-3")); got != "bar one three" {
+		t.Errorf("fork wrote %q", got)
+	}
+
+	if resp := requestResponse(t, sock, &protocol.Request{Type: "Fork", ID: uint32Ptr(99)}); resp.Type != "Error" {
+		t.Errorf("forking a missing session: expected Error, got %s", resp.Type)
+	}
+}
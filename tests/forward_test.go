@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/auth"
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/config"
+)
+
+// freePort returns a TCP address on 127.0.0.1 that was free a moment ago.
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+// TestForward tunnels two concurrent connections to an echo server through
+// the node's WebSocket listener, and checks that failed dials and tokens
+// without admin scope are refused.
+func TestForward(t *testing.T) {
+	dir := tempDir(t, "forward")
+	addr := freePort(t)
+	if err := config.UpdateConfig(dir, func(cfg *config.Config) error {
+		cfg.Node.Listen = &addr
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	startTestNode(t, dir)
+
+	// Echo server, standing in for a server started by a session.
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	echoPort := echo.Addr().(*net.TCPAddr).Port
+
+	admin, err := auth.LoadOrGenerateToken(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &client.Target{URL: "ws://" + addr, Token: admin}
+	for i := 0; ; i++ {
+		if _, err := client.ResolveSessionArg(context.Background(), target, "1"); err == nil || !strings.Contains(err.Error(), "connecting") {
+			break
+		}
+		if i == 50 {
+			t.Fatal("websocket listener not available")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	local, refused := freePort(t), freePort(t)
+	_, refusedPort, _ := net.SplitHostPort(freePort(t))
+	port, _ := strconv.Atoi(refusedPort)
+	go client.Forward(context.Background(), target, []client.ForwardSpec{
+		{Listen: local, Host: "127.0.0.1", Port: echoPort},
+		{Listen: refused, Host: "127.0.0.1", Port: port},
+	})
+
+	var conn net.Conn
+	for i := 0; ; i++ {
+		if conn, err = net.Dial("tcp", local); err == nil {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("forwarded port not listening: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer conn.Close()
+
+	// Two streams at once, each larger than a frame, ending with a
+	// half-close that the echo server answers by closing.
+	results := make(chan error, 2)
+	for _, c := range []net.Conn{conn, mustDial(t, local)} {
+		go func() {
+			defer c.Close()
+			content := make([]byte, 100<<10)
+			rand.Read(content)
+			go func() {
+				c.Write(content)
+				c.(*net.TCPConn).CloseWrite()
+			}()
+			got, err := io.ReadAll(c)
+			if err == nil && !bytes.Equal(got, content) {
+				err = io.ErrShortBuffer
+			}
+			results <- err
+		}()
+	}
+	for range 2 {
+		select {
+		case err := <-results:
+			if err != nil {
+				t.Fatalf("echo through forward: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for echo")
+		}
+	}
+
+	// A target the node cannot reach closes the local connection.
+	bad := mustDial(t, refused)
+	defer bad.Close()
+	bad.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if n, err := bad.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Fatalf("read from refused forward = %d, %v; want EOF", n, err)
+	}
+
+	// Forwarding needs admin scope.
+	launcher, err := auth.CreateToken(dir, "launcher", auth.ScopeLaunch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Forward(context.Background(), &client.Target{URL: "ws://" + addr, Token: launcher}, []client.ForwardSpec{
+		{Listen: "127.0.0.1:0", Host: "127.0.0.1", Port: echoPort},
+	})
+	if err == nil || !strings.Contains(err.Error(), "admin scope") {
+		t.Fatalf("expected launch token to be refused, got %v", err)
+	}
+}
+
+func mustDial(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
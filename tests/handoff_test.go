@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/node"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// TestHandoffHelperNode is not a real test. TestHandoff runs it in a child
+// process so that the node handing off is a separate process, as in an
+// upgrade.
+func TestHandoffHelperNode(t *testing.T) {
+	dir := os.Getenv("CW_HANDOFF_HELPER_DIR")
+	if dir == "" {
+		t.Skip("helper process for TestHandoff")
+	}
+	n, err := node.NewNode(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = n.Run(context.Background())
+	n.Cleanup()
+}
+
+func TestHandoff(t *testing.T) {
+	dir := tempDir(t, "handoff")
+	sock := filepath.Join(dir, "codewire.sock")
+
+	old := exec.Command(os.Args[0], "-test.run=^TestHandoffHelperNode$")
+	old.Env = append(os.Environ(), "CW_HANDOFF_HELPER_DIR="+dir)
+	if err := old.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = old.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() { _ = old.Process.Kill() })
+
+	for i := 0; ; i++ {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			conn.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatal("helper node did not start")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Name:       "keeper",
+		Command:    []string{"sh", "-c", `while read l; do echo "got $l"; done`},
+		WorkingDir: "/tmp",
+	})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	id := *resp.ID
+
+	h, err := node.ReceiveHandoff(dir)
+	if err != nil {
+		t.Fatalf("ReceiveHandoff: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("old node did not exit")
+	}
+
+	n, err := node.NewNodeFromHandoff(dir, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		requestResponse(t, sock, &protocol.Request{Type: "KillAll"})
+		cancel()
+		n.Cleanup()
+	})
+	go func() { _ = n.Run(ctx) }()
+
+	resp = requestResponse(t, sock, &protocol.Request{Type: "GetStatus", ID: &id})
+	if resp.Info == nil || resp.Info.Status != "running" || resp.Info.Adopted || resp.Info.Name != "keeper" {
+		t.Fatalf("expected session taken over with its terminal, got %+v", resp.Info)
+	}
+
+	// The session's terminal still works.
+	resp = requestResponse(t, sock, &protocol.Request{Type: "SendInput", ID: &id, Data: []byte("after\n")})
+	if resp.Type != "InputSent" {
+		t.Fatalf("expected InputSent, got %s: %s", resp.Type, resp.Message)
+	}
+	for i := 0; ; i++ {
+		resp = requestResponse(t, sock, &protocol.Request{Type: "Logs", ID: &id})
+		if strings.Contains(resp.Data, "got after") {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("no output after handoff, log: %q", resp.Data)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// New sessions do not reuse the handed-over ID.
+	resp = requestResponse(t, sock, &protocol.Request{Type: "Launch", Command: []string{"true"}, WorkingDir: "/tmp"})
+	if resp.Type != "Launched" || *resp.ID <= id {
+		t.Fatalf("expected a new session ID, got %s %v: %s", resp.Type, resp.ID, resp.Message)
+	}
+
+	requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: &id})
+	if status := waitExited(t, sock, id, 5*time.Second); status != "killed" {
+		t.Fatalf("expected killed, got %q", status)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -998,6 +1000,43 @@ loop:
 	}
 }
 
+func TestWatchScreen(t *testing.T) {
+	dir := tempDir(t, "watch-render")
+	sock := startTestNode(t, dir)
+	target := &client.Target{Local: dir}
+
+	// A carriage return overwrites the line, then the screen is cleared.
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"bash", "-c", `printf 'hello\rJ'; sleep 0.6; printf '\033[2J\033[Hdone'; sleep 0.3`},
+		WorkingDir: "/tmp",
+	})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	id := *resp.ID
+	time.Sleep(300 * time.Millisecond)
+
+	var out strings.Builder
+	timeout := uint64(10)
+	if err := client.WatchScreen(context.Background(), target, id, &out, &timeout, client.RenderOptions{Interval: 100 * time.Millisecond}); err != nil {
+		t.Fatalf("WatchScreen: %v", err)
+	}
+
+	var screens []string
+	for _, block := range regexp.MustCompile(`(?m)^--- \d\d:\d\d:\d\d ---\n`).Split(out.String(), -1)[1:] {
+		screens = append(screens, strings.TrimSpace(block))
+	}
+	if len(screens) < 2 || screens[0] != "Jello" || screens[len(screens)-1] != "done" {
+		t.Fatalf("screens = %q, want the rendered screen before and after clearing", screens)
+	}
+	for i := 1; i < len(screens); i++ {
+		if screens[i] == screens[i-1] {
+			t.Errorf("screen %d repeats the previous one: %q", i, screens[i])
+		}
+	}
+}
+
 func TestLaunchWithEnv(t *testing.T) {
 	dir := tempDir(t, "launch-env")
 	sock := startTestNode(t, dir)
@@ -1074,7 +1113,7 @@ func TestMultiplexedWatch(t *testing.T) {
 	target := &client.Target{Local: dir}
 	var buf strings.Builder
 	timeout := uint64(5)
-	err := client.WatchMultiByTag(target, "mux-test", &buf, &timeout)
+	err := client.WatchMultiByTag(context.Background(), target, "mux-test", &buf, &timeout, client.WatchOptions{})
 	if err != nil {
 		t.Fatalf("WatchMultiByTag: %v", err)
 	}
@@ -1088,6 +1127,216 @@ func TestMultiplexedWatch(t *testing.T) {
 	}
 }
 
+func TestMultiplexedWatchFiltered(t *testing.T) {
+	dir := tempDir(t, "mux-filter")
+	sock := startTestNode(t, dir)
+
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"bash", "-c", "echo KEEP_1; echo DROP_1; echo KEEP_2; sleep 1"},
+		WorkingDir: "/tmp",
+		Tags:       []string{"mux-filter"},
+	})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	target := &client.Target{Local: dir}
+	var buf strings.Builder
+	timeout := uint64(5)
+	err := client.WatchMultiByTag(context.Background(), target, "mux-filter", &buf, &timeout, client.WatchOptions{
+		Timestamps: true,
+		Grep:       regexp.MustCompile(`^KEEP`),
+		Since:      time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("WatchMultiByTag: %v", err)
+	}
+
+	output := buf.String()
+	if strings.Contains(output, "DROP_1") {
+		t.Fatalf("grep should have dropped DROP_1: %q", output)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), output)
+	}
+	stamp := regexp.MustCompile(` \d{2}:\d{2}:\d{2}\.\d{3} KEEP_\d$`)
+	for _, line := range lines {
+		if !stamp.MatchString(line) {
+			t.Fatalf("expected timestamped line, got %q", line)
+		}
+	}
+}
+
+func TestGetRecording(t *testing.T) {
+	dir := tempDir(t, "recording")
+	sock := startTestNode(t, dir)
+
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"bash", "-c", "echo FIRST; sleep 0.5; echo SECOND"},
+		WorkingDir: "/tmp",
+	})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	id := *resp.ID
+
+	time.Sleep(1500 * time.Millisecond)
+
+	data, timing := getRecording(t, sock, id)
+	if len(timing) < 2 {
+		t.Fatalf("expected at least 2 timing entries, got %+v", timing)
+	}
+
+	var total int64
+	var first, second time.Time
+	for _, e := range timing {
+		at, err := time.Parse(time.RFC3339Nano, e.Time)
+		if err != nil {
+			t.Fatalf("bad timing time %q: %v", e.Time, err)
+		}
+		chunk := data[total : total+e.Length]
+		if strings.Contains(chunk, "FIRST") {
+			first = at
+		}
+		if strings.Contains(chunk, "SECOND") {
+			second = at
+		}
+		total += e.Length
+	}
+	if total != int64(len(data)) {
+		t.Fatalf("timing covers %d bytes, data has %d", total, len(data))
+	}
+	if gap := second.Sub(first); gap < 300*time.Millisecond {
+		t.Fatalf("expected ~500ms between chunks, got %v", gap)
+	}
+}
+
+// getRecording sends GetRecording for session id and collects the log from
+// its FileChunk frames and the timing from its RecordingTiming responses.
+func getRecording(t *testing.T, sock string, id uint32) (string, []protocol.TimingEntry) {
+	t.Helper()
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatalf("connect to %s: %v", sock, err)
+	}
+	defer conn.Close()
+	writer := connection.NewUnixWriter(conn)
+	reader := connection.NewUnixReader(conn)
+	if err := writer.SendRequest(&protocol.Request{Type: "GetRecording", ID: &id}); err != nil {
+		t.Fatalf("send request: %v", err)
+	}
+
+	var data strings.Builder
+	var timing []protocol.TimingEntry
+	var size int64
+	for {
+		f, err := reader.ReadFrame()
+		if err != nil || f == nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		if f.Type == protocol.FrameFileChunk {
+			data.WriteString(string(f.Payload))
+			continue
+		}
+		var resp protocol.Response
+		if err := json.Unmarshal(f.Payload, &resp); err != nil {
+			t.Fatalf("parse response JSON: %v", err)
+		}
+		switch resp.Type {
+		case "Recording":
+			size = resp.FileSize
+		case "RecordingTiming":
+			timing = append(timing, *resp.Timing...)
+		case "RecordingDone":
+			if resp.FileSize != size || int64(data.Len()) != size {
+				t.Fatalf("recording of %d bytes sent %d, done reports %d", size, data.Len(), resp.FileSize)
+			}
+			return data.String(), timing
+		default:
+			t.Fatalf("unexpected %s: %s", resp.Type, resp.Message)
+		}
+	}
+}
+
+func TestGetRecordingLarge(t *testing.T) {
+	dir := tempDir(t, "recording-large")
+	sock := startTestNode(t, dir)
+
+	// More output than fits in one frame.
+	n := int(protocol.MaxPayload) + 1<<20
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"sh", "-c", fmt.Sprintf("yes | head -c %d", n)},
+		WorkingDir: "/tmp",
+	})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	id := *resp.ID
+	waitExited(t, sock, id, 30*time.Second)
+
+	// The terminal turns each newline into CRLF.
+	data, timing := getRecording(t, sock, id)
+	if want := n / 2 * 3; len(data) != want || strings.Trim(data, "y\r\n") != "" {
+		t.Fatalf("recording has %d bytes, want %d", len(data), want)
+	}
+	var total int64
+	for _, e := range timing {
+		total += e.Length
+	}
+	if total != int64(len(data)) {
+		t.Fatalf("timing covers %d bytes, data has %d", total, len(data))
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := tempDir(t, "replay")
+	sock := startTestNode(t, dir)
+	target := &client.Target{Local: dir}
+
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"bash", "-c", "echo FIRST; sleep 1; echo SECOND"},
+		WorkingDir: "/tmp",
+	})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	id := *resp.ID
+	time.Sleep(1500 * time.Millisecond)
+
+	// At 4x the one-second pause plays in about a quarter second.
+	start := time.Now()
+	out := string(captureStdout(t, func() error {
+		return client.Replay(context.Background(), target, id, client.ReplayOptions{Speed: 4})
+	}))
+	elapsed := time.Since(start)
+	if i, j := strings.Index(out, "FIRST"), strings.Index(out, "SECOND"); i < 0 || j < i || !strings.Contains(out, "replay of session") {
+		t.Fatalf("replay output = %q", out)
+	}
+	if elapsed < 150*time.Millisecond || elapsed > 900*time.Millisecond {
+		t.Errorf("replay at 4x took %v, want about 250ms", elapsed)
+	}
+
+	// --max-idle caps every pause.
+	start = time.Now()
+	out = string(captureStdout(t, func() error {
+		return client.Replay(context.Background(), target, id, client.ReplayOptions{MaxIdle: 50 * time.Millisecond})
+	}))
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond || !strings.Contains(out, "FIRST") || !strings.Contains(out, "SECOND") {
+		t.Errorf("replay with --max-idle 50ms took %v, output %q", elapsed, out)
+	}
+
+	if err := client.Replay(context.Background(), target, id, client.ReplayOptions{From: time.Hour}); err == nil {
+		t.Error("replay from past the end of the recording succeeded")
+	}
+}
+
 func TestEventDrivenPersistence(t *testing.T) {
 	dir := tempDir(t, "evt-persist")
 	sock := startTestNode(t, dir)
@@ -1218,7 +1467,7 @@ func TestResolveSessionOrTag(t *testing.T) {
 	time.Sleep(200 * time.Millisecond)
 
 	// "batch-99" is not a session name — should resolve to tag
-	id, tags, err := client.ResolveSessionOrTag(target, "batch-99")
+	id, tags, err := client.ResolveSessionOrTag(context.Background(), target, "batch-99")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1230,7 +1479,7 @@ func TestResolveSessionOrTag(t *testing.T) {
 	}
 
 	// A numeric ID resolves as session
-	id2, tags2, err2 := client.ResolveSessionOrTag(target, fmt.Sprintf("%d", *r1.ID))
+	id2, tags2, err2 := client.ResolveSessionOrTag(context.Background(), target, fmt.Sprintf("%d", *r1.ID))
 	if err2 != nil {
 		t.Fatalf("unexpected error: %v", err2)
 	}
@@ -1242,6 +1491,62 @@ func TestResolveSessionOrTag(t *testing.T) {
 	}
 }
 
+func TestResolveSessionPrefix(t *testing.T) {
+	dir := tempDir(t, "resolve-prefix")
+	sock := startTestNode(t, dir)
+	target := &client.Target{Local: dir}
+
+	ids := map[string]uint32{}
+	for _, name := range []string{"planner", "plan-b", "reviewer"} {
+		r := requestResponse(t, sock, &protocol.Request{
+			Type: "Launch", Command: []string{"sleep", "5"}, WorkingDir: "/tmp",
+			Name: name, Tags: []string{"plan"},
+		})
+		if r.Type != "Launched" {
+			t.Fatalf("launch %s: %s", name, r.Message)
+		}
+		ids[name] = *r.ID
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// A unique prefix resolves to the session.
+	id, err := client.ResolveSessionArg(context.Background(), target, "rev")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != ids["reviewer"] {
+		t.Fatalf("expected reviewer (%d), got %d", ids["reviewer"], id)
+	}
+
+	// An ambiguous prefix lists the candidates.
+	_, err = client.ResolveSessionArg(context.Background(), target, "plan")
+	if err == nil || !strings.Contains(err.Error(), "ambiguous") ||
+		!strings.Contains(err.Error(), "planner") || !strings.Contains(err.Error(), "plan-b") {
+		t.Fatalf("expected ambiguity error listing candidates, got %v", err)
+	}
+
+	// An exact tag wins over a name prefix.
+	sid, tags, err := client.ResolveSessionOrTag(context.Background(), target, "plan")
+	if err != nil || sid != nil || len(tags) != 1 || tags[0] != "plan" {
+		t.Fatalf("expected tag plan, got id=%v tags=%v err=%v", sid, tags, err)
+	}
+
+	// %tag selects the tag explicitly; a longer prefix selects the session.
+	sid, tags, err = client.ResolveSessionOrTag(context.Background(), target, "%plan")
+	if err != nil || sid != nil || len(tags) != 1 || tags[0] != "plan" {
+		t.Fatalf("expected tag plan for %%plan, got id=%v tags=%v err=%v", sid, tags, err)
+	}
+	sid, _, err = client.ResolveSessionOrTag(context.Background(), target, "plann")
+	if err != nil || sid == nil || *sid != ids["planner"] {
+		t.Fatalf("expected planner for prefix plann, got id=%v err=%v", sid, err)
+	}
+
+	// Tags are rejected where a single session is required.
+	if _, err := client.ResolveSessionArg(context.Background(), target, "%plan"); err == nil {
+		t.Fatal("expected error resolving a tag argument as a single session")
+	}
+}
+
 func TestWaitByTagPositional(t *testing.T) {
 	dir := tempDir(t, "wait-tag-positional")
 	sock := startTestNode(t, dir)
@@ -1261,7 +1566,7 @@ func TestWaitByTagPositional(t *testing.T) {
 	// WaitForSession with tag "wt-42" should wait for both
 	done := make(chan error, 1)
 	go func() {
-		done <- client.WaitForSession(target, nil, []string{"wt-42"}, "all", nil)
+		done <- client.WaitForSession(context.Background(), target, nil, []string{"wt-42"}, client.WaitOptions{Condition: "all"})
 	}()
 
 	select {
@@ -1289,7 +1594,7 @@ func TestListStatusFilter(t *testing.T) {
 	time.Sleep(300 * time.Millisecond)
 
 	// Filter running — should see only running sessions
-	sessions, err := client.ListFiltered(target, "running")
+	sessions, err := client.ListFiltered(context.Background(), target, "running")
 	if err != nil {
 		t.Fatalf("ListFiltered: %v", err)
 	}
@@ -1303,6 +1608,53 @@ func TestListStatusFilter(t *testing.T) {
 	}
 }
 
+func TestListSortAndTags(t *testing.T) {
+	dir := tempDir(t, "list-sort")
+	sock := startTestNode(t, dir)
+	target := &client.Target{Local: dir}
+
+	for _, l := range []struct {
+		name string
+		tags []string
+	}{
+		{"charlie", []string{"web"}},
+		{"alpha", []string{"db"}},
+		{"bravo", []string{"web", "db"}},
+	} {
+		requestResponse(t, sock, &protocol.Request{
+			Type: "Launch", Command: []string{"sleep", "30"}, WorkingDir: "/tmp", Name: l.name, Tags: l.tags,
+		})
+	}
+
+	list := func(opts client.ListOptions) []string {
+		t.Helper()
+		opts.JSON = true
+		var sessions []protocol.SessionInfo
+		out := captureStdout(t, func() error { return client.List(context.Background(), target, opts) })
+		if err := json.Unmarshal(out, &sessions); err != nil {
+			t.Fatalf("cw list --json printed %q: %v", out, err)
+		}
+		var names []string
+		for _, s := range sessions {
+			names = append(names, s.Name)
+		}
+		return names
+	}
+
+	if got := list(client.ListOptions{Sort: "name"}); !slices.Equal(got, []string{"alpha", "bravo", "charlie"}) {
+		t.Errorf("--sort name = %q", got)
+	}
+	if got := list(client.ListOptions{}); !slices.Equal(got, []string{"charlie", "alpha", "bravo"}) {
+		t.Errorf("default order = %q, want launch order", got)
+	}
+	if got := list(client.ListOptions{Tags: []string{"web"}, Sort: "name"}); !slices.Equal(got, []string{"bravo", "charlie"}) {
+		t.Errorf("--tag web = %q", got)
+	}
+	if err := client.List(context.Background(), target, client.ListOptions{Sort: "size"}); err == nil {
+		t.Error("--sort size was accepted")
+	}
+}
+
 func TestCWSessionIDEnv(t *testing.T) {
 	dir := tempDir(t, "cw-session-id")
 	sock := startTestNode(t, dir)
@@ -1582,9 +1934,9 @@ func TestAnonymousSendRequest(t *testing.T) {
 	defer reqConn.Close()
 
 	if err := reqWriter.SendRequest(&protocol.Request{
-		Type:  "MsgRequest",
-		ToID:  uint32Ptr(targetID),
-		Body:  "approve?",
+		Type: "MsgRequest",
+		ToID: uint32Ptr(targetID),
+		Body: "approve?",
 	}); err != nil {
 		t.Fatalf("send MsgRequest: %v", err)
 	}
@@ -1642,7 +1994,7 @@ func TestHookNoGateway(t *testing.T) {
 	_ = sock // node is running but no gateway session
 
 	var out strings.Builder
-	blocked, err := client.Hook(target, strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"rm -rf /"}}`), &out)
+	blocked, err := client.Hook(context.Background(), target, strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"rm -rf /"}}`), &out)
 	if err != nil {
 		t.Fatalf("Hook() error: %v", err)
 	}
@@ -1668,7 +2020,7 @@ func TestHookReadOnlyBypass(t *testing.T) {
 			t.Parallel()
 			input := fmt.Sprintf(`{"tool_name":%q,"tool_input":{}}`, tool)
 			var out strings.Builder
-			blocked, err := client.Hook(target, strings.NewReader(input), &out)
+			blocked, err := client.Hook(context.Background(), target, strings.NewReader(input), &out)
 			if err != nil {
 				t.Fatalf("Hook() error: %v", err)
 			}
@@ -1718,10 +2070,16 @@ func TestHookDenied(t *testing.T) {
 	// Run Hook() in a goroutine — it will block waiting for the gateway reply.
 	target := &client.Target{Local: dir}
 	var out strings.Builder
-	hookDone := make(chan struct{ blocked bool; err error }, 1)
+	hookDone := make(chan struct {
+		blocked bool
+		err     error
+	}, 1)
 	go func() {
-		blocked, err := client.Hook(target, strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"rm -rf /"}}`), &out)
-		hookDone <- struct{ blocked bool; err error }{blocked, err}
+		blocked, err := client.Hook(context.Background(), target, strings.NewReader(`{"tool_name":"Bash","tool_input":{"command":"rm -rf /"}}`), &out)
+		hookDone <- struct {
+			blocked bool
+			err     error
+		}{blocked, err}
 	}()
 
 	// Simulate gateway receiving the request and replying DENIED.
@@ -1791,3 +2149,233 @@ func TestHookDenied(t *testing.T) {
 		t.Fatal("timeout waiting for Hook() to return")
 	}
 }
+
+// TestHookPostToolUseAndStop verifies that PostToolUse and Stop payloads are
+// recorded as session events on the agent's session.
+func TestHookPostToolUseAndStop(t *testing.T) {
+	t.Parallel()
+	dir := tempDir(t, "hook-post-tool-use")
+	sock := startTestNode(t, dir)
+
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"sleep", "30"},
+		WorkingDir: "/tmp",
+	})
+	if resp.Type != "Launched" || resp.ID == nil {
+		t.Fatalf("launch: unexpected response %q", resp.Type)
+	}
+	id := *resp.ID
+
+	subConn, subReader, subWriter := connectRaw(t, sock)
+	defer subConn.Close()
+	if err := subWriter.SendRequest(&protocol.Request{
+		Type:       "Subscribe",
+		ID:         &id,
+		EventTypes: []string{"session.tool_result", "session.agent_stopped"},
+	}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if f, err := subReader.ReadFrame(); err != nil || f == nil {
+		t.Fatalf("read SubscribeAck: %v", err)
+	}
+
+	target := &client.Target{Local: dir}
+	inputs := []string{
+		`{"hook_event_name":"PostToolUse","session_id":"abc","tool_name":"Bash","tool_input":{"command":"ls"},"tool_response":{"stdout":"file.txt"}}`,
+		`{"hook_event_name":"Stop","session_id":"abc","transcript_path":"/tmp/abc.jsonl","stop_hook_active":false}`,
+	}
+	for _, input := range inputs {
+		var out strings.Builder
+		blocked, err := client.HookForSession(context.Background(), target, &id, strings.NewReader(input), &out)
+		if err != nil {
+			t.Fatalf("HookForSession() error: %v", err)
+		}
+		if blocked || out.Len() != 0 {
+			t.Fatalf("expected allow with no output, got blocked=%v out=%q", blocked, out.String())
+		}
+	}
+
+	want := []string{"session.tool_result", "session.agent_stopped"}
+	for _, eventType := range want {
+		frameCh := make(chan *protocol.Frame, 1)
+		go func() {
+			f, _ := subReader.ReadFrame()
+			frameCh <- f
+		}()
+		select {
+		case f := <-frameCh:
+			if f == nil {
+				t.Fatal("subscription closed")
+			}
+			var ev protocol.Response
+			if err := json.Unmarshal(f.Payload, &ev); err != nil {
+				t.Fatalf("unmarshal event: %v", err)
+			}
+			if ev.Event == nil || ev.Event.EventType != eventType {
+				t.Fatalf("expected %s event, got %+v", eventType, ev.Event)
+			}
+			if eventType == "session.tool_result" {
+				var data struct {
+					Tool     string          `json:"tool"`
+					Response json.RawMessage `json:"response"`
+				}
+				json.Unmarshal(ev.Event.Data, &data)
+				if data.Tool != "Bash" || !strings.Contains(string(data.Response), "file.txt") {
+					t.Fatalf("unexpected tool_result data: %s", ev.Event.Data)
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", eventType)
+		}
+	}
+}
+
+// TestHookBudgetExceeded verifies that the hook blocks tool calls once the
+// session budget set at launch is exhausted.
+func TestHookBudgetExceeded(t *testing.T) {
+	t.Parallel()
+	dir := tempDir(t, "hook-budget")
+	sock := startTestNode(t, dir)
+
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"sleep", "30"},
+		WorkingDir: "/tmp",
+		Budget:     &protocol.Budget{Bash: 1},
+	})
+	if resp.Type != "Launched" || resp.ID == nil {
+		t.Fatalf("launch: unexpected response %q", resp.Type)
+	}
+	id := *resp.ID
+
+	target := &client.Target{Local: dir}
+	input := `{"hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"ls"}}`
+
+	var out strings.Builder
+	blocked, err := client.HookForSession(context.Background(), target, &id, strings.NewReader(input), &out)
+	if err != nil || blocked {
+		t.Fatalf("first call: expected allow, got blocked=%v err=%v", blocked, err)
+	}
+
+	out.Reset()
+	blocked, err = client.HookForSession(context.Background(), target, &id, strings.NewReader(input), &out)
+	if err != nil {
+		t.Fatalf("HookForSession() error: %v", err)
+	}
+	if !blocked {
+		t.Fatal("second call: expected block")
+	}
+	var decision struct {
+		Decision string `json:"decision"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out.String())), &decision); err != nil {
+		t.Fatalf("parse hook output %q: %v", out.String(), err)
+	}
+	if decision.Decision != "block" || !strings.Contains(decision.Reason, "budget exceeded") {
+		t.Fatalf("unexpected decision: %+v", decision)
+	}
+
+	status := requestResponse(t, sock, &protocol.Request{Type: "GetStatus", ID: &id})
+	if status.Info == nil || status.Info.Budget == nil || status.Info.Budget.Bash != 1 {
+		t.Fatalf("expected budget in session info, got %+v", status.Info)
+	}
+}
+
+// TestHookDeniedNotCharged verifies that tool calls the gateway denies do not
+// use up the session budget.
+func TestHookDeniedNotCharged(t *testing.T) {
+	t.Parallel()
+	dir := tempDir(t, "hook-denied-budget")
+	sock := startTestNode(t, dir)
+
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"sleep", "30"},
+		WorkingDir: "/tmp",
+		Budget:     &protocol.Budget{Bash: 1},
+	})
+	if resp.Type != "Launched" || resp.ID == nil {
+		t.Fatalf("launch: unexpected response %q", resp.Type)
+	}
+	id := *resp.ID
+
+	// A gateway that denies everything.
+	resp = requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"sleep", "30"},
+		WorkingDir: "/tmp",
+		Name:       "gateway",
+	})
+	if resp.Type != "Launched" || resp.ID == nil {
+		t.Fatalf("launch gateway: unexpected response %q", resp.Type)
+	}
+	gatewayID := *resp.ID
+	subConn, subReader, subWriter := connectRaw(t, sock)
+	defer subConn.Close()
+	if err := subWriter.SendRequest(&protocol.Request{
+		Type:       "Subscribe",
+		ID:         &gatewayID,
+		EventTypes: []string{"message.request"},
+	}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if f, err := subReader.ReadFrame(); err != nil || f == nil {
+		t.Fatalf("read SubscribeAck: %v", err)
+	}
+	go func() {
+		for {
+			f, err := subReader.ReadFrame()
+			if err != nil || f == nil {
+				return
+			}
+			var ev protocol.Response
+			if json.Unmarshal(f.Payload, &ev) != nil || ev.Event == nil {
+				continue
+			}
+			var reqData struct {
+				RequestID string `json:"request_id"`
+			}
+			json.Unmarshal(ev.Event.Data, &reqData)
+			conn, _, writer := connectRaw(t, sock)
+			writer.SendRequest(&protocol.Request{Type: "MsgReply", RequestID: reqData.RequestID, Body: "DENIED: not now"})
+			conn.Close()
+		}
+	}()
+
+	target := &client.Target{Local: dir}
+	input := `{"hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"ls"}}`
+	hook := func() (bool, string) {
+		t.Helper()
+		var out strings.Builder
+		blocked, err := client.HookForSession(context.Background(), target, &id, strings.NewReader(input), &out)
+		if err != nil {
+			t.Fatalf("HookForSession() error: %v", err)
+		}
+		return blocked, out.String()
+	}
+
+	for i := range 2 {
+		if blocked, out := hook(); !blocked || !strings.Contains(out, "Gateway denied") {
+			t.Fatalf("call %d: expected the gateway to deny, got blocked=%v out=%q", i, blocked, out)
+		}
+	}
+
+	// With the gateway gone, the budget's one Bash call is still there.
+	if resp := requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: &gatewayID}); resp.Type == "Error" {
+		t.Fatalf("kill gateway: %s", resp.Message)
+	}
+	for i := 0; sessionStatus(t, sock, gatewayID) == "running"; i++ {
+		if i == 50 {
+			t.Fatal("gateway still running")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if blocked, out := hook(); blocked {
+		t.Fatalf("expected the budget to allow one call, got %q", out)
+	}
+	if blocked, out := hook(); !blocked || !strings.Contains(out, "budget exceeded") {
+		t.Fatalf("expected the budget to block, got blocked=%v out=%q", blocked, out)
+	}
+}
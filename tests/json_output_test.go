@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// captureStdout returns what f prints to stdout.
+func captureStdout(t *testing.T, f func() error) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+	err = f()
+	os.Stdout = stdout
+	w.Close()
+	out := <-done
+	if err != nil {
+		t.Fatalf("%v (output %q)", err, out)
+	}
+	return out
+}
+
+func TestJSONOutput(t *testing.T) {
+	dir := tempDir(t, "json-output")
+	startTestNode(t, dir)
+	target := &client.Target{Local: dir}
+
+	var launched client.LaunchResult
+	out := captureStdout(t, func() error {
+		return client.Run(context.Background(), target, []string{"sh", "-c", "read line; echo got $line; exit 4"}, client.RunOptions{
+			WorkingDir: dir,
+			Name:       "reader",
+			JSON:       true,
+		})
+	})
+	if err := json.Unmarshal(out, &launched); err != nil {
+		t.Fatalf("cw run --json printed %q: %v", out, err)
+	}
+	if launched.ID == 0 || launched.Name != "reader" || launched.Status != "running" {
+		t.Fatalf("cw run --json = %+v", launched)
+	}
+
+	var sent client.SendResult
+	out = captureStdout(t, func() error {
+		input := "hello"
+		return client.SendInput(context.Background(), target, launched.ID, nil, &input, false, nil, "", nil, false, true)
+	})
+	if err := json.Unmarshal(out, &sent); err != nil || sent != (client.SendResult{ID: launched.ID, Bytes: 6}) {
+		t.Fatalf("cw send --json printed %q (%v)", out, err)
+	}
+
+	var waited client.WaitResult
+	out = captureStdout(t, func() error {
+		return client.WaitForSession(context.Background(), target, &launched.ID, nil, client.WaitOptions{Condition: "any", JSON: true})
+	})
+	if err := json.Unmarshal(out, &waited); err != nil {
+		t.Fatalf("cw wait --json printed %q: %v", out, err)
+	}
+	if !waited.Met || waited.Condition != "any" || waited.ExitCode != 4 || len(waited.Sessions) != 1 {
+		t.Fatalf("cw wait --json = %+v", waited)
+	}
+
+	var messages []protocol.MessageResponse
+	out = captureStdout(t, func() error { return client.Inbox(context.Background(), target, launched.ID, 10, true) })
+	if err := json.Unmarshal(out, &messages); err != nil || messages == nil || len(messages) != 0 {
+		t.Fatalf("cw inbox --json of an empty inbox printed %q (%v)", out, err)
+	}
+}
+
+func TestSchemaCommands(t *testing.T) {
+	// The schema lists every field, requiring those without omitempty.
+	schema := client.JSONSchema(reflect.TypeFor[client.WaitResult]())
+	props := schema["properties"].(map[string]any)
+	for _, field := range []string{"met", "exit_code", "sessions", "session_id"} {
+		if _, ok := props[field]; !ok {
+			t.Errorf("WaitResult schema lacks %q", field)
+		}
+	}
+	if required := schema["required"].([]string); !reflect.DeepEqual(required, []string{"met", "exit_code", "sessions"}) {
+		t.Errorf("WaitResult required = %q", required)
+	}
+	items := props["sessions"].(map[string]any)["items"].(map[string]any)
+	if items["title"] != "SessionInfo" {
+		t.Errorf("sessions items = %v, want SessionInfo", items["title"])
+	}
+
+	commands := client.SchemaCommands()
+	for _, want := range []string{"run", "send", "kill", "wait", "msg", "request", "inbox", "subscribe", "kv list", "nodes", "list", "status"} {
+		if !slices.Contains(commands, want) {
+			t.Errorf("no schema for cw %s", want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestKillChildren(t *testing.T) {
+	dir := tempDir(t, "kill-children")
+	sock := startTestNode(t, dir)
+
+	childAlive := func(pidFile string) bool {
+		pid, err := strconv.Atoi(waitFile(t, pidFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Give the signal time to be delivered. A killed child whose parent
+		// is gone may linger as a zombie until init reaps it.
+		time.Sleep(200 * time.Millisecond)
+		stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+		return err == nil && !strings.Contains(string(stat), ") Z ")
+	}
+
+	// Without --children only the shell is signalled. Its child ignores the
+	// hangup sent when the shell exits, so it survives.
+	lone := filepath.Join(dir, "lone.pid")
+	id := launchShell(t, sock, "nohup sleep 30 >/dev/null 2>&1 & echo $! > "+lone+"; wait")
+	waitFile(t, lone)
+	requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: &id})
+	waitExited(t, sock, id, 5*time.Second)
+	if !childAlive(lone) {
+		t.Fatal("expected the child to outlive its shell")
+	}
+	pid, _ := strconv.Atoi(waitFile(t, lone))
+	_ = syscall.Kill(pid, syscall.SIGKILL)
+
+	group := filepath.Join(dir, "group.pid")
+	id = launchShell(t, sock, "nohup sleep 30 >/dev/null 2>&1 & echo $! > "+group+"; wait")
+	waitFile(t, group)
+	requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: &id, Children: true})
+	waitExited(t, sock, id, 5*time.Second)
+	if childAlive(group) {
+		t.Fatal("expected the child to be killed with its process group")
+	}
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// waitExited polls until session id's process has exited and returns its
+// final status.
+func waitExited(t *testing.T, sock string, id uint32, timeout time.Duration) string {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if status := sessionStatus(t, sock, id); strings.HasPrefix(status, "completed") || status == "killed" {
+			return status
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("session %d still running after %s", id, timeout)
+	return ""
+}
+
+// waitFile polls until path exists and returns its trimmed contents.
+func waitFile(t *testing.T, path string) string {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			return strings.TrimSpace(string(data))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("%s was not written", path)
+	return ""
+}
+
+func launchShell(t *testing.T, sock, script string) uint32 {
+	t.Helper()
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"sh", "-c", script},
+		WorkingDir: "/tmp",
+	})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	return *resp.ID
+}
+
+func TestKillSignal(t *testing.T) {
+	dir := tempDir(t, "kill-signal")
+	sock := startTestNode(t, dir)
+	ready := filepath.Join(dir, "ready")
+
+	id := launchShell(t, sock, "trap 'exit 3' INT; echo ok > "+ready+"; while :; do sleep 0.1; done")
+	waitFile(t, ready)
+
+	resp := requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: &id, Signal: "INT"})
+	if resp.Type != "Killed" {
+		t.Fatalf("expected Killed, got %s: %s", resp.Type, resp.Message)
+	}
+	if status := waitExited(t, sock, id, 5*time.Second); status != "killed" {
+		t.Fatalf("expected killed, got %q", status)
+	}
+	resp = requestResponse(t, sock, &protocol.Request{Type: "GetStatus", ID: &id})
+	if resp.Info == nil || resp.Info.ExitCode == nil || *resp.Info.ExitCode != 3 {
+		t.Fatalf("expected the INT trap to exit 3, got %+v", resp.Info)
+	}
+
+	resp = requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: &id, Signal: "USR1"})
+	if resp.Type != "Error" {
+		t.Fatalf("expected Error for unsupported signal, got %s", resp.Type)
+	}
+}
+
+func TestKillGraceEscalates(t *testing.T) {
+	dir := tempDir(t, "kill-grace")
+	sock := startTestNode(t, dir)
+	ready := filepath.Join(dir, "ready")
+
+	id := launchShell(t, sock, "trap '' TERM; echo ok > "+ready+"; while :; do sleep 0.1; done")
+	waitFile(t, ready)
+
+	start := time.Now()
+	resp := requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: &id, Grace: "500ms"})
+	if resp.Type != "Killed" {
+		t.Fatalf("expected Killed, got %s: %s", resp.Type, resp.Message)
+	}
+
+	// TERM is ignored, so the session only exits once KILL follows, and is
+	// running until then.
+	if status := sessionStatus(t, sock, id); status != "running" {
+		t.Fatalf("expected running during the grace period, got %q", status)
+	}
+	waitExited(t, sock, id, 5*time.Second)
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Fatalf("session exited after %s, before the grace period", elapsed)
+	}
+}
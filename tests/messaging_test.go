@@ -96,6 +96,48 @@ func TestNameConflict(t *testing.T) {
 	requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: uint32Ptr(firstID)})
 }
 
+// ---------------------------------------------------------------------------
+// TestAutoNameAndRename — unnamed launches get a generated name, and Rename
+// changes it.
+// ---------------------------------------------------------------------------
+
+func TestAutoNameAndRename(t *testing.T) {
+	dir := tempDir(t, "auto-name")
+	sock := startTestNode(t, dir)
+
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"bash", "-c", "sleep 30"},
+		WorkingDir: "/tmp",
+	})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	id := *resp.ID
+	if resp.Name == "" {
+		t.Fatal("expected a generated name in Launched response")
+	}
+
+	resp = requestResponse(t, sock, &protocol.Request{Type: "Rename", ID: uint32Ptr(id), Name: "planner"})
+	if resp.Type != "Renamed" {
+		t.Fatalf("expected Renamed, got %s: %s", resp.Type, resp.Message)
+	}
+
+	resp = requestResponse(t, sock, &protocol.Request{Type: "GetStatus", ID: uint32Ptr(id)})
+	if resp.Info == nil || resp.Info.Name != "planner" {
+		t.Fatalf("expected name 'planner' after rename, got %+v", resp.Info)
+	}
+
+	// Invalid names are rejected.
+	resp = requestResponse(t, sock, &protocol.Request{Type: "Rename", ID: uint32Ptr(id), Name: "bad name"})
+	if resp.Type != "Error" {
+		t.Fatalf("expected Error for invalid name, got %s", resp.Type)
+	}
+
+	// Clean up.
+	requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: uint32Ptr(id)})
+}
+
 // ---------------------------------------------------------------------------
 // TestNameBasedMessaging — send a message using to_name and read it back.
 // ---------------------------------------------------------------------------
@@ -0,0 +1,141 @@
+//go:build !windows
+
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+// startOrphan starts a process the way a node starts sessions, in its own
+// session and process group, and records it in sessions.json as running
+// session 7, as a node that exited without stopping it would have left it.
+// pidStart is recorded as the process's start; empty is how older nodes left
+// it.
+func startOrphan(t *testing.T, dir string, pidStart string) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command("sleep", "30")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Reap the process once it exits so it does not linger as a zombie.
+	go func() { _ = cmd.Wait() }()
+	t.Cleanup(func() { _ = cmd.Process.Kill() })
+
+	pid := uint32(cmd.Process.Pid)
+	metas := []session.SessionMeta{
+		{ID: 7, Name: "survivor", Prompt: "sleep 30", WorkingDir: "/tmp", CreatedAt: time.Now().UTC(), Status: "running", PID: &pid, PIDStart: pidStart, Tags: []string{"agents"}},
+		{ID: 6, Prompt: "true", WorkingDir: "/tmp", CreatedAt: time.Now().UTC(), Status: "completed (0)"},
+	}
+	data, err := json.Marshal(metas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "sessions", "7"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sessions", "7", "output.log"), []byte("before restart\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sessions.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestOrphanAdopted(t *testing.T) {
+	dir := tempDir(t, "orphan-adopt")
+	startOrphan(t, dir, "")
+	sock := startTestNode(t, dir)
+
+	resp := requestResponse(t, sock, &protocol.Request{Type: "ListSessions"})
+	if resp.Sessions == nil || len(*resp.Sessions) != 1 {
+		t.Fatalf("expected only the surviving session, got %+v", resp.Sessions)
+	}
+	s := (*resp.Sessions)[0]
+	if s.ID != 7 || s.Name != "survivor" || s.Status != "running" || !s.Adopted {
+		t.Fatalf("unexpected adopted session: %+v", s)
+	}
+
+	resp = requestResponse(t, sock, &protocol.Request{Type: "Logs", ID: &s.ID})
+	if resp.Type != "LogData" || resp.Data != "before restart\n" {
+		t.Fatalf("expected earlier output, got %s %q", resp.Type, resp.Data)
+	}
+	resp = requestResponse(t, sock, &protocol.Request{Type: "SendInput", ID: &s.ID, Data: []byte("x")})
+	if resp.Type != "Error" {
+		t.Fatalf("expected Error sending input to an adopted session, got %s", resp.Type)
+	}
+
+	// New sessions do not reuse the adopted ID.
+	resp = requestResponse(t, sock, &protocol.Request{Type: "Launch", Command: []string{"true"}, WorkingDir: "/tmp"})
+	if resp.Type != "Launched" || *resp.ID != 8 {
+		t.Fatalf("expected session 8, got %s %v: %s", resp.Type, resp.ID, resp.Message)
+	}
+
+	if resp := requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: &s.ID}); resp.Type != "Killed" {
+		t.Fatalf("expected Killed, got %s: %s", resp.Type, resp.Message)
+	}
+	if status := waitExited(t, sock, s.ID, 5*time.Second); status != "killed" {
+		t.Fatalf("expected killed, got %q", status)
+	}
+}
+
+func TestOrphanKilled(t *testing.T) {
+	dir := tempDir(t, "orphan-kill")
+	err := config.UpdateConfig(dir, func(cfg *config.Config) error {
+		cfg.Node.OrphanPolicy = "kill"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	orphan := startOrphan(t, dir, "")
+	sock := startTestNode(t, dir)
+
+	resp := requestResponse(t, sock, &protocol.Request{Type: "ListSessions"})
+	if resp.Sessions != nil && len(*resp.Sessions) != 0 {
+		t.Fatalf("expected no sessions, got %+v", *resp.Sessions)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for syscall.Kill(orphan.Process.Pid, 0) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("orphaned process is still running")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestOrphanRecycledPID(t *testing.T) {
+	dir := tempDir(t, "orphan-recycled")
+	err := config.UpdateConfig(dir, func(cfg *config.Config) error {
+		cfg.Node.OrphanPolicy = "kill"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	// The recorded start does not match the process now holding the PID,
+	// as if the session's process had exited and the PID been reused.
+	orphan := startOrphan(t, dir, "recycled")
+	sock := startTestNode(t, dir)
+
+	resp := requestResponse(t, sock, &protocol.Request{Type: "ListSessions"})
+	if resp.Sessions != nil && len(*resp.Sessions) != 0 {
+		t.Fatalf("expected no sessions, got %+v", *resp.Sessions)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if err := syscall.Kill(orphan.Process.Pid, 0); err != nil {
+		t.Fatalf("unrelated process was killed: %v", err)
+	}
+}
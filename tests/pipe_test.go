@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestPipe(t *testing.T) {
+	dir := tempDir(t, "pipe")
+	sock := startTestNode(t, dir)
+	start := filepath.Join(dir, "start")
+	out := filepath.Join(dir, "out")
+
+	sink := launchShell(t, sock, "while read -r line; do echo \"$line\" >> "+out+"; done")
+	src := launchShell(t, sock, "while [ ! -f "+start+" ]; do sleep 0.05; done; "+
+		"printf 'ok 1\\nFAIL a_test.go:12\\n\\nok 2\\nFAIL b_test.go:7\\n'; sleep 0.5")
+
+	for _, bad := range []*protocol.Request{
+		{Type: "PipeAdd", ID: &src, ToID: &src},
+		{Type: "PipeAdd", ID: &src, ToID: &sink, Replace: "x"},
+		{Type: "PipeAdd", ID: &src, ToID: &sink, Grep: "("},
+		{Type: "PipeAdd", ID: &src, ToID: uint32Ptr(999)},
+	} {
+		if resp := requestResponse(t, sock, bad); resp.Type != "Error" {
+			t.Errorf("PipeAdd %d → %d (grep %q, replace %q): expected Error, got %s", *bad.ID, *bad.ToID, bad.Grep, bad.Replace, resp.Type)
+		}
+	}
+
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:    "PipeAdd",
+		ID:      &src,
+		ToID:    &sink,
+		Grep:    `^FAIL (\w+)\.go:(\d+)`,
+		Replace: "fix $1 line $2",
+	})
+	if resp.Type != "PipeAdded" || resp.Pipes == nil || len(*resp.Pipes) != 1 {
+		t.Fatalf("expected PipeAdded, got %s: %s", resp.Type, resp.Message)
+	}
+	p := (*resp.Pipes)[0]
+	if p.From != src || p.To != sink {
+		t.Fatalf("pipe = %+v", p)
+	}
+	if err := os.WriteFile(start, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "fix a_test line 12\nfix b_test line 7"
+	var got string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		data, _ := os.ReadFile(out)
+		if got = strings.TrimSpace(string(data)); got == want {
+			break
+		}
+	}
+	if got != want {
+		t.Fatalf("sink read %q, want %q", got, want)
+	}
+
+	// The pipe ends with its source session.
+	waitExited(t, sock, src, 5*time.Second)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		resp = requestResponse(t, sock, &protocol.Request{Type: "PipeList"})
+		if resp.Type != "Pipes" {
+			t.Fatalf("expected Pipes, got %s: %s", resp.Type, resp.Message)
+		}
+		if len(*resp.Pipes) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pipe outlived its source: %+v", *resp.Pipes)
+		}
+	}
+	if resp := requestResponse(t, sock, &protocol.Request{Type: "PipeRemove", Pipe: p.ID}); resp.Type != "Error" {
+		t.Errorf("removing an ended pipe: expected Error, got %s", resp.Type)
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/protocol"
+	"github.com/codewiresh/codewire/internal/session"
+)
+
+func sessionStatus(t *testing.T, sock string, id uint32) string {
+	t.Helper()
+	resp := requestResponse(t, sock, &protocol.Request{Type: "GetStatus", ID: &id})
+	if resp.Info == nil {
+		t.Fatalf("GetStatus %d: %s %s", id, resp.Type, resp.Message)
+	}
+	return resp.Info.Status
+}
+
+func TestLaunchQueue(t *testing.T) {
+	dir := tempDir(t, "queue")
+	err := config.UpdateConfig(dir, func(cfg *config.Config) error {
+		cfg.Node.MaxConcurrentSessions = 1
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	sock := startTestNode(t, dir)
+
+	launch := func(noQueue bool, command ...string) *protocol.Response {
+		return requestResponse(t, sock, &protocol.Request{
+			Type:       "Launch",
+			Command:    command,
+			WorkingDir: "/tmp",
+			NoQueue:    noQueue,
+		})
+	}
+
+	first := launch(false, "sleep", "1")
+	if first.Type != "Launched" || first.Status != "running" {
+		t.Fatalf("expected first session running, got %s %q: %s", first.Type, first.Status, first.Message)
+	}
+	second := launch(false, "sh", "-c", "echo second")
+	if second.Type != "Launched" || second.Status != "queued" {
+		t.Fatalf("expected second session queued, got %s %q: %s", second.Type, second.Status, second.Message)
+	}
+	third := launch(false, "sleep", "30")
+	if third.Type != "Launched" || third.Status != "queued" {
+		t.Fatalf("expected third session queued, got %s %q: %s", third.Type, third.Status, third.Message)
+	}
+
+	if resp := launch(true, "true"); resp.Type != "Error" {
+		t.Fatalf("expected --no-queue launch to fail, got %s", resp.Type)
+	}
+
+	// A queued session can be killed before it starts.
+	if resp := requestResponse(t, sock, &protocol.Request{Type: "Kill", ID: third.ID}); resp.Type != "Killed" {
+		t.Fatalf("expected Killed, got %s: %s", resp.Type, resp.Message)
+	}
+	if got := sessionStatus(t, sock, *third.ID); got != "killed" {
+		t.Fatalf("expected killed third session, got %q", got)
+	}
+	if got := sessionStatus(t, sock, *second.ID); got != "queued" {
+		t.Fatalf("expected second session still queued, got %q", got)
+	}
+
+	// The second session starts once the first finishes, and runs to completion.
+	timeout := uint64(10)
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:           "Wait",
+		ID:             second.ID,
+		Condition:      "all",
+		TimeoutSeconds: &timeout,
+	})
+	if resp.Type != "WaitResult" {
+		t.Fatalf("expected WaitResult, got %s: %s", resp.Type, resp.Message)
+	}
+	if got := sessionStatus(t, sock, *second.ID); got != "completed (0)" {
+		t.Fatalf("expected second session completed, got %q", got)
+	}
+
+	events, err := session.ReadEventLog(filepath.Join(dir, "sessions", fmt.Sprintf("%d", *second.ID), "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var transitions []string
+	for _, e := range events {
+		if e.Type == session.EventSessionStatus {
+			var d session.SessionStatusData
+			_ = json.Unmarshal(e.Data, &d)
+			transitions = append(transitions, d.From+"->"+d.To)
+		}
+	}
+	if len(transitions) == 0 || transitions[0] != "queued->running" {
+		t.Fatalf("unexpected status transitions %v", transitions)
+	}
+
+	// With the queue empty and the slot free, launches run immediately.
+	if resp := launch(true, "true"); resp.Type != "Launched" || resp.Status != "running" {
+		t.Fatalf("expected immediate launch, got %s %q: %s", resp.Type, resp.Status, resp.Message)
+	}
+}
+
+func TestLaunchPool(t *testing.T) {
+	dir := tempDir(t, "pool")
+	sock := startTestNode(t, dir)
+
+	launch := func(pool string, size int, noQueue bool, command ...string) *protocol.Response {
+		return requestResponse(t, sock, &protocol.Request{
+			Type:       "Launch",
+			Command:    command,
+			WorkingDir: "/tmp",
+			Pool:       pool,
+			PoolSize:   size,
+			NoQueue:    noQueue,
+		})
+	}
+
+	first := launch("builders", 1, false, "sleep", "1")
+	if first.Type != "Launched" || first.Status != "running" {
+		t.Fatalf("expected first builder running, got %s %q: %s", first.Type, first.Status, first.Message)
+	}
+	// Joining without a size keeps the pool's limit of 1.
+	second := launch("builders", 0, false, "true")
+	if second.Type != "Launched" || second.Status != "queued" {
+		t.Fatalf("expected second builder queued, got %s %q: %s", second.Type, second.Status, second.Message)
+	}
+	if resp := launch("builders", 0, true, "true"); resp.Type != "Error" {
+		t.Fatalf("expected --no-queue launch to fail, got %s", resp.Type)
+	}
+
+	// Sessions outside the full pool are not held up by it.
+	if resp := launch("", 0, false, "true"); resp.Type != "Launched" || resp.Status != "running" {
+		t.Fatalf("expected unpooled session running, got %s %q: %s", resp.Type, resp.Status, resp.Message)
+	}
+	if resp := launch("shell", 2, false, "true"); resp.Type != "Launched" || resp.Status != "running" {
+		t.Fatalf("expected other pool's session running, got %s %q: %s", resp.Type, resp.Status, resp.Message)
+	}
+
+	timeout := uint64(10)
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:           "Wait",
+		ID:             second.ID,
+		Condition:      "all",
+		TimeoutSeconds: &timeout,
+	})
+	if resp.Type != "WaitResult" {
+		t.Fatalf("expected WaitResult, got %s: %s", resp.Type, resp.Message)
+	}
+	if got := sessionStatus(t, sock, *second.ID); got != "completed (0)" {
+		t.Fatalf("expected second builder completed, got %q", got)
+	}
+
+	resp = requestResponse(t, sock, &protocol.Request{Type: "GetStatus", ID: second.ID})
+	if resp.Info == nil || resp.Info.Pool != "builders" {
+		t.Fatalf("expected pool builders in status, got %+v", resp.Info)
+	}
+}
@@ -48,3 +48,80 @@ func TestAgentConnectsToHub(t *testing.T) {
 		t.Fatal("agent did not connect to hub")
 	}
 }
+
+func TestAgentTokenRotation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	st, _ := store.NewSQLiteStore(t.TempDir())
+	issued := time.Now().Add(-time.Hour)
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n1", Token: "tok1", AuthorizedAt: issued, LastSeenAt: issued})
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n2", Token: "tok2", AuthorizedAt: issued, LastSeenAt: issued})
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "laptop", Token: "tok3", Scope: store.ScopeClient, AuthorizedAt: issued, LastSeenAt: issued})
+
+	hub := localrelay.NewNodeHub()
+	srv := httptest.NewServer(localrelay.BuildRelayMux(hub, localrelay.NewPendingSessions(), st))
+	defer srv.Close()
+
+	saved := make(chan string, 1)
+	go localrelay.RunAgent(ctx, localrelay.AgentConfig{
+		RelayURL:  srv.URL,
+		NodeName:  "n1",
+		NodeToken: "tok1",
+		Rotate: func(token string) error {
+			saved <- token
+			return nil
+		},
+	})
+	for deadline := time.Now().Add(3 * time.Second); !hub.Has("n1") && time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if !hub.Has("n1") {
+		t.Fatal("agent did not connect to hub")
+	}
+
+	rotate := func(name string) int {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/api/v1/keys/"+name+"/rotate", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := rotate("n1"); code != http.StatusOK {
+		t.Fatalf("rotating n1: HTTP %d", code)
+	}
+
+	var token string
+	select {
+	case token = <-saved:
+	default:
+		t.Fatal("node was not given a new token")
+	}
+	node, _ := st.NodeGet(ctx, "n1")
+	if node.Token != token || node.PendingToken != "" || !node.AuthorizedAt.After(issued) {
+		t.Fatalf("after rotation: %+v", node)
+	}
+	if old, _ := st.NodeGetByToken(ctx, "tok1"); old != nil {
+		t.Fatal("old token still valid after the cutover")
+	}
+	for deadline := time.Now().Add(3 * time.Second); !hub.Has("n1") && time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if !hub.Has("n1") {
+		t.Fatal("agent did not reconnect with the new token")
+	}
+
+	// A node that is not connected, or a client, cannot be rotated, and
+	// keeps its token.
+	if code := rotate("n2"); code != http.StatusConflict {
+		t.Fatalf("rotating disconnected n2: HTTP %d, want 409", code)
+	}
+	if code := rotate("laptop"); code != http.StatusBadRequest {
+		t.Fatalf("rotating client: HTTP %d, want 400", code)
+	}
+	if n2, _ := st.NodeGetByToken(ctx, "tok2"); n2 == nil || n2.PendingToken != "" {
+		t.Fatalf("failed rotation changed n2's tokens: %+v", n2)
+	}
+}
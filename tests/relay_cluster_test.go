@@ -0,0 +1,122 @@
+//go:build integration
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	localrelay "github.com/codewiresh/codewire/internal/relay"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// testReplica is one relay replica sharing st with the others.
+type testReplica struct {
+	hub  *localrelay.NodeHub
+	http *httptest.Server
+	ssh  net.Listener
+}
+
+func startTestReplica(t *testing.T, ctx context.Context, st store.Store) *testReplica {
+	t.Helper()
+	hub := localrelay.NewNodeHub()
+	sessions := localrelay.NewPendingSessions()
+
+	mux := http.NewServeMux()
+	mux.Handle("/", localrelay.BuildRelayMux(hub, sessions, st))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	localrelay.NewCluster(st, hub, sessions, srv.URL, "cluster-secret").RegisterHandlers(mux)
+
+	sshSrv, err := localrelay.NewSSHServer(st, hub, sessions)
+	if err != nil {
+		t.Fatalf("creating SSH server: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go sshSrv.Serve(ctx, ln)
+
+	return &testReplica{hub: hub, http: srv, ssh: ln}
+}
+
+// TestRelayClusterSSH connects the node agent to one replica and SSH to
+// another. The SSH request is forwarded to the agent's replica, and the
+// agent's back-connection is proxied to the replica holding the SSH session.
+func TestRelayClusterSSH(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	st, _ := store.NewSQLiteStore(t.TempDir())
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n1", Token: "tok1", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+
+	a := startTestReplica(t, ctx, st)
+	b := startTestReplica(t, ctx, st)
+
+	go localrelay.RunAgent(ctx, localrelay.AgentConfig{
+		RelayURL:  a.http.URL,
+		NodeName:  "n1",
+		NodeToken: "tok1",
+	})
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && !a.hub.Has("n1") {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !a.hub.Has("n1") {
+		t.Fatal("agent did not connect")
+	}
+	if b.hub.Has("n1") {
+		t.Fatal("expected the agent to be connected to replica A only")
+	}
+
+	sshCfg := &ssh.ClientConfig{
+		User:            "n1",
+		Auth:            []ssh.AuthMethod{ssh.Password("tok1")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+	client, err := ssh.Dial("tcp", b.ssh.Addr().String(), sshCfg)
+	if err != nil {
+		t.Fatalf("ssh dial: %v", err)
+	}
+	defer client.Close()
+
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("ssh session: %v", err)
+	}
+	defer sess.Close()
+
+	if err := sess.RequestPty("xterm", 24, 80, ssh.TerminalModes{}); err != nil {
+		t.Fatalf("pty request: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	sess.Stdout = &stdout
+	sess.Stdin = bytes.NewBufferString("echo hello-cluster\nexit\n")
+
+	if err := sess.Shell(); err != nil {
+		t.Fatalf("ssh shell: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- sess.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for shell to exit")
+	}
+
+	if !bytes.Contains(stdout.Bytes(), []byte("hello-cluster")) {
+		t.Fatalf("expected 'hello-cluster' in output, got: %q", stdout.String())
+	}
+}
@@ -0,0 +1,135 @@
+//go:build integration
+
+package tests
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	localrelay "github.com/codewiresh/codewire/internal/relay"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// TestRelayEndToEndSSH runs an SSH session with the node inside a
+// direct-tcpip channel through the relay (ssh -J), so the relay only
+// forwards ciphertext.
+func TestRelayEndToEndSSH(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	st, _ := store.NewSQLiteStore(t.TempDir())
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n1", Token: "tok1", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+
+	hub := localrelay.NewNodeHub()
+	sessions := localrelay.NewPendingSessions()
+	httpSrv := httptest.NewServer(localrelay.BuildRelayMux(hub, sessions, st))
+	defer httpSrv.Close()
+
+	sshSrv, err := localrelay.NewSSHServer(st, hub, sessions)
+	if err != nil {
+		t.Fatalf("creating SSH server: %v", err)
+	}
+	sshLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go sshSrv.Serve(ctx, sshLn)
+
+	// The node's host key, as printed by cw setup, and a client key it trusts.
+	nodeDir := t.TempDir()
+	hostKey, err := localrelay.LoadOrCreateHostKey(nodeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	clientKey, _ := ssh.NewSignerFromKey(priv)
+	if err := os.WriteFile(filepath.Join(nodeDir, localrelay.AuthorizedKeysFile), ssh.MarshalAuthorizedKey(clientKey.PublicKey()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	go localrelay.RunAgent(ctx, localrelay.AgentConfig{
+		RelayURL:  httpSrv.URL,
+		NodeName:  "n1",
+		NodeToken: "tok1",
+		DataDir:   nodeDir,
+	})
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && !hub.Has("n1") {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !hub.Has("n1") {
+		t.Fatal("agent did not connect")
+	}
+
+	jump, err := ssh.Dial("tcp", sshLn.Addr().String(), &ssh.ClientConfig{
+		User:            "n1",
+		Auth:            []ssh.AuthMethod{ssh.Password("tok1")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("ssh dial relay: %v", err)
+	}
+	defer jump.Close()
+
+	dialNode := func(signer ssh.Signer) (*ssh.Client, error) {
+		conn, err := jump.Dial("tcp", "n1:22")
+		if err != nil {
+			return nil, err
+		}
+		c, chans, reqs, err := ssh.NewClientConn(conn, "n1:22", &ssh.ClientConfig{
+			User:            "me",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+			Timeout:         5 * time.Second,
+		})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return ssh.NewClient(c, chans, reqs), nil
+	}
+
+	node, err := dialNode(clientKey)
+	if err != nil {
+		t.Fatalf("ssh to node through relay: %v", err)
+	}
+	defer node.Close()
+	sess, err := node.NewSession()
+	if err != nil {
+		t.Fatalf("ssh session: %v", err)
+	}
+	out, err := sess.Output("echo hello-e2e")
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if strings.TrimSpace(string(out)) != "hello-e2e" {
+		t.Fatalf("expected hello-e2e, got %q", out)
+	}
+
+	// A key the node does not know is refused by the node itself.
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	other, _ := ssh.NewSignerFromKey(otherPriv)
+	if c, err := dialNode(other); err == nil {
+		c.Close()
+		t.Fatal("expected an unauthorized client key to be refused")
+	}
+
+	entries, err := st.AuditList(ctx, store.AuditFilter{Node: "n1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || entries[len(entries)-1].Action != "ssh.e2e" {
+		t.Fatalf("expected ssh.e2e audit entries, got %+v", entries)
+	}
+}
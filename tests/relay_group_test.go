@@ -0,0 +1,316 @@
+//go:build integration
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/protocol"
+	localrelay "github.com/codewiresh/codewire/internal/relay"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// startGroupNode starts a node named name that joins group gpu on the relay
+// at relayURL, and returns its socket.
+func startGroupNode(t *testing.T, relayURL, name, token string) string {
+	t.Helper()
+	dir := tempDir(t, "group-"+name)
+	cfg := fmt.Sprintf("relay_url = %q\nrelay_token = %q\nrelay_groups = [\"gpu\"]\n\n[node]\nname = %q\n", relayURL, token, name)
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return startTestNode(t, dir)
+}
+
+// TestRelayGroupRun launches sessions through the relay on the nodes of a
+// group, placed round-robin and on the least-loaded node.
+func TestRelayGroupRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	st, _ := store.NewSQLiteStore(t.TempDir())
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n1", Token: "tok1", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n2", Token: "tok2", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+
+	hub := localrelay.NewNodeHub()
+	srv := httptest.NewServer(localrelay.BuildRelayMux(hub, localrelay.NewPendingSessions(), st))
+	defer srv.Close()
+
+	socks := map[string]string{
+		"n1": startGroupNode(t, srv.URL, "n1", "tok1"),
+		"n2": startGroupNode(t, srv.URL, "n2", "tok2"),
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && len(hub.Group("gpu")) < 2 {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if nodes := hub.Group("gpu"); len(nodes) != 2 {
+		t.Fatalf("group gpu = %+v", nodes)
+	}
+
+	run := func(placement string) string {
+		t.Helper()
+		target := &client.Target{URL: srv.URL, NodeGroup: "gpu", Placement: placement}
+		out := captureStdout(t, func() error {
+			return client.Run(target, []string{"sleep", "30"}, client.RunOptions{WorkingDir: t.TempDir(), JSON: true})
+		})
+		var result client.LaunchResult
+		if err := json.Unmarshal(out, &result); err != nil {
+			t.Fatalf("parsing %s: %v", out, err)
+		}
+		if result.Node == "" || result.Node != target.Node {
+			t.Fatalf("launched on node %q, target node %q", result.Node, target.Node)
+		}
+		return result.Node
+	}
+
+	if a, b := run("round-robin"), run("round-robin"); a == b {
+		t.Errorf("round-robin placed both sessions on %s", a)
+	}
+	// Both nodes run one session; the tie goes to n1, then n2 has fewer.
+	if got := run("least-loaded"); got != "n1" {
+		t.Errorf("least-loaded placed on %s, want n1", got)
+	}
+	if got := run("least-loaded"); got != "n2" {
+		t.Errorf("least-loaded placed on %s, want n2", got)
+	}
+	for name, sock := range socks {
+		resp := requestResponse(t, sock, &protocol.Request{Type: "ListSessions"})
+		if len(*resp.Sessions) != 2 {
+			t.Errorf("node %s runs %d sessions, want 2", name, len(*resp.Sessions))
+		}
+	}
+
+	target := &client.Target{URL: srv.URL, NodeGroup: "cpu"}
+	if err := client.Run(target, []string{"true"}, client.RunOptions{WorkingDir: t.TempDir()}); err == nil {
+		t.Error("run on an empty group succeeded")
+	}
+}
+
+// TestRelayScheduleSession submits sessions to the relay, which launches
+// them on the node with room, and reaches them with the returned handle.
+func TestRelayScheduleSession(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	st, _ := store.NewSQLiteStore(t.TempDir())
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n1", Token: "tok1", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n2", Token: "tok2", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+
+	hub := localrelay.NewNodeHub()
+	srv := httptest.NewServer(localrelay.BuildRelayMux(hub, localrelay.NewPendingSessions(), st))
+	defer srv.Close()
+
+	startGroupNode(t, srv.URL, "n1", "tok1")
+	startGroupNode(t, srv.URL, "n2", "tok2")
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && len(hub.Group("")) < 2 {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	schedule := func(spec localrelay.LaunchSpec) (localrelay.ScheduledSession, int) {
+		t.Helper()
+		body, _ := json.Marshal(spec)
+		resp, err := http.Post(srv.URL+"/api/v1/sessions", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var s localrelay.ScheduledSession
+		if resp.StatusCode == http.StatusCreated {
+			if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return s, resp.StatusCode
+	}
+
+	first, code := schedule(localrelay.LaunchSpec{Command: []string{"sleep", "30"}, Name: "job1", WorkingDir: t.TempDir()})
+	if code != http.StatusCreated {
+		t.Fatalf("schedule status = %d", code)
+	}
+	if first.Handle != fmt.Sprintf("%s:%d", first.Node, first.ID) || first.Status != "running" {
+		t.Fatalf("scheduled %+v", first)
+	}
+	// The node that took the first session has more load.
+	second, _ := schedule(localrelay.LaunchSpec{Command: []string{"sleep", "30"}, WorkingDir: t.TempDir()})
+	if second.Node == first.Node {
+		t.Errorf("both sessions scheduled on %s", first.Node)
+	}
+
+	// The handle reaches the session through the relay.
+	sessions, err := client.ListFiltered(&client.Target{URL: srv.URL, Node: first.Node}, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != first.ID || sessions[0].Name != "job1" {
+		t.Fatalf("sessions on %s = %+v", first.Node, sessions)
+	}
+
+	if _, code := schedule(localrelay.LaunchSpec{}); code != http.StatusBadRequest {
+		t.Errorf("empty spec status = %d, want 400", code)
+	}
+	if _, code := schedule(localrelay.LaunchSpec{Command: []string{"true"}, Group: "cpu"}); code != http.StatusServiceUnavailable {
+		t.Errorf("empty group status = %d, want 503", code)
+	}
+}
+
+// TestRelayNodeStatus checks that a node's heartbeat reaches the relay's
+// node list.
+func TestRelayNodeStatus(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	st, _ := store.NewSQLiteStore(t.TempDir())
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n1", Token: "tok1", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+
+	hub := localrelay.NewNodeHub()
+	srv := httptest.NewServer(localrelay.BuildRelayMux(hub, localrelay.NewPendingSessions(), st))
+	defer srv.Close()
+
+	dir := tempDir(t, "status-n1")
+	cfg := fmt.Sprintf("relay_url = %q\nrelay_token = \"tok1\"\n\n[node]\nname = \"n1\"\ntags = [\"gpu\", \"eu\"]\n", srv.URL)
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	startTestNode(t, dir)
+
+	// The node reports its status as soon as it connects.
+	var node client.NodeInfo
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(srv.URL + "/api/v1/nodes")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var nodes []client.NodeInfo
+		err = json.NewDecoder(resp.Body).Decode(&nodes)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) == 1 && nodes[0].Status != nil {
+			node = nodes[0]
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if node.Status == nil {
+		t.Fatal("node reported no status")
+	}
+	if !node.Connected || node.Status.CPUs == 0 {
+		t.Fatalf("node = %+v, status = %+v", node, *node.Status)
+	}
+	if runtime.GOOS == "linux" && (node.Status.MemTotal == 0 || node.Status.DiskFree == 0) {
+		t.Errorf("status without memory or disk: %+v", *node.Status)
+	}
+	if node.Status.OS != runtime.GOOS || node.Status.Arch != runtime.GOARCH || len(node.Status.Tags) != 2 {
+		t.Errorf("status platform or tags: %+v", *node.Status)
+	}
+
+	filter := func(f string) []client.NodeInfo {
+		t.Helper()
+		out := captureStdout(t, func() error {
+			return client.Nodes(srv.URL, client.NodesOptions{JSON: true, Filter: f})
+		})
+		var nodes []client.NodeInfo
+		if err := json.Unmarshal(out, &nodes); err != nil {
+			t.Fatalf("parsing %s: %v", out, err)
+		}
+		return nodes
+	}
+	for f, want := range map[string]int{"connected=true": 1, "tag=gpu,os=" + runtime.GOOS: 1, "tag=cpu": 0, "!tag": 0, "connected=false": 0} {
+		if got := len(filter(f)); got != want {
+			t.Errorf("--filter %s kept %d nodes, want %d", f, got, want)
+		}
+	}
+}
+
+func TestRelayUpdateChannel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	st, _ := store.NewSQLiteStore(t.TempDir())
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n1", Token: "tok1", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+
+	hub := localrelay.NewNodeHub()
+	srv := httptest.NewServer(localrelay.BuildRelayMux(hub, localrelay.NewPendingSessions(), st))
+	defer srv.Close()
+
+	setChannel := func(body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/api/v1/update-channels/stable", bytes.NewReader([]byte(body)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := setChannel(`{"version": "latest"}`); code != http.StatusBadRequest {
+		t.Fatalf("setting version latest: status %d, want 400", code)
+	}
+	if code := setChannel(`{"version": "v0.2.0", "url": "https://mirror.example/cw"}`); code != http.StatusOK {
+		t.Fatalf("setting channel: status %d", code)
+	}
+
+	// The node on another version than the channel's is asked to update as
+	// soon as it reports its status; the node on the channel's version is
+	// left alone.
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n2", Token: "tok2", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+	type offer struct{ node, version, url string }
+	offers := make(chan offer, 16)
+	for name, version := range map[string]string{"n1": "v0.2.0", "n2": "v0.1.9"} {
+		token := "tok" + name[1:]
+		go localrelay.RunAgent(ctx, localrelay.AgentConfig{
+			RelayURL:  srv.URL,
+			NodeName:  name,
+			NodeToken: token,
+			Status: func() localrelay.NodeStatus {
+				return localrelay.NodeStatus{Version: version, Channel: "stable"}
+			},
+			Update: func(v, url string) { offers <- offer{name, v, url} },
+		})
+	}
+
+	select {
+	case o := <-offers:
+		if o.node != "n2" || o.version != "v0.2.0" || o.url != "https://mirror.example/cw" {
+			t.Errorf("offer = %+v", o)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("node was not offered the channel's version")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !hub.Has("n1") && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case o := <-offers:
+		if o.node == "n1" {
+			t.Errorf("node on the channel's version was offered %+v", o)
+		}
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/api/v1/update-channels/stable", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting channel: status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,139 @@
+//go:build integration
+
+package tests
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/codewiresh/codewire/internal/client"
+	localrelay "github.com/codewiresh/codewire/internal/relay"
+	"github.com/codewiresh/codewire/internal/store"
+)
+
+// TestSSHKeyCommands registers a client key with cw key add, then uses it to
+// run list and cw-attach through the relay's SSH listener.
+func TestSSHKeyCommands(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	st, err := store.NewSQLiteStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = st.NodeRegister(ctx, store.NodeRecord{Name: "n1", Token: "tok1", AuthorizedAt: time.Now(), LastSeenAt: time.Now()})
+
+	mux := http.NewServeMux()
+	localrelay.RegisterSSHKeyHandlers(mux, st)
+	api := httptest.NewServer(mux)
+	defer api.Close()
+
+	hub := localrelay.NewNodeHub()
+	sessions := localrelay.NewPendingSessions()
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	sshSrv, err := localrelay.NewSSHServer(st, hub, sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go sshSrv.Serve(ctx, ln)
+
+	// Simulated node: answer each command with the cw arguments it would
+	// run, then hang up.
+	msgCh := make(chan localrelay.HubMessage, 4)
+	hub.Register("n1", msgCh)
+	go func() {
+		for msg := range msgCh {
+			if msg.Type != "SSHRequest" {
+				continue
+			}
+			nodeSide, relaySide := net.Pipe()
+			sessions.DeliverForTest(msg.SessionID, relaySide)
+			go func() {
+				nodeSide.Write([]byte("cw " + strings.Join(msg.Command, " ") + "\r\n"))
+				nodeSide.Close()
+			}()
+		}
+	}()
+
+	// cw key add, run on the node, registers the client's key on the relay.
+	dir := t.TempDir()
+	cfg := "relay_url = \"" + api.URL + "\"\nrelay_token = \"tok1\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(priv)
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))) + " laptop"
+	if err := client.SSHKeyAdd(dir, line); err != nil {
+		t.Fatalf("SSHKeyAdd: %v", err)
+	}
+
+	dial := func(user string, key ssh.Signer) (*ssh.Client, error) {
+		return ssh.Dial("tcp", ln.Addr().String(), &ssh.ClientConfig{
+			User:            user,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		})
+	}
+	conn, err := dial("n1", signer)
+	if err != nil {
+		t.Fatalf("ssh dial with registered key: %v", err)
+	}
+	defer conn.Close()
+
+	run := func(command string) (string, error) {
+		sess, err := conn.NewSession()
+		if err != nil {
+			t.Fatalf("ssh session: %v", err)
+		}
+		defer sess.Close()
+		out, err := sess.CombinedOutput(command)
+		return string(out), err
+	}
+
+	if out, err := run("list"); err != nil || !strings.Contains(out, "cw list") {
+		t.Fatalf("list = %q, %v; want cw list", out, err)
+	}
+	if out, err := run("cw-attach planner"); err != nil || !strings.Contains(out, "cw attach planner") {
+		t.Fatalf("cw-attach = %q, %v; want cw attach planner", out, err)
+	}
+	for _, command := range []string{"rm -rf /", "cw-attach --server=other x"} {
+		out, err := run(command)
+		var exitErr *ssh.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 127 || !strings.Contains(out, "unsupported command") {
+			t.Fatalf("%q = %q, %v; want refusal with status 127", command, out, err)
+		}
+	}
+
+	// The key only opens the node it was added to, and other keys are
+	// refused.
+	if _, err := dial("n2", signer); err == nil {
+		t.Fatal("expected key to be refused for another node")
+	}
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	other, _ := ssh.NewSignerFromKey(otherPriv)
+	if _, err := dial("n1", other); err == nil {
+		t.Fatal("expected unregistered key to be refused")
+	}
+
+	// After cw key remove the key no longer logs in.
+	if err := client.SSHKeyRemove(dir, ssh.FingerprintSHA256(signer.PublicKey())); err != nil {
+		t.Fatalf("SSHKeyRemove: %v", err)
+	}
+	if _, err := dial("n1", signer); err == nil {
+		t.Fatal("expected removed key to be refused")
+	}
+}
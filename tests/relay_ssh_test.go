@@ -82,4 +82,19 @@ func TestSSHConnectAndShell(t *testing.T) {
 		t.Fatalf("ssh shell: %v", err)
 	}
 	t.Log("SSH shell started successfully")
+
+	// The bridged session is recorded in the audit log.
+	for i := 0; ; i++ {
+		entries, err := st.AuditList(ctx, store.AuditFilter{Node: "n1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 1 && entries[0].Action == "ssh" && entries[0].Result == "ok" && entries[0].SessionID != "" {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("expected an ssh audit entry, got %+v", entries)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 }
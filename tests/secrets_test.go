@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+func TestRunSecrets(t *testing.T) {
+	dir := tempDir(t, "run-secrets")
+	startTestNode(t, dir)
+	target := &client.Target{Local: dir}
+
+	envFile := filepath.Join(dir, "test.env")
+	if err := os.WriteFile(envFile, []byte("API_TOKEN=hunter2-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := client.ResolveSecrets(context.Background(), target, dir, []string{"TOKEN@envfile://" + envFile + "#API_TOKEN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var launched client.LaunchResult
+	out := captureStdout(t, func() error {
+		return client.Run(context.Background(), target, []string{"sh", "-c", `test -n "$TOKEN" && grep -qx "API_TOKEN=$TOKEN" test.env`}, client.RunOptions{
+			WorkingDir: dir,
+			Secrets:    resolved,
+			JSON:       true,
+		})
+	})
+	if err := json.Unmarshal(out, &launched); err != nil {
+		t.Fatalf("cw run --json printed %q: %v", out, err)
+	}
+	var waited client.WaitResult
+	out = captureStdout(t, func() error {
+		return client.WaitForSession(context.Background(), target, &launched.ID, nil, client.WaitOptions{Condition: "any", JSON: true})
+	})
+	if err := json.Unmarshal(out, &waited); err != nil || waited.ExitCode != 0 {
+		t.Fatalf("session did not see the secret: %s (%v)", out, err)
+	}
+
+	// The value is nowhere in the node's state.
+	for _, path := range []string{
+		filepath.Join(dir, "sessions.json"),
+		filepath.Join(dir, "sessions", fmt.Sprint(launched.ID), "events.jsonl"),
+	} {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "hunter2") {
+			t.Errorf("%s contains the secret", path)
+		}
+	}
+}
+
+func TestRunRedaction(t *testing.T) {
+	dir := tempDir(t, "run-redaction")
+	sock := startTestNode(t, dir)
+	target := &client.Target{Local: dir}
+
+	var launched client.LaunchResult
+	out := captureStdout(t, func() error {
+		return client.Run(context.Background(), target, []string{"sh", "-c", `printf 'token=%s\n' "$TOKEN"; echo key sk-abcdefghijklmnopqrstuv; printf 'waiting %s' "$TOKEN"`}, client.RunOptions{
+			WorkingDir: dir,
+			Secrets:    []string{"TOKEN=hunter2-secret"},
+			Redact:     []string{`sk-[A-Za-z0-9]{20,}`},
+			JSON:       true,
+		})
+	})
+	if err := json.Unmarshal(out, &launched); err != nil {
+		t.Fatalf("cw run --json printed %q: %v", out, err)
+	}
+	captureStdout(t, func() error {
+		return client.WaitForSession(context.Background(), target, &launched.ID, nil, client.WaitOptions{Condition: "any", JSON: true})
+	})
+
+	id := launched.ID
+	resp := requestResponse(t, sock, &protocol.Request{Type: "Logs", ID: &id, Follow: boolPtr(false)})
+	for _, want := range []string{"token=[REDACTED]", "key [REDACTED]", "waiting [REDACTED]"} {
+		if !strings.Contains(resp.Data, want) {
+			t.Errorf("logs %q lack %q", resp.Data, want)
+		}
+	}
+	resp = requestResponse(t, sock, &protocol.Request{Type: "GetStatus", ID: &id})
+	if resp.Info == nil || resp.Info.LastOutputSnippet == nil {
+		t.Fatalf("no output snippet in %+v", resp)
+	}
+	if s := *resp.Info.LastOutputSnippet; strings.Contains(s, "hunter2") || strings.Contains(s, "sk-abc") {
+		t.Errorf("status snippet leaks a secret: %q", s)
+	}
+}
@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/client"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// fakeSSH stands in for ssh: it drops the options and the destination, logs
+// the remote command and runs it locally with HOME set to $CW_SSH_HOME. The
+// installed cw is this test binary, so it runs that as TestSSHStdioHelper
+// in place of cw node stdio.
+const fakeSSH = `#!/bin/sh
+while [ "$1" != "--" ]; do shift; done
+shift 2
+echo "$1" >> "$CW_SSH_HOME/commands"
+export HOME="$CW_SSH_HOME"
+case "$1" in
+*"node stdio"*)
+	[ -x "$HOME/.codewire/bin/cw" ] || exit 127
+	exec "$HOME/.codewire/bin/cw" -test.run='^TestSSHStdioHelper$'
+	;;
+esac
+exec sh -c "$1"
+`
+
+func TestSSHStdioHelper(t *testing.T) {
+	dir := os.Getenv("CW_SSH_NODE_DIR")
+	if dir == "" {
+		t.Skip("helper process for TestSSHTarget")
+	}
+	if err := client.ServeStdio(dir, os.Stdin, os.Stdout); err != nil {
+		t.Fatal(err)
+	}
+	os.Exit(0)
+}
+
+func TestSSHTarget(t *testing.T) {
+	dir := tempDir(t, "ssh-target")
+	startTestNode(t, dir)
+
+	home := filepath.Join(dir, "home")
+	bin := filepath.Join(dir, "bin")
+	for _, d := range []string{home, bin} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte(fakeSSH), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("CW_SSH_HOME", home)
+	t.Setenv("CW_SSH_NODE_DIR", dir)
+
+	target, err := client.ResolveTarget(dir, "ssh://dev@example.com:2222", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.SSH != "ssh://dev@example.com:2222" || target.IsLocal() {
+		t.Fatalf("target = %+v, want SSH target", target)
+	}
+
+	send := func(req *protocol.Request) *protocol.Response {
+		t.Helper()
+		reader, writer, err := target.Connect(context.Background())
+		if err != nil {
+			t.Fatalf("connecting over ssh: %v", err)
+		}
+		defer reader.Close()
+		defer writer.Close()
+		if err := writer.SendRequest(req); err != nil {
+			t.Fatal(err)
+		}
+		frame, err := reader.ReadFrame()
+		if err != nil || frame == nil {
+			t.Fatalf("reading response: %v", err)
+		}
+		var resp protocol.Response
+		if err := json.Unmarshal(frame.Payload, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return &resp
+	}
+
+	// The first connection finds no cw and installs this executable.
+	resp := send(&protocol.Request{Type: "Launch", Command: []string{"sleep", "30"}, WorkingDir: "/tmp"})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := os.ReadFile(exe)
+	got, err := os.ReadFile(filepath.Join(home, ".codewire", "bin", "cw"))
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("cw not installed in ~/.codewire/bin: %v", err)
+	}
+
+	resp = send(&protocol.Request{Type: "ListSessions"})
+	if resp.Type != "SessionList" || resp.Sessions == nil || len(*resp.Sessions) != 1 {
+		t.Fatalf("expected one session, got %s: %+v", resp.Type, resp.Sessions)
+	}
+
+	log, _ := os.ReadFile(filepath.Join(home, "commands"))
+	if n := strings.Count(string(log), "uname -sm"); n != 1 {
+		t.Fatalf("installed cw %d times, want once:\n%s", n, log)
+	}
+}
+
+func TestSSHTargetInvalid(t *testing.T) {
+	dir := tempDir(t, "ssh-target-invalid")
+	for _, server := range []string{"ssh://", "ssh://host/path"} {
+		if _, err := client.ResolveTarget(dir, server, ""); err == nil {
+			t.Errorf("ResolveTarget(%q) succeeded", server)
+		}
+	}
+}
+
+func TestSSHTargetCancel(t *testing.T) {
+	dir := tempDir(t, "ssh-target-cancel")
+	bin := filepath.Join(dir, "bin")
+	if err := os.MkdirAll(bin, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// An ssh that never connects.
+	if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte("#!/bin/sh\nexec sleep 30\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	target, err := client.ResolveTarget(dir, "ssh://example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := target.Connect(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Connect = %v, want the deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Connect took %s after the deadline", elapsed)
+	}
+}
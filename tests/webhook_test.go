@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/node"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// webhookRecorder is a test endpoint that records deliveries, failing the
+// first failFirst requests with a 500.
+type webhookRecorder struct {
+	mu         sync.Mutex
+	failFirst  int
+	requests   int
+	payloads   []node.WebhookPayload
+	signatures []string
+	bodies     [][]byte
+}
+
+func (r *webhookRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	if r.requests <= r.failFirst {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var p node.WebhookPayload
+	_ = json.Unmarshal(body, &p)
+	r.payloads = append(r.payloads, p)
+	r.signatures = append(r.signatures, req.Header.Get("X-Codewire-Signature"))
+	r.bodies = append(r.bodies, body)
+}
+
+// waitPayloads waits until at least n payloads were delivered.
+func (r *webhookRecorder) waitPayloads(t *testing.T, n int, timeout time.Duration) []node.WebhookPayload {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		got := append([]node.WebhookPayload(nil), r.payloads...)
+		r.mu.Unlock()
+		if len(got) >= n {
+			return got
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d webhook deliveries", n)
+	return nil
+}
+
+func TestWebhookDeliveryWithRetryAndSignature(t *testing.T) {
+	dir := tempDir(t, "webhook")
+	rec := &webhookRecorder{failFirst: 1}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	err := config.UpdateConfig(dir, func(cfg *config.Config) error {
+		cfg.Webhooks = []config.Webhook{{
+			URL:    srv.URL,
+			Events: []string{"session.status"},
+			Tags:   []string{"build"},
+			Secret: "s3cret",
+		}}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+
+	sock := startTestNode(t, dir)
+
+	// Untagged session: must not be delivered.
+	requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"true"},
+		WorkingDir: "/tmp",
+	})
+	resp := requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"true"},
+		WorkingDir: "/tmp",
+		Tags:       []string{"build"},
+	})
+	if resp.Type != "Launched" {
+		t.Fatalf("expected Launched, got %s: %s", resp.Type, resp.Message)
+	}
+	buildID := *resp.ID
+
+	// The first attempt fails with 500; the retry after ~1s succeeds.
+	payloads := rec.waitPayloads(t, 1, 8*time.Second)
+	p := payloads[0]
+	if p.Event != "session.status" {
+		t.Fatalf("expected session.status, got %s", p.Event)
+	}
+	if p.SessionID != buildID {
+		t.Fatalf("expected session %d, got %d", buildID, p.SessionID)
+	}
+	if len(p.Tags) != 1 || p.Tags[0] != "build" {
+		t.Fatalf("expected tags [build], got %v", p.Tags)
+	}
+
+	rec.mu.Lock()
+	sig, body := rec.signatures[0], rec.bodies[0]
+	rec.mu.Unlock()
+	if want := node.SignWebhookPayload("s3cret", body); sig != want {
+		t.Fatalf("signature mismatch: got %q, want %q", sig, want)
+	}
+
+	for _, p := range payloads {
+		if p.SessionID != buildID {
+			t.Fatalf("untagged session %d was delivered", p.SessionID)
+		}
+	}
+}
+
+func TestWebhookReload(t *testing.T) {
+	dir := tempDir(t, "webhook-reload")
+	rec := &webhookRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	sock := startTestNode(t, dir)
+
+	// Add the webhook after the node has started.
+	err := config.UpdateConfig(dir, func(cfg *config.Config) error {
+		cfg.Webhooks = append(cfg.Webhooks, config.Webhook{URL: srv.URL, Events: []string{"session.created"}})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	time.Sleep(3 * time.Second)
+
+	requestResponse(t, sock, &protocol.Request{
+		Type:       "Launch",
+		Command:    []string{"true"},
+		WorkingDir: "/tmp",
+	})
+
+	payloads := rec.waitPayloads(t, 1, 5*time.Second)
+	if payloads[0].Event != "session.created" {
+		t.Fatalf("expected session.created, got %s", payloads[0].Event)
+	}
+}
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+
+	"github.com/codewiresh/codewire/internal/auth"
+	"github.com/codewiresh/codewire/internal/config"
+	"github.com/codewiresh/codewire/internal/connection"
+	"github.com/codewiresh/codewire/internal/protocol"
+)
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 to dir and
+// returns a pool trusting it.
+func writeTestCert(t *testing.T, dir string) (certPath, keyPath string, roots *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath = filepath.Join(dir, "cert.pem")
+	keyPath = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots = x509.NewCertPool()
+	roots.AddCert(cert)
+	return certPath, keyPath, roots
+}
+
+// wsRequest sends one request over the node's WebSocket listener. It returns
+// an error if the connection is refused.
+func wsRequest(t *testing.T, url, token string, roots *x509.CertPool, req *protocol.Request) (*protocol.Response, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+		HTTPClient: &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}},
+		HTTPHeader: http.Header{"Authorization": []string{"Bearer " + token}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	reader := connection.NewWSReader(ctx, conn)
+	writer := connection.NewWSWriter(ctx, conn)
+	defer reader.Close()
+	defer writer.Close()
+
+	if err := writer.SendRequest(req); err != nil {
+		t.Fatalf("send request: %v", err)
+	}
+	f, err := reader.ReadFrame()
+	if err != nil || f == nil {
+		t.Fatalf("read response: %v", err)
+	}
+	var resp protocol.Response
+	if err := json.Unmarshal(f.Payload, &resp); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	return &resp, nil
+}
+
+func TestWebSocketTLSAndScopes(t *testing.T) {
+	dir := tempDir(t, "ws-scopes")
+	certPath, keyPath, roots := writeTestCert(t, dir)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	err = config.UpdateConfig(dir, func(cfg *config.Config) error {
+		cfg.Node.Listen = &addr
+		cfg.Node.TLSCert = certPath
+		cfg.Node.TLSKey = keyPath
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	sock := startTestNode(t, dir)
+	url := "wss://" + addr + "/ws"
+
+	admin, err := auth.LoadOrGenerateToken(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := auth.CreateToken(dir, "reader", auth.ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	launcher, err := auth.CreateToken(dir, "launcher", auth.ScopeLaunch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The listener serves TLS only.
+	var resp *protocol.Response
+	for i := 0; ; i++ {
+		if resp, err = wsRequest(t, url, reader, roots, &protocol.Request{Type: "ListSessions"}); err == nil {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("websocket listener not available: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if resp.Type != "SessionList" {
+		t.Fatalf("expected SessionList, got %s: %s", resp.Type, resp.Message)
+	}
+	if _, err := wsRequest(t, "ws://"+addr+"/ws", admin, nil, &protocol.Request{Type: "ListSessions"}); err == nil {
+		t.Fatal("expected plain WebSocket to fail against the TLS listener")
+	}
+
+	launch := &protocol.Request{Type: "Launch", Command: []string{"sleep", "30"}, WorkingDir: "/tmp"}
+	if resp, _ = wsRequest(t, url, reader, roots, launch); resp.Type != "Error" || !strings.Contains(resp.Message, "launch scope") {
+		t.Fatalf("expected read token to be refused Launch, got %s: %s", resp.Type, resp.Message)
+	}
+	if resp, _ = wsRequest(t, url, launcher, roots, launch); resp.Type != "Launched" {
+		t.Fatalf("expected launch token to launch, got %s: %s", resp.Type, resp.Message)
+	}
+	if resp, _ = wsRequest(t, url, launcher, roots, &protocol.Request{Type: "KillAll"}); resp.Type != "Error" {
+		t.Fatalf("expected launch token to be refused KillAll, got %s", resp.Type)
+	}
+	if resp, _ = wsRequest(t, url, admin, roots, &protocol.Request{Type: "KillAll"}); resp.Type != "KilledAll" {
+		t.Fatalf("expected main token to kill all, got %s: %s", resp.Type, resp.Message)
+	}
+
+	// Revoked and rotated tokens stop working without a restart.
+	if err := auth.RevokeToken(dir, "reader"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wsRequest(t, url, reader, roots, &protocol.Request{Type: "ListSessions"}); err == nil {
+		t.Fatal("expected revoked token to be refused")
+	}
+	rotated, err := auth.RotateToken(dir, "launcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wsRequest(t, url, launcher, roots, &protocol.Request{Type: "ListSessions"}); err == nil {
+		t.Fatal("expected the token replaced by rotation to be refused")
+	}
+	if resp, err = wsRequest(t, url, rotated, roots, &protocol.Request{Type: "ListSessions"}); err != nil || resp.Type != "SessionList" {
+		t.Fatalf("expected rotated token to work, got %v", err)
+	}
+
+	// The Unix socket is unaffected.
+	if resp := requestResponse(t, sock, &protocol.Request{Type: "KillAll"}); resp.Type != "KilledAll" {
+		t.Fatalf("expected KilledAll over the Unix socket, got %s", resp.Type)
+	}
+}